@@ -0,0 +1,380 @@
+// Command loadgen drives a running orchestrator with synthetic panels. Each
+// panel connects over the session's socket like a real one, streams message
+// updates into a session of its own making and times the events it is sent.
+// At the end it reports update throughput, update and event latency
+// percentiles, the events the server dropped and how the save queue held up.
+//
+//	loadgen -session mysession -panels 300 -rate 5 -duration 1m
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/metrics"
+	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// panelTypes are cycled through so the synthetic panels resemble a real mix
+var panelTypes = []string{"messages", "sessions", "input", "controller", "diff"}
+
+type config struct {
+	socketPath string
+	panels     int
+	rate       float64 // Updates per second per panel
+	size       int     // Bytes of message content per update
+	duration   time.Duration
+	ramp       time.Duration // Connects are spread over this long
+	messages   int           // Updates streamed into a message before the panel starts a new one
+	cleanup    bool
+}
+
+func main() {
+	var cfg config
+	session := flag.String("session", "opencode", "Session whose orchestrator to load")
+	flag.StringVar(&cfg.socketPath, "socket", "", "Socket to connect to, overriding -session")
+	flag.IntVar(&cfg.panels, "panels", 200, "Synthetic panels to connect")
+	flag.Float64Var(&cfg.rate, "rate", 2, "Updates per second sent by each panel")
+	flag.IntVar(&cfg.size, "size", 512, "Bytes of message content sent in each update")
+	flag.DurationVar(&cfg.duration, "duration", 30*time.Second, "How long to generate load once every panel is connected")
+	flag.DurationVar(&cfg.ramp, "ramp", 5*time.Second, "Time over which the panels connect")
+	flag.IntVar(&cfg.messages, "stream", 20, "Updates streamed into each message before a panel starts the next")
+	flag.BoolVar(&cfg.cleanup, "cleanup", true, "Delete the load session and its messages afterwards")
+	logPath := flag.String("log", "", "File for the panels' client logs; discarded by default")
+	flag.Parse()
+
+	if cfg.panels < 1 || cfg.rate <= 0 || cfg.size < 1 || cfg.duration <= 0 || cfg.ramp < 0 || cfg.messages < 1 {
+		log.Fatal("-panels, -rate, -size, -duration and -stream must be positive and -ramp not negative")
+	}
+	if cfg.socketPath == "" {
+		cfg.socketPath = paths.NewPathManager(*session).SocketPath()
+	}
+
+	// Hundreds of clients logging every request would drown the report
+	log.SetOutput(io.Discard)
+	if *logPath != "" {
+		file, err := os.OpenFile(*logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		log.SetOutput(file)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if err := run(ctx, cfg); err != nil {
+		fmt.Fprintf(os.Stderr, "loadgen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// results collects what the panels measured
+type results struct {
+	updates       atomic.Int64
+	failedUpdates atomic.Int64
+	events        atomic.Int64
+	connected     atomic.Int64
+	connectErrors atomic.Int64
+
+	mutex         sync.Mutex
+	updateLatency metrics.Histogram // Update sent until the server applied it
+	eventLatency  metrics.Histogram // Event applied until a panel received it
+	firstError    error
+}
+
+func (r *results) recordUpdate(latency time.Duration, err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if err != nil {
+		r.failedUpdates.Add(1)
+		if r.firstError == nil {
+			r.firstError = err
+		}
+		return
+	}
+	r.updates.Add(1)
+	r.updateLatency.Record(latency)
+}
+
+func (r *results) recordEvent(latency time.Duration) {
+	r.events.Add(1)
+	r.mutex.Lock()
+	r.eventLatency.Record(max(latency, 0))
+	r.mutex.Unlock()
+}
+
+func run(ctx context.Context, cfg config) error {
+	runID := fmt.Sprintf("loadgen-%d", os.Getpid())
+	monitor := ipc.NewSocketClient(cfg.socketPath, runID+"-monitor", "controller")
+	if err := monitor.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", cfg.socketPath, err)
+	}
+	defer monitor.Disconnect()
+
+	before, err := monitor.GetDiagnostics(0)
+	if err != nil {
+		return fmt.Errorf("failed to read diagnostics: %w", err)
+	}
+
+	sessionID := runID
+	if _, err := sendUpdate(monitor, types.SessionAdded, types.SessionAddPayload{Session: types.SessionInfo{
+		ID:        sessionID,
+		Title:     "Load test " + time.Now().Format(time.DateTime),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}}); err != nil {
+		return fmt.Errorf("failed to create the load session: %w", err)
+	}
+	if cfg.cleanup {
+		defer deleteSession(monitor, sessionID)
+	}
+
+	// Connect the panels, spread over the ramp
+	fmt.Printf("Connecting %d panels to %s over %v\n", cfg.panels, cfg.socketPath, cfg.ramp)
+	res := &results{}
+	clients := make([]*ipc.SocketClient, cfg.panels)
+	var connecting sync.WaitGroup
+	for i := range clients {
+		delay := time.Duration(0)
+		if cfg.panels > 1 {
+			delay = cfg.ramp * time.Duration(i) / time.Duration(cfg.panels-1)
+		}
+		connecting.Add(1)
+		go func(i int) {
+			defer connecting.Done()
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay):
+			}
+			client := ipc.NewSocketClient(cfg.socketPath, fmt.Sprintf("%s-%d", runID, i), panelTypes[i%len(panelTypes)])
+			client.RegisterEventHandler("*", func(event types.StateEvent) error {
+				if !event.Timestamp.IsZero() {
+					res.recordEvent(time.Since(event.Timestamp))
+				}
+				return nil
+			})
+			if err := client.Connect(); err != nil {
+				res.connectErrors.Add(1)
+				fmt.Fprintf(os.Stderr, "Panel %d failed to connect: %v\n", i, err)
+				return
+			}
+			res.connected.Add(1)
+			clients[i] = client
+		}(i)
+	}
+	connecting.Wait()
+	defer func() {
+		for _, client := range clients {
+			if client != nil {
+				client.Disconnect()
+			}
+		}
+	}()
+	if ctx.Err() != nil {
+		return nil
+	}
+
+	// Generate the load, sampling the save queue meanwhile
+	fmt.Printf("%d panels connected; sending %.1f updates/s each for %v\n", res.connected.Load(), cfg.rate, cfg.duration)
+	loadCtx, cancel := context.WithTimeout(ctx, cfg.duration)
+	defer cancel()
+	var sending sync.WaitGroup
+	for i, client := range clients {
+		if client == nil {
+			continue
+		}
+		sending.Add(1)
+		go func(i int, client *ipc.SocketClient) {
+			defer sending.Done()
+			streamMessages(loadCtx, cfg, client, res, sessionID, fmt.Sprintf("%s-%d", runID, i))
+		}(i, client)
+	}
+	started := time.Now()
+	maxDepth, capacity := sampleSaveQueue(loadCtx, monitor)
+	sending.Wait()
+	elapsed := time.Since(started)
+
+	// Let the last events arrive before reading the server's counters
+	time.Sleep(time.Second)
+	after, err := monitor.GetDiagnostics(0)
+	if err != nil {
+		return fmt.Errorf("failed to read diagnostics: %w", err)
+	}
+	report(cfg, res, clients, runID, before, after, elapsed, maxDepth, capacity)
+	return nil
+}
+
+// streamMessages has a panel stream updates into messages of its own, as an
+// assistant reply would, at the configured rate until ctx is done
+func streamMessages(ctx context.Context, cfg config, client *ipc.SocketClient, res *results, sessionID, prefix string) {
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / cfg.rate))
+	defer ticker.Stop()
+
+	content := strings.Repeat("x", cfg.size)
+	messageID := ""
+	for sent := 0; ; sent++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		var latency time.Duration
+		var err error
+		if sent%cfg.messages == 0 {
+			messageID = fmt.Sprintf("%s-m%d", prefix, sent/cfg.messages)
+			latency, err = sendUpdate(client, types.MessageAdded, types.MessageAddPayload{Message: types.MessageInfo{
+				ID:        messageID,
+				SessionID: sessionID,
+				Type:      "assistant",
+				Content:   content,
+				Status:    "streaming",
+				Timestamp: time.Now(),
+			}})
+		} else {
+			latency, err = sendUpdate(client, types.MessageUpdated, types.MessageUpdatePayload{
+				MessageID: messageID,
+				Content:   content,
+			})
+		}
+		if ctx.Err() != nil {
+			return // Cut short by the end of the run
+		}
+		res.recordUpdate(latency, err)
+	}
+}
+
+// sendUpdate applies an update and returns how long the server took to answer
+func sendUpdate(client *ipc.SocketClient, updateType types.UpdateType, payload interface{}) (time.Duration, error) {
+	started := time.Now()
+	_, err := client.SendStateUpdateAndWait(types.StateUpdate{
+		Type:            updateType,
+		ExpectedVersion: client.GetCurrentVersion(),
+		Payload:         payload,
+		Timestamp:       started,
+	})
+	return time.Since(started), err
+}
+
+// deleteSession removes the load session, confirming the deletion if the
+// server asks
+func deleteSession(client *ipc.SocketClient, sessionID string) {
+	update := types.StateUpdate{
+		Type:            types.SessionDeleted,
+		ExpectedVersion: client.GetCurrentVersion(),
+		Payload:         types.SessionDeletePayload{SessionID: sessionID},
+		Timestamp:       time.Now(),
+	}
+	_, err := client.SendStateUpdateAndWait(update)
+	var required *ipc.ConfirmationRequiredError
+	if errors.As(err, &required) {
+		update.ID = ""
+		update.ExpectedVersion = client.GetCurrentVersion()
+		update.ConfirmationToken = required.Token
+		_, err = client.SendStateUpdateAndWait(update)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to delete the load session %s: %v\n", sessionID, err)
+	}
+}
+
+// sampleSaveQueue polls the server's save queue until ctx is done and
+// returns the deepest it got and its capacity
+func sampleSaveQueue(ctx context.Context, monitor *ipc.SocketClient) (maxDepth, capacity int) {
+	ticker := time.NewTicker(250 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return maxDepth, capacity
+		case <-ticker.C:
+		}
+		diagnostics, err := monitor.GetDiagnostics(0)
+		if err != nil {
+			continue
+		}
+		maxDepth = max(maxDepth, diagnostics.Metrics.SaveQueueDepth)
+		capacity = diagnostics.Metrics.SaveQueueCapacity
+	}
+}
+
+func report(cfg config, res *results, clients []*ipc.SocketClient, runID string, before, after *interfaces.Diagnostics, elapsed time.Duration, maxDepth, capacity int) {
+	res.mutex.Lock()
+	updateLatency := res.updateLatency.Summary()
+	eventLatency := res.eventLatency.Summary()
+	firstError := res.firstError
+	res.mutex.Unlock()
+
+	var gaps int64
+	for _, client := range clients {
+		if client != nil {
+			gaps += client.Gaps()
+		}
+	}
+	var delivered, dropped, resyncs int64
+	lagging := 0
+	for _, subscriber := range after.Subscribers {
+		if !strings.HasPrefix(subscriber.PanelID, runID+"-") || strings.HasSuffix(subscriber.PanelID, "-monitor") {
+			continue
+		}
+		delivered += subscriber.Delivered
+		dropped += subscriber.Dropped
+		resyncs += subscriber.Resyncs
+		if subscriber.Lagging {
+			lagging++
+		}
+	}
+
+	seconds := elapsed.Seconds()
+	fmt.Printf("\nPanels:    %d connected, %d failed to connect\n", res.connected.Load(), res.connectErrors.Load())
+	fmt.Printf("Updates:   %d applied, %d failed, %.1f/s (target %.1f/s)\n",
+		res.updates.Load(), res.failedUpdates.Load(), float64(res.updates.Load())/seconds, cfg.rate*float64(res.connected.Load()))
+	if firstError != nil {
+		fmt.Printf("           first failure: %v\n", firstError)
+	}
+	printLatency("Update latency", updateLatency)
+	fmt.Printf("Events:    %d received, %.1f/s\n", res.events.Load(), float64(res.events.Load())/seconds)
+	printLatency("Event latency", eventLatency)
+
+	dropRate := 0.0
+	if offered := delivered + dropped; offered > 0 {
+		dropRate = float64(dropped) / float64(offered) * 100
+	}
+	fmt.Printf("Delivery:  %d queued, %d dropped (%.2f%%), %d resyncs, %d gaps seen by panels, %d panels lagging\n",
+		delivered, dropped, dropRate, resyncs, gaps, lagging)
+
+	saves := after.Metrics.TotalSaves - before.Metrics.TotalSaves
+	fmt.Printf("Saves:     %d written, %d failed, %d coalesced into queued saves, %.1f/s\n",
+		saves, after.Metrics.FailedSaves-before.Metrics.FailedSaves,
+		after.Metrics.CoalescedSaves-before.Metrics.CoalescedSaves, float64(saves)/seconds)
+	fmt.Printf("           queue deepest at %d of %d, %d slow saves\n",
+		maxDepth, capacity, after.Metrics.SlowSaves-before.Metrics.SlowSaves)
+	printLatency("Save latency", after.Metrics.SaveLatency) // Since the server started
+}
+
+func printLatency(name string, summary metrics.LatencySummary) {
+	if summary.Count == 0 {
+		fmt.Printf("%-15s none recorded\n", name+":")
+		return
+	}
+	fmt.Printf("%-15s p50 %v, p95 %v, p99 %v, max %v\n", name+":",
+		summary.P50.Round(time.Microsecond), summary.P95.Round(time.Microsecond),
+		summary.P99.Round(time.Microsecond), summary.Max.Round(time.Microsecond))
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	controllerpanel "github.com/opencode/tmux_coder/internal/panels/controller"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := controllerpanel.DefaultRunConfig()
+	if err != nil {
+		log.Fatalf("controller panel config error: %v", err)
+	}
+
+	if err := controllerpanel.Run(ctx, cfg); err != nil {
+		log.Fatalf("controller panel exited: %v", err)
+	}
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os/signal"
+	"syscall"
+
+	diffpanel "github.com/opencode/tmux_coder/internal/panels/diff"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := diffpanel.DefaultRunConfig()
+	if err != nil {
+		log.Fatalf("diff panel config error: %v", err)
+	}
+
+	if err := diffpanel.Run(ctx, cfg); err != nil {
+		log.Fatalf("diff panel exited: %v", err)
+	}
+}
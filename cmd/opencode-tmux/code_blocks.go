@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/editor"
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// extractCodeBlocks stores the code blocks of the assistant reply an event
+// is about once the reply is complete. Replies whose blocks are already
+// stored are left alone, so repeated updates of a finished reply cost a parse.
+func (orch *TmuxOrchestrator) extractCodeBlocks(event types.StateEvent) {
+	messageID := eventMessageID(event)
+	if messageID == "" {
+		return
+	}
+	message, ok := orch.syncManager.GetState().GetMessageByID(messageID)
+	if !ok || message.Type != "assistant" || message.Status != "completed" {
+		return
+	}
+	body, err := orch.messageBody(message)
+	if err != nil {
+		log.Printf("[CODEBLOCKS] Failed to read message %s: %v", message.ID, err)
+		return
+	}
+	blocks := codeblocks.Extract(body)
+	if reflect.DeepEqual(blocks, message.CodeBlocks) {
+		return
+	}
+	if err := orch.applyCodeBlockUpdate(types.CodeBlocksExtracted, types.CodeBlocksPayload{MessageID: message.ID, Blocks: blocks}); err != nil {
+		log.Printf("[CODEBLOCKS] Failed to store code blocks of message %s: %v", message.ID, err)
+	}
+}
+
+// applyCodeBlockTool names the changes proposed from code blocks among file diffs
+const applyCodeBlockTool = "apply_code_block"
+
+// handleCodeBlockAction copies, saves, opens or proposes to apply a code block
+// and records the outcome
+func (orch *TmuxOrchestrator) handleCodeBlockAction(action types.UIAction, args types.CodeBlockArgs) {
+	result := types.CodeBlockHandledPayload{MessageID: args.MessageID, Index: args.Index, Action: action}
+	code, block, err := orch.codeBlock(args.MessageID, args.Index)
+	if err == nil {
+		switch action {
+		case types.UIActionCopyCodeBlock:
+			err = orch.copyToClipboard(code)
+		case types.UIActionSaveCodeBlock:
+			result.Path, err = saveCodeBlock(code, codeBlockFileName(args.MessageID, block), args.Path)
+		case types.UIActionOpenCodeBlock:
+			err = orch.openCodeBlockPane(code, codeBlockFileName(args.MessageID, block))
+		case types.UIActionApplyCodeBlock:
+			result.Path, err = orch.proposeCodeBlock(args, code, block)
+		}
+	}
+	if err != nil {
+		result.Error = err.Error()
+		log.Printf("[CODEBLOCKS] %s of block %d of message %s failed: %v", action, args.Index, args.MessageID, err)
+	}
+	if err := orch.applyCodeBlockUpdate(types.CodeBlockHandled, result); err != nil {
+		log.Printf("[CODEBLOCKS] Failed to record %s of block %d of message %s: %v", action, args.Index, args.MessageID, err)
+	}
+}
+
+// codeBlock returns the code of a block extracted from a message
+func (orch *TmuxOrchestrator) codeBlock(messageID string, index int) (string, types.CodeBlock, error) {
+	message, ok := orch.syncManager.GetState().GetMessageByID(messageID)
+	if !ok {
+		return "", types.CodeBlock{}, fmt.Errorf("message %s not found", messageID)
+	}
+	block, ok := types.FindCodeBlock(message, index)
+	if !ok {
+		return "", types.CodeBlock{}, fmt.Errorf("message %s has no code block %d", messageID, index)
+	}
+	body, err := orch.messageBody(message)
+	if err != nil {
+		return "", types.CodeBlock{}, err
+	}
+	code, err := block.Code(body)
+	return code, block, err
+}
+
+// messageBody returns the full body of a message, reading it from the blob
+// store when it was offloaded
+func (orch *TmuxOrchestrator) messageBody(message types.MessageInfo) (string, error) {
+	if message.BodyRef == "" {
+		return message.Content, nil
+	}
+	data, err := orch.syncManager.GetBlob(message.BodyRef)
+	if err != nil {
+		return "", fmt.Errorf("failed to load body of message %s: %w", message.ID, err)
+	}
+	return string(data), nil
+}
+
+// copyToClipboard puts text in a tmux paste buffer, which tmux 3.2 and later
+// also hand to the terminal's clipboard
+func (orch *TmuxOrchestrator) copyToClipboard(text string) error {
+	var err error
+	for _, args := range [][]string{{"load-buffer", "-w", "-"}, {"load-buffer", "-"}} {
+		cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, args...)
+		cmd.Stdin = strings.NewReader(text)
+		var output []byte
+		if output, err = cmd.CombinedOutput(); err == nil {
+			return nil
+		}
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return fmt.Errorf("failed to copy to the tmux buffer: %w", err)
+}
+
+// proposeCodeBlock previews replacing a file with a code block as a pending
+// file diff; accepting the diff writes the file. The file is args.Path, or
+// the one the block's fence names. It returns the file's workspace path.
+func (orch *TmuxOrchestrator) proposeCodeBlock(args types.CodeBlockArgs, code string, block types.CodeBlock) (string, error) {
+	if orch.workspace == nil {
+		return "", fmt.Errorf("file diffs are disabled")
+	}
+	target := strings.TrimSpace(args.Path)
+	if target == "" {
+		target = block.Path
+	}
+	if target == "" {
+		return "", fmt.Errorf("code block %d names no file; give a path", block.Index+1)
+	}
+	path, rel, err := workspacePath(target)
+	if err != nil {
+		return "", err
+	}
+	base, err := codeblocks.FileHash(path)
+	if err != nil {
+		return "", err
+	}
+	content := []byte(withFinalNewline(code))
+	preview, err := orch.workspace.Preview(orch.ctx, rel, content)
+	if err != nil {
+		return "", fmt.Errorf("failed to preview the change: %w", err)
+	}
+	if preview.Patch == "" {
+		return "", fmt.Errorf("%s already holds this code", rel)
+	}
+
+	message, _ := orch.syncManager.GetState().GetMessageByID(args.MessageID)
+	diff := types.FileDiffSet{
+		ID:        ids.New("apply"),
+		SessionID: message.SessionID,
+		MessageID: message.ID,
+		Tool:      applyCodeBlockTool,
+		Files:     []types.FileDiff{preview},
+		Status:    types.FileDiffPending,
+		CreatedAt: time.Now(),
+		Proposal:  &types.CodeBlockProposal{MessageID: message.ID, Index: block.Index, Path: rel, BaseHash: base, CodeHash: codeblocks.Hash(content)},
+	}
+	update := types.StateUpdate{
+		ID:              ids.New("file_diff_" + diff.ID),
+		Type:            types.FileDiffReady,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.FileDiffReadyPayload{Diff: diff},
+		SourcePanel:     "filediff",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		return "", fmt.Errorf("failed to publish the preview: %w", err)
+	}
+	if !orch.serverOnly && orch.appConfig.Diffs.OpenPane {
+		if err := orch.openDiffPane(); err != nil {
+			log.Printf("[DIFF] Failed to open diff pane: %v", err)
+		}
+	}
+	return rel, nil
+}
+
+// applyProposal writes an accepted code block proposal to its file and notes
+// the change in the thread of the reply the block came from. The note is a
+// message of its own: state updates cannot carry opencode parts to append
+// to the reply. Only the code that was previewed is written; a block that
+// changed since, say by a redaction, is refused.
+func (orch *TmuxOrchestrator) applyProposal(diff types.FileDiffSet) error {
+	proposal := diff.Proposal
+	code, _, err := orch.codeBlock(proposal.MessageID, proposal.Index)
+	if err != nil {
+		return err
+	}
+	content := []byte(withFinalNewline(code))
+	if codeblocks.Hash(content) != proposal.CodeHash {
+		return fmt.Errorf("code block %d of message %s changed since the preview", proposal.Index+1, proposal.MessageID)
+	}
+	path, _, err := workspacePath(proposal.Path)
+	if err != nil {
+		return err
+	}
+	if err := codeblocks.WriteFile(path, content, proposal.BaseHash); err != nil {
+		return err
+	}
+
+	reply, _ := orch.syncManager.GetState().GetMessageByID(proposal.MessageID)
+	parent := reply.ParentID
+	if parent == "" {
+		// The reply starts its own thread
+		parent = reply.ID
+	}
+	note := types.MessageInfo{
+		ID:        ids.New("applied"),
+		SessionID: reply.SessionID,
+		ParentID:  parent,
+		Type:      "system",
+		Content:   fmt.Sprintf("Applied code block %d to %s", proposal.Index+1, proposal.Path),
+		Timestamp: time.Now(),
+		Status:    "completed",
+	}
+	if err := orch.syncManager.AddMessage(note, "orchestrator"); err != nil {
+		log.Printf("[CODEBLOCKS] Failed to note applying diff %s: %v", diff.ID, err)
+	}
+	return nil
+}
+
+// workspacePath resolves path against the workspace, returning it absolute
+// and relative to the workspace; paths leading out of it are refused. The
+// check is repeated with symlinks resolved, so a link cannot lead out either,
+// and the absolute path returned is the resolved one.
+func workspacePath(path string) (string, string, error) {
+	workDir, err := os.Getwd()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine the workspace: %w", err)
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(workDir, path)
+	}
+	path = filepath.Clean(path)
+	rel, ok := withinDir(workDir, path)
+	if !ok {
+		return "", "", fmt.Errorf("%s is outside the workspace", path)
+	}
+
+	realWorkDir, err := filepath.EvalSymlinks(workDir)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to determine the workspace: %w", err)
+	}
+	realPath, err := resolveExisting(path)
+	if err != nil {
+		return "", "", err
+	}
+	if _, ok := withinDir(realWorkDir, realPath); !ok {
+		return "", "", fmt.Errorf("%s leads outside the workspace", path)
+	}
+	return realPath, rel, nil
+}
+
+// withinDir returns path relative to dir, reporting whether it lies below dir
+func withinDir(dir, path string) (string, bool) {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return rel, true
+}
+
+// resolveExisting resolves the symlinks of the longest part of path that
+// exists, keeping the rest, which is yet to be created, as it is
+func resolveExisting(path string) (string, error) {
+	var missing []string
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, missing...)...), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+		}
+		missing = append([]string{filepath.Base(path)}, missing...)
+		path = parent
+	}
+}
+
+// withFinalNewline ends non-empty code with a newline, as files are
+func withFinalNewline(code string) string {
+	if code != "" && !strings.HasSuffix(code, "\n") {
+		return code + "\n"
+	}
+	return code
+}
+
+// saveCodeBlock writes code to path, relative to the workspace, or to name in
+// the workspace when path is empty. Existing files are never overwritten.
+func saveCodeBlock(code, name, path string) (string, error) {
+	if strings.TrimSpace(path) == "" {
+		path = name
+	}
+	path, _, err := workspacePath(path)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("%s already exists", path)
+	} else if err != nil {
+		return "", err
+	}
+	if _, err := file.WriteString(withFinalNewline(code)); err != nil {
+		file.Close()
+		return "", err
+	}
+	return path, file.Close()
+}
+
+// openCodeBlockPane opens code in the editor in a pane split off the messages
+// pane. The file is written next to the state and removed when the editor exits.
+func (orch *TmuxOrchestrator) openCodeBlockPane(code, name string) error {
+	if orch.serverOnly {
+		return fmt.Errorf("opening code blocks needs the tmux layout")
+	}
+	messagesPane := orch.getPaneTarget("messages", "messages")
+	if messagesPane == "" {
+		return fmt.Errorf("no messages pane to split")
+	}
+
+	dir := filepath.Join(filepath.Dir(orch.statePath), "codeblocks")
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(code), 0o600); err != nil {
+		return err
+	}
+
+	command := editor.Command()
+	args := []string{"split-window", "-h", "-t", messagesPane}
+	if orch.appConfig != nil {
+		if orch.appConfig.Editor.Command != "" {
+			command = orch.appConfig.Editor.Command
+		}
+		if orch.appConfig.Diffs.PaneSize != "" {
+			args = append(args, "-l", orch.appConfig.Diffs.PaneSize)
+		}
+	}
+	if workDir, err := os.Getwd(); err == nil {
+		args = append(args, "-c", workDir)
+	}
+	script := fmt.Sprintf("%s %s; rm -f %s", command, shellEscape(path), shellEscape(path))
+	if output, err := exec.CommandContext(orch.ctx, orch.tmuxCommand, append(args, script)...).CombinedOutput(); err != nil {
+		os.Remove(path)
+		return fmt.Errorf("failed to open a pane: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// codeBlockFileName names the file a block is saved or opened as, e.g.
+// "codeblock-msg_123-2.go" for the second block, written in Go
+func codeBlockFileName(messageID string, block types.CodeBlock) string {
+	safe := strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || ('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9') {
+			return r
+		}
+		return '_'
+	}, messageID)
+	return fmt.Sprintf("codeblock-%s-%d%s", safe, block.Index+1, codeblocks.Extension(block.Language))
+}
+
+// eventMessageID returns the ID of the message a message event is about
+func eventMessageID(event types.StateEvent) string {
+	var fields struct {
+		MessageID string            `json:"message_id"`
+		Message   types.MessageInfo `json:"message"`
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil || json.Unmarshal(data, &fields) != nil {
+		return ""
+	}
+	if fields.MessageID != "" {
+		return fields.MessageID
+	}
+	return fields.Message.ID
+}
+
+// applyCodeBlockUpdate applies an update made for code blocks to shared state
+func (orch *TmuxOrchestrator) applyCodeBlockUpdate(updateType types.UpdateType, payload interface{}) error {
+	return orch.syncManager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              ids.New("code_block"),
+		Type:            updateType,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         payload,
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	})
+}
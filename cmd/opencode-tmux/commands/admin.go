@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// adminCommands maps CLI admin command names to their IPC names
+var adminCommands = map[string]string{
+	"drain-saves":     "drain_saves",
+	"force-backup":    "force_backup",
+	"rotate-logs":     "rotate_logs",
+	"dump-goroutines": "dump_goroutines",
+	"debug":           "set_debug_logging",
+	"disconnect":      "disconnect_panel",
+	"force-sync":      "force_sync",
+	"restore-backup":  "restore_backup",
+	"respawn":         "respawn_panel",
+	"profile":         "write_profile",
+}
+
+// CmdAdmin implements the 'admin' subcommand
+func CmdAdmin(args []string) error {
+	fs := flag.NewFlagSet("admin", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux admin [options] [session-name] <command> [argument]\n\n")
+		fmt.Fprintf(os.Stderr, "Run a privileged command on a running session. Needs the session's admin\n")
+		fmt.Fprintf(os.Stderr, "token, which only the session owner can read.\n\n")
+		fmt.Fprintf(os.Stderr, "Commands:\n")
+		fmt.Fprintf(os.Stderr, "  drain-saves           Wait until every queued state save is written\n")
+		fmt.Fprintf(os.Stderr, "  force-backup          Back up the state now, off-site too when configured\n")
+		fmt.Fprintf(os.Stderr, "  rotate-logs           Move the daemon log to .1 and start a new one\n")
+		fmt.Fprintf(os.Stderr, "  dump-goroutines       Print the stack of every daemon goroutine\n")
+		fmt.Fprintf(os.Stderr, "  debug on|off          Toggle verbose daemon logging\n")
+		fmt.Fprintf(os.Stderr, "  disconnect <panel-id> Close a panel's IPC connection\n")
+		fmt.Fprintf(os.Stderr, "  force-sync            Save state and resend it in full to every panel\n")
+		fmt.Fprintf(os.Stderr, "  restore-backup [path] Replace live state with a backup, the newest valid one by default\n")
+		fmt.Fprintf(os.Stderr, "  respawn <panel>       Restart a panel's process in its pane\n")
+		fmt.Fprintf(os.Stderr, "  profile <kind> [secs] Write a cpu, heap, allocs, goroutine, block or mutex\n")
+		fmt.Fprintf(os.Stderr, "                        profile of the daemon; cpu, block and mutex sample\n")
+		fmt.Fprintf(os.Stderr, "                        for secs (default 30, at most 50)\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The session name is optional, so the first argument is it only when it is not a command
+	positional := fs.Args()
+	sessionName := "opencode"
+	if len(positional) > 0 {
+		if _, isCommand := adminCommands[positional[0]]; !isCommand {
+			sessionName = positional[0]
+			positional = positional[1:]
+		}
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no admin command given")
+	}
+
+	command, ok := adminCommands[positional[0]]
+	if !ok {
+		return fmt.Errorf("unknown admin command %q", positional[0])
+	}
+	params, err := adminParams(positional[0], positional[1:])
+	if err != nil {
+		return err
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+	token, err := ipc.ReadAdminToken(ipc.AdminTokenPath(socketPath))
+	if err != nil {
+		return err
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-admin-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	result, err := client.AdminCommand(token, command, params)
+	if err != nil {
+		return fmt.Errorf("admin %s failed: %w", positional[0], err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	printAdminResult(positional[0], result)
+	return nil
+}
+
+// adminParams builds the parameters of an admin command from its arguments
+func adminParams(name string, args []string) (map[string]interface{}, error) {
+	switch name {
+	case "debug":
+		if len(args) != 1 || (args[0] != "on" && args[0] != "off") {
+			return nil, fmt.Errorf("usage: admin debug on|off")
+		}
+		return map[string]interface{}{"enabled": args[0] == "on"}, nil
+	case "disconnect":
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			return nil, fmt.Errorf("usage: admin disconnect <panel-id>")
+		}
+		return map[string]interface{}{"panel_id": args[0]}, nil
+	case "restore-backup":
+		if len(args) > 1 {
+			return nil, fmt.Errorf("usage: admin restore-backup [path]")
+		}
+		if len(args) == 1 {
+			return map[string]interface{}{"path": args[0]}, nil
+		}
+		return nil, nil
+	case "respawn":
+		if len(args) != 1 || strings.TrimSpace(args[0]) == "" {
+			return nil, fmt.Errorf("usage: admin respawn <panel>")
+		}
+		return map[string]interface{}{"panel": args[0]}, nil
+	case "profile":
+		if len(args) < 1 || len(args) > 2 {
+			return nil, fmt.Errorf("usage: admin profile <kind> [seconds]")
+		}
+		params := map[string]interface{}{"kind": args[0]}
+		if len(args) == 2 {
+			seconds, err := strconv.ParseFloat(args[1], 64)
+			if err != nil || seconds <= 0 {
+				return nil, fmt.Errorf("seconds must be a positive number, got %q", args[1])
+			}
+			params["seconds"] = seconds
+		}
+		return params, nil
+	}
+	if len(args) > 0 {
+		return nil, fmt.Errorf("admin %s takes no arguments", name)
+	}
+	return nil, nil
+}
+
+// printAdminResult prints the interesting part of an admin response
+func printAdminResult(name string, result map[string]interface{}) {
+	switch name {
+	case "drain-saves":
+		fmt.Printf("Save queue drained in %vms\n", result["duration_ms"])
+	case "force-backup":
+		if backup, ok := result["backup"].(map[string]interface{}); ok {
+			fmt.Printf("Backup written: %v\n", backup["path"])
+		} else {
+			fmt.Println("Backup written")
+		}
+	case "rotate-logs":
+		fmt.Printf("Log rotated to %v\n", result["rotated"])
+	case "dump-goroutines":
+		fmt.Print(result["goroutines"])
+	case "debug":
+		if enabled, _ := result["enabled"].(bool); enabled {
+			fmt.Println("Debug logging enabled")
+		} else {
+			fmt.Println("Debug logging disabled")
+		}
+	case "disconnect":
+		fmt.Printf("Closed %v connection(s)\n", result["disconnected"])
+	case "force-sync":
+		fmt.Println("Full state sync sent to every panel")
+	case "restore-backup":
+		if backup, ok := result["backup"].(map[string]interface{}); ok {
+			fmt.Printf("State restored from %v\n", backup["path"])
+		} else {
+			fmt.Println("State restored")
+		}
+	case "respawn":
+		fmt.Printf("Panel %v respawned\n", result["panel"])
+	case "profile":
+		fmt.Printf("Profile written to %v\n", result["path"])
+		fmt.Printf("Inspect it with: go tool pprof %v\n", result["path"])
+	}
+}
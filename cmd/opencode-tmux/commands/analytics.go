@@ -0,0 +1,107 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// CmdAnalytics implements the 'analytics' subcommand
+func CmdAnalytics(args []string) error {
+	fs := flag.NewFlagSet("analytics", flag.ExitOnError)
+	days := fs.Int("days", 7, "Number of days to cover, ending today (0 for all retained history)")
+	session := fs.String("session", "", "Only count activity in this session ID")
+	idleGap := fs.Duration("idle-gap", analytics.DefaultIdleGap, "Longest pause still counted as active time")
+	csvPath := fs.String("csv", "", "Write the report as CSV to this file ('-' for stdout)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux analytics [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Show messages, tokens, tool runs and active time per day, from the state journal.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux analytics --days 30 --csv usage.csv mysession\n")
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	query := analytics.Query{SessionID: *session, IdleGap: *idleGap}
+	if *days > 0 {
+		// Whole days: today and the days before it
+		year, month, day := time.Now().Date()
+		query.Since = time.Date(year, month, day-(*days-1), 0, 0, 0, 0, time.Local)
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-analytics-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	report, err := client.QueryAnalytics(query)
+	if err != nil {
+		return fmt.Errorf("failed to query analytics: %w", err)
+	}
+
+	switch {
+	case *csvPath == "-":
+		return analytics.WriteCSV(os.Stdout, report)
+	case *csvPath != "":
+		file, err := os.Create(*csvPath)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *csvPath, err)
+		}
+		if err := analytics.WriteCSV(file, report); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write %s: %w", *csvPath, err)
+		}
+		if err := file.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", *csvPath, err)
+		}
+		fmt.Printf("Wrote %d days to %s\n", len(report.Days), *csvPath)
+		return nil
+	case *jsonOutput:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+
+	if len(report.Days) == 0 {
+		fmt.Println("No activity recorded")
+		return nil
+	}
+	if !report.HistoryStart.IsZero() && report.HistoryStart.After(query.Since) {
+		fmt.Printf("History starts %s; earlier activity is not counted\n\n", timefmt.DateTime(report.HistoryStart))
+	}
+
+	fmt.Printf("%-10s  %6s  %9s  %10s  %5s  %8s  %8s\n", "DATE", "USER", "ASSISTANT", "TOKENS", "TOOLS", "ACTIVE", "SESSIONS")
+	for _, day := range append(report.Days, report.Total) {
+		fmt.Printf("%-10s  %6d  %9d  %10d  %5d  %8s  %8d\n",
+			day.Date, day.UserMessages, day.AssistantMessages, day.Tokens,
+			day.ToolRuns, day.ActiveTime.Round(time.Minute), day.Sessions)
+	}
+
+	return nil
+}
@@ -38,8 +38,9 @@ func CmdAttach(args []string) error {
 
 	sessionName := getSessionName(fs.Args())
 
-	// Check if session exists
-	if !sessionExists(sessionName) {
+	// Check if session exists, as a tmux session or a window of another
+	status := checkSessionStatus(sessionName)
+	if !status.TmuxRunning {
 		// If auto-start is enabled, create the session
 		if *autoStart {
 			fmt.Printf("Session '%s' does not exist, creating it with --auto-start\n", sessionName)
@@ -52,8 +53,7 @@ func CmdAttach(args []string) error {
 	}
 
 	// Check if daemon is running
-	daemonRunning := isDaemonRunning(sessionName)
-	if !daemonRunning {
+	if !status.DaemonRunning {
 		if *autoStart {
 			fmt.Printf("Daemon not running for session '%s', starting it with --auto-start\n", sessionName)
 			log.Printf("Auto-starting daemon for orphaned session '%s'", sessionName)
@@ -76,7 +76,18 @@ func CmdAttach(args []string) error {
 	// Attach to session
 	log.Printf("Attaching to session '%s'", sessionName)
 
-	tmuxArgs := []string{"attach-session", "-t", sessionName}
+	tmuxSession := sessionName
+	if status.Host.Host != "" {
+		tmuxSession = status.Host.Host
+		if err := exec.Command("tmux", "select-window", "-t", status.Host.WindowID).Run(); err != nil {
+			log.Printf("Failed to select window %s: %v", status.Host.WindowID, err)
+		}
+	}
+	tmuxArgs := []string{"attach-session", "-t", tmuxSession}
+	if inTmuxSession() {
+		// Attaching would nest tmux; move this client over instead
+		tmuxArgs = []string{"switch-client", "-t", tmuxSession}
+	}
 	if *readOnly {
 		tmuxArgs = append(tmuxArgs, "-r")
 	}
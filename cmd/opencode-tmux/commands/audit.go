@@ -0,0 +1,92 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// CmdAudit implements the 'audit' subcommand
+func CmdAudit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ExitOnError)
+	updateType := fs.String("type", "", "Only show updates of this type (e.g. session_deleted)")
+	panel := fs.String("panel", "", "Only show updates from this source panel")
+	target := fs.String("target", "", "Only show updates touching this session, message or annotation ID")
+	since := fs.Duration("since", 0, "Only show updates newer than this duration (e.g. 2h)")
+	limit := fs.Int("limit", 50, "Show at most this many of the most recent entries (0 for all)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux audit [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Show which panel applied which state updates, and when.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux audit --type session_deleted --target ses_123 mysession\n")
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	filter := audit.Filter{
+		Type:        *updateType,
+		SourcePanel: *panel,
+		Target:      *target,
+		Limit:       *limit,
+	}
+	if *since > 0 {
+		filter.Since = time.Now().Add(-*since)
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-audit-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	entries, err := client.QueryAudit(filter)
+	if err != nil {
+		return fmt.Errorf("failed to query audit log: %w", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	if len(entries) == 0 {
+		fmt.Println("No matching audit entries")
+		return nil
+	}
+
+	fmt.Printf("%-19s  %-22s  %-20s  %-24s  %s\n", "TIME", "TYPE", "PANEL", "TARGET", "VERSION")
+	for _, entry := range entries {
+		fmt.Printf("%-19s  %-22s  %-20s  %-24s  %d -> %d\n",
+			timefmt.DateTime(entry.Timestamp),
+			entry.Type, entry.SourcePanel, entry.Target,
+			entry.VersionBefore, entry.VersionAfter)
+	}
+
+	return nil
+}
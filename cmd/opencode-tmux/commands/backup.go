@@ -0,0 +1,292 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// CmdBackup implements the 'backup' subcommand
+func CmdBackup(args []string) error {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux backup <action> [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Actions:\n")
+		fmt.Fprintf(os.Stderr, "  verify       Check every backup's checksum and state, and report the newest restorable one\n")
+		fmt.Fprintf(os.Stderr, "  push         Copy the current state and its blobs to the configured off-site destinations\n")
+		fmt.Fprintf(os.Stderr, "  list-remote  List the state copies held by an off-site destination\n")
+		fmt.Fprintf(os.Stderr, "  restore      Restore the session's state from an off-site destination\n")
+		return nil
+	}
+
+	switch args[0] {
+	case "verify":
+		return cmdBackupVerify(args[1:])
+	case "push":
+		return cmdBackupPush(args[1:])
+	case "list-remote":
+		return cmdBackupListRemote(args[1:])
+	case "restore":
+		return cmdBackupRestore(args[1:])
+	default:
+		return fmt.Errorf("unknown backup action: %s", args[0])
+	}
+}
+
+func cmdBackupVerify(args []string) error {
+	fs := flag.NewFlagSet("backup verify", flag.ExitOnError)
+	statePath := fs.String("state", "", "State file whose backups to verify (default: the session's state file)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux backup verify [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Load each backup of the session's state, validate checksums and state\n")
+		fmt.Fprintf(os.Stderr, "invariants, and report which backups can be restored. Exits non-zero\n")
+		fmt.Fprintf(os.Stderr, "if any backup fails verification. Safe to run while the daemon is up.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	path := resolveBackupStatePath(*statePath, sessionName)
+	fileManager := persistence.NewFileManager(persistence.DefaultFileManagerConfig(path))
+	report := persistence.NewBackupManager(fileManager).VerifyAll()
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		fmt.Printf("Backups of %s\n\n", path)
+		if len(report.Backups) == 0 {
+			fmt.Println("No backups found")
+			return nil
+		}
+
+		fmt.Printf("%-8s  %-8s  %10s  %-19s  %s\n", "STATUS", "VERSION", "SIZE", "WRITTEN", "FILE")
+		for _, backup := range report.Backups {
+			fmt.Printf("%-8s  %-8d  %10d  %-19s  %s\n",
+				backup.Status, backup.StateVersion, backup.Size,
+				timefmt.DateTime(backup.Timestamp), backup.Path)
+			if backup.Error != "" {
+				fmt.Printf("          %s\n", backup.Error)
+			}
+		}
+		fmt.Println()
+
+		if newest := report.NewestRestorable; newest != nil {
+			fmt.Printf("Newest restorable: version %d (%s)\n", newest.StateVersion, newest.Path)
+		} else {
+			fmt.Println("Newest restorable: none")
+		}
+	}
+
+	if !report.Healthy() && len(report.Backups) > 0 {
+		return fmt.Errorf("backup verification failed")
+	}
+	return nil
+}
+
+// resolveBackupStatePath picks the state file: flag, then OPENCODE_STATE, then the session default
+func resolveBackupStatePath(flagValue, sessionName string) string {
+	if flagValue != "" {
+		return flagValue
+	}
+	if path := os.Getenv("OPENCODE_STATE"); path != "" {
+		return path
+	}
+	return paths.NewPathManager(sessionName).StatePath()
+}
+
+// remoteBackupFlags are shared by the actions that talk to off-site destinations
+type remoteBackupFlags struct {
+	configPath  string
+	statePath   string
+	destination string
+}
+
+func (f *remoteBackupFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.configPath, "config", "", "Configuration file with the backup destinations (required)")
+	fs.StringVar(&f.statePath, "state", "", "State file (default: the session's state file)")
+	fs.StringVar(&f.destination, "to", "", "Destination name (default: all for push, the first for others)")
+}
+
+// parseRemoteBackupArgs parses flags with the session name before or after them
+func parseRemoteBackupArgs(fs *flag.FlagSet, args []string) (string, error) {
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return "", err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+	return sessionName, nil
+}
+
+// destinations loads the configured destinations, narrowed to the one named by --to
+func (f *remoteBackupFlags) destinations() ([]persistence.BackupDestination, *config.BackupConfig, error) {
+	if f.configPath == "" {
+		return nil, nil, fmt.Errorf("--config is required to locate backup destinations")
+	}
+	cfg, err := config.LoadConfig(f.configPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, fmt.Errorf("invalid config: %w", err)
+	}
+	destinations, err := cfg.Backup.BuildDestinations()
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(destinations) == 0 {
+		return nil, nil, fmt.Errorf("no backup destinations configured in %s", f.configPath)
+	}
+	if f.destination == "" {
+		return destinations, &cfg.Backup, nil
+	}
+	for _, dest := range destinations {
+		if dest.Name() == f.destination {
+			return []persistence.BackupDestination{dest}, &cfg.Backup, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("unknown backup destination: %s", f.destination)
+}
+
+func cmdBackupPush(args []string) error {
+	fs := flag.NewFlagSet("backup push", flag.ExitOnError)
+	var flags remoteBackupFlags
+	flags.register(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux backup push --config <file> [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Copy the session's state and the blobs it references off-site now,\n")
+		fmt.Fprintf(os.Stderr, "pruning old copies beyond backup.keep. Safe to run while the daemon is up.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	sessionName, err := parseRemoteBackupArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	destinations, backupConfig, err := flags.destinations()
+	if err != nil {
+		return err
+	}
+
+	statePath := resolveBackupStatePath(flags.statePath, sessionName)
+	fileManagerConfig := persistence.DefaultFileManagerConfig(statePath)
+	remote := persistence.NewRemoteBackup(
+		persistence.NewFileManager(fileManagerConfig),
+		persistence.NewBlobStore(persistence.DefaultBlobDir(statePath), fileManagerConfig.FileMode, fileManagerConfig.DirMode),
+		persistence.RemoteBackupConfig{Keep: backupConfig.Keep, Destinations: destinations},
+	)
+
+	err = remote.CopyOffsite(context.Background())
+	stats := remote.GetStatistics()
+	fmt.Printf("Copied %s to %d of %d destination(s), %d new blob(s)\n",
+		statePath, stats.Copies, len(destinations), stats.BlobsSent)
+	return err
+}
+
+func cmdBackupListRemote(args []string) error {
+	fs := flag.NewFlagSet("backup list-remote", flag.ExitOnError)
+	var flags remoteBackupFlags
+	flags.register(fs)
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux backup list-remote --config <file> [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "List the session's state copies on each destination, newest first.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	sessionName, err := parseRemoteBackupArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	destinations, _, err := flags.destinations()
+	if err != nil {
+		return err
+	}
+
+	session := persistence.RemoteSessionName(resolveBackupStatePath(flags.statePath, sessionName))
+	for _, dest := range destinations {
+		names, err := persistence.ListRemoteStates(context.Background(), dest, session)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dest.Name(), err)
+		}
+		fmt.Printf("%s (%d copies)\n", dest.Name(), len(names))
+		for _, name := range names {
+			fmt.Printf("  %s\n", name)
+		}
+	}
+	return nil
+}
+
+func cmdBackupRestore(args []string) error {
+	fs := flag.NewFlagSet("backup restore", flag.ExitOnError)
+	var flags remoteBackupFlags
+	flags.register(fs)
+	name := fs.String("name", "", "State copy to restore, as shown by list-remote (default: newest)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux backup restore --config <file> [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Download a state copy and its blobs, verify them, and make them the\n")
+		fmt.Fprintf(os.Stderr, "session's state. The current state is kept in the local backup chain.\n")
+		fmt.Fprintf(os.Stderr, "The session must not be running.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	sessionName, err := parseRemoteBackupArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	destinations, _, err := flags.destinations()
+	if err != nil {
+		return err
+	}
+
+	// A running daemon would overwrite the restored state on its next save
+	if isSocketActive(getSocketPath(sessionName)) {
+		return fmt.Errorf("session %s is running; stop it before restoring", sessionName)
+	}
+
+	statePath := resolveBackupStatePath(flags.statePath, sessionName)
+	fileManagerConfig := persistence.DefaultFileManagerConfig(statePath)
+	state, err := persistence.RestoreFromRemote(context.Background(), destinations[0],
+		persistence.RemoteSessionName(statePath), *name,
+		persistence.NewFileManager(fileManagerConfig),
+		persistence.NewBlobStore(persistence.DefaultBlobDir(statePath), fileManagerConfig.FileMode, fileManagerConfig.DirMode))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from %s: version %d, %d session(s)\n",
+		statePath, destinations[0].Name(), state.Version.Version, len(state.Sessions))
+	return nil
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/session"
 )
 
 // contains checks if a string is in a slice
@@ -23,12 +24,13 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
-// getSessionName returns session name from args or default
+// getSessionName returns session name from args, or else the configured
+// session name as resolved for the current directory
 func getSessionName(args []string) string {
 	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
 		return args[0]
 	}
-	return "opencode"
+	return configuredSessionName()
 }
 
 // sessionExists checks if a tmux session exists
@@ -274,9 +276,11 @@ type SessionStatus struct {
 	TmuxRunning   bool
 	DaemonRunning bool
 	ClientCount   int
+	Host          session.HostedWindow // Window of another tmux session holding the panels, if any
 }
 
-// checkSessionStatus checks the status of a session
+// checkSessionStatus checks the status of a session, whose panels are either
+// a tmux session of their own or a window of another
 func checkSessionStatus(sessionName string) SessionStatus {
 	status := SessionStatus{
 		Name:          sessionName,
@@ -284,9 +288,17 @@ func checkSessionStatus(sessionName string) SessionStatus {
 		DaemonRunning: isDaemonRunning(sessionName),
 		ClientCount:   0,
 	}
+	tmuxSession := sessionName
+	if !status.TmuxRunning {
+		if hosted, ok := session.FindHostedWindow("tmux", sessionName); ok {
+			status.TmuxRunning = true
+			status.Host = hosted
+			tmuxSession = hosted.Host
+		}
+	}
 
 	if status.TmuxRunning {
-		count, err := getConnectedClientsCount(sessionName)
+		count, err := getConnectedClientsCount(tmuxSession)
 		if err == nil {
 			status.ClientCount = count
 		}
@@ -0,0 +1,150 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/conformance"
+)
+
+// CmdConformance implements the 'conformance' subcommand
+func CmdConformance(args []string) error {
+	fs := flag.NewFlagSet("conformance", flag.ExitOnError)
+	socketPath := fs.String("socket", "", "Socket the panel connects to (default: a temporary path)")
+	duration := fs.Duration("duration", conformance.DefaultDuration, "How long to watch the panel after it connects")
+	connectTimeout := fs.Duration("connect-timeout", conformance.DefaultConnectTimeout, "How long to wait for the panel to connect")
+	heartbeat := fs.Duration("heartbeat-timeout", conformance.DefaultHeartbeatTimeout, "Longest the panel may go without pinging")
+	panelLog := fs.String("panel-log", "", "Write the panel's output to this file instead of the terminal")
+	jsonOutput := fs.Bool("json", false, "Output the report in JSON format")
+	verbose := fs.Bool("verbose", false, "Show the harness server's log")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux conformance [options] [-- panel-command [args...]]\n\n")
+		fmt.Fprintf(os.Stderr, "Check that a panel speaks the orchestrator's IPC protocol: its handshake,\n")
+		fmt.Fprintf(os.Stderr, "heartbeats, event handling and state updates. The panel command is started\n")
+		fmt.Fprintf(os.Stderr, "with OPENCODE_SOCKET pointing at a test server; without one, start the panel\n")
+		fmt.Fprintf(os.Stderr, "yourself against the socket printed. Exits non-zero when a check fails.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux conformance --json -- ./my-panel --theme dark\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if !*verbose {
+		log.SetOutput(io.Discard)
+	}
+
+	harness, err := conformance.Listen(conformance.Options{
+		SocketPath:       *socketPath,
+		ConnectTimeout:   *connectTimeout,
+		Duration:         *duration,
+		HeartbeatTimeout: *heartbeat,
+	})
+	if err != nil {
+		return err
+	}
+	defer harness.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if fs.NArg() > 0 {
+		panel, err := startPanel(fs.Args(), harness.SocketPath(), *panelLog)
+		if err != nil {
+			return err
+		}
+		defer stopPanel(panel)
+	} else {
+		fmt.Fprintf(os.Stderr, "Waiting %v for a panel to connect with OPENCODE_SOCKET=%s\n", *connectTimeout, harness.SocketPath())
+	}
+
+	report, err := harness.Run(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+	} else {
+		printConformanceReport(report)
+	}
+
+	if failed := report.Failed(); len(failed) > 0 {
+		return fmt.Errorf("panel failed %d of %d conformance checks", len(failed), len(report.Results))
+	}
+	return nil
+}
+
+// startPanel runs the panel command against the harness
+func startPanel(command []string, socketPath, logPath string) (*exec.Cmd, error) {
+	panel := exec.Command(command[0], command[1:]...)
+	panel.Env = append(os.Environ(), "OPENCODE_SOCKET="+socketPath)
+	panel.Stdin = os.Stdin
+	panel.Stdout, panel.Stderr = os.Stdout, os.Stderr
+	if logPath != "" {
+		file, err := os.Create(logPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", logPath, err)
+		}
+		panel.Stdout, panel.Stderr = file, file
+	}
+	if err := panel.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start panel: %w", err)
+	}
+	return panel, nil
+}
+
+// stopPanel asks the panel to exit, then kills it if it has not within a few
+// seconds
+func stopPanel(panel *exec.Cmd) {
+	exited := make(chan struct{})
+	go func() {
+		panel.Wait()
+		if file, ok := panel.Stdout.(*os.File); ok && file != os.Stdout {
+			file.Close()
+		}
+		close(exited)
+	}()
+	panel.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-exited:
+	case <-time.After(3 * time.Second):
+		panel.Process.Kill()
+		<-exited
+	}
+}
+
+// printConformanceReport prints one line per check
+func printConformanceReport(report *conformance.Report) {
+	if report.PanelID != "" {
+		framing := report.Framing
+		if framing == "" {
+			framing = "json-lines"
+		}
+		fmt.Printf("Panel %s (%s), protocol %s, %s framing\n", report.PanelID, report.PanelType, report.ProtocolVersion, framing)
+		fmt.Printf("%d messages sent, %d events delivered in %v\n\n", report.MessagesSent, report.EventsDelivered, report.Duration.Round(time.Millisecond))
+	}
+	for _, result := range report.Results {
+		fmt.Printf("%-4s  %-10s  %s\n", strings.ToUpper(string(result.Status)), result.Name, result.Detail)
+	}
+	if report.Passed {
+		fmt.Println("\nAll checks passed")
+	}
+}
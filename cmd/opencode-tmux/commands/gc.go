@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// CmdGC implements the 'gc' subcommand
+func CmdGC(args []string) error {
+	fs := flag.NewFlagSet("gc", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Report what would be removed without removing anything")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux gc [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Remove temp files left by crashed processes, backups beyond the rotation\n")
+		fmt.Fprintf(os.Stderr, "limit and message blobs no longer referenced by the state or its backups.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-gc-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	stats, err := client.CollectGarbage(*dryRun)
+	if err != nil {
+		return fmt.Errorf("garbage collection failed: %w", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+
+	verb := "Removed"
+	if stats.DryRun {
+		verb = "Would remove"
+	}
+	fmt.Printf("%s %d temp files, %d backups, %d blobs (%d bytes)\n",
+		verb, stats.TempFilesRemoved, stats.BackupsRemoved, stats.BlobsRemoved, stats.BytesReclaimed)
+	for _, msg := range stats.Errors {
+		fmt.Printf("  error: %s\n", msg)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// CmdHistory implements the 'history' subcommand
+func CmdHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	version := fs.Int64("at", 0, "State version to show (required; find versions with 'opencode-tmux audit')")
+	sessionID := fs.String("session", "", "Only show messages of this session ID (default: the then-current session)")
+	jsonOutput := fs.Bool("json", false, "Output the full state in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux history --at <version> [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Show the state as it was at a past version, rebuilt from the state\n")
+		fmt.Fprintf(os.Stderr, "journal. Live state is not modified.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux audit --type messages_cleared mysession\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux history --at 1041 mysession\n")
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+	if *version <= 0 {
+		fs.Usage()
+		return fmt.Errorf("--at is required")
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-history-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	state, err := client.RequestStateAt(*version)
+	if err != nil {
+		return err
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(state)
+	}
+
+	fmt.Printf("State at version %d (%s)\n\n", state.Version.Version,
+		timefmt.DateTime(state.Version.Timestamp))
+	fmt.Printf("Sessions (%d):\n", len(state.Sessions))
+	for _, session := range state.Sessions {
+		marker := " "
+		if session.ID == state.CurrentSessionID {
+			marker = "*"
+		}
+		fmt.Printf("  %s %-24s  %-40s  %d messages\n", marker, session.ID, session.Title, session.MessageCount)
+	}
+
+	showSession := *sessionID
+	if showSession == "" {
+		showSession = state.CurrentSessionID
+	}
+	if showSession == "" {
+		return nil
+	}
+
+	fmt.Printf("\nMessages in %s:\n", showSession)
+	for i := range state.Messages {
+		msg := &state.Messages[i]
+		if msg.SessionID != showSession {
+			continue
+		}
+		// Blobs behind old versions may have been collected or redacted since
+		if err := client.ResolveMessageBody(msg); err != nil {
+			msg.Content = fmt.Sprintf("[body unavailable: %v]", err)
+		}
+		fmt.Printf("  [%s] %-9s %s\n", timefmt.Clock(msg.Timestamp), msg.Type, firstLine(msg.Content, 100))
+	}
+	return nil
+}
+
+// firstLine returns the first line of s, truncated to max runes
+func firstLine(s string, max int) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(s), "\n")
+	if runes := []rune(line); len(runes) > max {
+		return string(runes[:max-1]) + "…"
+	}
+	return line
+}
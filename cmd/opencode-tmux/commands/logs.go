@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/supervision"
+)
+
+// logsPollInterval is how often --follow checks the logs for new output
+const logsPollInterval = 500 * time.Millisecond
+
+// CmdLogs implements the 'logs' subcommand
+func CmdLogs(args []string) error {
+	fs := flag.NewFlagSet("logs", flag.ExitOnError)
+	panel := fs.String("panel", "", "Only show this panel's log (e.g. sessions, messages, input)")
+	lines := fs.Int("n", 20, "Lines to show from the end of each log")
+	follow := fs.Bool("follow", false, "Keep printing output as panels write it")
+	fs.BoolVar(follow, "f", false, "Shorthand for --follow")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux logs [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Show what panel processes wrote to stderr. The supervisor captures each\n")
+		fmt.Fprintf(os.Stderr, "panel's stderr to a rotating log and marks every start and restart in it.\n")
+		fmt.Fprintf(os.Stderr, "Inside tmux the session defaults to the current one.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux logs --panel messages -n 100 mysession\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux logs --follow\n")
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	explicit := len(args) > 0 && args[0] == sessionName
+	if explicit {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+		explicit = true
+	}
+	if current := getCurrentTmuxSession(); !explicit && current != "" {
+		sessionName = current
+	}
+
+	dir := paths.NewPathManager(sessionName).PanelLogDir()
+	logs, err := findPanelLogs(dir, *panel)
+	if err != nil {
+		return err
+	}
+	if len(logs) == 0 && !*follow {
+		if *panel != "" {
+			return fmt.Errorf("no log for panel '%s' in %s", *panel, dir)
+		}
+		return fmt.Errorf("no panel logs for session '%s' in %s", sessionName, dir)
+	}
+
+	prefixed := *panel == ""
+	for i, name := range logs {
+		tail, err := supervision.TailLines(filepath.Join(dir, name+".log"), *lines)
+		if err != nil {
+			return err
+		}
+		if !prefixed {
+			for _, line := range tail {
+				fmt.Println(line)
+			}
+			continue
+		}
+		if *follow {
+			for _, line := range tail {
+				fmt.Printf("[%s] %s\n", name, line)
+			}
+			continue
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Printf("==> %s <==\n", name)
+		for _, line := range tail {
+			fmt.Println(line)
+		}
+	}
+	if !*follow {
+		return nil
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return followPanelLogs(ctx, dir, *panel, os.Stdout, prefixed)
+}
+
+// findPanelLogs returns the names of the panels with a log in dir, or just
+// panel when it is set and has one
+func findPanelLogs(dir, panel string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".log")
+		if panel == "" || name == panel {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// followPanelLogs prints what is appended to the logs in dir until ctx ends,
+// picking up panels that start later and logs truncated by rotation
+func followPanelLogs(ctx context.Context, dir, panel string, out io.Writer, prefixed bool) error {
+	offsets := make(map[string]int64)
+	rotations := make(map[string]time.Time) // When each log's newest backup was written
+	partial := make(map[string]string)      // Output after the last newline, held back until the line ends
+	logs, err := findPanelLogs(dir, panel)
+	if err != nil {
+		return err
+	}
+	for _, name := range logs {
+		path := filepath.Join(dir, name+".log")
+		if info, err := os.Stat(path); err == nil {
+			offsets[name] = info.Size()
+		}
+		rotations[name] = backupTime(path)
+	}
+
+	ticker := time.NewTicker(logsPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		logs, err := findPanelLogs(dir, panel)
+		if err != nil {
+			return err
+		}
+		for _, name := range logs {
+			path := filepath.Join(dir, name+".log")
+			// Rotation truncates the log in place; by the time it is seen the
+			// panel may have written past the old offset again
+			if rotated := backupTime(path); !rotated.Equal(rotations[name]) {
+				rotations[name] = rotated
+				offsets[name] = 0
+			}
+			data, offset, err := readPanelLogFrom(path, offsets[name])
+			if err != nil {
+				continue
+			}
+			offsets[name] = offset
+			text := partial[name] + string(data)
+			end := strings.LastIndexByte(text, '\n')
+			partial[name] = text[end+1:]
+			if end < 0 {
+				continue
+			}
+			for _, line := range strings.Split(text[:end], "\n") {
+				if prefixed {
+					fmt.Fprintf(out, "[%s] %s\n", name, line)
+				} else {
+					fmt.Fprintln(out, line)
+				}
+			}
+		}
+	}
+}
+
+// backupTime returns when the log at path was last rotated, going by its
+// newest backup
+func backupTime(path string) time.Time {
+	info, err := os.Stat(path + ".1")
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// readPanelLogFrom returns what was written to path after offset and the new
+// offset. A file smaller than offset was truncated by rotation, so it is read
+// from the start.
+func readPanelLogFrom(path string, offset int64) ([]byte, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, offset, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return nil, offset, err
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if info.Size() == offset {
+		return nil, offset, nil
+	}
+	data, err := io.ReadAll(io.NewSectionReader(file, offset, info.Size()-offset))
+	if err != nil {
+		return nil, offset, err
+	}
+	return data, offset + int64(len(data)), nil
+}
@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// macroActions lists the macro subcommands and whether each takes a macro name
+var macroActions = map[string]bool{
+	"record": true,
+	"stop":   false,
+	"replay": true,
+	"list":   false,
+	"delete": true,
+}
+
+// CmdMacro implements the 'macro' subcommand
+func CmdMacro(args []string) error {
+	fs := flag.NewFlagSet("macro", flag.ExitOnError)
+	targetSession := fs.String("target-session", "", "Replay against this opencode session instead of the recorded one")
+	speed := fs.Float64("speed", 1, "Replay speed relative to the recording; 0 replays without pauses")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux macro [options] [session-name] <action> [macro-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Record prompts, UI actions and session changes into a named macro and\n")
+		fmt.Fprintf(os.Stderr, "replay them later. Macros are kept in ~/.opencode/macros.\n\n")
+		fmt.Fprintf(os.Stderr, "Actions:\n")
+		fmt.Fprintf(os.Stderr, "  record <name>  Start recording\n")
+		fmt.Fprintf(os.Stderr, "  stop           Stop recording and save the macro\n")
+		fmt.Fprintf(os.Stderr, "  replay <name>  Replay a macro in the background\n")
+		fmt.Fprintf(os.Stderr, "  list           List saved macros\n")
+		fmt.Fprintf(os.Stderr, "  delete <name>  Delete a saved macro\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The session name is optional, so the first argument is it only when it is not an action
+	positional := fs.Args()
+	sessionName := "opencode"
+	if len(positional) > 0 {
+		if _, isAction := macroActions[positional[0]]; !isAction {
+			sessionName = positional[0]
+			positional = positional[1:]
+		}
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no macro action given")
+	}
+
+	action := positional[0]
+	needsName, ok := macroActions[action]
+	if !ok {
+		return fmt.Errorf("unknown macro action %q", action)
+	}
+	name := ""
+	if needsName {
+		if len(positional) != 2 {
+			return fmt.Errorf("usage: macro %s <name>", action)
+		}
+		name = positional[1]
+	} else if len(positional) > 1 {
+		return fmt.Errorf("macro %s takes no arguments", action)
+	}
+	if *speed < 0 {
+		return fmt.Errorf("--speed cannot be negative")
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-macro-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	var result interface{}
+	switch action {
+	case "record":
+		if err := client.StartMacroRecording(name); err != nil {
+			return fmt.Errorf("macro record failed: %w", err)
+		}
+		result = map[string]string{"recording": name}
+		if !*jsonOutput {
+			fmt.Printf("Recording macro %s; run 'opencode-tmux macro stop' to save it\n", name)
+		}
+
+	case "stop":
+		info, err := client.StopMacroRecording()
+		if err != nil {
+			return fmt.Errorf("macro stop failed: %w", err)
+		}
+		result = info
+		if !*jsonOutput {
+			fmt.Printf("Saved macro %s with %d steps\n", info.Name, info.Steps)
+		}
+
+	case "replay":
+		info, err := client.ReplayMacro(name, macro.ReplayOptions{SessionID: *targetSession, Speed: *speed})
+		if err != nil {
+			return fmt.Errorf("macro replay failed: %w", err)
+		}
+		result = info
+		if !*jsonOutput {
+			fmt.Printf("Replaying macro %s (%d steps)\n", info.Name, info.Steps)
+		}
+
+	case "list":
+		macros, err := client.ListMacros()
+		if err != nil {
+			return fmt.Errorf("macro list failed: %w", err)
+		}
+		result = macros
+		if !*jsonOutput {
+			if len(macros) == 0 {
+				fmt.Println("No macros saved")
+			}
+			for _, info := range macros {
+				fmt.Printf("%-24s %3d steps  %8s  recorded %s\n",
+					info.Name, info.Steps, info.Duration.Round(time.Second), timefmt.DateTime(info.RecordedAt))
+			}
+		}
+
+	case "delete":
+		if err := client.DeleteMacro(name); err != nil {
+			return fmt.Errorf("macro delete failed: %w", err)
+		}
+		result = map[string]string{"deleted": name}
+		if !*jsonOutput {
+			fmt.Printf("Deleted macro %s\n", name)
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return nil
+}
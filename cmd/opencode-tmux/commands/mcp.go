@@ -0,0 +1,124 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/mcp"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// CmdMCP implements the 'mcp' subcommand
+func CmdMCP(args []string) error {
+	fs := flag.NewFlagSet("mcp", flag.ExitOnError)
+	readWrite := fs.Bool("read-write", false, "Also offer the append_note tool")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux mcp [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Serve the session's state over the Model Context Protocol on stdin/stdout,\n")
+		fmt.Fprintf(os.Stderr, "for use as a stdio MCP server by other AI tools. Read-only by default.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-mcp-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := mcp.NewServer(&mcpBackend{client: client}, *readWrite)
+	return server.Serve(ctx, os.Stdin, os.Stdout)
+}
+
+// mcpBackend reads state from the daemon on every request so answers are current
+type mcpBackend struct {
+	client *ipc.SocketClient
+}
+
+func (b *mcpBackend) Sessions() ([]types.SessionInfo, error) {
+	current, err := b.client.RequestState()
+	if err != nil {
+		return nil, err
+	}
+	return current.GetSessions(), nil
+}
+
+func (b *mcpBackend) Transcript(sessionID string) (*state.SessionExport, error) {
+	current, err := b.client.RequestState()
+	if err != nil {
+		return nil, err
+	}
+	session, ok := current.GetSessionByID(sessionID)
+	if !ok {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	export := &state.SessionExport{
+		ExportedAt:  time.Now(),
+		Version:     current.GetCurrentVersion(),
+		Session:     session,
+		Messages:    current.GetSessionMessages(sessionID),
+		Annotations: make([]types.MessageAnnotation, 0),
+	}
+	for i := range export.Messages {
+		// Offloaded bodies are fetched; a missing blob leaves the message empty
+		_ = b.client.ResolveMessageBody(&export.Messages[i])
+		export.Annotations = append(export.Annotations, current.GetAnnotations(export.Messages[i].ID)...)
+	}
+	return export, nil
+}
+
+func (b *mcpBackend) AppendNote(sessionID, messageID, text string) error {
+	if messageID == "" {
+		current, err := b.client.RequestState()
+		if err != nil {
+			return err
+		}
+		messages := current.GetSessionMessages(sessionID)
+		if len(messages) == 0 {
+			return fmt.Errorf("session %s has no messages to attach a note to", sessionID)
+		}
+		messageID = messages[len(messages)-1].ID
+	}
+
+	_, err := b.client.SendStateUpdateAndWait(types.StateUpdate{
+		Type: types.AnnotationAdded,
+		Payload: types.AnnotationAddPayload{Annotation: types.MessageAnnotation{
+			MessageID: messageID,
+			SessionID: sessionID,
+			Kind:      types.AnnotationNote,
+			Content:   text,
+			Author:    "mcp",
+		}},
+		Timestamp: time.Now(),
+	})
+	return err
+}
@@ -0,0 +1,112 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	tmuxconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/gitstatus"
+	"github.com/opencode/tmux_coder/internal/session"
+)
+
+// SessionNameOptions holds what resolving a session name template needs
+type SessionNameOptions struct {
+	Template    string                  // Configured session name, possibly with {dir}, {branch} and {n}
+	OnCollision session.CollisionPolicy // What to do when another project holds the name
+	Interactive bool                    // Whether In and Out reach a person, for CollisionPrompt
+
+	In  io.Reader
+	Out io.Writer
+}
+
+// SessionNameVars returns the session name template values for the current
+// directory: its repository root, or the directory outside one, and branch
+func SessionNameVars() session.NameVars {
+	dir, err := os.Getwd()
+	if err != nil {
+		return session.NameVars{}
+	}
+	ctx := context.Background()
+	return session.NameVars{Dir: gitstatus.Workspace(ctx, dir), Branch: gitstatus.Branch(ctx, dir)}
+}
+
+// ResolveSessionName returns the name of this project's session: the
+// template's first expansion, unless another project's tmux session holds
+// it. Then the collision policy picks the next free name, or that session
+// to attach to instead of starting one, which attach reports.
+func ResolveSessionName(opts SessionNameOptions) (name string, attach bool, err error) {
+	vars := SessionNameVars()
+	name, collided, err := session.ResolveName(opts.Template, vars, tmuxSessionProject)
+	if err != nil || !collided {
+		return name, false, err
+	}
+
+	taken := session.ExpandName(opts.Template, vars, 1)
+	policy := opts.OnCollision
+	if policy == session.CollisionPrompt {
+		if !opts.Interactive {
+			policy = session.CollisionSuffix
+		} else if policy, err = promptCollision(opts.In, opts.Out, taken, name); err != nil {
+			return "", false, err
+		}
+	}
+
+	if policy == session.CollisionAttach {
+		log.Printf("Session %s belongs to another project; attaching to it", taken)
+		return taken, true, nil
+	}
+	log.Printf("Session %s belongs to another project; starting %s", taken, name)
+	return name, false, nil
+}
+
+// configuredSessionName resolves the configured session name for commands
+// given none, without acting on collisions: this project's running session,
+// or the name starting one would take
+func configuredSessionName() string {
+	cfg, err := tmuxconfig.LoadSession(profileConfigPath())
+	if err != nil {
+		return "opencode"
+	}
+	name, _, err := session.ResolveName(cfg.Session.Name, SessionNameVars(), tmuxSessionProject)
+	if err != nil {
+		return session.ExpandName(cfg.Session.Name, SessionNameVars(), 1)
+	}
+	return name
+}
+
+// promptCollision asks whether to take the free name or attach to the
+// session holding the taken one
+func promptCollision(in io.Reader, out io.Writer, taken, free string) (session.CollisionPolicy, error) {
+	fmt.Fprintf(out, "Session %s belongs to another project.\n", taken)
+	fmt.Fprintf(out, "Choose an action: [s] Start %s (default) / [a] Attach to %s / [q] Exit: ", free, taken)
+
+	reader := bufio.NewReader(in)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", fmt.Errorf("failed to read user input: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "", "s", "start":
+			return session.CollisionSuffix, nil
+		case "a", "attach":
+			return session.CollisionAttach, nil
+		case "q", "quit":
+			return "", fmt.Errorf("user cancels startup")
+		}
+		if errors.Is(err, io.EOF) {
+			return session.CollisionSuffix, nil
+		}
+		fmt.Fprintf(out, "Invalid input, please enter s / a / q: ")
+	}
+}
+
+func tmuxSessionProject(name string) (string, bool) {
+	return session.SessionProject("tmux", name)
+}
@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// CmdProfile implements the 'profile' subcommand
+func CmdProfile(args []string) error {
+	fs := flag.NewFlagSet("profile", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux profile [options] [session-name] [list | use <profile>]\n\n")
+		fmt.Fprintf(os.Stderr, "List the config profiles, or switch a running session to another one. Switching\n")
+		fmt.Fprintf(os.Stderr, "reapplies the layout without restarting panels that stay, and replaces the\n")
+		fmt.Fprintf(os.Stderr, "theme, model and keybindings. A profile's state_dir is only read at startup.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The session name is optional, so the first argument is it only when it is not an action
+	positional := fs.Args()
+	sessionName := "opencode"
+	if len(positional) > 0 && positional[0] != "list" && positional[0] != "use" {
+		sessionName = positional[0]
+		positional = positional[1:]
+	}
+	action := "list"
+	if len(positional) > 0 {
+		action = positional[0]
+		positional = positional[1:]
+	}
+
+	var name string
+	switch {
+	case action == "use" && len(positional) == 1:
+		name = positional[0]
+	case action == "list" && len(positional) == 0:
+	default:
+		fs.Usage()
+		return fmt.Errorf("expected list or use <profile>")
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		if action == "use" {
+			return fmt.Errorf("orchestrator for session '%s' is not running; start it with --profile %s", sessionName, name)
+		}
+		// Without a daemon, list what the config file defines
+		profiles, err := config.LoadProfiles(profileConfigPath())
+		if err != nil {
+			return err
+		}
+		return printProfiles(&interfaces.ProfileStatus{Available: config.ProfileNames(profiles)}, *jsonOutput)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-profile-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	if action == "use" {
+		profile, err := client.SwitchProfile(name)
+		if err != nil {
+			return fmt.Errorf("switch profile failed: %w", err)
+		}
+		return printProfiles(profile, *jsonOutput)
+	}
+
+	status, err := client.GetStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get status: %w", err)
+	}
+	profile := status.Profile
+	if profile == nil {
+		profile = &interfaces.ProfileStatus{}
+	}
+	return printProfiles(profile, *jsonOutput)
+}
+
+// profileConfigPath returns the config file the orchestrator reads profiles from
+func profileConfigPath() string {
+	if path := os.Getenv("OPENCODE_TMUX_CONFIG"); path != "" {
+		return path
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(homeDir, ".opencode", "tmux.yaml")
+}
+
+// printProfiles lists the profiles, marking the active one
+func printProfiles(profile *interfaces.ProfileStatus, jsonOutput bool) error {
+	if jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(profile)
+	}
+	if len(profile.Available) == 0 {
+		fmt.Println("No profiles are defined; add them under profiles: in the config file.")
+		return nil
+	}
+	for _, name := range profile.Available {
+		marker := " "
+		if name == profile.Active {
+			marker = "*"
+		}
+		fmt.Printf("%s %s\n", marker, name)
+	}
+	return nil
+}
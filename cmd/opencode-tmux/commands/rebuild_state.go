@@ -0,0 +1,158 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/session"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// CmdRebuildState implements the 'rebuild-state' subcommand
+func CmdRebuildState(args []string) error {
+	fs := flag.NewFlagSet("rebuild-state", flag.ExitOnError)
+	statePath := fs.String("state", "", "State file to rebuild (default: the session's state file)")
+	output := fs.String("output", "", "Write the rebuilt state here instead of over the state file")
+	check := fs.Bool("check", false, "Only compare the rebuilt state with the state file")
+	force := fs.Bool("force", false, "Write even when the state file is newer than the journal")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux rebuild-state [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Rebuild the session's state from its journal: the newest checkpoint is\n")
+		fmt.Fprintf(os.Stderr, "loaded and every update recorded after it replayed. The result is compared\n")
+		fmt.Fprintf(os.Stderr, "with the state file and, unless --check is given, written over it; the\n")
+		fmt.Fprintf(os.Stderr, "replaced file is kept as the newest backup. Use it when both the state file\n")
+		fmt.Fprintf(os.Stderr, "and its backups are suspect. The daemon must be stopped to write in place.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux rebuild-state --check mysession\n")
+	}
+
+	if err := fs.Parse(reorderArgs(args)); err != nil {
+		return err
+	}
+	sessionName := getSessionName(fs.Args())
+
+	path := resolveBackupStatePath(*statePath, sessionName)
+	target := path
+	if *output != "" {
+		target = *output
+	}
+	if !*check && target == path {
+		if pid, running := session.CheckLock(getPIDPath(sessionName)); running {
+			return fmt.Errorf("orchestrator for session '%s' is running (PID %d); stop it first or use --output", sessionName, pid)
+		}
+	}
+
+	// Opening creates a missing directory, so check first that there is history
+	journalDir := strings.TrimSuffix(path, filepath.Ext(path)) + ".journal"
+	if _, err := os.Stat(journalDir); err != nil {
+		return fmt.Errorf("no state journal at %s: %w", journalDir, err)
+	}
+	j, err := journal.Open(journal.DefaultConfig(journalDir))
+	if err != nil {
+		return fmt.Errorf("failed to open state journal: %w", err)
+	}
+	defer j.Close()
+
+	newest := j.Newest()
+	if newest == 0 {
+		return fmt.Errorf("state journal %s is empty", journalDir)
+	}
+	rebuilt, err := state.ReplayJournal(j, newest)
+	if err != nil {
+		return fmt.Errorf("failed to replay the journal: %w", err)
+	}
+	fmt.Printf("Rebuilt version %d from %s (oldest retained version %d)\n", newest, journalDir, j.Oldest())
+
+	// Compare with what the state file holds, without falling back to backups.
+	// Sections are compared rather than whole files: the time of the last
+	// update is stamped apart from the version and does not replay exactly.
+	fileManager := persistence.NewFileManager(persistence.DefaultFileManagerConfig(path))
+	stored, err := fileManager.LoadStateFile()
+	matches := false
+	if err != nil {
+		fmt.Printf("State file %s: %v\n", path, err)
+	} else {
+		fmt.Printf("State file %s: version %d\n", path, stored.Version.Version)
+		switch {
+		case stored.Version.Version > newest:
+			fmt.Printf("The state file is %d version(s) ahead of the journal\n", stored.Version.Version-newest)
+			if !*check && !*force && target == path {
+				return fmt.Errorf("refusing to replace newer state; use --force to roll it back to version %d", newest)
+			}
+		case stored.Version.Version < newest:
+			fmt.Printf("The state file is %d version(s) behind the journal\n", newest-stored.Version.Version)
+		default:
+			if sections := mismatchedSections(stored, rebuilt); len(sections) > 0 {
+				fmt.Printf("The state file differs from the journal in: %s\n", strings.Join(sections, ", "))
+			} else {
+				matches = true
+				fmt.Println("The state file matches the journal")
+			}
+		}
+	}
+
+	if *check {
+		if !matches {
+			return fmt.Errorf("state file does not match the journal")
+		}
+		return nil
+	}
+	if matches && target == path {
+		return nil
+	}
+
+	// Saving keeps the replaced file as the newest backup
+	config := persistence.DefaultFileManagerConfig(target)
+	config.DifferentialSave = false
+	writer := persistence.NewFileManager(config)
+	if err := os.MkdirAll(filepath.Dir(target), config.DirMode); err != nil {
+		return fmt.Errorf("failed to create state directory: %w", err)
+	}
+	defer writer.Close()
+	if err := writer.SaveStateAtomic(rebuilt); err != nil {
+		return fmt.Errorf("failed to write rebuilt state: %w", err)
+	}
+
+	// Read it back the way the daemon will
+	rebuiltSum, err := persistence.StateChecksum(rebuilt)
+	if err != nil {
+		return err
+	}
+	written, err := writer.LoadStateFile()
+	if err != nil {
+		return fmt.Errorf("rebuilt state does not load: %w", err)
+	}
+	if sum, err := persistence.StateChecksum(written); err != nil || sum != rebuiltSum {
+		return fmt.Errorf("rebuilt state does not verify: checksum %s, want %s", sum, rebuiltSum)
+	}
+	fmt.Printf("Wrote version %d to %s (checksum %s)\n", newest, target, rebuiltSum)
+	return nil
+}
+
+// mismatchedSections lists the sections in which two states differ
+func mismatchedSections(stored, rebuilt *types.SharedApplicationState) []string {
+	rebuiltSums, storedSums := rebuilt.Checksums(), stored.Checksums()
+	sections := rebuiltSums.Mismatched(storedSums)
+	for section := range rebuiltSums {
+		if _, ok := storedSums[section]; !ok {
+			sections = append(sections, section)
+		}
+	}
+	for section := range storedSums {
+		if _, ok := rebuiltSums[section]; !ok {
+			sections = append(sections, section)
+		}
+	}
+	sort.Strings(sections)
+	return sections
+}
@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// replicaEventHistory is how many events the replica keeps for its readers to
+// replay after a reconnect
+const replicaEventHistory = 1000
+
+// CmdReplica implements the 'replica' subcommand
+func CmdReplica(args []string) error {
+	fs := flag.NewFlagSet("replica", flag.ExitOnError)
+	listen := fs.String("listen", "", "Socket to serve readers on (default: the session's replica socket)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux replica [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Run a read-only copy of the session's state server. The replica follows the\n")
+		fmt.Fprintf(os.Stderr, "orchestrator's events and serves state, events and message bodies on a\n")
+		fmt.Fprintf(os.Stderr, "socket of its own, so heavy readers such as exporters and dashboards do not\n")
+		fmt.Fprintf(os.Stderr, "slow the panels down. Updates sent to the replica are rejected.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux replica mysession\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux replica --listen /tmp/dashboard.sock\n")
+	}
+
+	// Allow the session name before or after flags
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+
+	pathMgr := paths.NewPathManager(sessionName)
+	socketPath := pathMgr.SocketPath()
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+	listenPath := *listen
+	if listenPath == "" {
+		listenPath = pathMgr.ReplicaSocketPath()
+	}
+	if listenPath == socketPath {
+		return fmt.Errorf("the replica cannot listen on the orchestrator's socket")
+	}
+	if isSocketActive(listenPath) {
+		return fmt.Errorf("a server is already listening on %s", listenPath)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-replica-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	replica := state.NewReplica(replicaEventHistory)
+	if blobDir := persistence.DefaultBlobDir(pathMgr.StatePath()); dirExists(blobDir) {
+		replica.SetBlobStore(persistence.NewBlobStore(blobDir, 0, 0))
+	}
+	if err := replica.Sync(client); err != nil {
+		return err
+	}
+
+	subscriber := client.NewSubscriber("replica", 0)
+	subscriber.Handle("*", func(event types.StateEvent) error {
+		return replica.Follow(client, event)
+	})
+	subscriber.Start()
+	defer subscriber.Stop()
+
+	server := ipc.NewSocketServer(listenPath, replica.GetEventBus(), replica, nil)
+	if err := server.Start(); err != nil {
+		return fmt.Errorf("failed to start replica server: %w", err)
+	}
+	defer server.Stop()
+
+	fmt.Printf("Replica of session '%s' at version %d serving on %s\n", sessionName, replica.Version(), listenPath)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Printf("[REPLICA] Stopping at version %d", replica.Version())
+	return nil
+}
+
+// dirExists reports whether path is an existing directory
+func dirExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
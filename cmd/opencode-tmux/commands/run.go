@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// CmdRun implements the 'run' subcommand
+func CmdRun(args []string) error {
+	fs := flag.NewFlagSet("run", flag.ExitOnError)
+	dir := fs.String("dir", "", "Working directory of the command (default: the workspace)")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux run [options] [session-name] -- <command>\n\n")
+		fmt.Fprintf(os.Stderr, "Run a shell command in a pane below the messages pane. Its output is\n")
+		fmt.Fprintf(os.Stderr, "streamed into the current session's transcript, followed by its exit status.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Everything after "--" is the command, so its own flags are left alone
+	split := len(args)
+	for i, arg := range args {
+		if arg == "--" {
+			split = i
+			break
+		}
+	}
+	if split == len(args) {
+		fs.Usage()
+		return fmt.Errorf("no command given; put it after --")
+	}
+	command := strings.Join(args[split+1:], " ")
+	args = args[:split]
+
+	sessionName := getSessionName(args)
+	if len(args) > 0 && args[0] == sessionName {
+		args = args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		sessionName = fs.Arg(0)
+	}
+	if strings.TrimSpace(command) == "" {
+		return fmt.Errorf("no command given; put it after --")
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-run-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	run, err := client.RunTerminalCommand(command, *dir)
+	if err != nil {
+		return fmt.Errorf("run failed: %w", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(run)
+	}
+	fmt.Printf("Started run %s in pane %s\n", run.ID, run.PaneID)
+	return nil
+}
@@ -0,0 +1,181 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// scheduleActions lists the schedule subcommands
+var scheduleActions = map[string]bool{
+	"add":    true,
+	"list":   true,
+	"remove": true,
+}
+
+// CmdSchedule implements the 'schedule' subcommand
+func CmdSchedule(args []string) error {
+	fs := flag.NewFlagSet("schedule", flag.ExitOnError)
+	at := fs.String("at", "", "When to run first: HH:MM, YYYY-MM-DD HH:MM, RFC 3339 or a delay such as 30m")
+	every := fs.Duration("every", 0, "Run again at this interval, e.g. 24h; once when unset")
+	sessionID := fs.String("session", "", "opencode session to prompt (default: the current one when it runs)")
+	name := fs.String("name", "", "Short name shown in the list")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux schedule [options] [session-name] <action> [arguments]\n\n")
+		fmt.Fprintf(os.Stderr, "Submit a stored prompt at a set time, once or at an interval. Scheduled\n")
+		fmt.Fprintf(os.Stderr, "prompts are kept in the session state and queued behind any run in flight.\n\n")
+		fmt.Fprintf(os.Stderr, "Actions:\n")
+		fmt.Fprintf(os.Stderr, "  add <prompt>   Schedule a prompt; needs --at\n")
+		fmt.Fprintf(os.Stderr, "  list           List scheduled prompts\n")
+		fmt.Fprintf(os.Stderr, "  remove <id>    Delete a scheduled prompt\n\n")
+		fmt.Fprintf(os.Stderr, "Example:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux schedule --at 18:00 --every 24h add \"Summarize today's session\"\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The session name is optional, so the first argument is it only when it is not an action
+	positional := fs.Args()
+	sessionName := ""
+	if len(positional) > 0 && !scheduleActions[positional[0]] {
+		sessionName = positional[0]
+		positional = positional[1:]
+	}
+	if sessionName == "" {
+		sessionName = configuredSessionName()
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no schedule action given")
+	}
+	action, rest := positional[0], positional[1:]
+	if !scheduleActions[action] {
+		return fmt.Errorf("unknown schedule action %q", action)
+	}
+
+	var update types.StateUpdate
+	switch action {
+	case "add":
+		text := strings.TrimSpace(strings.Join(rest, " "))
+		if text == "" {
+			return fmt.Errorf("usage: schedule --at <time> [--every <interval>] add <prompt>")
+		}
+		if *at == "" {
+			return fmt.Errorf("--at is required")
+		}
+		nextRun, err := types.ParseScheduleTime(*at, timefmt.In(time.Now()))
+		if err != nil {
+			return err
+		}
+		schedule := types.ScheduledPrompt{
+			ID:        ids.New("schedule"),
+			Name:      *name,
+			SessionID: *sessionID,
+			Text:      text,
+			NextRun:   nextRun,
+			Every:     *every,
+		}
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+		update = types.StateUpdate{Type: types.PromptScheduled, Payload: types.PromptSchedulePayload{Schedule: schedule}}
+	case "remove":
+		if len(rest) != 1 {
+			return fmt.Errorf("usage: schedule remove <id>")
+		}
+		update = types.StateUpdate{Type: types.PromptUnscheduled, Payload: types.PromptUnschedulePayload{ScheduleID: rest[0]}}
+	case "list":
+		if len(rest) > 0 {
+			return fmt.Errorf("schedule list takes no arguments")
+		}
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-schedule-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	var result interface{}
+	switch action {
+	case "add", "remove":
+		update.SourcePanel = "cli"
+		update.Timestamp = time.Now()
+		if _, err := client.SendStateUpdateAndWait(update); err != nil {
+			return fmt.Errorf("schedule %s failed: %w", action, err)
+		}
+		if payload, ok := update.Payload.(types.PromptSchedulePayload); ok {
+			result = payload.Schedule
+			if !*jsonOutput {
+				fmt.Printf("Scheduled %s for %s\n", payload.Schedule.ID, scheduleWhen(payload.Schedule))
+			}
+		} else {
+			result = map[string]string{"removed": rest[0]}
+			if !*jsonOutput {
+				fmt.Printf("Removed scheduled prompt %s\n", rest[0])
+			}
+		}
+
+	case "list":
+		current, err := client.RequestState()
+		if err != nil {
+			return fmt.Errorf("failed to read state: %w", err)
+		}
+		schedules := current.GetScheduledPrompts()
+		result = schedules
+		if !*jsonOutput {
+			if len(schedules) == 0 {
+				fmt.Println("No prompts scheduled")
+			}
+			for _, schedule := range schedules {
+				label := schedule.Name
+				if label == "" {
+					label = strings.Join(strings.Fields(schedule.Text), " ")
+				}
+				if len([]rune(label)) > 48 {
+					label = string([]rune(label)[:45]) + "..."
+				}
+				session := schedule.SessionID
+				if session == "" {
+					session = "current"
+				}
+				fmt.Printf("%-28s %-34s %-20s %s\n", schedule.ID, scheduleWhen(schedule), session, label)
+			}
+		}
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(result)
+	}
+	return nil
+}
+
+// scheduleWhen describes when a scheduled prompt runs next
+func scheduleWhen(schedule types.ScheduledPrompt) string {
+	when := timefmt.DateTime(schedule.NextRun)
+	if schedule.Every > 0 {
+		when += ", every " + schedule.Every.String()
+	}
+	return when
+}
@@ -0,0 +1,357 @@
+package commands
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	tmuxconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/sst/opencode-sdk-go"
+	"github.com/sst/opencode-sdk-go/option"
+)
+
+// setupServerTimeout bounds the catalog request made while checking the server
+const setupServerTimeout = 5 * time.Second
+
+// SetupOptions holds options for the first-run setup
+type SetupOptions struct {
+	ConfigPath  string // Config file to write
+	ServerURL   string // OpenCode server the model catalog is read from
+	SessionName string // Suggested session name
+	Overwrite   bool   // Replace an existing config file
+
+	In  io.Reader
+	Out io.Writer
+}
+
+// layoutPreset is a starter layout offered by the setup
+type layoutPreset struct {
+	name        string
+	description string
+	layout      func() *tmuxconfig.Layout
+}
+
+var layoutPresets = []layoutPreset{
+	{"standard", "sessions on the left, messages above input", tmuxconfig.DefaultLayout},
+	{"focused", "messages above input, no session list", func() *tmuxconfig.Layout {
+		return &tmuxconfig.Layout{
+			Version: "1.0",
+			Mode:    "raw",
+			Panels: []tmuxconfig.Panel{
+				{ID: "messages", Type: "messages"},
+				{ID: "input", Type: "input", Height: "20%"},
+			},
+			Splits: []tmuxconfig.Split{
+				{Type: "vertical", Target: "root", Panels: []string{"messages", "input"}, Ratio: "4:1"},
+			},
+		}
+	}},
+	{"controller", "sessions above the controller on the left, messages above input", func() *tmuxconfig.Layout {
+		return &tmuxconfig.Layout{
+			Version: "1.0",
+			Mode:    "raw",
+			Panels: []tmuxconfig.Panel{
+				{ID: "sessions", Type: "sessions", Width: "20%"},
+				{ID: "controller", Type: "controller"},
+				{ID: "messages", Type: "messages"},
+				{ID: "input", Type: "input", Height: "20%"},
+			},
+			Splits: []tmuxconfig.Split{
+				{Type: "horizontal", Target: "root", Panels: []string{"sessions", "messages"}},
+				{Type: "vertical", Target: "sessions", Panels: []string{"sessions", "controller"}},
+				{Type: "vertical", Target: "messages", Panels: []string{"messages", "input"}},
+			},
+		}
+	}},
+}
+
+// CmdSetup implements the 'setup' subcommand
+func CmdSetup(args []string) error {
+	fs := flag.NewFlagSet("setup", flag.ExitOnError)
+	configPath := fs.String("config", "", "Config file to write (default $OPENCODE_TMUX_CONFIG or ~/.opencode/tmux.yaml)")
+	serverURL := fs.String("server", os.Getenv("OPENCODE_SERVER"), "OpenCode server to read the model catalog from")
+	force := fs.Bool("force", false, "Replace an existing config file")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux setup [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Check that tmux and opencode are available, then write a starter config\n")
+		fmt.Fprintf(os.Stderr, "with a layout, theme and default model and check that it loads. 'start'\n")
+		fmt.Fprintf(os.Stderr, "runs this on its own when there is no config file yet.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux setup --force mysession\n")
+	}
+
+	if err := fs.Parse(reorderArgs(args)); err != nil {
+		return err
+	}
+
+	return RunSetup(SetupOptions{
+		ConfigPath:  resolveReloadConfigPath(&StartOptions{ConfigPath: *configPath}),
+		ServerURL:   *serverURL,
+		SessionName: getSessionName(fs.Args()),
+		Overwrite:   *force,
+		In:          os.Stdin,
+		Out:         os.Stdout,
+	})
+}
+
+// NeedsSetup reports whether there is no config file at configPath yet, so
+// starting a session should run the first-run setup
+func NeedsSetup(configPath string) bool {
+	return !tmuxconfig.ConfigExists(configPath)
+}
+
+// RunSetup asks for the session name, layout, theme and default model, writes
+// them to opts.ConfigPath and checks that the result loads. It fails when
+// tmux is missing, since no session can start without it.
+func RunSetup(opts SetupOptions) error {
+	if !opts.Overwrite && tmuxconfig.ConfigExists(opts.ConfigPath) {
+		return fmt.Errorf("%s already exists (use --force to replace it)", opts.ConfigPath)
+	}
+	p := &setupPrompter{in: bufio.NewReader(opts.In), out: opts.Out}
+
+	fmt.Fprintf(p.out, "\nWelcome to opencode-tmux! Let's write %s.\n\n", opts.ConfigPath)
+	fmt.Fprintln(p.out, "Checking your environment:")
+	version, err := detectTmux()
+	if err != nil {
+		fmt.Fprintf(p.out, "  ✗ tmux: %v\n", err)
+		return fmt.Errorf("tmux is required; install it and run setup again")
+	}
+	fmt.Fprintf(p.out, "  ✓ tmux: %s\n", version)
+	if path, err := exec.LookPath("opencode"); err == nil {
+		fmt.Fprintf(p.out, "  ✓ opencode: %s\n", path)
+	} else {
+		fmt.Fprintf(p.out, "  - opencode: not on PATH (only needed to run the server yourself)\n")
+	}
+	providers, err := fetchProviders(opts.ServerURL)
+	switch {
+	case opts.ServerURL == "":
+		fmt.Fprintf(p.out, "  - server: OPENCODE_SERVER is not set; the model list is not available\n")
+	case err != nil:
+		fmt.Fprintf(p.out, "  ✗ server: %s is not reachable: %v\n", opts.ServerURL, err)
+	default:
+		fmt.Fprintf(p.out, "  ✓ server: %s\n", opts.ServerURL)
+	}
+	fmt.Fprintln(p.out)
+
+	session := tmuxconfig.Session{Name: p.ask("Session name", opts.SessionName)}
+
+	names := make([]string, len(layoutPresets))
+	for i, preset := range layoutPresets {
+		names[i] = fmt.Sprintf("%-10s %s", preset.name, preset.description)
+	}
+	layout := layoutPresets[p.selectIndex("Layout:", names, 0)].layout()
+
+	if err := theme.LoadThemesFromJSON(); err != nil {
+		return fmt.Errorf("failed to load themes: %w", err)
+	}
+	themes := theme.AvailableThemes()
+	session.Theme = themes[p.selectIndex("Theme:", themes, 0)]
+
+	session.Model = p.chooseModel(catalogModels(providers), defaultModel(providers))
+
+	if err := tmuxconfig.WriteStarter(opts.ConfigPath, session, layout, opts.Overwrite); err != nil {
+		return err
+	}
+	fmt.Fprintf(p.out, "\nWrote %s. Checking it:\n", opts.ConfigPath)
+	if err := validateSetup(p.out, opts.ConfigPath, providers); err != nil {
+		return fmt.Errorf("the config written to %s does not load: %w", opts.ConfigPath, err)
+	}
+	fmt.Fprintln(p.out)
+	return nil
+}
+
+// detectTmux returns the version of the tmux on PATH
+func detectTmux() (string, error) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		return "", errors.New("not found on PATH")
+	}
+	out, err := exec.Command("tmux", "-V").Output()
+	if err != nil {
+		return "", fmt.Errorf("tmux -V failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// fetchProviders reads the model catalog from the server, or returns nil
+// when no server is set
+func fetchProviders(serverURL string) (*opencode.AppProvidersResponse, error) {
+	if serverURL == "" {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), setupServerTimeout)
+	defer cancel()
+	client := opencode.NewClient(option.WithBaseURL(serverURL))
+	return client.App.Providers(ctx, opencode.AppProvidersParams{})
+}
+
+// catalogModels lists the catalog's models as sorted "provider/model" references
+func catalogModels(providers *opencode.AppProvidersResponse) []string {
+	if providers == nil {
+		return nil
+	}
+	var models []string
+	for _, provider := range providers.Providers {
+		for id := range provider.Models {
+			models = append(models, provider.ID+"/"+id)
+		}
+	}
+	sort.Strings(models)
+	return models
+}
+
+// defaultModel returns the server's default model of the first provider
+// that has one, or "" when there is none
+func defaultModel(providers *opencode.AppProvidersResponse) string {
+	if providers == nil {
+		return ""
+	}
+	ids := make([]string, 0, len(providers.Default))
+	for id := range providers.Default {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if model := providers.Default[id]; model != "" {
+			return id + "/" + model
+		}
+	}
+	return ""
+}
+
+// validateSetup loads the written config the way start does and checks the
+// chosen theme and model exist
+func validateSetup(out io.Writer, configPath string, providers *opencode.AppProvidersResponse) error {
+	check := func(name string, err error) error {
+		if err != nil {
+			fmt.Fprintf(out, "  ✗ %s: %v\n", name, err)
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		fmt.Fprintf(out, "  ✓ %s\n", name)
+		return nil
+	}
+
+	sessionCfg, err := tmuxconfig.LoadSession(configPath)
+	if err := check("session", err); err != nil {
+		return err
+	}
+	layout, err := tmuxconfig.LoadLayout(configPath)
+	if err == nil {
+		err = layout.Validate()
+	}
+	if err := check("layout", err); err != nil {
+		return err
+	}
+	cfg, err := tmuxconfig.LoadConfig(configPath)
+	if err == nil {
+		err = cfg.Validate()
+	}
+	if err := check("settings", err); err != nil {
+		return err
+	}
+
+	if name := sessionCfg.Session.Theme; name != "" {
+		var err error
+		if theme.GetTheme(name) == nil {
+			err = fmt.Errorf("unknown theme %q", name)
+		}
+		if err := check("theme "+name, err); err != nil {
+			return err
+		}
+	}
+	if ref := sessionCfg.Session.Model; ref != "" && providers != nil {
+		var err error
+		if !contains(catalogModels(providers), ref) {
+			err = fmt.Errorf("%s is not in the server's model catalog", ref)
+		}
+		if err := check("model "+ref, err); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setupPrompter reads the answers to the setup's questions
+type setupPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// readLine returns the next answer; at end of input every answer is empty,
+// so the defaults are taken
+func (p *setupPrompter) readLine() string {
+	line, _ := p.in.ReadString('\n')
+	return strings.TrimSpace(line)
+}
+
+// ask returns the answer to question, or def when it is left empty
+func (p *setupPrompter) ask(question, def string) string {
+	fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	if answer := p.readLine(); answer != "" {
+		return answer
+	}
+	return def
+}
+
+// selectIndex lists items and returns the index of the one chosen by number
+func (p *setupPrompter) selectIndex(question string, items []string, def int) int {
+	fmt.Fprintln(p.out, question)
+	for i, item := range items {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, item)
+	}
+	fmt.Fprintf(p.out, "Enter number [%d]: ", def+1)
+	for {
+		answer := p.readLine()
+		if answer == "" {
+			return def
+		}
+		if idx, err := strconv.Atoi(answer); err == nil && idx >= 1 && idx <= len(items) {
+			return idx - 1
+		}
+		fmt.Fprintf(p.out, "Enter a number between 1 and %d: ", len(items))
+	}
+}
+
+// chooseModel asks for the default model by number from the catalog or as
+// provider/model. Without a catalog any provider/model is accepted, and an
+// empty answer with no default leaves the model to the server.
+func (p *setupPrompter) chooseModel(models []string, def string) string {
+	fmt.Fprintln(p.out, "Default model:")
+	for i, model := range models {
+		fmt.Fprintf(p.out, "  %d) %s\n", i+1, model)
+	}
+	hint := "provider/model"
+	if len(models) > 0 {
+		hint = "number or provider/model"
+	}
+	if def == "" {
+		hint += ", empty for the server's default"
+	}
+	fmt.Fprintf(p.out, "Enter %s [%s]: ", hint, def)
+	for {
+		answer := p.readLine()
+		if answer == "" {
+			return def
+		}
+		if idx, err := strconv.Atoi(answer); err == nil && idx >= 1 && idx <= len(models) {
+			return models[idx-1]
+		}
+		provider, model, _ := strings.Cut(answer, "/")
+		if provider != "" && model != "" && (len(models) == 0 || contains(models, answer)) {
+			return answer
+		}
+		fmt.Fprintf(p.out, "Enter %s: ", hint)
+	}
+}
@@ -0,0 +1,104 @@
+package commands
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/share"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// CmdShare implements the 'share' subcommand
+func CmdShare(args []string) error {
+	fs := flag.NewFlagSet("share", flag.ExitOnError)
+	sessionID := fs.String("session", "", "Session ID to share (default: the current session)")
+	output := fs.String("output", "", "HTML file to write, - for stdout (default: <session-id>.html)")
+	title := fs.String("title", "", "Heading of the page (default: the session title)")
+	redact := fs.Bool("redact", true, "Replace suspected secrets such as API keys and tokens with [REDACTED]")
+	style := fs.String("style", share.DefaultStyle, "Chroma style code is highlighted with")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux share [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Render a conversation as one self-contained HTML file, to attach to a pull\n")
+		fmt.Fprintf(os.Stderr, "request or paste into an issue tracker. Code is highlighted, and tool output\n")
+		fmt.Fprintf(os.Stderr, "and terminal transcripts are collapsed. Secrets the scanner recognizes are\n")
+		fmt.Fprintf(os.Stderr, "redacted unless --redact=false; check the page before sharing it anyway.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux share --output review.html mysession\n")
+	}
+
+	if err := fs.Parse(reorderArgs(args)); err != nil {
+		return err
+	}
+	sessionName := getSessionName(fs.Args())
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-share-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	current, err := client.RequestState()
+	if err != nil {
+		return fmt.Errorf("failed to read state: %w", err)
+	}
+	id := *sessionID
+	if id == "" {
+		id = current.CurrentSessionID
+	}
+	if id == "" {
+		return fmt.Errorf("no session selected; pass --session")
+	}
+	session, ok := current.GetSessionByID(id)
+	if !ok {
+		return fmt.Errorf("session %s not found", id)
+	}
+
+	var messages []types.MessageInfo
+	for _, msg := range current.Messages {
+		if msg.SessionID != id {
+			continue
+		}
+		if err := client.ResolveMessageBody(&msg); err != nil {
+			return fmt.Errorf("failed to load message %s: %w", msg.ID, err)
+		}
+		messages = append(messages, msg)
+	}
+
+	path := *output
+	if path == "" {
+		path = id + ".html"
+	}
+	var w io.Writer = os.Stdout
+	if path != "-" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", path, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	result, err := share.Render(w, session, messages, share.Options{Title: *title, Redact: *redact, Style: *style})
+	if err != nil {
+		return err
+	}
+	if path != "-" {
+		fmt.Printf("Wrote %s: %d messages, %d code blocks, %d tool outputs", path, result.Messages, result.CodeBlocks, result.ToolOutputs)
+		if *redact {
+			fmt.Printf(", %d suspected secrets redacted", result.Redacted)
+		}
+		fmt.Println()
+	}
+	return nil
+}
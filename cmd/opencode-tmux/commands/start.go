@@ -8,7 +8,10 @@ import (
 	"path/filepath"
 	"strings"
 
+	tmuxconfig "github.com/opencode/tmux_coder/internal/config"
 	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/session"
+	"golang.org/x/term"
 )
 
 // RunLegacyWithArgs is a bridge function that will be set by main.go
@@ -21,6 +24,7 @@ type StartOptions struct {
 	SessionName string
 	ConfigPath  string
 	LayoutPath  string
+	Profile     string // Config profile; $OPENCODE_PROFILE when empty
 
 	// Server configuration
 	ServerURL string
@@ -53,6 +57,7 @@ func CmdStart(args []string) error {
 	// Session flags
 	fs.StringVar(&opts.ConfigPath, "config", "", "Path to configuration file")
 	fs.StringVar(&opts.LayoutPath, "layout", "", "Path to layout file")
+	fs.StringVar(&opts.Profile, "profile", "", "Config profile to apply, e.g. work (default $OPENCODE_PROFILE)")
 
 	// Server flags
 	fs.StringVar(&opts.ServerURL, "server", os.Getenv("OPENCODE_SERVER"), "OpenCode server URL")
@@ -71,7 +76,7 @@ func CmdStart(args []string) error {
 	fs.BoolVar(&opts.AttachOnly, "attach-only", false, "Only attach to existing session")
 
 	// Merge target
-	fs.StringVar(&opts.MergeInto, "merge-into", "", "Merge into an existing tmux session (create a new window there)")
+	fs.StringVar(&opts.MergeInto, "merge-into", "", "Merge into an existing tmux session (create a new window there); \"auto\" for the current one")
 
 	// Advanced flags
 	fs.BoolVar(&opts.NoAutoStart, "no-auto-start", false, "Don't start panels automatically")
@@ -94,7 +99,12 @@ func CmdStart(args []string) error {
 		fmt.Fprintf(os.Stderr, "  opencode-tmux start mysession --daemon --detach\n")
 		fmt.Fprintf(os.Stderr, "  opencode-tmux attach mysession\n\n")
 		fmt.Fprintf(os.Stderr, "  # Force recreate session\n")
-		fmt.Fprintf(os.Stderr, "  opencode-tmux start mysession --force\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux start mysession --force\n\n")
+		fmt.Fprintf(os.Stderr, "  # Start with the settings of the config file's demo profile\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux start mysession --profile demo\n\n")
+		fmt.Fprintf(os.Stderr, "  # Add the panels as a window of the tmux session you are in\n")
+		fmt.Fprintf(os.Stderr, "  # (or set session.host: auto in the config file)\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux start mysession --merge-into auto\n")
 	}
 
 	// Reorder args: flags first, then positional
@@ -140,6 +150,13 @@ func CmdStart(args []string) error {
 		return fmt.Errorf("cannot combine --merge-into with --force")
 	}
 
+	// A configured name is resolved for this project, which may collide
+	if fs.NArg() == 0 && !opts.ReloadLayout && !opts.AttachOnly {
+		if err := resolveStartSessionName(opts); err != nil {
+			return err
+		}
+	}
+
 	// Handle reload-layout command (special case)
 	if opts.ReloadLayout {
 		return handleReloadLayout(opts)
@@ -149,6 +166,40 @@ func CmdStart(args []string) error {
 	return executeStart(opts)
 }
 
+// resolveStartSessionName resolves the configured session name, acting on a
+// collision with another project's session as the config says. Attaching
+// instead is only offered when the flags leave a session to attach to.
+func resolveStartSessionName(opts *StartOptions) error {
+	cfg, err := tmuxconfig.LoadSession(profileConfigPath())
+	if err != nil {
+		return err
+	}
+	policy, err := session.ParseCollisionPolicy(cfg.Session.OnCollision)
+	if err != nil {
+		return err
+	}
+	if opts.Detach || opts.ForceNew || strings.TrimSpace(opts.MergeInto) != "" {
+		policy = session.CollisionSuffix
+	}
+
+	name, attach, err := ResolveSessionName(SessionNameOptions{
+		Template:    cfg.Session.Name,
+		OnCollision: policy,
+		Interactive: term.IsTerminal(int(os.Stdin.Fd())),
+		In:          os.Stdin,
+		Out:         os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+	opts.SessionName = name
+	if attach {
+		fmt.Printf("Session '%s' belongs to another project; attaching to it\n", name)
+		opts.AttachOnly = true
+	}
+	return nil
+}
+
 // Validate checks if options are valid
 func (opts *StartOptions) Validate() error {
 	if opts.ServerURL == "" && !opts.Detach && !opts.AttachOnly {
@@ -401,6 +452,9 @@ func buildLegacyArgs(opts *StartOptions) []string {
 		// by legacy startup code that scans for the first non-flag argument.
 		args = append(args, "--merge-into="+opts.MergeInto)
 	}
+	if strings.TrimSpace(opts.Profile) != "" {
+		args = append(args, "--profile="+opts.Profile)
+	}
 
 	// Add session name as positional argument
 	args = append(args, opts.SessionName)
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"os"
 	"time"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
 )
 
 // CmdStatus implements the 'status' subcommand
@@ -34,8 +36,12 @@ func CmdStatus(args []string) error {
 	// Get client details if tmux is running
 	var clients []ClientInfo
 	if status.TmuxRunning {
+		tmuxSession := sessionName
+		if status.Host.Host != "" {
+			tmuxSession = status.Host.Host
+		}
 		var err error
-		clients, err = getConnectedClients(sessionName)
+		clients, err = getConnectedClients(tmuxSession)
 		if err != nil {
 			// Non-fatal error, continue
 			clients = []ClientInfo{}
@@ -66,6 +72,10 @@ func CmdStatus(args []string) error {
 			"socket_path":    socketPath,
 			"pid_path":       pidPath,
 		}
+		if status.Host.Host != "" {
+			output["host_session"] = status.Host.Host
+			output["host_window"] = status.Host.WindowID
+		}
 
 		encoder := json.NewEncoder(os.Stdout)
 		encoder.SetIndent("", "  ")
@@ -77,7 +87,9 @@ func CmdStatus(args []string) error {
 	fmt.Printf("Status: %s\n", overallStatus)
 	fmt.Println("────────────────────────────────────────")
 
-	if status.TmuxRunning {
+	if status.Host.Host != "" {
+		fmt.Printf("Tmux Session: ✓ Running as window %s of session %s\n", status.Host.WindowID, status.Host.Host)
+	} else if status.TmuxRunning {
 		fmt.Printf("Tmux Session: ✓ Running\n")
 	} else {
 		fmt.Printf("Tmux Session: ✗ Not running\n")
@@ -95,7 +107,7 @@ func CmdStatus(args []string) error {
 			// Convert timestamp to readable format
 			timestamp := client.ConnectedAt
 			if ts, err := time.Parse(time.RFC3339, timestamp); err == nil {
-				timestamp = ts.Format("2006-01-02 15:04:05")
+				timestamp = timefmt.DateTime(ts)
 			}
 			fmt.Printf("  - %s (PID %s, connected: %s)\n", client.TTY, client.PID, timestamp)
 		}
@@ -0,0 +1,134 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// CmdSyncConfig implements the 'sync-config' subcommand
+func CmdSyncConfig(args []string) error {
+	fs := flag.NewFlagSet("sync-config", flag.ExitOnError)
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux sync-config [options] [session-name] [setting=value ...]\n\n")
+		fmt.Fprintf(os.Stderr, "Show or change the state sync settings of a running session without a restart.\n")
+		fmt.Fprintf(os.Stderr, "Durations take units (auto_save_interval=10s); nested settings use dots\n")
+		fmt.Fprintf(os.Stderr, "(retention.max_messages_per_session=2000).\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	// Allow the session name before or after flags; settings are never names
+	sessionName := "opencode"
+	if len(args) > 0 && !strings.ContainsRune(args[0], '=') {
+		sessionName = getSessionName(args)
+		if args[0] == sessionName {
+			args = args[1:]
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	changes := make(map[string]interface{})
+	for _, arg := range fs.Args() {
+		name, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			sessionName = arg
+			continue
+		}
+		if err := setConfigValue(changes, strings.Split(name, "."), value); err != nil {
+			return err
+		}
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-sync-config-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	var config map[string]interface{}
+	var err error
+	if len(changes) > 0 {
+		config, err = client.UpdateSyncConfig(changes)
+	} else {
+		config, err = client.GetSyncConfig()
+	}
+	if err != nil {
+		return fmt.Errorf("sync config failed: %w", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(config)
+	}
+	printConfigFields(config, "")
+	return nil
+}
+
+// setConfigValue stores value at path in changes, parsing durations, booleans and numbers
+func setConfigValue(changes map[string]interface{}, path []string, value string) error {
+	for _, name := range path[:len(path)-1] {
+		nested, ok := changes[name].(map[string]interface{})
+		if !ok {
+			nested = make(map[string]interface{})
+			changes[name] = nested
+		}
+		changes = nested
+	}
+
+	name := path[len(path)-1]
+	if name == "" {
+		return fmt.Errorf("invalid setting %q", strings.Join(path, "."))
+	}
+	if d, err := time.ParseDuration(value); err == nil && strings.TrimLeft(value, "-0123456789.") != "" {
+		changes[name] = int64(d)
+	} else if b, err := strconv.ParseBool(value); err == nil {
+		changes[name] = b
+	} else if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+		changes[name] = n
+	} else {
+		changes[name] = value
+	}
+	return nil
+}
+
+// printConfigFields prints settings one per line, durations in their usual form
+func printConfigFields(config map[string]interface{}, prefix string) {
+	names := make([]string, 0, len(config))
+	for name := range config {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch value := config[name].(type) {
+		case map[string]interface{}:
+			printConfigFields(value, prefix+name+".")
+		case float64:
+			if strings.HasSuffix(name, "_interval") || strings.HasSuffix(name, "_window") {
+				fmt.Printf("%s%s = %v\n", prefix, name, time.Duration(value))
+			} else {
+				fmt.Printf("%s%s = %d\n", prefix, name, int64(value))
+			}
+		default:
+			fmt.Printf("%s%s = %v\n", prefix, name, value)
+		}
+	}
+}
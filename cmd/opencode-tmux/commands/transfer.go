@@ -0,0 +1,125 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// transferActions lists the transfer subcommands
+var transferActions = map[string]bool{
+	"export": true,
+	"import": true,
+}
+
+// CmdTransfer implements the 'transfer' subcommand
+func CmdTransfer(args []string) error {
+	fs := flag.NewFlagSet("transfer", flag.ExitOnError)
+	sessionID := fs.String("session", "", "Session ID to export (default: the current session)")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux transfer [options] [session-name] <action> [file]\n\n")
+		fmt.Fprintf(os.Stderr, "Move a conversation between the plain opencode TUI and tmux, in the format\n")
+		fmt.Fprintf(os.Stderr, "'opencode export' writes and 'opencode import' reads. Parts and metadata\n")
+		fmt.Fprintf(os.Stderr, "of sessions that came from opencode go back unchanged.\n\n")
+		fmt.Fprintf(os.Stderr, "Actions:\n")
+		fmt.Fprintf(os.Stderr, "  export [file]  Write a session to file (default: <session-id>.json; - for stdout)\n")
+		fmt.Fprintf(os.Stderr, "  import <file>  Add the session in file (- for stdin)\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode export ses_123 > ses_123.json\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux transfer mysession import ses_123.json\n")
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	// The session name is optional, so the first argument is it only when it is not an action
+	positional := fs.Args()
+	sessionName := "opencode"
+	if len(positional) > 0 && !transferActions[positional[0]] {
+		sessionName = positional[0]
+		positional = positional[1:]
+	}
+	if len(positional) == 0 {
+		fs.Usage()
+		return fmt.Errorf("no transfer action given")
+	}
+	action, positional := positional[0], positional[1:]
+	if !transferActions[action] {
+		return fmt.Errorf("unknown transfer action %q", action)
+	}
+	if len(positional) > 1 || (action == "import" && len(positional) == 0) {
+		return fmt.Errorf("usage: transfer %s <file>", action)
+	}
+	path := ""
+	if len(positional) == 1 {
+		path = positional[0]
+	}
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-transfer-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	if action == "import" {
+		var data []byte
+		var err error
+		if path == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(path)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		session, err := client.ImportOpencodeSession(data)
+		if err != nil {
+			return fmt.Errorf("import failed: %w", err)
+		}
+		fmt.Printf("Imported session %s (%s)\n", session.ID, session.Title)
+		return nil
+	}
+
+	data, err := client.ExportOpencodeSession(*sessionID)
+	if err != nil {
+		return fmt.Errorf("export failed: %w", err)
+	}
+	if path == "-" {
+		_, err := os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+	if path == "" {
+		id := *sessionID
+		if id == "" {
+			var export struct {
+				Info struct {
+					ID string `json:"id"`
+				} `json:"info"`
+			}
+			if err := json.Unmarshal(data, &export); err != nil {
+				return fmt.Errorf("invalid export: %w", err)
+			}
+			id = export.Info.ID
+		}
+		path = id + ".json"
+	}
+	// Conversations can hold secrets, so the file is private like the state
+	if err := os.WriteFile(path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	fmt.Printf("Wrote %s; load it into opencode with 'opencode import %s'\n", path, path)
+	return nil
+}
@@ -0,0 +1,106 @@
+package commands
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/version"
+)
+
+// CmdUpgrade implements the 'upgrade' subcommand
+func CmdUpgrade(args []string) error {
+	fs := flag.NewFlagSet("upgrade", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "Only show which panels would restart")
+	jsonOutput := fs.Bool("json", false, "Output in JSON format")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux upgrade [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "After installing new binaries, restart the panels of a running session that\n")
+		fmt.Fprintf(os.Stderr, "still run another build, so they pick up the installed one (%s).\n", version.Build)
+		fmt.Fprintf(os.Stderr, "The daemon keeps its build until the session is stopped and started again.\n")
+		fmt.Fprintf(os.Stderr, "Needs the session's admin token, which only the session owner can read.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(reorderArgs(args)); err != nil {
+		return err
+	}
+	sessionName := getSessionName(fs.Args())
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+	token, err := ipc.ReadAdminToken(ipc.AdminTokenPath(socketPath))
+	if err != nil {
+		return err
+	}
+
+	client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-upgrade-%d", os.Getpid()), "controller")
+	if err := client.Connect(); err != nil {
+		return fmt.Errorf("failed to connect to daemon: %w", err)
+	}
+	defer client.Disconnect()
+
+	result, err := client.AdminCommand(token, "upgrade_panels", map[string]interface{}{
+		"target_build":    version.Build,
+		"target_protocol": version.Protocol,
+		"dry_run":         *dryRun,
+	})
+	if err != nil {
+		return fmt.Errorf("upgrade failed: %w", err)
+	}
+	data, err := json.Marshal(result["upgrade"])
+	if err != nil {
+		return fmt.Errorf("failed to decode upgrade report: %w", err)
+	}
+	var report interfaces.UpgradeReport
+	if err := json.Unmarshal(data, &report); err != nil {
+		return fmt.Errorf("failed to decode upgrade report: %w", err)
+	}
+
+	if *jsonOutput {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	}
+	printUpgradeReport(sessionName, &report)
+	if len(report.Failed) > 0 {
+		return fmt.Errorf("%d panel(s) failed to restart", len(report.Failed))
+	}
+	return nil
+}
+
+// printUpgradeReport says what the upgrade restarted and what is left to do
+func printUpgradeReport(sessionName string, report *interfaces.UpgradeReport) {
+	restarted := "Restarted"
+	if report.DryRun {
+		restarted = "Would restart"
+	}
+	switch {
+	case len(report.Restarted) > 0:
+		fmt.Printf("%s %d panel(s) to run build %s: %v\n", restarted, len(report.Restarted), report.TargetBuild, report.Restarted)
+	case len(report.Failed) == 0:
+		fmt.Printf("Every connected panel already runs build %s\n", report.TargetBuild)
+	}
+
+	failed := make([]string, 0, len(report.Failed))
+	for name := range report.Failed {
+		failed = append(failed, name)
+	}
+	sort.Strings(failed)
+	for _, name := range failed {
+		fmt.Printf("Failed to restart %s: %s\n", name, report.Failed[name])
+	}
+
+	if report.DaemonOutdated {
+		fmt.Printf("The daemon still runs build %s. To replace it, restart the session:\n", report.DaemonBuild)
+		fmt.Printf("  opencode-tmux stop %s && opencode-tmux start %s\n", sessionName, sessionName)
+	}
+}
@@ -0,0 +1,182 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/session"
+)
+
+// maxWatchdogBackoff caps the wait between restarts of a server that keeps failing
+const maxWatchdogBackoff = 5 * time.Minute
+
+// CmdWatchdog implements the 'watchdog' subcommand
+func CmdWatchdog(args []string) error {
+	fs := flag.NewFlagSet("watchdog", flag.ExitOnError)
+	interval := fs.Duration("interval", 5*time.Second, "How often to check the daemon")
+	timeout := fs.Duration("timeout", 5*time.Second, "How long the daemon has to answer a check")
+	failures := fs.Int("failures", 3, "Failed checks in a row before the daemon is restarted")
+
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: opencode-tmux watchdog [options] [session-name]\n\n")
+		fmt.Fprintf(os.Stderr, "Watch a session's orchestrator daemon and restart it when it crashes or stops\n")
+		fmt.Fprintf(os.Stderr, "answering on its socket. Panels reconnect on their own and resume where they\n")
+		fmt.Fprintf(os.Stderr, "left off. The watchdog exits when the daemon is stopped with 'opencode-tmux stop'.\n\n")
+		fmt.Fprintf(os.Stderr, "Options:\n")
+		fs.PrintDefaults()
+		fmt.Fprintf(os.Stderr, "\nExample:\n")
+		fmt.Fprintf(os.Stderr, "  opencode-tmux watchdog mysession &\n")
+	}
+
+	if err := fs.Parse(reorderArgs(args)); err != nil {
+		return err
+	}
+	if *interval <= 0 || *timeout <= 0 || *failures < 1 {
+		return fmt.Errorf("--interval and --timeout must be positive and --failures at least 1")
+	}
+	sessionName := getSessionName(fs.Args())
+
+	socketPath := getSocketPath(sessionName)
+	if !isSocketActive(socketPath) {
+		return fmt.Errorf("orchestrator for session '%s' is not running", sessionName)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("Watching the daemon of session '%s' every %v\n", sessionName, *interval)
+	failed := 0
+	restarts := 0
+	backoff := *interval
+	ticker := time.NewTicker(*interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		err := probeDaemon(socketPath, *timeout)
+		if err == nil {
+			failed = 0
+			backoff = *interval
+			continue
+		}
+		failed++
+		log.Printf("[WATCHDOG] Check %d/%d of session '%s' failed: %v", failed, *failures, sessionName, err)
+		if failed < *failures {
+			continue
+		}
+
+		// A daemon that was stopped on purpose removed its PID file
+		pidPath := getPIDPath(sessionName)
+		if _, err := os.Stat(pidPath); errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("The daemon of session '%s' was stopped; watchdog exiting\n", sessionName)
+			return nil
+		}
+
+		restarts++
+		fmt.Printf("%s Restarting the daemon of session '%s' (restart %d): %v\n",
+			time.Now().Format(time.TimeOnly), sessionName, restarts, err)
+		if err := restartDaemon(ctx, sessionName, pidPath); err != nil {
+			fmt.Fprintf(os.Stderr, "Restart failed: %v\n", err)
+		}
+		failed = 0
+
+		// Give a daemon that keeps failing longer to come up each time
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxWatchdogBackoff)
+	}
+}
+
+// probeDaemon checks that the daemon accepts a connection and answers a
+// status query within timeout; a socket that only accepts is not enough
+func probeDaemon(socketPath string, timeout time.Duration) error {
+	result := make(chan error, 1)
+	go func() {
+		client := ipc.NewSocketClient(socketPath, fmt.Sprintf("cli-watchdog-%d", os.Getpid()), "controller")
+		if err := client.Connect(); err != nil {
+			result <- err
+			return
+		}
+		defer client.Disconnect()
+		_, err := client.GetStatus()
+		result <- err
+	}()
+
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("no answer within %v", timeout)
+	}
+}
+
+// restartDaemon stops the daemon if its process is still alive but not
+// answering, then starts it again and waits for its socket
+func restartDaemon(ctx context.Context, sessionName, pidPath string) error {
+	if pid, running := session.CheckLock(pidPath); running {
+		log.Printf("[WATCHDOG] Stopping unresponsive daemon (PID %d)", pid)
+		if err := terminateProcess(pid, 10*time.Second); err != nil {
+			return err
+		}
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to get executable path: %w", err)
+	}
+	cmd := exec.CommandContext(ctx, executable, "start", sessionName, "--daemon", "--detach")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("start failed: %w", err)
+	}
+
+	socketPath := getSocketPath(sessionName)
+	deadline := time.Now().Add(30 * time.Second)
+	for !isSocketActive(socketPath) {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("daemon did not come up within 30s")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	return nil
+}
+
+// terminateProcess asks a process to exit and kills it if it has not within grace
+func terminateProcess(pid int, grace time.Duration) error {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	if err := process.Signal(syscall.SIGTERM); err != nil {
+		return nil // Already gone
+	}
+	deadline := time.Now().Add(grace)
+	for time.Now().Before(deadline) {
+		if process.Signal(syscall.Signal(0)) != nil {
+			return nil
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	log.Printf("[WATCHDOG] Daemon (PID %d) ignored SIGTERM, killing it", pid)
+	if err := process.Kill(); err != nil && !errors.Is(err, os.ErrProcessDone) {
+		return fmt.Errorf("failed to kill daemon (PID %d): %w", pid, err)
+	}
+	return nil
+}
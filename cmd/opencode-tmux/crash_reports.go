@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	appconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/crashreport"
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/paths"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// defaultCrashEvents is how many recent events a bundle holds without a config
+const defaultCrashEvents = 200
+
+// newCrashReportWriter returns the writer for crash bundles, stored in the
+// configured directory or next to the state file
+func newCrashReportWriter(cfg *appconfig.Config, statePath string) *crashreport.Writer {
+	dir := strings.TrimSuffix(statePath, filepath.Ext(statePath)) + ".crash"
+	var opts crashreport.Options
+	if cfg != nil {
+		if cfg.CrashReports.Dir != "" {
+			dir = cfg.CrashReports.Dir
+		}
+		opts = crashreport.Options{
+			Keep:        cfg.CrashReports.Keep,
+			LogLines:    cfg.CrashReports.LogLines,
+			MinInterval: cfg.CrashReports.MinInterval,
+		}
+	}
+	return crashreport.NewWriter(dir, opts)
+}
+
+// panelCrashSubject names the panel an app runs as in crash bundles
+func panelCrashSubject(appName string) string {
+	if name := panelLogName(appName); name != "" {
+		return name
+	}
+	return filepath.Base(strings.Fields(appName + " unknown")[0])
+}
+
+// reportCrash writes a crash bundle for trigger and announces its path to
+// panels. Repeats for the same subject within the configured interval are
+// dropped, so a panel in a crash loop yields one bundle.
+func (orch *TmuxOrchestrator) reportCrash(trigger crashreport.Trigger) {
+	if orch.crashReports == nil || orch.syncManager == nil {
+		return
+	}
+	trigger.At = time.Now()
+	path, err := orch.crashReports.Write(trigger, orch.collectCrashContents)
+	if errors.Is(err, crashreport.ErrSuppressed) {
+		log.Printf("[DEBUG] Skipping crash bundle for %s %s: %v", trigger.Kind, trigger.Subject, err)
+		return
+	}
+	if err != nil {
+		log.Printf("[ERROR] Failed to write crash bundle for %s %s: %v", trigger.Kind, trigger.Subject, err)
+		return
+	}
+	log.Printf("Crash bundle for %s %s (%s): %s", trigger.Kind, trigger.Subject, trigger.Detail, path)
+
+	orch.syncManager.GetEventBus().Broadcast(types.StateEvent{
+		ID:   ids.New("event"),
+		Type: types.EventCrashReport,
+		Data: types.CrashReportPayload{
+			Kind:      trigger.Kind,
+			Subject:   trigger.Subject,
+			Detail:    trigger.Detail,
+			Path:      path,
+			CreatedAt: trigger.At,
+		},
+		SourcePanel: "system",
+		Timestamp:   time.Now(),
+	})
+}
+
+// crashHealth is the health section of a crash bundle
+type crashHealth struct {
+	Storage  interfaces.HealthCheckResult `json:"storage"`
+	Delivery interfaces.HealthCheckResult `json:"delivery"`
+	Panes    map[string]string            `json:"panes"` // Health of each panel's pane
+}
+
+// crashChecksums is the checksum report of a crash bundle: every backup
+// verified, and what startup repaired
+type crashChecksums struct {
+	Backups  *interfaces.BackupReport  `json:"backups,omitempty"`
+	Recovery interfaces.RecoveryReport `json:"recovery"`
+}
+
+// collectCrashContents gathers what goes into a crash bundle
+func (orch *TmuxOrchestrator) collectCrashContents() crashreport.Contents {
+	contents := crashreport.Contents{Session: orch.sessionName}
+	eventBus := orch.syncManager.GetEventBus()
+
+	events := defaultCrashEvents
+	if orch.appConfig != nil {
+		events = orch.appConfig.CrashReports.Events
+	}
+	contents.Sections = append(contents.Sections, crashreport.Section{Name: "events", Value: eventBus.GetEventHistory(events)})
+
+	if diagnostics, err := orch.GetDiagnostics(0); err == nil {
+		diagnostics.RecentEvents = nil // The events section has them in full
+		contents.Sections = append(contents.Sections, crashreport.Section{Name: "diagnostics", Value: diagnostics})
+	}
+
+	health := crashHealth{Panes: make(map[string]string)}
+	if orch.storageCheck.CheckFunc != nil {
+		health.Storage = orch.storageCheck.CheckFunc()
+	}
+	if orch.deliveryCheck.CheckFunc != nil {
+		health.Delivery = orch.deliveryCheck.CheckFunc()
+	}
+	orch.layoutMutex.Lock()
+	panes := cloneStringMap(orch.panes)
+	orch.layoutMutex.Unlock()
+	if orch.healthChecker != nil {
+		for panel, target := range panes {
+			health.Panes[panel] = orch.healthChecker.CheckPaneHealth(target).String()
+		}
+	}
+	contents.Sections = append(contents.Sections, crashreport.Section{Name: "health", Value: health})
+
+	checksums := crashChecksums{Recovery: orch.lastRecovery}
+	if orch.backupManager != nil {
+		report := orch.backupManager.VerifyAll()
+		checksums.Backups = &report
+	}
+	contents.Sections = append(contents.Sections, crashreport.Section{Name: "checksums", Value: checksums})
+
+	pathMgr := paths.NewPathManager(orch.sessionName)
+	contents.Logs = append(contents.Logs, crashreport.Log{Name: "orchestrator", Path: pathMgr.LogPath()})
+	panelLogs, _ := filepath.Glob(filepath.Join(pathMgr.PanelLogDir(), "*.log"))
+	for _, path := range panelLogs {
+		contents.Logs = append(contents.Logs, crashreport.Log{Name: "panel-" + strings.TrimSuffix(filepath.Base(path), ".log"), Path: path})
+	}
+	return contents
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+// daemonLog is the log file the daemon writes to, nil while logging to stderr
+var daemonLog *reopenableLog
+
+// reopenableLog is a log file that can be moved aside and reopened while the
+// logger keeps writing to it
+type reopenableLog struct {
+	path  string
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// openReopenableLog opens path for appending
+func openReopenableLog(path string) (*reopenableLog, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return &reopenableLog{path: path, file: file}, nil
+}
+
+func (l *reopenableLog) Write(p []byte) (int, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Write(p)
+}
+
+// Rotate renames the log to path.1, replacing an older rotation, and starts a
+// new file at path. It returns the rotated file's path.
+func (l *reopenableLog) Rotate() (string, error) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	rotated := l.path + ".1"
+	if err := os.Rename(l.path, rotated); err != nil {
+		return "", fmt.Errorf("failed to rotate log %s: %w", l.path, err)
+	}
+	file, err := os.OpenFile(l.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		// Keep writing to the renamed file rather than losing output
+		return "", fmt.Errorf("failed to reopen log %s: %w", l.path, err)
+	}
+	l.file.Close()
+	l.file = file
+	return rotated, nil
+}
+
+// Close closes the current file
+func (l *reopenableLog) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
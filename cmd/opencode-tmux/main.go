@@ -9,34 +9,61 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"reflect"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/opencode/tmux_coder/cmd/opencode-tmux/commands"
+	"github.com/opencode/tmux_coder/internal/agentroute"
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/automation"
 	"github.com/opencode/tmux_coder/internal/client"
 	appconfig "github.com/opencode/tmux_coder/internal/config"
 	tmuxconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/connectivity"
+	"github.com/opencode/tmux_coder/internal/contextgauge"
+	"github.com/opencode/tmux_coder/internal/crashreport"
+	"github.com/opencode/tmux_coder/internal/editor"
+	"github.com/opencode/tmux_coder/internal/filediff"
+	"github.com/opencode/tmux_coder/internal/filetree"
+	"github.com/opencode/tmux_coder/internal/gitstatus"
+	"github.com/opencode/tmux_coder/internal/httpapi"
+	"github.com/opencode/tmux_coder/internal/ids"
 	"github.com/opencode/tmux_coder/internal/interfaces"
 	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/lsp"
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/modelpolicy"
 	panelregistry "github.com/opencode/tmux_coder/internal/panel"
 	"github.com/opencode/tmux_coder/internal/paths"
 	"github.com/opencode/tmux_coder/internal/permission"
 	"github.com/opencode/tmux_coder/internal/persistence"
 	"github.com/opencode/tmux_coder/internal/session"
+	"github.com/opencode/tmux_coder/internal/snapshot"
 	"github.com/opencode/tmux_coder/internal/socket"
 	"github.com/opencode/tmux_coder/internal/state"
 	"github.com/opencode/tmux_coder/internal/supervision"
+	"github.com/opencode/tmux_coder/internal/termrun"
 	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/tracing"
 	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/version"
+	"github.com/opencode/tmux_coder/internal/webhook"
 	"github.com/sst/opencode-sdk-go"
 	"github.com/sst/opencode-sdk-go/option"
 	"golang.org/x/term"
@@ -53,6 +80,10 @@ const (
 	ModeDaemon
 )
 
+// resolvedSessionEnv hands the detached daemon child the session name its
+// parent resolved, so a collision is settled once
+const resolvedSessionEnv = "OPENCODE_TMUX_SESSION_NAME"
+
 // String returns the string representation of RunMode
 func (m RunMode) String() string {
 	switch m {
@@ -89,6 +120,8 @@ type TmuxOrchestrator struct {
 	layoutMutex      sync.Mutex
 	paneSupervisorMu sync.Mutex
 	paneSupervisors  map[string]context.CancelFunc
+	maximizeMu       sync.Mutex
+	maximizeTimer    *time.Timer // Restores the layout after the messages pane was maximized
 	lock             *session.SessionLock
 	messageRoles     map[string]string // Track message ID -> role mapping for handling parts
 	messageRolesMu   sync.Mutex        // Protect messageRoles map
@@ -107,8 +140,63 @@ type TmuxOrchestrator struct {
 	owner     interfaces.SessionOwner // Session owner information
 
 	// Stage 6: Process monitoring and health detection
-	healthChecker *supervision.PaneHealthChecker
-	appConfig     *appconfig.Config
+	healthChecker  *supervision.PaneHealthChecker
+	appConfig      *appconfig.Config
+	auditLog       *audit.Log
+	journal        *journal.Journal
+	tracer         *tracing.Tracer
+	snapshotWriter *snapshot.Writer
+	eventOverflow  *state.EventOverflow
+	backupCheck    interfaces.HealthCheck
+	storageCheck   interfaces.HealthCheck
+	deliveryCheck  interfaces.HealthCheck
+	backupManager  *persistence.BackupManager
+	remoteBackup   *persistence.RemoteBackup
+	macroStore     *macro.Store
+	macroRecorder  *macro.Recorder
+	macroReplaying atomic.Bool
+	webhooks       *webhook.Dispatcher
+	httpAPI        *httpapi.Server
+	workspace      *filediff.Workspace // Reads and reverts tool call edits; nil when diffs are disabled
+	diffPaneMu     sync.Mutex          // Serializes opening the diff pane
+	fileTree       *filetree.Lister
+	terminal       *termrun.Runner // Runs commands in terminal panes; nil when disabled
+	terminalMu     sync.Mutex      // Guards terminalRun and terminalActive
+	terminalRun    *termrun.Run    // Latest run; its pane is closed when the next run starts
+	terminalActive bool
+	editor         *editor.Editor // Opens the input in the user's editor
+	editing        atomic.Bool    // Set while the editor is open
+	enricher       *lsp.Enricher  // Gathers prompt context from language servers; nil when disabled
+	runCancelsMu   sync.Mutex
+	runCancels     map[string]context.CancelFunc // Prompts submitted by the orchestrator, by cancel token
+	queueMu        sync.Mutex
+	draining       map[string]bool // Sessions whose prompt queue is being submitted
+
+	// Context window gauge: refreshes are coalesced through contextRefresh
+	contextRefresh  chan struct{}
+	contextMu       sync.Mutex
+	contextMeasured map[string]contextgauge.Measured // Latest provider count by session
+	contextCatalog  contextgauge.Catalog
+	catalogFetched  time.Time
+	// Sessions being summarized; one compaction per session at a time
+	compactMu  sync.Mutex
+	compacting map[string]bool
+
+	// Overflow write failures already reported by the health check
+	lastOverflowErrors int64
+
+	// Crash bundles; nil when disabled or ephemeral
+	crashReports *crashreport.Writer
+	lastRecovery interfaces.RecoveryReport // The startup repair of the state file
+
+	// Config profiles, guarded by layoutMutex; profileName is empty when none is active
+	profiles    map[string]tmuxconfig.Profile
+	profileName string
+	profile     tmuxconfig.Profile
+	boundKeys   []string // tmux keys bound for the active profile
+
+	// Theme and model a new session's state starts with, from the config's session section
+	sessionDefaults tmuxconfig.Session
 
 	// Merge mode: when set, build panes inside an existing tmux session window
 	// instead of creating/managing our own tmux session.
@@ -217,29 +305,35 @@ func (orch *TmuxOrchestrator) Initialize() error {
 	return nil
 }
 
+// loadAppConfig loads and validates the orchestrator config, falling back to defaults
+func loadAppConfig(configPath string) *appconfig.Config {
+	if configPath == "" {
+		log.Printf("[Stage 6] Using default configuration")
+		return appconfig.DefaultConfig()
+	}
+
+	log.Printf("[Stage 6] Loading configuration from: %s", configPath)
+	cfg, err := appconfig.LoadConfig(configPath)
+	if err != nil {
+		log.Printf("[Stage 6] Warning: failed to load config: %v, using defaults", err)
+		return appconfig.DefaultConfig()
+	}
+	if err := cfg.Validate(); err != nil {
+		log.Printf("[Stage 6] Warning: invalid config: %v, using defaults", err)
+		return appconfig.DefaultConfig()
+	}
+
+	log.Printf("[Stage 6] Configuration loaded successfully")
+	return cfg
+}
+
 // Start creates and configures the tmux session with panels
 func (orch *TmuxOrchestrator) Start() error {
 	log.Printf("Starting tmux session: %s", orch.sessionName)
 
-	// Stage 6: Load configuration
-	if orch.configPath != "" {
-		log.Printf("[Stage 6] Loading configuration from: %s", orch.configPath)
-		cfg, err := appconfig.LoadConfig(orch.configPath)
-		if err != nil {
-			log.Printf("[Stage 6] Warning: failed to load config: %v, using defaults", err)
-			orch.appConfig = appconfig.DefaultConfig()
-		} else {
-			if err := cfg.Validate(); err != nil {
-				log.Printf("[Stage 6] Warning: invalid config: %v, using defaults", err)
-				orch.appConfig = appconfig.DefaultConfig()
-			} else {
-				orch.appConfig = cfg
-				log.Printf("[Stage 6] Configuration loaded successfully")
-			}
-		}
-	} else {
-		orch.appConfig = appconfig.DefaultConfig()
-		log.Printf("[Stage 6] Using default configuration")
+	// Stage 6: Load configuration (normally already loaded by main before Initialize)
+	if orch.appConfig == nil {
+		orch.appConfig = loadAppConfig(orch.configPath)
 	}
 
 	// Stage 6: Initialize health checker
@@ -280,7 +374,20 @@ func (orch *TmuxOrchestrator) Start() error {
 			target = target + ":"
 		}
 
-		cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "new-window", "-d", "-t", target, "-P", "-F", "#{window_id}")
+		// A window left by an earlier run, such as one that crashed, is
+		// replaced rather than joined by a second
+		if previous, ok := session.FindHostedWindow(orch.tmuxCommand, orch.sessionName); ok {
+			log.Printf("Replacing window %s of session %s left by an earlier run", previous.WindowID, previous.Host)
+			if err := exec.CommandContext(orch.ctx, orch.tmuxCommand, "kill-window", "-t", previous.WindowID).Run(); err != nil {
+				log.Printf("Warning: failed to remove window %s: %v", previous.WindowID, err)
+			}
+		}
+
+		windowName := strings.TrimSpace(orch.sessionDefaults.WindowName)
+		if windowName == "" {
+			windowName = orch.sessionName
+		}
+		cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "new-window", "-d", "-t", target, "-n", windowName, "-P", "-F", "#{window_id}")
 		out, err := cmd.CombinedOutput()
 		if err != nil {
 			return fmt.Errorf("failed to create window in target session %q: %w\n%s", orch.tmuxTargetSession, err, strings.TrimSpace(string(out)))
@@ -289,6 +396,9 @@ func (orch *TmuxOrchestrator) Start() error {
 		if winID == "" {
 			return fmt.Errorf("tmux did not return a window id for merge window")
 		}
+		if err := session.MarkHostedWindow(orch.tmuxCommand, winID, orch.sessionName); err != nil {
+			log.Printf("Warning: %v; a restart will not find the window", err)
+		}
 		orch.mergedWindowID = winID
 		orch.rootWindowTarget = winID
 		if orch.layout == nil {
@@ -362,6 +472,16 @@ func (orch *TmuxOrchestrator) Stop() error {
 
 	orch.isRunning = false
 
+	// ===== PHASE 0: Drain event subscribers =====
+	// Before the context is cancelled, so in-process subscribers are still
+	// reading; panels get a shutdown event after everything queued for them
+	if orch.syncManager != nil {
+		log.Printf("[Shutdown] Closing event bus...")
+		if err := orch.syncManager.GetEventBus().Close("orchestrator stopping", 3*time.Second); err != nil {
+			log.Printf("[Shutdown] WARNING: %v", err)
+		}
+	}
+
 	// Cancel context to signal shutdown
 	orch.cancel()
 
@@ -371,6 +491,18 @@ func (orch *TmuxOrchestrator) Stop() error {
 		orch.ipcServer.Stop()
 	}
 
+	if orch.httpAPI != nil {
+		log.Printf("[Shutdown] Stopping HTTP API...")
+		if err := orch.httpAPI.Stop(5 * time.Second); err != nil {
+			log.Printf("[Shutdown] WARNING: HTTP API did not stop cleanly: %v", err)
+		}
+	}
+
+	if orch.enricher != nil {
+		log.Printf("[Shutdown] Stopping language servers...")
+		orch.enricher.Close()
+	}
+
 	// ===== PHASE 2: Wait for existing IPC connections to close =====
 	if orch.ipcServer != nil {
 		log.Printf("[Shutdown] Waiting for IPC connections to close...")
@@ -392,6 +524,23 @@ func (orch *TmuxOrchestrator) Stop() error {
 		log.Printf("[Shutdown] Stopping sync manager...")
 		orch.syncManager.Stop()
 	}
+	if orch.auditLog != nil {
+		orch.auditLog.Close()
+	}
+	if orch.journal != nil {
+		orch.journal.Close()
+	}
+	if orch.snapshotWriter != nil {
+		orch.snapshotWriter.Close()
+	}
+	if orch.eventOverflow != nil {
+		orch.eventOverflow.Close()
+	}
+
+	// Key bindings are shared by every tmux session, so they go either way
+	orch.layoutMutex.Lock()
+	orch.unbindProfileKeysLocked()
+	orch.layoutMutex.Unlock()
 
 	// ===== PHASE 5: Handle tmux session =====
 	// Stage 4: Check cleanup flag
@@ -550,6 +699,13 @@ func (orch *TmuxOrchestrator) cleanupSocket() error {
 
 	log.Printf("[Socket] Cleaning up socket: %s", orch.socketPath)
 
+	if err := os.Remove(ipc.AdminTokenPath(orch.socketPath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Socket] WARNING: Failed to remove admin token: %v", err)
+	}
+	if err := os.Remove(httpapi.TokenPath(orch.socketPath)); err != nil && !os.IsNotExist(err) {
+		log.Printf("[Socket] WARNING: Failed to remove HTTP API token: %v", err)
+	}
+
 	// Check socket status before cleanup (for logging purposes)
 	status, err := socket.CheckSocketStatus(orch.socketPath)
 	if err != nil && status != socket.SocketStale && status != socket.SocketNonExistent {
@@ -594,19 +750,68 @@ func (orch *TmuxOrchestrator) initializeStateManagement() error {
 	// Create shared state
 	sharedState := types.NewSharedApplicationState()
 
-	// Create file manager
+	// Create the repository: the state file, or memory for an ephemeral
+	// session, which then writes nothing next to the state file either
+	ephemeral := orch.appConfig != nil && orch.appConfig.Storage.Ephemeral()
 	fileManagerConfig := persistence.DefaultFileManagerConfig(orch.statePath)
-	fileManager := persistence.NewFileManager(fileManagerConfig)
+	if orch.appConfig != nil {
+		fileManagerConfig.DifferentialSave = orch.appConfig.Storage.DifferentialSave
+		// Validated with the config, so a parse error cannot happen here
+		fileManagerConfig.FileMode, _ = orch.appConfig.Storage.ParseFileMode()
+		fileManagerConfig.DirMode, _ = orch.appConfig.Storage.ParseDirMode()
+	}
+	var fileManager *persistence.FileManager
+	var repository interfaces.StateRepository
+	if ephemeral {
+		memory := orch.appConfig.Storage.Memory
+		repository = persistence.NewMemoryRepository(persistence.MemoryOptions{Latency: memory.Latency, FailureRate: memory.FailureRate})
+		log.Printf("Ephemeral mode: state is kept in memory and lost on exit")
+	} else {
+		fileManager = persistence.NewFileManager(fileManagerConfig)
+		repository = fileManager
+		orch.backupManager = persistence.NewBackupManager(fileManager)
+		orch.backupCheck = orch.backupManager.HealthCheck()
+	}
+
+	syncManagerConfig := state.DefaultSyncManagerConfig()
+	if orch.appConfig != nil {
+		syncManagerConfig.SecretPolicy = state.SecretPolicy(orch.appConfig.Security.SecretPolicy)
+		syncManagerConfig.EventHistorySize = orch.appConfig.IPC.EventHistorySize
+		syncManagerConfig.VectorClockNode = orch.appConfig.IPC.VectorClockNode
+		syncManagerConfig.MaxStateSize = orch.appConfig.Storage.MaxStateSize
+		syncManagerConfig.Retention.MaxMessagesPerSession = orch.appConfig.Storage.RetainMessagesPerSession
+		syncManagerConfig.SlowUpdate = orch.appConfig.Watchdog.SlowUpdate
+		syncManagerConfig.SlowSave = orch.appConfig.Watchdog.SlowSave
+		syncManagerConfig.WatchdogDumpDir = orch.appConfig.Watchdog.DumpDir
+	}
+	if ephemeral {
+		// Goroutine dumps go to the log instead
+		syncManagerConfig.WatchdogDumpDir = ""
+	} else if syncManagerConfig.WatchdogDumpDir == "" {
+		syncManagerConfig.WatchdogDumpDir = strings.TrimSuffix(orch.statePath, filepath.Ext(orch.statePath)) + ".watchdog"
+	}
 
 	// Create event bus
-	eventBus := state.NewEventBus(1000)
+	eventBus := state.NewEventBus(syncManagerConfig.EventHistorySize)
+
+	// Spill events evicted from memory to disk so replays survive bursts
+	if !ephemeral && orch.appConfig != nil && orch.appConfig.IPC.EventOverflowSize > 0 {
+		overflowPath := strings.TrimSuffix(orch.statePath, filepath.Ext(orch.statePath)) + ".events.log"
+		if overflow, err := state.OpenEventOverflow(overflowPath, orch.appConfig.IPC.EventOverflowSize, fileManagerConfig.FileMode); err != nil {
+			log.Printf("Warning: failed to open event overflow %s: %v", overflowPath, err)
+		} else {
+			orch.eventOverflow = overflow
+			eventBus.SetOverflow(overflow)
+		}
+	}
 
 	// Create conflict resolver
 	conflictResolver := state.DefaultConflictResolver()
 
 	// Create sync manager
-	syncManagerConfig := state.DefaultSyncManagerConfig()
-	orch.syncManager = state.NewPanelSyncManager(sharedState, fileManager, eventBus, conflictResolver, syncManagerConfig)
+	orch.syncManager = state.NewPanelSyncManager(sharedState, repository, eventBus, conflictResolver, syncManagerConfig)
+	orch.storageCheck = orch.syncManager.StorageHealthCheck()
+	orch.deliveryCheck = orch.syncManager.DeliveryHealthCheck()
 
 	// Create event channel for local state changes
 	eventChan := make(chan types.StateEvent, 100)
@@ -615,10 +820,198 @@ func (orch *TmuxOrchestrator) initializeStateManagement() error {
 	// Start goroutine to handle events
 	go orch.handleEvents(eventChan)
 
+	if !ephemeral && (orch.appConfig == nil || orch.appConfig.CrashReports.Enabled) {
+		orch.crashReports = newCrashReportWriter(orch.appConfig, orch.statePath)
+	}
+
 	// Initialize sync manager
 	if err := orch.syncManager.Initialize(); err != nil {
 		return err
 	}
+	if fileManager != nil {
+		orch.lastRecovery = fileManager.GetStats().LastRecovery
+		if recovery := orch.lastRecovery; recovery.RestoredBackup != "" || len(recovery.Quarantined) > 0 {
+			go orch.reportCrash(crashreport.Trigger{
+				Kind:    crashreport.KindStateCorruption,
+				Subject: filepath.Base(orch.statePath),
+				Detail:  recovery.Summary(),
+			})
+		}
+	}
+
+	var blobStore *persistence.BlobStore
+	if !ephemeral {
+		// Keep large message bodies and tool outputs out of the state file
+		blobStore = persistence.NewBlobStore(persistence.DefaultBlobDir(orch.statePath), fileManagerConfig.FileMode, fileManagerConfig.DirMode)
+		threshold, preview := persistence.DefaultBlobThreshold, persistence.DefaultMessagePreview
+		if orch.appConfig != nil {
+			threshold, preview = orch.appConfig.Storage.MaxMessageSize, orch.appConfig.Storage.MessagePreviewSize
+		}
+		orch.syncManager.SetMessagePreview(preview)
+		orch.syncManager.SetBlobStore(blobStore, threshold)
+
+		// Record applied updates next to the state file; auditing is best effort
+		auditPath := strings.TrimSuffix(orch.statePath, filepath.Ext(orch.statePath)) + ".audit.log"
+		if auditLog, err := audit.Open(audit.DefaultConfig(auditPath)); err != nil {
+			log.Printf("Warning: failed to open audit log %s: %v", auditPath, err)
+		} else {
+			orch.auditLog = auditLog
+			orch.syncManager.SetAuditLog(auditLog)
+			log.Printf("Audit log: %s", auditPath)
+		}
+
+		// Journal applied updates so past versions can be browsed; history is best effort too
+		journalDir := strings.TrimSuffix(orch.statePath, filepath.Ext(orch.statePath)) + ".journal"
+		if j, err := journal.Open(journal.DefaultConfig(journalDir)); err != nil {
+			log.Printf("Warning: failed to open state journal %s: %v", journalDir, err)
+		} else {
+			orch.journal = j
+			orch.syncManager.SetJournal(j)
+			log.Printf("State journal: %s", journalDir)
+		}
+	}
+
+	// Macros are shared by every session, so they live outside the state directory
+	if macroDir, err := macro.DefaultDir(); err != nil {
+		log.Printf("Warning: macros disabled: %v", err)
+	} else {
+		orch.macroStore = macro.NewStore(macroDir)
+		orch.macroRecorder = macro.NewRecorder()
+		orch.syncManager.SetMacroRecorder(orch.macroRecorder)
+	}
+
+	// Trace updates from the socket to disk when a collector is configured
+	if orch.appConfig != nil && orch.appConfig.Tracing.Enabled {
+		cfg := orch.appConfig.Tracing
+		exporter := tracing.NewOTLPExporter(cfg.Endpoint, cfg.ServiceName, cfg.Headers, cfg.Timeout)
+		orch.tracer = tracing.NewTracer(tracing.Options{FlushInterval: cfg.FlushInterval}, exporter)
+		orch.syncManager.SetTracer(orch.tracer)
+		go orch.tracer.Run(orch.ctx)
+		log.Printf("Tracing: exporting spans to %s", cfg.Endpoint)
+	}
+
+	// Run user automation scripts against events; a script that fails to load is skipped
+	if orch.appConfig != nil && len(orch.appConfig.Automation.Scripts) > 0 {
+		orch.startAutomation(eventBus)
+	}
+
+	if orch.appConfig != nil && len(orch.appConfig.Webhooks.Endpoints) > 0 {
+		if endpoints, err := orch.appConfig.Webhooks.BuildEndpoints(); err != nil {
+			log.Printf("Warning: webhooks disabled: %v", err)
+		} else {
+			orch.webhooks = webhook.NewDispatcher(endpoints, webhook.Options{
+				Timeout:     orch.appConfig.Webhooks.Timeout,
+				MaxAttempts: orch.appConfig.Webhooks.MaxAttempts,
+				Session:     orch.sessionName,
+			}, func(messageID string) (types.MessageInfo, bool) {
+				return orch.syncManager.GetState().GetMessageByID(messageID)
+			})
+			events := make(chan types.StateEvent, 512)
+			eventBus.Subscribe("webhooks", "webhooks", "webhooks", events)
+			go orch.webhooks.Run(orch.ctx, events)
+			log.Printf("Webhooks: notifying %d endpoint(s)", len(endpoints))
+		}
+	}
+
+	if workDir, err := os.Getwd(); err != nil {
+		log.Printf("Warning: sessions will not be tied to a workspace: %v", err)
+	} else if err := orch.publishWorkspace(gitstatus.Workspace(orch.ctx, workDir)); err != nil {
+		log.Printf("Warning: failed to publish workspace: %v", err)
+	}
+
+	if orch.appConfig != nil && orch.appConfig.Git.Enabled {
+		if workDir, err := os.Getwd(); err != nil {
+			log.Printf("Warning: git status disabled: %v", err)
+		} else {
+			go gitstatus.NewWatcher(workDir, orch.appConfig.Git.Interval, orch.publishGitStatus).Run(orch.ctx)
+		}
+	}
+
+	if orch.appConfig != nil && orch.appConfig.Connectivity.Enabled && orch.httpClient != nil {
+		cfg := orch.appConfig.Connectivity
+		monitor := connectivity.NewMonitor(connectivity.Options{
+			Interval:     cfg.Interval,
+			Timeout:      cfg.Timeout,
+			SlowAfter:    cfg.SlowAfter,
+			OfflineAfter: cfg.OfflineAfter,
+		}, orch.probeServer, orch.panelLinks, orch.publishConnectivity)
+		go monitor.Run(orch.ctx)
+	}
+
+	if orch.appConfig != nil && orch.appConfig.Diffs.Enabled {
+		if workDir, err := os.Getwd(); err != nil {
+			log.Printf("Warning: file diffs disabled: %v", err)
+		} else {
+			orch.workspace = filediff.NewWorkspace(workDir)
+		}
+	}
+
+	if orch.appConfig != nil && len(orch.appConfig.FileTree.Roots) > 0 {
+		if lister, err := filetree.NewLister(orch.appConfig.FileTree.Roots, orch.appConfig.FileTree.MaxEntries); err != nil {
+			log.Printf("Warning: file tree disabled: %v", err)
+		} else {
+			orch.fileTree = lister
+			orch.publishFileTreeRoots()
+		}
+	}
+
+	if orch.appConfig != nil && orch.appConfig.LSP.Enabled {
+		if workDir, err := os.Getwd(); err != nil {
+			log.Printf("Warning: prompt context disabled: %v", err)
+		} else {
+			orch.enricher = lsp.NewEnricher(workDir, orch.appConfig.LSP.Servers, orch.appConfig.LSP.Timeout)
+		}
+	}
+
+	if orch.appConfig != nil && orch.appConfig.Terminal.Enabled {
+		orch.terminal = termrun.NewRunner(orch.tmuxCommand, filepath.Join(filepath.Dir(orch.statePath), "runs"))
+	}
+	orch.editor = editor.New(orch.tmuxCommand, filepath.Join(filepath.Dir(orch.statePath), "edits"))
+
+	if orch.appConfig != nil {
+		orch.publishModelPolicy(orch.appConfig.Models)
+		orch.publishAgentRoutes(orch.appConfig.Agents)
+		orch.publishSessionTemplates(orch.appConfig.Templates)
+	}
+
+	orch.contextRefresh = make(chan struct{}, 1)
+	orch.contextMeasured = make(map[string]contextgauge.Measured)
+	orch.compacting = make(map[string]bool)
+	go orch.runContextGauge()
+	orch.drainPromptQueues()
+	if orch.httpClient != nil {
+		go orch.runScheduler()
+	}
+
+	if !ephemeral && orch.appConfig != nil && orch.appConfig.IPC.StateSnapshot {
+		snapshotPath := strings.TrimSuffix(orch.statePath, filepath.Ext(orch.statePath)) + ".snapshot"
+		if writer, err := snapshot.Create(snapshotPath, persistence.DefaultFileMode); err != nil {
+			log.Printf("Warning: failed to create state snapshot %s: %v", snapshotPath, err)
+		} else {
+			orch.snapshotWriter = writer
+			orch.syncManager.SetSnapshotWriter(writer)
+			// Publish the loaded state now so panels started before the first save can use it
+			if _, err := writer.Write(orch.syncManager.GetState()); err != nil {
+				log.Printf("Warning: failed to publish initial state snapshot: %v", err)
+			}
+			log.Printf("State snapshot: %s", snapshotPath)
+		}
+	}
+
+	if !ephemeral && orch.appConfig != nil && orch.appConfig.Backup.Interval > 0 && len(orch.appConfig.Backup.Destinations) > 0 {
+		if destinations, err := orch.appConfig.Backup.BuildDestinations(); err != nil {
+			log.Printf("Warning: off-site backups disabled: %v", err)
+		} else {
+			remote := persistence.NewRemoteBackup(fileManager, blobStore, persistence.RemoteBackupConfig{
+				Interval:     orch.appConfig.Backup.Interval,
+				Keep:         orch.appConfig.Backup.Keep,
+				Destinations: destinations,
+			})
+			orch.remoteBackup = remote
+			go remote.Run(orch.ctx)
+			log.Printf("Off-site backups every %v to %d destination(s)", orch.appConfig.Backup.Interval, len(destinations))
+		}
+	}
 
 	// Verify initialization
 	if orch.syncManager == nil {
@@ -637,6 +1030,117 @@ func (orch *TmuxOrchestrator) initializeStateManagement() error {
 	return nil
 }
 
+// startAutomation loads the configured scripts and feeds them events from the bus
+func (orch *TmuxOrchestrator) startAutomation(eventBus *state.EventBus) {
+	paths, err := orch.appConfig.Automation.ScriptPaths()
+	if err != nil {
+		log.Printf("Warning: automation disabled: %v", err)
+		return
+	}
+
+	engine := automation.NewEngine(orch.syncManager.GetState, orch.syncManager.UpdateWithVersionCheck, orch.appConfig.Automation.MaxSteps)
+	for _, path := range paths {
+		if err := engine.LoadFile(path); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
+	if len(engine.Scripts()) == 0 {
+		return
+	}
+
+	// Slow handlers overflow the channel and miss events until resynced; size it for bursts
+	events := make(chan types.StateEvent, 512)
+	eventBus.Subscribe(automation.Source, automation.Source, "automation", events)
+	go engine.Run(orch.ctx, events)
+	log.Printf("Automation: running %d script(s): %s", len(engine.Scripts()), strings.Join(engine.Scripts(), ", "))
+}
+
+// publishWorkspace records the directory new sessions belong to, so the
+// sessions panel can show this workspace's sessions by default, and the
+// tmux session the name template resolved to
+func (orch *TmuxOrchestrator) publishWorkspace(workspace string) error {
+	state := orch.syncManager.GetState()
+	if state.Workspace == workspace && state.TmuxSession == orch.sessionName {
+		return nil
+	}
+	log.Printf("Workspace: %s", workspace)
+	return orch.syncManager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              ids.New("workspace"),
+		Type:            types.WorkspaceChanged,
+		ExpectedVersion: state.GetCurrentVersion(),
+		Payload:         types.WorkspacePayload{Workspace: workspace, TmuxSession: orch.sessionName},
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	})
+}
+
+// publishGitStatus stores the workspace repository status in shared state and
+// exposes a summary as the tmux option @opencode_git for use in status lines
+func (orch *TmuxOrchestrator) publishGitStatus(git *types.GitState) error {
+	update := types.StateUpdate{
+		ID:              ids.New("git_status"),
+		Type:            types.GitStatusChanged,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.GitStatusPayload{Git: git},
+		SourcePanel:     "git",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		return err
+	}
+
+	if !orch.serverOnly {
+		cmd := exec.Command(orch.tmuxCommand, "set-option", "-t", orch.sessionName, "@opencode_git", gitstatus.Summary(git))
+		if err := cmd.Run(); err != nil {
+			log.Printf("[StatusBar] Failed to set @opencode_git: %v", err)
+		}
+	}
+	return nil
+}
+
+// probeServer makes one cheap request to the opencode server. The probe is
+// not retried; repeated failures are what the monitor counts.
+func (orch *TmuxOrchestrator) probeServer(ctx context.Context) error {
+	_, err := orch.httpClient.Path.Get(ctx, opencode.PathGetParams{}, option.WithMaxRetries(0))
+	return err
+}
+
+// panelLinks lists the panels connected over IPC
+func (orch *TmuxOrchestrator) panelLinks() []connectivity.PanelLink {
+	if orch.ipcServer == nil {
+		return nil
+	}
+	var links []connectivity.PanelLink
+	for _, conn := range orch.ipcServer.GetConnections() {
+		links = append(links, connectivity.PanelLink{PanelID: conn.PanelID, LastSeen: conn.LastSeen})
+	}
+	return links
+}
+
+// publishConnectivity stores the link health in shared state and exposes the
+// overall status as the tmux option @opencode_connection
+func (orch *TmuxOrchestrator) publishConnectivity(connection types.ConnectionState, transitions []types.LinkTransition) error {
+	update := types.StateUpdate{
+		ID:              ids.New("connectivity"),
+		Type:            types.ConnectivityChanged,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.ConnectivityChangedPayload{Connection: connection, Transitions: transitions},
+		SourcePanel:     "connectivity",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		return err
+	}
+
+	if !orch.serverOnly {
+		cmd := exec.Command(orch.tmuxCommand, "set-option", "-t", orch.sessionName, "@opencode_connection", connection.Status)
+		if err := cmd.Run(); err != nil {
+			log.Printf("[StatusBar] Failed to set @opencode_connection: %v", err)
+		}
+	}
+	return nil
+}
+
 // handleLocalSessionChanged handles local session change events from panels
 func (orch *TmuxOrchestrator) handleEvents(eventChan chan types.StateEvent) {
 	for event := range eventChan {
@@ -645,12 +1149,33 @@ func (orch *TmuxOrchestrator) handleEvents(eventChan chan types.StateEvent) {
 			if err := orch.handleLocalSessionChanged(event); err != nil {
 				log.Printf("Error handling local session change: %v", err)
 			}
+			orch.requestContextRefresh()
 		case types.EventThemeChanged:
 			if err := orch.handleThemeChanged(event); err != nil {
 				log.Printf("Error handling theme change: %v", err)
 			}
 		case types.EventPanelDisconnected:
 			orch.handlePanelDisconnected(event)
+		case types.EventUIActionTriggered:
+			orch.handleUIAction(event)
+		case types.EventRunAttempted:
+			orch.noteRunAttempt(event)
+		case types.EventRunFinished, types.EventPromptQueued:
+			orch.drainPromptQueue(orch.eventSessionID(event))
+		case types.EventMessageAdded, types.EventMessageUpdated:
+			orch.extractCodeBlocks(event)
+			orch.requestContextRefresh()
+		case types.EventMessagesCleared, types.EventModelChanged, types.EventAgentChanged:
+			orch.requestContextRefresh()
+		case types.EventRunCancelled:
+			// The abort is an HTTP call; keep the event loop free
+			go orch.handleRunCancelled(event)
+			orch.drainPromptQueue(orch.eventSessionID(event))
+		case types.EventInputLocationChanged:
+			if orch.enricher != nil {
+				// Language servers can take seconds; keep the event loop free
+				go orch.gatherPromptContext()
+			}
 		default:
 			// Handle other event types if needed
 			log.Printf("Received event: %s from panel %s", event.Type, event.SourcePanel)
@@ -658,71 +1183,358 @@ func (orch *TmuxOrchestrator) handleEvents(eventChan chan types.StateEvent) {
 	}
 }
 
-func (orch *TmuxOrchestrator) handleLocalSessionChanged(event types.StateEvent) error {
-	log.Printf("[TMUX] Handling local session change event: %+v", event)
-
-	// Extract session ID from the event payload
-	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
-		var payload types.SessionChangePayload
-		if sessionIDRaw, exists := payloadMap["session_id"]; exists {
-			if sessionID, ok := sessionIDRaw.(string); ok {
-				payload.SessionID = sessionID
-				log.Printf("[TMUX] Session changed to: %s", payload.SessionID)
+// publishFileTreeRoots stores the configured roots in the file tree state when
+// they changed since the state was saved
+func (orch *TmuxOrchestrator) publishFileTreeRoots() {
+	roots := orch.fileTree.Roots()
+	if slices.Equal(orch.syncManager.GetState().GetFileTree().Roots, roots) {
+		return
+	}
+	update := types.StateUpdate{
+		ID:              ids.New("file_tree_roots"),
+		Type:            types.FileTreeChanged,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.FileTreeUpdatePayload{Action: types.FileTreeSetRoots, Roots: roots},
+		SourcePanel:     "system",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("Warning: failed to set file tree roots: %v", err)
+	}
+}
 
-				// The state has already been updated by the sync manager
-				// We just need to log this for debugging purposes
-				return nil
-			}
+// publishModelPolicy stores the configured retry and fallback policy, which
+// every panel submitting prompts follows, when it changed since the state was saved
+func (orch *TmuxOrchestrator) publishModelPolicy(cfg appconfig.ModelsConfig) {
+	policy := &types.ModelPolicy{MaxRetries: cfg.MaxRetries, Backoff: cfg.RetryBackoff}
+	for _, name := range cfg.Fallbacks {
+		model, err := types.ParseModelRef(name)
+		if err != nil {
+			log.Printf("Warning: skipping model fallback: %v", err)
+			continue
 		}
+		policy.Fallbacks = append(policy.Fallbacks, model)
+	}
+	if current := orch.syncManager.GetState().ModelPolicy; current != nil && reflect.DeepEqual(current, policy) {
+		return
+	}
+	update := types.StateUpdate{
+		ID:              ids.New("model_policy"),
+		Type:            types.ModelPolicyChanged,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.ModelPolicyPayload{Policy: policy},
+		SourcePanel:     "system",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("Warning: failed to set model policy: %v", err)
 	}
-
-	log.Printf("[TMUX] Failed to extract session ID from event payload")
-	return nil
 }
 
-func (orch *TmuxOrchestrator) handleThemeChanged(event types.StateEvent) error {
-	log.Printf("[TMUX] Handling theme change event: %+v", event)
+// publishAgentRoutes stores the configured routes from mentions to agents,
+// which every panel submitting prompts follows, when they changed since the state was saved
+func (orch *TmuxOrchestrator) publishAgentRoutes(cfg appconfig.AgentsConfig) {
+	routes := cfg.Routes
+	if current := orch.syncManager.GetState().GetAgentRoutes(); len(current) == 0 && len(routes) == 0 || reflect.DeepEqual(current, routes) {
+		return
+	}
+	update := types.StateUpdate{
+		ID:              ids.New("agent_routes"),
+		Type:            types.AgentRoutesChanged,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.AgentRoutesPayload{Routes: routes},
+		SourcePanel:     "system",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("Warning: failed to set agent routes: %v", err)
+	}
+}
 
-	// Extract theme name from the event payload
-	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
-		var payload types.ThemeChangePayload
-		if themeRaw, exists := payloadMap["theme"]; exists {
-			if theme, ok := themeRaw.(string); ok {
-				payload.Theme = theme
-				log.Printf("[TMUX] Theme changed to: %s", payload.Theme)
+// requestContextRefresh asks for the context gauge to be recomputed; requests
+// made while one is pending are merged
+func (orch *TmuxOrchestrator) requestContextRefresh() {
+	select {
+	case orch.contextRefresh <- struct{}{}:
+	default:
+	}
+}
 
-				// Apply the theme globally to all panels
-				return orch.applyGlobalTheme(payload.Theme)
-			}
+// runContextGauge recomputes the context window usage of the current session
+// on request until the orchestrator stops
+func (orch *TmuxOrchestrator) runContextGauge() {
+	for {
+		select {
+		case <-orch.ctx.Done():
+			return
+		case <-orch.contextRefresh:
+			orch.refreshContextUsage()
 		}
 	}
+}
 
-	log.Printf("[TMUX] Failed to extract theme from event payload")
-	return nil
+// recordContextMeasured keeps the context size a provider reported with a reply
+func (orch *TmuxOrchestrator) recordContextMeasured(sessionID, messageID string, tokens int) {
+	orch.contextMu.Lock()
+	orch.contextMeasured[sessionID] = contextgauge.Measured{MessageID: messageID, Tokens: tokens}
+	orch.contextMu.Unlock()
+	orch.requestContextRefresh()
 }
 
-func (orch *TmuxOrchestrator) handlePanelDisconnected(event types.StateEvent) {
-	panelID, panelType := extractPanelConnectionInfo(event.Data)
-	if panelID == "" && panelType == "" {
-		log.Printf("[TMUX] panel disconnect event missing identifiers: %+v", event.Data)
-		return
+// contextLimit returns the context window of a model from the provider
+// catalog, fetching the catalog when the model is not in it, at most once a minute
+func (orch *TmuxOrchestrator) contextLimit(model types.ModelRef) int {
+	orch.contextMu.Lock()
+	limit, ok := orch.contextCatalog[model]
+	stale := time.Since(orch.catalogFetched) > time.Minute
+	orch.contextMu.Unlock()
+	if ok || !stale || orch.httpClient == nil || model.IsZero() {
+		return limit
 	}
 
-	target := orch.getPaneTarget(panelID, panelType)
-	if strings.TrimSpace(target) == "" {
-		log.Printf("[TMUX] No pane target recorded for panel %s (%s)", panelID, panelType)
+	ctx, cancel := context.WithTimeout(orch.ctx, 15*time.Second)
+	defer cancel()
+	response, err := orch.httpClient.App.Providers(ctx, opencode.AppProvidersParams{})
+	orch.contextMu.Lock()
+	defer orch.contextMu.Unlock()
+	orch.catalogFetched = time.Now()
+	if err != nil {
+		log.Printf("[CONTEXT] Failed to load the model catalog: %v", err)
+		return 0
+	}
+	orch.contextCatalog = contextgauge.CatalogFromProviders(response)
+	return orch.contextCatalog[model]
+}
+
+// refreshContextUsage measures the current session against the selected
+// model's context window. It stores the usage when it moved noticeably and
+// announces a threshold when usage rose to the warning or critical level.
+func (orch *TmuxOrchestrator) refreshContextUsage() {
+	current := orch.syncManager.GetState()
+	sessionID := current.GetCurrentSessionID()
+	if sessionID == "" {
+		return
+	}
+	model := types.ModelRef{ProviderID: current.Provider, ModelID: current.Model}
+	limit := orch.contextLimit(model)
+
+	orch.contextMu.Lock()
+	measured := orch.contextMeasured[sessionID]
+	orch.contextMu.Unlock()
+	tokens, estimated := contextgauge.Estimate(current.Messages, sessionID, measured)
+
+	usage := types.ContextUsage{
+		SessionID: sessionID,
+		Model:     model,
+		Tokens:    tokens,
+		Limit:     limit,
+		Estimated: estimated,
+		UpdatedAt: time.Now(),
+	}
+	usage.Level = types.ContextLevel(usage.Percent())
+	previous := current.ContextUsage
+	if !contextgauge.Changed(previous, usage) {
 		return
 	}
 
-	appName, err := orch.getPanelAppName(panelID, panelType)
-	if err != nil {
-		log.Printf("[TMUX] Unable to resolve app for panel %s (%s): %v", panelID, panelType, err)
+	update := types.StateUpdate{
+		ID:              ids.New("context_usage"),
+		Type:            types.ContextUsageUpdated,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.ContextUsagePayload{Usage: usage},
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[CONTEXT] Failed to store context usage: %v", err)
+		return
+	}
+	if !contextgauge.Crossed(previous, usage) {
 		return
 	}
 
-	for attempt := 0; attempt < 3; attempt++ {
-		if orch.paneExists(target) && orch.paneMatchesApp(target, appName) {
-			break
+	log.Printf("[CONTEXT] Session %s uses %.0f%% of the %s context window", sessionID, usage.Percent(), model)
+	update = types.StateUpdate{
+		ID:              ids.New("context_threshold"),
+		Type:            types.ContextThreshold,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.ContextThresholdPayload{Usage: usage},
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[CONTEXT] Failed to announce context threshold: %v", err)
+	}
+}
+
+// noteRunAttempt adds a line to the run's session when an attempt failed and
+// the run retried, fell back or gave up after earlier attempts, so the user
+// sees why the reply is late or came from another model
+func (orch *TmuxOrchestrator) noteRunAttempt(event types.StateEvent) {
+	var payload types.RunAttemptedPayload
+	switch data := event.Data.(type) {
+	case types.RunAttemptedPayload:
+		payload = data
+	default:
+		return
+	}
+	attempt := payload.Attempt
+	if attempt.Outcome == types.AttemptSucceeded || (attempt.Outcome == types.AttemptFailed && attempt.Number == 1) {
+		return
+	}
+	run, ok := orch.syncManager.GetState().GetAgentRun(payload.RunID)
+	if !ok {
+		return
+	}
+	message := types.MessageInfo{
+		ID:        fmt.Sprintf("%s_attempt_%d", run.ID, attempt.Number),
+		SessionID: run.SessionID,
+		Type:      "system",
+		Content:   modelpolicy.Describe(attempt),
+		Timestamp: attempt.FinishedAt,
+		Status:    "completed",
+	}
+	if err := orch.syncManager.AddMessage(message, "orchestrator"); err != nil {
+		log.Printf("[RUNS] Failed to note attempt %d of run %s: %v", attempt.Number, run.ID, err)
+	}
+}
+
+// gatherPromptContext asks the language server about the location attached
+// to the input and stores what it says. A failure is stored too, so the input
+// panel can show why no context was added.
+func (orch *TmuxOrchestrator) gatherPromptContext() {
+	location, ok := orch.syncManager.GetState().GetInputLocation()
+	if !ok {
+		return
+	}
+	promptContext, err := orch.enricher.Enrich(orch.ctx, location)
+	if err != nil {
+		log.Printf("[LSP] No context for %s: %v", location, err)
+		promptContext = &types.PromptContext{Location: location, Error: err.Error(), UpdatedAt: time.Now()}
+	}
+
+	update := types.StateUpdate{
+		ID:              ids.New("prompt_context"),
+		Type:            types.PromptContextUpdated,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.PromptContextPayload{Context: *promptContext},
+		SourcePanel:     "lsp",
+		Timestamp:       time.Now(),
+	}
+	// Fails as stale when the location changed meanwhile; that change gathers its own
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[LSP] Prompt context for %s not stored: %v", location, err)
+	}
+}
+
+// handleUIAction runs the UI actions the orchestrator itself handles
+func (orch *TmuxOrchestrator) handleUIAction(event types.StateEvent) {
+	payload, ok := types.UIActionFromEvent(event)
+	if !ok {
+		return
+	}
+	switch payload.Action {
+	case types.UIActionDiffAccept, types.UIActionDiffRevert:
+		var args types.DiffActionArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			log.Printf("[DIFF] Ignoring %s: %v", payload.Action, err)
+			return
+		}
+		// Reverting runs git; keep the event loop free
+		go orch.resolveFileDiff(payload.Action, args)
+	case types.UIActionZoomPane, types.UIActionCycleFocus, types.UIActionMaximizeMessages:
+		if err := orch.handlePaneAction(payload); err != nil {
+			log.Printf("[LAYOUT] %s failed: %v", payload.Action, err)
+		}
+	case types.UIActionCopyCodeBlock, types.UIActionSaveCodeBlock, types.UIActionOpenCodeBlock:
+		var args types.CodeBlockArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			log.Printf("[CODEBLOCKS] Ignoring %s: %v", payload.Action, err)
+			return
+		}
+		// Copying and opening run tmux; keep the event loop free
+		go orch.handleCodeBlockAction(payload.Action, args)
+	}
+}
+
+func (orch *TmuxOrchestrator) handleLocalSessionChanged(event types.StateEvent) error {
+	log.Printf("[TMUX] Handling local session change event: %+v", event)
+
+	// Extract session ID from the event payload
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.SessionChangePayload
+		if sessionIDRaw, exists := payloadMap["session_id"]; exists {
+			if sessionID, ok := sessionIDRaw.(string); ok {
+				payload.SessionID = sessionID
+				log.Printf("[TMUX] Session changed to: %s", payload.SessionID)
+
+				// The state has already been updated by the sync manager
+				// We just need to log this for debugging purposes
+				return nil
+			}
+		}
+	}
+
+	log.Printf("[TMUX] Failed to extract session ID from event payload")
+	return nil
+}
+
+func (orch *TmuxOrchestrator) handleThemeChanged(event types.StateEvent) error {
+	log.Printf("[TMUX] Handling theme change event: %+v", event)
+
+	// Extract theme name from the event payload
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.ThemeChangePayload
+		if themeRaw, exists := payloadMap["theme"]; exists {
+			if theme, ok := themeRaw.(string); ok {
+				payload.Theme = theme
+				log.Printf("[TMUX] Theme changed to: %s", payload.Theme)
+
+				// Apply the theme globally to all panels
+				return orch.applyGlobalTheme(payload.Theme)
+			}
+		}
+	}
+
+	log.Printf("[TMUX] Failed to extract theme from event payload")
+	return nil
+}
+
+func (orch *TmuxOrchestrator) handlePanelDisconnected(event types.StateEvent) {
+	panelID, panelType := extractPanelConnectionInfo(event.Data)
+	if panelID == "" && panelType == "" {
+		log.Printf("[TMUX] panel disconnect event missing identifiers: %+v", event.Data)
+		return
+	}
+	if panelType == "diff" {
+		// The diff pane closes with its panel and is reopened by the next diff
+		orch.layoutMutex.Lock()
+		delete(orch.panes, "diff")
+		orch.layoutMutex.Unlock()
+		return
+	}
+
+	policy := orch.layoutPanelPolicy(panelID)
+	if policy.Restart == supervision.RestartNever {
+		log.Printf("[TMUX] Panel %s (%s) disconnected; not restarting (restart: never)", panelID, panelType)
+		return
+	}
+
+	target := orch.getPaneTarget(panelID, panelType)
+	if strings.TrimSpace(target) == "" {
+		log.Printf("[TMUX] No pane target recorded for panel %s (%s)", panelID, panelType)
+		return
+	}
+
+	appName, err := orch.getPanelAppName(panelID, panelType)
+	if err != nil {
+		log.Printf("[TMUX] Unable to resolve app for panel %s (%s): %v", panelID, panelType, err)
+		return
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		if orch.paneExists(target) && orch.paneMatchesApp(target, appName) {
+			break
 		}
 		log.Printf("[TMUX] Pane %s for panel %s (%s) missing/stale (attempt %d); attempting recover", target, panelID, panelType, attempt+1)
 		recovered, err := orch.recoverMissingPane(panelID, panelType)
@@ -761,14 +1573,11 @@ func (orch *TmuxOrchestrator) handlePanelDisconnected(event types.StateEvent) {
 		return
 	}
 
-	envVars := map[string]string{
-		"OPENCODE_SERVER": os.Getenv("OPENCODE_SERVER"),
-		"OPENCODE_SOCKET": orch.socketPath,
-	}
+	envVars := orch.panelEnv()
 
 	go func(panelID, panelType, paneTarget, app string) {
 		log.Printf("[TMUX] Restarting panel %s (%s) after disconnect", panelID, panelType)
-		if err := orch.startPanelApp(paneTarget, app, envVars); err != nil {
+		if err := orch.startPanelApp(paneTarget, app, envVars, policy); err != nil {
 			log.Printf("[TMUX] Failed to restart panel %s (%s): %v", panelID, panelType, err)
 		}
 	}(panelID, panelType, target, appName)
@@ -811,17 +1620,156 @@ func (orch *TmuxOrchestrator) startIPCServer() error {
 	// Stage 5: Set up permission checker with default policy
 	permissionChecker := permission.NewChecker(orch.owner, nil)
 	orch.ipcServer.SetPermissionChecker(permissionChecker)
+	orch.ipcServer.SetTracer(orch.tracer)
 	log.Printf("Permission checker configured for session owner: %s (UID=%d, GID=%d)",
 		orch.owner.Username, orch.owner.UID, orch.owner.GID)
 
+	// Socket mode and peer policy gate who may connect at all
+	if orch.appConfig != nil {
+		if mode, err := orch.appConfig.IPC.ParseSocketMode(); err == nil {
+			orch.ipcServer.SetSocketMode(mode)
+		}
+		orch.ipcServer.SetPeerPolicy(permission.PermissionLevel(orch.appConfig.IPC.PeerPolicy))
+		log.Printf("IPC socket mode %s, peer policy %s", orch.appConfig.IPC.SocketMode, orch.appConfig.IPC.PeerPolicy)
+
+		// Destructive operations from panels wait for the panel to confirm them
+		confirmations := make(map[types.UpdateType]time.Duration, len(orch.appConfig.Confirmation.Operations))
+		for operation, timeout := range orch.appConfig.Confirmation.Operations {
+			confirmations[types.UpdateType(operation)] = timeout
+		}
+		orch.ipcServer.SetConfirmations(confirmations)
+	}
+
 	// Start server
 	if err := orch.ipcServer.Start(); err != nil {
 		return err
 	}
 
+	// Admin commands need a token only the session owner can read
+	tokenPath := ipc.AdminTokenPath(orch.socketPath)
+	if token, err := ipc.CreateToken(tokenPath); err != nil {
+		log.Printf("Warning: admin commands disabled: %v", err)
+	} else {
+		orch.ipcServer.SetAdminToken(token)
+		log.Printf("Admin token: %s", tokenPath)
+	}
+	orch.ipcServer.SetProfileDir(paths.NewPathManager(orch.sessionName).ProfileDir())
+
+	if orch.appConfig != nil && orch.appConfig.HTTPAPI.Enabled {
+		orch.startHTTPAPI()
+	}
+
+	return nil
+}
+
+// startHTTPAPI serves the inbound HTTP API; failing to start it is not fatal
+func (orch *TmuxOrchestrator) startHTTPAPI() {
+	cfg := orch.appConfig.HTTPAPI
+	token := ""
+	if cfg.TokenEnv != "" {
+		token = os.Getenv(cfg.TokenEnv)
+	} else {
+		tokenPath := httpapi.TokenPath(orch.socketPath)
+		generated, err := ipc.CreateToken(tokenPath)
+		if err != nil {
+			log.Printf("Warning: HTTP API disabled: %v", err)
+			return
+		}
+		token = generated
+		log.Printf("HTTP API token: %s", tokenPath)
+	}
+	if token == "" {
+		log.Printf("Warning: HTTP API disabled: %s is empty", cfg.TokenEnv)
+		return
+	}
+
+	server := httpapi.NewServer(apiBackend{orch: orch}, token)
+	if err := server.Start(cfg.Listen); err != nil {
+		log.Printf("Warning: HTTP API disabled: %v", err)
+		return
+	}
+	orch.httpAPI = server
+	log.Printf("HTTP API listening on %s", cfg.Listen)
+}
+
+// apiBackend carries out HTTP API requests through the opencode server and shared state
+type apiBackend struct {
+	orch *TmuxOrchestrator
+}
+
+func (b apiBackend) CreateSession(ctx context.Context, title string) (types.SessionInfo, error) {
+	if b.orch.httpClient == nil {
+		return types.SessionInfo{}, fmt.Errorf("no opencode server to create sessions on")
+	}
+	params := opencode.SessionNewParams{}
+	if title != "" {
+		params.Title = opencode.F(title)
+	}
+	session, err := b.orch.httpClient.Session.New(ctx, params)
+	if err != nil {
+		return types.SessionInfo{}, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	info := types.SessionInfo{
+		ID:        session.ID,
+		Title:     session.Title,
+		CreatedAt: parseServerTime(session.Time.Created),
+		UpdatedAt: parseServerTime(session.Time.Updated),
+		IsActive:  true,
+	}
+	if err := b.orch.syncManager.AddSession(info, "http-api"); err != nil {
+		return types.SessionInfo{}, fmt.Errorf("session %s created but not added to state: %w", session.ID, err)
+	}
+	return info, nil
+}
+
+// SubmitMessage records the prompt and submits it in the background, as the
+// input panel does; the reply arrives through the usual event stream
+func (b apiBackend) SubmitMessage(ctx context.Context, sessionID, text string) error {
+	if _, ok := b.orch.syncManager.GetState().GetSessionByID(sessionID); !ok {
+		return fmt.Errorf("%w: %s", httpapi.ErrSessionNotFound, sessionID)
+	}
+	if b.orch.httpClient == nil {
+		return fmt.Errorf("no opencode server to submit prompts to")
+	}
+
+	update := types.StateUpdate{
+		ID:              ids.New("http_api_prompt"),
+		Type:            types.PromptSubmitted,
+		ExpectedVersion: b.orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.PromptSubmitPayload{SessionID: sessionID, Text: text},
+		SourcePanel:     "http-api",
+		Timestamp:       time.Now(),
+	}
+	if err := b.orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		return fmt.Errorf("failed to record prompt: %w", err)
+	}
+
+	go func() {
+		if err := b.orch.submitPrompt(b.orch.ctx, sessionID, text); err != nil {
+			log.Printf("HTTP API: prompt for session %s failed: %v", sessionID, err)
+		}
+	}()
 	return nil
 }
 
+func (b apiBackend) Transcript(sessionID string) (*state.SessionExport, error) {
+	if _, ok := b.orch.syncManager.GetState().GetSessionByID(sessionID); !ok {
+		return nil, fmt.Errorf("%w: %s", httpapi.ErrSessionNotFound, sessionID)
+	}
+	export, err := b.orch.syncManager.ExportSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range export.Messages {
+		// HTTP clients cannot fetch blobs; a missing one leaves the message as stored
+		if err := b.orch.syncManager.ResolveMessageBody(&export.Messages[i]); err != nil {
+			log.Printf("HTTP API: failed to load body of message %s: %v", export.Messages[i].ID, err)
+		}
+	}
+	return export, nil
+}
+
 // isTmuxAvailable checks if tmux is available on the system
 func (orch *TmuxOrchestrator) isTmuxAvailable() bool {
 	_, err := exec.LookPath(orch.tmuxCommand)
@@ -836,6 +1784,12 @@ func (orch *TmuxOrchestrator) createTmuxSession() error {
 		return fmt.Errorf("failed to create tmux session: %w", err)
 	}
 
+	// Tag it with the project, so another project's start does not take it
+	if workDir, err := os.Getwd(); err == nil {
+		if err := session.MarkProject(orch.tmuxCommand, orch.sessionName, gitstatus.Workspace(orch.ctx, workDir)); err != nil {
+			log.Printf("Warning: %v", err)
+		}
+	}
 	return nil
 }
 
@@ -1201,34 +2155,149 @@ func (orch *TmuxOrchestrator) getWindowID(target string) (string, error) {
 func (orch *TmuxOrchestrator) handleSessionCompactedEvent(sessionID string) error {
 	log.Printf("[SSE] Session compacted: %s", sessionID)
 
-	data := make(map[string]interface{})
-	if sessionID != "" {
-		data["session_id"] = sessionID
-	}
-
-	if err := orch.triggerUIAction("refresh_messages", data); err != nil {
+	args := types.RefreshMessagesArgs{SessionID: sessionID}
+	if err := orch.triggerUIAction(types.UIActionRefreshMessages, args); err != nil {
 		return fmt.Errorf("failed to trigger messages refresh: %w", err)
 	}
 
 	return nil
 }
 
-func (orch *TmuxOrchestrator) triggerUIAction(action string, data map[string]interface{}) error {
+func (orch *TmuxOrchestrator) triggerUIAction(action types.UIAction, args types.UIActionArgs) error {
+	payload, err := types.NewUIActionPayload(action, args)
+	if err != nil {
+		return err
+	}
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("ui_action_%s_%d", action, time.Now().UnixNano()),
+		ID:              ids.New("ui_action_" + string(action)),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
-		Payload: types.UIActionPayload{
-			Action: action,
-			Data:   data,
-		},
-		SourcePanel: "tmux-orchestrator",
-		Timestamp:   time.Now(),
+		Payload:         payload,
+		SourcePanel:     "tmux-orchestrator",
+		Timestamp:       time.Now(),
 	}
 
 	return orch.syncManager.UpdateWithVersionCheck(update)
 }
 
+// publishFileDiff stores the diff of a tool call that edited files and shows
+// it in the diff pane
+func (orch *TmuxOrchestrator) publishFileDiff(diff types.FileDiffSet) {
+	// Completed tool parts can be delivered more than once; keep the outcome of a resolved diff
+	if existing, ok := orch.syncManager.GetState().GetFileDiff(diff.ID); ok && existing.Status != types.FileDiffPending {
+		return
+	}
+	orch.workspace.Fill(orch.ctx, &diff)
+	if len(diff.Files) == 0 {
+		log.Printf("[DIFF] %s call %s left no changes to show", diff.Tool, diff.ID)
+		return
+	}
+
+	update := types.StateUpdate{
+		ID:              ids.New("file_diff_" + diff.ID),
+		Type:            types.FileDiffReady,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.FileDiffReadyPayload{Diff: diff},
+		SourcePanel:     "filediff",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[DIFF] Failed to publish diff %s: %v", diff.ID, err)
+		return
+	}
+	log.Printf("[DIFF] %s call %s changed %d file(s)", diff.Tool, diff.ID, len(diff.Files))
+
+	if !orch.serverOnly && orch.appConfig.Diffs.OpenPane {
+		if err := orch.openDiffPane(); err != nil {
+			log.Printf("[DIFF] Failed to open diff pane: %v", err)
+		}
+	}
+}
+
+// openDiffPane splits a diff pane off the messages pane unless one is open.
+// The pane is not supervised: quitting the panel closes it, and the next diff
+// opens a new one.
+func (orch *TmuxOrchestrator) openDiffPane() error {
+	orch.diffPaneMu.Lock()
+	defer orch.diffPaneMu.Unlock()
+
+	orch.layoutMutex.Lock()
+	target := orch.panes["diff"]
+	orch.layoutMutex.Unlock()
+	if target != "" && orch.paneExists(target) {
+		// The running panel picks the diff up from its event
+		return nil
+	}
+
+	messagesPane := orch.getPaneTarget("messages", "messages")
+	if messagesPane == "" {
+		return fmt.Errorf("no messages pane to split")
+	}
+	cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "split-window", "-h", "-d",
+		"-l", orch.appConfig.Diffs.PaneSize, "-t", messagesPane, "-P", "-F", "#{pane_id}")
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to split messages pane: %w", err)
+	}
+	target = strings.TrimSpace(string(output))
+	orch.updatePaneTarget("diff", "diff", target)
+
+	return orch.launchPaneProcess(target, "opencode-diff", orch.panelEnv(), supervision.PanePolicy{})
+}
+
+// resolveFileDiff accepts or reverts a diff and records the outcome in state.
+// Accepting keeps the files as they are; reverting applies the patches in reverse.
+// A proposed change is written when accepted and discarded when reverted.
+func (orch *TmuxOrchestrator) resolveFileDiff(action types.UIAction, args types.DiffActionArgs) {
+	diff, ok := orch.syncManager.GetState().GetFileDiff(args.DiffID)
+	if !ok {
+		log.Printf("[DIFF] %s: diff %s not found", action, args.DiffID)
+		return
+	}
+
+	resolved := types.FileDiffResolvedPayload{DiffID: diff.ID}
+	switch {
+	case diff.Status == types.FileDiffReverted:
+		resolved.Error = "diff was already reverted"
+	case diff.Proposal != nil && diff.Status != types.FileDiffPending:
+		resolved.Error = "change was already " + diff.Status
+	case diff.Proposal != nil && action == types.UIActionDiffAccept:
+		resolved.Status = types.FileDiffAccepted
+		if err := orch.applyProposal(diff); err != nil {
+			resolved.Error = err.Error()
+		}
+	case diff.Proposal != nil:
+		resolved.Status = types.FileDiffDiscarded
+	case action == types.UIActionDiffAccept:
+		resolved.Status = types.FileDiffAccepted
+	case orch.workspace == nil:
+		resolved.Error = "file diffs are disabled"
+	default:
+		resolved.Status = types.FileDiffReverted
+		if err := orch.workspace.Revert(orch.ctx, diff, args.Paths); err != nil {
+			resolved.Error = err.Error()
+		}
+	}
+
+	update := types.StateUpdate{
+		ID:              ids.New("file_diff_resolved_" + diff.ID),
+		Type:            types.FileDiffResolved,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         resolved,
+		SourcePanel:     "filediff",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[DIFF] Failed to record %s of diff %s: %v", action, diff.ID, err)
+		return
+	}
+	if resolved.Error != "" {
+		log.Printf("[DIFF] %s of diff %s failed: %s", action, diff.ID, resolved.Error)
+	} else {
+		log.Printf("[DIFF] Diff %s %s", diff.ID, resolved.Status)
+	}
+}
+
 // startPanelApplications starts the applications in each panel
 func (orch *TmuxOrchestrator) startPanelApplications() error {
 	if orch.layout != nil {
@@ -1237,14 +2306,33 @@ func (orch *TmuxOrchestrator) startPanelApplications() error {
 	return orch.startDefaultPanelApplications()
 }
 
+// panelEnv returns the environment passed to every panel process
+func (orch *TmuxOrchestrator) panelEnv() map[string]string {
+	env := map[string]string{
+		"OPENCODE_SERVER": os.Getenv("OPENCODE_SERVER"),
+		"OPENCODE_SOCKET": orch.socketPath,
+	}
+	if orch.snapshotWriter != nil {
+		env["OPENCODE_STATE_SNAPSHOT"] = orch.snapshotWriter.Path()
+	}
+	// Display settings from the config; the daemon's own environment wins
+	if orch.appConfig != nil {
+		display := orch.appConfig.Display
+		for key, value := range timefmt.Env(display.Timezone, display.TimeFormat, display.DateTimeFormat) {
+			if override := os.Getenv(key); override != "" {
+				value = override
+			}
+			env[key] = value
+		}
+	}
+	return env
+}
+
 func (orch *TmuxOrchestrator) startDefaultPanelApplications() error {
 	sessionTarget := orch.sessionName + ":0"
 
 	// Set environment variables for all panels
-	envVars := map[string]string{
-		"OPENCODE_SERVER": os.Getenv("OPENCODE_SERVER"),
-		"OPENCODE_SOCKET": orch.socketPath,
-	}
+	envVars := orch.panelEnv()
 
 	log.Printf("Starting panel applications with IPC socket: %s", orch.socketPath)
 
@@ -1266,7 +2354,7 @@ func (orch *TmuxOrchestrator) startDefaultPanelApplications() error {
 	for i, panel := range panels {
 		log.Printf("Starting %s (%d/3)...", panel.desc, i+1)
 
-		if err := orch.startPanelApp(panel.pane, panel.name, envVars); err != nil {
+		if err := orch.startPanelApp(panel.pane, panel.name, envVars, supervision.PanePolicy{}); err != nil {
 			log.Printf("Failed to start %s: %v", panel.desc, err)
 			// Don't fail completely - continue with other panels
 			continue
@@ -1287,10 +2375,7 @@ func (orch *TmuxOrchestrator) startDefaultPanelApplications() error {
 }
 
 func (orch *TmuxOrchestrator) startConfigPanelApplications() error {
-	envVars := map[string]string{
-		"OPENCODE_SERVER": os.Getenv("OPENCODE_SERVER"),
-		"OPENCODE_SOCKET": orch.socketPath,
-	}
+	envVars := orch.panelEnv()
 
 	log.Printf("Starting panel applications with IPC socket: %s", orch.socketPath)
 	time.Sleep(1 * time.Second)
@@ -1310,7 +2395,7 @@ func (orch *TmuxOrchestrator) startConfigPanelApplications() error {
 		}
 
 		log.Printf("Starting %s panel (%d/%d)...", panel.ID, idx+1, len(orch.layout.Panels))
-		if err := orch.startPanelApp(target, appName, envVars); err != nil {
+		if err := orch.startPanelApp(target, appName, envVars, panelPolicy(panel)); err != nil {
 			log.Printf("Failed to start %s panel: %v", panel.ID, err)
 			continue
 		}
@@ -1365,6 +2450,10 @@ func resolvePanelAppName(panelCfg tmuxconfig.Panel) (string, error) {
 		return "opencode-messages", nil
 	case "input":
 		return "opencode-input", nil
+	case "controller":
+		return "opencode-controller", nil
+	case "diff":
+		return "opencode-diff", nil
 	case "shell":
 		// For shell type, return the user's default shell or bash
 		shell := os.Getenv("SHELL")
@@ -1372,25 +2461,105 @@ func resolvePanelAppName(panelCfg tmuxconfig.Panel) (string, error) {
 			shell = "/bin/bash"
 		}
 		return shell, nil
+	case "logs":
+		return logsPanelCommand(), nil
 	}
 
 	return "", fmt.Errorf("unsupported panel type: %s", panelCfg.Type)
 }
 
-// startPanelApp starts an application in a specific tmux pane
-func (orch *TmuxOrchestrator) startPanelApp(paneTarget, appName string, envVars map[string]string) error {
+// logsPanelArgs runs the logs command so that it follows every panel's log
+const logsPanelArgs = " logs --follow"
+
+// logsPanelCommand returns the command of the logs panel, which tails every
+// panel's captured stderr
+func logsPanelCommand() string {
+	execPath, err := os.Executable()
+	if err != nil {
+		return "opencode-tmux" + logsPanelArgs
+	}
+	return shellEscape(execPath) + logsPanelArgs
+}
+
+// panelLogName names the log a panel app's stderr is captured to. It returns
+// "" for apps whose stderr belongs on the terminal: interactive shells, and
+// the logs panel itself.
+func panelLogName(appName string) string {
+	fields := strings.Fields(appName)
+	if len(fields) == 0 || strings.HasSuffix(appName, logsPanelArgs) {
+		return ""
+	}
+	base := filepath.Base(strings.Trim(fields[0], "'\""))
+	switch base {
+	case "sh", "bash", "zsh", "fish", "dash", "ksh", "tcsh", "csh":
+		return ""
+	}
+	return strings.TrimPrefix(base, "opencode-")
+}
+
+// panelLog returns the log a panel app's stderr is captured to, or nil when
+// it is not captured
+func (orch *TmuxOrchestrator) panelLog(appName string) *supervision.PanelLog {
+	name := panelLogName(appName)
+	if name == "" {
+		return nil
+	}
+	var maxSize int64
+	var backups int
+	if orch.appConfig != nil {
+		maxSize = orch.appConfig.Supervision.PanelLogMaxSize
+		backups = orch.appConfig.Supervision.PanelLogBackups
+	}
+	return supervision.NewPanelLog(paths.NewPathManager(orch.sessionName).PanelLogPath(name), maxSize, backups)
+}
+
+// startPanelApp starts an application in a specific tmux pane and supervises
+// it under policy
+func (orch *TmuxOrchestrator) startPanelApp(paneTarget, appName string, envVars map[string]string, policy supervision.PanePolicy) error {
 	normalizedTarget := orch.normalizePaneTarget(paneTarget)
-	if err := orch.launchPaneProcess(normalizedTarget, appName, envVars); err != nil {
+
+	// The pane outlives the processes the supervisor respawns in it, so it
+	// names the panel to the IPC server across respawns
+	envVars = maps.Clone(envVars)
+	envVars[ipc.PanelIdentityEnv] = normalizedTarget
+	if err := orch.launchPaneProcess(normalizedTarget, appName, envVars, policy); err != nil {
 		return err
 	}
 
-	orch.startPaneSupervisor(normalizedTarget, appName, envVars)
+	orch.startPaneSupervisor(normalizedTarget, appName, envVars, policy)
 	return nil
 }
 
-func (orch *TmuxOrchestrator) launchPaneProcess(paneTarget, appName string, envVars map[string]string) error {
-	paneTarget = orch.normalizePaneTarget(paneTarget)
-
+// panelPolicy returns how the supervisor looks after a layout panel
+func panelPolicy(panel tmuxconfig.Panel) supervision.PanePolicy {
+	restart, err := supervision.ParseRestartPolicy(panel.Restart)
+	if err != nil {
+		log.Printf("[WARN] Panel %s: %v; restarting always", panel.ID, err)
+		restart = supervision.RestartAlways
+	}
+	return supervision.PanePolicy{
+		Restart:        restart,
+		StartupTimeout: panel.StartupTimeout,
+		HealthCheck:    strings.TrimSpace(panel.HealthCheck),
+	}
+}
+
+// layoutPanelPolicy returns the supervision policy of the layout panel with
+// the given ID, the default for panels outside the layout
+func (orch *TmuxOrchestrator) layoutPanelPolicy(panelID string) supervision.PanePolicy {
+	if orch.layout != nil {
+		for _, panel := range orch.layout.Panels {
+			if panel.ID == panelID {
+				return panelPolicy(panel)
+			}
+		}
+	}
+	return supervision.PanePolicy{}
+}
+
+func (orch *TmuxOrchestrator) launchPaneProcess(paneTarget, appName string, envVars map[string]string, policy supervision.PanePolicy) error {
+	paneTarget = orch.normalizePaneTarget(paneTarget)
+
 	run := strings.TrimSpace(appName)
 	binaryPath, err := orch.getBinaryPath(appName)
 	if err == nil {
@@ -1402,9 +2571,27 @@ func (orch *TmuxOrchestrator) launchPaneProcess(paneTarget, appName string, envV
 		return fmt.Errorf("no command for panel %s", appName)
 	}
 
-	command := orch.buildPaneCommand(run, envVars)
+	stderrPath := ""
+	if panelLog := orch.panelLog(appName); panelLog != nil {
+		if err := panelLog.Mark(time.Now(), "starting %s", run); err != nil {
+			log.Printf("[WARN] Not capturing stderr of %s: %v", appName, err)
+		} else {
+			stderrPath = panelLog.Path
+		}
+	}
+
+	command := orch.buildPaneCommand(run, envVars, stderrPath)
 	log.Printf("[DEBUG] Respawning pane %s with command: %s", paneTarget, command)
 
+	if policy.KeepsExitedPane() {
+		// Keep the pane once its process exits, so its exit status decides
+		// whether it is restarted and its output stays readable
+		cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "set-option", "-p", "-t", paneTarget, "remain-on-exit", "on")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("[WARN] Failed to keep pane %s open on exit: %v: %s", paneTarget, err, strings.TrimSpace(string(output)))
+		}
+	}
+
 	cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "respawn-pane", "-k", "-t", paneTarget, command)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
@@ -1415,7 +2602,12 @@ func (orch *TmuxOrchestrator) launchPaneProcess(paneTarget, appName string, envV
 		return fmt.Errorf("failed to respawn pane %s: %w", paneTarget, err)
 	}
 
-	if !orch.waitForPaneProcess(paneTarget, 3*time.Second) {
+	if !orch.waitForPaneProcess(paneTarget, policy.Startup()) {
+		if policy.KeepsExitedPane() && orch.healthChecker.ExitStatus(paneTarget) >= 0 {
+			// Already done, as a one-shot script may be; the supervisor
+			// decides on its exit status
+			return nil
+		}
 		return fmt.Errorf("pane %s did not become active after launching %s", paneTarget, appName)
 	}
 
@@ -1693,6 +2885,12 @@ func (orch *TmuxOrchestrator) getPanelAppName(panelID, panelType string) (string
 		return "opencode-messages", nil
 	case "input", "opencode-input":
 		return "opencode-input", nil
+	case "controller", "opencode-controller":
+		return "opencode-controller", nil
+	case "diff", "opencode-diff":
+		return "opencode-diff", nil
+	case "logs":
+		return logsPanelCommand(), nil
 	}
 
 	switch panelID {
@@ -1702,12 +2900,16 @@ func (orch *TmuxOrchestrator) getPanelAppName(panelID, panelType string) (string
 		return "opencode-messages", nil
 	case "input":
 		return "opencode-input", nil
+	case "controller":
+		return "opencode-controller", nil
+	case "diff":
+		return "opencode-diff", nil
 	}
 
 	return "", fmt.Errorf("unknown app for panel %s (%s)", panelID, panelType)
 }
 
-func (orch *TmuxOrchestrator) startPaneSupervisor(paneTarget, appName string, envVars map[string]string) {
+func (orch *TmuxOrchestrator) startPaneSupervisor(paneTarget, appName string, envVars map[string]string, policy supervision.PanePolicy) {
 	// Copy env vars to avoid later mutation
 	envCopy := cloneStringMap(envVars)
 	orch.paneSupervisorMu.Lock()
@@ -1718,10 +2920,12 @@ func (orch *TmuxOrchestrator) startPaneSupervisor(paneTarget, appName string, en
 	orch.paneSupervisors[paneTarget] = cancel
 	orch.paneSupervisorMu.Unlock()
 
-	go orch.monitorPane(supervisorCtx, paneTarget, appName, envCopy)
+	go orch.monitorPane(supervisorCtx, paneTarget, appName, envCopy, policy)
 }
 
-func (orch *TmuxOrchestrator) monitorPane(ctx context.Context, paneTarget, appName string, envVars map[string]string) {
+// monitorPane checks a pane's health and restarts its process as its policy
+// allows. The supervisor stops once the policy leaves the pane alone.
+func (orch *TmuxOrchestrator) monitorPane(ctx context.Context, paneTarget, appName string, envVars map[string]string, policy supervision.PanePolicy) {
 	// Stage 6: Use configured health check interval and delays
 	checkInterval := 2 * time.Second
 	initialDelay := time.Second
@@ -1738,6 +2942,8 @@ func (orch *TmuxOrchestrator) monitorPane(ctx context.Context, paneTarget, appNa
 	ticker := time.NewTicker(checkInterval)
 	defer ticker.Stop()
 	retryDelay := initialDelay
+	panelLog := orch.panelLog(appName)
+	launchedAt := time.Now()
 
 	for {
 		select {
@@ -1745,14 +2951,51 @@ func (orch *TmuxOrchestrator) monitorPane(ctx context.Context, paneTarget, appNa
 			return
 		case <-ticker.C:
 			health := orch.healthChecker.CheckPaneHealth(paneTarget)
+			if panelLog != nil {
+				if _, err := panelLog.RotateIfNeeded(); err != nil {
+					log.Printf("[WARN] Failed to rotate log of %s: %v", appName, err)
+				}
+			}
+			if health == supervision.PaneHealthy && policy.HealthCheck != "" && time.Since(launchedAt) >= policy.Startup() {
+				if err := supervision.RunHealthCheck(ctx, policy.HealthCheck, envVars, checkInterval); err != nil {
+					log.Printf("[WARN] Pane %s for %s: %v", paneTarget, appName, err)
+					health = supervision.PaneFailing
+				}
+			}
 
 			if health == supervision.PaneHealthy {
 				retryDelay = initialDelay
 				continue
 			}
 
+			exitStatus := -1
+			if health == supervision.PaneDead {
+				exitStatus = orch.healthChecker.ExitStatus(paneTarget)
+			}
+			if !policy.ShouldRestart(health, exitStatus) {
+				log.Printf("[Monitor] Pane %s for %s is %s (exit status %d); leaving it (restart: %s)",
+					paneTarget, appName, strings.ToLower(health.String()), exitStatus, policy.Restart)
+				if panelLog != nil {
+					panelLog.Mark(time.Now(), "pane %s (%s, exit status %d); not restarting", strings.ToLower(health.String()), paneTarget, exitStatus)
+				}
+				if health != supervision.PaneFailing {
+					return
+				}
+				continue
+			}
+
 			log.Printf("[WARN] Pane %s for %s unhealthy (status: %s); attempting restart", paneTarget, appName, health)
-			if err := orch.launchPaneProcess(paneTarget, appName, envVars); err != nil {
+			if panelLog != nil {
+				panelLog.Mark(time.Now(), "pane %s (%s); restarting", strings.ToLower(health.String()), paneTarget)
+			}
+			if (health == supervision.PaneDead && exitStatus != 0) || health == supervision.PaneZombie {
+				orch.reportCrash(crashreport.Trigger{
+					Kind:    crashreport.KindPanelCrash,
+					Subject: panelCrashSubject(appName),
+					Detail:  fmt.Sprintf("pane %s is %s", paneTarget, strings.ToLower(health.String())),
+				})
+			}
+			if err := orch.launchPaneProcess(paneTarget, appName, envVars, policy); err != nil {
 				log.Printf("[ERROR] Failed to restart pane %s: %v", paneTarget, err)
 				time.Sleep(retryDelay)
 				retryDelay *= 2
@@ -1762,11 +3005,14 @@ func (orch *TmuxOrchestrator) monitorPane(ctx context.Context, paneTarget, appNa
 				continue
 			}
 			retryDelay = initialDelay
+			launchedAt = time.Now()
 		}
 	}
 }
 
-func (orch *TmuxOrchestrator) buildPaneCommand(run string, envVars map[string]string) string {
+// buildPaneCommand returns the shell command running run with envVars set,
+// appending its stderr to stderrPath unless that is empty
+func (orch *TmuxOrchestrator) buildPaneCommand(run string, envVars map[string]string, stderrPath string) string {
 	assignments := make([]string, 0, len(envVars))
 	keys := make([]string, 0, len(envVars))
 	for key := range envVars {
@@ -1781,7 +3027,11 @@ func (orch *TmuxOrchestrator) buildPaneCommand(run string, envVars map[string]st
 		assignments = append(assignments, fmt.Sprintf("%s=%s", key, shellEscape(value)))
 	}
 
-	inner := shellEscape("exec " + run)
+	script := "exec " + run
+	if stderrPath != "" {
+		script += " 2>>" + shellEscape(stderrPath)
+	}
+	inner := shellEscape(script)
 	if len(assignments) > 0 {
 		return fmt.Sprintf("env %s sh -lc %s", strings.Join(assignments, " "), inner)
 	}
@@ -1853,6 +3103,10 @@ func (orch *TmuxOrchestrator) getBinaryPath(appName string) (string, error) {
 			binaryName = filepath.Join(cmdDir, "opencode-messages", "dist", "messages-pane")
 		case "opencode-input":
 			binaryName = filepath.Join(cmdDir, "opencode-input", "dist", "input-pane")
+		case "opencode-controller":
+			binaryName = filepath.Join(cmdDir, "opencode-controller", "dist", "controller-pane")
+		case "opencode-diff":
+			binaryName = filepath.Join(cmdDir, "opencode-diff", "dist", "diff-pane")
 		default:
 			return "", fmt.Errorf("unknown app name: %s", appName)
 		}
@@ -1988,6 +3242,10 @@ func (orch *TmuxOrchestrator) ReloadLayout(configOverride string) error {
 	if err != nil {
 		return fmt.Errorf("failed to load layout config: %w", err)
 	}
+	if orch.profile.Layout != nil {
+		// The active profile's layout stands in for the file's
+		layoutCfg = orch.profile.Layout
+	}
 
 	if targetPath != orch.configPath {
 		log.Printf("Reload layout requested with new config path: %s (was %s)", targetPath, orch.configPath)
@@ -2068,6 +3326,7 @@ func (orch *TmuxOrchestrator) ReloadLayout(configOverride string) error {
 	orch.layout = layoutCfg
 	orch.panes = newPaneMap
 	orch.logPaneAssignments("reload_layout", orch.panes)
+	orch.bindProfileKeysLocked() // Panes were replaced
 
 	if err := orch.startMissingPanels(layoutCfg, newPaneMap, movedPanels); err != nil {
 		log.Printf("Warning: failed to start all new panels after layout reload: %v", err)
@@ -2104,145 +3363,993 @@ func (orch *TmuxOrchestrator) killTmuxSession() error {
 				return nil
 			}
 		}
-		log.Printf("[Shutdown] Failed to kill tmux session: %v", err)
-		return err
+		log.Printf("[Shutdown] Failed to kill tmux session: %v", err)
+		return err
+	}
+	log.Printf("[Shutdown] Successfully killed tmux session '%s'", orch.sessionName)
+	return nil
+}
+
+// swapPaneContents swaps the processes between two tmux panes.
+func (orch *TmuxOrchestrator) swapPaneContents(sourcePane, targetPane string) error {
+	if strings.TrimSpace(sourcePane) == "" || strings.TrimSpace(targetPane) == "" {
+		return fmt.Errorf("invalid pane ids for swap")
+	}
+	if sourcePane == targetPane {
+		return nil
+	}
+	cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "swap-pane", "-s", sourcePane, "-t", targetPane)
+	return cmd.Run()
+}
+
+// startMissingPanels launches applications for panels that did not inherit an existing process.
+func (orch *TmuxOrchestrator) startMissingPanels(layoutCfg *tmuxconfig.Layout, panes map[string]string, moved map[string]bool) error {
+	if layoutCfg == nil {
+		return nil
+	}
+
+	envVars := orch.panelEnv()
+
+	var errs []string
+	for _, panel := range layoutCfg.Panels {
+		if moved[panel.ID] {
+			continue
+		}
+		targetPane, ok := panes[panel.ID]
+		if !ok || strings.TrimSpace(targetPane) == "" {
+			continue
+		}
+
+		appName, err := resolvePanelAppName(panel)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", panel.ID, err))
+			continue
+		}
+
+		if err := orch.startPanelApp(targetPane, appName, envVars, panelPolicy(panel)); err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", panel.ID, err))
+			continue
+		}
+		log.Printf("Started panel %s after layout reload", panel.ID)
+	}
+
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Shutdown implements the interfaces.OrchestratorControl interface.
+// It triggers graceful shutdown of the orchestrator daemon.
+// If cleanup is true, the tmux session will also be destroyed.
+func (orch *TmuxOrchestrator) Shutdown(cleanup bool) error {
+	log.Printf("Shutdown requested via IPC (cleanup=%v)", cleanup)
+
+	// Store cleanup flag for use in Stop()
+	orch.cleanupOnExit = cleanup
+
+	// Trigger shutdown by canceling context
+	// This will cause waitForShutdown() to return
+	orch.cancel()
+
+	return nil
+}
+
+// GetStatus returns the current status of the session
+func (orch *TmuxOrchestrator) GetStatus() (*interfaces.SessionStatus, error) {
+	// Calculate uptime
+	uptime := time.Since(orch.startedAt)
+
+	// Get panel status
+	var panels []interfaces.PanelStatus
+	connections := orch.panelConnections()
+	orch.layoutMutex.Lock()
+	if orch.layout != nil {
+		for _, panel := range orch.layout.Panels {
+			paneID := orch.panes[panel.ID]
+			panelStatus := interfaces.PanelStatus{
+				Name:      panel.ID,
+				PaneID:    paneID,
+				IsRunning: paneID != "",
+			}
+			if conn, ok := connections[panel.ID]; ok {
+				panelStatus.Build = conn.Build
+				panelStatus.Compatibility = string(panelCompatibility(conn))
+			}
+			panels = append(panels, panelStatus)
+		}
+	}
+	orch.layoutMutex.Unlock()
+
+	// Get client count using clientTracker if available
+	clientCount := 0
+	if orch.clientTracker != nil {
+		count, _ := orch.clientTracker.GetConnectedClients()
+		clientCount = count
+	} else {
+		// Fallback: try to count clients via tmux
+		clients, err := orch.listTmuxClients()
+		if err == nil {
+			clientCount = len(clients)
+		}
+	}
+
+	status := &interfaces.SessionStatus{
+		SessionName: orch.sessionName,
+		DaemonPID:   os.Getpid(),
+		Build:       version.Build,
+		IsRunning:   orch.isRunning,
+		Uptime:      uptime,
+		StartedAt:   orch.startedAt,
+		ClientCount: clientCount,
+		Panels:      panels,
+		SocketPath:  orch.socketPath,
+		ConfigPath:  orch.configPath,
+		Owner:       orch.owner,
+		Profile:     orch.profileStatus(),
+	}
+	if orch.syncManager != nil {
+		history := orch.syncManager.GetEventBus().GetHistoryStats()
+		status.EventHistory = &history
+		storage := orch.storageCheck.CheckFunc()
+		status.Storage = &storage
+	}
+
+	return status, nil
+}
+
+// GetConnectedClients returns a list of connected tmux clients
+func (orch *TmuxOrchestrator) GetConnectedClients() ([]interfaces.ClientInfo, error) {
+	// Always use direct tmux query for now
+	// ClientTracker's GetConnectedClientsInfo has different format
+	return orch.listTmuxClients()
+}
+
+// Ping checks if the daemon is responsive
+func (orch *TmuxOrchestrator) Ping() error {
+	// Simple health check - if we can respond, we're alive
+	if !orch.isRunning {
+		return fmt.Errorf("orchestrator is not running")
+	}
+	return nil
+}
+
+// CollectGarbage removes orphaned temp files, surplus backups and unreferenced blobs
+func (orch *TmuxOrchestrator) CollectGarbage(dryRun bool) (interfaces.GCStats, error) {
+	if orch.syncManager == nil {
+		return interfaces.GCStats{}, fmt.Errorf("state management is not initialized")
+	}
+	return orch.syncManager.CollectGarbage(dryRun)
+}
+
+// GetSyncConfig returns the sync manager's live configuration
+func (orch *TmuxOrchestrator) GetSyncConfig() (map[string]interface{}, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	return orch.syncManager.GetConfig().Fields(), nil
+}
+
+// UpdateSyncConfig changes sync manager settings on the running daemon
+func (orch *TmuxOrchestrator) UpdateSyncConfig(changes map[string]interface{}) (map[string]interface{}, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	config, err := orch.syncManager.UpdateConfig(changes)
+	if err != nil {
+		return nil, err
+	}
+	return config.Fields(), nil
+}
+
+// DrainSaves waits until every queued state save has been written
+func (orch *TmuxOrchestrator) DrainSaves() error {
+	if orch.syncManager == nil {
+		return fmt.Errorf("state management is not initialized")
+	}
+	return orch.syncManager.SaveStateSync()
+}
+
+// errNoBackups is returned by backup commands when state is kept in memory
+var errNoBackups = fmt.Errorf("backups are unavailable: state is kept in memory only")
+
+// ForceBackup backs up the state file now and, when off-site backups are
+// configured, copies it to every destination
+func (orch *TmuxOrchestrator) ForceBackup() (*interfaces.BackupInfo, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	if orch.backupManager == nil {
+		return nil, errNoBackups
+	}
+	// Back up what panels see, not what the last autosave wrote
+	if err := orch.syncManager.SaveStateSync(); err != nil {
+		return nil, fmt.Errorf("failed to save state before backup: %w", err)
+	}
+	backup, err := orch.backupManager.CreateBackup()
+	if err != nil {
+		return nil, err
+	}
+	if orch.remoteBackup != nil {
+		if err := orch.remoteBackup.CopyOffsite(orch.ctx); err != nil {
+			return backup, fmt.Errorf("local backup %s written, off-site copy failed: %w", backup.Path, err)
+		}
+	}
+	return backup, nil
+}
+
+// RotateLogs moves the daemon log to its .1 file and starts a new one
+func (orch *TmuxOrchestrator) RotateLogs() (string, error) {
+	if daemonLog == nil {
+		return "", fmt.Errorf("daemon is not logging to a file")
+	}
+	rotated, err := daemonLog.Rotate()
+	if err != nil {
+		return "", err
+	}
+	log.Printf("Log rotated; previous log is %s", rotated)
+	return rotated, nil
+}
+
+// SetDebugLogging adds microsecond timestamps to log lines while debugging;
+// the IPC server adds its per-event logging itself
+func (orch *TmuxOrchestrator) SetDebugLogging(enabled bool) error {
+	if enabled {
+		log.SetFlags(log.Flags() | log.Lmicroseconds)
+		log.Printf("Debug logging enabled")
+	} else {
+		log.SetFlags(log.Flags() &^ log.Lmicroseconds)
+		log.Printf("Debug logging disabled")
+	}
+	return nil
+}
+
+// GetDiagnostics gathers status, subscribers, metrics, conflict statistics and
+// recent events for the controller panel
+func (orch *TmuxOrchestrator) GetDiagnostics(recentEvents int) (*interfaces.Diagnostics, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	status, err := orch.GetStatus()
+	if err != nil {
+		return nil, err
+	}
+
+	eventBus := orch.syncManager.GetEventBus()
+	diagnostics := &interfaces.Diagnostics{
+		Status:    status,
+		Healthy:   orch.syncManager.IsHealthy(),
+		Metrics:   orch.syncManager.GetMetrics(),
+		Conflicts: orch.syncManager.GetConflictStatistics(),
+	}
+	for _, subscriber := range eventBus.GetSubscribers() {
+		diagnostics.Subscribers = append(diagnostics.Subscribers, subscriber)
+	}
+	sort.Slice(diagnostics.Subscribers, func(i, j int) bool {
+		return diagnostics.Subscribers[i].ConnectedAt.Before(diagnostics.Subscribers[j].ConnectedAt)
+	})
+	for _, event := range eventBus.GetEventHistory(recentEvents) {
+		diagnostics.RecentEvents = append(diagnostics.RecentEvents, interfaces.EventSummary{
+			ID:          event.ID,
+			Type:        event.Type,
+			SourcePanel: event.SourcePanel,
+			Version:     event.Version,
+			Timestamp:   event.Timestamp,
+		})
+	}
+	if orch.backupManager != nil {
+		if latest, err := orch.backupManager.GetLatestBackup(); err == nil {
+			diagnostics.LatestBackup = latest
+		}
+	}
+	if orch.webhooks != nil {
+		diagnostics.Webhooks = orch.webhooks.Stats()
+	}
+	return diagnostics, nil
+}
+
+// GetDeliveryStats lists each subscriber's event delivery counts by panel ID
+func (orch *TmuxOrchestrator) GetDeliveryStats() ([]interfaces.SubscriberInfo, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	var subscribers []interfaces.SubscriberInfo
+	for _, subscriber := range orch.syncManager.GetEventBus().GetSubscribers() {
+		subscribers = append(subscribers, subscriber)
+	}
+	sort.Slice(subscribers, func(i, j int) bool {
+		if subscribers[i].PanelID != subscribers[j].PanelID {
+			return subscribers[i].PanelID < subscribers[j].PanelID
+		}
+		return subscribers[i].ConnectionID < subscribers[j].ConnectionID
+	})
+	return subscribers, nil
+}
+
+// ForceSync saves state and rebroadcasts it in full to every panel
+func (orch *TmuxOrchestrator) ForceSync() error {
+	if orch.syncManager == nil {
+		return fmt.Errorf("state management is not initialized")
+	}
+	return orch.syncManager.ForceFullSync()
+}
+
+// RestoreBackup loads a backup, the newest one that verifies when path is
+// empty, and makes it the live state
+func (orch *TmuxOrchestrator) RestoreBackup(path string) (*interfaces.BackupInfo, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	if orch.backupManager == nil {
+		return nil, errNoBackups
+	}
+
+	var backup interfaces.BackupInfo
+	if path == "" {
+		report := orch.backupManager.VerifyAll()
+		if report.NewestRestorable == nil {
+			return nil, fmt.Errorf("no restorable backup found")
+		}
+		backup = report.NewestRestorable.BackupInfo
+	} else {
+		backups, err := orch.backupManager.ListBackups()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list backups: %w", err)
+		}
+		found := false
+		for _, candidate := range backups {
+			if candidate.Path == path || filepath.Base(candidate.Path) == path {
+				backup, found = candidate, true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("backup %s not found", path)
+		}
+	}
+
+	restored, err := orch.backupManager.LoadBackup(backup.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backup %s: %w", backup.Path, err)
+	}
+	if err := orch.syncManager.RestoreState(restored); err != nil {
+		return nil, err
+	}
+	log.Printf("State restored from backup %s", backup.Path)
+	return &backup, nil
+}
+
+// RespawnPanel restarts a panel's process in its pane and resets its supervisor
+func (orch *TmuxOrchestrator) RespawnPanel(name string) error {
+	name = strings.TrimSpace(name)
+	orch.layoutMutex.Lock()
+	target, ok := orch.panes[name]
+	orch.layoutMutex.Unlock()
+	if !ok || target == "" {
+		return fmt.Errorf("no pane for panel %s", name)
+	}
+
+	appName, err := orch.getPanelAppName(name, name)
+	if err != nil {
+		return err
+	}
+	log.Printf("Respawning panel %s (%s) in pane %s", name, appName, target)
+	return orch.startPanelApp(target, appName, orch.panelEnv(), orch.layoutPanelPolicy(name))
+}
+
+// StartMacroRecording begins recording user updates into the named macro
+func (orch *TmuxOrchestrator) StartMacroRecording(name string) error {
+	if orch.syncManager == nil || orch.macroRecorder == nil {
+		return fmt.Errorf("macros are not available")
+	}
+	if err := orch.macroRecorder.Start(name, orch.syncManager.GetState().CurrentSessionID); err != nil {
+		return err
+	}
+	log.Printf("Recording macro %s", name)
+	return nil
+}
+
+// StopMacroRecording ends the recording and saves the macro
+func (orch *TmuxOrchestrator) StopMacroRecording() (*macro.Info, error) {
+	if orch.macroRecorder == nil {
+		return nil, fmt.Errorf("macros are not available")
+	}
+	recorded, err := orch.macroRecorder.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if err := orch.macroStore.Save(recorded); err != nil {
+		return nil, err
+	}
+	info := recorded.Info()
+	log.Printf("Saved macro %s (%d steps)", info.Name, info.Steps)
+	return &info, nil
+}
+
+// ReplayMacro loads a macro and replays it in the background; prompts are
+// submitted to the opencode server one after another, each waiting for its reply
+func (orch *TmuxOrchestrator) ReplayMacro(name string, opts macro.ReplayOptions) (*macro.Info, error) {
+	if orch.syncManager == nil || orch.macroStore == nil {
+		return nil, fmt.Errorf("macros are not available")
+	}
+	recorded, err := orch.macroStore.Load(name)
+	if err != nil {
+		return nil, err
+	}
+	if !orch.macroReplaying.CompareAndSwap(false, true) {
+		return nil, fmt.Errorf("another macro is replaying")
+	}
+
+	info := recorded.Info()
+	go func() {
+		defer orch.macroReplaying.Store(false)
+		log.Printf("Replaying macro %s (%d steps, session %q)", name, info.Steps, opts.SessionID)
+		applied, err := macro.Replay(orch.ctx, recorded, opts, orch.applyMacroStep)
+		if err != nil {
+			log.Printf("Macro %s stopped after %d of %d steps: %v", name, applied, info.Steps, err)
+			return
+		}
+		log.Printf("Macro %s replayed", name)
+	}()
+	return &info, nil
+}
+
+// applyMacroStep applies one replayed step; prompts are sent to the opencode
+// server first, since shared state only records them
+func (orch *TmuxOrchestrator) applyMacroStep(updateType types.UpdateType, payload map[string]interface{}) error {
+	if updateType == types.PromptSubmitted {
+		var prompt types.PromptSubmitPayload
+		data, err := json.Marshal(payload)
+		if err == nil {
+			err = json.Unmarshal(data, &prompt)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid prompt: %w", err)
+		}
+		if err := orch.submitPrompt(orch.ctx, prompt.SessionID, prompt.Text); err != nil {
+			return err
+		}
+	}
+	return orch.syncManager.ApplyMacroStep(updateType, payload)
+}
+
+// submitPrompt sends text to a session on the opencode server as a user
+// prompt; a leading mention routes it to another agent
+func (orch *TmuxOrchestrator) submitPrompt(ctx context.Context, sessionID, text string) error {
+	if orch.httpClient == nil {
+		return fmt.Errorf("no opencode server to submit prompts to")
+	}
+
+	// The prompt is tracked as a run so it can be cancelled over IPC
+	run := types.NewAgentRun(sessionID, "orchestrator")
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	orch.runCancelsMu.Lock()
+	if orch.runCancels == nil {
+		orch.runCancels = make(map[string]context.CancelFunc)
+	}
+	orch.runCancels[run.CancelToken] = cancel
+	orch.runCancelsMu.Unlock()
+	defer func() {
+		orch.runCancelsMu.Lock()
+		delete(orch.runCancels, run.CancelToken)
+		orch.runCancelsMu.Unlock()
+	}()
+	if err := orch.recordRunUpdate(types.RunStarted, types.RunStartedPayload{Run: run}); err != nil {
+		log.Printf("[RUNS] Failed to record run %s: %v", run.ID, err)
+	}
+
+	current := orch.syncManager.GetState()
+	primary := types.ModelRef{ProviderID: current.Provider, ModelID: current.Model}
+	agent, text := agentroute.Route(text, current.GetAgentRoutes())
+	if agent != "" {
+		log.Printf("[RUNS] Routing prompt in session %s to agent %s", sessionID, agent)
+	}
+	var response *opencode.SessionPromptResponse
+	err := modelpolicy.Run(ctx, current.GetModelPolicy(), primary, func(ctx context.Context, model types.ModelRef) error {
+		params := opencode.SessionPromptParams{
+			Parts: opencode.F([]opencode.SessionPromptParamsPartUnion{
+				opencode.TextPartInputParam{
+					Text: opencode.F(text),
+					Type: opencode.F(opencode.TextPartInputTypeText),
+				},
+			}),
+		}
+		if agent != "" {
+			params.Agent = opencode.F(agent)
+		}
+		if !model.IsZero() {
+			params.Model = opencode.F(opencode.SessionPromptParamsModel{
+				ProviderID: opencode.F(model.ProviderID),
+				ModelID:    opencode.F(model.ModelID),
+			})
+		}
+		if session, ok := current.GetSessionByID(sessionID); ok && session.Instructions != "" {
+			params.System = opencode.F(session.Instructions)
+		}
+		var err error
+		if response, err = orch.httpClient.Session.Prompt(ctx, sessionID, params); err != nil {
+			return err
+		}
+		return modelpolicy.ResponseError(response)
+	}, func(attempt types.RunAttempt) {
+		if err := orch.recordRunUpdate(types.RunAttempted, types.RunAttemptedPayload{RunID: run.ID, Attempt: attempt}); err != nil {
+			log.Printf("[RUNS] Failed to record attempt %d of run %s: %v", attempt.Number, run.ID, err)
+		}
+	})
+
+	finished := types.RunFinishedPayload{RunID: run.ID, FinishedAt: time.Now()}
+	if err != nil {
+		finished.Error = err.Error()
+	}
+	if response != nil {
+		finished.MessageID = response.Info.ID
+	}
+	// A cancelled run is already recorded as such and rejects the result
+	if recordErr := orch.recordRunUpdate(types.RunFinished, finished); recordErr != nil {
+		log.Printf("[RUNS] Did not record end of run %s: %v", run.ID, recordErr)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to submit prompt: %w", err)
+	}
+	return nil
+}
+
+// recordRunUpdate applies a run lifecycle update to shared state
+func (orch *TmuxOrchestrator) recordRunUpdate(updateType types.UpdateType, payload interface{}) error {
+	return orch.syncManager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              ids.New("run_update"),
+		Type:            updateType,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         payload,
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	})
+}
+
+// CancelRun records a cancel request; handleRunCancelled does the rest once
+// it has been resolved to a run or session
+func (orch *TmuxOrchestrator) CancelRun(runID, messageID string) error {
+	runID, messageID = strings.TrimSpace(runID), strings.TrimSpace(messageID)
+	if runID == "" && messageID == "" {
+		return fmt.Errorf("run id or message id required")
+	}
+	return orch.recordRunUpdate(types.CancelRun, types.CancelRunPayload{RunID: runID, MessageID: messageID, Reason: "cancelled"})
+}
+
+// handleRunCancelled propagates a cancellation, whichever panel asked for it:
+// the orchestrator drops its own request for the run and aborts the session
+// on the opencode server so generation stops. opencode answers one prompt per
+// session at a time, so the abort only affects the cancelled run.
+func (orch *TmuxOrchestrator) handleRunCancelled(event types.StateEvent) {
+	cancelled, ok := event.Data.(types.RunCancelledPayload)
+	if !ok {
+		log.Printf("[RUNS] Unexpected run cancelled payload %T", event.Data)
+		return
+	}
+
+	if cancelled.CancelToken != "" {
+		orch.runCancelsMu.Lock()
+		if cancel, ok := orch.runCancels[cancelled.CancelToken]; ok {
+			cancel()
+		}
+		orch.runCancelsMu.Unlock()
+	}
+
+	if orch.httpClient != nil {
+		ctx, cancel := context.WithTimeout(orch.ctx, 10*time.Second)
+		defer cancel()
+		if _, err := orch.httpClient.Session.Abort(ctx, cancelled.SessionID, opencode.SessionAbortParams{}); err != nil {
+			log.Printf("[RUNS] Failed to abort session %s: %v", cancelled.SessionID, err)
+			return
+		}
+	}
+	log.Printf("[RUNS] Cancelled run %q in session %s (%d replies)", cancelled.RunID, cancelled.SessionID, len(cancelled.MessageIDs))
+}
+
+// CompactSession asks the assistant to summarize a session, the current one
+// when sessionID is empty. The summary runs in the background and replaces
+// the messages it covers once the server has written it; the originals are
+// archived in state. Failures are noted in the session's transcript.
+func (orch *TmuxOrchestrator) CompactSession(sessionID string) error {
+	if orch.httpClient == nil {
+		return fmt.Errorf("opencode server is not connected")
+	}
+	current := orch.syncManager.GetState()
+	sessionID = strings.TrimSpace(sessionID)
+	if sessionID == "" {
+		sessionID = current.GetCurrentSessionID()
+	}
+	if sessionID == "" {
+		return fmt.Errorf("no session selected")
+	}
+	if len(current.GetActiveRuns(sessionID)) > 0 {
+		return fmt.Errorf("session %s has a reply in progress", sessionID)
+	}
+	model := types.ModelRef{ProviderID: current.Provider, ModelID: current.Model}
+	if model.IsZero() {
+		return fmt.Errorf("no model selected to summarize with")
+	}
+
+	var older []string
+	for _, msg := range current.Messages {
+		if msg.SessionID == sessionID {
+			older = append(older, msg.ID)
+		}
+	}
+	if len(older) == 0 {
+		return fmt.Errorf("session %s has no messages to compact", sessionID)
+	}
+
+	orch.compactMu.Lock()
+	defer orch.compactMu.Unlock()
+	if orch.compacting[sessionID] {
+		return fmt.Errorf("session %s is already being compacted", sessionID)
+	}
+	orch.compacting[sessionID] = true
+	go orch.compactSession(sessionID, model, older)
+	return nil
+}
+
+// compactSession has the server summarize a session and records the summary
+// in place of the messages that were there when compaction started
+func (orch *TmuxOrchestrator) compactSession(sessionID string, model types.ModelRef, older []string) {
+	defer func() {
+		orch.compactMu.Lock()
+		delete(orch.compacting, sessionID)
+		orch.compactMu.Unlock()
+	}()
+	log.Printf("[COMPACT] Summarizing %d messages of session %s with %s", len(older), sessionID, model)
+
+	err := orch.summarizeSession(sessionID, model, older)
+	if err == nil {
+		return
+	}
+	log.Printf("[COMPACT] Failed to compact session %s: %v", sessionID, err)
+	note := types.MessageInfo{
+		ID:        ids.New("compact_failed"),
+		SessionID: sessionID,
+		Type:      "system",
+		Content:   fmt.Sprintf("Compaction failed: %v", err),
+		Timestamp: time.Now(),
+		Status:    "error",
+	}
+	if addErr := orch.syncManager.AddMessage(note, "orchestrator"); addErr != nil {
+		log.Printf("[COMPACT] Failed to note the failure: %v", addErr)
+	}
+}
+
+func (orch *TmuxOrchestrator) summarizeSession(sessionID string, model types.ModelRef, older []string) error {
+	ctx, cancel := context.WithTimeout(orch.ctx, 5*time.Minute)
+	defer cancel()
+	if _, err := orch.httpClient.Session.Summarize(ctx, sessionID, opencode.SessionSummarizeParams{
+		ProviderID: opencode.F(model.ProviderID),
+		ModelID:    opencode.F(model.ModelID),
+	}); err != nil {
+		return fmt.Errorf("summarize: %w", err)
+	}
+	messages, err := orch.httpClient.Session.Messages(ctx, sessionID, opencode.SessionMessagesParams{})
+	if err != nil {
+		return fmt.Errorf("load summary: %w", err)
+	}
+
+	// The server writes the summary as a new assistant reply
+	seen := make(map[string]bool, len(older))
+	for _, id := range older {
+		seen[id] = true
+	}
+	var summary *types.MessageInfo
+	for i := len(*messages) - 1; i >= 0 && summary == nil; i-- {
+		m := (*messages)[i]
+		info, ok := m.Info.AsUnion().(opencode.AssistantMessage)
+		if !ok || !info.Summary || seen[info.ID] {
+			continue
+		}
+		var text []string
+		for _, part := range m.Parts {
+			if textPart, ok := part.AsUnion().(opencode.TextPart); ok {
+				text = append(text, textPart.Text)
+			}
+		}
+		summary = &types.MessageInfo{
+			ID:        info.ID,
+			SessionID: sessionID,
+			Type:      "assistant",
+			Content:   strings.Join(text, "\n"),
+			Timestamp: time.Now(),
+			Status:    "completed",
+		}
 	}
-	log.Printf("[Shutdown] Successfully killed tmux session '%s'", orch.sessionName)
+	if summary == nil {
+		return fmt.Errorf("the server wrote no summary")
+	}
+
+	current := orch.syncManager.GetState()
+	orch.contextMu.Lock()
+	measured := orch.contextMeasured[sessionID]
+	orch.contextMu.Unlock()
+	before, _ := contextgauge.Estimate(current.Messages, sessionID, measured)
+	after, _ := contextgauge.Estimate([]types.MessageInfo{*summary}, sessionID, contextgauge.Measured{})
+
+	update := types.StateUpdate{
+		ID:              ids.New("session_compacted"),
+		Type:            types.SessionCompacted,
+		ExpectedVersion: current.GetCurrentVersion(),
+		Payload: types.SessionCompactedPayload{
+			Compaction: types.SessionCompaction{
+				SessionID:    sessionID,
+				ArchivedIDs:  older,
+				TokensBefore: before,
+				TokensAfter:  after,
+			},
+			Summary: *summary,
+		},
+		SourcePanel: "orchestrator",
+		Timestamp:   time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		return fmt.Errorf("record summary: %w", err)
+	}
+
+	// The last measured reply is archived; the gauge estimates from the summary on
+	orch.contextMu.Lock()
+	delete(orch.contextMeasured, sessionID)
+	orch.contextMu.Unlock()
+	orch.requestContextRefresh()
+	log.Printf("[COMPACT] Session %s compacted from about %d to %d tokens", sessionID, before, after)
 	return nil
 }
 
-// swapPaneContents swaps the processes between two tmux panes.
-func (orch *TmuxOrchestrator) swapPaneContents(sourcePane, targetPane string) error {
-	if strings.TrimSpace(sourcePane) == "" || strings.TrimSpace(targetPane) == "" {
-		return fmt.Errorf("invalid pane ids for swap")
+// ListMacros summarizes the saved macros
+func (orch *TmuxOrchestrator) ListMacros() ([]macro.Info, error) {
+	if orch.macroStore == nil {
+		return nil, fmt.Errorf("macros are not available")
 	}
-	if sourcePane == targetPane {
-		return nil
+	return orch.macroStore.List()
+}
+
+// DeleteMacro removes a saved macro
+func (orch *TmuxOrchestrator) DeleteMacro(name string) error {
+	if orch.macroStore == nil {
+		return fmt.Errorf("macros are not available")
 	}
-	cmd := exec.CommandContext(orch.ctx, orch.tmuxCommand, "swap-pane", "-s", sourcePane, "-t", targetPane)
-	return cmd.Run()
+	return orch.macroStore.Delete(name)
 }
 
-// startMissingPanels launches applications for panels that did not inherit an existing process.
-func (orch *TmuxOrchestrator) startMissingPanels(layoutCfg *tmuxconfig.Layout, panes map[string]string, moved map[string]bool) error {
-	if layoutCfg == nil {
-		return nil
+// ListDirectory lists one directory inside the file tree roots
+func (orch *TmuxOrchestrator) ListDirectory(path string) (*filetree.Listing, error) {
+	if orch.fileTree == nil {
+		return nil, fmt.Errorf("file tree is not available")
 	}
+	return orch.fileTree.List(orch.ctx, path)
+}
 
-	envVars := map[string]string{
-		"OPENCODE_SERVER": os.Getenv("OPENCODE_SERVER"),
-		"OPENCODE_SOCKET": orch.socketPath,
+// EditInput opens text in the user's editor over the input pane. Once the
+// editor exits, the text saved replaces the input buffer.
+func (orch *TmuxOrchestrator) EditInput(text string) error {
+	if orch.editor == nil || orch.syncManager == nil {
+		return fmt.Errorf("editing is unavailable")
+	}
+	if orch.serverOnly {
+		return fmt.Errorf("editing needs the tmux layout")
+	}
+	if !orch.editing.CompareAndSwap(false, true) {
+		return fmt.Errorf("the input is already open in the editor")
 	}
 
-	var errs []string
-	for _, panel := range layoutCfg.Panels {
-		if moved[panel.ID] {
-			continue
+	spec := editor.Spec{
+		ID:     ids.New("edit"),
+		Text:   text,
+		Target: orch.getPaneTarget("input", "input"),
+	}
+	if orch.appConfig != nil {
+		spec.Editor = orch.appConfig.Editor.Command
+		spec.Popup = orch.appConfig.Editor.Popup
+		spec.Size = orch.appConfig.Editor.Size
+	}
+	if workDir, err := os.Getwd(); err == nil {
+		spec.Dir = workDir
+	}
+
+	go func() {
+		defer orch.editing.Store(false)
+		edited, saved, err := orch.editor.Edit(orch.ctx, spec)
+		if err != nil {
+			log.Printf("[EDITOR] Edit %s failed: %v", spec.ID, err)
+			return
 		}
-		targetPane, ok := panes[panel.ID]
-		if !ok || strings.TrimSpace(targetPane) == "" {
-			continue
+		if !saved {
+			log.Printf("[EDITOR] Edit %s left the input unchanged", spec.ID)
+			return
+		}
+		// The mode is left alone, so enter sends the edited prompt whole
+		if err := orch.syncManager.UpdateInputBuffer(edited, len(edited), 0, 0, "", "editor"); err != nil {
+			log.Printf("[EDITOR] Failed to update the input from edit %s: %v", spec.ID, err)
 		}
+	}()
+	return nil
+}
 
-		appName, err := resolvePanelAppName(panel)
+// RunTerminalCommand starts a shell command in a pane below the messages pane.
+// Its output is streamed into a system message of the current session and its
+// exit status recorded when it ends. One command runs at a time; the pane of
+// the previous run is closed when the next one starts.
+func (orch *TmuxOrchestrator) RunTerminalCommand(command, dir string) (*types.TerminalRun, error) {
+	if orch.terminal == nil || orch.syncManager == nil {
+		return nil, fmt.Errorf("terminal runs are disabled")
+	}
+	if orch.serverOnly {
+		return nil, fmt.Errorf("terminal runs need the tmux layout")
+	}
+	if strings.TrimSpace(command) == "" {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+	sessionID := orch.syncManager.GetState().CurrentSessionID
+	if sessionID == "" {
+		return nil, fmt.Errorf("no current session to record the run in")
+	}
+	if dir != "" {
+		absDir, err := filepath.Abs(dir)
 		if err != nil {
-			errs = append(errs, fmt.Sprintf("%s: %v", panel.ID, err))
-			continue
+			return nil, fmt.Errorf("resolve run directory: %w", err)
 		}
+		dir = absDir
+	}
 
-		if err := orch.startPanelApp(targetPane, appName, envVars); err != nil {
-			errs = append(errs, fmt.Sprintf("%s: %v", panel.ID, err))
-			continue
+	orch.terminalMu.Lock()
+	defer orch.terminalMu.Unlock()
+	if orch.terminalActive {
+		return nil, fmt.Errorf("a terminal run is still in progress")
+	}
+	if orch.terminalRun != nil {
+		if err := orch.terminalRun.Kill(); err != nil {
+			log.Printf("[TERMINAL] Failed to close pane of run %s: %v", orch.terminalRun.ID, err)
 		}
-		log.Printf("Started panel %s after layout reload", panel.ID)
+		orch.terminalRun = nil
 	}
 
-	if len(errs) > 0 {
-		return errors.New(strings.Join(errs, "; "))
+	messagesPane := orch.getPaneTarget("messages", "messages")
+	if messagesPane == "" {
+		return nil, fmt.Errorf("no messages pane to split")
 	}
-	return nil
+	id := ids.New("run")
+	handle, err := orch.terminal.Start(orch.ctx, termrun.Spec{
+		ID:      id,
+		Command: command,
+		Dir:     dir,
+		Target:  messagesPane,
+		Size:    orch.appConfig.Terminal.PaneSize,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	run := types.TerminalRun{
+		ID:        id,
+		SessionID: sessionID,
+		MessageID: "msg_" + id,
+		Command:   command,
+		Dir:       dir,
+		PaneID:    handle.PaneID,
+		Status:    types.TerminalRunRunning,
+		StartedAt: time.Now(),
+	}
+	update := types.StateUpdate{
+		ID:              fmt.Sprintf("terminal_run_started_%s", id),
+		Type:            types.TerminalRunStarted,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         types.TerminalRunStartedPayload{Run: run},
+		SourcePanel:     "terminal",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		handle.Kill()
+		return nil, fmt.Errorf("failed to record terminal run: %w", err)
+	}
+	message := types.MessageInfo{
+		ID:        run.MessageID,
+		SessionID: sessionID,
+		Type:      "system",
+		Content:   terminalTranscript(run, "", orch.appConfig.Terminal.MaxOutputBytes),
+		Timestamp: run.StartedAt,
+		Status:    "pending",
+	}
+	if err := orch.syncManager.AddMessage(message, "terminal"); err != nil {
+		log.Printf("[TERMINAL] Failed to add transcript message for run %s: %v", id, err)
+	}
+
+	orch.terminalRun = handle
+	orch.terminalActive = true
+	log.Printf("[TERMINAL] Started run %s in pane %s: %s", id, handle.PaneID, command)
+	go orch.followTerminalRun(handle, run)
+	return &run, nil
 }
 
-// Shutdown implements the interfaces.OrchestratorControl interface.
-// It triggers graceful shutdown of the orchestrator daemon.
-// If cleanup is true, the tmux session will also be destroyed.
-func (orch *TmuxOrchestrator) Shutdown(cleanup bool) error {
-	log.Printf("Shutdown requested via IPC (cleanup=%v)", cleanup)
+// followTerminalRun streams a run's output into its message until the command
+// exits, then records how it ended
+func (orch *TmuxOrchestrator) followTerminalRun(handle *termrun.Run, run types.TerminalRun) {
+	limit := orch.appConfig.Terminal.MaxOutputBytes
+	var output string
+	code, err := handle.Wait(orch.ctx, termrun.DefaultPollInterval, func(chunk string) {
+		// Raw output holds escape sequences, so keep some slack over the limit
+		output += chunk
+		if len(output) > 2*limit {
+			output = output[len(output)-2*limit:]
+		}
+		if err := orch.syncManager.UpdateMessage(run.MessageID, terminalTranscript(run, output, limit), "pending", "terminal"); err != nil {
+			log.Printf("[TERMINAL] Failed to stream output of run %s: %v", run.ID, err)
+		}
+	})
 
-	// Store cleanup flag for use in Stop()
-	orch.cleanupOnExit = cleanup
+	finished := types.TerminalRunFinishedPayload{RunID: run.ID, ExitCode: code, FinishedAt: time.Now()}
+	status := "completed"
+	if err != nil {
+		finished.Error = err.Error()
+		status = "error"
+	} else if code != 0 {
+		status = "error"
+	}
+	run.ExitCode, run.Error, run.FinishedAt = finished.ExitCode, finished.Error, finished.FinishedAt
+	if err := orch.syncManager.UpdateMessage(run.MessageID, terminalTranscript(run, output, limit), status, "terminal"); err != nil {
+		log.Printf("[TERMINAL] Failed to record output of run %s: %v", run.ID, err)
+	}
 
-	// Trigger shutdown by canceling context
-	// This will cause waitForShutdown() to return
-	orch.cancel()
+	update := types.StateUpdate{
+		ID:              fmt.Sprintf("terminal_run_finished_%s", run.ID),
+		Type:            types.TerminalRunFinished,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         finished,
+		SourcePanel:     "terminal",
+		Timestamp:       time.Now(),
+	}
+	if err := orch.syncManager.UpdateWithVersionCheck(update); err != nil {
+		log.Printf("[TERMINAL] Failed to record end of run %s: %v", run.ID, err)
+	}
+	log.Printf("[TERMINAL] Run %s ended: exit=%d err=%v", run.ID, code, err)
 
-	return nil
+	orch.terminalMu.Lock()
+	orch.terminalActive = false
+	orch.terminalMu.Unlock()
 }
 
-// GetStatus returns the current status of the session
-func (orch *TmuxOrchestrator) GetStatus() (*interfaces.SessionStatus, error) {
-	// Calculate uptime
-	uptime := time.Since(orch.startedAt)
-
-	// Get panel status
-	var panels []interfaces.PanelStatus
-	orch.layoutMutex.Lock()
-	if orch.layout != nil {
-		for _, panel := range orch.layout.Panels {
-			paneID := orch.panes[panel.ID]
-			panelStatus := interfaces.PanelStatus{
-				Name:      panel.ID,
-				PaneID:    paneID,
-				IsRunning: paneID != "",
-			}
-			panels = append(panels, panelStatus)
-		}
-	}
-	orch.layoutMutex.Unlock()
-
-	// Get client count using clientTracker if available
-	clientCount := 0
-	if orch.clientTracker != nil {
-		count, _ := orch.clientTracker.GetConnectedClients()
-		clientCount = count
-	} else {
-		// Fallback: try to count clients via tmux
-		clients, err := orch.listTmuxClients()
-		if err == nil {
-			clientCount = len(clients)
+// terminalTranscript renders a run as message content: the command, the last
+// limit bytes of its output and, once it has ended, how it ended
+func terminalTranscript(run types.TerminalRun, output string, limit int) string {
+	text := strings.TrimRight(termrun.Clean(output), "\n")
+	if len(text) > limit {
+		text = text[len(text)-limit:]
+		if cut := strings.IndexByte(text, '\n'); cut >= 0 {
+			text = text[cut+1:]
 		}
+		text = "[earlier output dropped]\n" + text
 	}
 
-	status := &interfaces.SessionStatus{
-		SessionName: orch.sessionName,
-		DaemonPID:   os.Getpid(),
-		IsRunning:   orch.isRunning,
-		Uptime:      uptime,
-		StartedAt:   orch.startedAt,
-		ClientCount: clientCount,
-		Panels:      panels,
-		SocketPath:  orch.socketPath,
-		ConfigPath:  orch.configPath,
-		Owner:       orch.owner,
+	var b strings.Builder
+	fmt.Fprintf(&b, "$ %s\n```\n%s\n```", run.Command, text)
+	switch {
+	case run.Error != "":
+		fmt.Fprintf(&b, "\n[run failed: %s]", run.Error)
+	case !run.FinishedAt.IsZero():
+		fmt.Fprintf(&b, "\n[exit %d]", run.ExitCode)
 	}
-
-	return status, nil
+	return b.String()
 }
 
-// GetConnectedClients returns a list of connected tmux clients
-func (orch *TmuxOrchestrator) GetConnectedClients() ([]interfaces.ClientInfo, error) {
-	// Always use direct tmux query for now
-	// ClientTracker's GetConnectedClientsInfo has different format
-	return orch.listTmuxClients()
+// QueryAudit returns audit log entries for applied state updates
+func (orch *TmuxOrchestrator) QueryAudit(filter audit.Filter) ([]audit.Entry, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
+	}
+	return orch.syncManager.QueryAudit(filter)
 }
 
-// Ping checks if the daemon is responsive
-func (orch *TmuxOrchestrator) Ping() error {
-	// Simple health check - if we can respond, we're alive
-	if !orch.isRunning {
-		return fmt.Errorf("orchestrator is not running")
+// QueryAnalytics summarizes assistant usage per day from the state journal
+func (orch *TmuxOrchestrator) QueryAnalytics(query analytics.Query) (*analytics.Report, error) {
+	if orch.syncManager == nil {
+		return nil, fmt.Errorf("state management is not initialized")
 	}
-	return nil
+	return orch.syncManager.QueryAnalytics(query)
 }
 
 // listTmuxClients queries tmux for connected clients
@@ -2305,7 +4412,7 @@ func sendReloadLayoutCommand(socketPath, sessionName, configPath string) error {
 		return fmt.Errorf("failed to access socket %s: %w", socketPath, err)
 	}
 
-	panelID := fmt.Sprintf("controller-%s-%d", sessionName, time.Now().UnixNano())
+	panelID := ids.New("controller-" + sessionName)
 	client := ipc.NewSocketClient(socketPath, panelID, "controller")
 	if err := client.Connect(); err != nil {
 		return fmt.Errorf("failed to connect to orchestrator socket: %w", err)
@@ -2326,15 +4433,13 @@ func sendReloadLayoutCommand(socketPath, sessionName, configPath string) error {
 
 // attachExistingSession attaches to an already-running tmux session without modifying orchestrator state.
 func (orch *TmuxOrchestrator) attachExistingSession() error {
-	target := orch.sessionName
-	if strings.TrimSpace(orch.tmuxTargetSession) != "" {
-		target = orch.tmuxTargetSession
+	window := orch.mergedWindowID
+	if window == "" && strings.TrimSpace(orch.tmuxTargetSession) != "" {
+		if hosted, ok := session.FindHostedWindow(orch.tmuxCommand, orch.sessionName); ok {
+			window = hosted.WindowID
+		}
 	}
-	cmd := exec.Command(orch.tmuxCommand, "attach-session", "-t", target)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	return cmd.Run()
+	return orch.attachTmux(window)
 }
 
 // attachToSession attaches to the tmux session
@@ -2342,16 +4447,31 @@ func (orch *TmuxOrchestrator) attachToSession() error {
 	if !orch.isRunning {
 		return fmt.Errorf("session is not running")
 	}
+	return orch.attachTmux(orch.mergedWindowID)
+}
 
+// attachTmux attaches the terminal to the tmux session holding the panels,
+// showing window when they are a window of another session. From inside
+// tmux, where attaching would nest, the client is switched over instead.
+func (orch *TmuxOrchestrator) attachTmux(window string) error {
 	target := orch.sessionName
 	if strings.TrimSpace(orch.tmuxTargetSession) != "" {
 		target = orch.tmuxTargetSession
 	}
-	cmd := exec.Command(orch.tmuxCommand, "attach-session", "-t", target)
+	if window != "" {
+		if err := exec.Command(orch.tmuxCommand, "select-window", "-t", window).Run(); err != nil {
+			log.Printf("Warning: failed to select window %s: %v", window, err)
+		}
+	}
+
+	args := []string{"attach-session", "-t", target}
+	if os.Getenv("TMUX") != "" {
+		args = []string{"switch-client", "-t", target}
+	}
+	cmd := exec.Command(orch.tmuxCommand, args...)
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-
 	return cmd.Run()
 }
 
@@ -2369,7 +4489,7 @@ func (orch *TmuxOrchestrator) attachToSession() error {
 // 1. Detect OPENCODE_DAEMON_DETACHED=1 and skip detachment
 // 2. Continue normal daemon startup (acquire lock, start IPC server, etc.)
 // 3. Run as a true background daemon with PPID=1
-func detachAsDaemon() error {
+func detachAsDaemon(sessionName string) error {
 	// Get current executable path
 	executable, err := os.Executable()
 	if err != nil {
@@ -2379,8 +4499,8 @@ func detachAsDaemon() error {
 	// Prepare command with same arguments
 	cmd := exec.Command(executable, os.Args[1:]...)
 
-	// Add environment variable to mark child as detached
-	cmd.Env = append(os.Environ(), "OPENCODE_DAEMON_DETACHED=1")
+	// Mark the child as detached and hand it the resolved session name
+	cmd.Env = append(os.Environ(), "OPENCODE_DAEMON_DETACHED=1", resolvedSessionEnv+"="+sessionName)
 
 	// Configure process attributes for detachment
 	cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -2394,16 +4514,7 @@ func detachAsDaemon() error {
 	}
 	cmd.Stdin = devNull
 
-	// Redirect stdout/stderr to log file for daemon process
-	// Extract session name from arguments to create session-specific log
-	sessionName := "opencode" // default
-	for i, arg := range os.Args {
-		if i > 0 && !strings.HasPrefix(arg, "-") && arg != "start" {
-			sessionName = arg
-			break
-		}
-	}
-
+	// Redirect stdout/stderr to the session's log file for daemon process
 	pathMgr := paths.NewPathManager(sessionName)
 	if err := pathMgr.EnsureDirectories(); err != nil {
 		return fmt.Errorf("failed to create log directory: %w", err)
@@ -2573,6 +4684,49 @@ func (orch *TmuxOrchestrator) performHealthCheck() {
 		log.Printf("Warning: Sync manager is not healthy")
 	}
 
+	// Verify the backup chain now and then; it reads every backup
+	if check := &orch.backupCheck; check.Enabled && time.Since(check.LastCheck) >= check.Interval {
+		wasHealthy := check.LastCheck.IsZero() || check.LastResult.Healthy
+		check.LastResult = check.CheckFunc()
+		check.LastCheck = check.LastResult.Timestamp
+		if !check.LastResult.Healthy {
+			log.Printf("Warning: state backups are not healthy: %s", check.LastResult.Message)
+			if wasHealthy {
+				go orch.reportCrash(crashreport.Trigger{
+					Kind:    crashreport.KindStateCorruption,
+					Subject: "backups",
+					Detail:  check.LastResult.Message,
+				})
+			}
+		}
+	}
+
+	// Saves pause while the disk is full; keep warning until they resume
+	if check := &orch.storageCheck; check.Enabled && time.Since(check.LastCheck) >= check.Interval {
+		check.LastResult = check.CheckFunc()
+		check.LastCheck = check.LastResult.Timestamp
+		if !check.LastResult.Healthy {
+			log.Printf("Warning: state storage is not healthy: %s", check.LastResult.Message)
+		}
+	}
+
+	// Panels that keep dropping events are resynced; warn while it continues
+	if check := &orch.deliveryCheck; check.Enabled && time.Since(check.LastCheck) >= check.Interval {
+		check.LastResult = check.CheckFunc()
+		check.LastCheck = check.LastResult.Timestamp
+		if !check.LastResult.Healthy {
+			log.Printf("Warning: event delivery is not healthy: %s", check.LastResult.Message)
+		}
+	}
+
+	// Replays fall back to full state reloads once events are lost
+	if orch.syncManager != nil {
+		if history := orch.syncManager.GetEventBus().GetHistoryStats(); history.OverflowErrors > orch.lastOverflowErrors {
+			log.Printf("Warning: %d events could not be spilled to %s", history.OverflowErrors-orch.lastOverflowErrors, history.OverflowPath)
+			orch.lastOverflowErrors = history.OverflowErrors
+		}
+	}
+
 	// Check IPC server health
 	if orch.ipcServer != nil && !orch.ipcServer.IsRunning() {
 		log.Printf("Warning: IPC server is not running")
@@ -2662,6 +4816,14 @@ func (orch *TmuxOrchestrator) printStatus() {
 			metrics.TotalUpdates, metrics.GetSuccessRate())
 		fmt.Printf("  State Saves: %d (%.1f%% success)\n",
 			metrics.TotalSaves, metrics.GetSaveSuccessRate())
+
+		history := orch.syncManager.GetEventBus().GetHistoryStats()
+		fmt.Printf("  Event History: %d/%d in memory, %d on disk (%d bytes), oldest version %d, %d evicted\n",
+			history.InMemory, history.Capacity, history.OverflowEvents, history.OverflowBytes,
+			history.OldestVersion, history.Evicted)
+
+		storage := orch.storageCheck.CheckFunc()
+		fmt.Printf("  Storage: %s\n", storage.Message)
 	}
 }
 
@@ -2733,7 +4895,8 @@ func runLegacyMode() {
 	// name will remain as started, which is acceptable.
 
 	logPath := filepath.Join(logDir, fmt.Sprintf("tmux-%s.log", sanitizeLogComponent(sessionName)))
-	if logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644); err == nil {
+	if logFile, err := openReopenableLog(logPath); err == nil {
+		daemonLog = logFile
 		log.SetOutput(logFile)
 		log.SetFlags(log.LstdFlags | log.Lshortfile)
 		defer logFile.Close()
@@ -2752,6 +4915,10 @@ func runLegacyMode() {
 	flag.BoolVar(&forceNewSessionFlag, "force-new-session", false, "Force creation of a new tmux session, replacing any existing session")
 	flag.BoolVar(&attachOnlyFlag, "attach-only", false, "Attach to an existing tmux session and exit without reconfiguring panels")
 	flag.BoolVar(&reloadLayoutFlag, "reload-layout", false, "Reload the tmux layout without restarting panel processes")
+	var ephemeralFlag bool
+	flag.BoolVar(&ephemeralFlag, "ephemeral", false, "Keep state in memory only; nothing is loaded from or saved to disk")
+	var profileFlag string
+	flag.StringVar(&profileFlag, "profile", "", "Config profile to apply (default $"+tmuxconfig.ProfileEnv+")")
 
 	// Stage 3: Signal handling mode flags
 	var daemonFlag bool
@@ -2760,7 +4927,7 @@ func runLegacyMode() {
 	flag.BoolVar(&daemonFlag, "daemon", false, "Run in daemon mode (Ctrl+C ignored, use IPC to shutdown)")
 	flag.BoolVar(&foregroundFlag, "foreground", false, "Run in foreground mode (Ctrl+C triggers shutdown) [default]")
 	// Accept merge flag in legacy mode as a no-op flag parsed here; actual use happens later.
-	flag.StringVar(&mergeIntoFlag, "merge-into", "", "Merge into an existing tmux session (create a new window there)")
+	flag.StringVar(&mergeIntoFlag, "merge-into", "", "Merge into an existing tmux session (create a new window there); \"auto\" for the current one")
 
 	flag.Parse()
 
@@ -2807,6 +4974,57 @@ func runLegacyMode() {
 		sessionOverride = true
 	}
 
+	configPath := os.Getenv("OPENCODE_TMUX_CONFIG")
+	if configPath == "" {
+		configPath = filepath.Join(logFileHomeDir, ".opencode", "tmux.yaml")
+	}
+
+	// First run: write a starter config before anything reads it. The
+	// detached daemon child has no terminal, so this happens in its parent.
+	if commands.NeedsSetup(configPath) && isTerminal() && !attachOnlyFlag && !reloadLayoutFlag {
+		err := commands.RunSetup(commands.SetupOptions{
+			ConfigPath:  configPath,
+			ServerURL:   os.Getenv("OPENCODE_SERVER"),
+			SessionName: sessionName,
+			In:          os.Stdin,
+			Out:         os.Stdout,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Setup failed: %v\n", err)
+			log.Fatalf("First-run setup failed: %v", err)
+		}
+	}
+
+	sessionCfg, err := tmuxconfig.LoadSession(configPath)
+	if err != nil {
+		log.Fatalf("Failed to load tmux session config: %v", err)
+	}
+
+	// A configured session name is resolved for this project before anything
+	// uses it; the detached daemon child takes the name its parent resolved
+	if resolved := os.Getenv(resolvedSessionEnv); resolved != "" && os.Getenv("OPENCODE_DAEMON_DETACHED") == "1" {
+		sessionName = resolved
+	} else if !sessionOverride {
+		policy, _ := session.ParseCollisionPolicy(sessionCfg.Session.OnCollision)
+		if reloadLayoutFlag || attachOnlyFlag || serverOnly || forceNewSessionFlag || strings.TrimSpace(mergeIntoFlag) != "" {
+			policy = session.CollisionSuffix
+		}
+		name, attach, err := commands.ResolveSessionName(commands.SessionNameOptions{
+			Template:    sessionCfg.Session.Name,
+			OnCollision: policy,
+			Interactive: isTerminal(),
+			In:          os.Stdin,
+			Out:         os.Stdout,
+		})
+		if err != nil {
+			log.Fatalf("Failed to resolve session name: %v", err)
+		}
+		sessionName = name
+		if attach {
+			attachOnlyFlag = true
+		}
+	}
+
 	// Stage 3.5: Daemon Detachment with Pre-Lock Check
 	// If daemon mode is enabled and not already detached, check lock and re-execute as detached process
 	if runMode == ModeDaemon && os.Getenv("OPENCODE_DAEMON_DETACHED") == "" {
@@ -2829,7 +5047,7 @@ func runLegacyMode() {
 
 		// Lock check passed, proceed with detachment
 		log.Printf("[Daemon] Detaching from terminal...")
-		if err := detachAsDaemon(); err != nil {
+		if err := detachAsDaemon(sessionName); err != nil {
 			log.Fatalf("[Daemon] Failed to detach: %v", err)
 		}
 		// Parent process exits here - shell returns to user
@@ -2845,8 +5063,9 @@ func runLegacyMode() {
 	if runMode == ModeDaemon && os.Getenv("OPENCODE_DAEMON_DETACHED") == "1" {
 		pathMgr := paths.NewPathManager(sessionName)
 		logPath := pathMgr.LogPath()
-		logFile, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		logFile, err := openReopenableLog(logPath)
 		if err == nil {
+			daemonLog = logFile
 			log.SetOutput(logFile)
 			log.Printf("=== Daemon process started (PID: %d) ===", os.Getpid())
 		} else {
@@ -2860,19 +5079,16 @@ func runLegacyMode() {
 		log.Fatal("OPENCODE_SERVER environment variable not set")
 	}
 
-	homeDir, err := os.UserHomeDir()
+	profiles, err := tmuxconfig.LoadProfiles(configPath)
 	if err != nil {
-		log.Fatal("Failed to get home directory:", err)
+		log.Fatalf("Failed to load config profiles: %v", err)
 	}
-
-	configPath := os.Getenv("OPENCODE_TMUX_CONFIG")
-	if configPath == "" {
-		configPath = filepath.Join(homeDir, ".opencode", "tmux.yaml")
-	}
-
-	sessionCfg, err := tmuxconfig.LoadSession(configPath)
+	profileName, profile, err := tmuxconfig.SelectProfile(profiles, profileFlag)
 	if err != nil {
-		log.Fatalf("Failed to load tmux session config: %v", err)
+		log.Fatalf("Failed to select config profile: %v", err)
+	}
+	if profileName != "" {
+		log.Printf("Using config profile: %s", profileName)
 	}
 
 	// === Per-Session Architecture: Use session name from command line ===
@@ -2900,10 +5116,18 @@ func runLegacyMode() {
 		log.Printf("Warning: failed to cleanup stale files: %v", err)
 	}
 
+	appCfg := loadAppConfig(configPath)
+	if ephemeralFlag {
+		appCfg.Storage.Backend = appconfig.StorageBackendMemory
+	}
+
 	// Determine socket path early (needed for reload-layout command)
 	if envSocketPath != "" {
 		socketPath = envSocketPath
 		log.Printf("Socket path (from env): %s", socketPath)
+	} else if appCfg.IPC.SocketPath != "" {
+		socketPath = appCfg.IPC.ResolveSocketPath(sessionName)
+		log.Printf("Socket path (from config): %s", socketPath)
 	} else {
 		socketPath = pathMgr.SocketPath()
 		log.Printf("Socket path (per-session): %s", socketPath)
@@ -2912,12 +5136,6 @@ func runLegacyMode() {
 	// Handle reload-layout command BEFORE acquiring lock
 	// (orchestrator is already running, so we send IPC message and exit)
 	if reloadLayoutFlag {
-		if !sessionOverride {
-			name := strings.TrimSpace(sessionCfg.Session.Name)
-			if name != "" {
-				sessionName = name
-			}
-		}
 		if err := sendReloadLayoutCommand(socketPath, sessionName, configPath); err != nil {
 			fmt.Fprintf(os.Stderr, "Reload layout failed: %v\n", err)
 			os.Exit(1)
@@ -2945,6 +5163,9 @@ func runLegacyMode() {
 	if envStatePath != "" {
 		statePath = envStatePath
 		log.Printf("State path (from env): %s", statePath)
+	} else if profileStatePath := profile.StatePath(sessionName); profileStatePath != "" {
+		statePath = profileStatePath
+		log.Printf("State path (from profile %s): %s", profileName, statePath)
 	} else {
 		statePath = pathMgr.StatePath()
 		log.Printf("State path (per-session): %s", statePath)
@@ -2954,12 +5175,8 @@ func runLegacyMode() {
 	if err != nil {
 		log.Fatalf("Failed to load tmux layout config: %v", err)
 	}
-
-	if !sessionOverride {
-		name := strings.TrimSpace(sessionCfg.Session.Name)
-		if name != "" {
-			sessionName = name
-		}
+	if profile.Layout != nil {
+		layoutCfg = profile.Layout
 	}
 
 	// Create HTTP client (only if not in server-only mode)
@@ -2976,10 +5193,29 @@ func runLegacyMode() {
 		log.Fatal("Failed to set theme:", err)
 	}
 
-	// Create orchestrator
+	// Create orchestrator; without --merge-into the config may name a host session
 	mergeInto := strings.TrimSpace(mergeIntoFlag)
+	if mergeInto == "" {
+		mergeInto = sessionCfg.Session.Host
+	}
+	if requested := strings.TrimSpace(mergeInto); requested != "" {
+		mergeInto = session.ResolveHost(requested)
+		if mergeInto == sessionName {
+			// Started from inside its own tmux session
+			mergeInto = ""
+		}
+		switch {
+		case mergeInto == "" && requested == session.HostAuto:
+			log.Printf("Not started from inside tmux; giving session %s a tmux session of its own", sessionName)
+		case requested == session.HostAuto:
+			log.Printf("Adding session %s as a window of the current tmux session %s", sessionName, mergeInto)
+		}
+	}
 	orchestrator := NewTmuxOrchestrator(sessionName, socketPath, statePath, serverURL, httpClient, serverOnly, layoutCfg, reuseSessionFlag, forceNewSessionFlag, attachOnlyFlag, configPath, runMode, mergeInto)
 	orchestrator.lock = lock
+	orchestrator.appConfig = appCfg
+	orchestrator.setProfile(profileName, profile, profiles)
+	orchestrator.sessionDefaults = sessionCfg.Session
 
 	if err := orchestrator.prepareExistingSession(); err != nil {
 		log.Fatal(err)
@@ -3005,6 +5241,8 @@ func runLegacyMode() {
 	if err := orchestrator.Start(); err != nil {
 		log.Fatal("Failed to start tmux session:", err)
 	}
+	orchestrator.applyProfile()
+	orchestrator.applySessionDefaults()
 
 	// Start health monitoring
 	go orchestrator.monitorHealth()
@@ -3167,7 +5405,7 @@ func main() {
 	// Check if subcommand is used
 	if len(os.Args) >= 2 {
 		subcommand := os.Args[1]
-		knownCommands := []string{"start", "attach", "detach", "stop", "status", "list", "help", "version"}
+		knownCommands := []string{"start", "attach", "detach", "stop", "status", "list", "audit", "analytics", "history", "gc", "sync-config", "admin", "macro", "schedule", "run", "mcp", "replica", "backup", "conformance", "logs", "profile", "setup", "upgrade", "watchdog", "rebuild-state", "share", "transfer", "help", "version"}
 
 		// Check if first argument is a known subcommand
 		if contains(knownCommands, subcommand) {
@@ -3190,8 +5428,30 @@ func contains(slice []string, item string) bool {
 	return false
 }
 
+// configureDisplayTime shows times in subcommand output as the config file's
+// display settings ask, with the environment's taking precedence
+func configureDisplayTime() {
+	configPath := os.Getenv("OPENCODE_TMUX_CONFIG")
+	if configPath == "" {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			configPath = filepath.Join(homeDir, ".opencode", "tmux.yaml")
+		}
+	}
+	if cfg, err := appconfig.LoadConfig(configPath); err == nil {
+		display := cfg.Display
+		if err := timefmt.Configure(display.Timezone, display.TimeFormat, display.DateTimeFormat); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: display settings in %s: %v\n", configPath, err)
+		}
+	}
+	if err := timefmt.ConfigureFromEnv(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: display settings in environment: %v\n", err)
+	}
+}
+
 // executeSubcommand dispatches to the appropriate subcommand handler
 func executeSubcommand(subcommand string, args []string) {
+	configureDisplayTime()
+
 	// Import commands package functions
 	var err error
 
@@ -3215,6 +5475,56 @@ func executeSubcommand(subcommand string, args []string) {
 	case "list":
 		err = commands.CmdList(args)
 
+	case "audit":
+		err = commands.CmdAudit(args)
+	case "analytics":
+		err = commands.CmdAnalytics(args)
+	case "history":
+		err = commands.CmdHistory(args)
+	case "gc":
+		err = commands.CmdGC(args)
+	case "sync-config":
+		err = commands.CmdSyncConfig(args)
+	case "admin":
+		err = commands.CmdAdmin(args)
+	case "macro":
+		err = commands.CmdMacro(args)
+	case "schedule":
+		err = commands.CmdSchedule(args)
+	case "run":
+		err = commands.CmdRun(args)
+	case "mcp":
+		err = commands.CmdMCP(args)
+	case "replica":
+		err = commands.CmdReplica(args)
+	case "backup":
+		err = commands.CmdBackup(args)
+	case "conformance":
+		err = commands.CmdConformance(args)
+	case "logs":
+		err = commands.CmdLogs(args)
+
+	case "profile":
+		err = commands.CmdProfile(args)
+
+	case "setup":
+		err = commands.CmdSetup(args)
+
+	case "upgrade":
+		err = commands.CmdUpgrade(args)
+
+	case "watchdog":
+		err = commands.CmdWatchdog(args)
+
+	case "rebuild-state":
+		err = commands.CmdRebuildState(args)
+
+	case "share":
+		err = commands.CmdShare(args)
+
+	case "transfer":
+		err = commands.CmdTransfer(args)
+
 	case "help":
 		printHelp()
 
@@ -3303,6 +5613,27 @@ func printHelp() {
 	fmt.Println("  stop       Stop orchestrator daemon")
 	fmt.Println("  status     View session status")
 	fmt.Println("  list       List all running sessions")
+	fmt.Println("  audit      Show which panel applied which state updates")
+	fmt.Println("  analytics  Show messages, tokens, tool runs and active time per day")
+	fmt.Println("  history    Show the state as it was at a past version")
+	fmt.Println("  gc         Remove orphaned temp files, old backups and unreferenced blobs")
+	fmt.Println("  sync-config Show or change state sync settings of a running session")
+	fmt.Println("  admin      Drain saves, force a backup, rotate logs and other privileged commands")
+	fmt.Println("  macro      Record prompts and UI actions into a macro and replay it")
+	fmt.Println("  schedule   Submit a stored prompt at a set time or interval")
+	fmt.Println("  run        Run a shell command in a pane and record its output in the transcript")
+	fmt.Println("  mcp        Serve session state to other AI tools over MCP (stdio)")
+	fmt.Println("  replica    Serve a read-only copy of session state to heavy readers")
+	fmt.Println("  backup     Verify state backups and copy or restore them off-site")
+	fmt.Println("  conformance Check that a custom panel speaks the IPC protocol")
+	fmt.Println("  logs       Show or follow what panel processes wrote to stderr")
+	fmt.Println("  profile    List config profiles or switch a running session to another")
+	fmt.Println("  setup      Write a starter config (runs on its own the first time you start)")
+	fmt.Println("  upgrade    Restart panels still running a build older than the installed one")
+	fmt.Println("  watchdog   Restart the orchestrator daemon when it crashes or hangs")
+	fmt.Println("  rebuild-state Rebuild the state file by replaying the state journal")
+	fmt.Println("  share      Render a conversation as a self-contained HTML page")
+	fmt.Println("  transfer   Move a conversation to or from the opencode TUI")
 	fmt.Println("  help       Show this help message")
 	fmt.Println("  version    Show version information")
 	fmt.Println()
@@ -3323,8 +5654,8 @@ func printHelp() {
 // printVersion shows version information
 func printVersion() {
 	fmt.Println("OpenCode Tmux Orchestrator")
-	fmt.Println("Version: 2.0.0-stage4")
-	fmt.Println("Build: Stage 4 - CLI Subcommands")
+	fmt.Println("Version: " + version.Build)
+	fmt.Println("IPC protocol: " + version.Protocol)
 }
 
 // startSSEClient starts the Server-Sent Events client for real-time updates
@@ -3384,6 +5715,10 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 		uni := evt.AsUnion()
 		if v, ok := uni.(opencode.EventListResponseEventMessageUpdated); ok {
 			info := v.Properties.Info
+			// A summary's input is the conversation it replaces, not what follows it
+			if tokens, ok := info.Tokens.(opencode.AssistantMessageTokens); ok && tokens.Input > 0 && !info.Summary {
+				orch.recordContextMeasured(info.SessionID, info.ID, contextgauge.ReplyTokens(tokens))
+			}
 
 			// Create or refresh local message metadata; content will be built by parts
 			msg := types.MessageInfo{
@@ -3400,17 +5735,29 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 					return "pending"
 				}(),
 			}
+			// Replies name the agent that answered in their mode
+			if info.Role == opencode.MessageRoleAssistant {
+				msg.Agent = info.Mode
+			}
 			// Avoid duplicate additions if multiple message.updated events arrive for same ID
 			exists := false
 			currentStatus := ""
+			currentAgent := ""
 			st := orch.syncManager.GetState()
 			for _, m := range st.Messages {
 				if m.ID == msg.ID {
 					exists = true
 					currentStatus = m.Status
+					currentAgent = m.Agent
 					break
 				}
 			}
+			// Parts may have created the message before its metadata arrived
+			if exists && msg.Agent != "" && msg.Agent != currentAgent {
+				if err := orch.syncManager.AttributeMessage(msg.ID, msg.Agent, "sse"); err != nil {
+					log.Printf("[SSE] Failed to attribute message %s to agent %s: %v", msg.ID, msg.Agent, err)
+				}
+			}
 			if exists {
 				// Only update status if the message is not already completed
 				// This prevents message.updated events from overwriting the "completed" status
@@ -3428,6 +5775,8 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 				} else {
 					log.Printf("[SSE] Message metadata exists but already completed; skipping status update: %s", msg.ID)
 				}
+			} else if st.IsMessageArchived(msg.ID) {
+				log.Printf("[SSE] Message %s was archived by a compaction; not adding it back", msg.ID)
 			} else {
 				// Track message role for later use when parts arrive
 				orch.messageRolesMu.Lock()
@@ -3458,6 +5807,13 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 				log.Printf("[SSE] part.skipped id=%s type=%s len=%d (reasoning/thinking)", part.MessageID, part.Type, len(part.Text))
 				return
 			}
+			// Tool calls that edit files carry no text; show their diff instead
+			if orch.workspace != nil {
+				if diff, ok := filediff.FromPart(part); ok {
+					go orch.publishFileDiff(diff)
+					return
+				}
+			}
 			// Mark message as completed when step-finish part arrives
 			if part.Type == opencode.PartTypeStepFinish {
 				if err := orch.syncManager.UpdateMessage(part.MessageID, "", "completed", "sse"); err != nil {
@@ -3546,7 +5902,7 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 		if v, ok := uni.(opencode.EventListResponseEventMessageRemoved); ok {
 			// Construct a deletion update with optimistic version check
 			upd := types.StateUpdate{
-				ID:              fmt.Sprintf("del_%s_%d", v.Properties.MessageID, time.Now().UnixNano()),
+				ID:              ids.New("del_" + v.Properties.MessageID),
 				Type:            types.MessageDeleted,
 				ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 				Payload:         types.MessageDeletePayload{MessageID: v.Properties.MessageID},
@@ -3575,7 +5931,7 @@ func (orch *TmuxOrchestrator) handleTypedEvent(evt opencode.EventListResponse) {
 		if v, ok := uni.(opencode.EventListResponseEventSessionDeleted); ok {
 			// Construct a session deletion update
 			upd := types.StateUpdate{
-				ID:              fmt.Sprintf("del_session_%s_%d", v.Properties.Info.ID, time.Now().UnixNano()),
+				ID:              ids.New("del_session_" + v.Properties.Info.ID),
 				Type:            types.SessionDeleted,
 				ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 				Payload:         types.SessionDeletePayload{SessionID: v.Properties.Info.ID},
@@ -3718,7 +6074,7 @@ func (orch *TmuxOrchestrator) handleSSEEvent(data string) {
 
 		// Construct a state update for deletion and apply via manager
 		update := types.StateUpdate{
-			ID:              time.Now().Format("20060102150405.000000"),
+			ID:              ids.New("sse_message_deleted"),
 			Type:            types.MessageDeleted,
 			ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 			Payload:         types.MessageDeletePayload{MessageID: props.MessageID},
@@ -3872,8 +6228,9 @@ func (orch *TmuxOrchestrator) loadSessionsFromServer() error {
 		if err != nil {
 			log.Printf("Warning: Failed to load messages for session %s: %v", currentSessionID, err)
 		} else if msgs != nil && len(*msgs) > 0 {
+			loaded := orch.syncManager.GetState()
 			for _, m := range *msgs {
-				var messageType string
+				var messageType, agent string
 				var contentParts []string
 
 				switch info := m.Info.AsUnion().(type) {
@@ -3881,7 +6238,7 @@ func (orch *TmuxOrchestrator) loadSessionsFromServer() error {
 					messageType = "user"
 				case opencode.AssistantMessage:
 					messageType = "assistant"
-					_ = info // suppress unused in switch
+					agent = info.Mode
 				default:
 					messageType = "system"
 				}
@@ -3892,6 +6249,11 @@ func (orch *TmuxOrchestrator) loadSessionsFromServer() error {
 					}
 				}
 
+				// Messages replaced by a summary stay in the archive
+				if loaded.IsMessageArchived(m.Info.ID) {
+					continue
+				}
+
 				mi := types.MessageInfo{
 					ID:        m.Info.ID,
 					SessionID: currentSessionID,
@@ -3899,6 +6261,7 @@ func (orch *TmuxOrchestrator) loadSessionsFromServer() error {
 					Content:   strings.Join(contentParts, "\n"),
 					Timestamp: time.Now(),
 					Status:    "completed",
+					Agent:     agent,
 				}
 
 				if err := orch.syncManager.AddMessage(mi, "server-sync"); err != nil {
@@ -4068,11 +6431,11 @@ func (orch *TmuxOrchestrator) handleOpenModelsRequest(body json.RawMessage) inte
 
 	// Create a state update to trigger model dialog opening in all connected panels
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("open_models_%d", time.Now().UnixNano()),
+		ID:              ids.New("open_models"),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 		Payload: types.UIActionPayload{
-			Action: "open_models",
+			Action: types.UIActionOpenModelPicker,
 		},
 		SourcePanel: "tmux-orchestrator",
 		Timestamp:   time.Now(),
@@ -4083,7 +6446,7 @@ func (orch *TmuxOrchestrator) handleOpenModelsRequest(body json.RawMessage) inte
 		log.Printf("Failed to trigger open models action: %v", err)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "failed to trigger model dialog",
+			"error":   fmt.Sprintf("failed to trigger model dialog: %v", err),
 		}
 	}
 
@@ -4097,11 +6460,11 @@ func (orch *TmuxOrchestrator) handleOpenAgentsRequest(body json.RawMessage) inte
 
 	// Create a state update to trigger agent dialog opening
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("open_agents_%d", time.Now().UnixNano()),
+		ID:              ids.New("open_agents"),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 		Payload: types.UIActionPayload{
-			Action: "open_agents",
+			Action: types.UIActionOpenAgentPicker,
 		},
 		SourcePanel: "tmux-orchestrator",
 		Timestamp:   time.Now(),
@@ -4111,7 +6474,7 @@ func (orch *TmuxOrchestrator) handleOpenAgentsRequest(body json.RawMessage) inte
 		log.Printf("Failed to trigger open agents action: %v", err)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "failed to trigger agent dialog",
+			"error":   fmt.Sprintf("failed to trigger agent dialog: %v", err),
 		}
 	}
 
@@ -4124,11 +6487,11 @@ func (orch *TmuxOrchestrator) handleOpenSessionsRequest(body json.RawMessage) in
 
 	// Create a state update to trigger session dialog opening
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("open_sessions_%d", time.Now().UnixNano()),
+		ID:              ids.New("open_sessions"),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 		Payload: types.UIActionPayload{
-			Action: "open_sessions",
+			Action: types.UIActionOpenSessionPicker,
 		},
 		SourcePanel: "tmux-orchestrator",
 		Timestamp:   time.Now(),
@@ -4138,7 +6501,7 @@ func (orch *TmuxOrchestrator) handleOpenSessionsRequest(body json.RawMessage) in
 		log.Printf("Failed to trigger open sessions action: %v", err)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "failed to trigger session dialog",
+			"error":   fmt.Sprintf("failed to trigger session dialog: %v", err),
 		}
 	}
 
@@ -4151,11 +6514,11 @@ func (orch *TmuxOrchestrator) handleOpenThemesRequest(body json.RawMessage) inte
 
 	// Create a state update to trigger theme dialog opening
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("open_themes_%d", time.Now().UnixNano()),
+		ID:              ids.New("open_themes"),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 		Payload: types.UIActionPayload{
-			Action: "open_themes",
+			Action: types.UIActionOpenThemePicker,
 		},
 		SourcePanel: "tmux-orchestrator",
 		Timestamp:   time.Now(),
@@ -4165,7 +6528,7 @@ func (orch *TmuxOrchestrator) handleOpenThemesRequest(body json.RawMessage) inte
 		log.Printf("Failed to trigger open themes action: %v", err)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "failed to trigger theme dialog",
+			"error":   fmt.Sprintf("failed to trigger theme dialog: %v", err),
 		}
 	}
 
@@ -4178,11 +6541,11 @@ func (orch *TmuxOrchestrator) handleOpenHelpRequest(body json.RawMessage) interf
 
 	// Create a state update to trigger help dialog opening
 	update := types.StateUpdate{
-		ID:              fmt.Sprintf("open_help_%d", time.Now().UnixNano()),
+		ID:              ids.New("open_help"),
 		Type:            types.UIActionTriggered,
 		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
 		Payload: types.UIActionPayload{
-			Action: "open_help",
+			Action: types.UIActionOpenHelp,
 		},
 		SourcePanel: "tmux-orchestrator",
 		Timestamp:   time.Now(),
@@ -4192,7 +6555,7 @@ func (orch *TmuxOrchestrator) handleOpenHelpRequest(body json.RawMessage) interf
 		log.Printf("Failed to trigger open help action: %v", err)
 		return map[string]interface{}{
 			"success": false,
-			"error":   "failed to trigger help dialog",
+			"error":   fmt.Sprintf("failed to trigger help dialog: %v", err),
 		}
 	}
 
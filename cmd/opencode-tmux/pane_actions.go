@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// handlePaneAction carries out a layout UI action. Panels ask for these
+// through UIActionTriggered updates instead of running tmux themselves, as
+// only the orchestrator knows which pane each panel runs in.
+func (orch *TmuxOrchestrator) handlePaneAction(payload types.UIActionPayload) error {
+	if orch.serverOnly {
+		return fmt.Errorf("no tmux panes in server-only mode")
+	}
+	switch payload.Action {
+	case types.UIActionZoomPane:
+		var args types.ZoomPaneArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		target := orch.getPaneTarget(args.Panel, args.Panel)
+		if target == "" {
+			return fmt.Errorf("no pane for panel %s", args.Panel)
+		}
+		return orch.tmux("resize-pane", "-Z", "-t", target)
+
+	case types.UIActionCycleFocus:
+		var args types.CycleFocusArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		return orch.cycleFocus(args.Reverse)
+
+	case types.UIActionMaximizeMessages:
+		var args types.MaximizeMessagesArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		return orch.maximizeMessages(args)
+	}
+	return fmt.Errorf("not a pane action: %s", payload.Action)
+}
+
+// cycleFocus selects the pane of the panel after the focused one, in layout
+// order, wrapping around; the first when focus is elsewhere
+func (orch *TmuxOrchestrator) cycleFocus(reverse bool) error {
+	var panes []string
+	for _, panel := range orch.focusOrder() {
+		target := orch.getPaneTarget(panel, panel)
+		if target == "" {
+			continue
+		}
+		paneID, err := orch.resolvePaneID(target)
+		if err != nil {
+			log.Printf("[LAYOUT] Skipping panel %s in focus order: %v", panel, err)
+			continue
+		}
+		panes = append(panes, paneID)
+	}
+	if len(panes) == 0 {
+		return fmt.Errorf("no panel panes to focus")
+	}
+
+	session := orch.sessionName
+	if strings.TrimSpace(orch.tmuxTargetSession) != "" {
+		session = orch.tmuxTargetSession
+	}
+	active, err := orch.resolvePaneID(session)
+	if err != nil {
+		return err
+	}
+	next := 0
+	for i, pane := range panes {
+		if pane != active {
+			continue
+		}
+		step := 1
+		if reverse {
+			step = len(panes) - 1
+		}
+		next = (i + step) % len(panes)
+		break
+	}
+	if err := orch.tmux("select-window", "-t", panes[next]); err != nil {
+		return err
+	}
+	return orch.tmux("select-pane", "-t", panes[next])
+}
+
+// focusOrder lists the panels focus cycles through: the layout's, in the
+// order they are declared, or the default three
+func (orch *TmuxOrchestrator) focusOrder() []string {
+	orch.layoutMutex.Lock()
+	defer orch.layoutMutex.Unlock()
+	if orch.layout == nil || len(orch.layout.Panels) == 0 {
+		return []string{"sessions", "messages", "input"}
+	}
+	panels := make([]string, 0, len(orch.layout.Panels))
+	for _, panel := range orch.layout.Panels {
+		panels = append(panels, panel.ID)
+	}
+	return panels
+}
+
+// maximizeMessages zooms the messages pane, restoring the layout after
+// args.Seconds or when released. Asking again while maximized restarts the
+// wait. The layout is only restored while the messages pane is still the
+// zoomed one, so a zoom changed by hand in the meantime is left alone.
+func (orch *TmuxOrchestrator) maximizeMessages(args types.MaximizeMessagesArgs) error {
+	target := orch.getPaneTarget("messages", "messages")
+	if target == "" {
+		return fmt.Errorf("no pane for the messages panel")
+	}
+
+	orch.maximizeMu.Lock()
+	defer orch.maximizeMu.Unlock()
+	if orch.maximizeTimer != nil {
+		orch.maximizeTimer.Stop()
+		orch.maximizeTimer = nil
+	}
+
+	zoomed, err := orch.paneZoomed(target)
+	if err != nil {
+		return err
+	}
+	if args.Release {
+		if !zoomed {
+			return nil
+		}
+		log.Printf("[LAYOUT] Restoring layout after maximized messages pane")
+		return orch.tmux("resize-pane", "-Z", "-t", target)
+	}
+
+	if !zoomed {
+		if err := orch.tmux("resize-pane", "-Z", "-t", target); err != nil {
+			return err
+		}
+	}
+	if args.Seconds > 0 {
+		orch.maximizeTimer = time.AfterFunc(time.Duration(args.Seconds)*time.Second, func() {
+			if err := orch.maximizeMessages(types.MaximizeMessagesArgs{Release: true}); err != nil {
+				log.Printf("[LAYOUT] Failed to restore layout: %v", err)
+			}
+		})
+	}
+	return nil
+}
+
+// paneZoomed reports whether target is the zoomed pane of its window
+func (orch *TmuxOrchestrator) paneZoomed(target string) (bool, error) {
+	out, err := exec.CommandContext(orch.ctx, orch.tmuxCommand, "display-message", "-p", "-t", target, "#{window_zoomed_flag}#{pane_active}").Output()
+	if err != nil {
+		return false, fmt.Errorf("tmux display-message failed: %w", err)
+	}
+	return strings.TrimSpace(string(out)) == "11", nil
+}
+
+// tmux runs a tmux command, reporting what tmux printed when it fails
+func (orch *TmuxOrchestrator) tmux(args ...string) error {
+	if out, err := exec.CommandContext(orch.ctx, orch.tmuxCommand, args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("tmux %s failed: %v: %s", args[0], err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os/exec"
+	"strings"
+
+	tmuxconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/theme"
+)
+
+// setProfile makes profile the active one. Its layout is used from the next
+// layout build or reload; the rest is applied by applyProfile.
+func (orch *TmuxOrchestrator) setProfile(name string, profile tmuxconfig.Profile, profiles map[string]tmuxconfig.Profile) {
+	orch.layoutMutex.Lock()
+	defer orch.layoutMutex.Unlock()
+	orch.profileName = name
+	orch.profile = profile
+	orch.profiles = profiles
+}
+
+// applyProfile puts the active profile's theme and model into shared state
+// and binds its keys. Settings the profile leaves empty are not touched.
+func (orch *TmuxOrchestrator) applyProfile() {
+	orch.layoutMutex.Lock()
+	name, profile := orch.profileName, orch.profile
+	orch.bindProfileKeysLocked()
+	orch.layoutMutex.Unlock()
+	if name == "" || orch.syncManager == nil {
+		return
+	}
+
+	current := orch.syncManager.GetState()
+	if profile.Theme != "" && profile.Theme != current.Theme {
+		if err := theme.SetTheme(profile.Theme); err != nil {
+			log.Printf("[Profile] %s: unknown theme %q: %v", name, profile.Theme, err)
+		} else if err := orch.syncManager.ChangeTheme(profile.Theme, "orchestrator"); err != nil {
+			log.Printf("[Profile] %s: failed to set theme: %v", name, err)
+		}
+	}
+	if provider, model := profile.ModelParts(); model != "" && (provider != current.Provider || model != current.Model) {
+		if err := orch.syncManager.ChangeModel(provider, model, "orchestrator"); err != nil {
+			log.Printf("[Profile] %s: failed to set model: %v", name, err)
+		}
+	}
+	log.Printf("[Profile] Applied profile %s", name)
+}
+
+// applySessionDefaults gives state that still has the built-in theme and no
+// model the config's session theme and model, so a setup's choices apply to
+// new sessions without overriding what was picked later or by a profile.
+func (orch *TmuxOrchestrator) applySessionDefaults() {
+	defaults := orch.sessionDefaults
+	if orch.syncManager == nil || (defaults.Theme == "" && defaults.Model == "") {
+		return
+	}
+
+	current := orch.syncManager.GetState()
+	if defaults.Theme != "" && current.Theme == "opencode" && defaults.Theme != current.Theme {
+		if err := theme.SetTheme(defaults.Theme); err != nil {
+			log.Printf("[Config] Unknown session theme %q: %v", defaults.Theme, err)
+		} else if err := orch.syncManager.ChangeTheme(defaults.Theme, "orchestrator"); err != nil {
+			log.Printf("[Config] Failed to set session theme: %v", err)
+		}
+	}
+	if provider, model := defaults.ModelParts(); model != "" && current.Model == "" {
+		if err := orch.syncManager.ChangeModel(provider, model, "orchestrator"); err != nil {
+			log.Printf("[Config] Failed to set session model: %v", err)
+		}
+	}
+}
+
+// bindProfileKeysLocked replaces the keys bound for the previous profile with
+// the active profile's. Bindings live in tmux's root table, which every
+// session shares, so a key only focuses a panel in this session and is
+// passed through elsewhere. Callers hold layoutMutex.
+func (orch *TmuxOrchestrator) bindProfileKeysLocked() {
+	orch.unbindProfileKeysLocked()
+	if orch.serverOnly || len(orch.profile.Keybindings) == 0 {
+		return
+	}
+
+	session := orch.sessionName
+	if strings.TrimSpace(orch.tmuxTargetSession) != "" {
+		session = orch.tmuxTargetSession
+	}
+	for key, panel := range orch.profile.Keybindings {
+		pane := orch.panes[panel]
+		if pane == "" {
+			log.Printf("[Profile] Not binding %s: no panel %q in the layout", key, panel)
+			continue
+		}
+		args := []string{"bind-key", "-n", key,
+			"if-shell", "-F", fmt.Sprintf("#{==:#{session_name},%s}", session),
+			"select-window -t " + pane + " ; select-pane -t " + pane,
+			"send-keys " + key,
+		}
+		if err := exec.CommandContext(orch.ctx, orch.tmuxCommand, args...).Run(); err != nil {
+			log.Printf("[Profile] Failed to bind %s to panel %s: %v", key, panel, err)
+			continue
+		}
+		orch.boundKeys = append(orch.boundKeys, key)
+	}
+}
+
+// unbindProfileKeysLocked removes the keys bound by bindProfileKeysLocked.
+// Callers hold layoutMutex.
+func (orch *TmuxOrchestrator) unbindProfileKeysLocked() {
+	for _, key := range orch.boundKeys {
+		// Stop runs after the context is cancelled, so this does not use it
+		if err := exec.Command(orch.tmuxCommand, "unbind-key", "-n", key).Run(); err != nil {
+			log.Printf("[Profile] Failed to unbind %s: %v", key, err)
+		}
+	}
+	orch.boundKeys = nil
+}
+
+// SwitchProfile makes another profile the active one: its layout is applied
+// without restarting panels that stay, and its theme, model and keys replace
+// the current ones. Profiles are reread from the config file, so edits made
+// since startup count. A different state directory only takes effect on the
+// next start.
+func (orch *TmuxOrchestrator) SwitchProfile(name string) (*interfaces.ProfileStatus, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("profile name is required")
+	}
+	profiles, err := tmuxconfig.LoadProfiles(orch.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load profiles: %w", err)
+	}
+	name, profile, err := tmuxconfig.SelectProfile(profiles, name)
+	if err != nil {
+		return nil, err
+	}
+
+	orch.layoutMutex.Lock()
+	previous := orch.profile
+	orch.layoutMutex.Unlock()
+	orch.setProfile(name, profile, profiles)
+
+	if !orch.serverOnly {
+		if err := orch.ReloadLayout(""); err != nil {
+			return nil, fmt.Errorf("profile %s selected but its layout was not applied: %w", name, err)
+		}
+	}
+	orch.applyProfile()
+	if profile.StatePath(orch.sessionName) != previous.StatePath(orch.sessionName) {
+		log.Printf("[Profile] %s keeps state in %s from the next start; this run keeps %s", name, profile.StateDir, orch.statePath)
+	}
+	log.Printf("[Profile] Switched to profile %s", name)
+	return orch.profileStatus(), nil
+}
+
+// profileStatus reports the active profile and the ones to choose from
+func (orch *TmuxOrchestrator) profileStatus() *interfaces.ProfileStatus {
+	orch.layoutMutex.Lock()
+	defer orch.layoutMutex.Unlock()
+	return &interfaces.ProfileStatus{
+		Active:    orch.profileName,
+		Available: tmuxconfig.ProfileNames(orch.profiles),
+	}
+}
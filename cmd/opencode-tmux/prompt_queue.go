@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// drainPromptQueues starts draining every session with queued prompts, for
+// prompts left queued when the orchestrator last stopped
+func (orch *TmuxOrchestrator) drainPromptQueues() {
+	seen := make(map[string]bool)
+	for _, prompt := range orch.syncManager.GetState().GetPromptQueue("") {
+		if !seen[prompt.SessionID] {
+			seen[prompt.SessionID] = true
+			orch.drainPromptQueue(prompt.SessionID)
+		}
+	}
+}
+
+// drainPromptQueue submits the prompts queued for a session, one at a time,
+// while the session has no run in flight. One drainer runs per session; a
+// call while it runs does nothing, since the drainer rechecks the queue
+// after every prompt.
+func (orch *TmuxOrchestrator) drainPromptQueue(sessionID string) {
+	if sessionID == "" || orch.httpClient == nil {
+		return
+	}
+	orch.queueMu.Lock()
+	if orch.draining == nil {
+		orch.draining = make(map[string]bool)
+	}
+	if orch.draining[sessionID] {
+		orch.queueMu.Unlock()
+		return
+	}
+	orch.draining[sessionID] = true
+	orch.queueMu.Unlock()
+
+	go func() {
+		for orch.ctx.Err() == nil {
+			next, ok := orch.nextQueuedPrompt(sessionID)
+			if !ok {
+				return
+			}
+			if err := orch.recordQueueUpdate(types.PromptDequeued, types.PromptDequeuedPayload{PromptID: next.ID, Reason: types.DequeueSubmitted}); err != nil {
+				// Taken back for editing or removed meanwhile
+				log.Printf("[QUEUE] Skipping queued prompt %s: %v", next.ID, err)
+				continue
+			}
+			if err := orch.recordQueueUpdate(types.PromptSubmitted, types.PromptSubmitPayload{SessionID: sessionID, Text: next.Text}); err != nil {
+				log.Printf("[QUEUE] Failed to record queued prompt %s: %v", next.ID, err)
+			}
+			log.Printf("[QUEUE] Submitting queued prompt %s to session %s", next.ID, sessionID)
+			if err := orch.submitPrompt(orch.ctx, sessionID, next.Text); err != nil {
+				log.Printf("[QUEUE] Queued prompt %s failed: %v", next.ID, err)
+			}
+		}
+	}()
+}
+
+// nextQueuedPrompt returns the prompt to submit next, or false once the
+// session has none or has a run in flight; a run started elsewhere drains
+// the queue when it finishes. The drainer stops under queueMu, so a prompt
+// queued as it stops starts a new one.
+func (orch *TmuxOrchestrator) nextQueuedPrompt(sessionID string) (types.QueuedPrompt, bool) {
+	orch.queueMu.Lock()
+	defer orch.queueMu.Unlock()
+	current := orch.syncManager.GetState()
+	queued := current.GetPromptQueue(sessionID)
+	if len(queued) == 0 || len(current.GetActiveRuns(sessionID)) > 0 {
+		delete(orch.draining, sessionID)
+		return types.QueuedPrompt{}, false
+	}
+	return queued[0], true
+}
+
+// recordQueueUpdate applies a prompt queue or schedule update to shared state
+func (orch *TmuxOrchestrator) recordQueueUpdate(updateType types.UpdateType, payload interface{}) error {
+	return orch.syncManager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              ids.New("prompt_queue"),
+		Type:            updateType,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         payload,
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	})
+}
+
+// eventSessionID returns the session a run or prompt queue event is about.
+// Payloads from panels arrive decoded as maps.
+func (orch *TmuxOrchestrator) eventSessionID(event types.StateEvent) string {
+	var fields struct {
+		RunID     string             `json:"run_id"`
+		SessionID string             `json:"session_id"`
+		Prompt    types.QueuedPrompt `json:"prompt"`
+	}
+	data, err := json.Marshal(event.Data)
+	if err != nil || json.Unmarshal(data, &fields) != nil {
+		return ""
+	}
+	switch {
+	case fields.SessionID != "":
+		return fields.SessionID
+	case fields.Prompt.SessionID != "":
+		return fields.Prompt.SessionID
+	case fields.RunID != "":
+		if run, ok := orch.syncManager.GetState().GetAgentRun(fields.RunID); ok {
+			return run.SessionID
+		}
+	}
+	return ""
+}
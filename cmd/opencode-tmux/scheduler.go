@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// scheduleTick is how often scheduled prompts are checked for being due
+const scheduleTick = 15 * time.Second
+
+// runScheduler queues scheduled prompts as they fall due, until the
+// orchestrator stops. Prompts that fell due while it was stopped run once
+// when it starts.
+func (orch *TmuxOrchestrator) runScheduler() {
+	ticker := time.NewTicker(scheduleTick)
+	defer ticker.Stop()
+	for {
+		orch.runDueSchedules(time.Now())
+		select {
+		case <-orch.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runDueSchedules queues every scheduled prompt due at now. Recording the run
+// first moves the schedule on, so a prompt is queued once per due time.
+func (orch *TmuxOrchestrator) runDueSchedules(now time.Time) {
+	current := orch.syncManager.GetState()
+	for _, schedule := range current.GetScheduledPrompts() {
+		if !schedule.Due(now) {
+			continue
+		}
+		sessionID := schedule.SessionID
+		if sessionID == "" {
+			sessionID = current.GetCurrentSessionID()
+		}
+		if sessionID == "" {
+			log.Printf("[SCHEDULE] Scheduled prompt %s is due but no session is selected", schedule.ID)
+			continue
+		}
+
+		ran := types.ScheduledPromptRanPayload{ScheduleID: schedule.ID, SessionID: sessionID, RanAt: now}
+		if err := orch.recordQueueUpdate(types.ScheduledPromptRan, ran); err != nil {
+			log.Printf("[SCHEDULE] Skipping scheduled prompt %s: %v", schedule.ID, err)
+			continue
+		}
+		// Queued like any prompt, it waits for runs in flight and is then
+		// submitted by the queue's drainer
+		prompt := types.QueuedPrompt{ID: ids.New("queued"), SessionID: sessionID, Text: schedule.Text, QueuedBy: "scheduler"}
+		if err := orch.recordQueueUpdate(types.PromptQueued, types.PromptQueuedPayload{Prompt: prompt}); err != nil {
+			log.Printf("[SCHEDULE] Failed to queue scheduled prompt %s: %v", schedule.ID, err)
+			continue
+		}
+		log.Printf("[SCHEDULE] Queued scheduled prompt %s for session %s", schedule.ID, sessionID)
+	}
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"time"
+
+	appconfig "github.com/opencode/tmux_coder/internal/config"
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/sst/opencode-sdk-go"
+)
+
+// publishSessionTemplates stores the configured session templates, which the
+// input panel offers in its picker, when they changed since the state was saved
+func (orch *TmuxOrchestrator) publishSessionTemplates(configured []appconfig.TemplateConfig) {
+	var templates []types.SessionTemplate
+	for _, tc := range configured {
+		templates = append(templates, tc.SessionTemplate())
+	}
+	if reflect.DeepEqual(orch.syncManager.GetState().GetSessionTemplates(), templates) {
+		return
+	}
+	if err := orch.applyTemplateUpdate(types.SessionTemplatesChanged, types.SessionTemplatesPayload{Templates: templates}); err != nil {
+		log.Printf("Warning: failed to set session templates: %v", err)
+	}
+}
+
+// CreateSessionFromTemplate creates a session on the opencode server from the
+// named template and selects it, along with the template's agent and model.
+// title replaces the template's title when set.
+func (orch *TmuxOrchestrator) CreateSessionFromTemplate(name, title string) (*types.SessionInfo, error) {
+	if orch.httpClient == nil {
+		return nil, fmt.Errorf("opencode server is not connected")
+	}
+	name = strings.TrimSpace(name)
+	template, ok := types.FindSessionTemplate(orch.syncManager.GetState().GetSessionTemplates(), name)
+	if !ok {
+		return nil, fmt.Errorf("session template %q not found", name)
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		title = template.Title
+	}
+
+	params := opencode.SessionNewParams{}
+	if title != "" {
+		params.Title = opencode.F(title)
+	}
+	ctx, cancel := context.WithTimeout(orch.ctx, 10*time.Second)
+	defer cancel()
+	session, err := orch.httpClient.Session.New(ctx, params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+
+	info := types.NewSessionFromTemplate(template, types.SessionInfo{
+		ID:        session.ID,
+		Title:     session.Title,
+		CreatedAt: parseServerTime(session.Time.Created),
+		UpdatedAt: parseServerTime(session.Time.Updated),
+		IsActive:  true,
+	})
+	if err := orch.syncManager.AddSession(info, "orchestrator"); err != nil {
+		return nil, fmt.Errorf("session %s created but not added to state: %w", session.ID, err)
+	}
+	if err := orch.syncManager.UpdateSessionSelection(info.ID, "orchestrator"); err != nil {
+		log.Printf("[TEMPLATE] Failed to select session %s: %v", info.ID, err)
+	}
+
+	// The agent goes first, as selecting it also selects its default model
+	if template.Agent != "" {
+		if err := orch.applyTemplateUpdate(types.AgentChanged, types.AgentChangePayload{Agent: template.Agent}); err != nil {
+			log.Printf("[TEMPLATE] Failed to select agent %s: %v", template.Agent, err)
+		}
+	}
+	if template.Model != "" {
+		if model, err := types.ParseModelRef(template.Model); err == nil {
+			payload := types.ModelChangePayload{Provider: model.ProviderID, Model: model.ModelID, Agent: template.Agent}
+			if err := orch.applyTemplateUpdate(types.ModelChanged, payload); err != nil {
+				log.Printf("[TEMPLATE] Failed to select model %s: %v", template.Model, err)
+			}
+		}
+	}
+	log.Printf("[TEMPLATE] Created session %s from template %s", info.ID, template.Name)
+	return &info, nil
+}
+
+// applyTemplateUpdate applies an update made for session templates to shared state
+func (orch *TmuxOrchestrator) applyTemplateUpdate(updateType types.UpdateType, payload interface{}) error {
+	return orch.syncManager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              ids.New("session_template"),
+		Type:            updateType,
+		ExpectedVersion: orch.syncManager.GetState().GetCurrentVersion(),
+		Payload:         payload,
+		SourcePanel:     "orchestrator",
+		Timestamp:       time.Now(),
+	})
+}
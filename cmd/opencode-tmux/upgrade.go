@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/version"
+)
+
+// panelConnections returns the connected panels by layout panel ID. A layout
+// panel is matched to a connection by its type, or its ID when it has none.
+func (orch *TmuxOrchestrator) panelConnections() map[string]*ipc.ClientConnection {
+	connected := map[string]*ipc.ClientConnection{}
+	if orch.ipcServer == nil {
+		return connected
+	}
+	byType := map[string]*ipc.ClientConnection{}
+	for _, conn := range orch.ipcServer.GetConnections() {
+		byType[conn.PanelType] = conn
+	}
+
+	orch.layoutMutex.Lock()
+	defer orch.layoutMutex.Unlock()
+	if orch.layout == nil {
+		return connected
+	}
+	for _, panel := range orch.layout.Panels {
+		panelType := panel.Type
+		if panelType == "" {
+			panelType = panel.ID
+		}
+		if conn, ok := byType[panelType]; ok && orch.panes[panel.ID] != "" {
+			connected[panel.ID] = conn
+		}
+	}
+	return connected
+}
+
+// panelCompatibility says how a connected panel's build relates to the daemon's
+func panelCompatibility(conn *ipc.ClientConnection) version.Compatibility {
+	return version.Check(version.Build, version.Protocol, conn.Build, conn.Protocol)
+}
+
+// UpgradePanels restarts every connected panel not running targetBuild. The
+// panes run the binaries on disk, so after an install a restart is all a
+// panel needs; the daemon keeps its own build until the session restarts.
+func (orch *TmuxOrchestrator) UpgradePanels(targetBuild, targetProtocol string, dryRun bool) (*interfaces.UpgradeReport, error) {
+	if !version.ProtocolSupported(version.Protocol, targetProtocol) {
+		return nil, fmt.Errorf("build %s speaks IPC protocol %s, which this daemon (build %s, protocol %s) does not; restart the session instead",
+			targetBuild, targetProtocol, version.Build, version.Protocol)
+	}
+
+	report := &interfaces.UpgradeReport{
+		DaemonBuild:    version.Build,
+		TargetBuild:    targetBuild,
+		Restarted:      []string{},
+		Current:        []string{},
+		DryRun:         dryRun,
+		DaemonOutdated: version.Check(targetBuild, targetProtocol, version.Build, version.Protocol) != version.Match,
+	}
+	connections := orch.panelConnections()
+	names := make([]string, 0, len(connections))
+	for name := range connections {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		conn := connections[name]
+		if version.Check(targetBuild, targetProtocol, conn.Build, conn.Protocol) == version.Match {
+			report.Current = append(report.Current, name)
+			continue
+		}
+		if !dryRun {
+			log.Printf("[Upgrade] Restarting panel %s: build %s, installed %s", name, buildLabel(conn.Build), targetBuild)
+			if err := orch.RespawnPanel(name); err != nil {
+				if report.Failed == nil {
+					report.Failed = map[string]string{}
+				}
+				report.Failed[name] = err.Error()
+				continue
+			}
+		}
+		report.Restarted = append(report.Restarted, name)
+	}
+	if report.DaemonOutdated {
+		log.Printf("[Upgrade] Daemon runs build %s, installed is %s; it is replaced on the next session start", version.Build, targetBuild)
+	}
+	return report, nil
+}
+
+// buildLabel names a build in messages
+func buildLabel(build string) string {
+	if build == "" {
+		return "unknown"
+	}
+	return build
+}
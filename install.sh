@@ -124,15 +124,17 @@ build_binaries() {
 
         # Build CLI
         mkdir -p build
-        go build -ldflags="-s -w" -o build/tmuxcoder ./cmd/tmuxcoder
+        version=$(git describe --tags --always --dirty 2>/dev/null || echo "dev")
+        ldflags="-s -w -X github.com/opencode/tmux_coder/internal/version.Build=$version"
+        go build -ldflags="$ldflags" -o build/tmuxcoder ./cmd/tmuxcoder
 
         # Build panels
-        for pkg in cmd/opencode-tmux cmd/opencode-sessions cmd/opencode-messages cmd/opencode-input; do
+        for pkg in cmd/opencode-tmux cmd/opencode-sessions cmd/opencode-messages cmd/opencode-input cmd/opencode-controller cmd/opencode-diff; do
             out="$pkg/dist/$(basename "$pkg" | sed 's/opencode-//')-pane"
             [[ "$pkg" == "cmd/opencode-tmux" ]] && out="$pkg/dist/opencode-tmux"
             mkdir -p "$(dirname "$out")"
             echo "  -> Building $pkg"
-            go build -ldflags="-s -w" -o "$out" "./$pkg"
+            go build -ldflags="$ldflags" -o "$out" "./$pkg"
         done
     fi
 
@@ -0,0 +1,44 @@
+// Package agentroute routes prompts to opencode agents by mention: a prompt
+// starting "@reviewer" goes to the agent "@reviewer" is routed to, with the
+// mention taken off.
+package agentroute
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ValidMention reports whether name can be mentioned: lower case letters,
+// digits, dashes and underscores
+func ValidMention(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// Route returns the agent a prompt's leading mention is routed to and the
+// prompt without it. Prompts with no mention, a mention of no route, or
+// nothing after the mention are left as they are with no agent, so "@file"
+// references and the like reach the server untouched.
+func Route(text string, routes map[string]string) (agent, prompt string) {
+	trimmed := strings.TrimLeftFunc(text, unicode.IsSpace)
+	if !strings.HasPrefix(trimmed, "@") {
+		return "", text
+	}
+	end := strings.IndexFunc(trimmed, unicode.IsSpace)
+	if end < 0 {
+		return "", text
+	}
+	agent, ok := routes[strings.ToLower(trimmed[1:end])]
+	rest := strings.TrimSpace(trimmed[end:])
+	if !ok || agent == "" || rest == "" {
+		return "", text
+	}
+	return agent, rest
+}
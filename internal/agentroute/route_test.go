@@ -0,0 +1,38 @@
+package agentroute
+
+import "testing"
+
+func TestRoute(t *testing.T) {
+	routes := map[string]string{"reviewer": "review", "plan": "plan"}
+	tests := []struct {
+		text   string
+		agent  string
+		prompt string
+	}{
+		{"@reviewer check the diff", "review", "check the diff"},
+		{"  @Reviewer\n\ncheck the diff\n", "review", "check the diff"},
+		{"@plan a migration", "plan", "a migration"},
+		{"@main.go has a bug", "", "@main.go has a bug"},
+		{"@reviewer", "", "@reviewer"},
+		{"@reviewer   ", "", "@reviewer   "},
+		{"ask @reviewer later", "", "ask @reviewer later"},
+		{"no mention", "", "no mention"},
+	}
+	for _, tc := range tests {
+		agent, prompt := Route(tc.text, routes)
+		if agent != tc.agent || prompt != tc.prompt {
+			t.Errorf("Route(%q) = %q, %q; want %q, %q", tc.text, agent, prompt, tc.agent, tc.prompt)
+		}
+	}
+	if agent, _ := Route("@reviewer look", nil); agent != "" {
+		t.Errorf("routed with no routes to %q", agent)
+	}
+}
+
+func TestValidMention(t *testing.T) {
+	for name, want := range map[string]bool{"reviewer": true, "code-review_2": true, "": false, "Reviewer": false, "a b": false, "@x": false} {
+		if got := ValidMention(name); got != want {
+			t.Errorf("ValidMention(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
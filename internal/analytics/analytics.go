@@ -0,0 +1,299 @@
+// Package analytics summarizes how the assistant was used, day by day, from
+// the state journal: messages exchanged, tokens spent, tools run and time
+// spent working. It only sees the history the journal still retains.
+package analytics
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// DefaultIdleGap is the longest pause between updates still counted as
+// active time
+const DefaultIdleGap = 5 * time.Minute
+
+// dateLayout names days in reports and CSV
+const dateLayout = "2006-01-02"
+
+// activityTypes are the updates that mean someone was working in a session.
+// Updates the orchestrator makes on its own, such as git status polls and
+// connectivity probes, are left out so they do not count as active time.
+var activityTypes = map[types.UpdateType]bool{
+	types.SessionAdded:        true,
+	types.SessionChanged:      true,
+	types.MessageAdded:        true,
+	types.MessageUpdated:      true,
+	types.MessageDeleted:      true,
+	types.InputUpdated:        true,
+	types.PromptSubmitted:     true,
+	types.RunStarted:          true,
+	types.RunFinished:         true,
+	types.CancelRun:           true,
+	types.TerminalRunStarted:  true,
+	types.TerminalRunFinished: true,
+}
+
+// Source is the history a report is built from; *journal.Journal is one
+type Source interface {
+	Walk(entryFn func(journal.Entry), checkpointFn func(*types.SharedApplicationState)) error
+}
+
+// Query selects the history a report covers
+type Query struct {
+	Since     time.Time     `json:"since,omitempty"`      // Zero: everything retained
+	Until     time.Time     `json:"until,omitempty"`      // Zero: now
+	SessionID string        `json:"session_id,omitempty"` // Empty: all sessions
+	IdleGap   time.Duration `json:"idle_gap,omitempty"`   // Zero: DefaultIdleGap
+}
+
+// Day is the activity of one local calendar day
+type Day struct {
+	Date              string        `json:"date"` // YYYY-MM-DD in the daemon's time zone
+	UserMessages      int           `json:"user_messages"`
+	AssistantMessages int           `json:"assistant_messages"`
+	Tokens            int64         `json:"tokens"` // Input, output and reasoning tokens of finished steps
+	ToolRuns          int           `json:"tool_runs"`
+	ActiveTime        time.Duration `json:"active_time"`
+	Sessions          int           `json:"sessions"` // Sessions with activity that day
+}
+
+// Report is the activity over a query's range, one entry per day including
+// quiet days, oldest first
+type Report struct {
+	Since        time.Time `json:"since"`
+	Until        time.Time `json:"until"`
+	Days         []Day     `json:"days"`
+	Total        Day       `json:"total"`         // Sums over Days; Sessions counts distinct sessions
+	HistoryStart time.Time `json:"history_start"` // Oldest retained update; earlier activity is not counted
+}
+
+// entryPayload holds the fields of update payloads the report reads
+type entryPayload struct {
+	SessionID string          `json:"session_id"`
+	MessageID string          `json:"message_id"`
+	Message   *messagePayload `json:"message"`
+	Parts     []partPayload   `json:"parts"`
+}
+
+type messagePayload struct {
+	ID        string        `json:"id"`
+	SessionID string        `json:"session_id"`
+	Type      string        `json:"type"`
+	Parts     []partPayload `json:"parts"`
+}
+
+type partPayload struct {
+	ID        string `json:"id"`
+	SessionID string `json:"sessionID"`
+	Type      string `json:"type"`
+	Tokens    *struct {
+		Input     float64 `json:"input"`
+		Output    float64 `json:"output"`
+		Reasoning float64 `json:"reasoning"`
+	} `json:"tokens"`
+}
+
+// dayStats accumulates one day
+type dayStats struct {
+	Day
+	sessions map[string]bool
+}
+
+// Aggregate builds a report from source. Days follow the local time zone.
+func Aggregate(source Source, query Query) (*Report, error) {
+	until := query.Until
+	if until.IsZero() {
+		until = time.Now()
+	}
+	idleGap := query.IdleGap
+	if idleGap <= 0 {
+		idleGap = DefaultIdleGap
+	}
+
+	var (
+		days         = make(map[string]*dayStats)
+		allSessions  = make(map[string]bool)
+		messageOwner = make(map[string]string) // Message ID -> session ID
+		seenParts    = make(map[string]bool)
+		historyStart time.Time
+		firstActive  time.Time
+		lastActive   time.Time
+	)
+	day := func(t time.Time) *dayStats {
+		key := t.Local().Format(dateLayout)
+		stats, ok := days[key]
+		if !ok {
+			stats = &dayStats{Day: Day{Date: key}, sessions: make(map[string]bool)}
+			days[key] = stats
+		}
+		return stats
+	}
+
+	checkpointFn := func(state *types.SharedApplicationState) {
+		for _, message := range state.Messages {
+			messageOwner[message.ID] = message.SessionID
+		}
+	}
+	var entryFn func(entry journal.Entry)
+	entryFn = func(entry journal.Entry) {
+		if historyStart.IsZero() || entry.Timestamp.Before(historyStart) {
+			historyStart = entry.Timestamp
+		}
+		updateType := types.UpdateType(entry.Type)
+		if updateType == types.StateBatched {
+			// Updates applied together count one by one
+			members, _ := entry.Members()
+			for _, member := range members {
+				entryFn(member)
+			}
+			return
+		}
+		if !activityTypes[updateType] {
+			return
+		}
+
+		var payload entryPayload
+		if len(entry.Payload) > 0 {
+			// Payloads that do not decode still count as activity
+			json.Unmarshal(entry.Payload, &payload)
+		}
+		parts := payload.Parts
+		sessionID := payload.SessionID
+		if payload.Message != nil {
+			if payload.Message.ID != "" && payload.Message.SessionID != "" {
+				messageOwner[payload.Message.ID] = payload.Message.SessionID
+			}
+			sessionID = payload.Message.SessionID
+			parts = append(parts, payload.Message.Parts...)
+		}
+		if sessionID == "" && payload.MessageID != "" {
+			sessionID = messageOwner[payload.MessageID]
+		}
+
+		if query.SessionID != "" && sessionID != query.SessionID {
+			return
+		}
+		if entry.Timestamp.Before(query.Since) || entry.Timestamp.After(until) {
+			return
+		}
+
+		stats := day(entry.Timestamp)
+		if !lastActive.IsZero() {
+			if gap := entry.Timestamp.Sub(lastActive); gap > 0 && gap <= idleGap {
+				stats.ActiveTime += gap
+			}
+		}
+		if firstActive.IsZero() {
+			firstActive = entry.Timestamp
+		}
+		lastActive = entry.Timestamp
+		if sessionID != "" {
+			stats.sessions[sessionID] = true
+			allSessions[sessionID] = true
+		}
+
+		if updateType == types.MessageAdded && payload.Message != nil {
+			switch payload.Message.Type {
+			case "user":
+				stats.UserMessages++
+			case "assistant":
+				stats.AssistantMessages++
+			}
+		}
+
+		// Parts are resent as a reply streams in; each counts once, on the day
+		// it first appeared. Parts moved to the blob store are not counted.
+		for _, part := range parts {
+			if part.ID == "" || seenParts[part.ID] {
+				continue
+			}
+			switch part.Type {
+			case "tool":
+				stats.ToolRuns++
+			case "step-finish":
+				if part.Tokens == nil {
+					continue
+				}
+				stats.Tokens += int64(part.Tokens.Input + part.Tokens.Output + part.Tokens.Reasoning)
+			default:
+				continue
+			}
+			seenParts[part.ID] = true
+		}
+	}
+
+	if err := source.Walk(entryFn, checkpointFn); err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	report := &Report{
+		Since:        query.Since,
+		Until:        until,
+		HistoryStart: historyStart,
+		Total:        Day{Date: "total", Sessions: len(allSessions)},
+	}
+	if len(days) == 0 && query.Since.IsZero() {
+		return report, nil
+	}
+
+	// List every day in range, quiet ones included. Without a start the list
+	// opens on the first active day, and it never opens before the history.
+	first := query.Since
+	if first.IsZero() {
+		first = firstActive
+	} else if historyStart.After(first) {
+		first = historyStart
+	}
+	for date := startOfDay(first); !date.After(until); date = date.AddDate(0, 0, 1) {
+		stats := day(date)
+		stats.Sessions = len(stats.sessions)
+		report.Days = append(report.Days, stats.Day)
+
+		report.Total.UserMessages += stats.UserMessages
+		report.Total.AssistantMessages += stats.AssistantMessages
+		report.Total.Tokens += stats.Tokens
+		report.Total.ToolRuns += stats.ToolRuns
+		report.Total.ActiveTime += stats.ActiveTime
+	}
+	return report, nil
+}
+
+// startOfDay returns local midnight on t's day
+func startOfDay(t time.Time) time.Time {
+	year, month, day := t.Local().Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.Local)
+}
+
+// csvHeader names the columns WriteCSV writes
+var csvHeader = []string{"date", "user_messages", "assistant_messages", "tokens", "tool_runs", "active_minutes", "sessions"}
+
+// WriteCSV writes one row per day and a final total row
+func WriteCSV(w io.Writer, report *Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, day := range append(append([]Day(nil), report.Days...), report.Total) {
+		row := []string{
+			day.Date,
+			strconv.Itoa(day.UserMessages),
+			strconv.Itoa(day.AssistantMessages),
+			strconv.FormatInt(day.Tokens, 10),
+			strconv.Itoa(day.ToolRuns),
+			strconv.FormatFloat(day.ActiveTime.Minutes(), 'f', 1, 64),
+			strconv.Itoa(day.Sessions),
+		}
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
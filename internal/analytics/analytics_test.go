@@ -0,0 +1,185 @@
+package analytics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// fakeSource replays a checkpoint and then its entries
+type fakeSource struct {
+	checkpoint *types.SharedApplicationState
+	entries    []journal.Entry
+	err        error
+}
+
+func (s *fakeSource) Walk(entryFn func(journal.Entry), checkpointFn func(*types.SharedApplicationState)) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.checkpoint != nil {
+		checkpointFn(s.checkpoint)
+	}
+	for _, entry := range s.entries {
+		entryFn(entry)
+	}
+	return nil
+}
+
+// day0 is a local morning, so offsets of a few hours stay on the same day
+var day0 = time.Date(2025, 3, 3, 9, 0, 0, 0, time.Local)
+
+func at(day int, minutes int) time.Time {
+	return day0.AddDate(0, 0, day).Add(time.Duration(minutes) * time.Minute)
+}
+
+func entry(t *testing.T, when time.Time, updateType types.UpdateType, payload interface{}) journal.Entry {
+	t.Helper()
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return journal.Entry{Timestamp: when, Type: string(updateType), Payload: raw}
+}
+
+func message(id, sessionID, messageType string, parts ...map[string]interface{}) map[string]interface{} {
+	return map[string]interface{}{"message": map[string]interface{}{"id": id, "session_id": sessionID, "type": messageType, "parts": parts}}
+}
+
+func toolPart(id string) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": "tool", "tool": "bash"}
+}
+
+func stepPart(id string, input, output float64) map[string]interface{} {
+	return map[string]interface{}{"id": id, "type": "step-finish", "tokens": map[string]interface{}{"input": input, "output": output, "reasoning": 0}}
+}
+
+func testSource(t *testing.T) *fakeSource {
+	return &fakeSource{
+		checkpoint: &types.SharedApplicationState{Messages: []types.MessageInfo{{ID: "old", SessionID: "s2"}}},
+		entries: []journal.Entry{
+			// Day 0: a short exchange in s1
+			entry(t, at(0, 0), types.MessageAdded, message("m1", "s1", "user")),
+			entry(t, at(0, 1), types.MessageAdded, message("m2", "s1", "assistant")),
+			entry(t, at(0, 2), types.MessageUpdated, map[string]interface{}{"message_id": "m2", "parts": []interface{}{toolPart("p1")}}),
+			// The same parts streamed again along with the finished step
+			entry(t, at(0, 3), types.MessageUpdated, map[string]interface{}{"message_id": "m2", "parts": []interface{}{toolPart("p1"), stepPart("p2", 100, 50)}}),
+			// Polling is not activity, so the idle hour before the next prompt is not either
+			entry(t, at(0, 30), types.GitStatusChanged, map[string]interface{}{}),
+			entry(t, at(0, 63), types.MessageAdded, message("m3", "s1", "user")),
+			// Day 2: s2, whose message is known only from the checkpoint
+			entry(t, at(2, 0), types.MessageUpdated, map[string]interface{}{"message_id": "old", "parts": []interface{}{toolPart("p3"), toolPart("p4")}}),
+			entry(t, at(2, 4), types.MessageAdded, message("m4", "s2", "assistant", stepPart("p5", 10, 5))),
+		},
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	tests := []struct {
+		name  string
+		query Query
+		days  []Day
+		total Day
+	}{
+		{
+			name:  "everything",
+			query: Query{Until: at(2, 60)},
+			days: []Day{
+				{Date: "2025-03-03", UserMessages: 2, AssistantMessages: 1, Tokens: 150, ToolRuns: 1, ActiveTime: 3 * time.Minute, Sessions: 1},
+				{Date: "2025-03-04"},
+				{Date: "2025-03-05", AssistantMessages: 1, Tokens: 15, ToolRuns: 2, ActiveTime: 4 * time.Minute, Sessions: 1},
+			},
+			total: Day{Date: "total", UserMessages: 2, AssistantMessages: 2, Tokens: 165, ToolRuns: 3, ActiveTime: 7 * time.Minute, Sessions: 2},
+		},
+		{
+			name:  "one session",
+			query: Query{Until: at(2, 60), SessionID: "s2"},
+			days: []Day{
+				{Date: "2025-03-05", AssistantMessages: 1, Tokens: 15, ToolRuns: 2, ActiveTime: 4 * time.Minute, Sessions: 1},
+			},
+			total: Day{Date: "total", AssistantMessages: 1, Tokens: 15, ToolRuns: 2, ActiveTime: 4 * time.Minute, Sessions: 1},
+		},
+		{
+			name:  "longer idle gap",
+			query: Query{Until: at(0, 90), IdleGap: time.Hour},
+			days: []Day{
+				{Date: "2025-03-03", UserMessages: 2, AssistantMessages: 1, Tokens: 150, ToolRuns: 1, ActiveTime: 63 * time.Minute, Sessions: 1},
+			},
+			total: Day{Date: "total", UserMessages: 2, AssistantMessages: 1, Tokens: 150, ToolRuns: 1, ActiveTime: 63 * time.Minute, Sessions: 1},
+		},
+		{
+			name:  "window with quiet days",
+			query: Query{Since: at(1, -60), Until: at(3, 0)},
+			days: []Day{
+				{Date: "2025-03-04"},
+				{Date: "2025-03-05", AssistantMessages: 1, Tokens: 15, ToolRuns: 2, ActiveTime: 4 * time.Minute, Sessions: 1},
+				{Date: "2025-03-06"},
+			},
+			total: Day{Date: "total", AssistantMessages: 1, Tokens: 15, ToolRuns: 2, ActiveTime: 4 * time.Minute, Sessions: 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Aggregate(testSource(t), tt.query)
+			if err != nil {
+				t.Fatalf("Aggregate() error = %v", err)
+			}
+			if !report.HistoryStart.Equal(at(0, 0)) {
+				t.Errorf("HistoryStart = %v, want %v", report.HistoryStart, at(0, 0))
+			}
+			if len(report.Days) != len(tt.days) {
+				t.Fatalf("Days = %+v, want %+v", report.Days, tt.days)
+			}
+			for i := range tt.days {
+				if report.Days[i] != tt.days[i] {
+					t.Errorf("Days[%d] = %+v, want %+v", i, report.Days[i], tt.days[i])
+				}
+			}
+			if report.Total != tt.total {
+				t.Errorf("Total = %+v, want %+v", report.Total, tt.total)
+			}
+		})
+	}
+}
+
+func TestAggregateEmptyAndFailing(t *testing.T) {
+	report, err := Aggregate(&fakeSource{}, Query{})
+	if err != nil || len(report.Days) != 0 || !report.HistoryStart.IsZero() {
+		t.Errorf("empty history = %+v, %v; want no days", report, err)
+	}
+
+	boom := errors.New("boom")
+	if _, err := Aggregate(&fakeSource{err: boom}, Query{}); !errors.Is(err, boom) {
+		t.Errorf("Aggregate() error = %v, want %v", err, boom)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	report := &Report{
+		Days: []Day{
+			{Date: "2025-03-03", UserMessages: 2, AssistantMessages: 1, Tokens: 150, ToolRuns: 1, ActiveTime: 90 * time.Second, Sessions: 1},
+			{Date: "2025-03-04"},
+		},
+		Total: Day{Date: "total", UserMessages: 2, AssistantMessages: 1, Tokens: 150, ToolRuns: 1, ActiveTime: 90 * time.Second, Sessions: 1},
+	}
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, report); err != nil {
+		t.Fatalf("WriteCSV() error = %v", err)
+	}
+	want := strings.Join([]string{
+		"date,user_messages,assistant_messages,tokens,tool_runs,active_minutes,sessions",
+		"2025-03-03,2,1,150,1,1.5,1",
+		"2025-03-04,0,0,0,0,0.0,0",
+		"total,2,1,150,1,1.5,1",
+		"",
+	}, "\n")
+	if buf.String() != want {
+		t.Errorf("WriteCSV() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
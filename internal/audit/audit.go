@@ -0,0 +1,322 @@
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// Entry records one applied state update
+type Entry struct {
+	Timestamp     time.Time `json:"timestamp"`
+	UpdateID      string    `json:"update_id"`
+	Type          string    `json:"type"`
+	SourcePanel   string    `json:"source_panel"`
+	Target        string    `json:"target,omitempty"` // Session, message or annotation the update refers to
+	VersionBefore int64     `json:"version_before"`
+	VersionAfter  int64     `json:"version_after"`
+	PayloadHash   string    `json:"payload_hash"`
+}
+
+// Filter selects entries in a query; zero-valued fields match everything
+type Filter struct {
+	Type        string    `json:"type,omitempty"`
+	SourcePanel string    `json:"source_panel,omitempty"`
+	Target      string    `json:"target,omitempty"`
+	Since       time.Time `json:"since,omitempty"`
+	Until       time.Time `json:"until,omitempty"`
+	Limit       int       `json:"limit,omitempty"` // Most recent N matches
+}
+
+// Matches reports whether entry satisfies the filter
+func (f Filter) Matches(entry Entry) bool {
+	if f.Type != "" && entry.Type != f.Type {
+		return false
+	}
+	if f.SourcePanel != "" && entry.SourcePanel != f.SourcePanel {
+		return false
+	}
+	if f.Target != "" && entry.Target != f.Target {
+		return false
+	}
+	if !f.Since.IsZero() && entry.Timestamp.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && entry.Timestamp.After(f.Until) {
+		return false
+	}
+	return true
+}
+
+// Config controls where the audit log is written and how it rotates
+type Config struct {
+	Path     string      `json:"path"`
+	MaxSize  int64       `json:"max_size"`  // Rotate once the active file exceeds this many bytes
+	MaxFiles int         `json:"max_files"` // Rotated files kept in addition to the active one
+	FileMode os.FileMode `json:"file_mode"`
+}
+
+// DefaultConfig returns a configuration that keeps about 50MB of history
+func DefaultConfig(path string) Config {
+	return Config{
+		Path:     path,
+		MaxSize:  10 * 1024 * 1024,
+		MaxFiles: 5,
+		FileMode: 0600,
+	}
+}
+
+// queueSize is how many encoded entries may wait for the writer before Record blocks
+const queueSize = 1024
+
+// Log is an append-only JSON-lines audit log with size-based rotation.
+// Entries are written by a background goroutine, so Record never waits on disk.
+type Log struct {
+	config Config
+	file   *os.File
+	writer *bufio.Writer
+	size   int64
+	mutex  sync.Mutex // Guards the files against concurrent writes, rotation and queries
+
+	queue     chan request
+	done      chan struct{}
+	closed    bool
+	closeMu   sync.RWMutex // Held for reading while enqueueing, so Close never closes a queue in use
+	closeOnce sync.Once
+}
+
+// request is an encoded entry for the writer, or with data nil, a marker that
+// is signalled once everything queued before it is on disk
+type request struct {
+	data    []byte
+	flushed chan struct{}
+}
+
+// Open opens or creates the audit log at config.Path
+func Open(config Config) (*Log, error) {
+	if err := os.MkdirAll(filepath.Dir(config.Path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create audit directory: %w", err)
+	}
+
+	auditLog := &Log{
+		config: config,
+		queue:  make(chan request, queueSize),
+		done:   make(chan struct{}),
+	}
+	if err := auditLog.openFile(); err != nil {
+		return nil, err
+	}
+	go auditLog.writeLoop()
+	return auditLog, nil
+}
+
+// openFile opens the active file for appending and records its size
+func (l *Log) openFile() error {
+	file, err := os.OpenFile(l.config.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, l.config.FileMode)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat audit log: %w", err)
+	}
+
+	l.file = file
+	l.writer = bufio.NewWriter(file)
+	l.size = info.Size()
+	return nil
+}
+
+// Record queues an entry for the writer. Write failures happen later and are
+// logged; an error here means the entry could not be encoded or the log is closed.
+func (l *Log) Record(entry Entry) error {
+	data, err := json.Marshal(timefmt.UTC(entry))
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	data = append(data, '\n')
+	return l.enqueue(request{data: data})
+}
+
+func (l *Log) enqueue(req request) error {
+	l.closeMu.RLock()
+	defer l.closeMu.RUnlock()
+	if l.closed {
+		return fmt.Errorf("audit log is closed")
+	}
+	l.queue <- req
+	return nil
+}
+
+// writeLoop writes queued entries, flushing whenever the queue runs dry, so a
+// burst of updates costs one write
+func (l *Log) writeLoop() {
+	defer close(l.done)
+	for req := range l.queue {
+		l.mutex.Lock()
+		if req.data != nil {
+			if err := l.writeLocked(req.data); err != nil {
+				log.Printf("Failed to write audit entry: %v", err)
+			}
+		}
+		if len(l.queue) == 0 || req.flushed != nil {
+			if err := l.writer.Flush(); err != nil {
+				log.Printf("Failed to flush audit log: %v", err)
+			}
+		}
+		l.mutex.Unlock()
+		if req.flushed != nil {
+			close(req.flushed)
+		}
+	}
+}
+
+// writeLocked appends one encoded entry, rotating first if the active file is full
+func (l *Log) writeLocked(data []byte) error {
+	if l.file == nil {
+		return fmt.Errorf("audit log is closed after a failed rotation")
+	}
+	if l.config.MaxSize > 0 && l.size+int64(len(data)) > l.config.MaxSize {
+		if err := l.rotateLocked(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.writer.Write(data)
+	l.size += int64(n)
+	return err
+}
+
+// sync waits until every entry recorded so far is on disk
+func (l *Log) sync() {
+	flushed := make(chan struct{})
+	if l.enqueue(request{flushed: flushed}) == nil {
+		<-flushed
+	}
+}
+
+// rotateLocked shifts path -> path.1 -> ... -> path.MaxFiles and reopens path
+func (l *Log) rotateLocked() error {
+	if err := l.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush audit log: %w", err)
+	}
+	if err := l.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit log: %w", err)
+	}
+	l.file = nil
+
+	if l.config.MaxFiles > 0 {
+		os.Remove(l.rotatedPath(l.config.MaxFiles))
+		for i := l.config.MaxFiles - 1; i > 0; i-- {
+			os.Rename(l.rotatedPath(i), l.rotatedPath(i+1))
+		}
+		if err := os.Rename(l.config.Path, l.rotatedPath(1)); err != nil {
+			return fmt.Errorf("failed to rotate audit log: %w", err)
+		}
+	} else if err := os.Remove(l.config.Path); err != nil {
+		return fmt.Errorf("failed to truncate audit log: %w", err)
+	}
+
+	return l.openFile()
+}
+
+func (l *Log) rotatedPath(generation int) string {
+	return fmt.Sprintf("%s.%d", l.config.Path, generation)
+}
+
+// Query returns matching entries from the active and rotated files, oldest first
+func (l *Log) Query(filter Filter) ([]Entry, error) {
+	l.sync()
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	var entries []Entry
+	for i := l.config.MaxFiles; i >= 0; i-- {
+		path := l.config.Path
+		if i > 0 {
+			path = l.rotatedPath(i)
+		}
+		if err := readEntries(path, filter, &entries); err != nil {
+			return nil, err
+		}
+	}
+
+	// Files are read oldest first, but keep ordering stable across clock adjustments
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp.Before(entries[j].Timestamp)
+	})
+
+	if filter.Limit > 0 && len(entries) > filter.Limit {
+		entries = entries[len(entries)-filter.Limit:]
+	}
+	return entries, nil
+}
+
+// readEntries appends entries from path that match filter; missing files are skipped
+func readEntries(path string, filter Filter, entries *[]Entry) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to open audit file %s: %w", path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue // Skip a line torn by a crash mid-write
+		}
+		if filter.Matches(entry) {
+			*entries = append(*entries, entry)
+		}
+	}
+	return scanner.Err()
+}
+
+// Close writes the queued entries and closes the active file
+func (l *Log) Close() error {
+	l.closeOnce.Do(func() {
+		l.closeMu.Lock()
+		l.closed = true
+		close(l.queue)
+		l.closeMu.Unlock()
+	})
+	<-l.done
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	flushErr := l.writer.Flush()
+	err := l.file.Close()
+	l.file = nil
+	if flushErr != nil {
+		return flushErr
+	}
+	return err
+}
+
+// HashPayload returns a truncated SHA-256 of a payload's JSON encoding, enough
+// to correlate identical updates without storing their content
+func HashPayload(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
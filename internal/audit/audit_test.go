@@ -0,0 +1,105 @@
+package audit
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogRotationAndQuery(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "state.audit.log"))
+	config.MaxSize = 512
+	config.MaxFiles = 2
+
+	auditLog, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer auditLog.Close()
+
+	start := time.Now()
+	for i := 0; i < 20; i++ {
+		entry := Entry{
+			Timestamp:     start.Add(time.Duration(i) * time.Second),
+			UpdateID:      fmt.Sprintf("update_%d", i),
+			Type:          "message_added",
+			SourcePanel:   "messages",
+			VersionBefore: int64(i),
+			VersionAfter:  int64(i + 1),
+		}
+		if i == 18 {
+			entry.Type = "session_deleted"
+			entry.SourcePanel = "sessions"
+			entry.Target = "ses_1"
+		}
+		if err := auditLog.Record(entry); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+
+	if _, err := os.Stat(config.Path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected at most %d rotated files, found %s.3", config.MaxFiles, config.Path)
+	}
+
+	tests := []struct {
+		name      string
+		filter    Filter
+		wantCount int
+		wantFirst string
+	}{
+		{"by type and target", Filter{Type: "session_deleted", Target: "ses_1"}, 1, "update_18"},
+		{"by panel", Filter{SourcePanel: "sessions"}, 1, "update_18"},
+		{"limit keeps most recent", Filter{Limit: 2}, 2, "update_18"},
+		{"since", Filter{Since: start.Add(19 * time.Second)}, 1, "update_19"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries, err := auditLog.Query(tt.filter)
+			if err != nil {
+				t.Fatalf("Query() error = %v", err)
+			}
+			if len(entries) != tt.wantCount {
+				t.Fatalf("Query() returned %d entries, want %d", len(entries), tt.wantCount)
+			}
+			if entries[0].UpdateID != tt.wantFirst {
+				t.Errorf("first entry = %s, want %s", entries[0].UpdateID, tt.wantFirst)
+			}
+		})
+	}
+}
+
+func TestCloseWritesQueuedEntries(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "state.audit.log"))
+	auditLog, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	const count = 2 * queueSize
+	for i := 0; i < count; i++ {
+		if err := auditLog.Record(Entry{Timestamp: time.Now(), UpdateID: fmt.Sprintf("update_%d", i)}); err != nil {
+			t.Fatalf("Record() error = %v", err)
+		}
+	}
+	if err := auditLog.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if err := auditLog.Record(Entry{UpdateID: "late"}); err == nil {
+		t.Error("Record() after Close succeeded")
+	}
+
+	reopened, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reopened.Close()
+	entries, err := reopened.Query(Filter{})
+	if err != nil {
+		t.Fatalf("Query() error = %v", err)
+	}
+	if len(entries) != count {
+		t.Errorf("Query() returned %d entries, want %d", len(entries), count)
+	}
+}
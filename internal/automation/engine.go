@@ -0,0 +1,350 @@
+// Package automation runs user Starlark scripts that react to state events and
+// issue state updates.
+//
+// A script registers handlers with on(event_type, fn) when it is loaded; "*"
+// matches every event. Handlers receive the event as a dict and may call:
+//
+//	state()                 current session, sessions and version
+//	messages(session_id)    messages of a session
+//	update(type, payload)   apply a state update, e.g. "annotation_added"
+//	print(...)              write to the daemon log
+//
+// Updates issued by scripts come from SourcePanel "automation" and are not
+// delivered back to scripts, so a handler cannot trigger itself.
+package automation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"go.starlark.net/starlark"
+	"go.starlark.net/syntax"
+
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Source is the source panel of updates issued by scripts
+const Source = "automation"
+
+// DefaultMaxSteps bounds the work one handler call may do
+const DefaultMaxSteps = 1_000_000
+
+// anyEvent registers a handler for every event type
+const anyEvent = "*"
+
+// StateFunc returns the current shared state
+type StateFunc func() *types.SharedApplicationState
+
+// SubmitFunc applies an update issued by a script
+type SubmitFunc func(update types.StateUpdate) error
+
+type handler struct {
+	script string
+	fn     starlark.Callable
+}
+
+// Engine holds the loaded scripts and dispatches events to their handlers
+type Engine struct {
+	state    StateFunc
+	submit   SubmitFunc
+	maxSteps uint64
+
+	mutex    sync.Mutex
+	handlers map[string][]handler
+	scripts  []string
+	errors   int64
+}
+
+// NewEngine returns an engine with no scripts; maxSteps of 0 uses DefaultMaxSteps
+func NewEngine(state StateFunc, submit SubmitFunc, maxSteps uint64) *Engine {
+	if maxSteps == 0 {
+		maxSteps = DefaultMaxSteps
+	}
+	return &Engine{
+		state:    state,
+		submit:   submit,
+		maxSteps: maxSteps,
+		handlers: make(map[string][]handler),
+	}
+}
+
+// LoadFile loads a script from disk
+func (e *Engine) LoadFile(path string) error {
+	return e.load(path, nil)
+}
+
+// LoadSource loads a script from memory; name identifies it in logs
+func (e *Engine) LoadSource(name, src string) error {
+	return e.load(name, src)
+}
+
+func (e *Engine) load(name string, src interface{}) error {
+	script := filepath.Base(name)
+	registered := make(map[string][]handler)
+
+	on := starlark.NewBuiltin("on", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+		var eventType string
+		var fn starlark.Callable
+		if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &eventType, &fn); err != nil {
+			return nil, err
+		}
+		registered[eventType] = append(registered[eventType], handler{script: script, fn: fn})
+		return starlark.None, nil
+	})
+
+	predeclared := e.builtins(script)
+	predeclared["on"] = on
+
+	thread := e.newThread(script)
+	if _, err := starlark.ExecFileOptions(&syntax.FileOptions{}, thread, name, src, predeclared); err != nil {
+		return fmt.Errorf("failed to load script %s: %w", name, err)
+	}
+	if len(registered) == 0 {
+		return fmt.Errorf("script %s registers no handlers", name)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for eventType, handlers := range registered {
+		e.handlers[eventType] = append(e.handlers[eventType], handlers...)
+	}
+	e.scripts = append(e.scripts, script)
+	return nil
+}
+
+// Scripts lists the loaded scripts in load order
+func (e *Engine) Scripts() []string {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return append([]string(nil), e.scripts...)
+}
+
+// Errors returns how many handler calls have failed
+func (e *Engine) Errors() int64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.errors
+}
+
+// Handle runs the handlers registered for the event's type. Events from
+// scripts are ignored. A failing handler is logged and does not stop the others.
+func (e *Engine) Handle(event types.StateEvent) {
+	if event.SourcePanel == Source {
+		return
+	}
+
+	e.mutex.Lock()
+	handlers := append(append([]handler(nil), e.handlers[string(event.Type)]...), e.handlers[anyEvent]...)
+	e.mutex.Unlock()
+	if len(handlers) == 0 {
+		return
+	}
+
+	value, err := eventValue(event)
+	if err != nil {
+		log.Printf("Automation: cannot convert %s event %s: %v", event.Type, event.ID, err)
+		return
+	}
+	for _, h := range handlers {
+		thread := e.newThread(h.script)
+		if _, err := starlark.Call(thread, h.fn, starlark.Tuple{value}, nil); err != nil {
+			e.mutex.Lock()
+			e.errors++
+			e.mutex.Unlock()
+			log.Printf("Automation %s: handler %s failed on %s event: %v", h.script, h.fn.Name(), event.Type, err)
+		}
+	}
+}
+
+// Run handles events until the channel closes or ctx is cancelled
+func (e *Engine) Run(ctx context.Context, events <-chan types.StateEvent) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.Printf("Automation: event subscription closed, scripts stopped")
+				return
+			}
+			e.Handle(event)
+		}
+	}
+}
+
+func (e *Engine) newThread(script string) *starlark.Thread {
+	thread := &starlark.Thread{
+		Name: script,
+		Print: func(_ *starlark.Thread, msg string) {
+			log.Printf("Automation %s: %s", script, msg)
+		},
+	}
+	thread.SetMaxExecutionSteps(e.maxSteps)
+	return thread
+}
+
+// builtins returns the functions available to a script
+func (e *Engine) builtins(script string) starlark.StringDict {
+	return starlark.StringDict{
+		"state": starlark.NewBuiltin("state", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 0); err != nil {
+				return nil, err
+			}
+			current := e.state()
+			return toStarlarkJSON(map[string]interface{}{
+				"version":            current.GetCurrentVersion(),
+				"current_session_id": current.GetCurrentSessionID(),
+				"sessions":           current.GetSessions(),
+			})
+		}),
+		"messages": starlark.NewBuiltin("messages", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var sessionID string
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 1, &sessionID); err != nil {
+				return nil, err
+			}
+			return toStarlarkJSON(e.state().GetSessionMessages(sessionID))
+		}),
+		"update": starlark.NewBuiltin("update", func(thread *starlark.Thread, b *starlark.Builtin, args starlark.Tuple, kwargs []starlark.Tuple) (starlark.Value, error) {
+			var updateType string
+			var payload *starlark.Dict
+			if err := starlark.UnpackPositionalArgs(b.Name(), args, kwargs, 2, &updateType, &payload); err != nil {
+				return nil, err
+			}
+			goPayload, err := fromStarlark(payload)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", b.Name(), err)
+			}
+			update := types.StateUpdate{
+				ID:              ids.New("automation_" + strings.TrimSuffix(script, filepath.Ext(script))),
+				Type:            types.UpdateType(updateType),
+				ExpectedVersion: e.state().GetCurrentVersion(),
+				Payload:         goPayload,
+				SourcePanel:     Source,
+				Timestamp:       time.Now(),
+			}
+			if err := e.submit(update); err != nil {
+				return nil, fmt.Errorf("%s %s: %w", b.Name(), updateType, err)
+			}
+			return starlark.None, nil
+		}),
+	}
+}
+
+// eventValue converts an event to the dict handlers receive
+func eventValue(event types.StateEvent) (starlark.Value, error) {
+	return toStarlarkJSON(event)
+}
+
+// toStarlarkJSON converts a Go value to Starlark through its JSON form, so
+// field names match what panels see on the wire
+func toStarlarkJSON(value interface{}) (starlark.Value, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var decoded interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return toStarlark(decoded)
+}
+
+func toStarlark(value interface{}) (starlark.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return starlark.None, nil
+	case bool:
+		return starlark.Bool(v), nil
+	case string:
+		return starlark.String(v), nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return starlark.MakeInt64(i), nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, err
+		}
+		return starlark.Float(f), nil
+	case []interface{}:
+		items := make([]starlark.Value, 0, len(v))
+		for _, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, converted)
+		}
+		return starlark.NewList(items), nil
+	case map[string]interface{}:
+		dict := starlark.NewDict(len(v))
+		for key, item := range v {
+			converted, err := toStarlark(item)
+			if err != nil {
+				return nil, err
+			}
+			if err := dict.SetKey(starlark.String(key), converted); err != nil {
+				return nil, err
+			}
+		}
+		return dict, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %T", value)
+	}
+}
+
+// fromStarlark converts a Starlark value built by a script to plain Go values
+func fromStarlark(value starlark.Value) (interface{}, error) {
+	switch v := value.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v), nil
+	case starlark.String:
+		return string(v), nil
+	case starlark.Int:
+		i, ok := v.Int64()
+		if !ok {
+			return nil, fmt.Errorf("integer %s out of range", v)
+		}
+		return i, nil
+	case starlark.Float:
+		return float64(v), nil
+	case starlark.Indexable:
+		items := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			converted, err := fromStarlark(v.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, converted)
+		}
+		return items, nil
+	case *starlark.Dict:
+		m := make(map[string]interface{}, v.Len())
+		for _, item := range v.Items() {
+			key, ok := item[0].(starlark.String)
+			if !ok {
+				return nil, fmt.Errorf("dict key %s is not a string", item[0])
+			}
+			converted, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			m[string(key)] = converted
+		}
+		return m, nil
+	default:
+		return nil, fmt.Errorf("unsupported value of type %s", value.Type())
+	}
+}
@@ -0,0 +1,113 @@
+package automation
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+const jiraScript = `
+def tag_jira(event):
+    message = event["data"]["message"]
+    for word in message["content"].split():
+        if word.startswith("PROJ-"):
+            update("annotation_added", {"annotation": {
+                "message_id": message["id"],
+                "kind": "note",
+                "content": "JIRA " + word,
+            }})
+
+on("message_added", tag_jira)
+`
+
+func newTestEngine(t *testing.T, maxSteps uint64) (*Engine, *[]types.StateUpdate) {
+	t.Helper()
+	state := types.NewSharedApplicationState()
+	var submitted []types.StateUpdate
+	engine := NewEngine(func() *types.SharedApplicationState { return state }, func(update types.StateUpdate) error {
+		submitted = append(submitted, update)
+		return nil
+	}, maxSteps)
+	return engine, &submitted
+}
+
+func messageEvent(source, content string) types.StateEvent {
+	return types.StateEvent{
+		ID:          "event_1",
+		Type:        types.EventMessageAdded,
+		SourcePanel: source,
+		Data: types.MessageAddPayload{Message: types.MessageInfo{
+			ID: "msg_1", SessionID: "ses_1", Type: "user", Content: content,
+		}},
+	}
+}
+
+func TestEngineHandlesEvents(t *testing.T) {
+	engine, submitted := newTestEngine(t, 0)
+	if err := engine.LoadSource("jira.star", jiraScript); err != nil {
+		t.Fatalf("LoadSource failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		event   types.StateEvent
+		updates int
+	}{
+		{"mentions ticket", messageEvent("input-panel", "fix PROJ-42 today"), 1},
+		{"no ticket", messageEvent("input-panel", "nothing to see"), 0},
+		{"own update", messageEvent(Source, "PROJ-7"), 0},
+		{"other event type", types.StateEvent{Type: types.EventThemeChanged, Data: map[string]interface{}{"theme": "dark"}}, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			*submitted = nil
+			engine.Handle(tc.event)
+			if len(*submitted) != tc.updates {
+				t.Fatalf("got %d updates, want %d", len(*submitted), tc.updates)
+			}
+		})
+	}
+
+	engine.Handle(messageEvent("input-panel", "PROJ-42"))
+	update := (*submitted)[0]
+	if update.Type != types.AnnotationAdded || update.SourcePanel != Source {
+		t.Fatalf("unexpected update %+v", update)
+	}
+	annotation := update.Payload.(map[string]interface{})["annotation"].(map[string]interface{})
+	if annotation["message_id"] != "msg_1" || annotation["content"] != "JIRA PROJ-42" {
+		t.Fatalf("unexpected annotation %v", annotation)
+	}
+}
+
+func TestEngineRejectsBadScripts(t *testing.T) {
+	engine, _ := newTestEngine(t, 0)
+	if err := engine.LoadSource("syntax.star", "def broken(:\n"); err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if err := engine.LoadSource("idle.star", "x = 1\n"); err == nil || !strings.Contains(err.Error(), "no handlers") {
+		t.Fatalf("expected a no-handlers error, got %v", err)
+	}
+	if len(engine.Scripts()) != 0 {
+		t.Fatalf("failed scripts were kept: %v", engine.Scripts())
+	}
+}
+
+func TestEngineBoundsHandlerWork(t *testing.T) {
+	engine, submitted := newTestEngine(t, 10_000)
+	script := `
+def spin(event):
+    for i in range(1000000):
+        pass
+    update("theme_changed", {"theme": "never"})
+
+on("*", spin)
+`
+	if err := engine.LoadSource("spin.star", script); err != nil {
+		t.Fatalf("LoadSource failed: %v", err)
+	}
+	engine.Handle(messageEvent("input-panel", "hi"))
+	if engine.Errors() != 1 || len(*submitted) != 0 {
+		t.Fatalf("errors = %d, updates = %d; want the handler aborted", engine.Errors(), len(*submitted))
+	}
+}
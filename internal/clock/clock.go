@@ -0,0 +1,199 @@
+// Package clock abstracts wall time so that code which expires, schedules or
+// times out by it can run on a fake clock in tests.
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Clock tells the time and waits for it to pass
+type Clock interface {
+	Now() time.Time
+	Since(t time.Time) time.Duration
+	After(d time.Duration) <-chan time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers ticks at intervals, like time.Ticker
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) Since(t time.Time) time.Duration        { return time.Since(t) }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+func (realClock) NewTicker(d time.Duration) Ticker       { return realTicker{time.NewTicker(d)} }
+
+type realTicker struct{ ticker *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.ticker.C }
+func (t realTicker) Stop()               { t.ticker.Stop() }
+
+// Or returns c, or Real when c is nil
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Fake is a clock that only moves when told to. Timers and tickers fire
+// during Advance and Set, in the order they fall due. It is safe for
+// concurrent use.
+type Fake struct {
+	mutex   sync.Mutex
+	now     time.Time
+	waiters []*fakeWaiter
+	changed chan struct{} // Closed and replaced whenever waiters changes
+}
+
+type fakeWaiter struct {
+	due    time.Time
+	period time.Duration // Zero for one-shot timers
+	ch     chan time.Time
+}
+
+// NewFake returns a fake clock reading start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start, changed: make(chan struct{})}
+}
+
+// Now returns the fake time
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Since returns the fake time elapsed since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// After returns a channel that receives the fake time once d has passed on it
+func (f *Fake) After(d time.Duration) <-chan time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	ch := make(chan time.Time, 1)
+	if d <= 0 {
+		ch <- f.now
+		return ch
+	}
+	f.addLocked(&fakeWaiter{due: f.now.Add(d), ch: ch})
+	return ch
+}
+
+// NewTicker returns a ticker driven by the fake time. Like time.Ticker it
+// drops ticks a slow reader has not taken.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	waiter := &fakeWaiter{due: f.now.Add(d), period: d, ch: make(chan time.Time, 1)}
+	f.addLocked(waiter)
+	return &fakeTicker{clock: f, waiter: waiter}
+}
+
+// Advance moves the clock forward by d, firing what falls due on the way
+func (f *Fake) Advance(d time.Duration) {
+	f.Set(f.Now().Add(d))
+}
+
+// Set moves the clock to t, firing what falls due on the way. Moving it
+// backwards fires nothing.
+func (f *Fake) Set(t time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for {
+		sort.Slice(f.waiters, func(i, j int) bool { return f.waiters[i].due.Before(f.waiters[j].due) })
+		if len(f.waiters) == 0 || f.waiters[0].due.After(t) {
+			break
+		}
+		waiter := f.waiters[0]
+		f.now = waiter.due
+		select {
+		case waiter.ch <- waiter.due:
+		default:
+		}
+		if waiter.period > 0 {
+			waiter.due = waiter.due.Add(waiter.period)
+		} else {
+			f.removeLocked(waiter)
+		}
+	}
+	f.now = t
+}
+
+// Waiters returns how many timers and tickers are pending
+func (f *Fake) Waiters() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return len(f.waiters)
+}
+
+// BlockUntil waits until at least n timers and tickers are pending, so a
+// test can advance the clock knowing the goroutine under test is waiting on
+// it. It gives up after timeout and reports whether n was reached.
+func (f *Fake) BlockUntil(n int, timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	for {
+		f.mutex.Lock()
+		count, changed := len(f.waiters), f.changed
+		f.mutex.Unlock()
+		if count >= n {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-deadline.C:
+			return false
+		}
+	}
+}
+
+func (f *Fake) addLocked(waiter *fakeWaiter) {
+	f.waiters = append(f.waiters, waiter)
+	f.notifyLocked()
+}
+
+func (f *Fake) removeLocked(waiter *fakeWaiter) {
+	for i, w := range f.waiters {
+		if w == waiter {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			f.notifyLocked()
+			return
+		}
+	}
+}
+
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+type fakeTicker struct {
+	clock  *Fake
+	waiter *fakeWaiter
+}
+
+func (t *fakeTicker) C() <-chan time.Time { return t.waiter.ch }
+
+func (t *fakeTicker) Stop() {
+	t.clock.mutex.Lock()
+	defer t.clock.mutex.Unlock()
+	t.clock.removeLocked(t.waiter)
+}
@@ -0,0 +1,120 @@
+package clock
+
+import (
+	"testing"
+	"time"
+)
+
+var start = time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+func fired(ch <-chan time.Time) (time.Time, bool) {
+	select {
+	case at := <-ch:
+		return at, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeAfter(t *testing.T) {
+	fake := NewFake(start)
+	late := fake.After(2 * time.Minute)
+	early := fake.After(time.Minute)
+	if fake.Waiters() != 2 {
+		t.Fatalf("Waiters() = %d, want 2", fake.Waiters())
+	}
+
+	fake.Advance(59 * time.Second)
+	if _, ok := fired(early); ok {
+		t.Fatal("timer fired early")
+	}
+
+	fake.Advance(time.Second)
+	if at, ok := fired(early); !ok || !at.Equal(start.Add(time.Minute)) {
+		t.Fatalf("early timer = %v, %v; want %v", at, ok, start.Add(time.Minute))
+	}
+	if _, ok := fired(late); ok {
+		t.Fatal("late timer fired with the early one")
+	}
+
+	// Moving backwards fires nothing; jumping past fires at the due time
+	fake.Set(start)
+	if _, ok := fired(late); ok {
+		t.Fatal("timer fired when the clock moved back")
+	}
+	fake.Set(start.Add(time.Hour))
+	if at, ok := fired(late); !ok || !at.Equal(start.Add(2*time.Minute)) {
+		t.Errorf("late timer = %v, %v; want %v", at, ok, start.Add(2*time.Minute))
+	}
+	if got := fake.Since(start); got != time.Hour {
+		t.Errorf("Since(start) = %v, want 1h", got)
+	}
+	if fake.Waiters() != 0 {
+		t.Errorf("Waiters() = %d after all fired, want 0", fake.Waiters())
+	}
+
+	if _, ok := fired(fake.After(0)); !ok {
+		t.Errorf("After(0) did not fire at once")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	fake := NewFake(start)
+	ticker := fake.NewTicker(10 * time.Second)
+
+	fake.Advance(10 * time.Second)
+	if at, ok := fired(ticker.C()); !ok || !at.Equal(start.Add(10*time.Second)) {
+		t.Fatalf("tick = %v, %v", at, ok)
+	}
+
+	// Like time.Ticker, ticks nobody took are dropped rather than queued
+	fake.Advance(30 * time.Second)
+	if _, ok := fired(ticker.C()); !ok {
+		t.Fatal("no tick after 30s")
+	}
+	if _, ok := fired(ticker.C()); ok {
+		t.Fatal("missed ticks were queued")
+	}
+
+	ticker.Stop()
+	fake.Advance(time.Minute)
+	if _, ok := fired(ticker.C()); ok {
+		t.Error("stopped ticker ticked")
+	}
+	if fake.Waiters() != 0 {
+		t.Errorf("Waiters() = %d after Stop, want 0", fake.Waiters())
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	fake := NewFake(start)
+	done := make(chan struct{})
+	go func() {
+		<-fake.After(time.Second)
+		close(done)
+	}()
+
+	if !fake.BlockUntil(1, time.Second) {
+		t.Fatal("BlockUntil() gave up before the goroutine waited")
+	}
+	fake.Advance(time.Second)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("waiting goroutine was not woken")
+	}
+
+	if fake.BlockUntil(1, 10*time.Millisecond) {
+		t.Error("BlockUntil() reported a waiter that had fired")
+	}
+}
+
+func TestOr(t *testing.T) {
+	if Or(nil) != Real {
+		t.Error("Or(nil) is not the system clock")
+	}
+	fake := NewFake(start)
+	if Or(fake) != Clock(fake) {
+		t.Error("Or(fake) did not return fake")
+	}
+}
@@ -0,0 +1,176 @@
+// Package codeblocks finds the fenced code blocks of markdown message bodies
+// so they can be copied, saved or opened on their own.
+package codeblocks
+
+import (
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// extensions maps common fence languages to the file extension code in them is saved with
+var extensions = map[string]string{
+	"bash":       ".sh",
+	"c":          ".c",
+	"c++":        ".cpp",
+	"cpp":        ".cpp",
+	"cs":         ".cs",
+	"csharp":     ".cs",
+	"css":        ".css",
+	"diff":       ".diff",
+	"dockerfile": ".dockerfile",
+	"go":         ".go",
+	"golang":     ".go",
+	"html":       ".html",
+	"java":       ".java",
+	"javascript": ".js",
+	"js":         ".js",
+	"json":       ".json",
+	"jsx":        ".jsx",
+	"kotlin":     ".kt",
+	"lua":        ".lua",
+	"make":       ".mk",
+	"makefile":   ".mk",
+	"markdown":   ".md",
+	"md":         ".md",
+	"patch":      ".patch",
+	"php":        ".php",
+	"py":         ".py",
+	"python":     ".py",
+	"rb":         ".rb",
+	"ruby":       ".rb",
+	"rs":         ".rs",
+	"rust":       ".rs",
+	"sh":         ".sh",
+	"shell":      ".sh",
+	"sql":        ".sql",
+	"swift":      ".swift",
+	"toml":       ".toml",
+	"ts":         ".ts",
+	"tsx":        ".tsx",
+	"typescript": ".ts",
+	"xml":        ".xml",
+	"yaml":       ".yaml",
+	"yml":        ".yaml",
+	"zsh":        ".sh",
+}
+
+// pathKeys are the info string attributes naming the file a block belongs in
+var pathKeys = map[string]bool{
+	"file":     true,
+	"filename": true,
+	"path":     true,
+	"title":    true,
+}
+
+// Extract returns the fenced code blocks of a markdown body in order. Fences
+// are runs of at least three backticks or tildes indented by up to three
+// spaces; a block left open runs to the end of the body.
+func Extract(body string) []types.CodeBlock {
+	var blocks []types.CodeBlock
+	var open *types.CodeBlock
+	var fence string
+
+	lineNo := 0
+	for start := 0; start < len(body); {
+		lineNo++
+		end := len(body)
+		if newline := strings.IndexByte(body[start:], '\n'); newline >= 0 {
+			end = start + newline
+		}
+		line := body[start:end]
+
+		if open == nil {
+			if marker, info, ok := openingFence(line); ok {
+				fence = marker
+				lang, path := parseInfo(info)
+				open = &types.CodeBlock{
+					Index:     len(blocks),
+					Language:  lang,
+					Path:      path,
+					Start:     min(end+1, len(body)),
+					StartLine: lineNo + 1,
+				}
+			}
+		} else if closesFence(line, fence) {
+			// The code ends at the newline before the closing fence
+			open.End = max(open.Start, start-1)
+			open.EndLine = lineNo - 1
+			blocks = append(blocks, *open)
+			open = nil
+		}
+		start = end + 1
+	}
+
+	if open != nil {
+		open.End = max(open.Start, len(strings.TrimSuffix(body, "\n")))
+		open.EndLine = lineNo
+		blocks = append(blocks, *open)
+	}
+	return blocks
+}
+
+// Extension returns the file extension for code in language, ".txt" when unknown
+func Extension(language string) string {
+	if ext, ok := extensions[strings.ToLower(language)]; ok {
+		return ext
+	}
+	return ".txt"
+}
+
+// openingFence reports whether line opens a code block, returning the fence
+// and the info string after it
+func openingFence(line string) (string, string, bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || len(trimmed) < 3 {
+		return "", "", false
+	}
+	char := trimmed[0]
+	if char != '`' && char != '~' {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == char {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(trimmed[n:])
+	// A backtick fence cannot have backticks in its info string
+	if char == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	return trimmed[:n], info, true
+}
+
+// closesFence reports whether line closes a block opened by fence: the same
+// character, at least as many times, and nothing after but spaces
+func closesFence(line, fence string) bool {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 {
+		return false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == fence[0] {
+		n++
+	}
+	return n >= len(fence) && strings.TrimSpace(trimmed[n:]) == ""
+}
+
+// parseInfo returns the language and file named by a fence's info string:
+// "go" and "main.go" of both "go title=main.go" and "go:main.go"
+func parseInfo(info string) (string, string) {
+	fields := strings.Fields(info)
+	if len(fields) == 0 {
+		return "", ""
+	}
+	lang, path, _ := strings.Cut(strings.Trim(fields[0], "{}."), ":")
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if ok && pathKeys[strings.ToLower(key)] {
+			path = strings.Trim(value, `"'`)
+		}
+	}
+	return lang, path
+}
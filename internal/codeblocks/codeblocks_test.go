@@ -0,0 +1,142 @@
+package codeblocks
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestExtract(t *testing.T) {
+	body := "Try this:\n\n```go title=main.go\nfunc main() {\n\tprintln(\"hi\")\n}\n```\n\nThen run:\n" +
+		"  ~~~~\n  make test\n  ```\n  ~~~~\nand\n```\n```\n```sh\nunterminated\n"
+
+	blocks := Extract(body)
+	want := []struct {
+		language  string
+		code      string
+		startLine int
+		endLine   int
+	}{
+		{"go", "func main() {\n\tprintln(\"hi\")\n}", 4, 6},
+		{"", "  make test\n  ```", 11, 12},
+		{"", "", 16, 15},
+		{"sh", "unterminated", 18, 18},
+	}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d: %+v", len(blocks), len(want), blocks)
+	}
+	for i, block := range blocks {
+		code, err := block.Code(body)
+		if err != nil {
+			t.Fatalf("block %d: %v", i, err)
+		}
+		if block.Index != i || block.Language != want[i].language || code != want[i].code ||
+			block.StartLine != want[i].startLine || block.EndLine != want[i].endLine {
+			t.Errorf("block %d = %+v with code %q, want %+v", i, block, code, want[i])
+		}
+	}
+}
+
+func TestExtractIgnoresInlineAndIndentedFences(t *testing.T) {
+	for _, body := range []string{
+		"",
+		"no code here",
+		"use ``` for fences",
+		"    ```\n    indented code\n    ```",
+		"```go`\nnot a fence",
+	} {
+		if blocks := Extract(body); len(blocks) != 0 {
+			t.Errorf("Extract(%q) = %+v, want none", body, blocks)
+		}
+	}
+}
+
+func TestExtension(t *testing.T) {
+	for language, want := range map[string]string{"go": ".go", "Python": ".py", "": ".txt", "brainfuck": ".txt"} {
+		if got := Extension(language); got != want {
+			t.Errorf("Extension(%q) = %q, want %q", language, got, want)
+		}
+	}
+}
+
+func TestExtractPaths(t *testing.T) {
+	body := "```go title=\"cmd/main.go\"\npackage main\n```\n```ts:src/app.ts\nexport {}\n```\n```python\npass\n```\n"
+	blocks := Extract(body)
+	want := [][2]string{{"go", "cmd/main.go"}, {"ts", "src/app.ts"}, {"python", ""}}
+	if len(blocks) != len(want) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(want))
+	}
+	for i, block := range blocks {
+		if block.Language != want[i][0] || block.Path != want[i][1] {
+			t.Errorf("block %d: language %q path %q, want %q %q", i, block.Language, block.Path, want[i][0], want[i][1])
+		}
+	}
+}
+
+func TestWriteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pkg", "main.go")
+
+	// A new file is written when it still does not exist
+	if err := WriteFile(path, []byte("one\n"), ""); err != nil {
+		t.Fatal(err)
+	}
+	base, err := FileHash(path)
+	if err != nil || base == "" {
+		t.Fatalf("FileHash = %q, %v", base, err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(path, []byte("two\n"), base); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "two\n" {
+		t.Errorf("content = %q", got)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0o600 {
+		t.Errorf("mode = %v, want it kept", info.Mode().Perm())
+	}
+
+	// The file changed since base was taken
+	if err := WriteFile(path, []byte("three\n"), base); !errors.Is(err, ErrFileChanged) {
+		t.Errorf("stale write error = %v, want ErrFileChanged", err)
+	}
+	if err := WriteFile(path, []byte("three\n"), ""); !errors.Is(err, ErrFileChanged) {
+		t.Errorf("write expecting no file error = %v, want ErrFileChanged", err)
+	}
+	if got, _ := os.ReadFile(path); string(got) != "two\n" {
+		t.Errorf("content after refused writes = %q", got)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("temporary files left behind: %v", entries)
+	}
+}
+
+func TestDescribe(t *testing.T) {
+	for name, tc := range map[string]struct {
+		body string
+		want types.ContentMeta
+	}{
+		"empty": {"", types.ContentMeta{}},
+		"prose": {"one\ntwo\n", types.ContentMeta{Lines: 2}},
+		"code": {
+			"Two files:\n```go\na\nb\nc\n```\n```sh\nmake\n```\n```\nplain\n```",
+			types.ContentMeta{Lines: 12, Language: "go", CodeBlocks: 3, CodeLines: 5},
+		},
+		"fenced diff": {
+			"```diff\n--- a/x\n+++ b/x\n@@ -1 +1,2 @@\n-old\n+new\n+more\n```\n",
+			types.ContentMeta{Lines: 8, Language: "diff", CodeBlocks: 1, CodeLines: 6, Additions: 2, Deletions: 1},
+		},
+		"bare patch": {
+			"diff --git a/x b/x\n--- a/x\n+++ b/x\n@@ -1 +0,0 @@\n-gone\n",
+			types.ContentMeta{Lines: 5, Language: "diff", Deletions: 1},
+		},
+	} {
+		if got := Describe(tc.body); got != tc.want {
+			t.Errorf("%s: Describe = %+v, want %+v", name, got, tc.want)
+		}
+	}
+}
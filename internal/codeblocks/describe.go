@@ -0,0 +1,80 @@
+package codeblocks
+
+import (
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Describe returns the content metadata of a message body: its line count,
+// the language most of its fenced code is in, and the lines added and
+// removed by the diffs it holds, fenced or making up the whole body
+func Describe(body string) types.ContentMeta {
+	meta := types.ContentMeta{Lines: countLines(body)}
+	if meta.Lines == 0 {
+		return meta
+	}
+
+	blocks := Extract(body)
+	if len(blocks) == 0 {
+		if isPatch(body) {
+			meta.Language = "diff"
+			meta.Additions, meta.Deletions = diffStats(body)
+		}
+		return meta
+	}
+
+	linesByLanguage := make(map[string]int)
+	for _, block := range blocks {
+		code := body[block.Start:block.End]
+		lines := countLines(code)
+		meta.CodeBlocks++
+		meta.CodeLines += lines
+		language := strings.ToLower(block.Language)
+		if language == "patch" || (language == "" && isPatch(code)) {
+			language = "diff"
+		}
+		if language == "diff" {
+			added, deleted := diffStats(code)
+			meta.Additions += added
+			meta.Deletions += deleted
+		}
+		if language != "" {
+			linesByLanguage[language] += lines
+			// Blocks come in order, so the first language wins a tie
+			if meta.Language == "" || linesByLanguage[language] > linesByLanguage[meta.Language] {
+				meta.Language = language
+			}
+		}
+	}
+	return meta
+}
+
+// countLines counts the lines of text, a final newline ending the last one
+func countLines(text string) int {
+	if text == "" {
+		return 0
+	}
+	return strings.Count(strings.TrimSuffix(text, "\n"), "\n") + 1
+}
+
+// isPatch reports whether text reads as a unified diff
+func isPatch(text string) bool {
+	return (strings.HasPrefix(text, "diff --git ") || strings.HasPrefix(text, "--- ") || strings.Contains(text, "\n--- ")) &&
+		strings.Contains(text, "\n+++ ") && strings.Contains(text, "\n@@ ")
+}
+
+// diffStats counts the lines a unified diff adds and removes, leaving out file headers
+func diffStats(patch string) (int, int) {
+	added, deleted := 0, 0
+	for _, line := range strings.Split(patch, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "), strings.HasPrefix(line, "--- "):
+		case strings.HasPrefix(line, "+"):
+			added++
+		case strings.HasPrefix(line, "-"):
+			deleted++
+		}
+	}
+	return added, deleted
+}
@@ -0,0 +1,78 @@
+package codeblocks
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ErrFileChanged is returned by WriteFile when the file is not as it was
+// when the change was previewed
+var ErrFileChanged = errors.New("file changed since the preview")
+
+// FileHash returns the hash of a file's content, empty when it does not exist
+func FileHash(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return Hash(data), nil
+}
+
+// Hash returns the hash FileHash gives a file holding data
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// WriteFile replaces the content of path with data, provided the file still
+// hashes to base, the FileHash taken when the change was previewed. The data
+// goes to a temporary file renamed over path, so the file is never left half
+// written; an existing file keeps its permissions.
+func WriteFile(path string, data []byte, base string) error {
+	current, err := FileHash(path)
+	if err != nil {
+		return err
+	}
+	if current != base {
+		return fmt.Errorf("%s: %w", path, ErrFileChanged)
+	}
+
+	mode := fs.FileMode(0o644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tempPath, mode); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
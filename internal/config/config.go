@@ -2,17 +2,48 @@ package config
 
 import (
 	"fmt"
+	"net"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/opencode/tmux_coder/internal/agentroute"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/webhook"
 	"gopkg.in/yaml.v3"
 )
 
 // Config represents the complete configuration for opencode-tmux
 type Config struct {
-	Supervision SupervisionConfig `yaml:"supervision"`
-	IPC         IPCConfig         `yaml:"ipc"`
-	Permissions PermissionsConfig `yaml:"permissions"`
+	Supervision  SupervisionConfig  `yaml:"supervision"`
+	IPC          IPCConfig          `yaml:"ipc"`
+	Permissions  PermissionsConfig  `yaml:"permissions"`
+	Security     SecurityConfig     `yaml:"security"`
+	Backup       BackupConfig       `yaml:"backup"`
+	Storage      StorageConfig      `yaml:"storage"`
+	Automation   AutomationConfig   `yaml:"automation"`
+	Webhooks     WebhooksConfig     `yaml:"webhooks"`
+	HTTPAPI      HTTPAPIConfig      `yaml:"http_api"`
+	Git          GitConfig          `yaml:"git"`
+	Diffs        DiffsConfig        `yaml:"diffs"`
+	FileTree     FileTreeConfig     `yaml:"file_tree"`
+	Terminal     TerminalConfig     `yaml:"terminal"`
+	Editor       EditorConfig       `yaml:"editor"`
+	LSP          LSPConfig          `yaml:"lsp"`
+	Models       ModelsConfig       `yaml:"models"`
+	Agents       AgentsConfig       `yaml:"agents"`
+	Connectivity ConnectivityConfig `yaml:"connectivity"`
+	Tracing      TracingConfig      `yaml:"tracing"`
+	Watchdog     WatchdogConfig     `yaml:"watchdog"`
+	CrashReports CrashReportsConfig `yaml:"crash_reports"`
+	Confirmation ConfirmationConfig `yaml:"confirmation"`
+	Display      DisplayConfig      `yaml:"display"`
+	Templates    []TemplateConfig   `yaml:"templates"`
 }
 
 // SupervisionConfig controls process monitoring and health checking
@@ -21,13 +52,47 @@ type SupervisionConfig struct {
 	HealthCheckInterval time.Duration `yaml:"health_check_interval"` // How often to check pane health
 	RestartDelay        time.Duration `yaml:"restart_delay"`         // Initial delay before restarting failed process
 	MaxRestartDelay     time.Duration `yaml:"max_restart_delay"`     // Maximum delay between restart attempts
+	PanelLogMaxSize     int64         `yaml:"panel_log_max_size"`    // Bytes a panel's stderr log may grow to before rotation; -1 disables rotation
+	PanelLogBackups     int           `yaml:"panel_log_backups"`     // Rotated panel logs kept
 }
 
 // IPCConfig controls IPC socket behavior
 type IPCConfig struct {
 	SocketDir  string        `yaml:"socket_dir"`  // Directory for IPC socket files
+	SocketPath string        `yaml:"socket_path"` // Explicit socket path; "{session}" expands to the session name
 	SocketMode string        `yaml:"socket_mode"` // Unix file permissions (e.g., "0600")
+	PeerPolicy string        `yaml:"peer_policy"` // Who may connect, by peer credentials: "owner", "group", "any"
 	Timeout    time.Duration `yaml:"timeout"`     // IPC request timeout
+	// StateSnapshot publishes state in a memory-mapped file that render-only panels read instead of IPC
+	StateSnapshot bool `yaml:"state_snapshot"`
+	// EventHistorySize is how many recent events are kept in memory for replay
+	EventHistorySize int `yaml:"event_history_size"`
+	// EventOverflowSize bounds the bytes of older events spilled to disk; 0 keeps history in memory only
+	EventOverflowSize int64 `yaml:"event_overflow_size"`
+	// VectorClockNode enables vector-clock versioning under this name; empty uses plain versions
+	VectorClockNode string `yaml:"vector_clock_node"`
+}
+
+// ParseSocketMode parses SocketMode as an octal file mode
+func (c IPCConfig) ParseSocketMode() (os.FileMode, error) {
+	return parseMode("socket_mode", c.SocketMode)
+}
+
+// parseMode parses value, the setting key, as octal permission bits
+func parseMode(key, value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if mode > 0777 {
+		return 0, fmt.Errorf("invalid %s %q: only permission bits are allowed", key, value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// ResolveSocketPath expands the session placeholder in SocketPath
+func (c IPCConfig) ResolveSocketPath(sessionName string) string {
+	return strings.ReplaceAll(c.SocketPath, "{session}", sessionName)
 }
 
 // PermissionsConfig controls who can perform various operations
@@ -37,6 +102,332 @@ type PermissionsConfig struct {
 	Status       string `yaml:"status"`        // Who can view status
 }
 
+// SecurityConfig controls content scanning of state updates
+type SecurityConfig struct {
+	SecretPolicy string `yaml:"secret_policy"` // Secret scanning: "off", "flag", "block"
+}
+
+// BackupConfig controls off-site copies of session state
+type BackupConfig struct {
+	Interval     time.Duration             `yaml:"interval"` // Time between off-site copies; 0 copies only on demand
+	Keep         int                       `yaml:"keep"`     // State copies kept per destination; 0 keeps all
+	Destinations []BackupDestinationConfig `yaml:"destinations"`
+}
+
+// StorageConfig chooses where state is kept and bounds the size of the state file
+type StorageConfig struct {
+	Backend                  string              `yaml:"backend"`                     // "file" or "memory"; memory state is lost on exit
+	MaxStateSize             int64               `yaml:"max_state_size"`              // Bytes at which the state is compacted; 0 disables the quota
+	RetainMessagesPerSession int                 `yaml:"retain_messages_per_session"` // Messages compaction keeps per session; 0 keeps all
+	MaxMessageSize           int                 `yaml:"max_message_size"`            // Bytes of a message body kept in state; larger bodies move to blob files
+	MessagePreviewSize       int                 `yaml:"message_preview_size"`        // Bytes of a moved body kept inline as a truncated preview; 0 keeps none
+	DifferentialSave         bool                `yaml:"differential_save"`           // Save sessions, each session's messages, input and settings to files of their own, rewriting only those that changed
+	FileMode                 string              `yaml:"file_mode"`                   // Unix permissions of state, backup, blob and log files (e.g., "0600")
+	DirMode                  string              `yaml:"dir_mode"`                    // Unix permissions of the directories holding them (e.g., "0700")
+	Memory                   MemoryStorageConfig `yaml:"memory"`
+}
+
+// ParseFileMode parses FileMode; state files are never writable by group or others
+func (c StorageConfig) ParseFileMode() (os.FileMode, error) {
+	return parseStorageMode("file_mode", c.FileMode)
+}
+
+// ParseDirMode parses DirMode; state directories are never writable by group or others
+func (c StorageConfig) ParseDirMode() (os.FileMode, error) {
+	return parseStorageMode("dir_mode", c.DirMode)
+}
+
+func parseStorageMode(key, value string) (os.FileMode, error) {
+	mode, err := parseMode(key, value)
+	if err != nil {
+		return 0, err
+	}
+	if mode&0022 != 0 {
+		return 0, fmt.Errorf("invalid %s %q: group and others must not have write permission", key, value)
+	}
+	return mode, nil
+}
+
+// Storage backends
+const (
+	StorageBackendFile   = "file"
+	StorageBackendMemory = "memory"
+)
+
+// Ephemeral reports whether state is kept only in memory
+func (c StorageConfig) Ephemeral() bool {
+	return c.Backend == StorageBackendMemory
+}
+
+// MemoryStorageConfig slows down or breaks the memory backend, to try out
+// how panels cope with a struggling store
+type MemoryStorageConfig struct {
+	Latency     time.Duration `yaml:"latency"`      // Added to every save and load
+	FailureRate float64       `yaml:"failure_rate"` // Fraction of saves and loads that fail, 0 to 1
+}
+
+// AutomationConfig lists the Starlark scripts run against state events
+type AutomationConfig struct {
+	Scripts  []string `yaml:"scripts"`   // Script paths; "~/" expands to the home directory
+	MaxSteps uint64   `yaml:"max_steps"` // Execution steps one handler call may take; 0 uses the default
+}
+
+// ScriptPaths returns the script paths with "~/" expanded
+func (c AutomationConfig) ScriptPaths() ([]string, error) {
+	paths := make([]string, 0, len(c.Scripts))
+	for _, script := range c.Scripts {
+		if rest, ok := strings.CutPrefix(script, "~/"); ok {
+			homeDir, err := os.UserHomeDir()
+			if err != nil {
+				return nil, fmt.Errorf("resolve home dir for %s: %w", script, err)
+			}
+			script = filepath.Join(homeDir, rest)
+		}
+		paths = append(paths, script)
+	}
+	return paths, nil
+}
+
+// WebhooksConfig controls outbound event notifications
+type WebhooksConfig struct {
+	Timeout     time.Duration   `yaml:"timeout"`      // Per-attempt request timeout
+	MaxAttempts int             `yaml:"max_attempts"` // Attempts per notification, including the first
+	Endpoints   []WebhookConfig `yaml:"endpoints"`
+}
+
+// WebhookConfig describes one receiver. The signing key is read from the
+// environment variable named by SecretEnv so it stays out of the config file.
+type WebhookConfig struct {
+	Name      string   `yaml:"name"`
+	URL       string   `yaml:"url"`
+	Events    []string `yaml:"events"` // Empty delivers every event
+	SecretEnv string   `yaml:"secret_env"`
+}
+
+// BuildEndpoints creates the configured endpoints
+func (c WebhooksConfig) BuildEndpoints() ([]webhook.Endpoint, error) {
+	endpoints := make([]webhook.Endpoint, 0, len(c.Endpoints))
+	for i, wc := range c.Endpoints {
+		name := wc.Name
+		if name == "" {
+			name = fmt.Sprintf("webhook-%d", i)
+		}
+		parsed, err := url.Parse(wc.URL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return nil, fmt.Errorf("webhook %s: url must be an http or https URL, got %q", name, wc.URL)
+		}
+		for _, event := range wc.Events {
+			if !webhook.KnownEvent(event) {
+				return nil, fmt.Errorf("webhook %s: unknown event %q", name, event)
+			}
+		}
+		endpoint := webhook.Endpoint{Name: name, URL: wc.URL, Events: wc.Events}
+		if wc.SecretEnv != "" {
+			endpoint.Secret = os.Getenv(wc.SecretEnv)
+			if endpoint.Secret == "" {
+				return nil, fmt.Errorf("webhook %s: secret_env %s is not set", name, wc.SecretEnv)
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return endpoints, nil
+}
+
+// GitConfig controls polling of the workspace repository
+type GitConfig struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // Time between "git status" runs
+}
+
+// DiffsConfig controls the diff pane opened when a tool call edits files
+type DiffsConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	OpenPane bool   `yaml:"open_pane"` // Open the diff pane on new diffs; otherwise they are only kept in state
+	PaneSize string `yaml:"pane_size"` // Width of the pane, in columns or a percentage such as "40%"
+}
+
+// FileTreeConfig controls the workspace file browser
+type FileTreeConfig struct {
+	Roots      []string `yaml:"roots"`       // Directories the tree may show; relative paths start at the working directory
+	MaxEntries int      `yaml:"max_entries"` // Entries returned for one directory
+}
+
+// TerminalConfig controls commands run in terminal panes
+type TerminalConfig struct {
+	Enabled        bool   `yaml:"enabled"`
+	PaneSize       string `yaml:"pane_size"`        // Height of the run pane, in lines or a percentage such as "30%"
+	MaxOutputBytes int    `yaml:"max_output_bytes"` // Output kept in the transcript for one run; the start is dropped beyond it
+}
+
+// EditorConfig controls composing the input in an external editor
+type EditorConfig struct {
+	Command string `yaml:"command"` // Editor the file name is appended to; $VISUAL, $EDITOR or vi when empty
+	Popup   bool   `yaml:"popup"`   // Open a tmux popup; a pane below the input when false or unsupported
+	Size    string `yaml:"size"`    // Popup width and height, or pane height, in cells or a percentage
+}
+
+// LSPConfig controls the language servers asked for code context when a file
+// position is attached to a prompt
+type LSPConfig struct {
+	Enabled bool                `yaml:"enabled"`
+	Servers map[string][]string `yaml:"servers"` // File extension, such as ".go", to the server command
+	Timeout time.Duration       `yaml:"timeout"` // Limit on gathering context for one position, server start included
+}
+
+// ModelsConfig controls how prompts react to provider errors that may pass,
+// such as rate limits, timeouts and overloaded providers
+type ModelsConfig struct {
+	MaxRetries   int           `yaml:"max_retries"`   // Retries on each model before falling back
+	RetryBackoff time.Duration `yaml:"retry_backoff"` // Wait before the first retry on a model; doubles with each retry
+	Fallbacks    []string      `yaml:"fallbacks"`     // "provider/model", tried in order once retries run out
+}
+
+// AgentsConfig routes prompts to opencode agents by mention
+type AgentsConfig struct {
+	// Routes maps a mention, without its "@", to the agent a prompt starting
+	// with it is sent to, e.g. reviewer: review
+	Routes map[string]string `yaml:"routes"`
+}
+
+// ConnectivityConfig controls probing of the opencode server and panel links
+type ConnectivityConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Interval     time.Duration `yaml:"interval"`      // Time between probes
+	Timeout      time.Duration `yaml:"timeout"`       // Limit on one server probe
+	SlowAfter    time.Duration `yaml:"slow_after"`    // Slower server answers count as degraded
+	OfflineAfter int           `yaml:"offline_after"` // Consecutive failed probes before the server is offline
+}
+
+// TracingConfig controls export of spans for state updates to an OTLP collector
+type TracingConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Endpoint      string            `yaml:"endpoint"`       // OTLP/HTTP collector, e.g. http://localhost:4318
+	ServiceName   string            `yaml:"service_name"`   // Reported as the service.name resource attribute
+	Headers       map[string]string `yaml:"headers"`        // Added to every export request, e.g. for auth
+	Timeout       time.Duration     `yaml:"timeout"`        // Limit on one export request
+	FlushInterval time.Duration     `yaml:"flush_interval"` // Longest a finished span waits for export
+}
+
+// WatchdogConfig sets when updates and saves are reported as slow
+type WatchdogConfig struct {
+	SlowUpdate time.Duration `yaml:"slow_update"` // 0 disables the update check
+	SlowSave   time.Duration `yaml:"slow_save"`   // 0 disables the save check
+	DumpDir    string        `yaml:"dump_dir"`    // Goroutine dumps; defaults next to the state file
+}
+
+// CrashReportsConfig controls the bundles assembled when a panel crashes or
+// state is found corrupt
+type CrashReportsConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Dir         string        `yaml:"dir"`          // Defaults next to the state file
+	Keep        int           `yaml:"keep"`         // Newest bundles kept; older ones are removed
+	LogLines    int           `yaml:"log_lines"`    // Lines taken from the end of each log
+	Events      int           `yaml:"events"`       // Recent events included
+	MinInterval time.Duration `yaml:"min_interval"` // Shortest time between bundles for the same panel or file
+}
+
+// ConfirmationConfig lists the destructive operations panels must confirm.
+// Each maps an update type to how long its confirmation token stays valid;
+// operations not listed, or set to 0, apply without asking.
+type ConfirmationConfig struct {
+	Operations map[string]time.Duration `yaml:"operations"`
+}
+
+// DisplayConfig controls how panels and commands show times. Times are
+// stored and sent in UTC; these settings only affect what people read.
+type DisplayConfig struct {
+	Timezone       string `yaml:"timezone"`         // IANA zone such as "Europe/Berlin", "UTC", or "local" for the machine's zone
+	TimeFormat     string `yaml:"time_format"`      // Go layout for times of day
+	DateTimeFormat string `yaml:"date_time_format"` // Go layout for dates with times
+}
+
+// TemplateConfig is a session template: what new sessions created from it
+// start with
+type TemplateConfig struct {
+	Name         string   `yaml:"name"`         // Picked with "/template <name>"; no spaces
+	Title        string   `yaml:"title"`        // Title of new sessions; the server names them when empty
+	Description  string   `yaml:"description"`  // Shown in the picker
+	Instructions string   `yaml:"instructions"` // System instructions sent with every prompt of the session
+	Agent        string   `yaml:"agent"`        // Agent selected when a session is created
+	Model        string   `yaml:"model"`        // "provider/model" selected when a session is created
+	Tags         []string `yaml:"tags"`
+}
+
+// SessionTemplate returns the template as kept in state
+func (tc TemplateConfig) SessionTemplate() types.SessionTemplate {
+	return types.SessionTemplate{
+		Name:         strings.TrimSpace(tc.Name),
+		Title:        tc.Title,
+		Description:  tc.Description,
+		Instructions: strings.TrimSpace(tc.Instructions),
+		Agent:        tc.Agent,
+		Model:        tc.Model,
+		Tags:         tc.Tags,
+	}
+}
+
+// validPaneSize reports whether size is a tmux pane size: columns or a percentage
+func validPaneSize(size string) bool {
+	n, err := strconv.Atoi(strings.TrimSuffix(size, "%"))
+	return err == nil && n > 0 && (!strings.HasSuffix(size, "%") || n < 100)
+}
+
+// HTTPAPIConfig controls the inbound HTTP API
+type HTTPAPIConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Listen  string `yaml:"listen"` // host:port; keep it on loopback unless a proxy adds TLS
+	// TokenEnv names an environment variable holding the bearer token; when empty
+	// a random token is written next to the IPC socket
+	TokenEnv string `yaml:"token_env"`
+}
+
+// BackupDestinationConfig describes one off-site destination. Which fields apply
+// depends on Type: "local" uses Path, "rsync" uses Target and SSHCommand, "s3" uses
+// Bucket, Prefix, Region and Endpoint.
+type BackupDestinationConfig struct {
+	Name       string `yaml:"name"`
+	Type       string `yaml:"type"`
+	Path       string `yaml:"path"`
+	Target     string `yaml:"target"`      // [user@]host:/path
+	SSHCommand string `yaml:"ssh_command"` // Remote shell for rsync, default "ssh"
+	Bucket     string `yaml:"bucket"`
+	Prefix     string `yaml:"prefix"`
+	Region     string `yaml:"region"`
+	Endpoint   string `yaml:"endpoint"` // S3-compatible endpoint; empty means AWS
+}
+
+// BuildDestinations creates the configured destinations
+func (c BackupConfig) BuildDestinations() ([]persistence.BackupDestination, error) {
+	destinations := make([]persistence.BackupDestination, 0, len(c.Destinations))
+	for i, dc := range c.Destinations {
+		name := dc.Name
+		if name == "" {
+			name = fmt.Sprintf("%s-%d", dc.Type, i)
+		}
+
+		var dest persistence.BackupDestination
+		var err error
+		switch dc.Type {
+		case "local":
+			if dc.Path == "" {
+				return nil, fmt.Errorf("backup destination %s: path is required", name)
+			}
+			dest = persistence.NewLocalDestination(name, dc.Path)
+		case "rsync":
+			dest, err = persistence.NewRsyncDestination(name, dc.Target, dc.SSHCommand)
+		case "s3":
+			dest, err = persistence.NewS3Destination(name, dc.Bucket, dc.Prefix, dc.Region, dc.Endpoint)
+		default:
+			return nil, fmt.Errorf("backup destination %s: invalid type %q (must be 'local', 'rsync', or 's3')", name, dc.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("backup destination %s: %w", name, err)
+		}
+		destinations = append(destinations, dest)
+	}
+	return destinations, nil
+}
+
 // DefaultConfig returns the default configuration
 func DefaultConfig() *Config {
 	return &Config{
@@ -45,17 +436,112 @@ func DefaultConfig() *Config {
 			HealthCheckInterval: 2 * time.Second,
 			RestartDelay:        1 * time.Second,
 			MaxRestartDelay:     30 * time.Second,
+			PanelLogMaxSize:     1 << 20,
+			PanelLogBackups:     3,
 		},
 		IPC: IPCConfig{
 			SocketDir:  "/tmp/opencode-tmux",
 			SocketMode: "0600",
+			PeerPolicy: "owner",
 			Timeout:    10 * time.Second,
+
+			EventHistorySize:  1000,
+			EventOverflowSize: 16 * 1024 * 1024,
 		},
 		Permissions: PermissionsConfig{
 			Shutdown:     "owner",
 			ReloadLayout: "owner",
 			Status:       "any",
 		},
+		Security: SecurityConfig{
+			SecretPolicy: "off",
+		},
+		Backup: BackupConfig{
+			Interval: 6 * time.Hour,
+			Keep:     28,
+		},
+		Storage: StorageConfig{
+			Backend:                  StorageBackendFile,
+			MaxStateSize:             256 * 1024 * 1024,
+			RetainMessagesPerSession: 5000,
+			MaxMessageSize:           persistence.DefaultBlobThreshold,
+			MessagePreviewSize:       persistence.DefaultMessagePreview,
+			DifferentialSave:         true,
+			FileMode:                 "0600",
+			DirMode:                  "0700",
+		},
+		Git: GitConfig{
+			Enabled:  true,
+			Interval: 5 * time.Second,
+		},
+		Diffs: DiffsConfig{
+			Enabled:  true,
+			OpenPane: true,
+			PaneSize: "40%",
+		},
+		FileTree: FileTreeConfig{
+			Roots:      []string{"."},
+			MaxEntries: 1000,
+		},
+		Terminal: TerminalConfig{
+			Enabled:        true,
+			PaneSize:       "30%",
+			MaxOutputBytes: 64 * 1024,
+		},
+		Editor: EditorConfig{
+			Popup: true,
+			Size:  "80%",
+		},
+		LSP: LSPConfig{
+			Servers: map[string][]string{".go": {"gopls"}},
+			Timeout: 10 * time.Second,
+		},
+		Models: ModelsConfig{
+			MaxRetries:   2,
+			RetryBackoff: 2 * time.Second,
+		},
+		Connectivity: ConnectivityConfig{
+			Enabled:      true,
+			Interval:     5 * time.Second,
+			Timeout:      3 * time.Second,
+			SlowAfter:    time.Second,
+			OfflineAfter: 3,
+		},
+		Watchdog: WatchdogConfig{
+			SlowUpdate: 250 * time.Millisecond,
+			SlowSave:   2 * time.Second,
+		},
+		CrashReports: CrashReportsConfig{
+			Enabled:     true,
+			Keep:        10,
+			LogLines:    200,
+			Events:      200,
+			MinInterval: 10 * time.Minute,
+		},
+		Confirmation: ConfirmationConfig{
+			Operations: map[string]time.Duration{
+				string(types.SessionDeleted):  30 * time.Second,
+				string(types.MessagesCleared): 30 * time.Second,
+			},
+		},
+		Display: DisplayConfig{
+			Timezone:       "local",
+			TimeFormat:     timefmt.DefaultClockFormat,
+			DateTimeFormat: timefmt.DefaultDateTimeFormat,
+		},
+		Tracing: TracingConfig{
+			Endpoint:      "http://localhost:4318",
+			ServiceName:   "tmux_coder",
+			Timeout:       10 * time.Second,
+			FlushInterval: 5 * time.Second,
+		},
+		HTTPAPI: HTTPAPIConfig{
+			Listen: "127.0.0.1:7840",
+		},
+		Webhooks: WebhooksConfig{
+			Timeout:     10 * time.Second,
+			MaxAttempts: 5,
+		},
 	}
 }
 
@@ -100,9 +586,22 @@ func (c *Config) Validate() error {
 	if c.IPC.Timeout < 0 {
 		return fmt.Errorf("ipc.timeout cannot be negative, got %v", c.IPC.Timeout)
 	}
+	if _, err := c.IPC.ParseSocketMode(); err != nil {
+		return fmt.Errorf("ipc.%w", err)
+	}
+	if c.IPC.EventHistorySize < 0 {
+		return fmt.Errorf("ipc.event_history_size cannot be negative, got %d", c.IPC.EventHistorySize)
+	}
+	if c.IPC.EventOverflowSize < 0 {
+		return fmt.Errorf("ipc.event_overflow_size cannot be negative, got %d", c.IPC.EventOverflowSize)
+	}
 
 	// Validate permissions
 	validPerms := map[string]bool{"owner": true, "group": true, "any": true}
+	if !validPerms[c.IPC.PeerPolicy] {
+		return fmt.Errorf("invalid ipc.peer_policy: %s (must be 'owner', 'group', or 'any')",
+			c.IPC.PeerPolicy)
+	}
 	if !validPerms[c.Permissions.Shutdown] {
 		return fmt.Errorf("invalid shutdown permission: %s (must be 'owner', 'group', or 'any')",
 			c.Permissions.Shutdown)
@@ -116,6 +615,234 @@ func (c *Config) Validate() error {
 			c.Permissions.Status)
 	}
 
+	// Validate security config
+	validPolicies := map[string]bool{"off": true, "flag": true, "block": true}
+	if !validPolicies[c.Security.SecretPolicy] {
+		return fmt.Errorf("invalid secret_policy: %s (must be 'off', 'flag', or 'block')",
+			c.Security.SecretPolicy)
+	}
+
+	// Validate backup config
+	if c.Backup.Interval != 0 && c.Backup.Interval < time.Minute {
+		return fmt.Errorf("backup.interval must be 0 or >= 1m, got %v", c.Backup.Interval)
+	}
+	if c.Backup.Keep < 0 {
+		return fmt.Errorf("backup.keep cannot be negative, got %d", c.Backup.Keep)
+	}
+	if _, err := c.Backup.BuildDestinations(); err != nil {
+		return err
+	}
+
+	// Validate storage config
+	if c.Storage.Backend != StorageBackendFile && c.Storage.Backend != StorageBackendMemory {
+		return fmt.Errorf("storage.backend must be %q or %q, got %q", StorageBackendFile, StorageBackendMemory, c.Storage.Backend)
+	}
+	if c.Storage.Memory.Latency < 0 {
+		return fmt.Errorf("storage.memory.latency cannot be negative, got %v", c.Storage.Memory.Latency)
+	}
+	if c.Storage.Memory.FailureRate < 0 || c.Storage.Memory.FailureRate > 1 {
+		return fmt.Errorf("storage.memory.failure_rate must be between 0 and 1, got %v", c.Storage.Memory.FailureRate)
+	}
+	if _, err := c.Storage.ParseFileMode(); err != nil {
+		return fmt.Errorf("storage.%w", err)
+	}
+	if _, err := c.Storage.ParseDirMode(); err != nil {
+		return fmt.Errorf("storage.%w", err)
+	}
+	if c.Storage.MaxStateSize < 0 {
+		return fmt.Errorf("storage.max_state_size cannot be negative, got %d", c.Storage.MaxStateSize)
+	}
+	if c.Storage.RetainMessagesPerSession < 0 {
+		return fmt.Errorf("storage.retain_messages_per_session cannot be negative, got %d", c.Storage.RetainMessagesPerSession)
+	}
+	if c.Storage.MaxMessageSize < 1024 {
+		return fmt.Errorf("storage.max_message_size must be >= 1024, got %d", c.Storage.MaxMessageSize)
+	}
+	if c.Storage.MessagePreviewSize < 0 || c.Storage.MessagePreviewSize >= c.Storage.MaxMessageSize {
+		return fmt.Errorf("storage.message_preview_size must be between 0 and max_message_size (%d), got %d",
+			c.Storage.MaxMessageSize, c.Storage.MessagePreviewSize)
+	}
+
+	// Validate automation config
+	for i, script := range c.Automation.Scripts {
+		if strings.TrimSpace(script) == "" {
+			return fmt.Errorf("automation.scripts[%d] cannot be empty", i)
+		}
+	}
+
+	// Validate webhooks config
+	if c.Webhooks.Timeout < 0 {
+		return fmt.Errorf("webhooks.timeout cannot be negative, got %v", c.Webhooks.Timeout)
+	}
+	if c.Webhooks.MaxAttempts < 0 {
+		return fmt.Errorf("webhooks.max_attempts cannot be negative, got %d", c.Webhooks.MaxAttempts)
+	}
+	if _, err := c.Webhooks.BuildEndpoints(); err != nil {
+		return err
+	}
+
+	// Validate git config
+	if c.Git.Enabled && c.Git.Interval < time.Second {
+		return fmt.Errorf("git.interval must be >= 1s, got %v", c.Git.Interval)
+	}
+
+	// Validate diffs config
+	if c.Diffs.Enabled && c.Diffs.OpenPane && !validPaneSize(c.Diffs.PaneSize) {
+		return fmt.Errorf("diffs.pane_size must be a column count or a percentage, got %q", c.Diffs.PaneSize)
+	}
+
+	// Validate file tree config
+	if c.FileTree.MaxEntries < 0 {
+		return fmt.Errorf("file_tree.max_entries cannot be negative, got %d", c.FileTree.MaxEntries)
+	}
+
+	// Validate terminal config
+	if c.Terminal.Enabled {
+		if !validPaneSize(c.Terminal.PaneSize) {
+			return fmt.Errorf("terminal.pane_size must be a line count or a percentage, got %q", c.Terminal.PaneSize)
+		}
+		if c.Terminal.MaxOutputBytes < 1024 {
+			return fmt.Errorf("terminal.max_output_bytes must be >= 1024, got %d", c.Terminal.MaxOutputBytes)
+		}
+	}
+
+	// Validate editor config
+	if !validPaneSize(c.Editor.Size) {
+		return fmt.Errorf("editor.size must be a cell count or a percentage, got %q", c.Editor.Size)
+	}
+
+	// Validate LSP config
+	if c.LSP.Enabled {
+		if len(c.LSP.Servers) == 0 {
+			return fmt.Errorf("lsp.servers must name at least one server when lsp is enabled")
+		}
+		for ext, command := range c.LSP.Servers {
+			if !strings.HasPrefix(ext, ".") {
+				return fmt.Errorf("lsp.servers key %q must be a file extension starting with '.'", ext)
+			}
+			if len(command) == 0 || command[0] == "" {
+				return fmt.Errorf("lsp.servers[%s] must give a command", ext)
+			}
+		}
+		if c.LSP.Timeout < time.Second {
+			return fmt.Errorf("lsp.timeout must be >= 1s, got %v", c.LSP.Timeout)
+		}
+	}
+
+	// Validate models config
+	if c.Models.MaxRetries < 0 {
+		return fmt.Errorf("models.max_retries must be >= 0, got %d", c.Models.MaxRetries)
+	}
+	if c.Models.RetryBackoff < 0 {
+		return fmt.Errorf("models.retry_backoff must be >= 0, got %v", c.Models.RetryBackoff)
+	}
+	for _, fallback := range c.Models.Fallbacks {
+		if _, err := types.ParseModelRef(fallback); err != nil {
+			return fmt.Errorf("invalid models.fallbacks entry: %w", err)
+		}
+	}
+
+	// Validate agent routes
+	for name, agent := range c.Agents.Routes {
+		if !agentroute.ValidMention(name) {
+			return fmt.Errorf("agents.routes: %q is not a valid mention; use lower case letters, digits, - and _", name)
+		}
+		if agent == "" {
+			return fmt.Errorf("agents.routes.%s: agent is required", name)
+		}
+	}
+
+	// Validate connectivity config
+	if c.Connectivity.Enabled {
+		if c.Connectivity.Interval < time.Second {
+			return fmt.Errorf("connectivity.interval must be >= 1s, got %v", c.Connectivity.Interval)
+		}
+		if c.Connectivity.Timeout <= 0 || c.Connectivity.Timeout > c.Connectivity.Interval {
+			return fmt.Errorf("connectivity.timeout must be > 0 and <= connectivity.interval, got %v", c.Connectivity.Timeout)
+		}
+		if c.Connectivity.SlowAfter <= 0 {
+			return fmt.Errorf("connectivity.slow_after must be > 0, got %v", c.Connectivity.SlowAfter)
+		}
+		if c.Connectivity.OfflineAfter < 1 {
+			return fmt.Errorf("connectivity.offline_after must be >= 1, got %d", c.Connectivity.OfflineAfter)
+		}
+	}
+
+	// Validate tracing config
+	if c.Tracing.Enabled {
+		if u, err := url.Parse(c.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("tracing.endpoint must be an http(s) URL, got %q", c.Tracing.Endpoint)
+		}
+		if c.Tracing.ServiceName == "" {
+			return fmt.Errorf("tracing.service_name is required")
+		}
+		if c.Tracing.Timeout <= 0 {
+			return fmt.Errorf("tracing.timeout must be > 0, got %v", c.Tracing.Timeout)
+		}
+		if c.Tracing.FlushInterval < 100*time.Millisecond {
+			return fmt.Errorf("tracing.flush_interval must be >= 100ms, got %v", c.Tracing.FlushInterval)
+		}
+	}
+
+	// Validate watchdog config
+	if c.Watchdog.SlowUpdate < 0 {
+		return fmt.Errorf("watchdog.slow_update cannot be negative, got %v", c.Watchdog.SlowUpdate)
+	}
+	if c.Watchdog.SlowSave < 0 {
+		return fmt.Errorf("watchdog.slow_save cannot be negative, got %v", c.Watchdog.SlowSave)
+	}
+
+	// Validate crash report config
+	if c.CrashReports.Enabled {
+		if c.CrashReports.Keep < 1 {
+			return fmt.Errorf("crash_reports.keep must be >= 1, got %d", c.CrashReports.Keep)
+		}
+		if c.CrashReports.LogLines < 0 || c.CrashReports.Events < 0 {
+			return fmt.Errorf("crash_reports.log_lines and crash_reports.events cannot be negative")
+		}
+		if c.CrashReports.MinInterval < 0 {
+			return fmt.Errorf("crash_reports.min_interval cannot be negative, got %v", c.CrashReports.MinInterval)
+		}
+	}
+
+	// Validate confirmation config
+	for operation, timeout := range c.Confirmation.Operations {
+		if !types.ConfirmableUpdates[types.UpdateType(operation)] {
+			return fmt.Errorf("confirmation.operations: %q cannot require confirmation", operation)
+		}
+		if timeout < 0 {
+			return fmt.Errorf("confirmation.operations.%s cannot be negative, got %v", operation, timeout)
+		}
+	}
+
+	// Validate display config
+	if _, err := timefmt.LoadLocation(c.Display.Timezone); err != nil {
+		return fmt.Errorf("display.timezone: %w", err)
+	}
+
+	// Validate session templates
+	templateNames := make(map[string]bool, len(c.Templates))
+	for _, tc := range c.Templates {
+		template := tc.SessionTemplate()
+		if err := template.Validate(); err != nil {
+			return fmt.Errorf("invalid templates entry: %w", err)
+		}
+		if templateNames[template.Name] {
+			return fmt.Errorf("templates: %s is defined twice", template.Name)
+		}
+		templateNames[template.Name] = true
+	}
+
+	// Validate HTTP API config
+	if c.HTTPAPI.Enabled {
+		if _, _, err := net.SplitHostPort(c.HTTPAPI.Listen); err != nil {
+			return fmt.Errorf("invalid http_api.listen %q: %w", c.HTTPAPI.Listen, err)
+		}
+		if c.HTTPAPI.TokenEnv != "" && os.Getenv(c.HTTPAPI.TokenEnv) == "" {
+			return fmt.Errorf("http_api.token_env %s is not set", c.HTTPAPI.TokenEnv)
+		}
+	}
+
 	return nil
 }
 
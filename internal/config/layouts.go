@@ -0,0 +1,153 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// resolveLayout returns l merged over the layouts it extends and includes:
+// the base first, then each include in order, then l itself. Relative paths
+// are taken from dir; chain holds the files being loaded, to report cycles.
+func resolveLayout(l *Layout, dir string, chain []string) (*Layout, error) {
+	if l.Extends == "" && len(l.Include) == 0 {
+		return l, nil
+	}
+
+	refs := l.Include
+	if l.Extends != "" {
+		refs = append([]string{l.Extends}, refs...)
+	}
+	merged := &Layout{}
+	for _, ref := range refs {
+		base, err := loadLayoutFile(layoutPath(ref, dir), chain)
+		if err != nil {
+			return nil, err
+		}
+		merged.merge(base)
+	}
+
+	own := *l
+	own.Extends, own.Include = "", nil
+	merged.merge(&own)
+	return merged, nil
+}
+
+// loadLayoutFile loads a layout file named by extends or include. Such files
+// hold only layout settings, so unknown keys are rejected rather than ignored.
+func loadLayoutFile(path string, chain []string) (*Layout, error) {
+	for i, loading := range chain {
+		if loading == path {
+			return nil, fmt.Errorf("layout include cycle: %s", strings.Join(append(chain[i:len(chain):len(chain)], path), " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read layout: %w", err)
+	}
+	var layout Layout
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&layout); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("parse layout %s: %w", path, err)
+	}
+	return resolveLayout(&layout, filepath.Dir(path), append(chain[:len(chain):len(chain)], path))
+}
+
+// layoutPath resolves a path named by extends or include
+func layoutPath(ref, dir string) string {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			ref = filepath.Join(homeDir, ref[2:])
+		}
+	}
+	if !filepath.IsAbs(ref) {
+		ref = filepath.Join(dir, ref)
+	}
+	return filepath.Clean(ref)
+}
+
+// merge lays other over l. Its version and mode replace l's when set. Its
+// panels override the settings they give of l's panel with the same ID and
+// are added otherwise; its splits do the same for l's split of the same two
+// panels.
+func (l *Layout) merge(other *Layout) {
+	if other.Version != "" {
+		l.Version = other.Version
+	}
+	if other.Mode != "" {
+		l.Mode = other.Mode
+	}
+
+	for _, panel := range other.Panels {
+		i := l.panelIndex(panel.ID)
+		if i < 0 {
+			l.Panels = append(l.Panels, panel)
+			continue
+		}
+		base := &l.Panels[i]
+		for _, field := range []struct{ base, over *string }{
+			{&base.Module, &panel.Module},
+			{&base.Type, &panel.Type},
+			{&base.Width, &panel.Width},
+			{&base.Height, &panel.Height},
+			{&base.Command, &panel.Command},
+			{&base.Restart, &panel.Restart},
+			{&base.HealthCheck, &panel.HealthCheck},
+		} {
+			if *field.over != "" {
+				*field.base = *field.over
+			}
+		}
+		if panel.StartupTimeout != 0 {
+			base.StartupTimeout = panel.StartupTimeout
+		}
+	}
+
+	for _, split := range other.Splits {
+		i := l.splitIndex(split.Panels)
+		if i < 0 {
+			split.Panels = append([]string(nil), split.Panels...)
+			l.Splits = append(l.Splits, split)
+			continue
+		}
+		base := &l.Splits[i]
+		for _, field := range []struct{ base, over *string }{
+			{&base.Type, &split.Type},
+			{&base.Target, &split.Target},
+			{&base.Ratio, &split.Ratio},
+		} {
+			if *field.over != "" {
+				*field.base = *field.over
+			}
+		}
+	}
+}
+
+// panelIndex returns the index of the panel with the given ID, or -1
+func (l *Layout) panelIndex(id string) int {
+	for i, panel := range l.Panels {
+		if panel.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// splitIndex returns the index of the split dividing the same panels, or -1
+func (l *Layout) splitIndex(panels []string) int {
+	for i, split := range l.Splits {
+		if len(split.Panels) == len(panels) && strings.Join(split.Panels, "\x00") == strings.Join(panels, "\x00") {
+			return i
+		}
+	}
+	return -1
+}
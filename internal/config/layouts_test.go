@@ -0,0 +1,164 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const baseLayoutYAML = `mode: raw
+panels:
+  - id: sessions
+    type: sessions
+    width: 20%
+  - id: messages
+    type: messages
+  - id: input
+    type: input
+    height: 20%
+splits:
+  - type: horizontal
+    target: root
+    panels: [sessions, messages]
+  - type: vertical
+    target: messages
+    panels: [messages, input]
+    ratio: "4:1"
+`
+
+// writeLayouts writes files into one directory and returns it
+func writeLayouts(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestLoadLayoutExtendsAndIncludes(t *testing.T) {
+	dir := writeLayouts(t, map[string]string{
+		"shared/base.yaml": baseLayoutYAML,
+		"shared/diff.yaml": `panels:
+  - id: diff
+    type: diff
+splits:
+  - type: horizontal
+    target: messages
+    panels: [messages, diff]
+`,
+		"project/tmux.yaml": `session:
+  name: project
+extends: ../shared/base.yaml
+include: [../shared/diff.yaml]
+panels:
+  - id: sessions
+    width: 30%
+splits:
+  - panels: [messages, input]
+    ratio: "3:1"
+`,
+	})
+
+	layout, err := LoadLayout(filepath.Join(dir, "project", "tmux.yaml"))
+	if err != nil {
+		t.Fatalf("LoadLayout() error = %v", err)
+	}
+	var ids []string
+	for _, panel := range layout.Panels {
+		ids = append(ids, panel.ID)
+	}
+	if got := strings.Join(ids, ","); got != "sessions,messages,input,diff" {
+		t.Errorf("panels = %s", got)
+	}
+	if sessions := layout.Panels[0]; sessions.Width != "30%" || sessions.Type != "sessions" {
+		t.Errorf("overridden panel = %+v, want the base with the project's width", sessions)
+	}
+	if len(layout.Splits) != 3 || layout.Splits[1].Ratio != "3:1" || layout.Splits[1].Target != "messages" {
+		t.Errorf("splits = %+v", layout.Splits)
+	}
+	if layout.Extends != "" || layout.Include != nil {
+		t.Errorf("resolved layout still names its files: %q %v", layout.Extends, layout.Include)
+	}
+}
+
+func TestLoadLayoutRejectsBadIncludes(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"tmux.yaml": "extends: a.yaml\n",
+				"a.yaml":    "extends: b.yaml\n",
+				"b.yaml":    "include: [a.yaml]\n",
+			},
+			want: "cycle",
+		},
+		{
+			name:  "missing file",
+			files: map[string]string{"tmux.yaml": "extends: missing.yaml\n"},
+			want:  "missing.yaml",
+		},
+		{
+			name: "unknown key",
+			files: map[string]string{
+				"tmux.yaml": "extends: base.yaml\n",
+				"base.yaml": baseLayoutYAML + "pannels: []\n",
+			},
+			want: "pannels",
+		},
+		{
+			name: "invalid result",
+			files: map[string]string{
+				"tmux.yaml": "extends: base.yaml\npanels:\n  - id: orphan\n    type: diff\n",
+				"base.yaml": baseLayoutYAML,
+			},
+			want: "orphan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeLayouts(t, tt.files)
+			_, err := LoadLayout(filepath.Join(dir, "tmux.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadLayout() error = %v, want one mentioning %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestProfileLayoutExtends(t *testing.T) {
+	dir := writeLayouts(t, map[string]string{
+		"base.yaml": baseLayoutYAML,
+		"tmux.yaml": `profiles:
+  focus:
+    keybindings:
+      M-1: messages
+    layout:
+      extends: base.yaml
+      panels:
+        - id: input
+          height: 10%
+`,
+	})
+
+	profiles, err := LoadProfiles(filepath.Join(dir, "tmux.yaml"))
+	if err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+	layout := profiles["focus"].Layout
+	if len(layout.Panels) != 3 || layout.Panels[2].Height != "10%" {
+		t.Errorf("profile layout panels = %+v", layout.Panels)
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"fmt"
 	"io/fs"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/yaml.v3"
 )
@@ -17,32 +19,58 @@ type SessionConfig struct {
 	Session Session `yaml:"session"`
 }
 
-// Layout describes the tmux panel layout.
+// Layout describes the tmux panel layout. A layout may extend a base layout
+// file and include others, overriding what they set; see resolveLayout.
 type Layout struct {
-	Version string  `yaml:"version"`
-	Mode    string  `yaml:"mode"`
-	Panels  []Panel `yaml:"panels"`
-	Splits  []Split `yaml:"splits"`
+	Version string   `yaml:"version"`
+	Extends string   `yaml:"extends,omitempty"` // Base layout file, relative to this file
+	Include []string `yaml:"include,omitempty"` // Layout files merged over the base, in order
+	Mode    string   `yaml:"mode"`
+	Panels  []Panel  `yaml:"panels"`
+	Splits  []Split  `yaml:"splits"`
 }
 
 type Session struct {
-	Name string `yaml:"name"`
+	// Name may use {dir} (the project directory's name), {branch} (its git
+	// branch) and {n} (a counter), so each project gets a session of its own
+	Name  string `yaml:"name"`
+	Theme string `yaml:"theme,omitempty"` // Theme of a new session's state
+	Model string `yaml:"model,omitempty"` // Model of a new session's state, "provider/model"
+	// Host is the existing tmux session to add the panels to as a new window:
+	// a session name, or "auto" for the one opencode-tmux is started from.
+	// Empty gives the panels a tmux session of their own.
+	Host       string `yaml:"host,omitempty"`
+	WindowName string `yaml:"window_name,omitempty"` // Name of the window in the host session; the session name when empty
+	// OnCollision is what starting does when another project's session holds
+	// the name: "suffix" (default) takes the next free name, "attach"
+	// attaches to that session and "prompt" asks.
+	OnCollision string `yaml:"on_collision,omitempty"`
+}
+
+// ModelParts splits Model into its provider and model
+func (s Session) ModelParts() (provider, model string) {
+	return splitModel(s.Model)
 }
 
 type Panel struct {
 	ID      string `yaml:"id"`
-	Module  string `yaml:"module"`
+	Module  string `yaml:"module,omitempty"`
 	Type    string `yaml:"type"`
-	Width   string `yaml:"width"`
-	Height  string `yaml:"height"`
-	Command string `yaml:"command"`
+	Width   string `yaml:"width,omitempty"`
+	Height  string `yaml:"height,omitempty"`
+	Command string `yaml:"command,omitempty"`
+
+	// How the pane supervisor looks after the panel's process
+	Restart        string        `yaml:"restart,omitempty"`         // always (default), on-failure or never
+	StartupTimeout time.Duration `yaml:"startup_timeout,omitempty"` // Time to come up before the health check runs; 3s when unset
+	HealthCheck    string        `yaml:"health_check,omitempty"`    // Shell command that fails while the panel is unhealthy
 }
 
 type Split struct {
 	Type   string   `yaml:"type"`
 	Target string   `yaml:"target"`
 	Panels []string `yaml:"panels"`
-	Ratio  string   `yaml:"ratio"`
+	Ratio  string   `yaml:"ratio,omitempty"`
 }
 
 // DefaultSession returns the built-in session configuration.
@@ -85,31 +113,64 @@ func LoadSession(path string) (*SessionConfig, error) {
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parse tmux session config: %w", err)
 	}
+	if cfg.Session.Model != "" {
+		if provider, model := cfg.Session.ModelParts(); provider == "" || model == "" {
+			return nil, fmt.Errorf("session model %q must be provider/model", cfg.Session.Model)
+		}
+	}
+	switch strings.ToLower(strings.TrimSpace(cfg.Session.OnCollision)) {
+	case "", "suffix", "attach", "prompt":
+	default:
+		return nil, fmt.Errorf("session on_collision %q must be suffix, attach or prompt", cfg.Session.OnCollision)
+	}
 
 	cfg.ensureDefaults()
 	return cfg, nil
 }
 
-// LoadLayout loads the layout configuration from the provided path.
+// LoadLayout loads the layout configuration from the provided path. A layout
+// built from other files must be valid once they are merged.
 func LoadLayout(path string) (*Layout, error) {
-	cfg := DefaultLayout()
-
 	data, err := readConfigFile(path)
 	if err != nil {
 		return nil, err
 	}
 	if data == nil {
-		return cfg, nil
+		return DefaultLayout(), nil
 	}
 
+	// Decoded over nothing, so the defaults do not mix with a base layout
+	cfg := &Layout{}
 	if err := yaml.Unmarshal(data, cfg); err != nil {
 		return nil, fmt.Errorf("parse tmux layout config: %w", err)
 	}
+	if cfg.Extends != "" || len(cfg.Include) > 0 {
+		if cfg, err = resolveConfigLayout(cfg, path); err != nil {
+			return nil, err
+		}
+	}
 
 	cfg.ensureDefaults()
 	return cfg, nil
 }
 
+// resolveConfigLayout merges a layout given in the config file at path over
+// the files it extends and includes, and validates the result
+func resolveConfigLayout(layout *Layout, path string) (*Layout, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	resolved, err := resolveLayout(layout, filepath.Dir(path), []string{path})
+	if err != nil {
+		return nil, err
+	}
+	resolved.ensureDefaults()
+	if err := resolved.Validate(); err != nil {
+		return nil, fmt.Errorf("layout of %s: %w", path, err)
+	}
+	return resolved, nil
+}
+
 func (c *SessionConfig) ensureDefaults() {
 	if c.Version == "" {
 		c.Version = "1.0"
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProfileEnv names the profile to use when --profile is not given
+const ProfileEnv = "OPENCODE_PROFILE"
+
+// Profile is a named set of settings applied over the rest of the config
+// file, such as "work", "home" or "demo". Settings a profile leaves empty keep
+// their usual values.
+type Profile struct {
+	Layout      *Layout           `yaml:"layout"`      // Replaces the file's layout
+	Theme       string            `yaml:"theme"`       // Theme set when the profile is applied
+	Model       string            `yaml:"model"`       // Default model, "provider/model"
+	Keybindings map[string]string `yaml:"keybindings"` // tmux key to the layout panel it focuses, e.g. M-1: sessions
+	StateDir    string            `yaml:"state_dir"`   // Where the session's state is kept; only read at startup
+}
+
+// profilesFile is the part of the config file holding profiles
+type profilesFile struct {
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+// LoadProfiles loads the profiles defined in the config file at path. A
+// missing file defines none.
+func LoadProfiles(path string) (map[string]Profile, error) {
+	data, err := readConfigFile(path)
+	if err != nil || data == nil {
+		return nil, err
+	}
+
+	var file profilesFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse profiles: %w", err)
+	}
+	for name, profile := range file.Profiles {
+		if profile.Layout != nil && (profile.Layout.Extends != "" || len(profile.Layout.Include) > 0) {
+			if profile.Layout, err = resolveConfigLayout(profile.Layout, path); err != nil {
+				return nil, fmt.Errorf("profile %s: %w", name, err)
+			}
+		}
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("profile %s: %w", name, err)
+		}
+		if profile.Layout != nil {
+			profile.Layout.ensureDefaults()
+		}
+		file.Profiles[name] = profile
+	}
+	return file.Profiles, nil
+}
+
+// ProfileNames returns the names of profiles in order
+func ProfileNames(profiles map[string]Profile) []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectProfile returns the profile called name, or the one named by
+// $OPENCODE_PROFILE when name is empty. With neither set no profile is
+// selected and the name returned is empty.
+func SelectProfile(profiles map[string]Profile, name string) (string, Profile, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = strings.TrimSpace(os.Getenv(ProfileEnv))
+	}
+	if name == "" {
+		return "", Profile{}, nil
+	}
+	profile, ok := profiles[name]
+	if !ok {
+		if len(profiles) == 0 {
+			return "", Profile{}, fmt.Errorf("unknown profile %q: the config file defines no profiles", name)
+		}
+		return "", Profile{}, fmt.Errorf("unknown profile %q (have %s)", name, strings.Join(ProfileNames(profiles), ", "))
+	}
+	return name, profile, nil
+}
+
+// Validate checks the settings a profile gives
+func (p Profile) Validate() error {
+	if p.Model != "" {
+		if provider, model := p.ModelParts(); provider == "" || model == "" {
+			return fmt.Errorf("model %q must be provider/model", p.Model)
+		}
+	}
+	for key, panel := range p.Keybindings {
+		if strings.TrimSpace(key) == "" || strings.TrimSpace(panel) == "" {
+			return fmt.Errorf("keybinding %q: %q needs both a key and a panel", key, panel)
+		}
+	}
+	if p.Layout != nil && len(p.Layout.Panels) > 0 {
+		for _, panel := range p.Keybindings {
+			if !p.Layout.hasPanel(panel) {
+				return fmt.Errorf("keybinding to %q: the profile's layout has no such panel", panel)
+			}
+		}
+	}
+	return nil
+}
+
+// ModelParts splits Model into its provider and model
+func (p Profile) ModelParts() (provider, model string) {
+	return splitModel(p.Model)
+}
+
+// splitModel splits a "provider/model" reference
+func splitModel(ref string) (provider, model string) {
+	provider, model, _ = strings.Cut(ref, "/")
+	return strings.TrimSpace(provider), strings.TrimSpace(model)
+}
+
+// StatePath returns where a session's state file goes under the profile's
+// state directory, or "" when the profile does not set one
+func (p Profile) StatePath(sessionName string) string {
+	dir := strings.TrimSpace(p.StateDir)
+	if dir == "" {
+		return ""
+	}
+	if strings.HasPrefix(dir, "~/") {
+		if homeDir, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(homeDir, dir[2:])
+		}
+	}
+	return filepath.Join(dir, sessionName+".json")
+}
+
+// hasPanel reports whether the layout has a panel with the given ID
+func (l *Layout) hasPanel(id string) bool {
+	for _, panel := range l.Panels {
+		if panel.ID == id {
+			return true
+		}
+	}
+	return false
+}
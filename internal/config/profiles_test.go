@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const profilesYAML = `
+profiles:
+  work:
+    theme: tokyonight
+    model: anthropic/claude-sonnet
+    keybindings:
+      M-1: sessions
+    state_dir: /tmp/work-states
+  demo:
+    layout:
+      mode: raw
+      panels:
+        - id: messages
+          type: messages
+        - id: input
+          type: input
+      splits:
+        - type: vertical
+          target: root
+          panels: [messages, input]
+    keybindings:
+      M-1: input
+`
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "tmux.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadProfiles(t *testing.T) {
+	profiles, err := LoadProfiles(writeConfig(t, profilesYAML))
+	if err != nil {
+		t.Fatalf("LoadProfiles() error = %v", err)
+	}
+	if names := strings.Join(ProfileNames(profiles), ","); names != "demo,work" {
+		t.Errorf("ProfileNames() = %s, want demo,work", names)
+	}
+	if provider, model := profiles["work"].ModelParts(); provider != "anthropic" || model != "claude-sonnet" {
+		t.Errorf("ModelParts() = %s, %s", provider, model)
+	}
+	if got := profiles["work"].StatePath("dev"); got != "/tmp/work-states/dev.json" {
+		t.Errorf("StatePath() = %s", got)
+	}
+	if layout := profiles["demo"].Layout; layout == nil || len(layout.Panels) != 2 {
+		t.Errorf("demo layout = %+v", layout)
+	}
+
+	missing, err := LoadProfiles(filepath.Join(t.TempDir(), "none.yaml"))
+	if err != nil || len(missing) != 0 {
+		t.Errorf("LoadProfiles(missing) = %v, %v; want none", missing, err)
+	}
+}
+
+func TestLoadProfilesRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		profile string
+		want    string
+	}{
+		{"model without provider", "model: claude", "must be provider/model"},
+		{"keybinding without panel", "keybindings: {M-1: ''}", "needs both a key and a panel"},
+		{"keybinding to missing panel", "keybindings: {M-1: sessions}\n    layout: {panels: [{id: input, type: input}]}", "no such panel"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfig(t, "profiles:\n  bad:\n    "+tt.profile+"\n")
+			_, err := LoadProfiles(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadProfiles() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	profiles := map[string]Profile{"work": {Theme: "tokyonight"}, "home": {Theme: "opencode"}}
+	tests := []struct {
+		name     string
+		flag     string
+		env      string
+		profiles map[string]Profile
+		want     string
+		wantErr  bool
+	}{
+		{"neither set", "", "", profiles, "", false},
+		{"flag", "home", "", profiles, "home", false},
+		{"env", "", "work", profiles, "work", false},
+		{"flag over env", "home", "work", profiles, "home", false},
+		{"unknown", "demo", "", profiles, "", true},
+		{"none defined", "work", "", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(ProfileEnv, tt.env)
+			name, profile, err := SelectProfile(tt.profiles, tt.flag)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SelectProfile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if name != tt.want || (name != "" && profile.Theme != profiles[name].Theme) {
+				t.Errorf("SelectProfile() = %q %+v, want %q", name, profile, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,126 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// starterFile is the config file written by the first-run setup: the session
+// and layout sections the loaders read
+type starterFile struct {
+	Version string  `yaml:"version"`
+	Session Session `yaml:"session"`
+	Mode    string  `yaml:"mode"`
+	Panels  []Panel `yaml:"panels"`
+	Splits  []Split `yaml:"splits"`
+}
+
+// WriteStarter writes a config file holding session and layout. An existing
+// config file is not replaced unless overwrite is set.
+func WriteStarter(path string, session Session, layout *Layout, overwrite bool) error {
+	if layout == nil {
+		layout = DefaultLayout()
+	}
+	if !overwrite {
+		if data, err := readConfigFile(path); err != nil {
+			return err
+		} else if data != nil {
+			return fmt.Errorf("%s: %w", path, fs.ErrExist)
+		}
+	}
+
+	data, err := yaml.Marshal(starterFile{
+		Version: "1.0",
+		Session: session,
+		Mode:    layout.Mode,
+		Panels:  layout.Panels,
+		Splits:  layout.Splits,
+	})
+	if err != nil {
+		return fmt.Errorf("encode tmux config: %w", err)
+	}
+	data = append([]byte("# Written by opencode-tmux setup; see examples/tmux-config-complete.yaml for more settings\n"), data...)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("create config directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("write tmux config: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("write tmux config: %w", err)
+	}
+	return nil
+}
+
+// ConfigExists reports whether a non-empty config file is at path
+func ConfigExists(path string) bool {
+	data, err := readConfigFile(path)
+	return err != nil || data != nil
+}
+
+// Validate checks that the layout can be built: every panel has a unique ID
+// and a known restart policy, every split divides the root or an earlier
+// split's panel into two declared panels, and every panel is placed by a split.
+func (l *Layout) Validate() error {
+	if len(l.Panels) == 0 {
+		return errors.New("layout has no panels")
+	}
+	ids := make(map[string]bool, len(l.Panels))
+	for _, panel := range l.Panels {
+		id := strings.TrimSpace(panel.ID)
+		if id == "" {
+			return errors.New("layout panel without an id")
+		}
+		if id == "root" {
+			return errors.New("layout panel id \"root\" is reserved for the window's first pane")
+		}
+		if ids[id] {
+			return fmt.Errorf("layout panel %q is declared twice", id)
+		}
+		ids[id] = true
+		switch strings.ToLower(strings.TrimSpace(panel.Restart)) {
+		case "", "always", "on-failure", "never":
+		default:
+			return fmt.Errorf("layout panel %q: unknown restart policy %q (want always, on-failure or never)", id, panel.Restart)
+		}
+		if panel.StartupTimeout < 0 {
+			return fmt.Errorf("layout panel %q: startup_timeout must not be negative", id)
+		}
+	}
+
+	placed := map[string]bool{"root": true}
+	for i, split := range l.Splits {
+		if !placed[split.Target] {
+			return fmt.Errorf("split %d: target %q is neither root nor a panel of an earlier split", i+1, split.Target)
+		}
+		if len(split.Panels) != 2 {
+			return fmt.Errorf("split %d: must name exactly two panels", i+1)
+		}
+		for _, id := range split.Panels {
+			if !ids[id] {
+				return fmt.Errorf("split %d: panel %q is not declared", i+1, id)
+			}
+			placed[id] = true
+		}
+		if split.Ratio != "" {
+			if _, _, ok := l.RatioPercents(split.Ratio); !ok {
+				return fmt.Errorf("split %d: invalid ratio %q", i+1, split.Ratio)
+			}
+		}
+	}
+	for _, panel := range l.Panels {
+		if !placed[panel.ID] {
+			return fmt.Errorf("layout panel %q is not placed by any split", panel.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteStarter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "opencode", "tmux.yaml")
+	if ConfigExists(path) {
+		t.Fatal("ConfigExists() = true before the file is written")
+	}
+
+	session := Session{Name: "dev", Theme: "tokyonight", Model: "anthropic/claude-sonnet"}
+	if err := WriteStarter(path, session, nil, false); err != nil {
+		t.Fatalf("WriteStarter() error = %v", err)
+	}
+	if !ConfigExists(path) {
+		t.Fatal("ConfigExists() = false after the file is written")
+	}
+
+	sessionCfg, err := LoadSession(path)
+	if err != nil {
+		t.Fatalf("LoadSession() error = %v", err)
+	}
+	if sessionCfg.Session != session {
+		t.Errorf("session = %+v, want %+v", sessionCfg.Session, session)
+	}
+	layout, err := LoadLayout(path)
+	if err != nil {
+		t.Fatalf("LoadLayout() error = %v", err)
+	}
+	if err := layout.Validate(); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if len(layout.Panels) != len(DefaultLayout().Panels) {
+		t.Errorf("panels = %+v", layout.Panels)
+	}
+
+	if err := WriteStarter(path, session, nil, false); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("second WriteStarter() error = %v, want fs.ErrExist", err)
+	}
+	if err := WriteStarter(path, Session{Name: "other"}, nil, true); err != nil {
+		t.Errorf("WriteStarter(overwrite) error = %v", err)
+	}
+}
+
+func TestLoadSessionRejectsBareModel(t *testing.T) {
+	path := writeConfig(t, "session:\n  name: dev\n  model: claude-sonnet\n")
+	if _, err := LoadSession(path); err == nil {
+		t.Fatal("LoadSession() accepted a model without a provider")
+	}
+}
+
+func TestLoadSessionRejectsUnknownCollisionPolicy(t *testing.T) {
+	path := writeConfig(t, "session:\n  name: \"{dir}\"\n  on_collision: replace\n")
+	if _, err := LoadSession(path); err == nil || !strings.Contains(err.Error(), "on_collision") {
+		t.Fatalf("LoadSession() error = %v, want one about on_collision", err)
+	}
+}
+
+func TestLayoutValidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		layout Layout
+		want   string
+	}{
+		{
+			name: "duplicate panel",
+			layout: Layout{
+				Panels: []Panel{{ID: "messages"}, {ID: "messages"}},
+				Splits: []Split{{Target: "root", Panels: []string{"messages", "messages"}}},
+			},
+			want: "declared twice",
+		},
+		{
+			name: "unknown target",
+			layout: Layout{
+				Panels: []Panel{{ID: "messages"}, {ID: "input"}},
+				Splits: []Split{{Target: "sessions", Panels: []string{"messages", "input"}}},
+			},
+			want: "neither root",
+		},
+		{
+			name: "undeclared panel",
+			layout: Layout{
+				Panels: []Panel{{ID: "messages"}},
+				Splits: []Split{{Target: "root", Panels: []string{"messages", "input"}}},
+			},
+			want: "not declared",
+		},
+		{
+			name: "unplaced panel",
+			layout: Layout{
+				Panels: []Panel{{ID: "messages"}, {ID: "input"}, {ID: "sessions"}},
+				Splits: []Split{{Target: "root", Panels: []string{"messages", "input"}}},
+			},
+			want: "not placed",
+		},
+		{
+			name: "bad ratio",
+			layout: Layout{
+				Panels: []Panel{{ID: "messages"}, {ID: "input"}},
+				Splits: []Split{{Target: "root", Panels: []string{"messages", "input"}, Ratio: "3"}},
+			},
+			want: "invalid ratio",
+		},
+		{
+			name: "bad restart policy",
+			layout: Layout{
+				Panels: []Panel{{ID: "setup", Restart: "sometimes"}, {ID: "input"}},
+				Splits: []Split{{Target: "root", Panels: []string{"setup", "input"}}},
+			},
+			want: "restart policy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.layout.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() error = %v, want it to mention %q", err, tt.want)
+			}
+		})
+	}
+	if err := DefaultLayout().Validate(); err != nil {
+		t.Errorf("DefaultLayout().Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,330 @@
+package conformance
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// maxProblems bounds the problems listed in one result
+const maxProblems = 5
+
+// panelRequests are the message types the server answers
+var panelRequests = map[string]bool{
+	ipc.MessageTypeStateUpdate:  true,
+	ipc.MessageTypeStateRequest: true,
+	"clear_session_messages":    true,
+	"redact_message":            true,
+	"blob_request":              true,
+	"state_at_request":          true,
+	"event_replay_request":      true,
+	ipc.MessageTypePing:         true,
+	"orchestrator_command":      true,
+	"admin_command":             true,
+}
+
+// run is everything a run observed, to be judged
+type run struct {
+	opts       Options
+	handshake  *ipc.HandshakeMessage
+	response   *ipc.HandshakeResponse
+	records    []record
+	problems   []string // Panel messages that could not be read
+	probes     []types.StateEvent
+	subscriber subscriberInfo
+	subscribed bool
+	connected  bool
+	closedAt   time.Time
+	reconnects int
+	start, end time.Time
+}
+
+// evaluate runs every check, in report order
+func (r *run) evaluate() []Result {
+	return []Result{
+		checkHandshake(r.handshake, r.response),
+		r.checkHeartbeat(),
+		r.checkEvents(),
+		r.checkMessages(),
+		r.checkUpdates(),
+		r.checkConnection(),
+	}
+}
+
+// result passes with detail when there are no problems and fails listing
+// them otherwise
+func result(name string, problems []string, detail string) Result {
+	if len(problems) == 0 {
+		return Result{Name: name, Status: StatusPass, Detail: detail}
+	}
+	if len(problems) > maxProblems {
+		more := len(problems) - maxProblems
+		problems = append(problems[:maxProblems:maxProblems], fmt.Sprintf("and %d more", more))
+	}
+	return Result{Name: name, Status: StatusFail, Detail: strings.Join(problems, "; ")}
+}
+
+// checkHandshake checks the panel identified itself and the server took it
+func checkHandshake(handshake *ipc.HandshakeMessage, response *ipc.HandshakeResponse) Result {
+	if handshake == nil {
+		return Result{Name: CheckHandshake, Status: StatusFail, Detail: "the panel sent no readable handshake"}
+	}
+	var problems []string
+	if handshake.Type != ipc.MessageTypeHandshake {
+		problems = append(problems, fmt.Sprintf("type is %q, want %q", handshake.Type, ipc.MessageTypeHandshake))
+	}
+	if handshake.PanelID == "" {
+		problems = append(problems, "panel_id is empty")
+	}
+	if handshake.PanelType == "" {
+		problems = append(problems, "panel_type is empty")
+	}
+	if handshake.Version == "" {
+		problems = append(problems, "version is empty")
+	}
+	if handshake.Timestamp.IsZero() {
+		problems = append(problems, "timestamp is missing")
+	}
+	if handshake.Capabilities != nil {
+		for _, pattern := range handshake.Capabilities.Topics {
+			if err := types.ValidateTopicPattern(pattern); err != nil {
+				problems = append(problems, err.Error())
+			}
+		}
+	}
+	switch {
+	case response == nil:
+		problems = append(problems, "the server did not answer the handshake")
+	case !response.Success:
+		problems = append(problems, fmt.Sprintf("the server rejected the handshake: %s", response.Error))
+	}
+	framing := ""
+	if response != nil {
+		framing = response.Framing
+	}
+	if framing == "" {
+		framing = "json-lines"
+	}
+	return result(CheckHandshake, problems, fmt.Sprintf("panel %s (%s), protocol %s, %s framing", handshake.PanelID, handshake.PanelType, handshake.Version, framing))
+}
+
+// watchEnd is when the panel stopped being watched: the end of the run, or
+// when it hung up
+func (r *run) watchEnd() time.Time {
+	if !r.closedAt.IsZero() && r.closedAt.Before(r.end) {
+		return r.closedAt
+	}
+	return r.end
+}
+
+// checkHeartbeat checks the panel pinged at least once per heartbeat timeout
+func (r *run) checkHeartbeat() Result {
+	end := r.watchEnd()
+	var pings []time.Time
+	for _, record := range r.records {
+		if record.fromPanel && record.message.Type == ipc.MessageTypePing {
+			pings = append(pings, record.at)
+		}
+	}
+	if len(pings) == 0 && end.Sub(r.start) < r.opts.HeartbeatTimeout {
+		return Result{Name: CheckHeartbeat, Status: StatusSkip,
+			Detail: fmt.Sprintf("watched for %v, less than the heartbeat timeout of %v", end.Sub(r.start).Round(time.Millisecond), r.opts.HeartbeatTimeout)}
+	}
+
+	longest := time.Duration(0)
+	previous := r.start
+	for _, at := range append(pings, end) {
+		if gap := at.Sub(previous); gap > longest {
+			longest = gap
+		}
+		previous = at
+	}
+	var problems []string
+	if longest > r.opts.HeartbeatTimeout {
+		problems = append(problems, fmt.Sprintf("went %v without pinging; the limit is %v", longest.Round(time.Millisecond), r.opts.HeartbeatTimeout))
+	}
+	return result(CheckHeartbeat, problems, fmt.Sprintf("%d pings, longest gap %v", len(pings), longest.Round(time.Millisecond)))
+}
+
+// checkEvents checks every probe event the panel subscribed to reached it,
+// and that it read them quickly enough that none was dropped
+func (r *run) checkEvents() Result {
+	if r.probes == nil {
+		return Result{Name: CheckEvents, Status: StatusSkip, Detail: "the run ended before probe events were sent"}
+	}
+	expected := make(map[string]bool)
+	for _, probe := range r.probes {
+		if r.handshake.Capabilities.Accepts(probe) {
+			expected[probe.ID] = true
+		}
+	}
+	if len(expected) == 0 {
+		return Result{Name: CheckEvents, Status: StatusSkip, Detail: "the panel's declared capabilities exclude every probe event"}
+	}
+
+	received := 0
+	for _, record := range r.records {
+		if record.fromPanel || record.message.Type != ipc.MessageTypeStateEvent {
+			continue
+		}
+		if data, ok := record.message.Data.(map[string]interface{}); ok {
+			if id, _ := data["id"].(string); expected[id] {
+				received++
+				delete(expected, id)
+			}
+		}
+	}
+	var problems []string
+	if len(expected) > 0 {
+		problems = append(problems, fmt.Sprintf("%d of %d probe events never reached the panel; it stopped reading its connection", len(expected), received+len(expected)))
+	}
+	if r.subscriber.Dropped > 0 {
+		problems = append(problems, fmt.Sprintf("the server dropped %d events the panel did not read in time", r.subscriber.Dropped))
+	}
+	return result(CheckEvents, problems, fmt.Sprintf("%d probe events delivered, including an unknown event type and a state sync", received))
+}
+
+// checkMessages checks every message the panel sent is one the server
+// understands and that the server raised no errors about them
+func (r *run) checkMessages() Result {
+	problems := append([]string(nil), r.problems...)
+	sent := 0
+	for _, record := range r.records {
+		message := record.message
+		if !record.fromPanel {
+			if message.Type == ipc.MessageTypeError {
+				problems = append(problems, fmt.Sprintf("the server answered with an error: %s", errorText(message.Data)))
+			}
+			continue
+		}
+		sent++
+		switch {
+		case message.Type == "":
+			problems = append(problems, "a message has no type")
+			continue
+		case !panelRequests[message.Type]:
+			problems = append(problems, fmt.Sprintf("unknown message type %q", message.Type))
+		case message.Type != ipc.MessageTypePing && message.RequestID == "":
+			problems = append(problems, fmt.Sprintf("%s request has no request_id", message.Type))
+		}
+		if message.Timestamp.IsZero() {
+			problems = append(problems, fmt.Sprintf("%s message has no timestamp", message.Type))
+		}
+	}
+	if sent == 0 && len(problems) == 0 {
+		return Result{Name: CheckMessages, Status: StatusSkip, Detail: "the panel sent nothing after its handshake"}
+	}
+	return result(CheckMessages, problems, fmt.Sprintf("%d messages", sent))
+}
+
+// checkUpdates checks each state update is well formed, was based on a
+// version the panel had been shown, was accepted, and was not resent once
+// applied
+func (r *run) checkUpdates() Result {
+	responses := make(map[string]ipc.IPCMessage)
+	for _, record := range r.records {
+		if !record.fromPanel && record.message.RequestID != "" {
+			responses[record.message.RequestID] = record.message
+		}
+	}
+
+	var problems []string
+	applied := make(map[string]bool)
+	seen := int64(0) // Highest version shown to the panel so far
+	updates := 0
+	for _, record := range r.records {
+		message := record.message
+		if !record.fromPanel {
+			if version, ok := shownVersion(message); ok && version > seen {
+				seen = version
+			}
+			continue
+		}
+		if message.Type != ipc.MessageTypeStateUpdate {
+			continue
+		}
+		updates++
+
+		var update types.StateUpdate
+		raw, _ := json.Marshal(message.Data)
+		if err := json.Unmarshal(raw, &update); err != nil {
+			problems = append(problems, fmt.Sprintf("update is not a state update: %v", err))
+			continue
+		}
+		label := update.ID
+		if update.ID == "" {
+			label = string(update.Type)
+			problems = append(problems, fmt.Sprintf("%s update has no id", update.Type))
+		}
+		if update.Type == "" {
+			problems = append(problems, fmt.Sprintf("update %s has no type", label))
+		}
+		if update.ExpectedVersion > seen {
+			problems = append(problems, fmt.Sprintf("update %s expects version %d, but the panel had only been shown %d", label, update.ExpectedVersion, seen))
+		}
+		if update.ID != "" && applied[update.ID] {
+			problems = append(problems, fmt.Sprintf("update %s was resent after it was applied", label))
+		}
+
+		response, answered := responses[message.RequestID]
+		switch {
+		case !answered:
+		case response.Type == ipc.MessageTypeStateUpdateResponse:
+			applied[update.ID] = true
+		case response.Type == "state_update_error":
+			problems = append(problems, fmt.Sprintf("update %s was rejected: %s", label, errorText(response.Data)))
+		}
+	}
+	if updates == 0 {
+		return Result{Name: CheckUpdates, Status: StatusSkip, Detail: "the panel sent no state updates; use it during the run to cover them"}
+	}
+	return result(CheckUpdates, problems, fmt.Sprintf("%d updates", updates))
+}
+
+// checkConnection checks the panel stayed connected for the whole run
+func (r *run) checkConnection() Result {
+	var problems []string
+	if !r.closedAt.IsZero() && r.closedAt.Before(r.end) {
+		problems = append(problems, fmt.Sprintf("the panel disconnected %v after connecting", r.closedAt.Sub(r.start).Round(time.Millisecond)))
+	} else if !r.connected || !r.subscribed {
+		problems = append(problems, "the server no longer had the panel connected at the end of the run")
+	}
+	if r.reconnects > 0 {
+		problems = append(problems, fmt.Sprintf("the panel opened %d more connections", r.reconnects))
+	}
+	return result(CheckConnection, problems, fmt.Sprintf("connected for %v", r.end.Sub(r.start).Round(time.Millisecond)))
+}
+
+// shownVersion returns the state version a message from the server told the
+// panel about
+func shownVersion(message ipc.IPCMessage) (int64, bool) {
+	data, ok := message.Data.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+	switch message.Type {
+	case ipc.MessageTypeStateEvent, ipc.MessageTypeStateUpdateResponse:
+		version, ok := data["version"].(float64)
+		return int64(version), ok
+	case ipc.MessageTypeStateResponse:
+		if stateVersion, ok := data["version"].(map[string]interface{}); ok {
+			version, ok := stateVersion["version"].(float64)
+			return int64(version), ok
+		}
+	}
+	return 0, false
+}
+
+// errorText returns the error in an error response's data
+func errorText(data interface{}) string {
+	if fields, ok := data.(map[string]interface{}); ok {
+		if text, ok := fields["error"].(string); ok {
+			return text
+		}
+	}
+	return fmt.Sprint(data)
+}
@@ -0,0 +1,351 @@
+// Package conformance checks that a panel speaks the orchestrator's IPC
+// protocol. A Harness runs the real state server behind a recording proxy; the
+// panel under test connects to the proxy as it would to the orchestrator. The
+// harness sends it probe events, watches it for a while and then judges what
+// passed between them: the handshake, heartbeats, event delivery, the
+// messages it sent and its state updates.
+package conformance
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultConnectTimeout   = 10 * time.Second
+	DefaultDuration         = 25 * time.Second
+	DefaultHeartbeatTimeout = 15 * time.Second // The stock client pings every 10s
+	DefaultBurstSize        = 50
+)
+
+// probeEventType is an event type no panel knows, sent to check that panels
+// ignore events newer than they are
+const probeEventType types.StateEventType = "conformance_probe"
+
+// Check names, stable for tools reading reports
+const (
+	CheckHandshake  = "handshake"
+	CheckHeartbeat  = "heartbeat"
+	CheckEvents     = "events"
+	CheckMessages   = "messages"
+	CheckUpdates    = "updates"
+	CheckConnection = "connection"
+)
+
+// Status is the outcome of one check
+type Status string
+
+const (
+	StatusPass Status = "pass"
+	StatusFail Status = "fail"
+	StatusSkip Status = "skip" // Nothing the panel did exercised the check
+)
+
+// Result is the outcome of one check, with what went wrong when it failed
+type Result struct {
+	Name   string `json:"name"`
+	Status Status `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the outcome of a run
+type Report struct {
+	PanelID         string        `json:"panel_id,omitempty"`
+	PanelType       string        `json:"panel_type,omitempty"`
+	ProtocolVersion string        `json:"protocol_version,omitempty"`
+	Framing         string        `json:"framing,omitempty"` // Negotiated; empty for JSON lines
+	Started         time.Time     `json:"started"`
+	Duration        time.Duration `json:"duration"`
+	MessagesSent    int           `json:"messages_sent"`    // By the panel, handshake excluded
+	EventsDelivered int           `json:"events_delivered"` // To the panel
+	Results         []Result      `json:"results"`
+	Passed          bool          `json:"passed"` // No check failed
+}
+
+// Failed returns the checks that failed
+func (r *Report) Failed() []Result {
+	var failed []Result
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			failed = append(failed, result)
+		}
+	}
+	return failed
+}
+
+// Options configure a Harness
+type Options struct {
+	SocketPath       string        // Where the panel connects; a temporary path when empty
+	ConnectTimeout   time.Duration // How long to wait for the panel's handshake
+	Duration         time.Duration // How long to watch the panel after its handshake
+	HeartbeatTimeout time.Duration // Longest a panel may go without pinging
+	BurstSize        int           // Probe events sent at once to check the panel keeps up
+}
+
+func (o Options) withDefaults() Options {
+	if o.ConnectTimeout <= 0 {
+		o.ConnectTimeout = DefaultConnectTimeout
+	}
+	if o.Duration <= 0 {
+		o.Duration = DefaultDuration
+	}
+	if o.HeartbeatTimeout <= 0 {
+		o.HeartbeatTimeout = DefaultHeartbeatTimeout
+	}
+	if o.BurstSize <= 0 {
+		o.BurstSize = DefaultBurstSize
+	}
+	return o
+}
+
+// Harness is a state server waiting for the panel under test
+type Harness struct {
+	opts         Options
+	dir          string
+	socketPath   string
+	serverSocket string
+	manager      *state.PanelSyncManager
+	server       *ipc.SocketServer
+	listener     net.Listener
+	transcript   *transcript
+	closeOnce    sync.Once
+}
+
+// Listen starts the server and the proxy the panel connects to
+func Listen(opts Options) (*Harness, error) {
+	opts = opts.withDefaults()
+
+	// Unix socket paths are limited to about 100 bytes, so the server's
+	// socket lives in a short directory of its own
+	dir, err := os.MkdirTemp("", "tmuxcoder-conformance")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create harness directory: %w", err)
+	}
+	h := &Harness{
+		opts:         opts,
+		dir:          dir,
+		socketPath:   opts.SocketPath,
+		serverSocket: filepath.Join(dir, "server.sock"),
+		transcript:   newTranscript(),
+	}
+	if h.socketPath == "" {
+		h.socketPath = filepath.Join(dir, "panel.sock")
+	}
+
+	config := state.DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	config.WatchdogDumpDir = ""
+	repository := persistence.NewMemoryRepository(persistence.MemoryOptions{})
+	h.manager = state.NewPanelSyncManager(types.NewSharedApplicationState(), repository, state.NewEventBus(config.EventHistorySize), state.DefaultConflictResolver(), config)
+	if err := h.manager.Initialize(); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to initialize state: %w", err)
+	}
+
+	h.server = ipc.NewSocketServer(h.serverSocket, h.manager.GetEventBus(), h.manager, nil)
+	if err := h.server.Start(); err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to start IPC server: %w", err)
+	}
+
+	os.Remove(h.socketPath)
+	h.listener, err = net.Listen("unix", h.socketPath)
+	if err != nil {
+		h.Close()
+		return nil, fmt.Errorf("failed to listen on %s: %w", h.socketPath, err)
+	}
+	go h.acceptLoop()
+	return h, nil
+}
+
+// SocketPath is where the panel under test connects, as OPENCODE_SOCKET
+func (h *Harness) SocketPath() string {
+	return h.socketPath
+}
+
+// Close stops the proxy and the server and removes their sockets
+func (h *Harness) Close() error {
+	h.closeOnce.Do(func() {
+		if h.listener != nil {
+			h.listener.Close()
+			os.Remove(h.socketPath)
+		}
+		h.transcript.closeConns()
+		if h.server != nil {
+			h.server.Stop()
+		}
+		if h.manager != nil {
+			h.manager.Stop()
+		}
+		os.RemoveAll(h.dir)
+	})
+	return nil
+}
+
+// Run waits for the panel to connect, probes it and watches it for the
+// configured duration, then reports. Cancelling ctx cuts the watch short.
+func (h *Harness) Run(ctx context.Context) (*Report, error) {
+	report := &Report{Started: time.Now()}
+	defer func() { report.Duration = time.Since(report.Started) }()
+
+	connectCtx, cancel := context.WithTimeout(ctx, h.opts.ConnectTimeout)
+	defer cancel()
+	select {
+	case <-h.transcript.handshakeDone:
+	case <-connectCtx.Done():
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		report.Results = skipAfter(Result{Name: CheckHandshake, Status: StatusFail,
+			Detail: fmt.Sprintf("no panel completed a handshake within %v", h.opts.ConnectTimeout)})
+		return report, nil
+	}
+
+	handshake, response := h.transcript.handshakes()
+	if handshake != nil {
+		report.PanelID = handshake.PanelID
+		report.PanelType = handshake.PanelType
+		report.ProtocolVersion = handshake.Version
+	}
+	if response == nil || !response.Success {
+		report.Results = skipAfter(checkHandshake(handshake, response))
+		return report, nil
+	}
+	report.Framing = response.Framing
+
+	// Give the panel a moment to request state before probing it
+	watchEnd := h.transcript.connectedTime().Add(h.opts.Duration)
+	probes := h.probeAfter(ctx, time.Second)
+	select {
+	case <-time.After(time.Until(watchEnd)):
+	case <-ctx.Done():
+	}
+
+	subscriber, subscribed := h.subscriber(handshake.PanelID)
+	_, connected := h.connection(handshake.PanelID)
+	records := h.transcript.snapshot()
+	for _, record := range records {
+		if record.fromPanel {
+			report.MessagesSent++
+		} else if record.message.Type == ipc.MessageTypeStateEvent {
+			report.EventsDelivered++
+		}
+	}
+
+	run := &run{
+		opts:       h.opts,
+		handshake:  handshake,
+		response:   response,
+		records:    records,
+		problems:   h.transcript.problemList(),
+		probes:     probes(),
+		subscriber: subscriber,
+		subscribed: subscribed,
+		connected:  connected,
+		closedAt:   h.transcript.closedTime(),
+		reconnects: h.transcript.reconnectCount(),
+		start:      h.transcript.connectedTime(),
+		end:        time.Now(),
+	}
+	report.Results = run.evaluate()
+	report.Passed = len(report.Failed()) == 0
+	return report, nil
+}
+
+// skipAfter reports a failed first check with the rest skipped, for runs
+// that could go no further
+func skipAfter(first Result) []Result {
+	results := []Result{first}
+	for _, name := range []string{CheckHeartbeat, CheckEvents, CheckMessages, CheckUpdates, CheckConnection} {
+		results = append(results, Result{Name: name, Status: StatusSkip, Detail: "the panel never connected"})
+	}
+	return results
+}
+
+// probeAfter sends the probe events after delay, unless ctx ends first. The
+// returned function waits for the probes to be sent and returns them.
+func (h *Harness) probeAfter(ctx context.Context, delay time.Duration) func() []types.StateEvent {
+	done := make(chan []types.StateEvent, 1)
+	go func() {
+		select {
+		case <-time.After(delay):
+			done <- h.sendProbes()
+		case <-ctx.Done():
+			done <- nil
+		}
+	}()
+	return func() []types.StateEvent { return <-done }
+}
+
+// sendProbes broadcasts a full state sync, an event of a type no panel knows
+// carrying awkward text, and a burst large enough to fill the socket buffers
+// of a panel that stops reading
+func (h *Harness) sendProbes() []types.StateEvent {
+	bus := h.manager.GetEventBus()
+	current := h.manager.GetState()
+	probe := func(eventType types.StateEventType, data interface{}) types.StateEvent {
+		return types.StateEvent{
+			ID:          ids.New("probe"),
+			Type:        eventType,
+			Data:        data,
+			Version:     current.Version.Version,
+			SourcePanel: "conformance",
+			Timestamp:   time.Now(),
+		}
+	}
+
+	probes := []types.StateEvent{
+		probe(types.EventStateSync, types.StateSyncPayload{State: current}),
+		probe(probeEventType, map[string]interface{}{
+			"text":   "line one\nline two\r\n\ttabbed \"quoted\" \\ ✓ \U0001F600",
+			"future": map[string]interface{}{"fields": []int{1, 2, 3}},
+		}),
+	}
+	padding := strings.Repeat("x", 16<<10)
+	for i := 0; i < h.opts.BurstSize; i++ {
+		probes = append(probes, probe(probeEventType, map[string]interface{}{"seq": i, "padding": padding}))
+	}
+	for _, event := range probes {
+		bus.Broadcast(event)
+	}
+	return probes
+}
+
+// subscriber returns the event bus's view of the panel
+func (h *Harness) subscriber(panelID string) (subscriberInfo, bool) {
+	for _, info := range h.manager.GetEventBus().GetSubscribers() {
+		if info.PanelID == panelID {
+			return subscriberInfo{Dropped: info.Dropped, Behind: info.Behind}, true
+		}
+	}
+	return subscriberInfo{}, false
+}
+
+// connection returns the server's connection for the panel
+func (h *Harness) connection(panelID string) (*ipc.ClientConnection, bool) {
+	for _, conn := range h.server.GetConnections() {
+		if conn.PanelID == panelID {
+			return conn, true
+		}
+	}
+	return nil, false
+}
+
+// subscriberInfo is what the checks need from the event bus
+type subscriberInfo struct {
+	Dropped int64
+	Behind  bool
+}
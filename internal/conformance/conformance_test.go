@@ -0,0 +1,150 @@
+package conformance
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func startHarness(t *testing.T, opts Options) *Harness {
+	t.Helper()
+	h, err := Listen(opts)
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h
+}
+
+func statuses(report *Report) map[string]Result {
+	results := make(map[string]Result)
+	for _, result := range report.Results {
+		results[result.Name] = result
+	}
+	return results
+}
+
+func TestStockClientConforms(t *testing.T) {
+	if testing.Short() {
+		t.Skip("watches a panel for seconds")
+	}
+	t.Parallel()
+	h := startHarness(t, Options{Duration: 2500 * time.Millisecond})
+
+	client := ipc.NewSocketClient(h.SocketPath(), "conformance-panel", "sessions")
+	go func() {
+		if err := client.Connect(); err != nil {
+			t.Errorf("Connect() error = %v", err)
+			return
+		}
+		if _, err := client.RequestState(); err != nil {
+			t.Errorf("RequestState() error = %v", err)
+		}
+		update := types.StateUpdate{
+			Type:            types.SessionAdded,
+			ExpectedVersion: client.GetCurrentVersion(),
+			Payload:         types.SessionAddPayload{Session: types.SessionInfo{ID: "s1", Title: "One"}},
+		}
+		if _, err := client.SendStateUpdateAndWait(update); err != nil {
+			t.Errorf("SendStateUpdateAndWait() error = %v", err)
+		}
+	}()
+	defer client.Disconnect()
+
+	report, err := h.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !report.Passed {
+		t.Errorf("stock client failed: %+v", report.Failed())
+	}
+	if report.PanelID != "conformance-panel" || report.Framing != ipc.FramingLengthPrefixed {
+		t.Errorf("report = %+v, want panel conformance-panel with length-prefixed framing", report)
+	}
+	results := statuses(report)
+	for _, name := range []string{CheckHandshake, CheckEvents, CheckMessages, CheckUpdates, CheckConnection} {
+		if results[name].Status != StatusPass {
+			t.Errorf("%s = %+v, want pass", name, results[name])
+		}
+	}
+	// The stock client pings every 10s, longer than this run
+	if results[CheckHeartbeat].Status != StatusSkip {
+		t.Errorf("heartbeat = %+v, want skip", results[CheckHeartbeat])
+	}
+}
+
+func TestMisbehavingPanelFails(t *testing.T) {
+	if testing.Short() {
+		t.Skip("watches a panel for seconds")
+	}
+	t.Parallel()
+	h := startHarness(t, Options{Duration: 2500 * time.Millisecond, HeartbeatTimeout: 500 * time.Millisecond})
+
+	conn, err := net.Dial("unix", h.SocketPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	encoder := json.NewEncoder(conn)
+	// No version, and it never pings or reads the events it is sent
+	encoder.Encode(ipc.HandshakeMessage{Type: "handshake", PanelID: "rogue", PanelType: "custom", Timestamp: time.Now()})
+	encoder.Encode(ipc.IPCMessage{Type: "gossip", Timestamp: time.Now()})
+	encoder.Encode(ipc.IPCMessage{
+		Type:      ipc.MessageTypeStateUpdate,
+		RequestID: "req-1",
+		Data:      types.StateUpdate{ID: "u1", Type: types.InputUpdated, ExpectedVersion: 99},
+		Timestamp: time.Now(),
+	})
+
+	report, err := h.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Passed {
+		t.Fatal("misbehaving panel passed")
+	}
+	tests := []struct {
+		name   string
+		status Status
+		detail string
+	}{
+		{CheckHandshake, StatusFail, "version is empty"},
+		{CheckHeartbeat, StatusFail, "without pinging"},
+		{CheckEvents, StatusFail, "never reached the panel"},
+		{CheckMessages, StatusFail, `unknown message type "gossip"`},
+		{CheckUpdates, StatusFail, "expects version 99"},
+		{CheckConnection, StatusPass, ""},
+	}
+	results := statuses(report)
+	for _, tt := range tests {
+		got := results[tt.name]
+		if got.Status != tt.status || !strings.Contains(got.Detail, tt.detail) {
+			t.Errorf("%s = %+v, want %s mentioning %q", tt.name, got, tt.status, tt.detail)
+		}
+	}
+}
+
+func TestNoPanelConnects(t *testing.T) {
+	h := startHarness(t, Options{ConnectTimeout: 100 * time.Millisecond})
+	report, err := h.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if report.Passed || len(report.Results) != 6 {
+		t.Fatalf("report = %+v, want a failed handshake and the rest skipped", report)
+	}
+	if report.Results[0].Status != StatusFail {
+		t.Errorf("handshake = %+v, want fail", report.Results[0])
+	}
+	for _, result := range report.Results[1:] {
+		if result.Status != StatusSkip {
+			t.Errorf("%s = %+v, want skip", result.Name, result)
+		}
+	}
+}
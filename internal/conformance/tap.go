@@ -0,0 +1,259 @@
+package conformance
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+)
+
+// The proxy copies bytes unchanged between the panel and the server, and
+// copies them again into a parser for each direction. Only the first
+// connection is recorded; later ones, such as a panel reconnecting, are
+// proxied and counted as reconnects.
+
+// record is one message seen on the wire
+type record struct {
+	fromPanel bool
+	at        time.Time
+	message   ipc.IPCMessage
+}
+
+// transcript is everything seen on the recorded connection
+type transcript struct {
+	mutex         sync.Mutex
+	records       []record
+	problems      []string // Messages from the panel that could not be read
+	handshake     *ipc.HandshakeMessage
+	response      *ipc.HandshakeResponse
+	responded     bool // The handshake is over, with or without a response
+	connectedAt   time.Time
+	closedAt      time.Time // When the panel closed the connection
+	reconnects    int
+	conns         []net.Conn
+	framing       chan string   // The negotiated framing, once the response is read
+	handshakeDone chan struct{} // Closed once the handshake response is read
+}
+
+func newTranscript() *transcript {
+	return &transcript{
+		framing:       make(chan string, 1),
+		handshakeDone: make(chan struct{}),
+	}
+}
+
+// acceptLoop proxies each panel connection to the server
+func (h *Harness) acceptLoop() {
+	for {
+		conn, err := h.listener.Accept()
+		if err != nil {
+			return
+		}
+		upstream, err := net.Dial("unix", h.serverSocket)
+		if err != nil {
+			log.Printf("Conformance proxy failed to reach the server: %v", err)
+			conn.Close()
+			continue
+		}
+		recorded := h.transcript.connect(conn, upstream)
+		go h.pipe(conn, upstream, recorded, true)
+		go h.pipe(upstream, conn, recorded, false)
+	}
+}
+
+// connect registers a proxied connection and reports whether it is recorded
+func (t *transcript) connect(conns ...net.Conn) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.conns = append(t.conns, conns...)
+	if !t.connectedAt.IsZero() {
+		t.reconnects++
+		return false
+	}
+	t.connectedAt = time.Now()
+	return true
+}
+
+// closeConns closes every proxied connection
+func (t *transcript) closeConns() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	for _, conn := range t.conns {
+		conn.Close()
+	}
+}
+
+// pipe copies src to dst. When recorded, what dst accepted is also parsed;
+// bytes go to the parser only once written, so events a panel has stopped
+// reading are not counted as delivered.
+func (h *Harness) pipe(src, dst net.Conn, recorded, fromPanel bool) {
+	defer dst.Close()
+	defer src.Close()
+
+	var tap *io.PipeWriter
+	if recorded {
+		var reader *io.PipeReader
+		reader, tap = io.Pipe()
+		defer tap.Close()
+		go h.transcript.parse(reader, fromPanel)
+	}
+
+	buf := make([]byte, 32<<10)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				return
+			}
+			if tap != nil {
+				tap.Write(buf[:n])
+			}
+		}
+		if err != nil {
+			if recorded && fromPanel {
+				h.transcript.closed()
+			}
+			return
+		}
+	}
+}
+
+// parse reads one direction of the recorded connection: a JSON handshake,
+// then messages in the framing the server granted
+func (t *transcript) parse(r *io.PipeReader, fromPanel bool) {
+	// Whatever is left unparsed still has to be drained, or the proxy stalls
+	defer io.Copy(io.Discard, r)
+
+	decoder := json.NewDecoder(r)
+	var framing string
+	if fromPanel {
+		var handshake ipc.HandshakeMessage
+		if err := decoder.Decode(&handshake); err != nil {
+			t.problem(fmt.Sprintf("handshake is not JSON: %v", err))
+			t.setResponse(nil)
+			return
+		}
+		t.setHandshake(&handshake)
+		framing = <-t.framing
+	} else {
+		var response ipc.HandshakeResponse
+		if err := decoder.Decode(&response); err != nil {
+			t.setResponse(nil)
+			return
+		}
+		t.setResponse(&response)
+		framing = response.Framing
+	}
+
+	var next func(v interface{}) error = decoder.Decode
+	if framing == ipc.FramingLengthPrefixed {
+		next = ipc.NewFrameDecoder(ipc.AfterHandshake(decoder, r), 0).Decode
+	}
+	for {
+		var message ipc.IPCMessage
+		err := next(&message)
+		if err == nil {
+			t.add(record{fromPanel: fromPanel, at: time.Now(), message: message})
+			continue
+		}
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrClosedPipe) {
+			return
+		}
+		if fromPanel {
+			t.problem(fmt.Sprintf("unreadable message: %v", err))
+		}
+		if errors.Is(err, ipc.ErrInvalidFrame) || errors.Is(err, ipc.ErrFrameTooLarge) {
+			continue
+		}
+		// A JSON-lines stream cannot be resynchronized after a syntax error
+		return
+	}
+}
+
+func (t *transcript) setHandshake(handshake *ipc.HandshakeMessage) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.handshake = handshake
+}
+
+// setResponse records the server's answer, or nil when there was none, and
+// releases everything waiting on the handshake
+func (t *transcript) setResponse(response *ipc.HandshakeResponse) {
+	t.mutex.Lock()
+	if t.responded {
+		t.mutex.Unlock()
+		return
+	}
+	t.responded = true
+	t.response = response
+	t.mutex.Unlock()
+
+	framing := ""
+	if response != nil {
+		framing = response.Framing
+	}
+	t.framing <- framing
+	close(t.handshakeDone)
+}
+
+func (t *transcript) add(r record) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.records = append(t.records, r)
+}
+
+func (t *transcript) problem(problem string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.problems = append(t.problems, problem)
+}
+
+func (t *transcript) closed() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.closedAt.IsZero() {
+		t.closedAt = time.Now()
+	}
+}
+
+func (t *transcript) handshakes() (*ipc.HandshakeMessage, *ipc.HandshakeResponse) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.handshake, t.response
+}
+
+func (t *transcript) connectedTime() time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.connectedAt
+}
+
+func (t *transcript) reconnectCount() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.reconnects
+}
+
+func (t *transcript) closedTime() time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.closedAt
+}
+
+func (t *transcript) snapshot() []record {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]record(nil), t.records...)
+}
+
+func (t *transcript) problemList() []string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return append([]string(nil), t.problems...)
+}
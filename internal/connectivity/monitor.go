@@ -0,0 +1,259 @@
+// Package connectivity probes the opencode server and the panels' IPC links
+// and reports whenever one of them goes online, degraded or offline.
+package connectivity
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Panels ping the orchestrator every 10 seconds; a link quiet for two pings
+// is degraded and one quiet for six is offline
+const (
+	PanelQuietAfter = 25 * time.Second
+	PanelGoneAfter  = 60 * time.Second
+)
+
+// ForgetAfter is how long a disconnected panel stays listed as offline.
+// Command line clients connect briefly and would otherwise pile up.
+const ForgetAfter = 5 * time.Minute
+
+// Options tune the probes
+type Options struct {
+	Interval     time.Duration // Time between probes
+	Timeout      time.Duration // Limit on one server probe
+	SlowAfter    time.Duration // Server answers slower than this are degraded
+	OfflineAfter int           // Consecutive failed server probes before offline
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{Interval: 5 * time.Second, Timeout: 3 * time.Second, SlowAfter: time.Second, OfflineAfter: 3}
+}
+
+// ServerProbe makes one request to the opencode server
+type ServerProbe func(ctx context.Context) error
+
+// PanelLink is a panel's connection as the socket server sees it
+type PanelLink struct {
+	PanelID  string
+	LastSeen time.Time // Last message received, pings included
+}
+
+// PanelsFunc lists the connected panels
+type PanelsFunc func() []PanelLink
+
+// PublishFunc receives the link health whenever a link changes status, is
+// first seen or is forgotten, together with the status changes
+type PublishFunc func(state types.ConnectionState, transitions []types.LinkTransition) error
+
+// Monitor probes the links on an interval
+type Monitor struct {
+	opts    Options
+	probe   ServerProbe
+	panels  PanelsFunc
+	publish PublishFunc
+}
+
+// NewMonitor returns a monitor; zero options take their defaults
+func NewMonitor(opts Options, probe ServerProbe, panels PanelsFunc, publish PublishFunc) *Monitor {
+	defaults := DefaultOptions()
+	if opts.Interval <= 0 {
+		opts.Interval = defaults.Interval
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.SlowAfter <= 0 {
+		opts.SlowAfter = defaults.SlowAfter
+	}
+	if opts.OfflineAfter <= 0 {
+		opts.OfflineAfter = defaults.OfflineAfter
+	}
+	return &Monitor{opts: opts, probe: probe, panels: panels, publish: publish}
+}
+
+// Run probes until ctx is cancelled, publishing only changes
+func (m *Monitor) Run(ctx context.Context) {
+	var last *types.ConnectionState
+	ticker := time.NewTicker(m.opts.Interval)
+	defer ticker.Stop()
+	for {
+		result := m.probeServer(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		next := Next(last, result, m.panels(), time.Now(), m.opts)
+		if transitions, changed := Diff(last, next); changed {
+			for _, t := range transitions {
+				log.Printf("[CONNECTIVITY] %s link %s: %q -> %q %s", t.Kind, t.Name, t.From, t.To, t.Error)
+			}
+			if err := m.publish(next, transitions); err != nil {
+				log.Printf("[CONNECTIVITY] Failed to publish link health: %v", err)
+			} else {
+				last = &next
+			}
+		} else if last != nil {
+			// Keep latency and failure counts current without publishing
+			last = &next
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ProbeResult is the outcome of one server probe
+type ProbeResult struct {
+	Latency time.Duration
+	Err     error
+}
+
+func (m *Monitor) probeServer(ctx context.Context) ProbeResult {
+	ctx, cancel := context.WithTimeout(ctx, m.opts.Timeout)
+	defer cancel()
+	start := time.Now()
+	err := m.probe(ctx)
+	return ProbeResult{Latency: time.Since(start), Err: err}
+}
+
+// Next derives the link health from the previous one, a server probe and
+// the connected panels
+func Next(prev *types.ConnectionState, server ProbeResult, panels []PanelLink, now time.Time, opts Options) types.ConnectionState {
+	next := types.ConnectionState{CheckedAt: now}
+
+	var prevServer *types.LinkState
+	if prev != nil {
+		prevServer = &prev.Server
+	}
+	link := types.LinkState{Name: types.LinkServer, Kind: types.LinkServer}
+	if prevServer != nil {
+		link.LastOK = prevServer.LastOK
+		link.Failures = prevServer.Failures
+	}
+	if server.Err != nil {
+		link.Failures++
+		link.Error = server.Err.Error()
+		link.Status = types.LinkDegraded
+		if link.Failures >= opts.OfflineAfter {
+			link.Status = types.LinkOffline
+		}
+	} else {
+		link.Failures = 0
+		link.Latency = server.Latency
+		link.LastOK = now
+		link.Status = types.LinkOnline
+		if server.Latency > opts.SlowAfter {
+			link.Status = types.LinkDegraded
+		}
+	}
+	next.Server = keepSince(link, prevServer, now)
+
+	// A panel reconnecting gets a new connection under the same panel ID
+	lastSeen := make(map[string]time.Time, len(panels))
+	for _, panel := range panels {
+		if seen, ok := lastSeen[panel.PanelID]; !ok || panel.LastSeen.After(seen) {
+			lastSeen[panel.PanelID] = panel.LastSeen
+		}
+	}
+	previous := make(map[string]*types.LinkState)
+	if prev != nil {
+		for i := range prev.Panels {
+			previous[prev.Panels[i].Name] = &prev.Panels[i]
+		}
+	}
+	for id, seen := range lastSeen {
+		link := types.LinkState{Name: id, Kind: types.LinkIPC, LastOK: seen}
+		switch quiet := now.Sub(seen); {
+		case quiet > PanelGoneAfter:
+			link.Status = types.LinkOffline
+			link.Error = "no messages for " + quiet.Round(time.Second).String()
+		case quiet > PanelQuietAfter:
+			link.Status = types.LinkDegraded
+			link.Error = "no messages for " + quiet.Round(time.Second).String()
+		default:
+			link.Status = types.LinkOnline
+		}
+		next.Panels = append(next.Panels, keepSince(link, previous[id], now))
+	}
+	for id, old := range previous {
+		if _, connected := lastSeen[id]; connected {
+			continue
+		}
+		if old.Status == types.LinkOffline && now.Sub(old.Since) > ForgetAfter {
+			continue
+		}
+		link := *old
+		link.Status = types.LinkOffline
+		link.Error = "disconnected"
+		next.Panels = append(next.Panels, keepSince(link, old, now))
+	}
+	sort.Slice(next.Panels, func(i, j int) bool { return next.Panels[i].Name < next.Panels[j].Name })
+
+	next.Status = next.Server.Status
+	if next.Status == types.LinkOnline {
+		for _, panel := range next.Panels {
+			if panel.Status != types.LinkOnline {
+				next.Status = types.LinkDegraded
+				break
+			}
+		}
+	}
+	return next
+}
+
+// keepSince carries over when the link entered its status
+func keepSince(link types.LinkState, prev *types.LinkState, now time.Time) types.LinkState {
+	if prev != nil && prev.Status == link.Status {
+		link.Since = prev.Since
+	} else {
+		link.Since = now
+	}
+	return link
+}
+
+// Diff lists the links whose status changed and reports whether the health
+// is worth publishing: a status changed, or a link appeared or was forgotten
+func Diff(prev *types.ConnectionState, next types.ConnectionState) ([]types.LinkTransition, bool) {
+	if prev == nil {
+		transitions := []types.LinkTransition{transition(nil, next.Server, next.CheckedAt)}
+		for _, panel := range next.Panels {
+			transitions = append(transitions, transition(nil, panel, next.CheckedAt))
+		}
+		return transitions, true
+	}
+
+	var transitions []types.LinkTransition
+	if prev.Server.Status != next.Server.Status {
+		transitions = append(transitions, transition(&prev.Server, next.Server, next.CheckedAt))
+	}
+	previous := make(map[string]types.LinkState, len(prev.Panels))
+	for _, panel := range prev.Panels {
+		previous[panel.Name] = panel
+	}
+	for _, panel := range next.Panels {
+		old, ok := previous[panel.Name]
+		switch {
+		case !ok:
+			transitions = append(transitions, transition(nil, panel, next.CheckedAt))
+		case old.Status != panel.Status:
+			transitions = append(transitions, transition(&old, panel, next.CheckedAt))
+		}
+	}
+	return transitions, len(transitions) > 0 || len(prev.Panels) != len(next.Panels) || prev.Status != next.Status
+}
+
+func transition(from *types.LinkState, to types.LinkState, at time.Time) types.LinkTransition {
+	t := types.LinkTransition{Name: to.Name, Kind: to.Kind, To: to.Status, Error: to.Error, At: at}
+	if from != nil {
+		t.From = from.Status
+	}
+	return t
+}
@@ -0,0 +1,110 @@
+package connectivity
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestNextServer(t *testing.T) {
+	opts := DefaultOptions()
+	now := time.Now()
+	down := errors.New("connection refused")
+
+	tests := []struct {
+		name   string
+		probes []ProbeResult
+		want   []string
+	}{
+		{"fast answers", []ProbeResult{{Latency: time.Millisecond}}, []string{types.LinkOnline}},
+		{"slow answer", []ProbeResult{{Latency: 2 * time.Second}}, []string{types.LinkDegraded}},
+		{
+			name:   "offline after repeated failures",
+			probes: []ProbeResult{{}, {Err: down}, {Err: down}, {Err: down}},
+			want:   []string{types.LinkOnline, types.LinkDegraded, types.LinkDegraded, types.LinkOffline},
+		},
+		{
+			name:   "one answer brings it back",
+			probes: []ProbeResult{{Err: down}, {Err: down}, {Err: down}, {}},
+			want:   []string{types.LinkDegraded, types.LinkDegraded, types.LinkOffline, types.LinkOnline},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var prev *types.ConnectionState
+			for i, probe := range tc.probes {
+				next := Next(prev, probe, nil, now.Add(time.Duration(i)*time.Second), opts)
+				if next.Server.Status != tc.want[i] || next.Status != tc.want[i] {
+					t.Errorf("probe %d: server %s, overall %s, want %s", i, next.Server.Status, next.Status, tc.want[i])
+				}
+				prev = &next
+			}
+		})
+	}
+}
+
+func TestNextPanels(t *testing.T) {
+	opts := DefaultOptions()
+	now := time.Now()
+	panels := []PanelLink{
+		{PanelID: "input", LastSeen: now.Add(-time.Second)},
+		{PanelID: "messages", LastSeen: now.Add(-30 * time.Second)},
+		{PanelID: "sessions", LastSeen: now.Add(-2 * time.Minute)},
+		// An older connection of a panel that has since reconnected
+		{PanelID: "input", LastSeen: now.Add(-10 * time.Minute)},
+	}
+	first := Next(nil, ProbeResult{}, panels, now, opts)
+	want := map[string]string{"input": types.LinkOnline, "messages": types.LinkDegraded, "sessions": types.LinkOffline}
+	if len(first.Panels) != len(want) {
+		t.Fatalf("panels = %+v", first.Panels)
+	}
+	for _, panel := range first.Panels {
+		if panel.Status != want[panel.Name] {
+			t.Errorf("panel %s = %s, want %s", panel.Name, panel.Status, want[panel.Name])
+		}
+	}
+	if first.Status != types.LinkDegraded {
+		t.Errorf("overall = %s, want degraded while a panel link is not online", first.Status)
+	}
+	transitions, changed := Diff(nil, first)
+	if !changed || len(transitions) != 4 {
+		t.Errorf("first report transitions = %+v", transitions)
+	}
+
+	// The input panel disconnects; it stays listed as offline until forgotten
+	later := now.Add(time.Second)
+	second := Next(&first, ProbeResult{}, panels[1:3], later, opts)
+	transitions, changed = Diff(&first, second)
+	if !changed || len(transitions) != 1 || transitions[0].Name != "input" || transitions[0].From != types.LinkOnline || transitions[0].To != types.LinkOffline {
+		t.Errorf("disconnect transitions = %+v", transitions)
+	}
+	if _, changed := Diff(&second, Next(&second, ProbeResult{}, panels[1:3], later.Add(time.Second), opts)); changed {
+		t.Errorf("unchanged links reported as changed")
+	}
+
+	forgotten := Next(&second, ProbeResult{}, panels[1:3], later.Add(ForgetAfter+time.Second), opts)
+	for _, panel := range forgotten.Panels {
+		if panel.Name == "input" {
+			t.Errorf("disconnected panel still listed after %v", ForgetAfter)
+		}
+	}
+	if _, changed := Diff(&second, forgotten); !changed {
+		t.Errorf("forgetting a panel not reported")
+	}
+}
+
+func TestSinceTracksStatusChanges(t *testing.T) {
+	opts := DefaultOptions()
+	start := time.Now()
+	first := Next(nil, ProbeResult{}, nil, start, opts)
+	second := Next(&first, ProbeResult{Latency: time.Millisecond}, nil, start.Add(time.Minute), opts)
+	if !second.Server.Since.Equal(start) {
+		t.Errorf("since = %v, want kept at %v while online", second.Server.Since, start)
+	}
+	third := Next(&second, ProbeResult{Err: errors.New("timeout")}, nil, start.Add(2*time.Minute), opts)
+	if !third.Server.Since.Equal(start.Add(2*time.Minute)) || !third.Server.LastOK.Equal(start.Add(time.Minute)) {
+		t.Errorf("after failure since = %v, last ok = %v", third.Server.Since, third.Server.LastOK)
+	}
+}
@@ -0,0 +1,127 @@
+// Package contextgauge estimates how much of a model's context window a
+// conversation takes, so panels can warn before requests get truncated.
+package contextgauge
+
+import (
+	"github.com/sst/opencode-sdk-go"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// CharsPerToken is the rough ratio used for text no provider has counted yet
+const CharsPerToken = 4
+
+// Measured is the context size a provider reported with one reply
+type Measured struct {
+	MessageID string
+	Tokens    int
+}
+
+// ReplyTokens returns the context a reply's usage says the next request will
+// carry: everything sent plus the reply itself. Reasoning is not sent back.
+func ReplyTokens(tokens opencode.AssistantMessageTokens) int {
+	return int(tokens.Input + tokens.Cache.Read + tokens.Cache.Write + tokens.Output)
+}
+
+// Estimate returns the tokens a session's conversation takes: the size last
+// measured plus a guess for the messages after that reply, or a guess for the
+// whole session when nothing was measured. estimated is set when any part was
+// guessed.
+func Estimate(messages []types.MessageInfo, sessionID string, measured Measured) (tokens int, estimated bool) {
+	counting := measured.MessageID == ""
+	if !counting {
+		found := false
+		for _, msg := range messages {
+			if msg.ID == measured.MessageID && msg.SessionID == sessionID {
+				found = true
+				break
+			}
+		}
+		// The measured reply was cleared or compacted away
+		counting = !found
+	}
+	if !counting {
+		tokens = measured.Tokens
+	}
+
+	chars := 0
+	for _, msg := range messages {
+		if msg.SessionID != sessionID {
+			continue
+		}
+		if !counting {
+			counting = msg.ID == measured.MessageID
+			continue
+		}
+		if msg.Type == "system" {
+			// Local notes such as terminal transcripts are never sent
+			continue
+		}
+		if msg.Content != "" {
+			chars += len(msg.Content)
+		} else {
+			chars += msg.BodySize
+		}
+	}
+	if chars > 0 {
+		tokens += (chars + CharsPerToken - 1) / CharsPerToken
+		estimated = true
+	}
+	return tokens, estimated
+}
+
+// Catalog holds context window sizes by model
+type Catalog map[types.ModelRef]int
+
+// CatalogFromProviders reads the context limits of every listed model
+func CatalogFromProviders(response *opencode.AppProvidersResponse) Catalog {
+	catalog := make(Catalog)
+	if response == nil {
+		return catalog
+	}
+	for _, provider := range response.Providers {
+		for id, model := range provider.Models {
+			if model.Limit.Context > 0 {
+				catalog[types.ModelRef{ProviderID: provider.ID, ModelID: id}] = int(model.Limit.Context)
+			}
+		}
+	}
+	return catalog
+}
+
+var levelRank = map[string]int{
+	types.ContextLevelOK:       0,
+	types.ContextLevelWarning:  1,
+	types.ContextLevelCritical: 2,
+}
+
+// Changed reports whether next differs enough from prev to be worth storing:
+// another session, model or level, or tokens moved by at least 1% of the
+// window. Streaming replies would otherwise update state on every chunk.
+func Changed(prev *types.ContextUsage, next types.ContextUsage) bool {
+	if prev == nil {
+		return true
+	}
+	if prev.SessionID != next.SessionID || prev.Model != next.Model || prev.Limit != next.Limit ||
+		prev.Level != next.Level || prev.Estimated != next.Estimated {
+		return true
+	}
+	step := next.Limit / 100
+	if step < 1000 {
+		step = 1000
+	}
+	delta := next.Tokens - prev.Tokens
+	return delta >= step || -delta >= step
+}
+
+// Crossed reports whether usage rose to a more severe level in the same
+// session, which is when panels should warn
+func Crossed(prev *types.ContextUsage, next types.ContextUsage) bool {
+	if next.Level == types.ContextLevelOK {
+		return false
+	}
+	if prev == nil || prev.SessionID != next.SessionID {
+		return true
+	}
+	return levelRank[next.Level] > levelRank[prev.Level]
+}
@@ -0,0 +1,78 @@
+package contextgauge
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestEstimate(t *testing.T) {
+	messages := []types.MessageInfo{
+		{ID: "u1", SessionID: "s", Type: "user", Content: strings.Repeat("a", 40)},
+		{ID: "a1", SessionID: "s", Type: "assistant", Content: strings.Repeat("b", 400)},
+		{ID: "x1", SessionID: "other", Type: "user", Content: strings.Repeat("c", 4000)},
+		{ID: "n1", SessionID: "s", Type: "system", Content: strings.Repeat("d", 4000)},
+		{ID: "u2", SessionID: "s", Type: "user", BodySize: 80},
+	}
+	tests := []struct {
+		name          string
+		measured      Measured
+		wantTokens    int
+		wantEstimated bool
+	}{
+		{"nothing measured", Measured{}, 10 + 100 + 20, true},
+		{"measured reply plus later messages", Measured{MessageID: "a1", Tokens: 5000}, 5000 + 20, true},
+		{"measured reply no longer in the session", Measured{MessageID: "gone", Tokens: 5000}, 130, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tokens, estimated := Estimate(messages, "s", tc.measured)
+			if tokens != tc.wantTokens || estimated != tc.wantEstimated {
+				t.Errorf("Estimate() = %d, %t, want %d, %t", tokens, estimated, tc.wantTokens, tc.wantEstimated)
+			}
+		})
+	}
+
+	if tokens, estimated := Estimate(messages[:2], "s", Measured{MessageID: "a1", Tokens: 700}); tokens != 700 || estimated {
+		t.Errorf("Estimate() with nothing after the measured reply = %d, %t, want 700, false", tokens, estimated)
+	}
+}
+
+func TestChangedAndCrossed(t *testing.T) {
+	model := types.ModelRef{ProviderID: "anthropic", ModelID: "large"}
+	usage := func(session string, tokens int) types.ContextUsage {
+		u := types.ContextUsage{SessionID: session, Model: model, Tokens: tokens, Limit: 200000}
+		u.Level = types.ContextLevel(u.Percent())
+		return u
+	}
+	ptr := func(u types.ContextUsage) *types.ContextUsage { return &u }
+
+	tests := []struct {
+		name        string
+		prev        *types.ContextUsage
+		next        types.ContextUsage
+		wantChanged bool
+		wantCrossed bool
+	}{
+		{"first measurement", nil, usage("s", 1000), true, false},
+		{"first measurement already high", nil, usage("s", 170000), true, true},
+		{"small growth", ptr(usage("s", 1000)), usage("s", 2500), false, false},
+		{"growth of 1%", ptr(usage("s", 1000)), usage("s", 3000), true, false},
+		{"reaches warning", ptr(usage("s", 150000)), usage("s", 160000), true, true},
+		{"reaches critical", ptr(usage("s", 160000)), usage("s", 190000), true, true},
+		{"stays critical", ptr(usage("s", 190000)), usage("s", 195000), true, false},
+		{"drops after compaction", ptr(usage("s", 190000)), usage("s", 20000), true, false},
+		{"session switch to a full one", ptr(usage("s", 190000)), usage("t", 190000), true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Changed(tc.prev, tc.next); got != tc.wantChanged {
+				t.Errorf("Changed() = %t, want %t", got, tc.wantChanged)
+			}
+			if got := Crossed(tc.prev, tc.next); got != tc.wantCrossed {
+				t.Errorf("Crossed() = %t, want %t", got, tc.wantCrossed)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Package crashreport assembles crash bundles: when a panel crashes or a state
+// file is found corrupt, what the orchestrator knew at the time (recent
+// events, metrics, health checks, the end of each log and a checksum report)
+// is written to one timestamped .tar.gz that can be attached to a bug report.
+package crashreport
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/supervision"
+)
+
+// What triggered a bundle
+const (
+	KindPanelCrash      = "panel_crash"
+	KindStateCorruption = "state_corruption"
+)
+
+// Defaults for Options left zero
+const (
+	DefaultKeep        = 10
+	DefaultLogLines    = 200
+	DefaultMinInterval = 10 * time.Minute
+)
+
+// ErrSuppressed is returned for a trigger too soon after the last bundle for
+// the same subject, such as a panel in a crash loop
+var ErrSuppressed = errors.New("a crash bundle was written for this recently")
+
+// Trigger is what went wrong
+type Trigger struct {
+	Kind    string    `json:"kind"`
+	Subject string    `json:"subject"` // The panel, or the corrupt file
+	Detail  string    `json:"detail,omitempty"`
+	At      time.Time `json:"at"`
+}
+
+// Section is one JSON file in a bundle
+type Section struct {
+	Name  string // File name without extension, e.g. "events"
+	Value interface{}
+}
+
+// Log is a log file whose end is copied into a bundle
+type Log struct {
+	Name string // File name in the bundle's logs directory, without extension
+	Path string
+}
+
+// Contents is what the orchestrator collected for a bundle
+type Contents struct {
+	Session  string
+	Sections []Section
+	Logs     []Log
+}
+
+// Manifest is the bundle's index, written first as manifest.json
+type Manifest struct {
+	Trigger   Trigger   `json:"trigger"`
+	Session   string    `json:"session,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	Files     []string  `json:"files"`
+	Errors    []string  `json:"errors,omitempty"` // Parts that could not be collected
+}
+
+// Options configure a Writer
+type Options struct {
+	Keep        int           // Newest bundles kept in the directory
+	LogLines    int           // Lines taken from the end of each log
+	MinInterval time.Duration // Shortest time between bundles for one kind and subject
+}
+
+// Writer writes bundles to a directory, pruning old ones
+type Writer struct {
+	dir   string
+	opts  Options
+	mutex sync.Mutex
+	last  map[string]time.Time // Last bundle per kind and subject
+}
+
+// NewWriter returns a Writer storing bundles in dir
+func NewWriter(dir string, opts Options) *Writer {
+	if opts.Keep <= 0 {
+		opts.Keep = DefaultKeep
+	}
+	if opts.LogLines <= 0 {
+		opts.LogLines = DefaultLogLines
+	}
+	if opts.MinInterval == 0 {
+		opts.MinInterval = DefaultMinInterval
+	}
+	return &Writer{dir: dir, opts: opts, last: make(map[string]time.Time)}
+}
+
+// Dir is where bundles are written
+func (w *Writer) Dir() string {
+	return w.dir
+}
+
+// Write collects a bundle for trigger and returns the archive's path. collect
+// is only called when the bundle is not suppressed, so a crash loop costs one
+// collection per interval.
+func (w *Writer) Write(trigger Trigger, collect func() Contents) (string, error) {
+	if trigger.At.IsZero() {
+		trigger.At = time.Now()
+	}
+	key := trigger.Kind + "/" + trigger.Subject
+	w.mutex.Lock()
+	if last, ok := w.last[key]; ok && trigger.At.Sub(last) < w.opts.MinInterval {
+		w.mutex.Unlock()
+		return "", ErrSuppressed
+	}
+	w.last[key] = trigger.At
+	w.mutex.Unlock()
+
+	if err := os.MkdirAll(w.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create crash report directory: %w", err)
+	}
+	name := bundleName(trigger)
+	path := filepath.Join(w.dir, name+".tar.gz")
+	if err := w.writeArchive(path, name, trigger, collect()); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	w.prune()
+	return path, nil
+}
+
+// unsafeName matches what is replaced in a subject to name its bundle
+var unsafeName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// bundleName names a bundle after when and why it was written, so bundles
+// sort by time
+func bundleName(trigger Trigger) string {
+	subject := strings.Trim(unsafeName.ReplaceAllString(trigger.Subject, "_"), "._")
+	if subject == "" {
+		subject = "unknown"
+	}
+	return fmt.Sprintf("crash-%s-%s-%s", trigger.At.UTC().Format("20060102T150405.000Z"), trigger.Kind, subject)
+}
+
+// writeArchive writes the bundle's files under a directory named name
+func (w *Writer) writeArchive(path, name string, trigger Trigger, contents Contents) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create crash bundle: %w", err)
+	}
+	defer file.Close()
+	gz := gzip.NewWriter(file)
+	archive := tar.NewWriter(gz)
+
+	manifest := Manifest{Trigger: trigger, Session: contents.Session, CreatedAt: time.Now()}
+	files := make(map[string][]byte)
+	for _, section := range contents.Sections {
+		data, err := json.MarshalIndent(section.Value, "", "  ")
+		if err != nil {
+			manifest.Errors = append(manifest.Errors, fmt.Sprintf("%s: %v", section.Name, err))
+			continue
+		}
+		files[section.Name+".json"] = data
+	}
+	for _, log := range contents.Logs {
+		lines, err := supervision.TailLines(log.Path, w.opts.LogLines)
+		if err != nil {
+			if !os.IsNotExist(err) {
+				manifest.Errors = append(manifest.Errors, fmt.Sprintf("log %s: %v", log.Name, err))
+			}
+			continue
+		}
+		files["logs/"+log.Name+".log"] = []byte(strings.Join(lines, "\n") + "\n")
+	}
+	for file := range files {
+		manifest.Files = append(manifest.Files, file)
+	}
+	sort.Strings(manifest.Files)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := addFile(archive, name+"/manifest.json", data, manifest.CreatedAt); err != nil {
+		return err
+	}
+	for _, file := range manifest.Files {
+		if err := addFile(archive, name+"/"+file, files[file], manifest.CreatedAt); err != nil {
+			return err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %w", err)
+	}
+	return file.Close()
+}
+
+func addFile(archive *tar.Writer, name string, data []byte, modTime time.Time) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}
+	if err := archive.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %w", err)
+	}
+	if _, err := archive.Write(data); err != nil {
+		return fmt.Errorf("failed to write crash bundle: %w", err)
+	}
+	return nil
+}
+
+// prune removes all but the newest Keep bundles
+func (w *Writer) prune() {
+	bundles, err := List(w.dir)
+	if err != nil || len(bundles) <= w.opts.Keep {
+		return
+	}
+	for _, path := range bundles[:len(bundles)-w.opts.Keep] {
+		os.Remove(path)
+	}
+}
+
+// List returns the bundles in dir, oldest first
+func List(dir string) ([]string, error) {
+	bundles, err := filepath.Glob(filepath.Join(dir, "crash-*.tar.gz"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(bundles)
+	return bundles, nil
+}
@@ -0,0 +1,142 @@
+package crashreport
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readBundle returns the files of a bundle by their path inside it
+func readBundle(t *testing.T, path string) map[string]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive := tar.NewReader(gz)
+	files := make(map[string]string)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(archive)
+		files[header.Name] = string(data)
+	}
+}
+
+func TestWriteBundle(t *testing.T) {
+	dir := t.TempDir()
+	panelLog := filepath.Join(dir, "input.log")
+	os.WriteFile(panelLog, []byte("one\ntwo\npanic: boom\n"), 0600)
+
+	w := NewWriter(filepath.Join(dir, "crash"), Options{LogLines: 2})
+	trigger := Trigger{Kind: KindPanelCrash, Subject: "input", Detail: "pane dead", At: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)}
+	path, err := w.Write(trigger, func() Contents {
+		return Contents{
+			Session: "demo",
+			Sections: []Section{
+				{Name: "metrics", Value: map[string]int{"updates": 3}},
+				{Name: "broken", Value: func() {}},
+			},
+			Logs: []Log{{Name: "input", Path: panelLog}, {Name: "missing", Path: filepath.Join(dir, "none.log")}},
+		}
+	})
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if want := "crash-20260102T030405.000Z-panel_crash-input.tar.gz"; filepath.Base(path) != want {
+		t.Errorf("bundle = %s, want %s", filepath.Base(path), want)
+	}
+
+	files := readBundle(t, path)
+	root := strings.TrimSuffix(filepath.Base(path), ".tar.gz") + "/"
+	if got := files[root+"logs/input.log"]; got != "two\npanic: boom\n" {
+		t.Errorf("input log = %q, want its last 2 lines", got)
+	}
+	if got := files[root+"metrics.json"]; !strings.Contains(got, `"updates": 3`) {
+		t.Errorf("metrics = %q", got)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal([]byte(files[root+"manifest.json"]), &manifest); err != nil {
+		t.Fatalf("manifest: %v", err)
+	}
+	if manifest.Trigger != trigger || manifest.Session != "demo" {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if want := []string{"logs/input.log", "metrics.json"}; !reflect.DeepEqual(manifest.Files, want) {
+		t.Errorf("files = %v, want %v", manifest.Files, want)
+	}
+	// A section that cannot be encoded is noted; a log that does not exist yet is not
+	if len(manifest.Errors) != 1 || !strings.HasPrefix(manifest.Errors[0], "broken:") {
+		t.Errorf("errors = %v, want one for the broken section", manifest.Errors)
+	}
+}
+
+func TestWriteSuppressesRepeats(t *testing.T) {
+	w := NewWriter(t.TempDir(), Options{MinInterval: time.Minute})
+	start := time.Now()
+	collected := 0
+	collect := func() Contents {
+		collected++
+		return Contents{}
+	}
+
+	tests := []struct {
+		name    string
+		trigger Trigger
+		wantErr error
+	}{
+		{"first crash", Trigger{Kind: KindPanelCrash, Subject: "input", At: start}, nil},
+		{"crash loop", Trigger{Kind: KindPanelCrash, Subject: "input", At: start.Add(30 * time.Second)}, ErrSuppressed},
+		{"another panel", Trigger{Kind: KindPanelCrash, Subject: "messages", At: start.Add(30 * time.Second)}, nil},
+		{"after the interval", Trigger{Kind: KindPanelCrash, Subject: "input", At: start.Add(2 * time.Minute)}, nil},
+	}
+	for _, tt := range tests {
+		if _, err := w.Write(tt.trigger, collect); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Write() error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+	if collected != 3 {
+		t.Errorf("collected %d times, want 3: suppressed bundles are not collected", collected)
+	}
+}
+
+func TestWritePrunesOldBundles(t *testing.T) {
+	dir := t.TempDir()
+	w := NewWriter(dir, Options{Keep: 2})
+	start := time.Now()
+	for i := 0; i < 4; i++ {
+		trigger := Trigger{Kind: KindStateCorruption, Subject: "state.json", At: start.Add(time.Duration(i) * time.Hour)}
+		if _, err := w.Write(trigger, func() Contents { return Contents{} }); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+	bundles, err := List(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(bundles) != 2 {
+		t.Fatalf("kept %d bundles, want 2", len(bundles))
+	}
+	if want := bundleName(Trigger{Kind: KindStateCorruption, Subject: "state.json", At: start.Add(3 * time.Hour)}); !strings.Contains(bundles[1], want) {
+		t.Errorf("newest bundle = %s, want %s", bundles[1], want)
+	}
+}
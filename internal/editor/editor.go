@@ -0,0 +1,239 @@
+// Package editor opens text in the user's editor in a tmux popup, or in a
+// pane when no popup can be shown, and hands back what was saved.
+package editor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/shellquote"
+)
+
+// pollInterval is how often an open editor is checked on
+const pollInterval = 200 * time.Millisecond
+
+// popupStartWait is how long a popup gets to fail before it counts as open
+const popupStartWait = 500 * time.Millisecond
+
+// Command returns the editor to run: $VISUAL, else $EDITOR, else vi
+func Command() string {
+	for _, name := range []string{"VISUAL", "EDITOR"} {
+		if editor := strings.TrimSpace(os.Getenv(name)); editor != "" {
+			return editor
+		}
+	}
+	return "vi"
+}
+
+// Spec describes one edit
+type Spec struct {
+	ID     string // Names the edited file
+	Text   string // Text the editor starts with
+	Editor string // Shell command the file name is appended to; Command() when empty
+	Target string // Pane the popup opens over, or the pane to split
+	Dir    string // Working directory of the editor
+	Popup  bool   // Open a popup; a pane is split when false or when popups fail
+	Size   string // Popup width and height, or pane height, e.g. "80%"
+}
+
+// Editor opens edits in tmux, keeping the edited files in dir
+type Editor struct {
+	tmux string
+	dir  string
+}
+
+// New returns an editor using the given tmux binary
+func New(tmuxCommand, dir string) *Editor {
+	return &Editor{tmux: tmuxCommand, dir: dir}
+}
+
+// Edit opens spec.Text in the editor and waits for the editor to exit. It
+// returns the text saved, and false when the text is unchanged or the editor
+// failed, as vim does when quit with :cq.
+func (e *Editor) Edit(ctx context.Context, spec Spec) (string, bool, error) {
+	if spec.ID == "" || strings.ContainsAny(spec.ID, "/\\ ") {
+		return "", false, fmt.Errorf("invalid edit id %q", spec.ID)
+	}
+	if err := os.MkdirAll(e.dir, 0o700); err != nil {
+		return "", false, fmt.Errorf("create edit directory: %w", err)
+	}
+	path := filepath.Join(e.dir, spec.ID+".md")
+	exitPath := filepath.Join(e.dir, spec.ID+".exit")
+	defer os.Remove(path)
+	defer os.Remove(exitPath)
+	if err := os.WriteFile(path, []byte(spec.Text), 0o600); err != nil {
+		return "", false, fmt.Errorf("write edit file: %w", err)
+	}
+	os.Remove(exitPath)
+
+	command := spec.Editor
+	if strings.TrimSpace(command) == "" {
+		command = Command()
+	}
+	script := fmt.Sprintf("%s %s; printf %%s $? > %s", command, shellquote.Quote(path), shellquote.Quote(exitPath))
+	// The script is POSIX; hand it to sh whatever tmux's default-shell is
+	script = "sh -c " + shellquote.Quote(script)
+
+	paneID := ""
+	var popupClosed <-chan error
+	var err error
+	if spec.Popup {
+		popupClosed = e.openPopup(ctx, spec, script)
+	}
+	if popupClosed == nil {
+		if paneID, err = e.openPane(ctx, spec, script); err != nil {
+			return "", false, err
+		}
+	}
+
+	code, err := e.wait(ctx, exitPath, paneID, popupClosed)
+	if err != nil {
+		return "", false, err
+	}
+	if code != 0 {
+		return "", false, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", false, fmt.Errorf("read edit file: %w", err)
+	}
+	text := string(data)
+	// Editors end the file with a newline the prompt did not have
+	if !strings.HasSuffix(spec.Text, "\n") {
+		text = strings.TrimSuffix(text, "\n")
+	}
+	if text == spec.Text {
+		return "", false, nil
+	}
+	return text, true, nil
+}
+
+// openPopup shows the editor in a popup over spec.Target and returns a
+// channel that receives once the popup closes. It returns nil when tmux
+// refuses, as tmux before 3.2 does or with no client attached.
+func (e *Editor) openPopup(ctx context.Context, spec Spec, script string) <-chan error {
+	args := []string{"display-popup", "-E"}
+	if spec.Target != "" {
+		args = append(args, "-t", spec.Target)
+	}
+	if spec.Size != "" {
+		args = append(args, "-w", spec.Size, "-h", spec.Size)
+	}
+	if spec.Dir != "" {
+		args = append(args, "-d", spec.Dir)
+	}
+	cmd := exec.CommandContext(ctx, e.tmux, append(args, script)...)
+	if err := cmd.Start(); err != nil {
+		return nil
+	}
+	// A popup may hold the command until it closes, so only an early failure counts
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		if err != nil {
+			return nil
+		}
+		done <- nil
+		return done
+	case <-time.After(popupStartWait):
+		return done
+	}
+}
+
+// openPane splits spec.Target for the editor and focuses it
+func (e *Editor) openPane(ctx context.Context, spec Spec, script string) (string, error) {
+	args := []string{"split-window", "-P", "-F", "#{pane_id}"}
+	if spec.Target != "" {
+		args = append(args, "-t", spec.Target)
+	}
+	if spec.Size != "" {
+		args = append(args, "-l", spec.Size)
+	}
+	if spec.Dir != "" {
+		args = append(args, "-c", spec.Dir)
+	}
+	out, err := e.tmuxOutput(ctx, append(args, script)...)
+	if err != nil {
+		return "", fmt.Errorf("open editor pane: %w", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// wait polls for the editor's exit status. An editor pane closed by hand
+// never writes one, so paneID, when set, is checked on too. A popup closed
+// without a status, when popupClosed is set, counts as a cancelled edit.
+func (e *Editor) wait(ctx context.Context, exitPath, paneID string, popupClosed <-chan error) (int, error) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			if paneID != "" {
+				e.tmuxOutput(context.Background(), "kill-pane", "-t", paneID)
+			}
+			return -1, ctx.Err()
+		case <-popupClosed:
+			code, ok, err := readExitStatus(exitPath)
+			if err != nil || ok {
+				return code, err
+			}
+			return -1, nil
+		case <-ticker.C:
+		}
+
+		code, ok, err := readExitStatus(exitPath)
+		if err != nil || ok {
+			return code, err
+		}
+		if paneID != "" && !e.paneAlive(ctx, paneID) {
+			if _, err := os.Stat(exitPath); err == nil {
+				continue // Exited between the two checks
+			}
+			return -1, fmt.Errorf("editor pane %s closed before the editor exited", paneID)
+		}
+	}
+}
+
+// readExitStatus reads the status the editor script wrote, reporting false
+// while there is none
+func readExitStatus(exitPath string) (int, bool, error) {
+	data, err := os.ReadFile(exitPath)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return -1, false, nil
+	}
+	if err != nil {
+		return -1, false, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return -1, false, fmt.Errorf("invalid exit status %q", data)
+	}
+	return code, true, nil
+}
+
+func (e *Editor) paneAlive(ctx context.Context, paneID string) bool {
+	out, err := e.tmuxOutput(ctx, "display-message", "-p", "-t", paneID, "#{pane_id}")
+	return err == nil && strings.TrimSpace(string(out)) == paneID
+}
+
+func (e *Editor) tmuxOutput(ctx context.Context, args ...string) ([]byte, error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(cmdCtx, e.tmux, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return out, err
+	}
+	return out, nil
+}
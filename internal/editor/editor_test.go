@@ -0,0 +1,101 @@
+package editor
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCommand(t *testing.T) {
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "nano")
+	if got := Command(); got != "nano" {
+		t.Errorf("Command() = %q, want $EDITOR", got)
+	}
+	t.Setenv("VISUAL", "code --wait")
+	if got := Command(); got != "code --wait" {
+		t.Errorf("Command() = %q, want $VISUAL", got)
+	}
+	t.Setenv("VISUAL", "")
+	t.Setenv("EDITOR", "")
+	if got := Command(); got != "vi" {
+		t.Errorf("Command() = %q, want vi", got)
+	}
+}
+
+func TestEdit(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// A private tmux server, so the test never touches the user's sessions
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("TMUX", "")
+	if out, err := exec.Command("tmux", "new-session", "-d", "-s", "editor-test", "-x", "120", "-y", "40").CombinedOutput(); err != nil {
+		t.Skipf("cannot start tmux: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+
+	e := New("tmux", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		id, editor, want string
+		saved            bool
+	}{
+		{"saved", "sed -i s/draft/final/", "final prompt", true},
+		{"unchanged", "true", "", false},
+		{"failed", "sh -c 'echo changed > \"$0\"; exit 1'", "", false},
+	} {
+		// No client is attached, so the popup fails and a pane opens instead
+		text, saved, err := e.Edit(ctx, Spec{ID: tc.id, Text: "draft prompt", Editor: tc.editor, Target: "editor-test", Popup: true})
+		if err != nil {
+			t.Fatalf("Edit(%s) error = %v", tc.id, err)
+		}
+		if text != tc.want || saved != tc.saved {
+			t.Errorf("Edit(%s) = %q, %v; want %q, %v", tc.id, text, saved, tc.want, tc.saved)
+		}
+	}
+
+	// The editor must start under a default-shell that is not POSIX, like fish
+	fakeShell := filepath.Join(t.TempDir(), "notposix")
+	script := "#!/bin/sh\ncase \"$2\" in \"sh -c '\"*) eval \"exec $2\" ;; *) exit 127 ;; esac\n"
+	if err := os.WriteFile(fakeShell, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("tmux", "set-option", "-g", "default-shell", fakeShell).CombinedOutput(); err != nil {
+		t.Fatalf("set default-shell: %v: %s", err, out)
+	}
+	if text, saved, err := e.Edit(ctx, Spec{ID: "fish", Text: "draft prompt", Editor: "sed -i s/draft/final/", Target: "editor-test"}); err != nil || !saved || text != "final prompt" {
+		t.Errorf("Edit(fish) = %q, %v, %v; want the saved text", text, saved, err)
+	}
+
+	if _, _, err := e.Edit(ctx, Spec{ID: "bad id", Editor: "true"}); err == nil {
+		t.Error("Edit() accepted an id with a space")
+	}
+}
+
+func TestWaitPopupClosed(t *testing.T) {
+	e := New("tmux", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A popup closed before the editor wrote its status is a cancelled edit
+	closed := make(chan error, 1)
+	closed <- nil
+	if code, err := e.wait(ctx, filepath.Join(t.TempDir(), "missing.exit"), "", closed); err != nil || code == 0 {
+		t.Errorf("wait() = %d, %v; want a cancelled edit", code, err)
+	}
+
+	exitPath := filepath.Join(t.TempDir(), "done.exit")
+	if err := os.WriteFile(exitPath, []byte("0"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	closed <- nil
+	if code, err := e.wait(ctx, exitPath, "", closed); err != nil || code != 0 {
+		t.Errorf("wait() = %d, %v; want the editor's status", code, err)
+	}
+}
@@ -0,0 +1,298 @@
+// Package filediff builds diffs for assistant tool calls that edit files and
+// reverts them in the workspace, and previews changes proposed to files.
+package filediff
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/sst/opencode-sdk-go"
+)
+
+// MaxPatchBytes caps each stored patch; a cut patch can be shown but not reverted
+const MaxPatchBytes = 256 * 1024
+
+// truncatedMarker ends a patch cut at MaxPatchBytes
+const truncatedMarker = "\n[patch truncated]\n"
+
+// editTools are the opencode tools that write files
+var editTools = map[string]bool{
+	"edit":      true,
+	"multiedit": true,
+	"write":     true,
+	"patch":     true,
+}
+
+// FromPart returns the files changed by a completed file-editing tool part or
+// a patch part. Patches come from the tool's metadata when it reports one; the
+// rest are left empty for Workspace.Fill.
+func FromPart(part opencode.Part) (types.FileDiffSet, bool) {
+	set := types.FileDiffSet{
+		ID:        part.ID,
+		SessionID: part.SessionID,
+		MessageID: part.MessageID,
+		Status:    types.FileDiffPending,
+		CreatedAt: time.Now(),
+	}
+
+	switch p := part.AsUnion().(type) {
+	case opencode.ToolPart:
+		if !editTools[p.Tool] || p.State.Status != opencode.ToolPartStateStatusCompleted {
+			return types.FileDiffSet{}, false
+		}
+		set.Tool = p.Tool
+		input, _ := p.State.Input.(map[string]interface{})
+		metadata, _ := p.State.Metadata.(map[string]interface{})
+		patch, _ := metadata["diff"].(string)
+
+		if path, _ := input["filePath"].(string); path != "" {
+			set.Files = append(set.Files, types.FileDiff{Path: path, Patch: patch, Source: "patch"})
+		} else if patchText, _ := input["patchText"].(string); patchText != "" {
+			for _, path := range patchFiles(patchText) {
+				set.Files = append(set.Files, types.FileDiff{Path: path})
+			}
+		}
+
+	case opencode.PartPatchPart:
+		set.Tool = "patch"
+		for _, path := range p.Files {
+			set.Files = append(set.Files, types.FileDiff{Path: path})
+		}
+
+	default:
+		return types.FileDiffSet{}, false
+	}
+
+	if len(set.Files) == 0 {
+		return types.FileDiffSet{}, false
+	}
+	return set, true
+}
+
+// patchFiles lists the files named by an opencode patch tool envelope
+func patchFiles(patchText string) []string {
+	var files []string
+	for _, line := range strings.Split(patchText, "\n") {
+		for _, prefix := range []string{"*** Add File: ", "*** Update File: ", "*** Delete File: "} {
+			if path, ok := strings.CutPrefix(line, prefix); ok {
+				files = append(files, strings.TrimSpace(path))
+			}
+		}
+	}
+	return files
+}
+
+// Workspace reads and reverts file changes under a directory. Paths in diffs
+// are made relative to the repository root, or to the directory itself
+// outside a repository.
+type Workspace struct {
+	dir     string
+	gitPath string
+}
+
+// NewWorkspace returns a workspace rooted at dir
+func NewWorkspace(dir string) *Workspace {
+	return &Workspace{dir: dir, gitPath: "git"}
+}
+
+// Fill makes the set's paths relative and gives each file a patch. A tool
+// patch is kept, since it holds only the tool's change; files without one get
+// their working tree diff against HEAD, which also includes edits made before
+// the tool ran. Files left without a patch are dropped.
+func (w *Workspace) Fill(ctx context.Context, set *types.FileDiffSet) {
+	base, inRepo := w.base(ctx)
+
+	files := set.Files[:0]
+	for _, file := range set.Files {
+		path := file.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(w.dir, path)
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			continue
+		}
+		file.Path = filepath.ToSlash(rel)
+
+		if file.Patch != "" {
+			file.Patch = normalizePatch(file.Patch, file.Path)
+		}
+		if file.Patch == "" && inRepo {
+			file.Patch, file.Source = w.gitDiff(ctx, base, file.Path), "git"
+		}
+		if file.Patch == "" {
+			continue
+		}
+		if len(file.Patch) > MaxPatchBytes {
+			cut := strings.LastIndexByte(file.Patch[:MaxPatchBytes], '\n')
+			file.Patch = file.Patch[:cut+1] + strings.TrimPrefix(truncatedMarker, "\n")
+		}
+		files = append(files, file)
+	}
+	set.Files = files
+}
+
+// Revert undoes the changes of the named files, or of every file when paths
+// is empty, by applying their patches in reverse. Either every patch applies
+// or none does; a file edited again since the diff was taken fails to apply.
+func (w *Workspace) Revert(ctx context.Context, set types.FileDiffSet, paths []string) error {
+	selected := make(map[string]bool, len(paths))
+	for _, path := range paths {
+		selected[path] = true
+	}
+
+	var patch strings.Builder
+	for _, file := range set.Files {
+		if len(selected) > 0 && !selected[file.Path] {
+			continue
+		}
+		if strings.HasSuffix(file.Patch, truncatedMarker) {
+			return fmt.Errorf("cannot revert %s: its patch was truncated", file.Path)
+		}
+		patch.WriteString(file.Patch)
+		if !strings.HasSuffix(file.Patch, "\n") {
+			patch.WriteString("\n")
+		}
+	}
+	if patch.Len() == 0 {
+		return fmt.Errorf("diff %s has none of the requested files", set.ID)
+	}
+
+	base, _ := w.base(ctx)
+	cmdCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, w.gitPath, "apply", "--reverse", "--whitespace=nowarn", "-")
+	cmd.Dir = base
+	cmd.Stdin = strings.NewReader(patch.String())
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return fmt.Errorf("git apply: %w: %s", err, message)
+		}
+		return fmt.Errorf("git apply: %w", err)
+	}
+	return nil
+}
+
+// Preview returns the diff that giving the file at path, relative to the
+// workspace, the content proposed would make, leaving the file untouched. The
+// patch is empty when the file already holds that content.
+func (w *Workspace) Preview(ctx context.Context, path string, proposed []byte) (types.FileDiff, error) {
+	diff := types.FileDiff{Path: filepath.ToSlash(path), Source: "proposal"}
+	current := filepath.Join(w.dir, path)
+	if _, err := os.Stat(current); errors.Is(err, fs.ErrNotExist) {
+		current = "/dev/null"
+	}
+
+	temp, err := os.CreateTemp("", "proposal_*"+filepath.Ext(path))
+	if err != nil {
+		return diff, err
+	}
+	defer os.Remove(temp.Name())
+	_, err = temp.Write(proposed)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return diff, err
+	}
+
+	// --no-index exits 1 when the files differ
+	out, err := w.git(ctx, w.dir, "diff", "--no-color", "--no-ext-diff", "--no-index", "--", current, temp.Name())
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return diff, err
+	}
+	diff.Patch = normalizePatch(string(out), diff.Path)
+	if current == "/dev/null" {
+		diff.Patch = strings.Replace(diff.Patch, "--- a/"+diff.Path+"\n", "--- /dev/null\n", 1)
+	}
+	if len(diff.Patch) > MaxPatchBytes {
+		cut := strings.LastIndexByte(diff.Patch[:MaxPatchBytes], '\n')
+		diff.Patch = diff.Patch[:cut+1] + strings.TrimPrefix(truncatedMarker, "\n")
+	}
+	return diff, nil
+}
+
+// base returns the repository root containing the workspace, or the
+// workspace directory when it is not in a repository
+func (w *Workspace) base(ctx context.Context) (string, bool) {
+	out, err := w.git(ctx, w.dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return w.dir, false
+	}
+	return strings.TrimSpace(string(out)), true
+}
+
+// gitDiff returns the working tree diff of a path against HEAD, or the whole
+// file as added when it is untracked; empty when there is nothing to show
+func (w *Workspace) gitDiff(ctx context.Context, root, path string) string {
+	if out, err := w.git(ctx, root, "diff", "--no-color", "--no-ext-diff", "HEAD", "--", path); err == nil && len(out) > 0 {
+		return string(out)
+	}
+
+	untracked, err := w.git(ctx, root, "ls-files", "--others", "--exclude-standard", "--", path)
+	if err != nil || len(bytes.TrimSpace(untracked)) == 0 {
+		return ""
+	}
+	// --no-index exits 1 when the files differ
+	out, err := w.git(ctx, root, "diff", "--no-color", "--no-ext-diff", "--no-index", "--", "/dev/null", path)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return ""
+	}
+	return string(out)
+}
+
+func (w *Workspace) git(ctx context.Context, dir string, args ...string) ([]byte, error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, w.gitPath, append([]string{"-C", dir, "--no-optional-locks"}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		return out, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// normalizePatch rewrites the file headers of a tool's unified diff, which
+// name absolute paths, to the a/ and b/ form git apply expects, adding them
+// when missing, and drops the Index banner. A patch without hunks is returned
+// empty.
+func normalizePatch(patch, path string) string {
+	if !strings.Contains(patch, "\n@@ ") && !strings.HasPrefix(patch, "@@ ") {
+		return ""
+	}
+
+	var b strings.Builder
+	inHunks := false
+	for _, line := range strings.SplitAfter(patch, "\n") {
+		if !inHunks {
+			switch {
+			case strings.HasPrefix(line, "@@ "):
+				inHunks = true
+				if !strings.Contains(b.String(), "+++ ") {
+					b.WriteString("--- a/" + path + "\n+++ b/" + path + "\n")
+				}
+			case strings.HasPrefix(line, "Index: "), strings.HasPrefix(line, "====="):
+				continue
+			case strings.HasPrefix(line, "--- "):
+				line = "--- a/" + path + "\n"
+			case strings.HasPrefix(line, "+++ "):
+				line = "+++ b/" + path + "\n"
+			}
+		}
+		b.WriteString(line)
+	}
+	return b.String()
+}
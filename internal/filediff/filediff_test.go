@@ -0,0 +1,230 @@
+package filediff
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/sst/opencode-sdk-go"
+)
+
+func decodePart(t *testing.T, raw string) opencode.Part {
+	t.Helper()
+	var part opencode.Part
+	if err := json.Unmarshal([]byte(raw), &part); err != nil {
+		t.Fatalf("decode part: %v", err)
+	}
+	return part
+}
+
+func TestFromPart(t *testing.T) {
+	tests := []struct {
+		name  string
+		raw   string
+		ok    bool
+		tool  string
+		paths []string
+		patch bool
+	}{
+		{
+			name: "completed edit with diff",
+			raw: `{"id":"p1","messageID":"m1","sessionID":"s1","type":"tool","callID":"c1","tool":"edit",
+				"state":{"status":"completed","input":{"filePath":"/w/a.go"},"metadata":{"diff":"@@ -1 +1 @@\n-a\n+b\n"},
+				"output":"","title":"a.go","time":{"start":1,"end":2}}}`,
+			ok: true, tool: "edit", paths: []string{"/w/a.go"}, patch: true,
+		},
+		{
+			name: "running edit",
+			raw: `{"id":"p1","messageID":"m1","sessionID":"s1","type":"tool","callID":"c1","tool":"edit",
+				"state":{"status":"running","input":{"filePath":"/w/a.go"},"time":{"start":1}}}`,
+		},
+		{
+			name: "read tool",
+			raw: `{"id":"p1","messageID":"m1","sessionID":"s1","type":"tool","callID":"c1","tool":"read",
+				"state":{"status":"completed","input":{"filePath":"/w/a.go"},"metadata":{},"output":"","title":"","time":{"start":1,"end":2}}}`,
+		},
+		{
+			name: "patch tool envelope",
+			raw: `{"id":"p1","messageID":"m1","sessionID":"s1","type":"tool","callID":"c1","tool":"patch",
+				"state":{"status":"completed","input":{"patchText":"*** Begin Patch\n*** Update File: a.go\n@@\n*** Add File: b.go\n+x\n*** End Patch"},
+				"metadata":{},"output":"","title":"","time":{"start":1,"end":2}}}`,
+			ok: true, tool: "patch", paths: []string{"a.go", "b.go"},
+		},
+		{
+			name: "patch part",
+			raw:  `{"id":"p2","messageID":"m1","sessionID":"s1","type":"patch","files":["/w/a.go","/w/c.go"],"hash":"abc"}`,
+			ok:   true, tool: "patch", paths: []string{"/w/a.go", "/w/c.go"},
+		},
+		{
+			name: "text part",
+			raw:  `{"id":"p3","messageID":"m1","sessionID":"s1","type":"text","text":"hello"}`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			set, ok := FromPart(decodePart(t, tc.raw))
+			if ok != tc.ok {
+				t.Fatalf("FromPart() ok = %v, want %v", ok, tc.ok)
+			}
+			if !ok {
+				return
+			}
+			if set.Tool != tc.tool || set.SessionID != "s1" || set.MessageID != "m1" || set.Status != types.FileDiffPending {
+				t.Errorf("FromPart() = %+v", set)
+			}
+			var paths []string
+			for _, file := range set.Files {
+				paths = append(paths, file.Path)
+				if (file.Patch != "") != tc.patch {
+					t.Errorf("file %s patch = %q", file.Path, file.Patch)
+				}
+			}
+			if strings.Join(paths, ",") != strings.Join(tc.paths, ",") {
+				t.Errorf("paths = %v, want %v", paths, tc.paths)
+			}
+		})
+	}
+}
+
+func TestNormalizePatch(t *testing.T) {
+	tool := "Index: /w/a.go\n===================================================================\n--- /w/a.go\n+++ /w/a.go\n@@ -1 +1 @@\n--- old\n+new\n"
+	want := "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n--- old\n+new\n"
+	if got := normalizePatch(tool, "a.go"); got != want {
+		t.Errorf("normalizePatch() = %q, want %q", got, want)
+	}
+	if got := normalizePatch("@@ -1 +1 @@\n-a\n+b\n", "a.go"); got != "--- a/a.go\n+++ b/a.go\n@@ -1 +1 @@\n-a\n+b\n" {
+		t.Errorf("normalizePatch() without headers = %q", got)
+	}
+	if got := normalizePatch("Index: /w/a.go\n--- /w/a.go\n+++ /w/a.go\n", "a.go"); got != "" {
+		t.Errorf("normalizePatch() without hunks = %q, want empty", got)
+	}
+}
+
+func TestFillAndRevert(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root := t.TempDir()
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=t", "-c", "user.email=t@t"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	read := func(name string) string {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			return "<missing>"
+		}
+		return string(data)
+	}
+
+	run("init", "-q")
+	write("tracked.txt", "one\ntwo\n")
+	write("edited.txt", "alpha\nbeta\n")
+	run("add", ".")
+	run("commit", "-q", "-m", "init")
+
+	// An edit tool reporting its own diff, a write tool relying on git, and a new file
+	write("edited.txt", "alpha\nBETA\n")
+	write("tracked.txt", "one\nTWO\n")
+	write("new.txt", "fresh\n")
+	set := types.FileDiffSet{ID: "p1", Files: []types.FileDiff{
+		{Path: filepath.Join(root, "edited.txt"), Patch: "Index: x\n--- x\n+++ x\n@@ -1,2 +1,2 @@\n alpha\n-beta\n+BETA\n", Source: "patch"},
+		{Path: "tracked.txt"},
+		{Path: filepath.Join(root, "new.txt")},
+		{Path: "unchanged.txt"},
+	}}
+
+	workspace := NewWorkspace(root)
+	workspace.Fill(context.Background(), &set)
+	if len(set.Files) != 3 {
+		t.Fatalf("Fill() kept %d files, want 3: %+v", len(set.Files), set.Files)
+	}
+	for i, want := range []struct{ path, source, contains string }{
+		{"edited.txt", "patch", "+++ b/edited.txt"},
+		{"tracked.txt", "git", "+TWO"},
+		{"new.txt", "git", "+fresh"},
+	} {
+		file := set.Files[i]
+		if file.Path != want.path || file.Source != want.source || !strings.Contains(file.Patch, want.contains) {
+			t.Errorf("file %d = %+v, want %s from %s containing %q", i, file, want.path, want.source, want.contains)
+		}
+	}
+
+	if err := workspace.Revert(context.Background(), set, []string{"edited.txt"}); err != nil {
+		t.Fatalf("Revert(edited.txt) error = %v", err)
+	}
+	if got := read("edited.txt"); got != "alpha\nbeta\n" {
+		t.Errorf("edited.txt = %q after revert", got)
+	}
+	if got := read("tracked.txt"); got != "one\nTWO\n" {
+		t.Errorf("tracked.txt = %q, want it untouched", got)
+	}
+
+	// The edited file no longer matches its patch, so reverting everything fails as a whole
+	if err := workspace.Revert(context.Background(), set, nil); err == nil {
+		t.Fatalf("Revert(all) succeeded with an already reverted file")
+	}
+	if got := read("new.txt"); got != "fresh\n" {
+		t.Errorf("new.txt = %q, want it untouched by the failed revert", got)
+	}
+
+	if err := workspace.Revert(context.Background(), set, []string{"tracked.txt", "new.txt"}); err != nil {
+		t.Fatalf("Revert(tracked, new) error = %v", err)
+	}
+	if got := read("tracked.txt"); got != "one\ntwo\n" {
+		t.Errorf("tracked.txt = %q after revert", got)
+	}
+	if got := read("new.txt"); got != "<missing>" {
+		t.Errorf("new.txt = %q, want it removed", got)
+	}
+}
+
+func TestPreview(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	workspace := NewWorkspace(dir)
+
+	diff, err := workspace.Preview(context.Background(), "main.go", []byte("package main\n\nfunc main() {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.Path != "main.go" || diff.Source != "proposal" ||
+		!strings.Contains(diff.Patch, "--- a/main.go\n+++ b/main.go\n") || !strings.Contains(diff.Patch, "+func main() {}") {
+		t.Errorf("preview of an edit = %+v", diff)
+	}
+	if got, _ := os.ReadFile(filepath.Join(dir, "main.go")); string(got) != "package main\n" {
+		t.Errorf("main.go = %q, want it untouched", got)
+	}
+
+	diff, err = workspace.Preview(context.Background(), "cmd/new.go", []byte("package cmd\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(diff.Patch, "--- /dev/null\n+++ b/cmd/new.go\n") || !strings.Contains(diff.Patch, "+package cmd") {
+		t.Errorf("preview of a new file = %+v", diff)
+	}
+
+	if diff, err := workspace.Preview(context.Background(), "main.go", []byte("package main\n")); err != nil || diff.Patch != "" {
+		t.Errorf("preview of unchanged content = %+v, %v", diff, err)
+	}
+}
@@ -0,0 +1,212 @@
+// Package filetree lists workspace directories for the file browser, one
+// directory at a time, hiding what the repository's gitignore rules exclude.
+package filetree
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultMaxEntries caps the entries returned for one directory
+const DefaultMaxEntries = 1000
+
+// Entry is one file or directory in a listing
+type Entry struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"` // Absolute
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// Listing is the content of one directory, directories first then by name
+type Listing struct {
+	Path      string  `json:"path"`
+	Entries   []Entry `json:"entries"`
+	Truncated bool    `json:"truncated"` // More entries than the cap were found
+}
+
+// Lister lists directories under a fixed set of roots
+type Lister struct {
+	roots      []string
+	maxEntries int
+	gitPath    string
+}
+
+// NewLister returns a lister for the given roots, which are made absolute
+// relative to the working directory
+func NewLister(roots []string, maxEntries int) (*Lister, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no file tree roots")
+	}
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	lister := &Lister{maxEntries: maxEntries, gitPath: "git"}
+	for _, root := range roots {
+		abs, err := filepath.Abs(root)
+		if err != nil {
+			return nil, fmt.Errorf("resolve file tree root %s: %w", root, err)
+		}
+		lister.roots = append(lister.roots, abs)
+	}
+	return lister, nil
+}
+
+// Roots returns the absolute roots
+func (l *Lister) Roots() []string {
+	return append([]string(nil), l.roots...)
+}
+
+// List returns the entries of a directory inside one of the roots. The .git
+// directory and paths ignored by git are left out.
+func (l *Lister) List(ctx context.Context, dir string) (*Listing, error) {
+	if !filepath.IsAbs(dir) {
+		return nil, fmt.Errorf("path %q is not absolute", dir)
+	}
+	dir = filepath.Clean(dir)
+	if !l.contains(dir) {
+		return nil, fmt.Errorf("%s is outside the file tree roots", dir)
+	}
+	// Symlinks may point anywhere; list only what resolves inside a root
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !l.contains(resolved) && !l.containsResolved(resolved) {
+		return nil, fmt.Errorf("%s resolves outside the file tree roots", dir)
+	}
+
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]Entry, 0, len(dirEntries))
+	for _, dirEntry := range dirEntries {
+		if dirEntry.Name() == ".git" {
+			continue
+		}
+		entry := Entry{Name: dirEntry.Name(), Path: filepath.Join(dir, dirEntry.Name()), IsDir: dirEntry.IsDir()}
+		if info, err := dirEntry.Info(); err == nil {
+			entry.Size = info.Size()
+			entry.ModTime = info.ModTime()
+			// Show symlinked directories as directories so they can be expanded
+			if info.Mode()&os.ModeSymlink != 0 {
+				if target, err := os.Stat(entry.Path); err == nil {
+					entry.IsDir = target.IsDir()
+				}
+			}
+		}
+		entries = append(entries, entry)
+	}
+
+	ignored, err := l.ignored(ctx, dir, entries)
+	if err != nil {
+		return nil, err
+	}
+	kept := entries[:0]
+	for _, entry := range entries {
+		if !ignored[entry.Name] {
+			kept = append(kept, entry)
+		}
+	}
+
+	sort.Slice(kept, func(i, j int) bool {
+		if kept[i].IsDir != kept[j].IsDir {
+			return kept[i].IsDir
+		}
+		return strings.ToLower(kept[i].Name) < strings.ToLower(kept[j].Name)
+	})
+
+	listing := &Listing{Path: dir, Entries: kept}
+	if len(kept) > l.maxEntries {
+		listing.Entries = kept[:l.maxEntries]
+		listing.Truncated = true
+	}
+	return listing, nil
+}
+
+// ignored asks git which entries its ignore rules exclude. Outside a
+// repository, or without git, nothing is ignored.
+func (l *Lister) ignored(ctx context.Context, dir string, entries []Entry) (map[string]bool, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	if _, err := exec.LookPath(l.gitPath); err != nil {
+		return nil, nil
+	}
+
+	var input bytes.Buffer
+	for _, entry := range entries {
+		input.WriteString(entry.Name)
+		if entry.IsDir {
+			// Lets patterns such as "build/" match directories
+			input.WriteString("/")
+		}
+		input.WriteByte(0)
+	}
+
+	cmdCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, l.gitPath, "-C", dir, "check-ignore", "--stdin", "-z")
+	cmd.Stdin = &input
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			switch exitErr.ExitCode() {
+			case 1: // Nothing is ignored
+				return nil, nil
+			case 128: // Not a repository
+				return nil, nil
+			}
+		}
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git check-ignore: %w: %s", err, message)
+		}
+		return nil, fmt.Errorf("git check-ignore: %w", err)
+	}
+
+	ignored := make(map[string]bool)
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name = strings.TrimSuffix(name, "/"); name != "" {
+			ignored[name] = true
+		}
+	}
+	return ignored, nil
+}
+
+func (l *Lister) contains(path string) bool {
+	for _, root := range l.roots {
+		if within(root, path) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsResolved checks a symlink-resolved path against the resolved roots
+func (l *Lister) containsResolved(path string) bool {
+	for _, root := range l.roots {
+		if resolvedRoot, err := filepath.EvalSymlinks(root); err == nil && within(resolvedRoot, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,113 @@
+package filetree
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestList(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"src", "build", ".git", "Docs"} {
+		if err := os.Mkdir(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, file := range []string{"main.go", "debug.log", "README.md", "src/util.go"} {
+		if err := os.WriteFile(filepath.Join(root, file), []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("build/\n*.log\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	gitRepo := false
+	if _, err := exec.LookPath("git"); err == nil {
+		gitRepo = exec.Command("git", "init", "-q", root).Run() == nil
+	}
+
+	lister, err := NewLister([]string{root}, 0)
+	if err != nil {
+		t.Fatalf("NewLister() error = %v", err)
+	}
+	listing, err := lister.List(context.Background(), root)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	var names []string
+	for _, entry := range listing.Entries {
+		names = append(names, entry.Name)
+	}
+	want := []string{"Docs", "src", ".gitignore", "main.go", "README.md"}
+	if !gitRepo {
+		// Without git nothing is ignored
+		want = []string{"build", "Docs", "src", ".gitignore", "debug.log", "main.go", "README.md"}
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("List() names = %v, want %v", names, want)
+	}
+
+	sub, err := lister.List(context.Background(), filepath.Join(root, "src"))
+	if err != nil || len(sub.Entries) != 1 || sub.Entries[0].Path != filepath.Join(root, "src", "util.go") {
+		t.Errorf("List(src) = %+v, %v", sub, err)
+	}
+
+	for _, dir := range []string{filepath.Dir(root), filepath.Join(root, "src", "..", ".."), "src"} {
+		if _, err := lister.List(context.Background(), dir); err == nil {
+			t.Errorf("List(%s) succeeded outside the roots", dir)
+		}
+	}
+
+	capped, _ := NewLister([]string{root}, 2)
+	if listing, err := capped.List(context.Background(), root); err != nil || len(listing.Entries) != 2 || !listing.Truncated {
+		t.Errorf("capped List() = %+v, %v", listing, err)
+	}
+}
+
+func TestFileTreeStateApply(t *testing.T) {
+	var tree types.FileTreeState
+	steps := []struct {
+		payload types.FileTreeUpdatePayload
+		wantErr bool
+	}{
+		{types.FileTreeUpdatePayload{Action: types.FileTreeSetRoots, Roots: []string{"/w/a", "/w/b/"}}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeSetRoots, Roots: []string{"relative"}}, true},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeExpand, Path: "/w/a/src"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeExpand, Path: "/w/a/src/"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeExpand, Path: "/w/ab"}, true},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeSelect, Path: "/w/b/x.go"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeAttach, Path: "/w/a/src/main.go"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeAttach, Path: "/w/b/x.go"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeAttach, Path: "/w/b/x.go"}, false},
+		{types.FileTreeUpdatePayload{Action: types.FileTreeDetach, Path: "/w/a/src/main.go"}, false},
+		{types.FileTreeUpdatePayload{Action: "rename", Path: "/w/a/src"}, true},
+	}
+	for i, step := range steps {
+		if err := tree.Apply(step.payload); (err != nil) != step.wantErr {
+			t.Fatalf("step %d: Apply(%+v) error = %v, wantErr %v", i, step.payload, err, step.wantErr)
+		}
+	}
+	want := types.FileTreeState{
+		Roots:    []string{"/w/a", "/w/b"},
+		Expanded: []string{"/w/a/src"},
+		Selected: "/w/b/x.go",
+		Attached: []string{"/w/b/x.go"},
+	}
+	if !reflect.DeepEqual(tree, want) {
+		t.Fatalf("tree = %+v, want %+v", tree, want)
+	}
+
+	// Narrowing the roots drops what they no longer cover
+	if err := tree.Apply(types.FileTreeUpdatePayload{Action: types.FileTreeSetRoots, Roots: []string{"/w/a"}}); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Selected != "" || len(tree.Attached) != 0 || !tree.IsExpanded("/w/a/src") {
+		t.Errorf("tree after narrowing roots = %+v", tree)
+	}
+}
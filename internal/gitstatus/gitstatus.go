@@ -0,0 +1,257 @@
+// Package gitstatus polls the workspace repository and reports its branch,
+// upstream divergence and changed files.
+package gitstatus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// MaxFiles caps the changed paths kept in state; FileCount still counts all
+const MaxFiles = 200
+
+// DefaultInterval is how often the repository is polled
+const DefaultInterval = 5 * time.Second
+
+// PublishFunc receives the repository status whenever it changes; nil means
+// the directory is not inside a repository
+type PublishFunc func(git *types.GitState) error
+
+// Watcher polls one directory's repository
+type Watcher struct {
+	dir      string
+	interval time.Duration
+	publish  PublishFunc
+	gitPath  string
+}
+
+// NewWatcher returns a watcher for the repository containing dir
+func NewWatcher(dir string, interval time.Duration, publish PublishFunc) *Watcher {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Watcher{dir: dir, interval: interval, publish: publish, gitPath: "git"}
+}
+
+// Run polls until ctx is cancelled, publishing only changes
+func (w *Watcher) Run(ctx context.Context) {
+	if _, err := exec.LookPath(w.gitPath); err != nil {
+		log.Printf("Git status disabled: %v", err)
+		return
+	}
+
+	var last *types.GitState
+	first := true
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		current, err := w.Status(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("Git status of %s failed: %v", w.dir, err)
+		} else if first || !Equal(last, current) {
+			if err := w.publish(current); err != nil {
+				log.Printf("Failed to publish git status: %v", err)
+			} else {
+				last = current
+				first = false
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status reads the repository status now; it returns nil without error when
+// the directory is not inside a repository
+func (w *Watcher) Status(ctx context.Context) (*types.GitState, error) {
+	root, err := w.git(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 128 {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	out, err := w.git(ctx, "status", "--porcelain=v2", "--branch", "-z")
+	if err != nil {
+		return nil, err
+	}
+	git, err := Parse(out)
+	if err != nil {
+		return nil, err
+	}
+	git.Root = strings.TrimSpace(string(root))
+	git.UpdatedAt = time.Now()
+	return git, nil
+}
+
+// Workspace returns the root of the repository containing dir, or dir itself
+// when it is not inside a repository or git is unavailable
+func Workspace(ctx context.Context, dir string) string {
+	w := NewWatcher(dir, 0, nil)
+	if _, err := exec.LookPath(w.gitPath); err != nil {
+		return dir
+	}
+	root, err := w.git(ctx, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return dir
+	}
+	return strings.TrimSpace(string(root))
+}
+
+// Branch returns the branch checked out in dir, or "" when dir is not inside
+// a repository, HEAD is detached or git is unavailable
+func Branch(ctx context.Context, dir string) string {
+	w := NewWatcher(dir, 0, nil)
+	if _, err := exec.LookPath(w.gitPath); err != nil {
+		return ""
+	}
+	branch, err := w.git(ctx, "symbolic-ref", "--short", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(branch))
+}
+
+func (w *Watcher) git(ctx context.Context, args ...string) ([]byte, error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	cmd := exec.CommandContext(cmdCtx, w.gitPath, append([]string{"-C", w.dir, "--no-optional-locks"}, args...)...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return nil, fmt.Errorf("git %s: %w: %s", args[0], err, message)
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
+
+// Parse reads the output of "git status --porcelain=v2 --branch -z"
+func Parse(out []byte) (*types.GitState, error) {
+	git := &types.GitState{}
+	fields := strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00")
+	for i := 0; i < len(fields); i++ {
+		entry := fields[i]
+		if entry == "" {
+			continue
+		}
+
+		switch entry[0] {
+		case '#':
+			parseHeader(git, entry)
+
+		case '1', '2', 'u':
+			// 1 XY sub mH mI mW hH hI path
+			// 2 XY sub mH mI mW hH hI Xscore path, then origPath as its own field
+			// u XY sub m1 m2 m3 mW h1 h2 h3 path
+			pathField := map[byte]int{'1': 8, '2': 9, 'u': 10}[entry[0]]
+			parts := strings.SplitN(entry, " ", pathField+1)
+			if len(parts) != pathField+1 {
+				return nil, fmt.Errorf("malformed status entry %q", entry)
+			}
+			file := types.GitFileStatus{Path: parts[pathField], Status: parts[1]}
+			if entry[0] == '2' {
+				if i+1 >= len(fields) {
+					return nil, fmt.Errorf("rename entry %q has no source path", entry)
+				}
+				i++
+				file.OrigPath = fields[i]
+			}
+			addFile(git, file)
+
+		case '?':
+			addFile(git, types.GitFileStatus{Path: strings.TrimPrefix(entry, "? "), Status: "??"})
+
+		case '!':
+			// Ignored files are not reported unless asked for
+
+		default:
+			return nil, fmt.Errorf("unknown status entry %q", entry)
+		}
+	}
+	return git, nil
+}
+
+func parseHeader(git *types.GitState, entry string) {
+	key, value, _ := strings.Cut(strings.TrimPrefix(entry, "# "), " ")
+	switch key {
+	case "branch.oid":
+		if value != "(initial)" {
+			git.Head = value
+		}
+	case "branch.head":
+		if value != "(detached)" {
+			git.Branch = value
+		}
+	case "branch.upstream":
+		git.Upstream = value
+	case "branch.ab":
+		ahead, behind, _ := strings.Cut(value, " ")
+		git.Ahead, _ = strconv.Atoi(strings.TrimPrefix(ahead, "+"))
+		git.Behind, _ = strconv.Atoi(strings.TrimPrefix(behind, "-"))
+	}
+}
+
+func addFile(git *types.GitState, file types.GitFileStatus) {
+	git.FileCount++
+	if len(git.Files) < MaxFiles {
+		git.Files = append(git.Files, file)
+	}
+}
+
+// Equal reports whether two statuses describe the same repository state,
+// ignoring when they were read
+func Equal(a, b *types.GitState) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	left, right := *a, *b
+	left.UpdatedAt, right.UpdatedAt = time.Time{}, time.Time{}
+	return reflect.DeepEqual(left, right)
+}
+
+// Summary renders a one-line description such as "main ↑1 ↓2 +3", or "" for nil
+func Summary(git *types.GitState) string {
+	if git == nil {
+		return ""
+	}
+	ref := git.Branch
+	if ref == "" {
+		ref = "detached"
+		if len(git.Head) >= 7 {
+			ref += "@" + git.Head[:7]
+		}
+	}
+	parts := []string{ref}
+	if git.Ahead > 0 {
+		parts = append(parts, fmt.Sprintf("↑%d", git.Ahead))
+	}
+	if git.Behind > 0 {
+		parts = append(parts, fmt.Sprintf("↓%d", git.Behind))
+	}
+	if git.Dirty() {
+		parts = append(parts, fmt.Sprintf("+%d", git.FileCount))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,96 @@
+package gitstatus
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func porcelain(entries ...string) []byte {
+	return []byte(strings.Join(entries, "\x00") + "\x00")
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		out     []byte
+		want    types.GitState
+		summary string
+	}{
+		{
+			name: "tracking branch with changes",
+			out: porcelain(
+				"# branch.oid 1234567890abcdef",
+				"# branch.head main",
+				"# branch.upstream origin/main",
+				"# branch.ab +2 -1",
+				"1 .M N... 100644 100644 100644 aaa bbb internal/state/sync manager.go",
+				"2 R. N... 100644 100644 100644 aaa bbb R100 new.go",
+				"old.go",
+				"u UU N... 100644 100644 100644 100644 aaa bbb ccc conflict.go",
+				"? notes.txt",
+			),
+			want: types.GitState{
+				Branch: "main", Head: "1234567890abcdef", Upstream: "origin/main", Ahead: 2, Behind: 1,
+				Files: []types.GitFileStatus{
+					{Path: "internal/state/sync manager.go", Status: ".M"},
+					{Path: "new.go", Status: "R.", OrigPath: "old.go"},
+					{Path: "conflict.go", Status: "UU"},
+					{Path: "notes.txt", Status: "??"},
+				},
+				FileCount: 4,
+			},
+			summary: "main ↑2 ↓1 +4",
+		},
+		{
+			name:    "detached and clean",
+			out:     porcelain("# branch.oid abcdef0123456", "# branch.head (detached)"),
+			want:    types.GitState{Head: "abcdef0123456"},
+			summary: "detached@abcdef0",
+		},
+		{
+			name:    "before first commit",
+			out:     porcelain("# branch.oid (initial)", "# branch.head main"),
+			want:    types.GitState{Branch: "main"},
+			summary: "main",
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Parse(tc.out)
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			if !Equal(got, &tc.want) {
+				t.Fatalf("Parse = %+v, want %+v", got, tc.want)
+			}
+			if summary := Summary(got); summary != tc.summary {
+				t.Errorf("Summary = %q, want %q", summary, tc.summary)
+			}
+		})
+	}
+}
+
+func TestParseCapsFiles(t *testing.T) {
+	entries := []string{"# branch.head main"}
+	for i := 0; i < MaxFiles+5; i++ {
+		entries = append(entries, "? file")
+	}
+	got, err := Parse(porcelain(entries...))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(got.Files) != MaxFiles || got.FileCount != MaxFiles+5 {
+		t.Fatalf("kept %d of %d files", len(got.Files), got.FileCount)
+	}
+}
+
+func TestEqualIgnoresReadTime(t *testing.T) {
+	a := &types.GitState{Branch: "main", UpdatedAt: time.Now()}
+	b := &types.GitState{Branch: "main", UpdatedAt: time.Now().Add(time.Minute)}
+	if !Equal(a, b) || Equal(a, nil) || !Equal(nil, nil) {
+		t.Fatal("Equal should compare everything but UpdatedAt")
+	}
+}
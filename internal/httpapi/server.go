@@ -0,0 +1,179 @@
+// Package httpapi serves an opt-in HTTP API that lets external tools create
+// sessions, submit user messages and read transcripts on a running instance.
+//
+// Every request must carry "Authorization: Bearer <token>". Routes:
+//
+//	POST /v1/sessions                        {"title": "..."}  -> 201 session
+//	POST /v1/sessions/{id}/messages          {"text": "..."}   -> 202
+//	GET  /v1/sessions/{id}/transcript                          -> 200 transcript
+package httpapi
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// maxBodyBytes bounds request bodies
+const maxBodyBytes = 1 << 20
+
+// ErrSessionNotFound is returned by backends for unknown session IDs
+var ErrSessionNotFound = errors.New("session not found")
+
+// Backend carries out API requests against the running instance
+type Backend interface {
+	// CreateSession creates a session on the opencode server and adds it to shared state
+	CreateSession(ctx context.Context, title string) (types.SessionInfo, error)
+	// SubmitMessage sends text to a session as a user prompt
+	SubmitMessage(ctx context.Context, sessionID, text string) error
+	// Transcript returns a session's messages and annotations
+	Transcript(sessionID string) (*state.SessionExport, error)
+}
+
+// TokenPath returns where the API token for a socket is kept
+func TokenPath(socketPath string) string {
+	return socketPath + ".api-token"
+}
+
+// Server is the HTTP API server
+type Server struct {
+	backend Backend
+	token   string
+	server  *http.Server
+}
+
+// NewServer returns a server that accepts requests presenting token
+func NewServer(backend Backend, token string) *Server {
+	s := &Server{backend: backend, token: token}
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /v1/sessions", s.handleCreateSession)
+	mux.HandleFunc("POST /v1/sessions/{id}/messages", s.handleSubmitMessage)
+	mux.HandleFunc("GET /v1/sessions/{id}/transcript", s.handleTranscript)
+	s.server = &http.Server{
+		Handler:           s.authenticate(mux),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s
+}
+
+// Start listens on addr and serves in the background
+func (s *Server) Start(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("HTTP API stopped: %v", err)
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the server down, waiting up to timeout for requests in flight
+func (s *Server) Stop(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.server.Shutdown(ctx)
+}
+
+// Handler returns the authenticated handler, for tests
+func (s *Server) Handler() http.Handler {
+	return s.server.Handler
+}
+
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || s.token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(s.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, "invalid or missing token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleCreateSession(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title string `json:"title"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	session, err := s.backend.CreateSession(r.Context(), strings.TrimSpace(req.Title))
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, session)
+}
+
+func (s *Server) handleSubmitMessage(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Text string `json:"text"`
+	}
+	if !decodeBody(w, r, &req) {
+		return
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(w, http.StatusBadRequest, "text is required")
+		return
+	}
+	sessionID := r.PathValue("id")
+	if err := s.backend.SubmitMessage(r.Context(), sessionID, req.Text); err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{"session_id": sessionID, "accepted": true})
+}
+
+func (s *Server) handleTranscript(w http.ResponseWriter, r *http.Request) {
+	transcript, err := s.backend.Transcript(r.PathValue("id"))
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, transcript)
+}
+
+// decodeBody decodes a JSON request body, writing the error response on failure
+func decodeBody(w http.ResponseWriter, r *http.Request, out interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(out); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("invalid request body: %v", err))
+		return false
+	}
+	return true
+}
+
+func writeBackendError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrSessionNotFound) {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	writeError(w, http.StatusBadGateway, err.Error())
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("HTTP API: failed to write response: %v", err)
+	}
+}
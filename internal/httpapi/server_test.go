@@ -0,0 +1,84 @@
+package httpapi
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+type fakeBackend struct {
+	sessions  map[string]types.SessionInfo
+	submitted []string
+}
+
+func (b *fakeBackend) CreateSession(ctx context.Context, title string) (types.SessionInfo, error) {
+	session := types.SessionInfo{ID: fmt.Sprintf("ses_%d", len(b.sessions)+1), Title: title}
+	b.sessions[session.ID] = session
+	return session, nil
+}
+
+func (b *fakeBackend) SubmitMessage(ctx context.Context, sessionID, text string) error {
+	if _, ok := b.sessions[sessionID]; !ok {
+		return fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	b.submitted = append(b.submitted, sessionID+":"+text)
+	return nil
+}
+
+func (b *fakeBackend) Transcript(sessionID string) (*state.SessionExport, error) {
+	session, ok := b.sessions[sessionID]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrSessionNotFound, sessionID)
+	}
+	return &state.SessionExport{Session: session}, nil
+}
+
+func TestServerRoutes(t *testing.T) {
+	backend := &fakeBackend{sessions: map[string]types.SessionInfo{"ses_1": {ID: "ses_1"}}}
+	handler := NewServer(backend, "secret").Handler()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"missing token", http.MethodPost, "/v1/sessions", "", `{"title":"x"}`, http.StatusUnauthorized},
+		{"wrong token", http.MethodPost, "/v1/sessions", "nope", `{"title":"x"}`, http.StatusUnauthorized},
+		{"create session", http.MethodPost, "/v1/sessions", "secret", `{"title":"Triage"}`, http.StatusCreated},
+		{"unknown field", http.MethodPost, "/v1/sessions", "secret", `{"name":"x"}`, http.StatusBadRequest},
+		{"submit message", http.MethodPost, "/v1/sessions/ses_1/messages", "secret", `{"text":"hello"}`, http.StatusAccepted},
+		{"empty message", http.MethodPost, "/v1/sessions/ses_1/messages", "secret", `{"text":"  "}`, http.StatusBadRequest},
+		{"unknown session", http.MethodPost, "/v1/sessions/ses_9/messages", "secret", `{"text":"hello"}`, http.StatusNotFound},
+		{"transcript", http.MethodGet, "/v1/sessions/ses_1/transcript", "secret", "", http.StatusOK},
+		{"wrong method", http.MethodGet, "/v1/sessions", "secret", "", http.StatusMethodNotAllowed},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			if rec.Code != tc.want {
+				t.Fatalf("status = %d, want %d (body %s)", rec.Code, tc.want, rec.Body.String())
+			}
+		})
+	}
+
+	if len(backend.submitted) != 1 || backend.submitted[0] != "ses_1:hello" {
+		t.Fatalf("unexpected submissions %v", backend.submitted)
+	}
+	if _, ok := backend.sessions["ses_2"]; !ok || backend.sessions["ses_2"].Title != "Triage" {
+		t.Fatalf("session not created: %v", backend.sessions)
+	}
+}
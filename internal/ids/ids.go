@@ -0,0 +1,96 @@
+// Package ids generates the IDs stamped on sessions, updates, events and the
+// other records the server creates: a readable prefix and a UUIDv7, such as
+// "update_01928c4e-7b1a-7c3e-9f2d-5a6b7c8d9e0f". A UUIDv7 starts with its
+// millisecond timestamp and this process never repeats or reorders one, so
+// IDs never collide however fast they are made, and IDs sharing a prefix sort
+// chronologically as plain strings.
+package ids
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// separator joins the prefix to the UUID. Prefixes may contain it too; UUIDs
+// never do.
+const separator = "_"
+
+// legacyEventLayout is the timestamp older event IDs were made of
+const legacyEventLayout = "20060102150405.000000"
+
+// New returns a fresh ID with the given prefix
+func New(prefix string) string {
+	return prefix + separator + uuid.Must(uuid.NewV7()).String()
+}
+
+// Parse splits an ID made by New into its prefix and UUID
+func Parse(id string) (string, uuid.UUID, error) {
+	i := strings.LastIndex(id, separator)
+	if i < 0 {
+		return "", uuid.UUID{}, fmt.Errorf("id %q has no prefix", id)
+	}
+	u, err := uuid.Parse(id[i+1:])
+	if err != nil {
+		return "", uuid.UUID{}, fmt.Errorf("id %q: %w", id, err)
+	}
+	if u.Version() != 7 {
+		return "", uuid.UUID{}, fmt.Errorf("id %q is a version %d UUID, want 7", id, u.Version())
+	}
+	return id[:i], u, nil
+}
+
+// Prefix returns the prefix of an ID made by New, or "" for any other ID
+func Prefix(id string) string {
+	prefix, _, err := Parse(id)
+	if err != nil {
+		return ""
+	}
+	return prefix
+}
+
+// Time returns when an ID was made, to the millisecond. It also reads the
+// timestamp IDs made before this package, such as "session_<unix nanos>",
+// "update_<unix nanos>_<seq>" and bare event timestamps, so state saved by
+// older versions still sorts. It reports false for IDs that carry no time,
+// such as those assigned by the opencode server.
+func Time(id string) (time.Time, bool) {
+	if _, u, err := Parse(id); err == nil {
+		sec, nsec := u.Time().UnixTime()
+		return time.Unix(sec, nsec), true
+	}
+	if t, err := time.ParseInLocation(legacyEventLayout, id, time.Local); err == nil {
+		return t, true
+	}
+	for _, part := range strings.Split(id, separator) {
+		// Unix nanoseconds have had 19 digits since 2001
+		if len(part) != 19 {
+			continue
+		}
+		if nanos, err := strconv.ParseInt(part, 10, 64); err == nil {
+			return time.Unix(0, nanos), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// Compare orders IDs by when they were made, for slices.SortFunc. IDs made
+// in the same millisecond, or carrying no time, fall back to string order,
+// which for IDs made by New is the order they were made in. IDs with a time
+// sort before those without.
+func Compare(a, b string) int {
+	ta, aok := Time(a)
+	tb, bok := Time(b)
+	switch {
+	case aok && !bok:
+		return -1
+	case !aok && bok:
+		return 1
+	case aok && bok && !ta.Equal(tb):
+		return ta.Compare(tb)
+	}
+	return strings.Compare(a, b)
+}
@@ -0,0 +1,113 @@
+package ids
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNewIsUniqueAndOrdered(t *testing.T) {
+	const goroutines, perGoroutine = 8, 2000
+
+	var mutex sync.Mutex
+	seen := make(map[string]bool, goroutines*perGoroutine)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			made := make([]string, perGoroutine)
+			for i := range made {
+				made[i] = New("update")
+			}
+			// Each goroutine's IDs come out in the order it made them
+			if !slices.IsSorted(made) {
+				t.Error("IDs made in sequence do not sort in sequence")
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			for _, id := range made {
+				if seen[id] {
+					t.Errorf("duplicate id %s", id)
+				}
+				seen[id] = true
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestParse(t *testing.T) {
+	id := New("file_diff_resolved")
+	prefix, u, err := Parse(id)
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", id, err)
+	}
+	if prefix != "file_diff_resolved" || u.Version() != 7 {
+		t.Errorf("Parse(%q) = %q, version %d", id, prefix, u.Version())
+	}
+
+	for _, bad := range []string{
+		"",
+		"session_1736182800000000000",
+		"update_not-a-uuid",
+		"event_6ba7b810-9dad-11d1-80b4-00c04fd430c8", // Version 1
+		"ses_abc123",
+	} {
+		if _, _, err := Parse(bad); err == nil {
+			t.Errorf("Parse(%q) succeeded", bad)
+		}
+		if got := Prefix(bad); got != "" {
+			t.Errorf("Prefix(%q) = %q, want empty", bad, got)
+		}
+	}
+}
+
+func TestTime(t *testing.T) {
+	legacy := time.Date(2025, 1, 6, 17, 0, 0, 123456789, time.UTC)
+
+	tests := []struct {
+		name string
+		id   string
+		want time.Time
+		ok   bool
+	}{
+		{name: "legacy session", id: "session_1736182800123456789", want: legacy, ok: true},
+		{name: "legacy update with sequence", id: "update_1736182800123456789_42", want: legacy, ok: true},
+		{name: "legacy prefixed", id: "ui_action_open_models_1736182800123456789", want: legacy, ok: true},
+		{name: "legacy event", id: legacy.Local().Format(legacyEventLayout), want: legacy.Truncate(time.Microsecond), ok: true},
+		{name: "server assigned", id: "ses_abc123"},
+		{name: "short number", id: "run_42"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := Time(tt.id)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Errorf("Time(%q) = %v, %v; want %v, %v", tt.id, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	before := time.Now().Truncate(time.Millisecond)
+	id := New("session")
+	after := time.Now()
+	got, ok := Time(id)
+	if !ok || got.Before(before) || got.After(after) {
+		t.Errorf("Time(%q) = %v, %v; want between %v and %v", id, got, ok, before, after)
+	}
+}
+
+func TestCompareSortsChronologically(t *testing.T) {
+	first := "session_1736182800000000000"
+	second := "session_1736182900000000000"
+	fresh := []string{New("session"), New("session"), New("session")}
+	ids := []string{"ses_server", fresh[2], second, fresh[0], "ses_another", first, fresh[1]}
+
+	slices.SortFunc(ids, Compare)
+	want := []string{first, second, fresh[0], fresh[1], fresh[2], "ses_another", "ses_server"}
+	if !slices.Equal(ids, want) {
+		t.Errorf("sorted\n%s\nwant\n%s", strings.Join(ids, "\n"), strings.Join(want, "\n"))
+	}
+}
@@ -0,0 +1,333 @@
+// Package integration boots the state server the way the orchestrator does,
+// without tmux, and connects fake panels to it over the real Unix socket.
+// Tests drive update traffic through the panels and check that every panel
+// converges on the same state, sees events in the same order, and that the
+// state survives a restart.
+package integration
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// DefaultWait bounds how long a harness waits for panels to catch up
+const DefaultWait = 5 * time.Second
+
+// Options configure a Harness
+type Options struct {
+	Panels         int                                // Fake panels to connect, named panel-1, panel-2, ...
+	Persistent     bool                               // Keep state in a file so it survives Restart
+	Confirmations  map[types.UpdateType]time.Duration // Destructive updates the server holds for confirmation
+	StateChunkSize int                                // Chunk size for full state transfers, 0 for the default
+}
+
+// Harness is a running server with panels connected to it
+type Harness struct {
+	t          testing.TB
+	opts       Options
+	dir        string
+	SocketPath string
+	StatePath  string
+	Manager    *state.PanelSyncManager
+	Server     *ipc.SocketServer
+	Panels     []*Panel
+	Observer   *Panel // Connected but never sends, so it sees every event
+	memory     *persistence.MemoryRepository
+}
+
+// Start boots a server and connects the panels. Everything is torn down when
+// the test ends.
+func Start(t testing.TB, opts Options) *Harness {
+	t.Helper()
+
+	// Unix socket paths are limited to about 100 bytes, which t.TempDir
+	// can exceed, so the socket lives in a short directory of its own
+	dir, err := os.MkdirTemp("", "tmuxcoder-it")
+	if err != nil {
+		t.Fatalf("failed to create harness directory: %v", err)
+	}
+	h := &Harness{
+		t:          t,
+		opts:       opts,
+		dir:        dir,
+		SocketPath: filepath.Join(dir, "ipc.sock"),
+		StatePath:  filepath.Join(dir, "state.json"),
+	}
+	if !opts.Persistent {
+		h.memory = persistence.NewMemoryRepository(persistence.MemoryOptions{})
+	}
+	t.Cleanup(h.Close)
+
+	h.boot()
+	return h
+}
+
+// boot starts the sync manager and server and connects fresh panels
+func (h *Harness) boot() {
+	h.t.Helper()
+
+	var repository interfaces.StateRepository = h.memory
+	if h.memory == nil {
+		repository = persistence.NewFileManager(persistence.DefaultFileManagerConfig(h.StatePath))
+	}
+	config := state.DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	config.WatchdogDumpDir = ""
+
+	h.Manager = state.NewPanelSyncManager(types.NewSharedApplicationState(), repository, state.NewEventBus(config.EventHistorySize), state.DefaultConflictResolver(), config)
+	if err := h.Manager.Initialize(); err != nil {
+		h.t.Fatalf("failed to initialize sync manager: %v", err)
+	}
+
+	h.Server = ipc.NewSocketServer(h.SocketPath, h.Manager.GetEventBus(), h.Manager, nil)
+	h.Server.SetConfirmations(h.opts.Confirmations)
+	h.Server.SetStateChunkSize(h.opts.StateChunkSize)
+	if err := h.Server.Start(); err != nil {
+		h.t.Fatalf("failed to start IPC server: %v", err)
+	}
+
+	h.Observer = h.Connect("harness-observer", "observer")
+	h.Panels = nil
+	for i := 1; i <= h.opts.Panels; i++ {
+		h.Panels = append(h.Panels, h.Connect(fmt.Sprintf("panel-%d", i), "test"))
+	}
+}
+
+// Close shuts everything down and removes the harness directory. It runs
+// when the test ends, and calling it again is a no-op.
+func (h *Harness) Close() {
+	h.shutdown()
+	os.RemoveAll(h.dir)
+}
+
+// shutdown disconnects the panels and stops the server, then the sync
+// manager, which saves the state on the way out
+func (h *Harness) shutdown() {
+	for _, panel := range h.Panels {
+		panel.Client.Disconnect()
+	}
+	if h.Observer != nil {
+		h.Observer.Client.Disconnect()
+	}
+	if h.Server != nil {
+		h.Server.Stop()
+	}
+	if h.Manager != nil {
+		h.Manager.Stop()
+	}
+}
+
+// Restart stops everything and boots again from the saved state, as the
+// orchestrator does when it is restarted. Panels reconnect with the same IDs
+// and start with no events recorded.
+func (h *Harness) Restart() {
+	h.t.Helper()
+	h.shutdown()
+	h.boot()
+}
+
+// Connect adds a panel to the running server
+func (h *Harness) Connect(panelID, panelType string) *Panel {
+	h.t.Helper()
+
+	panel := &Panel{ID: panelID, Client: ipc.NewSocketClient(h.SocketPath, panelID, panelType)}
+	panel.Client.RegisterEventHandler("*", panel.record)
+	if err := panel.Client.Connect(); err != nil {
+		h.t.Fatalf("panel %s failed to connect: %v", panelID, err)
+	}
+	// Panels fetch the whole state once on startup and follow events after
+	initial, err := panel.Client.RequestState()
+	if err != nil {
+		h.t.Fatalf("panel %s failed to fetch initial state: %v", panelID, err)
+	}
+	panel.synced = initial.Version.Version
+	return panel
+}
+
+// State returns the server's state
+func (h *Harness) State() *types.SharedApplicationState {
+	return h.Manager.GetState()
+}
+
+// WaitForConvergence waits until every panel has seen the server's current
+// version and then checks that each panel fetches the same state the server
+// holds.
+func (h *Harness) WaitForConvergence() {
+	h.t.Helper()
+
+	want := h.State()
+	for _, panel := range append([]*Panel{h.Observer}, h.Panels...) {
+		if err := panel.WaitForVersion(want.Version.Version, DefaultWait); err != nil {
+			h.t.Fatalf("%v", err)
+		}
+		got, err := panel.Client.RequestState()
+		if err != nil {
+			h.t.Fatalf("panel %s failed to fetch state: %v", panel.ID, err)
+		}
+		if diff := Diff(want, got); diff != "" {
+			h.t.Errorf("panel %s diverged from the server: %s", panel.ID, diff)
+		}
+	}
+}
+
+// CheckEventOrder checks that state events carry versions that never go
+// backwards and that every panel saw the state events the observer saw, in
+// the same order, less those for its own updates, which the server does not
+// echo back. Unversioned events, such as other panels connecting, depend on
+// when a panel joined and are left out. Call it after WaitForConvergence.
+func (h *Harness) CheckEventOrder() {
+	h.t.Helper()
+
+	all := versioned(h.Observer.Events())
+	var last int64
+	for _, event := range all {
+		if event.Version < last {
+			h.t.Errorf("version %d broadcast after %d", event.Version, last)
+		}
+		last = event.Version
+	}
+
+	for _, panel := range h.Panels {
+		var want []types.StateEvent
+		for _, event := range all {
+			if event.SourcePanel != panel.ID {
+				want = append(want, event)
+			}
+		}
+		// A panel's own responses can overtake events forwarded to it, so
+		// give stragglers time to arrive
+		got := versioned(panel.Events())
+		for deadline := time.Now().Add(DefaultWait); len(got) < len(want) && time.Now().Before(deadline); got = versioned(panel.Events()) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if len(got) != len(want) {
+			h.t.Errorf("panel %s saw %d events, want %d", panel.ID, len(got), len(want))
+			continue
+		}
+		for i := range got {
+			if got[i].ID != want[i].ID {
+				h.t.Errorf("panel %s event %d is %s (%s), want %s (%s)", panel.ID, i, got[i].ID, got[i].Type, want[i].ID, want[i].Type)
+				break
+			}
+		}
+	}
+}
+
+func versioned(events []types.StateEvent) []types.StateEvent {
+	var kept []types.StateEvent
+	for _, event := range events {
+		if event.Version > 0 {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
+
+// Diff describes the first way two states differ in what panels show, or
+// returns "" when they agree. Timestamps and bookkeeping are ignored.
+func Diff(want, got *types.SharedApplicationState) string {
+	switch {
+	case got == nil:
+		return "no state"
+	case want.Version.Version != got.Version.Version:
+		return fmt.Sprintf("version %d, want %d", got.Version.Version, want.Version.Version)
+	case want.CurrentSessionID != got.CurrentSessionID:
+		return fmt.Sprintf("current session %q, want %q", got.CurrentSessionID, want.CurrentSessionID)
+	case want.Theme != got.Theme:
+		return fmt.Sprintf("theme %q, want %q", got.Theme, want.Theme)
+	case len(want.Sessions) != len(got.Sessions):
+		return fmt.Sprintf("%d sessions, want %d", len(got.Sessions), len(want.Sessions))
+	case len(want.Messages) != len(got.Messages):
+		return fmt.Sprintf("%d messages, want %d", len(got.Messages), len(want.Messages))
+	}
+	for i := range want.Sessions {
+		w, g := want.Sessions[i], got.Sessions[i]
+		if w.ID != g.ID || w.Title != g.Title || w.MessageCount != g.MessageCount {
+			return fmt.Sprintf("session %d is %s %q with %d messages, want %s %q with %d", i, g.ID, g.Title, g.MessageCount, w.ID, w.Title, w.MessageCount)
+		}
+	}
+	for i := range want.Messages {
+		w, g := want.Messages[i], got.Messages[i]
+		if w.ID != g.ID || w.SessionID != g.SessionID || w.Content != g.Content || w.Status != g.Status {
+			return fmt.Sprintf("message %d is %s %q, want %s %q", i, g.ID, g.Content, w.ID, w.Content)
+		}
+	}
+	return ""
+}
+
+// Panel is a fake panel: a socket client that records every event it
+// receives
+type Panel struct {
+	ID     string
+	Client *ipc.SocketClient
+
+	mutex  sync.Mutex
+	synced int64 // Version of the state fetched on connect or reached by Send
+	events []types.StateEvent
+}
+
+func (p *Panel) record(event types.StateEvent) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.events = append(p.events, event)
+	return nil
+}
+
+// Events returns the events received so far, in order
+func (p *Panel) Events() []types.StateEvent {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return append([]types.StateEvent(nil), p.events...)
+}
+
+// Send applies an update against the last version this panel saw, leaving
+// any conflict to the server's resolver, as a real panel does
+func (p *Panel) Send(update types.StateUpdate) (int64, error) {
+	if update.ExpectedVersion == 0 {
+		update.ExpectedVersion = p.Client.GetCurrentVersion()
+		if update.ExpectedVersion <= 0 {
+			update.ExpectedVersion = 1
+		}
+	}
+	version, err := p.Client.SendStateUpdateAndWait(update)
+	if err == nil {
+		p.mutex.Lock()
+		if version > p.synced {
+			p.synced = version
+		}
+		p.mutex.Unlock()
+	}
+	return version, err
+}
+
+// WaitForVersion waits until the panel has caught up with version, through
+// its initial state, its own updates or the events for everyone else's
+func (p *Panel) WaitForVersion(version int64, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		p.mutex.Lock()
+		seen := p.synced
+		if n := len(p.events); n > 0 && p.events[n-1].Version > seen {
+			seen = p.events[n-1].Version
+		}
+		p.mutex.Unlock()
+
+		if seen >= version {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("panel %s saw version %d, still waiting for %d after %v", p.ID, seen, version, timeout)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,274 @@
+package integration
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/version"
+)
+
+func TestPanelsConvergeUnderConcurrentUpdates(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 3})
+
+	for _, update := range testutil.NewUpdates("panel-1", 0).AddSession("s1", "Shared").ChangeSession("s1").List() {
+		if _, err := h.Panels[0].Send(update); err != nil {
+			t.Fatalf("setup update %s: %v", update.Type, err)
+		}
+	}
+
+	// Every panel writes at once, mostly against stale versions, so the
+	// conflict resolver has to merge them
+	const perPanel = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, len(h.Panels)*perPanel)
+	for _, panel := range h.Panels {
+		wg.Add(1)
+		go func(panel *Panel) {
+			defer wg.Done()
+			for i := 1; i <= perPanel; i++ {
+				message := testutil.Message(fmt.Sprintf("%s-m%d", panel.ID, i), "s1", "user", fmt.Sprintf("%s says %d", panel.ID, i))
+				update := types.StateUpdate{Type: types.MessageAdded, Payload: types.MessageAddPayload{Message: message}}
+				if _, err := panel.Send(update); err != nil {
+					errs <- fmt.Errorf("%s message %d: %w", panel.ID, i, err)
+				}
+			}
+		}(panel)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	h.WaitForConvergence()
+	h.CheckEventOrder()
+
+	state := h.State()
+	want := len(h.Panels) * perPanel
+	if len(state.Messages) != want || state.Sessions[0].MessageCount != want {
+		t.Errorf("got %d messages, session counts %d; want %d", len(state.Messages), state.Sessions[0].MessageCount, want)
+	}
+	// Each panel's messages keep the order it sent them in
+	next := make(map[string]int)
+	for _, message := range state.Messages {
+		var panelID string
+		var n int
+		fmt.Sscanf(message.Content, "%s says %d", &panelID, &n)
+		if n != next[panelID]+1 {
+			t.Errorf("%s message %d applied after %d", panelID, n, next[panelID])
+		}
+		next[panelID] = n
+	}
+}
+
+func TestStateSurvivesRestart(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 2, Persistent: true})
+
+	updates := testutil.NewUpdates("panel-1", 0).
+		AddSession("s1", "First").
+		AddSession("s2", "Second").
+		ChangeSession("s2").
+		AddMessage(testutil.Message("m1", "s2", "user", "hello")).
+		AddMessage(testutil.Message("m2", "s2", "assistant", "hi")).
+		UpdateMessage("m2", "hi there", "completed").
+		ChangeTheme("tokyonight")
+	for i, update := range updates.List() {
+		// Alternate panels, each building on what the other did
+		update.ExpectedVersion = 0
+		if _, err := h.Panels[i%2].Send(update); err != nil {
+			t.Fatalf("update %s: %v", update.Type, err)
+		}
+	}
+	h.WaitForConvergence()
+	h.CheckEventOrder()
+	before := h.State()
+
+	h.Restart()
+
+	if diff := Diff(before, h.State()); diff != "" {
+		t.Fatalf("state after restart: %s", diff)
+	}
+	h.WaitForConvergence()
+
+	// The restarted server carries on from the saved version
+	if _, err := h.Panels[1].Send(types.StateUpdate{Type: types.ThemeChanged, Payload: types.ThemeChangePayload{Theme: "opencode"}}); err != nil {
+		t.Fatalf("update after restart: %v", err)
+	}
+	h.WaitForConvergence()
+	if got := h.State().Version.Version; got != before.Version.Version+1 {
+		t.Errorf("version after restart = %d, want %d", got, before.Version.Version+1)
+	}
+}
+
+func TestDestructiveUpdateNeedsConfirmation(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 2, Confirmations: map[types.UpdateType]time.Duration{types.SessionDeleted: time.Minute}})
+	sender, watcher := h.Panels[0], h.Panels[1]
+
+	if _, err := sender.Send(types.StateUpdate{Type: types.SessionAdded, Payload: types.SessionAddPayload{Session: testutil.Session("s1", "Doomed")}}); err != nil {
+		t.Fatal(err)
+	}
+
+	remove := types.StateUpdate{Type: types.SessionDeleted, Payload: types.SessionDeletePayload{SessionID: "s1"}}
+	_, err := sender.Send(remove)
+	var required *ipc.ConfirmationRequiredError
+	if !errors.As(err, &required) {
+		t.Fatalf("delete = %v, want a confirmation request", err)
+	}
+	if len(h.State().Sessions) != 1 {
+		t.Fatalf("session deleted before confirmation")
+	}
+
+	// Other panels hear about the pending delete
+	deadline := time.Now().Add(DefaultWait)
+	for !sawEvent(watcher, types.EventConfirmationRequired) {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher never saw %s", types.EventConfirmationRequired)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Another panel cannot use the token
+	stolen := remove
+	stolen.ConfirmationToken = required.Token
+	if _, err := watcher.Send(stolen); !errors.As(err, new(*ipc.ConfirmationRequiredError)) {
+		t.Errorf("delete with another panel's token = %v, want a confirmation request", err)
+	}
+
+	// The token was spent by the other panel's attempt, so ask again
+	if _, err := sender.Send(remove); !errors.As(err, &required) {
+		t.Fatalf("second delete = %v, want a confirmation request", err)
+	}
+	remove.ConfirmationToken = required.Token
+	if _, err := sender.Send(remove); err != nil {
+		t.Fatalf("confirmed delete: %v", err)
+	}
+
+	h.WaitForConvergence()
+	if len(h.State().Sessions) != 0 {
+		t.Errorf("session survived a confirmed delete")
+	}
+}
+
+func sawEvent(panel *Panel, eventType types.StateEventType) bool {
+	for _, event := range panel.Events() {
+		if event.Type == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandshakeExchangesBuilds(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 1})
+
+	if got := h.Panels[0].Client.ServerBuild(); got != version.Build {
+		t.Errorf("ServerBuild() = %q, want %q", got, version.Build)
+	}
+	for _, conn := range h.Server.GetConnections() {
+		if conn.Build != version.Build || conn.Protocol != version.Protocol {
+			t.Errorf("connection %s build = %q/%q, want %q/%q", conn.PanelID, conn.Build, conn.Protocol, version.Build, version.Protocol)
+		}
+	}
+
+	// A panel speaking a protocol the server does not is refused
+	conn, err := net.Dial("unix", h.SocketPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	json.NewEncoder(conn).Encode(ipc.HandshakeMessage{Type: "handshake", PanelID: "future", PanelType: "messages", Version: "99.0", Build: "v99.0.0"})
+	var response ipc.HandshakeResponse
+	if err := json.NewDecoder(conn).Decode(&response); err != nil {
+		t.Fatalf("handshake response: %v", err)
+	}
+	if response.Success || response.Protocol != version.Protocol {
+		t.Errorf("response = %+v, want a refusal naming protocol %s", response, version.Protocol)
+	}
+}
+
+func TestLargeStateTransfersInChunks(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 2, StateChunkSize: 512})
+
+	for _, update := range testutil.NewUpdates("panel-1", 0).AddSession("s1", "Shared").ChangeSession("s1").List() {
+		if _, err := h.Panels[0].Send(update); err != nil {
+			t.Fatalf("setup update %s: %v", update.Type, err)
+		}
+	}
+	for i := 1; i <= 20; i++ {
+		message := testutil.Message(fmt.Sprintf("m%d", i), "s1", "user", strings.Repeat(fmt.Sprintf("line %d ", i), 20))
+		if _, err := h.Panels[0].Send(types.StateUpdate{Type: types.MessageAdded, Payload: types.MessageAddPayload{Message: message}}); err != nil {
+			t.Fatalf("message %d: %v", i, err)
+		}
+	}
+
+	// Each panel fetches the state, many chunks long, and gets what the server holds
+	h.WaitForConvergence()
+}
+
+func TestOpencodeSessionTransfer(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	h := Start(t, Options{Panels: 1})
+	client := h.Panels[0].Client
+
+	if err := h.Manager.AddSession(testutil.Session("s1", "Moving"), "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Manager.AddMessage(types.MessageInfo{ID: "u1", SessionID: "s1", Type: "user", Content: "hello"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := client.ExportOpencodeSession("s1")
+	if err != nil {
+		t.Fatalf("ExportOpencodeSession() error = %v", err)
+	}
+	if _, err := client.ExportOpencodeSession("missing"); err == nil {
+		t.Error("exporting an unknown session succeeded")
+	}
+
+	// Imported back after the session is gone, it reads the same
+	if err := h.Manager.ClearSessionMessages("s1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Manager.DeleteSession("s1", "test"); err != nil {
+		t.Fatal(err)
+	}
+	session, err := client.ImportOpencodeSession(data)
+	if err != nil {
+		t.Fatalf("ImportOpencodeSession() error = %v", err)
+	}
+	if session.ID != "s1" || session.Title != "Moving" {
+		t.Errorf("imported session = %+v", session)
+	}
+	if msg, ok := h.State().GetMessageByID("u1"); !ok || msg.Content != "hello" {
+		t.Errorf("imported message = %+v, %v", msg, ok)
+	}
+	if _, err := client.ImportOpencodeSession(data); err == nil {
+		t.Error("importing the session twice succeeded")
+	}
+}
@@ -0,0 +1,35 @@
+package integration
+
+import (
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestServerLifecycleLeaksNothing(t *testing.T) {
+	if testing.Short() {
+		t.Skip("integration test")
+	}
+	testutil.CheckLeaks(t)
+	h := Start(t, Options{Panels: 2, Persistent: true})
+
+	// Each restart stops the server, the sync manager and every panel's
+	// connection, and boots them again over the same state file
+	for i := 0; i < 3; i++ {
+		update := types.StateUpdate{Type: types.SessionAdded, Payload: types.SessionAddPayload{Session: testutil.Session(string(rune('a'+i)), "Cycle")}}
+		if _, err := h.Panels[i%2].Send(update); err != nil {
+			t.Fatalf("cycle %d: %v", i, err)
+		}
+		h.WaitForConvergence()
+		h.Restart()
+	}
+
+	// Panels that come and go on a running server
+	for i := 0; i < 5; i++ {
+		panel := h.Connect("transient", "test")
+		if err := panel.Client.Disconnect(); err != nil {
+			t.Fatalf("disconnect %d: %v", i, err)
+		}
+	}
+}
@@ -2,6 +2,13 @@ package interfaces
 
 import (
 	"time"
+
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/filetree"
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/webhook"
 )
 
 // IpcRequester represents the identity of an IPC request sender
@@ -31,12 +38,141 @@ type OrchestratorControl interface {
 
 	// Ping checks if the daemon is responsive
 	Ping() error
+
+	// QueryAudit returns audit log entries for applied state updates
+	QueryAudit(filter audit.Filter) ([]audit.Entry, error)
+
+	// QueryAnalytics summarizes assistant usage per day from the state journal
+	QueryAnalytics(query analytics.Query) (*analytics.Report, error)
+
+	// CollectGarbage removes orphaned persisted files, or only reports them when dryRun is set
+	CollectGarbage(dryRun bool) (GCStats, error)
+
+	// GetSyncConfig returns the sync manager's live configuration as JSON fields
+	GetSyncConfig() (map[string]interface{}, error)
+
+	// UpdateSyncConfig changes sync manager settings, given as JSON fields, without
+	// a restart and returns the configuration now in effect
+	UpdateSyncConfig(changes map[string]interface{}) (map[string]interface{}, error)
+
+	// DrainSaves blocks until every queued state save has been written
+	DrainSaves() error
+
+	// ForceBackup backs up the state file now, and copies it off-site when configured
+	ForceBackup() (*BackupInfo, error)
+
+	// RotateLogs moves the daemon log aside and reopens it, returning the rotated path
+	RotateLogs() (string, error)
+
+	// SetDebugLogging turns verbose daemon logging on or off
+	SetDebugLogging(enabled bool) error
+
+	// GetDiagnostics returns a snapshot of daemon health, state metrics and the
+	// latest recentEvents events, for the controller panel
+	GetDiagnostics(recentEvents int) (*Diagnostics, error)
+
+	// GetDeliveryStats returns each subscriber's delivered and dropped event
+	// counts, ordered by panel ID
+	GetDeliveryStats() ([]SubscriberInfo, error)
+
+	// ForceSync saves state and sends every panel a full state sync
+	ForceSync() error
+
+	// RestoreBackup replaces the live state with a backup, the newest restorable
+	// one when path is empty, and returns the backup used
+	RestoreBackup(path string) (*BackupInfo, error)
+
+	// RespawnPanel restarts the process of a panel, named by layout ID or type, in its pane
+	RespawnPanel(name string) error
+
+	// StartMacroRecording begins recording user updates into the named macro
+	StartMacroRecording(name string) error
+
+	// StopMacroRecording ends the recording, saves the macro and returns its summary
+	StopMacroRecording() (*macro.Info, error)
+
+	// ReplayMacro starts replaying a saved macro in the background
+	ReplayMacro(name string, opts macro.ReplayOptions) (*macro.Info, error)
+
+	// ListMacros summarizes the saved macros
+	ListMacros() ([]macro.Info, error)
+
+	// DeleteMacro removes a saved macro
+	DeleteMacro(name string) error
+
+	// ListDirectory lists one directory inside the file tree roots
+	ListDirectory(path string) (*filetree.Listing, error)
+
+	// RunTerminalCommand starts a shell command in a terminal pane, in dir or the
+	// workspace when empty, and returns the run; its output and exit status are
+	// recorded in state as it goes
+	RunTerminalCommand(command, dir string) (*types.TerminalRun, error)
+
+	// EditInput opens text, the input buffer, in the user's editor and
+	// returns once it is open; the text saved replaces the input buffer
+	EditInput(text string) error
+
+	// CancelRun cancels an assistant run in flight, by run ID or by a message of
+	// its session, and aborts the generation on the opencode server
+	CancelRun(runID, messageID string) error
+
+	// CompactSession starts summarizing a session, the current one when
+	// sessionID is empty; the summary replaces its messages once written
+	CompactSession(sessionID string) error
+
+	// CreateSessionFromTemplate creates a session from the named session
+	// template and selects it with the template's agent and model; title
+	// replaces the template's title when set
+	CreateSessionFromTemplate(template, title string) (*types.SessionInfo, error)
+
+	// SwitchProfile makes the named config profile the active one, reapplying
+	// the layout and replacing the theme, model and keybindings
+	SwitchProfile(name string) (*ProfileStatus, error)
+
+	// UpgradePanels restarts the connected panels whose build differs from
+	// targetBuild, the build now installed, so they pick up the new binary;
+	// with dryRun it only reports which would restart
+	UpgradePanels(targetBuild, targetProtocol string, dryRun bool) (*UpgradeReport, error)
+}
+
+// UpgradeReport says which panels an upgrade restarted
+type UpgradeReport struct {
+	DaemonBuild string            `json:"daemon_build"`
+	TargetBuild string            `json:"target_build"`
+	Restarted   []string          `json:"restarted"`        // Panels restarted, or that would be with dry_run
+	Current     []string          `json:"current"`          // Panels already running targetBuild
+	Failed      map[string]string `json:"failed,omitempty"` // Panels whose restart failed, with the error
+	DryRun      bool              `json:"dry_run,omitempty"`
+	// Set when the daemon itself runs another build; only a session restart replaces it
+	DaemonOutdated bool `json:"daemon_outdated"`
+}
+
+// Diagnostics is everything the controller panel shows about a running daemon
+type Diagnostics struct {
+	Status       *SessionStatus      `json:"status"`
+	Healthy      bool                `json:"healthy"`
+	Subscribers  []SubscriberInfo    `json:"subscribers"`
+	Metrics      StateManagerMetrics `json:"metrics"`
+	Conflicts    ConflictStatistics  `json:"conflicts"`
+	LatestBackup *BackupInfo         `json:"latest_backup,omitempty"`
+	RecentEvents []EventSummary      `json:"recent_events"` // Newest last
+	Webhooks     []webhook.Stats     `json:"webhooks,omitempty"`
+}
+
+// EventSummary describes a state event without its payload
+type EventSummary struct {
+	ID          string               `json:"id"`
+	Type        types.StateEventType `json:"type"`
+	SourcePanel string               `json:"source_panel"`
+	Version     int64                `json:"version"`
+	Timestamp   time.Time            `json:"timestamp"`
 }
 
 // SessionStatus represents the current status of a session
 type SessionStatus struct {
 	SessionName string        `json:"session_name"`
 	DaemonPID   int           `json:"daemon_pid"`
+	Build       string        `json:"build,omitempty"` // Build of the daemon's binary
 	IsRunning   bool          `json:"is_running"`
 	Uptime      time.Duration `json:"uptime"`
 	StartedAt   time.Time     `json:"started_at"`
@@ -45,6 +181,16 @@ type SessionStatus struct {
 	SocketPath  string        `json:"socket_path"`
 	ConfigPath  string        `json:"config_path"`
 	Owner       SessionOwner  `json:"owner"`
+
+	EventHistory *EventHistoryStats `json:"event_history,omitempty"`
+	Storage      *HealthCheckResult `json:"storage,omitempty"`
+	Profile      *ProfileStatus     `json:"profile,omitempty"`
+}
+
+// ProfileStatus names the active config profile and the ones defined
+type ProfileStatus struct {
+	Active    string   `json:"active,omitempty"` // Empty when no profile is active
+	Available []string `json:"available"`
 }
 
 // PanelStatus represents the status of a single panel
@@ -55,6 +201,9 @@ type PanelStatus struct {
 	PID       int    `json:"pid,omitempty"`
 	Restarts  int    `json:"restarts"`
 	LastError string `json:"last_error,omitempty"`
+	// Build the panel reported when it connected, and how it relates to the daemon's
+	Build         string `json:"build,omitempty"`
+	Compatibility string `json:"compatibility,omitempty"`
 }
 
 // ClientInfo represents information about a connected tmux client
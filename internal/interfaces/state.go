@@ -1,8 +1,12 @@
 package interfaces
 
 import (
+	"fmt"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/opencode/tmux_coder/internal/metrics"
 	"github.com/opencode/tmux_coder/internal/types"
 )
 
@@ -55,6 +59,15 @@ type StateManager interface {
 
 	// ClearSessionMessages clears all messages for a given session
 	ClearSessionMessages(sessionID string, panelID string) error
+
+	// RedactMessage replaces ranges of message content with placeholders and persists immediately
+	RedactMessage(messageID string, ranges []types.RedactionRange, reason, panelID string) error
+
+	// GetBlob returns an offloaded message body or parts list by content hash
+	GetBlob(hash string) ([]byte, error)
+
+	// StateAt reconstructs a past version of the state without modifying live state
+	StateAt(version int64) (*types.SharedApplicationState, error)
 }
 
 // EventBus defines the interface for event distribution
@@ -76,6 +89,18 @@ type EventBus interface {
 
 	// GetEventHistory returns recent events from the history buffer
 	GetEventHistory(maxEvents int) []types.StateEvent
+
+	// GetEventsSince returns retained events newer than version, oldest first,
+	// reading spilled events back from disk; complete is false when some of
+	// them are no longer retained
+	GetEventsSince(version int64) (events []types.StateEvent, complete bool, err error)
+
+	// GetHistoryStats reports how much of the event history is retained
+	GetHistoryStats() EventHistoryStats
+
+	// Close stops accepting events, sends every subscriber a final shutdown
+	// event, waits up to timeout for them to drain and closes their channels
+	Close(reason string, timeout time.Duration) error
 }
 
 // ConflictResolver defines the interface for resolving state conflicts
@@ -113,6 +138,9 @@ type BackupManager interface {
 	// GetStatistics returns backup operation statistics
 	GetStatistics() BackupStatistics
 
+	// VerifyAll loads every backup in the chain and reports which are restorable
+	VerifyAll() BackupReport
+
 	// Start begins automatic backup operations
 	Start() error
 
@@ -165,6 +193,75 @@ type RepositoryStats struct {
 	ModTime    time.Time `json:"mod_time"`
 	IsLocked   bool      `json:"is_locked"`
 	BackupPath string    `json:"backup_path"`
+	// PermissionIssues lists persisted files that are too permissive or owned by another user
+	PermissionIssues []string `json:"permission_issues,omitempty"`
+	// LastGC summarizes the most recent garbage collection run
+	LastGC GCStats `json:"last_gc"`
+	// LastRecovery summarizes the crash-recovery pass run by Initialize
+	LastRecovery RecoveryReport `json:"last_recovery"`
+}
+
+// RecoveryReport summarizes the startup pass that cleans up after a writer
+// that crashed mid-save
+type RecoveryReport struct {
+	RanAt            time.Time `json:"ran_at"`
+	Skipped          string    `json:"skipped,omitempty"` // Why recovery did not run
+	StaleLockRemoved bool      `json:"stale_lock_removed"`
+	TempFilesRemoved int       `json:"temp_files_removed"`
+	PromotedTemp     string    `json:"promoted_temp,omitempty"`   // Interrupted save finished by installing its temp file
+	RestoredBackup   string    `json:"restored_backup,omitempty"` // Backup installed over a corrupt state file
+	Quarantined      []string  `json:"quarantined,omitempty"`     // Corrupt files moved aside for inspection
+	Errors           []string  `json:"errors,omitempty"`
+}
+
+// Changed reports whether recovery found anything to repair
+func (r RecoveryReport) Changed() bool {
+	return r.StaleLockRemoved || r.TempFilesRemoved > 0 || r.PromotedTemp != "" ||
+		r.RestoredBackup != "" || len(r.Quarantined) > 0 || len(r.Errors) > 0
+}
+
+// Summary describes the recovery in one line
+func (r RecoveryReport) Summary() string {
+	if r.Skipped != "" {
+		return "skipped: " + r.Skipped
+	}
+	if !r.Changed() {
+		return "nothing to recover"
+	}
+
+	var parts []string
+	if r.StaleLockRemoved {
+		parts = append(parts, "removed stale lock")
+	}
+	if r.PromotedTemp != "" {
+		parts = append(parts, "completed interrupted save from "+filepath.Base(r.PromotedTemp))
+	}
+	if r.RestoredBackup != "" {
+		parts = append(parts, "restored state from "+filepath.Base(r.RestoredBackup))
+	}
+	if r.TempFilesRemoved > 0 {
+		parts = append(parts, fmt.Sprintf("removed %d temp files", r.TempFilesRemoved))
+	}
+	if len(r.Quarantined) > 0 {
+		parts = append(parts, fmt.Sprintf("quarantined %d corrupt files", len(r.Quarantined)))
+	}
+	if len(r.Errors) > 0 {
+		parts = append(parts, fmt.Sprintf("%d errors", len(r.Errors)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GCStats summarizes a garbage collection run over persisted files.
+// In a dry run the counts are what would have been removed.
+type GCStats struct {
+	LastRun          time.Time     `json:"last_run"`
+	Duration         time.Duration `json:"duration"`
+	DryRun           bool          `json:"dry_run"`
+	TempFilesRemoved int           `json:"temp_files_removed"`
+	BackupsRemoved   int           `json:"backups_removed"`
+	BlobsRemoved     int           `json:"blobs_removed"`
+	BytesReclaimed   int64         `json:"bytes_reclaimed"`
+	Errors           []string      `json:"errors,omitempty"`
 }
 
 // StateManagerMetrics contains performance metrics for state management
@@ -172,14 +269,26 @@ type StateManagerMetrics struct {
 	TotalUpdates         int64                      `json:"total_updates"`
 	SuccessfulUpdates    int64                      `json:"successful_updates"`
 	FailedUpdates        int64                      `json:"failed_updates"`
+	DuplicateUpdates     int64                      `json:"duplicate_updates"`
 	UpdatesByType        map[types.UpdateType]int64 `json:"updates_by_type"`
 	TotalSaves           int64                      `json:"total_saves"`
 	SuccessfulSaves      int64                      `json:"successful_saves"`
 	FailedSaves          int64                      `json:"failed_saves"`
 	AverageUpdateLatency time.Duration              `json:"average_update_latency"`
 	AverageSaveLatency   time.Duration              `json:"average_save_latency"`
+	UpdateLatency        metrics.LatencySummary     `json:"update_latency"`
+	SaveLatency          metrics.LatencySummary     `json:"save_latency"`
 	LastUpdateTime       time.Time                  `json:"last_update_time"`
 	LastSaveTime         time.Time                  `json:"last_save_time"`
+	SlowUpdates          int64                      `json:"slow_updates"`
+	SlowSaves            int64                      `json:"slow_saves"`
+	Batches              int64                      `json:"batches"`         // Passes of the apply loop that took several queued updates
+	BatchedUpdates       int64                      `json:"batched_updates"` // Updates taken in those passes
+	LargestBatch         int64                      `json:"largest_batch"`
+	Panics               map[string]int64           `json:"panics,omitempty"` // Recovered panics by component
+	SaveQueueDepth       int                        `json:"save_queue_depth"` // Saves waiting for the save worker
+	SaveQueueCapacity    int                        `json:"save_queue_capacity"`
+	CoalescedSaves       int64                      `json:"coalesced_saves"` // Save requests dropped into one already queued
 }
 
 // GetSuccessRate returns the success rate for updates
@@ -190,6 +299,14 @@ func (m *StateManagerMetrics) GetSuccessRate() float64 {
 	return float64(m.SuccessfulUpdates) / float64(m.TotalUpdates) * 100.0
 }
 
+// AverageBatchSize returns how many updates a batch took on average, 0 before the first
+func (m *StateManagerMetrics) AverageBatchSize() float64 {
+	if m.Batches == 0 {
+		return 0
+	}
+	return float64(m.BatchedUpdates) / float64(m.Batches)
+}
+
 // GetSaveSuccessRate returns the success rate for saves
 func (m *StateManagerMetrics) GetSaveSuccessRate() float64 {
 	if m.TotalSaves == 0 {
@@ -206,6 +323,32 @@ type SubscriberInfo struct {
 	ConnectedAt  time.Time `json:"connected_at"`
 	LastEventAt  time.Time `json:"last_event_at"`
 	EventCount   int64     `json:"event_count"`
+	// Declared in the handshake; nil for panels that declared nothing
+	Capabilities *types.PanelCapabilities `json:"capabilities,omitempty"`
+	Delivered    int64                    `json:"delivered"`              // Events queued for the panel
+	Dropped      int64                    `json:"dropped"`                // Events lost to a full queue
+	LastDropAt   time.Time                `json:"last_drop_at,omitempty"` // Zero when nothing was dropped
+	Resyncs      int64                    `json:"resyncs"`                // Full state syncs sent after drops
+	Behind       bool                     `json:"behind"`                 // Dropped events not yet covered by a resync
+	Lagging      bool                     `json:"lagging"`                // Dropping events persistently
+	// Stable identity the orchestrator gave the panel; empty for clients
+	// started outside a pane
+	Identity    string `json:"identity,omitempty"`
+	LastVersion int64  `json:"last_version"` // State version of the last event queued for the panel
+	Sequence    int64  `json:"sequence"`     // Sequence number of the last event offered, queued or dropped
+	Respawns    int64  `json:"respawns"`     // New processes that took over the identity
+}
+
+// EventHistoryStats describes event history occupancy in memory and on disk
+type EventHistoryStats struct {
+	Capacity       int    `json:"capacity"`  // In-memory history size
+	InMemory       int    `json:"in_memory"` // Events currently held in memory
+	OverflowEvents int64  `json:"overflow_events"`
+	OverflowBytes  int64  `json:"overflow_bytes"`
+	OverflowPath   string `json:"overflow_path,omitempty"`
+	OldestVersion  int64  `json:"oldest_version"` // Oldest state version still replayable
+	Evicted        int64  `json:"evicted"`        // Events no longer retained anywhere
+	OverflowErrors int64  `json:"overflow_errors"`
 }
 
 // ConflictResolutionResult represents the outcome of conflict resolution
@@ -238,6 +381,19 @@ type ConflictStatistics struct {
 	RetryCount    int64            `json:"retry_count"`
 	SuccessRate   float64          `json:"success_rate"`
 	Strategy      ConflictStrategy `json:"strategy"`
+
+	// Vector clocks: updates from writers that had not seen each other, and redeliveries dropped
+	ConcurrentCount int64 `json:"concurrent_count"`
+	DuplicateCount  int64 `json:"duplicate_count"`
+
+	// Throttling: updates that waited for a per-panel in-flight slot, and those that gave up
+	ThrottledCount   int64          `json:"throttled_count"`
+	RejectedCount    int64          `json:"rejected_count"`
+	InFlightByPanel  map[string]int `json:"in_flight_by_panel,omitempty"`
+	StormActive      bool           `json:"storm_active"`
+	StormCount       int64          `json:"storm_count"`      // Number of times storm mode was entered
+	SerializedCount  int64          `json:"serialized_count"` // Updates applied through the serial queue
+	LastStormStarted time.Time      `json:"last_storm_started,omitempty"`
 }
 
 // BackupInfo contains information about a backup file
@@ -249,6 +405,44 @@ type BackupInfo struct {
 	IsValid      bool      `json:"is_valid"`
 }
 
+// BackupStatus classifies a backup after verification
+type BackupStatus string
+
+const (
+	BackupValid   BackupStatus = "valid"   // Checksum matches and the state passes validation
+	BackupInvalid BackupStatus = "invalid" // Decodes but violates state invariants
+	BackupCorrupt BackupStatus = "corrupt" // Unreadable, undecodable or checksum mismatch
+)
+
+// BackupVerification is the verification result for one backup file
+type BackupVerification struct {
+	BackupInfo
+	Status   BackupStatus `json:"status"`
+	Checksum string       `json:"checksum,omitempty"` // Empty for backups written before checksums
+	Error    string       `json:"error,omitempty"`
+}
+
+// BackupReport summarizes verification of the whole backup chain, newest first
+type BackupReport struct {
+	CheckedAt time.Time            `json:"checked_at"`
+	Backups   []BackupVerification `json:"backups"`
+	// NewestRestorable is the most recent valid backup, nil if none can be restored
+	NewestRestorable *BackupVerification `json:"newest_restorable,omitempty"`
+}
+
+// Healthy reports whether every backup verified and at least one is restorable
+func (r BackupReport) Healthy() bool {
+	if r.NewestRestorable == nil {
+		return false
+	}
+	for _, backup := range r.Backups {
+		if backup.Status != BackupValid {
+			return false
+		}
+	}
+	return true
+}
+
 // BackupStatistics contains backup operation statistics
 type BackupStatistics struct {
 	TotalBackups      int64     `json:"total_backups"`
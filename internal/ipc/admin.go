@@ -0,0 +1,266 @@
+package ipc
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/permission"
+)
+
+// tokenBytes is the amount of randomness in an admin or HTTP API token
+const tokenBytes = 32
+
+// AdminTokenPath returns where the admin token for a socket is kept
+func AdminTokenPath(socketPath string) string {
+	return socketPath + ".admin-token"
+}
+
+// CreateToken writes a fresh random token to path, readable only by its owner.
+// It backs the admin channel and the HTTP API.
+func CreateToken(path string) (string, error) {
+	raw := make([]byte, tokenBytes)
+	if _, err := rand.Read(raw); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token := hex.EncodeToString(raw)
+
+	// Replace rather than truncate, so a file left with wider permissions is not reused
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to remove old token: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to write token: %w", err)
+	}
+	return token, nil
+}
+
+// ReadAdminToken reads the admin token written by CreateToken
+func ReadAdminToken(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read admin token: %w", err)
+	}
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", fmt.Errorf("admin token file %s is empty", path)
+	}
+	return token, nil
+}
+
+// SetAdminToken enables the admin channel; commands must present this token.
+// With no token set every admin command is refused.
+func (server *SocketServer) SetAdminToken(token string) {
+	server.adminMutex.Lock()
+	defer server.adminMutex.Unlock()
+	server.adminToken = token
+}
+
+// SetDebugLogging turns on logging of every event forwarded to panels
+func (server *SocketServer) SetDebugLogging(enabled bool) {
+	server.debugLogging.Store(enabled)
+}
+
+// checkAdminToken compares a presented token with the configured one in constant time
+func (server *SocketServer) checkAdminToken(token string) error {
+	server.adminMutex.RLock()
+	expected := server.adminToken
+	server.adminMutex.RUnlock()
+
+	if expected == "" {
+		return fmt.Errorf("admin channel disabled")
+	}
+	if subtle.ConstantTimeCompare([]byte(token), []byte(expected)) != 1 {
+		return fmt.Errorf("invalid admin token")
+	}
+	return nil
+}
+
+// handleAdminCommand processes privileged commands. Each needs the admin token
+// and the admin permission, and is logged with who sent it.
+func (server *SocketServer) handleAdminCommand(clientConn *ClientConnection, message IPCMessage) {
+	var payload struct {
+		Command string                 `json:"command"`
+		Params  map[string]interface{} `json:"params"`
+		Token   string                 `json:"token"`
+	}
+	if err := mapToStruct(message.Data, &payload); err != nil || strings.TrimSpace(payload.Command) == "" {
+		server.sendErrorMessage(clientConn, "admin_command_response", "invalid admin command payload", message.RequestID)
+		return
+	}
+	cmdLower := strings.ToLower(payload.Command)
+
+	if err := server.checkAdminToken(payload.Token); err != nil {
+		log.Printf("Admin command %s from %v refused: %v", cmdLower, clientConn.Requester, err)
+		server.sendErrorMessage(clientConn, "admin_command_response", err.Error(), message.RequestID)
+		return
+	}
+	if server.permissionChecker != nil {
+		if err := server.permissionChecker.CheckPermission(permission.OperationAdmin, clientConn.Requester); err != nil {
+			log.Printf("Permission denied for admin command %s from %v: %v", cmdLower, clientConn.Requester, err)
+			server.sendErrorMessage(clientConn, "admin_command_response", err.Error(), message.RequestID)
+			return
+		}
+	}
+	log.Printf("Admin command %s from %v (panel %s), params %v", cmdLower, clientConn.Requester, clientConn.PanelID, payload.Params)
+
+	result, err := server.runAdminCommand(cmdLower, payload.Params)
+	if err != nil {
+		log.Printf("Admin command %s failed: %v", cmdLower, err)
+		server.sendErrorMessage(clientConn, "admin_command_response", err.Error(), message.RequestID)
+		return
+	}
+
+	data := map[string]interface{}{
+		"success": true,
+		"command": cmdLower,
+	}
+	for key, value := range result {
+		data[key] = value
+	}
+	response := IPCMessage{
+		Type:      "admin_command_response",
+		RequestID: message.RequestID,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send %s response: %v", cmdLower, err)
+	}
+}
+
+// runAdminCommand executes an authorized admin command and returns the fields
+// to add to its response
+func (server *SocketServer) runAdminCommand(command string, params map[string]interface{}) (map[string]interface{}, error) {
+	switch command {
+	case "dump_goroutines":
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 2); err != nil {
+			return nil, fmt.Errorf("failed to dump goroutines: %w", err)
+		}
+		return map[string]interface{}{"goroutines": buf.String()}, nil
+
+	case "write_profile":
+		kind, _ := params["kind"].(string)
+		seconds, _ := params["seconds"].(float64)
+		path, err := server.writeProfile(strings.ToLower(strings.TrimSpace(kind)), time.Duration(seconds*float64(time.Second)))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"path": path}, nil
+
+	case "disconnect_panel":
+		panelID, _ := params["panel_id"].(string)
+		if strings.TrimSpace(panelID) == "" {
+			return nil, fmt.Errorf("panel_id is required")
+		}
+		disconnected := server.DisconnectPanel(panelID, "disconnected by admin")
+		if disconnected == 0 {
+			return nil, fmt.Errorf("no connected panel %q", panelID)
+		}
+		return map[string]interface{}{"disconnected": disconnected}, nil
+	}
+
+	if server.control == nil {
+		return nil, fmt.Errorf("control handler not configured")
+	}
+	switch command {
+	case "drain_saves":
+		start := time.Now()
+		if err := server.control.DrainSaves(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"duration_ms": time.Since(start).Milliseconds()}, nil
+
+	case "force_backup":
+		backup, err := server.control.ForceBackup()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"backup": backup}, nil
+
+	case "rotate_logs":
+		rotated, err := server.control.RotateLogs()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"rotated": rotated}, nil
+
+	case "force_sync":
+		if err := server.control.ForceSync(); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{}, nil
+
+	case "restore_backup":
+		path, _ := params["path"].(string)
+		backup, err := server.control.RestoreBackup(strings.TrimSpace(path))
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"backup": backup}, nil
+
+	case "respawn_panel":
+		panel, _ := params["panel"].(string)
+		if strings.TrimSpace(panel) == "" {
+			return nil, fmt.Errorf("panel is required")
+		}
+		if err := server.control.RespawnPanel(panel); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"panel": panel}, nil
+
+	case "upgrade_panels":
+		target, _ := params["target_build"].(string)
+		protocol, _ := params["target_protocol"].(string)
+		dryRun, _ := params["dry_run"].(bool)
+		if strings.TrimSpace(target) == "" || strings.TrimSpace(protocol) == "" {
+			return nil, fmt.Errorf("target_build and target_protocol are required")
+		}
+		report, err := server.control.UpgradePanels(target, protocol, dryRun)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"upgrade": report}, nil
+
+	case "set_debug_logging":
+		enabled, ok := params["enabled"].(bool)
+		if !ok {
+			return nil, fmt.Errorf("enabled must be true or false")
+		}
+		if err := server.control.SetDebugLogging(enabled); err != nil {
+			return nil, err
+		}
+		server.SetDebugLogging(enabled)
+		return map[string]interface{}{"enabled": enabled}, nil
+	}
+	return nil, fmt.Errorf("unsupported admin command")
+}
+
+// DisconnectPanel closes every connection of the given panel and returns how
+// many were closed. The panel's supervisor decides whether it reconnects.
+func (server *SocketServer) DisconnectPanel(panelID, reason string) int {
+	server.connectionsMux.RLock()
+	var matches []*ClientConnection
+	for _, conn := range server.connections {
+		if conn.PanelID == panelID {
+			matches = append(matches, conn)
+		}
+	}
+	server.connectionsMux.RUnlock()
+
+	disconnected := 0
+	for _, conn := range matches {
+		if server.disconnectClient(conn, reason) {
+			disconnected++
+		}
+	}
+	return disconnected
+}
@@ -0,0 +1,94 @@
+package ipc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAdminTokenFile(t *testing.T) {
+	path := AdminTokenPath(filepath.Join(t.TempDir(), "test.sock"))
+
+	// A leftover file with wide permissions must not be reused
+	if err := os.WriteFile(path, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	token, err := CreateToken(path)
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if len(token) != 2*tokenBytes {
+		t.Errorf("token length = %d, want %d", len(token), 2*tokenBytes)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("token file mode = %v, want 0600", mode)
+	}
+
+	read, err := ReadAdminToken(path)
+	if err != nil || read != token {
+		t.Errorf("ReadAdminToken() = %q, %v; want %q", read, err, token)
+	}
+}
+
+func TestCheckAdminToken(t *testing.T) {
+	server := NewSocketServer("", nil, nil, nil)
+
+	tests := []struct {
+		name       string
+		configured string
+		presented  string
+		wantErr    bool
+	}{
+		{name: "disabled", configured: "", presented: "", wantErr: true},
+		{name: "wrong token", configured: "secret", presented: "guess", wantErr: true},
+		{name: "empty token", configured: "secret", presented: "", wantErr: true},
+		{name: "matching token", configured: "secret", presented: "secret"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.SetAdminToken(tt.configured)
+			if err := server.checkAdminToken(tt.presented); (err != nil) != tt.wantErr {
+				t.Errorf("checkAdminToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteProfile(t *testing.T) {
+	server := NewSocketServer("", nil, nil, nil)
+	dir := filepath.Join(t.TempDir(), "profiles")
+	server.SetProfileDir(dir)
+
+	for _, params := range []map[string]interface{}{
+		{"kind": "heap"},
+		{"kind": "goroutine"},
+		{"kind": "CPU", "seconds": 0.05},
+		{"kind": "mutex", "seconds": 0.05},
+	} {
+		result, err := server.runAdminCommand("write_profile", params)
+		if err != nil {
+			t.Fatalf("write_profile %v: %v", params, err)
+		}
+		path, _ := result["path"].(string)
+		if filepath.Dir(path) != dir {
+			t.Errorf("profile written to %q, want it in %s", path, dir)
+		}
+		if info, err := os.Stat(path); err != nil || info.Size() == 0 || info.Mode().Perm() != 0600 {
+			t.Errorf("profile %s: %v, %v", path, info, err)
+		}
+	}
+
+	for _, params := range []map[string]interface{}{
+		{"kind": "disk"},
+		{"kind": "cpu", "seconds": 600.0},
+	} {
+		if _, err := server.runAdminCommand("write_profile", params); err == nil {
+			t.Errorf("write_profile %v succeeded", params)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package ipc
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ConfirmationRequiredError is returned to a panel whose destructive update is
+// waiting for confirmation. Sending the same update again with Token set in
+// StateUpdate.ConfirmationToken before ExpiresAt applies it.
+type ConfirmationRequiredError struct {
+	Operation types.UpdateType
+	Token     string
+	ExpiresAt time.Time
+}
+
+func (e *ConfirmationRequiredError) Error() string {
+	return fmt.Sprintf("%s requires confirmation before %s", e.Operation, e.ExpiresAt.Format(time.Kitchen))
+}
+
+// pendingConfirmation is a destructive update waiting for its confirming resend
+type pendingConfirmation struct {
+	operation types.UpdateType
+	panelID   string
+	payload   string
+	expiresAt time.Time
+}
+
+// confirmationGate holds destructive updates back until their sender
+// confirms them. Only the panel that sent an update can confirm it, and only
+// by repeating the same operation on the same payload.
+type confirmationGate struct {
+	mutex    sync.Mutex
+	timeouts map[types.UpdateType]time.Duration
+	pending  map[string]pendingConfirmation
+}
+
+func newConfirmationGate(timeouts map[types.UpdateType]time.Duration) *confirmationGate {
+	gate := &confirmationGate{
+		timeouts: make(map[types.UpdateType]time.Duration),
+		pending:  make(map[string]pendingConfirmation),
+	}
+	for operation, timeout := range timeouts {
+		if timeout > 0 {
+			gate.timeouts[operation] = timeout
+		}
+	}
+	return gate
+}
+
+// check returns nil when the operation may apply: it needs no confirmation or
+// token confirms it. Otherwise it returns the confirmation the panel must
+// send, replacing an expired or mismatched token with a new one. A matching
+// token stays valid until confirmed is called, so a retry after a version
+// conflict does not need confirming again.
+func (gate *confirmationGate) check(operation types.UpdateType, panelID string, payload interface{}, token string, now time.Time) *ConfirmationRequiredError {
+	if gate == nil {
+		return nil
+	}
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+
+	timeout, ok := gate.timeouts[operation]
+	if !ok {
+		return nil
+	}
+	for key, p := range gate.pending {
+		if !now.Before(p.expiresAt) {
+			delete(gate.pending, key)
+		}
+	}
+
+	canonical := canonicalPayload(payload)
+	if p, ok := gate.pending[token]; ok {
+		if p.operation == operation && p.panelID == panelID && p.payload == canonical {
+			return nil
+		}
+		delete(gate.pending, token)
+	}
+
+	required := &ConfirmationRequiredError{
+		Operation: operation,
+		Token:     newConfirmationToken(),
+		ExpiresAt: now.Add(timeout),
+	}
+	gate.pending[required.Token] = pendingConfirmation{
+		operation: operation,
+		panelID:   panelID,
+		payload:   canonical,
+		expiresAt: required.ExpiresAt,
+	}
+	return required
+}
+
+// confirmed retires a token once its update has applied
+func (gate *confirmationGate) confirmed(token string) {
+	if gate == nil || token == "" {
+		return
+	}
+	gate.mutex.Lock()
+	defer gate.mutex.Unlock()
+	delete(gate.pending, token)
+}
+
+// canonicalPayload encodes a payload the same way whether it arrived as a
+// struct or as the map JSON decoding produced
+func canonicalPayload(payload interface{}) string {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return ""
+	}
+	var generic interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return ""
+	}
+	raw, _ = json.Marshal(generic)
+	return string(raw)
+}
+
+func newConfirmationToken() string {
+	buf := make([]byte, 16)
+	_, _ = rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
+
+// confirmationResponse is sent in place of a normal response while an update
+// waits for confirmation
+func confirmationResponse(required *ConfirmationRequiredError, requestID string) IPCMessage {
+	return IPCMessage{
+		Type:      "confirmation_required",
+		RequestID: requestID,
+		Data: map[string]interface{}{
+			"success":            false,
+			"error":              required.Error(),
+			"operation":          required.Operation,
+			"confirmation_token": required.Token,
+			"expires_at":         required.ExpiresAt,
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// decodeConfirmationRequired turns a confirmation_required response back
+// into the error the caller can test for with errors.As
+func decodeConfirmationRequired(response *IPCMessage) error {
+	var data struct {
+		Operation types.UpdateType `json:"operation"`
+		Token     string           `json:"confirmation_token"`
+		ExpiresAt time.Time        `json:"expires_at"`
+	}
+	if err := mapToStruct(response.Data, &data); err != nil {
+		return fmt.Errorf("invalid confirmation response: %w", err)
+	}
+	return &ConfirmationRequiredError{Operation: data.Operation, Token: data.Token, ExpiresAt: data.ExpiresAt}
+}
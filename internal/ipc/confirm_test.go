@@ -0,0 +1,100 @@
+package ipc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestConfirmationGate(t *testing.T) {
+	now := time.Now()
+	deleteA := types.SessionDeletePayload{SessionID: "a"}
+	// The same payload as it arrives over IPC, decoded into a map
+	deleteAWire := map[string]interface{}{"session_id": "a"}
+
+	gate := newConfirmationGate(map[types.UpdateType]time.Duration{
+		types.SessionDeleted:  30 * time.Second,
+		types.MessagesCleared: 0, // Listed but disabled
+	})
+
+	if required := gate.check(types.MessagesCleared, "p1", types.MessagesClearPayload{SessionID: "a"}, "", now); required != nil {
+		t.Fatalf("disabled operation required confirmation")
+	}
+	if required := gate.check(types.ThemeChanged, "p1", nil, "", now); required != nil {
+		t.Fatalf("unlisted operation required confirmation")
+	}
+
+	first := gate.check(types.SessionDeleted, "p1", deleteA, "", now)
+	if first == nil || first.Token == "" {
+		t.Fatalf("first request was not held for confirmation")
+	}
+	if want := now.Add(30 * time.Second); !first.ExpiresAt.Equal(want) {
+		t.Errorf("ExpiresAt = %v, want %v", first.ExpiresAt, want)
+	}
+
+	tests := []struct {
+		name    string
+		panelID string
+		payload interface{}
+		at      time.Time
+	}{
+		{"other panel", "p2", deleteA, now},
+		{"other session", "p1", types.SessionDeletePayload{SessionID: "b"}, now},
+		{"expired", "p1", deleteA, first.ExpiresAt},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gate := newConfirmationGate(map[types.UpdateType]time.Duration{types.SessionDeleted: 30 * time.Second})
+			pending := gate.check(types.SessionDeleted, "p1", deleteA, "", now)
+			retry := gate.check(types.SessionDeleted, tt.panelID, tt.payload, pending.Token, tt.at)
+			if retry == nil {
+				t.Fatalf("token was accepted")
+			}
+			if retry.Token == pending.Token {
+				t.Errorf("rejected token was reissued")
+			}
+			// A rejected token is spent even for the request it was issued for
+			if gate.check(types.SessionDeleted, "p1", deleteA, pending.Token, now) == nil {
+				t.Errorf("rejected token still confirms")
+			}
+		})
+	}
+
+	// The sender repeating the update confirms it, and keeps confirming it
+	// until it applies, so a retry after a version conflict goes through
+	if required := gate.check(types.SessionDeleted, "p1", deleteAWire, first.Token, now.Add(time.Second)); required != nil {
+		t.Fatalf("confirming request was held again: %v", required)
+	}
+	if required := gate.check(types.SessionDeleted, "p1", deleteAWire, first.Token, now.Add(2*time.Second)); required != nil {
+		t.Fatalf("retried confirmation was held again: %v", required)
+	}
+	gate.confirmed(first.Token)
+	if gate.check(types.SessionDeleted, "p1", deleteA, first.Token, now.Add(3*time.Second)) == nil {
+		t.Errorf("token confirmed a second update")
+	}
+
+	var disabled *confirmationGate
+	if disabled.check(types.SessionDeleted, "p1", deleteA, "", now) != nil {
+		t.Errorf("nil gate required confirmation")
+	}
+}
+
+func TestDecodeConfirmationRequired(t *testing.T) {
+	expires := time.Now().Add(time.Minute).Round(time.Second)
+	sent := confirmationResponse(&ConfirmationRequiredError{Operation: types.MessagesCleared, Token: "abc", ExpiresAt: expires}, "req-1")
+
+	// Round trip through a map, as the client sees it
+	var data map[string]interface{}
+	if err := mapToStruct(sent.Data, &data); err != nil {
+		t.Fatal(err)
+	}
+	err := decodeConfirmationRequired(&IPCMessage{Type: sent.Type, RequestID: sent.RequestID, Data: data})
+	required, ok := err.(*ConfirmationRequiredError)
+	if !ok {
+		t.Fatalf("decodeConfirmationRequired() = %T %v, want *ConfirmationRequiredError", err, err)
+	}
+	if required.Operation != types.MessagesCleared || required.Token != "abc" || !required.ExpiresAt.Equal(expires) {
+		t.Errorf("decoded %+v", required)
+	}
+}
@@ -0,0 +1,266 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// FramingLengthPrefixed is the framing a client asks for in its handshake.
+// Each message is a 4-byte big-endian length followed by that many bytes of
+// JSON. Peers that do not ask for it, or servers that do not grant it, keep
+// exchanging newline-delimited JSON.
+const FramingLengthPrefixed = "length-prefixed"
+
+// frameHeaderSize is the size of the length prefix
+const frameHeaderSize = 4
+
+// DefaultMaxFrameSize bounds a single message; a full state sync of a long
+// history is the largest message sent
+const DefaultMaxFrameSize = 64 << 20
+
+var (
+	// ErrFrameTooLarge is returned for a message over the frame size limit.
+	// The oversized frame is skipped, so the stream stays usable.
+	ErrFrameTooLarge = errors.New("ipc frame exceeds maximum size")
+	// ErrInvalidFrame is returned for a frame that does not hold a JSON
+	// message; the stream stays usable
+	ErrInvalidFrame = errors.New("ipc frame is not a valid message")
+)
+
+// messageEncoder writes one message to a connection
+type messageEncoder interface {
+	Encode(v interface{}) error
+}
+
+// rawEncoder also writes messages that are already JSON, such as events
+// encoded once for every subscriber
+type rawEncoder interface {
+	messageEncoder
+	EncodeRaw(payload []byte) error
+}
+
+// messageDecoder reads one message from a connection
+type messageDecoder interface {
+	Decode(v interface{}) error
+}
+
+// FrameEncoder writes messages as length-prefixed frames
+type FrameEncoder struct {
+	w       io.Writer
+	maxSize int
+	buf     bytes.Buffer
+}
+
+// NewFrameEncoder returns an encoder writing to w; a maxSize of zero uses
+// DefaultMaxFrameSize
+func NewFrameEncoder(w io.Writer, maxSize int) *FrameEncoder {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameEncoder{w: w, maxSize: maxSize}
+}
+
+// Encode writes v as one frame, with its times in UTC. A message over the
+// size limit is not written.
+func (e *FrameEncoder) Encode(v interface{}) error {
+	payload, err := json.Marshal(timefmt.UTC(v))
+	if err != nil {
+		return err
+	}
+	return e.EncodeRaw(payload)
+}
+
+// EncodeRaw writes payload, which must be one JSON message, as one frame
+func (e *FrameEncoder) EncodeRaw(payload []byte) error {
+	if len(payload) > e.maxSize {
+		return fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, len(payload), e.maxSize)
+	}
+
+	// Header and payload go out in one write so a frame is never split by
+	// another writer
+	e.buf.Reset()
+	var header [frameHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:], uint32(len(payload)))
+	e.buf.Write(header[:])
+	e.buf.Write(payload)
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// lineEncoder writes messages as newline-delimited JSON
+type lineEncoder struct {
+	*json.Encoder
+	w   io.Writer
+	buf bytes.Buffer
+}
+
+func newLineEncoder(w io.Writer) *lineEncoder {
+	return &lineEncoder{Encoder: json.NewEncoder(w), w: w}
+}
+
+// Encode writes v and its newline, with its times in UTC
+func (e *lineEncoder) Encode(v interface{}) error {
+	return e.Encoder.Encode(timefmt.UTC(v))
+}
+
+// EncodeRaw writes payload, which must be one compact JSON message, and its
+// newline in one write
+func (e *lineEncoder) EncodeRaw(payload []byte) error {
+	e.buf.Reset()
+	e.buf.Write(payload)
+	e.buf.WriteByte('\n')
+	_, err := e.w.Write(e.buf.Bytes())
+	return err
+}
+
+// FrameDecoder reads length-prefixed frames. A read that fails part way
+// through a frame, such as on a read deadline, keeps what was read and the
+// next Decode carries on from there.
+type FrameDecoder struct {
+	r       io.Reader
+	maxSize int
+
+	header    [frameHeaderSize]byte
+	headerLen int    // Header bytes read so far
+	payload   []byte // Payload of the current frame, nil between frames
+	read      int    // Payload bytes read so far
+	skip      int    // Bytes of an oversized frame still to discard
+}
+
+// NewFrameDecoder returns a decoder reading from r; a maxSize of zero uses
+// DefaultMaxFrameSize
+func NewFrameDecoder(r io.Reader, maxSize int) *FrameDecoder {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxFrameSize
+	}
+	return &FrameDecoder{r: r, maxSize: maxSize}
+}
+
+// Decode reads the next frame into v
+func (d *FrameDecoder) Decode(v interface{}) error {
+	payload, err := d.next()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(payload, v); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFrame, err)
+	}
+	return nil
+}
+
+// next returns the payload of the next complete frame
+func (d *FrameDecoder) next() ([]byte, error) {
+	for {
+		if d.skip > 0 {
+			if err := d.discard(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		if d.payload == nil {
+			for d.headerLen < frameHeaderSize {
+				n, err := d.r.Read(d.header[d.headerLen:])
+				d.headerLen += n
+				if err != nil && d.headerLen < frameHeaderSize {
+					if errors.Is(err, io.EOF) && d.headerLen > 0 {
+						return nil, io.ErrUnexpectedEOF
+					}
+					return nil, err
+				}
+			}
+			d.headerLen = 0
+			size := int(binary.BigEndian.Uint32(d.header[:]))
+			if size > d.maxSize {
+				// The frame is discarded by the next Decode
+				d.skip = size
+				return nil, fmt.Errorf("%w: %d bytes, limit %d", ErrFrameTooLarge, size, d.maxSize)
+			}
+			d.payload = make([]byte, size)
+			d.read = 0
+		}
+
+		for d.read < len(d.payload) {
+			n, err := d.r.Read(d.payload[d.read:])
+			d.read += n
+			if err != nil && d.read < len(d.payload) {
+				if errors.Is(err, io.EOF) {
+					return nil, io.ErrUnexpectedEOF
+				}
+				return nil, err
+			}
+		}
+		payload := d.payload
+		d.payload = nil
+		return payload, nil
+	}
+}
+
+// discard drops the rest of an oversized frame
+func (d *FrameDecoder) discard() error {
+	var scratch [32 << 10]byte
+	for d.skip > 0 {
+		chunk := scratch[:]
+		if d.skip < len(chunk) {
+			chunk = chunk[:d.skip]
+		}
+		n, err := d.r.Read(chunk)
+		d.skip -= n
+		if err != nil && d.skip > 0 {
+			if errors.Is(err, io.EOF) {
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// isRecoverableFrameError reports whether a decode error left the stream
+// usable, so the reader can go on to the next message
+func isRecoverableFrameError(err error) bool {
+	return errors.Is(err, ErrFrameTooLarge) || errors.Is(err, ErrInvalidFrame)
+}
+
+// framingName describes a negotiated framing for logs
+func framingName(framing string) string {
+	if framing == "" {
+		return "json-lines"
+	}
+	return framing
+}
+
+// AfterHandshake returns the reader for what follows the handshake on conn:
+// whatever the JSON decoder has already buffered, then the connection, less
+// the newline the JSON encoder wrote after the handshake message
+func AfterHandshake(decoder *json.Decoder, conn io.Reader) io.Reader {
+	return &newlineSkipper{r: io.MultiReader(decoder.Buffered(), conn)}
+}
+
+// newlineSkipper drops one newline at the start of a stream
+type newlineSkipper struct {
+	r       io.Reader
+	checked bool
+}
+
+func (s *newlineSkipper) Read(p []byte) (int, error) {
+	if !s.checked && len(p) > 0 {
+		var first [1]byte
+		n, err := s.r.Read(first[:])
+		if n == 0 {
+			return 0, err
+		}
+		s.checked = true
+		if first[0] != '\n' {
+			p[0] = first[0]
+			return 1, nil
+		}
+	}
+	return s.r.Read(p)
+}
@@ -0,0 +1,266 @@
+package ipc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func encodeFrames(t testing.TB, maxSize int, messages ...interface{}) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	encoder := NewFrameEncoder(&buf, maxSize)
+	for _, message := range messages {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatalf("Encode(%v) error = %v", message, err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func rawFrame(payload string) []byte {
+	frame := make([]byte, frameHeaderSize, frameHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(frame, uint32(len(payload)))
+	return append(frame, payload...)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	messages := []IPCMessage{
+		{Type: MessageTypeStateUpdate, RequestID: "req-1", Data: "line one\nline two\n"},
+		{Type: MessageTypePing},
+		{Type: MessageTypeStateUpdate, Data: strings.Repeat("x", 100<<10)},
+	}
+	var in []interface{}
+	for _, message := range messages {
+		in = append(in, message)
+	}
+	stream := encodeFrames(t, 0, in...)
+
+	readers := map[string]io.Reader{
+		"whole":    bytes.NewReader(stream),
+		"one byte": iotest.OneByteReader(bytes.NewReader(stream)),
+		"half":     iotest.HalfReader(bytes.NewReader(stream)),
+	}
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			decoder := NewFrameDecoder(reader, 0)
+			for i, want := range messages {
+				var got IPCMessage
+				if err := decoder.Decode(&got); err != nil {
+					t.Fatalf("Decode() #%d error = %v", i, err)
+				}
+				if got.Type != want.Type || got.RequestID != want.RequestID || got.Data != want.Data {
+					t.Errorf("Decode() #%d = %+v, want %+v", i, got, want)
+				}
+			}
+			if err := decoder.Decode(&IPCMessage{}); err != io.EOF {
+				t.Errorf("Decode() at end error = %v, want io.EOF", err)
+			}
+		})
+	}
+}
+
+// timeoutReader returns its chunks in turn, failing with a timeout between
+// each, as a connection with a read deadline does
+type timeoutReader struct {
+	chunks  [][]byte
+	timeout bool
+}
+
+func (r *timeoutReader) Read(p []byte) (int, error) {
+	if r.timeout {
+		r.timeout = false
+		return 0, os.ErrDeadlineExceeded
+	}
+	if len(r.chunks) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+		r.timeout = true
+	}
+	return n, nil
+}
+
+func TestFrameDecoderResumesAfterTimeout(t *testing.T) {
+	stream := encodeFrames(t, 0, map[string]string{"text": "first"}, map[string]string{"text": "second"})
+	// Split inside the first header and inside the second payload
+	reader := &timeoutReader{chunks: [][]byte{stream[:2], stream[2:9], stream[9 : len(stream)-3], stream[len(stream)-3:]}}
+	decoder := NewFrameDecoder(reader, 0)
+
+	var got []string
+	for len(got) < 2 {
+		var message map[string]string
+		err := decoder.Decode(&message)
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Decode() error = %v", err)
+		}
+		got = append(got, message["text"])
+	}
+	if got[0] != "first" || got[1] != "second" {
+		t.Errorf("decoded %v, want [first second]", got)
+	}
+}
+
+func TestFrameDecoderSkipsBadFrames(t *testing.T) {
+	var stream []byte
+	stream = append(stream, rawFrame(`{"n":1}`)...)
+	stream = append(stream, rawFrame(`{"n":"`+strings.Repeat("x", 64)+`"}`)...)
+	stream = append(stream, rawFrame(`{"n":`)...)
+	stream = append(stream, rawFrame(`{"n":2}`)...)
+	decoder := NewFrameDecoder(iotest.OneByteReader(bytes.NewReader(stream)), 32)
+
+	wantErrs := []error{nil, ErrFrameTooLarge, ErrInvalidFrame, nil}
+	var got []int
+	for i, wantErr := range wantErrs {
+		var message struct{ N int }
+		err := decoder.Decode(&message)
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("Decode() #%d error = %v, want %v", i, err, wantErr)
+		}
+		if err != nil {
+			if !isRecoverableFrameError(err) {
+				t.Errorf("Decode() #%d error %v is not recoverable", i, err)
+			}
+			continue
+		}
+		got = append(got, message.N)
+	}
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("decoded %v, want [1 2]", got)
+	}
+}
+
+func TestFrameDecoderTruncatedStream(t *testing.T) {
+	stream := encodeFrames(t, 0, map[string]string{"text": "hello"})
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, io.EOF},
+		{"partial header", stream[:2], io.ErrUnexpectedEOF},
+		{"partial payload", stream[:len(stream)-1], io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := NewFrameDecoder(bytes.NewReader(tt.data), 0).Decode(&map[string]string{})
+			if err != tt.want {
+				t.Errorf("Decode() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFrameEncoderRejectsOversizedMessage(t *testing.T) {
+	var buf bytes.Buffer
+	encoder := NewFrameEncoder(&buf, 16)
+	if err := encoder.Encode(strings.Repeat("x", 32)); !errors.Is(err, ErrFrameTooLarge) {
+		t.Errorf("Encode() error = %v, want ErrFrameTooLarge", err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("oversized message wrote %d bytes", buf.Len())
+	}
+	if err := encoder.Encode("ok"); err != nil {
+		t.Errorf("Encode() after rejection error = %v", err)
+	}
+}
+
+func TestAfterHandshake(t *testing.T) {
+	// The client's handshake is newline-terminated JSON and the first frame
+	// can follow in the same read
+	var stream bytes.Buffer
+	json.NewEncoder(&stream).Encode(HandshakeMessage{PanelID: "panel-1", Framing: FramingLengthPrefixed})
+	stream.Write(encodeFrames(t, 0, map[string]string{"text": "framed"}))
+
+	conn := bytes.NewReader(stream.Bytes())
+	handshakeDecoder := json.NewDecoder(conn)
+	var handshake HandshakeMessage
+	if err := handshakeDecoder.Decode(&handshake); err != nil {
+		t.Fatalf("handshake Decode() error = %v", err)
+	}
+	if handshake.Framing != FramingLengthPrefixed {
+		t.Errorf("Framing = %q, want %q", handshake.Framing, FramingLengthPrefixed)
+	}
+
+	var message map[string]string
+	if err := NewFrameDecoder(AfterHandshake(handshakeDecoder, conn), 0).Decode(&message); err != nil {
+		t.Fatalf("frame Decode() error = %v", err)
+	}
+	if message["text"] != "framed" {
+		t.Errorf("frame = %v, want text framed", message)
+	}
+}
+
+func FuzzFrameDecoder(f *testing.F) {
+	f.Add(rawFrame(`{"type":"ping"}`))
+	f.Add(append(rawFrame(`{"n":1}`), rawFrame(`{"n":`)...))
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff, '{'})
+	f.Add([]byte{0, 0})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		decoder := NewFrameDecoder(bytes.NewReader(data), 1<<10)
+		// Every frame consumes at least its header, so the loop ends
+		for i := 0; i <= len(data); i++ {
+			var message IPCMessage
+			err := decoder.Decode(&message)
+			if err != nil && !isRecoverableFrameError(err) {
+				return
+			}
+		}
+		t.Fatalf("decoder did not reach the end of %d bytes", len(data))
+	})
+}
+
+func FuzzFrameRoundTrip(f *testing.F) {
+	f.Add("hello", "req-1")
+	f.Add("multi\nline\r\n", "")
+	f.Add("\x00\xff{\"type\":", "p\n")
+	f.Fuzz(func(t *testing.T, data, requestID string) {
+		want := IPCMessage{Type: MessageTypeStateUpdate, RequestID: requestID, Data: data}
+		stream := encodeFrames(t, 0, want, want)
+		decoder := NewFrameDecoder(iotest.HalfReader(bytes.NewReader(stream)), 0)
+		for i := 0; i < 2; i++ {
+			var got IPCMessage
+			if err := decoder.Decode(&got); err != nil {
+				t.Fatalf("Decode() #%d error = %v", i, err)
+			}
+			// JSON replaces invalid UTF-8, so compare against its own round trip
+			wantJSON, _ := json.Marshal(want)
+			gotJSON, _ := json.Marshal(got)
+			if !bytes.Equal(wantJSON, gotJSON) {
+				t.Fatalf("Decode() #%d = %+v, want %+v", i, got, want)
+			}
+		}
+	})
+}
+
+func TestEncodeRaw(t *testing.T) {
+	payload := []byte(`{"type":"state_event","data":{"text":"a\nb"}}`)
+
+	var lines bytes.Buffer
+	if err := newLineEncoder(&lines).EncodeRaw(payload); err != nil {
+		t.Fatalf("lineEncoder.EncodeRaw() error = %v", err)
+	}
+	if lines.String() != string(payload)+"\n" {
+		t.Errorf("line = %q, want the payload and a newline", lines.String())
+	}
+
+	var frames bytes.Buffer
+	if err := NewFrameEncoder(&frames, 0).EncodeRaw(payload); err != nil {
+		t.Fatalf("FrameEncoder.EncodeRaw() error = %v", err)
+	}
+	if !bytes.Equal(frames.Bytes(), rawFrame(string(payload))) {
+		t.Errorf("frame = %q, want %q", frames.Bytes(), rawFrame(string(payload)))
+	}
+}
@@ -0,0 +1,59 @@
+package ipc
+
+import (
+	"fmt"
+
+	"github.com/opencode/tmux_coder/internal/macro"
+)
+
+// runMacroCommand executes a macro command and returns the fields to add to its response
+func (server *SocketServer) runMacroCommand(command string, params map[string]interface{}) (map[string]interface{}, error) {
+	var args struct {
+		Name string `json:"name"`
+		macro.ReplayOptions
+	}
+	if params != nil {
+		if err := mapToStruct(params, &args); err != nil {
+			return nil, fmt.Errorf("invalid macro parameters")
+		}
+	}
+
+	switch command {
+	case "macro_record":
+		if err := server.control.StartMacroRecording(args.Name); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"name": args.Name}, nil
+
+	case "macro_stop":
+		info, err := server.control.StopMacroRecording()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"macro": info}, nil
+
+	case "macro_replay":
+		if args.Speed < 0 {
+			return nil, fmt.Errorf("speed cannot be negative")
+		}
+		info, err := server.control.ReplayMacro(args.Name, args.ReplayOptions)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"macro": info}, nil
+
+	case "macro_list":
+		macros, err := server.control.ListMacros()
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"macros": macros}, nil
+
+	case "macro_delete":
+		if err := server.control.DeleteMacro(args.Name); err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"name": args.Name}, nil
+	}
+	return nil, fmt.Errorf("unsupported macro command")
+}
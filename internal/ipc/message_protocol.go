@@ -2,8 +2,13 @@ package ipc
 
 import (
 	"encoding/json"
+	"fmt"
 	"reflect"
+	"sync/atomic"
 	"time"
+
+	"github.com/opencode/tmux_coder/internal/metrics"
+	"github.com/opencode/tmux_coder/internal/types"
 )
 
 // IPCMessage represents a message exchanged between server and clients
@@ -12,6 +17,10 @@ type IPCMessage struct {
 	RequestID string      `json:"request_id,omitempty"`
 	Data      interface{} `json:"data"`
 	Timestamp time.Time   `json:"timestamp"`
+	// TraceParent is the W3C trace context of the sender's span, if any
+	TraceParent string `json:"trace_parent,omitempty"`
+	// Sequence of a state event for the receiving panel, see types.StateEvent
+	Sequence int64 `json:"sequence,omitempty"`
 }
 
 // HandshakeMessage is sent by clients to initiate connection
@@ -21,6 +30,18 @@ type HandshakeMessage struct {
 	PanelType string    `json:"panel_type"` // "sessions", "messages", "input"
 	Version   string    `json:"version"`    // Protocol version
 	Timestamp time.Time `json:"timestamp"`
+	// What the panel can handle; omitted by panels that take every event
+	Capabilities *types.PanelCapabilities `json:"capabilities,omitempty"`
+	// Framing the client wants after the handshake; empty keeps JSON lines
+	Framing string `json:"framing,omitempty"`
+	// Build of the panel's binary; empty from panels that predate it
+	Build string `json:"build,omitempty"`
+	// Stable identity the orchestrator gave the panel, see PanelIdentityEnv
+	Identity string `json:"identity,omitempty"`
+	// Set when the process connected before and replays what it missed
+	// itself; otherwise the server replays what the identity's previous
+	// process was never sent
+	Reconnect bool `json:"reconnect,omitempty"`
 }
 
 // HandshakeResponse is sent by server in response to handshake
@@ -30,6 +51,22 @@ type HandshakeResponse struct {
 	ConnectionID string    `json:"connection_id"` // Server-assigned connection ID
 	ServerTime   time.Time `json:"server_time"`
 	Error        string    `json:"error,omitempty"`
+	// Framing both sides use after the handshake; empty keeps JSON lines
+	Framing string `json:"framing,omitempty"`
+	// Build and protocol of the orchestrator, for the panel to compare with its own
+	Build    string `json:"build,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Run of the server; it changes when the server restarts, so a panel
+	// knows whether the events it missed can still be replayed
+	Instance string `json:"instance,omitempty"`
+}
+
+// PongPayload answers a ping with the server's state version and the
+// checksum of each section of the state at that version, for the panel to
+// compare with its cached view
+type PongPayload struct {
+	Version   int64                `json:"version"`
+	Checksums types.StateChecksums `json:"checksums,omitempty"`
 }
 
 // Message type constants
@@ -40,6 +77,9 @@ const (
 	MessageTypeStateUpdateResponse = "state_update_response"
 	MessageTypeStateRequest        = "state_request"
 	MessageTypeStateResponse       = "state_response"
+	MessageTypeStateManifest       = "state_manifest"
+	MessageTypeStateChunkRequest   = "state_chunk_request"
+	MessageTypeStateChunk          = "state_chunk"
 	MessageTypeStateEvent          = "state_event"
 	MessageTypePing                = "ping"
 	MessageTypePong                = "pong"
@@ -124,12 +164,13 @@ func (v *MessageValidator) ValidateHandshake(msg HandshakeMessage) error {
 		"messages":   true,
 		"input":      true,
 		"controller": true,
+		"diff":       true,
 	}
 
 	if !validPanelTypes[msg.PanelType] {
 		return &ValidationError{
 			Field:   "panel_type",
-			Message: "must be one of: sessions, messages, input, controller",
+			Message: "must be one of: sessions, messages, input, controller, diff",
 		}
 	}
 
@@ -186,6 +227,24 @@ func (v *MessageValidator) ValidateIPCMessage(msg IPCMessage) error {
 	return nil
 }
 
+// ValidateUIAction checks a UI action against the action catalog, so a
+// misspelled action or argument is rejected instead of silently ignored
+func (v *MessageValidator) ValidateUIAction(payload types.UIActionPayload) error {
+	if !payload.Action.Known() {
+		return &ValidationError{
+			Field:   "action",
+			Message: fmt.Sprintf("unknown UI action %q", payload.Action),
+		}
+	}
+	if err := payload.Validate(); err != nil {
+		return &ValidationError{
+			Field:   "data",
+			Message: err.Error(),
+		}
+	}
+	return nil
+}
+
 // ValidationError represents a message validation error
 type ValidationError struct {
 	Field   string `json:"field"`
@@ -306,7 +365,7 @@ func structToMap(data interface{}) (map[string]interface{}, error) {
 
 // isValidPanelType checks if a panel type is valid
 func isValidPanelType(panelType string) bool {
-	validTypes := []string{"sessions", "messages", "input", "controller"}
+	validTypes := []string{"sessions", "messages", "input", "controller", "diff"}
 	for _, valid := range validTypes {
 		if panelType == valid {
 			return true
@@ -333,8 +392,17 @@ func createIPCMessage(msgType string, data interface{}) IPCMessage {
 	}
 }
 
-// MessageStats tracks statistics about message processing
+// MessageStats tracks statistics about message processing. Every connection
+// records into it at once, so counts are atomic and read through Snapshot.
 type MessageStats struct {
+	totalMessages  atomic.Int64
+	messagesByType metrics.CounterMap[string]
+	errorCount     atomic.Int64
+	lastMessage    metrics.Stamp
+}
+
+// MessageStatsSnapshot is a copy of MessageStats at one moment
+type MessageStatsSnapshot struct {
 	TotalMessages   int64            `json:"total_messages"`
 	MessagesByType  map[string]int64 `json:"messages_by_type"`
 	ErrorCount      int64            `json:"error_count"`
@@ -343,29 +411,37 @@ type MessageStats struct {
 
 // NewMessageStats creates a new message statistics tracker
 func NewMessageStats() *MessageStats {
-	return &MessageStats{
-		MessagesByType: make(map[string]int64),
-	}
+	return &MessageStats{}
 }
 
 // RecordMessage records statistics for a processed message
 func (s *MessageStats) RecordMessage(messageType string, success bool) {
-	s.TotalMessages++
-	s.MessagesByType[messageType]++
-	s.LastMessageTime = time.Now()
+	s.totalMessages.Add(1)
+	s.messagesByType.Add(messageType, 1)
+	s.lastMessage.Set(time.Now())
 
 	if !success {
-		s.ErrorCount++
+		s.errorCount.Add(1)
+	}
+}
+
+// Snapshot copies the statistics
+func (s *MessageStats) Snapshot() MessageStatsSnapshot {
+	return MessageStatsSnapshot{
+		TotalMessages:   s.totalMessages.Load(),
+		MessagesByType:  s.messagesByType.Snapshot(),
+		ErrorCount:      s.errorCount.Load(),
+		LastMessageTime: s.lastMessage.Load(),
 	}
 }
 
 // GetMessageRate returns messages per second over the last period
 func (s *MessageStats) GetMessageRate(period time.Duration) float64 {
-	if time.Since(s.LastMessageTime) > period {
+	if time.Since(s.lastMessage.Load()) > period {
 		return 0
 	}
 
-	return float64(s.TotalMessages) / period.Seconds()
+	return float64(s.totalMessages.Load()) / period.Seconds()
 }
 
 // TypeSafeMessage provides type-safe message creation
@@ -0,0 +1,95 @@
+package ipc
+
+import (
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// opencodeSessions is implemented by state managers that move sessions in and
+// out in the opencode server's native format; a replica does not
+type opencodeSessions interface {
+	ExportOpencodeSessionJSON(sessionID string) ([]byte, error)
+	ImportOpencodeSessionJSON(data []byte, panelID string) (types.SessionInfo, error)
+}
+
+// handleOpencodeExport returns a session as `opencode export` writes it
+func (server *SocketServer) handleOpencodeExport(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		SessionID string `json:"session_id"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode opencode export request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+	sessions, ok := server.stateManager.(opencodeSessions)
+	if !ok {
+		server.sendErrorMessage(clientConn, "error", "session export is not supported here", message.RequestID)
+		return
+	}
+	if request.SessionID == "" {
+		request.SessionID = server.stateManager.GetState().CurrentSessionID
+	}
+	if request.SessionID == "" {
+		server.sendErrorMessage(clientConn, "error", "no session selected; give a session ID", message.RequestID)
+		return
+	}
+
+	data, err := sessions.ExportOpencodeSessionJSON(request.SessionID)
+	if err != nil {
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	response := IPCMessage{
+		Type:      "opencode_export_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"session_id": request.SessionID,
+			"export":     string(data),
+		},
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send opencode export response: %v", err)
+	}
+}
+
+// handleOpencodeImport adds a session from the output of `opencode export`
+func (server *SocketServer) handleOpencodeImport(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		Export string `json:"export"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode opencode import request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+	sessions, ok := server.stateManager.(opencodeSessions)
+	if !ok {
+		server.sendErrorMessage(clientConn, "error", "session import is not supported here", message.RequestID)
+		return
+	}
+
+	session, err := sessions.ImportOpencodeSessionJSON([]byte(request.Export), clientConn.PanelID)
+	if err != nil {
+		log.Printf("Failed to import opencode session: %v", err)
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	response := IPCMessage{
+		Type:      "opencode_import_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"success": true,
+			"session": session,
+		},
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send opencode import response: %v", err)
+	}
+}
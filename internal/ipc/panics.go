@@ -0,0 +1,60 @@
+package ipc
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+)
+
+// Components whose panics the server recovers from
+const (
+	ComponentIPCHandler   = "ipc_handler"
+	ComponentIPCForwarder = "ipc_forwarder"
+)
+
+// panicReporter is implemented by state managers that count recovered panics
+// and announce them to panels
+type panicReporter interface {
+	ReportPanic(component, context string, value interface{}, stack []byte)
+}
+
+// reportPanic hands a recovered panic to the state manager, or logs it when
+// the manager cannot take it
+func (server *SocketServer) reportPanic(component, context string, value interface{}, stack []byte) {
+	if reporter, ok := server.stateManager.(panicReporter); ok {
+		reporter.ReportPanic(component, context, value, stack)
+		return
+	}
+	log.Printf("[PANIC] Recovered panic in %s (%s): %v\n%s", component, context, value, stack)
+}
+
+// recoverHandler is deferred around each message handler. A panic fails the
+// request with an error response instead of taking the server down.
+func (server *SocketServer) recoverHandler(clientConn *ClientConnection, message IPCMessage) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	server.reportPanic(ComponentIPCHandler, fmt.Sprintf("%s from %s", message.Type, clientConn.PanelID), r, debug.Stack())
+	server.sendErrorMessage(clientConn, MessageTypeError, fmt.Sprintf("internal error handling %s", message.Type), message.RequestID)
+}
+
+// recoverConnection is deferred around a connection's handshake and read
+// loop; the connection is closed and the server keeps accepting others
+func (server *SocketServer) recoverConnection() {
+	if r := recover(); r != nil {
+		server.reportPanic(ComponentIPCHandler, "connection", r, debug.Stack())
+	}
+}
+
+// recoverForwarder is deferred around a client's event forwarding. A panic
+// disconnects that client, which reconnects and resyncs, and leaves the rest
+// connected.
+func (server *SocketServer) recoverForwarder(clientConn *ClientConnection) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	server.reportPanic(ComponentIPCForwarder, "events to "+clientConn.PanelID, r, debug.Stack())
+	server.disconnectClient(clientConn, "event forwarding failed")
+}
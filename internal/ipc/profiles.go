@@ -0,0 +1,97 @@
+package ipc
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// The write_profile admin command captures a pprof profile of the daemon to
+// a file, so slowness in a huge session can be diagnosed without a build
+// carrying instrumentation. CPU, block and mutex profiles sample the daemon
+// for a while, and blocking and contention are recorded only during it; the
+// other profiles are snapshots.
+
+const (
+	defaultProfileDuration = 30 * time.Second
+	// maxProfileDuration keeps sampling within the time an admin client waits
+	maxProfileDuration = 50 * time.Second
+	// mutexProfileFraction reports one in this many mutex contention events
+	mutexProfileFraction = 5
+)
+
+// SetProfileDir sets where write_profile writes profiles; empty writes them
+// to the system's temporary directory
+func (server *SocketServer) SetProfileDir(dir string) {
+	server.profileMutex.Lock()
+	defer server.profileMutex.Unlock()
+	server.profileDir = dir
+}
+
+// writeProfile captures a profile of the given kind, sampling for duration
+// when the kind samples, and returns the path of the file written
+func (server *SocketServer) writeProfile(kind string, duration time.Duration) (string, error) {
+	// Besides CPU, the runtime's own profiles: heap, allocs, goroutine,
+	// threadcreate, block and mutex
+	if kind != "cpu" && pprof.Lookup(kind) == nil {
+		return "", fmt.Errorf("unknown profile %q", kind)
+	}
+	if duration <= 0 {
+		duration = defaultProfileDuration
+	}
+	if duration > maxProfileDuration {
+		return "", fmt.Errorf("profiles sample for at most %v", maxProfileDuration)
+	}
+
+	// Sampling changes process-wide settings, so one profile at a time
+	if !server.profileMutex.TryLock() {
+		return "", fmt.Errorf("a profile is already being captured")
+	}
+	defer server.profileMutex.Unlock()
+
+	dir := server.profileDir
+	if dir == "" {
+		dir = os.TempDir()
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create profile directory: %w", err)
+	}
+	file, err := os.CreateTemp(dir, kind+"-"+time.Now().Format("20060102-150405")+"-*.pprof")
+	if err != nil {
+		return "", fmt.Errorf("failed to create profile: %w", err)
+	}
+	path := file.Name()
+
+	switch kind {
+	case "cpu":
+		if err = pprof.StartCPUProfile(file); err == nil {
+			time.Sleep(duration)
+			pprof.StopCPUProfile()
+		}
+	case "block":
+		runtime.SetBlockProfileRate(1)
+		time.Sleep(duration)
+		err = pprof.Lookup(kind).WriteTo(file, 0)
+		runtime.SetBlockProfileRate(0)
+	case "mutex":
+		previous := runtime.SetMutexProfileFraction(mutexProfileFraction)
+		time.Sleep(duration)
+		err = pprof.Lookup(kind).WriteTo(file, 0)
+		runtime.SetMutexProfileFraction(previous)
+	default:
+		if kind == "heap" || kind == "allocs" {
+			runtime.GC() // Count what is live now, not as of the last collection
+		}
+		err = pprof.Lookup(kind).WriteTo(file, 0)
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(path)
+		return "", fmt.Errorf("failed to write %s profile: %w", kind, err)
+	}
+	return path, nil
+}
@@ -8,13 +8,23 @@ import (
 	"io"
 	"log"
 	"net"
+	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/filetree"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/snapshot"
+	"github.com/opencode/tmux_coder/internal/tracing"
 	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/version"
 )
 
 // SocketClient manages Unix Domain Socket client for panel communication
@@ -23,8 +33,8 @@ type SocketClient struct {
 	panelID            string
 	panelType          string
 	conn               net.Conn
-	encoder            *json.Encoder
-	decoder            *json.Decoder
+	encoder            messageEncoder
+	decoder            messageDecoder
 	connectionID       string
 	isConnected        bool
 	connectionMux      sync.RWMutex
@@ -40,10 +50,56 @@ type SocketClient struct {
 	pendingRequests    map[string]chan IPCMessage // Maps requestID to a response channel
 	pendingRequestsMux sync.Mutex                 // Mutex for pendingRequests map
 	currentVersion     int64                      // Track current state version
+	currentClock       types.VectorClock          // Last vector clock seen, nil unless the server uses one
+	sentTick           int64                      // This panel's entry in the last clock sent, guarded by versionMux
 	versionMux         sync.RWMutex               // Mutex for version access
 	sendMutex          sync.Mutex                 // Synchronize writes to the connection
+	snapshotReader     *snapshot.Reader           // Optional shared-memory state for read-only panels
+	blobCache          map[string][]byte          // Fetched blobs; content-addressed, so never stale
+	blobCacheSize      int
+	blobMux            sync.Mutex
+	capabilities       *types.PanelCapabilities // Declared in the handshake, nil to receive every event
+	subscribers        []*Subscriber            // Supervised subscribers, guarded by handlerMux
+	connCancel         context.CancelFunc       // Stops the current connection's ping loop
+	connectedBefore    bool                     // Set after the first successful Connect
+	clock              clock.Clock              // Paces the heartbeat and reconnect attempts
+	serverBuild        string                   // Orchestrator build from the last handshake, guarded by connectionMux
+	serverInstance     string                   // Server run from the last handshake, guarded by connectionMux
+	identity           string                   // Stable identity from the orchestrator, empty outside a pane
+	partialState       *partialState            // Chunked state transfer to resume, guarded by transferMux
+	transferMux        sync.Mutex
+	resuming           bool               // Live events are held while missed ones are replayed
+	heldEvents         []types.StateEvent // Live events that arrived during the replay, guarded by resumeMux
+	lastSequence       int64              // Sequence of the last event received on this connection, guarded by resumeMux
+	gaps               int64              // Sequence gaps detected, guarded by resumeMux
+	resumeMux          sync.Mutex
+	stateView          StateView // Checked against the checksums in pongs, guarded by handlerMux
+	repairing          bool      // A resync of diverged sections is under way, guarded by resumeMux
+	mismatches         int64     // Checksum mismatches detected, guarded by resumeMux
 }
 
+// maxBlobCacheBytes bounds the client's blob cache; it is cleared when exceeded
+const maxBlobCacheBytes = 32 << 20
+
+// maxReconnectDelay caps the wait between reconnect attempts, which doubles
+// after each failed one. With the default ten attempts a panel keeps trying
+// for about three minutes, long enough for a watchdog to restart the server.
+const maxReconnectDelay = 30 * time.Second
+
+// ResumeToken records where a panel left off: the server run it was connected
+// to and the last state version it saw. Reconnecting to the same run replays
+// the events missed since Version; a restarted server retained none of them,
+// so the panel's subscribers fetch full state instead.
+type ResumeToken struct {
+	Instance string `json:"instance"`
+	Version  int64  `json:"version"`
+}
+
+// StateView reports the state version a panel's cache is at and the checksum
+// of each section it caches, computed with types.SharedApplicationState's
+// Checksums. It is called on the goroutine that runs the event handlers.
+type StateView func() (version int64, checksums types.StateChecksums)
+
 // EventHandler defines the signature for event handling functions
 type EventHandler func(event types.StateEvent) error
 
@@ -59,12 +115,59 @@ func NewSocketClient(socketPath, panelID, panelType string) *SocketClient {
 		pendingRequests: make(map[string]chan IPCMessage),
 		ctx:             ctx,
 		cancel:          cancel,
-		reconnectDelay:  5 * time.Second,
+		reconnectDelay:  time.Second,
 		maxReconnects:   10,
 		pingInterval:    10 * time.Second,
+		clock:           clock.Real,
 	}
 }
 
+// SetClock replaces the clock that paces the heartbeat pings; nil restores
+// the system clock. Call before Connect.
+func (client *SocketClient) SetClock(c clock.Clock) {
+	client.connectionMux.Lock()
+	defer client.connectionMux.Unlock()
+	client.clock = clock.Or(c)
+}
+
+// ServerBuild returns the orchestrator's build reported in the last
+// handshake; empty before connecting or when the orchestrator predates builds
+func (client *SocketClient) ServerBuild() string {
+	client.connectionMux.RLock()
+	defer client.connectionMux.RUnlock()
+	return client.serverBuild
+}
+
+// PanelIdentityEnv names the environment variable through which the
+// orchestrator gives each panel process a stable identity. It stays the same
+// when the supervisor respawns the panel, so the server hands the new process
+// the subscription of the one before and replays the events it missed.
+const PanelIdentityEnv = "OPENCODE_PANEL_IDENTITY"
+
+// SetIdentity sets the stable identity the client declares in its handshake,
+// usually os.Getenv(PanelIdentityEnv); call before Connect
+func (client *SocketClient) SetIdentity(identity string) {
+	client.connectionMux.Lock()
+	defer client.connectionMux.Unlock()
+	client.identity = identity
+}
+
+// ResumeToken returns where the client would resume after a reconnect
+func (client *SocketClient) ResumeToken() ResumeToken {
+	client.connectionMux.RLock()
+	instance := client.serverInstance
+	client.connectionMux.RUnlock()
+	return ResumeToken{Instance: instance, Version: client.GetCurrentVersion()}
+}
+
+// SetCapabilities declares what the panel can handle. The server then sends it
+// only the UI actions and diff-bearing events it declared; call before Connect.
+func (client *SocketClient) SetCapabilities(capabilities types.PanelCapabilities) {
+	client.connectionMux.Lock()
+	defer client.connectionMux.Unlock()
+	client.capabilities = &capabilities
+}
+
 // Connect establishes a connection to the IPC server
 func (client *SocketClient) Connect() error {
 	client.connectionMux.Lock()
@@ -81,11 +184,10 @@ func (client *SocketClient) Connect() error {
 	}
 
 	client.conn = conn
-	client.encoder = json.NewEncoder(conn)
-	client.decoder = json.NewDecoder(conn)
+	token := ResumeToken{Instance: client.serverInstance, Version: client.GetCurrentVersion()}
 
 	// Perform handshake
-	if err := client.performHandshake(); err != nil {
+	if err := client.performHandshake(conn); err != nil {
 		conn.Close()
 		return fmt.Errorf("handshake failed: %w", err)
 	}
@@ -95,9 +197,25 @@ func (client *SocketClient) Connect() error {
 
 	log.Printf("Panel %s (%s) connected to IPC server", client.panelID, client.panelType)
 
+	// Each connection gets its own ping loop, stopped when the connection is lost
+	connCtx, connCancel := context.WithCancel(client.ctx)
+	client.connCancel = connCancel
+
+	// After a reconnect, hold live events until the missed ones are
+	// replayed, so handlers see them in order
+	client.resumeMux.Lock()
+	client.lastSequence = 0 // Each connection numbers its events from 1
+	client.resuming = client.connectedBefore
+	client.resumeMux.Unlock()
+
 	// Start message handling and ping goroutines
 	go client.handleMessages()
-	go client.pingLoop()
+	go client.pingLoop(connCtx)
+
+	if client.connectedBefore {
+		go client.resume(token)
+	}
+	client.connectedBefore = true
 
 	return nil
 }
@@ -108,6 +226,7 @@ func (client *SocketClient) Disconnect() error {
 	defer client.connectionMux.Unlock()
 
 	if !client.isConnected {
+		client.cancel() // Stop a reconnect in progress
 		return nil
 	}
 
@@ -115,11 +234,18 @@ func (client *SocketClient) Disconnect() error {
 
 	// Cancel context to signal shutdown
 	client.cancel()
+	if client.connCancel != nil {
+		client.connCancel()
+	}
 
 	// Close connection
 	if client.conn != nil {
 		client.conn.Close()
 	}
+	if client.snapshotReader != nil {
+		client.snapshotReader.Close()
+		client.snapshotReader = nil
+	}
 
 	client.isConnected = false
 	client.connectionID = ""
@@ -127,25 +253,34 @@ func (client *SocketClient) Disconnect() error {
 	return nil
 }
 
-// performHandshake exchanges handshake messages with the server
-func (client *SocketClient) performHandshake() error {
+// performHandshake exchanges handshake messages with the server over JSON
+// lines, then switches to length-prefixed frames if the server agrees
+func (client *SocketClient) performHandshake(conn net.Conn) error {
 	handshake := HandshakeMessage{
-		Type:      "handshake",
-		PanelID:   client.panelID,
-		PanelType: client.panelType,
-		Version:   "1.0",
-		Timestamp: time.Now(),
+		Type:         "handshake",
+		PanelID:      client.panelID,
+		PanelType:    client.panelType,
+		Version:      version.Protocol,
+		Timestamp:    time.Now(),
+		Capabilities: client.capabilities,
+		Framing:      FramingLengthPrefixed,
+		Build:        version.Build,
+		Identity:     client.identity,
+		Reconnect:    client.connectedBefore,
 	}
 
+	encoder := json.NewEncoder(conn)
+	decoder := json.NewDecoder(conn)
 	client.sendMutex.Lock()
-	err := client.encoder.Encode(handshake)
+	client.encoder, client.decoder = encoder, decoder
+	err := encoder.Encode(handshake)
 	client.sendMutex.Unlock()
 	if err != nil {
 		return fmt.Errorf("failed to send handshake: %w", err)
 	}
 
 	var response HandshakeResponse
-	if err := client.decoder.Decode(&response); err != nil {
+	if err := decoder.Decode(&response); err != nil {
 		return fmt.Errorf("failed to receive handshake response: %w", err)
 	}
 
@@ -153,8 +288,20 @@ func (client *SocketClient) performHandshake() error {
 		return fmt.Errorf("handshake rejected: %s", response.Error)
 	}
 
+	if response.Framing == FramingLengthPrefixed {
+		client.sendMutex.Lock()
+		client.encoder = NewFrameEncoder(conn, 0)
+		client.decoder = NewFrameDecoder(AfterHandshake(decoder, conn), 0)
+		client.sendMutex.Unlock()
+	}
+
 	client.connectionID = response.ConnectionID
-	log.Printf("Handshake successful, connection ID: %s", client.connectionID)
+	client.serverBuild = response.Build
+	client.serverInstance = response.Instance
+	log.Printf("Handshake successful, connection ID: %s, framing: %s", client.connectionID, framingName(response.Framing))
+	if version.Check(response.Build, version.Protocol, version.Build, version.Protocol) == version.Compatible {
+		log.Printf("Orchestrator runs build %s but this panel is %s; run 'opencode-tmux upgrade' to restart panels", response.Build, version.Build)
+	}
 
 	return nil
 }
@@ -171,6 +318,9 @@ func (client *SocketClient) sendRequestAndWait(message *IPCMessage, timeout time
 	// Generate a unique request ID
 	requestID := uuid.New().String()
 	message.RequestID = requestID
+	if message.TraceParent == "" {
+		message.TraceParent = tracing.NewRoot()
+	}
 	log.Printf("[CLIENT] Sending request type=%s id=%s", message.Type, requestID)
 
 	// Create a response channel for this specific request
@@ -211,12 +361,62 @@ func (client *SocketClient) sendRequestAndWait(message *IPCMessage, timeout time
 	}
 }
 
+// EnableSnapshot lets RequestState read from the orchestrator's shared-memory snapshot
+// at path, falling back to IPC when the snapshot is missing or older than known state.
+func (client *SocketClient) EnableSnapshot(path string) error {
+	reader, err := snapshot.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open state snapshot: %w", err)
+	}
+	client.connectionMux.Lock()
+	defer client.connectionMux.Unlock()
+	if client.snapshotReader != nil {
+		client.snapshotReader.Close()
+	}
+	client.snapshotReader = reader
+	return nil
+}
+
+// readSnapshot returns the snapshot state if it is at least as new as the client's view
+func (c *SocketClient) readSnapshot() (*types.SharedApplicationState, bool) {
+	c.connectionMux.RLock()
+	reader := c.snapshotReader
+	c.connectionMux.RUnlock()
+	if reader == nil {
+		return nil, false
+	}
+
+	state, header, err := reader.Read()
+	if err != nil {
+		log.Printf("[CLIENT] State snapshot unavailable, using IPC: %v", err)
+		return nil, false
+	}
+	if header.StateVersion < c.GetCurrentVersion() {
+		return nil, false
+	}
+	return state, true
+}
+
 // RequestState requests the current state from the server using the new sync mechanism.
 func (c *SocketClient) RequestState() (*types.SharedApplicationState, error) {
+	if state, ok := c.readSnapshot(); ok {
+		c.setCurrentVersion(state.Version.Version)
+		c.setCurrentClock(state.Version.Clock)
+		return state, nil
+	}
+
 	log.Printf("[CLIENT] Requesting initial state from panel %s", c.panelID)
 
+	c.transferMux.Lock()
+	defer c.transferMux.Unlock()
+
+	request := map[string]interface{}{"chunked": true}
+	if c.partialState != nil {
+		request["resume"] = c.partialState.manifest.TransferID
+	}
 	message := IPCMessage{
 		Type:      "state_request",
+		Data:      request,
 		Timestamp: time.Now(),
 	}
 
@@ -225,30 +425,123 @@ func (c *SocketClient) RequestState() (*types.SharedApplicationState, error) {
 		return nil, fmt.Errorf("failed to get state response: %w", err)
 	}
 
-	if response.Type != "state_response" {
+	var stateData *types.SharedApplicationState
+	switch response.Type {
+	case "state_response":
+		if response.Data == nil {
+			return nil, fmt.Errorf("received nil state data")
+		}
+		c.partialState = nil
+		stateData = &types.SharedApplicationState{}
+		if err := mapToStruct(response.Data, stateData); err != nil {
+			return nil, fmt.Errorf("failed to map response data to state: %w", err)
+		}
+	case "state_manifest":
+		var manifest StateManifest
+		if err := mapToStruct(response.Data, &manifest); err != nil {
+			return nil, fmt.Errorf("failed to decode state manifest: %w", err)
+		}
+		if stateData, err = c.receiveChunkedState(manifest); err != nil {
+			return nil, err
+		}
+	default:
 		return nil, fmt.Errorf("unexpected response type: expected 'state_response', got '%s'", response.Type)
 	}
 
-	if response.Data == nil {
-		return nil, fmt.Errorf("received nil state data")
+	c.resetCurrentVersion(stateData.Version.Version)
+	c.setCurrentClock(stateData.Version.Clock)
+	log.Printf("[CLIENT] Successfully received and decoded state version: %d", stateData.Version.Version)
+	return stateData, nil
+}
+
+// receiveChunkedState fetches the chunks of a transfer in order. A transfer
+// cut short is kept so the next RequestState resumes it where it stopped.
+// Callers hold transferMux.
+func (c *SocketClient) receiveChunkedState(manifest StateManifest) (*types.SharedApplicationState, error) {
+	partial := c.partialState
+	if partial == nil || partial.manifest.TransferID != manifest.TransferID {
+		partial = &partialState{manifest: manifest}
+		partial.data.Grow(manifest.Size)
+		c.partialState = partial
+	} else {
+		log.Printf("[CLIENT] Resuming state transfer %s at chunk %d of %d", manifest.TransferID, partial.next, manifest.Chunks)
 	}
 
-	var stateData types.SharedApplicationState
-	if err := mapToStruct(response.Data, &stateData); err != nil {
-		return nil, fmt.Errorf("failed to map response data to state: %w", err)
+	for partial.next < manifest.Chunks {
+		message := IPCMessage{
+			Type:      "state_chunk_request",
+			Data:      map[string]interface{}{"transfer_id": manifest.TransferID, "index": partial.next},
+			Timestamp: time.Now(),
+		}
+		response, err := c.sendRequestAndWait(&message, 10*time.Second)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get state chunk %d of %d: %w", partial.next, manifest.Chunks, err)
+		}
+		if response.Type == "error" {
+			responseData, _ := response.Data.(map[string]interface{})
+			errorMsg, _ := responseData["error"].(string)
+			if strings.Contains(errorMsg, ErrTransferNotFound.Error()) {
+				c.partialState = nil
+				return nil, fmt.Errorf("%w: %s", ErrTransferNotFound, manifest.TransferID)
+			}
+			return nil, fmt.Errorf("failed to get state chunk %d: %s", partial.next, errorMsg)
+		}
+		if response.Type != "state_chunk" {
+			return nil, fmt.Errorf("unexpected response type: expected 'state_chunk', got '%s'", response.Type)
+		}
+
+		var chunk StateChunk
+		if err := mapToStruct(response.Data, &chunk); err != nil {
+			return nil, fmt.Errorf("failed to decode state chunk: %w", err)
+		}
+		if chunk.TransferID != manifest.TransferID || chunk.Index != partial.next {
+			return nil, fmt.Errorf("received chunk %d of transfer %s, expected chunk %d of %s",
+				chunk.Index, chunk.TransferID, partial.next, manifest.TransferID)
+		}
+		partial.data.Write(chunk.Data)
+		partial.next++
 	}
 
-	c.setCurrentVersion(stateData.Version.Version)
-	log.Printf("[CLIENT] Successfully received and decoded state version: %d", stateData.Version.Version)
-	return &stateData, nil
+	c.partialState = nil
+	return decodeTransferredState(partial)
+}
+
+// TriggerUIAction asks the panels that handle action to perform it. Unknown
+// actions and invalid arguments are rejected before anything is sent.
+func (client *SocketClient) TriggerUIAction(action types.UIAction, args types.UIActionArgs) error {
+	payload, err := types.NewUIActionPayload(action, args)
+	if err != nil {
+		return err
+	}
+	_, err = client.SendStateUpdateAndWait(types.StateUpdate{
+		Type:      types.UIActionTriggered,
+		Payload:   payload,
+		Timestamp: time.Now(),
+	})
+	return err
 }
 
 // SendStateUpdateAndWait sends a state update and waits for a confirmation response.
+// Updates without an ID get one; callers that retry after a timeout should set
+// the ID themselves so the server drops the retry if the first delivery applied.
+// A destructive update the server wants confirmed fails with a
+// *ConfirmationRequiredError.
 func (client *SocketClient) SendStateUpdateAndWait(update types.StateUpdate) (int64, error) {
+	if update.ID == "" {
+		update.ID = uuid.New().String()
+	}
+	if update.Clock == nil {
+		update.Clock = client.nextClock()
+	}
+	if update.TraceParent == "" {
+		update.TraceParent = tracing.NewRoot()
+	}
+
 	message := IPCMessage{
-		Type:      "state_update",
-		Data:      update,
-		Timestamp: time.Now(),
+		Type:        "state_update",
+		Data:        update,
+		Timestamp:   time.Now(),
+		TraceParent: update.TraceParent,
 	}
 
 	response, err := client.sendRequestAndWait(&message, 10*time.Second)
@@ -256,6 +549,9 @@ func (client *SocketClient) SendStateUpdateAndWait(update types.StateUpdate) (in
 		return 0, fmt.Errorf("failed to get state update response: %w", err)
 	}
 
+	if response.Type == "confirmation_required" {
+		return 0, decodeConfirmationRequired(response)
+	}
 	if response.Type != "state_update_response" {
 		if response.Type == "state_update_error" {
 			if responseData, ok := response.Data.(map[string]interface{}); ok {
@@ -272,6 +568,9 @@ func (client *SocketClient) SendStateUpdateAndWait(update types.StateUpdate) (in
 			if version, ok := responseData["version"].(float64); ok {
 				newVersion := int64(version)
 				client.setCurrentVersion(newVersion)
+				if clock, ok := responseData["clock"].(map[string]interface{}); ok {
+					client.setCurrentClock(decodeVectorClock(clock))
+				}
 				return newVersion, nil // Success
 			}
 		}
@@ -283,14 +582,50 @@ func (client *SocketClient) SendStateUpdateAndWait(update types.StateUpdate) (in
 	return 0, fmt.Errorf("invalid state update response format")
 }
 
-// SendClearSessionMessages sends a request to clear all messages in a session
-func (client *SocketClient) SendClearSessionMessages(sessionID string) error {
-	message := IPCMessage{
-		Type: "clear_session_messages",
-		Data: map[string]interface{}{
-			"session_id": sessionID,
-			"panel_id":   client.panelID,
+// LockSession acquires or renews an advisory lock on a session for this panel, so
+// other panels cannot delete or clear it until UnlockSession or the TTL lapses.
+// Long operations should renew well before the TTL.
+func (client *SocketClient) LockSession(sessionID, operation string, ttl time.Duration) error {
+	_, err := client.SendStateUpdateAndWait(types.StateUpdate{
+		Type:            types.SessionLocked,
+		ExpectedVersion: client.GetCurrentVersion(),
+		Payload: types.SessionLockPayload{
+			SessionID:  sessionID,
+			Operation:  operation,
+			TTLSeconds: int(ttl / time.Second),
 		},
+		SourcePanel: client.panelID,
+		Timestamp:   time.Now(),
+	})
+	return err
+}
+
+// UnlockSession releases this panel's lock on a session; force releases anyone's
+func (client *SocketClient) UnlockSession(sessionID string, force bool) error {
+	_, err := client.SendStateUpdateAndWait(types.StateUpdate{
+		Type:            types.SessionUnlocked,
+		ExpectedVersion: client.GetCurrentVersion(),
+		Payload:         types.SessionUnlockPayload{SessionID: sessionID, Force: force},
+		SourcePanel:     client.panelID,
+		Timestamp:       time.Now(),
+	})
+	return err
+}
+
+// SendClearSessionMessages sends a request to clear all messages in a session.
+// When the server wants it confirmed the error is a *ConfirmationRequiredError
+// whose token, passed back here, confirms it.
+func (client *SocketClient) SendClearSessionMessages(sessionID, confirmationToken string) error {
+	data := map[string]interface{}{
+		"session_id": sessionID,
+		"panel_id":   client.panelID,
+	}
+	if confirmationToken != "" {
+		data["confirmation_token"] = confirmationToken
+	}
+	message := IPCMessage{
+		Type:      "clear_session_messages",
+		Data:      data,
 		Timestamp: time.Now(),
 	}
 
@@ -299,6 +634,10 @@ func (client *SocketClient) SendClearSessionMessages(sessionID string) error {
 		return fmt.Errorf("failed to clear session messages: %w", err)
 	}
 
+	if response.Type == "confirmation_required" {
+		return decodeConfirmationRequired(response)
+	}
+
 	if response.Type == "error" {
 		if responseData, ok := response.Data.(map[string]interface{}); ok {
 			if errorMsg, ok := responseData["error"].(string); ok {
@@ -316,6 +655,242 @@ func (client *SocketClient) SendClearSessionMessages(sessionID string) error {
 	return nil
 }
 
+// SendRedactMessage asks the server to redact ranges of a message's content
+func (client *SocketClient) SendRedactMessage(messageID string, ranges []types.RedactionRange, reason string) error {
+	message := IPCMessage{
+		Type: "redact_message",
+		Data: map[string]interface{}{
+			"message_id": messageID,
+			"ranges":     ranges,
+			"reason":     reason,
+		},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to redact message: %w", err)
+	}
+
+	if response.Type == "error" {
+		if responseData, ok := response.Data.(map[string]interface{}); ok {
+			if errorMsg, ok := responseData["error"].(string); ok {
+				return errors.New(errorMsg)
+			}
+		}
+		return fmt.Errorf("unknown error redacting message")
+	}
+
+	if response.Type != "redact_message_response" {
+		return fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+
+	return nil
+}
+
+// ExportOpencodeSession returns a session, the current one when sessionID is
+// empty, in the JSON `opencode export` writes
+func (client *SocketClient) ExportOpencodeSession(sessionID string) ([]byte, error) {
+	message := IPCMessage{
+		Type:      "opencode_export_request",
+		Data:      map[string]interface{}{"session_id": sessionID},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to export session: %w", err)
+	}
+
+	responseData, _ := response.Data.(map[string]interface{})
+	if response.Type == "error" {
+		if errorMsg, ok := responseData["error"].(string); ok {
+			return nil, errors.New(errorMsg)
+		}
+		return nil, fmt.Errorf("unknown error exporting session")
+	}
+	if response.Type != "opencode_export_response" {
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+	export, ok := responseData["export"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid export response format")
+	}
+	return []byte(export), nil
+}
+
+// ImportOpencodeSession adds a session from the output of `opencode export`
+func (client *SocketClient) ImportOpencodeSession(data []byte) (*types.SessionInfo, error) {
+	message := IPCMessage{
+		Type:      "opencode_import_request",
+		Data:      map[string]interface{}{"export": string(data)},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to import session: %w", err)
+	}
+
+	responseData, _ := response.Data.(map[string]interface{})
+	if response.Type == "error" {
+		if errorMsg, ok := responseData["error"].(string); ok {
+			return nil, errors.New(errorMsg)
+		}
+		return nil, fmt.Errorf("unknown error importing session")
+	}
+	if response.Type != "opencode_import_response" {
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+	var session types.SessionInfo
+	if err := mapToStruct(responseData["session"], &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &session, nil
+}
+
+// FetchBlob returns an offloaded message body or parts list by hash
+func (client *SocketClient) FetchBlob(hash string) ([]byte, error) {
+	client.blobMux.Lock()
+	if data, ok := client.blobCache[hash]; ok {
+		client.blobMux.Unlock()
+		return data, nil
+	}
+	client.blobMux.Unlock()
+
+	message := IPCMessage{
+		Type:      "blob_request",
+		Data:      map[string]interface{}{"hash": hash},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 10*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch blob: %w", err)
+	}
+
+	responseData, _ := response.Data.(map[string]interface{})
+	if response.Type == "error" {
+		if errorMsg, ok := responseData["error"].(string); ok {
+			return nil, errors.New(errorMsg)
+		}
+		return nil, fmt.Errorf("unknown error fetching blob %s", hash)
+	}
+	if response.Type != "blob_response" {
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+	content, ok := responseData["content"].(string)
+	if !ok {
+		return nil, fmt.Errorf("invalid blob response format")
+	}
+
+	data := []byte(content)
+	client.blobMux.Lock()
+	if client.blobCache == nil || client.blobCacheSize+len(data) > maxBlobCacheBytes {
+		client.blobCache = make(map[string][]byte)
+		client.blobCacheSize = 0
+	}
+	client.blobCache[hash] = data
+	client.blobCacheSize += len(data)
+	client.blobMux.Unlock()
+
+	return data, nil
+}
+
+// RequestStateAt fetches the state as it was at a past version. The result is a
+// read-only view for display; it does not change the client's tracked version,
+// so updates built afterwards still apply to the live state.
+func (client *SocketClient) RequestStateAt(version int64) (*types.SharedApplicationState, error) {
+	message := IPCMessage{
+		Type:      "state_at_request",
+		Data:      map[string]interface{}{"version": version},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 30*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get historical state: %w", err)
+	}
+
+	responseData, _ := response.Data.(map[string]interface{})
+	if response.Type == "error" {
+		if errorMsg, ok := responseData["error"].(string); ok {
+			return nil, errors.New(errorMsg)
+		}
+		return nil, fmt.Errorf("unknown error fetching state at version %d", version)
+	}
+	if response.Type != "state_at_response" {
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+
+	var historical types.SharedApplicationState
+	if err := mapToStruct(responseData["state"], &historical); err != nil {
+		return nil, fmt.Errorf("failed to decode historical state: %w", err)
+	}
+	return &historical, nil
+}
+
+// ReplayEvents fetches the events applied after sinceVersion, oldest first.
+// When complete is false some of them are no longer retained and the caller
+// should request full state instead.
+func (client *SocketClient) ReplayEvents(sinceVersion int64) ([]types.StateEvent, bool, error) {
+	message := IPCMessage{
+		Type:      "event_replay_request",
+		Data:      map[string]interface{}{"since_version": sinceVersion},
+		Timestamp: time.Now(),
+	}
+
+	response, err := client.sendRequestAndWait(&message, 30*time.Second)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to replay events: %w", err)
+	}
+
+	responseData, _ := response.Data.(map[string]interface{})
+	if response.Type == "error" {
+		if errorMsg, ok := responseData["error"].(string); ok {
+			return nil, false, errors.New(errorMsg)
+		}
+		return nil, false, fmt.Errorf("unknown error replaying events since version %d", sinceVersion)
+	}
+	if response.Type != "event_replay_response" {
+		return nil, false, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+
+	var replay struct {
+		Complete bool               `json:"complete"`
+		Events   []types.StateEvent `json:"events"`
+	}
+	if err := mapToStruct(responseData, &replay); err != nil {
+		return nil, false, fmt.Errorf("failed to decode replayed events: %w", err)
+	}
+	return replay.Events, replay.Complete, nil
+}
+
+// ResolveMessageBody inlines a message's offloaded body and parts, fetching them on demand
+func (client *SocketClient) ResolveMessageBody(msg *types.MessageInfo) error {
+	if msg.BodyRef != "" {
+		data, err := client.FetchBlob(msg.BodyRef)
+		if err != nil {
+			return err
+		}
+		msg.Content = string(data)
+		msg.BodyRef, msg.BodySize, msg.Truncated = "", 0, false
+	}
+	if msg.PartsRef != "" {
+		data, err := client.FetchBlob(msg.PartsRef)
+		if err != nil {
+			return err
+		}
+		parts, err := types.DecodeParts(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode message parts: %w", err)
+		}
+		msg.Parts = parts
+		msg.PartsRef = ""
+	}
+	return nil
+}
+
 // SendOrchestratorCommand sends a control command to the orchestrator and waits for the result.
 func (client *SocketClient) SendOrchestratorCommand(command string) error {
 	return client.SendOrchestratorCommandWithParams(command, nil)
@@ -323,9 +898,15 @@ func (client *SocketClient) SendOrchestratorCommand(command string) error {
 
 // SendOrchestratorCommandWithParams sends a control command with optional parameters.
 func (client *SocketClient) SendOrchestratorCommandWithParams(command string, params map[string]interface{}) error {
+	_, err := client.QueryOrchestrator(command, params)
+	return err
+}
+
+// QueryOrchestrator sends a control command and returns the response data on success.
+func (client *SocketClient) QueryOrchestrator(command string, params map[string]interface{}) (map[string]interface{}, error) {
 	command = strings.TrimSpace(command)
 	if command == "" {
-		return fmt.Errorf("command cannot be empty")
+		return nil, fmt.Errorf("command cannot be empty")
 	}
 
 	payload := map[string]interface{}{
@@ -343,27 +924,315 @@ func (client *SocketClient) SendOrchestratorCommandWithParams(command string, pa
 
 	response, err := client.sendRequestAndWait(&message, 15*time.Second)
 	if err != nil {
-		return fmt.Errorf("failed to execute orchestrator command: %w", err)
+		return nil, fmt.Errorf("failed to execute orchestrator command: %w", err)
 	}
 
 	if response.Type != "orchestrator_command_response" {
-		return fmt.Errorf("unexpected response type: %s", response.Type)
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
 	}
 
 	if response.Data == nil {
-		return fmt.Errorf("empty orchestrator response")
+		return nil, fmt.Errorf("empty orchestrator response")
 	}
 
 	if respData, ok := response.Data.(map[string]interface{}); ok {
 		if success, ok := respData["success"].(bool); ok && success {
-			return nil
+			return respData, nil
 		}
 		if errMsg, ok := respData["error"].(string); ok && errMsg != "" {
-			return errors.New(errMsg)
+			return nil, errors.New(errMsg)
 		}
 	}
 
-	return fmt.Errorf("orchestrator command failed")
+	return nil, fmt.Errorf("orchestrator command failed")
+}
+
+// QueryAudit fetches audit log entries matching filter from the orchestrator.
+func (client *SocketClient) QueryAudit(filter audit.Filter) ([]audit.Entry, error) {
+	params, err := structToMap(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit filter: %w", err)
+	}
+
+	respData, err := client.QueryOrchestrator("query_audit", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []audit.Entry
+	if err := mapToStruct(respData["entries"], &entries); err != nil {
+		return nil, fmt.Errorf("failed to decode audit entries: %w", err)
+	}
+	return entries, nil
+}
+
+// QueryAnalytics fetches per-day usage totals from the orchestrator.
+func (client *SocketClient) QueryAnalytics(query analytics.Query) (*analytics.Report, error) {
+	params, err := structToMap(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode analytics query: %w", err)
+	}
+
+	respData, err := client.QueryOrchestrator("query_analytics", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var report analytics.Report
+	if err := mapToStruct(respData["report"], &report); err != nil {
+		return nil, fmt.Errorf("failed to decode analytics report: %w", err)
+	}
+	return &report, nil
+}
+
+// CollectGarbage asks the orchestrator to remove orphaned persisted files.
+// With dryRun set nothing is deleted and the stats report what would be.
+func (client *SocketClient) CollectGarbage(dryRun bool) (interfaces.GCStats, error) {
+	respData, err := client.QueryOrchestrator("collect_garbage", map[string]interface{}{"dry_run": dryRun})
+	if err != nil {
+		return interfaces.GCStats{}, err
+	}
+
+	var stats interfaces.GCStats
+	if err := mapToStruct(respData["stats"], &stats); err != nil {
+		return interfaces.GCStats{}, fmt.Errorf("failed to decode gc stats: %w", err)
+	}
+	return stats, nil
+}
+
+// GetSyncConfig fetches the sync manager's live configuration as JSON fields.
+func (client *SocketClient) GetSyncConfig() (map[string]interface{}, error) {
+	respData, err := client.QueryOrchestrator("get_sync_config", nil)
+	if err != nil {
+		return nil, err
+	}
+	config, _ := respData["config"].(map[string]interface{})
+	return config, nil
+}
+
+// UpdateSyncConfig changes sync manager settings on the running orchestrator and
+// returns the configuration now in effect. Durations are given in nanoseconds.
+func (client *SocketClient) UpdateSyncConfig(changes map[string]interface{}) (map[string]interface{}, error) {
+	respData, err := client.QueryOrchestrator("set_sync_config", changes)
+	if err != nil {
+		return nil, err
+	}
+	config, _ := respData["config"].(map[string]interface{})
+	return config, nil
+}
+
+// GetDiagnostics fetches the controller panel's view of the orchestrator,
+// including up to recentEvents of the latest events.
+func (client *SocketClient) GetDiagnostics(recentEvents int) (*interfaces.Diagnostics, error) {
+	respData, err := client.QueryOrchestrator("get_diagnostics", map[string]interface{}{"recent_events": recentEvents})
+	if err != nil {
+		return nil, err
+	}
+
+	var diagnostics interfaces.Diagnostics
+	if err := mapToStruct(respData["diagnostics"], &diagnostics); err != nil {
+		return nil, fmt.Errorf("failed to decode diagnostics: %w", err)
+	}
+	return &diagnostics, nil
+}
+
+// GetDeliveryStats fetches each subscriber's delivered and dropped event counts.
+func (client *SocketClient) GetDeliveryStats() ([]interfaces.SubscriberInfo, error) {
+	respData, err := client.QueryOrchestrator("get_delivery_stats", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var subscribers []interfaces.SubscriberInfo
+	if err := mapToStruct(respData["subscribers"], &subscribers); err != nil {
+		return nil, fmt.Errorf("failed to decode delivery stats: %w", err)
+	}
+	return subscribers, nil
+}
+
+// StartMacroRecording asks the orchestrator to record user updates into the named macro.
+func (client *SocketClient) StartMacroRecording(name string) error {
+	_, err := client.QueryOrchestrator("macro_record", map[string]interface{}{"name": name})
+	return err
+}
+
+// StopMacroRecording ends the recording and returns the saved macro's summary.
+func (client *SocketClient) StopMacroRecording() (*macro.Info, error) {
+	return client.macroInfo(client.QueryOrchestrator("macro_stop", nil))
+}
+
+// ReplayMacro starts replaying a saved macro; the orchestrator plays it in the background.
+func (client *SocketClient) ReplayMacro(name string, opts macro.ReplayOptions) (*macro.Info, error) {
+	params, err := structToMap(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode replay options: %w", err)
+	}
+	params["name"] = name
+	return client.macroInfo(client.QueryOrchestrator("macro_replay", params))
+}
+
+func (client *SocketClient) macroInfo(respData map[string]interface{}, err error) (*macro.Info, error) {
+	if err != nil {
+		return nil, err
+	}
+	var info macro.Info
+	if err := mapToStruct(respData["macro"], &info); err != nil {
+		return nil, fmt.Errorf("failed to decode macro: %w", err)
+	}
+	return &info, nil
+}
+
+// ListMacros summarizes the macros saved on the orchestrator's host.
+func (client *SocketClient) ListMacros() ([]macro.Info, error) {
+	respData, err := client.QueryOrchestrator("macro_list", nil)
+	if err != nil {
+		return nil, err
+	}
+	var macros []macro.Info
+	if err := mapToStruct(respData["macros"], &macros); err != nil {
+		return nil, fmt.Errorf("failed to decode macros: %w", err)
+	}
+	return macros, nil
+}
+
+// DeleteMacro removes a saved macro.
+func (client *SocketClient) DeleteMacro(name string) error {
+	_, err := client.QueryOrchestrator("macro_delete", map[string]interface{}{"name": name})
+	return err
+}
+
+// ListDirectory lists a directory of the file tree. Directories are loaded
+// one at a time as the tree is expanded.
+func (client *SocketClient) ListDirectory(path string) (*filetree.Listing, error) {
+	respData, err := client.QueryOrchestrator("list_dir", map[string]interface{}{"path": path})
+	if err != nil {
+		return nil, err
+	}
+	var listing filetree.Listing
+	if err := mapToStruct(respData["listing"], &listing); err != nil {
+		return nil, fmt.Errorf("failed to decode directory listing: %w", err)
+	}
+	return &listing, nil
+}
+
+// RunTerminalCommand starts a shell command in a terminal pane of the session.
+// It returns once the command has started; follow the run in state.
+func (client *SocketClient) RunTerminalCommand(command, dir string) (*types.TerminalRun, error) {
+	respData, err := client.QueryOrchestrator("terminal_run", map[string]interface{}{"command": command, "dir": dir})
+	if err != nil {
+		return nil, err
+	}
+	var run types.TerminalRun
+	if err := mapToStruct(respData["run"], &run); err != nil {
+		return nil, fmt.Errorf("failed to decode terminal run: %w", err)
+	}
+	return &run, nil
+}
+
+// EditInput opens text in the user's editor. It returns once the editor is
+// open; the text saved arrives as an input update.
+func (client *SocketClient) EditInput(text string) error {
+	_, err := client.QueryOrchestrator("edit_input", map[string]interface{}{"text": text})
+	return err
+}
+
+// CancelRun cancels an assistant run in flight, by run ID or by a message of
+// its session
+func (client *SocketClient) CancelRun(runID, messageID string) error {
+	_, err := client.QueryOrchestrator("cancel_run", map[string]interface{}{"run_id": runID, "message_id": messageID})
+	return err
+}
+
+// CompactSession starts summarizing a session, the current one when sessionID
+// is empty. It returns once the compaction has started.
+func (client *SocketClient) CompactSession(sessionID string) error {
+	_, err := client.QueryOrchestrator("compact_session", map[string]interface{}{"session_id": sessionID})
+	return err
+}
+
+// CreateSessionFromTemplate creates a session from the named session template
+// and selects it; title replaces the template's title when set
+func (client *SocketClient) CreateSessionFromTemplate(template, title string) (*types.SessionInfo, error) {
+	respData, err := client.QueryOrchestrator("create_session_from_template", map[string]interface{}{"template": template, "title": title})
+	if err != nil {
+		return nil, err
+	}
+	var session types.SessionInfo
+	if err := mapToStruct(respData["session"], &session); err != nil {
+		return nil, fmt.Errorf("failed to decode session: %w", err)
+	}
+	return &session, nil
+}
+
+// GetStatus fetches the session's status from the orchestrator
+func (client *SocketClient) GetStatus() (*interfaces.SessionStatus, error) {
+	respData, err := client.QueryOrchestrator("get_status", nil)
+	if err != nil {
+		return nil, err
+	}
+	var status interfaces.SessionStatus
+	if err := mapToStruct(respData["status"], &status); err != nil {
+		return nil, fmt.Errorf("failed to decode status: %w", err)
+	}
+	return &status, nil
+}
+
+// SwitchProfile makes the named config profile the active one and returns
+// the profiles as they now stand
+func (client *SocketClient) SwitchProfile(name string) (*interfaces.ProfileStatus, error) {
+	respData, err := client.QueryOrchestrator("switch_profile", map[string]interface{}{"profile": name})
+	if err != nil {
+		return nil, err
+	}
+	var profile interfaces.ProfileStatus
+	if err := mapToStruct(respData["profile"], &profile); err != nil {
+		return nil, fmt.Errorf("failed to decode profile: %w", err)
+	}
+	return &profile, nil
+}
+
+// AdminCommand sends a privileged command, authorized by the server's admin
+// token, and returns the response fields on success
+func (client *SocketClient) AdminCommand(token, command string, params map[string]interface{}) (map[string]interface{}, error) {
+	command = strings.TrimSpace(command)
+	if command == "" {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+
+	payload := map[string]interface{}{
+		"command": command,
+		"token":   token,
+	}
+	if len(params) > 0 {
+		payload["params"] = params
+	}
+
+	message := IPCMessage{
+		Type:      "admin_command",
+		Data:      payload,
+		Timestamp: time.Now(),
+	}
+
+	// Draining saves or copying a backup off-site can take a while
+	response, err := client.sendRequestAndWait(&message, 60*time.Second)
+	if err != nil {
+		return nil, fmt.Errorf("failed to execute admin command: %w", err)
+	}
+	if response.Type != "admin_command_response" {
+		return nil, fmt.Errorf("unexpected response type: %s", response.Type)
+	}
+
+	respData, ok := response.Data.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("empty admin response")
+	}
+	if success, ok := respData["success"].(bool); ok && success {
+		return respData, nil
+	}
+	if errMsg, ok := respData["error"].(string); ok && errMsg != "" {
+		return nil, errors.New(errMsg)
+	}
+	return nil, fmt.Errorf("admin command failed")
 }
 
 // RegisterEventHandler registers a handler for specific event types
@@ -388,7 +1257,7 @@ func (client *SocketClient) handleMessages() {
 		var message IPCMessage
 		err := client.decoder.Decode(&message)
 		if err != nil {
-			if errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || isConnectionError(err) {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) || isConnectionError(err) {
 				log.Printf("Connection closed, triggering reconnect: %v", err)
 				client.handleConnectionError(err)
 				return // Exit this handler, a new one will be started on reconnect
@@ -442,9 +1311,151 @@ func (client *SocketClient) handleStateEvent(message IPCMessage) {
 		log.Printf("Failed to decode state event: %v", err)
 		return
 	}
+	event.Sequence = message.Sequence
+
+	client.resumeMux.Lock()
+	if event.Sequence > 0 {
+		// A skipped number is an event the server dropped; catch up on what
+		// was missed before handling this one
+		if missed := event.Sequence - client.lastSequence - 1; missed > 0 && !client.resuming {
+			log.Printf("Panel %s missed %d event(s) before sequence %d; catching up", client.panelID, missed, event.Sequence)
+			client.gaps++
+			client.resuming = true
+			go client.catchUp(client.GetCurrentVersion())
+		}
+		client.lastSequence = event.Sequence
+	}
+	if client.resuming {
+		client.heldEvents = append(client.heldEvents, event)
+		client.resumeMux.Unlock()
+		return
+	}
+	client.resumeMux.Unlock()
+	client.deliverEvent(event)
+}
+
+// Gaps returns how many times the client found events missing from its stream
+func (client *SocketClient) Gaps() int64 {
+	client.resumeMux.Lock()
+	defer client.resumeMux.Unlock()
+	return client.gaps
+}
+
+// ServerInstance returns the server run from the last handshake
+func (client *SocketClient) ServerInstance() string {
+	client.connectionMux.RLock()
+	defer client.connectionMux.RUnlock()
+	return client.serverInstance
+}
+
+// catchUp replays what the current connection lost after version
+func (client *SocketClient) catchUp(version int64) {
+	client.resume(ResumeToken{Instance: client.ServerInstance(), Version: version})
+}
+
+// resume brings the handlers up to date after a reconnect or a gap in the
+// event stream. When the server is the run the token names, the events
+// missed since the token's version are replayed; otherwise the handlers are
+// sent the full state. Live events held meanwhile are delivered afterwards,
+// less those the replay already covered.
+func (client *SocketClient) resume(token ResumeToken) {
+	replayed := token.Version
+	resumed := false
+	if token.Instance != "" && token.Instance == client.ServerInstance() {
+		events, complete, err := client.ReplayEvents(token.Version)
+		switch {
+		case err != nil:
+			log.Printf("Panel %s failed to replay missed events: %v", client.panelID, err)
+		case !complete:
+			log.Printf("Panel %s missed events the server no longer retains", client.panelID)
+		default:
+			log.Printf("Panel %s resumed from version %d, replaying %d events", client.panelID, token.Version, len(events))
+			for _, event := range events {
+				// The server would not have sent the panel its own events,
+				// nor those it declared it cannot handle
+				if event.SourcePanel != client.panelID && client.capabilities.Accepts(event) {
+					client.deliverEvent(event)
+				}
+				replayed = event.Version
+			}
+			resumed = true
+		}
+	}
 
+	for {
+		client.resumeMux.Lock()
+		held := client.heldEvents
+		client.heldEvents = nil
+		if len(held) == 0 {
+			client.resuming = false
+			client.resumeMux.Unlock()
+			break
+		}
+		client.resumeMux.Unlock()
+		for _, event := range held {
+			if !resumed || event.Version > replayed {
+				client.deliverEvent(event)
+			}
+		}
+	}
+
+	if !resumed {
+		client.resyncHandlers(nil)
+		client.handlerMux.RLock()
+		for _, s := range client.subscribers {
+			go s.resubscribe()
+		}
+		client.handlerMux.RUnlock()
+	}
+}
+
+// resyncHandlers sends the current state as a state sync to the handlers
+// registered on the client, naming the sections that diverged if any;
+// supervised subscribers fetch their own
+func (client *SocketClient) resyncHandlers(sections []string) {
+	client.handlerMux.RLock()
+	wanted := len(client.eventHandlers[types.EventStateSync]) > 0 || len(client.eventHandlers["*"]) > 0
+	client.handlerMux.RUnlock()
+	if !wanted {
+		return
+	}
+
+	current, err := client.RequestState()
+	if err != nil {
+		log.Printf("Panel %s failed to fetch state to resync: %v", client.panelID, err)
+		return
+	}
+	// Handlers expect the payload decoded as it is from the wire
+	data, err := structToMap(types.StateSyncPayload{State: current, Sections: sections})
+	if err != nil {
+		log.Printf("Panel %s failed to encode state to resync: %v", client.panelID, err)
+		return
+	}
+	client.callHandlers(types.StateEvent{
+		Type:        types.EventStateSync,
+		Data:        data,
+		Version:     current.Version.Version,
+		SourcePanel: "system",
+		Timestamp:   current.Version.Timestamp,
+	})
+}
+
+// deliverEvent hands an event to the registered handlers and subscribers
+func (client *SocketClient) deliverEvent(event types.StateEvent) {
 	client.setCurrentVersion(event.Version)
+	client.setCurrentClock(event.Clock)
+
+	client.callHandlers(event)
+
+	client.handlerMux.RLock()
+	defer client.handlerMux.RUnlock()
+	for _, s := range client.subscribers {
+		s.offer(event)
+	}
+}
 
+// callHandlers runs the handlers registered on the client for an event
+func (client *SocketClient) callHandlers(event types.StateEvent) {
 	client.handlerMux.RLock()
 	defer client.handlerMux.RUnlock()
 
@@ -463,9 +1474,65 @@ func (client *SocketClient) handleStateEvent(message IPCMessage) {
 	}
 }
 
+// SetStateView registers the panel's cached view of the state. After each
+// pong the view's checksums are compared with the server's; the handlers are
+// sent a StateSync naming the sections that differ.
+func (client *SocketClient) SetStateView(view StateView) {
+	client.handlerMux.Lock()
+	defer client.handlerMux.Unlock()
+	client.stateView = view
+}
+
+// Mismatches returns how many times the panel's view was found to differ
+// from the server's state
+func (client *SocketClient) Mismatches() int64 {
+	client.resumeMux.Lock()
+	defer client.resumeMux.Unlock()
+	return client.mismatches
+}
+
 // handlePong processes pong responses
 func (client *SocketClient) handlePong(message IPCMessage) {
-	client.lastPingTime = time.Now()
+	client.lastPingTime = client.clock.Now()
+
+	var pong PongPayload
+	if err := mapToStruct(message.Data, &pong); err != nil || len(pong.Checksums) == 0 {
+		return // A server that predates checksums
+	}
+	client.handlerMux.RLock()
+	view := client.stateView
+	client.handlerMux.RUnlock()
+	if view == nil {
+		return
+	}
+
+	// A view at another version is expected to differ
+	version, checksums := view()
+	if version != pong.Version {
+		return
+	}
+	sections := pong.Checksums.Mismatched(checksums)
+	if len(sections) == 0 {
+		return
+	}
+
+	client.resumeMux.Lock()
+	if client.resuming || client.repairing {
+		client.resumeMux.Unlock()
+		return
+	}
+	client.mismatches++
+	client.repairing = true
+	client.resumeMux.Unlock()
+
+	sort.Strings(sections)
+	log.Printf("Panel %s diverged from the server at version %d in %v; resyncing", client.panelID, version, sections)
+	go func() {
+		client.resyncHandlers(sections)
+		client.resumeMux.Lock()
+		client.repairing = false
+		client.resumeMux.Unlock()
+	}()
 }
 
 // handleError processes error messages from the server
@@ -478,15 +1545,15 @@ func (client *SocketClient) handleError(message IPCMessage) {
 }
 
 // pingLoop sends periodic ping messages to maintain connection
-func (client *SocketClient) pingLoop() {
-	ticker := time.NewTicker(client.pingInterval)
+func (client *SocketClient) pingLoop(ctx context.Context) {
+	ticker := client.clock.NewTicker(client.pingInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
-		case <-client.ctx.Done():
+		case <-ctx.Done():
 			return
-		case <-ticker.C:
+		case <-ticker.C():
 			client.sendPing()
 		}
 	}
@@ -503,7 +1570,7 @@ func (client *SocketClient) sendPing() {
 
 	message := IPCMessage{
 		Type:      "ping",
-		Timestamp: time.Now(),
+		Timestamp: client.clock.Now(),
 	}
 
 	client.sendMutex.Lock()
@@ -526,21 +1593,36 @@ func (client *SocketClient) handleConnectionError(err error) {
 	if client.conn != nil {
 		client.conn.Close()
 	}
+	if client.connCancel != nil {
+		client.connCancel()
+	}
 	client.connectionMux.Unlock()
 
 	log.Printf("Connection error: %v", err)
 
-	if client.reconnectCount < client.maxReconnects {
+	// Back off between attempts, so a server being restarted has time to
+	// come back before the client gives up
+	delay := client.reconnectDelay
+	for client.reconnectCount < client.maxReconnects {
 		client.reconnectCount++
-		log.Printf("Attempting reconnection %d/%d in %v", client.reconnectCount, client.maxReconnects, client.reconnectDelay)
-		time.Sleep(client.reconnectDelay)
+		log.Printf("Attempting reconnection %d/%d in %v", client.reconnectCount, client.maxReconnects, delay)
+		select {
+		case <-client.ctx.Done():
+			return
+		case <-client.clock.After(delay):
+		}
+		if client.IsConnected() {
+			return
+		}
 		if err := client.Connect(); err != nil {
 			log.Printf("Reconnection failed: %v", err)
+			delay = min(delay*2, maxReconnectDelay)
+			continue
 		}
-	} else {
-		log.Printf("Maximum reconnection attempts exceeded")
-		client.cancel() // Stop all operations
+		return
 	}
+	log.Printf("Maximum reconnection attempts exceeded")
+	client.cancel() // Stop all operations
 }
 
 // IsConnected returns true if the client is currently connected
@@ -563,12 +1645,62 @@ func isConnectionError(err error) bool {
 	return false
 }
 
+// setCurrentVersion records a version seen in an event or response. Events can
+// arrive out of order, so the version only moves forward.
 func (client *SocketClient) setCurrentVersion(version int64) {
+	client.versionMux.Lock()
+	defer client.versionMux.Unlock()
+	if version > client.currentVersion {
+		client.currentVersion = version
+	}
+}
+
+// resetCurrentVersion adopts the version of a full state from the server, which
+// is authoritative even when it is older, e.g. after a restore
+func (client *SocketClient) resetCurrentVersion(version int64) {
 	client.versionMux.Lock()
 	defer client.versionMux.Unlock()
 	client.currentVersion = version
 }
 
+func (client *SocketClient) setCurrentClock(clock types.VectorClock) {
+	if clock == nil {
+		return
+	}
+	client.versionMux.Lock()
+	defer client.versionMux.Unlock()
+	client.currentClock = client.currentClock.Merge(clock)
+}
+
+// nextClock stamps an outgoing update with the last clock seen and this panel's
+// entry advanced past every update sent, including ones not yet echoed back.
+// It returns nil until the server has sent a clock.
+func (client *SocketClient) nextClock() types.VectorClock {
+	client.versionMux.Lock()
+	defer client.versionMux.Unlock()
+	if client.currentClock == nil {
+		return nil
+	}
+	if seen := client.currentClock[client.panelID]; seen > client.sentTick {
+		client.sentTick = seen
+	}
+	client.sentTick++
+	next := client.currentClock.Clone()
+	next[client.panelID] = client.sentTick
+	return next
+}
+
+// decodeVectorClock converts a JSON-decoded clock back into a VectorClock
+func decodeVectorClock(raw map[string]interface{}) types.VectorClock {
+	clock := make(types.VectorClock, len(raw))
+	for node, value := range raw {
+		if counter, ok := value.(float64); ok {
+			clock[node] = int64(counter)
+		}
+	}
+	return clock
+}
+
 // GetCurrentVersion returns the current state version known to the client.
 func (client *SocketClient) GetCurrentVersion() int64 {
 	client.versionMux.RLock()
@@ -0,0 +1,307 @@
+package ipc
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestPingLoopFollowsClock(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	fake := clock.NewFake(time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC))
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	client.SetClock(fake)
+	client.connectionMux.Lock()
+	client.conn = local
+	client.encoder = json.NewEncoder(local)
+	client.isConnected = true
+	client.connectionMux.Unlock()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go client.pingLoop(ctx)
+
+	if !fake.BlockUntil(1, time.Second) {
+		t.Fatal("ping loop never started its ticker")
+	}
+
+	pings := make(chan IPCMessage, 1)
+	go func() {
+		var message IPCMessage
+		if err := json.NewDecoder(remote).Decode(&message); err == nil {
+			pings <- message
+		}
+	}()
+
+	fake.Advance(client.pingInterval - time.Second)
+	select {
+	case message := <-pings:
+		t.Fatalf("pinged before the interval passed: %+v", message)
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	fake.Advance(time.Second)
+	select {
+	case message := <-pings:
+		if message.Type != "ping" || !message.Timestamp.Equal(fake.Now()) {
+			t.Errorf("got %s stamped %v, want a ping stamped %v", message.Type, message.Timestamp, fake.Now())
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no ping once the interval passed on the fake clock")
+	}
+}
+
+func TestResumeReplaysMissedEventsInOrder(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	client.connectionMux.Lock()
+	client.conn = local
+	client.encoder = json.NewEncoder(local)
+	client.decoder = json.NewDecoder(local)
+	client.isConnected = true
+	client.serverInstance = "server-1"
+	client.connectionMux.Unlock()
+
+	var versions []int64
+	seen := make(chan struct{}, 8)
+	client.RegisterEventHandler("*", func(event types.StateEvent) error {
+		versions = append(versions, event.Version)
+		seen <- struct{}{}
+		return nil
+	})
+
+	client.resuming = true
+	go client.handleMessages()
+	go client.resume(ResumeToken{Instance: "server-1", Version: 2})
+
+	event := func(version int64) types.StateEvent {
+		return types.StateEvent{Type: types.EventMessageUpdated, Version: version}
+	}
+	encoder, decoder := json.NewEncoder(remote), json.NewDecoder(remote)
+	var request IPCMessage
+	if err := decoder.Decode(&request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Type != "event_replay_request" {
+		t.Fatalf("request = %s, want an event replay", request.Type)
+	}
+
+	// A live event arrives before the replay answers; it must wait its turn
+	// and not be delivered twice
+	for _, message := range []IPCMessage{
+		{Type: "state_event", Data: event(4)},
+		{Type: "state_event", Data: event(5)},
+		{Type: "event_replay_response", RequestID: request.RequestID, Data: map[string]interface{}{
+			"complete": true,
+			"events":   []types.StateEvent{event(3), event(4)},
+		}},
+	} {
+		if err := encoder.Encode(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-seen:
+		case <-time.After(time.Second):
+			t.Fatalf("delivered %v, want three events", versions)
+		}
+	}
+	if len(versions) != 3 || versions[0] != 3 || versions[1] != 4 || versions[2] != 5 {
+		t.Errorf("delivered versions %v, want [3 4 5]", versions)
+	}
+	if token := client.ResumeToken(); token != (ResumeToken{Instance: "server-1", Version: 5}) {
+		t.Errorf("resume token = %+v", token)
+	}
+}
+
+func TestSequenceGapTriggersReplay(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	client.connectionMux.Lock()
+	client.conn = local
+	client.encoder = json.NewEncoder(local)
+	client.decoder = json.NewDecoder(local)
+	client.isConnected = true
+	client.serverInstance = "server-1"
+	client.connectionMux.Unlock()
+
+	var versions []int64
+	seen := make(chan struct{}, 8)
+	client.RegisterEventHandler("*", func(event types.StateEvent) error {
+		versions = append(versions, event.Version)
+		seen <- struct{}{}
+		return nil
+	})
+	go client.handleMessages()
+
+	// Events go out as the server forwards them, numbered per subscriber
+	send := func(version, sequence int64) {
+		t.Helper()
+		payload, err := json.Marshal(IPCMessage{Type: "state_event", Data: types.StateEvent{Type: types.EventMessageUpdated, Version: version}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := remote.Write(append(withSequence(payload, sequence), '\n')); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wait := func(n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			select {
+			case <-seen:
+			case <-time.After(time.Second):
+				t.Fatalf("delivered %v, waiting for %d more", versions, n-i)
+			}
+		}
+	}
+
+	send(1, 1)
+	wait(1)
+	send(3, 3) // The event numbered 2 was dropped
+
+	var request IPCMessage
+	if err := json.NewDecoder(remote).Decode(&request); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := request.Data.(map[string]interface{}); request.Type != "event_replay_request" || data["since_version"] != float64(1) {
+		t.Fatalf("request = %s %v, want an event replay since version 1", request.Type, request.Data)
+	}
+	if err := json.NewEncoder(remote).Encode(IPCMessage{Type: "event_replay_response", RequestID: request.RequestID, Data: map[string]interface{}{
+		"complete": true,
+		"events": []types.StateEvent{
+			{Type: types.EventMessageUpdated, Version: 2},
+			{Type: types.EventMessageUpdated, Version: 3},
+			{Type: types.EventInputUpdated, Version: 3, SourcePanel: "panel-1"}, // Never sent to the panel that caused it
+		},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+	wait(2)
+	send(4, 4)
+	wait(1)
+
+	if len(versions) != 4 || versions[0] != 1 || versions[1] != 2 || versions[2] != 3 || versions[3] != 4 {
+		t.Errorf("delivered versions %v, want [1 2 3 4]", versions)
+	}
+	if gaps := client.Gaps(); gaps != 1 {
+		t.Errorf("gaps = %d, want 1", gaps)
+	}
+}
+
+func TestChecksumMismatchResyncsHandlers(t *testing.T) {
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	client.connectionMux.Lock()
+	client.conn = local
+	client.encoder = json.NewEncoder(local)
+	client.decoder = json.NewDecoder(local)
+	client.isConnected = true
+	client.connectionMux.Unlock()
+
+	server := &types.SharedApplicationState{Version: types.StateVersion{Version: 5}, Provider: "anthropic"}
+	cached := &types.SharedApplicationState{Version: types.StateVersion{Version: 5}, Provider: "openai"}
+	client.SetStateView(func() (int64, types.StateChecksums) {
+		return cached.Version.Version, cached.Checksums(types.ChecksumSettings)
+	})
+	synced := make(chan types.StateSyncPayload, 1)
+	client.RegisterEventHandler(types.EventStateSync, func(event types.StateEvent) error {
+		var payload types.StateSyncPayload
+		if err := mapToStruct(event.Data, &payload); err != nil {
+			return err
+		}
+		synced <- payload
+		return nil
+	})
+	go client.handleMessages()
+
+	pong := func(version int64) {
+		t.Helper()
+		if err := json.NewEncoder(remote).Encode(IPCMessage{Type: "pong", Data: PongPayload{Version: version, Checksums: server.Checksums()}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A view at another version is not compared
+	pong(6)
+	pong(5)
+	var request IPCMessage
+	if err := json.NewDecoder(remote).Decode(&request); err != nil {
+		t.Fatal(err)
+	}
+	if request.Type != "state_request" {
+		t.Fatalf("request = %s, want a state request", request.Type)
+	}
+	if err := json.NewEncoder(remote).Encode(IPCMessage{Type: "state_response", RequestID: request.RequestID, Data: server}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case payload := <-synced:
+		if payload.State == nil || payload.State.Provider != "anthropic" || len(payload.Sections) != 1 || payload.Sections[0] != types.ChecksumSettings {
+			t.Errorf("sync = %+v, want the server's state repairing the settings", payload)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no state sync after the checksums differed")
+	}
+	if mismatches := client.Mismatches(); mismatches != 1 {
+		t.Errorf("mismatches = %d, want 1", mismatches)
+	}
+}
+
+func TestNextClockAdvancesPerSend(t *testing.T) {
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	if clock := client.nextClock(); clock != nil {
+		t.Fatalf("nextClock() = %v before the server sent a clock, want nil", clock)
+	}
+
+	client.setCurrentClock(types.VectorClock{"orchestrator": 4, "panel-1": 2})
+	first, second := client.nextClock(), client.nextClock()
+	if first["panel-1"] != 3 || second["panel-1"] != 4 || second["orchestrator"] != 4 {
+		t.Fatalf("clocks = %v, %v; want panel-1 at 3 then 4", first, second)
+	}
+	if second.Compare(first) != types.ClockAfter {
+		t.Errorf("second send %v does not follow the first %v", second, first)
+	}
+
+	// An echo of the first send must not rewind the counter
+	client.setCurrentClock(first)
+	if third := client.nextClock(); third["panel-1"] != 5 {
+		t.Errorf("third clock = %v, want panel-1 at 5", third)
+	}
+}
+
+func TestEventsNeverRewindVersion(t *testing.T) {
+	client := NewSocketClient("unused.sock", "panel-1", "test")
+	clock := types.VectorClock{"orchestrator": 5}
+
+	client.deliverEvent(types.StateEvent{Type: types.EventMessageAdded, Version: 5, Clock: clock})
+	// Snapshot notices carry no version; a late event carries an older one
+	client.deliverEvent(types.StateEvent{Type: types.EventSnapshotUpdated})
+	client.deliverEvent(types.StateEvent{Type: types.EventMessageUpdated, Version: 3, Clock: types.VectorClock{"orchestrator": 3}})
+
+	if got := client.GetCurrentVersion(); got != 5 {
+		t.Errorf("version = %d, want 5", got)
+	}
+	if next := client.nextClock(); next["orchestrator"] != 5 {
+		t.Errorf("next clock = %v, want orchestrator at 5", next)
+	}
+}
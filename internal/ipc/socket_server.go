@@ -9,15 +9,27 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/ids"
 	"github.com/opencode/tmux_coder/internal/interfaces"
 	"github.com/opencode/tmux_coder/internal/permission"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/tracing"
 	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/version"
 )
 
+// DefaultSocketMode restricts the socket to its owner
+const DefaultSocketMode os.FileMode = 0600
+
 // SocketServer manages Unix Domain Socket server for inter-panel communication
 type SocketServer struct {
 	socketPath        string
@@ -28,12 +40,38 @@ type SocketServer struct {
 	stateManager      interfaces.StateManager
 	control           interfaces.OrchestratorControl
 	permissionChecker *permission.Checker
+	socketMode        os.FileMode
+	peerPolicy        permission.PermissionLevel
+	tracer            *tracing.Tracer
+	confirmations     *confirmationGate
+	transfers         *stateTransfers
+	stateChunkSize    int
+	instance          string               // Identifies this run of the server in handshakes
+	checksums         types.StateChecksums // Gossiped in pongs, computed once per version
+	checksumVersion   int64
+	checksumMux       sync.Mutex
+	adminToken        string
+	adminMutex        sync.RWMutex
+	profileDir        string     // Where write_profile puts profiles, guarded by profileMutex
+	profileMutex      sync.Mutex // Held while a profile is captured
+	debugLogging      atomic.Bool
 	ctx               context.Context
 	cancel            context.CancelFunc
 	isRunning         bool
 	runningMux        sync.RWMutex
 }
 
+// capabilitySubscriber is implemented by event buses that route events by panel capabilities
+type capabilitySubscriber interface {
+	SubscribeWithCapabilities(connectionID, panelID, panelType string, capabilities *types.PanelCapabilities, eventChan chan types.StateEvent)
+}
+
+// identitySubscriber is implemented by event buses that carry a panel's
+// subscription over to the next process with the same identity
+type identitySubscriber interface {
+	SubscribeWithIdentity(connectionID, panelID, panelType, identity string, capabilities *types.PanelCapabilities, replay bool, eventChan chan types.StateEvent)
+}
+
 // ClientConnection represents a connected panel client
 type ClientConnection struct {
 	ID           string                   `json:"id"`
@@ -44,8 +82,13 @@ type ClientConnection struct {
 	LastSeen     time.Time                `json:"last_seen"`
 	MessageCount int64                    `json:"message_count"`
 	Requester    *interfaces.IpcRequester `json:"requester,omitempty"` // Client credentials
-	encoder      *json.Encoder            `json:"-"`
-	decoder      *json.Decoder            `json:"-"`
+	Capabilities *types.PanelCapabilities `json:"capabilities,omitempty"`
+	Framing      string                   `json:"framing,omitempty"`
+	Build        string                   `json:"build,omitempty"`    // Build of the panel's binary, from the handshake
+	Protocol     string                   `json:"protocol,omitempty"` // IPC protocol the panel speaks
+	Identity     string                   `json:"identity,omitempty"` // Stable identity the orchestrator gave the panel
+	encoder      rawEncoder               `json:"-"`
+	decoder      messageDecoder           `json:"-"`
 	sendMutex    sync.Mutex               // To synchronize writes to the connection
 }
 
@@ -65,19 +108,48 @@ func (cc *ClientConnection) send(message IPCMessage) error {
 	return cc.encoder.Encode(message)
 }
 
+// sendEncoded writes a message already encoded as JSON to the client
+func (cc *ClientConnection) sendEncoded(payload []byte) error {
+	cc.sendMutex.Lock()
+	defer cc.sendMutex.Unlock()
+
+	if cc.Conn == nil {
+		return fmt.Errorf("cannot send message to nil connection for panel %s", cc.PanelID)
+	}
+
+	cc.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	defer cc.Conn.SetWriteDeadline(time.Time{})
+
+	return cc.encoder.EncodeRaw(payload)
+}
+
 // NewSocketServer creates a new Unix Domain Socket server
 func NewSocketServer(socketPath string, eventBus interfaces.EventBus, stateManager interfaces.StateManager, control interfaces.OrchestratorControl) *SocketServer {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	return &SocketServer{
-		socketPath:   socketPath,
-		connections:  make(map[string]*ClientConnection),
-		eventBus:     eventBus,
-		stateManager: stateManager,
-		control:      control,
-		ctx:          ctx,
-		cancel:       cancel,
+		socketPath:     socketPath,
+		connections:    make(map[string]*ClientConnection),
+		eventBus:       eventBus,
+		stateManager:   stateManager,
+		control:        control,
+		socketMode:     DefaultSocketMode,
+		peerPolicy:     permission.PermissionOwner,
+		transfers:      newStateTransfers(),
+		stateChunkSize: DefaultStateChunkSize,
+		instance:       ids.New("server"),
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// SetStateChunkSize sets the largest piece a full state is sent in to panels
+// that ask for chunks; states that fit in one go out whole
+func (server *SocketServer) SetStateChunkSize(size int) {
+	if size <= 0 {
+		size = DefaultStateChunkSize
 	}
+	server.stateChunkSize = size
 }
 
 // SetPermissionChecker sets the permission checker for the server
@@ -85,6 +157,72 @@ func (server *SocketServer) SetPermissionChecker(checker *permission.Checker) {
 	server.permissionChecker = checker
 }
 
+// SetSocketMode sets the file mode applied to the socket when the server starts
+func (server *SocketServer) SetSocketMode(mode os.FileMode) {
+	server.socketMode = mode
+}
+
+// SetPeerPolicy sets which peers may connect, based on their kernel-reported credentials.
+// The default admits only processes owned by the session owner.
+func (server *SocketServer) SetPeerPolicy(level permission.PermissionLevel) {
+	server.peerPolicy = level
+}
+
+// SetTracer records a span for each state update received; nil only propagates trace context
+func (server *SocketServer) SetTracer(tracer *tracing.Tracer) {
+	server.tracer = tracer
+}
+
+// SetConfirmations makes the listed destructive operations wait for their
+// sender to confirm them within the given time; operations not listed, or
+// listed with no time, apply at once
+func (server *SocketServer) SetConfirmations(timeouts map[types.UpdateType]time.Duration) {
+	server.confirmations = newConfirmationGate(timeouts)
+}
+
+// requestConfirmation answers a destructive request with its confirmation
+// token and tells the other panels it is pending
+func (server *SocketServer) requestConfirmation(clientConn *ClientConnection, required *ConfirmationRequiredError, sessionID, requestID string) {
+	log.Printf("[IPC] %s from panel %s waits for confirmation until %s", required.Operation, clientConn.PanelID, required.ExpiresAt.Format(time.RFC3339))
+	if err := clientConn.send(confirmationResponse(required, requestID)); err != nil {
+		log.Printf("Failed to send confirmation request: %v", err)
+	}
+	if server.eventBus == nil {
+		return
+	}
+	server.eventBus.Broadcast(types.StateEvent{
+		ID:   uuid.New().String(),
+		Type: types.EventConfirmationRequired,
+		Data: types.ConfirmationRequiredPayload{
+			Operation:   required.Operation,
+			SourcePanel: clientConn.PanelID,
+			SessionID:   sessionID,
+			ExpiresAt:   required.ExpiresAt,
+		},
+		Version:     server.stateManager.GetState().GetCurrentVersion(),
+		SourcePanel: clientConn.PanelID,
+		Timestamp:   time.Now(),
+	})
+}
+
+// admitPeer checks the connecting process's credentials against the peer policy
+func (server *SocketServer) admitPeer(requester *interfaces.IpcRequester) error {
+	if server.peerPolicy == permission.PermissionAny {
+		return nil
+	}
+	if requester == nil {
+		return fmt.Errorf("peer credentials unavailable")
+	}
+	if server.permissionChecker != nil {
+		return server.permissionChecker.CheckLevel(server.peerPolicy, requester)
+	}
+	// Without a checker the server process itself is the owner
+	if requester.UID != uint32(os.Getuid()) {
+		return fmt.Errorf("permission denied: peer UID %d does not match server UID %d", requester.UID, os.Getuid())
+	}
+	return nil
+}
+
 // Start begins listening for client connections
 func (server *SocketServer) Start() error {
 	server.runningMux.Lock()
@@ -99,11 +237,15 @@ func (server *SocketServer) Start() error {
 		return fmt.Errorf("failed to cleanup existing socket: %w", err)
 	}
 
-	// Create directory for socket if it doesn't exist
+	// Create directory for socket if it doesn't exist. Other users may traverse
+	// it to reach the socket but cannot create or replace entries.
 	socketDir := filepath.Dir(server.socketPath)
-	if err := os.MkdirAll(socketDir, 0755); err != nil {
+	if err := os.MkdirAll(socketDir, 0711); err != nil {
 		return fmt.Errorf("failed to create socket directory: %w", err)
 	}
+	if info, err := os.Stat(socketDir); err == nil && info.Mode().Perm()&0002 != 0 && info.Mode()&os.ModeSticky == 0 {
+		log.Printf("Warning: socket directory %s is world-writable; other users could replace the socket", socketDir)
+	}
 
 	// Start listening on Unix Domain Socket
 	listener, err := net.Listen("unix", server.socketPath)
@@ -111,9 +253,8 @@ func (server *SocketServer) Start() error {
 		return fmt.Errorf("failed to listen on socket: %w", err)
 	}
 
-	// Set socket permissions to allow group/other users to connect
-	// Application-level permission checking will enforce access control
-	if err := os.Chmod(server.socketPath, 0666); err != nil {
+	// File mode is the first gate; peer credentials are checked again on each connection
+	if err := os.Chmod(server.socketPath, server.socketMode); err != nil {
 		listener.Close()
 		return fmt.Errorf("failed to set socket permissions: %w", err)
 	}
@@ -198,12 +339,25 @@ func (server *SocketServer) acceptConnections() {
 // handleConnection processes a new client connection
 func (server *SocketServer) handleConnection(conn net.Conn) {
 	defer conn.Close()
+	defer server.recoverConnection()
 
 	// Set initial deadline for handshake
 	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
 
 	decoder := json.NewDecoder(conn)
-	encoder := json.NewEncoder(conn)
+	encoder := newLineEncoder(conn)
+
+	// Extract requester credentials and reject unauthorized peers before reading anything from them
+	requester, err := GetRequesterFromConn(conn)
+	if err != nil {
+		log.Printf("Warning: failed to extract peer credentials: %v", err)
+		requester = nil
+	}
+	if err := server.admitPeer(requester); err != nil {
+		log.Printf("Rejected IPC connection: %v", err)
+		encoder.Encode(HandshakeResponse{Success: false, Error: err.Error()})
+		return
+	}
 
 	// Wait for handshake message
 	var handshake HandshakeMessage
@@ -221,26 +375,43 @@ func (server *SocketServer) handleConnection(conn net.Conn) {
 		return
 	}
 
-	// Extract requester credentials
-	requester, err := GetRequesterFromConn(conn)
-	if err != nil {
-		log.Printf("Warning: failed to extract peer credentials: %v", err)
-		// Continue without credentials for backward compatibility
-	} else {
+	if handshake.Capabilities != nil {
+		for _, pattern := range handshake.Capabilities.Topics {
+			if err := types.ValidateTopicPattern(pattern); err != nil {
+				log.Printf("Invalid handshake from panel %s: %v", handshake.PanelID, err)
+				encoder.Encode(HandshakeResponse{Success: false, Error: err.Error()})
+				return
+			}
+		}
+	}
+
+	if !version.ProtocolSupported(version.Protocol, handshake.Version) {
+		err := fmt.Errorf("panel %s speaks IPC protocol %q but orchestrator %s speaks %s; restart the session so both run the same release",
+			handshake.PanelID, handshake.Version, version.Build, version.Protocol)
+		log.Printf("Refused handshake: %v", err)
+		encoder.Encode(HandshakeResponse{Success: false, Error: err.Error(), Build: version.Build, Protocol: version.Protocol})
+		return
+	}
+
+	if requester != nil {
 		log.Printf("Connection from user %s (UID=%d, GID=%d)", requester.Username, requester.UID, requester.GID)
 	}
 
 	// Create client connection object
 	clientConn := &ClientConnection{
-		ID:          fmt.Sprintf("%s-%d", handshake.PanelID, time.Now().UnixNano()),
-		PanelType:   handshake.PanelType,
-		PanelID:     handshake.PanelID,
-		Conn:        conn,
-		ConnectedAt: time.Now(),
-		LastSeen:    time.Now(),
-		Requester:   requester,
-		encoder:     encoder,
-		decoder:     decoder,
+		ID:           ids.New(handshake.PanelID),
+		PanelType:    handshake.PanelType,
+		PanelID:      handshake.PanelID,
+		Conn:         conn,
+		ConnectedAt:  time.Now(),
+		LastSeen:     time.Now(),
+		Requester:    requester,
+		Capabilities: handshake.Capabilities,
+		Build:        handshake.Build,
+		Protocol:     handshake.Version,
+		Identity:     handshake.Identity,
+		encoder:      encoder,
+		decoder:      decoder,
 	}
 
 	// Send handshake response (raw, not wrapped in IPCMessage)
@@ -249,21 +420,38 @@ func (server *SocketServer) handleConnection(conn net.Conn) {
 		Success:      true,
 		ConnectionID: clientConn.ID,
 		ServerTime:   time.Now(),
+		Build:        version.Build,
+		Protocol:     version.Protocol,
+		Instance:     server.instance,
+	}
+	if handshake.Framing == FramingLengthPrefixed {
+		handshakeResponse.Framing = FramingLengthPrefixed
 	}
 	if err := encoder.Encode(handshakeResponse); err != nil {
 		log.Printf("Failed to send handshake response: %v", err)
 		return
 	}
+	if handshakeResponse.Framing == FramingLengthPrefixed {
+		clientConn.Framing = FramingLengthPrefixed
+		clientConn.encoder = NewFrameEncoder(conn, 0)
+		clientConn.decoder = NewFrameDecoder(AfterHandshake(decoder, conn), 0)
+	}
 
 	// Register connection
 	server.connectionsMux.Lock()
 	server.connections[clientConn.ID] = clientConn
 	server.connectionsMux.Unlock()
-	log.Printf("Panel %s (%s) connected with ID %s", clientConn.PanelID, clientConn.PanelType, clientConn.ID)
+	log.Printf("Panel %s (%s) connected with ID %s, build %s", clientConn.PanelID, clientConn.PanelType, clientConn.ID, buildName(clientConn.Build))
 
 	// Subscribe to event bus
 	eventChan := make(chan types.StateEvent, 100)
-	server.eventBus.Subscribe(clientConn.ID, clientConn.PanelID, clientConn.PanelType, eventChan)
+	if router, ok := server.eventBus.(identitySubscriber); ok && clientConn.Identity != "" {
+		router.SubscribeWithIdentity(clientConn.ID, clientConn.PanelID, clientConn.PanelType, clientConn.Identity, clientConn.Capabilities, !handshake.Reconnect, eventChan)
+	} else if router, ok := server.eventBus.(capabilitySubscriber); ok && clientConn.Capabilities != nil {
+		router.SubscribeWithCapabilities(clientConn.ID, clientConn.PanelID, clientConn.PanelType, clientConn.Capabilities, eventChan)
+	} else {
+		server.eventBus.Subscribe(clientConn.ID, clientConn.PanelID, clientConn.PanelType, eventChan)
+	}
 
 	// Start event forwarding goroutine
 	go server.forwardEvents(clientConn, eventChan)
@@ -297,6 +485,10 @@ func (server *SocketServer) handleClientMessages(clientConn *ClientConnection) {
 					// log.Printf("[SERVER] Read timeout for client %s. Looping.", clientConn.ID)
 					continue
 				}
+				if isRecoverableFrameError(err) {
+					log.Printf("Skipping message from client %s: %v", clientConn.ID, err)
+					continue
+				}
 				log.Printf("Error reading from client %s: %v", clientConn.ID, err)
 				return // Real error or EOF, close connection
 			}
@@ -312,18 +504,35 @@ func (server *SocketServer) handleClientMessages(clientConn *ClientConnection) {
 
 // processClientMessage handles a message from a client
 func (server *SocketServer) processClientMessage(clientConn *ClientConnection, message IPCMessage) {
+	defer server.recoverHandler(clientConn, message)
 	log.Printf("[SERVER] Received message of type '%s' from client %s (%s)", message.Type, clientConn.PanelID, clientConn.ID)
 	switch message.Type {
 	case "state_update":
 		server.handleStateUpdate(clientConn, message)
 	case "state_request":
 		server.handleStateRequest(clientConn, message)
+	case "state_chunk_request":
+		server.handleStateChunkRequest(clientConn, message)
 	case "clear_session_messages":
 		server.handleClearSessionMessages(clientConn, message)
+	case "redact_message":
+		server.handleRedactMessage(clientConn, message)
+	case "opencode_export_request":
+		server.handleOpencodeExport(clientConn, message)
+	case "opencode_import_request":
+		server.handleOpencodeImport(clientConn, message)
+	case "blob_request":
+		server.handleBlobRequest(clientConn, message)
+	case "state_at_request":
+		server.handleStateAtRequest(clientConn, message)
+	case "event_replay_request":
+		server.handleEventReplayRequest(clientConn, message)
 	case "ping":
 		server.handlePing(clientConn, message)
 	case "orchestrator_command":
 		server.handleOrchestratorCommand(clientConn, message)
+	case "admin_command":
+		server.handleAdminCommand(clientConn, message)
 	default:
 		log.Printf("Unknown message type from client %s: %s", clientConn.ID, message.Type)
 		server.sendError(clientConn, "unknown message type")
@@ -341,21 +550,63 @@ func (server *SocketServer) handleStateUpdate(clientConn *ClientConnection, mess
 
 	update.SourcePanel = clientConn.PanelID
 
+	// The update's own context wins over the envelope's; the sync manager
+	// parents its spans on this one
+	parent := update.TraceParent
+	if parent == "" {
+		parent = message.TraceParent
+	}
+	span := server.tracer.Start(parent, "ipc.handle_state_update")
+	defer span.End()
+	span.SetAttr("panel.id", clientConn.PanelID)
+	span.SetAttr("update.id", update.ID)
+	span.SetAttr("update.type", string(update.Type))
+	update.TraceParent = span.TraceParent()
+
+	if update.Type == types.UIActionTriggered {
+		var payload types.UIActionPayload
+		err := mapToStruct(update.Payload, &payload)
+		if err == nil {
+			err = NewMessageValidator().ValidateUIAction(payload)
+		}
+		if err != nil {
+			log.Printf("Rejected UI action from %s: %v", clientConn.PanelID, err)
+			span.SetError(err)
+			server.sendErrorMessage(clientConn, "state_update_error", err.Error(), message.RequestID)
+			return
+		}
+	}
+
+	if required := server.confirmations.check(update.Type, clientConn.PanelID, update.Payload, update.ConfirmationToken, time.Now()); required != nil {
+		var target struct {
+			SessionID string `json:"session_id"`
+		}
+		_ = mapToStruct(update.Payload, &target)
+		span.SetAttr("confirmation.required", true)
+		server.requestConfirmation(clientConn, required, target.SessionID, message.RequestID)
+		return
+	}
+
 	err := server.stateManager.UpdateWithVersionCheck(update)
 	if err != nil {
 		log.Printf("Failed to apply state update: %v", err)
+		span.SetError(err)
 		server.sendErrorMessage(clientConn, "state_update_error", err.Error(), message.RequestID)
 		return
 	}
+	server.confirmations.confirmed(update.ConfirmationToken)
 
+	current := server.stateManager.GetState().Version
 	response := IPCMessage{
 		Type:      "state_update_response",
 		RequestID: message.RequestID,
 		Data: map[string]interface{}{
 			"success": true,
-			"version": server.stateManager.GetState().GetCurrentVersion(),
+			"version": current.Version,
+			"clock":   current.Clock,
 		},
-		Timestamp: time.Now(),
+		Timestamp:   time.Now(),
+		TraceParent: update.TraceParent,
 	}
 	log.Printf("[SERVER] Sending state_update_response id=%s version=%d to panel=%s", message.RequestID, server.stateManager.GetState().GetCurrentVersion(), clientConn.PanelID)
 	if err := clientConn.send(response); err != nil {
@@ -363,8 +614,30 @@ func (server *SocketServer) handleStateUpdate(clientConn *ClientConnection, mess
 	}
 }
 
-// handleStateRequest processes a state request from a client
+// handleStateRequest processes a state request from a client. A client that
+// asks for chunks gets a state larger than one chunk as a manifest to fetch
+// the chunks by, or the manifest of the transfer it resumes.
 func (server *SocketServer) handleStateRequest(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		Chunked bool   `json:"chunked"`
+		Resume  string `json:"resume"` // Transfer a reconnected client was part way through
+	}
+	if message.Data != nil {
+		if err := mapToStruct(message.Data, &request); err != nil {
+			log.Printf("Failed to decode state request: %v", err)
+			server.sendError(clientConn, "invalid request")
+			return
+		}
+	}
+
+	if request.Chunked && request.Resume != "" {
+		if manifest, ok := server.transfers.manifest(request.Resume, time.Now()); ok {
+			log.Printf("[IPC] Panel %s resumes state transfer %s", clientConn.PanelID, manifest.TransferID)
+			server.sendStateManifest(clientConn, manifest, message.RequestID)
+			return
+		}
+	}
+
 	currentState := server.stateManager.GetState()
 	if currentState == nil {
 		server.sendError(clientConn, "state not available")
@@ -376,10 +649,28 @@ func (server *SocketServer) handleStateRequest(clientConn *ClientConnection, mes
 		clientConn.PanelID, clientConn.PanelType, currentState.CurrentSessionID,
 		len(currentState.Sessions), len(currentState.Messages))
 
+	snapshot := currentState.Clone()
+	var data interface{} = snapshot
+	if request.Chunked {
+		encoded, err := json.Marshal(timefmt.UTC(snapshot))
+		if err != nil {
+			server.sendErrorMessage(clientConn, "error", fmt.Sprintf("failed to encode state: %v", err), message.RequestID)
+			return
+		}
+		if len(encoded) > server.stateChunkSize {
+			manifest := server.transfers.start(encoded, snapshot.GetCurrentVersion(), server.stateChunkSize, time.Now())
+			log.Printf("[IPC] Sending state version %d to panel %s in %d chunks (%d bytes)",
+				manifest.Version, clientConn.PanelID, manifest.Chunks, manifest.Size)
+			server.sendStateManifest(clientConn, manifest, message.RequestID)
+			return
+		}
+		data = json.RawMessage(encoded)
+	}
+
 	response := IPCMessage{
 		Type:      "state_response",
 		RequestID: message.RequestID,
-		Data:      currentState.Clone(),
+		Data:      data,
 		Timestamp: time.Now(),
 	}
 	if err := clientConn.send(response); err != nil {
@@ -387,6 +678,48 @@ func (server *SocketServer) handleStateRequest(clientConn *ClientConnection, mes
 	}
 }
 
+// sendStateManifest answers a state request with the manifest of a chunked transfer
+func (server *SocketServer) sendStateManifest(clientConn *ClientConnection, manifest StateManifest, requestID string) {
+	response := IPCMessage{
+		Type:      "state_manifest",
+		RequestID: requestID,
+		Data:      manifest,
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send state manifest: %v", err)
+	}
+}
+
+// handleStateChunkRequest serves one chunk of a chunked state transfer
+func (server *SocketServer) handleStateChunkRequest(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		TransferID string `json:"transfer_id"`
+		Index      int    `json:"index"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode state chunk request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+
+	chunk, err := server.transfers.chunk(request.TransferID, request.Index, time.Now())
+	if err != nil {
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	response := IPCMessage{
+		Type:      "state_chunk",
+		RequestID: message.RequestID,
+		Data:      chunk,
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send state chunk: %v", err)
+	}
+}
+
 // handleClearSessionMessages processes clear session messages request
 func (server *SocketServer) handleClearSessionMessages(clientConn *ClientConnection, message IPCMessage) {
 	var requestData map[string]interface{}
@@ -407,12 +740,20 @@ func (server *SocketServer) handleClearSessionMessages(clientConn *ClientConnect
 		panelID = pid
 	}
 
+	token, _ := requestData["confirmation_token"].(string)
+	payload := types.MessagesClearPayload{SessionID: sessionID}
+	if required := server.confirmations.check(types.MessagesCleared, clientConn.PanelID, payload, token, time.Now()); required != nil {
+		server.requestConfirmation(clientConn, required, sessionID, message.RequestID)
+		return
+	}
+
 	// Call syncManager to clear session messages
 	if err := server.stateManager.ClearSessionMessages(sessionID, panelID); err != nil {
 		log.Printf("Failed to clear session messages: %v", err)
 		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
 		return
 	}
+	server.confirmations.confirmed(token)
 
 	// Send success response
 	response := IPCMessage{
@@ -430,11 +771,155 @@ func (server *SocketServer) handleClearSessionMessages(clientConn *ClientConnect
 	}
 }
 
+// handleRedactMessage processes a request to redact ranges of a message
+func (server *SocketServer) handleRedactMessage(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		MessageID string                 `json:"message_id"`
+		Ranges    []types.RedactionRange `json:"ranges"`
+		Reason    string                 `json:"reason"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode redact request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+
+	if request.MessageID == "" {
+		server.sendErrorMessage(clientConn, "error", "message_id is required", message.RequestID)
+		return
+	}
+
+	if err := server.stateManager.RedactMessage(request.MessageID, request.Ranges, request.Reason, clientConn.PanelID); err != nil {
+		log.Printf("Failed to redact message %s: %v", request.MessageID, err)
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	response := IPCMessage{
+		Type:      "redact_message_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"success":    true,
+			"message_id": request.MessageID,
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send redact response: %v", err)
+	}
+}
+
+// handleBlobRequest returns an offloaded message body or parts list
+func (server *SocketServer) handleBlobRequest(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		Hash string `json:"hash"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode blob request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+
+	data, err := server.stateManager.GetBlob(request.Hash)
+	if err != nil {
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	response := IPCMessage{
+		Type:      "blob_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"hash":    request.Hash,
+			"content": string(data),
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send blob response: %v", err)
+	}
+}
+
+// handleStateAtRequest serves a reconstructed past state. The response is a
+// read-only view: it never changes live state or the client's tracked version.
+func (server *SocketServer) handleStateAtRequest(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		Version int64 `json:"version"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode state-at request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+
+	historical, err := server.stateManager.StateAt(request.Version)
+	if err != nil {
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	log.Printf("[IPC] Panel %s viewing state at version %d", clientConn.PanelID, request.Version)
+
+	response := IPCMessage{
+		Type:      "state_at_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"version":   request.Version,
+			"read_only": true,
+			"state":     historical,
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send state-at response: %v", err)
+	}
+}
+
+// handleEventReplayRequest returns the retained events a client missed after since_version
+func (server *SocketServer) handleEventReplayRequest(clientConn *ClientConnection, message IPCMessage) {
+	var request struct {
+		SinceVersion int64 `json:"since_version"`
+	}
+	if err := mapToStruct(message.Data, &request); err != nil {
+		log.Printf("Failed to decode event replay request: %v", err)
+		server.sendError(clientConn, "invalid request")
+		return
+	}
+
+	events, complete, err := server.eventBus.GetEventsSince(request.SinceVersion)
+	if err != nil {
+		server.sendErrorMessage(clientConn, "error", err.Error(), message.RequestID)
+		return
+	}
+
+	log.Printf("[IPC] Replaying %d events since version %d to panel %s (complete=%v)",
+		len(events), request.SinceVersion, clientConn.PanelID, complete)
+
+	response := IPCMessage{
+		Type:      "event_replay_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"since_version": request.SinceVersion,
+			"complete":      complete,
+			"events":        events,
+		},
+		Timestamp: time.Now(),
+	}
+
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send event replay response: %v", err)
+	}
+}
+
 // handlePing processes a ping message from a client
 func (server *SocketServer) handlePing(clientConn *ClientConnection, message IPCMessage) {
 	response := IPCMessage{
 		Type:      "pong",
 		RequestID: message.RequestID,
+		Data:      server.stateChecksums(),
 		Timestamp: time.Now(),
 	}
 	if err := clientConn.send(response); err != nil {
@@ -442,8 +927,24 @@ func (server *SocketServer) handlePing(clientConn *ClientConnection, message IPC
 	}
 }
 
+// stateChecksums returns the checksums of the current state, reusing those
+// of the last ping when the state has not changed since
+func (server *SocketServer) stateChecksums() PongPayload {
+	current := server.stateManager.GetState()
+	version := current.GetCurrentVersion()
+
+	server.checksumMux.Lock()
+	defer server.checksumMux.Unlock()
+	if server.checksums == nil || server.checksumVersion != version {
+		server.checksums = current.Checksums()
+		server.checksumVersion = version
+	}
+	return PongPayload{Version: version, Checksums: server.checksums}
+}
+
 // forwardEvents forwards state events to a client
 func (server *SocketServer) forwardEvents(clientConn *ClientConnection, eventChan chan types.StateEvent) {
+	defer server.recoverForwarder(clientConn)
 	for {
 		event, ok := <-eventChan
 		if !ok {
@@ -452,12 +953,23 @@ func (server *SocketServer) forwardEvents(clientConn *ClientConnection, eventCha
 			return
 		}
 
-		message := IPCMessage{
-			Type:      "state_event",
-			Data:      event,
-			Timestamp: time.Now(),
+		if server.debugLogging.Load() {
+			log.Printf("[SERVER] Forwarding event %s (%s) from %s to client %s", event.Type, event.ID, event.SourcePanel, clientConn.ID)
+		}
+		// Every subscriber is sent the same bytes, built by whichever forwards
+		// the event first
+		payload, err := event.WireEncoding(func(eventJSON []byte) ([]byte, error) {
+			return json.Marshal(IPCMessage{
+				Type:        "state_event",
+				Data:        json.RawMessage(eventJSON),
+				Timestamp:   time.Now(),
+				TraceParent: event.TraceParent,
+			})
+		})
+		if err == nil {
+			err = clientConn.sendEncoded(withSequence(payload, event.Sequence))
 		}
-		if err := clientConn.send(message); err != nil {
+		if err != nil {
 			log.Printf("Failed to forward event to client %s: %v", clientConn.ID, err)
 			server.disconnectClient(clientConn, fmt.Sprintf("event forwarding failed: %v", err))
 			return
@@ -465,6 +977,21 @@ func (server *SocketServer) forwardEvents(clientConn *ClientConnection, eventCha
 	}
 }
 
+// withSequence returns an encoded message with the subscriber's sequence
+// number added in front, leaving the shared encoding untouched
+func withSequence(payload []byte, sequence int64) []byte {
+	if sequence == 0 || len(payload) < 2 || payload[0] != '{' {
+		return payload
+	}
+	out := make([]byte, 0, len(payload)+24)
+	out = append(out, `{"sequence":`...)
+	out = strconv.AppendInt(out, sequence, 10)
+	if payload[1] != '}' {
+		out = append(out, ',')
+	}
+	return append(out, payload[1:]...)
+}
+
 // disconnectClient removes a client connection, unsubscribes it from the event bus,
 // and closes the underlying socket. It returns true if the connection was active.
 func (server *SocketServer) disconnectClient(clientConn *ClientConnection, reason string) bool {
@@ -562,6 +1089,36 @@ func (server *SocketServer) handleOrchestratorCommand(clientConn *ClientConnecti
 		operation = permission.OperationGetStatus
 	case "get_clients":
 		operation = permission.OperationGetClients
+	case "query_audit":
+		operation = permission.OperationQueryAudit
+	case "query_analytics":
+		operation = permission.OperationQueryAnalytics
+	case "collect_garbage":
+		operation = permission.OperationCollectGarbage
+	case "get_sync_config":
+		operation = permission.OperationGetSyncConfig
+	case "set_sync_config":
+		operation = permission.OperationSetSyncConfig
+	case "get_diagnostics":
+		operation = permission.OperationGetDiagnostics
+	case "get_delivery_stats":
+		operation = permission.OperationDeliveryStats
+	case "macro_record", "macro_stop", "macro_replay", "macro_list", "macro_delete":
+		operation = permission.OperationMacros
+	case "list_dir":
+		operation = permission.OperationListFiles
+	case "terminal_run":
+		operation = permission.OperationTerminalRun
+	case "edit_input":
+		operation = permission.OperationEditInput
+	case "cancel_run":
+		operation = permission.OperationCancelRun
+	case "compact_session":
+		operation = permission.OperationCompactSession
+	case "create_session_from_template":
+		operation = permission.OperationCreateSession
+	case "switch_profile":
+		operation = permission.OperationSwitchProfile
 	case "ping":
 		// Ping doesn't need permission check
 		operation = ""
@@ -679,9 +1236,18 @@ func (server *SocketServer) handleOrchestratorCommand(clientConn *ClientConnecti
 		}
 		return
 
-	case "ping":
-		if err := server.control.Ping(); err != nil {
-			log.Printf("Ping command failed: %v", err)
+	case "query_audit":
+		var filter audit.Filter
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &filter); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid audit filter", message.RequestID)
+				return
+			}
+		}
+
+		entries, err := server.control.QueryAudit(filter)
+		if err != nil {
+			log.Printf("Query audit command failed: %v", err)
 			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
 			return
 		}
@@ -691,39 +1257,480 @@ func (server *SocketServer) handleOrchestratorCommand(clientConn *ClientConnecti
 			RequestID: message.RequestID,
 			Data: map[string]interface{}{
 				"success": true,
-				"command": "ping",
+				"command": "query_audit",
+				"entries": entries,
 			},
 			Timestamp: time.Now(),
 		}
 		if err := clientConn.send(response); err != nil {
-			log.Printf("Failed to send ping response: %v", err)
+			log.Printf("Failed to send query_audit response: %v", err)
 		}
 		return
-	}
 
-	// Default success response for reload_layout
-	response := IPCMessage{
-		Type:      "orchestrator_command_response",
-		RequestID: message.RequestID,
-		Data: map[string]interface{}{
-			"success": true,
-			"command": cmdLower,
-		},
-		Timestamp: time.Now(),
-	}
-	if err := clientConn.send(response); err != nil {
-		log.Printf("Failed to send orchestrator command response: %v", err)
-	}
-}
+	case "query_analytics":
+		var query analytics.Query
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &query); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid analytics query", message.RequestID)
+				return
+			}
+		}
 
-// cleanupSocket removes the socket file if it exists
-func (server *SocketServer) cleanupSocket() error {
-	if _, err := os.Stat(server.socketPath); err == nil {
-		return os.Remove(server.socketPath)
-	}
+		report, err := server.control.QueryAnalytics(query)
+		if err != nil {
+			log.Printf("Query analytics command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "query_analytics",
+				"report":  report,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send query_analytics response: %v", err)
+		}
+		return
+
+	case "collect_garbage":
+		var params struct {
+			DryRun bool `json:"dry_run"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid gc parameters", message.RequestID)
+				return
+			}
+		}
+
+		stats, err := server.control.CollectGarbage(params.DryRun)
+		if err != nil {
+			log.Printf("Collect garbage command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "collect_garbage",
+				"stats":   stats,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send collect_garbage response: %v", err)
+		}
+		return
+
+	case "get_sync_config", "set_sync_config":
+		var config map[string]interface{}
+		var err error
+		if cmdLower == "set_sync_config" {
+			if len(payload.Params) == 0 {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "no settings to change", message.RequestID)
+				return
+			}
+			log.Printf("Sync config change from %v: %v", clientConn.Requester, payload.Params)
+			config, err = server.control.UpdateSyncConfig(payload.Params)
+		} else {
+			config, err = server.control.GetSyncConfig()
+		}
+		if err != nil {
+			log.Printf("%s command failed: %v", cmdLower, err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": cmdLower,
+				"config":  config,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send %s response: %v", cmdLower, err)
+		}
+		return
+
+	case "get_diagnostics":
+		var params struct {
+			RecentEvents int `json:"recent_events"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid diagnostics parameters", message.RequestID)
+				return
+			}
+		}
+		if params.RecentEvents <= 0 {
+			params.RecentEvents = 20
+		}
+
+		diagnostics, err := server.control.GetDiagnostics(params.RecentEvents)
+		if err != nil {
+			log.Printf("Get diagnostics command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success":     true,
+				"command":     "get_diagnostics",
+				"diagnostics": diagnostics,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send get_diagnostics response: %v", err)
+		}
+		return
+
+	case "get_delivery_stats":
+		subscribers, err := server.control.GetDeliveryStats()
+		if err != nil {
+			log.Printf("Get delivery stats command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success":     true,
+				"command":     "get_delivery_stats",
+				"subscribers": subscribers,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send get_delivery_stats response: %v", err)
+		}
+		return
+
+	case "macro_record", "macro_stop", "macro_replay", "macro_list", "macro_delete":
+		result, err := server.runMacroCommand(cmdLower, payload.Params)
+		if err != nil {
+			log.Printf("%s command failed: %v", cmdLower, err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		data := map[string]interface{}{
+			"success": true,
+			"command": cmdLower,
+		}
+		for key, value := range result {
+			data[key] = value
+		}
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data:      data,
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send %s response: %v", cmdLower, err)
+		}
+		return
+
+	case "list_dir":
+		var params struct {
+			Path string `json:"path"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid list_dir parameters", message.RequestID)
+				return
+			}
+		}
+
+		listing, err := server.control.ListDirectory(params.Path)
+		if err != nil {
+			log.Printf("List directory command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "list_dir",
+				"listing": listing,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send list_dir response: %v", err)
+		}
+		return
+
+	case "terminal_run":
+		var params struct {
+			Command string `json:"command"`
+			Dir     string `json:"dir"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid terminal_run parameters", message.RequestID)
+				return
+			}
+		}
+
+		run, err := server.control.RunTerminalCommand(params.Command, params.Dir)
+		if err != nil {
+			log.Printf("Terminal run command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "terminal_run",
+				"run":     run,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send terminal_run response: %v", err)
+		}
+		return
+
+	case "edit_input":
+		var params struct {
+			Text string `json:"text"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid edit_input parameters", message.RequestID)
+				return
+			}
+		}
+
+		if err := server.control.EditInput(params.Text); err != nil {
+			log.Printf("Edit input command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "edit_input",
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send edit_input response: %v", err)
+		}
+		return
+
+	case "cancel_run":
+		var params struct {
+			RunID     string `json:"run_id"`
+			MessageID string `json:"message_id"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid cancel_run parameters", message.RequestID)
+				return
+			}
+		}
+
+		if err := server.control.CancelRun(params.RunID, params.MessageID); err != nil {
+			log.Printf("Cancel run command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "cancel_run",
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send cancel_run response: %v", err)
+		}
+		return
+
+	case "compact_session":
+		var params struct {
+			SessionID string `json:"session_id"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid compact_session parameters", message.RequestID)
+				return
+			}
+		}
+
+		if err := server.control.CompactSession(params.SessionID); err != nil {
+			log.Printf("Compact session command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "compact_session",
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send compact_session response: %v", err)
+		}
+		return
+
+	case "create_session_from_template":
+		var params struct {
+			Template string `json:"template"`
+			Title    string `json:"title"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid create_session_from_template parameters", message.RequestID)
+				return
+			}
+		}
+
+		session, err := server.control.CreateSessionFromTemplate(params.Template, params.Title)
+		if err != nil {
+			log.Printf("Create session from template command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "create_session_from_template",
+				"session": session,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send create_session_from_template response: %v", err)
+		}
+		return
+
+	case "switch_profile":
+		var params struct {
+			Profile string `json:"profile"`
+		}
+		if payload.Params != nil {
+			if err := mapToStruct(payload.Params, &params); err != nil {
+				server.sendErrorMessage(clientConn, "orchestrator_command_response", "invalid switch_profile parameters", message.RequestID)
+				return
+			}
+		}
+
+		profile, err := server.control.SwitchProfile(params.Profile)
+		if err != nil {
+			log.Printf("Switch profile command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "switch_profile",
+				"profile": profile,
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send switch_profile response: %v", err)
+		}
+		return
+
+	case "ping":
+		if err := server.control.Ping(); err != nil {
+			log.Printf("Ping command failed: %v", err)
+			server.sendErrorMessage(clientConn, "orchestrator_command_response", err.Error(), message.RequestID)
+			return
+		}
+
+		response := IPCMessage{
+			Type:      "orchestrator_command_response",
+			RequestID: message.RequestID,
+			Data: map[string]interface{}{
+				"success": true,
+				"command": "ping",
+			},
+			Timestamp: time.Now(),
+		}
+		if err := clientConn.send(response); err != nil {
+			log.Printf("Failed to send ping response: %v", err)
+		}
+		return
+	}
+
+	// Default success response for reload_layout
+	response := IPCMessage{
+		Type:      "orchestrator_command_response",
+		RequestID: message.RequestID,
+		Data: map[string]interface{}{
+			"success": true,
+			"command": cmdLower,
+		},
+		Timestamp: time.Now(),
+	}
+	if err := clientConn.send(response); err != nil {
+		log.Printf("Failed to send orchestrator command response: %v", err)
+	}
+}
+
+// cleanupSocket removes the socket file if it exists
+func (server *SocketServer) cleanupSocket() error {
+	if _, err := os.Stat(server.socketPath); err == nil {
+		return os.Remove(server.socketPath)
+	}
 	return nil
 }
 
+// buildName names a panel's build in logs
+func buildName(build string) string {
+	if build == "" {
+		return "unknown"
+	}
+	return build
+}
+
 // GetConnections returns information about all active connections
 func (server *SocketServer) GetConnections() map[string]*ClientConnection {
 	server.connectionsMux.RLock()
@@ -739,6 +1746,8 @@ func (server *SocketServer) GetConnections() map[string]*ClientConnection {
 			ConnectedAt:  conn.ConnectedAt,
 			LastSeen:     conn.LastSeen,
 			MessageCount: conn.MessageCount,
+			Build:        conn.Build,
+			Protocol:     conn.Protocol,
 		}
 	}
 	return connections
@@ -0,0 +1,164 @@
+package ipc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// A full state can outgrow a frame. A client that asks for chunks gets, for a
+// state larger than one chunk, a manifest instead of the state and then
+// fetches the chunks in order. The server keeps a transfer by ID for a while
+// after its last request, so a panel that reconnects part way resumes it.
+
+// DefaultStateChunkSize is the largest piece of a chunked state transfer
+const DefaultStateChunkSize = 1 << 20
+
+const (
+	stateTransferTTL  = 2 * time.Minute // How long an idle transfer is kept for a resume
+	maxStateTransfers = 16              // Transfers kept at once; the least recently used goes first
+)
+
+// ErrTransferNotFound is returned for a chunk of a transfer the server no
+// longer holds; the client starts over
+var ErrTransferNotFound = errors.New("state transfer not found")
+
+// StateManifest describes a state sent in chunks
+type StateManifest struct {
+	TransferID string `json:"transfer_id"`
+	Version    int64  `json:"version"`    // State version being transferred
+	Size       int    `json:"size"`       // Bytes of the state's JSON encoding
+	ChunkSize  int    `json:"chunk_size"` // Bytes per chunk; the last may be shorter
+	Chunks     int    `json:"chunks"`
+	Checksum   string `json:"checksum"` // SHA-256 of the whole encoding
+}
+
+// StateChunk is one piece of a chunked state
+type StateChunk struct {
+	TransferID string `json:"transfer_id"`
+	Index      int    `json:"index"`
+	Data       []byte `json:"data"`
+}
+
+type stateTransfer struct {
+	manifest StateManifest
+	data     []byte
+	lastUsed time.Time
+}
+
+// stateTransfers holds the server's chunked transfers in progress
+type stateTransfers struct {
+	mutex sync.Mutex
+	byID  map[string]*stateTransfer
+}
+
+func newStateTransfers() *stateTransfers {
+	return &stateTransfers{byID: make(map[string]*stateTransfer)}
+}
+
+// start registers the encoding of a state version and returns its manifest
+func (t *stateTransfers) start(data []byte, version int64, chunkSize int, now time.Time) StateManifest {
+	manifest := StateManifest{
+		TransferID: uuid.New().String(),
+		Version:    version,
+		Size:       len(data),
+		ChunkSize:  chunkSize,
+		Chunks:     (len(data) + chunkSize - 1) / chunkSize,
+		Checksum:   transferChecksum(data),
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expireLocked(now)
+	if len(t.byID) >= maxStateTransfers {
+		var oldest string
+		for id, transfer := range t.byID {
+			if oldest == "" || transfer.lastUsed.Before(t.byID[oldest].lastUsed) {
+				oldest = id
+			}
+		}
+		delete(t.byID, oldest)
+	}
+	t.byID[manifest.TransferID] = &stateTransfer{manifest: manifest, data: data, lastUsed: now}
+	return manifest
+}
+
+// manifest returns the manifest of a transfer still held, for a resume
+func (t *stateTransfers) manifest(id string, now time.Time) (StateManifest, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expireLocked(now)
+	transfer, ok := t.byID[id]
+	if !ok {
+		return StateManifest{}, false
+	}
+	transfer.lastUsed = now
+	return transfer.manifest, true
+}
+
+// chunk returns one chunk of a transfer. The transfer is dropped once its
+// last chunk is served.
+func (t *stateTransfers) chunk(id string, index int, now time.Time) (StateChunk, error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.expireLocked(now)
+	transfer, ok := t.byID[id]
+	if !ok {
+		return StateChunk{}, fmt.Errorf("%w: %s", ErrTransferNotFound, id)
+	}
+	if index < 0 || index >= transfer.manifest.Chunks {
+		return StateChunk{}, fmt.Errorf("chunk %d out of range for transfer %s of %d chunks", index, id, transfer.manifest.Chunks)
+	}
+	transfer.lastUsed = now
+
+	start := index * transfer.manifest.ChunkSize
+	end := min(start+transfer.manifest.ChunkSize, len(transfer.data))
+	if index == transfer.manifest.Chunks-1 {
+		delete(t.byID, id)
+	}
+	return StateChunk{TransferID: id, Index: index, Data: transfer.data[start:end]}, nil
+}
+
+func (t *stateTransfers) expireLocked(now time.Time) {
+	for id, transfer := range t.byID {
+		if now.Sub(transfer.lastUsed) > stateTransferTTL {
+			delete(t.byID, id)
+		}
+	}
+}
+
+func transferChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// partialState is what a client has received of a chunked transfer
+type partialState struct {
+	manifest StateManifest
+	data     bytes.Buffer
+	next     int // Index of the next chunk to fetch
+}
+
+// decodeTransferredState verifies a completed transfer and decodes its state
+func decodeTransferredState(partial *partialState) (*types.SharedApplicationState, error) {
+	data := partial.data.Bytes()
+	if len(data) != partial.manifest.Size {
+		return nil, fmt.Errorf("state transfer %s: received %d bytes, expected %d", partial.manifest.TransferID, len(data), partial.manifest.Size)
+	}
+	if sum := transferChecksum(data); sum != partial.manifest.Checksum {
+		return nil, fmt.Errorf("state transfer %s: checksum mismatch", partial.manifest.TransferID)
+	}
+	var state types.SharedApplicationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("state transfer %s: failed to decode state: %w", partial.manifest.TransferID, err)
+	}
+	return &state, nil
+}
@@ -0,0 +1,92 @@
+package ipc
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestStateTransferChunks(t *testing.T) {
+	state := types.NewSharedApplicationState()
+	state.CurrentSessionID = "session-with-a-long-enough-id-to-span-chunks"
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	transfers := newStateTransfers()
+	manifest := transfers.start(data, 7, 16, now)
+	if manifest.Size != len(data) || manifest.Chunks != (len(data)+15)/16 || manifest.Version != 7 {
+		t.Fatalf("manifest = %+v for %d bytes", manifest, len(data))
+	}
+
+	// Fetch half, then resume from the manifest as a reconnected client would
+	partial := &partialState{manifest: manifest}
+	for ; partial.next < manifest.Chunks/2; partial.next++ {
+		chunk, err := transfers.chunk(manifest.TransferID, partial.next, now)
+		if err != nil {
+			t.Fatalf("chunk %d: %v", partial.next, err)
+		}
+		partial.data.Write(chunk.Data)
+	}
+	resumed, ok := transfers.manifest(manifest.TransferID, now.Add(time.Minute))
+	if !ok || resumed != manifest {
+		t.Fatalf("manifest(%s) = %+v, %v", manifest.TransferID, resumed, ok)
+	}
+	for ; partial.next < manifest.Chunks; partial.next++ {
+		chunk, err := transfers.chunk(manifest.TransferID, partial.next, now.Add(time.Minute))
+		if err != nil {
+			t.Fatalf("chunk %d: %v", partial.next, err)
+		}
+		partial.data.Write(chunk.Data)
+	}
+
+	got, err := decodeTransferredState(partial)
+	if err != nil {
+		t.Fatalf("decodeTransferredState: %v", err)
+	}
+	if got.CurrentSessionID != state.CurrentSessionID {
+		t.Errorf("CurrentSessionID = %q, want %q", got.CurrentSessionID, state.CurrentSessionID)
+	}
+
+	// The transfer is gone once its last chunk was served
+	if _, err := transfers.chunk(manifest.TransferID, 0, now); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("chunk after completion: %v, want ErrTransferNotFound", err)
+	}
+}
+
+func TestStateTransferChecksum(t *testing.T) {
+	data := []byte(`{"current_session_id":"a"}`)
+	partial := &partialState{manifest: StateManifest{Size: len(data), Checksum: transferChecksum(data)}}
+	partial.data.WriteString(`{"current_session_id":"b"}`)
+
+	if _, err := decodeTransferredState(partial); err == nil {
+		t.Errorf("corrupted transfer decoded")
+	}
+}
+
+func TestStateTransferExpiry(t *testing.T) {
+	now := time.Now()
+	transfers := newStateTransfers()
+
+	idle := transfers.start([]byte("idle"), 1, 2, now)
+	if _, err := transfers.chunk(idle.TransferID, 0, now.Add(stateTransferTTL+time.Second)); !errors.Is(err, ErrTransferNotFound) {
+		t.Errorf("idle transfer kept: %v", err)
+	}
+
+	first := transfers.start([]byte("first"), 1, 2, now)
+	for i := 1; i < maxStateTransfers; i++ {
+		transfers.start([]byte("other"), 1, 2, now.Add(time.Duration(i)*time.Millisecond))
+	}
+	transfers.start([]byte("newest"), 1, 2, now.Add(time.Second))
+	if _, ok := transfers.manifest(first.TransferID, now.Add(time.Second)); ok {
+		t.Errorf("least recently used transfer kept past the limit")
+	}
+	if len(transfers.byID) != maxStateTransfers {
+		t.Errorf("%d transfers held, want %d", len(transfers.byID), maxStateTransfers)
+	}
+}
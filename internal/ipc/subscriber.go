@@ -0,0 +1,252 @@
+package ipc
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// DefaultSubscriberQueue is the number of events a subscriber buffers before
+// dropping; a dropped event is recovered by the next state sync
+const DefaultSubscriberQueue = 128
+
+// SubscriberStats counts what a supervised subscriber has done
+type SubscriberStats struct {
+	Handled      int64 `json:"handled"`
+	Errors       int64 `json:"errors"`
+	Panics       int64 `json:"panics"`
+	Dropped      int64 `json:"dropped"`
+	Resubscribes int64 `json:"resubscribes"`
+	QueueDepth   int   `json:"queue_depth"`
+}
+
+// Subscriber runs a panel's event handlers on one goroutine of its own, so the
+// client's read loop never waits on a panel. Events are handled in the order
+// they arrived, a panicking handler is logged and counted rather than taking
+// the panel down, and after a reconnect the subscriber receives the events it
+// missed or, when the server can no longer replay them, fetches the current
+// state and delivers it as a state sync.
+type Subscriber struct {
+	client *SocketClient
+	name   string
+	queue  chan types.StateEvent
+
+	handlerMux    sync.RWMutex
+	handlers      map[types.StateEventType][]EventHandler
+	topicHandlers []topicHandler
+
+	statsMux sync.Mutex
+	stats    SubscriberStats
+
+	stop      chan struct{}
+	done      chan struct{}
+	startOnce sync.Once
+	stopOnce  sync.Once
+}
+
+// topicHandler is a handler for the events matching a topic pattern
+type topicHandler struct {
+	pattern string
+	handler EventHandler
+}
+
+// NewSubscriber returns a subscriber fed by the client; register handlers
+// with Handle, then call Start. A queueSize of zero uses DefaultSubscriberQueue.
+func (client *SocketClient) NewSubscriber(name string, queueSize int) *Subscriber {
+	if queueSize <= 0 {
+		queueSize = DefaultSubscriberQueue
+	}
+	s := &Subscriber{
+		client:   client,
+		name:     name,
+		queue:    make(chan types.StateEvent, queueSize),
+		handlers: make(map[types.StateEventType][]EventHandler),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	client.handlerMux.Lock()
+	client.subscribers = append(client.subscribers, s)
+	client.handlerMux.Unlock()
+	return s
+}
+
+// Handle registers a handler for an event type, or for every event with "*".
+// Handlers for a type run first, then topic handlers, then wildcard handlers,
+// each in registration order.
+func (s *Subscriber) Handle(eventType types.StateEventType, handler EventHandler) {
+	s.handlerMux.Lock()
+	defer s.handlerMux.Unlock()
+	s.handlers[eventType] = append(s.handlers[eventType], handler)
+}
+
+// HandleTopic registers a handler for the events whose topic matches pattern,
+// see types.MatchTopic
+func (s *Subscriber) HandleTopic(pattern string, handler EventHandler) error {
+	if err := types.ValidateTopicPattern(pattern); err != nil {
+		return err
+	}
+	s.handlerMux.Lock()
+	defer s.handlerMux.Unlock()
+	s.topicHandlers = append(s.topicHandlers, topicHandler{pattern: pattern, handler: handler})
+	return nil
+}
+
+// Start begins dispatching; calling it again has no effect
+func (s *Subscriber) Start() {
+	s.startOnce.Do(func() {
+		go s.run()
+	})
+}
+
+// Stop detaches the subscriber from the client and waits for the handler in
+// progress, if any, to return. Queued events are discarded. It must not be
+// called from one of the subscriber's own handlers.
+func (s *Subscriber) Stop() {
+	s.stopOnce.Do(func() {
+		s.client.handlerMux.Lock()
+		for i, sub := range s.client.subscribers {
+			if sub == s {
+				s.client.subscribers = append(s.client.subscribers[:i], s.client.subscribers[i+1:]...)
+				break
+			}
+		}
+		s.client.handlerMux.Unlock()
+
+		close(s.stop)
+		started := true
+		s.startOnce.Do(func() { started = false })
+		if started {
+			<-s.done
+		}
+	})
+}
+
+// Stats returns the subscriber's counters
+func (s *Subscriber) Stats() SubscriberStats {
+	s.statsMux.Lock()
+	defer s.statsMux.Unlock()
+	stats := s.stats
+	stats.QueueDepth = len(s.queue)
+	return stats
+}
+
+// wants reports whether any handler is registered for the event
+func (s *Subscriber) wants(event types.StateEvent) bool {
+	s.handlerMux.RLock()
+	defer s.handlerMux.RUnlock()
+	if len(s.handlers[event.Type]) > 0 || len(s.handlers["*"]) > 0 {
+		return true
+	}
+	if len(s.topicHandlers) == 0 {
+		return false
+	}
+	topic := types.EventTopic(event)
+	for _, th := range s.topicHandlers {
+		if types.MatchTopic(th.pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// offer queues an event without blocking the caller
+func (s *Subscriber) offer(event types.StateEvent) {
+	if !s.wants(event) {
+		return
+	}
+	select {
+	case s.queue <- event:
+	default:
+		s.statsMux.Lock()
+		s.stats.Dropped++
+		s.statsMux.Unlock()
+		log.Printf("[SUBSCRIBER] %s: queue full, dropping event %s", s.name, event.Type)
+	}
+}
+
+// resubscribe runs after the client reconnects and could not replay the
+// events it missed. The server registers the new connection itself; what the
+// panel lacks is whatever changed while it was away, so it gets the current
+// state as a sync.
+func (s *Subscriber) resubscribe() {
+	s.statsMux.Lock()
+	s.stats.Resubscribes++
+	s.statsMux.Unlock()
+
+	if !s.wants(types.StateEvent{Type: types.EventStateSync}) {
+		return
+	}
+	current, err := s.client.RequestState()
+	if err != nil {
+		log.Printf("[SUBSCRIBER] %s: failed to fetch state after reconnect: %v", s.name, err)
+		return
+	}
+	s.offer(types.StateEvent{
+		Type:        types.EventStateSync,
+		Data:        types.StateSyncPayload{State: current},
+		Version:     current.Version.Version,
+		SourcePanel: "system",
+		Timestamp:   current.Version.Timestamp,
+	})
+}
+
+func (s *Subscriber) run() {
+	defer close(s.done)
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.client.ctx.Done():
+			return
+		case event := <-s.queue:
+			s.dispatch(event)
+		}
+	}
+}
+
+// dispatch hands one event to its handlers in order
+func (s *Subscriber) dispatch(event types.StateEvent) {
+	s.handlerMux.RLock()
+	handlers := append([]EventHandler(nil), s.handlers[event.Type]...)
+	if len(s.topicHandlers) > 0 {
+		topic := types.EventTopic(event)
+		for _, th := range s.topicHandlers {
+			if types.MatchTopic(th.pattern, topic) {
+				handlers = append(handlers, th.handler)
+			}
+		}
+	}
+	handlers = append(handlers, s.handlers["*"]...)
+	s.handlerMux.RUnlock()
+
+	for _, handler := range handlers {
+		err := s.call(handler, event)
+		s.statsMux.Lock()
+		s.stats.Handled++
+		if err != nil {
+			s.stats.Errors++
+		}
+		s.statsMux.Unlock()
+		if err != nil {
+			log.Printf("[SUBSCRIBER] %s: handler error for %s: %v", s.name, event.Type, err)
+		}
+	}
+}
+
+// call runs a handler, turning a panic into an error
+func (s *Subscriber) call(handler EventHandler, event types.StateEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.statsMux.Lock()
+			s.stats.Panics++
+			s.statsMux.Unlock()
+			log.Printf("[SUBSCRIBER] %s: handler panicked on %s: %v\n%s", s.name, event.Type, r, debug.Stack())
+			err = fmt.Errorf("handler panicked: %v", r)
+		}
+	}()
+	return handler(event)
+}
@@ -0,0 +1,140 @@
+package ipc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func deliverEvent(client *SocketClient, eventType types.StateEventType, id string) {
+	client.handleStateEvent(IPCMessage{Type: "state_event", Data: types.StateEvent{ID: id, Type: eventType}})
+}
+
+func TestSubscriberDispatch(t *testing.T) {
+	client := NewSocketClient("", "panel-1", "test")
+	defer client.cancel()
+
+	sub := client.NewSubscriber("test", 0)
+	got := make(chan string, 16)
+	sub.Handle(types.EventSessionAdded, func(event types.StateEvent) error {
+		if event.ID == "boom" {
+			panic("handler bug")
+		}
+		got <- "typed:" + event.ID
+		return nil
+	})
+	sub.Handle("*", func(event types.StateEvent) error {
+		got <- "wildcard:" + event.ID
+		return nil
+	})
+	sub.Start()
+
+	deliverEvent(client, types.EventSessionAdded, "1")
+	deliverEvent(client, types.EventSessionAdded, "boom")
+	deliverEvent(client, types.EventThemeChanged, "2")
+
+	// The panic is recovered and the wildcard handler still sees the event
+	want := []string{"typed:1", "wildcard:1", "wildcard:boom", "wildcard:2"}
+	for i, w := range want {
+		select {
+		case g := <-got:
+			if g != w {
+				t.Fatalf("call %d = %q, want %q", i, g, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+
+	sub.Stop()
+	stats := sub.Stats()
+	if stats.Handled != 5 || stats.Panics != 1 || stats.Errors != 1 {
+		t.Errorf("stats = %+v, want 5 handled, 1 panic, 1 error", stats)
+	}
+
+	// A stopped subscriber is detached from the client
+	deliverEvent(client, types.EventSessionAdded, "3")
+	if depth := sub.Stats().QueueDepth; depth != 0 {
+		t.Errorf("queue depth after Stop = %d, want 0", depth)
+	}
+}
+
+func TestSubscriberDropsWhenFull(t *testing.T) {
+	client := NewSocketClient("", "panel-1", "test")
+	defer client.cancel()
+
+	sub := client.NewSubscriber("slow", 2)
+	sub.Handle(types.EventSessionAdded, func(types.StateEvent) error { return nil })
+	sub.Handle(types.EventThemeChanged, func(types.StateEvent) error { return nil })
+
+	// Not started, so nothing drains the queue; unhandled types are not queued
+	deliverEvent(client, types.EventMessageAdded, "ignored")
+	for _, id := range []string{"1", "2", "3", "4"} {
+		deliverEvent(client, types.EventSessionAdded, id)
+	}
+
+	stats := sub.Stats()
+	if stats.QueueDepth != 2 || stats.Dropped != 2 {
+		t.Errorf("stats = %+v, want queue depth 2 and 2 dropped", stats)
+	}
+
+	// The client's read loop is never blocked by a subscriber, and Stop on a
+	// subscriber that never started returns at once
+	done := make(chan struct{})
+	go func() {
+		sub.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked on an unstarted subscriber")
+	}
+}
+
+func TestSubscriberTopicHandlers(t *testing.T) {
+	client := NewSocketClient("", "panel-1", "test")
+	defer client.cancel()
+
+	sub := client.NewSubscriber("test", 0)
+	got := make(chan string, 16)
+	if err := sub.HandleTopic("message.msg_1.*", func(event types.StateEvent) error {
+		got <- "topic:" + event.ID
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := sub.HandleTopic("message.msg*", nil); err == nil {
+		t.Error("HandleTopic accepted a partial wildcard")
+	}
+	sub.Handle(types.EventMessageUpdated, func(event types.StateEvent) error {
+		got <- "typed:" + event.ID
+		return nil
+	})
+	sub.Start()
+	defer sub.Stop()
+
+	publish := func(id string, eventType types.StateEventType, messageID string) {
+		client.handleStateEvent(IPCMessage{Type: "state_event", Data: types.StateEvent{
+			ID:   id,
+			Type: eventType,
+			Data: map[string]interface{}{"message_id": messageID},
+		}})
+	}
+	publish("1", types.EventMessageDeleted, "msg_2") // No handler wants it
+	publish("2", types.EventMessageDeleted, "msg_1")
+	publish("3", types.EventMessageUpdated, "msg_1")
+
+	want := []string{"topic:2", "typed:3", "topic:3"}
+	for i, w := range want {
+		select {
+		case g := <-got:
+			if g != w {
+				t.Fatalf("call %d = %q, want %q", i, g, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %q", w)
+		}
+	}
+}
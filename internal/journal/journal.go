@@ -0,0 +1,450 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrUnavailable is returned when no retained segment can reconstruct a version
+var ErrUnavailable = errors.New("state history not available")
+
+// Entry records one applied update with the payload needed to replay it. The
+// updates of a batch share one version and are recorded as one entry of type
+// state_batched whose payload lists their entries; see Members.
+type Entry struct {
+	Version     int64           `json:"version"` // State version after the update
+	Timestamp   time.Time       `json:"timestamp"`
+	UpdateID    string          `json:"update_id"`
+	Type        string          `json:"type"`
+	SourcePanel string          `json:"source_panel"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Members returns the updates an entry records: those of a batch, in the
+// order applied, or else the entry itself
+func (e Entry) Members() ([]Entry, error) {
+	if e.Type != string(types.StateBatched) {
+		return []Entry{e}, nil
+	}
+	var members []Entry
+	if err := json.Unmarshal(e.Payload, &members); err != nil {
+		return nil, fmt.Errorf("invalid batch entry for version %d: %w", e.Version, err)
+	}
+	return members, nil
+}
+
+// Config controls where the journal is written and how much history it keeps
+type Config struct {
+	Dir         string      `json:"dir"`
+	SegmentSize int64       `json:"segment_size"` // Start a new segment past this many bytes
+	MaxSegments int         `json:"max_segments"` // Segments kept; older history is dropped
+	FileMode    os.FileMode `json:"file_mode"`
+	DirMode     os.FileMode `json:"dir_mode"`
+}
+
+// DefaultConfig returns a configuration that keeps about 64MB of history
+func DefaultConfig(dir string) Config {
+	return Config{
+		Dir:         dir,
+		SegmentSize: 4 * 1024 * 1024,
+		MaxSegments: 16,
+		FileMode:    0600,
+		DirMode:     0700,
+	}
+}
+
+// Journal is a segmented log of applied updates. Every segment starts with a
+// checkpoint of the full state, so any retained version can be rebuilt by
+// loading one checkpoint and replaying the entries that follow it.
+//
+// Layout: <dir>/<seq>.jsonl holds entries, <dir>/<seq>.checkpoint.json the
+// state at the segment's start.
+type Journal struct {
+	config      Config
+	mutex       sync.Mutex
+	file        *os.File
+	size        int64
+	seq         int
+	lastVersion int64
+}
+
+// Open opens the journal in config.Dir, continuing its newest segment
+func Open(config Config) (*Journal, error) {
+	if err := os.MkdirAll(config.Dir, config.DirMode); err != nil {
+		return nil, fmt.Errorf("failed to create journal directory: %w", err)
+	}
+
+	j := &Journal{config: config}
+	segments, err := j.segments()
+	if err != nil {
+		return nil, err
+	}
+	if len(segments) == 0 {
+		return j, nil
+	}
+
+	// Continue the newest segment; Record starts a new one if versions don't follow on
+	j.seq = segments[len(segments)-1]
+	checkpoint, err := j.readCheckpoint(j.seq)
+	if err != nil {
+		return j, nil
+	}
+	j.lastVersion = checkpoint.Version.Version
+	entries, err := j.readEntries(j.seq)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 {
+		j.lastVersion = entries[len(entries)-1].Version
+	}
+
+	file, err := os.OpenFile(j.entriesPath(j.seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, config.FileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal segment: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to stat journal segment: %w", err)
+	}
+	j.file = file
+	j.size = info.Size()
+	return j, nil
+}
+
+// Record appends an entry. state is the state after the update; it is only
+// serialized when a new segment needs a checkpoint, so callers pass the live
+// state and must hold whatever lock protects it.
+func (j *Journal) Record(entry Entry, state *types.SharedApplicationState) error {
+	data, err := json.Marshal(timefmt.UTC(entry))
+	if err != nil {
+		return fmt.Errorf("failed to encode journal entry: %w", err)
+	}
+	data = append(data, '\n')
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	// A gap (reset, or updates applied while the journal was closed) makes
+	// replay across it impossible, so history restarts from a checkpoint
+	if j.file == nil || entry.Version != j.lastVersion+1 || j.size+int64(len(data)) > j.config.SegmentSize {
+		if err := j.startSegmentLocked(state); err != nil {
+			return err
+		}
+	}
+
+	n, err := j.file.Write(data)
+	j.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write journal entry: %w", err)
+	}
+	j.lastVersion = entry.Version
+	return nil
+}
+
+// startSegmentLocked checkpoints state and opens the next segment
+func (j *Journal) startSegmentLocked(state *types.SharedApplicationState) error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	seq := j.seq + 1
+	checkpoint, err := json.Marshal(timefmt.UTC(state))
+	if err != nil {
+		return fmt.Errorf("failed to encode journal checkpoint: %w", err)
+	}
+	if err := j.writeFile(j.checkpointPath(seq), checkpoint); err != nil {
+		return fmt.Errorf("failed to write journal checkpoint: %w", err)
+	}
+
+	file, err := os.OpenFile(j.entriesPath(seq), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, j.config.FileMode)
+	if err != nil {
+		return fmt.Errorf("failed to create journal segment: %w", err)
+	}
+	j.file = file
+	j.size = 0
+	j.seq = seq
+	j.lastVersion = state.Version.Version
+
+	j.pruneLocked()
+	return nil
+}
+
+// pruneLocked removes the oldest segments beyond MaxSegments
+func (j *Journal) pruneLocked() {
+	if j.config.MaxSegments <= 0 {
+		return
+	}
+	segments, err := j.segments()
+	if err != nil {
+		return
+	}
+	for len(segments) > j.config.MaxSegments {
+		os.Remove(j.entriesPath(segments[0]))
+		os.Remove(j.checkpointPath(segments[0]))
+		segments = segments[1:]
+	}
+}
+
+// Load returns the checkpoint and the entries to replay on it to reach version
+func (j *Journal) Load(version int64) (*types.SharedApplicationState, []Entry, error) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Newest first: after a reset, versions repeat and the recent history wins
+	for i := len(segments) - 1; i >= 0; i-- {
+		checkpoint, err := j.readCheckpoint(segments[i])
+		if err != nil || checkpoint.Version.Version > version {
+			continue
+		}
+		entries, err := j.readEntries(segments[i])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		next := checkpoint.Version.Version + 1
+		replay := make([]Entry, 0)
+		for _, entry := range entries {
+			if entry.Version < next {
+				continue // The entry that opened the segment is in the checkpoint
+			}
+			if entry.Version != next || next > version {
+				break
+			}
+			replay = append(replay, entry)
+			next++
+		}
+		if next-1 == version {
+			return checkpoint, replay, nil
+		}
+	}
+
+	return nil, nil, fmt.Errorf("%w: version %d", ErrUnavailable, version)
+}
+
+// Oldest returns the oldest version that can be reconstructed, or 0 when empty
+func (j *Journal) Oldest() int64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return 0
+	}
+	for _, seq := range segments {
+		if checkpoint, err := j.readCheckpoint(seq); err == nil {
+			return checkpoint.Version.Version
+		}
+	}
+	return 0
+}
+
+// Newest returns the newest version recorded, or 0 when empty
+func (j *Journal) Newest() int64 {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.lastVersion
+}
+
+// Walk calls the given functions for every retained checkpoint and entry, oldest first
+func (j *Journal) Walk(entryFn func(Entry), checkpointFn func(*types.SharedApplicationState)) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+	for _, seq := range segments {
+		if checkpoint, err := j.readCheckpoint(seq); err == nil {
+			checkpointFn(checkpoint)
+		}
+		entries, err := j.readEntries(seq)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			entryFn(entry)
+		}
+	}
+	return nil
+}
+
+// Rewrite passes every entry and checkpoint through the given functions and
+// rewrites the files where they report a change. It exists so redactions reach
+// history too; it is slow and meant for rare, deliberate edits.
+func (j *Journal) Rewrite(entryFn func(*Entry) bool, checkpointFn func(*types.SharedApplicationState) bool) error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	segments, err := j.segments()
+	if err != nil {
+		return err
+	}
+
+	for _, seq := range segments {
+		if checkpoint, err := j.readCheckpoint(seq); err == nil && checkpointFn(checkpoint) {
+			data, err := json.Marshal(checkpoint)
+			if err != nil {
+				return fmt.Errorf("failed to encode journal checkpoint: %w", err)
+			}
+			if err := j.writeFile(j.checkpointPath(seq), data); err != nil {
+				return fmt.Errorf("failed to rewrite journal checkpoint: %w", err)
+			}
+		}
+
+		entries, err := j.readEntries(seq)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for i := range entries {
+			if entryFn(&entries[i]) {
+				changed = true
+			}
+		}
+		if !changed {
+			continue
+		}
+
+		var buf bytes.Buffer
+		for _, entry := range entries {
+			data, err := json.Marshal(entry)
+			if err != nil {
+				return fmt.Errorf("failed to encode journal entry: %w", err)
+			}
+			buf.Write(data)
+			buf.WriteByte('\n')
+		}
+		if err := j.writeFile(j.entriesPath(seq), buf.Bytes()); err != nil {
+			return fmt.Errorf("failed to rewrite journal segment: %w", err)
+		}
+
+		// The active file handle points at the replaced inode; reopen it
+		if seq == j.seq && j.file != nil {
+			j.file.Close()
+			file, err := os.OpenFile(j.entriesPath(seq), os.O_WRONLY|os.O_APPEND, j.config.FileMode)
+			if err != nil {
+				j.file = nil
+				return fmt.Errorf("failed to reopen journal segment: %w", err)
+			}
+			j.file = file
+			j.size = int64(buf.Len())
+		}
+	}
+	return nil
+}
+
+// Close closes the active segment
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.file == nil {
+		return nil
+	}
+	err := j.file.Close()
+	j.file = nil
+	return err
+}
+
+// segments returns the sequence numbers of the segments on disk, oldest first
+func (j *Journal) segments() ([]int, error) {
+	names, err := filepath.Glob(filepath.Join(j.config.Dir, "*.checkpoint.json"))
+	if err != nil {
+		return nil, err
+	}
+	segments := make([]int, 0, len(names))
+	for _, name := range names {
+		seq, err := strconv.Atoi(strings.TrimSuffix(filepath.Base(name), ".checkpoint.json"))
+		if err == nil {
+			segments = append(segments, seq)
+		}
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (j *Journal) readCheckpoint(seq int) (*types.SharedApplicationState, error) {
+	data, err := os.ReadFile(j.checkpointPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	var state types.SharedApplicationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("corrupt journal checkpoint %d: %w", seq, err)
+	}
+	return &state, nil
+}
+
+// readEntries returns a segment's entries; a line torn by a crash mid-write is skipped
+func (j *Journal) readEntries(seq int) ([]Entry, error) {
+	file, err := os.Open(j.entriesPath(seq))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open journal segment %d: %w", seq, err)
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// writeFile replaces path atomically
+func (j *Journal) writeFile(path string, data []byte) error {
+	temp, err := os.CreateTemp(j.config.Dir, ".journal_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), j.config.FileMode); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), path)
+}
+
+func (j *Journal) entriesPath(seq int) string {
+	return filepath.Join(j.config.Dir, fmt.Sprintf("%08d.jsonl", seq))
+}
+
+func (j *Journal) checkpointPath(seq int) string {
+	return filepath.Join(j.config.Dir, fmt.Sprintf("%08d.checkpoint.json", seq))
+}
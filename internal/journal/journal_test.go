@@ -0,0 +1,72 @@
+package journal
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func record(t *testing.T, j *Journal, state *types.SharedApplicationState) {
+	t.Helper()
+	state.Version.Version++
+	entry := Entry{Version: state.Version.Version, Type: "theme_changed", Payload: []byte(`{"theme":"dark"}`)}
+	if err := j.Record(entry, state); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+}
+
+func TestJournalSegments(t *testing.T) {
+	config := DefaultConfig(filepath.Join(t.TempDir(), "journal"))
+	config.SegmentSize = 300
+	config.MaxSegments = 3
+
+	j, err := Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	state := types.NewSharedApplicationState()
+	for i := 0; i < 4; i++ {
+		record(t, j, state)
+	}
+	j.Close()
+
+	// Reopening continues the segment, so versions before the restart stay replayable
+	j, err = Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer j.Close()
+	record(t, j, state)
+
+	checkpoint, entries, err := j.Load(state.Version.Version)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := checkpoint.Version.Version + int64(len(entries)); got != state.Version.Version {
+		t.Errorf("Load() reaches version %d, want %d", got, state.Version.Version)
+	}
+
+	// A version gap (e.g. a reset) cannot be replayed across and starts a new segment
+	state.Version.Version += 10
+	record(t, j, state)
+	if _, _, err := j.Load(state.Version.Version - 5); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Load() inside a gap error = %v, want ErrUnavailable", err)
+	}
+
+	// Old segments are pruned, taking their versions with them
+	for i := 0; i < 20; i++ {
+		record(t, j, state)
+	}
+	segments, _ := j.segments()
+	if len(segments) != config.MaxSegments {
+		t.Errorf("kept %d segments, want %d", len(segments), config.MaxSegments)
+	}
+	if _, _, err := j.Load(2); !errors.Is(err, ErrUnavailable) {
+		t.Errorf("Load() of a pruned version error = %v, want ErrUnavailable", err)
+	}
+	if oldest := j.Oldest(); oldest <= 2 {
+		t.Errorf("Oldest() = %d after pruning", oldest)
+	}
+}
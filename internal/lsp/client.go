@@ -0,0 +1,361 @@
+// Package lsp is a small language server protocol client. It asks a language
+// server about one position in a file (hover text, definitions and the
+// file's diagnostics) to give prompts code context.
+package lsp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf16"
+)
+
+// Protocol types, only the fields used here
+
+type position struct {
+	Line      int `json:"line"`
+	Character int `json:"character"` // UTF-16 code units
+}
+
+type lspRange struct {
+	Start position `json:"start"`
+	End   position `json:"end"`
+}
+
+type location struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+// locationOrLink decodes both Location and LocationLink results
+type locationOrLink struct {
+	URI                  string    `json:"uri"`
+	Range                *lspRange `json:"range"`
+	TargetURI            string    `json:"targetUri"`
+	TargetSelectionRange *lspRange `json:"targetSelectionRange"`
+}
+
+type diagnostic struct {
+	Range    lspRange `json:"range"`
+	Severity int      `json:"severity"`
+	Source   string   `json:"source"`
+	Message  string   `json:"message"`
+}
+
+type textDocumentPosition struct {
+	TextDocument struct {
+		URI string `json:"uri"`
+	} `json:"textDocument"`
+	Position position `json:"position"`
+}
+
+// Client talks to one language server
+type Client struct {
+	conn    *conn
+	cmd     *exec.Cmd // nil when the connection was not started by the client
+	rootURI string
+
+	mu          sync.Mutex
+	versions    map[string]int          // Open documents by URI
+	diagnostics map[string][]diagnostic // Latest diagnostics by URI
+	published   map[string]chan struct{}
+}
+
+// Start runs a language server and initializes it for the workspace at rootDir
+func Start(ctx context.Context, command []string, rootDir string) (*Client, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("no language server command")
+	}
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Dir = rootDir
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("start %s: %w", command[0], err)
+	}
+
+	client := newClient(stdout, stdin, rootDir)
+	client.cmd = cmd
+	go cmd.Wait()
+	if err := client.initialize(ctx, rootDir); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return client, nil
+}
+
+func newClient(r io.Reader, w io.Writer, rootDir string) *Client {
+	client := &Client{
+		rootURI:     fileURI(rootDir),
+		versions:    make(map[string]int),
+		diagnostics: make(map[string][]diagnostic),
+		published:   make(map[string]chan struct{}),
+	}
+	client.conn = newConn(r, w)
+	client.conn.onNotify = client.handleNotification
+	client.conn.onRequest = client.handleRequest
+	return client
+}
+
+func (c *Client) initialize(ctx context.Context, rootDir string) error {
+	params := map[string]interface{}{
+		"processId": os.Getpid(),
+		"rootUri":   c.rootURI,
+		"workspaceFolders": []map[string]string{
+			{"uri": c.rootURI, "name": filepath.Base(rootDir)},
+		},
+		"capabilities": map[string]interface{}{
+			"textDocument": map[string]interface{}{
+				"hover":              map[string]interface{}{"contentFormat": []string{"plaintext", "markdown"}},
+				"definition":         map[string]interface{}{"linkSupport": true},
+				"publishDiagnostics": map[string]interface{}{},
+				"synchronization":    map[string]interface{}{"didSave": false},
+			},
+			"workspace": map[string]interface{}{"workspaceFolders": true, "configuration": true},
+		},
+	}
+	if err := c.conn.call(ctx, "initialize", params, nil); err != nil {
+		return fmt.Errorf("initialize language server: %w", err)
+	}
+	return c.conn.notify("initialized", map[string]interface{}{})
+}
+
+// Alive reports whether the server connection is still open
+func (c *Client) Alive() bool {
+	select {
+	case <-c.conn.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// Close shuts the server down, killing it if it does not exit in time
+func (c *Client) Close() error {
+	if c.Alive() {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		if c.conn.call(ctx, "shutdown", nil, nil) == nil {
+			c.conn.notify("exit", nil)
+		}
+		cancel()
+	}
+	if c.cmd != nil && c.cmd.Process != nil {
+		select {
+		case <-c.conn.done:
+		case <-time.After(time.Second):
+			c.cmd.Process.Kill()
+		}
+	}
+	return nil
+}
+
+// sync opens the file in the server, or sends its current content when it is
+// already open, and returns a channel closed when diagnostics for it arrive
+func (c *Client) sync(path, languageID, text string) (<-chan struct{}, error) {
+	uri := fileURI(path)
+	published := make(chan struct{})
+
+	c.mu.Lock()
+	version, open := c.versions[uri]
+	version++
+	c.versions[uri] = version
+	c.published[uri] = published
+	c.mu.Unlock()
+
+	if !open {
+		return published, c.conn.notify("textDocument/didOpen", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri, "languageId": languageID, "version": version, "text": text},
+		})
+	}
+	return published, c.conn.notify("textDocument/didChange", map[string]interface{}{
+		"textDocument":   map[string]interface{}{"uri": uri, "version": version},
+		"contentChanges": []map[string]string{{"text": text}},
+	})
+}
+
+func (c *Client) hover(ctx context.Context, path string, pos position) (string, error) {
+	var result struct {
+		Contents json.RawMessage `json:"contents"`
+	}
+	if err := c.conn.call(ctx, "textDocument/hover", positionParams(path, pos), &result); err != nil {
+		return "", err
+	}
+	return markupText(result.Contents), nil
+}
+
+func (c *Client) definition(ctx context.Context, path string, pos position) ([]location, error) {
+	var raw json.RawMessage
+	if err := c.conn.call(ctx, "textDocument/definition", positionParams(path, pos), &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	var results []locationOrLink
+	if raw[0] == '[' {
+		if err := json.Unmarshal(raw, &results); err != nil {
+			return nil, err
+		}
+	} else {
+		var single locationOrLink
+		if err := json.Unmarshal(raw, &single); err != nil {
+			return nil, err
+		}
+		results = append(results, single)
+	}
+
+	locations := make([]location, 0, len(results))
+	for _, result := range results {
+		switch {
+		case result.TargetURI != "" && result.TargetSelectionRange != nil:
+			locations = append(locations, location{URI: result.TargetURI, Range: *result.TargetSelectionRange})
+		case result.URI != "" && result.Range != nil:
+			locations = append(locations, location{URI: result.URI, Range: *result.Range})
+		}
+	}
+	return locations, nil
+}
+
+// fileDiagnostics returns the latest diagnostics published for a file
+func (c *Client) fileDiagnostics(path string) []diagnostic {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]diagnostic(nil), c.diagnostics[fileURI(path)]...)
+}
+
+func (c *Client) handleNotification(method string, params json.RawMessage) {
+	if method != "textDocument/publishDiagnostics" {
+		return
+	}
+	var published struct {
+		URI         string       `json:"uri"`
+		Diagnostics []diagnostic `json:"diagnostics"`
+	}
+	if json.Unmarshal(params, &published) != nil {
+		return
+	}
+	uri := normalizeURI(published.URI)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.diagnostics[uri] = published.Diagnostics
+	if ch, ok := c.published[uri]; ok {
+		close(ch)
+		delete(c.published, uri)
+	}
+}
+
+// handleRequest answers what servers commonly ask of clients
+func (c *Client) handleRequest(method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "workspace/configuration":
+		var request struct {
+			Items []json.RawMessage `json:"items"`
+		}
+		json.Unmarshal(params, &request)
+		return make([]interface{}, len(request.Items)), nil
+	case "workspace/workspaceFolders":
+		return []map[string]string{{"uri": c.rootURI, "name": "workspace"}}, nil
+	case "window/workDoneProgress/create", "client/registerCapability", "client/unregisterCapability":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("method %s not supported", method)
+}
+
+func positionParams(path string, pos position) textDocumentPosition {
+	var params textDocumentPosition
+	params.TextDocument.URI = fileURI(path)
+	params.Position = pos
+	return params
+}
+
+// markupText flattens hover contents: MarkupContent, a MarkedString or a list
+// of MarkedStrings
+func markupText(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return ""
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var markup struct {
+		Value string `json:"value"`
+	}
+	if raw[0] == '{' && json.Unmarshal(raw, &markup) == nil {
+		return markup.Value
+	}
+	var list []json.RawMessage
+	if json.Unmarshal(raw, &list) == nil {
+		parts := make([]string, 0, len(list))
+		for _, item := range list {
+			if part := markupText(item); part != "" {
+				parts = append(parts, part)
+			}
+		}
+		return strings.Join(parts, "\n\n")
+	}
+	return ""
+}
+
+func fileURI(path string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(path)}).String()
+}
+
+// uriPath returns the file path of a file URI
+func uriPath(uri string) (string, bool) {
+	parsed, err := url.Parse(uri)
+	if err != nil || parsed.Scheme != "file" {
+		return "", false
+	}
+	return filepath.FromSlash(parsed.Path), true
+}
+
+// normalizeURI re-encodes a file URI the way fileURI does, since servers may
+// escape characters differently
+func normalizeURI(uri string) string {
+	if path, ok := uriPath(uri); ok {
+		return fileURI(path)
+	}
+	return uri
+}
+
+// utf16Column converts a 0-based character column to UTF-16 code units
+func utf16Column(line string, column int) int {
+	units := 0
+	for i, r := range []rune(line) {
+		if i >= column {
+			break
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return units
+}
+
+// runeColumn converts a 0-based UTF-16 column back to characters
+func runeColumn(line string, units int) int {
+	column := 0
+	for _, r := range line {
+		if units <= 0 {
+			break
+		}
+		units -= len(utf16.Encode([]rune{r}))
+		column++
+	}
+	return column
+}
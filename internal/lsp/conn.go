@@ -0,0 +1,219 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// message is a JSON-RPC 2.0 request, notification or response
+type message struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+	Result  json.RawMessage  `json:"result,omitempty"`
+	Error   *rpcError        `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("lsp error %d: %s", e.Code, e.Message)
+}
+
+// conn is a JSON-RPC connection framed with Content-Length headers, as the
+// language server protocol uses over stdio
+type conn struct {
+	w       io.Writer
+	writeMu sync.Mutex
+
+	mu      sync.Mutex
+	nextID  int64
+	pending map[int64]chan *message
+	err     error // Set once the read loop ends
+
+	// Called from the read loop; onRequest answers requests from the server
+	onNotify  func(method string, params json.RawMessage)
+	onRequest func(method string, params json.RawMessage) (interface{}, error)
+
+	done chan struct{}
+}
+
+func newConn(r io.Reader, w io.Writer) *conn {
+	c := &conn{
+		w:       w,
+		pending: make(map[int64]chan *message),
+		done:    make(chan struct{}),
+	}
+	go c.readLoop(bufio.NewReader(r))
+	return c
+}
+
+// call sends a request and decodes its result into result, which may be nil
+func (c *conn) call(ctx context.Context, method string, params, result interface{}) error {
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return c.err
+	}
+	c.nextID++
+	id := c.nextID
+	reply := make(chan *message, 1)
+	c.pending[id] = reply
+	c.mu.Unlock()
+
+	defer func() {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+	}()
+
+	if err := c.write(map[string]interface{}{"jsonrpc": "2.0", "id": id, "method": method, "params": params}); err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		// Tell the server it can stop working on the request
+		c.notify("$/cancelRequest", map[string]interface{}{"id": id})
+		return ctx.Err()
+	case msg := <-reply:
+		if msg == nil {
+			return c.closedErr()
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result == nil || len(msg.Result) == 0 || string(msg.Result) == "null" {
+			return nil
+		}
+		if err := json.Unmarshal(msg.Result, result); err != nil {
+			return fmt.Errorf("decode %s result: %w", method, err)
+		}
+		return nil
+	}
+}
+
+// notify sends a notification
+func (c *conn) notify(method string, params interface{}) error {
+	return c.write(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params})
+}
+
+func (c *conn) write(msg interface{}) error {
+	body, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if _, err := fmt.Fprintf(c.w, "Content-Length: %d\r\n\r\n", len(body)); err != nil {
+		return err
+	}
+	_, err = c.w.Write(body)
+	return err
+}
+
+func (c *conn) readLoop(r *bufio.Reader) {
+	var err error
+	for {
+		var body []byte
+		if body, err = readFrame(r); err != nil {
+			break
+		}
+		var msg message
+		if json.Unmarshal(body, &msg) != nil {
+			continue
+		}
+
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			c.answer(msg)
+		case msg.Method != "":
+			if c.onNotify != nil {
+				c.onNotify(msg.Method, msg.Params)
+			}
+		case msg.ID != nil:
+			id, convErr := strconv.ParseInt(string(*msg.ID), 10, 64)
+			if convErr != nil {
+				continue
+			}
+			c.mu.Lock()
+			reply := c.pending[id]
+			c.mu.Unlock()
+			if reply != nil {
+				reply <- &msg
+			}
+		}
+	}
+
+	c.mu.Lock()
+	c.err = fmt.Errorf("language server connection closed: %w", err)
+	for id, reply := range c.pending {
+		close(reply)
+		delete(c.pending, id)
+	}
+	c.mu.Unlock()
+	close(c.done)
+}
+
+// answer replies to a request from the server. Servers ask for configuration
+// and progress tokens; anything without a handler gets a null result.
+func (c *conn) answer(msg message) {
+	var result interface{}
+	var handlerErr error
+	if c.onRequest != nil {
+		result, handlerErr = c.onRequest(msg.Method, msg.Params)
+	}
+	reply := map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result}
+	if handlerErr != nil {
+		reply = map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "error": &rpcError{Code: -32601, Message: handlerErr.Error()}}
+	}
+	c.write(reply)
+}
+
+func (c *conn) closedErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+	return fmt.Errorf("language server connection closed")
+}
+
+// readFrame reads one Content-Length framed message body
+func readFrame(r *bufio.Reader) ([]byte, error) {
+	length := -1
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if ok && strings.EqualFold(strings.TrimSpace(name), "Content-Length") {
+			if length, err = strconv.Atoi(strings.TrimSpace(value)); err != nil {
+				return nil, fmt.Errorf("invalid Content-Length %q", value)
+			}
+		}
+	}
+	if length < 0 {
+		return nil, fmt.Errorf("message without Content-Length")
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
@@ -0,0 +1,222 @@
+package lsp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// MaxDiagnostics caps the diagnostics kept for a file, nearest to the location first
+const MaxDiagnostics = 20
+
+// MaxDefinitions caps the definitions kept for a location
+const MaxDefinitions = 5
+
+// diagnosticsWait is how long to wait for a server to publish diagnostics
+// after a file is opened or changed
+const diagnosticsWait = 2 * time.Second
+
+// languageIDs maps file extensions to LSP language identifiers
+var languageIDs = map[string]string{
+	".go":   "go",
+	".ts":   "typescript",
+	".tsx":  "typescriptreact",
+	".js":   "javascript",
+	".jsx":  "javascriptreact",
+	".py":   "python",
+	".rs":   "rust",
+	".c":    "c",
+	".h":    "c",
+	".cpp":  "cpp",
+	".java": "java",
+	".rb":   "ruby",
+}
+
+var severities = map[int]string{1: "error", 2: "warning", 3: "info", 4: "hint"}
+
+// Enricher gathers prompt context, starting a language server per configured
+// file extension the first time one is needed
+type Enricher struct {
+	rootDir string
+	servers map[string][]string // File extension to server command
+	timeout time.Duration
+
+	mu      sync.Mutex
+	clients map[string]*Client // By server command
+}
+
+// NewEnricher returns an enricher for the workspace at rootDir
+func NewEnricher(rootDir string, servers map[string][]string, timeout time.Duration) *Enricher {
+	return &Enricher{
+		rootDir: rootDir,
+		servers: servers,
+		timeout: timeout,
+		clients: make(map[string]*Client),
+	}
+}
+
+// Enrich asks the language server for the file's extension about a location
+func (e *Enricher) Enrich(ctx context.Context, loc types.CodeLocation) (*types.PromptContext, error) {
+	ext := strings.ToLower(filepath.Ext(loc.Path))
+	command, ok := e.servers[ext]
+	if !ok {
+		return nil, fmt.Errorf("no language server configured for %q files", ext)
+	}
+	content, err := os.ReadFile(loc.Path)
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(content), "\n")
+	if loc.Line < 1 || loc.Line > len(lines) {
+		return nil, fmt.Errorf("%s has no line %d", loc.Path, loc.Line)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	defer cancel()
+	client, err := e.client(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+
+	languageID := languageIDs[ext]
+	if languageID == "" {
+		languageID = strings.TrimPrefix(ext, ".")
+	}
+	published, err := client.sync(loc.Path, languageID, string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	pos := position{Line: loc.Line - 1, Character: utf16Column(strings.TrimSuffix(lines[loc.Line-1], "\r"), loc.Column-1)}
+	result := &types.PromptContext{Location: loc, UpdatedAt: time.Now()}
+
+	// A server without hover or definition support still has diagnostics to give
+	hover, hoverErr := client.hover(ctx, loc.Path, pos)
+	result.Hover = strings.TrimSpace(hover)
+	definitions, defErr := client.definition(ctx, loc.Path, pos)
+	for _, def := range definitions {
+		if len(result.Definitions) == MaxDefinitions {
+			break
+		}
+		if converted, ok := toDefinition(def, loc.Path, lines); ok {
+			result.Definitions = append(result.Definitions, converted)
+		}
+	}
+
+	wait, stop := context.WithTimeout(ctx, diagnosticsWait)
+	select {
+	case <-published:
+	case <-wait.Done():
+	}
+	stop()
+	result.Diagnostics = toDiagnostics(client.fileDiagnostics(loc.Path), loc, lines)
+
+	if hoverErr != nil && defErr != nil && len(result.Diagnostics) == 0 {
+		return nil, fmt.Errorf("hover: %v; definition: %v", hoverErr, defErr)
+	}
+	return result, nil
+}
+
+// Close shuts down every started server
+func (e *Enricher) Close() {
+	e.mu.Lock()
+	clients := e.clients
+	e.clients = make(map[string]*Client)
+	e.mu.Unlock()
+	for _, client := range clients {
+		client.Close()
+	}
+}
+
+// client returns the running server for a command, starting it if needed
+func (e *Enricher) client(ctx context.Context, command []string) (*Client, error) {
+	key := strings.Join(command, "\x00")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if client, ok := e.clients[key]; ok {
+		if client.Alive() {
+			return client, nil
+		}
+		delete(e.clients, key)
+	}
+	client, err := Start(ctx, command, e.rootDir)
+	if err != nil {
+		return nil, err
+	}
+	e.clients[key] = client
+	return client, nil
+}
+
+// toDefinition converts a definition location, reading the line it points
+// at for a snippet
+func toDefinition(def location, currentPath string, currentLines []string) (types.CodeDefinition, bool) {
+	path, ok := uriPath(def.URI)
+	if !ok {
+		return types.CodeDefinition{}, false
+	}
+	lines := currentLines
+	if path != currentPath {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			lines = nil
+		} else {
+			lines = strings.Split(string(content), "\n")
+		}
+	}
+
+	result := types.CodeDefinition{CodeLocation: types.CodeLocation{
+		Path:   path,
+		Line:   def.Range.Start.Line + 1,
+		Column: def.Range.Start.Character + 1,
+	}}
+	if def.Range.Start.Line < len(lines) {
+		line := strings.TrimSuffix(lines[def.Range.Start.Line], "\r")
+		result.Column = runeColumn(line, def.Range.Start.Character) + 1
+		result.Snippet = strings.TrimSpace(line)
+	}
+	return result, true
+}
+
+// toDiagnostics converts a file's diagnostics, keeping those nearest to the location
+func toDiagnostics(diagnostics []diagnostic, loc types.CodeLocation, lines []string) []types.CodeDiagnostic {
+	distance := func(d diagnostic) int {
+		delta := d.Range.Start.Line + 1 - loc.Line
+		if delta < 0 {
+			return -delta
+		}
+		return delta
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		return distance(diagnostics[i]) < distance(diagnostics[j])
+	})
+	if len(diagnostics) > MaxDiagnostics {
+		diagnostics = diagnostics[:MaxDiagnostics]
+	}
+
+	result := make([]types.CodeDiagnostic, 0, len(diagnostics))
+	for _, d := range diagnostics {
+		column := d.Range.Start.Character
+		if d.Range.Start.Line < len(lines) {
+			column = runeColumn(strings.TrimSuffix(lines[d.Range.Start.Line], "\r"), column)
+		}
+		severity := severities[d.Severity]
+		if severity == "" {
+			severity = "error"
+		}
+		result = append(result, types.CodeDiagnostic{
+			Line:     d.Range.Start.Line + 1,
+			Column:   column + 1,
+			Severity: severity,
+			Message:  d.Message,
+			Source:   d.Source,
+		})
+	}
+	return result
+}
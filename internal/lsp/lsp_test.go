@@ -0,0 +1,152 @@
+package lsp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// The test binary doubles as a fake language server when this is set
+const fakeServerEnv = "TMUXCODER_FAKE_LSP"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(fakeServerEnv) == "1" {
+		runFakeServer()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// runFakeServer answers over stdio: hover shows the word under the cursor,
+// definitions point at the first line of the file, and every opened file gets
+// one warning on its last line
+func runFakeServer() {
+	reader := bufio.NewReader(os.Stdin)
+	server := newConn(strings.NewReader(""), os.Stdout)
+	files := map[string]string{}
+	for {
+		body, err := readFrame(reader)
+		if err != nil {
+			return
+		}
+		var msg message
+		json.Unmarshal(body, &msg)
+
+		var params struct {
+			TextDocument struct {
+				URI  string `json:"uri"`
+				Text string `json:"text"`
+			} `json:"textDocument"`
+			Position       position `json:"position"`
+			ContentChanges []struct {
+				Text string `json:"text"`
+			} `json:"contentChanges"`
+		}
+		json.Unmarshal(msg.Params, &params)
+
+		var result interface{}
+		switch msg.Method {
+		case "initialize":
+			result = map[string]interface{}{"capabilities": map[string]interface{}{}}
+		case "textDocument/didOpen", "textDocument/didChange":
+			if len(params.ContentChanges) > 0 {
+				params.TextDocument.Text = params.ContentChanges[0].Text
+			}
+			files[params.TextDocument.URI] = params.TextDocument.Text
+			last := strings.Count(params.TextDocument.Text, "\n")
+			server.notify("textDocument/publishDiagnostics", map[string]interface{}{
+				"uri": params.TextDocument.URI,
+				"diagnostics": []diagnostic{
+					{Range: lspRange{Start: position{Line: last, Character: 0}}, Severity: 2, Source: "fake", Message: "last line"},
+				},
+			})
+		case "textDocument/hover":
+			line := strings.Split(files[params.TextDocument.URI], "\n")[params.Position.Line]
+			units := []rune(line)
+			result = map[string]interface{}{"contents": map[string]string{"kind": "plaintext", "value": "hover " + string(units[params.Position.Character:])}}
+		case "textDocument/definition":
+			result = []location{{URI: params.TextDocument.URI, Range: lspRange{Start: position{Line: 0, Character: 2}}}}
+		case "shutdown":
+			result = nil
+		case "exit":
+			return
+		}
+		if msg.ID != nil {
+			server.write(map[string]interface{}{"jsonrpc": "2.0", "id": msg.ID, "result": result})
+		}
+	}
+}
+
+func TestEnrich(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	if err := os.WriteFile(path, []byte("  first\nπ := value\nlast\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv(fakeServerEnv, "1")
+
+	enricher := NewEnricher(dir, map[string][]string{".go": {os.Args[0]}}, 5*time.Second)
+	defer enricher.Close()
+
+	loc := types.CodeLocation{Path: path, Line: 2, Column: 6}
+	got, err := enricher.Enrich(context.Background(), loc)
+	if err != nil {
+		t.Fatalf("Enrich() error = %v", err)
+	}
+	if got.Hover != "hover value" {
+		t.Errorf("Hover = %q, want %q", got.Hover, "hover value")
+	}
+	wantDef := types.CodeDefinition{CodeLocation: types.CodeLocation{Path: path, Line: 1, Column: 3}, Snippet: "first"}
+	if len(got.Definitions) != 1 || got.Definitions[0] != wantDef {
+		t.Errorf("Definitions = %+v, want %+v", got.Definitions, wantDef)
+	}
+	wantDiag := types.CodeDiagnostic{Line: 4, Column: 1, Severity: "warning", Message: "last line", Source: "fake"}
+	if len(got.Diagnostics) != 1 || got.Diagnostics[0] != wantDiag {
+		t.Errorf("Diagnostics = %+v, want %+v", got.Diagnostics, wantDiag)
+	}
+	if rendered := got.Render(); !strings.Contains(rendered, "main.go:1:3: first") || !strings.Contains(rendered, "4:1 warning: last line (fake)") {
+		t.Errorf("Render() = %q", rendered)
+	}
+
+	// The running server is reused
+	if _, err := enricher.Enrich(context.Background(), loc); err != nil {
+		t.Fatalf("second Enrich() error = %v", err)
+	}
+	if len(enricher.clients) != 1 {
+		t.Errorf("started %d servers, want 1", len(enricher.clients))
+	}
+
+	for _, bad := range []types.CodeLocation{
+		{Path: filepath.Join(dir, "notes.txt"), Line: 1, Column: 1},
+		{Path: path, Line: 99, Column: 1},
+	} {
+		if _, err := enricher.Enrich(context.Background(), bad); err == nil {
+			t.Errorf("Enrich(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestMarkupText(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{`"plain"`, "plain"},
+		{`{"kind":"markdown","value":"**bold**"}`, "**bold**"},
+		{`{"language":"go","value":"func f()"}`, "func f()"},
+		{`["a",{"language":"go","value":"b"}]`, "a\n\nb"},
+		{`null`, ""},
+	}
+	for _, tc := range tests {
+		if got := markupText(json.RawMessage(tc.raw)); got != tc.want {
+			t.Errorf("markupText(%s) = %q, want %q", tc.raw, got, tc.want)
+		}
+	}
+}
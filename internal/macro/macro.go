@@ -0,0 +1,200 @@
+package macro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrNotFound is returned when no macro has the requested name
+var ErrNotFound = errors.New("macro not found")
+
+// namePattern keeps macro names usable as file names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// recordable lists the user-originated update types a macro captures. Session
+// adds and deletes are left out: they mirror sessions created on the opencode
+// server and cannot be replayed through shared state alone.
+var recordable = map[types.UpdateType]bool{
+	types.PromptSubmitted:     true,
+	types.UIActionTriggered:   true,
+	types.SessionChanged:      true,
+	types.SessionUpdated:      true,
+	types.SessionOrderChanged: true,
+	types.SessionReordered:    true,
+	types.SessionPinned:       true,
+	types.ThemeChanged:        true,
+	types.ModelChanged:        true,
+	types.AgentChanged:        true,
+}
+
+// Recordable reports whether updates of this type are recorded into macros
+func Recordable(updateType types.UpdateType) bool {
+	return recordable[updateType]
+}
+
+// Step is one recorded update
+type Step struct {
+	Type    types.UpdateType `json:"type"`
+	Payload json.RawMessage  `json:"payload"`
+	Delay   time.Duration    `json:"delay"` // Time since the previous step, or since recording started
+}
+
+// Macro is a named sequence of recorded updates
+type Macro struct {
+	Name       string    `json:"name"`
+	RecordedAt time.Time `json:"recorded_at"`
+	// SessionID is the session that was current when recording started; replay
+	// against another session rewrites references to it
+	SessionID string `json:"session_id,omitempty"`
+	Steps     []Step `json:"steps"`
+}
+
+// Info summarizes a stored macro
+type Info struct {
+	Name       string        `json:"name"`
+	RecordedAt time.Time     `json:"recorded_at"`
+	SessionID  string        `json:"session_id,omitempty"`
+	Steps      int           `json:"steps"`
+	Duration   time.Duration `json:"duration"` // Sum of step delays
+}
+
+// Info returns the macro's summary
+func (m *Macro) Info() Info {
+	info := Info{Name: m.Name, RecordedAt: m.RecordedAt, SessionID: m.SessionID, Steps: len(m.Steps)}
+	for _, step := range m.Steps {
+		info.Duration += step.Delay
+	}
+	return info
+}
+
+// ValidateName checks that name can be used for a macro file
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid macro name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// DefaultDir returns where macros are kept, shared by every session
+func DefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("resolve home dir: %w", err)
+	}
+	return filepath.Join(homeDir, ".opencode", "macros"), nil
+}
+
+// Store keeps macros as one JSON file each in a directory
+type Store struct {
+	dir string
+}
+
+// NewStore returns a store for macros in dir; the directory is created on first save
+func NewStore(dir string) *Store {
+	return &Store{dir: dir}
+}
+
+func (s *Store) path(name string) string {
+	return filepath.Join(s.dir, name+".json")
+}
+
+// Save writes a macro, replacing one with the same name
+func (s *Store) Save(m *Macro) error {
+	if err := ValidateName(m.Name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode macro %s: %w", m.Name, err)
+	}
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return fmt.Errorf("failed to create macro directory: %w", err)
+	}
+
+	temp, err := os.CreateTemp(s.dir, ".macro_*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save macro %s: %w", m.Name, err)
+	}
+	defer os.Remove(temp.Name())
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to save macro %s: %w", m.Name, err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to save macro %s: %w", m.Name, err)
+	}
+	if err := os.Rename(temp.Name(), s.path(m.Name)); err != nil {
+		return fmt.Errorf("failed to save macro %s: %w", m.Name, err)
+	}
+	return nil
+}
+
+// Load reads the macro with the given name
+func (s *Store) Load(name string) (*Macro, error) {
+	if err := ValidateName(name); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(s.path(name))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read macro %s: %w", name, err)
+	}
+
+	var m Macro
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("failed to decode macro %s: %w", name, err)
+	}
+	m.Name = name
+	return &m, nil
+}
+
+// List summarizes every stored macro, sorted by name. Unreadable files are skipped.
+func (s *Store) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to list macros: %w", err)
+	}
+
+	var infos []Info
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if entry.IsDir() || !ok || ValidateName(name) != nil {
+			continue
+		}
+		m, err := s.Load(name)
+		if err != nil {
+			continue
+		}
+		infos = append(infos, m.Info())
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos, nil
+}
+
+// Delete removes the macro with the given name
+func (s *Store) Delete(name string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+	if err := os.Remove(s.path(name)); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("%w: %s", ErrNotFound, name)
+		}
+		return fmt.Errorf("failed to delete macro %s: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package macro
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestRecorderFiltersUpdates(t *testing.T) {
+	recorder := NewRecorder()
+	recorder.Record(types.StateUpdate{Type: types.PromptSubmitted, Payload: map[string]interface{}{"text": "before"}})
+	if err := recorder.Start("demo", "ses_1"); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	if err := recorder.Start("other", "ses_1"); err == nil {
+		t.Fatal("expected a second Start to fail")
+	}
+
+	updates := []struct {
+		update types.StateUpdate
+		want   bool
+	}{
+		{types.StateUpdate{Type: types.PromptSubmitted, SourcePanel: "input-panel", Payload: map[string]interface{}{"text": "hi"}}, true},
+		{types.StateUpdate{Type: types.ThemeChanged, SourcePanel: "sessions-panel", Payload: map[string]interface{}{"theme": "dark"}}, true},
+		{types.StateUpdate{Type: types.MessageAdded, SourcePanel: "messages-panel"}, false},
+		{types.StateUpdate{Type: types.PromptSubmitted, SourcePanel: ReplaySource}, false},
+		{types.StateUpdate{Type: types.SessionChanged, SourcePanel: "system"}, false},
+	}
+	wantSteps := 0
+	for _, tc := range updates {
+		recorder.Record(tc.update)
+		if tc.want {
+			wantSteps++
+		}
+	}
+
+	if _, steps, recording := recorder.Status(); !recording || steps != wantSteps {
+		t.Fatalf("Status = (%d steps, recording %v), want (%d, true)", steps, recording, wantSteps)
+	}
+	m, err := recorder.Stop()
+	if err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if m.Steps[0].Type != types.PromptSubmitted || m.Steps[1].Type != types.ThemeChanged {
+		t.Fatalf("unexpected steps: %+v", m.Steps)
+	}
+	if _, err := recorder.Stop(); err == nil {
+		t.Fatal("expected Stop without a recording to fail")
+	}
+}
+
+func TestReplayRebindsSession(t *testing.T) {
+	m := &Macro{
+		Name:      "demo",
+		SessionID: "ses_old",
+		Steps: []Step{
+			{Type: types.PromptSubmitted, Payload: []byte(`{"session_id":"ses_old","text":"hi"}`), Delay: time.Hour},
+			{Type: types.SessionUpdated, Payload: []byte(`{"session":{"id":"x","session_id":"ses_other"}}`)},
+		},
+	}
+
+	var applied []map[string]interface{}
+	n, err := Replay(context.Background(), m, ReplayOptions{SessionID: "ses_new"}, func(updateType types.UpdateType, payload map[string]interface{}) error {
+		applied = append(applied, payload)
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("Replay = (%d, %v), want (2, nil)", n, err)
+	}
+	if got := applied[0]["session_id"]; got != "ses_new" {
+		t.Errorf("recorded session not rebound: %v", got)
+	}
+	if got := applied[1]["session"].(map[string]interface{})["session_id"]; got != "ses_other" {
+		t.Errorf("unrelated session rewritten: %v", got)
+	}
+
+	failing := errors.New("boom")
+	n, err = Replay(context.Background(), m, ReplayOptions{}, func(types.UpdateType, map[string]interface{}) error {
+		return failing
+	})
+	if n != 0 || !errors.Is(err, failing) {
+		t.Fatalf("Replay with failing apply = (%d, %v)", n, err)
+	}
+}
+
+func TestStoreRoundTrip(t *testing.T) {
+	store := NewStore(t.TempDir())
+	if infos, err := store.List(); err != nil || len(infos) != 0 {
+		t.Fatalf("List on empty store = (%v, %v)", infos, err)
+	}
+
+	m := &Macro{Name: "demo", RecordedAt: time.Now(), Steps: []Step{{Type: types.PromptSubmitted, Payload: []byte(`{"text":"hi"}`), Delay: time.Second}}}
+	if err := store.Save(m); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	infos, err := store.List()
+	if err != nil || len(infos) != 1 || infos[0].Steps != 1 || infos[0].Duration != time.Second {
+		t.Fatalf("List = (%+v, %v)", infos, err)
+	}
+
+	if err := store.Save(&Macro{Name: "../escape"}); err == nil {
+		t.Fatal("expected an invalid name to be rejected")
+	}
+	if err := store.Delete("demo"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Load("demo"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load after delete = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,151 @@
+package macro
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ReplaySource is the source panel of updates applied by a replay. The
+// recorder ignores them, so replaying while recording does not nest macros.
+const ReplaySource = "macro"
+
+// Recorder captures recordable updates into the macro being recorded. At most
+// one recording runs at a time.
+type Recorder struct {
+	mutex  sync.Mutex
+	active *Macro
+	last   time.Time
+}
+
+// NewRecorder returns an idle recorder
+func NewRecorder() *Recorder {
+	return &Recorder{}
+}
+
+// Start begins recording a macro; sessionID is the session current now
+func (r *Recorder) Start(name, sessionID string) error {
+	if err := ValidateName(name); err != nil {
+		return err
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active != nil {
+		return fmt.Errorf("already recording macro %s", r.active.Name)
+	}
+	r.active = &Macro{Name: name, RecordedAt: time.Now(), SessionID: sessionID}
+	r.last = r.active.RecordedAt
+	return nil
+}
+
+// Record adds an applied update to the macro being recorded, if any
+func (r *Recorder) Record(update types.StateUpdate) {
+	if !Recordable(update.Type) || update.SourcePanel == ReplaySource || update.SourcePanel == "system" {
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active == nil {
+		return
+	}
+
+	payload, err := json.Marshal(update.Payload)
+	if err != nil {
+		log.Printf("Macro %s: skipping %s update %s: %v", r.active.Name, update.Type, update.ID, err)
+		return
+	}
+	now := time.Now()
+	r.active.Steps = append(r.active.Steps, Step{Type: update.Type, Payload: payload, Delay: now.Sub(r.last)})
+	r.last = now
+}
+
+// Stop ends the recording and returns the recorded macro
+func (r *Recorder) Stop() (*Macro, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active == nil {
+		return nil, fmt.Errorf("no macro is being recorded")
+	}
+	recorded := r.active
+	r.active = nil
+	return recorded, nil
+}
+
+// Status reports the macro being recorded and how many steps it has so far
+func (r *Recorder) Status() (name string, steps int, recording bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active == nil {
+		return "", 0, false
+	}
+	return r.active.Name, len(r.active.Steps), true
+}
+
+// ReplayOptions control how a macro is played back
+type ReplayOptions struct {
+	// SessionID replays against this session instead of the recorded one
+	SessionID string `json:"session_id,omitempty"`
+	// Speed scales the recorded delays between steps (2 plays twice as fast);
+	// 0 plays steps back to back
+	Speed float64 `json:"speed,omitempty"`
+}
+
+// ApplyFunc applies one replayed step
+type ApplyFunc func(updateType types.UpdateType, payload map[string]interface{}) error
+
+// Replay applies the macro's steps in order and returns how many were applied.
+// It stops at the first step that fails or when ctx is cancelled.
+func Replay(ctx context.Context, m *Macro, opts ReplayOptions, apply ApplyFunc) (int, error) {
+	for i, step := range m.Steps {
+		if opts.Speed > 0 && step.Delay > 0 {
+			timer := time.NewTimer(time.Duration(float64(step.Delay) / opts.Speed))
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return i, ctx.Err()
+			case <-timer.C:
+			}
+		} else if err := ctx.Err(); err != nil {
+			return i, err
+		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal(step.Payload, &payload); err != nil {
+			return i, fmt.Errorf("step %d (%s): invalid payload: %w", i+1, step.Type, err)
+		}
+		if opts.SessionID != "" {
+			rebindSession(payload, m.SessionID, opts.SessionID)
+		}
+		if err := apply(step.Type, payload); err != nil {
+			return i, fmt.Errorf("step %d (%s): %w", i+1, step.Type, err)
+		}
+	}
+	return len(m.Steps), nil
+}
+
+// rebindSession rewrites session_id fields naming the recorded session to the
+// target session, at any depth. Macros recorded with no current session have
+// every session reference rewritten.
+func rebindSession(value interface{}, from, to string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if id, ok := field.(string); ok && key == "session_id" && id != "" && (from == "" || id == from) {
+				v[key] = to
+				continue
+			}
+			rebindSession(field, from, to)
+		}
+	case []interface{}:
+		for _, item := range v {
+			rebindSession(item, from, to)
+		}
+	}
+}
@@ -0,0 +1,407 @@
+// Package mcp exposes session state to other AI tooling as a Model Context
+// Protocol server speaking JSON-RPC 2.0 over newline-delimited stdio.
+//
+// Tools: list_sessions, read_transcript and, in read-write mode, append_note.
+// Resources: tmuxcoder://sessions and tmuxcoder://sessions/{id}/transcript.
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ServerName and ServerVersion identify the server during initialization
+const (
+	ServerName    = "tmuxcoder"
+	ServerVersion = "1.0.0"
+)
+
+// supportedVersions lists the protocol revisions the server speaks, newest first
+var supportedVersions = []string{"2025-03-26", "2024-11-05"}
+
+// JSON-RPC error codes
+const (
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+	codeInternalError  = -32603
+)
+
+// resourcePrefix starts every resource URI
+const resourcePrefix = "tmuxcoder://sessions"
+
+// Backend supplies the session data the server exposes
+type Backend interface {
+	Sessions() ([]types.SessionInfo, error)
+	Transcript(sessionID string) (*state.SessionExport, error)
+	// AppendNote attaches a note to a message; an empty messageID means the
+	// session's latest message
+	AppendNote(sessionID, messageID, text string) error
+}
+
+// Server answers MCP requests from one client
+type Server struct {
+	backend   Backend
+	readWrite bool
+
+	writeMutex sync.Mutex
+}
+
+// NewServer returns a server; append_note is only offered when readWrite is set
+func NewServer(backend Backend, readWrite bool) *Server {
+	return &Server{backend: backend, readWrite: readWrite}
+}
+
+type request struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return e.Message
+}
+
+func invalidParams(format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+// Serve reads requests from r and writes responses to w until r is exhausted or ctx is cancelled
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		if resp := s.handleLine([]byte(line)); resp != nil {
+			if err := s.write(w, resp); err != nil {
+				return err
+			}
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *Server) write(w io.Writer, resp *response) error {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		return err
+	}
+	s.writeMutex.Lock()
+	defer s.writeMutex.Unlock()
+	_, err = w.Write(append(data, '\n'))
+	return err
+}
+
+// handleLine processes one message and returns the response, or nil for notifications
+func (s *Server) handleLine(line []byte) *response {
+	var req request
+	if err := json.Unmarshal(line, &req); err != nil {
+		return &response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: err.Error()}}
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return &response{JSONRPC: "2.0", ID: idOrNull(req.ID), Error: &rpcError{Code: codeInvalidRequest, Message: "not a JSON-RPC 2.0 request"}}
+	}
+
+	result, err := s.dispatch(req)
+	if len(req.ID) == 0 {
+		// Notifications get no response, even when they fail
+		return nil
+	}
+	resp := &response{JSONRPC: "2.0", ID: req.ID}
+	if err != nil {
+		rpcErr, ok := err.(*rpcError)
+		if !ok {
+			rpcErr = &rpcError{Code: codeInternalError, Message: err.Error()}
+		}
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+func idOrNull(id json.RawMessage) json.RawMessage {
+	if len(id) == 0 {
+		return json.RawMessage("null")
+	}
+	return id
+}
+
+func (s *Server) dispatch(req request) (interface{}, error) {
+	switch req.Method {
+	case "initialize":
+		return s.initialize(req.Params)
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+	case "ping":
+		return map[string]interface{}{}, nil
+	case "tools/list":
+		return map[string]interface{}{"tools": s.tools()}, nil
+	case "tools/call":
+		return s.callTool(req.Params)
+	case "resources/list":
+		return s.listResources()
+	case "resources/templates/list":
+		return map[string]interface{}{"resourceTemplates": []map[string]string{{
+			"uriTemplate": resourcePrefix + "/{session_id}/transcript",
+			"name":        "Session transcript",
+			"mimeType":    "text/markdown",
+		}}}, nil
+	case "resources/read":
+		return s.readResource(req.Params)
+	default:
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "method not found: " + req.Method}
+	}
+}
+
+func (s *Server) initialize(params json.RawMessage) (interface{}, error) {
+	var init struct {
+		ProtocolVersion string `json:"protocolVersion"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &init); err != nil {
+			return nil, invalidParams("invalid initialize params: %v", err)
+		}
+	}
+	version := supportedVersions[0]
+	for _, supported := range supportedVersions {
+		if init.ProtocolVersion == supported {
+			version = supported
+		}
+	}
+
+	instructions := "Read-only access to the user's TmuxCoder coding sessions."
+	if s.readWrite {
+		instructions = "Access to the user's TmuxCoder coding sessions; notes you append are visible to the user."
+	}
+	return map[string]interface{}{
+		"protocolVersion": version,
+		"capabilities": map[string]interface{}{
+			"tools":     map[string]interface{}{},
+			"resources": map[string]interface{}{},
+		},
+		"serverInfo":   map[string]string{"name": ServerName, "version": ServerVersion},
+		"instructions": instructions,
+	}, nil
+}
+
+type tool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	InputSchema map[string]interface{} `json:"inputSchema"`
+}
+
+func objectSchema(properties map[string]interface{}, required ...string) map[string]interface{} {
+	schema := map[string]interface{}{"type": "object", "properties": properties}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func (s *Server) tools() []tool {
+	tools := []tool{
+		{
+			Name:        "list_sessions",
+			Description: "List the coding sessions with their IDs, titles and message counts",
+			InputSchema: objectSchema(map[string]interface{}{}),
+		},
+		{
+			Name:        "read_transcript",
+			Description: "Read the messages and notes of a session, oldest first",
+			InputSchema: objectSchema(map[string]interface{}{
+				"session_id": map[string]interface{}{"type": "string"},
+				"limit":      map[string]interface{}{"type": "integer", "description": "Only the newest messages; 0 for all"},
+			}, "session_id"),
+		},
+	}
+	if s.readWrite {
+		tools = append(tools, tool{
+			Name:        "append_note",
+			Description: "Attach a note to a message of a session, by default its latest message",
+			InputSchema: objectSchema(map[string]interface{}{
+				"session_id": map[string]interface{}{"type": "string"},
+				"text":       map[string]interface{}{"type": "string"},
+				"message_id": map[string]interface{}{"type": "string"},
+			}, "session_id", "text"),
+		})
+	}
+	return tools
+}
+
+func (s *Server) callTool(params json.RawMessage) (interface{}, error) {
+	var call struct {
+		Name      string `json:"name"`
+		Arguments struct {
+			SessionID string `json:"session_id"`
+			MessageID string `json:"message_id"`
+			Text      string `json:"text"`
+			Limit     int    `json:"limit"`
+		} `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &call); err != nil {
+		return nil, invalidParams("invalid tool call: %v", err)
+	}
+	args := call.Arguments
+
+	var text string
+	var err error
+	switch call.Name {
+	case "list_sessions":
+		text, err = s.sessionsJSON()
+	case "read_transcript":
+		if args.SessionID == "" {
+			return nil, invalidParams("session_id is required")
+		}
+		var export *state.SessionExport
+		if export, err = s.backend.Transcript(args.SessionID); err == nil {
+			text = RenderTranscript(export, args.Limit)
+		}
+	case "append_note":
+		if !s.readWrite {
+			return nil, invalidParams("append_note is not available in read-only mode")
+		}
+		if args.SessionID == "" || strings.TrimSpace(args.Text) == "" {
+			return nil, invalidParams("session_id and text are required")
+		}
+		if err = s.backend.AppendNote(args.SessionID, args.MessageID, args.Text); err == nil {
+			text = "Note added"
+		}
+	default:
+		return nil, invalidParams("unknown tool %q", call.Name)
+	}
+
+	// Tool failures are results the model can read, not protocol errors
+	if err != nil {
+		return toolResult(err.Error(), true), nil
+	}
+	return toolResult(text, false), nil
+}
+
+func toolResult(text string, isError bool) map[string]interface{} {
+	return map[string]interface{}{
+		"content": []map[string]string{{"type": "text", "text": text}},
+		"isError": isError,
+	}
+}
+
+func (s *Server) sessionsJSON() (string, error) {
+	sessions, err := s.backend.Sessions()
+	if err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(sessions, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func (s *Server) listResources() (interface{}, error) {
+	sessions, err := s.backend.Sessions()
+	if err != nil {
+		return nil, err
+	}
+	resources := []map[string]string{{
+		"uri":      resourcePrefix,
+		"name":     "Sessions",
+		"mimeType": "application/json",
+	}}
+	for _, session := range sessions {
+		resources = append(resources, map[string]string{
+			"uri":      resourcePrefix + "/" + session.ID + "/transcript",
+			"name":     "Transcript: " + session.Title,
+			"mimeType": "text/markdown",
+		})
+	}
+	return map[string]interface{}{"resources": resources}, nil
+}
+
+func (s *Server) readResource(params json.RawMessage) (interface{}, error) {
+	var read struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &read); err != nil {
+		return nil, invalidParams("invalid read params: %v", err)
+	}
+
+	var text, mimeType string
+	if read.URI == resourcePrefix {
+		data, err := s.sessionsJSON()
+		if err != nil {
+			return nil, err
+		}
+		text, mimeType = data, "application/json"
+	} else {
+		rest, ok := strings.CutPrefix(read.URI, resourcePrefix+"/")
+		sessionID, isTranscript := strings.CutSuffix(rest, "/transcript")
+		if !ok || !isTranscript || sessionID == "" || strings.Contains(sessionID, "/") {
+			return nil, invalidParams("unknown resource %q", read.URI)
+		}
+		export, err := s.backend.Transcript(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		text, mimeType = RenderTranscript(export, 0), "text/markdown"
+	}
+	return map[string]interface{}{
+		"contents": []map[string]string{{"uri": read.URI, "mimeType": mimeType, "text": text}},
+	}, nil
+}
+
+// RenderTranscript formats a session export as markdown; limit keeps only the
+// newest messages when positive
+func RenderTranscript(export *state.SessionExport, limit int) string {
+	messages := export.Messages
+	if limit > 0 && len(messages) > limit {
+		messages = messages[len(messages)-limit:]
+	}
+	notes := make(map[string][]types.MessageAnnotation)
+	for _, annotation := range export.Annotations {
+		notes[annotation.MessageID] = append(notes[annotation.MessageID], annotation)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\nSession %s, %d messages\n", export.Session.Title, export.Session.ID, len(export.Messages))
+	for _, message := range messages {
+		fmt.Fprintf(&b, "\n## %s (%s)\n\n%s\n", message.Type, timefmt.DateTime(message.Timestamp), strings.TrimSpace(message.Content))
+		for _, annotation := range notes[message.ID] {
+			switch annotation.Kind {
+			case types.AnnotationRating:
+				fmt.Fprintf(&b, "\n> rating %+d by %s\n", annotation.Rating, annotation.Author)
+			default:
+				fmt.Fprintf(&b, "\n> %s by %s: %s\n", annotation.Kind, annotation.Author, annotation.Content)
+			}
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,121 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+type fakeBackend struct {
+	notes []string
+}
+
+func (b *fakeBackend) Sessions() ([]types.SessionInfo, error) {
+	return []types.SessionInfo{{ID: "ses_1", Title: "Refactor"}}, nil
+}
+
+func (b *fakeBackend) Transcript(sessionID string) (*state.SessionExport, error) {
+	if sessionID != "ses_1" {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+	return &state.SessionExport{
+		Session: types.SessionInfo{ID: "ses_1", Title: "Refactor"},
+		Messages: []types.MessageInfo{
+			{ID: "msg_1", Type: "user", Content: "split the parser"},
+			{ID: "msg_2", Type: "assistant", Content: "done"},
+		},
+		Annotations: []types.MessageAnnotation{{MessageID: "msg_2", Kind: types.AnnotationNote, Content: "check tests", Author: "me"}},
+	}, nil
+}
+
+func (b *fakeBackend) AppendNote(sessionID, messageID, text string) error {
+	b.notes = append(b.notes, sessionID+":"+text)
+	return nil
+}
+
+// exchange sends requests one per line and returns the decoded responses by ID
+func exchange(t *testing.T, server *Server, requests ...string) map[string]map[string]interface{} {
+	t.Helper()
+	var out bytes.Buffer
+	if err := server.Serve(context.Background(), strings.NewReader(strings.Join(requests, "\n")), &out); err != nil {
+		t.Fatalf("Serve failed: %v", err)
+	}
+	responses := make(map[string]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var resp map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &resp); err != nil {
+			t.Fatalf("bad response %q: %v", line, err)
+		}
+		responses[fmt.Sprint(resp["id"])] = resp
+	}
+	return responses
+}
+
+func toolText(t *testing.T, resp map[string]interface{}) (string, bool) {
+	t.Helper()
+	result, ok := resp["result"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("no result in %v", resp)
+	}
+	content := result["content"].([]interface{})[0].(map[string]interface{})
+	return content["text"].(string), result["isError"].(bool)
+}
+
+func TestServerReadOnly(t *testing.T) {
+	backend := &fakeBackend{}
+	responses := exchange(t, NewServer(backend, false),
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2024-11-05"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/list"}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"read_transcript","arguments":{"session_id":"ses_1","limit":1}}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"append_note","arguments":{"session_id":"ses_1","text":"x"}}}`,
+		`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"read_transcript","arguments":{"session_id":"nope"}}}`,
+		`{"jsonrpc":"2.0","id":6,"method":"resources/read","params":{"uri":"tmuxcoder://sessions"}}`,
+		`{"jsonrpc":"2.0","id":7,"method":"bogus"}`,
+		`not json`,
+	)
+
+	if len(responses) != 8 {
+		t.Fatalf("got %d responses, want 8 (the notification gets none)", len(responses))
+	}
+	if version := responses["1"]["result"].(map[string]interface{})["protocolVersion"]; version != "2024-11-05" {
+		t.Errorf("negotiated version %v", version)
+	}
+	if tools := responses["2"]["result"].(map[string]interface{})["tools"].([]interface{}); len(tools) != 2 {
+		t.Errorf("read-only server lists %d tools, want 2", len(tools))
+	}
+	if text, isError := toolText(t, responses["3"]); isError || strings.Contains(text, "split the parser") || !strings.Contains(text, "check tests") {
+		t.Errorf("limited transcript = %q", text)
+	}
+	if responses["4"]["error"] == nil || len(backend.notes) != 0 {
+		t.Errorf("append_note allowed in read-only mode: %v", responses["4"])
+	}
+	if _, isError := toolText(t, responses["5"]); !isError {
+		t.Errorf("unknown session not reported as a tool error")
+	}
+	if responses["6"]["result"] == nil {
+		t.Errorf("resources/read failed: %v", responses["6"])
+	}
+	if code := responses["7"]["error"].(map[string]interface{})["code"]; code != float64(codeMethodNotFound) {
+		t.Errorf("unknown method code %v", code)
+	}
+	if code := responses["<nil>"]["error"].(map[string]interface{})["code"]; code != float64(codeParseError) {
+		t.Errorf("parse error code %v", code)
+	}
+}
+
+func TestServerReadWrite(t *testing.T) {
+	backend := &fakeBackend{}
+	responses := exchange(t, NewServer(backend, true),
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"append_note","arguments":{"session_id":"ses_1","text":"revisit"}}}`,
+	)
+	if _, isError := toolText(t, responses["1"]); isError || len(backend.notes) != 1 || backend.notes[0] != "ses_1:revisit" {
+		t.Fatalf("append_note = %v, notes %v", responses["1"], backend.notes)
+	}
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// CounterMap counts occurrences by key. Adding to a key already seen takes no
+// lock, so it is safe to call from every goroutine on a hot path. The zero
+// value is empty and ready to use.
+type CounterMap[K comparable] struct {
+	counters sync.Map // K -> *atomic.Int64
+}
+
+// Add adds n to the count for key
+func (m *CounterMap[K]) Add(key K, n int64) {
+	if counter, ok := m.counters.Load(key); ok {
+		counter.(*atomic.Int64).Add(n)
+		return
+	}
+	counter, _ := m.counters.LoadOrStore(key, new(atomic.Int64))
+	counter.(*atomic.Int64).Add(n)
+}
+
+// Get returns the count for key
+func (m *CounterMap[K]) Get(key K) int64 {
+	if counter, ok := m.counters.Load(key); ok {
+		return counter.(*atomic.Int64).Load()
+	}
+	return 0
+}
+
+// Snapshot returns a copy of every count. Counts added while it runs may or
+// may not be included.
+func (m *CounterMap[K]) Snapshot() map[K]int64 {
+	snapshot := make(map[K]int64)
+	m.counters.Range(func(key, counter any) bool {
+		snapshot[key.(K)] = counter.(*atomic.Int64).Load()
+		return true
+	})
+	return snapshot
+}
+
+// Stamp holds a time that many goroutines set and read without locking. The
+// zero value holds the zero time.
+type Stamp struct {
+	nanos atomic.Int64
+}
+
+// Set records t
+func (s *Stamp) Set(t time.Time) {
+	s.nanos.Store(t.UnixNano())
+}
+
+// Load returns the recorded time, or the zero time if none was set
+func (s *Stamp) Load() time.Time {
+	nanos := s.nanos.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
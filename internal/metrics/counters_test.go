@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCounterMapConcurrent(t *testing.T) {
+	var counters CounterMap[string]
+	keys := []string{"a", "b", "c"}
+
+	const workers, perWorker = 8, 1000
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				counters.Add(keys[i%len(keys)], 1)
+				if i%100 == 0 {
+					counters.Snapshot()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := counters.Snapshot()
+	var total int64
+	for _, key := range keys {
+		total += snapshot[key]
+		if snapshot[key] != counters.Get(key) {
+			t.Errorf("Snapshot()[%s] = %d, Get() = %d", key, snapshot[key], counters.Get(key))
+		}
+	}
+	if total != workers*perWorker {
+		t.Errorf("total = %d, want %d", total, workers*perWorker)
+	}
+	if got := counters.Get("missing"); got != 0 {
+		t.Errorf("Get(missing) = %d, want 0", got)
+	}
+
+	// Snapshots are copies
+	snapshot["a"] = -1
+	if counters.Get("a") == -1 {
+		t.Errorf("Snapshot shares storage with the map")
+	}
+}
+
+func TestStamp(t *testing.T) {
+	var stamp Stamp
+	if !stamp.Load().IsZero() {
+		t.Errorf("zero Stamp = %v, want the zero time", stamp.Load())
+	}
+
+	at := time.Date(2025, 3, 1, 12, 0, 0, 42, time.UTC)
+	stamp.Set(at)
+	if got := stamp.Load(); !got.Equal(at) {
+		t.Errorf("Load() = %v, want %v", got, at)
+	}
+}
@@ -0,0 +1,132 @@
+// Package metrics records latency distributions in fixed memory so that tail
+// latencies can be reported alongside the mean.
+package metrics
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// Each power of two is split into 2^subBits buckets, as in HDR histograms,
+// which bounds the error of a reported percentile to 1/16 of its value
+const (
+	subBits    = 4
+	subBuckets = 1 << subBits
+	numBuckets = (64 - subBits) * subBuckets
+)
+
+// LatencySummary is a snapshot of a latency histogram
+type LatencySummary struct {
+	Count int64         `json:"count"`
+	Mean  time.Duration `json:"mean"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+	P50   time.Duration `json:"p50"`
+	P95   time.Duration `json:"p95"`
+	P99   time.Duration `json:"p99"`
+}
+
+// Histogram counts durations in log-linear buckets covering the whole
+// time.Duration range. The zero value is empty and ready to use. It is not
+// safe for concurrent use.
+type Histogram struct {
+	counts [numBuckets]int64
+	count  int64
+	sum    time.Duration
+	min    time.Duration
+	max    time.Duration
+}
+
+// bucketOf returns the bucket of a non-negative value in nanoseconds; values
+// below 2*subBuckets have a bucket each
+func bucketOf(v uint64) int {
+	if v < 2*subBuckets {
+		return int(v)
+	}
+	shift := bits.Len64(v) - (subBits + 1)
+	return (shift+1)*subBuckets + int(v>>shift) - subBuckets
+}
+
+// bucketHigh returns the largest value that falls in a bucket
+func bucketHigh(index int) uint64 {
+	if index < 2*subBuckets {
+		return uint64(index)
+	}
+	shift := index/subBuckets - 1
+	mantissa := uint64(index%subBuckets + subBuckets)
+	return (mantissa+1)<<shift - 1
+}
+
+// Record adds one duration; negative durations count as zero
+func (h *Histogram) Record(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	h.counts[bucketOf(uint64(d))]++
+	if h.count == 0 || d < h.min {
+		h.min = d
+	}
+	if d > h.max {
+		h.max = d
+	}
+	h.count++
+	h.sum += d
+}
+
+// Count returns the number of recorded durations
+func (h *Histogram) Count() int64 {
+	return h.count
+}
+
+// Mean returns the average recorded duration, 0 when empty
+func (h *Histogram) Mean() time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	return h.sum / time.Duration(h.count)
+}
+
+// Percentile returns the duration at or below which p percent of the
+// recorded durations fall, 0 when empty
+func (h *Histogram) Percentile(p float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+	if p <= 0 {
+		return h.min
+	}
+	if p >= 100 {
+		return h.max
+	}
+	rank := int64(math.Ceil(p / 100 * float64(h.count)))
+	var seen int64
+	for i, n := range h.counts {
+		seen += n
+		if seen >= rank {
+			// Report the bucket's top, but never past what was recorded
+			v := time.Duration(bucketHigh(i))
+			if v > h.max {
+				v = h.max
+			}
+			if v < h.min {
+				v = h.min
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+// Summary returns the count, mean, extremes and common percentiles
+func (h *Histogram) Summary() LatencySummary {
+	return LatencySummary{
+		Count: h.count,
+		Mean:  h.Mean(),
+		Min:   h.min,
+		Max:   h.max,
+		P50:   h.Percentile(50),
+		P95:   h.Percentile(95),
+		P99:   h.Percentile(99),
+	}
+}
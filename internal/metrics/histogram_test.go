@@ -0,0 +1,82 @@
+package metrics
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBuckets(t *testing.T) {
+	// Bucket indexes grow with the value, and each value is at most its bucket's top
+	prev := -1
+	for _, v := range []uint64{0, 1, 31, 32, 33, 63, 64, 1000, 1 << 20, 1<<40 + 12345, math.MaxInt64} {
+		index := bucketOf(v)
+		if index < prev || index >= numBuckets {
+			t.Fatalf("bucketOf(%d) = %d after %d", v, index, prev)
+		}
+		if high := bucketHigh(index); high < v || float64(high-v) > float64(v)/subBuckets {
+			t.Errorf("bucketHigh(bucketOf(%d)) = %d, outside the error bound", v, high)
+		}
+		prev = index
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	var h Histogram
+	if got := h.Summary(); got != (LatencySummary{}) {
+		t.Errorf("empty summary = %+v", got)
+	}
+
+	// 1ms to 100ms in 1ms steps
+	for i := 1; i <= 100; i++ {
+		h.Record(time.Duration(i) * time.Millisecond)
+	}
+	tests := []struct {
+		p    float64
+		want time.Duration
+	}{
+		{0, time.Millisecond},
+		{50, 50 * time.Millisecond},
+		{95, 95 * time.Millisecond},
+		{99, 99 * time.Millisecond},
+		{100, 100 * time.Millisecond},
+	}
+	for _, tc := range tests {
+		got := h.Percentile(tc.p)
+		if got < tc.want || float64(got-tc.want) > float64(tc.want)/subBuckets {
+			t.Errorf("Percentile(%v) = %v, want within 1/16 above %v", tc.p, got, tc.want)
+		}
+	}
+
+	summary := h.Summary()
+	if summary.Count != 100 || summary.Mean != 50500*time.Microsecond || summary.Min != time.Millisecond || summary.Max != 100*time.Millisecond {
+		t.Errorf("summary = %+v", summary)
+	}
+}
+
+func TestTailIsNotAveragedAway(t *testing.T) {
+	var h Histogram
+	for i := 0; i < 990; i++ {
+		h.Record(time.Millisecond)
+	}
+	for i := 0; i < 10; i++ {
+		h.Record(time.Second)
+	}
+	// Percentiles report the top of their bucket, within 1/16 of the value
+	near := func(got, want time.Duration) bool {
+		return got >= want && float64(got-want) <= float64(want)/subBuckets
+	}
+	if p50 := h.Percentile(50); !near(p50, time.Millisecond) {
+		t.Errorf("p50 = %v, want about 1ms", p50)
+	}
+	if p99 := h.Percentile(99); !near(p99, time.Millisecond) {
+		t.Errorf("p99 = %v, want about 1ms", p99)
+	}
+	if p999 := h.Percentile(99.9); p999 != time.Second {
+		t.Errorf("p99.9 = %v, want 1s", p999)
+	}
+	h.Record(-time.Second)
+	if h.Summary().Min != 0 {
+		t.Errorf("negative duration not counted as zero")
+	}
+}
@@ -0,0 +1,200 @@
+// Package modelpolicy retries prompts that fail with provider errors which may
+// pass, and falls back to other models when retries run out.
+package modelpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sst/opencode-sdk-go"
+	"github.com/sst/opencode-sdk-go/shared"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Error classes worth another attempt
+const (
+	ReasonRateLimit  = "rate_limit"
+	ReasonTimeout    = "timeout"
+	ReasonOverloaded = "overloaded"
+)
+
+// ProviderError is an error the server reported on the assistant reply rather
+// than on the request
+type ProviderError struct {
+	Name    string
+	Message string
+}
+
+func (e *ProviderError) Error() string {
+	if e.Message == "" {
+		return e.Name
+	}
+	return fmt.Sprintf("%s: %s", e.Name, e.Message)
+}
+
+// ResponseError returns the provider error carried by a prompt response, or nil
+func ResponseError(response *opencode.SessionPromptResponse) error {
+	if response == nil || response.Info.Error.Name == "" {
+		return nil
+	}
+	err := &ProviderError{Name: string(response.Info.Error.Name)}
+	switch data := response.Info.Error.Data.(type) {
+	case shared.UnknownErrorData:
+		err.Message = data.Message
+	case shared.ProviderAuthErrorData:
+		err.Message = data.Message
+	case map[string]interface{}:
+		if message, ok := data["message"].(string); ok {
+			err.Message = message
+		}
+	}
+	if err.Message == "" {
+		err.Message = response.Info.Error.JSON.Data.Raw()
+	}
+	return err
+}
+
+// Classify returns why a failed attempt may succeed when tried again, or ""
+// when it will not: bad requests, auth errors, cancellations
+func Classify(err error) string {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return ""
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ReasonTimeout
+	}
+	var apiErr *opencode.Error
+	if errors.As(err, &apiErr) && apiErr.Response != nil {
+		switch apiErr.StatusCode {
+		case http.StatusTooManyRequests:
+			return ReasonRateLimit
+		case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+			return ReasonTimeout
+		case http.StatusBadGateway, http.StatusServiceUnavailable, 529:
+			return ReasonOverloaded
+		}
+	}
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) && providerErr.Name == string(opencode.AssistantMessageErrorNameProviderAuthError) {
+		return ""
+	}
+
+	// Providers phrase these differently and opencode passes them on as text
+	text := strings.ToLower(err.Error())
+	switch {
+	case containsAny(text, "rate limit", "rate_limit", "ratelimit", "too many requests", "429"):
+		return ReasonRateLimit
+	case containsAny(text, "overloaded", "unavailable", "capacity", "529", "503"):
+		return ReasonOverloaded
+	case containsAny(text, "timeout", "timed out", "deadline exceeded"):
+		return ReasonTimeout
+	}
+	return ""
+}
+
+func containsAny(s string, substrings ...string) bool {
+	for _, sub := range substrings {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// Attempt runs the prompt once on a model
+type Attempt func(ctx context.Context, model types.ModelRef) error
+
+// Run tries the prompt on the primary model and then on each fallback,
+// retrying each MaxRetries times with a doubling backoff while the failures
+// may pass. record is called as each attempt ends, before any wait. It
+// returns the last error when every attempt failed.
+func Run(ctx context.Context, policy types.ModelPolicy, primary types.ModelRef, attempt Attempt, record func(types.RunAttempt)) error {
+	models := []types.ModelRef{primary}
+	for _, fallback := range policy.Fallbacks {
+		if fallback != primary {
+			models = append(models, fallback)
+		}
+	}
+
+	number := 0
+	for i, model := range models {
+		wait := policy.Backoff
+		for try := 0; ; try++ {
+			number++
+			result := types.RunAttempt{Number: number, Model: model, StartedAt: time.Now()}
+			err := attempt(ctx, model)
+			result.FinishedAt = time.Now()
+			if err == nil {
+				result.Outcome = types.AttemptSucceeded
+				record(result)
+				return nil
+			}
+
+			result.Error = err.Error()
+			result.Reason = Classify(err)
+			switch {
+			case result.Reason == "" || ctx.Err() != nil:
+				result.Outcome = types.AttemptFailed
+			case try < policy.MaxRetries:
+				result.Outcome = types.AttemptRetry
+			case i < len(models)-1:
+				result.Outcome = types.AttemptFallback
+				result.Next = &models[i+1]
+			default:
+				result.Outcome = types.AttemptFailed
+			}
+			record(result)
+
+			switch result.Outcome {
+			case types.AttemptFailed:
+				return err
+			case types.AttemptFallback:
+				// The next model starts without waiting; its provider may be fine
+			case types.AttemptRetry:
+				if sleepErr := sleep(ctx, wait); sleepErr != nil {
+					return err
+				}
+				wait *= 2
+				continue
+			}
+			break
+		}
+	}
+	return fmt.Errorf("no model to try")
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// Describe summarizes an attempt and what happens next, for the transcript
+func Describe(attempt types.RunAttempt) string {
+	reason := strings.ReplaceAll(attempt.Reason, "_", " ")
+	if reason == "" {
+		reason = "error"
+	}
+	switch attempt.Outcome {
+	case types.AttemptRetry:
+		return fmt.Sprintf("Attempt %d on %s failed (%s): %s. Retrying.", attempt.Number, attempt.Model, reason, attempt.Error)
+	case types.AttemptFallback:
+		return fmt.Sprintf("Attempt %d on %s failed (%s): %s. Falling back to %s.", attempt.Number, attempt.Model, reason, attempt.Error, attempt.Next)
+	case types.AttemptFailed:
+		return fmt.Sprintf("Attempt %d on %s failed (%s): %s. Giving up.", attempt.Number, attempt.Model, reason, attempt.Error)
+	}
+	return fmt.Sprintf("Attempt %d on %s succeeded.", attempt.Number, attempt.Model)
+}
@@ -0,0 +1,141 @@
+package modelpolicy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/sst/opencode-sdk-go"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestClassify(t *testing.T) {
+	status := func(code int) error {
+		return fmt.Errorf("prompt: %w", &opencode.Error{StatusCode: code, Response: &http.Response{StatusCode: code}})
+	}
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"cancelled", fmt.Errorf("post: %w", context.Canceled), ""},
+		{"deadline", fmt.Errorf("post: %w", context.DeadlineExceeded), ReasonTimeout},
+		{"429", status(http.StatusTooManyRequests), ReasonRateLimit},
+		{"504", status(http.StatusGatewayTimeout), ReasonTimeout},
+		{"503", status(http.StatusServiceUnavailable), ReasonOverloaded},
+		{"provider rate limit", &ProviderError{Name: "UnknownError", Message: "Rate limit reached for requests"}, ReasonRateLimit},
+		{"provider overloaded", &ProviderError{Name: "UnknownError", Message: "Overloaded"}, ReasonOverloaded},
+		{"auth", &ProviderError{Name: "ProviderAuthError", Message: "429 invalid key"}, ""},
+		{"other", errors.New("invalid tool schema"), ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Classify(tc.err); got != tc.want {
+				t.Errorf("Classify(%v) = %q, want %q", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	primary := types.ModelRef{ProviderID: "anthropic", ModelID: "large"}
+	backup := types.ModelRef{ProviderID: "openai", ModelID: "medium"}
+	rateLimited := &ProviderError{Name: "UnknownError", Message: "rate limit exceeded"}
+	invalid := errors.New("invalid request")
+
+	tests := []struct {
+		name     string
+		policy   types.ModelPolicy
+		results  []error // Per attempt; attempts past the end succeed
+		wantErr  error
+		outcomes []string
+		models   []types.ModelRef
+	}{
+		{
+			name:     "first attempt succeeds",
+			policy:   types.ModelPolicy{MaxRetries: 2, Fallbacks: []types.ModelRef{backup}},
+			outcomes: []string{types.AttemptSucceeded},
+			models:   []types.ModelRef{primary},
+		},
+		{
+			name:     "retry then succeed",
+			policy:   types.ModelPolicy{MaxRetries: 2},
+			results:  []error{rateLimited},
+			outcomes: []string{types.AttemptRetry, types.AttemptSucceeded},
+			models:   []types.ModelRef{primary, primary},
+		},
+		{
+			name:     "fall back once retries run out",
+			policy:   types.ModelPolicy{MaxRetries: 1, Fallbacks: []types.ModelRef{primary, backup}},
+			results:  []error{rateLimited, rateLimited},
+			outcomes: []string{types.AttemptRetry, types.AttemptFallback, types.AttemptSucceeded},
+			models:   []types.ModelRef{primary, primary, backup},
+		},
+		{
+			name:     "give up when every model fails",
+			policy:   types.ModelPolicy{Fallbacks: []types.ModelRef{backup}},
+			results:  []error{rateLimited, rateLimited},
+			wantErr:  rateLimited,
+			outcomes: []string{types.AttemptFallback, types.AttemptFailed},
+			models:   []types.ModelRef{primary, backup},
+		},
+		{
+			name:     "errors that will not pass are not retried",
+			policy:   types.ModelPolicy{MaxRetries: 3, Fallbacks: []types.ModelRef{backup}},
+			results:  []error{invalid},
+			wantErr:  invalid,
+			outcomes: []string{types.AttemptFailed},
+			models:   []types.ModelRef{primary},
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var models []types.ModelRef
+			var attempts []types.RunAttempt
+			err := Run(context.Background(), tc.policy, primary, func(ctx context.Context, model types.ModelRef) error {
+				models = append(models, model)
+				if n := len(models) - 1; n < len(tc.results) {
+					return tc.results[n]
+				}
+				return nil
+			}, func(attempt types.RunAttempt) {
+				attempts = append(attempts, attempt)
+			})
+
+			if err != tc.wantErr {
+				t.Errorf("Run() error = %v, want %v", err, tc.wantErr)
+			}
+			if fmt.Sprint(models) != fmt.Sprint(tc.models) {
+				t.Errorf("models tried = %v, want %v", models, tc.models)
+			}
+			if len(attempts) != len(tc.outcomes) {
+				t.Fatalf("recorded %d attempts, want %d", len(attempts), len(tc.outcomes))
+			}
+			for i, attempt := range attempts {
+				if attempt.Number != i+1 || attempt.Outcome != tc.outcomes[i] {
+					t.Errorf("attempt %d = #%d %s, want #%d %s", i, attempt.Number, attempt.Outcome, i+1, tc.outcomes[i])
+				}
+				if attempt.Outcome == types.AttemptFallback && (attempt.Next == nil || *attempt.Next != backup) {
+					t.Errorf("fallback attempt next = %v, want %v", attempt.Next, backup)
+				}
+			}
+		})
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	tries := 0
+	err := Run(ctx, types.ModelPolicy{MaxRetries: 5, Backoff: 1 << 40}, types.ModelRef{}, func(context.Context, types.ModelRef) error {
+		tries++
+		cancel()
+		return errors.New("503 service unavailable")
+	}, func(types.RunAttempt) {})
+	if err == nil || tries != 1 {
+		t.Errorf("Run() = %v after %d tries, want the error after 1", err, tries)
+	}
+}
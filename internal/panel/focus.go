@@ -0,0 +1,19 @@
+package panel
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+// FocusOwnPane selects the tmux pane this panel process runs in
+func FocusOwnPane() error {
+	pane := os.Getenv("TMUX_PANE")
+	if pane == "" {
+		return fmt.Errorf("not running inside a tmux pane")
+	}
+	if out, err := exec.Command("tmux", "select-pane", "-t", pane).CombinedOutput(); err != nil {
+		return fmt.Errorf("tmux select-pane %s failed: %v: %s", pane, err, out)
+	}
+	return nil
+}
@@ -0,0 +1,682 @@
+package controllerpanel
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/metrics"
+	"github.com/opencode/tmux_coder/internal/panel"
+	"github.com/opencode/tmux_coder/internal/styles"
+	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/opencode/tmux_coder/internal/version"
+)
+
+// recentEventCount is how many of the latest events the panel lists
+const recentEventCount = 10
+
+// ControllerPanel shows orchestrator health and runs admin actions
+type ControllerPanel struct {
+	ipcClient       *ipc.SocketClient
+	socketPath      string
+	refreshInterval time.Duration
+	diagnostics     *interfaces.Diagnostics
+	selected        int     // Index into the status panel list, the target of respawn
+	pending         *action // Destructive action waiting for confirmation
+	notice          string  // Result of the last action
+	lastError       string
+	width           int
+	height          int
+	ctx             context.Context
+	cancel          context.CancelFunc
+}
+
+// action is an admin command the panel can run, or a plain request when run
+// is set
+type action struct {
+	command string
+	params  map[string]interface{}
+	prompt  string       // Shown while waiting for confirmation
+	done    string       // Shown once the command succeeded
+	run     func() error // Sent instead of an admin command when set
+}
+
+// RunConfig describes runtime configuration for the controller panel.
+type RunConfig struct {
+	SocketPath         string
+	LogDir             string
+	DefaultTheme       string
+	DisableThemeLoader bool
+	RefreshInterval    time.Duration
+}
+
+// DefaultRunConfig resolves configuration from environment variables.
+func DefaultRunConfig() (RunConfig, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return RunConfig{}, fmt.Errorf("resolve home dir: %w", err)
+	}
+
+	cfg := RunConfig{
+		SocketPath:      os.Getenv("OPENCODE_SOCKET"),
+		LogDir:          filepath.Join(homeDir, ".opencode"),
+		DefaultTheme:    "opencode",
+		RefreshInterval: 2 * time.Second,
+	}
+	if cfg.SocketPath == "" {
+		cfg.SocketPath = filepath.Join(cfg.LogDir, "ipc.sock")
+	}
+
+	if err := timefmt.ConfigureFromEnv(); err != nil {
+		return cfg, fmt.Errorf("display settings: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// Module implements the panel.Panel interface for the controller panel.
+type Module struct {
+	cfg     RunConfig
+	ctx     context.Context
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewModule constructs a new controller panel module instance.
+func NewModule() panel.Panel {
+	return &Module{}
+}
+
+// Metadata returns static information about the panel.
+func (m *Module) Metadata() panel.Metadata {
+	return panel.Metadata{
+		ID:             "controller",
+		DisplayName:    "Controller Panel",
+		Version:        "1.0.0",
+		Capabilities:   []string{"diagnostics", "admin"},
+		DefaultCommand: []string{"opencode-controller"},
+	}
+}
+
+// Init wires orchestration dependencies into the module.
+func (m *Module) Init(deps panel.RuntimeDeps) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ctx = deps.Context
+	if m.ctx == nil {
+		m.ctx = context.Background()
+	}
+
+	m.cfg = RunConfig{
+		SocketPath:      deps.SocketPath,
+		LogDir:          "",
+		DefaultTheme:    "opencode",
+		RefreshInterval: 2 * time.Second,
+	}
+
+	return nil
+}
+
+// Run executes the panel loop.
+func (m *Module) Run() error {
+	m.mu.Lock()
+	ctx := m.ctx
+	cfg := m.cfg
+	m.mu.Unlock()
+
+	err := Run(ctx, cfg)
+
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+
+	return err
+}
+
+// Shutdown gracefully stops the panel.
+func (m *Module) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Health returns health information for monitoring.
+func (m *Module) Health() panel.HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastErr != nil {
+		return panel.HealthStatus{
+			Healthy: false,
+			Reason:  m.lastErr.Error(),
+		}
+	}
+
+	return panel.HealthStatus{Healthy: true}
+}
+
+func init() {
+	panel.MustRegister(NewModule().Metadata(), NewModule)
+}
+
+// NewControllerPanel creates a new controller panel
+func NewControllerPanel(parent context.Context, socketPath string, refreshInterval time.Duration) *ControllerPanel {
+	ctx, cancel := context.WithCancel(parent)
+	if refreshInterval <= 0 {
+		refreshInterval = 2 * time.Second
+	}
+
+	p := &ControllerPanel{
+		ipcClient:       ipc.NewSocketClient(socketPath, "controller-panel", "controller"),
+		socketPath:      socketPath,
+		refreshInterval: refreshInterval,
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+
+	p.ipcClient.SetIdentity(os.Getenv(ipc.PanelIdentityEnv))
+
+	// The controller polls diagnostics and renders no state, so it handles no
+	// UI actions and needs no diffs
+	p.ipcClient.SetCapabilities(types.PanelCapabilities{})
+
+	return p
+}
+
+// Init initializes the panel
+func (p *ControllerPanel) Init() tea.Cmd {
+	return func() tea.Msg {
+		if err := p.ipcClient.Connect(); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to connect to IPC: %w", err)}
+		}
+		return ConnectedMsg{}
+	}
+}
+
+// Update handles messages and updates the panel state
+func (p *ControllerPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.width = msg.Width
+		p.height = msg.Height
+		return p, nil
+
+	case tea.KeyMsg:
+		return p.handleKeyPress(msg)
+
+	case ConnectedMsg:
+		log.Printf("Controller panel connected to IPC")
+		return p, tea.Batch(p.fetchDiagnostics(), p.scheduleRefresh())
+
+	case RefreshTickMsg:
+		return p, tea.Batch(p.fetchDiagnostics(), p.scheduleRefresh())
+
+	case DiagnosticsMsg:
+		p.diagnostics = msg.Diagnostics
+		p.clampSelection()
+		p.lastError = ""
+		return p, nil
+
+	case ActionDoneMsg:
+		p.notice = msg.Notice
+		p.lastError = ""
+		return p, p.fetchDiagnostics()
+
+	case ErrorMsg:
+		log.Printf("Controller panel error: %v", msg.Error)
+		p.lastError = msg.Error.Error()
+		return p, nil
+	}
+	return p, nil
+}
+
+// View renders the controller panel
+func (p *ControllerPanel) View() string {
+	t := theme.CurrentTheme()
+	heading := styles.NewStyle().Foreground(t.Primary()).Bold(true)
+	muted := styles.NewStyle().Foreground(t.TextMuted())
+
+	var b strings.Builder
+	b.WriteString(heading.Render("Controller") + "\n\n")
+
+	if p.diagnostics == nil {
+		b.WriteString(muted.Render("Waiting for diagnostics...") + "\n")
+	} else {
+		p.renderHealth(&b)
+		p.renderPanels(&b)
+		p.renderSubscribers(&b)
+		p.renderMetrics(&b)
+		p.renderConflicts(&b)
+		p.renderRecentEvents(&b)
+	}
+
+	switch {
+	case p.pending != nil:
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Warning()).Bold(true).Render(p.pending.prompt+" (y/n)"))
+	case p.lastError != "":
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Error()).Bold(true).Render("Error: "+p.lastError))
+	case p.notice != "":
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Success()).Render(p.notice))
+	}
+
+	b.WriteString("\n" + muted.Render("↑/k ↓/j select panel • x respawn • s force sync • b restore backup • p next profile • r refresh • q quit"))
+	return b.String()
+}
+
+// handleKeyPress processes keyboard input
+func (p *ControllerPanel) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+
+	if p.pending != nil {
+		pending := p.pending
+		p.pending = nil
+		if key == "y" {
+			return p, p.runAction(*pending)
+		}
+		p.notice = "Cancelled"
+		return p, nil
+	}
+
+	switch key {
+	case "q", "ctrl+c":
+		return p, tea.Quit
+
+	case "up", "k":
+		if p.selected > 0 {
+			p.selected--
+		}
+
+	case "down", "j":
+		if p.selected < len(p.panels())-1 {
+			p.selected++
+		}
+
+	case "r":
+		return p, p.fetchDiagnostics()
+
+	case "s":
+		return p, p.runAction(action{
+			command: "force_sync",
+			done:    "Full state sync sent to every panel",
+		})
+
+	case "b":
+		p.pending = &action{
+			command: "restore_backup",
+			prompt:  "Replace the live state with the newest valid backup?",
+			done:    "State restored from backup",
+		}
+
+	case "p":
+		if next := p.nextProfile(); next != "" {
+			p.pending = &action{
+				command: "switch_profile",
+				prompt:  fmt.Sprintf("Switch to the %s profile and reapply its layout?", next),
+				done:    fmt.Sprintf("Switched to profile %s", next),
+				run: func() error {
+					_, err := p.ipcClient.SwitchProfile(next)
+					return err
+				},
+			}
+		} else {
+			p.notice = "No other profile to switch to"
+		}
+
+	case "x":
+		panels := p.panels()
+		if p.selected < len(panels) {
+			name := panels[p.selected].Name
+			p.pending = &action{
+				command: "respawn_panel",
+				params:  map[string]interface{}{"panel": name},
+				prompt:  fmt.Sprintf("Restart the %s panel?", name),
+				done:    fmt.Sprintf("Panel %s respawned", name),
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// fetchDiagnostics asks the orchestrator for a fresh snapshot
+func (p *ControllerPanel) fetchDiagnostics() tea.Cmd {
+	return func() tea.Msg {
+		diagnostics, err := p.ipcClient.GetDiagnostics(recentEventCount)
+		if err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to fetch diagnostics: %w", err)}
+		}
+		return DiagnosticsMsg{Diagnostics: diagnostics}
+	}
+}
+
+func (p *ControllerPanel) scheduleRefresh() tea.Cmd {
+	return tea.Tick(p.refreshInterval, func(time.Time) tea.Msg {
+		return RefreshTickMsg{}
+	})
+}
+
+// runAction sends an admin command with the token the orchestrator wrote next
+// to its socket; the token is read each time since a restarted daemon writes a new one
+func (p *ControllerPanel) runAction(a action) tea.Cmd {
+	return func() tea.Msg {
+		if a.run != nil {
+			if err := a.run(); err != nil {
+				return ErrorMsg{Error: fmt.Errorf("%s failed: %w", a.command, err)}
+			}
+			log.Printf("Controller action %s succeeded", a.command)
+			return ActionDoneMsg{Notice: a.done}
+		}
+		token, err := ipc.ReadAdminToken(ipc.AdminTokenPath(p.socketPath))
+		if err != nil {
+			return ErrorMsg{Error: fmt.Errorf("admin actions unavailable: %w", err)}
+		}
+		if _, err := p.ipcClient.AdminCommand(token, a.command, a.params); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("%s failed: %w", a.command, err)}
+		}
+		log.Printf("Controller action %s succeeded", a.command)
+		return ActionDoneMsg{Notice: a.done}
+	}
+}
+
+// nextProfile returns the profile after the active one, wrapping around, or ""
+// when there is no other to switch to
+func (p *ControllerPanel) nextProfile() string {
+	if p.diagnostics == nil || p.diagnostics.Status == nil || p.diagnostics.Status.Profile == nil {
+		return ""
+	}
+	profile := p.diagnostics.Status.Profile
+	for i, name := range profile.Available {
+		if name == profile.Active {
+			if next := profile.Available[(i+1)%len(profile.Available)]; next != name {
+				return next
+			}
+			return ""
+		}
+	}
+	if len(profile.Available) > 0 {
+		return profile.Available[0]
+	}
+	return ""
+}
+
+// panels returns the panels reported in the last status
+func (p *ControllerPanel) panels() []interfaces.PanelStatus {
+	if p.diagnostics == nil || p.diagnostics.Status == nil {
+		return nil
+	}
+	return p.diagnostics.Status.Panels
+}
+
+func (p *ControllerPanel) clampSelection() {
+	if count := len(p.panels()); p.selected >= count {
+		p.selected = count - 1
+	}
+	if p.selected < 0 {
+		p.selected = 0
+	}
+}
+
+func (p *ControllerPanel) renderHealth(b *strings.Builder) {
+	t := theme.CurrentTheme()
+	d := p.diagnostics
+
+	health := styles.NewStyle().Foreground(t.Success()).Render("healthy")
+	if !d.Healthy {
+		health = styles.NewStyle().Foreground(t.Error()).Bold(true).Render("degraded")
+	}
+	if status := d.Status; status != nil {
+		fmt.Fprintf(b, "Session %s • pid %d • build %s • up %s • state %s\n",
+			status.SessionName, status.DaemonPID, status.Build, status.Uptime.Round(time.Second), health)
+		if profile := status.Profile; profile != nil && profile.Active != "" {
+			fmt.Fprintf(b, "Profile: %s\n", profile.Active)
+		}
+		if status.Storage != nil && !status.Storage.Healthy {
+			b.WriteString(styles.NewStyle().Foreground(t.Warning()).Render("Storage: "+status.Storage.Message) + "\n")
+		}
+	} else {
+		fmt.Fprintf(b, "State %s\n", health)
+	}
+	if backup := d.LatestBackup; backup != nil {
+		fmt.Fprintf(b, "Latest backup: %s (v%d, %s ago)\n",
+			filepath.Base(backup.Path), backup.StateVersion, time.Since(backup.Timestamp).Round(time.Second))
+	} else {
+		b.WriteString("Latest backup: none\n")
+	}
+}
+
+func (p *ControllerPanel) renderPanels(b *strings.Builder) {
+	t := theme.CurrentTheme()
+	p.section(b, "Panels")
+
+	for i, status := range p.panels() {
+		state := "running"
+		if !status.IsRunning {
+			state = "stopped"
+		}
+		line := fmt.Sprintf("%-12s %-8s %-8s restarts %d", status.Name, status.PaneID, state, status.Restarts)
+		if status.LastError != "" {
+			line += " • " + status.LastError
+		}
+		if status.Compatibility == string(version.Compatible) {
+			line += " • build " + status.Build + " (run opencode-tmux upgrade)"
+		}
+
+		style := styles.NewStyle().Foreground(t.Text()).Padding(0, 1)
+		if i == p.selected {
+			style = styles.NewStyle().Background(t.Primary()).Foreground(t.Background()).Bold(true).Padding(0, 1)
+		}
+		b.WriteString(style.Render(line) + "\n")
+	}
+}
+
+func (p *ControllerPanel) renderSubscribers(b *strings.Builder) {
+	subscribers := p.diagnostics.Subscribers
+	p.section(b, fmt.Sprintf("Subscribers (%d)", len(subscribers)))
+
+	for _, sub := range subscribers {
+		last := "never"
+		if !sub.LastEventAt.IsZero() {
+			last = time.Since(sub.LastEventAt).Round(time.Second).String() + " ago"
+		}
+		line := fmt.Sprintf("  %-20s %-10s %6d events • last %s", sub.PanelID, sub.PanelType, sub.EventCount, last)
+		if sub.Dropped == 0 {
+			b.WriteString(line + "\n")
+			continue
+		}
+		line += fmt.Sprintf(" • %d dropped, %d resyncs", sub.Dropped, sub.Resyncs)
+		color := theme.CurrentTheme().Warning()
+		if sub.Lagging {
+			line += " • lagging"
+			color = theme.CurrentTheme().Error()
+		}
+		b.WriteString(styles.NewStyle().Foreground(color).Render(line) + "\n")
+	}
+}
+
+func (p *ControllerPanel) renderMetrics(b *strings.Builder) {
+	m := p.diagnostics.Metrics
+	p.section(b, "Metrics")
+
+	fmt.Fprintf(b, "  updates %d (%.1f%% ok, %d failed, %d duplicate) • %s\n",
+		m.TotalUpdates, m.GetSuccessRate(), m.FailedUpdates, m.DuplicateUpdates, latencyText(m.UpdateLatency))
+	fmt.Fprintf(b, "  saves %d (%.1f%% ok, %d failed) • %s\n",
+		m.TotalSaves, m.GetSaveSuccessRate(), m.FailedSaves, latencyText(m.SaveLatency))
+	if m.Batches > 0 {
+		fmt.Fprintf(b, "  batches %d (%d updates, avg %.1f, largest %d)\n",
+			m.Batches, m.BatchedUpdates, m.AverageBatchSize(), m.LargestBatch)
+	}
+	if m.SlowUpdates > 0 || m.SlowSaves > 0 {
+		t := theme.CurrentTheme()
+		text := fmt.Sprintf("  watchdog: %d slow updates, %d slow saves (see the orchestrator log)", m.SlowUpdates, m.SlowSaves)
+		b.WriteString(styles.NewStyle().Foreground(t.Warning()).Render(text) + "\n")
+	}
+	if len(m.Panics) > 0 {
+		components := make([]string, 0, len(m.Panics))
+		for component, count := range m.Panics {
+			components = append(components, fmt.Sprintf("%s %d", component, count))
+		}
+		sort.Strings(components)
+		t := theme.CurrentTheme()
+		text := fmt.Sprintf("  recovered panics: %s (see the orchestrator log)", strings.Join(components, ", "))
+		b.WriteString(styles.NewStyle().Foreground(t.Error()).Render(text) + "\n")
+	}
+	if status := p.diagnostics.Status; status != nil && status.EventHistory != nil {
+		h := status.EventHistory
+		fmt.Fprintf(b, "  event history %d/%d in memory, %d on disk, %d evicted\n",
+			h.InMemory, h.Capacity, h.OverflowEvents, h.Evicted)
+	}
+}
+
+// latencyText summarizes a latency distribution as its mean and tail
+func latencyText(l metrics.LatencySummary) string {
+	round := func(d time.Duration) time.Duration { return d.Round(time.Microsecond) }
+	return fmt.Sprintf("avg %s p50 %s p95 %s p99 %s", round(l.Mean), round(l.P50), round(l.P95), round(l.P99))
+}
+
+func (p *ControllerPanel) renderConflicts(b *strings.Builder) {
+	t := theme.CurrentTheme()
+	c := p.diagnostics.Conflicts
+	p.section(b, "Conflicts")
+
+	fmt.Fprintf(b, "  %d conflicts, %d retries, %d concurrent • %d throttled, %d rejected • strategy %s\n",
+		c.ConflictCount, c.RetryCount, c.ConcurrentCount, c.ThrottledCount, c.RejectedCount, c.Strategy)
+	if c.StormActive {
+		b.WriteString(styles.NewStyle().Foreground(t.Warning()).Render("  conflict storm: updates are serialized") + "\n")
+	}
+
+	// Updates still waiting for an in-flight slot, per panel
+	panels := make([]string, 0, len(c.InFlightByPanel))
+	for panelID, inFlight := range c.InFlightByPanel {
+		if inFlight > 0 {
+			panels = append(panels, panelID)
+		}
+	}
+	sort.Strings(panels)
+	for _, panelID := range panels {
+		fmt.Fprintf(b, "  pending %-20s %d\n", panelID, c.InFlightByPanel[panelID])
+	}
+}
+
+func (p *ControllerPanel) renderRecentEvents(b *strings.Builder) {
+	events := p.diagnostics.RecentEvents
+	p.section(b, "Recent events")
+
+	if len(events) == 0 {
+		b.WriteString("  none\n")
+	}
+	// Newest first
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		fmt.Fprintf(b, "  %s v%-6d %-24s %s\n",
+			timefmt.Clock(event.Timestamp), event.Version, event.Type, event.SourcePanel)
+	}
+}
+
+func (p *ControllerPanel) section(b *strings.Builder, title string) {
+	t := theme.CurrentTheme()
+	b.WriteString("\n" + styles.NewStyle().Foreground(t.Accent()).Bold(true).Render(title) + "\n")
+}
+
+// Message types
+type ConnectedMsg struct{}
+
+type RefreshTickMsg struct{}
+
+type DiagnosticsMsg struct {
+	Diagnostics *interfaces.Diagnostics
+}
+
+type ActionDoneMsg struct {
+	Notice string
+}
+
+type ErrorMsg struct {
+	Error error
+}
+
+func Run(ctx context.Context, cfg RunConfig) error {
+	logDir := cfg.LogDir
+	if logDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("resolve home dir: %w", err)
+		}
+		logDir = filepath.Join(homeDir, ".opencode")
+	}
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+
+	logPath := filepath.Join(logDir, "controller.log")
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	log.SetOutput(logFile)
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	socketPath := cfg.SocketPath
+	if socketPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("resolve home dir: %w", err)
+		}
+		socketPath = filepath.Join(homeDir, ".opencode", "ipc.sock")
+	}
+
+	if !cfg.DisableThemeLoader {
+		if err := theme.LoadThemesFromJSON(); err != nil {
+			return fmt.Errorf("load themes: %w", err)
+		}
+	}
+
+	themeName := cfg.DefaultTheme
+	if themeName == "" {
+		themeName = "opencode"
+	}
+	if err := theme.SetTheme(themeName); err != nil {
+		return fmt.Errorf("set theme: %w", err)
+	}
+
+	panel := NewControllerPanel(ctx, socketPath, cfg.RefreshInterval)
+
+	program := tea.NewProgram(
+		panel,
+		tea.WithAltScreen(),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Printf("Context cancelled, shutting down controller panel: %v", ctx.Err())
+			panel.cancel()
+			program.Quit()
+		case <-done:
+		}
+	}()
+
+	_, err = program.Run()
+	close(done)
+
+	panel.ipcClient.Disconnect()
+	panel.cancel()
+
+	if err != nil {
+		return fmt.Errorf("controller panel run: %w", err)
+	}
+
+	return nil
+}
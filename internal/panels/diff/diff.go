@@ -0,0 +1,668 @@
+package diffpanel
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/panel"
+	"github.com/opencode/tmux_coder/internal/styles"
+	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// DiffPanel shows the file changes made by tool calls and sends accept and
+// revert actions back to the orchestrator
+type DiffPanel struct {
+	ipcClient  *ipc.SocketClient
+	eventsChan chan types.StateEvent
+	diffs      []types.FileDiffSet
+	selected   int // Index into diffs
+	file       int // Index into the selected diff's files
+	scroll     int // First patch line shown
+	pending    *pendingRevert
+	notice     string
+	lastError  string
+	width      int
+	height     int
+	ctx        context.Context
+	cancel     context.CancelFunc
+}
+
+// pendingRevert is a revert waiting for confirmation
+type pendingRevert struct {
+	args   types.DiffActionArgs
+	prompt string
+}
+
+// RunConfig describes runtime configuration for the diff panel.
+type RunConfig struct {
+	SocketPath         string
+	LogDir             string
+	DefaultTheme       string
+	DisableThemeLoader bool
+}
+
+// DefaultRunConfig resolves configuration from environment variables.
+func DefaultRunConfig() (RunConfig, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return RunConfig{}, fmt.Errorf("resolve home dir: %w", err)
+	}
+
+	cfg := RunConfig{
+		SocketPath:   os.Getenv("OPENCODE_SOCKET"),
+		LogDir:       filepath.Join(homeDir, ".opencode"),
+		DefaultTheme: "opencode",
+	}
+	if cfg.SocketPath == "" {
+		cfg.SocketPath = filepath.Join(cfg.LogDir, "ipc.sock")
+	}
+
+	return cfg, nil
+}
+
+// Module implements the panel.Panel interface for the diff panel.
+type Module struct {
+	cfg     RunConfig
+	ctx     context.Context
+	mu      sync.Mutex
+	lastErr error
+}
+
+// NewModule constructs a new diff panel module instance.
+func NewModule() panel.Panel {
+	return &Module{}
+}
+
+// Metadata returns static information about the panel.
+func (m *Module) Metadata() panel.Metadata {
+	return panel.Metadata{
+		ID:             "diff",
+		DisplayName:    "Diff Panel",
+		Version:        "1.0.0",
+		Capabilities:   []string{"diffs"},
+		DefaultCommand: []string{"opencode-diff"},
+	}
+}
+
+// Init wires orchestration dependencies into the module.
+func (m *Module) Init(deps panel.RuntimeDeps) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ctx = deps.Context
+	if m.ctx == nil {
+		m.ctx = context.Background()
+	}
+
+	m.cfg = RunConfig{
+		SocketPath:   deps.SocketPath,
+		DefaultTheme: "opencode",
+	}
+
+	return nil
+}
+
+// Run executes the panel loop.
+func (m *Module) Run() error {
+	m.mu.Lock()
+	ctx := m.ctx
+	cfg := m.cfg
+	m.mu.Unlock()
+
+	err := Run(ctx, cfg)
+
+	m.mu.Lock()
+	m.lastErr = err
+	m.mu.Unlock()
+
+	return err
+}
+
+// Shutdown gracefully stops the panel.
+func (m *Module) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Health returns health information for monitoring.
+func (m *Module) Health() panel.HealthStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.lastErr != nil {
+		return panel.HealthStatus{
+			Healthy: false,
+			Reason:  m.lastErr.Error(),
+		}
+	}
+
+	return panel.HealthStatus{Healthy: true}
+}
+
+func init() {
+	panel.MustRegister(NewModule().Metadata(), NewModule)
+}
+
+// NewDiffPanel creates a new diff panel
+func NewDiffPanel(parent context.Context, socketPath string) *DiffPanel {
+	ctx, cancel := context.WithCancel(parent)
+
+	p := &DiffPanel{
+		ipcClient:  ipc.NewSocketClient(socketPath, "diff-panel", "diff"),
+		eventsChan: make(chan types.StateEvent, 64),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	p.ipcClient.SetIdentity(os.Getenv(ipc.PanelIdentityEnv))
+
+	// Diffs come from file diff events, not message parts, and the panel only
+	// sends UI actions
+	p.ipcClient.SetCapabilities(types.PanelCapabilities{Topics: []string{"diff.*", "theme.*"}})
+
+	p.ipcClient.RegisterEventHandler(types.EventFileDiffReady, p.forwardEventToUI)
+	p.ipcClient.RegisterEventHandler(types.EventFileDiffResolved, p.forwardEventToUI)
+	p.ipcClient.RegisterEventHandler(types.EventStateSync, p.forwardEventToUI)
+	p.ipcClient.RegisterEventHandler(types.EventThemeChanged, p.forwardEventToUI)
+
+	return p
+}
+
+// Init initializes the panel
+func (p *DiffPanel) Init() tea.Cmd {
+	return func() tea.Msg {
+		if err := p.ipcClient.Connect(); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to connect to IPC: %w", err)}
+		}
+		return ConnectedMsg{}
+	}
+}
+
+// Update handles messages and updates the panel state
+func (p *DiffPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		p.width = msg.Width
+		p.height = msg.Height
+		return p, nil
+
+	case tea.KeyMsg:
+		return p.handleKeyPress(msg)
+
+	case ConnectedMsg:
+		log.Printf("Diff panel connected to IPC")
+		return p, tea.Batch(p.loadState(), p.waitForEvent())
+
+	case StateLoadedMsg:
+		p.setDiffs(msg.Diffs)
+		p.showLatestPending()
+		return p, nil
+
+	case EventMsg:
+		p.handleEvent(msg.Event)
+		return p, p.waitForEvent()
+
+	case ActionSentMsg:
+		p.notice = msg.Notice
+		p.lastError = ""
+		return p, nil
+
+	case ErrorMsg:
+		log.Printf("Diff panel error: %v", msg.Error)
+		p.lastError = msg.Error.Error()
+		return p, nil
+	}
+	return p, nil
+}
+
+// handleEvent applies a state event to the panel's copy of the diffs
+func (p *DiffPanel) handleEvent(event types.StateEvent) {
+	switch event.Type {
+	case types.EventFileDiffReady:
+		var payload types.FileDiffReadyPayload
+		if err := decodePayload(event.Data, &payload); err != nil {
+			log.Printf("Diff panel: bad file diff payload: %v", err)
+			return
+		}
+		diffs := make([]types.FileDiffSet, 0, len(p.diffs)+1)
+		for _, diff := range p.diffs {
+			if diff.ID != payload.Diff.ID {
+				diffs = append(diffs, diff)
+			}
+		}
+		p.setDiffs(append(diffs, payload.Diff))
+		// Follow the newest change as the assistant works
+		p.selectDiff(len(p.diffs) - 1)
+
+	case types.EventFileDiffResolved:
+		var payload types.FileDiffResolvedPayload
+		if err := decodePayload(event.Data, &payload); err != nil {
+			log.Printf("Diff panel: bad file diff resolution payload: %v", err)
+			return
+		}
+		for i := range p.diffs {
+			if p.diffs[i].ID != payload.DiffID {
+				continue
+			}
+			if payload.Error == "" {
+				p.diffs[i].Status = payload.Status
+				p.notice = fmt.Sprintf("Change %s", payload.Status)
+				p.lastError = ""
+			} else {
+				p.lastError = payload.Error
+			}
+			p.diffs[i].Error = payload.Error
+		}
+
+	case types.EventStateSync:
+		if payload, ok := event.Data.(types.StateSyncPayload); ok && payload.State != nil {
+			p.setDiffs(payload.State.GetFileDiffs())
+		} else {
+			// A sync decoded from JSON; read the state again rather than decode it
+			go func() {
+				if state, err := p.ipcClient.RequestState(); err == nil {
+					p.forwardEventToUI(types.StateEvent{Type: types.EventStateSync, Data: types.StateSyncPayload{State: state}})
+				}
+			}()
+		}
+
+	case types.EventThemeChanged:
+		var payload types.ThemeChangePayload
+		if err := decodePayload(event.Data, &payload); err == nil {
+			if err := theme.SetTheme(payload.Theme); err != nil {
+				log.Printf("Diff panel: failed to set theme %s: %v", payload.Theme, err)
+			}
+		}
+	}
+}
+
+// View renders the diff panel
+func (p *DiffPanel) View() string {
+	t := theme.CurrentTheme()
+	heading := styles.NewStyle().Foreground(t.Primary()).Bold(true)
+	muted := styles.NewStyle().Foreground(t.TextMuted())
+
+	var b strings.Builder
+	diff, ok := p.current()
+	if !ok {
+		b.WriteString(heading.Render("Diff") + "\n\n")
+		b.WriteString(muted.Render("No file changes yet") + "\n")
+		b.WriteString("\n" + muted.Render("q quit"))
+		return b.String()
+	}
+
+	b.WriteString(heading.Render(fmt.Sprintf("Diff %d/%d", p.selected+1, len(p.diffs))))
+	b.WriteString(muted.Render(fmt.Sprintf(" • %s • %s", diff.Tool, diff.Status)) + "\n")
+	for i, file := range diff.Files {
+		marker := "  "
+		style := styles.NewStyle().Foreground(t.Text())
+		if i == p.file {
+			marker = "▸ "
+			style = styles.NewStyle().Foreground(t.Accent()).Bold(true)
+		}
+		b.WriteString(style.Render(p.clip(marker+file.Path)) + "\n")
+	}
+	b.WriteString("\n")
+
+	lines := p.patchLines()
+	for _, line := range lines[p.scroll:min(len(lines), p.scroll+p.patchHeight())] {
+		b.WriteString(p.renderPatchLine(line) + "\n")
+	}
+
+	switch {
+	case p.pending != nil:
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Warning()).Bold(true).Render(p.pending.prompt+" (y/n)"))
+	case p.lastError != "":
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Error()).Bold(true).Render(p.clip("Error: "+p.lastError)))
+	case p.notice != "":
+		b.WriteString("\n" + styles.NewStyle().Foreground(t.Success()).Render(p.notice))
+	}
+
+	b.WriteString("\n" + muted.Render("h/l change • tab file • j/k scroll • a accept • r revert • R revert file • q quit"))
+	return b.String()
+}
+
+func (p *DiffPanel) renderPatchLine(line string) string {
+	t := theme.CurrentTheme()
+	line = p.clip(line)
+	switch {
+	case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"), strings.HasPrefix(line, "diff "):
+		return styles.NewStyle().Foreground(t.TextMuted()).Render(line)
+	case strings.HasPrefix(line, "@@"):
+		return styles.NewStyle().Foreground(t.DiffHunkHeader()).Render(line)
+	case strings.HasPrefix(line, "+"):
+		return styles.NewStyle().Foreground(t.DiffAdded()).Render(line)
+	case strings.HasPrefix(line, "-"):
+		return styles.NewStyle().Foreground(t.DiffRemoved()).Render(line)
+	}
+	return styles.NewStyle().Foreground(t.DiffContext()).Render(line)
+}
+
+// handleKeyPress processes keyboard input
+func (p *DiffPanel) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	key := msg.String()
+
+	if p.pending != nil {
+		pending := p.pending
+		p.pending = nil
+		if key == "y" {
+			return p, p.sendAction(types.UIActionDiffRevert, pending.args, "Revert requested")
+		}
+		p.notice = "Cancelled"
+		return p, nil
+	}
+
+	diff, ok := p.current()
+	switch key {
+	case "q", "ctrl+c":
+		return p, tea.Quit
+
+	case "left", "h":
+		p.selectDiff(p.selected - 1)
+
+	case "right", "l":
+		p.selectDiff(p.selected + 1)
+
+	case "tab", "n":
+		if ok && len(diff.Files) > 0 {
+			p.file = (p.file + 1) % len(diff.Files)
+			p.scroll = 0
+		}
+
+	case "shift+tab", "p":
+		if ok && len(diff.Files) > 0 {
+			p.file = (p.file + len(diff.Files) - 1) % len(diff.Files)
+			p.scroll = 0
+		}
+
+	case "down", "j":
+		p.scrollBy(1)
+
+	case "up", "k":
+		p.scrollBy(-1)
+
+	case "pgdown", "space":
+		p.scrollBy(p.patchHeight())
+
+	case "pgup":
+		p.scrollBy(-p.patchHeight())
+
+	case "a":
+		if ok {
+			return p, p.sendAction(types.UIActionDiffAccept, types.DiffActionArgs{DiffID: diff.ID}, "Accept requested")
+		}
+
+	case "r":
+		if ok {
+			p.pending = &pendingRevert{
+				args:   types.DiffActionArgs{DiffID: diff.ID},
+				prompt: fmt.Sprintf("Revert all %d file(s) of this change?", len(diff.Files)),
+			}
+			if diff.Proposal != nil {
+				// Nothing was written yet; reverting drops the proposal
+				p.pending.prompt = fmt.Sprintf("Discard the proposed change to %s?", diff.Proposal.Path)
+			}
+		}
+
+	case "R":
+		if ok && p.file < len(diff.Files) {
+			path := diff.Files[p.file].Path
+			p.pending = &pendingRevert{
+				args:   types.DiffActionArgs{DiffID: diff.ID, Paths: []string{path}},
+				prompt: fmt.Sprintf("Revert the change to %s?", path),
+			}
+		}
+	}
+
+	return p, nil
+}
+
+// sendAction asks the orchestrator to accept or revert a diff; the outcome
+// arrives as a file diff resolved event
+func (p *DiffPanel) sendAction(action types.UIAction, args types.DiffActionArgs, notice string) tea.Cmd {
+	return func() tea.Msg {
+		if err := p.ipcClient.TriggerUIAction(action, args); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("%s failed: %w", action, err)}
+		}
+		return ActionSentMsg{Notice: notice}
+	}
+}
+
+func (p *DiffPanel) loadState() tea.Cmd {
+	return func() tea.Msg {
+		state, err := p.ipcClient.RequestState()
+		if err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to load state: %w", err)}
+		}
+		return StateLoadedMsg{Diffs: state.GetFileDiffs()}
+	}
+}
+
+// forwardEventToUI bridges IPC events into Bubble Tea through eventsChan
+func (p *DiffPanel) forwardEventToUI(event types.StateEvent) error {
+	select {
+	case p.eventsChan <- event:
+	default:
+		log.Printf("diff: events channel full, dropping event %s", event.Type)
+	}
+	return nil
+}
+
+func (p *DiffPanel) waitForEvent() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case event := <-p.eventsChan:
+			return EventMsg{Event: event}
+		case <-p.ctx.Done():
+			return nil
+		}
+	}
+}
+
+// setDiffs replaces the diffs, keeping the selection on the same diff when it is still there
+func (p *DiffPanel) setDiffs(diffs []types.FileDiffSet) {
+	selectedID := ""
+	if diff, ok := p.current(); ok {
+		selectedID = diff.ID
+	}
+	p.diffs = diffs
+	for i, diff := range diffs {
+		if diff.ID == selectedID {
+			p.selected = i
+			p.clampFile()
+			return
+		}
+	}
+	p.selectDiff(len(diffs) - 1)
+}
+
+// showLatestPending selects the newest diff still waiting for a decision
+func (p *DiffPanel) showLatestPending() {
+	for i := len(p.diffs) - 1; i >= 0; i-- {
+		if p.diffs[i].Status == types.FileDiffPending {
+			p.selectDiff(i)
+			return
+		}
+	}
+}
+
+func (p *DiffPanel) selectDiff(index int) {
+	if index >= len(p.diffs) {
+		index = len(p.diffs) - 1
+	}
+	if index < 0 {
+		index = 0
+	}
+	if index != p.selected {
+		p.file = 0
+		p.scroll = 0
+	}
+	p.selected = index
+	p.clampFile()
+}
+
+func (p *DiffPanel) clampFile() {
+	diff, ok := p.current()
+	if !ok || p.file >= len(diff.Files) {
+		p.file = 0
+		p.scroll = 0
+	}
+	if lines := len(p.patchLines()); p.scroll >= lines {
+		p.scroll = max(0, lines-1)
+	}
+}
+
+func (p *DiffPanel) current() (types.FileDiffSet, bool) {
+	if p.selected < 0 || p.selected >= len(p.diffs) {
+		return types.FileDiffSet{}, false
+	}
+	return p.diffs[p.selected], true
+}
+
+func (p *DiffPanel) patchLines() []string {
+	diff, ok := p.current()
+	if !ok || p.file >= len(diff.Files) {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(diff.Files[p.file].Patch, "\n"), "\n")
+}
+
+// patchHeight is how many patch lines fit below the header, file list and footer
+func (p *DiffPanel) patchHeight() int {
+	diff, _ := p.current()
+	return max(1, p.height-len(diff.Files)-5)
+}
+
+func (p *DiffPanel) scrollBy(delta int) {
+	maxScroll := max(0, len(p.patchLines())-p.patchHeight())
+	p.scroll = min(maxScroll, max(0, p.scroll+delta))
+}
+
+// clip cuts a line to the panel width so long lines do not wrap
+func (p *DiffPanel) clip(line string) string {
+	line = strings.ReplaceAll(line, "\t", "    ")
+	if p.width <= 0 {
+		return line
+	}
+	runes := []rune(line)
+	if len(runes) <= p.width {
+		return line
+	}
+	return string(runes[:p.width-1]) + "…"
+}
+
+// Message types
+type ConnectedMsg struct{}
+
+type StateLoadedMsg struct {
+	Diffs []types.FileDiffSet
+}
+
+type EventMsg struct {
+	Event types.StateEvent
+}
+
+type ActionSentMsg struct {
+	Notice string
+}
+
+type ErrorMsg struct {
+	Error error
+}
+
+// decodePayload converts a payload decoded from JSON into a specific struct type
+func decodePayload(data interface{}, target interface{}) error {
+	bytes, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal payload map: %w", err)
+	}
+	if err := json.Unmarshal(bytes, target); err != nil {
+		return fmt.Errorf("failed to unmarshal payload into target struct: %w", err)
+	}
+	return nil
+}
+
+func Run(ctx context.Context, cfg RunConfig) error {
+	logDir := cfg.LogDir
+	if logDir == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("resolve home dir: %w", err)
+		}
+		logDir = filepath.Join(homeDir, ".opencode")
+	}
+	if err := os.MkdirAll(logDir, 0o755); err != nil {
+		return fmt.Errorf("create log directory: %w", err)
+	}
+
+	logPath := filepath.Join(logDir, "diff.log")
+	logFile, err := os.OpenFile(logPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("open log file: %w", err)
+	}
+	defer logFile.Close()
+
+	log.SetOutput(logFile)
+	log.SetFlags(log.LstdFlags | log.Lshortfile)
+
+	socketPath := cfg.SocketPath
+	if socketPath == "" {
+		homeDir, err := os.UserHomeDir()
+		if err != nil {
+			return fmt.Errorf("resolve home dir: %w", err)
+		}
+		socketPath = filepath.Join(homeDir, ".opencode", "ipc.sock")
+	}
+
+	if !cfg.DisableThemeLoader {
+		if err := theme.LoadThemesFromJSON(); err != nil {
+			return fmt.Errorf("load themes: %w", err)
+		}
+	}
+
+	themeName := cfg.DefaultTheme
+	if themeName == "" {
+		themeName = "opencode"
+	}
+	if err := theme.SetTheme(themeName); err != nil {
+		return fmt.Errorf("set theme: %w", err)
+	}
+
+	panel := NewDiffPanel(ctx, socketPath)
+
+	program := tea.NewProgram(
+		panel,
+		tea.WithAltScreen(),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			log.Printf("Context cancelled, shutting down diff panel: %v", ctx.Err())
+			panel.cancel()
+			program.Quit()
+		case <-done:
+		}
+	}()
+
+	_, err = program.Run()
+	close(done)
+
+	panel.ipcClient.Disconnect()
+	panel.cancel()
+
+	if err != nil {
+		return fmt.Errorf("diff panel run: %w", err)
+	}
+
+	return nil
+}
@@ -7,21 +7,28 @@ import (
 	"fmt"
 	"io/fs"
 	"log"
+	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea/v2"
 	"github.com/mattn/go-runewidth"
+	"github.com/opencode/tmux_coder/internal/agentroute"
+	"github.com/opencode/tmux_coder/internal/ids"
 	"github.com/opencode/tmux_coder/internal/ipc"
+	"github.com/opencode/tmux_coder/internal/modelpolicy"
 	"github.com/opencode/tmux_coder/internal/panel"
 	"github.com/opencode/tmux_coder/internal/state"
 	"github.com/opencode/tmux_coder/internal/styles"
 	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/opencode/tmux_coder/internal/timefmt"
 	"github.com/opencode/tmux_coder/internal/types"
 	"github.com/sst/opencode-sdk-go"
 	"github.com/sst/opencode-sdk-go/option"
@@ -66,6 +73,10 @@ func DefaultRunConfig() (RunConfig, error) {
 		cfg.SocketPath = filepath.Join(cfg.LogDir, "ipc.sock")
 	}
 
+	if err := timefmt.ConfigureFromEnv(); err != nil {
+		return cfg, fmt.Errorf("display settings: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -295,6 +306,31 @@ type InputPanel struct {
 	currentProvider string // Current selected provider
 	currentModel    string // Current selected model
 	promptTimeout   time.Duration
+	// File browser state; attached files are sent with the next prompt
+	fileTree types.FileTreeState
+	// Code position attached with /at and the language server context gathered for it
+	location      *types.CodeLocation
+	promptContext *types.PromptContext
+	// Retry and fallback policy for provider errors
+	modelPolicy types.ModelPolicy
+	// Agents prompts starting with a mention are routed to
+	agentRoutes map[string]string
+	// Templates offered by /template, as configured
+	sessionTemplates []types.SessionTemplate
+	// Context window usage of the current session, shown with the model
+	contextUsage *types.ContextUsage
+	// Health of the opencode server and panel links; nil until first probed
+	connection *types.ConnectionState
+	// Prompts in flight by run cancel token; several can run at once
+	runsMu     sync.Mutex
+	runCancels map[string]context.CancelFunc
+	// Runs in flight in every session, by run ID, and the prompts queued
+	// behind them; guarded by runsMu
+	activeRuns  map[string]string
+	promptQueue []types.QueuedPrompt
+	// Confirmation tokens for destructive commands the user was asked to repeat
+	confirmMu     sync.Mutex
+	confirmTokens map[string]string
 }
 
 var completionSuggestions = []string{
@@ -302,10 +338,13 @@ var completionSuggestions = []string{
 	"models",
 	"agents",
 	"clear",
+	"at",
 	// "agent",
 	// "share",
 	// "unshare",
 	"compact",
+	"queue",
+	"template",
 }
 
 const (
@@ -357,14 +396,48 @@ func NewInputPanel(parent context.Context, httpClient *opencode.Client, socketPa
 		comfortableThemes: comfortableThemes,
 		currentThemeIndex: currentIndex,
 		promptTimeout:     promptTimeout,
+		runCancels:        make(map[string]context.CancelFunc),
+		activeRuns:        make(map[string]string),
 	}
 
+	panel.ipcClient.SetIdentity(os.Getenv(ipc.PanelIdentityEnv))
+
+	// Dialogs opened from the TUI API and remotely run commands are handled here
+	panel.ipcClient.SetCapabilities(types.PanelCapabilities{UIActions: []types.UIAction{
+		types.UIActionOpenModelPicker,
+		types.UIActionOpenAgentPicker,
+		types.UIActionOpenTemplatePicker,
+		types.UIActionRunCommand,
+		types.UIActionFocusPane,
+	}})
+
+	// The sessions and settings are read from the cache; a cache that
+	// diverged from the server's state is resynced
+	panel.ipcClient.SetStateView(panel.cachedChecksums)
+
 	// Register event handlers
 	panel.ipcClient.RegisterEventHandler(state.EventInputUpdated, panel.handleInputUpdated)
 	panel.ipcClient.RegisterEventHandler(state.EventCursorMoved, panel.handleCursorMoved)
 	panel.ipcClient.RegisterEventHandler(state.EventSessionChanged, panel.handleSessionChanged)
 	panel.ipcClient.RegisterEventHandler(state.EventStateSync, panel.handleStateSync)
 	panel.ipcClient.RegisterEventHandler(types.EventUIActionTriggered, panel.handleUIActionTriggered)
+	panel.ipcClient.RegisterEventHandler(types.EventFileTreeChanged, panel.handleFileTreeChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventInputLocationChanged, panel.handleInputLocationChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventPromptContextUpdated, panel.handlePromptContextUpdated)
+	panel.ipcClient.RegisterEventHandler(types.EventRunCancelled, panel.handleRunCancelled)
+	panel.ipcClient.RegisterEventHandler(types.EventRunStarted, panel.handleRunStarted)
+	panel.ipcClient.RegisterEventHandler(types.EventRunFinished, panel.handleRunFinished)
+	panel.ipcClient.RegisterEventHandler(types.EventPromptQueued, panel.handlePromptQueueEvent)
+	panel.ipcClient.RegisterEventHandler(types.EventPromptDequeued, panel.handlePromptQueueEvent)
+	panel.ipcClient.RegisterEventHandler(types.EventPromptQueueReordered, panel.handlePromptQueueEvent)
+	panel.ipcClient.RegisterEventHandler(types.EventModelPolicyChanged, panel.handleModelPolicyChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventAgentRoutesChanged, panel.handleAgentRoutesChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventSessionTemplatesChanged, panel.handleSessionTemplatesChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventModelChanged, panel.handleModelChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventAgentChanged, panel.handleAgentChanged)
+	panel.ipcClient.RegisterEventHandler(types.EventContextUsageUpdated, panel.handleContextUsage)
+	panel.ipcClient.RegisterEventHandler(types.EventContextThreshold, panel.handleContextUsage)
+	panel.ipcClient.RegisterEventHandler(types.EventConnectivityChanged, panel.handleConnectivityChanged)
 	// Wildcard handler for diagnostics: log all incoming events
 	panel.ipcClient.RegisterEventHandler(types.StateEventType("*"), panel.handleAnyEvent)
 
@@ -453,6 +526,9 @@ func (p *InputPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			p.cachedState = msg.State
 
 			p.currentSessionID = msg.State.CurrentSessionID
+			p.fileTree = msg.State.GetFileTree()
+			p.location = msg.State.Input.Location
+			p.promptContext = msg.State.GetPromptContext()
 
 			// Get session title for the current session
 			if sessionInfo, found := msg.State.GetSessionByID(p.currentSessionID); found {
@@ -473,6 +549,15 @@ func (p *InputPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Update current model information
 			p.currentProvider = msg.State.Provider
 			p.currentModel = msg.State.Model
+			p.modelPolicy = msg.State.GetModelPolicy()
+			p.agentRoutes = msg.State.GetAgentRoutes()
+			p.sessionTemplates = msg.State.GetSessionTemplates()
+			p.contextUsage = nil
+			if usage, ok := msg.State.GetContextUsage(); ok {
+				p.contextUsage = &usage
+			}
+			p.connection = msg.State.GetConnectionState()
+			p.loadRuns(msg.State)
 			log.Printf("[INPUT] Model info loaded: Provider='%s', Model='%s'", p.currentProvider, p.currentModel)
 		} else {
 			log.Printf("[INPUT] No state available, using defaults")
@@ -547,6 +632,17 @@ func (p *InputPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		log.Printf("Input panel error: %v", msg.Error)
 		return p, nil
 
+	case OpenTemplatePickerMsg:
+		return p, p.openTemplatePicker()
+
+	case RunCommandMsg:
+		// Runs as if typed, then puts back whatever was being typed
+		draft, cursor := p.buffer, p.cursorPosition
+		p.buffer = strings.Join(append([]string{"/" + strings.TrimPrefix(msg.Command, "/")}, msg.Args...), " ")
+		model, cmd := p.handleCommand()
+		p.buffer, p.cursorPosition = draft, cursor
+		return model, cmd
+
 	case InfoMsg:
 		log.Printf("Input panel info: %s", msg.Message)
 		// If this is a model change message, trigger a state request to update UI
@@ -805,6 +901,12 @@ func (p *InputPanel) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		// Cycle through comfortable themes
 		return p.cycleTheme()
 
+	case "ctrl+x":
+		return p, p.editInEditor()
+
+	case "ctrl+y":
+		return p.editLastQueued()
+
 	case "f1":
 		p.showHelp = !p.showHelp
 		// Reset scroll state when toggling help
@@ -885,6 +987,9 @@ func (p *InputPanel) handleCompletionDialogKeys(msg tea.KeyMsg) (tea.Model, tea.
 		// Select current command
 		if p.completionSelectedIdx < len(p.completionCommands) {
 			selectedCommand := p.completionCommands[p.completionSelectedIdx]
+			if selectedCommand == "template" {
+				return p, p.openTemplatePicker()
+			}
 			p.showCompletionDialog = false
 			// Replace the "/" with the selected command
 			p.buffer = "/" + selectedCommand
@@ -913,6 +1018,9 @@ func (p *InputPanel) handleCompletionDialogKeys(msg tea.KeyMsg) (tea.Model, tea.
 		// Tab also selects the current command
 		if p.completionSelectedIdx < len(p.completionCommands) {
 			selectedCommand := p.completionCommands[p.completionSelectedIdx]
+			if selectedCommand == "template" {
+				return p, p.openTemplatePicker()
+			}
 			p.showCompletionDialog = false
 			// Replace the "/" with the selected command
 			p.buffer = "/" + selectedCommand
@@ -1108,7 +1216,7 @@ func (p *InputPanel) updateCompletionScrollOffset() {
 // handleTab processes tab completion
 func (p *InputPanel) handleTab() (tea.Model, tea.Cmd) {
 	if strings.HasPrefix(p.buffer, "/") {
-		commands := []string{"/help", "/clear", "/session", "/new", "/delete", "/theme", "/model", "/models", "/agent", "/agents"}
+		commands := []string{"/help", "/clear", "/session", "/new", "/delete", "/theme", "/model", "/models", "/agent", "/agents", "/at", "/template"}
 
 		for _, cmd := range commands {
 			if strings.HasPrefix(cmd, p.buffer) && len(cmd) > len(p.buffer) {
@@ -1291,6 +1399,12 @@ func (p *InputPanel) handleCommand() (tea.Model, tea.Cmd) {
 		}
 	case "/compact":
 		cmdToExecute = p.compactCurrentSession()
+	case "/at":
+		cmdToExecute = p.attachLocation(args)
+	case "/queue":
+		cmdToExecute = p.queueCommand(args)
+	case "/template":
+		cmdToExecute = p.templateCommand(args)
 	}
 	// Combine input state sync with the command execution
 	if cmdToExecute != nil {
@@ -1437,6 +1551,9 @@ func (p *InputPanel) sendMessage() tea.Cmd {
 	}
 
 	if p.currentSessionID != "" {
+		if p.shouldQueue(p.currentSessionID) {
+			return p.queuePrompt(message, p.currentSessionID)
+		}
 		return p.makeSendCommand(message, p.currentSessionID)
 	}
 
@@ -1452,62 +1569,168 @@ func (p *InputPanel) sendMessage() tea.Cmd {
 func (p *InputPanel) makeSendCommand(message, sessionID string) tea.Cmd {
 	return func() tea.Msg {
 		p.addToHistory(message)
+		attached := append([]string(nil), p.fileTree.Attached...)
+		location := p.location
+		codeContext := ""
+		if location != nil && p.promptContext != nil && p.promptContext.Location == *location {
+			codeContext = p.promptContext.Render()
+		}
+
+		// Shared state only records the submission, for the audit log and macro recording
+		submitted := types.StateUpdate{
+			Type:        types.PromptSubmitted,
+			Payload:     types.PromptSubmitPayload{SessionID: sessionID, Text: message, Files: attached},
+			SourcePanel: "input-panel",
+			Timestamp:   time.Now(),
+		}
+		if _, err := p.sendUpdateWithRetry(submitted); err != nil {
+			log.Printf("[INPUT] Failed to record prompt submission: %v", err)
+		}
+
+		// Attachments go with one prompt only
+		if len(attached) > 0 {
+			cleared := types.StateUpdate{
+				Type:        types.FileTreeChanged,
+				Payload:     types.FileTreeUpdatePayload{Action: types.FileTreeClearAttached},
+				SourcePanel: "input-panel",
+				Timestamp:   time.Now(),
+			}
+			if _, err := p.sendUpdateWithRetry(cleared); err != nil {
+				log.Printf("[INPUT] Failed to clear attached files: %v", err)
+			}
+		}
+
+		// The location goes with one prompt too
+		if location != nil {
+			detached := types.StateUpdate{
+				Type:        types.InputLocationChanged,
+				Payload:     types.InputLocationPayload{},
+				SourcePanel: "input-panel",
+				Timestamp:   time.Now(),
+			}
+			if _, err := p.sendUpdateWithRetry(detached); err != nil {
+				log.Printf("[INPUT] Failed to detach code location: %v", err)
+			}
+		}
+
+		var parts []opencode.SessionPromptParamsPartUnion
+		if codeContext != "" {
+			parts = append(parts, opencode.TextPartInputParam{
+				Text:      opencode.F(codeContext),
+				Type:      opencode.F(opencode.TextPartInputTypeText),
+				Synthetic: opencode.F(true),
+			})
+		}
+		// A leading mention routes the prompt to another agent and is not sent
+		agent, prompt := agentroute.Route(message, p.agentRoutes)
+		parts = append(parts, opencode.TextPartInputParam{
+			Text: opencode.F(prompt),
+			Type: opencode.F(opencode.TextPartInputTypeText),
+		})
+		for _, path := range attached {
+			parts = append(parts, filePartInput(path))
+		}
 
 		timeout := p.promptTimeout
+		policy := p.modelPolicy
+		instructions := p.sessionInstructions(sessionID)
+		primary := types.ModelRef{ProviderID: p.currentProvider, ModelID: p.currentModel}
 
-		go func(session, userMsg string, wait time.Duration) {
+		go func(session string, wait time.Duration) {
 			parentCtx := p.ctx
 			if parentCtx == nil {
 				parentCtx = context.Background()
 			}
-
-			var (
-				ctx    context.Context
-				cancel context.CancelFunc
-			)
-			if wait > 0 {
-				ctx, cancel = context.WithTimeout(parentCtx, wait)
-			} else {
-				ctx, cancel = context.WithCancel(parentCtx)
-			}
+			ctx, cancel := context.WithCancel(parentCtx)
 			defer cancel()
 
-			response, err := p.client.Session.Prompt(ctx, session, opencode.SessionPromptParams{
-				Parts: opencode.F([]opencode.SessionPromptParamsPartUnion{
-					opencode.TextPartInputParam{
-						Text: opencode.F(userMsg),
-						Type: opencode.F(opencode.TextPartInputTypeText),
-					},
-				}),
+			run := types.NewAgentRun(session, "input-panel")
+			p.runsMu.Lock()
+			p.runCancels[run.CancelToken] = cancel
+			p.runsMu.Unlock()
+			defer func() {
+				p.runsMu.Lock()
+				delete(p.runCancels, run.CancelToken)
+				p.runsMu.Unlock()
+			}()
+			p.sendRunUpdate(types.RunStarted, types.RunStartedPayload{Run: run})
+
+			// The timeout applies to each attempt, so a timed out attempt can be retried
+			var response *opencode.SessionPromptResponse
+			err := modelpolicy.Run(ctx, policy, primary, func(ctx context.Context, model types.ModelRef) error {
+				if wait > 0 {
+					var stop context.CancelFunc
+					ctx, stop = context.WithTimeout(ctx, wait)
+					defer stop()
+				}
+				params := opencode.SessionPromptParams{Parts: opencode.F(parts)}
+				if agent != "" {
+					params.Agent = opencode.F(agent)
+				}
+				if instructions != "" {
+					params.System = opencode.F(instructions)
+				}
+				if !model.IsZero() {
+					params.Model = opencode.F(opencode.SessionPromptParamsModel{
+						ProviderID: opencode.F(model.ProviderID),
+						ModelID:    opencode.F(model.ModelID),
+					})
+				}
+				var err error
+				if response, err = p.client.Session.Prompt(ctx, session, params); err != nil {
+					return err
+				}
+				return modelpolicy.ResponseError(response)
+			}, func(attempt types.RunAttempt) {
+				p.sendRunUpdate(types.RunAttempted, types.RunAttemptedPayload{RunID: run.ID, Attempt: attempt})
 			})
 
+			finished := types.RunFinishedPayload{RunID: run.ID, FinishedAt: time.Now()}
+			if err != nil {
+				finished.Error = err.Error()
+			}
+			if response != nil {
+				finished.MessageID = response.Info.ID
+			}
+			p.sendRunUpdate(types.RunFinished, finished)
+
 			if err != nil {
-				if errors.Is(err, context.DeadlineExceeded) && wait > 0 {
+				switch {
+				case errors.Is(err, context.Canceled):
+					log.Printf("[INPUT] Prompt run %s cancelled", run.ID)
+				case errors.Is(err, context.DeadlineExceeded) && wait > 0:
 					log.Printf("[INPUT] Prompt request timed out after %s", wait)
-				} else {
-					log.Printf("[INPUT] Failed to send message to OpenCode API: %v", err)
+				default:
+					log.Printf("[INPUT] Prompt run %s failed: %v", run.ID, err)
 				}
 				return
 			}
 
 			log.Printf("[INPUT] Successfully sent message to OpenCode API, response received")
-
-			if response == nil {
-				return
-			}
-
-			if response.Info.Error.Name != "" {
-				log.Printf("[INPUT] Assistant message error: %s - %v", response.Info.Error.Name, response.Info.Error.Data)
-			}
-		}(sessionID, message, timeout)
+		}(sessionID, timeout)
 
 		return MessageSentMsg{}
 	}
 }
 
+// filePartInput references a workspace file from a prompt; opencode reads it
+// when the prompt is processed
+func filePartInput(path string) opencode.FilePartInputParam {
+	mimeType := mime.TypeByExtension(filepath.Ext(path))
+	if mimeType == "" {
+		mimeType = "text/plain"
+	}
+	return opencode.FilePartInputParam{
+		Type:     opencode.F(opencode.FilePartInputTypeFile),
+		Mime:     opencode.F(mimeType),
+		URL:      opencode.F("file://" + path),
+		Filename: opencode.F(filepath.Base(path)),
+	}
+}
+
 func (p *InputPanel) createSessionAndSend(message string) tea.Cmd {
 	return func() tea.Msg {
-		title := fmt.Sprintf("New Session %s", time.Now().Format("15:04:05"))
+		title := fmt.Sprintf("New Session %s", timefmt.Clock(time.Now()))
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
@@ -1673,17 +1896,29 @@ func (p *InputPanel) handleSessionChanged(event types.StateEvent) error {
 	return nil
 }
 
+// cachedChecksums checksums the sections of the cached state the panel reads
+func (p *InputPanel) cachedChecksums() (int64, types.StateChecksums) {
+	if p.cachedState == nil {
+		return 0, nil
+	}
+	return p.version, p.cachedState.Checksums(types.ChecksumSessions, types.ChecksumSettings)
+}
+
 func (p *InputPanel) handleStateSync(event types.StateEvent) error {
 	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
 		var payload types.StateSyncPayload
 		if err := decodePayload(payloadMap, &payload); err == nil {
-			// Update cached state with smart invalidation
-			if p.cachedState == nil || payload.State.Version.Version > p.version {
+			// Update cached state with smart invalidation; a repair replaces
+			// a diverged cache at the version it is at
+			if p.cachedState == nil || payload.State.Version.Version > p.version || len(payload.Sections) > 0 {
 				p.cachedState = payload.State
 				p.version = payload.State.Version.Version
 				log.Printf("[INPUT] Cache updated to version %d", p.version)
 
 				p.currentSessionID = payload.State.CurrentSessionID
+				p.fileTree = payload.State.GetFileTree()
+				p.location = payload.State.Input.Location
+				p.promptContext = payload.State.PromptContext
 				p.buffer = payload.State.Input.Buffer
 				p.cursorPosition = payload.State.Input.CursorPosition
 				p.selectionStart = payload.State.Input.SelectionStart
@@ -1695,6 +1930,15 @@ func (p *InputPanel) handleStateSync(event types.StateEvent) error {
 				// Update current model information
 				p.currentProvider = payload.State.Provider
 				p.currentModel = payload.State.Model
+				p.modelPolicy = payload.State.GetModelPolicy()
+				p.agentRoutes = payload.State.GetAgentRoutes()
+				p.sessionTemplates = payload.State.GetSessionTemplates()
+				p.contextUsage = nil
+				if usage, ok := payload.State.GetContextUsage(); ok {
+					p.contextUsage = &usage
+				}
+				p.connection = payload.State.GetConnectionState()
+				p.loadRuns(payload.State)
 				log.Printf("[INPUT] Model info updated: Provider='%s', Model='%s'", p.currentProvider, p.currentModel)
 
 				// Update session title when we receive state sync
@@ -1732,67 +1976,601 @@ func (p *InputPanel) handleStateSync(event types.StateEvent) error {
 	return nil
 }
 
-// handleUIActionTriggered handles UI action triggered events
-func (p *InputPanel) handleUIActionTriggered(event types.StateEvent) error {
-	log.Printf("[INPUT] Received UI action triggered event: %+v", event)
+// handleFileTreeChanged mirrors file browser changes so attached files can be
+// sent with the next prompt
+func (p *InputPanel) handleFileTreeChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.FileTreeUpdatePayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		if err := p.fileTree.Apply(payload); err != nil {
+			log.Printf("[INPUT] Ignoring file tree change %q: %v", payload.Action, err)
+		}
+		p.version = event.Version
+	}
+	return nil
+}
 
-	// Extract action from the event payload
+// handleInputLocationChanged tracks the code location attached to the input
+func (p *InputPanel) handleInputLocationChanged(event types.StateEvent) error {
 	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
-		if actionRaw, exists := payloadMap["action"]; exists {
-			if action, ok := actionRaw.(string); ok {
-				log.Printf("[INPUT] UI action: %s", action)
-
-				// Handle open_models action by showing model selection dialog
-				if action == "open_models" {
-					cmd := p.openModelDialog()
-					if p.program != nil {
-						p.program.Send(InfoMsg{Message: "Model selection dialog opened"})
-					}
-					if cmd != nil {
-						go func() {
-							msg := cmd()
-							if msg == nil {
-								return
-							}
-							if p.program != nil {
-								p.program.Send(msg)
-								return
-							}
-							log.Printf("[MODEL_DIALOG] Dropped message because program is nil: %#v", msg)
-						}()
-					}
-				}
+		var payload types.InputLocationPayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		if payload.Location == nil || p.promptContext == nil || p.promptContext.Location != *payload.Location {
+			p.promptContext = nil
+		}
+		p.location = payload.Location
+		p.version = event.Version
+	}
+	return nil
+}
 
-				// Handle open_agents action by showing agent selection dialog
-				if action == "open_agents" {
-					cmd := p.openAgentDialog()
-					if p.program != nil {
-						p.program.Send(InfoMsg{Message: "Agent selection dialog opened"})
-					}
-					if cmd != nil {
-						go func() {
-							msg := cmd()
-							if msg == nil {
-								return
-							}
-							if p.program != nil {
-								p.program.Send(msg)
-								return
-							}
-							log.Printf("[AGENT_DIALOG] Dropped message because program is nil: %#v", msg)
-						}()
-					}
+// handlePromptContextUpdated keeps the context gathered for the attached location
+func (p *InputPanel) handlePromptContextUpdated(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.PromptContextPayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		if p.location != nil && *p.location == payload.Context.Location {
+			p.promptContext = &payload.Context
+		}
+		p.version = event.Version
+		if payload.Context.Error != "" {
+			log.Printf("[INPUT] No code context for %s: %s", payload.Context.Location, payload.Context.Error)
+		}
+	}
+	return nil
+}
+
+// handleModelChanged follows model selections, from this panel or another,
+// and the per-agent defaults they set
+func (p *InputPanel) handleModelChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.ModelChangePayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		if p.cachedState != nil {
+			if payload.Agent == p.cachedState.Agent {
+				p.cachedState.Provider, p.cachedState.Model = payload.Provider, payload.Model
+			}
+			if payload.Agent != "" && payload.Provider != "" && payload.Model != "" {
+				if p.cachedState.AgentModel == nil {
+					p.cachedState.AgentModel = map[string]string{}
 				}
+				p.cachedState.AgentModel[payload.Agent] = payload.Provider + "/" + payload.Model
+			}
+		}
+		if p.cachedState == nil || payload.Agent == p.cachedState.Agent {
+			p.currentProvider, p.currentModel = payload.Provider, payload.Model
+		}
+		p.version = event.Version
+	}
+	return nil
+}
+
+// handleAgentChanged switches to the new agent's default model, when it has one
+func (p *InputPanel) handleAgentChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.AgentChangePayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		if p.cachedState != nil {
+			p.cachedState.Agent = payload.Agent
+		}
+		if payload.Provider != "" && payload.Model != "" {
+			p.currentProvider, p.currentModel = payload.Provider, payload.Model
+			if p.cachedState != nil {
+				p.cachedState.Provider, p.cachedState.Model = payload.Provider, payload.Model
+			}
+		}
+		p.version = event.Version
+	}
+	return nil
+}
+
+// handleModelPolicyChanged follows the retry and fallback policy set by the orchestrator
+func (p *InputPanel) handleModelPolicyChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.ModelPolicyPayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		p.modelPolicy = types.ModelPolicy{}
+		if payload.Policy != nil {
+			p.modelPolicy = *payload.Policy
+		}
+		p.version = event.Version
+	}
+	return nil
+}
+
+// handleAgentRoutesChanged follows the agent routes set by the orchestrator
+func (p *InputPanel) handleAgentRoutesChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.AgentRoutesPayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		p.agentRoutes = payload.Routes
+		p.version = event.Version
+	}
+	return nil
+}
+
+// handleSessionTemplatesChanged follows the session templates set by the orchestrator
+func (p *InputPanel) handleSessionTemplatesChanged(event types.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.SessionTemplatesPayload
+		if err := decodePayload(payloadMap, &payload); err != nil {
+			return err
+		}
+		p.sessionTemplates = payload.Templates
+		p.version = event.Version
+	}
+	return nil
+}
+
+// contextText describes how full the current session's context window is, or
+// returns "" when it is unknown
+func (p *InputPanel) contextText() string {
+	usage := p.contextUsage
+	if usage == nil || usage.Limit <= 0 || usage.SessionID != p.currentSessionID {
+		return ""
+	}
+	text := fmt.Sprintf(" | Context: %.0f%%", usage.Percent())
+	if usage.Estimated {
+		text = fmt.Sprintf(" | Context: ~%.0f%%", usage.Percent())
+	}
+	switch usage.Level {
+	case types.ContextLevelWarning:
+		text += " (nearing limit)"
+	case types.ContextLevelCritical:
+		text += " (compact or start a new session)"
+	}
+	return text
+}
+
+// handleContextUsage follows the context window usage measured by the
+// orchestrator; a threshold event carries the usage that crossed it
+func (p *InputPanel) handleContextUsage(event types.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.ContextUsagePayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	usage := payload.Usage
+	p.contextUsage = &usage
+	p.version = event.Version
+	if event.Type == types.EventContextThreshold {
+		log.Printf("[INPUT] Context window %s: %.0f%% of %d tokens used", usage.Level, usage.Percent(), usage.Limit)
+	}
+	return nil
+}
 
+// handleConnectivityChanged follows the link health probed by the orchestrator
+func (p *InputPanel) handleConnectivityChanged(event types.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.ConnectivityChangedPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	p.connection = &payload.Connection
+	p.version = event.Version
+	for _, t := range payload.Transitions {
+		log.Printf("[INPUT] %s link %s is %s %s", t.Kind, t.Name, t.To, t.Error)
+	}
+	return nil
+}
+
+// connectionText describes links that are not online, or returns "" when
+// all are
+func (p *InputPanel) connectionText() string {
+	connection := p.connection
+	if connection == nil || connection.Status == types.LinkOnline {
+		return ""
+	}
+	if connection.Server.Status != types.LinkOnline {
+		return fmt.Sprintf(" | Server %s", connection.Server.Status)
+	}
+	var panels []string
+	for _, panel := range connection.Panels {
+		if panel.Status != types.LinkOnline {
+			panels = append(panels, fmt.Sprintf("%s %s", panel.Name, panel.Status))
+		}
+	}
+	return " | Panels: " + strings.Join(panels, ", ")
+}
+
+// handleRunCancelled drops the request of a cancelled run started by this panel
+func (p *InputPanel) handleRunCancelled(event types.StateEvent) error {
+	var payload types.RunCancelledPayload
+	switch data := event.Data.(type) {
+	case types.RunCancelledPayload:
+		payload = data
+	case map[string]interface{}:
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	p.runsMu.Lock()
+	cancel, ok := p.runCancels[payload.CancelToken]
+	delete(p.activeRuns, payload.RunID)
+	p.runsMu.Unlock()
+	if ok {
+		cancel()
+	}
+	return nil
+}
+
+// loadRuns takes the runs in flight and the prompt queue from a full state
+func (p *InputPanel) loadRuns(st *types.SharedApplicationState) {
+	active := make(map[string]string)
+	for _, run := range st.GetActiveRuns("") {
+		active[run.ID] = run.SessionID
+	}
+	p.runsMu.Lock()
+	p.activeRuns = active
+	p.promptQueue = st.GetPromptQueue("")
+	p.runsMu.Unlock()
+}
+
+// handleRunStarted notes a run in flight, from any panel, so prompts sent to
+// its session meanwhile are queued
+func (p *InputPanel) handleRunStarted(event types.StateEvent) error {
+	var payload types.RunStartedPayload
+	switch data := event.Data.(type) {
+	case types.RunStartedPayload:
+		payload = data
+	case map[string]interface{}:
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	p.runsMu.Lock()
+	p.activeRuns[payload.Run.ID] = payload.Run.SessionID
+	p.runsMu.Unlock()
+	return nil
+}
+
+func (p *InputPanel) handleRunFinished(event types.StateEvent) error {
+	var payload types.RunFinishedPayload
+	switch data := event.Data.(type) {
+	case types.RunFinishedPayload:
+		payload = data
+	case map[string]interface{}:
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	p.runsMu.Lock()
+	delete(p.activeRuns, payload.RunID)
+	p.runsMu.Unlock()
+	return nil
+}
+
+// handlePromptQueueEvent mirrors changes to the prompt queue
+func (p *InputPanel) handlePromptQueueEvent(event types.StateEvent) error {
+	data, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	p.runsMu.Lock()
+	defer p.runsMu.Unlock()
+	switch event.Type {
+	case types.EventPromptQueued:
+		var payload types.PromptQueuedPayload
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+		for i := range p.promptQueue {
+			if p.promptQueue[i].ID == payload.Prompt.ID {
+				p.promptQueue[i] = payload.Prompt
 				return nil
 			}
 		}
+		p.promptQueue = append(p.promptQueue, payload.Prompt)
+	case types.EventPromptDequeued:
+		var payload types.PromptDequeuedPayload
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+		p.promptQueue = slices.DeleteFunc(p.promptQueue, func(prompt types.QueuedPrompt) bool {
+			return prompt.ID == payload.PromptID
+		})
+	case types.EventPromptQueueReordered:
+		var payload types.PromptQueueReorderPayload
+		if err := decodePayload(data, &payload); err != nil {
+			return err
+		}
+		queue, err := types.ReorderPromptQueue(p.promptQueue, payload)
+		if err != nil {
+			return err
+		}
+		p.promptQueue = queue
+	}
+	p.version = event.Version
+	return nil
+}
+
+// queuedPrompts returns the prompts queued for a session, in queue order
+func (p *InputPanel) queuedPrompts(sessionID string) []types.QueuedPrompt {
+	p.runsMu.Lock()
+	defer p.runsMu.Unlock()
+	return types.PromptsQueuedFor(p.promptQueue, sessionID)
+}
+
+// shouldQueue reports whether a prompt for the session has to wait: a run
+// is in flight there, or earlier prompts are already waiting
+func (p *InputPanel) shouldQueue(sessionID string) bool {
+	p.runsMu.Lock()
+	defer p.runsMu.Unlock()
+	for _, runSession := range p.activeRuns {
+		if runSession == sessionID {
+			return true
+		}
+	}
+	return len(types.PromptsQueuedFor(p.promptQueue, sessionID)) > 0
+}
+
+// queuePrompt puts a prompt in the queue for the orchestrator to submit once
+// the session's runs finish. Only the text is queued: attached files and the
+// code location stay for the next prompt sent directly.
+func (p *InputPanel) queuePrompt(message, sessionID string) tea.Cmd {
+	p.addToHistory(message)
+	p.buffer = ""
+	p.cursorPosition = 0
+	p.selectionStart = 0
+	p.selectionEnd = 0
+	prompt := types.QueuedPrompt{ID: ids.New("queued"), SessionID: sessionID, Text: message, QueuedBy: "input-panel"}
+	waiting := len(p.queuedPrompts(sessionID)) + 1
+	return tea.Batch(p.syncInputState(), func() tea.Msg {
+		update := types.StateUpdate{
+			Type:        types.PromptQueued,
+			Payload:     types.PromptQueuedPayload{Prompt: prompt},
+			SourcePanel: "input-panel",
+			Timestamp:   time.Now(),
+		}
+		if _, err := p.sendUpdateWithRetry(update); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to queue prompt: %w", err)}
+		}
+		return InfoMsg{Message: fmt.Sprintf("Queued (%d waiting); sent when the current run finishes", waiting)}
+	})
+}
+
+// editLastQueued takes the last prompt queued for the current session out of
+// the queue and into the empty input, to be edited and sent again
+func (p *InputPanel) editLastQueued() (tea.Model, tea.Cmd) {
+	queued := p.queuedPrompts(p.currentSessionID)
+	if len(queued) == 0 {
+		return p, nil
+	}
+	if strings.TrimSpace(p.buffer) != "" {
+		return p, func() tea.Msg {
+			return ErrorMsg{Error: fmt.Errorf("clear the input before taking back a queued prompt")}
+		}
+	}
+	last := queued[len(queued)-1]
+	update := types.StateUpdate{
+		Type:        types.PromptDequeued,
+		Payload:     types.PromptDequeuedPayload{PromptID: last.ID, Reason: types.DequeueEdited},
+		SourcePanel: "input-panel",
+		Timestamp:   time.Now(),
+	}
+	// Dequeuing first keeps the orchestrator from submitting it meanwhile
+	if _, err := p.sendUpdateWithRetry(update); err != nil {
+		return p, func() tea.Msg {
+			return ErrorMsg{Error: fmt.Errorf("queued prompt already sent: %w", err)}
+		}
+	}
+	p.buffer = last.Text
+	p.cursorPosition = len(p.buffer)
+	p.selectionStart = 0
+	p.selectionEnd = 0
+	return p, p.syncInputState()
+}
+
+// templateCommand creates a session from the named template, titled with the
+// remaining arguments when given, or opens the template picker without a name
+func (p *InputPanel) templateCommand(args []string) tea.Cmd {
+	if len(args) == 0 {
+		return p.openTemplatePicker()
+	}
+	name, title := args[0], strings.Join(args[1:], " ")
+	return func() tea.Msg {
+		session, err := p.ipcClient.CreateSessionFromTemplate(name, title)
+		if err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to create session from template %s: %w", name, err)}
+		}
+		return InfoMsg{Message: fmt.Sprintf("Created session '%s' from template %s", session.Title, name)}
+	}
+}
+
+// openTemplatePicker lists the session templates in the completion dialog;
+// picking one fills in its /template command
+func (p *InputPanel) openTemplatePicker() tea.Cmd {
+	if len(p.sessionTemplates) == 0 {
+		return func() tea.Msg {
+			return InfoMsg{Message: "No session templates configured; add them under templates in the config"}
+		}
+	}
+	p.buffer = "/template "
+	p.cursorPosition = len(p.buffer)
+	p.showCompletionDialog = true
+	p.completionSelectedIdx = 0
+	p.completionScrollOffset = 0
+	p.refreshCompletionCommands()
+	return p.syncInputState()
+}
+
+// sessionInstructions returns the system instructions of a session created
+// from a template. They never change, so a cached copy of the session will do.
+func (p *InputPanel) sessionInstructions(sessionID string) string {
+	if info, ok := p.getSessionInfo(sessionID); ok {
+		return info.Instructions
+	}
+	// Sessions created since the state was cached are not in it
+	current, err := p.ipcClient.RequestState()
+	if err != nil {
+		log.Printf("[INPUT] Failed to look up session %s: %v", sessionID, err)
+		return ""
+	}
+	p.cachedState = current
+	info, _ := current.GetSessionByID(sessionID)
+	return info.Instructions
+}
+
+// queueCommand lists the prompts queued for the current session, or drops or
+// moves to the front the one numbered n in that list
+func (p *InputPanel) queueCommand(args []string) tea.Cmd {
+	queued := p.queuedPrompts(p.currentSessionID)
+	if len(args) == 0 {
+		return func() tea.Msg {
+			if len(queued) == 0 {
+				return InfoMsg{Message: "No prompts queued"}
+			}
+			lines := make([]string, len(queued))
+			for i, prompt := range queued {
+				lines[i] = fmt.Sprintf("%d. %s", i+1, truncateWithEllipsis(strings.Join(strings.Fields(prompt.Text), " "), 60))
+			}
+			return InfoMsg{Message: "Queued: " + strings.Join(lines, " | ")}
+		}
+	}
+
+	n := 0
+	if len(args) == 2 {
+		n, _ = strconv.Atoi(args[1])
+	}
+	if n < 1 || n > len(queued) {
+		return func() tea.Msg {
+			return ErrorMsg{Error: fmt.Errorf("usage: /queue [drop|top <n>] with n from 1 to %d", len(queued))}
+		}
+	}
+	prompt := queued[n-1]
+	var update types.StateUpdate
+	switch args[0] {
+	case "drop":
+		update = types.StateUpdate{Type: types.PromptDequeued, Payload: types.PromptDequeuedPayload{PromptID: prompt.ID, Reason: types.DequeueRemoved}}
+	case "top":
+		if n == 1 {
+			return nil
+		}
+		update = types.StateUpdate{Type: types.PromptQueueReordered, Payload: types.PromptQueueReorderPayload{PromptID: prompt.ID, Before: queued[0].ID}}
+	default:
+		return func() tea.Msg {
+			return ErrorMsg{Error: fmt.Errorf("unknown /queue action %q; use drop or top", args[0])}
+		}
+	}
+	update.SourcePanel = "input-panel"
+	update.Timestamp = time.Now()
+	return func() tea.Msg {
+		if _, err := p.sendUpdateWithRetry(update); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to change the queue: %w", err)}
+		}
+		return nil
+	}
+}
+
+// sendRunUpdate records a prompt run lifecycle change; a cancelled run
+// rejects its late result, which is expected
+func (p *InputPanel) sendRunUpdate(updateType types.UpdateType, payload interface{}) {
+	update := types.StateUpdate{
+		Type:        updateType,
+		Payload:     payload,
+		SourcePanel: "input-panel",
+		Timestamp:   time.Now(),
+	}
+	if _, err := p.sendUpdateWithRetry(update); err != nil {
+		log.Printf("[INPUT] Did not record %s: %v", updateType, err)
+	}
+}
+
+// handleUIActionTriggered handles UI action triggered events
+func (p *InputPanel) handleUIActionTriggered(event types.StateEvent) error {
+	log.Printf("[INPUT] Received UI action triggered event: %+v", event)
+
+	payload, ok := types.UIActionFromEvent(event)
+	if !ok {
+		log.Printf("[INPUT] Failed to extract action from UI action event payload")
+		return nil
 	}
+	log.Printf("[INPUT] UI action: %s", payload.Action)
+
+	switch payload.Action {
+	case types.UIActionOpenModelPicker:
+		p.runDialogCmd(p.openModelDialog(), "Model selection dialog opened", "[MODEL_DIALOG]")
+
+	case types.UIActionOpenAgentPicker:
+		p.runDialogCmd(p.openAgentDialog(), "Agent selection dialog opened", "[AGENT_DIALOG]")
+
+	case types.UIActionOpenTemplatePicker:
+		if p.program != nil {
+			p.program.Send(OpenTemplatePickerMsg{})
+		}
+
+	case types.UIActionRunCommand:
+		var args types.RunCommandArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		if p.program != nil {
+			p.program.Send(RunCommandMsg{Command: args.Command, Args: args.Args})
+		}
 
-	log.Printf("[INPUT] Failed to extract action from UI action event payload")
+	case types.UIActionFocusPane:
+		var args types.FocusPaneArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		if args.Panel == "input" {
+			return panel.FocusOwnPane()
+		}
+
+	default:
+		log.Printf("[INPUT] Unhandled UI action: %s", payload.Action)
+	}
 	return nil
 }
 
+// runDialogCmd runs a dialog command opened from outside the Bubble Tea loop
+// and feeds its result back into the program
+func (p *InputPanel) runDialogCmd(cmd tea.Cmd, info, logPrefix string) {
+	if p.program != nil {
+		p.program.Send(InfoMsg{Message: info})
+	}
+	if cmd == nil {
+		return
+	}
+	go func() {
+		msg := cmd()
+		if msg == nil {
+			return
+		}
+		if p.program != nil {
+			p.program.Send(msg)
+			return
+		}
+		log.Printf("%s Dropped message because program is nil: %#v", logPrefix, msg)
+	}()
+}
+
 // handleAnyEvent logs any received event for diagnostics
 func (p *InputPanel) handleAnyEvent(event types.StateEvent) error {
 	log.Printf("[INPUT] v%v Received event type: %s from %s", event.Version, event.Type, event.SourcePanel)
@@ -1886,14 +2664,25 @@ func (p *InputPanel) clearMessages() tea.Cmd {
 
 		log.Printf("[INPUT] Clearing messages for session %s", p.currentSessionID)
 
+		// Clear shared state first: the server may want the clear confirmed,
+		// and nothing must be deleted until it is
+		confirmKey := string(types.MessagesCleared) + ":" + p.currentSessionID
+		if err := p.ipcClient.SendClearSessionMessages(p.currentSessionID, p.takeConfirmation(confirmKey)); err != nil {
+			var required *ipc.ConfirmationRequiredError
+			if errors.As(err, &required) {
+				return p.awaitConfirmation(confirmKey, required, "Clearing all messages in this session")
+			}
+			log.Printf("[INPUT] Failed to sync clear messages state: %v", err)
+			return ErrorMsg{Error: fmt.Errorf("failed to sync state: %w", err)}
+		}
+
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
 
-		// Try to delete messages from backend (but continue even if it fails)
+		// Then delete messages from backend (state is already cleared, so only log failures)
 		response, err := p.client.Session.ClearMessages(ctx, p.currentSessionID)
 		if err != nil {
-			log.Printf("[INPUT] Backend clear messages failed (continuing with local clear): %v", err)
-			// Don't return error - continue to clear local state
+			log.Printf("[INPUT] Backend clear messages failed: %v", err)
 		} else {
 			cleared := int64(0)
 			if response != nil {
@@ -1906,12 +2695,6 @@ func (p *InputPanel) clearMessages() tea.Cmd {
 			log.Printf("[INPUT] Failed to purge local messages for session %s: %v", p.currentSessionID, err)
 		}
 
-		// Then, send clear messages request via IPC to update local state
-		if err := p.ipcClient.SendClearSessionMessages(p.currentSessionID); err != nil {
-			log.Printf("[INPUT] Failed to sync clear messages state: %v", err)
-			return ErrorMsg{Error: fmt.Errorf("failed to sync state: %w", err)}
-		}
-
 		log.Printf("[INPUT] Successfully cleared messages for session %s", p.currentSessionID)
 
 		// Ensure we have the latest state after clearing
@@ -1942,10 +2725,34 @@ func (p *InputPanel) clearMessages() tea.Cmd {
 	}
 }
 
+// takeConfirmation returns and forgets the token issued for an operation the
+// user was asked to repeat; empty when there is none
+func (p *InputPanel) takeConfirmation(key string) string {
+	p.confirmMu.Lock()
+	defer p.confirmMu.Unlock()
+	token := p.confirmTokens[key]
+	delete(p.confirmTokens, key)
+	return token
+}
+
+// awaitConfirmation keeps the token for the repeat of an operation and tells
+// the user how long they have to repeat it
+func (p *InputPanel) awaitConfirmation(key string, required *ipc.ConfirmationRequiredError, what string) tea.Msg {
+	p.confirmMu.Lock()
+	if p.confirmTokens == nil {
+		p.confirmTokens = make(map[string]string)
+	}
+	p.confirmTokens[key] = required.Token
+	p.confirmMu.Unlock()
+
+	wait := time.Until(required.ExpiresAt).Round(time.Second)
+	return InfoMsg{Message: fmt.Sprintf("%s cannot be undone: run the command again within %v to confirm", what, wait)}
+}
+
 func (p *InputPanel) createNewSession() tea.Cmd {
 	return func() tea.Msg {
 		// Generate a default title with timestamp
-		title := fmt.Sprintf("New Session %s", time.Now().Format("15:04:05"))
+		title := fmt.Sprintf("New Session %s", timefmt.Clock(time.Now()))
 
 		// Create session on OpenCode server first
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
@@ -2030,17 +2837,37 @@ func (p *InputPanel) switchToSession(sessionID string) tea.Cmd {
 
 func (p *InputPanel) deleteSession(sessionID string) tea.Cmd {
 	return func() tea.Msg {
-		// Delete session on OpenCode server first
+		// Update shared state first: the server may want the deletion
+		// confirmed, and the session must survive until it is
+		confirmKey := string(types.SessionDeleted) + ":" + sessionID
+		update := types.StateUpdate{
+			Type:              types.SessionDeleted,
+			Payload:           types.SessionDeletePayload{SessionID: sessionID},
+			SourcePanel:       "input-panel",
+			Timestamp:         time.Now(),
+			ConfirmationToken: p.takeConfirmation(confirmKey),
+			// ExpectedVersion will be set by sendUpdateWithRetry
+		}
+		if newVersion, err := p.sendUpdateWithRetry(update); err != nil {
+			var required *ipc.ConfirmationRequiredError
+			if errors.As(err, &required) {
+				return p.awaitConfirmation(confirmKey, required, fmt.Sprintf("Deleting session %s", sessionID))
+			}
+			log.Printf("[INPUT] Failed to send session delete state update: %v", err)
+			return ErrorMsg{Error: err}
+		} else {
+			p.version = newVersion
+		}
+
+		// Then delete the session on the OpenCode server
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
 		result, err := p.client.Session.Delete(ctx, sessionID, opencode.SessionDeleteParams{})
-
 		if err != nil {
 			log.Printf("[INPUT] Failed to delete session on OpenCode server: %v", err)
 			return ErrorMsg{Error: fmt.Errorf("failed to delete session: %w", err)}
 		}
-
 		if result == nil || !*result {
 			log.Printf("[INPUT] Session deletion returned false or nil result")
 			return ErrorMsg{Error: fmt.Errorf("session deletion failed on server")}
@@ -2048,46 +2875,100 @@ func (p *InputPanel) deleteSession(sessionID string) tea.Cmd {
 
 		log.Printf("[INPUT] Successfully deleted session on OpenCode server: %s", sessionID)
 
-		// Now update local state
+		if p.currentSessionID == sessionID {
+			p.currentSessionID = ""
+		}
+
+		return InfoMsg{Message: fmt.Sprintf("Deleted session %s", sessionID)}
+	}
+}
+
+func (p *InputPanel) changeTheme(theme string) tea.Cmd {
+	return func() tea.Msg {
 		update := types.StateUpdate{
-			Type:        types.SessionDeleted,
-			Payload:     types.SessionDeletePayload{SessionID: sessionID},
+			Type:        types.ThemeChanged,
+			Payload:     types.ThemeChangePayload{Theme: theme},
 			SourcePanel: "input-panel",
 			Timestamp:   time.Now(),
 			// ExpectedVersion will be set by sendUpdateWithRetry
 		}
 		if newVersion, err := p.sendUpdateWithRetry(update); err != nil {
-			log.Printf("[INPUT] Failed to send session delete state update: %v", err)
 			return ErrorMsg{Error: err}
 		} else {
 			p.version = newVersion
 		}
 
-		if p.currentSessionID == sessionID {
-			p.currentSessionID = ""
-		}
-
-		return InfoMsg{Message: fmt.Sprintf("Deleted session %s", sessionID)}
+		return InfoMsg{Message: fmt.Sprintf("Theme changed to %s", theme)}
 	}
 }
 
-func (p *InputPanel) changeTheme(theme string) tea.Cmd {
+// attachLocation handles "/at path:line[:column]", attaching a code position
+// whose language server context is sent with the next prompt; "/at" alone
+// detaches it
+func (p *InputPanel) attachLocation(args []string) tea.Cmd {
+	var location *types.CodeLocation
+	if len(args) > 0 {
+		parsed, err := parseCodeLocation(strings.Join(args, " "))
+		if err != nil {
+			return func() tea.Msg { return ErrorMsg{Error: err} }
+		}
+		location = &parsed
+	}
+
 	return func() tea.Msg {
 		update := types.StateUpdate{
-			Type:        types.ThemeChanged,
-			Payload:     types.ThemeChangePayload{Theme: theme},
+			Type:        types.InputLocationChanged,
+			Payload:     types.InputLocationPayload{Location: location},
 			SourcePanel: "input-panel",
 			Timestamp:   time.Now(),
-			// ExpectedVersion will be set by sendUpdateWithRetry
 		}
 		if newVersion, err := p.sendUpdateWithRetry(update); err != nil {
 			return ErrorMsg{Error: err}
 		} else {
 			p.version = newVersion
 		}
+		if location == nil {
+			return InfoMsg{Message: "Code location detached"}
+		}
+		return InfoMsg{Message: fmt.Sprintf("Gathering code context for %s", location)}
+	}
+}
 
-		return InfoMsg{Message: fmt.Sprintf("Theme changed to %s", theme)}
+// parseCodeLocation parses path:line[:column]; relative paths start at the
+// working directory and the column defaults to 1
+func parseCodeLocation(spec string) (types.CodeLocation, error) {
+	usage := fmt.Errorf("usage: /at path:line[:column]")
+	path, last, ok := cutLastColon(spec)
+	if !ok {
+		return types.CodeLocation{}, usage
+	}
+	number, err := strconv.Atoi(last)
+	if err != nil || number < 1 {
+		return types.CodeLocation{}, usage
 	}
+	location := types.CodeLocation{Line: number, Column: 1}
+	if rest, line, ok := cutLastColon(path); ok {
+		if lineNumber, err := strconv.Atoi(line); err == nil && lineNumber >= 1 {
+			path, location.Line, location.Column = rest, lineNumber, number
+		}
+	}
+	if path == "" {
+		return types.CodeLocation{}, usage
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return types.CodeLocation{}, err
+	}
+	location.Path = abs
+	return location, nil
+}
+
+func cutLastColon(s string) (string, string, bool) {
+	i := strings.LastIndexByte(s, ':')
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+1:], true
 }
 
 func (p *InputPanel) changeModel(provider, model string) tea.Cmd {
@@ -2128,6 +3009,18 @@ func (p *InputPanel) changeAgent(agent string) tea.Cmd {
 	}
 }
 
+// editInEditor has the orchestrator open the buffer in the user's editor;
+// the text saved comes back as an input update
+func (p *InputPanel) editInEditor() tea.Cmd {
+	buffer := p.buffer
+	return func() tea.Msg {
+		if err := p.ipcClient.EditInput(buffer); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to open the editor: %w", err)}
+		}
+		return InfoMsg{Message: "Editing in $EDITOR; save and quit to replace the input"}
+	}
+}
+
 func (p *InputPanel) compactCurrentSession() tea.Cmd {
 	sessionID := p.currentSessionID
 	if sessionID == "" {
@@ -2136,30 +3029,13 @@ func (p *InputPanel) compactCurrentSession() tea.Cmd {
 		}
 	}
 
-	provider, model, err := p.resolveProviderAndModel()
-	if err != nil {
-		return func() tea.Msg {
-			return ErrorMsg{Error: err}
-		}
-	}
-
+	// The orchestrator summarizes in the background and archives the
+	// messages the summary replaces
 	return func() tea.Msg {
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
-
-		_, apiErr := p.client.Session.Summarize(
-			ctx,
-			sessionID,
-			opencode.SessionSummarizeParams{
-				ProviderID: opencode.F(provider),
-				ModelID:    opencode.F(model),
-			},
-		)
-		if apiErr != nil {
-			return ErrorMsg{Error: fmt.Errorf("failed to compact session: %w", apiErr)}
+		if err := p.ipcClient.CompactSession(sessionID); err != nil {
+			return ErrorMsg{Error: fmt.Errorf("failed to compact session: %w", err)}
 		}
-
-		return InfoMsg{Message: "Session compact request sent"}
+		return InfoMsg{Message: "Compacting session; the summary replaces older messages when ready"}
 	}
 }
 
@@ -2513,6 +3389,9 @@ func (p *InputPanel) cacheHelpLines() {
 		"  /theme <name>            Change theme",
 		"  /model <provider> <model> Change model",
 		"  /agent <name>            Change agent",
+		"  /at <file:line[:col]>    Send code context for a position with the next prompt",
+		"  /queue [drop|top <n>]    List queued prompts, drop one or move it to the front",
+		"  /template [name] [title] Create a session from a template; lists them without a name",
 		"",
 		"Keyboard Shortcuts:",
 		"  Enter                    Send message",
@@ -2525,6 +3404,8 @@ func (p *InputPanel) cacheHelpLines() {
 		"  Ctrl+W                   Delete previous word",
 		"  Ctrl+L                   Clear buffer",
 		"  Ctrl+T                   Cycle through comfortable themes",
+		"  Ctrl+X                   Edit the input in $EDITOR",
+		"  Ctrl+Y                   Take the last queued prompt back to edit it",
 		"  F1                       Toggle this help",
 		"  Page Up/Down             Scroll help content",
 		"  Esc                      Exit help scroll mode",
@@ -2597,6 +3478,20 @@ func (p *InputPanel) renderInput() string {
 	if p.isMultiline {
 		header += " [MULTILINE]"
 	}
+	if n := len(p.fileTree.Attached); n > 0 {
+		header += fmt.Sprintf(" [%d attached]", n)
+	}
+	if p.location != nil {
+		status := "gathering context"
+		switch {
+		case p.promptContext == nil:
+		case p.promptContext.Error != "":
+			status = "no context"
+		default:
+			status = "context ready"
+		}
+		header += fmt.Sprintf(" [@ %s:%d, %s]", filepath.Base(p.location.Path), p.location.Line, status)
+	}
 
 	// Debug log to track header rendering
 	log.Printf("[INPUT] Rendering header: %s (currentSessionID: %s, currentSessionTitle: %s)", header, p.currentSessionID, p.currentSessionTitle)
@@ -2649,11 +3544,33 @@ func (p *InputPanel) renderInput() string {
 	if len(p.history) > 0 {
 		modeText += fmt.Sprintf(" | History: %d items", len(p.history))
 	}
+	if queued := len(p.queuedPrompts(p.currentSessionID)); queued > 0 {
+		modeText += fmt.Sprintf(" | Queued: %d", queued)
+	}
+	contextText := p.contextText()
 	log.Printf("[INPUT] Rendering mode text: '%s' (Provider='%s', Model='%s')", modeText, p.currentProvider, p.currentModel)
 
 	modeContent := styles.NewStyle().
 		Foreground(t.TextMuted()).
-		Render(modeText) + "\n"
+		Render(modeText)
+	if contextText != "" {
+		color := t.TextMuted()
+		switch p.contextUsage.Level {
+		case types.ContextLevelWarning:
+			color = t.Warning()
+		case types.ContextLevelCritical:
+			color = t.Error()
+		}
+		modeContent += styles.NewStyle().Foreground(color).Render(contextText)
+	}
+	if connectionText := p.connectionText(); connectionText != "" {
+		color := t.Warning()
+		if p.connection.Server.Status == types.LinkOffline {
+			color = t.Error()
+		}
+		modeContent += styles.NewStyle().Foreground(color).Render(connectionText)
+	}
+	modeContent += "\n"
 
 	content += modeContent
 	usedLines += 1
@@ -2702,6 +3619,9 @@ func (p *InputPanel) renderHelpCompact(maxLines int) string {
 		"  /theme <name>            Change theme",
 		"  /model <provider> <model> Change model",
 		"  /agent <name>            Change agent",
+		"  /at <file:line[:col]>    Send code context for a position with the next prompt",
+		"  /queue [drop|top <n>]    List queued prompts, drop one or move it to the front",
+		"  /template [name] [title] Create a session from a template; lists them without a name",
 		"",
 		"Keyboard Shortcuts:",
 		"  Enter                    Send message",
@@ -2832,6 +3752,7 @@ Commands:
   /theme <name>            Change theme
   /model <provider> <model> Change model
   /agent <name>            Change agent
+  /at <file:line[:col]>    Send code context for a position with the next prompt
 
 Keyboard Shortcuts:
   Enter                    Send message
@@ -3098,9 +4019,18 @@ func (p *InputPanel) refreshCompletionCommands() {
 	}
 
 	filtered := make([]string, 0, len(completionSuggestions))
-	for _, cmd := range completionSuggestions {
-		if word == "" || strings.HasPrefix(cmd, word) {
-			filtered = append(filtered, cmd)
+	if prefix, ok := strings.CutPrefix(p.buffer, "/template "); ok {
+		// After "/template " the templates are offered by name
+		for _, template := range p.sessionTemplates {
+			if strings.HasPrefix(template.Name, prefix) {
+				filtered = append(filtered, "template "+template.Name)
+			}
+		}
+	} else {
+		for _, cmd := range completionSuggestions {
+			if word == "" || strings.HasPrefix(cmd, word) {
+				filtered = append(filtered, cmd)
+			}
 		}
 	}
 
@@ -3423,6 +4353,16 @@ type InfoMsg struct {
 	Message string
 }
 
+// OpenTemplatePickerMsg opens the session template picker, as requested
+// through a UI action
+type OpenTemplatePickerMsg struct{}
+
+// RunCommandMsg runs a slash command requested through a UI action
+type RunCommandMsg struct {
+	Command string
+	Args    []string
+}
+
 type InputEventMsg struct {
 	Event types.StateEvent
 }
@@ -10,6 +10,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -22,6 +23,7 @@ import (
 	"github.com/opencode/tmux_coder/internal/state"
 	"github.com/opencode/tmux_coder/internal/styles"
 	"github.com/opencode/tmux_coder/internal/theme"
+	"github.com/opencode/tmux_coder/internal/timefmt"
 	"github.com/opencode/tmux_coder/internal/types"
 	"github.com/opencode/tmux_coder/internal/util"
 	"github.com/sst/opencode-sdk-go"
@@ -70,6 +72,8 @@ type LineBasedRenderer struct {
 	lastRenderWidth int                            `json:"last_render_width"`
 	cacheHits       int64                          `json:"cache_hits"`
 	cacheMisses     int64                          `json:"cache_misses"`
+	// Threads whose replies are hidden, by the ID of the message starting them
+	collapsed map[string]bool
 }
 
 // MessagesPanel manages the message history panel
@@ -92,7 +96,12 @@ type MessagesPanel struct {
 	eventsChan       chan state.StateEvent
 	markdownMode     bool // true for markdown rendering, false for plain text
 	lineRenderer     *LineBasedRenderer
-	refreshTicker    *time.Ticker // Add ticker for periodic refresh
+	refreshTicker    *time.Ticker    // Add ticker for periodic refresh
+	storageNotice    string          // Storage quota warning shown under the header
+	saveNotice       string          // Shown while saves are paused on a full disk
+	codeBlockNotice  string          // Selected code block, or how the last action on one went
+	codeBlock        codeBlockRef    // Code block the y, w and o keys act on
+	archived         map[string]bool // Messages replaced by a compaction summary; left out of server refreshes
 }
 
 // RunConfig describes runtime configuration for the messages panel.
@@ -125,6 +134,10 @@ func DefaultRunConfig() (RunConfig, error) {
 		cfg.SocketPath = filepath.Join(cfg.LogDir, "ipc.sock")
 	}
 
+	if err := timefmt.ConfigureFromEnv(); err != nil {
+		return cfg, fmt.Errorf("display settings: %w", err)
+	}
+
 	return cfg, nil
 }
 
@@ -233,6 +246,7 @@ func NewMessagesPanel(parent context.Context, httpClient *opencode.Client, socke
 		ctx:            ctx,
 		cancel:         cancel,
 		eventsChan:     make(chan state.StateEvent, 64),
+		archived:       make(map[string]bool),
 		lineRenderer: &LineBasedRenderer{
 			renderedLines:   make([]RenderedLine, 0),
 			lineToMessage:   make(map[int]string),
@@ -242,9 +256,29 @@ func NewMessagesPanel(parent context.Context, httpClient *opencode.Client, socke
 			lastRenderWidth: 0,
 			cacheHits:       0,
 			cacheMisses:     0,
+			collapsed:       make(map[string]bool),
 		},
 	}
 
+	// Render-only panel: read full state from the shared snapshot when published
+	if path := os.Getenv("OPENCODE_STATE_SNAPSHOT"); path != "" {
+		if err := panel.ipcClient.EnableSnapshot(path); err != nil {
+			log.Printf("State snapshot disabled: %v", err)
+		}
+	}
+
+	panel.ipcClient.SetIdentity(os.Getenv(ipc.PanelIdentityEnv))
+
+	panel.ipcClient.SetCapabilities(types.PanelCapabilities{
+		RendersMessages: true,
+		UIActions: []types.UIAction{
+			types.UIActionRefreshMessages,
+			types.UIActionScrollToMessage,
+			types.UIActionFocusPane,
+		},
+		Diffs: true,
+	})
+
 	// Register event handlers (bridge IPC events into Bubble Tea loop)
 	panel.ipcClient.RegisterEventHandler(state.EventMessageAdded, panel.forwardEventToUI)
 	panel.ipcClient.RegisterEventHandler(state.EventMessageUpdated, panel.forwardEventToUI)
@@ -253,7 +287,16 @@ func NewMessagesPanel(parent context.Context, httpClient *opencode.Client, socke
 	panel.ipcClient.RegisterEventHandler(state.EventSessionChanged, panel.forwardEventToUI)
 	panel.ipcClient.RegisterEventHandler(state.EventStateSync, panel.forwardEventToUI)
 	panel.ipcClient.RegisterEventHandler(types.EventThemeChanged, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventStateCompacted, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventStorageQuota, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventStorageHealth, panel.forwardEventToUI)
 	panel.ipcClient.RegisterEventHandler(types.EventUIActionTriggered, panel.handleUIActionTriggered)
+	panel.ipcClient.RegisterEventHandler(types.EventRunCancelled, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventSessionCompacted, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventThreadCollapsed, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventCodeBlocksExtracted, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventMessageAttributed, panel.forwardEventToUI)
+	panel.ipcClient.RegisterEventHandler(types.EventCodeBlockHandled, panel.forwardEventToUI)
 
 	// Wildcard handler to log receipt of any event type for diagnostics
 	panel.ipcClient.RegisterEventHandler(types.StateEventType("*"), panel.handleAnyEvent)
@@ -311,6 +354,8 @@ func (p *MessagesPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case StateLoadedMsg:
 		p.currentSessionID = msg.State.CurrentSessionID
 		p.messages = p.filterMessagesForSession(msg.State.Messages, p.currentSessionID)
+		p.noteArchived(msg.State.ArchivedMessages)
+		p.lineRenderer.setCollapsed(msg.State.GetCollapsedThreads())
 
 		// Log state details for debugging
 		log.Printf("[MESSAGES] State loaded: CurrentSessionID=%s, Total messages=%d, Filtered messages=%d",
@@ -342,6 +387,10 @@ func (p *MessagesPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		p.applyRefreshedMessages(msg.Messages)
 		return p, nil
 
+	case FullContentLoadedMsg:
+		p.applyFullContent(msg.Bodies)
+		return p, nil
+
 	case StreamingUpdateMsg:
 		return p.handleStreamingUpdate(msg)
 
@@ -501,6 +550,33 @@ func (p *MessagesPanel) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	case "r":
 		return p, p.refreshMessages()
 
+	case "x":
+		return p, p.cancelPendingReply()
+
+	case "z":
+		return p, p.toggleThreadAtTop()
+
+	case "Z":
+		return p, p.toggleAllThreads()
+
+	case "b":
+		p.selectNextCodeBlock()
+
+	case "y":
+		return p, p.codeBlockAction(types.UIActionCopyCodeBlock)
+
+	case "w":
+		return p, p.codeBlockAction(types.UIActionSaveCodeBlock)
+
+	case "o":
+		return p, p.codeBlockAction(types.UIActionOpenCodeBlock)
+
+	case "A":
+		return p, p.codeBlockAction(types.UIActionApplyCodeBlock)
+
+	case "f":
+		return p, p.loadFullContent()
+
 	case "m":
 		p.markdownMode = !p.markdownMode
 		log.Printf("[MESSAGES] Switched to %s mode", map[bool]string{true: "markdown", false: "plain"}[p.markdownMode])
@@ -599,6 +675,17 @@ func (p *MessagesPanel) refreshMessages() tea.Cmd {
 }
 
 func (p *MessagesPanel) applyRefreshedMessages(messages []types.MessageInfo) {
+	// The server still lists messages a summary replaced
+	messages = p.withoutArchived(messages)
+	// The server reports aborted replies as finished; keep them marked cancelled
+	for i := range messages {
+		for _, known := range p.messages {
+			if known.ID == messages[i].ID && known.Status == "cancelled" {
+				messages[i].Status = "cancelled"
+				break
+			}
+		}
+	}
 	p.messages = messages
 
 	mode := "plain"
@@ -643,6 +730,7 @@ func (p *MessagesPanel) handleMessageAdded(event state.StateEvent) error {
 		var payload types.MessageAddPayload
 		if err := decodePayload(payloadMap, &payload); err == nil {
 			if payload.Message.SessionID == p.currentSessionID {
+				p.resolveBody(&payload.Message)
 				p.messages = append(p.messages, payload.Message)
 
 				// Rebuild rendered lines with the new message
@@ -675,10 +763,21 @@ func (p *MessagesPanel) handleMessageUpdated(event state.StateEvent) error {
 			messageUpdated := false
 			for i, message := range p.messages {
 				if message.ID == payload.MessageID {
+					if payload.Content != "" || payload.BodyRef != "" {
+						// The orchestrator extracts the blocks of the new body again
+						p.messages[i].CodeBlocks = nil
+						p.messages[i].Meta = payload.Meta
+					}
 					if payload.Content != "" {
 						p.messages[i].Content = payload.Content
 						messageUpdated = true
 					}
+					if payload.BodyRef != "" {
+						p.messages[i].Content, p.messages[i].Truncated = payload.Content, payload.Truncated
+						p.messages[i].BodyRef, p.messages[i].BodySize = payload.BodyRef, payload.BodySize
+						p.resolveBody(&p.messages[i])
+						messageUpdated = true
+					}
 					if payload.Status != "" {
 						p.messages[i].Status = payload.Status
 						messageUpdated = true
@@ -730,6 +829,472 @@ func (p *MessagesPanel) handleMessageDeleted(event state.StateEvent) error {
 	return nil
 }
 
+func (p *MessagesPanel) handleStateCompacted(event state.StateEvent) error {
+	p.version = event.Version
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.StateCompactPayload
+		if err := decodePayload(payloadMap, &payload); err == nil {
+			pruned := make(map[string]bool, len(payload.MessageIDs))
+			for _, id := range payload.MessageIDs {
+				pruned[id] = true
+			}
+			kept := p.messages[:0]
+			for _, msg := range p.messages {
+				if !pruned[msg.ID] {
+					kept = append(kept, msg)
+				}
+			}
+			removed := len(p.messages) - len(kept)
+			p.messages = kept
+
+			if removed > 0 {
+				mode := "plain"
+				if p.markdownMode {
+					mode = "markdown"
+				}
+				p.lineRenderer.rebuildRenderedLines(p.messages, p.width, mode, p.showTimestamps)
+				p.scrollOffset = min(p.scrollOffset, p.calculateMaxScroll())
+			}
+			log.Printf("[MESSAGES] v%v State compacted (%s): removed %d messages", event.Version, payload.Reason, removed)
+		}
+	}
+	return nil
+}
+
+func (p *MessagesPanel) handleStorageQuota(event state.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.StorageQuotaPayload
+		if err := decodePayload(payloadMap, &payload); err == nil {
+			switch {
+			case payload.Level == types.QuotaWarning && payload.MaxSize > 0:
+				p.storageNotice = fmt.Sprintf("State file at %d%% of its %d MB quota",
+					payload.StateSize*100/payload.MaxSize, payload.MaxSize>>20)
+			case payload.Level == types.QuotaExceeded:
+				p.storageNotice = fmt.Sprintf("State file exceeds its %d MB quota", payload.MaxSize>>20)
+				if payload.Compacting {
+					p.storageNotice += "; compacting old messages"
+				}
+			default:
+				p.storageNotice = ""
+			}
+			log.Printf("[MESSAGES] Storage quota %s: %d of %d bytes", payload.Level, payload.StateSize, payload.MaxSize)
+		}
+	}
+	return nil
+}
+
+func (p *MessagesPanel) handleStorageHealth(event state.StateEvent) error {
+	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
+		var payload types.StorageHealthPayload
+		if err := decodePayload(payloadMap, &payload); err == nil {
+			p.saveNotice = ""
+			if payload.Degraded {
+				p.saveNotice = fmt.Sprintf("Saves paused: %s (%d MB free); free up disk space to resume",
+					payload.Reason, payload.Available>>20)
+			}
+			log.Printf("[MESSAGES] Storage degraded=%t: %s", payload.Degraded, payload.Reason)
+		}
+	}
+	return nil
+}
+
+// handleRunCancelled stops the pending indicator of cancelled replies without
+// waiting for the server to finish them
+func (p *MessagesPanel) handleRunCancelled(event state.StateEvent) error {
+	p.version = event.Version
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.RunCancelledPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	cancelled := false
+	for i := range p.messages {
+		if slices.Contains(payload.MessageIDs, p.messages[i].ID) {
+			p.messages[i].Status = "cancelled"
+			cancelled = true
+		}
+	}
+	if cancelled {
+		mode := "plain"
+		if p.markdownMode {
+			mode = "markdown"
+		}
+		p.lineRenderer.rebuildRenderedLines(p.messages, p.width, mode, p.showTimestamps)
+	}
+	log.Printf("[MESSAGES] v%v Run %q cancelled in session %s", event.Version, payload.RunID, payload.SessionID)
+	return nil
+}
+
+// handleSessionCompacted swaps the messages a summary replaced for the summary
+func (p *MessagesPanel) handleSessionCompacted(event state.StateEvent) error {
+	p.version = event.Version
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.SessionCompactedPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	for _, id := range payload.Compaction.ArchivedIDs {
+		p.archived[id] = true
+	}
+	if payload.Compaction.SessionID != p.currentSessionID {
+		return nil
+	}
+
+	summaryAt, found := -1, false
+	kept := make([]types.MessageInfo, 0, len(p.messages))
+	for _, msg := range p.messages {
+		switch {
+		case p.archived[msg.ID]:
+			if summaryAt < 0 {
+				summaryAt = len(kept)
+			}
+		case msg.ID == payload.Summary.ID:
+			found = true
+			kept = append(kept, payload.Summary)
+		default:
+			kept = append(kept, msg)
+		}
+	}
+	if !found {
+		if summaryAt < 0 {
+			summaryAt = 0
+		}
+		kept = slices.Insert(kept, summaryAt, payload.Summary)
+	}
+	p.messages = kept
+
+	mode := "plain"
+	if p.markdownMode {
+		mode = "markdown"
+	}
+	p.lineRenderer.rebuildRenderedLines(p.messages, p.width, mode, p.showTimestamps)
+	if p.autoScroll {
+		p.scrollToBottom()
+	}
+	log.Printf("[MESSAGES] v%v Session %s compacted: %d messages archived", event.Version, payload.Compaction.SessionID, len(payload.Compaction.ArchivedIDs))
+	return nil
+}
+
+// noteArchived remembers which messages compactions archived
+func (p *MessagesPanel) noteArchived(messages []types.MessageInfo) {
+	for _, msg := range messages {
+		p.archived[msg.ID] = true
+	}
+}
+
+// withoutArchived drops messages a compaction summary replaced
+func (p *MessagesPanel) withoutArchived(messages []types.MessageInfo) []types.MessageInfo {
+	if len(p.archived) == 0 {
+		return messages
+	}
+	kept := messages[:0]
+	for _, msg := range messages {
+		if !p.archived[msg.ID] {
+			kept = append(kept, msg)
+		}
+	}
+	return kept
+}
+
+// cancelPendingReply asks to cancel the run producing the latest pending reply
+func (p *MessagesPanel) cancelPendingReply() tea.Cmd {
+	messageID := ""
+	for i := len(p.messages) - 1; i >= 0; i-- {
+		if p.messages[i].Type == "assistant" && p.messages[i].Status == "pending" {
+			messageID = p.messages[i].ID
+			break
+		}
+	}
+	if messageID == "" {
+		return nil
+	}
+	return func() tea.Msg {
+		update := types.StateUpdate{
+			Type:            types.CancelRun,
+			ExpectedVersion: p.version,
+			Payload:         types.CancelRunPayload{MessageID: messageID, Reason: "cancelled from messages panel"},
+			SourcePanel:     "messages-panel",
+			Timestamp:       time.Now(),
+		}
+		newVersion, err := p.ipcClient.SendStateUpdateAndWait(update)
+		if err != nil {
+			log.Printf("[MESSAGES] Failed to cancel reply %s: %v", messageID, err)
+			return ErrorMsg{Error: err}
+		}
+		p.version = newVersion
+		return nil
+	}
+}
+
+// toggleThreadAtTop collapses or expands the thread of the message at the
+// top of the view
+func (p *MessagesPanel) toggleThreadAtTop() tea.Cmd {
+	messageID := ""
+	for line := p.scrollOffset; line < p.lineRenderer.totalLines && messageID == ""; line++ {
+		messageID = p.lineRenderer.lineToMessage[line]
+	}
+	thread, ok := types.FindThread(p.messages, messageID)
+	if !ok || len(thread.Replies) == 0 {
+		return nil
+	}
+	return p.collapseThreads([]string{thread.ID()}, !p.lineRenderer.collapsed[thread.ID()])
+}
+
+// toggleAllThreads collapses every thread of the session with replies, or
+// expands them all when they are all collapsed already
+func (p *MessagesPanel) toggleAllThreads() tea.Cmd {
+	var roots []string
+	collapse := false
+	for _, thread := range types.GroupThreads(p.messages) {
+		if len(thread.Replies) > 0 {
+			roots = append(roots, thread.ID())
+			collapse = collapse || !p.lineRenderer.collapsed[thread.ID()]
+		}
+	}
+	if len(roots) == 0 {
+		return nil
+	}
+	return p.collapseThreads(roots, collapse)
+}
+
+// collapseThreads records threads as collapsed or expanded in shared state,
+// so every messages panel shows them the same way
+func (p *MessagesPanel) collapseThreads(rootIDs []string, collapsed bool) tea.Cmd {
+	return func() tea.Msg {
+		update := types.StateUpdate{
+			Type:            types.ThreadCollapsed,
+			ExpectedVersion: p.version,
+			Payload:         types.ThreadCollapsePayload{MessageIDs: rootIDs, Collapsed: collapsed},
+			SourcePanel:     "messages-panel",
+			Timestamp:       time.Now(),
+		}
+		newVersion, err := p.ipcClient.SendStateUpdateAndWait(update)
+		if err != nil {
+			log.Printf("[MESSAGES] Failed to collapse threads %v: %v", rootIDs, err)
+			return ErrorMsg{Error: err}
+		}
+		p.version = newVersion
+		return nil
+	}
+}
+
+// handleThreadCollapsed hides or shows the replies of the threads collapsed or expanded
+func (p *MessagesPanel) handleThreadCollapsed(event state.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.ThreadCollapsePayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	p.version = event.Version
+	for _, id := range payload.MessageIDs {
+		if payload.Collapsed {
+			p.lineRenderer.collapsed[id] = true
+		} else {
+			delete(p.lineRenderer.collapsed, id)
+		}
+	}
+
+	mode := "plain"
+	if p.markdownMode {
+		mode = "markdown"
+	}
+	p.lineRenderer.rebuildRenderedLines(p.messages, p.width, mode, p.showTimestamps)
+	if maxScroll := p.calculateMaxScroll(); p.scrollOffset > maxScroll || p.autoScroll {
+		p.scrollOffset = maxScroll
+	}
+	return nil
+}
+
+// codeBlockRef names one code block of one message
+type codeBlockRef struct {
+	MessageID string
+	Index     int
+}
+
+// selectNextCodeBlock selects the next code block of the messages from the
+// top of the screen down, wrapping around to the first
+func (p *MessagesPanel) selectNextCodeBlock() {
+	var refs []codeBlockRef
+	seen := make(map[string]bool)
+	for line := p.scrollOffset; line < p.lineRenderer.totalLines; line++ {
+		messageID := p.lineRenderer.lineToMessage[line]
+		if messageID == "" || seen[messageID] {
+			continue
+		}
+		seen[messageID] = true
+		for _, message := range p.messages {
+			if message.ID == messageID {
+				for _, block := range message.CodeBlocks {
+					refs = append(refs, codeBlockRef{MessageID: messageID, Index: block.Index})
+				}
+				break
+			}
+		}
+	}
+	if len(refs) == 0 {
+		p.codeBlock = codeBlockRef{}
+		p.codeBlockNotice = "No code blocks below the top of the screen"
+		return
+	}
+
+	next := 0
+	for i, ref := range refs {
+		if ref == p.codeBlock {
+			next = (i + 1) % len(refs)
+			break
+		}
+	}
+	p.codeBlock = refs[next]
+	p.codeBlockNotice = fmt.Sprintf("Code block %d/%d on screen: y copy, w save, o open, A apply, b next", next+1, len(refs))
+}
+
+// codeBlockAction asks the orchestrator to copy, save, open or apply the selected
+// code block, selecting the first one on screen when none is
+func (p *MessagesPanel) codeBlockAction(action types.UIAction) tea.Cmd {
+	if p.codeBlock.MessageID == "" {
+		p.selectNextCodeBlock()
+		if p.codeBlock.MessageID == "" {
+			return nil
+		}
+	}
+	args := types.CodeBlockArgs{MessageID: p.codeBlock.MessageID, Index: p.codeBlock.Index}
+	return func() tea.Msg {
+		if err := p.ipcClient.TriggerUIAction(action, args); err != nil {
+			log.Printf("[MESSAGES] %s failed: %v", action, err)
+			return ErrorMsg{Error: err}
+		}
+		return nil
+	}
+}
+
+// handleCodeBlocksExtracted stores the code blocks found in a message
+func (p *MessagesPanel) handleCodeBlocksExtracted(event state.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.CodeBlocksPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	p.version = event.Version
+	for i := range p.messages {
+		if p.messages[i].ID == payload.MessageID {
+			p.messages[i].CodeBlocks = payload.Blocks
+			break
+		}
+	}
+	return nil
+}
+
+// handleMessageAttributed labels a reply with the agent that answered
+func (p *MessagesPanel) handleMessageAttributed(event state.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.MessageAttributionPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	p.version = event.Version
+	for i := range p.messages {
+		if p.messages[i].ID == payload.MessageID {
+			p.messages[i].Agent = payload.Agent
+			break
+		}
+	}
+	return nil
+}
+
+// handleCodeBlockHandled shows how an action on a code block went
+func (p *MessagesPanel) handleCodeBlockHandled(event state.StateEvent) error {
+	payloadMap, ok := event.Data.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	var payload types.CodeBlockHandledPayload
+	if err := decodePayload(payloadMap, &payload); err != nil {
+		return err
+	}
+	p.version = event.Version
+
+	block := fmt.Sprintf("code block %d", payload.Index+1)
+	switch {
+	case payload.Error != "":
+		p.codeBlockNotice = fmt.Sprintf("Could not %s %s: %s", strings.TrimSuffix(string(payload.Action), "_code_block"), block, payload.Error)
+	case payload.Action == types.UIActionCopyCodeBlock:
+		p.codeBlockNotice = "Copied " + block
+	case payload.Action == types.UIActionSaveCodeBlock:
+		p.codeBlockNotice = fmt.Sprintf("Saved %s to %s", block, payload.Path)
+	case payload.Action == types.UIActionOpenCodeBlock:
+		p.codeBlockNotice = "Opened " + block + " in a new pane"
+	case payload.Action == types.UIActionApplyCodeBlock:
+		p.codeBlockNotice = fmt.Sprintf("Review the change %s makes to %s in the diff pane; accept it to write the file", block, payload.Path)
+	}
+	return nil
+}
+
+// loadFullContent fetches the full bodies of the truncated messages on screen
+func (p *MessagesPanel) loadFullContent() tea.Cmd {
+	visible := map[string]bool{}
+	for line := p.scrollOffset; line < p.scrollOffset+max(p.height-6, 1); line++ {
+		if id, ok := p.lineRenderer.lineToMessage[line]; ok {
+			visible[id] = true
+		}
+	}
+	var truncated []types.MessageInfo
+	for _, message := range p.messages {
+		if message.Truncated && visible[message.ID] {
+			truncated = append(truncated, message)
+		}
+	}
+	if len(truncated) == 0 {
+		return nil
+	}
+	return func() tea.Msg {
+		loaded := make(map[string]types.MessageInfo, len(truncated))
+		for _, message := range truncated {
+			ref := message.BodyRef
+			if err := p.ipcClient.ResolveMessageBody(&message); err != nil {
+				log.Printf("[MESSAGES] Failed to load full content of message %s: %v", message.ID, err)
+				return ErrorMsg{Error: err}
+			}
+			loaded[ref] = message
+		}
+		return FullContentLoadedMsg{Bodies: loaded}
+	}
+}
+
+// applyFullContent swaps previews for the loaded bodies, keeping the scroll position.
+// A message changed since the fetch no longer matches its old body and keeps its preview.
+func (p *MessagesPanel) applyFullContent(bodies map[string]types.MessageInfo) {
+	for i, message := range p.messages {
+		if full, ok := bodies[message.BodyRef]; ok && message.Truncated && message.ID == full.ID {
+			p.messages[i].Content, p.messages[i].Parts, p.messages[i].PartsRef = full.Content, full.Parts, full.PartsRef
+			p.messages[i].BodyRef, p.messages[i].BodySize, p.messages[i].Truncated = "", 0, false
+		}
+	}
+
+	mode := "plain"
+	if p.markdownMode {
+		mode = "markdown"
+	}
+	p.lineRenderer.rebuildRenderedLines(p.messages, p.width, mode, p.showTimestamps)
+	if maxScroll := p.calculateMaxScroll(); p.scrollOffset > maxScroll {
+		p.scrollOffset = maxScroll
+	}
+}
+
 func (p *MessagesPanel) handleMessagesCleared(event state.StateEvent) error {
 	log.Printf("[MESSAGES] handleMessagesCleared called, event data type: %T, data: %+v", event.Data, event.Data)
 	p.version = event.Version
@@ -879,7 +1444,7 @@ func (p *MessagesPanel) handleSessionChanged(event state.StateEvent) error {
 			}
 
 			log.Printf("[MESSAGES] v%v Fetched %d messages for session %s", event.Version, len(messageInfos), p.currentSessionID)
-			p.messages = messageInfos
+			p.messages = p.withoutArchived(messageInfos)
 
 			// Rebuild rendered lines for the new messages
 			mode := "plain"
@@ -932,6 +1497,8 @@ func (p *MessagesPanel) handleStateSync(event state.StateEvent) error {
 		if err := decodePayload(payloadMap, &payload); err == nil {
 			p.currentSessionID = payload.State.CurrentSessionID
 			p.messages = p.filterMessagesForSession(payload.State.Messages, p.currentSessionID)
+			p.noteArchived(payload.State.ArchivedMessages)
+			p.lineRenderer.setCollapsed(payload.State.GetCollapsedThreads())
 			if p.autoScroll {
 				p.scrollToBottom()
 			}
@@ -964,19 +1531,25 @@ func (p *MessagesPanel) handleThemeChanged(event state.StateEvent) error {
 func (p *MessagesPanel) handleUIActionTriggered(event state.StateEvent) error {
 	log.Printf("[MESSAGES] Received UI action triggered event: %+v", event)
 
-	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
-		if actionRaw, exists := payloadMap["action"]; exists {
-			if action, ok := actionRaw.(string); ok {
-				log.Printf("[MESSAGES] UI action: %s", action)
-				if action == "refresh_messages" {
-					return p.forwardEventToUI(event)
-				}
-				return nil
-			}
-		}
+	payload, ok := types.UIActionFromEvent(event)
+	if !ok {
+		log.Printf("[MESSAGES] Failed to extract action from UI action event payload")
+		return nil
 	}
+	log.Printf("[MESSAGES] UI action: %s", payload.Action)
 
-	log.Printf("[MESSAGES] Failed to extract action from UI action event payload")
+	switch payload.Action {
+	case types.UIActionRefreshMessages, types.UIActionScrollToMessage:
+		return p.forwardEventToUI(event)
+	case types.UIActionFocusPane:
+		var args types.FocusPaneArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		if args.Panel == "messages" {
+			return panel.FocusOwnPane()
+		}
+	}
 	return nil
 }
 
@@ -1025,6 +1598,30 @@ func (p *MessagesPanel) handleMessageEvent(event state.StateEvent) (tea.Model, t
 	case types.EventThemeChanged:
 		p.handleThemeChanged(event)
 		needsRefresh = true
+	case types.EventStateCompacted:
+		p.handleStateCompacted(event)
+		needsRefresh = true
+	case types.EventStorageQuota:
+		p.handleStorageQuota(event)
+		needsRefresh = true
+	case types.EventStorageHealth:
+		p.handleStorageHealth(event)
+		needsRefresh = true
+	case types.EventRunCancelled:
+		p.handleRunCancelled(event)
+		needsRefresh = true
+	case types.EventSessionCompacted:
+		p.handleSessionCompacted(event)
+		needsRefresh = true
+	case types.EventThreadCollapsed:
+		p.handleThreadCollapsed(event)
+	case types.EventCodeBlocksExtracted:
+		p.handleCodeBlocksExtracted(event)
+	case types.EventMessageAttributed:
+		p.handleMessageAttributed(event)
+		needsRefresh = true
+	case types.EventCodeBlockHandled:
+		p.handleCodeBlockHandled(event)
 	case types.EventUIActionTriggered:
 		if cmd := p.handleUIActionEvent(event); cmd != nil {
 			cmds = append(cmds, cmd)
@@ -1045,48 +1642,62 @@ func (p *MessagesPanel) handleMessageEvent(event state.StateEvent) (tea.Model, t
 }
 
 func (p *MessagesPanel) handleUIActionEvent(event state.StateEvent) tea.Cmd {
-	payloadMap, ok := event.Data.(map[string]interface{})
+	payload, ok := types.UIActionFromEvent(event)
 	if !ok {
 		log.Printf("[MESSAGES] UI action payload missing")
 		return nil
 	}
 
-	actionRaw, hasAction := payloadMap["action"]
-	if !hasAction {
-		log.Printf("[MESSAGES] UI action payload missing action field")
-		return nil
-	}
+	switch payload.Action {
+	case types.UIActionRefreshMessages:
+		var args types.RefreshMessagesArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			log.Printf("[MESSAGES] %v", err)
+			return nil
+		}
+		if args.SessionID != "" && args.SessionID != p.currentSessionID {
+			log.Printf("[MESSAGES] Refresh requested for session %s but current session is %s, skipping", args.SessionID, p.currentSessionID)
+			return nil
+		}
 
-	action, ok := actionRaw.(string)
-	if !ok {
-		log.Printf("[MESSAGES] UI action action field not string")
-		return nil
-	}
+		log.Printf("[MESSAGES] Triggering refresh due to UI action (session=%s)", args.SessionID)
+		return p.refreshMessages()
 
-	switch strings.ToLower(action) {
-	case "refresh_messages":
-		targetSession := ""
-		if dataRaw, ok := payloadMap["data"].(map[string]interface{}); ok {
-			if sessionRaw, ok := dataRaw["session_id"]; ok {
-				if sessionID, ok := sessionRaw.(string); ok {
-					targetSession = sessionID
-				}
-			}
+	case types.UIActionScrollToMessage:
+		var args types.ScrollToMessageArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			log.Printf("[MESSAGES] %v", err)
+			return nil
 		}
-
-		if targetSession != "" && targetSession != p.currentSessionID {
-			log.Printf("[MESSAGES] Refresh requested for session %s but current session is %s, skipping", targetSession, p.currentSessionID)
+		if args.SessionID != "" && args.SessionID != p.currentSessionID {
+			log.Printf("[MESSAGES] Scroll requested for session %s but current session is %s, skipping", args.SessionID, p.currentSessionID)
 			return nil
 		}
+		p.scrollToMessage(args.MessageID)
+		return nil
 
-		log.Printf("[MESSAGES] Triggering refresh due to UI action (session=%s)", targetSession)
-		return p.refreshMessages()
 	default:
-		log.Printf("[MESSAGES] Unhandled UI action: %s", action)
+		log.Printf("[MESSAGES] Unhandled UI action: %s", payload.Action)
 		return nil
 	}
 }
 
+// scrollToMessage scrolls so the message's first line is at the top, or as
+// close as the end of the list allows
+func (p *MessagesPanel) scrollToMessage(messageID string) {
+	for _, line := range p.lineRenderer.renderedLines {
+		if line.MessageID != messageID {
+			continue
+		}
+		maxScroll := p.calculateMaxScroll()
+		p.scrollOffset = min(maxScroll, line.LineIndex)
+		p.autoScroll = p.scrollOffset >= maxScroll
+		log.Printf("[MESSAGES] Scrolled to message %s at offset %d", messageID, p.scrollOffset)
+		return
+	}
+	log.Printf("[MESSAGES] Scroll requested to message %s, which is not shown", messageID)
+}
+
 // forwardEventToUI bridges IPC events into Bubble Tea by pushing into eventsChan
 func (p *MessagesPanel) forwardEventToUI(event state.StateEvent) error {
 	select {
@@ -1142,12 +1753,24 @@ func (p *MessagesPanel) filterMessagesForSession(messages []types.MessageInfo, s
 	filtered := make([]types.MessageInfo, 0)
 	for _, message := range messages {
 		if message.SessionID == sessionID {
+			p.resolveBody(&message)
 			filtered = append(filtered, message)
 		}
 	}
 	return filtered
 }
 
+// resolveBody loads an offloaded message body; only messages this panel shows are fetched.
+// A truncated message keeps its preview until the full content is asked for.
+func (p *MessagesPanel) resolveBody(message *types.MessageInfo) {
+	if message.Truncated || (message.BodyRef == "" && message.PartsRef == "") {
+		return
+	}
+	if err := p.ipcClient.ResolveMessageBody(message); err != nil {
+		log.Printf("[MESSAGES] Failed to load body of message %s: %v", message.ID, err)
+	}
+}
+
 // calculateMaxScroll calculates the maximum scroll offset using line-based calculation
 func (p *MessagesPanel) calculateMaxScroll() int {
 	// Calculate available height for messages (excluding header and footer)
@@ -1212,7 +1835,23 @@ func (p *MessagesPanel) renderMessages() string {
 	content += styles.NewStyle().
 		Foreground(t.Primary()).
 		Bold(true).
-		Render(header) + "\n\n"
+		Render(header) + "\n"
+	if p.saveNotice != "" {
+		content += styles.NewStyle().
+			Foreground(t.Error()).
+			Render(p.saveNotice) + "\n"
+	}
+	if p.storageNotice != "" {
+		content += styles.NewStyle().
+			Foreground(t.Warning()).
+			Render(p.storageNotice)
+	}
+	if p.codeBlockNotice != "" && p.storageNotice == "" {
+		content += styles.NewStyle().
+			Foreground(t.TextMuted()).
+			Render(p.codeBlockNotice)
+	}
+	content += "\n"
 
 	// Calculate visible lines using line-based rendering
 	visibleLines := p.calculateVisibleLines()
@@ -1287,6 +1926,14 @@ func (p *MessagesPanel) calculateVisibleLines() []RenderedLine {
 	return visibleLines
 }
 
+// assistantPrefix labels a reply with the agent that answered, when known
+func assistantPrefix(message types.MessageInfo) string {
+	if message.Agent == "" {
+		return "🤖 Assistant: "
+	}
+	return fmt.Sprintf("🤖 Assistant (%s): ", message.Agent)
+}
+
 // calculateMessageHeight calculates the actual height needed to render a message
 func (p *MessagesPanel) calculateMessageHeight(message types.MessageInfo) int {
 	// Start with base height for borders and padding
@@ -1300,7 +1947,7 @@ func (p *MessagesPanel) calculateMessageHeight(message types.MessageInfo) int {
 	case "user":
 		prefix = "🧑 You: "
 	case "assistant":
-		prefix = "🤖 Assistant: "
+		prefix = assistantPrefix(message)
 	case "system":
 		prefix = "⚙️ System: "
 	default:
@@ -1378,7 +2025,7 @@ func (p *MessagesPanel) renderMessage(message types.MessageInfo) string {
 			BorderLeft(true).
 			BorderRight(true).
 			BorderForeground(t.Info())
-		prefix = "🤖 Assistant: "
+		prefix = assistantPrefix(message)
 	case "system":
 		// System messages: default text color with no background
 		style = styles.NewStyle().
@@ -1440,7 +2087,7 @@ func (p *MessagesPanel) renderMessage(message types.MessageInfo) string {
 
 	// Add timestamp if enabled
 	if p.showTimestamps {
-		timestamp := message.Timestamp.Format("15:04:05")
+		timestamp := timefmt.Clock(message.Timestamp)
 		if p.markdownMode {
 			// For markdown mode, add timestamp to the first line only
 			lines := strings.Split(content, "\n")
@@ -1488,6 +2135,16 @@ func (p *MessagesPanel) renderMessage(message types.MessageInfo) string {
 		} else {
 			content += " ❌"
 		}
+	} else if message.Status == "cancelled" {
+		if p.markdownMode {
+			lines := strings.Split(content, "\n")
+			if len(lines) > 0 {
+				lines[len(lines)-1] += " [cancelled]"
+				content = strings.Join(lines, "\n")
+			}
+		} else {
+			content += " [cancelled]"
+		}
 	}
 
 	return style.Render(content)
@@ -1548,6 +2205,12 @@ type MessagesRefreshedMsg struct {
 	Messages []types.MessageInfo
 }
 
+// FullContentLoadedMsg carries messages with their truncated bodies fetched,
+// by the body reference the preview stood for
+type FullContentLoadedMsg struct {
+	Bodies map[string]types.MessageInfo
+}
+
 type StreamingStartedMsg struct{}
 
 type StreamingUpdateMsg struct {
@@ -1577,7 +2240,7 @@ func min(a, b int) int {
 
 // generateContentHash creates a hash for caching purposes
 func (lr *LineBasedRenderer) generateContentHash(message types.MessageInfo, width int, mode string, showTimestamps bool) string {
-	content := fmt.Sprintf("%s|%s|%s|%d|%s|%t|%s", message.ID, message.Content, message.Status, width, mode, showTimestamps, message.Type)
+	content := fmt.Sprintf("%s|%s|%s|%d|%s|%t|%s|%s|%s", message.ID, message.Content, message.Status, width, mode, showTimestamps, message.Type, contentSummary(message.Meta), message.Agent)
 	hash := md5.Sum([]byte(content))
 	return hex.EncodeToString(hash[:])
 }
@@ -1588,13 +2251,13 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 
 	// For empty pending assistant messages, show a thinking placeholder
 	if message.Type == "assistant" && message.Status == "pending" && strings.TrimSpace(message.Content) == "" {
-		prefix := "🤖 Assistant: "
+		prefix := assistantPrefix(message)
 		placeholder := "thinking... ⏳"
 		finalLine := prefix + placeholder
 
 		// Add timestamp if enabled
 		if showTimestamps {
-			timestamp := message.Timestamp.Format("15:04:05")
+			timestamp := timefmt.Clock(message.Timestamp)
 			finalLine = fmt.Sprintf("[%s] %s", timestamp, finalLine)
 		}
 
@@ -1643,7 +2306,7 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 	case "user":
 		prefix = "🧑 You: "
 	case "assistant":
-		prefix = "🤖 Assistant: "
+		prefix = assistantPrefix(message)
 	case "system":
 		prefix = "⚙️ System: "
 	default:
@@ -1671,7 +2334,7 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 
 			// Add timestamp if enabled and this is the first line
 			if showTimestamps && i == 0 {
-				timestamp := message.Timestamp.Format("15:04:05")
+				timestamp := timefmt.Clock(message.Timestamp)
 				finalLine = fmt.Sprintf("[%s] %s", timestamp, finalLine)
 			}
 
@@ -1693,7 +2356,7 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 
 		// Add timestamp if enabled
 		if showTimestamps {
-			timestamp := message.Timestamp.Format("15:04:05")
+			timestamp := timefmt.Clock(message.Timestamp)
 			content = fmt.Sprintf("[%s] %s", timestamp, content)
 		}
 
@@ -1725,9 +2388,23 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 			lines[lastIndex].Content += " ⏳"
 		} else if message.Status == "error" {
 			lines[lastIndex].Content += " ❌"
+		} else if message.Status == "cancelled" {
+			lines[lastIndex].Content += " [cancelled]"
 		}
 	}
 
+	// Replies carrying code or diffs get a summary line under them
+	if summary := contentSummary(message.Meta); summary != "" && message.Type != "user" && len(lines) > 0 {
+		lines[len(lines)-1].IsLastLine = false
+		lines = append(lines, RenderedLine{
+			Content:     strings.Repeat(" ", 3) + "⌁ " + summary,
+			MessageID:   message.ID,
+			MessageType: message.Type,
+			LineIndex:   len(lines),
+			IsLastLine:  true,
+		})
+	}
+
 	// Cache the result (only for non-pending messages)
 	if useCaching {
 		lr.renderCache[contentHash] = &MessageRenderCache{
@@ -1744,6 +2421,30 @@ func (lr *LineBasedRenderer) renderMessageToLines(message types.MessageInfo, wid
 	return lines
 }
 
+// contentSummary describes the code and diffs of a message body from the
+// metadata the state server attached, e.g. "go · 2 code blocks, 40 lines · +12 −3";
+// empty for bodies without either
+func contentSummary(meta *types.ContentMeta) string {
+	if meta == nil || (meta.CodeBlocks == 0 && meta.Additions+meta.Deletions == 0) {
+		return ""
+	}
+	var parts []string
+	if meta.Language != "" {
+		parts = append(parts, meta.Language)
+	}
+	switch meta.CodeBlocks {
+	case 0:
+	case 1:
+		parts = append(parts, fmt.Sprintf("1 code block, %d lines", meta.CodeLines))
+	default:
+		parts = append(parts, fmt.Sprintf("%d code blocks, %d lines", meta.CodeBlocks, meta.CodeLines))
+	}
+	if meta.Additions+meta.Deletions > 0 {
+		parts = append(parts, fmt.Sprintf("+%d −%d", meta.Additions, meta.Deletions))
+	}
+	return strings.Join(parts, " · ")
+}
+
 // wordWrap wraps text to fit within specified width (helper method)
 func (lr *LineBasedRenderer) wordWrap(text string, width int) string {
 	if width <= 0 {
@@ -1798,7 +2499,26 @@ func (lr *LineBasedRenderer) rebuildRenderedLines(messages []types.MessageInfo,
 		}
 	}
 
+	// Replies in collapsed threads are hidden behind a line under the message
+	// starting the thread
+	hidden := make(map[string]bool)
+	hiddenReplies := make(map[string]int)
+	if len(lr.collapsed) > 0 {
+		for _, thread := range types.GroupThreads(messages) {
+			if !lr.collapsed[thread.ID()] {
+				continue
+			}
+			for _, reply := range thread.Replies {
+				hidden[reply.ID] = true
+			}
+			hiddenReplies[thread.ID()] = len(thread.Replies)
+		}
+	}
+
 	for i, message := range messages {
+		if hidden[message.ID] {
+			continue
+		}
 		// Skip older pending assistant messages with empty content to avoid multiple "thinking" indicators
 		if message.Type == "assistant" && message.Status == "pending" && strings.TrimSpace(message.Content) == "" && i != latestPendingAssistantIndex {
 			log.Printf("[RENDERER] Skipping older pending assistant message %s to avoid duplicate thinking indicators", message.ID)
@@ -1817,6 +2537,22 @@ func (lr *LineBasedRenderer) rebuildRenderedLines(messages []types.MessageInfo,
 		lr.totalLines += len(messageLines)
 		log.Printf("[RENDERER] Rendered message %s into %d lines", message.ID, len(messageLines))
 
+		if count := hiddenReplies[message.ID]; count > 0 {
+			noun := "replies"
+			if count == 1 {
+				noun = "reply"
+			}
+			lr.lineToMessage[lr.totalLines] = message.ID
+			lr.renderedLines = append(lr.renderedLines, RenderedLine{
+				Content:     fmt.Sprintf("  ▸ %d %s hidden (z to expand)", count, noun),
+				MessageID:   message.ID,
+				MessageType: "system",
+				LineIndex:   lr.totalLines,
+				IsLastLine:  true,
+			})
+			lr.totalLines++
+		}
+
 		// Add separator line between messages (except for the last message)
 		if i < len(messages)-1 {
 			separatorLine := RenderedLine{
@@ -1838,6 +2574,14 @@ func (lr *LineBasedRenderer) rebuildRenderedLines(messages []types.MessageInfo,
 	log.Printf("[RENDERER] Rebuilt %d total lines from %d messages", lr.totalLines, len(messages))
 }
 
+// setCollapsed replaces the collapsed threads
+func (lr *LineBasedRenderer) setCollapsed(rootIDs []string) {
+	lr.collapsed = make(map[string]bool, len(rootIDs))
+	for _, id := range rootIDs {
+		lr.collapsed[id] = true
+	}
+}
+
 // getVisibleLines returns the lines that should be visible based on scroll offset and available height
 func (lr *LineBasedRenderer) getVisibleLines(scrollOffset int, availableHeight int) []RenderedLine {
 	if len(lr.renderedLines) == 0 || availableHeight <= 0 {
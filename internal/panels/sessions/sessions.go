@@ -12,8 +12,10 @@ import (
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea/v2"
+	"github.com/opencode/tmux_coder/internal/gitstatus"
 	"github.com/opencode/tmux_coder/internal/ipc"
 	"github.com/opencode/tmux_coder/internal/panel"
+	"github.com/opencode/tmux_coder/internal/state"
 	"github.com/opencode/tmux_coder/internal/styles"
 	"github.com/opencode/tmux_coder/internal/theme"
 	"github.com/opencode/tmux_coder/internal/types"
@@ -25,7 +27,10 @@ import (
 type SessionsPanel struct {
 	client            *opencode.Client
 	ipcClient         *ipc.SocketClient
-	sessions          []types.SessionInfo
+	sessions          []types.SessionInfo // The sessions shown, in list order
+	allSessions       []types.SessionInfo // Sessions of every workspace
+	workspace         string              // Sessions of other workspaces are hidden unless the order shows all
+	tmuxSession       string              // Resolved name of the orchestrator's tmux session
 	currentIndex      int
 	currentSessionID  string
 	width             int
@@ -34,10 +39,15 @@ type SessionsPanel struct {
 	cancel            context.CancelFunc
 	version           int64 // Store the state version directly in the model
 	eventsChan        chan types.StateEvent
-	program           *tea.Program // Reference to the program for triggering updates
-	scrollOffset      int          // Track scroll position for viewport
-	lastError         string       // Store last error message for display
-	isCreatingSession bool         // Track session creation in progress
+	subscriber        *ipc.Subscriber
+	program           *tea.Program      // Reference to the program for triggering updates
+	scrollOffset      int               // Track scroll position for viewport
+	lastError         string            // Store last error message for display
+	pendingDelete     *ConfirmDeleteMsg // Deletion waiting for the user to press d again
+	isCreatingSession bool              // Track session creation in progress
+	locks             []types.SessionLock
+	git               *types.GitState    // Workspace repository, nil outside one
+	order             types.SessionOrder // sessions are kept sorted in this order
 }
 
 // RunConfig describes runtime configuration for the sessions panel.
@@ -177,16 +187,37 @@ func NewSessionsPanel(parent context.Context, httpClient *opencode.Client, socke
 		eventsChan:   make(chan types.StateEvent, 64),
 	}
 
-	// Register event handlers
-	// Bridge IPC session events into Bubble Tea loop to force immediate UI refresh
-	panel.ipcClient.RegisterEventHandler(types.EventSessionAdded, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventSessionDeleted, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventSessionUpdated, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventSessionChanged, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventStateSync, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventThemeChanged, panel.forwardSessionEventToUI)
-	panel.ipcClient.RegisterEventHandler(types.EventUIActionTriggered, panel.forwardSessionEventToUI)
+	// Render-only panel: read full state from the shared snapshot when published
+	if path := os.Getenv("OPENCODE_STATE_SNAPSHOT"); path != "" {
+		if err := panel.ipcClient.EnableSnapshot(path); err != nil {
+			log.Printf("State snapshot disabled: %v", err)
+		}
+	}
+
+	panel.ipcClient.SetIdentity(os.Getenv(ipc.PanelIdentityEnv))
+
+	// The session list shows no message content
+	panel.ipcClient.SetCapabilities(types.PanelCapabilities{UIActions: []types.UIAction{types.UIActionFocusPane}})
 
+	// Register event handlers on a supervised subscriber
+	// Bridge IPC session events into Bubble Tea loop to force immediate UI refresh
+	panel.subscriber = panel.ipcClient.NewSubscriber("sessions", 0)
+	panel.subscriber.Handle(types.EventSessionAdded, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionDeleted, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionUpdated, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionChanged, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionLocked, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionUnlocked, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionOrderChanged, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionReordered, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventSessionPinned, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventStateSync, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventThemeChanged, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventUIActionTriggered, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventGitStatusChanged, panel.forwardSessionEventToUI)
+	panel.subscriber.Handle(types.EventWorkspaceChanged, panel.forwardSessionEventToUI)
+
+	panel.subscriber.Start()
 	return panel
 }
 
@@ -250,11 +281,16 @@ func (p *SessionsPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		return p, nil
 
 	case StateLoadedMsg:
-		p.sessions = msg.State.Sessions
+		p.order = msg.State.SessionOrder
+		p.allSessions = msg.State.Sessions
+		p.workspace = msg.State.Workspace
+		p.tmuxSession = msg.State.TmuxSession
 		p.currentSessionID = msg.State.CurrentSessionID
+		p.locks = msg.State.SessionLocks
+		p.git = msg.State.Git
 		p.version = msg.State.Version.Version // Explicitly store the version in the model state
 		log.Printf("[SESSIONS] Stored version %d in model state", p.version)
-		p.updateCurrentIndex()
+		p.sortSessions()
 		return p, nil
 
 	case ErrorMsg:
@@ -272,7 +308,12 @@ func (p *SessionsPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		log.Printf("[SESSIONS] Session updated: %s", msg.Session.ID)
 		return p, nil
 
+	case ConfirmDeleteMsg:
+		p.pendingDelete = &msg
+		return p, nil
+
 	case SessionDeletedMsg:
+		p.pendingDelete = nil
 		log.Printf("Session deleted: %s", msg.SessionID)
 		// UI will be refreshed automatically since the session was already removed
 		// from p.sessions in handleSessionDeleted via the SessionEventMsg flow
@@ -282,18 +323,17 @@ func (p *SessionsPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		log.Printf("Session created: %s", msg.Session.ID)
 		// Add the new session to the local list if not already present
 		found := false
-		for _, s := range p.sessions {
+		for _, s := range p.allSessions {
 			if s.ID == msg.Session.ID {
 				found = true
 				break
 			}
 		}
 		if !found {
-			p.sessions = append(p.sessions, msg.Session)
+			p.allSessions = append(p.allSessions, msg.Session)
 			// Select the newly created session
-			p.currentIndex = len(p.sessions) - 1
 			p.currentSessionID = msg.Session.ID
-			p.updateScrollOffset()
+			p.sortSessions()
 			log.Printf("Added new session to list at index %d", p.currentIndex)
 		}
 		p.isCreatingSession = false
@@ -309,6 +349,10 @@ func (p *SessionsPanel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		_, cmd := p.handleSessionEvent(msg.Event)
 		return p, tea.Batch(cmd, p.subscribeSessionEvents())
 
+	case SessionUpdateAppliedMsg:
+		// The server does not echo our own updates, so apply them here
+		return p.handleSessionEvent(msg.Event)
+
 	case ThemeChangedMsg:
 		log.Printf("[SESSIONS] Applying theme change: %s", msg.Theme)
 		// Apply the theme change immediately
@@ -368,6 +412,43 @@ func (p *SessionsPanel) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 
 	case "r":
 		return p, p.refreshSessions()
+
+	case "s":
+		order := p.order
+		order.Mode = order.Mode.Next()
+		return p, p.sendSessionUpdate(types.SessionOrderChanged, types.SessionOrderPayload{Order: order})
+
+	case "P":
+		order := p.order
+		order.PinnedFirst = !order.PinnedFirst
+		return p, p.sendSessionUpdate(types.SessionOrderChanged, types.SessionOrderPayload{Order: order})
+
+	case "w":
+		order := p.order
+		order.AllWorkspaces = !order.AllWorkspaces
+		return p, p.sendSessionUpdate(types.SessionOrderChanged, types.SessionOrderPayload{Order: order})
+
+	case "p":
+		if p.currentIndex >= 0 && p.currentIndex < len(p.sessions) {
+			session := p.sessions[p.currentIndex]
+			return p, p.sendSessionUpdate(types.SessionPinned, types.SessionPinPayload{SessionID: session.ID, Pinned: !session.Pinned})
+		}
+
+	case "K", "shift+up":
+		if p.currentIndex > 0 && p.currentIndex < len(p.sessions) {
+			return p, p.sendSessionUpdate(types.SessionReordered, types.SessionReorderPayload{
+				SessionID: p.sessions[p.currentIndex].ID,
+				Before:    p.sessions[p.currentIndex-1].ID,
+			})
+		}
+
+	case "J", "shift+down":
+		if p.currentIndex >= 0 && p.currentIndex < len(p.sessions)-1 {
+			return p, p.sendSessionUpdate(types.SessionReordered, types.SessionReorderPayload{
+				SessionID: p.sessions[p.currentIndex].ID,
+				After:     p.sessions[p.currentIndex+1].ID,
+			})
+		}
 	}
 
 	return p, nil
@@ -459,17 +540,28 @@ func (p *SessionsPanel) createNewSession() tea.Cmd {
 func (p *SessionsPanel) deleteCurrentSession() tea.Cmd {
 	if p.currentIndex >= 0 && p.currentIndex < len(p.sessions) {
 		sessionID := p.sessions[p.currentIndex].ID
+		// A second press on the same session confirms a deletion the server held back
+		token := ""
+		if p.pendingDelete != nil && p.pendingDelete.SessionID == sessionID && time.Now().Before(p.pendingDelete.ExpiresAt) {
+			token = p.pendingDelete.Token
+		}
+		p.pendingDelete = nil
 		return func() tea.Msg {
 			// Send update first to remove from shared state
 			update := types.StateUpdate{
-				Type:            types.SessionDeleted,
-				ExpectedVersion: p.expectedVersion(),
-				Payload:         types.SessionDeletePayload{SessionID: sessionID},
-				SourcePanel:     "sessions-panel",
-				Timestamp:       time.Now(),
+				Type:              types.SessionDeleted,
+				ExpectedVersion:   p.expectedVersion(),
+				Payload:           types.SessionDeletePayload{SessionID: sessionID},
+				SourcePanel:       "sessions-panel",
+				Timestamp:         time.Now(),
+				ConfirmationToken: token,
 			}
 
 			newVersion, err := p.ipcClient.SendStateUpdateAndWait(update)
+			var required *ipc.ConfirmationRequiredError
+			if errors.As(err, &required) {
+				return ConfirmDeleteMsg{SessionID: sessionID, Token: required.Token, ExpiresAt: required.ExpiresAt}
+			}
 			if err != nil {
 				// If state update fails, don't proceed with API deletion
 				return ErrorMsg{Error: fmt.Errorf("failed to update state for session deletion: %w", err)}
@@ -488,6 +580,27 @@ func (p *SessionsPanel) deleteCurrentSession() tea.Cmd {
 	return nil
 }
 
+// sendSessionUpdate sends an update to the list's order or pins and applies
+// it locally once the server accepts it
+func (p *SessionsPanel) sendSessionUpdate(updateType types.UpdateType, payload interface{}) tea.Cmd {
+	return func() tea.Msg {
+		update := types.StateUpdate{
+			Type:            updateType,
+			ExpectedVersion: p.expectedVersion(),
+			Payload:         payload,
+			SourcePanel:     "sessions-panel",
+			Timestamp:       time.Now(),
+		}
+
+		newVersion, err := p.ipcClient.SendStateUpdateAndWait(update)
+		if err != nil {
+			log.Printf("[SESSIONS] Failed to send %s update: %v", updateType, err)
+			return ErrorMsg{Error: err}
+		}
+		return SessionUpdateAppliedMsg{Event: state.CreateEventFromUpdate(update, newVersion)}
+	}
+}
+
 // refreshSessions refreshes the sessions list from the API
 func (p *SessionsPanel) refreshSessions() tea.Cmd {
 	return func() tea.Msg {
@@ -523,7 +636,8 @@ func (p *SessionsPanel) handleSessionAdded(event types.StateEvent) error {
 	if payload, ok := event.Data.(map[string]interface{}); ok {
 		var sessionAddPayload types.SessionAddPayload
 		if err := decodePayload(payload, &sessionAddPayload); err == nil {
-			p.sessions = append(p.sessions, sessionAddPayload.Session)
+			p.allSessions = append(p.allSessions, sessionAddPayload.Session)
+			p.sortSessions()
 			p.version = event.Version
 			log.Printf("Session added: %s, version updated to %d", sessionAddPayload.Session.ID, p.version)
 
@@ -542,15 +656,16 @@ func (p *SessionsPanel) handleSessionDeleted(event types.StateEvent) error {
 	if payload, ok := event.Data.(map[string]interface{}); ok {
 		var sessionDeletePayload types.SessionDeletePayload
 		if err := decodePayload(payload, &sessionDeletePayload); err == nil {
-			for i, session := range p.sessions {
+			for i, session := range p.allSessions {
 				if session.ID == sessionDeletePayload.SessionID {
-					p.sessions = append(p.sessions[:i], p.sessions[i+1:]...)
-					if p.currentIndex >= len(p.sessions) && len(p.sessions) > 0 {
-						p.currentIndex = len(p.sessions) - 1
-					}
+					p.allSessions = append(p.allSessions[:i], p.allSessions[i+1:]...)
 					break
 				}
 			}
+			p.sessions = types.ShownSessions(p.allSessions, p.order, p.workspace)
+			if p.currentIndex >= len(p.sessions) && len(p.sessions) > 0 {
+				p.currentIndex = len(p.sessions) - 1
+			}
 			p.version = event.Version
 			log.Printf("Session deleted: %s, version updated to %d", sessionDeletePayload.SessionID, p.version)
 
@@ -570,17 +685,18 @@ func (p *SessionsPanel) handleSessionUpdated(event types.StateEvent) error {
 		var sessionUpdatePayload types.SessionUpdatePayload
 		if err := decodePayload(payload, &sessionUpdatePayload); err == nil {
 			var updatedSession types.SessionInfo
-			for i, session := range p.sessions {
+			for i, session := range p.allSessions {
 				if session.ID == sessionUpdatePayload.SessionID {
 					if sessionUpdatePayload.Title != "" {
-						p.sessions[i].Title = sessionUpdatePayload.Title
+						p.allSessions[i].Title = sessionUpdatePayload.Title
 					}
-					p.sessions[i].IsActive = sessionUpdatePayload.IsActive
-					p.sessions[i].UpdatedAt = time.Now()
-					updatedSession = p.sessions[i]
+					p.allSessions[i].IsActive = sessionUpdatePayload.IsActive
+					p.allSessions[i].UpdatedAt = time.Now()
+					updatedSession = p.allSessions[i]
 					break
 				}
 			}
+			p.sortSessions()
 			p.version = event.Version
 			log.Printf("Session updated: %s, version updated to %d", sessionUpdatePayload.SessionID, p.version)
 
@@ -621,10 +737,15 @@ func (p *SessionsPanel) handleStateSync(event types.StateEvent) error {
 		// Smart cache invalidation - only update if version is newer
 		if payload.State.Version.Version > p.version {
 			oldVersion := p.version
-			p.sessions = payload.State.Sessions
+			p.order = payload.State.SessionOrder
+			p.allSessions = payload.State.Sessions
+			p.workspace = payload.State.Workspace
+			p.tmuxSession = payload.State.TmuxSession
 			p.currentSessionID = payload.State.CurrentSessionID
+			p.locks = payload.State.SessionLocks
+			p.git = payload.State.Git
 			p.version = payload.State.Version.Version
-			p.updateCurrentIndex()
+			p.sortSessions()
 			log.Printf("State synchronized from version %d to %d", oldVersion, p.version)
 
 			// Trigger immediate UI update for state sync
@@ -644,6 +765,115 @@ func (p *SessionsPanel) handleStateSync(event types.StateEvent) error {
 	return nil
 }
 
+func (p *SessionsPanel) handleSessionLocked(event types.StateEvent) error {
+	var payload types.SessionLockPayload
+	if err := decodePayload(event.Data, &payload); err != nil || payload.Lock == nil {
+		return err
+	}
+	p.removeLock(payload.SessionID)
+	p.locks = append(p.locks, *payload.Lock)
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleSessionUnlocked(event types.StateEvent) error {
+	var payload types.SessionUnlockPayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	p.removeLock(payload.SessionID)
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleSessionOrderChanged(event types.StateEvent) error {
+	var payload types.SessionOrderPayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	p.order = payload.Order
+	p.sortSessions()
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleSessionReordered(event types.StateEvent) error {
+	var payload types.SessionReorderPayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	sessions, err := types.ReorderSessions(p.allSessions, p.order, payload)
+	if err != nil {
+		// Out of step with the server; the next state sync will correct it
+		log.Printf("[SESSIONS] Cannot apply reorder: %v", err)
+		return err
+	}
+	p.allSessions = sessions
+	p.order.Mode = types.SessionSortManual
+	p.sortSessions()
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleSessionPinned(event types.StateEvent) error {
+	var payload types.SessionPinPayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	for i := range p.allSessions {
+		if p.allSessions[i].ID == payload.SessionID {
+			p.allSessions[i].Pinned = payload.Pinned
+			break
+		}
+	}
+	p.sortSessions()
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleWorkspaceChanged(event types.StateEvent) error {
+	var payload types.WorkspacePayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	p.workspace = payload.Workspace
+	p.tmuxSession = payload.TmuxSession
+	p.sortSessions()
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) handleGitStatusChanged(event types.StateEvent) error {
+	var payload types.GitStatusPayload
+	if err := decodePayload(event.Data, &payload); err != nil {
+		return err
+	}
+	p.git = payload.Git
+	p.version = event.Version
+	return nil
+}
+
+func (p *SessionsPanel) removeLock(sessionID string) {
+	kept := p.locks[:0]
+	for _, lock := range p.locks {
+		if lock.SessionID != sessionID {
+			kept = append(kept, lock)
+		}
+	}
+	p.locks = kept
+}
+
+// sessionLock returns the unexpired lock on a session, if any
+func (p *SessionsPanel) sessionLock(sessionID string) (types.SessionLock, bool) {
+	now := time.Now()
+	for _, lock := range p.locks {
+		if lock.SessionID == sessionID && !lock.Expired(now) {
+			return lock, true
+		}
+	}
+	return types.SessionLock{}, false
+}
+
 func (p *SessionsPanel) handleThemeChanged(event types.StateEvent) error {
 	var payload types.ThemeChangePayload
 	if err := decodePayload(event.Data, &payload); err != nil {
@@ -675,20 +905,22 @@ func (p *SessionsPanel) handleThemeChanged(event types.StateEvent) error {
 func (p *SessionsPanel) handleUIActionTriggered(event types.StateEvent) error {
 	log.Printf("[SESSIONS] Received UI action triggered event: %+v", event)
 
-	// Extract action from the event payload
-	if payloadMap, ok := event.Data.(map[string]interface{}); ok {
-		if actionRaw, exists := payloadMap["action"]; exists {
-			if action, ok := actionRaw.(string); ok {
-				log.Printf("[SESSIONS] UI action: %s", action)
-				// Sessions panel doesn't need to handle modal dialogs directly
-				// These are typically handled by other panels or the main TUI
-				// Just log for now
-				return nil
-			}
-		}
+	payload, ok := types.UIActionFromEvent(event)
+	if !ok {
+		log.Printf("[SESSIONS] Failed to extract action from UI action event payload")
+		return nil
 	}
+	log.Printf("[SESSIONS] UI action: %s", payload.Action)
 
-	log.Printf("[SESSIONS] Failed to extract action from UI action event payload")
+	if payload.Action == types.UIActionFocusPane {
+		var args types.FocusPaneArgs
+		if err := payload.DecodeArgs(&args); err != nil {
+			return err
+		}
+		if args.Panel == "sessions" {
+			return panel.FocusOwnPane()
+		}
+	}
 	return nil
 }
 
@@ -703,12 +935,26 @@ func (p *SessionsPanel) handleSessionEvent(event types.StateEvent) (tea.Model, t
 		p.handleSessionUpdated(event)
 	case types.EventSessionChanged:
 		p.handleSessionChanged(event)
+	case types.EventSessionLocked:
+		p.handleSessionLocked(event)
+	case types.EventSessionUnlocked:
+		p.handleSessionUnlocked(event)
+	case types.EventSessionOrderChanged:
+		p.handleSessionOrderChanged(event)
+	case types.EventSessionReordered:
+		p.handleSessionReordered(event)
+	case types.EventSessionPinned:
+		p.handleSessionPinned(event)
 	case types.EventStateSync:
 		p.handleStateSync(event)
 	case types.EventThemeChanged:
 		p.handleThemeChanged(event)
 	case types.EventUIActionTriggered:
 		p.handleUIActionTriggered(event)
+	case types.EventGitStatusChanged:
+		p.handleGitStatusChanged(event)
+	case types.EventWorkspaceChanged:
+		p.handleWorkspaceChanged(event)
 	}
 	return p, nil
 }
@@ -731,6 +977,14 @@ func (p *SessionsPanel) subscribeSessionEvents() tea.Cmd {
 	}
 }
 
+// sortSessions puts sessions in the list's order and picks the ones shown,
+// keeping the current session selected
+func (p *SessionsPanel) sortSessions() {
+	p.allSessions = types.SortSessions(p.allSessions, p.order)
+	p.sessions = types.ShownSessions(p.allSessions, p.order, p.workspace)
+	p.updateCurrentIndex()
+}
+
 // updateCurrentIndex updates the current index based on current session ID
 func (p *SessionsPanel) updateCurrentIndex() {
 	for i, session := range p.sessions {
@@ -747,12 +1001,22 @@ func (p *SessionsPanel) updateCurrentIndex() {
 	}
 }
 
-// updateScrollOffset adjusts scroll offset to keep current selection visible
-func (p *SessionsPanel) updateScrollOffset() {
+// visibleLines returns how many sessions fit: total height - header (2 lines,
+// 3 with a status line) - help text (2 lines)
+func (p *SessionsPanel) visibleLines() int {
 	visibleLines := p.height - 4
+	if statusLine(p.tmuxSession, gitstatus.Summary(p.git)) != "" {
+		visibleLines--
+	}
 	if visibleLines < 1 {
 		visibleLines = 1
 	}
+	return visibleLines
+}
+
+// updateScrollOffset adjusts scroll offset to keep current selection visible
+func (p *SessionsPanel) updateScrollOffset() {
+	visibleLines := p.visibleLines()
 
 	// If current index is above the viewport, scroll up
 	if p.currentIndex < p.scrollOffset {
@@ -813,13 +1077,17 @@ func (p *SessionsPanel) renderSessionsList() string {
 	content += styles.NewStyle().
 		Foreground(t.Primary()).
 		Bold(true).
-		Render("Sessions") + "\n\n"
-
-	// Calculate visible area: total height - header (2 lines) - help text (2 lines) - margins
-	visibleLines := p.height - 4
-	if visibleLines < 1 {
-		visibleLines = 1
+		Render("Sessions") + styles.NewStyle().
+		Foreground(t.TextMuted()).
+		Render(" "+sortLabel(p.order, p.workspace)) + "\n"
+	if summary := statusLine(p.tmuxSession, gitstatus.Summary(p.git)); summary != "" {
+		content += styles.NewStyle().
+			Foreground(t.TextMuted()).
+			Render(" "+summary) + "\n"
 	}
+	content += "\n"
+
+	visibleLines := p.visibleLines()
 
 	// Calculate viewport
 	startIdx, endIdx := p.calculateViewport(visibleLines)
@@ -853,6 +1121,9 @@ func (p *SessionsPanel) renderSessionsList() string {
 		} else {
 			indicator = "  "
 		}
+		if session.Pinned {
+			indicator += "⚑ "
+		}
 
 		title := session.Title
 		if title == "" {
@@ -860,6 +1131,12 @@ func (p *SessionsPanel) renderSessionsList() string {
 		}
 
 		sessionLine := fmt.Sprintf("%s%s%s (%d msgs)", prefix, indicator, title, session.MessageCount)
+		if session.Workspace != "" && p.workspace != "" && !types.SameWorkspace(session.Workspace, p.workspace) {
+			sessionLine += fmt.Sprintf(" [%s]", filepath.Base(session.Workspace))
+		}
+		if lock, ok := p.sessionLock(session.ID); ok {
+			sessionLine += fmt.Sprintf(" [locked by %s]", lock.Owner)
+		}
 		content += style.Render(sessionLine) + "\n"
 	}
 
@@ -869,6 +1146,11 @@ func (p *SessionsPanel) renderSessionsList() string {
 			Foreground(t.Primary()).
 			Bold(true).
 			Render("Creating new session...")
+	} else if p.pendingDelete != nil && time.Now().Before(p.pendingDelete.ExpiresAt) {
+		content += "\n" + styles.NewStyle().
+			Foreground(t.Warning()).
+			Bold(true).
+			Render(fmt.Sprintf("Press d again within %v to delete this session", time.Until(p.pendingDelete.ExpiresAt).Round(time.Second)))
 	} else if p.lastError != "" {
 		content += "\n" + styles.NewStyle().
 			Foreground(t.Error()).
@@ -885,11 +1167,43 @@ func (p *SessionsPanel) renderSessionsList() string {
 	// Add help text
 	content += "\n" + styles.NewStyle().
 		Foreground(t.TextMuted()).
-		Render("↑/k up • ↓/j down • enter select • n new • d delete • r refresh • q quit"+scrollInfo)
+		Render("↑/k up • ↓/j down • enter select • n new • d delete • r refresh • s sort • p pin • P pinned first • w all workspaces • K/J move • q quit"+scrollInfo)
 
 	return content
 }
 
+// statusLine joins the tmux session name and repository summary shown under
+// the header, either of which may be empty
+func statusLine(tmuxSession, gitSummary string) string {
+	switch {
+	case tmuxSession == "":
+		return gitSummary
+	case gitSummary == "":
+		return tmuxSession
+	}
+	return tmuxSession + " · " + gitSummary
+}
+
+// sortLabel describes the list's order and which workspaces it shows for
+// the header
+func sortLabel(order types.SessionOrder, workspace string) string {
+	mode := order.Mode
+	if mode == "" {
+		mode = types.SessionSortManual
+	}
+	label := string(mode)
+	if order.PinnedFirst {
+		label += ", pinned first"
+	}
+	switch {
+	case order.AllWorkspaces:
+		label += ", all workspaces"
+	case workspace != "":
+		label += ", " + filepath.Base(workspace)
+	}
+	return "(" + label + ")"
+}
+
 // Message types
 type ConnectedMsg struct{}
 
@@ -905,6 +1219,12 @@ type SessionEventMsg struct {
 	Event types.StateEvent
 }
 
+// SessionUpdateAppliedMsg carries the event for an update this panel sent
+// and the server applied
+type SessionUpdateAppliedMsg struct {
+	Event types.StateEvent
+}
+
 type SessionSelectedMsg struct {
 	SessionID string
 }
@@ -917,6 +1237,13 @@ type SessionDeletedMsg struct {
 	SessionID string
 }
 
+// ConfirmDeleteMsg holds a deletion the server wants confirmed
+type ConfirmDeleteMsg struct {
+	SessionID string
+	Token     string
+	ExpiresAt time.Time
+}
+
 type SessionSyncMsg struct {
 	Sessions         []types.SessionInfo
 	CurrentSessionID string
@@ -1020,6 +1347,7 @@ func Run(ctx context.Context, cfg RunConfig, httpClient *opencode.Client) error
 	_, err = program.Run()
 	close(done)
 
+	panel.subscriber.Stop()
 	panel.ipcClient.Disconnect()
 	panel.cancel()
 
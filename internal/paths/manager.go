@@ -35,6 +35,11 @@ func (p *PathManager) SocketPath() string {
 	return filepath.Join(p.baseDir, "sockets", p.sessionName+".sock")
 }
 
+// ReplicaSocketPath returns the socket a read replica of the session serves on
+func (p *PathManager) ReplicaSocketPath() string {
+	return filepath.Join(p.baseDir, "sockets", p.sessionName+".replica.sock")
+}
+
 // StatePath returns the state file path
 func (p *PathManager) StatePath() string {
 	return filepath.Join(p.baseDir, "states", p.sessionName+".json")
@@ -45,6 +50,21 @@ func (p *PathManager) LogPath() string {
 	return filepath.Join(p.baseDir, "logs", p.sessionName+".log")
 }
 
+// PanelLogDir returns the directory holding the session's panel logs
+func (p *PathManager) PanelLogDir() string {
+	return filepath.Join(p.baseDir, "logs", p.sessionName)
+}
+
+// PanelLogPath returns the file a panel's stderr is captured to
+func (p *PathManager) PanelLogPath(panel string) string {
+	return filepath.Join(p.PanelLogDir(), panel+".log")
+}
+
+// ProfileDir returns the directory the daemon writes profiles to on request
+func (p *PathManager) ProfileDir() string {
+	return filepath.Join(p.baseDir, "profiles", p.sessionName)
+}
+
 // PIDPath returns the PID file path
 func (p *PathManager) PIDPath() string {
 	return filepath.Join(p.baseDir, "locks", p.sessionName+".pid")
@@ -75,13 +95,21 @@ func (p *PathManager) EnsureDirectories() error {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 
-		// For sockets directory, ensure it's accessible to all users for testing permissions
-		// This allows other users to connect to the socket (file-level permissions control access)
+		// For sockets directory, let other users traverse it to reach a socket they are
+		// permitted to use, but never create or replace entries (socket mode and peer
+		// credentials control access)
 		if strings.HasSuffix(dir, "sockets") {
-			if err := os.Chmod(dir, 0777); err != nil {
+			if err := os.Chmod(dir, 0711); err != nil {
 				return fmt.Errorf("failed to set permissions on sockets directory %s: %w", dir, err)
 			}
 		}
+
+		// State files hold conversation content, so keep their directory private
+		if strings.HasSuffix(dir, "states") {
+			if err := os.Chmod(dir, 0700); err != nil {
+				return fmt.Errorf("failed to set permissions on states directory %s: %w", dir, err)
+			}
+		}
 	}
 
 	return nil
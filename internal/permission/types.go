@@ -19,27 +19,75 @@ const (
 type Operation string
 
 const (
-	OperationShutdown     Operation = "shutdown"
-	OperationReloadLayout Operation = "reload_layout"
-	OperationGetStatus    Operation = "get_status"
-	OperationGetClients   Operation = "get_clients"
+	OperationShutdown       Operation = "shutdown"
+	OperationReloadLayout   Operation = "reload_layout"
+	OperationGetStatus      Operation = "get_status"
+	OperationGetClients     Operation = "get_clients"
+	OperationQueryAudit     Operation = "query_audit"
+	OperationQueryAnalytics Operation = "query_analytics"
+	OperationCollectGarbage Operation = "collect_garbage"
+	OperationGetSyncConfig  Operation = "get_sync_config"
+	OperationSetSyncConfig  Operation = "set_sync_config"
+	OperationGetDiagnostics Operation = "get_diagnostics"
+	OperationDeliveryStats  Operation = "get_delivery_stats"
+	OperationMacros         Operation = "macros"
+	OperationListFiles      Operation = "list_files"
+	OperationTerminalRun    Operation = "terminal_run"
+	OperationEditInput      Operation = "edit_input"
+	OperationCancelRun      Operation = "cancel_run"
+	OperationCompactSession Operation = "compact_session"
+	OperationCreateSession  Operation = "create_session"
+	OperationSwitchProfile  Operation = "switch_profile"
+	OperationAdmin          Operation = "admin"
 )
 
 // Policy defines permission requirements for operations
 type Policy struct {
-	Shutdown     PermissionLevel
-	ReloadLayout PermissionLevel
-	GetStatus    PermissionLevel
-	GetClients   PermissionLevel
+	Shutdown       PermissionLevel
+	ReloadLayout   PermissionLevel
+	GetStatus      PermissionLevel
+	GetClients     PermissionLevel
+	QueryAudit     PermissionLevel
+	QueryAnalytics PermissionLevel
+	CollectGarbage PermissionLevel
+	GetSyncConfig  PermissionLevel
+	SetSyncConfig  PermissionLevel
+	GetDiagnostics PermissionLevel
+	DeliveryStats  PermissionLevel
+	Macros         PermissionLevel
+	ListFiles      PermissionLevel
+	TerminalRun    PermissionLevel
+	EditInput      PermissionLevel
+	CancelRun      PermissionLevel
+	CompactSession PermissionLevel
+	CreateSession  PermissionLevel
+	SwitchProfile  PermissionLevel
+	Admin          PermissionLevel
 }
 
 // DefaultPolicy returns the default permission policy
 func DefaultPolicy() *Policy {
 	return &Policy{
-		Shutdown:     PermissionOwner, // Only owner can shutdown
-		ReloadLayout: PermissionGroup, // Same group can reload
-		GetStatus:    PermissionAny,   // Anyone can view status
-		GetClients:   PermissionAny,   // Anyone can list clients
+		Shutdown:       PermissionOwner, // Only owner can shutdown
+		ReloadLayout:   PermissionGroup, // Same group can reload
+		GetStatus:      PermissionAny,   // Anyone can view status
+		GetClients:     PermissionAny,   // Anyone can list clients
+		QueryAudit:     PermissionOwner, // Audit history reveals who did what
+		QueryAnalytics: PermissionGroup, // Same group can see usage totals; no content is returned
+		CollectGarbage: PermissionOwner, // Deletes persisted files
+		GetSyncConfig:  PermissionGroup, // Same group can inspect tuning
+		SetSyncConfig:  PermissionOwner, // Changes how state is saved
+		GetDiagnostics: PermissionGroup, // Lists connected panels and recent activity
+		DeliveryStats:  PermissionGroup, // Lists connected panels and their event counts
+		Macros:         PermissionOwner, // Replays submit prompts as the owner
+		ListFiles:      PermissionOwner, // Reveals workspace file names
+		TerminalRun:    PermissionOwner, // Runs shell commands as the owner
+		EditInput:      PermissionOwner, // Runs the owner's editor
+		CancelRun:      PermissionGroup, // Same group can stop a runaway reply
+		CompactSession: PermissionGroup, // Same group can summarize; originals are archived
+		CreateSession:  PermissionGroup, // Same group can start sessions from the configured templates
+		SwitchProfile:  PermissionGroup, // Same group can reload the layout anyway
+		Admin:          PermissionOwner, // Admin commands also need the admin token
 	}
 }
 
@@ -78,6 +126,38 @@ func (c *Checker) CheckPermission(op Operation, requester *interfaces.IpcRequest
 		required = c.policy.GetStatus
 	case OperationGetClients:
 		required = c.policy.GetClients
+	case OperationQueryAudit:
+		required = c.policy.QueryAudit
+	case OperationQueryAnalytics:
+		required = c.policy.QueryAnalytics
+	case OperationCollectGarbage:
+		required = c.policy.CollectGarbage
+	case OperationGetSyncConfig:
+		required = c.policy.GetSyncConfig
+	case OperationSetSyncConfig:
+		required = c.policy.SetSyncConfig
+	case OperationGetDiagnostics:
+		required = c.policy.GetDiagnostics
+	case OperationDeliveryStats:
+		required = c.policy.DeliveryStats
+	case OperationMacros:
+		required = c.policy.Macros
+	case OperationListFiles:
+		required = c.policy.ListFiles
+	case OperationTerminalRun:
+		required = c.policy.TerminalRun
+	case OperationEditInput:
+		required = c.policy.EditInput
+	case OperationCancelRun:
+		required = c.policy.CancelRun
+	case OperationCompactSession:
+		required = c.policy.CompactSession
+	case OperationCreateSession:
+		required = c.policy.CreateSession
+	case OperationSwitchProfile:
+		required = c.policy.SwitchProfile
+	case OperationAdmin:
+		required = c.policy.Admin
 	default:
 		return fmt.Errorf("unknown operation: %s", op)
 	}
@@ -85,6 +165,15 @@ func (c *Checker) CheckPermission(op Operation, requester *interfaces.IpcRequest
 	return c.checkLevel(required, requester)
 }
 
+// CheckLevel verifies if requester meets the permission level, independent of any operation.
+// It is used to admit connections before any message is processed.
+func (c *Checker) CheckLevel(level PermissionLevel, requester *interfaces.IpcRequester) error {
+	if requester == nil {
+		return fmt.Errorf("permission denied: requester identity unknown")
+	}
+	return c.checkLevel(level, requester)
+}
+
 // checkLevel verifies if requester meets the permission level
 func (c *Checker) checkLevel(level PermissionLevel, requester *interfaces.IpcRequester) error {
 	switch level {
@@ -0,0 +1,248 @@
+package persistence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// BackupVerifyInterval is how often the backup health check re-verifies the chain
+const BackupVerifyInterval = 10 * time.Minute
+
+// BackupManager inspects and manages the backup chain a FileManager writes on each save.
+// Implements the interfaces.BackupManager interface.
+type BackupManager struct {
+	fm    *FileManager
+	mutex sync.Mutex
+	stats interfaces.BackupStatistics
+}
+
+// NewBackupManager creates a backup manager for fm's backups
+func NewBackupManager(fm *FileManager) *BackupManager {
+	return &BackupManager{fm: fm}
+}
+
+// CreateBackup rotates the chain and copies the current state file into it
+func (bm *BackupManager) CreateBackup() (*interfaces.BackupInfo, error) {
+	if err := bm.fm.acquireFileLock(); err != nil {
+		return nil, fmt.Errorf("failed to acquire file lock: %w", err)
+	}
+	err := bm.fm.backupExistingFile()
+	bm.fm.releaseFileLock()
+
+	bm.mutex.Lock()
+	bm.stats.TotalBackups++
+	if err != nil {
+		bm.stats.FailedBackups++
+	} else {
+		bm.stats.SuccessfulBackups++
+		bm.stats.LastBackupTime = time.Now()
+	}
+	bm.mutex.Unlock()
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	info := bm.inspect(bm.fm.backupPath).BackupInfo
+	bm.mutex.Lock()
+	bm.stats.TotalBackupSize += info.Size
+	bm.stats.AverageBackupSize = bm.stats.TotalBackupSize / bm.stats.SuccessfulBackups
+	bm.mutex.Unlock()
+	return &info, nil
+}
+
+// LoadBackup loads and verifies state from a backup in the chain
+func (bm *BackupManager) LoadBackup(backupPath string) (*types.SharedApplicationState, error) {
+	if !bm.inChain(backupPath) {
+		return nil, fmt.Errorf("%s is not a backup of %s", backupPath, bm.fm.statePath)
+	}
+	_, state, err := bm.fm.loadBackupFile(backupPath)
+	if err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// ListBackups returns every backup on disk, newest first
+func (bm *BackupManager) ListBackups() ([]interfaces.BackupInfo, error) {
+	report := bm.VerifyAll()
+	infos := make([]interfaces.BackupInfo, 0, len(report.Backups))
+	for _, backup := range report.Backups {
+		infos = append(infos, backup.BackupInfo)
+	}
+	return infos, nil
+}
+
+// DeleteBackup removes one backup from the chain
+func (bm *BackupManager) DeleteBackup(backupPath string) error {
+	if !bm.inChain(backupPath) {
+		return fmt.Errorf("%s is not a backup of %s", backupPath, bm.fm.statePath)
+	}
+	return os.Remove(backupPath)
+}
+
+// GetLatestBackup returns the newest restorable backup
+func (bm *BackupManager) GetLatestBackup() (*interfaces.BackupInfo, error) {
+	report := bm.VerifyAll()
+	if report.NewestRestorable == nil {
+		return nil, &BackupNotFoundError{Paths: bm.fm.backupChain()}
+	}
+	info := report.NewestRestorable.BackupInfo
+	return &info, nil
+}
+
+// GetStatistics returns backup operation statistics
+func (bm *BackupManager) GetStatistics() interfaces.BackupStatistics {
+	bm.mutex.Lock()
+	defer bm.mutex.Unlock()
+	return bm.stats
+}
+
+// VerifyAll loads every backup in the chain, checking checksums and state invariants
+func (bm *BackupManager) VerifyAll() interfaces.BackupReport {
+	report := interfaces.BackupReport{CheckedAt: time.Now()}
+	for _, path := range bm.fm.backupChain() {
+		result := bm.inspect(path)
+		report.Backups = append(report.Backups, result)
+	}
+	for i := range report.Backups {
+		if report.Backups[i].Status == interfaces.BackupValid {
+			newest := report.Backups[i]
+			report.NewestRestorable = &newest
+			break
+		}
+	}
+	return report
+}
+
+// HealthCheck returns a periodic check that fails when any backup is unusable
+func (bm *BackupManager) HealthCheck() interfaces.HealthCheck {
+	return interfaces.HealthCheck{
+		Name:        "backups",
+		Description: "State backups verify and at least one is restorable",
+		Interval:    BackupVerifyInterval,
+		Enabled:     true,
+		CheckFunc: func() interfaces.HealthCheckResult {
+			start := time.Now()
+			report := bm.VerifyAll()
+			result := interfaces.HealthCheckResult{
+				Healthy:   report.Healthy(),
+				Timestamp: start,
+				Metadata:  map[string]interface{}{"backups": len(report.Backups)},
+			}
+			switch {
+			case len(report.Backups) == 0:
+				// A fresh session has nothing to back up yet
+				result.Healthy = true
+				result.Message = "no backups yet"
+			case report.NewestRestorable == nil:
+				result.Message = "no restorable backup"
+			case !result.Healthy:
+				result.Message = fmt.Sprintf("%d of %d backups failed verification",
+					countUnusable(report), len(report.Backups))
+			default:
+				result.Message = fmt.Sprintf("newest restorable backup is version %d", report.NewestRestorable.StateVersion)
+			}
+			result.Duration = time.Since(start)
+			return result
+		},
+	}
+}
+
+// Start is a no-op; backups are written by the file manager on each save
+func (bm *BackupManager) Start() error {
+	return nil
+}
+
+// Stop is a no-op; see Start
+func (bm *BackupManager) Stop() error {
+	return nil
+}
+
+// inspect verifies one backup file
+func (bm *BackupManager) inspect(path string) interfaces.BackupVerification {
+	result := interfaces.BackupVerification{BackupInfo: interfaces.BackupInfo{Path: path}}
+
+	if info, err := os.Stat(path); err == nil {
+		result.Size = info.Size()
+		result.Timestamp = info.ModTime()
+	}
+
+	metadata, state, err := bm.fm.loadBackupFile(path)
+	result.Checksum = metadata.Checksum
+	if !metadata.Timestamp.IsZero() {
+		result.Timestamp = metadata.Timestamp
+	}
+	if state != nil {
+		result.StateVersion = state.Version.Version
+	}
+
+	switch err.(type) {
+	case nil:
+		result.Status = interfaces.BackupValid
+		result.IsValid = true
+	case *ValidationError:
+		result.Status = interfaces.BackupInvalid
+		result.Error = err.Error()
+	default:
+		result.Status = interfaces.BackupCorrupt
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// inChain reports whether path is one of this manager's backups
+func (bm *BackupManager) inChain(path string) bool {
+	clean := filepath.Clean(path)
+	for _, backup := range bm.fm.backupChain() {
+		if backup == clean {
+			return true
+		}
+	}
+	return false
+}
+
+func countUnusable(report interfaces.BackupReport) int {
+	count := 0
+	for _, backup := range report.Backups {
+		if backup.Status != interfaces.BackupValid {
+			count++
+		}
+	}
+	return count
+}
+
+// backupChain returns the backups on disk, newest first: the current backup,
+// then numbered generations in order
+func (fm *FileManager) backupChain() []string {
+	var chain []string
+	if _, err := os.Stat(fm.backupPath); err == nil {
+		chain = append(chain, fm.backupPath)
+	}
+
+	type generation struct {
+		n    int
+		path string
+	}
+	var numbered []generation
+	for _, entry := range fm.globInfo(fm.backupPath + ".*") {
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.path, fm.backupPath+"."))
+		if err == nil && n > 0 {
+			numbered = append(numbered, generation{n: n, path: entry.path})
+		}
+	}
+	sort.Slice(numbered, func(i, j int) bool { return numbered[i].n < numbered[j].n })
+	for _, g := range numbered {
+		chain = append(chain, g.path)
+	}
+	return chain
+}
@@ -0,0 +1,67 @@
+package persistence
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestBackupManagerVerifyAll(t *testing.T) {
+	fm := NewFileManager(DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json")))
+	if err := fm.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	// Four saves leave the current backup plus .1 and .2
+	state := types.NewSharedApplicationState()
+	for version := int64(1); version <= 4; version++ {
+		state.Version.Version = version
+		if err := fm.SaveStateAtomic(state); err != nil {
+			t.Fatalf("SaveStateAtomic() error = %v", err)
+		}
+	}
+
+	// Tamper with the newest backup without breaking its JSON
+	data, err := os.ReadFile(fm.backupPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Replace(data, []byte(`"version": 3`), []byte(`"version": 9`), 1)
+	if bytes.Equal(data, tampered) {
+		t.Fatal("test setup: version field not found in backup")
+	}
+	if err := os.WriteFile(fm.backupPath, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report := NewBackupManager(fm).VerifyAll()
+
+	wantStatus := []interfaces.BackupStatus{interfaces.BackupCorrupt, interfaces.BackupValid, interfaces.BackupValid}
+	if len(report.Backups) != len(wantStatus) {
+		t.Fatalf("VerifyAll() returned %d backups, want %d", len(report.Backups), len(wantStatus))
+	}
+	for i, want := range wantStatus {
+		if got := report.Backups[i].Status; got != want {
+			t.Errorf("backup %s status = %s, want %s (%s)", report.Backups[i].Path, got, want, report.Backups[i].Error)
+		}
+	}
+	if report.NewestRestorable == nil || report.NewestRestorable.StateVersion != 2 {
+		t.Errorf("NewestRestorable = %+v, want version 2", report.NewestRestorable)
+	}
+	if report.Healthy() {
+		t.Error("report with a corrupt backup should not be healthy")
+	}
+
+	// A corrupt state file falls back to the newest valid backup
+	if err := os.WriteFile(fm.statePath, tampered, 0600); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := fm.LoadStateAtomic()
+	if err != nil || loaded.Version.Version != 2 {
+		t.Errorf("LoadStateAtomic() = %v, %v; want fallback to version 2", loaded, err)
+	}
+}
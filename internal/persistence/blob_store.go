@@ -0,0 +1,163 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultBlobThreshold is the body size above which message content is stored as a blob
+const DefaultBlobThreshold = 16 << 10
+
+// DefaultMessagePreview is how much of a body stored as a blob stays inline as a preview
+const DefaultMessagePreview = 2 << 10
+
+// BlobStore keeps large message bodies and tool outputs in files named by the
+// SHA-256 of their content, so identical bodies are stored once and the state
+// file only carries the hash.
+type BlobStore struct {
+	dir      string
+	tempDir  string
+	fileMode os.FileMode
+	dirMode  os.FileMode
+}
+
+// NewBlobStore creates a store rooted at dir. Blobs are sharded by the first two hex
+// characters of their hash to keep directories small.
+func NewBlobStore(dir string, fileMode, dirMode os.FileMode) *BlobStore {
+	if fileMode == 0 {
+		fileMode = DefaultFileMode
+	}
+	if dirMode == 0 {
+		dirMode = DefaultDirMode
+	}
+	return &BlobStore{
+		dir:      dir,
+		tempDir:  filepath.Join(dir, "tmp"),
+		fileMode: fileMode,
+		dirMode:  dirMode,
+	}
+}
+
+// DefaultBlobDir returns the blob directory for a state file; each state gets its own
+// so garbage collection only has to consider one state's references
+func DefaultBlobDir(statePath string) string {
+	return strings.TrimSuffix(statePath, filepath.Ext(statePath)) + ".blobs"
+}
+
+// Dir returns the store's root directory
+func (bs *BlobStore) Dir() string {
+	return bs.dir
+}
+
+// HashBlob returns the content address of data
+func HashBlob(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Put stores data and returns its hash. Storing content that already exists is a no-op.
+func (bs *BlobStore) Put(data []byte) (string, error) {
+	hash := HashBlob(data)
+	path := bs.path(hash)
+
+	if _, err := os.Stat(path); err == nil {
+		// Touch it so garbage collection treats the blob as freshly referenced
+		now := time.Now()
+		os.Chtimes(path, now, now)
+		return hash, nil
+	}
+
+	for _, dir := range []string{filepath.Dir(path), bs.tempDir} {
+		if err := os.MkdirAll(dir, bs.dirMode); err != nil {
+			return "", fmt.Errorf("failed to create blob directory %s: %w", dir, err)
+		}
+	}
+
+	// Write to a temp file and rename so readers never see a partial blob
+	temp, err := os.CreateTemp(bs.tempDir, "blob_*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temp blob: %w", err)
+	}
+	tempPath := temp.Name()
+	defer os.Remove(tempPath)
+
+	if err := temp.Chmod(bs.fileMode); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("failed to set blob mode: %w", err)
+	}
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("failed to write blob: %w", err)
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return "", fmt.Errorf("failed to sync blob: %w", err)
+	}
+	if err := temp.Close(); err != nil {
+		return "", fmt.Errorf("failed to close blob: %w", err)
+	}
+	if err := os.Rename(tempPath, path); err != nil {
+		return "", fmt.Errorf("failed to store blob: %w", err)
+	}
+
+	return hash, nil
+}
+
+// Get returns the content stored under hash, verifying it has not been altered
+func (bs *BlobStore) Get(hash string) ([]byte, error) {
+	if !validBlobHash(hash) {
+		return nil, &ValidationError{Field: "hash", Message: fmt.Sprintf("invalid blob hash %q", hash)}
+	}
+
+	path := bs.path(hash)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, &BlobNotFoundError{Hash: hash}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", hash, err)
+	}
+	if HashBlob(data) != hash {
+		return nil, &CorruptionError{Path: path, Reason: "content does not match hash"}
+	}
+	return data, nil
+}
+
+// Has reports whether a blob is stored
+func (bs *BlobStore) Has(hash string) bool {
+	if !validBlobHash(hash) {
+		return false
+	}
+	_, err := os.Stat(bs.path(hash))
+	return err == nil
+}
+
+// Delete removes a blob. Callers must make sure nothing references it any more.
+func (bs *BlobStore) Delete(hash string) error {
+	if !validBlobHash(hash) {
+		return &ValidationError{Field: "hash", Message: fmt.Sprintf("invalid blob hash %q", hash)}
+	}
+	if err := os.Remove(bs.path(hash)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete blob %s: %w", hash, err)
+	}
+	return nil
+}
+
+func (bs *BlobStore) path(hash string) string {
+	return filepath.Join(bs.dir, hash[:2], hash)
+}
+
+// validBlobHash rejects anything that is not a hex SHA-256, so hashes from panels
+// cannot escape the blob directory
+func validBlobHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	_, err := hex.DecodeString(hash)
+	return err == nil
+}
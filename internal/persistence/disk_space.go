@@ -0,0 +1,91 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// MinFreeBytes stays free after a save so the logs and other writers on the
+	// same filesystem keep working
+	MinFreeBytes = 4 * 1024 * 1024
+	// minFreeInodes covers the temp file, backup copy and lock file of one save
+	minFreeInodes = 8
+	// saveGrowthAllowance is headroom for the state growing since the last save
+	saveGrowthAllowance = 1.25
+)
+
+// DiskFullError reports that a save would not fit, or did not fit, on the
+// filesystem holding the state file
+type DiskFullError struct {
+	Path       string `json:"path"`
+	Needed     uint64 `json:"needed"`      // Bytes the save needs, reserve included
+	Available  uint64 `json:"available"`   // Bytes available to this user
+	FreeInodes uint64 `json:"free_inodes"` // 0 on filesystems without an inode limit
+	Reason     string `json:"reason"`
+}
+
+func (e *DiskFullError) Error() string {
+	return fmt.Sprintf("not enough space to save %s: %s (need %d bytes, %d available)",
+		e.Path, e.Reason, e.Needed, e.Available)
+}
+
+// CheckDiskSpace verifies that the state directory has room for one more save:
+// a temp file and a backup copy, each estimated from the current state file,
+// plus MinFreeBytes and a few inodes. It returns a *DiskFullError when not.
+func (fm *FileManager) CheckDiskSpace() error {
+	var current int64
+	if info, err := os.Stat(fm.statePath); err == nil {
+		current = info.Size()
+	}
+	return checkFreeSpace(filepath.Dir(fm.statePath), fm.statePath, estimateSaveBytes(current))
+}
+
+// estimateSaveBytes is what a save of a state currently size bytes writes: the
+// new state and a backup copy of the old one
+func estimateSaveBytes(size int64) uint64 {
+	return uint64(float64(size)*saveGrowthAllowance) + uint64(size) + MinFreeBytes
+}
+
+// checkFreeSpace compares the free space and inodes of dir's filesystem with needed
+func checkFreeSpace(dir, statePath string, needed uint64) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		// An unknown free space is no reason to refuse a save
+		return nil
+	}
+
+	available := fs.Bavail * uint64(fs.Bsize)
+	diskErr := &DiskFullError{Path: statePath, Needed: needed, Available: available, FreeInodes: fs.Ffree}
+	switch {
+	case available < needed:
+		diskErr.Reason = "disk full"
+	case fs.Files > 0 && fs.Ffree < minFreeInodes:
+		// Filesystems without a fixed inode table report zero total inodes
+		diskErr.Reason = fmt.Sprintf("out of inodes (%d free)", fs.Ffree)
+	default:
+		return nil
+	}
+	return diskErr
+}
+
+// diskFullFromWrite turns a write that ran out of space or quota into a
+// *DiskFullError, so callers can tell it from other I/O failures
+func (fm *FileManager) diskFullFromWrite(err error) error {
+	if !errors.Is(err, syscall.ENOSPC) && !errors.Is(err, syscall.EDQUOT) {
+		return err
+	}
+	diskErr := &DiskFullError{Path: fm.statePath, Reason: "disk full during write"}
+	if errors.Is(err, syscall.EDQUOT) {
+		diskErr.Reason = "disk quota exceeded during write"
+	}
+	var fs syscall.Statfs_t
+	if syscall.Statfs(filepath.Dir(fm.statePath), &fs) == nil {
+		diskErr.Available = fs.Bavail * uint64(fs.Bsize)
+		diskErr.FreeInodes = fs.Ffree
+	}
+	return diskErr
+}
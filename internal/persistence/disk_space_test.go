@@ -0,0 +1,54 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"syscall"
+	"testing"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name     string
+		needed   uint64
+		wantFull bool
+	}{
+		{name: "fits", needed: 1},
+		{name: "larger than any disk", needed: math.MaxUint64, wantFull: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkFreeSpace(dir, "state.json", tt.needed)
+			var diskErr *DiskFullError
+			if errors.As(err, &diskErr) != tt.wantFull {
+				t.Fatalf("checkFreeSpace() = %v, want full %v", err, tt.wantFull)
+			}
+			if tt.wantFull && (diskErr.Needed != tt.needed || diskErr.Reason == "") {
+				t.Errorf("DiskFullError = %+v", diskErr)
+			}
+		})
+	}
+}
+
+func TestDiskFullFromWrite(t *testing.T) {
+	fm := NewFileManager(DefaultFileManagerConfig(t.TempDir() + "/state.json"))
+	tests := []struct {
+		name     string
+		err      error
+		wantFull bool
+	}{
+		{name: "no space", err: fmt.Errorf("write: %w", syscall.ENOSPC), wantFull: true},
+		{name: "quota", err: syscall.EDQUOT, wantFull: true},
+		{name: "other", err: syscall.EIO},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var diskErr *DiskFullError
+			if got := fm.diskFullFromWrite(tt.err); errors.As(got, &diskErr) != tt.wantFull {
+				t.Errorf("diskFullFromWrite(%v) = %v, want full %v", tt.err, got, tt.wantFull)
+			}
+		})
+	}
+}
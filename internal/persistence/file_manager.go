@@ -1,15 +1,21 @@
 package persistence
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/opencode/tmux_coder/internal/clock"
 	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/timefmt"
 	"github.com/opencode/tmux_coder/internal/types"
 )
 
@@ -25,6 +31,16 @@ type FileManager struct {
 	lockMutex          sync.Mutex
 	compressionEnabled bool
 	backupRotation     int
+	fileMode           os.FileMode
+	dirMode            os.FileMode
+	gcMutex            sync.Mutex
+	lastGC             interfaces.GCStats
+	lastRecovery       interfaces.RecoveryReport
+	clock              clock.Clock
+	sectionsDir        string
+	differential       bool
+	sectionMutex       sync.Mutex
+	savedSections      map[string]SectionRef // Sections of the state last saved or loaded
 }
 
 // FileManagerConfig contains configuration for file manager
@@ -34,6 +50,9 @@ type FileManagerConfig struct {
 	CompressionEnabled bool          `json:"compression_enabled"`
 	BackupRotation     int           `json:"backup_rotation"`
 	TempDir            string        `json:"temp_dir"`
+	FileMode           os.FileMode   `json:"file_mode"`         // Mode for state, lock and backup files
+	DirMode            os.FileMode   `json:"dir_mode"`          // Mode for directories created by the manager
+	DifferentialSave   bool          `json:"differential_save"` // Write only the sections of state changed since the last save
 }
 
 // DefaultFileManagerConfig returns default configuration
@@ -45,11 +64,20 @@ func DefaultFileManagerConfig(statePath string) FileManagerConfig {
 		CompressionEnabled: false,
 		BackupRotation:     5,
 		TempDir:            filepath.Join(dir, "tmp"),
+		FileMode:           DefaultFileMode,
+		DirMode:            DefaultDirMode,
 	}
 }
 
 // NewFileManager creates a new file manager with specified configuration
 func NewFileManager(config FileManagerConfig) *FileManager {
+	if config.FileMode == 0 {
+		config.FileMode = DefaultFileMode
+	}
+	if config.DirMode == 0 {
+		config.DirMode = DefaultDirMode
+	}
+
 	return &FileManager{
 		statePath:          config.StatePath,
 		lockPath:           config.StatePath + ".lock",
@@ -58,10 +86,23 @@ func NewFileManager(config FileManagerConfig) *FileManager {
 		lockTimeout:        config.LockTimeout,
 		compressionEnabled: config.CompressionEnabled,
 		backupRotation:     config.BackupRotation,
+		fileMode:           config.FileMode,
+		dirMode:            config.DirMode,
+		clock:              clock.Real,
+		sectionsDir:        config.StatePath + ".sections",
+		differential:       config.DifferentialSave,
 	}
 }
 
-// Initialize sets up the file manager and creates necessary directories
+// SetClock replaces the clock that decides when a lock file is stale and
+// stamps saved state; nil restores the system clock. Waiting for a lock
+// still takes real time. Call it before the manager is shared.
+func (fm *FileManager) SetClock(c clock.Clock) {
+	fm.clock = clock.Or(c)
+}
+
+// Initialize sets up the file manager, creates necessary directories and
+// recovers from a save interrupted by a crash
 func (fm *FileManager) Initialize() error {
 	// Create directories if they don't exist
 	dirs := []string{
@@ -71,11 +112,16 @@ func (fm *FileManager) Initialize() error {
 	}
 
 	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		if err := fm.ensureDir(dir); err != nil {
 			return fmt.Errorf("failed to create directory %s: %w", dir, err)
 		}
 	}
 
+	report := fm.recoverInterruptedWrites()
+	fm.gcMutex.Lock()
+	fm.lastRecovery = report
+	fm.gcMutex.Unlock()
+
 	return nil
 }
 
@@ -87,6 +133,16 @@ func (fm *FileManager) SaveStateAtomic(state *types.SharedApplicationState) erro
 	}
 	defer fm.releaseFileLock()
 
+	return fm.saveLocked(state)
+}
+
+// saveLocked writes state over the state file; the caller holds the file lock
+func (fm *FileManager) saveLocked(state *types.SharedApplicationState) error {
+	// Fail with a clear error before anything is half-written
+	if err := fm.CheckDiskSpace(); err != nil {
+		return err
+	}
+
 	// Create temporary file
 	tempFile, err := fm.createTempFile()
 	if err != nil {
@@ -99,14 +155,25 @@ func (fm *FileManager) SaveStateAtomic(state *types.SharedApplicationState) erro
 		os.Remove(tempPath) // Clean up on any error
 	}()
 
-	// Serialize and write state
-	if err := fm.writeStateToFile(state, tempFile); err != nil {
-		return fmt.Errorf("failed to write state: %w", err)
+	// The mode survives the rename, so set it before the file becomes visible
+	if err := fm.applyFileMode(tempPath); err != nil {
+		return fmt.Errorf("failed to set state file mode: %w", err)
+	}
+
+	// Serialize and write state, with the changed sections first for a differential save
+	var sections map[string]SectionRef
+	if fm.differential {
+		sections, err = fm.writeSectionedStateToFile(state, tempFile)
+	} else {
+		err = fm.writeStateToFile(state, tempFile)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write state: %w", fm.diskFullFromWrite(err))
 	}
 
 	// Sync to disk
 	if err := tempFile.Sync(); err != nil {
-		return fmt.Errorf("failed to sync temp file: %w", err)
+		return fmt.Errorf("failed to sync temp file: %w", fm.diskFullFromWrite(err))
 	}
 
 	// Close temp file before rename
@@ -116,17 +183,29 @@ func (fm *FileManager) SaveStateAtomic(state *types.SharedApplicationState) erro
 
 	// Backup existing file if it exists
 	if err := fm.backupExistingFile(); err != nil {
-		return fmt.Errorf("failed to backup existing file: %w", err)
+		return fmt.Errorf("failed to backup existing file: %w", fm.diskFullFromWrite(err))
 	}
 
 	// Atomic rename
 	if err := os.Rename(tempPath, fm.statePath); err != nil {
 		return fmt.Errorf("failed to rename temp file: %w", err)
 	}
+	fm.setSavedSections(sections)
+
+	// Sections only the rotated-out backup listed are no longer needed
+	if err := fm.pruneSections(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 
 	return nil
 }
 
+func (fm *FileManager) setSavedSections(sections map[string]SectionRef) {
+	fm.sectionMutex.Lock()
+	fm.savedSections = sections
+	fm.sectionMutex.Unlock()
+}
+
 // LoadStateAtomic loads state from file with integrity checks
 func (fm *FileManager) LoadStateAtomic() (*types.SharedApplicationState, error) {
 	// Acquire file lock
@@ -140,33 +219,66 @@ func (fm *FileManager) LoadStateAtomic() (*types.SharedApplicationState, error)
 		return nil, &FileNotFoundError{Path: fm.statePath}
 	}
 
-	// Open and read state file
-	file, err := os.Open(fm.statePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to open state file: %w", err)
+	// Refuse state written by another user
+	if err := fm.checkOwnership(fm.statePath); err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	// Verify file integrity
-	if err := fm.verifyFileIntegrity(file); err != nil {
-		// Try to load from backup
-		return fm.loadFromBackup()
+	// Read state file
+	data, err := os.ReadFile(fm.statePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
 	}
 
-	// Decode state
-	var state types.SharedApplicationState
-	decoder := json.NewDecoder(file)
-	if err := decoder.Decode(&state); err != nil {
-		// Try to load from backup on decode error
+	// Verify integrity and decode, falling back to backups on corruption
+	metadata, state, err := decodeStateFile(fm.statePath, data, fm.sectionsDir)
+	if err != nil {
+		log.Printf("State file %s is corrupt (%v), trying backups", fm.statePath, err)
 		return fm.loadFromBackup()
 	}
 
 	// Validate state structure
-	if err := fm.validateState(&state); err != nil {
+	if err := fm.validateState(state); err != nil {
 		return nil, fmt.Errorf("state validation failed: %w", err)
 	}
 
-	return &state, nil
+	// The next differential save writes only what changed since this load
+	fm.setSavedSections(metadata.Sections)
+
+	// Rewrite a file saved with local times; the old one is kept as a backup
+	if metadata.Version == legacyLocalTimeFormat {
+		if err := fm.saveLocked(state); err != nil {
+			log.Printf("Failed to migrate state file %s to UTC timestamps: %v", fm.statePath, err)
+		} else {
+			log.Printf("Migrated state file %s to UTC timestamps", fm.statePath)
+		}
+	}
+
+	return state, nil
+}
+
+// LoadStateFile loads the state file alone: unlike LoadStateAtomic it never
+// falls back to backups or rewrites the file, so corruption is reported
+func (fm *FileManager) LoadStateFile() (*types.SharedApplicationState, error) {
+	if err := fm.acquireFileLock(); err != nil {
+		return nil, fmt.Errorf("failed to acquire file lock: %w", err)
+	}
+	defer fm.releaseFileLock()
+
+	data, err := os.ReadFile(fm.statePath)
+	if os.IsNotExist(err) {
+		return nil, &FileNotFoundError{Path: fm.statePath}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+	_, state, err := decodeStateFile(fm.statePath, data, fm.sectionsDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.validateState(state); err != nil {
+		return nil, fmt.Errorf("state validation failed: %w", err)
+	}
+	return state, nil
 }
 
 // acquireFileLock acquires an exclusive file lock
@@ -189,7 +301,7 @@ func (fm *FileManager) acquireFileLock() error {
 	start := time.Now()
 	for {
 		// Create lock file
-		lockFile, err := os.OpenFile(fm.lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		lockFile, err := os.OpenFile(fm.lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, fm.fileMode)
 		if err != nil {
 			if os.IsExist(err) {
 				if err := fm.handleStaleLock(); err != nil {
@@ -253,6 +365,13 @@ func (fm *FileManager) releaseFileLock() error {
 	return nil
 }
 
+// Close releases the state file lock if it is still held, closing its
+// descriptor and removing the lock file. Saves and loads lock afresh, so
+// the manager can still be used after Close.
+func (fm *FileManager) Close() error {
+	return fm.releaseFileLock()
+}
+
 // handleStaleLock checks if a lock file is stale and removes it if so
 func (fm *FileManager) handleStaleLock() error {
 	// Check lock file age
@@ -265,7 +384,7 @@ func (fm *FileManager) handleStaleLock() error {
 	}
 
 	// If lock file is older than timeout, consider it stale
-	if time.Since(stat.ModTime()) > fm.lockTimeout {
+	if fm.clock.Since(stat.ModTime()) > fm.lockTimeout {
 		if err := os.Remove(fm.lockPath); err != nil {
 			return fmt.Errorf("failed to remove stale lock: %w", err)
 		}
@@ -287,7 +406,7 @@ func (fm *FileManager) flockFile(file *os.File) error {
 // createTempFile creates a temporary file for atomic writes
 func (fm *FileManager) createTempFile() (*os.File, error) {
 	// Ensure temp directory exists
-	if err := os.MkdirAll(fm.tempDir, 0755); err != nil {
+	if err := fm.ensureDir(fm.tempDir); err != nil {
 		return nil, err
 	}
 
@@ -296,56 +415,109 @@ func (fm *FileManager) createTempFile() (*os.File, error) {
 	return os.CreateTemp(fm.tempDir, pattern)
 }
 
-// writeStateToFile writes state data to a file
+// writeStateToFile writes state data to a file. Times are written in UTC
+// so the file reads the same on a machine in another zone.
 func (fm *FileManager) writeStateToFile(state *types.SharedApplicationState, file *os.File) error {
-	encoder := json.NewEncoder(file)
-	encoder.SetIndent("", "  ") // Pretty print for debugging
+	data, err := fm.encodeStateFile(state)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		return fmt.Errorf("failed to write state: %w", err)
+	}
+	return nil
+}
+
+// encodeStateFile encodes the whole of state as a state file
+func (fm *FileManager) encodeStateFile(state *types.SharedApplicationState) ([]byte, error) {
+	// Serialize the state first so the metadata header can carry its checksum
+	body, err := encodeStateBody(state)
+	if err != nil {
+		return nil, err
+	}
 
 	// Add metadata header
 	metadata := StateMetadata{
-		Version:   "1.0",
-		Timestamp: time.Now(),
-		Checksum:  "", // Will be calculated after serialization
+		Version:   stateFormatVersion,
+		Timestamp: fm.clock.Now().UTC(),
+		Checksum:  stateChecksum(body),
 	}
 
-	// Write metadata first
+	// Metadata first, then the state data
+	var file bytes.Buffer
+	encoder := json.NewEncoder(&file)
+	encoder.SetIndent("", "  ")
 	if err := encoder.Encode(metadata); err != nil {
-		return fmt.Errorf("failed to encode metadata: %w", err)
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
 	}
+	file.Write(body)
 
-	// Write state data
-	if err := encoder.Encode(state); err != nil {
-		return fmt.Errorf("failed to encode state: %w", err)
-	}
+	return file.Bytes(), nil
+}
 
-	return nil
+// encodeStateBody encodes state as the body of a state file
+func encodeStateBody(state *types.SharedApplicationState) ([]byte, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	encoder.SetIndent("", "  ") // Pretty print for debugging
+	if err := encoder.Encode(timefmt.UTC(state)); err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	return body.Bytes(), nil
 }
 
-// verifyFileIntegrity checks file integrity and structure
-func (fm *FileManager) verifyFileIntegrity(file *os.File) error {
-	// Seek to beginning
-	if _, err := file.Seek(0, 0); err != nil {
-		return err
+// StateChecksum returns the checksum a state file written whole records for
+// state, so states from different sources can be compared by content
+func StateChecksum(state *types.SharedApplicationState) (string, error) {
+	body, err := encodeStateBody(state)
+	if err != nil {
+		return "", err
 	}
+	return stateChecksum(body), nil
+}
+
+// stateChecksum returns the checksum recorded in the metadata header for a state body.
+// Surrounding whitespace is ignored so the header's trailing newline does not matter.
+func stateChecksum(body []byte) string {
+	sum := sha256.Sum256(bytes.TrimSpace(body))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// decodeStateFile parses a state or backup file and verifies its checksum.
+// Files written before checksums were recorded have an empty Checksum and are accepted;
+// times in files written before they were kept in UTC are converted to UTC.
+// The sections of a differentially saved file are read from sectionsDir.
+func decodeStateFile(path string, data []byte, sectionsDir string) (StateMetadata, *types.SharedApplicationState, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
 
-	// Read and verify metadata
-	decoder := json.NewDecoder(file)
 	var metadata StateMetadata
 	if err := decoder.Decode(&metadata); err != nil {
-		return &CorruptionError{Path: fm.statePath, Reason: "invalid metadata"}
+		return metadata, nil, &CorruptionError{Path: path, Reason: "invalid metadata"}
 	}
-
-	// Basic metadata validation
 	if metadata.Version == "" {
-		return &CorruptionError{Path: fm.statePath, Reason: "missing version"}
+		return metadata, nil, &CorruptionError{Path: path, Reason: "missing version"}
 	}
 
-	// Reset file position for subsequent reads
-	if _, err := file.Seek(0, 0); err != nil {
-		return err
+	body := data[decoder.InputOffset():]
+	if metadata.Checksum != "" && stateChecksum(body) != metadata.Checksum {
+		return metadata, nil, &CorruptionError{Path: path, Reason: "checksum mismatch"}
+	}
+	if len(metadata.Sections) > 0 {
+		merged, err := mergeSections(path, metadata, body, sectionsDir)
+		if err != nil {
+			return metadata, nil, err
+		}
+		body = merged
 	}
 
-	return nil
+	var state types.SharedApplicationState
+	if err := json.Unmarshal(body, &state); err != nil {
+		return metadata, nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("invalid state: %v", err)}
+	}
+	if metadata.Version == legacyLocalTimeFormat {
+		return metadata, timefmt.UTC(&state), nil
+	}
+	return metadata, &state, nil
 }
 
 // validateState performs basic state validation
@@ -442,35 +614,37 @@ func (fm *FileManager) loadFromBackup() (*types.SharedApplicationState, error) {
 			continue
 		}
 
-		file, err := os.Open(backupPath)
+		_, state, err := fm.loadBackupFile(backupPath)
 		if err != nil {
 			continue
 		}
 
-		var state types.SharedApplicationState
-		decoder := json.NewDecoder(file)
-
-		// Skip metadata
-		var metadata StateMetadata
-		decoder.Decode(&metadata)
-
-		if err := decoder.Decode(&state); err != nil {
-			file.Close()
-			continue
-		}
+		// Successfully loaded from backup
+		return state, nil
+	}
 
-		file.Close()
+	return nil, &BackupNotFoundError{Paths: backupPaths}
+}
 
-		// Validate backup state
-		if err := fm.validateState(&state); err != nil {
-			continue
-		}
+// loadBackupFile reads, verifies and validates one backup file
+func (fm *FileManager) loadBackupFile(path string) (StateMetadata, *types.SharedApplicationState, error) {
+	if err := fm.checkOwnership(path); err != nil {
+		return StateMetadata{}, nil, err
+	}
 
-		// Successfully loaded from backup
-		return &state, nil
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return StateMetadata{}, nil, err
 	}
 
-	return nil, &BackupNotFoundError{Paths: backupPaths}
+	metadata, state, err := decodeStateFile(path, data, fm.sectionsDir)
+	if err != nil {
+		return metadata, nil, err
+	}
+	if err := fm.validateState(state); err != nil {
+		return metadata, state, err
+	}
+	return metadata, state, nil
 }
 
 // copyFile copies a file from src to dst
@@ -481,12 +655,17 @@ func (fm *FileManager) copyFile(src, dst string) error {
 	}
 	defer srcFile.Close()
 
-	dstFile, err := os.Create(dst)
+	dstFile, err := os.OpenFile(dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, fm.fileMode)
 	if err != nil {
 		return err
 	}
 	defer dstFile.Close()
 
+	// OpenFile does not change the mode of an existing file, and is subject to umask
+	if err := dstFile.Chmod(fm.fileMode); err != nil {
+		return err
+	}
+
 	// Copy file contents
 	if _, err := dstFile.ReadFrom(srcFile); err != nil {
 		return err
@@ -504,20 +683,40 @@ func (fm *FileManager) GetStats() interfaces.RepositoryStats {
 		BackupPath: fm.backupPath,
 	}
 
+	for _, issue := range fm.CheckPermissions() {
+		stats.PermissionIssues = append(stats.PermissionIssues, issue.String())
+	}
+
+	fm.gcMutex.Lock()
+	stats.LastGC = fm.lastGC
+	stats.LastRecovery = fm.lastRecovery
+	fm.gcMutex.Unlock()
+
 	// Get file info if exists
 	if stat, err := os.Stat(fm.statePath); err == nil {
-		stats.FileSize = stat.Size()
+		stats.FileSize = stat.Size() + fm.sectionsSize()
 		stats.ModTime = stat.ModTime()
 	}
 
 	return stats
 }
 
+// State file format versions. Files of version 1.0 hold times in the zone of
+// the machine that wrote them; from 1.1 on they are UTC. Version 1.2 files
+// are differential saves, holding part of the state and listing the rest.
+const (
+	legacyLocalTimeFormat = "1.0"
+	stateFormatVersion    = "1.1"
+	sectionedStateFormat  = "1.2"
+)
+
 // StateMetadata contains metadata about the state file
 type StateMetadata struct {
-	Version   string    `json:"version"`
-	Timestamp time.Time `json:"timestamp"`
-	Checksum  string    `json:"checksum"`
+	Version     string                `json:"version"`
+	Timestamp   time.Time             `json:"timestamp"`
+	Checksum    string                `json:"checksum"`
+	Sections    map[string]SectionRef `json:"sections,omitempty"`     // Section files of a differential save, by section
+	MessageRuns []MessageRun          `json:"message_runs,omitempty"` // Order of the messages kept in sections
 }
 
 // Error types
@@ -561,6 +760,17 @@ func (e *ValidationError) Error() string {
 	return fmt.Sprintf("validation error in %s: %s", e.Field, e.Message)
 }
 
+// OwnershipError indicates a persisted file belongs to a different user
+type OwnershipError struct {
+	Path        string `json:"path"`
+	OwnerUID    int    `json:"owner_uid"`
+	ExpectedUID int    `json:"expected_uid"`
+}
+
+func (e *OwnershipError) Error() string {
+	return fmt.Sprintf("refusing to load %s: owned by uid %d, expected uid %d", e.Path, e.OwnerUID, e.ExpectedUID)
+}
+
 // BackupNotFoundError indicates no valid backup was found
 type BackupNotFoundError struct {
 	Paths []string `json:"paths"`
@@ -569,3 +779,12 @@ type BackupNotFoundError struct {
 func (e *BackupNotFoundError) Error() string {
 	return fmt.Sprintf("no valid backup found in paths: %v", e.Paths)
 }
+
+// BlobNotFoundError indicates a referenced blob is missing from the blob store
+type BlobNotFoundError struct {
+	Hash string `json:"hash"`
+}
+
+func (e *BlobNotFoundError) Error() string {
+	return fmt.Sprintf("blob not found: %s", e.Hash)
+}
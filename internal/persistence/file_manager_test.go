@@ -0,0 +1,171 @@
+package persistence
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/testutil"
+)
+
+func TestHandleStaleLockFollowsClock(t *testing.T) {
+	tests := []struct {
+		name        string
+		age         time.Duration // How far the clock has moved past the lock's mtime
+		wantRemoved bool
+	}{
+		{name: "fresh lock", age: time.Second},
+		{name: "just inside timeout", age: 29 * time.Second},
+		{name: "past timeout", age: 31 * time.Second, wantRemoved: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fm := NewFileManager(DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json")))
+			if err := os.WriteFile(fm.lockPath, []byte(deadPID), 0600); err != nil {
+				t.Fatal(err)
+			}
+			stat, err := os.Stat(fm.lockPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fm.SetClock(clock.NewFake(stat.ModTime().Add(tt.age)))
+
+			err = fm.handleStaleLock()
+			_, statErr := os.Stat(fm.lockPath)
+			if tt.wantRemoved {
+				if err != nil || !os.IsNotExist(statErr) {
+					t.Errorf("handleStaleLock() = %v, lock exists = %v; want it removed", err, statErr == nil)
+				}
+				return
+			}
+			var timeout *LockTimeoutError
+			if !errors.As(err, &timeout) || statErr != nil {
+				t.Errorf("handleStaleLock() = %v, lock exists = %v; want a timeout and the lock kept", err, statErr == nil)
+			}
+		})
+	}
+}
+
+func TestFileManagerLockCyclesLeakNothing(t *testing.T) {
+	testutil.CheckLeaks(t)
+	fm := NewFileManager(DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json")))
+	if err := fm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := fm.SaveStateAtomic(testutil.NewState().Version(int64(i + 1)).Sessions(1).Build()); err != nil {
+			t.Fatalf("save %d: %v", i, err)
+		}
+		if _, err := fm.LoadStateAtomic(); err != nil {
+			t.Fatalf("load %d: %v", i, err)
+		}
+	}
+
+	// A lock still held is released by Close
+	if err := fm.acquireFileLock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if _, err := os.Stat(fm.lockPath); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind by Close: %v", err)
+	}
+	other := NewFileManager(DefaultFileManagerConfig(fm.statePath))
+	if _, err := other.LoadStateAtomic(); err != nil {
+		t.Errorf("load after Close: %v", err)
+	}
+}
+
+func TestSaveWritesUTC(t *testing.T) {
+	fm := NewFileManager(DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json")))
+	if err := fm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	zone := time.FixedZone("UTC+2", 2*60*60)
+	fm.SetClock(clock.NewFake(time.Date(2026, 6, 1, 14, 0, 0, 0, zone)))
+
+	state := testutil.NewState().Sessions(1).Build()
+	state.Version.Timestamp = state.Version.Timestamp.In(zone)
+	state.Sessions[0].CreatedAt = state.Sessions[0].CreatedAt.In(zone)
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(fm.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "+02:00") {
+		t.Errorf("state file holds local times:\n%s", data)
+	}
+	metadata, _, err := decodeStateFile(fm.statePath, data, fm.sectionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Version != stateFormatVersion || metadata.Timestamp.Location() != time.UTC {
+		t.Errorf("metadata = %+v, want version %s stamped in UTC", metadata, stateFormatVersion)
+	}
+	if state.Sessions[0].CreatedAt.Location() != zone {
+		t.Errorf("saving changed the caller's state")
+	}
+}
+
+func TestLoadMigratesLocalTimeFile(t *testing.T) {
+	fm := NewFileManager(DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json")))
+	if err := fm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A file as written before times were kept in UTC
+	zone := time.FixedZone("UTC-5", -5*60*60)
+	created := time.Date(2026, 3, 4, 9, 30, 0, 0, zone)
+	state := testutil.NewState().Sessions(1).Build()
+	state.Version.Timestamp = created
+	state.Sessions[0].CreatedAt = created
+	var body bytes.Buffer
+	if err := json.NewEncoder(&body).Encode(state); err != nil {
+		t.Fatal(err)
+	}
+	header, err := json.Marshal(StateMetadata{Version: legacyLocalTimeFormat, Timestamp: created})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fm.statePath, append(append(header, '\n'), body.Bytes()...), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := fm.LoadStateAtomic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := loaded.Sessions[0].CreatedAt
+	if got.Location() != time.UTC || !got.Equal(created) {
+		t.Errorf("CreatedAt = %v, want %v in UTC", got, created)
+	}
+
+	// The file is rewritten in the current format, the old one kept as a backup
+	data, err := os.ReadFile(fm.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata, _, err := decodeStateFile(fm.statePath, data, fm.sectionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Version != stateFormatVersion || strings.Contains(string(data), "-05:00") {
+		t.Errorf("state file not migrated: version %s\n%s", metadata.Version, data)
+	}
+	backup, _, err := fm.loadBackupFile(fm.backupPath)
+	if err != nil || backup.Version != legacyLocalTimeFormat {
+		t.Errorf("backup = %+v, %v; want the original file", backup, err)
+	}
+}
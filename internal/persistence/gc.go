@@ -0,0 +1,182 @@
+package persistence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// GCOptions controls a garbage collection run
+type GCOptions struct {
+	DryRun     bool          // Report what would be removed without removing it
+	TempMaxAge time.Duration // Temp files older than this are orphaned even if their writer is alive
+	Blobs      *BlobStore    // Blob store to sweep; nil skips blobs
+	BlobMinAge time.Duration // Unreferenced blobs younger than this are kept, covering in-flight writes
+	Referenced map[string]bool
+}
+
+// DefaultGCOptions returns conservative settings for unattended runs
+func DefaultGCOptions() GCOptions {
+	return GCOptions{
+		TempMaxAge: 10 * time.Minute,
+		BlobMinAge: time.Hour,
+	}
+}
+
+// CollectGarbage removes temp files left by crashed writers, backups beyond the
+// rotation limit and blobs referenced by neither opts.Referenced nor any backup.
+// Individual failures are recorded in the stats rather than aborting the run.
+func (fm *FileManager) CollectGarbage(opts GCOptions) interfaces.GCStats {
+	start := time.Now()
+	stats := interfaces.GCStats{LastRun: start, DryRun: opts.DryRun}
+
+	remove := func(path string, size int64, counter *int) {
+		if !opts.DryRun {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				stats.Errors = append(stats.Errors, err.Error())
+				return
+			}
+		}
+		*counter++
+		stats.BytesReclaimed += size
+	}
+
+	// Orphaned state temp files
+	for _, entry := range fm.globInfo(filepath.Join(fm.tempDir, "state_*.tmp")) {
+		if orphanedTempFile(entry.info, opts.TempMaxAge, start) {
+			remove(entry.path, entry.info.Size(), &stats.TempFilesRemoved)
+		}
+	}
+
+	// Backups beyond the rotation limit, e.g. after lowering backup_rotation
+	keep := fm.backupRotation
+	if keep <= 1 {
+		keep = 0
+	}
+	for _, entry := range fm.globInfo(fm.backupPath + ".*") {
+		n, err := strconv.Atoi(strings.TrimPrefix(entry.path, fm.backupPath+"."))
+		if err == nil && n > keep {
+			remove(entry.path, entry.info.Size(), &stats.BackupsRemoved)
+		}
+	}
+
+	if opts.Blobs != nil {
+		referenced := make(map[string]bool, len(opts.Referenced))
+		for hash := range opts.Referenced {
+			referenced[hash] = true
+		}
+		// Backups may be restored, so whatever they reference stays
+		for _, path := range fm.backupChain() {
+			if err := addStateFileRefs(path, fm.sectionsDir, referenced); err != nil {
+				stats.Errors = append(stats.Errors, fmt.Sprintf("%s: %v", path, err))
+			}
+		}
+
+		for _, entry := range fm.globInfo(filepath.Join(opts.Blobs.tempDir, "blob_*.tmp")) {
+			if start.Sub(entry.info.ModTime()) > opts.TempMaxAge {
+				remove(entry.path, entry.info.Size(), &stats.TempFilesRemoved)
+			}
+		}
+		for _, entry := range fm.globInfo(filepath.Join(opts.Blobs.dir, "??", "*")) {
+			hash := filepath.Base(entry.path)
+			if !validBlobHash(hash) || referenced[hash] || start.Sub(entry.info.ModTime()) < opts.BlobMinAge {
+				continue
+			}
+			remove(entry.path, entry.info.Size(), &stats.BlobsRemoved)
+		}
+	}
+
+	stats.Duration = time.Since(start)
+
+	fm.gcMutex.Lock()
+	fm.lastGC = stats
+	fm.gcMutex.Unlock()
+
+	return stats
+}
+
+type fileEntry struct {
+	path string
+	info os.FileInfo
+}
+
+// globInfo returns regular files matching pattern
+func (fm *FileManager) globInfo(pattern string) []fileEntry {
+	matches, _ := filepath.Glob(pattern)
+	entries := make([]fileEntry, 0, len(matches))
+	for _, path := range matches {
+		info, err := os.Lstat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+		entries = append(entries, fileEntry{path: path, info: info})
+	}
+	return entries
+}
+
+// orphanedTempFile reports whether a state temp file no longer belongs to a running save.
+// Names carry the writer's pid (state_<pid>_*.tmp), so files of dead writers go at once.
+func orphanedTempFile(info os.FileInfo, maxAge time.Duration, now time.Time) bool {
+	if now.Sub(info.ModTime()) > maxAge {
+		return true
+	}
+
+	fields := strings.SplitN(strings.TrimPrefix(info.Name(), "state_"), "_", 2)
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 || pid == os.Getpid() {
+		return false
+	}
+	return syscall.Kill(pid, 0) == syscall.ESRCH
+}
+
+// addStateFileRefs adds the blob references of a saved state file to refs
+func addStateFileRefs(path, sectionsDir string, refs map[string]bool) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	_, state, err := decodeStateFile(path, data, sectionsDir)
+	if err != nil {
+		return err
+	}
+
+	for hash := range MessageBlobRefs(state) {
+		refs[hash] = true
+	}
+	return nil
+}
+
+// MessageBlobRefs returns every blob hash referenced by messages in state,
+// archived ones included
+func MessageBlobRefs(state *types.SharedApplicationState) map[string]bool {
+	refs := make(map[string]bool)
+	add := func(msg *types.MessageInfo) {
+		if msg.BodyRef != "" {
+			refs[msg.BodyRef] = true
+		}
+		if msg.PartsRef != "" {
+			refs[msg.PartsRef] = true
+		}
+		if msg.NativeRef != "" {
+			refs[msg.NativeRef] = true
+		}
+	}
+	for i := range state.Messages {
+		add(&state.Messages[i])
+	}
+	// Compactions archive messages with their bodies still in the store
+	for i := range state.ArchivedMessages {
+		add(&state.ArchivedMessages[i])
+	}
+	if state.CurrentMessage != nil {
+		add(state.CurrentMessage)
+	}
+	return refs
+}
@@ -0,0 +1,90 @@
+package persistence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestCollectGarbage(t *testing.T) {
+	dir := t.TempDir()
+	config := DefaultFileManagerConfig(filepath.Join(dir, "state.json"))
+	config.BackupRotation = 2
+	fm := NewFileManager(config)
+	if err := fm.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	blobs := NewBlobStore(DefaultBlobDir(config.StatePath), 0, 0)
+
+	old := time.Now().Add(-2 * time.Hour)
+	write := func(path string, mtime time.Time) {
+		t.Helper()
+		// Parses as an empty metadata header and state, like a minimal backup
+		if err := os.WriteFile(path, []byte("{\"version\": \"1.0\"}\n{}\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		os.Chtimes(path, mtime, mtime)
+	}
+
+	// Temp files: one stale, one fresh from this (live) process
+	staleTemp := filepath.Join(config.TempDir, "state_1_stale.tmp")
+	freshTemp := filepath.Join(config.TempDir, fmt.Sprintf("state_%d_fresh.tmp", os.Getpid()))
+	write(staleTemp, old)
+	write(freshTemp, time.Now())
+
+	// Backups: .3 is beyond a rotation of 2
+	for _, n := range []string{"1", "2", "3"} {
+		write(fm.backupPath+"."+n, time.Now())
+	}
+
+	live, _ := blobs.Put([]byte("referenced by state"))
+	orphan, _ := blobs.Put([]byte("referenced by nothing"))
+	young, _ := blobs.Put([]byte("just written"))
+	for _, hash := range []string{live, orphan} {
+		os.Chtimes(blobs.path(hash), old, old)
+	}
+
+	// A backup referencing a blob keeps it alive
+	backupState := types.NewSharedApplicationState()
+	backupState.Messages = []types.MessageInfo{{ID: "m1", BodyRef: live}}
+	if err := fm.SaveStateAtomic(backupState); err != nil {
+		t.Fatal(err)
+	}
+	if err := fm.SaveStateAtomic(types.NewSharedApplicationState()); err != nil {
+		t.Fatal(err)
+	}
+
+	opts := DefaultGCOptions()
+	opts.Blobs = blobs
+	opts.DryRun = true
+
+	dry := fm.CollectGarbage(opts)
+	if dry.TempFilesRemoved != 1 || dry.BackupsRemoved != 1 || dry.BlobsRemoved != 1 {
+		t.Fatalf("dry run stats = %+v, want 1 temp, 1 backup, 1 blob", dry)
+	}
+	if !blobs.Has(orphan) {
+		t.Fatal("dry run must not delete anything")
+	}
+
+	opts.DryRun = false
+	stats := fm.CollectGarbage(opts)
+	if stats.TempFilesRemoved != 1 || stats.BackupsRemoved != 1 || stats.BlobsRemoved != 1 || len(stats.Errors) != 0 {
+		t.Fatalf("stats = %+v", stats)
+	}
+	if blobs.Has(orphan) || !blobs.Has(live) || !blobs.Has(young) {
+		t.Errorf("wrong blobs collected: orphan=%v live=%v young=%v", blobs.Has(orphan), blobs.Has(live), blobs.Has(young))
+	}
+	if _, err := os.Stat(staleTemp); !os.IsNotExist(err) {
+		t.Errorf("stale temp file should be removed")
+	}
+	if _, err := os.Stat(freshTemp); err != nil {
+		t.Errorf("fresh temp file of a live writer should be kept: %v", err)
+	}
+	if got := fm.GetStats().LastGC; got.BlobsRemoved != 1 || got.DryRun {
+		t.Errorf("GetStats().LastGC = %+v", got)
+	}
+}
@@ -0,0 +1,158 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// MemoryStatePath is reported as the state path of an in-memory repository
+const MemoryStatePath = "memory"
+
+// ErrInjectedFailure is returned by a MemoryRepository save or load chosen to fail
+var ErrInjectedFailure = errors.New("injected storage failure")
+
+// MemoryOptions slow down or break a MemoryRepository to exercise callers'
+// timeouts and error paths
+type MemoryOptions struct {
+	Latency     time.Duration // Added to every save and load
+	FailureRate float64       // Fraction of saves and loads that fail, 0 to 1
+	Clock       clock.Clock   // Stamps saves; nil is the system clock
+}
+
+// MemoryRepository keeps state in memory and never touches disk. It
+// implements interfaces.StateRepository for tests and for ephemeral sessions
+// whose state should vanish when they stop. State is held serialized, so a
+// load returns a copy no caller shares.
+type MemoryRepository struct {
+	mutex    sync.Mutex
+	opts     MemoryOptions
+	failNext int
+	random   *rand.Rand
+	data     []byte
+	modTime  time.Time
+	saves    int64
+	loads    int64
+}
+
+// NewMemoryRepository returns an empty repository
+func NewMemoryRepository(opts MemoryOptions) *MemoryRepository {
+	return &MemoryRepository{
+		opts:   opts,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// SetOptions replaces the latency and failure rate
+func (r *MemoryRepository) SetOptions(opts MemoryOptions) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.opts = opts
+}
+
+// FailNext makes the next n saves or loads fail with ErrInjectedFailure,
+// whatever the failure rate
+func (r *MemoryRepository) FailNext(n int) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.failNext = n
+}
+
+// Counts returns how many saves and loads succeeded
+func (r *MemoryRepository) Counts() (saves, loads int64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.saves, r.loads
+}
+
+// Initialize has nothing to set up
+func (r *MemoryRepository) Initialize() error {
+	return nil
+}
+
+// SaveStateAtomic replaces the stored state; a failed save leaves the
+// previous state in place
+func (r *MemoryRepository) SaveStateAtomic(state *types.SharedApplicationState) error {
+	if state == nil {
+		return fmt.Errorf("cannot save nil state")
+	}
+	if err := r.inject(); err != nil {
+		return err
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to serialize state: %w", err)
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.data = data
+	r.modTime = clock.Or(r.opts.Clock).Now()
+	r.saves++
+	return nil
+}
+
+// LoadStateAtomic returns a copy of the stored state, or a FileNotFoundError
+// before the first save
+func (r *MemoryRepository) LoadStateAtomic() (*types.SharedApplicationState, error) {
+	if err := r.inject(); err != nil {
+		return nil, err
+	}
+
+	r.mutex.Lock()
+	data := r.data
+	r.mutex.Unlock()
+	if data == nil {
+		return nil, &FileNotFoundError{Path: MemoryStatePath}
+	}
+
+	var state types.SharedApplicationState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to deserialize state: %w", err)
+	}
+
+	r.mutex.Lock()
+	r.loads++
+	r.mutex.Unlock()
+	return &state, nil
+}
+
+// GetStats reports the size of the stored state
+func (r *MemoryRepository) GetStats() interfaces.RepositoryStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return interfaces.RepositoryStats{
+		StatePath: MemoryStatePath,
+		FileSize:  int64(len(r.data)),
+		ModTime:   r.modTime,
+	}
+}
+
+// inject waits out the configured latency and decides whether this call fails
+func (r *MemoryRepository) inject() error {
+	r.mutex.Lock()
+	latency := r.opts.Latency
+	failing := false
+	if r.failNext > 0 {
+		r.failNext--
+		failing = true
+	} else if r.opts.FailureRate > 0 {
+		failing = r.random.Float64() < r.opts.FailureRate
+	}
+	r.mutex.Unlock()
+
+	if latency > 0 {
+		time.Sleep(latency)
+	}
+	if failing {
+		return ErrInjectedFailure
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package persistence
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestMemoryRepository(t *testing.T) {
+	repo := NewMemoryRepository(MemoryOptions{})
+	if err := repo.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+
+	var notFound *FileNotFoundError
+	if _, err := repo.LoadStateAtomic(); !errors.As(err, &notFound) {
+		t.Fatalf("LoadStateAtomic() before any save error = %v, want FileNotFoundError", err)
+	}
+
+	state := types.NewSharedApplicationState()
+	state.AddSession(types.SessionInfo{ID: "s1", Title: "first"})
+	if err := repo.SaveStateAtomic(state); err != nil {
+		t.Fatalf("SaveStateAtomic() error = %v", err)
+	}
+
+	// The repository keeps its own copy
+	state.Sessions[0].Title = "changed"
+	loaded, err := repo.LoadStateAtomic()
+	if err != nil {
+		t.Fatalf("LoadStateAtomic() error = %v", err)
+	}
+	if len(loaded.Sessions) != 1 || loaded.Sessions[0].Title != "first" {
+		t.Errorf("loaded sessions = %+v, want the saved session", loaded.Sessions)
+	}
+	loaded.Sessions[0].Title = "also changed"
+	if again, _ := repo.LoadStateAtomic(); again.Sessions[0].Title != "first" {
+		t.Errorf("loads share state: title = %q", again.Sessions[0].Title)
+	}
+
+	stats := repo.GetStats()
+	if stats.StatePath != MemoryStatePath || stats.FileSize == 0 || stats.ModTime.IsZero() {
+		t.Errorf("GetStats() = %+v", stats)
+	}
+	if saves, loads := repo.Counts(); saves != 1 || loads != 2 {
+		t.Errorf("Counts() = %d saves, %d loads; want 1, 2", saves, loads)
+	}
+}
+
+func TestMemoryRepositoryInjection(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     MemoryOptions
+		failNext int
+		wantErr  bool
+		minDelay time.Duration
+	}{
+		{name: "healthy"},
+		{name: "latency", opts: MemoryOptions{Latency: 20 * time.Millisecond}, minDelay: 20 * time.Millisecond},
+		{name: "always failing", opts: MemoryOptions{FailureRate: 1}, wantErr: true},
+		{name: "fail next", failNext: 1, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMemoryRepository(MemoryOptions{})
+			first := types.NewSharedApplicationState()
+			if err := repo.SaveStateAtomic(first); err != nil {
+				t.Fatal(err)
+			}
+			repo.SetOptions(tt.opts)
+			repo.FailNext(tt.failNext)
+
+			second := types.NewSharedApplicationState()
+			second.AddSession(types.SessionInfo{ID: "s2"})
+			start := time.Now()
+			err := repo.SaveStateAtomic(second)
+			if elapsed := time.Since(start); elapsed < tt.minDelay {
+				t.Errorf("save took %v, want at least %v", elapsed, tt.minDelay)
+			}
+			if tt.wantErr != errors.Is(err, ErrInjectedFailure) {
+				t.Fatalf("SaveStateAtomic() error = %v, want injected failure: %v", err, tt.wantErr)
+			}
+
+			// A failed save leaves the previous state in place
+			repo.SetOptions(MemoryOptions{})
+			loaded, err := repo.LoadStateAtomic()
+			if err != nil {
+				t.Fatalf("LoadStateAtomic() error = %v", err)
+			}
+			wantSessions := 1
+			if tt.wantErr {
+				wantSessions = 0
+			}
+			if len(loaded.Sessions) != wantSessions {
+				t.Errorf("loaded %d sessions, want %d", len(loaded.Sessions), wantSessions)
+			}
+		})
+	}
+}
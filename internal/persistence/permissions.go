@@ -0,0 +1,115 @@
+package persistence
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+const (
+	// DefaultFileMode keeps state, lock and backup files private to the owner
+	DefaultFileMode os.FileMode = 0600
+	// DefaultDirMode keeps state directories private to the owner
+	DefaultDirMode os.FileMode = 0700
+)
+
+// PermissionIssue describes a persisted file that is more permissive than configured
+// or owned by another user
+type PermissionIssue struct {
+	Path     string      `json:"path"`
+	Mode     os.FileMode `json:"mode"`
+	Expected os.FileMode `json:"expected"`
+	OwnerUID int         `json:"owner_uid"`
+	Reason   string      `json:"reason"`
+}
+
+func (i PermissionIssue) String() string {
+	return fmt.Sprintf("%s: %s (mode %04o, expected at most %04o, owner uid %d)",
+		i.Path, i.Reason, i.Mode.Perm(), i.Expected.Perm(), i.OwnerUID)
+}
+
+// CheckPermissions inspects the state, lock and backup files and their directory.
+// Missing files are not reported.
+func (fm *FileManager) CheckPermissions() []PermissionIssue {
+	var issues []PermissionIssue
+
+	// Only directories this user owns are checked; a shared parent such as /tmp is not ours to fix
+	stateDir := filepath.Dir(fm.statePath)
+	if fm.checkOwnership(stateDir) == nil {
+		if issue, ok := fm.checkPath(stateDir, fm.dirMode); ok {
+			issues = append(issues, issue)
+		}
+	}
+	for _, path := range fm.managedFiles() {
+		if issue, ok := fm.checkPath(path, fm.fileMode); ok {
+			issues = append(issues, issue)
+		}
+	}
+
+	return issues
+}
+
+// managedFiles returns every file path the manager writes
+func (fm *FileManager) managedFiles() []string {
+	paths := []string{fm.statePath, fm.lockPath, fm.backupPath}
+	for i := 1; i <= fm.backupRotation; i++ {
+		paths = append(paths, fmt.Sprintf("%s.%d", fm.backupPath, i))
+	}
+	return paths
+}
+
+// checkPath reports an issue if path grants bits beyond expected or belongs to another user
+func (fm *FileManager) checkPath(path string, expected os.FileMode) (PermissionIssue, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return PermissionIssue{}, false
+	}
+
+	issue := PermissionIssue{Path: path, Mode: info.Mode(), Expected: expected, OwnerUID: -1}
+	if uid, ok := fileOwnerUID(info); ok {
+		issue.OwnerUID = uid
+		if uid != os.Getuid() {
+			issue.Reason = "owned by another user"
+			return issue, true
+		}
+	}
+	if info.Mode().Perm()&^expected.Perm() != 0 {
+		issue.Reason = "too permissive"
+		return issue, true
+	}
+
+	return PermissionIssue{}, false
+}
+
+// checkOwnership refuses files written by another user, which could otherwise
+// be used to inject state into this user's session
+func (fm *FileManager) checkOwnership(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if uid, ok := fileOwnerUID(info); ok && uid != os.Getuid() {
+		return &OwnershipError{Path: path, OwnerUID: uid, ExpectedUID: os.Getuid()}
+	}
+	return nil
+}
+
+// applyFileMode sets mode explicitly so the result does not depend on the process umask
+func (fm *FileManager) applyFileMode(path string) error {
+	return os.Chmod(path, fm.fileMode)
+}
+
+// ensureDir creates dir with the configured mode. Existing directories are left
+// alone and reported by CheckPermissions instead.
+func (fm *FileManager) ensureDir(dir string) error {
+	return os.MkdirAll(dir, fm.dirMode)
+}
+
+func fileOwnerUID(info os.FileInfo) (int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return int(stat.Uid), true
+}
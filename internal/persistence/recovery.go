@@ -0,0 +1,205 @@
+package persistence
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+)
+
+// recoverInterruptedWrites repairs what a writer that crashed inside
+// SaveStateAtomic can leave behind: a lock file nobody holds, a fully written
+// temp file that was never renamed into place, a truncated backup copy, or a
+// state file that is missing or corrupt. Newer complete saves are finished;
+// everything else is rolled back to the last good file.
+func (fm *FileManager) recoverInterruptedWrites() interfaces.RecoveryReport {
+	report := interfaces.RecoveryReport{RanAt: time.Now()}
+
+	// A live writer's files are not ours to touch
+	held, removed, err := fm.clearStaleLock()
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	}
+	if held {
+		report.Skipped = "state file is locked by another process"
+		return report
+	}
+	report.StaleLockRemoved = removed
+
+	if err := fm.acquireFileLock(); err != nil {
+		report.Skipped = fmt.Sprintf("could not lock state file: %v", err)
+		return report
+	}
+	defer fm.releaseFileLock()
+
+	// Only a damaged file counts as corrupt; unreadable or invalid state is left for Load to report
+	current, stateErr := fm.readStateVersion(fm.statePath)
+	stateCorrupt := isCorruption(stateErr)
+
+	// The newest complete temp file of a dead writer is a save that only lacked its rename
+	var promote string
+	var promoteVersion int64
+	var leftovers []fileEntry
+	for _, entry := range fm.globInfo(filepath.Join(fm.tempDir, "state_*.tmp")) {
+		if !deadWriterTempFile(entry.info) {
+			continue
+		}
+		leftovers = append(leftovers, entry)
+
+		version, err := fm.readStateVersion(entry.path)
+		if err != nil {
+			continue
+		}
+		if (os.IsNotExist(stateErr) || stateCorrupt || (stateErr == nil && version > current)) && (promote == "" || version > promoteVersion) {
+			promote, promoteVersion = entry.path, version
+		}
+	}
+
+	if stateCorrupt {
+		fm.quarantine(fm.statePath, &report)
+	}
+
+	switch {
+	case promote != "":
+		if err := fm.promoteTempFile(promote, stateErr == nil); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			report.PromotedTemp = promote
+		}
+	case stateCorrupt:
+		if restored, err := fm.restoreNewestBackup(); err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		} else {
+			report.RestoredBackup = restored
+		}
+	}
+
+	for _, entry := range leftovers {
+		if entry.path == report.PromotedTemp {
+			continue
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			report.Errors = append(report.Errors, err.Error())
+			continue
+		}
+		report.TempFilesRemoved++
+	}
+
+	// A crash while copying the state into the backup leaves a truncated copy
+	if _, err := os.Stat(fm.backupPath); err == nil {
+		if _, err := fm.readStateVersion(fm.backupPath); isCorruption(err) {
+			fm.quarantine(fm.backupPath, &report)
+		}
+	}
+
+	if report.Changed() {
+		log.Printf("Recovered from interrupted state write: %s", report.Summary())
+		for _, msg := range report.Errors {
+			log.Printf("State recovery error: %s", msg)
+		}
+	}
+	return report
+}
+
+// clearStaleLock removes the lock file when no process holds its flock. It
+// reports whether a live process holds the lock and whether a stale one was removed.
+func (fm *FileManager) clearStaleLock() (held, removed bool, err error) {
+	file, err := os.OpenFile(fm.lockPath, os.O_RDWR, 0)
+	if os.IsNotExist(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to inspect lock file: %w", err)
+	}
+	defer file.Close()
+
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB); err != nil {
+		return true, false, nil
+	}
+	if err := os.Remove(fm.lockPath); err != nil && !os.IsNotExist(err) {
+		return false, false, fmt.Errorf("failed to remove stale lock: %w", err)
+	}
+	return false, true, nil
+}
+
+// deadWriterTempFile reports whether a state temp file was left by a process
+// that no longer exists; names carry the writer's pid (state_<pid>_*.tmp)
+func deadWriterTempFile(info os.FileInfo) bool {
+	fields := strings.SplitN(strings.TrimPrefix(info.Name(), "state_"), "_", 2)
+	pid, err := strconv.Atoi(fields[0])
+	if err != nil || pid <= 0 {
+		return true
+	}
+	if pid == os.Getpid() {
+		return false
+	}
+	return syscall.Kill(pid, 0) == syscall.ESRCH
+}
+
+// readStateVersion verifies and validates a state file and returns its version
+func (fm *FileManager) readStateVersion(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	_, state, err := decodeStateFile(path, data, fm.sectionsDir)
+	if err != nil {
+		return 0, err
+	}
+	if err := fm.validateState(state); err != nil {
+		return 0, err
+	}
+	return state.Version.Version, nil
+}
+
+func isCorruption(err error) bool {
+	var corruption *CorruptionError
+	return errors.As(err, &corruption)
+}
+
+// promoteTempFile finishes an interrupted save, backing up the state it replaces
+func (fm *FileManager) promoteTempFile(tempPath string, backupCurrent bool) error {
+	if backupCurrent {
+		if err := fm.backupExistingFile(); err != nil {
+			return fmt.Errorf("failed to back up state before completing save: %w", err)
+		}
+	}
+	if err := fm.applyFileMode(tempPath); err != nil {
+		return fmt.Errorf("failed to set state file mode: %w", err)
+	}
+	if err := os.Rename(tempPath, fm.statePath); err != nil {
+		return fmt.Errorf("failed to complete interrupted save: %w", err)
+	}
+	return nil
+}
+
+// restoreNewestBackup copies the newest restorable backup over the state file
+func (fm *FileManager) restoreNewestBackup() (string, error) {
+	for _, path := range fm.backupChain() {
+		if _, err := fm.readStateVersion(path); err != nil {
+			continue
+		}
+		if err := fm.copyFile(path, fm.statePath); err != nil {
+			return "", fmt.Errorf("failed to restore %s: %w", path, err)
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf("no restorable backup for corrupt state file %s", fm.statePath)
+}
+
+// quarantine moves a corrupt file aside so it is neither loaded nor rotated into backups
+func (fm *FileManager) quarantine(path string, report *interfaces.RecoveryReport) {
+	target := fmt.Sprintf("%s.corrupt-%s", path, time.Now().UTC().Format("20060102T150405Z"))
+	if err := os.Rename(path, target); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("failed to quarantine %s: %v", path, err))
+		return
+	}
+	report.Quarantined = append(report.Quarantined, target)
+}
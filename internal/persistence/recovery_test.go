@@ -0,0 +1,180 @@
+package persistence
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// deadPID is far above any pid_max, so no process can own it
+const deadPID = "2147480000"
+
+func TestRecoverInterruptedWrites(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(t *testing.T, fm *FileManager, write func(path string, version int64))
+		// Expected outcome
+		wantVersion  int64 // 0: no loadable state
+		wantPromoted bool
+		wantRestored bool
+		wantRemoved  int
+		wantQuarant  int
+		wantLock     bool // lock file survives
+	}{
+		{
+			name: "stale lock",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				os.WriteFile(fm.lockPath, []byte(deadPID), 0600)
+			},
+			wantVersion: 3,
+		},
+		{
+			name: "complete temp newer than state",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				write(filepath.Join(fm.tempDir, "state_"+deadPID+"_a.tmp"), 5)
+				write(filepath.Join(fm.tempDir, "state_"+deadPID+"_b.tmp"), 4)
+			},
+			wantVersion:  5,
+			wantPromoted: true,
+			wantRemoved:  1,
+		},
+		{
+			name: "temp older than state",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				write(filepath.Join(fm.tempDir, "state_"+deadPID+"_a.tmp"), 2)
+			},
+			wantVersion: 3,
+			wantRemoved: 1,
+		},
+		{
+			name: "truncated temp",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				os.WriteFile(filepath.Join(fm.tempDir, "state_"+deadPID+"_a.tmp"), []byte(`{"version": "1.0", "chec`), 0600)
+			},
+			wantVersion: 3,
+			wantRemoved: 1,
+		},
+		{
+			name: "state missing after interrupted rename",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.backupPath, 2)
+				write(filepath.Join(fm.tempDir, "state_"+deadPID+"_a.tmp"), 3)
+			},
+			wantVersion:  3,
+			wantPromoted: true,
+		},
+		{
+			name: "corrupt state restored from backup",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				os.WriteFile(fm.statePath, []byte("{\"version\": \"1.0\", \"checksum\": \"sha256:00\"}\n{}\n"), 0600)
+				write(fm.backupPath+".1", 2)
+			},
+			wantVersion:  2,
+			wantRestored: true,
+			wantQuarant:  1,
+		},
+		{
+			name: "truncated backup copy",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				os.WriteFile(fm.backupPath, []byte(`{"version": "1.0"}`+"\n{\"sess"), 0600)
+			},
+			wantVersion: 3,
+			wantQuarant: 1,
+		},
+		{
+			name: "live writer's temp is left alone",
+			setup: func(t *testing.T, fm *FileManager, write func(string, int64)) {
+				write(fm.statePath, 3)
+				write(filepath.Join(fm.tempDir, "state_1_live.tmp"), 9)
+			},
+			wantVersion: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json"))
+			fm := NewFileManager(config)
+			if err := os.MkdirAll(fm.tempDir, 0700); err != nil {
+				t.Fatal(err)
+			}
+
+			write := func(path string, version int64) {
+				t.Helper()
+				state := types.NewSharedApplicationState()
+				state.Version.Version = version
+				file, err := os.Create(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer file.Close()
+				if err := fm.writeStateToFile(state, file); err != nil {
+					t.Fatal(err)
+				}
+			}
+			tt.setup(t, fm, write)
+
+			if err := fm.Initialize(); err != nil {
+				t.Fatalf("Initialize() error = %v", err)
+			}
+			report := fm.GetStats().LastRecovery
+			if len(report.Errors) > 0 || report.Skipped != "" {
+				t.Fatalf("recovery errors = %v, skipped = %q", report.Errors, report.Skipped)
+			}
+			if (report.PromotedTemp != "") != tt.wantPromoted || (report.RestoredBackup != "") != tt.wantRestored {
+				t.Errorf("promoted = %q, restored = %q", report.PromotedTemp, report.RestoredBackup)
+			}
+			if report.TempFilesRemoved != tt.wantRemoved || len(report.Quarantined) != tt.wantQuarant {
+				t.Errorf("removed %d temps (want %d), quarantined %v (want %d)",
+					report.TempFilesRemoved, tt.wantRemoved, report.Quarantined, tt.wantQuarant)
+			}
+			for _, path := range report.Quarantined {
+				if !strings.Contains(path, ".corrupt-") {
+					t.Errorf("quarantined path %s", path)
+				}
+				if _, err := os.Stat(path); err != nil {
+					t.Errorf("quarantined file missing: %v", err)
+				}
+			}
+			if _, err := os.Stat(fm.lockPath); (err == nil) != tt.wantLock {
+				t.Errorf("lock file present = %v, want %v", err == nil, tt.wantLock)
+			}
+
+			state, err := fm.LoadStateAtomic()
+			if err != nil {
+				t.Fatalf("LoadStateAtomic() error = %v", err)
+			}
+			if state.Version.Version != tt.wantVersion {
+				t.Errorf("loaded version %d, want %d", state.Version.Version, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestRecoverySkipsWhileLockHeld(t *testing.T) {
+	config := DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json"))
+	holder := NewFileManager(config)
+	if err := holder.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	if err := holder.acquireFileLock(); err != nil {
+		t.Fatal(err)
+	}
+	defer holder.releaseFileLock()
+
+	fm := NewFileManager(config)
+	if err := fm.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	if report := fm.GetStats().LastRecovery; report.Skipped == "" || report.Changed() {
+		t.Errorf("recovery with a held lock = %+v, want skipped", report)
+	}
+}
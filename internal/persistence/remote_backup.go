@@ -0,0 +1,360 @@
+package persistence
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrRemoteNotFound is returned by destinations when a key does not exist
+var ErrRemoteNotFound = errors.New("remote backup not found")
+
+// BackupDestination stores off-site copies of state files and blobs under
+// slash-separated keys. Implementations must make Put atomic from the reader's view.
+type BackupDestination interface {
+	Name() string
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	// List returns the full keys under prefix; a missing prefix yields no keys
+	List(ctx context.Context, prefix string) ([]string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// Remote layout, relative to a destination's root:
+//
+//	<session>/states/<UTC timestamp>-v<version>.json
+//	<session>/blobs/<sha256>
+const (
+	remoteStatesDir = "states"
+	remoteBlobsDir  = "blobs"
+	remoteTimeFmt   = "20060102T150405Z"
+)
+
+// RemoteBackupConfig controls scheduled off-site copies
+type RemoteBackupConfig struct {
+	Interval     time.Duration // Time between copies; 0 disables the schedule
+	Keep         int           // Remote state copies kept per destination; 0 keeps all
+	Destinations []BackupDestination
+}
+
+// RemoteBackupStats summarizes off-site copy activity
+type RemoteBackupStats struct {
+	Copies     int64             `json:"copies"`
+	Failures   int64             `json:"failures"`
+	BlobsSent  int64             `json:"blobs_sent"`
+	LastCopy   time.Time         `json:"last_copy"`
+	LastErrors map[string]string `json:"last_errors,omitempty"` // By destination name
+}
+
+// RemoteBackup copies the state file and the blobs it references to remote destinations
+type RemoteBackup struct {
+	fm      *FileManager
+	blobs   *BlobStore
+	config  RemoteBackupConfig
+	session string
+	mutex   sync.Mutex
+	stats   RemoteBackupStats
+}
+
+// NewRemoteBackup creates an off-site copier for fm's state file. blobs may be nil.
+func NewRemoteBackup(fm *FileManager, blobs *BlobStore, config RemoteBackupConfig) *RemoteBackup {
+	return &RemoteBackup{
+		fm:      fm,
+		blobs:   blobs,
+		config:  config,
+		session: RemoteSessionName(fm.statePath),
+	}
+}
+
+// RemoteSessionName is the top-level remote directory for a state file
+func RemoteSessionName(statePath string) string {
+	return strings.TrimSuffix(filepath.Base(statePath), filepath.Ext(statePath))
+}
+
+// Run copies off-site every Interval until ctx is done
+func (rb *RemoteBackup) Run(ctx context.Context) {
+	if rb.config.Interval <= 0 || len(rb.config.Destinations) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(rb.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := rb.CopyOffsite(ctx); err != nil {
+				log.Printf("Off-site backup failed: %v", err)
+			}
+		}
+	}
+}
+
+// CopyOffsite copies the current state to every destination. A failing destination
+// does not stop the others; the combined error names each failure.
+func (rb *RemoteBackup) CopyOffsite(ctx context.Context) error {
+	data, err := os.ReadFile(rb.fm.statePath)
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	// Never ship a corrupt state off-site; it would push out good copies on pruning
+	metadata, state, err := decodeStateFile(rb.fm.statePath, data, rb.fm.sectionsDir)
+	if err != nil {
+		return err
+	}
+	// A differential save lists sections kept beside it; the copy holds the whole state
+	if len(metadata.Sections) > 0 {
+		if data, err = rb.fm.encodeStateFile(state); err != nil {
+			return err
+		}
+	}
+
+	var errs []error
+	for _, dest := range rb.config.Destinations {
+		sent, err := rb.copyTo(ctx, dest, data, state)
+
+		rb.mutex.Lock()
+		rb.stats.BlobsSent += int64(sent)
+		if rb.stats.LastErrors == nil {
+			rb.stats.LastErrors = make(map[string]string)
+		}
+		if err != nil {
+			rb.stats.Failures++
+			rb.stats.LastErrors[dest.Name()] = err.Error()
+			errs = append(errs, fmt.Errorf("%s: %w", dest.Name(), err))
+		} else {
+			rb.stats.Copies++
+			rb.stats.LastCopy = time.Now()
+			delete(rb.stats.LastErrors, dest.Name())
+		}
+		rb.mutex.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// GetStatistics returns off-site copy statistics
+func (rb *RemoteBackup) GetStatistics() RemoteBackupStats {
+	rb.mutex.Lock()
+	defer rb.mutex.Unlock()
+
+	stats := rb.stats
+	stats.LastErrors = make(map[string]string, len(rb.stats.LastErrors))
+	for name, msg := range rb.stats.LastErrors {
+		stats.LastErrors[name] = msg
+	}
+	return stats
+}
+
+// copyTo uploads missing blobs first, so every remote state has its blobs, then the state
+func (rb *RemoteBackup) copyTo(ctx context.Context, dest BackupDestination, data []byte, state *types.SharedApplicationState) (int, error) {
+	sent := 0
+	if refs := MessageBlobRefs(state); len(refs) > 0 && rb.blobs != nil {
+		existing, err := dest.List(ctx, path.Join(rb.session, remoteBlobsDir)+"/")
+		if err != nil {
+			return 0, fmt.Errorf("failed to list remote blobs: %w", err)
+		}
+		have := make(map[string]bool, len(existing))
+		for _, key := range existing {
+			have[path.Base(key)] = true
+		}
+
+		for hash := range refs {
+			if have[hash] {
+				continue
+			}
+			blob, err := rb.blobs.Get(hash)
+			if err != nil {
+				return sent, fmt.Errorf("failed to read blob %s: %w", hash, err)
+			}
+			if err := dest.Put(ctx, path.Join(rb.session, remoteBlobsDir, hash), blob); err != nil {
+				return sent, fmt.Errorf("failed to upload blob %s: %w", hash, err)
+			}
+			sent++
+		}
+	}
+
+	name := fmt.Sprintf("%s-v%d.json", time.Now().UTC().Format(remoteTimeFmt), state.Version.Version)
+	if err := dest.Put(ctx, path.Join(rb.session, remoteStatesDir, name), data); err != nil {
+		return sent, fmt.Errorf("failed to upload state: %w", err)
+	}
+
+	if rb.config.Keep > 0 {
+		states, err := ListRemoteStates(ctx, dest, rb.session)
+		if err != nil {
+			return sent, fmt.Errorf("failed to list remote states for pruning: %w", err)
+		}
+		for len(states) > rb.config.Keep {
+			oldest := states[len(states)-1]
+			if err := dest.Delete(ctx, path.Join(rb.session, remoteStatesDir, oldest)); err != nil {
+				return sent, fmt.Errorf("failed to prune %s: %w", oldest, err)
+			}
+			states = states[:len(states)-1]
+		}
+	}
+	return sent, nil
+}
+
+// ListRemoteStates returns the state copies of a session on dest, newest first
+func ListRemoteStates(ctx context.Context, dest BackupDestination, session string) ([]string, error) {
+	keys, err := dest.List(ctx, path.Join(session, remoteStatesDir)+"/")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if name := path.Base(key); strings.HasSuffix(name, ".json") {
+			names = append(names, name)
+		}
+	}
+	// Names start with a UTC timestamp, so lexical order is chronological
+	sort.Sort(sort.Reverse(sort.StringSlice(names)))
+	return names, nil
+}
+
+// RestoreFromRemote downloads a state copy and its blobs and saves it as fm's state.
+// An empty name restores the newest copy. The local state is backed up first by the
+// regular save path, so a restore can itself be undone from the local backup chain.
+func RestoreFromRemote(ctx context.Context, dest BackupDestination, session, name string, fm *FileManager, blobs *BlobStore) (*types.SharedApplicationState, error) {
+	if name == "" {
+		states, err := ListRemoteStates(ctx, dest, session)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list remote states: %w", err)
+		}
+		if len(states) == 0 {
+			return nil, fmt.Errorf("%w: no state copies for %s on %s", ErrRemoteNotFound, session, dest.Name())
+		}
+		name = states[0]
+	}
+
+	key := path.Join(session, remoteStatesDir, name)
+	data, err := dest.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", key, err)
+	}
+	_, state, err := decodeStateFile(key, data, "")
+	if err != nil {
+		return nil, err
+	}
+	if err := fm.validateState(state); err != nil {
+		return nil, err
+	}
+
+	for hash := range MessageBlobRefs(state) {
+		if blobs == nil {
+			return nil, fmt.Errorf("state references blobs but no blob store is configured")
+		}
+		if blobs.Has(hash) {
+			continue
+		}
+		blob, err := dest.Get(ctx, path.Join(session, remoteBlobsDir, hash))
+		if err != nil {
+			return nil, fmt.Errorf("failed to download blob %s: %w", hash, err)
+		}
+		stored, err := blobs.Put(blob)
+		if err != nil {
+			return nil, err
+		}
+		if stored != hash {
+			blobs.Delete(stored)
+			return nil, &CorruptionError{Path: path.Join(session, remoteBlobsDir, hash), Reason: "content does not match hash"}
+		}
+	}
+
+	if err := fm.Initialize(); err != nil {
+		return nil, err
+	}
+	if err := fm.SaveStateAtomic(state); err != nil {
+		return nil, fmt.Errorf("failed to save restored state: %w", err)
+	}
+	return state, nil
+}
+
+// LocalDestination copies backups to a directory, such as a mounted NAS or USB disk
+type LocalDestination struct {
+	name string
+	root string
+}
+
+// NewLocalDestination creates a destination rooted at dir
+func NewLocalDestination(name, dir string) *LocalDestination {
+	return &LocalDestination{name: name, root: dir}
+}
+
+func (d *LocalDestination) Name() string {
+	return d.name
+}
+
+func (d *LocalDestination) Put(ctx context.Context, key string, data []byte) error {
+	target := d.path(key)
+	if err := os.MkdirAll(filepath.Dir(target), DefaultDirMode); err != nil {
+		return err
+	}
+	temp, err := os.CreateTemp(filepath.Dir(target), ".upload_*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), target)
+}
+
+func (d *LocalDestination) Get(ctx context.Context, key string) ([]byte, error) {
+	data, err := os.ReadFile(d.path(key))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, key)
+	}
+	return data, err
+}
+
+func (d *LocalDestination) List(ctx context.Context, prefix string) ([]string, error) {
+	entries, err := os.ReadDir(d.path(prefix))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Type().IsRegular() && !strings.HasPrefix(entry.Name(), ".") {
+			keys = append(keys, path.Join(prefix, entry.Name()))
+		}
+	}
+	return keys, nil
+}
+
+func (d *LocalDestination) Delete(ctx context.Context, key string) error {
+	if err := os.Remove(d.path(key)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// path maps a key below the root; keys are generated internally, but Clean keeps
+// a hand-typed restore name from escaping the root
+func (d *LocalDestination) path(key string) string {
+	return filepath.Join(d.root, filepath.FromSlash(path.Clean("/"+key)))
+}
@@ -0,0 +1,138 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/shellquote"
+)
+
+// RsyncDestination copies backups to "host:/path" or "user@host:/path" over ssh.
+// It shells out to rsync and ssh so the user's keys, agent and ssh_config apply.
+type RsyncDestination struct {
+	name   string
+	host   string
+	root   string
+	sshCmd string
+}
+
+// NewRsyncDestination parses target as [user@]host:/path. sshCommand replaces
+// "ssh" as the remote shell, e.g. "ssh -p 2222 -i ~/.ssh/backup".
+func NewRsyncDestination(name, target, sshCommand string) (*RsyncDestination, error) {
+	host, root, ok := strings.Cut(target, ":")
+	if !ok || host == "" || root == "" {
+		return nil, fmt.Errorf("invalid rsync target %q: expected [user@]host:/path", target)
+	}
+	if sshCommand == "" {
+		sshCommand = "ssh"
+	}
+	return &RsyncDestination{
+		name:   name,
+		host:   host,
+		root:   strings.TrimSuffix(root, "/"),
+		sshCmd: sshCommand,
+	}, nil
+}
+
+func (d *RsyncDestination) Name() string {
+	return d.name
+}
+
+func (d *RsyncDestination) Put(ctx context.Context, key string, data []byte) error {
+	// Stage the file under its key so --relative creates the remote directories;
+	// rsync writes to a temp name and renames, so readers never see partial files
+	stage, err := os.MkdirTemp("", "tmux-coder-rsync-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(stage)
+
+	local := filepath.Join(stage, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(local), DefaultDirMode); err != nil {
+		return err
+	}
+	if err := os.WriteFile(local, data, DefaultFileMode); err != nil {
+		return err
+	}
+
+	src := stage + "/./" + key
+	_, err = d.rsync(ctx, "-a", "--relative", src, d.host+":"+d.root+"/")
+	return err
+}
+
+func (d *RsyncDestination) Get(ctx context.Context, key string) ([]byte, error) {
+	stage, err := os.MkdirTemp("", "tmux-coder-rsync-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(stage)
+
+	local := filepath.Join(stage, "object")
+	if _, err := d.rsync(ctx, "-a", d.remote(key), local); err != nil {
+		if strings.Contains(err.Error(), "No such file") {
+			return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, key)
+		}
+		return nil, err
+	}
+	return os.ReadFile(local)
+}
+
+func (d *RsyncDestination) List(ctx context.Context, prefix string) ([]string, error) {
+	out, err := d.rsync(ctx, "--list-only", d.remote(prefix)+"/")
+	if err != nil {
+		if strings.Contains(err.Error(), "No such file") {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var keys []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// "-rw-r--r--   1,234 2024/01/02 03:04:05 name"; directories start with 'd'
+		fields := strings.Fields(line)
+		if len(fields) < 5 || !strings.HasPrefix(fields[0], "-") {
+			continue
+		}
+		name := strings.Join(fields[4:], " ")
+		if !strings.HasPrefix(name, ".") {
+			keys = append(keys, path.Join(prefix, name))
+		}
+	}
+	return keys, nil
+}
+
+func (d *RsyncDestination) Delete(ctx context.Context, key string) error {
+	args := append(strings.Fields(d.sshCmd)[1:], d.host, "rm", "-f", "--", shellquote.Quote(d.root+"/"+cleanKey(key)))
+	cmd := exec.CommandContext(ctx, strings.Fields(d.sshCmd)[0], args...)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("ssh rm failed: %v: %s", err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+func (d *RsyncDestination) remote(key string) string {
+	return d.host + ":" + d.root + "/" + cleanKey(key)
+}
+
+func (d *RsyncDestination) rsync(ctx context.Context, args ...string) ([]byte, error) {
+	args = append([]string{"-e", d.sshCmd}, args...)
+	cmd := exec.CommandContext(ctx, "rsync", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("rsync failed: %v: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return out, nil
+}
+
+// cleanKey strips any attempt to climb out of the destination root
+func cleanKey(key string) string {
+	return strings.TrimPrefix(path.Clean("/"+key), "/")
+}
@@ -0,0 +1,275 @@
+package persistence
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Destination copies backups to an S3 bucket or any S3-compatible store
+// (MinIO, Backblaze B2, Cloudflare R2). Credentials come from the standard
+// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN variables so
+// they never end up in a config file.
+type S3Destination struct {
+	name     string
+	bucket   string
+	prefix   string
+	region   string
+	endpoint string
+	client   *http.Client
+}
+
+// NewS3Destination creates an S3 destination. An empty endpoint means AWS;
+// requests always use path-style addressing so custom endpoints work unchanged.
+func NewS3Destination(name, bucket, prefix, region, endpoint string) (*S3Destination, error) {
+	if bucket == "" {
+		return nil, fmt.Errorf("s3 destination %q: bucket is required", name)
+	}
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	return &S3Destination{
+		name:     name,
+		bucket:   bucket,
+		prefix:   strings.Trim(prefix, "/"),
+		region:   region,
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		client:   &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+func (d *S3Destination) Name() string {
+	return d.name
+}
+
+func (d *S3Destination) Put(ctx context.Context, key string, data []byte) error {
+	resp, err := d.do(ctx, http.MethodPut, d.objectKey(key), nil, data)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *S3Destination) Get(ctx context.Context, key string) ([]byte, error) {
+	resp, err := d.do(ctx, http.MethodGet, d.objectKey(key), nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+func (d *S3Destination) List(ctx context.Context, prefix string) ([]string, error) {
+	var keys []string
+	token := ""
+	for {
+		// Keys are listed one level deep, like a directory listing
+		query := url.Values{"list-type": {"2"}, "prefix": {d.objectKey(prefix) + "/"}, "delimiter": {"/"}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := d.do(ctx, http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse list response: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			key := object.Key
+			if d.prefix != "" {
+				key = strings.TrimPrefix(key, d.prefix+"/")
+			}
+			keys = append(keys, key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (d *S3Destination) Delete(ctx context.Context, key string) error {
+	resp, err := d.do(ctx, http.MethodDelete, d.objectKey(key), nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (d *S3Destination) objectKey(key string) string {
+	key = cleanKey(key)
+	if d.prefix == "" {
+		return key
+	}
+	return d.prefix + "/" + key
+}
+
+// do sends a signed request and turns non-2xx responses into errors
+func (d *S3Destination) do(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	accessKey := os.Getenv("AWS_ACCESS_KEY_ID")
+	secretKey := os.Getenv("AWS_SECRET_ACCESS_KEY")
+	if accessKey == "" || secretKey == "" {
+		return nil, fmt.Errorf("s3 destination %q: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set", d.name)
+	}
+
+	u, err := url.Parse(d.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint %q: %w", d.endpoint, err)
+	}
+	u.Path = "/" + d.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if token := os.Getenv("AWS_SESSION_TOKEN"); token != "" {
+		req.Header.Set("X-Amz-Security-Token", token)
+	}
+	signV4(req, body, accessKey, secretKey, d.region, "s3", time.Now())
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if resp.StatusCode == http.StatusNotFound && key != "" {
+			return nil, fmt.Errorf("%w: %s", ErrRemoteNotFound, key)
+		}
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", method, u.Path, resp.Status, bytes.TrimSpace(detail))
+	}
+	return resp, nil
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, signing host and every
+// header already set on it
+func signV4(req *http.Request, body []byte, accessKey, secretKey, region, service string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	signingKey := hmacSHA256([]byte("AWS4"+secretKey), day)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query parameters sorted by key with RFC 3986 escaping,
+// which is what SigV4 signs; url.Values.Encode escapes spaces as '+'
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
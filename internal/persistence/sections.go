@@ -0,0 +1,365 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// A differential save splits the state into sections: the sessions, the
+// messages of each session, the input and the settings. Each section is kept
+// in a file of its own under <state>.sections, named by its checksum, and the
+// state file holds the rest of the state and lists the section files in its
+// metadata. A save writes only the sections that changed since the last one,
+// then the state file, whose rename still commits the save atomically. A
+// section file stays until neither the state file nor a backup lists it.
+
+// Sections of a differentially saved state
+const (
+	sectionSessions       = "sessions"
+	sectionInput          = "input"
+	sectionSettings       = "settings"
+	sectionMessagesPrefix = "messages/" // Followed by the session ID
+)
+
+// sectionKeys maps a section to the top-level state keys it holds
+var sectionKeys = map[string][]string{
+	sectionSessions: {"sessions", "current_session_id", "session_order", "session_locks"},
+	sectionInput:    {"input"},
+	sectionSettings: {"theme", "provider", "model", "agent", "agent_model", "model_policy"},
+}
+
+// SectionRef locates a section of a differentially saved state
+type SectionRef struct {
+	File     string `json:"file"` // Name in the sections directory
+	Checksum string `json:"checksum"`
+	Size     int64  `json:"size"`
+}
+
+// MessageRun is a run of consecutive messages of one session. The runs of a
+// differentially saved state restore the order of messages across sessions.
+type MessageRun struct {
+	SessionID string `json:"session_id"`
+	Count     int    `json:"count"`
+}
+
+// stateSections is a state split for a differential save
+type stateSections struct {
+	core        map[string]json.RawMessage
+	sections    map[string][]byte // Encoded section files by section name
+	messageRuns []MessageRun
+}
+
+// splitState encodes state, with its times in UTC, and splits it into sections
+func splitState(state *types.SharedApplicationState) (*stateSections, error) {
+	encoded, err := json.Marshal(timefmt.UTC(state))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	var core map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &core); err != nil {
+		return nil, fmt.Errorf("failed to split state: %w", err)
+	}
+
+	split := &stateSections{core: core, sections: make(map[string][]byte)}
+	for name, keys := range sectionKeys {
+		section := make(map[string]json.RawMessage, len(keys))
+		for _, key := range keys {
+			if value, ok := core[key]; ok {
+				section[key] = value
+				delete(core, key)
+			}
+		}
+		if split.sections[name], err = encodeSection(section); err != nil {
+			return nil, err
+		}
+	}
+
+	var messages []json.RawMessage
+	if raw, ok := core["messages"]; ok {
+		if err := json.Unmarshal(raw, &messages); err != nil {
+			return nil, fmt.Errorf("failed to split messages: %w", err)
+		}
+		delete(core, "messages")
+	}
+	bySession := make(map[string][]json.RawMessage)
+	for _, message := range messages {
+		var key struct {
+			SessionID string `json:"session_id"`
+		}
+		if err := json.Unmarshal(message, &key); err != nil {
+			return nil, fmt.Errorf("failed to split messages: %w", err)
+		}
+		bySession[key.SessionID] = append(bySession[key.SessionID], message)
+		if n := len(split.messageRuns); n > 0 && split.messageRuns[n-1].SessionID == key.SessionID {
+			split.messageRuns[n-1].Count++
+		} else {
+			split.messageRuns = append(split.messageRuns, MessageRun{SessionID: key.SessionID, Count: 1})
+		}
+	}
+	for sessionID, sessionMessages := range bySession {
+		list, err := json.Marshal(sessionMessages)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode messages of session %s: %w", sessionID, err)
+		}
+		if split.sections[sectionMessagesPrefix+sessionID], err = encodeSection(map[string]json.RawMessage{"messages": list}); err != nil {
+			return nil, err
+		}
+	}
+	return split, nil
+}
+
+func encodeSection(section map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.MarshalIndent(section, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode section: %w", err)
+	}
+	return append(data, '\n'), nil
+}
+
+// sectionFileName names a section's file after the section and its content
+func sectionFileName(name, checksum string) string {
+	safe := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, name)
+	return fmt.Sprintf("%s-%s.json", safe, strings.TrimPrefix(checksum, "sha256:")[:16])
+}
+
+func sectionChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeSections writes the sections whose content differs from the last
+// save's and returns references to every section
+func (fm *FileManager) writeSections(sections map[string][]byte) (map[string]SectionRef, error) {
+	if err := fm.ensureDir(fm.sectionsDir); err != nil {
+		return nil, fmt.Errorf("failed to create sections directory: %w", err)
+	}
+
+	fm.sectionMutex.Lock()
+	previous := fm.savedSections
+	fm.sectionMutex.Unlock()
+
+	refs := make(map[string]SectionRef, len(sections))
+	for name, data := range sections {
+		ref := SectionRef{Checksum: sectionChecksum(data), Size: int64(len(data))}
+		ref.File = sectionFileName(name, ref.Checksum)
+		refs[name] = ref
+
+		// Only sections that changed since the last save are written; one
+		// changed back to content a backup still lists is on disk already
+		if previous[name] == ref {
+			continue
+		}
+		path := filepath.Join(fm.sectionsDir, ref.File)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := fm.writeSectionFile(path, data); err != nil {
+			return nil, fmt.Errorf("failed to write section %s: %w", name, fm.diskFullFromWrite(err))
+		}
+	}
+	return refs, nil
+}
+
+// writeSectionFile writes one section through a temp file, like the state file
+func (fm *FileManager) writeSectionFile(path string, data []byte) error {
+	tempFile, err := fm.createTempFile()
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+	defer func() {
+		tempFile.Close()
+		os.Remove(tempPath)
+	}()
+
+	if err := fm.applyFileMode(tempPath); err != nil {
+		return err
+	}
+	if _, err := tempFile.Write(data); err != nil {
+		return err
+	}
+	if err := tempFile.Sync(); err != nil {
+		return err
+	}
+	if err := tempFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tempPath, path)
+}
+
+// writeSectionedStateToFile writes the changed sections of state and then the
+// state file listing them
+func (fm *FileManager) writeSectionedStateToFile(state *types.SharedApplicationState, file *os.File) (map[string]SectionRef, error) {
+	split, err := splitState(state)
+	if err != nil {
+		return nil, err
+	}
+	refs, err := fm.writeSections(split.sections)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.MarshalIndent(split.core, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode state: %w", err)
+	}
+	body = append(body, '\n')
+
+	metadata := StateMetadata{
+		Version:     sectionedStateFormat,
+		Timestamp:   fm.clock.Now().UTC(),
+		Checksum:    stateChecksum(body),
+		Sections:    refs,
+		MessageRuns: split.messageRuns,
+	}
+	encoder := json.NewEncoder(file)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(metadata); err != nil {
+		return nil, fmt.Errorf("failed to encode metadata: %w", err)
+	}
+	if _, err := file.Write(body); err != nil {
+		return nil, fmt.Errorf("failed to write state: %w", err)
+	}
+	return refs, nil
+}
+
+// mergeSections reads the sections a state file lists from dir and puts them
+// back into the rest of the state, body
+func mergeSections(path string, metadata StateMetadata, body []byte, dir string) ([]byte, error) {
+	if dir == "" {
+		return nil, &CorruptionError{Path: path, Reason: "state sections are not available"}
+	}
+	var core map[string]json.RawMessage
+	if err := json.Unmarshal(body, &core); err != nil {
+		return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("invalid state: %v", err)}
+	}
+
+	bySession := make(map[string][]json.RawMessage)
+	for name, ref := range metadata.Sections {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.Base(ref.File)))
+		if err != nil {
+			return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("section %s: %v", name, err)}
+		}
+		if sectionChecksum(data) != ref.Checksum {
+			return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("section %s: checksum mismatch", name)}
+		}
+		var section map[string]json.RawMessage
+		if err := json.Unmarshal(data, &section); err != nil {
+			return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("section %s: %v", name, err)}
+		}
+
+		if sessionID, ok := strings.CutPrefix(name, sectionMessagesPrefix); ok {
+			var messages []json.RawMessage
+			if err := json.Unmarshal(section["messages"], &messages); err != nil {
+				return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("section %s: %v", name, err)}
+			}
+			bySession[sessionID] = messages
+			continue
+		}
+		for key, value := range section {
+			core[key] = value
+		}
+	}
+
+	messages := make([]json.RawMessage, 0)
+	for _, run := range metadata.MessageRuns {
+		pending := bySession[run.SessionID]
+		if run.Count > len(pending) {
+			return nil, &CorruptionError{Path: path, Reason: fmt.Sprintf("messages of session %s are missing", run.SessionID)}
+		}
+		messages = append(messages, pending[:run.Count]...)
+		bySession[run.SessionID] = pending[run.Count:]
+	}
+	list, err := json.Marshal(messages)
+	if err != nil {
+		return nil, err
+	}
+	core["messages"] = list
+
+	return json.Marshal(core)
+}
+
+// sectionFiles returns the section files a state or backup file lists, or
+// nil for one saved whole
+func sectionFiles(path string) (map[string]bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var metadata StateMetadata
+	if err := json.NewDecoder(file).Decode(&metadata); err != nil {
+		return nil, &CorruptionError{Path: path, Reason: "invalid metadata"}
+	}
+	files := make(map[string]bool, len(metadata.Sections))
+	for _, ref := range metadata.Sections {
+		files[ref.File] = true
+	}
+	return files, nil
+}
+
+// pruneSections removes section files that neither the state file nor any
+// backup lists. Unreadable files keep everything, since what they list is unknown.
+// The caller holds the file lock.
+func (fm *FileManager) pruneSections() error {
+	entries := fm.globInfo(filepath.Join(fm.sectionsDir, "*.json"))
+	if len(entries) == 0 {
+		return nil
+	}
+
+	referenced := make(map[string]bool)
+	for _, path := range append([]string{fm.statePath}, fm.backupChain()...) {
+		files, err := sectionFiles(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("not pruning state sections: %w", err)
+		}
+		for file := range files {
+			referenced[file] = true
+		}
+	}
+
+	var errs []string
+	for _, entry := range entries {
+		if referenced[filepath.Base(entry.path)] {
+			continue
+		}
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return fmt.Errorf("failed to prune state sections: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// sectionsSize is the size of the sections of the last state saved or loaded
+func (fm *FileManager) sectionsSize() int64 {
+	fm.sectionMutex.Lock()
+	defer fm.sectionMutex.Unlock()
+	var size int64
+	for _, ref := range fm.savedSections {
+		size += ref.Size
+	}
+	return size
+}
@@ -0,0 +1,173 @@
+package persistence
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func newDifferentialFileManager(t *testing.T) *FileManager {
+	t.Helper()
+	config := DefaultFileManagerConfig(filepath.Join(t.TempDir(), "state.json"))
+	config.DifferentialSave = true
+	config.BackupRotation = 1
+	fm := NewFileManager(config)
+	if err := fm.Initialize(); err != nil {
+		t.Fatal(err)
+	}
+	return fm
+}
+
+func sectionFileNames(t *testing.T, fm *FileManager) []string {
+	t.Helper()
+	entries, err := os.ReadDir(fm.sectionsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestDifferentialSaveRoundTrip(t *testing.T) {
+	fm := newDifferentialFileManager(t)
+
+	// Messages of two sessions interleaved, to check their order survives
+	state := testutil.NewState().Sessions(2).Model("anthropic", "claude").
+		Conversation("s1", "hello", "hi").
+		Conversation("s2", "other").
+		Message(testutil.Message("s1-m3", "s1", "user", "back")).
+		Build()
+	state.Input.Buffer = "draft"
+
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := NewFileManager(DefaultFileManagerConfig(fm.statePath)).LoadStateAtomic()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want, _ := json.Marshal(state)
+	got, _ := json.Marshal(loaded)
+	if string(got) != string(want) {
+		t.Errorf("loaded state differs:\n got %s\nwant %s", got, want)
+	}
+	if names := sectionFileNames(t, fm); len(names) != 5 {
+		t.Errorf("section files = %v, want sessions, input, settings and two message sections", names)
+	}
+}
+
+func TestDifferentialSaveWritesChangedSections(t *testing.T) {
+	fm := newDifferentialFileManager(t)
+	state := testutil.NewState().Sessions(2).Conversation("s1", "hello").Conversation("s2", "other").Build()
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+	before := fm.savedSections
+
+	state.Input.Buffer = "typing"
+	state.Version.Version++
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+	after := fm.savedSections
+
+	for name, ref := range after {
+		changed := before[name] != ref
+		if changed != (name == sectionInput) {
+			t.Errorf("section %s changed = %v", name, changed)
+		}
+	}
+	if fm.GetStats().FileSize <= 0 {
+		t.Errorf("stats do not count the sections")
+	}
+
+	// With one backup kept, the first input section is gone after the next
+	// save rotates out the backup listing it
+	first := filepath.Join(fm.sectionsDir, before[sectionInput].File)
+	state.Input.Buffer = "typing more"
+	state.Version.Version++
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(first); !os.IsNotExist(err) {
+		t.Errorf("section %s listed by no file was kept", first)
+	}
+	if _, err := os.Stat(filepath.Join(fm.sectionsDir, after[sectionInput].File)); err != nil {
+		t.Errorf("section listed by the backup was removed: %v", err)
+	}
+}
+
+func TestDifferentialSaveFallsBackOnMissingSection(t *testing.T) {
+	fm := newDifferentialFileManager(t)
+	state := testutil.NewState().Sessions(1).Conversation("s1", "hello").Build()
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+	state.Messages = append(state.Messages, testutil.Message("s1-m2", "s1", "assistant", "hi"))
+	state.Version.Version++
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Remove(filepath.Join(fm.sectionsDir, fm.savedSections[sectionMessagesPrefix+"s1"].File)); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(fm.statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var corruption *CorruptionError
+	if _, _, err := decodeStateFile(fm.statePath, data, fm.sectionsDir); !errors.As(err, &corruption) {
+		t.Fatalf("decode with a missing section = %v, want a corruption error", err)
+	}
+
+	loaded, err := fm.LoadStateAtomic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Messages) != 1 || loaded.Version.Version != state.Version.Version-1 {
+		t.Errorf("loaded version %d with %d messages, want the backup", loaded.Version.Version, len(loaded.Messages))
+	}
+}
+
+func TestSwitchingSaveModes(t *testing.T) {
+	fm := newDifferentialFileManager(t)
+	state := testutil.NewState().Sessions(1).Conversation("s1", "hello").Build()
+	if err := fm.SaveStateAtomic(state); err != nil {
+		t.Fatal(err)
+	}
+
+	// A whole save over a differential one loads, and so does its backup
+	whole := NewFileManager(DefaultFileManagerConfig(fm.statePath))
+	loaded, err := whole.LoadStateAtomic()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded.Version.Version++
+	if err := whole.SaveStateAtomic(loaded); err != nil {
+		t.Fatal(err)
+	}
+	for _, load := range []func() (*types.SharedApplicationState, error){
+		whole.LoadStateAtomic,
+		func() (*types.SharedApplicationState, error) {
+			_, state, err := whole.loadBackupFile(whole.backupPath)
+			return state, err
+		},
+	} {
+		got, err := load()
+		if err != nil || len(got.Messages) != 1 {
+			t.Errorf("load = %v, %v; want the saved state", got, err)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package session
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// HostAuto as a host session means the tmux session the command runs in
+const HostAuto = "auto"
+
+// HostWindowOption is the tmux window option naming the opencode session
+// whose panels a window of someone else's tmux session holds
+const HostWindowOption = "@opencode_session"
+
+// HostedWindow is a window an orchestrator added to an existing tmux session
+type HostedWindow struct {
+	Host     string // tmux session holding the window
+	WindowID string // tmux window ID, e.g. @3
+}
+
+// ResolveHost returns the tmux session to add an opencode session's window
+// to: host itself, or for HostAuto the session the command runs in. It is
+// empty when the opencode session gets a tmux session of its own.
+func ResolveHost(host string) string {
+	host = strings.TrimSpace(host)
+	if host != HostAuto {
+		return host
+	}
+	current, err := GetCurrentSessionID()
+	if err != nil {
+		return ""
+	}
+	return current.Name
+}
+
+// FindHostedWindow returns the window holding sessionName's panels in another
+// tmux session, if there is one
+func FindHostedWindow(tmuxCommand, sessionName string) (HostedWindow, bool) {
+	format := fmt.Sprintf("#{session_name}\t#{window_id}\t#{%s}", HostWindowOption)
+	output, err := exec.Command(tmuxCommand, "list-windows", "-a", "-F", format).Output()
+	if err != nil {
+		return HostedWindow{}, false
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) == 3 && fields[2] == sessionName {
+			return HostedWindow{Host: fields[0], WindowID: fields[1]}, true
+		}
+	}
+	return HostedWindow{}, false
+}
+
+// MarkHostedWindow tags a window as holding sessionName's panels
+func MarkHostedWindow(tmuxCommand, windowID, sessionName string) error {
+	output, err := exec.Command(tmuxCommand, "set-option", "-w", "-t", windowID, HostWindowOption, sessionName).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to tag window %s: %w: %s", windowID, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
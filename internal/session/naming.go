@@ -0,0 +1,117 @@
+package session
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProjectOption is the tmux session option holding the project directory a
+// session was started for, which tells a restart from a name collision
+const ProjectOption = "@opencode_project"
+
+// maxNameCandidates bounds the names tried before giving up on a free one
+const maxNameCandidates = 100
+
+// NameVars are the values a session name template refers to
+type NameVars struct {
+	Dir    string // Project directory; {dir} is its base name
+	Branch string // Git branch of the project, empty outside a repository
+}
+
+// CollisionPolicy says what starting does when the session name is held by
+// another project's session
+type CollisionPolicy string
+
+const (
+	CollisionSuffix CollisionPolicy = "suffix" // Take the next free name
+	CollisionAttach CollisionPolicy = "attach" // Attach to the session holding the name
+	CollisionPrompt CollisionPolicy = "prompt" // Ask; suffix without a terminal
+)
+
+// ParseCollisionPolicy parses a collision policy, "suffix" when empty
+func ParseCollisionPolicy(value string) (CollisionPolicy, error) {
+	switch policy := CollisionPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return CollisionSuffix, nil
+	case CollisionSuffix, CollisionAttach, CollisionPrompt:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown collision policy %q (want suffix, attach or prompt)", value)
+	}
+}
+
+// ExpandName fills in a session name template: {dir} and {branch} from vars
+// and {n} with n. A template without {n} gets "-n" appended after the first
+// name. Characters tmux or the session's file names cannot hold become dashes.
+func ExpandName(template string, vars NameVars, n int) string {
+	dir := ""
+	if vars.Dir != "" {
+		dir = filepath.Base(vars.Dir)
+	}
+	name := strings.NewReplacer("{dir}", dir, "{branch}", vars.Branch, "{n}", strconv.Itoa(n)).Replace(template)
+	if n > 1 && !strings.Contains(template, "{n}") {
+		name = fmt.Sprintf("%s-%d", name, n)
+	}
+
+	name = strings.Map(func(r rune) rune {
+		switch {
+		case r == '.' || r == ':' || r == '/' || r == '\\':
+			return '-'
+		case r <= ' ' || r == 0x7f:
+			return '-'
+		}
+		return r
+	}, name)
+	for strings.Contains(name, "--") {
+		name = strings.ReplaceAll(name, "--", "-")
+	}
+	if name = strings.Trim(name, "-"); name == "" {
+		return "opencode"
+	}
+	return name
+}
+
+// ResolveName returns the first expansion of template that no other
+// project holds: one owner reports as free, or as started for vars.Dir. The
+// first expansion with an untagged holder counts as this project's, as
+// sessions from before tagging carry no project. collided reports whether a
+// name other than the first was taken.
+func ResolveName(template string, vars NameVars, owner func(name string) (project string, exists bool)) (name string, collided bool, err error) {
+	for n := 1; n <= maxNameCandidates; n++ {
+		name = ExpandName(template, vars, n)
+		project, exists := owner(name)
+		if !exists || project == "" || sameDir(project, vars.Dir) {
+			return name, n > 1, nil
+		}
+	}
+	return "", true, fmt.Errorf("no free session name for %q after %d tries", template, maxNameCandidates)
+}
+
+// SessionProject returns the project directory recorded on the tmux session
+// called name, and whether that session exists
+func SessionProject(tmuxCommand, name string) (project string, exists bool) {
+	if exec.Command(tmuxCommand, "has-session", "-t", "="+name).Run() != nil {
+		return "", false
+	}
+	output, err := exec.Command(tmuxCommand, "show-options", "-v", "-t", "="+name, ProjectOption).Output()
+	if err != nil {
+		return "", true
+	}
+	return strings.TrimSpace(string(output)), true
+}
+
+// MarkProject tags the tmux session called name as started for dir
+func MarkProject(tmuxCommand, name, dir string) error {
+	output, err := exec.Command(tmuxCommand, "set-option", "-t", name, ProjectOption, dir).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to tag session %s: %w: %s", name, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+func sameDir(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
@@ -0,0 +1,83 @@
+package session
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExpandName(t *testing.T) {
+	vars := NameVars{Dir: "/home/dev/web.app", Branch: "feature/login"}
+	tests := []struct {
+		template string
+		n        int
+		want     string
+	}{
+		{"opencode", 1, "opencode"},
+		{"opencode", 3, "opencode-3"},
+		{"{dir}", 1, "web-app"},
+		{"{dir}-{branch}", 1, "web-app-feature-login"},
+		{"oc{n}", 1, "oc1"},
+		{"oc{n}", 2, "oc2"},
+		{"{dir}:{branch}", 2, "web-app-feature-login-2"},
+		{"{branch}", 1, "feature-login"},
+	}
+	for _, tt := range tests {
+		if got := ExpandName(tt.template, vars, tt.n); got != tt.want {
+			t.Errorf("ExpandName(%q, %d) = %q, want %q", tt.template, tt.n, got, tt.want)
+		}
+	}
+
+	if got := ExpandName("{dir}-{branch}", NameVars{Dir: "/src/api"}, 1); got != "api" {
+		t.Errorf("ExpandName() outside a repository = %q, want api", got)
+	}
+	if got := ExpandName("{branch}", NameVars{}, 1); got != "opencode" {
+		t.Errorf("ExpandName() of nothing = %q, want opencode", got)
+	}
+}
+
+func TestResolveName(t *testing.T) {
+	vars := NameVars{Dir: "/src/web"}
+	sessions := map[string]string{
+		"web":   "/src/other/web",
+		"web-2": "/src/web",
+		"old":   "",
+	}
+	owner := func(name string) (string, bool) {
+		project, ok := sessions[name]
+		return project, ok
+	}
+
+	tests := []struct {
+		template     string
+		want         string
+		wantCollided bool
+	}{
+		{"{dir}", "web-2", true},    // Another project holds web; this one's session is web-2
+		{"api", "api", false},       // Free
+		{"old", "old", false},       // Untagged sessions count as this project's
+		{"{dir}-x", "web-x", false}, // Free
+	}
+	for _, tt := range tests {
+		name, collided, err := ResolveName(tt.template, vars, owner)
+		if err != nil || name != tt.want || collided != tt.wantCollided {
+			t.Errorf("ResolveName(%q) = %q, %v, %v; want %q, %v", tt.template, name, collided, err, tt.want, tt.wantCollided)
+		}
+	}
+
+	taken := func(string) (string, bool) { return "/elsewhere", true }
+	if _, _, err := ResolveName("busy", vars, taken); err == nil || !strings.Contains(err.Error(), "busy") {
+		t.Errorf("ResolveName() with every name taken: error = %v", err)
+	}
+}
+
+func TestParseCollisionPolicy(t *testing.T) {
+	if policy, err := ParseCollisionPolicy(""); err != nil || policy != CollisionSuffix {
+		t.Errorf("ParseCollisionPolicy(\"\") = %q, %v", policy, err)
+	}
+	if policy, err := ParseCollisionPolicy(" Prompt "); err != nil || policy != CollisionPrompt {
+		t.Errorf("ParseCollisionPolicy(Prompt) = %q, %v", policy, err)
+	}
+	if _, err := ParseCollisionPolicy("replace"); err == nil {
+		t.Error("ParseCollisionPolicy(replace) succeeded")
+	}
+}
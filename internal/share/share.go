@@ -0,0 +1,289 @@
+// Package share renders a session's transcript as a single self-contained
+// HTML page, for attaching to pull requests or pasting into issue trackers:
+// styles are inlined, code is highlighted ahead of time and nothing is
+// loaded from elsewhere when the page is opened.
+package share
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/state"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/types"
+
+	"github.com/sst/opencode-sdk-go"
+)
+
+// DefaultStyle is the chroma style code is highlighted with
+const DefaultStyle = "github"
+
+//go:embed page.html.tmpl
+var pageSource string
+
+var pageTemplate = template.Must(template.New("page").Parse(pageSource))
+
+// Options controls how a transcript is rendered
+type Options struct {
+	Title     string    // Heading of the page; the session title by default
+	Redact    bool      // Replace suspected secrets with a placeholder
+	Style     string    // Chroma style for code; DefaultStyle when empty
+	Generated time.Time // Shown as when the page was made; now when zero
+}
+
+// Result counts what went into a rendered page
+type Result struct {
+	Messages    int `json:"messages"`
+	CodeBlocks  int `json:"code_blocks"`
+	ToolOutputs int `json:"tool_outputs"`
+	Redacted    int `json:"redacted"` // Suspected secrets replaced
+}
+
+// Render writes the messages of session, with bodies already resolved, as
+// an HTML page. Notes of the orchestrator, such as terminal transcripts,
+// and the output of tools the assistant ran are collapsed.
+func Render(w io.Writer, session types.SessionInfo, messages []types.MessageInfo, opts Options) (Result, error) {
+	style := styles.Get(opts.Style)
+	if opts.Style == "" {
+		style = styles.Get(DefaultStyle)
+	}
+	formatter := chromahtml.New(chromahtml.WithClasses(true), chromahtml.TabWidth(4))
+	var css bytes.Buffer
+	if err := formatter.WriteCSS(&css, style); err != nil {
+		return Result{}, fmt.Errorf("failed to render code styles: %w", err)
+	}
+
+	r := &renderer{formatter: formatter, style: style}
+	if opts.Redact {
+		r.scanner = state.NewSecretScanner(state.SecretPolicyFlag)
+	}
+
+	page := pageData{
+		Title:     r.redact(opts.Title),
+		SessionID: session.ID,
+		Workspace: session.Workspace,
+		CodeCSS:   template.CSS(css.String()),
+		Redacting: opts.Redact,
+	}
+	if page.Title == "" {
+		page.Title = r.redact(session.Title)
+	}
+	if page.Title == "" {
+		page.Title = session.ID
+	}
+	generated := opts.Generated
+	if generated.IsZero() {
+		generated = time.Now()
+	}
+	page.Generated = timefmt.DateTime(generated)
+	if !session.CreatedAt.IsZero() {
+		page.Started = timefmt.DateTime(session.CreatedAt)
+	}
+
+	for _, msg := range messages {
+		view, err := r.message(msg)
+		if err != nil {
+			return r.result, err
+		}
+		page.Messages = append(page.Messages, view)
+	}
+	r.result.Messages = len(page.Messages)
+	page.Result = r.result
+
+	if err := pageTemplate.Execute(w, page); err != nil {
+		return r.result, fmt.Errorf("failed to render transcript: %w", err)
+	}
+	return r.result, nil
+}
+
+type renderer struct {
+	formatter *chromahtml.Formatter
+	style     *chroma.Style
+	scanner   *state.SecretScanner
+	result    Result
+}
+
+type pageData struct {
+	Title     string
+	SessionID string
+	Workspace string
+	Started   string
+	Generated string
+	CodeCSS   template.CSS
+	Redacting bool
+	Messages  []messageView
+	Result    Result
+}
+
+type messageView struct {
+	Role      string
+	Agent     string // Agent that answered, for replies
+	Time      string
+	Status    string
+	Collapsed bool   // Shown folded under Summary
+	Summary   string // First line of a collapsed message
+	Segments  []segment
+	Tools     []toolView
+}
+
+// segment is a run of prose or one code block of a message body
+type segment struct {
+	Text     string
+	Code     template.HTML // Highlighted code, trusted: chroma escapes the source
+	Language string
+	Path     string
+}
+
+type toolView struct {
+	Name   string
+	Title  string
+	Status string
+	Input  string
+	Output string
+}
+
+// redact replaces suspected secrets when redaction was asked for
+func (r *renderer) redact(text string) string {
+	if r.scanner == nil || text == "" {
+		return text
+	}
+	redacted, n := r.scanner.Redact(text)
+	r.result.Redacted += n
+	return redacted
+}
+
+func (r *renderer) message(msg types.MessageInfo) (messageView, error) {
+	view := messageView{Role: msg.Type, Agent: msg.Agent, Status: msg.Status}
+	if view.Role == "" {
+		view.Role = "system"
+	}
+	if !msg.Timestamp.IsZero() {
+		view.Time = timefmt.DateTime(msg.Timestamp)
+	}
+	if view.Status == "completed" {
+		view.Status = ""
+	}
+
+	content := r.redact(msg.Content)
+	if view.Role != "user" && view.Role != "assistant" {
+		view.Collapsed = true
+		view.Summary, _, _ = strings.Cut(strings.TrimSpace(content), "\n")
+		view.Segments = []segment{{Text: content}}
+	} else {
+		segments, err := r.segments(content)
+		if err != nil {
+			return view, err
+		}
+		view.Segments = segments
+	}
+
+	for _, tool := range toolParts(msg) {
+		var input string
+		if tool.State.Input != nil {
+			data, _ := json.MarshalIndent(tool.State.Input, "", "  ")
+			input = string(data)
+		}
+		output := tool.State.Output
+		if tool.State.Error != "" {
+			output = tool.State.Error
+		}
+		view.Tools = append(view.Tools, toolView{
+			Name:   tool.Tool,
+			Title:  r.redact(tool.State.Title),
+			Status: string(tool.State.Status),
+			Input:  r.redact(input),
+			Output: r.redact(output),
+		})
+	}
+	r.result.ToolOutputs += len(view.Tools)
+	return view, nil
+}
+
+// segments splits a body into prose and highlighted code blocks
+func (r *renderer) segments(body string) ([]segment, error) {
+	lines := strings.Split(body, "\n")
+	var segments []segment
+	addText := func(from, to int) {
+		if text := strings.Trim(strings.Join(lines[from:to], "\n"), "\n"); text != "" {
+			segments = append(segments, segment{Text: text})
+		}
+	}
+
+	cursor := 0
+	for _, block := range codeblocks.Extract(body) {
+		// The fence opens on the line before the code and closes on the line after
+		addText(cursor, block.StartLine-2)
+		code, err := block.Code(body)
+		if err != nil {
+			return nil, err
+		}
+		highlighted, err := r.highlight(code, block)
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{Code: highlighted, Language: block.Language, Path: block.Path})
+		r.result.CodeBlocks++
+		cursor = min(block.EndLine+1, len(lines))
+	}
+	addText(cursor, len(lines))
+	return segments, nil
+}
+
+func (r *renderer) highlight(code string, block types.CodeBlock) (template.HTML, error) {
+	lexer := lexers.Get(block.Language)
+	if lexer == nil && block.Path != "" {
+		lexer = lexers.Match(block.Path)
+	}
+	if lexer == nil {
+		lexer = lexers.Fallback
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, code)
+	if err != nil {
+		return "", fmt.Errorf("failed to highlight code block %d: %w", block.Index, err)
+	}
+	var out bytes.Buffer
+	if err := r.formatter.Format(&out, r.style, iterator); err != nil {
+		return "", fmt.Errorf("failed to highlight code block %d: %w", block.Index, err)
+	}
+	return template.HTML(out.String()), nil
+}
+
+// toolParts returns the tool calls recorded with a message: those of its
+// native opencode record when it has one, else those streamed in its parts
+func toolParts(msg types.MessageInfo) []opencode.ToolPart {
+	var tools []opencode.ToolPart
+	if len(msg.Native) > 0 {
+		var native struct {
+			Parts []opencode.Part `json:"parts"`
+		}
+		if json.Unmarshal(msg.Native, &native) == nil {
+			for _, part := range native.Parts {
+				if tool, ok := part.AsUnion().(opencode.ToolPart); ok {
+					tools = append(tools, tool)
+				}
+			}
+			return tools
+		}
+	}
+	for _, part := range msg.Parts {
+		switch tool := part.(type) {
+		case opencode.ToolPart:
+			tools = append(tools, tool)
+		case *opencode.ToolPart:
+			tools = append(tools, *tool)
+		}
+	}
+	return tools
+}
@@ -0,0 +1,11 @@
+// Package shellquote quotes strings for POSIX shells, for commands that tmux,
+// ssh or a pane hand to sh.
+package shellquote
+
+import "strings"
+
+// Quote returns s as a single-quoted sh word; embedded single quotes end the
+// quoting, are escaped, and reopen it
+func Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,21 @@
+package shellquote
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func TestQuoteRoundTripsThroughSh(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not available")
+	}
+	for _, s := range []string{"", "plain", "two words", "it's", `$HOME "quoted" \ back`, "a\nb", "';rm -rf /;'"} {
+		out, err := exec.Command("sh", "-c", "printf %s "+Quote(s)).Output()
+		if err != nil {
+			t.Fatalf("sh -c for %q: %v", s, err)
+		}
+		if string(out) != s {
+			t.Errorf("Quote(%q) came back as %q", s, out)
+		}
+	}
+}
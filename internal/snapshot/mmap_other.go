@@ -0,0 +1,15 @@
+//go:build !unix
+
+package snapshot
+
+import "os"
+
+func mapFile(file *os.File, size int) ([]byte, error) {
+	return nil, ErrUnsupported
+}
+
+func unmapFile(data []byte) {}
+
+func fileID(info os.FileInfo) uint64 {
+	return 0
+}
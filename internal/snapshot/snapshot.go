@@ -0,0 +1,327 @@
+// Package snapshot publishes read-only copies of the shared state in a memory-mapped
+// file, so panels that only render can read large states without an IPC round trip.
+package snapshot
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Header layout (little endian, HeaderSize bytes):
+//
+//	0  magic       [8]byte
+//	8  format      uint32
+//	12 checksum    uint32  CRC-32 (IEEE) of the body
+//	16 sequence    uint64  odd while a write is in progress
+//	24 version     int64   state version of the body
+//	32 length      uint64  body length in bytes
+//	40 written     int64   unix nanoseconds
+//	48 reserved
+const (
+	HeaderSize    = 64
+	FormatVersion = 1
+
+	magic        = "TMXSNAP\x00"
+	offSequence  = 16
+	growthStride = 64 << 10 // Capacity grows in steps so readers rarely need to remap
+	readAttempts = 5
+)
+
+var (
+	// ErrUnsupported is returned on platforms without mmap support
+	ErrUnsupported = errors.New("state snapshots are not supported on this platform")
+	// ErrNotReady is returned when no complete snapshot could be read
+	ErrNotReady = errors.New("state snapshot not ready")
+	// ErrFormat is returned when the file is not a snapshot this build understands
+	ErrFormat = errors.New("unrecognized state snapshot format")
+)
+
+// Header describes the snapshot currently in the file
+type Header struct {
+	Format       uint32    `json:"format"`
+	Checksum     uint32    `json:"checksum"`
+	Sequence     uint64    `json:"sequence"`
+	StateVersion int64     `json:"state_version"`
+	Length       uint64    `json:"length"`
+	Written      time.Time `json:"written"`
+}
+
+func encodeHeader(buf []byte, h Header) {
+	copy(buf[0:8], magic)
+	binary.LittleEndian.PutUint32(buf[8:], h.Format)
+	binary.LittleEndian.PutUint32(buf[12:], h.Checksum)
+	binary.LittleEndian.PutUint64(buf[16:], h.Sequence)
+	binary.LittleEndian.PutUint64(buf[24:], uint64(h.StateVersion))
+	binary.LittleEndian.PutUint64(buf[32:], h.Length)
+	binary.LittleEndian.PutUint64(buf[40:], uint64(h.Written.UnixNano()))
+}
+
+func decodeHeader(buf []byte) (Header, error) {
+	if len(buf) < HeaderSize || string(buf[0:8]) != magic {
+		return Header{}, ErrFormat
+	}
+	h := Header{
+		Format:       binary.LittleEndian.Uint32(buf[8:]),
+		Checksum:     binary.LittleEndian.Uint32(buf[12:]),
+		Sequence:     binary.LittleEndian.Uint64(buf[16:]),
+		StateVersion: int64(binary.LittleEndian.Uint64(buf[24:])),
+		Length:       binary.LittleEndian.Uint64(buf[32:]),
+		Written:      time.Unix(0, int64(binary.LittleEndian.Uint64(buf[40:]))),
+	}
+	if h.Format != FormatVersion {
+		return Header{}, fmt.Errorf("%w: format %d", ErrFormat, h.Format)
+	}
+	return h, nil
+}
+
+// Writer publishes snapshots. Only the orchestrator should hold one for a given path.
+type Writer struct {
+	path     string
+	file     *os.File
+	mutex    sync.Mutex
+	sequence uint64
+	capacity int64
+}
+
+// Create replaces any snapshot at path and opens it for writing. The old file is
+// unlinked rather than truncated so readers still mapping it never fault.
+func Create(path string, mode os.FileMode) (*Writer, error) {
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove old snapshot: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to set snapshot mode: %w", err)
+	}
+
+	writer := &Writer{path: path, file: file}
+	if err := writer.grow(HeaderSize); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// Sequence 0 tells readers nothing has been published yet
+	buf := make([]byte, HeaderSize)
+	encodeHeader(buf, Header{Format: FormatVersion, Written: time.Now()})
+	if _, err := file.WriteAt(buf, 0); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	return writer, nil
+}
+
+// Path returns the snapshot file path
+func (w *Writer) Path() string {
+	return w.path
+}
+
+// Write publishes state and returns the header of the new snapshot
+func (w *Writer) Write(state *types.SharedApplicationState) (Header, error) {
+	body, err := json.Marshal(state)
+	if err != nil {
+		return Header{}, fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return Header{}, os.ErrClosed
+	}
+
+	// Mark the write in progress before touching the body
+	var seq [8]byte
+	w.sequence++
+	binary.LittleEndian.PutUint64(seq[:], w.sequence)
+	if _, err := w.file.WriteAt(seq[:], offSequence); err != nil {
+		return Header{}, fmt.Errorf("failed to mark snapshot: %w", err)
+	}
+
+	if err := w.grow(int64(HeaderSize + len(body))); err != nil {
+		return Header{}, err
+	}
+	if _, err := w.file.WriteAt(body, HeaderSize); err != nil {
+		return Header{}, fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	w.sequence++
+	header := Header{
+		Format:       FormatVersion,
+		Checksum:     crc32.ChecksumIEEE(body),
+		Sequence:     w.sequence,
+		StateVersion: state.Version.Version,
+		Length:       uint64(len(body)),
+		Written:      time.Now(),
+	}
+	buf := make([]byte, HeaderSize)
+	encodeHeader(buf, header)
+	if _, err := w.file.WriteAt(buf, 0); err != nil {
+		return Header{}, fmt.Errorf("failed to write snapshot header: %w", err)
+	}
+	return header, nil
+}
+
+// grow extends the file to hold size bytes. It never shrinks, since truncating
+// below a reader's mapping would fault the reader.
+func (w *Writer) grow(size int64) error {
+	if size <= w.capacity {
+		return nil
+	}
+	capacity := (size/growthStride + 1) * growthStride
+	if err := w.file.Truncate(capacity); err != nil {
+		return fmt.Errorf("failed to grow snapshot: %w", err)
+	}
+	w.capacity = capacity
+	return nil
+}
+
+// Close stops publishing and removes the snapshot so readers fall back to IPC
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	os.Remove(w.path)
+	return err
+}
+
+// Reader maps a snapshot file read-only
+type Reader struct {
+	path   string
+	mutex  sync.Mutex
+	data   []byte
+	fileID uint64
+}
+
+// Open maps the snapshot at path
+func Open(path string) (*Reader, error) {
+	reader := &Reader{path: path}
+	if err := reader.remap(); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// remap maps the current file at path, replacing any previous mapping
+func (r *Reader) remap() error {
+	file, err := os.Open(r.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() < HeaderSize {
+		return ErrNotReady
+	}
+
+	data, err := mapFile(file, int(info.Size()))
+	if err != nil {
+		return err
+	}
+	r.unmap()
+	r.data = data
+	r.fileID = fileID(info)
+	return nil
+}
+
+// refresh remaps when the writer has replaced or outgrown the mapped file
+func (r *Reader) refresh(need uint64) error {
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if r.data == nil || fileID(info) != r.fileID || uint64(len(r.data)) < need {
+		return r.remap()
+	}
+	return nil
+}
+
+func (r *Reader) unmap() {
+	if r.data != nil {
+		unmapFile(r.data)
+		r.data = nil
+	}
+}
+
+// Header returns the header of the current snapshot without decoding the body
+func (r *Reader) Header() (Header, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if err := r.refresh(HeaderSize); err != nil {
+		return Header{}, err
+	}
+	return decodeHeader(r.data)
+}
+
+// Read returns a consistent copy of the published state
+func (r *Reader) Read() (*types.SharedApplicationState, Header, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	for attempt := 0; attempt < readAttempts; attempt++ {
+		if err := r.refresh(HeaderSize); err != nil {
+			return nil, Header{}, err
+		}
+		header, err := decodeHeader(r.data)
+		if err != nil {
+			return nil, Header{}, err
+		}
+		if header.Sequence == 0 || header.Sequence%2 == 1 {
+			time.Sleep(time.Millisecond)
+			continue
+		}
+		if err := r.refresh(HeaderSize + header.Length); err != nil {
+			return nil, Header{}, err
+		}
+		if uint64(len(r.data)) < HeaderSize+header.Length {
+			continue
+		}
+
+		body := make([]byte, header.Length)
+		copy(body, r.data[HeaderSize:HeaderSize+header.Length])
+
+		// The writer bumps the sequence before touching the body, so an unchanged
+		// sequence plus a matching checksum means the copy is consistent
+		if binary.LittleEndian.Uint64(r.data[offSequence:]) != header.Sequence ||
+			crc32.ChecksumIEEE(body) != header.Checksum {
+			continue
+		}
+
+		var state types.SharedApplicationState
+		if err := json.Unmarshal(body, &state); err != nil {
+			return nil, Header{}, fmt.Errorf("failed to decode snapshot: %w", err)
+		}
+		return &state, header, nil
+	}
+	return nil, Header{}, ErrNotReady
+}
+
+// Close unmaps the snapshot
+func (r *Reader) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.unmap()
+	return nil
+}
@@ -0,0 +1,92 @@
+package snapshot
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestWriterReaderRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	writer, err := Create(path, 0600)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	defer writer.Close()
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reader.Close()
+
+	if _, _, err := reader.Read(); !errors.Is(err, ErrNotReady) {
+		t.Fatalf("Read() before first write: err = %v, want ErrNotReady", err)
+	}
+
+	state := types.NewSharedApplicationState()
+	state.Version.Version = 7
+	state.Messages = append(state.Messages, types.MessageInfo{ID: "m1", Content: "hello"})
+	if _, err := writer.Write(state); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+
+	got, header, err := reader.Read()
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if header.StateVersion != 7 || header.Sequence != 2 {
+		t.Errorf("header = %+v, want version 7 and sequence 2", header)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Content != "hello" {
+		t.Errorf("Read() messages = %+v", got.Messages)
+	}
+
+	// Outgrow the initial capacity so the reader has to remap
+	state.Version.Version = 8
+	state.Messages[0].Content = strings.Repeat("x", 2*growthStride)
+	if _, err := writer.Write(state); err != nil {
+		t.Fatalf("Write() large state error = %v", err)
+	}
+	got, header, err = reader.Read()
+	if err != nil {
+		t.Fatalf("Read() after growth error = %v", err)
+	}
+	if header.StateVersion != 8 || len(got.Messages[0].Content) != 2*growthStride {
+		t.Errorf("Read() after growth returned version %d, content length %d", header.StateVersion, len(got.Messages[0].Content))
+	}
+}
+
+func TestReaderFollowsRecreatedSnapshot(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.snapshot")
+	first, err := Create(path, 0600)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	state := types.NewSharedApplicationState()
+	state.Version.Version = 3
+	first.Write(state)
+
+	reader, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer reader.Close()
+
+	// A restarted orchestrator unlinks and recreates the file
+	first.Close()
+	second, err := Create(path, 0600)
+	if err != nil {
+		t.Fatalf("Create() again error = %v", err)
+	}
+	defer second.Close()
+	state.Version.Version = 1
+	second.Write(state)
+
+	if header, err := reader.Header(); err != nil || header.StateVersion != 1 {
+		t.Errorf("Header() = %+v, %v; want the recreated snapshot", header, err)
+	}
+}
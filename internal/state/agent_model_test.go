@@ -0,0 +1,146 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestAgentModelMap(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	manager.eventBus.Subscribe("conn", "panel", "input", events)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+	current := func() (string, string, string) {
+		st := manager.GetState()
+		return st.Agent, st.Provider, st.Model
+	}
+
+	// Choosing a model sets the current agent's default
+	if err := apply(types.AgentChanged, types.AgentChangePayload{Agent: "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.ModelChanged, types.ModelChangePayload{Provider: "anthropic", Model: "large"}); err != nil {
+		t.Fatal(err)
+	}
+	// Setting another agent's default leaves the current model alone
+	if err := apply(types.ModelChanged, types.ModelChangePayload{Provider: "openai", Model: "small", Agent: "plan"}); err != nil {
+		t.Fatal(err)
+	}
+	if agent, provider, model := current(); agent != "build" || provider != "anthropic" || model != "large" {
+		t.Errorf("current = %s %s/%s, want build anthropic/large", agent, provider, model)
+	}
+	if got := manager.GetState().AgentModel; got["build"] != "anthropic/large" || got["plan"] != "openai/small" {
+		t.Errorf("agent models = %v", got)
+	}
+
+	// Switching agent selects its default and says so in the event
+	if err := apply(types.AgentChanged, types.AgentChangePayload{Agent: "plan"}); err != nil {
+		t.Fatal(err)
+	}
+	if agent, provider, model := current(); agent != "plan" || provider != "openai" || model != "small" {
+		t.Errorf("current = %s %s/%s, want plan openai/small", agent, provider, model)
+	}
+	for {
+		select {
+		case event := <-events:
+			if event.Type != types.EventAgentChanged {
+				continue
+			}
+			payload := event.Data.(types.AgentChangePayload)
+			if payload.Agent != "plan" {
+				continue
+			}
+			if payload.Provider != "openai" || payload.Model != "small" {
+				t.Errorf("agent changed event = %+v", payload)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no agent changed event")
+		}
+		break
+	}
+
+	// An agent without a default keeps the current model
+	if err := apply(types.AgentModelCleared, types.AgentModelClearPayload{Agent: "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.AgentModelCleared, types.AgentModelClearPayload{Agent: "build"}); err == nil {
+		t.Errorf("clearing a missing default accepted")
+	}
+	if err := apply(types.AgentChanged, types.AgentChangePayload{Agent: "build"}); err != nil {
+		t.Fatal(err)
+	}
+	if agent, provider, model := current(); agent != "build" || provider != "openai" || model != "small" {
+		t.Errorf("current = %s %s/%s, want build openai/small", agent, provider, model)
+	}
+}
+
+func TestAgentRoutesAndAttribution(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	if err := apply(types.AgentRoutesChanged, types.AgentRoutesPayload{Routes: map[string]string{"Reviewer": "review"}}); err == nil {
+		t.Errorf("route with an upper case mention accepted")
+	}
+	if err := apply(types.AgentRoutesChanged, types.AgentRoutesPayload{Routes: map[string]string{"reviewer": "review"}}); err != nil {
+		t.Fatal(err)
+	}
+	routes := manager.GetState().GetAgentRoutes()
+	if routes["reviewer"] != "review" {
+		t.Errorf("agent routes = %v", routes)
+	}
+	routes["reviewer"] = "changed"
+	if manager.GetState().Clone().AgentRoutes["reviewer"] != "review" {
+		t.Errorf("routes returned are shared with state")
+	}
+
+	// A reply is labelled with the agent that answered
+	manager.AddMessage(types.MessageInfo{ID: "a1", SessionID: "s1", Type: "assistant", Status: "pending"}, "test")
+	if err := manager.AttributeMessage("a1", "review", "sse"); err != nil {
+		t.Fatal(err)
+	}
+	if msg, _ := manager.GetState().GetMessageByID("a1"); msg.Agent != "review" {
+		t.Errorf("message agent = %q, want review", msg.Agent)
+	}
+	if err := manager.AttributeMessage("missing", "review", "sse"); err == nil {
+		t.Errorf("attributed a missing message")
+	}
+	for {
+		select {
+		case event := <-events:
+			if event.Type != types.EventMessageAttributed {
+				continue
+			}
+			if payload := event.Data.(types.MessageAttributionPayload); payload.MessageID != "a1" || payload.Agent != "review" {
+				t.Errorf("message attributed event = %+v", payload)
+			}
+			if event.Topic != "message.a1.attributed" {
+				t.Errorf("event topic = %s", event.Topic)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no message attributed event")
+		}
+		break
+	}
+}
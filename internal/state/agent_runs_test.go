@@ -0,0 +1,256 @@
+package state
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestAgentRunLifecycle(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	first := types.NewAgentRun("ses_a", "input")
+	second := types.NewAgentRun("ses_b", "orchestrator")
+	second.ID = first.ID + "_b"
+	for _, run := range []types.AgentRun{first, second} {
+		if err := apply(types.RunStarted, types.RunStartedPayload{Run: run}); err != nil {
+			t.Fatalf("start %s error = %v", run.ID, err)
+		}
+	}
+	if err := apply(types.RunStarted, types.RunStartedPayload{Run: first}); err == nil {
+		t.Errorf("duplicate run accepted")
+	}
+	if got := manager.GetState().GetActiveRuns(""); len(got) != 2 {
+		t.Fatalf("active runs = %d, want 2", len(got))
+	}
+	if got := manager.GetState().GetActiveRuns("ses_b"); len(got) != 1 || got[0].ID != second.ID {
+		t.Fatalf("active runs in ses_b = %+v", got)
+	}
+
+	// The parent is the prompt the reply follows in its session
+	for _, msg := range []types.MessageInfo{
+		{ID: "msg_0", SessionID: "ses_a", Type: "user", Content: "split the parser"},
+		{ID: "msg_x", SessionID: "ses_b", Type: "user", Content: "other session"},
+		{ID: "msg_1", SessionID: "ses_a", Type: "assistant", Content: "done"},
+	} {
+		if err := manager.AddMessage(msg, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := apply(types.RunFinished, types.RunFinishedPayload{RunID: first.ID, MessageID: "msg_1", FinishedAt: time.Now()}); err != nil {
+		t.Fatalf("finish error = %v", err)
+	}
+	if run, _ := manager.GetState().GetAgentRun(first.ID); run.Status != types.AgentRunCompleted || run.MessageID != "msg_1" || run.ParentMessageID != "msg_0" {
+		t.Errorf("finished run = %+v", run)
+	}
+
+	if err := apply(types.CancelRun, types.CancelRunPayload{RunID: first.ID}); err == nil {
+		t.Errorf("cancelling a finished run accepted")
+	}
+	if err := apply(types.CancelRun, types.CancelRunPayload{RunID: second.ID, Reason: "user"}); err != nil {
+		t.Fatalf("cancel error = %v", err)
+	}
+	// The owner's late result does not overwrite the cancellation
+	if err := apply(types.RunFinished, types.RunFinishedPayload{RunID: second.ID, Error: "context canceled"}); err == nil {
+		t.Errorf("finishing a cancelled run accepted")
+	}
+	if run, _ := manager.GetState().GetAgentRun(second.ID); run.Status != types.AgentRunCancelled || run.Error != "user" {
+		t.Errorf("cancelled run = %+v", run)
+	}
+	if got := manager.GetState().GetActiveRuns(""); len(got) != 0 {
+		t.Errorf("active runs after finishing = %+v", got)
+	}
+}
+
+func TestCancelRunByMessage(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+	nextCancelled := func() types.RunCancelledPayload {
+		t.Helper()
+		for {
+			select {
+			case event := <-events:
+				if event.Type == types.EventRunCancelled {
+					return event.Data.(types.RunCancelledPayload)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no run cancelled event")
+			}
+		}
+	}
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	run := types.NewAgentRun("ses_a", "input")
+	if err := apply(types.RunStarted, types.RunStartedPayload{Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	for _, msg := range []types.MessageInfo{
+		{ID: "msg_0", SessionID: "ses_a", Type: "user", Status: "completed"},
+		{ID: "msg_1", SessionID: "ses_a", Type: "assistant", Status: "pending"},
+		{ID: "msg_2", SessionID: "ses_b", Type: "assistant", Status: "pending"},
+	} {
+		if err := manager.AddMessage(msg, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := apply(types.CancelRun, types.CancelRunPayload{MessageID: "msg_missing"}); err == nil {
+		t.Errorf("cancel by unknown message accepted")
+	}
+	if err := apply(types.CancelRun, types.CancelRunPayload{MessageID: "msg_1", Reason: "user"}); err != nil {
+		t.Fatalf("cancel by message error = %v", err)
+	}
+	if got, _ := manager.GetState().GetAgentRun(run.ID); got.Status != types.AgentRunCancelled {
+		t.Errorf("run status = %s, want cancelled", got.Status)
+	}
+	status := func(id string) string {
+		for _, msg := range manager.GetState().Messages {
+			if msg.ID == id {
+				return msg.Status
+			}
+		}
+		return ""
+	}
+	if got := status("msg_1"); got != "cancelled" {
+		t.Errorf("reply status = %s, want cancelled", got)
+	}
+	if got := status("msg_2"); got != "pending" {
+		t.Errorf("reply in another session status = %s, want pending", got)
+	}
+
+	// The server finishing the aborted reply does not undo the cancellation
+	if err := manager.UpdateMessage("msg_1", "partial", "completed", "sse"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status("msg_1"); got != "cancelled" {
+		t.Errorf("reply status after server update = %s, want cancelled", got)
+	}
+
+	// A reply generated outside any tracked run can still be stopped
+	if err := apply(types.CancelRun, types.CancelRunPayload{MessageID: "msg_2"}); err != nil {
+		t.Fatalf("cancel untracked reply error = %v", err)
+	}
+	if err := apply(types.CancelRun, types.CancelRunPayload{MessageID: "msg_2"}); err == nil {
+		t.Errorf("cancelling an idle session accepted")
+	}
+
+	if got := nextCancelled(); got.RunID != run.ID || got.CancelToken != run.CancelToken || len(got.MessageIDs) != 1 || got.MessageIDs[0] != "msg_1" {
+		t.Errorf("first event data = %+v", got)
+	}
+	if got := nextCancelled(); got.RunID != "" || got.SessionID != "ses_b" {
+		t.Errorf("second event data = %+v", got)
+	}
+}
+
+func TestAgentRunsTrimFinishedFirst(t *testing.T) {
+	manager := newTestSyncManager(t)
+	start := func(id string) {
+		run := types.NewAgentRun("ses", "test")
+		run.ID = id
+		if err := manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            types.RunStarted,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         types.RunStartedPayload{Run: run},
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The first run stays in flight while the rest finish
+	start("run_keep")
+	for i := 0; i < types.MaxAgentRuns; i++ {
+		id := fmt.Sprintf("run_%d", i)
+		start(id)
+		if err := manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            types.RunFinished,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         types.RunFinishedPayload{RunID: id},
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	runs := manager.GetState().Runs
+	if len(runs) != types.MaxAgentRuns {
+		t.Fatalf("kept %d runs, want %d", len(runs), types.MaxAgentRuns)
+	}
+	if runs[0].ID != "run_keep" {
+		t.Errorf("oldest kept run = %s, want the one in flight", runs[0].ID)
+	}
+	if _, ok := manager.GetState().GetAgentRun("run_0"); ok {
+		t.Errorf("oldest finished run was kept")
+	}
+}
+
+func TestRunAttemptsAndModelPolicy(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	backup := types.ModelRef{ProviderID: "openai", ModelID: "medium"}
+	if err := apply(types.ModelPolicyChanged, types.ModelPolicyPayload{Policy: &types.ModelPolicy{MaxRetries: -1}}); err == nil {
+		t.Errorf("negative retries accepted")
+	}
+	if err := apply(types.ModelPolicyChanged, types.ModelPolicyPayload{Policy: &types.ModelPolicy{MaxRetries: 1, Fallbacks: []types.ModelRef{backup}}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetModelPolicy(); got.MaxRetries != 1 || len(got.Fallbacks) != 1 || got.Fallbacks[0] != backup {
+		t.Errorf("model policy = %+v", got)
+	}
+
+	run := types.NewAgentRun("ses_a", "input")
+	if err := apply(types.RunStarted, types.RunStartedPayload{Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	attempt := func(number int, outcome string) types.RunAttemptedPayload {
+		return types.RunAttemptedPayload{RunID: run.ID, Attempt: types.RunAttempt{Number: number, Outcome: outcome, Reason: "rate_limit"}}
+	}
+	if err := apply(types.RunAttempted, attempt(2, types.AttemptRetry)); err == nil {
+		t.Errorf("attempt out of order accepted")
+	}
+	for i, outcome := range []string{types.AttemptRetry, types.AttemptFallback, types.AttemptSucceeded} {
+		if err := apply(types.RunAttempted, attempt(i+1, outcome)); err != nil {
+			t.Fatalf("attempt %d error = %v", i+1, err)
+		}
+	}
+	got, _ := manager.GetState().GetAgentRun(run.ID)
+	if len(got.Attempts) != 3 || got.Attempts[2].Outcome != types.AttemptSucceeded {
+		t.Errorf("attempts = %+v", got.Attempts)
+	}
+}
@@ -0,0 +1,18 @@
+package state
+
+import (
+	"github.com/opencode/tmux_coder/internal/analytics"
+)
+
+// QueryAnalytics summarizes activity per day from the journal. Only retained
+// history is counted, so the report starts no earlier than the oldest segment.
+func (manager *PanelSyncManager) QueryAnalytics(query analytics.Query) (*analytics.Report, error) {
+	manager.syncMutex.RLock()
+	j := manager.journal
+	manager.syncMutex.RUnlock()
+
+	if j == nil {
+		return nil, errHistoryDisabled
+	}
+	return analytics.Aggregate(j, query)
+}
@@ -0,0 +1,53 @@
+package state
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/analytics"
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestQueryAnalyticsReadsJournal(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if _, err := manager.QueryAnalytics(analytics.Query{}); !errors.Is(err, errHistoryDisabled) {
+		t.Errorf("QueryAnalytics() error = %v, want errHistoryDisabled", err)
+	}
+
+	j, err := journal.Open(journal.DefaultConfig(filepath.Join(t.TempDir(), "journal")))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer j.Close()
+	manager.SetJournal(j)
+
+	for _, session := range []string{"s1", "s2"} {
+		if err := manager.AddSession(types.SessionInfo{ID: session, CreatedAt: time.Now()}, "test"); err != nil {
+			t.Fatalf("AddSession() error = %v", err)
+		}
+	}
+	for i, msg := range []types.MessageInfo{
+		{ID: "m1", SessionID: "s1", Type: "user", Content: "hi"},
+		{ID: "m2", SessionID: "s1", Type: "assistant", Content: "hello"},
+		{ID: "m3", SessionID: "s2", Type: "user", Content: "again"},
+	} {
+		msg.Timestamp = time.Now().Add(time.Duration(i) * time.Millisecond)
+		if err := manager.AddMessage(msg, "test"); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+
+	report, err := manager.QueryAnalytics(analytics.Query{SessionID: "s1"})
+	if err != nil {
+		t.Fatalf("QueryAnalytics() error = %v", err)
+	}
+	if total := report.Total; total.UserMessages != 1 || total.AssistantMessages != 1 || total.Sessions != 1 {
+		t.Errorf("s1 totals = %+v, want one message each way in one session", total)
+	}
+	if len(report.Days) != 1 || report.Days[0].Date != time.Now().Format("2006-01-02") {
+		t.Errorf("Days = %+v, want only today", report.Days)
+	}
+}
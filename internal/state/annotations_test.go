@@ -0,0 +1,164 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func newTestSyncManager(t *testing.T) *PanelSyncManager {
+	t.Helper()
+
+	repository := persistence.NewMemoryRepository(persistence.MemoryOptions{})
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(100), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Stop() })
+	return manager
+}
+
+func TestAnnotationLifecycle(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "review", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Type: "assistant", Content: "hello"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.AddAnnotation(types.MessageAnnotation{MessageID: "m1", Kind: types.AnnotationRating, Rating: 1}, "test"); err != nil {
+		t.Fatalf("AddAnnotation() error = %v", err)
+	}
+
+	annotations := manager.GetState().GetAnnotations("m1")
+	if len(annotations) != 1 {
+		t.Fatalf("expected 1 annotation, got %d", len(annotations))
+	}
+	if annotations[0].SessionID != "s1" || annotations[0].Author != "test" || annotations[0].ID == "" {
+		t.Errorf("annotation defaults not applied: %+v", annotations[0])
+	}
+
+	export, err := manager.ExportSession("s1")
+	if err != nil {
+		t.Fatalf("ExportSession() error = %v", err)
+	}
+	if len(export.Messages) != 1 || len(export.Annotations) != 1 {
+		t.Errorf("export = %d messages, %d annotations; want 1, 1", len(export.Messages), len(export.Annotations))
+	}
+
+	rating := -1
+	if err := manager.UpdateAnnotation(annotations[0].ID, "", &rating, nil, "test"); err != nil {
+		t.Fatalf("UpdateAnnotation() error = %v", err)
+	}
+	if got := manager.GetState().GetAnnotations("m1")[0].Rating; got != -1 {
+		t.Errorf("rating = %d, want -1", got)
+	}
+
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.MessageDeleted,
+		ExpectedVersion: manager.GetState().GetCurrentVersion(),
+		Payload:         types.MessageDeletePayload{MessageID: "m1"},
+		SourcePanel:     "test",
+		Timestamp:       time.Now(),
+	}
+	if err := manager.UpdateWithVersionCheck(update); err != nil {
+		t.Fatalf("delete message error = %v", err)
+	}
+	if got := len(manager.GetState().Annotations); got != 0 {
+		t.Errorf("annotations after message delete = %d, want 0", got)
+	}
+}
+
+func TestAnnotationUpdateFields(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "review", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Type: "assistant", Content: "hello"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.AddAnnotation(types.MessageAnnotation{MessageID: "m1", Kind: types.AnnotationTodo, Content: "check", Rating: 1}, "test"); err != nil {
+		t.Fatalf("AddAnnotation() error = %v", err)
+	}
+	id := manager.GetState().GetAnnotations("m1")[0].ID
+	get := func() types.MessageAnnotation {
+		return manager.GetState().GetAnnotations("m1")[0]
+	}
+	done, notDone, zero := true, false, 0
+
+	if err := manager.UpdateAnnotation(id, "", nil, &done, "test"); err != nil {
+		t.Fatalf("UpdateAnnotation(done) error = %v", err)
+	}
+	if got := get(); !got.Done || got.Rating != 1 || got.Content != "check" {
+		t.Errorf("after marking done: %+v, want done with rating and content kept", got)
+	}
+
+	// Omitted fields stay as they are
+	if err := manager.UpdateAnnotation(id, "checked", nil, nil, "test"); err != nil {
+		t.Fatalf("UpdateAnnotation(content) error = %v", err)
+	}
+	if got := get(); !got.Done || got.Rating != 1 || got.Content != "checked" {
+		t.Errorf("after editing content: %+v, want done and rating kept", got)
+	}
+
+	// A zero rating and a false flag are set, not ignored
+	if err := manager.UpdateAnnotation(id, "", &zero, &notDone, "test"); err != nil {
+		t.Fatalf("UpdateAnnotation(clear) error = %v", err)
+	}
+	if got := get(); got.Done || got.Rating != 0 {
+		t.Errorf("after clearing: %+v, want rating 0 and not done", got)
+	}
+
+	if err := manager.UpdateAnnotation("missing", "text", nil, nil, "test"); err == nil {
+		t.Error("updating an unknown annotation succeeded")
+	}
+}
+
+func TestAnnotationAddValidation(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "review", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Type: "assistant", Content: "hello"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.AddAnnotation(types.MessageAnnotation{ID: "a1", MessageID: "m1", Kind: types.AnnotationNote, Content: "first"}, "test"); err != nil {
+		t.Fatalf("AddAnnotation() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		annotation types.MessageAnnotation
+	}{
+		{"unknown message", types.MessageAnnotation{MessageID: "missing", Kind: types.AnnotationNote}},
+		{"duplicate id", types.MessageAnnotation{ID: "a1", MessageID: "m1", Kind: types.AnnotationNote, Content: "second"}},
+		{"empty kind", types.MessageAnnotation{MessageID: "m1", Content: "note"}},
+		{"unknown kind", types.MessageAnnotation{MessageID: "m1", Kind: "flag"}},
+		{"rating without a rating", types.MessageAnnotation{MessageID: "m1", Kind: types.AnnotationRating}},
+		{"rating out of range", types.MessageAnnotation{MessageID: "m1", Kind: types.AnnotationRating, Rating: 5}},
+	}
+	for _, tt := range tests {
+		if err := manager.AddAnnotation(tt.annotation, "test"); err == nil {
+			t.Errorf("%s: AddAnnotation() succeeded", tt.name)
+		}
+	}
+	annotations := manager.GetState().Annotations
+	if len(annotations) != 1 || annotations[0].Content != "first" {
+		t.Errorf("annotations = %+v, want only the first note", annotations)
+	}
+
+	if err := manager.UpdateAnnotation("a1", "", new(int), nil, "test"); err != nil {
+		t.Errorf("clearing the rating of a note failed: %v", err)
+	}
+	bad := 2
+	if err := manager.UpdateAnnotation("a1", "", &bad, nil, "test"); err == nil {
+		t.Error("UpdateAnnotation() accepted a rating of 2")
+	}
+}
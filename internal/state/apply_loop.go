@@ -0,0 +1,160 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrVersionConflict is returned when a version-checked update was built against a stale version
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrConcurrentUpdate is a version conflict where vector clocks show the writer
+// had not seen updates applied by another writer
+var ErrConcurrentUpdate = fmt.Errorf("%w: concurrent update", ErrVersionConflict)
+
+// ErrSyncManagerStopped is returned for updates and saves submitted after Stop
+var ErrSyncManagerStopped = errors.New("sync manager is stopped")
+
+// applyRequest is an update waiting for the apply loop
+type applyRequest struct {
+	update types.StateUpdate
+	strict bool // Reject on version mismatch instead of applying on top of the current state
+	reply  chan error
+}
+
+// applyLoop is the single writer for application state. Updates are applied in
+// submission order, so callers never race each other for a version; those that
+// queue up behind one another are applied in batches, see collectBatch.
+func (manager *PanelSyncManager) applyLoop() {
+	queue := manager.currentApplyQueue()
+	for {
+		select {
+		case <-manager.ctx.Done():
+			return
+		case request, ok := <-queue:
+			if !ok {
+				// Resized: the old queue is drained, continue with its replacement
+				queue = manager.currentApplyQueue()
+				continue
+			}
+			var batch []applyRequest
+			batch, queue = manager.collectBatch([]applyRequest{request}, queue)
+			if len(batch) == 1 {
+				request.reply <- manager.applyRecovered(request)
+				continue
+			}
+			manager.applyBatchRecovered(batch)
+		}
+	}
+}
+
+// processApplyRequest runs one queued update under the state lock
+func (manager *PanelSyncManager) processApplyRequest(request applyRequest) error {
+	// Waiting for readers to release the lock counts: panels wait just the same
+	done := manager.watchSlow(SlowOperation{
+		Kind:        SlowKindUpdate,
+		UpdateType:  request.update.Type,
+		UpdateID:    request.update.ID,
+		SourcePanel: request.update.SourcePanel,
+	}, manager.GetConfig().SlowUpdate)
+	defer done()
+
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+
+	// A retried delivery gets the original outcome; its version is stale by now
+	if previous, ok := manager.dedupe.lookup(request.update.ID, manager.now()); ok {
+		manager.metrics.RecordDuplicate()
+		log.Printf("Dropping duplicate update %s (%s) from %s", request.update.ID, request.update.Type, request.update.SourcePanel)
+		return previous.err
+	}
+
+	// Conflicts are not recorded: the resolver retries them under the same ID
+	if request.strict {
+		span := manager.tracer.Start(request.update.TraceParent, "state.resolve")
+		span.SetAttr("update.expected_version", request.update.ExpectedVersion)
+		span.SetAttr("state.version", manager.state.Version.Version)
+		err := manager.checkVersionLocked(request.update)
+		span.SetError(err)
+		span.End()
+		if err != nil {
+			return err
+		}
+	}
+
+	span := manager.tracer.Start(request.update.TraceParent, "state.apply")
+	span.SetAttr("update.id", request.update.ID)
+	span.SetAttr("update.type", string(request.update.Type))
+	span.SetAttr("update.source", request.update.SourcePanel)
+	update := request.update
+	update.TraceParent = span.TraceParent()
+	err := manager.applyUpdateLocked(update)
+	span.SetError(err)
+	span.SetAttr("state.version", manager.state.Version.Version)
+	span.End()
+	manager.dedupe.record(request.update.ID, appliedUpdate{appliedAt: manager.now(), err: err})
+	return err
+}
+
+// checkVersionLocked detects conflicts, using vector clocks when both sides carry one
+func (manager *PanelSyncManager) checkVersionLocked(update types.StateUpdate) error {
+	if manager.clockNode != "" && update.Clock != nil {
+		// The writer must have seen everything the state has; its own entry is ahead by one
+		if relation := update.Clock.Compare(manager.state.Version.Clock); relation != types.ClockAfter {
+			return fmt.Errorf("%w: update clock is %s state clock", ErrConcurrentUpdate, relation)
+		}
+		return nil
+	}
+
+	if manager.state.Version.Version != update.ExpectedVersion {
+		return fmt.Errorf("%w: expected %d, current %d",
+			ErrVersionConflict, update.ExpectedVersion, manager.state.Version.Version)
+	}
+	return nil
+}
+
+// advanceClockLocked folds an applied update into the state's vector clock.
+// Remote writers bring their own increment; local updates tick this node.
+func (manager *PanelSyncManager) advanceClockLocked(update types.StateUpdate) {
+	if manager.clockNode == "" {
+		return
+	}
+	if update.Clock != nil {
+		manager.state.Version.Clock = manager.state.Version.Clock.Merge(update.Clock)
+		return
+	}
+	manager.state.Version.Clock = manager.state.Version.Clock.Increment(manager.clockNode)
+}
+
+// submitUpdate enqueues an update and waits for the apply loop to process it.
+// Non-strict updates are applied on top of whatever state precedes them in the queue.
+func (manager *PanelSyncManager) submitUpdate(update types.StateUpdate, strict bool) error {
+	request := applyRequest{update: update, strict: strict, reply: make(chan error, 1)}
+
+	// Held across the send so a resize never closes the queue under us
+	manager.applyMutex.RLock()
+	select {
+	case manager.applyQueue <- request:
+	case <-manager.ctx.Done():
+		manager.applyMutex.RUnlock()
+		return ErrSyncManagerStopped
+	}
+	manager.applyMutex.RUnlock()
+
+	select {
+	case err := <-request.reply:
+		return err
+	case <-manager.ctx.Done():
+		return ErrSyncManagerStopped
+	}
+}
+
+// currentVersion reads the state version under the lock the apply loop writes under
+func (manager *PanelSyncManager) currentVersion() int64 {
+	manager.syncMutex.RLock()
+	defer manager.syncMutex.RUnlock()
+	return manager.state.Version.Version
+}
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestApplyLoopOrdersConcurrentUpdates(t *testing.T) {
+	manager := newTestSyncManager(t)
+	startVersion := manager.GetState().GetCurrentVersion()
+
+	const writers = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			msg := types.MessageInfo{ID: fmt.Sprintf("m%d", i), SessionID: "s1", Content: "hi"}
+			errs <- manager.AddMessage(msg, fmt.Sprintf("panel-%d", i%3))
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("AddMessage() error = %v", err)
+		}
+	}
+
+	state := manager.GetState()
+	if got := len(state.Messages); got != writers {
+		t.Errorf("expected %d messages, got %d", writers, got)
+	}
+	// Updates applied together in a batch share one version
+	metrics := manager.GetMetrics()
+	want := int64(writers) - metrics.BatchedUpdates + metrics.Batches
+	if got := state.GetCurrentVersion() - startVersion; got != want {
+		t.Errorf("expected version to advance by %d, advanced by %d", want, got)
+	}
+	if conflicts := manager.GetConflictStatistics().ConflictCount; conflicts != 0 {
+		t.Errorf("in-process updates should not conflict, got %d conflicts", conflicts)
+	}
+}
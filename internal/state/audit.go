@@ -0,0 +1,85 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// errAuditDisabled is returned by QueryAudit when no audit log is attached
+var errAuditDisabled = errors.New("audit log is not enabled")
+
+// auditTargetKeys are the payload fields that identify what an update touched, in priority order
+var auditTargetKeys = []string{"annotation_id", "message_id", "session_id"}
+
+// SetAuditLog attaches an audit log that records every applied update; nil disables auditing
+func (manager *PanelSyncManager) SetAuditLog(auditLog *audit.Log) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.auditLog = auditLog
+}
+
+// QueryAudit returns audit entries matching filter
+func (manager *PanelSyncManager) QueryAudit(filter audit.Filter) ([]audit.Entry, error) {
+	manager.syncMutex.RLock()
+	auditLog := manager.auditLog
+	manager.syncMutex.RUnlock()
+
+	if auditLog == nil {
+		return nil, errAuditDisabled
+	}
+	return auditLog.Query(filter)
+}
+
+// recordAuditLocked queues an entry for an applied update (caller must hold syncMutex).
+// The audit log writes it in the background; failures are logged rather than
+// failing an update that has already been applied.
+func (manager *PanelSyncManager) recordAuditLocked(update types.StateUpdate, versionBefore int64) {
+	if manager.auditLog == nil {
+		return
+	}
+
+	entry := audit.Entry{
+		Timestamp:     manager.state.Version.Timestamp,
+		UpdateID:      update.ID,
+		Type:          string(update.Type),
+		SourcePanel:   update.SourcePanel,
+		VersionBefore: versionBefore,
+		VersionAfter:  manager.state.Version.Version,
+	}
+	// Encoded once for both, and here, as the payload may share data with the state
+	if data, err := json.Marshal(update.Payload); err == nil {
+		entry.Target = auditTarget(data)
+		entry.PayloadHash = audit.HashPayload(data)
+	}
+	if err := manager.auditLog.Record(entry); err != nil {
+		log.Printf("Failed to record audit entry for update %s: %v", update.ID, err)
+	}
+}
+
+// auditTarget extracts the ID of the entity an encoded payload refers to
+func auditTarget(data []byte) string {
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return ""
+	}
+
+	for _, key := range auditTargetKeys {
+		if id, ok := fields[key].(string); ok && id != "" {
+			return id
+		}
+	}
+
+	// Adds nest the entity, e.g. {"session": {"id": ...}}
+	for _, key := range []string{"annotation", "message", "session"} {
+		if nested, ok := fields[key].(map[string]interface{}); ok {
+			if id, ok := nested["id"].(string); ok && id != "" {
+				return id
+			}
+		}
+	}
+	return ""
+}
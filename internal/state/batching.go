@@ -0,0 +1,221 @@
+package state
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Under load the apply loop takes the updates already waiting in its queue
+// along with the one it is about to apply, up to MaxBatchSize, applies them
+// under one hold of the state lock and bumps the version once for all of
+// them. The batch is broadcast as one state_batch event carrying the events
+// each update would have produced; the event bus hands them out one at a time
+// to subscribers that did not declare they take batches. With an idle queue
+// every batch is a single update and nothing changes.
+
+// DefaultMaxBatchSize is how many queued updates the apply loop applies together
+const DefaultMaxBatchSize = 32
+
+// collectBatch adds the updates waiting behind the first to the batch, up to
+// the configured size, and returns the queue to continue with
+func (manager *PanelSyncManager) collectBatch(batch []applyRequest, queue chan applyRequest) ([]applyRequest, chan applyRequest) {
+	limit := manager.GetConfig().MaxBatchSize
+	for len(batch) < limit {
+		select {
+		case request, ok := <-queue:
+			if !ok {
+				// Resized: what was queued before is ahead in the old queue
+				queue = manager.currentApplyQueue()
+				continue
+			}
+			batch = append(batch, request)
+		default:
+			return batch, queue
+		}
+	}
+	return batch, queue
+}
+
+// applyBatchRecovered applies a batch and replies to each of its requests,
+// failing those not yet answered rather than the apply loop when it panics
+func (manager *PanelSyncManager) applyBatchRecovered(batch []applyRequest) {
+	defer func() {
+		if r := recover(); r != nil {
+			manager.ReportPanic(ComponentApply, fmt.Sprintf("batch of %d updates", len(batch)), r, debug.Stack())
+			for _, request := range batch {
+				select {
+				case request.reply <- fmt.Errorf("internal error applying batched %s update: %v", request.update.Type, r):
+				default:
+				}
+			}
+		}
+	}()
+
+	errs := manager.processApplyBatch(batch)
+	for i, request := range batch {
+		request.reply <- errs[i]
+	}
+}
+
+// processApplyBatch runs the queued updates of a batch under one hold of the
+// state lock and commits those that applied as one version. An update that
+// fails is reported to its sender and leaves the rest of the batch alone.
+func (manager *PanelSyncManager) processApplyBatch(batch []applyRequest) []error {
+	done := manager.watchSlow(SlowOperation{
+		Kind:        SlowKindUpdate,
+		UpdateType:  types.StateBatched,
+		UpdateID:    batch[0].update.ID,
+		SourcePanel: batch[0].update.SourcePanel,
+	}, manager.GetConfig().SlowUpdate)
+	defer done()
+
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+
+	errs := make([]error, len(batch))
+	applied := make([]types.StateUpdate, 0, len(batch))
+	for i, request := range batch {
+		if previous, ok := manager.dedupe.lookup(request.update.ID, manager.now()); ok {
+			manager.metrics.RecordDuplicate()
+			log.Printf("Dropping duplicate update %s (%s) from %s", request.update.ID, request.update.Type, request.update.SourcePanel)
+			errs[i] = previous.err
+			continue
+		}
+
+		if request.strict {
+			err := manager.checkVersionLocked(request.update)
+			// Without clocks the batch's earlier updates count as versions the
+			// sender had not seen, as they would have applied one at a time
+			if err == nil && len(applied) > 0 && (manager.clockNode == "" || request.update.Clock == nil) {
+				err = fmt.Errorf("%w: expected %d, batched after %d other updates",
+					ErrVersionConflict, request.update.ExpectedVersion, len(applied))
+			}
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+		}
+
+		span := manager.tracer.Start(request.update.TraceParent, "state.apply")
+		span.SetAttr("update.id", request.update.ID)
+		span.SetAttr("update.type", string(request.update.Type))
+		span.SetAttr("update.source", request.update.SourcePanel)
+		span.SetAttr("batch.index", i)
+		update := request.update
+		update.TraceParent = span.TraceParent()
+		err := manager.applyChangeRecovered(&update)
+		span.SetError(err)
+		span.End()
+		manager.dedupe.record(request.update.ID, appliedUpdate{appliedAt: manager.now(), err: err})
+		errs[i] = err
+		if err == nil {
+			applied = append(applied, update)
+		}
+	}
+
+	switch len(applied) {
+	case 0:
+	case 1:
+		manager.commitUpdateLocked(applied[0])
+	default:
+		manager.commitBatchLocked(applied)
+	}
+	manager.metrics.RecordBatch(len(batch))
+	return errs
+}
+
+// applyChangeRecovered applies one update of a batch, failing that update
+// rather than the whole batch when it panics
+func (manager *PanelSyncManager) applyChangeRecovered(update *types.StateUpdate) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			manager.ReportPanic(ComponentApply, fmt.Sprintf("batched %s update %s from %s", update.Type, update.ID, update.SourcePanel), r, debug.Stack())
+			err = fmt.Errorf("internal error applying %s update: %v", update.Type, r)
+		}
+	}()
+	return manager.applyChangeLocked(update)
+}
+
+// commitBatchLocked bumps the version once for the updates of a batch already
+// applied, records them and broadcasts the batch event
+func (manager *PanelSyncManager) commitBatchLocked(updates []types.StateUpdate) {
+	source := updates[0].SourcePanel
+	for _, update := range updates[1:] {
+		if update.SourcePanel != source {
+			source = ""
+			break
+		}
+	}
+
+	versionBefore := manager.state.Version.Version
+	manager.state.Version.Version++
+	manager.state.Version.Timestamp = manager.now()
+	manager.state.Version.Source = source
+	manager.state.LastUpdate = manager.now()
+	manager.state.UpdateCount += int64(len(updates))
+	version := manager.state.Version.Version
+
+	payload := types.StateBatchPayload{Events: make([]types.StateEvent, 0, len(updates))}
+	for _, update := range updates {
+		manager.advanceClockLocked(update)
+		manager.recordAuditLocked(update, versionBefore)
+		manager.recordMacroLocked(update)
+
+		event := CreateEventFromUpdate(update, version)
+		event.Timestamp = manager.state.Version.Timestamp
+		payload.Events = append(payload.Events, event)
+	}
+	manager.recordJournalBatchLocked(updates)
+
+	span := manager.tracer.Start(updates[len(updates)-1].TraceParent, "state.broadcast")
+	event := types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStateBatch,
+		Data:        payload,
+		Version:     version,
+		Clock:       manager.state.Version.Clock.Clone(),
+		SourcePanel: source,
+		Timestamp:   manager.state.Version.Timestamp,
+		TraceParent: span.TraceParent(),
+	}
+	span.SetAttr("event.type", string(event.Type))
+	span.SetAttr("batch.size", len(updates))
+	manager.eventBus.Broadcast(event)
+	span.End()
+	manager.lastTrace = updates[len(updates)-1].TraceParent
+}
+
+// replayBatchLocked applies the updates of a batch applied elsewhere, as a
+// replica or a replay of history does, bumping the version once like the
+// manager that applied them first
+func (manager *PanelSyncManager) replayBatchLocked(updates []types.StateUpdate) error {
+	for i := range updates {
+		if err := manager.applyChangeLocked(&updates[i]); err != nil {
+			return fmt.Errorf("batched %s update: %w", updates[i].Type, err)
+		}
+	}
+	manager.commitBatchLocked(updates)
+	return nil
+}
+
+// batchedUpdates turns the events of a batch back into the updates that
+// produced them
+func batchedUpdates(payload types.StateBatchPayload) ([]types.StateUpdate, error) {
+	updates := make([]types.StateUpdate, 0, len(payload.Events))
+	for _, event := range payload.Events {
+		updateType, ok := eventUpdates[event.Type]
+		if !ok {
+			return nil, fmt.Errorf("batched %s event cannot be replayed", event.Type)
+		}
+		updates = append(updates, types.StateUpdate{
+			Type:        updateType,
+			Payload:     event.Data,
+			SourcePanel: event.SourcePanel,
+			Timestamp:   event.Timestamp,
+		})
+	}
+	return updates, nil
+}
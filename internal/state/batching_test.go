@@ -0,0 +1,177 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// queuedMessages returns requests adding messages to session s1, as they
+// would wait in the apply queue
+func queuedMessages(manager *PanelSyncManager, ids ...string) []applyRequest {
+	var batch []applyRequest
+	for _, id := range ids {
+		batch = append(batch, applyRequest{
+			update: types.StateUpdate{
+				ID:          generateUpdateID(),
+				Type:        types.MessageAdded,
+				Payload:     types.MessageAddPayload{Message: types.MessageInfo{ID: id, SessionID: "s1", Type: "user", Content: id}},
+				SourcePanel: "input",
+				Timestamp:   manager.now(),
+			},
+			reply: make(chan error, 1),
+		})
+	}
+	return batch
+}
+
+func newBatchingTestManager(t *testing.T) *PanelSyncManager {
+	t.Helper()
+	manager := newTestSyncManager(t)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "paste", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	return manager
+}
+
+func TestApplyBatchSharesOneVersion(t *testing.T) {
+	manager := newBatchingTestManager(t)
+	bus := manager.eventBus.(*EventBus)
+	plain := make(chan types.StateEvent, 16)
+	batching := make(chan types.StateEvent, 16)
+	bus.SubscribeWithCapabilities("c-batching", "exporter", "controller", &types.PanelCapabilities{Batches: true}, batching)
+	bus.Subscribe("c-plain", "messages", "messages", plain)
+	drainEvents(t, batching)
+	before := manager.GetState().Version.Version
+
+	batch := queuedMessages(manager, "m1", "m2", "m3")
+	// A strict update that saw an older version fails alone
+	batch[1].strict = true
+	batch[1].update.ExpectedVersion = before - 1
+	manager.applyBatchRecovered(batch)
+
+	for i, request := range batch {
+		err := <-request.reply
+		if (i == 1) != errors.Is(err, ErrVersionConflict) {
+			t.Errorf("update %d error = %v", i, err)
+		}
+	}
+	state := manager.GetState()
+	if state.Version.Version != before+1 || len(state.Messages) != 2 {
+		t.Errorf("after the batch: version %d with %d messages, want %d with 2", state.Version.Version, len(state.Messages), before+1)
+	}
+
+	events := drainEvents(t, batching)
+	if len(events) != 1 || events[0].Type != types.EventStateBatch {
+		t.Fatalf("batching subscriber got %v, want one batch event", events)
+	}
+	var payload types.StateBatchPayload
+	if err := decodePayload(events[0].Data, &payload); err != nil || len(payload.Events) != 2 {
+		t.Fatalf("batch payload = %+v, %v; want two events", payload, err)
+	}
+
+	members := drainEvents(t, plain)
+	if len(members) != 2 {
+		t.Fatalf("plain subscriber got %d events, want the 2 members", len(members))
+	}
+	for i, member := range members {
+		if member.Type != types.EventMessageAdded || member.Version != before+1 || member.Batch == nil ||
+			member.Batch.Index != i || member.Batch.Size != 2 || member.Batch.ID != events[0].ID {
+			t.Errorf("member %d = %s at version %d in %+v", i, member.Type, member.Version, member.Batch)
+		}
+	}
+
+	metrics := manager.GetMetrics()
+	if metrics.Batches != 1 || metrics.BatchedUpdates != 3 || metrics.LargestBatch != 3 {
+		t.Errorf("batch metrics = %d batches of %d updates, largest %d", metrics.Batches, metrics.BatchedUpdates, metrics.LargestBatch)
+	}
+}
+
+func TestCollectBatchStopsAtMaxSize(t *testing.T) {
+	manager := newTestSyncManager(t)
+	config := manager.GetConfig()
+	config.MaxBatchSize = 3
+	if err := manager.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	queue := make(chan applyRequest, 8)
+	requests := queuedMessages(manager, "m1", "m2", "m3", "m4", "m5")
+	for _, request := range requests[1:] {
+		queue <- request
+	}
+	batch, _ := manager.collectBatch(requests[:1], queue)
+	if len(batch) != 3 || len(queue) != 2 {
+		t.Errorf("collected %d updates leaving %d queued, want 3 and 2", len(batch), len(queue))
+	}
+
+	// An idle queue leaves the update alone
+	batch, _ = manager.collectBatch(requests[:1], make(chan applyRequest, 1))
+	if len(batch) != 1 {
+		t.Errorf("collected %d updates from an empty queue", len(batch))
+	}
+}
+
+func TestStateAtReplaysBatch(t *testing.T) {
+	manager := newBatchingTestManager(t)
+	j, err := journal.Open(journal.DefaultConfig(filepath.Join(t.TempDir(), "journal")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	manager.SetJournal(j)
+
+	if err := manager.AddMessage(types.MessageInfo{ID: "m0", SessionID: "s1", Content: "first"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	before := manager.GetState().Version.Version
+	manager.applyBatchRecovered(queuedMessages(manager, "m1", "m2", "m3"))
+	if err := manager.AddMessage(types.MessageInfo{ID: "m4", SessionID: "s1", Content: "last"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	for version, want := range map[int64]int{before: 1, before + 1: 4, before + 2: 5} {
+		past, err := manager.StateAt(version)
+		if err != nil {
+			t.Fatalf("StateAt(%d) error = %v", version, err)
+		}
+		if past.Version.Version != version || len(past.Messages) != want {
+			t.Errorf("StateAt(%d) = version %d with %d messages, want %d", version, past.Version.Version, len(past.Messages), want)
+		}
+	}
+}
+
+func TestReplicaFollowsBatches(t *testing.T) {
+	primary := newBatchingTestManager(t)
+	bus := primary.eventBus.(*EventBus)
+	whole := make(chan types.StateEvent, 16)
+	members := make(chan types.StateEvent, 16)
+	bus.SubscribeWithCapabilities("c-whole", "replica-a", "controller", &types.PanelCapabilities{Batches: true}, whole)
+	bus.Subscribe("c-members", "replica-b", "controller", members)
+	drainEvents(t, whole)
+	source := &primarySource{manager: primary}
+
+	replicas := map[string]*Replica{"whole": NewReplica(10), "members": NewReplica(10)}
+	for _, replica := range replicas {
+		if err := replica.Sync(source); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := 0; i < 2; i++ {
+		primary.applyBatchRecovered(queuedMessages(primary, fmt.Sprintf("a%d", i), fmt.Sprintf("b%d", i)))
+	}
+
+	for name, events := range map[string]chan types.StateEvent{"whole": whole, "members": members} {
+		for _, event := range drainEvents(t, events) {
+			if err := replicas[name].Apply(event); err != nil {
+				t.Fatalf("%s replica Apply(%s) error = %v", name, event.Type, err)
+			}
+		}
+		assertReplicated(t, primary, replicas[name])
+	}
+}
@@ -0,0 +1,227 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// errBlobsDisabled is returned by GetBlob when no blob store is attached
+var errBlobsDisabled = errors.New("blob store is not enabled")
+
+// SetBlobStore moves message bodies and parts larger than threshold bytes into store,
+// leaving only their hashes in the state; nil disables offloading. Messages already in
+// memory are offloaded immediately so the next save shrinks the state file.
+func (manager *PanelSyncManager) SetBlobStore(store *persistence.BlobStore, threshold int) {
+	if threshold <= 0 {
+		threshold = persistence.DefaultBlobThreshold
+	}
+
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+
+	manager.blobs = store
+	manager.blobThreshold = threshold
+	if store == nil {
+		return
+	}
+
+	for i := range manager.state.Messages {
+		if err := manager.offloadMessageLocked(&manager.state.Messages[i]); err != nil {
+			log.Printf("Failed to offload message %s: %v", manager.state.Messages[i].ID, err)
+		}
+	}
+	if current := manager.state.CurrentMessage; current != nil {
+		if err := manager.offloadMessageLocked(current); err != nil {
+			log.Printf("Failed to offload current message %s: %v", current.ID, err)
+		}
+	}
+}
+
+// SetMessagePreview keeps the first size bytes of each offloaded body inline,
+// ending in a truncation marker, so panels can show a message without
+// fetching its blob; 0 leaves offloaded bodies empty. It applies to messages
+// offloaded from now on.
+func (manager *PanelSyncManager) SetMessagePreview(size int) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.blobPreview = max(size, 0)
+}
+
+// GetBlob returns an offloaded message body or parts list by hash
+func (manager *PanelSyncManager) GetBlob(hash string) ([]byte, error) {
+	manager.syncMutex.RLock()
+	store := manager.blobs
+	manager.syncMutex.RUnlock()
+
+	if store == nil {
+		return nil, errBlobsDisabled
+	}
+	return store.Get(hash)
+}
+
+// ResolveMessageBody replaces the blob references of msg with the body and
+// parts they point to, for callers outside the daemon that cannot fetch blobs
+func (manager *PanelSyncManager) ResolveMessageBody(msg *types.MessageInfo) error {
+	if msg.BodyRef != "" {
+		data, err := manager.GetBlob(msg.BodyRef)
+		if err != nil {
+			return err
+		}
+		msg.Content = string(data)
+		msg.BodyRef, msg.BodySize, msg.Truncated = "", 0, false
+	}
+	if msg.PartsRef != "" {
+		data, err := manager.GetBlob(msg.PartsRef)
+		if err != nil {
+			return err
+		}
+		parts, err := types.DecodeParts(data)
+		if err != nil {
+			return fmt.Errorf("failed to decode message parts: %w", err)
+		}
+		msg.Parts = parts
+		msg.PartsRef = ""
+	}
+	return nil
+}
+
+// offloadMessageLocked replaces oversized content, parts and native records
+// with blob references
+func (manager *PanelSyncManager) offloadMessageLocked(msg *types.MessageInfo) error {
+	if manager.blobs == nil {
+		return nil
+	}
+
+	if len(msg.Content) > manager.blobThreshold {
+		content := []byte(msg.Content)
+		hash, err := manager.blobs.Put(content)
+		if err != nil {
+			return fmt.Errorf("failed to store message body: %w", err)
+		}
+		msg.BodyRef = hash
+		msg.BodySize = len(msg.Content)
+		msg.Content = ""
+		msg.Truncated = false
+		if manager.blobPreview > 0 {
+			msg.Content = types.ContentPreview(string(content), manager.blobPreview)
+			msg.Truncated = true
+		}
+	}
+
+	if len(msg.Parts) > 0 {
+		data, err := json.Marshal(msg.Parts)
+		if err != nil {
+			return fmt.Errorf("failed to encode message parts: %w", err)
+		}
+		if len(data) > manager.blobThreshold {
+			hash, err := manager.blobs.Put(data)
+			if err != nil {
+				return fmt.Errorf("failed to store message parts: %w", err)
+			}
+			msg.PartsRef = hash
+			msg.Parts = nil
+		}
+	}
+
+	if len(msg.Native) > manager.blobThreshold {
+		hash, err := manager.blobs.Put(msg.Native)
+		if err != nil {
+			return fmt.Errorf("failed to store native message record: %w", err)
+		}
+		msg.NativeRef = hash
+		msg.Native = nil
+	}
+
+	return nil
+}
+
+// offloadUpdatePayloadLocked applies offloading to a message update before it is
+// applied, so both the state and the broadcast event carry references
+func (manager *PanelSyncManager) offloadUpdatePayloadLocked(payload *types.MessageUpdatePayload) error {
+	msg := types.MessageInfo{Content: payload.Content, Parts: payload.Parts}
+	if err := manager.offloadMessageLocked(&msg); err != nil {
+		return err
+	}
+	if msg.BodyRef != "" {
+		payload.Content = msg.Content
+		payload.BodyRef = msg.BodyRef
+		payload.BodySize = msg.BodySize
+		payload.Truncated = msg.Truncated
+	}
+	if msg.PartsRef != "" {
+		payload.Parts = nil
+		payload.PartsRef = msg.PartsRef
+	}
+	return nil
+}
+
+// checkBlobRefLocked rejects references to blobs the store does not hold
+func (manager *PanelSyncManager) checkBlobRefLocked(hash string) error {
+	if hash == "" || manager.replaying {
+		return nil
+	}
+	if manager.blobs == nil || !manager.blobs.Has(hash) {
+		return &persistence.BlobNotFoundError{Hash: hash}
+	}
+	return nil
+}
+
+// dropBlobsLocked deletes blobs that no message references any more
+func (manager *PanelSyncManager) dropBlobsLocked(hashes ...string) {
+	if manager.blobs == nil {
+		return
+	}
+
+	for _, hash := range hashes {
+		if hash == "" || manager.blobReferencedLocked(hash) {
+			continue
+		}
+		if err := manager.blobs.Delete(hash); err != nil {
+			log.Printf("Failed to delete blob %s: %v", hash, err)
+		}
+	}
+}
+
+func (manager *PanelSyncManager) blobReferencedLocked(hash string) bool {
+	references := func(msg *types.MessageInfo) bool {
+		return msg.BodyRef == hash || msg.PartsRef == hash || msg.NativeRef == hash
+	}
+	for i := range manager.state.Messages {
+		if references(&manager.state.Messages[i]) {
+			return true
+		}
+	}
+	// Archived messages keep their bodies in the store too
+	for i := range manager.state.ArchivedMessages {
+		if references(&manager.state.ArchivedMessages[i]) {
+			return true
+		}
+	}
+	current := manager.state.CurrentMessage
+	return current != nil && references(current)
+}
+
+// loadMessageBodyLocked inlines an offloaded body, for edits that need the text
+func (manager *PanelSyncManager) loadMessageBodyLocked(msg *types.MessageInfo) error {
+	if msg.BodyRef == "" {
+		return nil
+	}
+	if manager.blobs == nil {
+		return errBlobsDisabled
+	}
+
+	data, err := manager.blobs.Get(msg.BodyRef)
+	if err != nil {
+		return err
+	}
+	msg.Content = string(data)
+	msg.BodyRef = ""
+	msg.BodySize = 0
+	msg.Truncated = false
+	return nil
+}
@@ -0,0 +1,224 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/sst/opencode-sdk-go"
+)
+
+func TestLargeMessageBodiesAreOffloaded(t *testing.T) {
+	manager := newTestSyncManager(t)
+	store := persistence.NewBlobStore(filepath.Join(t.TempDir(), "blobs"), 0, 0)
+	manager.SetBlobStore(store, 64)
+
+	body := strings.Repeat("a long assistant reply ", 10)
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Content: body}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m2", SessionID: "s1", Content: "short"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+
+	messages := manager.GetState().Messages
+	large, small := messages[0], messages[1]
+	if large.Content != "" || large.BodyRef != persistence.HashBlob([]byte(body)) || large.BodySize != len(body) {
+		t.Fatalf("large message not offloaded: %+v", large)
+	}
+	if small.Content != "short" || small.BodyRef != "" {
+		t.Errorf("small message should stay inline: %+v", small)
+	}
+	if data, err := manager.GetBlob(large.BodyRef); err != nil || string(data) != body {
+		t.Errorf("GetBlob() = %q, %v", data, err)
+	}
+
+	// Redacting an offloaded body rewrites it and removes the unredacted blob
+	oldRef := large.BodyRef
+	if err := manager.RedactMessage("m1", []types.RedactionRange{{Start: 0, End: 6}}, "test", "test"); err != nil {
+		t.Fatalf("RedactMessage() error = %v", err)
+	}
+	redacted := manager.GetState().Messages[0]
+	data, err := manager.GetBlob(redacted.BodyRef)
+	if err != nil || !strings.HasPrefix(string(data), RedactionPlaceholder) {
+		t.Errorf("redacted body = %q, %v", data, err)
+	}
+	if store.Has(oldRef) {
+		t.Errorf("unredacted blob %s should have been deleted", oldRef)
+	}
+}
+
+func TestOffloadedBodiesKeepPreview(t *testing.T) {
+	manager := newTestSyncManager(t)
+	store := persistence.NewBlobStore(filepath.Join(t.TempDir(), "blobs"), 0, 0)
+	manager.SetMessagePreview(40)
+	manager.SetBlobStore(store, 64)
+
+	body := strings.Repeat("tool output line\n", 20)
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Content: "short"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.UpdateMessage("m1", body, "completed", "test"); err != nil {
+		t.Fatalf("UpdateMessage() error = %v", err)
+	}
+
+	msg := manager.GetState().Messages[0]
+	if !msg.Truncated || msg.BodyRef != persistence.HashBlob([]byte(body)) || msg.BodySize != len(body) {
+		t.Fatalf("large body not offloaded with a preview: %+v", msg)
+	}
+	if want := types.ContentPreview(body, 40); msg.Content != want {
+		t.Errorf("Content = %q, want preview %q", msg.Content, want)
+	}
+	if data, err := manager.GetBlob(msg.BodyRef); err != nil || string(data) != body {
+		t.Errorf("GetBlob() = %q, %v; want the full body", data, err)
+	}
+
+	// A short update replaces the preview with an inline body
+	if err := manager.UpdateMessage("m1", "done", "completed", "test"); err != nil {
+		t.Fatalf("UpdateMessage() error = %v", err)
+	}
+	if msg := manager.GetState().Messages[0]; msg.Truncated || msg.BodyRef != "" || msg.Content != "done" {
+		t.Errorf("short update left a preview: %+v", msg)
+	}
+}
+
+func TestContentPreview(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		size     int
+		wantKept string
+	}{
+		{name: "fits", content: "short", size: 10, wantKept: "short"},
+		{name: "cut at line", content: "first line\nsecond line\nthird", size: 18, wantKept: "first line"},
+		{name: "cut inside a character", content: "ééééé", size: 5, wantKept: "éé"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := types.ContentPreview(tt.content, tt.size)
+			if !strings.HasPrefix(got, tt.wantKept) {
+				t.Fatalf("ContentPreview() = %q, want it to start with %q", got, tt.wantKept)
+			}
+			if tt.wantKept == tt.content {
+				if got != tt.content {
+					t.Errorf("ContentPreview() = %q, want content unchanged", got)
+				}
+				return
+			}
+			rest := strings.TrimPrefix(got, tt.wantKept)
+			if !strings.Contains(rest, fmt.Sprintf("%d more bytes", len(tt.content)-len(tt.wantKept))) {
+				t.Errorf("ContentPreview() = %q, want a marker counting the bytes left out", got)
+			}
+		})
+	}
+}
+
+func TestArchivedMessageBlobsSurviveCollection(t *testing.T) {
+	dir := t.TempDir()
+	fmConfig := persistence.DefaultFileManagerConfig(filepath.Join(dir, "state.json"))
+	fm := persistence.NewFileManager(fmConfig)
+	if err := fm.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), fm, NewEventBus(100), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Stop() })
+	blobDir := persistence.DefaultBlobDir(fmConfig.StatePath)
+	manager.SetBlobStore(persistence.NewBlobStore(blobDir, 0, 0), 64)
+
+	body := strings.Repeat("a long assistant reply ", 10)
+	for _, id := range []string{"m1", "m2"} {
+		if err := manager.AddMessage(types.MessageInfo{ID: id, SessionID: "s1", Type: "assistant", Content: body}, "test"); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	err := manager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.SessionCompacted,
+		ExpectedVersion: manager.GetState().GetCurrentVersion(),
+		Payload: types.SessionCompactedPayload{
+			Compaction: types.SessionCompaction{SessionID: "s1", ArchivedIDs: []string{"m1"}},
+			Summary:    types.MessageInfo{ID: "sum", SessionID: "s1", Type: "assistant", Content: "summary"},
+		},
+		SourcePanel: "test",
+		Timestamp:   time.Now(),
+	})
+	if err != nil {
+		t.Fatalf("SessionCompacted error = %v", err)
+	}
+
+	// m2 shares the archived body's blob; redacting it must leave that blob alone
+	ref := persistence.HashBlob([]byte(body))
+	if err := manager.RedactMessage("m2", []types.RedactionRange{{Start: 0, End: 6}}, "test", "test"); err != nil {
+		t.Fatalf("RedactMessage() error = %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	filepath.Walk(blobDir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			os.Chtimes(path, old, old)
+		}
+		return nil
+	})
+	if _, err := manager.CollectGarbage(false); err != nil {
+		t.Fatalf("CollectGarbage() error = %v", err)
+	}
+
+	archived := manager.GetState().ArchivedMessages
+	if len(archived) != 1 || archived[0].BodyRef != ref {
+		t.Fatalf("archived = %+v, want m1 referencing %s", archived, ref)
+	}
+	if data, err := manager.GetBlob(ref); err != nil || string(data) != body {
+		t.Errorf("archived body = %q, %v", data, err)
+	}
+}
+
+func TestResolveMessageBodyForTranscripts(t *testing.T) {
+	manager := newTestSyncManager(t)
+	store := persistence.NewBlobStore(filepath.Join(t.TempDir(), "blobs"), 0, 0)
+	manager.SetMessagePreview(40)
+	manager.SetBlobStore(store, 64)
+
+	body := strings.Repeat("tool output line\n", 20)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "transcript", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Content: body}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+
+	export, err := manager.ExportSession("s1")
+	if err != nil {
+		t.Fatalf("ExportSession() error = %v", err)
+	}
+	msg := export.Messages[0]
+	if msg.BodyRef == "" || !msg.Truncated {
+		t.Fatalf("message not offloaded: %+v", msg)
+	}
+	partsJSON, _ := json.Marshal([]opencode.PartUnion{opencode.TextPart{ID: "p1", Type: opencode.TextPartTypeText, Text: body}})
+	if msg.PartsRef, err = store.Put(partsJSON); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.ResolveMessageBody(&msg); err != nil {
+		t.Fatalf("ResolveMessageBody() error = %v", err)
+	}
+	if msg.Content != body || msg.BodyRef != "" || msg.Truncated {
+		t.Errorf("body not resolved: %+v", msg)
+	}
+	if len(msg.Parts) != 1 || msg.PartsRef != "" {
+		t.Fatalf("parts not resolved: %+v", msg)
+	}
+	if text, ok := msg.Parts[0].(opencode.TextPart); !ok || text.Text != body {
+		t.Errorf("part = %#v, want the text part", msg.Parts[0])
+	}
+}
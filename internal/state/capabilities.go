@@ -0,0 +1,15 @@
+package state
+
+import (
+	"errors"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrNoActionHandler is returned for a UI action no connected panel declared it handles
+var ErrNoActionHandler = errors.New("no connected panel handles UI action")
+
+// actionRouter is implemented by event buses that know which panels handle which UI actions
+type actionRouter interface {
+	HandlesAction(action types.UIAction, excludePanel string) bool
+}
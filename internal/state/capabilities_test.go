@@ -0,0 +1,127 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+	"github.com/sst/opencode-sdk-go"
+)
+
+func TestEventBusRoutesByCapabilities(t *testing.T) {
+	bus := NewEventBus(10)
+	channels := map[string]chan types.StateEvent{
+		"legacy":   make(chan types.StateEvent, 8),
+		"messages": make(chan types.StateEvent, 8),
+		"sessions": make(chan types.StateEvent, 8),
+		"topics":   make(chan types.StateEvent, 8),
+	}
+	bus.Subscribe("c-legacy", "legacy", "controller", channels["legacy"])
+	bus.SubscribeWithCapabilities("c-messages", "messages", "messages",
+		&types.PanelCapabilities{RendersMessages: true, UIActions: []types.UIAction{types.UIActionRefreshMessages}, Diffs: true}, channels["messages"])
+	bus.SubscribeWithCapabilities("c-sessions", "sessions", "sessions", &types.PanelCapabilities{}, channels["sessions"])
+	bus.SubscribeWithCapabilities("c-topics", "topics", "diff",
+		&types.PanelCapabilities{Topics: []string{"diff.*", "message.m2.*"}}, channels["topics"])
+	for _, ch := range channels {
+		for len(ch) > 0 {
+			<-ch // Connection notices
+		}
+	}
+
+	tests := []struct {
+		name  string
+		event types.StateEvent
+		want  []string
+	}{
+		{
+			name:  "handled action",
+			event: types.StateEvent{Type: types.EventUIActionTriggered, Data: types.UIActionPayload{Action: types.UIActionRefreshMessages}},
+			want:  []string{"legacy", "messages"},
+		},
+		{
+			name:  "unhandled action",
+			event: types.StateEvent{Type: types.EventUIActionTriggered, Data: map[string]interface{}{"action": "open_models"}},
+			want:  []string{"legacy"},
+		},
+		{
+			name: "message with patch",
+			event: types.StateEvent{Type: types.EventMessageAdded, Data: types.MessageAddPayload{
+				Message: types.MessageInfo{ID: "m1", Parts: []opencode.PartUnion{opencode.PartPatchPart{ID: "p1"}}},
+			}},
+			want: []string{"legacy", "messages"},
+		},
+		{
+			name:  "plain message",
+			event: types.StateEvent{Type: types.EventMessageAdded, Data: types.MessageAddPayload{Message: types.MessageInfo{ID: "m2"}}},
+			want:  []string{"legacy", "messages", "sessions", "topics"},
+		},
+		{
+			name:  "diff",
+			event: types.StateEvent{Type: types.EventFileDiffReady, Data: types.FileDiffReadyPayload{}},
+			want:  []string{"legacy", "messages", "sessions", "topics"},
+		},
+		{
+			name:  "other message",
+			event: types.StateEvent{Type: types.EventMessageUpdated, Data: map[string]interface{}{"message_id": "m3"}},
+			want:  []string{"legacy", "messages", "sessions"},
+		},
+		{
+			name:  "state sync",
+			event: types.StateEvent{Type: types.EventStateSync, Data: types.StateSyncPayload{}},
+			want:  []string{"legacy", "messages", "sessions", "topics"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.event.SourcePanel = "system"
+			bus.Broadcast(tt.event)
+
+			for panel, ch := range channels {
+				wanted := false
+				for _, w := range tt.want {
+					wanted = wanted || w == panel
+				}
+				select {
+				case <-ch:
+					if !wanted {
+						t.Errorf("%s received %s", panel, tt.name)
+					}
+				default:
+					if wanted {
+						t.Errorf("%s did not receive %s", panel, tt.name)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUIActionWithoutHandler(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 8)
+	manager.eventBus.(*EventBus).SubscribeWithCapabilities("conn", "input", "input",
+		&types.PanelCapabilities{UIActions: []types.UIAction{types.UIActionOpenModelPicker}}, events)
+
+	trigger := func(action types.UIAction, source string) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateEventID(),
+			Type:            types.UIActionTriggered,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         types.UIActionPayload{Action: action},
+			SourcePanel:     source,
+			Timestamp:       time.Now(),
+		})
+	}
+
+	if err := trigger(types.UIActionOpenModelPicker, "orchestrator"); err != nil {
+		t.Errorf("handled action error = %v", err)
+	}
+	if err := trigger(types.UIActionOpenThemePicker, "orchestrator"); !errors.Is(err, ErrNoActionHandler) {
+		t.Errorf("unhandled action error = %v, want ErrNoActionHandler", err)
+	}
+	// A panel is never sent its own action, so it cannot handle it either
+	if err := trigger(types.UIActionOpenModelPicker, "input"); !errors.Is(err, ErrNoActionHandler) {
+		t.Errorf("self-targeted action error = %v, want ErrNoActionHandler", err)
+	}
+}
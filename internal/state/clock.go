@@ -0,0 +1,38 @@
+package state
+
+import (
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+)
+
+// wallClock wraps the manager's clock so it can sit in an atomic.Value
+type wallClock struct{ clock.Clock }
+
+// SetClock replaces the clock the manager stamps updates, expires locks and
+// schedules autosaves and resyncs by. Tests pass a *clock.Fake; nil restores
+// the system clock. The watchdog keeps real time, since it guards against
+// real hangs.
+func (manager *PanelSyncManager) SetClock(c clock.Clock) {
+	manager.wallClock.Store(wallClock{clock.Or(c)})
+
+	// Wake the workers so they re-arm their timers on the new clock
+	manager.configMutex.Lock()
+	close(manager.configChanged)
+	manager.configChanged = make(chan struct{})
+	manager.configMutex.Unlock()
+}
+
+// clock returns the manager's clock; scratch managers built without the
+// constructor use the system clock
+func (manager *PanelSyncManager) clock() clock.Clock {
+	if held, ok := manager.wallClock.Load().(wallClock); ok {
+		return held.Clock
+	}
+	return clock.Real
+}
+
+// now returns the manager's time in UTC, the zone state is kept in
+func (manager *PanelSyncManager) now() time.Time {
+	return manager.clock().Now().UTC()
+}
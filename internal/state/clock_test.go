@@ -0,0 +1,66 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestAutoSaveFollowsClock(t *testing.T) {
+	fake := clock.NewFake(time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC))
+	repository := persistence.NewMemoryRepository(persistence.MemoryOptions{Clock: fake})
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveInterval = 5 * time.Second
+	config.GCInterval = 0
+
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(100), DefaultConflictResolver(), config)
+	manager.SetClock(fake)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Stop() })
+
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "autosaved"}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().Version.Timestamp; !got.Equal(fake.Now()) {
+		t.Errorf("update stamped %v, want the fake time %v", got, fake.Now())
+	}
+	// The update queues a save of its own; let it land before counting
+	waitForSaves(t, repository, 2)
+	initialSaves, _ := repository.Counts()
+
+	// Autosave and resync are both waiting on the fake clock
+	if !fake.BlockUntil(2, time.Second) {
+		t.Fatalf("workers never waited on the fake clock (%d waiting)", fake.Waiters())
+	}
+	fake.Advance(4 * time.Second)
+	time.Sleep(20 * time.Millisecond)
+	if saves, _ := repository.Counts(); saves != initialSaves {
+		t.Fatalf("saved %d times before the interval passed", saves-initialSaves)
+	}
+
+	fake.Advance(time.Second)
+	waitForSaves(t, repository, initialSaves+1)
+	if got := repository.GetStats().ModTime; !got.Equal(fake.Now()) {
+		t.Errorf("saved at %v, want the fake time %v", got, fake.Now())
+	}
+}
+
+func waitForSaves(t *testing.T, repository *persistence.MemoryRepository, want int64) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if saves, _ := repository.Counts(); saves >= want {
+			return
+		}
+		if time.Now().After(deadline) {
+			saves, _ := repository.Counts()
+			t.Fatalf("saved %d times, want %d", saves, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
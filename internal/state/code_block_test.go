@@ -0,0 +1,95 @@
+package state
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestCodeBlocksExtracted(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	body := "Run this:\n```sh\ngo test ./...\n```\n"
+	if err := apply(types.SessionAdded, types.SessionAddPayload{Session: testutil.Session("s1", "one")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.MessageAdded, types.MessageAddPayload{Message: testutil.Message("a1", "s1", "assistant", body)}); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := codeblocks.Extract(body)
+	if err := apply(types.CodeBlocksExtracted, types.CodeBlocksPayload{MessageID: "a1", Blocks: blocks}); err != nil {
+		t.Fatal(err)
+	}
+	message, _ := manager.GetState().GetMessageByID("a1")
+	if len(message.CodeBlocks) != 1 || message.CodeBlocks[0].Language != "sh" {
+		t.Fatalf("code blocks = %+v", message.CodeBlocks)
+	}
+	if code, err := message.CodeBlocks[0].Code(message.Content); err != nil || code != "go test ./..." {
+		t.Errorf("code = %q, %v", code, err)
+	}
+
+	for name, payload := range map[string]types.CodeBlocksPayload{
+		"unknown message": {MessageID: "missing", Blocks: blocks},
+		"past the body":   {MessageID: "a1", Blocks: []types.CodeBlock{{Start: 0, End: len(body) + 1}}},
+		"wrong index":     {MessageID: "a1", Blocks: []types.CodeBlock{{Index: 1}}},
+	} {
+		if err := apply(types.CodeBlocksExtracted, payload); err == nil {
+			t.Errorf("%s: code blocks accepted", name)
+		}
+	}
+
+	// A new body drops the offsets into the old one
+	if err := apply(types.MessageUpdated, types.MessageUpdatePayload{MessageID: "a1", Content: "rewritten"}); err != nil {
+		t.Fatal(err)
+	}
+	if message, _ := manager.GetState().GetMessageByID("a1"); len(message.CodeBlocks) != 0 {
+		t.Errorf("code blocks after the body changed = %+v", message.CodeBlocks)
+	}
+	if err := apply(types.MessageUpdated, types.MessageUpdatePayload{MessageID: "a1", Status: "completed"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.CodeBlockHandled, types.CodeBlockHandledPayload{MessageID: "a1", Action: types.UIActionCopyCodeBlock}); err != nil {
+		t.Errorf("recording a handled action: %v", err)
+	}
+}
+
+func TestContentMetaDescribesFullBodies(t *testing.T) {
+	manager := newTestSyncManager(t)
+	manager.SetBlobStore(persistence.NewBlobStore(filepath.Join(t.TempDir(), "blobs"), 0, 0), 64)
+
+	// The body is offloaded, but described whole
+	body := "Replace it:\n```go\n" + strings.Repeat("x := 1\n", 20) + "```\n"
+	if err := manager.AddMessage(types.MessageInfo{ID: "a1", SessionID: "s1", Type: "assistant", Content: body}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	message, _ := manager.GetState().GetMessageByID("a1")
+	want := types.ContentMeta{Lines: 23, Language: "go", CodeBlocks: 1, CodeLines: 20}
+	if message.BodyRef == "" || message.Meta == nil || *message.Meta != want {
+		t.Fatalf("offloaded message meta = %+v, want %+v", message.Meta, want)
+	}
+
+	if err := manager.UpdateMessage("a1", "done", "completed", "test"); err != nil {
+		t.Fatal(err)
+	}
+	message, _ = manager.GetState().GetMessageByID("a1")
+	if message.Meta == nil || *message.Meta != (types.ContentMeta{Lines: 1}) {
+		t.Errorf("meta after the body changed = %+v", message.Meta)
+	}
+}
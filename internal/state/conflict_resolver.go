@@ -1,9 +1,12 @@
 package state
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"math"
+	"math/rand"
+	"sync/atomic"
 	"time"
 
 	"github.com/opencode/tmux_coder/internal/interfaces"
@@ -16,9 +19,12 @@ type ConflictResolver struct {
 	baseBackoffMs    int
 	maxBackoffMs     int
 	conflictStrategy interfaces.ConflictStrategy
-	retryCount       int64
-	successCount     int64
-	conflictCount    int64
+	retryCount       atomic.Int64 // Counters are shared by every connection resolving at once
+	successCount     atomic.Int64
+	conflictCount    atomic.Int64
+	concurrentCount  atomic.Int64
+	duplicateCount   atomic.Int64
+	throttle         *conflictThrottle
 }
 
 // NewConflictResolver creates a new conflict resolver with specified parameters
@@ -28,9 +34,16 @@ func NewConflictResolver(maxRetries, baseBackoffMs, maxBackoffMs int, strategy i
 		baseBackoffMs:    baseBackoffMs,
 		maxBackoffMs:     maxBackoffMs,
 		conflictStrategy: strategy,
+		throttle:         newConflictThrottle(DefaultThrottleConfig()),
 	}
 }
 
+// SetThrottleConfig replaces the in-flight and storm limits. It should be called
+// before the resolver is shared, since in-flight accounting restarts from zero.
+func (resolver *ConflictResolver) SetThrottleConfig(config ThrottleConfig) {
+	resolver.throttle = newConflictThrottle(config)
+}
+
 // DefaultConflictResolver creates a resolver with sensible defaults
 func DefaultConflictResolver() *ConflictResolver {
 	return NewConflictResolver(
@@ -51,6 +64,26 @@ func (resolver *ConflictResolver) ResolveConflict(
 		Strategy: resolver.conflictStrategy,
 	}
 
+	release, reentrant, err := resolver.throttle.enter(update.ID, update.SourcePanel)
+	if err != nil {
+		resolver.retryCount.Add(1)
+		result.Error = fmt.Errorf("%w %s", err, update.SourcePanel)
+		result.TimeTaken = time.Since(startTime)
+		return result
+	}
+	defer release()
+
+	if !reentrant && update.Clock != nil {
+		proceed, err := resolver.checkCausality(stateManager, update)
+		if !proceed {
+			result.Success = err == nil
+			result.Error = err
+			result.FinalVersion = stateManager.GetState().GetCurrentVersion()
+			result.TimeTaken = time.Since(startTime)
+			return result
+		}
+	}
+
 	for attempt := 0; attempt < resolver.maxRetries; attempt++ {
 		result.Attempts = attempt + 1
 
@@ -62,12 +95,16 @@ func (resolver *ConflictResolver) ResolveConflict(
 		updatedUpdate := update
 		updatedUpdate.ExpectedVersion = currentVersion
 		updatedUpdate.Timestamp = time.Now()
+		if update.Clock != nil {
+			// Causality was settled above; rebase onto the current clock like the version
+			updatedUpdate.Clock = state.Version.Clock.Merge(update.Clock)
+		}
 
 		// Attempt the update
 		err := stateManager.UpdateWithVersionCheck(updatedUpdate)
 		if err == nil {
 			// Success!
-			resolver.successCount++
+			resolver.successCount.Add(1)
 			result.Success = true
 			result.FinalVersion = stateManager.GetState().GetCurrentVersion()
 			result.TimeTaken = time.Since(startTime)
@@ -76,7 +113,10 @@ func (resolver *ConflictResolver) ResolveConflict(
 
 		// Check if it's a version conflict
 		if isVersionConflict(err) {
-			resolver.conflictCount++
+			resolver.conflictCount.Add(1)
+			if !reentrant {
+				resolver.throttle.recordConflict()
+			}
 
 			log.Printf("Conflict detected (attempt %d/%d): %v",
 				attempt+1, resolver.maxRetries, err)
@@ -99,17 +139,58 @@ func (resolver *ConflictResolver) ResolveConflict(
 		// Non-conflict error, return immediately
 		result.Error = err
 		result.TimeTaken = time.Since(startTime)
-		resolver.retryCount++
+		resolver.retryCount.Add(1)
 		return result
 	}
 
 	// Max retries exceeded
-	resolver.retryCount++
+	resolver.retryCount.Add(1)
 	result.Error = fmt.Errorf("max retries exceeded (%d) for update type %s", resolver.maxRetries, update.Type)
 	result.TimeTaken = time.Since(startTime)
 	return result
 }
 
+// appliedUpdates is implemented by state managers that remember applied update IDs
+type appliedUpdates interface {
+	UpdateApplied(id string) bool
+}
+
+// checkCausality compares a vector-clocked update with the current state before any
+// retry. Redeliveries of applied updates are dropped as duplicates, and truly
+// concurrent updates are applied only if the conflict strategy accepts them.
+func (resolver *ConflictResolver) checkCausality(
+	stateManager interfaces.StateManager,
+	update types.StateUpdate,
+) (bool, error) {
+	current := stateManager.GetState().Version.Clock
+	if current == nil {
+		return true, nil
+	}
+
+	switch update.Clock.Compare(current) {
+	case types.ClockAfter:
+		// Plain ordering race; the writer has seen everything
+		return true, nil
+	case types.ClockBefore, types.ClockEqual:
+		// Only an update whose ID was applied is a redelivery; otherwise the writer
+		// reused a clock, and dropping the update would lose it silently
+		if applied, ok := stateManager.(appliedUpdates); ok && applied.UpdateApplied(update.ID) {
+			resolver.duplicateCount.Add(1)
+			log.Printf("Dropping duplicate update %s from %s (clock already merged)", update.ID, update.SourcePanel)
+			return false, nil
+		}
+		resolver.conflictCount.Add(1)
+		return false, fmt.Errorf("%w: update %s carries a clock the state has already seen", ErrConcurrentUpdate, update.ID)
+	default:
+		resolver.concurrentCount.Add(1)
+		resolver.conflictCount.Add(1)
+		if resolver.applyConflictStrategy(stateManager, update, ErrConcurrentUpdate) {
+			return true, nil
+		}
+		return false, fmt.Errorf("%w: update %s rejected by %s strategy", ErrConcurrentUpdate, update.ID, resolver.conflictStrategy)
+	}
+}
+
 // applyConflictStrategy applies the configured conflict resolution strategy
 func (resolver *ConflictResolver) applyConflictStrategy(
 	stateManager interfaces.StateManager,
@@ -192,41 +273,62 @@ func (resolver *ConflictResolver) resolveManually(
 
 // calculateBackoff computes the backoff duration for retry attempts
 func (resolver *ConflictResolver) calculateBackoff(attempt int) time.Duration {
-	// Exponential backoff with jitter
+	// Exponential backoff, capped at the maximum
 	backoffMs := resolver.baseBackoffMs * int(math.Pow(2, float64(attempt)))
-
-	// Cap at maximum backoff
 	if backoffMs > resolver.maxBackoffMs {
 		backoffMs = resolver.maxBackoffMs
 	}
+	if backoffMs <= 0 {
+		return 0
+	}
 
-	// Add some jitter to avoid thundering herd
-	jitter := time.Duration(backoffMs/4) * time.Millisecond
-	baseBackoff := time.Duration(backoffMs) * time.Millisecond
-
-	// Random jitter between -25% and +25%
-	jitterOffset := time.Duration((time.Now().UnixNano() % int64(jitter*2)) - int64(jitter))
-
-	return baseBackoff + jitterOffset
+	// Equal jitter: half fixed, half random, so panels that collided together
+	// spread out on retry instead of colliding again
+	half := time.Duration(backoffMs) * time.Millisecond / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
 }
 
 // GetStatistics returns conflict resolution statistics
 func (resolver *ConflictResolver) GetStatistics() interfaces.ConflictStatistics {
-	total := resolver.successCount + resolver.retryCount + resolver.conflictCount
+	successCount := resolver.successCount.Load()
+	conflictCount := resolver.conflictCount.Load()
+	retryCount := resolver.retryCount.Load()
+	total := successCount + retryCount + conflictCount
 
 	var successRate float64
 	if total > 0 {
-		successRate = float64(resolver.successCount) / float64(total) * 100
+		successRate = float64(successCount) / float64(total) * 100
 	}
 
-	return interfaces.ConflictStatistics{
-		TotalAttempts: total,
-		SuccessCount:  resolver.successCount,
-		ConflictCount: resolver.conflictCount,
-		RetryCount:    resolver.retryCount,
-		SuccessRate:   successRate,
-		Strategy:      resolver.conflictStrategy,
+	stats := interfaces.ConflictStatistics{
+		TotalAttempts:   total,
+		SuccessCount:    successCount,
+		ConflictCount:   conflictCount,
+		RetryCount:      retryCount,
+		SuccessRate:     successRate,
+		Strategy:        resolver.conflictStrategy,
+		ConcurrentCount: resolver.concurrentCount.Load(),
+		DuplicateCount:  resolver.duplicateCount.Load(),
 	}
+
+	throttle := resolver.throttle
+	throttle.mutex.Lock()
+	defer throttle.mutex.Unlock()
+
+	stats.ThrottledCount = throttle.throttledCount
+	stats.RejectedCount = throttle.rejectedCount
+	stats.StormActive = throttle.stormActiveLocked(time.Now())
+	stats.StormCount = throttle.stormCount
+	stats.SerializedCount = throttle.serializedCount
+	stats.LastStormStarted = throttle.lastStormStarted
+	if len(throttle.inFlight) > 0 {
+		stats.InFlightByPanel = make(map[string]int, len(throttle.inFlight))
+		for panelID, count := range throttle.inFlight {
+			stats.InFlightByPanel[panelID] = count
+		}
+	}
+
+	return stats
 }
 
 // UpdateConflictStrategy changes the conflict resolution strategy
@@ -249,9 +351,9 @@ func (resolver *ConflictResolver) IsHealthy() bool {
 	return stats.SuccessRate >= 80.0 && conflictRate <= 20.0
 }
 
-// isVersionConflict checks if the error is a version conflict
+// isVersionConflict checks if the error is a version conflict. Since in-process
+// updates are ordered by the apply loop, these only arise from stale cross-process
+// views; every other error is final.
 func isVersionConflict(err error) bool {
-	// Simple check for version conflict errors
-	// In a real implementation, this would check for specific error types
-	return err != nil && err.Error() != ""
+	return errors.Is(err, ErrVersionConflict)
 }
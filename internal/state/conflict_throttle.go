@@ -0,0 +1,156 @@
+package state
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// ErrInFlightLimit is returned when a panel has too many updates waiting on conflict resolution
+var ErrInFlightLimit = errors.New("too many in-flight updates for panel")
+
+// ThrottleConfig bounds how hard panels can push the resolver under contention
+type ThrottleConfig struct {
+	MaxInFlightPerPanel int           `json:"max_in_flight_per_panel"` // 0 disables the cap
+	InFlightWait        time.Duration `json:"in_flight_wait"`          // How long to wait for a slot before rejecting
+	StormThreshold      int           `json:"storm_threshold"`         // Conflicts within StormWindow that trigger serialization; 0 disables
+	StormWindow         time.Duration `json:"storm_window"`
+	StormCooldown       time.Duration `json:"storm_cooldown"` // Quiet period after the last conflict before leaving storm mode
+}
+
+// DefaultThrottleConfig returns limits suited to a handful of interactive panels
+func DefaultThrottleConfig() ThrottleConfig {
+	return ThrottleConfig{
+		MaxInFlightPerPanel: 8,
+		InFlightWait:        5 * time.Second,
+		StormThreshold:      20,
+		StormWindow:         time.Second,
+		StormCooldown:       2 * time.Second,
+	}
+}
+
+// conflictThrottle tracks per-panel in-flight updates and conflict storms
+type conflictThrottle struct {
+	config ThrottleConfig
+	mutex  sync.Mutex
+	cond   *sync.Cond
+
+	inFlight map[string]int
+	// active holds update IDs currently inside ResolveConflict, so re-entrant
+	// resolution of the same update does not wait on its own slot or the queue
+	active map[string]bool
+
+	recentConflicts []time.Time
+	stormUntil      time.Time
+	serialQueue     chan struct{}
+
+	throttledCount   int64
+	rejectedCount    int64
+	stormCount       int64
+	serializedCount  int64
+	lastStormStarted time.Time
+}
+
+func newConflictThrottle(config ThrottleConfig) *conflictThrottle {
+	throttle := &conflictThrottle{
+		config:      config,
+		inFlight:    make(map[string]int),
+		active:      make(map[string]bool),
+		serialQueue: make(chan struct{}, 1),
+	}
+	throttle.cond = sync.NewCond(&throttle.mutex)
+	return throttle
+}
+
+// enter admits an update, waiting for a per-panel slot and, during a storm, for its
+// turn in the serial queue. The returned release must be called when resolution ends.
+// reentrant is true when the update is already being resolved further up the stack.
+func (t *conflictThrottle) enter(updateID, panelID string) (release func(), reentrant bool, err error) {
+	t.mutex.Lock()
+	if t.active[updateID] {
+		t.mutex.Unlock()
+		return func() {}, true, nil
+	}
+
+	if t.config.MaxInFlightPerPanel > 0 && t.inFlight[panelID] >= t.config.MaxInFlightPerPanel {
+		t.throttledCount++
+		deadline := time.Now().Add(t.config.InFlightWait)
+		timer := time.AfterFunc(t.config.InFlightWait, func() {
+			t.mutex.Lock()
+			t.cond.Broadcast()
+			t.mutex.Unlock()
+		})
+		for t.inFlight[panelID] >= t.config.MaxInFlightPerPanel && time.Now().Before(deadline) {
+			t.cond.Wait()
+		}
+		timer.Stop()
+		if t.inFlight[panelID] >= t.config.MaxInFlightPerPanel {
+			t.rejectedCount++
+			t.mutex.Unlock()
+			return nil, false, ErrInFlightLimit
+		}
+	}
+
+	t.inFlight[panelID]++
+	t.active[updateID] = true
+	serialize := t.stormActiveLocked(time.Now())
+	if serialize {
+		t.serializedCount++
+	}
+	t.mutex.Unlock()
+
+	if serialize {
+		t.serialQueue <- struct{}{}
+	}
+
+	release = func() {
+		if serialize {
+			<-t.serialQueue
+		}
+		t.mutex.Lock()
+		t.inFlight[panelID]--
+		if t.inFlight[panelID] <= 0 {
+			delete(t.inFlight, panelID)
+		}
+		delete(t.active, updateID)
+		t.cond.Broadcast()
+		t.mutex.Unlock()
+	}
+	return release, false, nil
+}
+
+// recordConflict notes a conflict and enters storm mode if the threshold is crossed
+func (t *conflictThrottle) recordConflict() {
+	if t.config.StormThreshold <= 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-t.config.StormWindow)
+	kept := t.recentConflicts[:0]
+	for _, at := range t.recentConflicts {
+		if at.After(cutoff) {
+			kept = append(kept, at)
+		}
+	}
+	t.recentConflicts = append(kept, now)
+
+	if len(t.recentConflicts) < t.config.StormThreshold {
+		return
+	}
+	if !t.stormActiveLocked(now) {
+		t.stormCount++
+		t.lastStormStarted = now
+		log.Printf("Conflict storm detected (%d conflicts in %v), serializing updates",
+			len(t.recentConflicts), t.config.StormWindow)
+	}
+	t.stormUntil = now.Add(t.config.StormCooldown)
+}
+
+func (t *conflictThrottle) stormActiveLocked(now time.Time) bool {
+	return now.Before(t.stormUntil)
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestConflictThrottleInFlightCap(t *testing.T) {
+	throttle := newConflictThrottle(ThrottleConfig{MaxInFlightPerPanel: 1, InFlightWait: 20 * time.Millisecond})
+
+	release, _, err := throttle.enter("u1", "messages")
+	if err != nil {
+		t.Fatalf("enter() error = %v", err)
+	}
+
+	if _, reentrant, err := throttle.enter("u1", "messages"); err != nil || !reentrant {
+		t.Errorf("re-entering the same update: reentrant=%v err=%v, want reentrant without error", reentrant, err)
+	}
+	if _, _, err := throttle.enter("u2", "messages"); !errors.Is(err, ErrInFlightLimit) {
+		t.Errorf("second update for a full panel: err = %v, want ErrInFlightLimit", err)
+	}
+	if release2, _, err := throttle.enter("u3", "sessions"); err != nil {
+		t.Errorf("other panel should not be throttled: %v", err)
+	} else {
+		release2()
+	}
+
+	release()
+	if release4, _, err := throttle.enter("u4", "messages"); err != nil {
+		t.Errorf("slot should be free after release: %v", err)
+	} else {
+		release4()
+	}
+
+	if throttle.throttledCount != 1 || throttle.rejectedCount != 1 {
+		t.Errorf("throttled=%d rejected=%d, want 1 and 1", throttle.throttledCount, throttle.rejectedCount)
+	}
+}
+
+func TestConflictThrottleStorm(t *testing.T) {
+	throttle := newConflictThrottle(ThrottleConfig{StormThreshold: 3, StormWindow: time.Second, StormCooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		throttle.recordConflict()
+	}
+	if !throttle.stormActiveLocked(time.Now()) || throttle.stormCount != 1 {
+		t.Fatalf("expected storm mode after threshold, stormCount=%d", throttle.stormCount)
+	}
+
+	release, _, err := throttle.enter("u1", "messages")
+	if err != nil {
+		t.Fatalf("enter() error = %v", err)
+	}
+	if len(throttle.serialQueue) != 1 || throttle.serializedCount != 1 {
+		t.Errorf("update should hold the serial queue during a storm")
+	}
+	release()
+	if len(throttle.serialQueue) != 0 {
+		t.Errorf("serial queue should be free after release")
+	}
+}
+
+func TestCalculateBackoffJitterBounds(t *testing.T) {
+	resolver := NewConflictResolver(5, 10, 1000, "")
+
+	for attempt := 0; attempt < 10; attempt++ {
+		capped := 10 << attempt
+		if capped > 1000 {
+			capped = 1000
+		}
+		max := time.Duration(capped) * time.Millisecond
+		for i := 0; i < 20; i++ {
+			if got := resolver.calculateBackoff(attempt); got < max/2 || got > max {
+				t.Fatalf("calculateBackoff(%d) = %v, want within [%v, %v]", attempt, got, max/2, max)
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestContextUsageLevels(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	tests := []struct {
+		name   string
+		tokens int
+		limit  int
+		want   string
+	}{
+		{"unknown limit", 50000, 0, types.ContextLevelOK},
+		{"below warning", 79000, 100000, types.ContextLevelOK},
+		{"warning", 80000, 100000, types.ContextLevelWarning},
+		{"critical", 95000, 100000, types.ContextLevelCritical},
+		{"over the limit", 120000, 100000, types.ContextLevelCritical},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The level sent is ignored; it follows from the tokens and limit
+			usage := types.ContextUsage{SessionID: "ses_a", Tokens: tc.tokens, Limit: tc.limit, Level: types.ContextLevelCritical}
+			if err := apply(types.ContextUsageUpdated, types.ContextUsagePayload{Usage: usage}); err != nil {
+				t.Fatal(err)
+			}
+			if got, ok := manager.GetState().GetContextUsage(); !ok || got.Level != tc.want {
+				t.Errorf("level = %q, want %q", got.Level, tc.want)
+			}
+		})
+	}
+
+	if err := apply(types.ContextUsageUpdated, types.ContextUsagePayload{Usage: types.ContextUsage{Tokens: -1}}); err == nil {
+		t.Errorf("negative usage accepted")
+	}
+	if err := apply(types.ContextThreshold, types.ContextThresholdPayload{Usage: types.ContextUsage{Tokens: 10, Limit: 100}}); err == nil {
+		t.Errorf("threshold without a warning level accepted")
+	}
+	if err := apply(types.ContextThreshold, types.ContextThresholdPayload{Usage: types.ContextUsage{Tokens: 85, Limit: 100, Level: types.ContextLevelWarning}}); err != nil {
+		t.Errorf("threshold error = %v", err)
+	}
+}
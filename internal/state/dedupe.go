@@ -0,0 +1,102 @@
+package state
+
+import (
+	"time"
+)
+
+// DefaultDedupeWindow is how long applied update IDs are remembered
+const DefaultDedupeWindow = 5 * time.Minute
+
+// maxDedupeEntries bounds memory when updates arrive faster than the window expires them
+const maxDedupeEntries = 10000
+
+// appliedUpdate is the outcome of an update that went through the apply loop
+type appliedUpdate struct {
+	appliedAt time.Time
+	err       error
+}
+
+// updateDedupe remembers recently applied update IDs so a retried delivery of the
+// same update is answered with the original result instead of applying it twice.
+// It is only touched by the apply loop, under syncMutex.
+type updateDedupe struct {
+	window  time.Duration
+	applied map[string]appliedUpdate
+	order   []string // IDs in application order, for expiry
+}
+
+func newUpdateDedupe(window time.Duration) *updateDedupe {
+	if window <= 0 {
+		return nil
+	}
+	return &updateDedupe{
+		window:  window,
+		applied: make(map[string]appliedUpdate),
+	}
+}
+
+// withWindow returns a dedupe for window that keeps the IDs still inside it
+func (d *updateDedupe) withWindow(window time.Duration) *updateDedupe {
+	if window <= 0 {
+		return nil
+	}
+	if d == nil {
+		return newUpdateDedupe(window)
+	}
+	d.window = window
+	d.expire(time.Now())
+	return d
+}
+
+// lookup returns the recorded outcome for id if it was applied within the window
+func (d *updateDedupe) lookup(id string, now time.Time) (appliedUpdate, bool) {
+	if d == nil || id == "" {
+		return appliedUpdate{}, false
+	}
+	d.expire(now)
+	result, ok := d.applied[id]
+	return result, ok
+}
+
+// record stores the outcome of applying id
+func (d *updateDedupe) record(id string, result appliedUpdate) {
+	if d == nil || id == "" {
+		return
+	}
+	if _, ok := d.applied[id]; !ok {
+		d.order = append(d.order, id)
+	}
+	d.applied[id] = result
+	d.expire(result.appliedAt)
+}
+
+// expire forgets IDs older than the window, and the oldest IDs beyond the cap
+func (d *updateDedupe) expire(now time.Time) {
+	drop := 0
+	for drop < len(d.order) {
+		id := d.order[drop]
+		if len(d.order)-drop <= maxDedupeEntries && now.Sub(d.applied[id].appliedAt) < d.window {
+			break
+		}
+		delete(d.applied, id)
+		drop++
+	}
+	d.order = d.order[drop:]
+}
+
+// size returns the number of remembered update IDs
+func (d *updateDedupe) size() int {
+	if d == nil {
+		return 0
+	}
+	return len(d.applied)
+}
+
+// UpdateApplied reports whether the update with id went through the apply loop
+// within the dedupe window
+func (manager *PanelSyncManager) UpdateApplied(id string) bool {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	_, ok := manager.dedupe.lookup(id, manager.now())
+	return ok
+}
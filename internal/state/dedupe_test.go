@@ -0,0 +1,140 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestDuplicateUpdatesApplyOnce(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "dedupe", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+
+	add := types.StateUpdate{
+		ID:              "retried-add",
+		Type:            types.MessageAdded,
+		ExpectedVersion: manager.GetState().Version.Version,
+		Payload:         types.MessageAddPayload{Message: types.MessageInfo{ID: "m1", SessionID: "s1", Content: "once"}},
+		SourcePanel:     "panel",
+	}
+	if err := manager.UpdateWithVersionCheck(add); err != nil {
+		t.Fatalf("first delivery error = %v", err)
+	}
+	version := manager.GetState().Version.Version
+
+	// The retry carries the now-stale expected version and must not conflict or re-apply
+	if err := manager.UpdateWithVersionCheck(add); err != nil {
+		t.Fatalf("duplicate delivery error = %v", err)
+	}
+	state := manager.GetState()
+	if state.Version.Version != version || len(state.Messages) != 1 {
+		t.Fatalf("after duplicate: version %d (want %d), %d messages", state.Version.Version, version, len(state.Messages))
+	}
+	if got := manager.GetMetrics().DuplicateUpdates; got != 1 {
+		t.Errorf("DuplicateUpdates = %d, want 1", got)
+	}
+
+	// A failed update keeps failing the same way when retried
+	if err := manager.LockSession("s1", "export", time.Minute, "exporter"); err != nil {
+		t.Fatalf("LockSession() error = %v", err)
+	}
+	clear := types.StateUpdate{
+		ID:              "retried-clear",
+		Type:            types.MessagesCleared,
+		ExpectedVersion: manager.GetState().Version.Version,
+		Payload:         types.MessagesClearPayload{SessionID: "s1"},
+		SourcePanel:     "panel",
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := manager.UpdateWithVersionCheck(clear); !errors.Is(err, ErrSessionLocked) {
+			t.Fatalf("attempt %d error = %v, want ErrSessionLocked", attempt, err)
+		}
+	}
+	if err := manager.UnlockSession("s1", false, "exporter"); err != nil {
+		t.Fatalf("UnlockSession() error = %v", err)
+	}
+	if err := manager.UpdateWithVersionCheck(clear); !errors.Is(err, ErrSessionLocked) {
+		t.Errorf("retry within window error = %v, want the original ErrSessionLocked", err)
+	}
+}
+
+func TestUpdateDedupeExpiry(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name    string
+		records int
+		at      time.Duration
+		lookup  string
+		want    bool
+	}{
+		{"within window", 1, time.Minute, "id-0", true},
+		{"past window", 1, 6 * time.Minute, "id-0", false},
+		{"unknown id", 1, 0, "other", false},
+		{"empty id", 1, 0, "", false},
+		{"oldest beyond cap", maxDedupeEntries + 1, 0, "id-0", false},
+		{"newest within cap", maxDedupeEntries + 1, 0, fmt.Sprintf("id-%d", maxDedupeEntries), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newUpdateDedupe(DefaultDedupeWindow)
+			for i := 0; i < tt.records; i++ {
+				d.record(fmt.Sprintf("id-%d", i), appliedUpdate{appliedAt: start})
+			}
+			if _, ok := d.lookup(tt.lookup, start.Add(tt.at)); ok != tt.want {
+				t.Errorf("lookup(%q) = %v, want %v", tt.lookup, ok, tt.want)
+			}
+			if d.size() > maxDedupeEntries {
+				t.Errorf("size() = %d, want at most %d", d.size(), maxDedupeEntries)
+			}
+		})
+	}
+
+	if d := newUpdateDedupe(0); d != nil {
+		t.Error("newUpdateDedupe(0) should disable deduplication")
+	}
+}
+
+func TestReusedClockIsAConflict(t *testing.T) {
+	repository := persistence.NewMemoryRepository(persistence.MemoryOptions{})
+	config := newTestSyncManagerConfig()
+	config.VectorClockNode = "orchestrator"
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(100), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Stop() })
+
+	add := func(id, msgID string, clock types.VectorClock) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:          id,
+			Type:        types.MessageAdded,
+			Payload:     types.MessageAddPayload{Message: types.MessageInfo{ID: msgID, SessionID: "s1", Content: msgID}},
+			SourcePanel: "panel",
+			Clock:       clock,
+		})
+	}
+	clock := manager.GetState().Version.Clock.Increment("panel")
+	if err := add("first", "m1", clock); err != nil {
+		t.Fatalf("first update error = %v", err)
+	}
+
+	// A redelivery with the same ID is a duplicate
+	if err := add("first", "m1", clock); err != nil {
+		t.Fatalf("redelivery error = %v", err)
+	}
+	// A different update sent before the first was echoed is not
+	if err := add("second", "m2", clock); !errors.Is(err, ErrConcurrentUpdate) {
+		t.Fatalf("reused clock error = %v, want ErrConcurrentUpdate", err)
+	}
+	if got := len(manager.GetState().Messages); got != 1 {
+		t.Errorf("%d messages, want 1", got)
+	}
+}
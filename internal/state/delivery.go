@@ -0,0 +1,101 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// resyncInterval is how often subscribers that dropped events are checked
+// for room to take a full state sync
+const resyncInterval = time.Second
+
+// resyncTarget is implemented by event buses that track dropped events
+type resyncTarget interface {
+	resyncCandidates() []string
+	deliverResync(connectionID string, event types.StateEvent) bool
+	LaggingSubscribers() []interfaces.SubscriberInfo
+}
+
+// resyncWorker sends a full state sync to each subscriber that dropped events,
+// once its queue has drained enough to take it
+func (manager *PanelSyncManager) resyncWorker() {
+	target, ok := manager.eventBus.(resyncTarget)
+	if !ok {
+		return
+	}
+	for {
+		_, changed := manager.currentConfig()
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-changed:
+			continue
+		case <-manager.clock().After(resyncInterval):
+			manager.resyncBehind(target)
+		}
+	}
+}
+
+// resyncBehind delivers one state sync, built once, to every candidate
+func (manager *PanelSyncManager) resyncBehind(target resyncTarget) {
+	candidates := target.resyncCandidates()
+	if len(candidates) == 0 {
+		return
+	}
+
+	manager.syncMutex.RLock()
+	stateClone := manager.state.Clone()
+	manager.syncMutex.RUnlock()
+
+	event := types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStateSync,
+		Data:        types.StateSyncPayload{State: stateClone},
+		Version:     stateClone.Version.Version,
+		Clock:       stateClone.Version.Clock.Clone(),
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	}
+	for _, connectionID := range candidates {
+		target.deliverResync(connectionID, event)
+	}
+}
+
+// DeliveryHealthCheck returns a periodic check that fails while a subscriber
+// keeps dropping events
+func (manager *PanelSyncManager) DeliveryHealthCheck() interfaces.HealthCheck {
+	return interfaces.HealthCheck{
+		Name:        "event_delivery",
+		Description: "Panels are keeping up with state events",
+		Interval:    DropWindow / 3,
+		Enabled:     true,
+		CheckFunc: func() interfaces.HealthCheckResult {
+			result := interfaces.HealthCheckResult{
+				Healthy:   true,
+				Message:   "no panel is dropping events",
+				Timestamp: manager.now(),
+			}
+			target, ok := manager.eventBus.(resyncTarget)
+			if !ok {
+				return result
+			}
+			lagging := target.LaggingSubscribers()
+			if len(lagging) == 0 {
+				return result
+			}
+			sort.Slice(lagging, func(i, j int) bool { return lagging[i].PanelID < lagging[j].PanelID })
+			names := make([]string, 0, len(lagging))
+			for _, info := range lagging {
+				names = append(names, fmt.Sprintf("%s (%d dropped, %d resyncs)", info.PanelID, info.Dropped, info.Resyncs))
+			}
+			result.Healthy = false
+			result.Message = fmt.Sprintf("dropping events within %v: %s", DropWindow, strings.Join(names, ", "))
+			return result
+		},
+	}
+}
@@ -0,0 +1,63 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestDroppedEventsAreCountedAndResynced(t *testing.T) {
+	manager := newTestSyncManager(t)
+	bus := manager.eventBus.(*EventBus)
+	slow := make(chan types.StateEvent, 2)
+	fast := make(chan types.StateEvent, 64)
+	// Subscribed last, the slow panel is not sent a connect notice
+	bus.Subscribe("conn-fast", "input", "input", fast)
+	bus.Subscribe("conn-slow", "messages", "messages", slow)
+
+	for i := 0; i < SustainedDrops+2; i++ {
+		bus.Broadcast(types.StateEvent{ID: generateEventID(), Type: types.EventMessageAdded, SourcePanel: "test"})
+	}
+
+	subscribers := bus.GetSubscribers()
+	slowInfo, fastInfo := subscribers["conn-slow"], subscribers["conn-fast"]
+	if slowInfo.Delivered != 2 || slowInfo.Dropped != SustainedDrops || !slowInfo.Behind || !slowInfo.Lagging {
+		t.Errorf("slow subscriber = %+v", slowInfo)
+	}
+	if fastInfo.Dropped != 0 || fastInfo.Behind || fastInfo.Lagging {
+		t.Errorf("fast subscriber = %+v", fastInfo)
+	}
+	if lagging := bus.LaggingSubscribers(); len(lagging) != 1 || lagging[0].PanelID != "messages" {
+		t.Errorf("lagging = %+v", lagging)
+	}
+	if result := manager.DeliveryHealthCheck().CheckFunc(); result.Healthy {
+		t.Errorf("delivery health check passed with a lagging panel")
+	}
+
+	// Still full: no resync yet
+	manager.resyncBehind(bus)
+	if info := bus.GetSubscribers()["conn-slow"]; info.Resyncs != 0 {
+		t.Fatalf("resynced into a full queue: %+v", info)
+	}
+
+	<-slow
+	<-slow
+	manager.resyncBehind(bus)
+	select {
+	case event := <-slow:
+		if event.Type != types.EventStateSync {
+			t.Errorf("resync event = %s, want %s", event.Type, types.EventStateSync)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no resync delivered after the queue drained")
+	}
+	if info := bus.GetSubscribers()["conn-slow"]; info.Behind || info.Resyncs != 1 {
+		t.Errorf("after resync = %+v", info)
+	}
+	for _, event := range bus.GetEventHistory(0) {
+		if event.Type == types.EventStateSync {
+			t.Errorf("resync recorded in the shared history")
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// diskSpaceChecker is implemented by repositories that can tell whether a save fits
+type diskSpaceChecker interface {
+	CheckDiskSpace() error
+}
+
+// StorageHealth reports whether saves are paused because the disk is full
+func (manager *PanelSyncManager) StorageHealth() types.StorageHealthPayload {
+	manager.healthMutex.Lock()
+	defer manager.healthMutex.Unlock()
+	return manager.storageHealth
+}
+
+// storageDegraded reports whether autosave is paused
+func (manager *PanelSyncManager) storageDegraded() bool {
+	manager.healthMutex.Lock()
+	defer manager.healthMutex.Unlock()
+	return manager.storageHealth.Degraded
+}
+
+// updateStorageHealth enters degraded mode on a full disk and leaves it after
+// the next successful save, telling panels about either change
+func (manager *PanelSyncManager) updateStorageHealth(saveErr error) {
+	var diskErr *persistence.DiskFullError
+	full := errors.As(saveErr, &diskErr)
+
+	manager.healthMutex.Lock()
+	if manager.storageHealth.Degraded == full {
+		manager.healthMutex.Unlock()
+		return
+	}
+	if full {
+		manager.storageHealth = types.StorageHealthPayload{
+			Degraded:  true,
+			Reason:    diskErr.Reason,
+			Needed:    diskErr.Needed,
+			Available: diskErr.Available,
+			Since:     manager.now(),
+		}
+		log.Printf("Warning: pausing autosave: %v", diskErr)
+	} else {
+		log.Printf("Disk space available again after %v, resuming autosave",
+			manager.clock().Since(manager.storageHealth.Since).Round(time.Second))
+		manager.storageHealth = types.StorageHealthPayload{}
+	}
+	health := manager.storageHealth
+	manager.healthMutex.Unlock()
+
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStorageHealth,
+		Data:        health,
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+}
+
+// diskSpaceRecovered probes whether a paused autosave would fit again
+func (manager *PanelSyncManager) diskSpaceRecovered() bool {
+	checker, ok := manager.repository.(diskSpaceChecker)
+	if !ok {
+		// Without a probe the next save attempt is the probe
+		return true
+	}
+	return checker.CheckDiskSpace() == nil
+}
+
+// StorageHealthCheck returns a periodic check that fails while saves are paused
+func (manager *PanelSyncManager) StorageHealthCheck() interfaces.HealthCheck {
+	return interfaces.HealthCheck{
+		Name:        "storage",
+		Description: "The state file has room for the next save",
+		Interval:    manager.GetConfig().AutoSaveInterval,
+		Enabled:     true,
+		CheckFunc: func() interfaces.HealthCheckResult {
+			health := manager.StorageHealth()
+			result := interfaces.HealthCheckResult{
+				Healthy:   !health.Degraded,
+				Message:   "saves are succeeding",
+				Timestamp: manager.now(),
+			}
+			if health.Degraded {
+				result.Message = fmt.Sprintf("saves paused since %s: %s (%d bytes free, %d needed)",
+					health.Since.Format(time.TimeOnly), health.Reason, health.Available, health.Needed)
+			}
+			return result
+		},
+	}
+}
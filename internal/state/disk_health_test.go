@@ -0,0 +1,85 @@
+package state
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// fullDiskRepository fails saves and space probes with a DiskFullError while full is set
+type fullDiskRepository struct {
+	stubRepository
+	full atomic.Bool
+}
+
+func (r *fullDiskRepository) CheckDiskSpace() error {
+	if r.full.Load() {
+		return &persistence.DiskFullError{Path: "state.json", Needed: 2048, Available: 1024, Reason: "disk full"}
+	}
+	return nil
+}
+
+func (r *fullDiskRepository) SaveStateAtomic(state *types.SharedApplicationState) error {
+	if err := r.CheckDiskSpace(); err != nil {
+		return err
+	}
+	return r.stubRepository.SaveStateAtomic(state)
+}
+
+func TestFullDiskPausesAndResumesAutosave(t *testing.T) {
+	repository := &fullDiskRepository{}
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveInterval = 10 * time.Millisecond
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(10), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	defer manager.Stop()
+
+	events := make(chan types.StateEvent, 16)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+	nextHealth := func() types.StorageHealthPayload {
+		t.Helper()
+		for {
+			select {
+			case event := <-events:
+				if event.Type == types.EventStorageHealth {
+					return event.Data.(types.StorageHealthPayload)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("no storage health event")
+			}
+		}
+	}
+
+	repository.full.Store(true)
+	var diskErr *persistence.DiskFullError
+	if err := manager.SaveStateSync(); !errors.As(err, &diskErr) {
+		t.Fatalf("SaveStateSync() on a full disk = %v, want DiskFullError", err)
+	}
+	if health := nextHealth(); !health.Degraded || health.Available != 1024 {
+		t.Errorf("degraded event = %+v", health)
+	}
+	if result := manager.StorageHealthCheck().CheckFunc(); result.Healthy {
+		t.Errorf("health check passes while saves are paused: %+v", result)
+	}
+
+	// Autosave stays paused rather than failing every tick
+	saves := repository.saves.Load()
+	time.Sleep(50 * time.Millisecond)
+	if repository.saves.Load() != saves {
+		t.Errorf("autosave wrote while the disk was full")
+	}
+
+	repository.full.Store(false)
+	if health := nextHealth(); health.Degraded {
+		t.Errorf("resume event = %+v", health)
+	}
+	if repository.saves.Load() == saves || manager.StorageHealth().Degraded {
+		t.Errorf("autosave did not resume")
+	}
+}
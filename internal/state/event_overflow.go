@@ -0,0 +1,278 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// DefaultEventOverflowSize bounds the disk used by spilled events; half of it
+// is kept in the rotated file
+const DefaultEventOverflowSize = 16 * 1024 * 1024
+
+// EventOverflow keeps events evicted from the in-memory history in a JSON-lines
+// file so replays can reach further back than the memory buffer. The active file
+// rotates into a single ".1" generation; events rotated out of that are lost.
+type EventOverflow struct {
+	path     string
+	maxSize  int64
+	fileMode os.FileMode
+
+	file   *os.File
+	writer *bufio.Writer
+	mutex  sync.Mutex
+
+	activeEvents  int64
+	activeBytes   int64
+	activeOldest  int64
+	rotatedEvents int64
+	rotatedBytes  int64
+	rotatedOldest int64
+	dropped       int64
+}
+
+// OpenEventOverflow creates the overflow file at path. Events from a previous
+// run are discarded: clients reload full state when they reconnect to a new daemon.
+func OpenEventOverflow(path string, maxSize int64, fileMode os.FileMode) (*EventOverflow, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultEventOverflowSize
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create event overflow directory: %w", err)
+	}
+	os.Remove(path + ".1")
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, fileMode)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event overflow: %w", err)
+	}
+
+	return &EventOverflow{
+		path:     path,
+		maxSize:  maxSize,
+		fileMode: fileMode,
+		file:     file,
+		writer:   bufio.NewWriter(file),
+	}, nil
+}
+
+// Path returns the active overflow file
+func (o *EventOverflow) Path() string {
+	return o.path
+}
+
+// Append writes evicted events, rotating once the active file holds half the budget
+func (o *EventOverflow) Append(events []types.StateEvent) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return fmt.Errorf("event overflow is closed")
+	}
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		data = append(data, '\n')
+
+		if o.activeBytes > 0 && o.activeBytes+int64(len(data)) > o.maxSize/2 {
+			if err := o.rotateLocked(); err != nil {
+				return err
+			}
+		}
+
+		n, err := o.writer.Write(data)
+		o.activeBytes += int64(n)
+		if err != nil {
+			return fmt.Errorf("failed to write event %s: %w", event.ID, err)
+		}
+		o.activeEvents++
+		if o.activeOldest == 0 && event.Version > 0 {
+			o.activeOldest = event.Version
+		}
+	}
+	return nil
+}
+
+// rotateLocked moves the active file to ".1", dropping the previous generation
+func (o *EventOverflow) rotateLocked() error {
+	if err := o.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush event overflow: %w", err)
+	}
+	o.file.Close()
+	o.file = nil
+
+	if err := os.Rename(o.path, o.path+".1"); err != nil {
+		return fmt.Errorf("failed to rotate event overflow: %w", err)
+	}
+
+	file, err := os.OpenFile(o.path, os.O_CREATE|os.O_RDWR|os.O_TRUNC, o.fileMode)
+	if err != nil {
+		return fmt.Errorf("failed to reopen event overflow: %w", err)
+	}
+
+	o.dropped += o.rotatedEvents
+	o.rotatedEvents, o.rotatedBytes, o.rotatedOldest = o.activeEvents, o.activeBytes, o.activeOldest
+	o.activeEvents, o.activeBytes, o.activeOldest = 0, 0, 0
+	o.file = file
+	o.writer.Reset(file)
+	return nil
+}
+
+// ReadSince returns spilled events newer than version, oldest first
+func (o *EventOverflow) ReadSince(version int64) ([]types.StateEvent, error) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file != nil {
+		if err := o.writer.Flush(); err != nil {
+			return nil, fmt.Errorf("failed to flush event overflow: %w", err)
+		}
+	}
+
+	var events []types.StateEvent
+	for _, path := range []string{o.path + ".1", o.path} {
+		data, err := os.ReadFile(path)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read event overflow: %w", err)
+		}
+
+		for _, line := range bytes.Split(data, []byte{'\n'}) {
+			if len(line) == 0 {
+				continue
+			}
+			var event types.StateEvent
+			if err := json.Unmarshal(line, &event); err != nil {
+				return nil, fmt.Errorf("corrupt event in %s: %w", path, err)
+			}
+			if event.Version > version {
+				events = append(events, event)
+			}
+		}
+	}
+	return events, nil
+}
+
+// Rewrite passes every spilled event to rewrite and replaces each file in
+// which it changed an event, so nothing it removed is left on disk
+func (o *EventOverflow) Rewrite(rewrite func(event *types.StateEvent) bool) error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return fmt.Errorf("event overflow is closed")
+	}
+	if err := o.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush event overflow: %w", err)
+	}
+
+	if _, err := o.rewriteFileLocked(o.path+".1", rewrite); err != nil {
+		return err
+	}
+	size, err := o.rewriteFileLocked(o.path, rewrite)
+	if err != nil || size < 0 {
+		return err
+	}
+
+	// The active file was replaced; append to the new one
+	o.file.Close()
+	file, err := os.OpenFile(o.path, os.O_RDWR|os.O_APPEND, o.fileMode)
+	if err != nil {
+		o.file = nil
+		return fmt.Errorf("failed to reopen event overflow: %w", err)
+	}
+	o.file = file
+	o.writer.Reset(file)
+	o.activeBytes = size
+	return nil
+}
+
+// rewriteFileLocked rewrites the events in path, replacing the file only when
+// an event changed. It returns the new size, or -1 if the file was left alone.
+func (o *EventOverflow) rewriteFileLocked(path string, rewrite func(event *types.StateEvent) bool) (int64, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return -1, nil
+	}
+	if err != nil {
+		return -1, fmt.Errorf("failed to read event overflow: %w", err)
+	}
+
+	var out bytes.Buffer
+	changed := false
+	for _, line := range bytes.Split(data, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		var event types.StateEvent
+		if err := json.Unmarshal(line, &event); err != nil {
+			return -1, fmt.Errorf("corrupt event in %s: %w", path, err)
+		}
+		if rewrite(&event) {
+			changed = true
+			if line, err = json.Marshal(event); err != nil {
+				return -1, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+			}
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if !changed {
+		return -1, nil
+	}
+
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, out.Bytes(), o.fileMode); err != nil {
+		os.Remove(temp)
+		return -1, fmt.Errorf("failed to rewrite event overflow: %w", err)
+	}
+	if err := os.Rename(temp, path); err != nil {
+		os.Remove(temp)
+		return -1, fmt.Errorf("failed to replace event overflow: %w", err)
+	}
+	if path != o.path {
+		o.rotatedBytes = int64(out.Len())
+	}
+	return int64(out.Len()), nil
+}
+
+// Stats returns the retained event count and bytes, the oldest retained state
+// version and the number of events rotated out
+func (o *EventOverflow) Stats() (events, size, oldest, dropped int64) {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	oldest = o.rotatedOldest
+	if oldest == 0 {
+		oldest = o.activeOldest
+	}
+	return o.activeEvents + o.rotatedEvents, o.activeBytes + o.rotatedBytes, oldest, o.dropped
+}
+
+// Close flushes and closes the active file; the files are left for inspection
+func (o *EventOverflow) Close() error {
+	o.mutex.Lock()
+	defer o.mutex.Unlock()
+
+	if o.file == nil {
+		return nil
+	}
+	flushErr := o.writer.Flush()
+	closeErr := o.file.Close()
+	o.file = nil
+	if flushErr != nil {
+		return fmt.Errorf("failed to flush event overflow: %w", flushErr)
+	}
+	return closeErr
+}
@@ -3,20 +3,38 @@ package state
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/ids"
 	"github.com/opencode/tmux_coder/internal/interfaces"
 	"github.com/opencode/tmux_coder/internal/types"
 )
 
+// A subscriber that drops SustainedDrops events within DropWindow is lagging,
+// which fails the delivery health check until its drops age out
+const (
+	SustainedDrops = 5
+	DropWindow     = 30 * time.Second
+)
+
 // EventBus manages event distribution across panels
 type EventBus struct {
 	subscribers    map[string]chan types.StateEvent
 	subscriberMeta map[string]interfaces.SubscriberInfo
+	recentDrops    map[string][]time.Time               // Drop times within DropWindow, by connection
+	retired        map[string]interfaces.SubscriberInfo // Last subscription of panel identities now disconnected
 	mutex          sync.RWMutex
 	eventHistory   []types.StateEvent
 	maxHistory     int
+	overflow       *EventOverflow
+	evicted        int64 // Events dropped with no overflow attached
+	overflowErrors int64
+	closed         bool // Set by Close; later events are discarded
+	clock          clock.Clock
 }
 
 // NewEventBus creates a new event bus for state notifications
@@ -24,23 +42,55 @@ func NewEventBus(maxHistory int) *EventBus {
 	return &EventBus{
 		subscribers:    make(map[string]chan types.StateEvent),
 		subscriberMeta: make(map[string]interfaces.SubscriberInfo),
+		recentDrops:    make(map[string][]time.Time),
+		retired:        make(map[string]interfaces.SubscriberInfo),
 		eventHistory:   make([]types.StateEvent, 0, maxHistory),
 		maxHistory:     maxHistory,
+		clock:          clock.Real,
 	}
 }
 
+// SetClock replaces the clock that stamps subscriptions, deliveries and drops;
+// nil restores the system clock. Close still waits in real time.
+func (bus *EventBus) SetClock(c clock.Clock) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.clock = clock.Or(c)
+}
+
 // Subscribe registers a panel for state change notifications
 func (bus *EventBus) Subscribe(connectionID, panelID, panelType string, eventChan chan types.StateEvent) {
+	bus.SubscribeWithCapabilities(connectionID, panelID, panelType, nil, eventChan)
+}
+
+// SubscribeWithCapabilities registers a panel that declared its capabilities;
+// it is only sent the UI actions and diff-bearing events it can handle
+func (bus *EventBus) SubscribeWithCapabilities(connectionID, panelID, panelType string, capabilities *types.PanelCapabilities, eventChan chan types.StateEvent) {
+	bus.SubscribeWithIdentity(connectionID, panelID, panelType, "", capabilities, false, eventChan)
+}
+
+// SubscribeWithIdentity registers a panel under the stable identity the
+// orchestrator gave it. A new process taking over an identity keeps the
+// counters of the one before it and, with replay set, is first sent the
+// retained events that process was never queued.
+func (bus *EventBus) SubscribeWithIdentity(connectionID, panelID, panelType, identity string, capabilities *types.PanelCapabilities, replay bool, eventChan chan types.StateEvent) {
 	bus.mutex.Lock()
 	defer bus.mutex.Unlock()
 
+	if bus.closed {
+		// Closing the channel tells the subscriber there is nothing more to come
+		log.Printf("Event bus is closed; not subscribing panel %s (connection %s)", panelID, connectionID)
+		close(eventChan)
+		return
+	}
+
 	// Remove any existing subscriptions for this connection ID
 	bus.removeSubscriberLocked(connectionID, fmt.Sprintf("connection %s re-registered", connectionID))
 
 	// Remove stale subscriptions for the same panel ID to avoid overlap
 	var staleConnections []string
 	for existingConnID, meta := range bus.subscriberMeta {
-		if meta.PanelID == panelID {
+		if meta.PanelID == panelID || (identity != "" && meta.Identity == identity) {
 			staleConnections = append(staleConnections, existingConnID)
 		}
 	}
@@ -48,24 +98,42 @@ func (bus *EventBus) Subscribe(connectionID, panelID, panelType string, eventCha
 		bus.removeSubscriberLocked(staleConnID, fmt.Sprintf("panel %s replaced by connection %s", panelID, connectionID))
 	}
 
-	bus.subscribers[connectionID] = eventChan
-	bus.subscriberMeta[connectionID] = interfaces.SubscriberInfo{
+	meta := interfaces.SubscriberInfo{
 		ConnectionID: connectionID,
 		PanelID:      panelID,
 		PanelType:    panelType,
-		ConnectedAt:  time.Now(),
+		ConnectedAt:  bus.clock.Now(),
 		EventCount:   0,
+		Capabilities: capabilities,
+		Identity:     identity,
+	}
+	previous, respawned := bus.retired[identity]
+	if identity != "" && respawned {
+		delete(bus.retired, identity)
+		meta.EventCount = previous.EventCount
+		meta.Delivered = previous.Delivered
+		meta.Dropped = previous.Dropped
+		meta.LastDropAt = previous.LastDropAt
+		meta.Resyncs = previous.Resyncs
+		meta.LastVersion = previous.LastVersion
+		meta.Respawns = previous.Respawns + 1
 	}
+	bus.subscribers[connectionID] = eventChan
+	bus.subscriberMeta[connectionID] = meta
 
 	log.Printf("Panel %s (%s) subscribed to events with connection %s", panelID, panelType, connectionID)
 
+	if identity != "" && respawned && replay {
+		bus.replayLocked(connectionID, previous.LastVersion)
+	}
+
 	// Notify other panels about new connection
 	connectEvent := types.StateEvent{
 		ID:          generateEventID(),
 		Type:        types.EventPanelConnected,
 		Data:        types.PanelConnectionPayload{PanelID: panelID, PanelType: panelType},
 		SourcePanel: "system",
-		Timestamp:   time.Now(),
+		Timestamp:   bus.clock.Now(),
 	}
 	bus.broadcastUnsafe(connectEvent, panelID)
 }
@@ -78,90 +146,301 @@ func (bus *EventBus) Unsubscribe(connectionID string) {
 	bus.removeSubscriberLocked(connectionID, "")
 }
 
-// Broadcast sends events to all registered panels except the source
+// Broadcast sends events to all registered panels except the source. The
+// event is sealed first, outside the lock, so subscribers share one encoding.
 func (bus *EventBus) Broadcast(event types.StateEvent) {
+	event = sealEvent(event)
+
 	bus.mutex.Lock()
 	defer bus.mutex.Unlock()
 
+	if bus.closed {
+		return
+	}
 	bus.broadcastUnsafe(event, event.SourcePanel)
 }
 
 // broadcastUnsafe sends events without acquiring locks (caller must hold lock)
 func (bus *EventBus) broadcastUnsafe(event types.StateEvent, excludePanel string) {
+	event = sealEvent(event)
+
 	// Add to event history
 	bus.addToHistoryUnsafe(event)
 
-	type pendingRemoval struct {
-		connectionID string
-		reason       string
+	if event.Type == types.EventStateBatch {
+		bus.deliverBatchLocked(event)
+		return
 	}
 
-	var toRemove []pendingRemoval
-
 	// Send to all subscribers except the source panel
-	for connectionID, eventChan := range bus.subscribers {
+	for connectionID := range bus.subscribers {
 		meta, hasMeta := bus.subscriberMeta[connectionID]
-		if hasMeta && meta.PanelID == excludePanel {
+		if hasMeta && (meta.PanelID == excludePanel || !meta.Capabilities.Accepts(event)) {
 			continue
 		}
+		bus.deliverLocked(connectionID, event)
+	}
+}
+
+// deliverBatchLocked hands a batch event to every subscriber: whole to those
+// that declared they take batches, else as the batch's events one at a time.
+// Either way a subscriber is only sent the events it accepts and did not
+// send itself (caller must hold lock).
+func (bus *EventBus) deliverBatchLocked(batch types.StateEvent) {
+	payload, members, ok := batchMembers(batch)
+	if !ok {
+		return
+	}
+	for connectionID := range bus.subscribers {
+		bus.deliverBatchToLocked(connectionID, batch, payload, members)
+	}
+}
+
+// batchMembers decodes a batch event and seals its events, each marked with
+// its place in the batch
+func batchMembers(batch types.StateEvent) (types.StateBatchPayload, []types.StateEvent, bool) {
+	payload, ok := batch.Data.(types.StateBatchPayload)
+	if !ok {
+		// Passed on from another bus, as a replica does
+		if err := decodePayload(batch.Data, &payload); err != nil {
+			log.Printf("Warning: dropping batch event %s: %v", batch.ID, err)
+			return payload, nil, false
+		}
+	}
+
+	members := make([]types.StateEvent, len(payload.Events))
+	for i, member := range payload.Events {
+		member.Batch = &types.BatchPosition{ID: batch.ID, Index: i, Size: len(payload.Events)}
+		member.Clock = batch.Clock
+		members[i] = sealEvent(member)
+	}
+	return payload, members, true
+}
 
-		if hasMeta {
-			meta.LastEventAt = time.Now()
-			meta.EventCount++
-			meta.ConnectionID = connectionID
-			bus.subscriberMeta[connectionID] = meta
+// deliverBatchToLocked hands a batch event to one subscriber (caller must hold lock)
+func (bus *EventBus) deliverBatchToLocked(connectionID string, batch types.StateEvent, payload types.StateBatchPayload, members []types.StateEvent) {
+	meta, hasMeta := bus.subscriberMeta[connectionID]
+	accepted := members
+	if hasMeta {
+		accepted = make([]types.StateEvent, 0, len(members))
+		for _, member := range members {
+			if member.SourcePanel != meta.PanelID && meta.Capabilities.Accepts(member) {
+				accepted = append(accepted, member)
+			}
+		}
+	}
+
+	switch {
+	case len(accepted) == 0:
+	case !hasMeta || meta.Capabilities == nil || !meta.Capabilities.Batches:
+		for _, member := range accepted {
+			bus.deliverLocked(connectionID, member)
+		}
+	case len(accepted) == len(members):
+		bus.deliverLocked(connectionID, batch)
+	default:
+		subset := types.StateBatchPayload{Events: make([]types.StateEvent, len(accepted))}
+		for i, member := range accepted {
+			subset.Events[i] = payload.Events[member.Batch.Index]
 		}
+		bus.deliverLocked(connectionID, sealEvent(types.StateEvent{
+			ID:          batch.ID,
+			Type:        batch.Type,
+			Topic:       batch.Topic,
+			Data:        subset,
+			Version:     batch.Version,
+			Clock:       batch.Clock,
+			SourcePanel: batch.SourcePanel,
+			Timestamp:   batch.Timestamp,
+			TraceParent: batch.TraceParent,
+		}))
+	}
+}
+
+// replayLocked queues for one subscriber the retained events after version
+// that broadcasting them would have sent it (caller must hold lock)
+func (bus *EventBus) replayLocked(connectionID string, version int64) {
+	meta := bus.subscriberMeta[connectionID]
+	events, complete, err := bus.eventsSinceLocked(version)
+	if err != nil {
+		log.Printf("Warning: cannot replay events to panel %s: %v", meta.PanelID, err)
+		return
+	}
+	if !complete {
+		log.Printf("Warning: some events panel %s missed since version %d are no longer retained", meta.PanelID, version)
+	}
+	log.Printf("Replaying %d events to panel %s (identity %s) since version %d", len(events), meta.PanelID, meta.Identity, version)
 
-		// Try to send event (non-blocking)
-		select {
-		case eventChan <- event:
-			// Event delivered successfully
-		default:
-			// Channel full, log warning but continue
-			panelLabel := fmt.Sprintf("connection:%s", connectionID)
-			if hasMeta && meta.PanelID != "" {
-				panelLabel = meta.PanelID
+	for _, event := range events {
+		if event.Type == types.EventStateBatch {
+			if payload, members, ok := batchMembers(event); ok {
+				bus.deliverBatchToLocked(connectionID, event, payload, members)
 			}
-			log.Printf("Warning: Event channel full for %s (connection %s), dropping event %s and disconnecting subscriber",
+			continue
+		}
+		if event.SourcePanel != meta.PanelID && meta.Capabilities.Accepts(event) {
+			bus.deliverLocked(connectionID, event)
+		}
+	}
+}
+
+// deliverLocked queues an event for one subscriber without blocking. A full
+// queue drops the event and leaves the subscriber behind until a full state
+// sync catches it up (caller must hold lock).
+func (bus *EventBus) deliverLocked(connectionID string, event types.StateEvent) {
+	now := bus.clock.Now()
+	meta, hasMeta := bus.subscriberMeta[connectionID]
+	if !hasMeta {
+		meta = interfaces.SubscriberInfo{ConnectionID: connectionID}
+	}
+	meta.ConnectionID = connectionID
+	meta.LastEventAt = now
+	meta.EventCount++
+	// A dropped event uses up its number, so the panel sees the gap
+	meta.Sequence++
+	event.Sequence = meta.Sequence
+
+	select {
+	case bus.subscribers[connectionID] <- event:
+		meta.Delivered++
+		meta.LastVersion = max(meta.LastVersion, event.Version)
+	default:
+		meta.Dropped++
+		meta.LastDropAt = now
+		meta.Behind = true
+		drops := append(recentSince(bus.recentDrops[connectionID], now.Add(-DropWindow)), now)
+		bus.recentDrops[connectionID] = drops
+
+		panelLabel := fmt.Sprintf("connection:%s", connectionID)
+		if meta.PanelID != "" {
+			panelLabel = meta.PanelID
+		}
+		if len(drops) == SustainedDrops {
+			log.Printf("Warning: %s (connection %s) dropped %d events within %v; it will be resynced once its queue drains",
+				panelLabel, connectionID, len(drops), DropWindow)
+		} else if len(drops) < SustainedDrops {
+			log.Printf("Warning: Event channel full for %s (connection %s), dropping event %s",
 				panelLabel, connectionID, event.Type)
+		}
+	}
+	bus.subscriberMeta[connectionID] = meta
+}
 
-			reason := fmt.Sprintf("event channel overflow while delivering %s", event.Type)
-			toRemove = append(toRemove, pendingRemoval{
-				connectionID: connectionID,
-				reason:       reason,
-			})
+// sealEvent encodes an event once for all its subscribers. An event that does
+// not encode is delivered unsealed; sending it will fail the same way.
+func sealEvent(event types.StateEvent) types.StateEvent {
+	sealed, err := types.SealEvent(event)
+	if err != nil {
+		log.Printf("Warning: failed to encode event %s (%s): %v", event.Type, event.ID, err)
+	}
+	return sealed
+}
+
+// recentSince drops the times before cutoff from an ascending list
+func recentSince(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+// infoLocked returns a subscriber's info with its lagging status as of now (caller must hold lock)
+func (bus *EventBus) infoLocked(connectionID string, now time.Time) interfaces.SubscriberInfo {
+	info := bus.subscriberMeta[connectionID]
+	info.Lagging = len(recentSince(bus.recentDrops[connectionID], now.Add(-DropWindow))) >= SustainedDrops
+	return info
+}
+
+// resyncCandidates returns the connections that dropped events and now have
+// room in their queue for a full state sync
+func (bus *EventBus) resyncCandidates() []string {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	var candidates []string
+	for connectionID, meta := range bus.subscriberMeta {
+		eventChan := bus.subscribers[connectionID]
+		if meta.Behind && eventChan != nil && len(eventChan) < cap(eventChan)/2+1 {
+			candidates = append(candidates, connectionID)
 		}
 	}
+	return candidates
+}
+
+// deliverResync sends a full state sync to a subscriber that fell behind. It is
+// not added to the history, and a subscriber still full stays behind.
+func (bus *EventBus) deliverResync(connectionID string, event types.StateEvent) bool {
+	event = sealEvent(event)
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	meta, ok := bus.subscriberMeta[connectionID]
+	if !ok || !meta.Behind {
+		return false
+	}
+	event.Sequence = meta.Sequence + 1
+	select {
+	case bus.subscribers[connectionID] <- event:
+	default:
+		return false
+	}
+	meta.Sequence++
+	meta.Behind = false
+	meta.Resyncs++
+	meta.LastEventAt = bus.clock.Now()
+	bus.subscriberMeta[connectionID] = meta
+	log.Printf("Resynced %s (connection %s) after %d dropped events", meta.PanelID, connectionID, meta.Dropped)
+	return true
+}
 
-	for _, removal := range toRemove {
-		bus.removeSubscriberLocked(removal.connectionID, removal.reason)
+// LaggingSubscribers returns the subscribers dropping events persistently
+func (bus *EventBus) LaggingSubscribers() []interfaces.SubscriberInfo {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	now := bus.clock.Now()
+	var lagging []interfaces.SubscriberInfo
+	for connectionID := range bus.subscriberMeta {
+		if info := bus.infoLocked(connectionID, now); info.Lagging {
+			lagging = append(lagging, info)
+		}
 	}
+	return lagging
 }
 
 // BroadcastToPanel sends an event specifically to one panel
 func (bus *EventBus) BroadcastToPanel(event types.StateEvent, targetPanel string) {
+	event = sealEvent(event)
+
 	bus.mutex.Lock()
 	defer bus.mutex.Unlock()
 
-	for connectionID, eventChan := range bus.subscribers {
+	if bus.closed {
+		return
+	}
+
+	for connectionID := range bus.subscribers {
 		meta, exists := bus.subscriberMeta[connectionID]
 		if !exists || meta.PanelID != targetPanel {
 			continue
 		}
+		bus.deliverLocked(connectionID, event)
+	}
+}
 
-		meta.LastEventAt = time.Now()
-		meta.EventCount++
-		meta.ConnectionID = connectionID
-		bus.subscriberMeta[connectionID] = meta
-
-		select {
-		case eventChan <- event:
-			// Event delivered successfully
-		default:
-			log.Printf("Warning: Event channel full for panel %s (connection %s), dropping targeted event %s",
-				targetPanel, connectionID, event.Type)
+// HandlesAction reports whether a panel other than excludePanel handles a UI action
+func (bus *EventBus) HandlesAction(action types.UIAction, excludePanel string) bool {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+
+	for _, meta := range bus.subscriberMeta {
+		if meta.PanelID != excludePanel && meta.Capabilities.HandlesAction(action) {
+			return true
 		}
 	}
+	return false
 }
 
 // GetSubscribers returns information about all current subscribers
@@ -169,9 +448,10 @@ func (bus *EventBus) GetSubscribers() map[string]interfaces.SubscriberInfo {
 	bus.mutex.RLock()
 	defer bus.mutex.RUnlock()
 
+	now := bus.clock.Now()
 	subscribers := make(map[string]interfaces.SubscriberInfo)
-	for connectionID, info := range bus.subscriberMeta {
-		subscribers[connectionID] = info
+	for connectionID := range bus.subscriberMeta {
+		subscribers[connectionID] = bus.infoLocked(connectionID, now)
 	}
 	return subscribers
 }
@@ -194,6 +474,10 @@ func (bus *EventBus) removeSubscriberLocked(connectionID string, reason string)
 
 	delete(bus.subscribers, connectionID)
 	delete(bus.subscriberMeta, connectionID)
+	delete(bus.recentDrops, connectionID)
+	if meta.Identity != "" {
+		bus.retired[meta.Identity] = meta
+	}
 
 	close(eventChan)
 
@@ -217,11 +501,87 @@ func (bus *EventBus) removeSubscriberLocked(connectionID string, reason string)
 		Type:        types.EventPanelDisconnected,
 		Data:        types.PanelConnectionPayload{PanelID: meta.PanelID, PanelType: meta.PanelType},
 		SourcePanel: "system",
-		Timestamp:   time.Now(),
+		Timestamp:   bus.clock.Now(),
 	}
 	bus.broadcastUnsafe(disconnectEvent, meta.PanelID)
 }
 
+// closeDrainPoll is how often Close checks whether subscribers have drained
+const closeDrainPoll = 10 * time.Millisecond
+
+// Close stops accepting events and subscriptions, then sends every subscriber
+// a final EventShutdown after whatever it still has queued. Subscribers get
+// until timeout to take the shutdown event and drain their queue; then every
+// channel is closed whether drained or not, and the ones that were not are
+// reported in the error. Unsubscribes wait until Close returns.
+func (bus *EventBus) Close(reason string, timeout time.Duration) error {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	if bus.closed {
+		return nil
+	}
+	bus.closed = true
+	deadline := time.Now().Add(timeout)
+
+	final := types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventShutdown,
+		Data:        types.ShutdownPayload{Reason: reason},
+		SourcePanel: "system",
+		Timestamp:   bus.clock.Now(),
+	}
+	// One slow subscriber must not use up the others' time, so every pass
+	// offers the shutdown event to each without blocking
+	notified := make(map[string]bool, len(bus.subscribers))
+	pending := make(map[string]bool, len(bus.subscribers))
+	for connectionID := range bus.subscribers {
+		pending[connectionID] = true
+	}
+	for {
+		for connectionID := range pending {
+			eventChan := bus.subscribers[connectionID]
+			if !notified[connectionID] {
+				select {
+				case eventChan <- final:
+					notified[connectionID] = true
+				default:
+				}
+			}
+			if notified[connectionID] && len(eventChan) == 0 {
+				delete(pending, connectionID)
+			}
+		}
+		if len(pending) == 0 || !time.Now().Before(deadline) {
+			break
+		}
+		time.Sleep(closeDrainPoll)
+	}
+
+	var stuck []string
+	for connectionID, eventChan := range bus.subscribers {
+		if pending[connectionID] {
+			label := connectionID
+			if meta, ok := bus.subscriberMeta[connectionID]; ok && meta.PanelID != "" {
+				label = meta.PanelID
+			}
+			stuck = append(stuck, fmt.Sprintf("%s (%d queued)", label, len(eventChan)))
+		}
+		close(eventChan)
+	}
+	count := len(bus.subscribers)
+	bus.subscribers = make(map[string]chan types.StateEvent)
+	bus.subscriberMeta = make(map[string]interfaces.SubscriberInfo)
+	bus.recentDrops = make(map[string][]time.Time)
+
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("%d of %d subscribers did not drain within %v: %s", len(stuck), count, timeout, strings.Join(stuck, ", "))
+	}
+	log.Printf("Event bus closed; %d subscribers drained", count)
+	return nil
+}
+
 // GetEventHistory returns recent events from the history buffer
 func (bus *EventBus) GetEventHistory(maxEvents int) []types.StateEvent {
 	bus.mutex.RLock()
@@ -239,69 +599,234 @@ func (bus *EventBus) GetEventHistory(maxEvents int) []types.StateEvent {
 	return events
 }
 
+// RewriteHistory passes every event kept for replay, in memory and in the
+// overflow, to rewrite, and keeps the events it changes in their new form.
+// Redactions use it so replays do not resend the content they removed.
+func (bus *EventBus) RewriteHistory(rewrite func(event *types.StateEvent) bool) error {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for i := range bus.eventHistory {
+		if rewrite(&bus.eventHistory[i]) {
+			bus.eventHistory[i] = sealEvent(bus.eventHistory[i])
+		}
+	}
+	if bus.overflow != nil {
+		return bus.overflow.Rewrite(rewrite)
+	}
+	return nil
+}
+
 // addToHistoryUnsafe adds an event to the history buffer (caller must hold lock)
 func (bus *EventBus) addToHistoryUnsafe(event types.StateEvent) {
 	bus.eventHistory = append(bus.eventHistory, event)
 
 	// Maintain maximum history size
-	if len(bus.eventHistory) > bus.maxHistory {
-		// Remove oldest events
-		copy(bus.eventHistory, bus.eventHistory[1:])
-		bus.eventHistory = bus.eventHistory[:bus.maxHistory]
+	bus.trimHistoryLocked()
+}
+
+// trimHistoryLocked evicts the oldest events beyond maxHistory, spilling them to
+// the overflow when one is attached (caller must hold lock)
+func (bus *EventBus) trimHistoryLocked() {
+	excess := len(bus.eventHistory) - bus.maxHistory
+	if excess <= 0 {
+		return
 	}
+
+	if bus.overflow != nil {
+		if err := bus.overflow.Append(bus.eventHistory[:excess]); err != nil {
+			bus.overflowErrors++
+			bus.evicted += int64(excess)
+			log.Printf("Failed to spill %d events to overflow: %v", excess, err)
+		}
+	} else {
+		bus.evicted += int64(excess)
+	}
+
+	// Remove oldest events
+	copy(bus.eventHistory, bus.eventHistory[excess:])
+	bus.eventHistory = bus.eventHistory[:bus.maxHistory]
+}
+
+// SetMaxHistory changes the in-memory history size; events beyond the new size
+// are evicted immediately
+func (bus *EventBus) SetMaxHistory(maxHistory int) {
+	if maxHistory < 0 {
+		maxHistory = 0
+	}
+
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	bus.maxHistory = maxHistory
+	bus.trimHistoryLocked()
 }
 
+// SetOverflow spills events evicted from memory to overflow instead of dropping
+// them; nil detaches it. The caller owns overflow and closes it.
+func (bus *EventBus) SetOverflow(overflow *EventOverflow) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+	bus.overflow = overflow
+}
+
+// GetEventsSince returns retained state events newer than version, oldest first.
+// Events without a state version, such as panel connections, are skipped.
+// complete is false when events after version have been dropped, in which case
+// the caller should reload full state instead.
+func (bus *EventBus) GetEventsSince(version int64) ([]types.StateEvent, bool, error) {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+	return bus.eventsSinceLocked(version)
+}
+
+// eventsSinceLocked is GetEventsSince for callers holding the lock
+func (bus *EventBus) eventsSinceLocked(version int64) ([]types.StateEvent, bool, error) {
+	var events []types.StateEvent
+	if bus.overflow != nil {
+		spilled, err := bus.overflow.ReadSince(version)
+		if err != nil {
+			return nil, false, err
+		}
+		events = spilled
+	}
+	for _, event := range bus.eventHistory {
+		if event.Version > version {
+			events = append(events, event)
+		}
+	}
+
+	stats := bus.historyStatsLocked()
+	complete := stats.Evicted == 0 || (stats.OldestVersion > 0 && stats.OldestVersion <= version+1)
+	return events, complete, nil
+}
+
+// GetHistoryStats reports event history occupancy in memory and on disk
+func (bus *EventBus) GetHistoryStats() interfaces.EventHistoryStats {
+	bus.mutex.RLock()
+	defer bus.mutex.RUnlock()
+	return bus.historyStatsLocked()
+}
+
+func (bus *EventBus) historyStatsLocked() interfaces.EventHistoryStats {
+	stats := interfaces.EventHistoryStats{
+		Capacity:       bus.maxHistory,
+		InMemory:       len(bus.eventHistory),
+		Evicted:        bus.evicted,
+		OverflowErrors: bus.overflowErrors,
+	}
+
+	if bus.overflow != nil {
+		var dropped int64
+		stats.OverflowEvents, stats.OverflowBytes, stats.OldestVersion, dropped = bus.overflow.Stats()
+		stats.OverflowPath = bus.overflow.Path()
+		stats.Evicted += dropped
+	}
+	if stats.OldestVersion == 0 {
+		for _, event := range bus.eventHistory {
+			if event.Version > 0 {
+				stats.OldestVersion = event.Version
+				break
+			}
+		}
+	}
+	return stats
+}
+
+// updateEvents maps each update type to the event its application broadcasts.
+// Redactions are re-broadcast as regular message updates so every panel
+// replaces its copy of the content. Other update types broadcast a state sync.
+var updateEvents = map[types.UpdateType]types.StateEventType{
+	types.SessionChanged:          types.EventSessionChanged,
+	types.SessionAdded:            types.EventSessionAdded,
+	types.SessionDeleted:          types.EventSessionDeleted,
+	types.SessionUpdated:          types.EventSessionUpdated,
+	types.MessageAdded:            types.EventMessageAdded,
+	types.MessageUpdated:          types.EventMessageUpdated,
+	types.MessageRedacted:         types.EventMessageUpdated,
+	types.MessageDeleted:          types.EventMessageDeleted,
+	types.MessageAttributed:       types.EventMessageAttributed,
+	types.MessagesCleared:         types.EventMessagesCleared,
+	types.InputUpdated:            types.EventInputUpdated,
+	types.CursorMoved:             types.EventCursorMoved,
+	types.ThemeChanged:            types.EventThemeChanged,
+	types.ModelChanged:            types.EventModelChanged,
+	types.AgentChanged:            types.EventAgentChanged,
+	types.AgentModelCleared:       types.EventAgentModelCleared,
+	types.UIActionTriggered:       types.EventUIActionTriggered,
+	types.AnnotationAdded:         types.EventAnnotationAdded,
+	types.AnnotationUpdated:       types.EventAnnotationUpdated,
+	types.AnnotationRemoved:       types.EventAnnotationRemoved,
+	types.SessionLocked:           types.EventSessionLocked,
+	types.SessionUnlocked:         types.EventSessionUnlocked,
+	types.StateCompacted:          types.EventStateCompacted,
+	types.PromptSubmitted:         types.EventPromptSubmitted,
+	types.GitStatusChanged:        types.EventGitStatusChanged,
+	types.FileDiffReady:           types.EventFileDiffReady,
+	types.FileDiffResolved:        types.EventFileDiffResolved,
+	types.FileTreeChanged:         types.EventFileTreeChanged,
+	types.TerminalRunStarted:      types.EventTerminalRunStarted,
+	types.TerminalRunFinished:     types.EventTerminalRunFinished,
+	types.InputLocationChanged:    types.EventInputLocationChanged,
+	types.PromptContextUpdated:    types.EventPromptContextUpdated,
+	types.RunStarted:              types.EventRunStarted,
+	types.RunFinished:             types.EventRunFinished,
+	types.CancelRun:               types.EventRunCancelled,
+	types.RunAttempted:            types.EventRunAttempted,
+	types.ModelPolicyChanged:      types.EventModelPolicyChanged,
+	types.AgentRoutesChanged:      types.EventAgentRoutesChanged,
+	types.ContextUsageUpdated:     types.EventContextUsageUpdated,
+	types.ContextThreshold:        types.EventContextThreshold,
+	types.SessionCompacted:        types.EventSessionCompacted,
+	types.ConnectivityChanged:     types.EventConnectivityChanged,
+	types.SessionOrderChanged:     types.EventSessionOrderChanged,
+	types.SessionReordered:        types.EventSessionReordered,
+	types.SessionPinned:           types.EventSessionPinned,
+	types.WorkspaceChanged:        types.EventWorkspaceChanged,
+	types.PromptQueued:            types.EventPromptQueued,
+	types.PromptDequeued:          types.EventPromptDequeued,
+	types.PromptQueueReordered:    types.EventPromptQueueReordered,
+	types.PromptScheduled:         types.EventPromptScheduled,
+	types.PromptUnscheduled:       types.EventPromptUnscheduled,
+	types.ScheduledPromptRan:      types.EventScheduledPromptRan,
+	types.SessionTemplatesChanged: types.EventSessionTemplatesChanged,
+	types.ThreadCollapsed:         types.EventThreadCollapsed,
+	types.CodeBlocksExtracted:     types.EventCodeBlocksExtracted,
+	types.CodeBlockHandled:        types.EventCodeBlockHandled,
+	types.StateBatched:            types.EventStateBatch,
+}
+
+// eventUpdates maps an event back to the update type a replica applies it as
+var eventUpdates = func() map[types.StateEventType]types.UpdateType {
+	updates := make(map[types.StateEventType]types.UpdateType, len(updateEvents))
+	for updateType, eventType := range updateEvents {
+		if updateType != types.MessageRedacted {
+			updates[eventType] = updateType
+		}
+	}
+	return updates
+}()
+
 // CreateEventFromUpdate converts a state update to a state event
 func CreateEventFromUpdate(update types.StateUpdate, version int64) types.StateEvent {
-	var eventType types.StateEventType
-
-	// Map update types to event types
-	switch update.Type {
-	case types.SessionChanged:
-		eventType = types.EventSessionChanged
-	case types.SessionAdded:
-		eventType = types.EventSessionAdded
-	case types.SessionDeleted:
-		eventType = types.EventSessionDeleted
-	case types.SessionUpdated:
-		eventType = types.EventSessionUpdated
-	case types.MessageAdded:
-		eventType = types.EventMessageAdded
-	case types.MessageUpdated:
-		eventType = types.EventMessageUpdated
-	case types.MessageDeleted:
-		eventType = types.EventMessageDeleted
-	case types.MessagesCleared:
-		eventType = types.EventMessagesCleared
-	case types.InputUpdated:
-		eventType = types.EventInputUpdated
-	case types.CursorMoved:
-		eventType = types.EventCursorMoved
-	case types.ThemeChanged:
-		eventType = types.EventThemeChanged
-	case types.ModelChanged:
-		eventType = types.EventModelChanged
-	case types.AgentChanged:
-		eventType = types.EventAgentChanged
-	case types.UIActionTriggered:
-		eventType = types.EventUIActionTriggered
-	default:
+	eventType, ok := updateEvents[update.Type]
+	if !ok {
 		eventType = types.EventStateSync
 	}
 
 	return types.StateEvent{
 		ID:          generateEventID(),
 		Type:        eventType,
+		Topic:       types.TopicFor(eventType, update.Payload),
 		Data:        update.Payload,
 		Version:     version,
 		SourcePanel: update.SourcePanel,
 		Timestamp:   time.Now(),
+		TraceParent: update.TraceParent,
 	}
 }
 
 // generateEventID creates a unique identifier for events
 func generateEventID() string {
-	// Simple timestamp-based ID for now
-	// In production, consider using UUID or other unique ID generation
-	return time.Now().Format("20060102150405.000000")
+	return ids.New("event")
 }
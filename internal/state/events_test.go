@@ -0,0 +1,315 @@
+package state
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func broadcastVersions(bus *EventBus, from, to int64) {
+	for v := from; v <= to; v++ {
+		bus.Broadcast(types.StateEvent{
+			ID:          generateEventID(),
+			Type:        types.EventInputUpdated,
+			Data:        map[string]interface{}{"input": "x"},
+			SourcePanel: "test",
+			Timestamp:   time.Now(),
+			Version:     v,
+		})
+	}
+}
+
+func eventVersions(events []types.StateEvent) []int64 {
+	versions := make([]int64, len(events))
+	for i, event := range events {
+		versions[i] = event.Version
+	}
+	return versions
+}
+
+func TestEventHistoryOverflow(t *testing.T) {
+	tests := []struct {
+		name         string
+		overflow     bool
+		overflowSize int64
+		since        int64
+		wantFirst    int64
+		wantComplete bool
+	}{
+		{"memory only, recent", false, 0, 45, 46, true},
+		{"memory only, burst lost", false, 0, 10, 41, false},
+		{"overflow keeps burst", true, 1 << 20, 10, 11, true},
+		{"overflow rotated out", true, 2048, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bus := NewEventBus(10)
+			if tt.overflow {
+				overflow, err := OpenEventOverflow(filepath.Join(t.TempDir(), "state.events.log"), tt.overflowSize, 0600)
+				if err != nil {
+					t.Fatalf("OpenEventOverflow() error = %v", err)
+				}
+				defer overflow.Close()
+				bus.SetOverflow(overflow)
+			}
+
+			broadcastVersions(bus, 1, 50)
+
+			events, complete, err := bus.GetEventsSince(tt.since)
+			if err != nil {
+				t.Fatalf("GetEventsSince() error = %v", err)
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+			versions := eventVersions(events)
+			if len(versions) == 0 || versions[len(versions)-1] != 50 {
+				t.Fatalf("versions = %v, want to end at 50", versions)
+			}
+			for i := 1; i < len(versions); i++ {
+				if versions[i] != versions[i-1]+1 {
+					t.Fatalf("versions = %v, want contiguous", versions)
+				}
+			}
+			if tt.wantFirst > 0 && versions[0] != tt.wantFirst {
+				t.Errorf("first version = %d, want %d", versions[0], tt.wantFirst)
+			}
+
+			stats := bus.GetHistoryStats()
+			if stats.InMemory != 10 || stats.Capacity != 10 {
+				t.Errorf("stats = %+v, want 10/10 in memory", stats)
+			}
+			if tt.overflow && stats.OverflowEvents == 0 {
+				t.Errorf("stats = %+v, want spilled events", stats)
+			}
+			if (stats.Evicted == 0) != (tt.wantComplete && tt.overflow) {
+				t.Errorf("evicted = %d with complete=%v", stats.Evicted, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestEventBusSetMaxHistory(t *testing.T) {
+	bus := NewEventBus(20)
+	overflow, err := OpenEventOverflow(filepath.Join(t.TempDir(), "state.events.log"), 0, 0600)
+	if err != nil {
+		t.Fatalf("OpenEventOverflow() error = %v", err)
+	}
+	defer overflow.Close()
+	bus.SetOverflow(overflow)
+
+	broadcastVersions(bus, 1, 20)
+	bus.SetMaxHistory(5)
+
+	stats := bus.GetHistoryStats()
+	if stats.Capacity != 5 || stats.InMemory != 5 || stats.OverflowEvents != 15 || stats.OldestVersion != 1 {
+		t.Fatalf("stats after shrinking = %+v", stats)
+	}
+	if got := bus.GetEventHistory(0); len(got) != 5 || got[0].Version != 16 {
+		t.Fatalf("GetEventHistory() = %v, want versions 16-20", eventVersions(got))
+	}
+
+	events, complete, err := bus.GetEventsSince(0)
+	if err != nil || !complete || len(events) != 20 {
+		t.Fatalf("GetEventsSince(0) = %d events, complete=%v, err=%v", len(events), complete, err)
+	}
+
+	bus.SetMaxHistory(50)
+	broadcastVersions(bus, 21, 40)
+	if stats := bus.GetHistoryStats(); stats.InMemory != 25 || stats.OverflowEvents != 15 {
+		t.Fatalf("stats after growing = %+v", stats)
+	}
+}
+
+func TestEventBusClose(t *testing.T) {
+	bus := NewEventBus(100)
+	reader := make(chan types.StateEvent, 8)
+	stalled := make(chan types.StateEvent, 2)
+	bus.Subscribe("conn-stalled", "sessions", "sessions", stalled)
+	bus.Subscribe("conn-reader", "messages", "messages", reader)
+	broadcastVersions(bus, 1, 3)
+
+	// The reader starts late, so Close has to wait for it
+	received := make(chan []types.StateEvent)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		var events []types.StateEvent
+		for event := range reader {
+			events = append(events, event)
+		}
+		received <- events
+	}()
+
+	err := bus.Close("test over", 200*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "1 of 2") || !strings.Contains(err.Error(), "sessions") {
+		t.Errorf("Close() error = %v, want the stalled subscriber reported", err)
+	}
+
+	events := <-received
+	if len(events) != 4 || events[2].Version != 3 {
+		t.Fatalf("reader got %v, want the queued events then the shutdown", eventVersions(events))
+	}
+	if last := events[3]; last.Type != types.EventShutdown || last.Data.(types.ShutdownPayload).Reason != "test over" {
+		t.Errorf("last event = %+v, want the shutdown", last)
+	}
+	if _, open := <-stalled; open {
+		for range stalled {
+		}
+	}
+	if len(bus.GetSubscribers()) != 0 {
+		t.Errorf("subscribers left after close")
+	}
+
+	// Nothing is accepted once closed
+	broadcastVersions(bus, 4, 4)
+	late := make(chan types.StateEvent, 1)
+	bus.Subscribe("conn-late", "input", "input", late)
+	if _, open := <-late; open {
+		t.Errorf("late subscriber got an event")
+	}
+	if err := bus.Close("again", time.Millisecond); err != nil {
+		t.Errorf("second Close() error = %v", err)
+	}
+}
+
+func TestBroadcastSharesSealedEvent(t *testing.T) {
+	bus := NewEventBus(10)
+	var channels []chan types.StateEvent
+	for _, panelID := range []string{"a", "b", "c"} {
+		eventChan := make(chan types.StateEvent, 10)
+		bus.Subscribe("conn-"+panelID, panelID, "test", eventChan)
+		channels = append(channels, eventChan)
+	}
+	// Drain the connection notices
+	for _, eventChan := range channels {
+		for len(eventChan) > 0 {
+			<-eventChan
+		}
+	}
+
+	bus.Broadcast(types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventInputUpdated,
+		Data:        map[string]interface{}{"input": "x"},
+		SourcePanel: "test",
+		Version:     1,
+	})
+
+	var encodings [][]byte
+	for _, eventChan := range channels {
+		event := <-eventChan
+		if !event.Sealed() {
+			t.Fatalf("event %s delivered unsealed", event.ID)
+		}
+		encoded, err := event.MarshalJSON()
+		if err != nil {
+			t.Fatal(err)
+		}
+		encodings = append(encodings, encoded)
+		// Receivers that change the payload do not affect the others
+		event.Data.(map[string]interface{})["input"] = "changed"
+	}
+	for _, encoded := range encodings[1:] {
+		if &encoded[0] != &encodings[0][0] {
+			t.Error("subscribers were given separate encodings")
+		}
+	}
+	if !strings.Contains(string(encodings[0]), `"input":"x"`) {
+		t.Errorf("encoding = %s, want the original payload", encodings[0])
+	}
+}
+
+func TestEventBusSubscribeCyclesLeakNothing(t *testing.T) {
+	testutil.CheckLeaks(t)
+	bus := NewEventBus(10)
+
+	for i := 0; i < 50; i++ {
+		events := make(chan types.StateEvent, 10)
+		bus.Subscribe("conn", "panel-1", "test", events)
+		broadcastVersions(bus, int64(i*3+1), int64(i*3+3))
+		bus.Unsubscribe("conn")
+	}
+	if subscribers := bus.GetSubscribers(); len(subscribers) != 0 {
+		t.Errorf("%d subscribers left after unsubscribing", len(subscribers))
+	}
+
+	kept := make(chan types.StateEvent, 10)
+	bus.Subscribe("kept", "panel-2", "test", kept)
+	go func() {
+		for range kept {
+		}
+	}()
+	if err := bus.Close("test over", time.Second); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+}
+
+func TestEventBusIdentitySurvivesRespawn(t *testing.T) {
+	bus := NewEventBus(100)
+
+	first := make(chan types.StateEvent, 10)
+	bus.SubscribeWithIdentity("conn-1", "messages-panel", "messages", "s:0.1", nil, true, first)
+	broadcastVersions(bus, 1, 2)
+	bus.Unsubscribe("conn-1")
+
+	// Missed while no process held the identity, one of them sent by the panel itself
+	broadcastVersions(bus, 3, 4)
+	bus.Broadcast(types.StateEvent{ID: generateEventID(), Type: types.EventInputUpdated, SourcePanel: "messages-panel", Version: 5})
+
+	second := make(chan types.StateEvent, 10)
+	bus.SubscribeWithIdentity("conn-2", "messages-panel", "messages", "s:0.1", nil, true, second)
+	var replayed []types.StateEvent
+	for len(second) > 0 {
+		replayed = append(replayed, <-second)
+	}
+	if got := eventVersions(replayed); len(got) != 2 || got[0] != 3 || got[1] != 4 {
+		t.Errorf("replayed versions %v, want [3 4]", got)
+	}
+
+	info := bus.GetSubscribers()["conn-2"]
+	if info.Identity != "s:0.1" || info.Respawns != 1 || info.Delivered != 4 || info.LastVersion != 4 {
+		t.Errorf("subscriber after respawn = %+v", info)
+	}
+
+	// A process that catches up itself is not replayed to, and other
+	// identities start afresh
+	bus.Unsubscribe("conn-2")
+	broadcastVersions(bus, 6, 6)
+	third := make(chan types.StateEvent, 10)
+	bus.SubscribeWithIdentity("conn-3", "messages-panel", "messages", "s:0.1", nil, false, third)
+	if len(third) != 0 {
+		t.Errorf("reconnecting process was replayed %d events", len(third))
+	}
+	other := make(chan types.StateEvent, 10)
+	bus.SubscribeWithIdentity("conn-4", "input-panel", "input", "s:0.2", nil, true, other)
+	if info := bus.GetSubscribers()["conn-4"]; info.Respawns != 0 || len(other) != 0 {
+		t.Errorf("new identity = %+v with %d events queued", info, len(other))
+	}
+}
+
+func TestEventBusSequencesDeliveries(t *testing.T) {
+	bus := NewEventBus(100)
+	events := make(chan types.StateEvent, 2)
+	bus.Subscribe("conn", "panel-1", "test", events)
+
+	// The queue holds two; the next two are dropped but still numbered
+	broadcastVersions(bus, 1, 4)
+	var sequences []int64
+	for len(events) > 0 {
+		sequences = append(sequences, (<-events).Sequence)
+	}
+	broadcastVersions(bus, 5, 5)
+	sequences = append(sequences, (<-events).Sequence)
+
+	if len(sequences) != 3 || sequences[0] != 1 || sequences[1] != 2 || sequences[2] != 5 {
+		t.Errorf("sequences = %v, want [1 2 5]", sequences)
+	}
+	if info := bus.GetSubscribers()["conn"]; info.Sequence != 5 || info.Dropped != 2 {
+		t.Errorf("subscriber = %+v", info)
+	}
+}
@@ -0,0 +1,59 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// SessionExport is a self-contained snapshot of one conversation, including the
+// annotations captured while reviewing it.
+type SessionExport struct {
+	ExportedAt  time.Time                 `json:"exported_at"`
+	Version     int64                     `json:"state_version"`
+	Session     types.SessionInfo         `json:"session"`
+	Messages    []types.MessageInfo       `json:"messages"`
+	Annotations []types.MessageAnnotation `json:"annotations"`
+}
+
+// ExportSession builds an export of the given session's messages and annotations
+func (manager *PanelSyncManager) ExportSession(sessionID string) (*SessionExport, error) {
+	snapshot := manager.GetState()
+
+	session, found := snapshot.GetSessionByID(sessionID)
+	if !found {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+
+	export := &SessionExport{
+		ExportedAt:  manager.now(),
+		Version:     snapshot.Version.Version,
+		Session:     session,
+		Messages:    make([]types.MessageInfo, 0),
+		Annotations: make([]types.MessageAnnotation, 0),
+	}
+
+	for _, msg := range snapshot.Messages {
+		if msg.SessionID == sessionID {
+			export.Messages = append(export.Messages, msg)
+		}
+	}
+	for _, annotation := range snapshot.Annotations {
+		if annotation.SessionID == sessionID {
+			export.Annotations = append(export.Annotations, annotation)
+		}
+	}
+
+	return export, nil
+}
+
+// ExportSessionJSON renders ExportSession as indented JSON
+func (manager *PanelSyncManager) ExportSessionJSON(sessionID string) ([]byte, error) {
+	export, err := manager.ExportSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
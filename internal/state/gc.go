@@ -0,0 +1,91 @@
+package state
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/persistence"
+)
+
+// gcStartupDelay gives the orchestrator time to load state and attach the blob
+// store before the first collection, so nothing is swept against an empty state
+const gcStartupDelay = 30 * time.Second
+
+// errGCUnsupported is returned when the repository cannot collect garbage
+var errGCUnsupported = errors.New("repository does not support garbage collection")
+
+// garbageCollector is implemented by repositories that can clean up their own files
+type garbageCollector interface {
+	CollectGarbage(opts persistence.GCOptions) interfaces.GCStats
+}
+
+// CollectGarbage removes orphaned temp files, surplus backups and unreferenced blobs.
+// With dryRun set nothing is deleted and the stats report what would have been.
+func (manager *PanelSyncManager) CollectGarbage(dryRun bool) (interfaces.GCStats, error) {
+	collector, ok := manager.repository.(garbageCollector)
+	if !ok {
+		return interfaces.GCStats{}, errGCUnsupported
+	}
+
+	opts := persistence.DefaultGCOptions()
+	opts.DryRun = dryRun
+
+	manager.syncMutex.RLock()
+	opts.Blobs = manager.blobs
+	opts.Referenced = persistence.MessageBlobRefs(manager.state)
+	j := manager.journal
+	manager.syncMutex.RUnlock()
+
+	if j != nil {
+		if err := journalBlobRefs(j, opts.Referenced); err != nil {
+			// Without the full reference set, unreferenced blobs cannot be told apart
+			opts.Blobs = nil
+			log.Printf("Garbage collection keeps all blobs: failed to read history: %v", err)
+		}
+	}
+
+	stats := collector.CollectGarbage(opts)
+
+	verb := "removed"
+	if dryRun {
+		verb = "would remove"
+	}
+	log.Printf("Garbage collection %s %d temp files, %d backups, %d blobs (%d bytes) in %v",
+		verb, stats.TempFilesRemoved, stats.BackupsRemoved, stats.BlobsRemoved, stats.BytesReclaimed, stats.Duration)
+	for _, msg := range stats.Errors {
+		log.Printf("Garbage collection error: %s", msg)
+	}
+
+	return stats, nil
+}
+
+// gcWorker collects garbage shortly after startup and then periodically
+func (manager *PanelSyncManager) gcWorker() {
+	collected := false
+	for {
+		config, changed := manager.currentConfig()
+		var tick <-chan time.Time
+		if config.GCInterval > 0 {
+			wait := config.GCInterval
+			if !collected {
+				wait = gcStartupDelay
+			}
+			tick = manager.clock().After(wait)
+		}
+
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-changed:
+			continue
+		case <-tick:
+			if _, err := manager.CollectGarbage(config.GCDryRun); err != nil {
+				log.Printf("Garbage collection skipped: %v", err)
+				return
+			}
+			collected = true
+		}
+	}
+}
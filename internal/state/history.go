@@ -0,0 +1,391 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// errHistoryDisabled is returned by StateAt when no journal is attached
+var errHistoryDisabled = errors.New("state history is not enabled")
+
+// SetJournal attaches a journal that records every applied update so past
+// versions can be rebuilt with StateAt; nil disables history
+func (manager *PanelSyncManager) SetJournal(j *journal.Journal) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.journal = j
+}
+
+// StateAt reconstructs the state as it was at version without touching live
+// state: the nearest journal checkpoint is replayed up to version on a scratch
+// manager. Blob references in the result may point at blobs that have since
+// been collected or redacted.
+func (manager *PanelSyncManager) StateAt(version int64) (*types.SharedApplicationState, error) {
+	manager.syncMutex.RLock()
+	j := manager.journal
+	current := manager.state.Version.Version
+	if version == current {
+		state := manager.state.Clone()
+		manager.syncMutex.RUnlock()
+		return state, nil
+	}
+	manager.syncMutex.RUnlock()
+
+	if version <= 0 || version > current {
+		return nil, fmt.Errorf("version %d is out of range (current %d)", version, current)
+	}
+	if j == nil {
+		return nil, errHistoryDisabled
+	}
+
+	return ReplayJournal(j, version)
+}
+
+// ReplayJournal rebuilds the state at version from a journal alone: the
+// nearest checkpoint is loaded and the entries that follow it are replayed
+func ReplayJournal(j *journal.Journal, version int64) (*types.SharedApplicationState, error) {
+	checkpoint, entries, err := j.Load(version)
+	if err != nil {
+		if errors.Is(err, journal.ErrUnavailable) {
+			return nil, fmt.Errorf("%w (oldest retained version is %d)", err, j.Oldest())
+		}
+		return nil, err
+	}
+
+	replayer := &PanelSyncManager{
+		state:     checkpoint,
+		eventBus:  NewEventBus(0),
+		replaying: true,
+	}
+	for _, entry := range entries {
+		members, err := entry.Members()
+		if err != nil {
+			return nil, err
+		}
+		updates := make([]types.StateUpdate, 0, len(members))
+		for _, member := range members {
+			updates = append(updates, types.StateUpdate{
+				ID:          member.UpdateID,
+				Type:        types.UpdateType(member.Type),
+				SourcePanel: member.SourcePanel,
+				Payload:     member.Payload,
+			})
+		}
+		if len(updates) == 1 {
+			err = replayer.applyUpdateLocked(updates[0])
+		} else {
+			err = replayer.replayBatchLocked(updates)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to replay version %d: %w", entry.Version, err)
+		}
+		checkpoint.Version.Version = entry.Version
+		checkpoint.Version.Timestamp = entry.Timestamp
+		checkpoint.LastUpdate = entry.Timestamp
+	}
+	return checkpoint, nil
+}
+
+// recordJournalLocked appends an applied update to the journal (caller must hold
+// syncMutex). The recorded payload is the one broadcast, so generated IDs and blob
+// references replay exactly; redactions replay as the message update they produce.
+func (manager *PanelSyncManager) recordJournalLocked(update types.StateUpdate) {
+	if manager.journal == nil {
+		return
+	}
+	entry, ok := manager.journalEntryLocked(update)
+	if !ok {
+		return
+	}
+	if err := manager.journal.Record(entry, manager.state); err != nil {
+		log.Printf("Failed to record journal entry for update %s: %v", update.ID, err)
+	}
+}
+
+// recordJournalBatchLocked appends the updates of a batch to the journal as one
+// entry for the version they share (caller must hold syncMutex)
+func (manager *PanelSyncManager) recordJournalBatchLocked(updates []types.StateUpdate) {
+	if manager.journal == nil {
+		return
+	}
+	members := make([]journal.Entry, 0, len(updates))
+	for _, update := range updates {
+		if entry, ok := manager.journalEntryLocked(update); ok {
+			members = append(members, entry)
+		}
+	}
+	payload, err := json.Marshal(members)
+	if err != nil {
+		log.Printf("Failed to encode journal entry for a batch of %d updates: %v", len(updates), err)
+		return
+	}
+
+	entry := journal.Entry{
+		Version:     manager.state.Version.Version,
+		Timestamp:   manager.state.Version.Timestamp,
+		Type:        string(types.StateBatched),
+		SourcePanel: manager.state.Version.Source,
+		Payload:     payload,
+	}
+	if err := manager.journal.Record(entry, manager.state); err != nil {
+		log.Printf("Failed to record journal entry for a batch of %d updates: %v", len(updates), err)
+	}
+}
+
+// journalEntryLocked returns the journal entry for an applied update
+func (manager *PanelSyncManager) journalEntryLocked(update types.StateUpdate) (journal.Entry, bool) {
+	payload, err := json.Marshal(update.Payload)
+	if err != nil {
+		log.Printf("Failed to encode journal entry for update %s: %v", update.ID, err)
+		return journal.Entry{}, false
+	}
+	updateType := update.Type
+	if updateType == types.MessageRedacted {
+		updateType = types.MessageUpdated
+	}
+
+	return journal.Entry{
+		Version:     manager.state.Version.Version,
+		Timestamp:   manager.state.Version.Timestamp,
+		UpdateID:    update.ID,
+		Type:        string(updateType),
+		SourcePanel: update.SourcePanel,
+		Payload:     payload,
+	}, true
+}
+
+// redactJournalLocked rewrites history so earlier versions of a redacted
+// message show the redacted content too (caller must hold syncMutex)
+func (manager *PanelSyncManager) redactJournalLocked(redacted types.MessageUpdatePayload) {
+	if manager.journal == nil {
+		return
+	}
+
+	var rewriteEntry func(entry *journal.Entry) bool
+	rewriteEntry = func(entry *journal.Entry) bool {
+		switch types.UpdateType(entry.Type) {
+		case types.MessageAdded:
+			var payload types.MessageAddPayload
+			if json.Unmarshal(entry.Payload, &payload) != nil || !redactMessageInfo(&payload.Message, redacted) {
+				return false
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return false
+			}
+			entry.Payload = data
+			return true
+		case types.MessageUpdated:
+			var payload types.MessageUpdatePayload
+			if json.Unmarshal(entry.Payload, &payload) != nil || !redactUpdatePayload(&payload, redacted) {
+				return false
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return false
+			}
+			entry.Payload = data
+			return true
+		case types.CodeBlocksExtracted:
+			var payload types.CodeBlocksPayload
+			if json.Unmarshal(entry.Payload, &payload) != nil || !redactCodeBlocks(&payload, redacted) {
+				return false
+			}
+			data, err := json.Marshal(payload)
+			if err != nil {
+				return false
+			}
+			entry.Payload = data
+			return true
+		case types.StateBatched:
+			members, err := entry.Members()
+			if err != nil {
+				return false
+			}
+			changed := false
+			for i := range members {
+				if rewriteEntry(&members[i]) {
+					changed = true
+				}
+			}
+			if !changed {
+				return false
+			}
+			data, err := json.Marshal(members)
+			if err != nil {
+				return false
+			}
+			entry.Payload = data
+			return true
+		}
+		return false
+	}
+
+	rewriteCheckpoint := func(state *types.SharedApplicationState) bool {
+		return redactStateMessages(state, redacted)
+	}
+
+	if err := manager.journal.Rewrite(rewriteEntry, rewriteCheckpoint); err != nil {
+		log.Printf("Failed to redact message %s from history: %v", redacted.MessageID, err)
+	}
+}
+
+// historyRewriter is implemented by event buses that can rewrite the events
+// they keep for replay
+type historyRewriter interface {
+	RewriteHistory(rewrite func(event *types.StateEvent) bool) error
+}
+
+// redactEventsLocked rewrites the events kept for replay, in memory and spilled
+// to disk, so they no longer carry the unredacted message (caller must hold syncMutex)
+func (manager *PanelSyncManager) redactEventsLocked(redacted types.MessageUpdatePayload) {
+	rewriter, ok := manager.eventBus.(historyRewriter)
+	if !ok {
+		return
+	}
+	rewrite := func(event *types.StateEvent) bool {
+		return redactEvent(event, redacted)
+	}
+	if err := rewriter.RewriteHistory(rewrite); err != nil {
+		log.Printf("Failed to redact message %s from event history: %v", redacted.MessageID, err)
+	}
+}
+
+// redactEvent replaces the message in an event that carries it, including
+// inside batches and state syncs. A changed event loses its sealed encoding.
+func redactEvent(event *types.StateEvent, redacted types.MessageUpdatePayload) bool {
+	switch event.Type {
+	case types.EventMessageAdded:
+		var payload types.MessageAddPayload
+		if decodePayload(event.Data, &payload) != nil || !redactMessageInfo(&payload.Message, redacted) {
+			return false
+		}
+		*event = event.WithData(payload)
+	case types.EventMessageUpdated:
+		var payload types.MessageUpdatePayload
+		if decodePayload(event.Data, &payload) != nil || !redactUpdatePayload(&payload, redacted) {
+			return false
+		}
+		*event = event.WithData(payload)
+	case types.EventCodeBlocksExtracted:
+		var payload types.CodeBlocksPayload
+		if decodePayload(event.Data, &payload) != nil || !redactCodeBlocks(&payload, redacted) {
+			return false
+		}
+		*event = event.WithData(payload)
+	case types.EventStateBatch:
+		var payload types.StateBatchPayload
+		if decodePayload(event.Data, &payload) != nil {
+			return false
+		}
+		changed := false
+		for i := range payload.Events {
+			if redactEvent(&payload.Events[i], redacted) {
+				changed = true
+			}
+		}
+		if !changed {
+			return false
+		}
+		*event = event.WithData(payload)
+	case types.EventStateSync:
+		var payload types.StateSyncPayload
+		if decodePayload(event.Data, &payload) != nil || payload.State == nil || !redactStateMessages(payload.State, redacted) {
+			return false
+		}
+		*event = event.WithData(payload)
+	default:
+		return false
+	}
+	return true
+}
+
+// redactMessageInfo replaces a copy of the redacted message with its redacted content
+func redactMessageInfo(msg *types.MessageInfo, redacted types.MessageUpdatePayload) bool {
+	if msg == nil || msg.ID != redacted.MessageID {
+		return false
+	}
+	msg.Content, msg.BodyRef, msg.BodySize = redacted.Content, redacted.BodyRef, redacted.BodySize
+	msg.Truncated = redacted.Truncated
+	msg.Parts, msg.PartsRef = nil, ""
+	msg.Native, msg.NativeRef = nil, ""
+	msg.CodeBlocks = nil
+	msg.Meta = redacted.Meta
+	return true
+}
+
+// redactUpdatePayload replaces the content of an update to the redacted message
+func redactUpdatePayload(payload *types.MessageUpdatePayload, redacted types.MessageUpdatePayload) bool {
+	if payload.MessageID != redacted.MessageID {
+		return false
+	}
+	payload.Content, payload.BodyRef, payload.BodySize = redacted.Content, redacted.BodyRef, redacted.BodySize
+	payload.Truncated = redacted.Truncated
+	payload.Parts, payload.PartsRef = nil, ""
+	payload.Meta = redacted.Meta
+	return true
+}
+
+// redactCodeBlocks drops code blocks extracted from the redacted message,
+// whose offsets point into the body before the redaction
+func redactCodeBlocks(payload *types.CodeBlocksPayload, redacted types.MessageUpdatePayload) bool {
+	if payload.MessageID != redacted.MessageID || payload.Blocks == nil {
+		return false
+	}
+	payload.Blocks = nil
+	return true
+}
+
+// redactStateMessages redacts the message wherever a state copy holds it
+func redactStateMessages(state *types.SharedApplicationState, redacted types.MessageUpdatePayload) bool {
+	changed := redactMessageInfo(state.CurrentMessage, redacted)
+	for i := range state.Messages {
+		if redactMessageInfo(&state.Messages[i], redacted) {
+			changed = true
+		}
+	}
+	return changed
+}
+
+// journalBlobRefs returns the blobs referenced anywhere in retained history,
+// so garbage collection does not break time travel
+func journalBlobRefs(j *journal.Journal, refs map[string]bool) error {
+	var addRefs func(entry journal.Entry)
+	addRefs = func(entry journal.Entry) {
+		if entry.Type == string(types.StateBatched) {
+			members, _ := entry.Members()
+			for _, member := range members {
+				addRefs(member)
+			}
+			return
+		}
+		var payload struct {
+			BodyRef  string `json:"body_ref"`
+			PartsRef string `json:"parts_ref"`
+			Message  struct {
+				BodyRef   string `json:"body_ref"`
+				PartsRef  string `json:"parts_ref"`
+				NativeRef string `json:"native_ref"`
+			} `json:"message"`
+		}
+		if json.Unmarshal(entry.Payload, &payload) != nil {
+			return
+		}
+		for _, ref := range []string{payload.BodyRef, payload.PartsRef, payload.Message.BodyRef, payload.Message.PartsRef, payload.Message.NativeRef} {
+			if ref != "" {
+				refs[ref] = true
+			}
+		}
+	}
+	return j.Walk(addRefs, func(state *types.SharedApplicationState) {
+		for ref := range persistence.MessageBlobRefs(state) {
+			refs[ref] = true
+		}
+	})
+}
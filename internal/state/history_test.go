@@ -0,0 +1,241 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestStateAtReplaysJournal(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	// Small segments so reconstruction crosses checkpoints
+	config := journal.DefaultConfig(filepath.Join(t.TempDir(), "journal"))
+	config.SegmentSize = 1024
+	j, err := journal.Open(config)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer j.Close()
+	manager.SetJournal(j)
+
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "debugging", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	for i := 0; i < 12; i++ {
+		msg := types.MessageInfo{ID: "m" + string(rune('a'+i)), SessionID: "s1", Type: "user", Content: strings.Repeat("x", 100)}
+		if err := manager.AddMessage(msg, "test"); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "secret", SessionID: "s1", Content: "token=hunter2"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	beforeClear := manager.GetState().Version.Version
+	if err := manager.RedactMessage("secret", []types.RedactionRange{{Start: 6, End: 13}}, "test", "test"); err != nil {
+		t.Fatalf("RedactMessage() error = %v", err)
+	}
+	if err := manager.ClearSessionMessages("s1", "test"); err != nil {
+		t.Fatalf("ClearSessionMessages() error = %v", err)
+	}
+	live := manager.GetState()
+
+	past, err := manager.StateAt(beforeClear)
+	if err != nil {
+		t.Fatalf("StateAt(%d) error = %v", beforeClear, err)
+	}
+	if past.Version.Version != beforeClear || len(past.Messages) != 13 || past.Sessions[0].MessageCount != 13 {
+		t.Errorf("StateAt(%d) = version %d with %d messages, want 13 messages",
+			beforeClear, past.Version.Version, len(past.Messages))
+	}
+	// The redaction reaches history, even though it happened later
+	if content := past.Messages[12].Content; strings.Contains(content, "hunter2") {
+		t.Errorf("historical message still holds redacted text: %q", content)
+	}
+
+	// History starts at the first update journaled, adding the session
+	first := j.Oldest()
+	early, err := manager.StateAt(first + 1)
+	if err != nil {
+		t.Fatalf("StateAt(%d) error = %v", first+1, err)
+	}
+	if len(early.Sessions) != 1 || len(early.Messages) != 1 {
+		t.Errorf("StateAt(%d) has %d sessions and %d messages, want 1 and 1", first+1, len(early.Sessions), len(early.Messages))
+	}
+	if _, err := manager.StateAt(first - 1); !errors.Is(err, journal.ErrUnavailable) {
+		t.Errorf("StateAt(%d) error = %v, want ErrUnavailable", first-1, err)
+	}
+
+	if after := manager.GetState(); after.Version.Version != live.Version.Version || len(after.Messages) != 0 {
+		t.Errorf("StateAt modified live state: version %d, %d messages", after.Version.Version, len(after.Messages))
+	}
+	if _, err := manager.StateAt(live.Version.Version + 1); err == nil {
+		t.Error("StateAt() accepted a future version")
+	}
+
+	// The journal alone rebuilds the live state, as the rebuild-state command relies on
+	if newest := j.Newest(); newest != live.Version.Version {
+		t.Fatalf("Newest() = %d, want %d", newest, live.Version.Version)
+	}
+	rebuilt, err := ReplayJournal(j, j.Newest())
+	if err != nil {
+		t.Fatalf("ReplayJournal() error = %v", err)
+	}
+	if sections := live.Checksums().Mismatched(rebuilt.Checksums()); rebuilt.Version.Version != live.Version.Version || len(sections) > 0 {
+		t.Errorf("rebuilt version %d differs from live state in %v", rebuilt.Version.Version, sections)
+	}
+}
+
+func TestStateAtWithoutHistory(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if err := manager.ChangeTheme("dark", "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.ChangeTheme("light", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.StateAt(1); !errors.Is(err, errHistoryDisabled) {
+		t.Errorf("StateAt() error = %v, want errHistoryDisabled", err)
+	}
+	if state, err := manager.StateAt(manager.GetState().Version.Version); err != nil || state.Theme != "light" {
+		t.Errorf("StateAt(current) = %v, %v", state, err)
+	}
+}
+
+func TestRedactionScrubsEventHistory(t *testing.T) {
+	bus := NewEventBus(4)
+	overflowPath := filepath.Join(t.TempDir(), "state.events.log")
+	overflow, err := OpenEventOverflow(overflowPath, 2400, 0600)
+	if err != nil {
+		t.Fatalf("OpenEventOverflow() error = %v", err)
+	}
+	defer overflow.Close()
+	bus.SetOverflow(overflow)
+
+	repository := persistence.NewMemoryRepository(persistence.MemoryOptions{})
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, bus, DefaultConflictResolver(), newTestSyncManagerConfig())
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	t.Cleanup(func() { manager.Stop() })
+
+	const secret = "hunter2hunter2"
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Content: "token " + secret}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.MessageUpdated,
+		ExpectedVersion: manager.GetState().GetCurrentVersion(),
+		Payload:         types.MessageUpdatePayload{MessageID: "m1", Content: "token " + secret + "!"},
+		SourcePanel:     "test",
+		Timestamp:       time.Now(),
+	}); err != nil {
+		t.Fatalf("MessageUpdated error = %v", err)
+	}
+	// Push both events out of memory and into the rotated overflow file
+	for i := 0; i < 5; i++ {
+		if err := manager.AddMessage(types.MessageInfo{ID: fmt.Sprintf("f%d", i), SessionID: "s1", Content: "filler"}, "test"); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	onDisk := func() string {
+		var all []byte
+		for _, path := range []string{overflowPath + ".1", overflowPath} {
+			data, _ := os.ReadFile(path)
+			all = append(all, data...)
+		}
+		return string(all)
+	}
+	// m2 is still in the in-memory history when it is redacted
+	if err := manager.AddMessage(types.MessageInfo{ID: "m2", SessionID: "s1", Content: "token " + secret}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+
+	// Reading flushes the buffered writer so the files can be inspected
+	if _, err := overflow.ReadSince(0); err != nil {
+		t.Fatalf("ReadSince() error = %v", err)
+	}
+	rotated, _ := os.ReadFile(overflowPath + ".1")
+	if !strings.Contains(string(rotated), secret) {
+		t.Fatal("secret never reached the rotated overflow file; the test does not exercise it")
+	}
+
+	for _, id := range []string{"m2", "m1"} {
+		if err := manager.RedactMessage(id, []types.RedactionRange{{Start: 6, End: 20}}, "test", "test"); err != nil {
+			t.Fatalf("RedactMessage(%s) error = %v", id, err)
+		}
+	}
+
+	events, _, err := bus.GetEventsSince(0)
+	if err != nil {
+		t.Fatalf("GetEventsSince() error = %v", err)
+	}
+	data, err := json.Marshal(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), secret) {
+		t.Error("replayed events still carry the redacted secret")
+	}
+	if strings.Contains(onDisk(), secret) {
+		t.Error("overflow files still carry the redacted secret")
+	}
+	if len(events) < 10 {
+		t.Errorf("%d events replayed, want every event kept", len(events))
+	}
+}
+
+func TestRedactionDropsCodeBlocks(t *testing.T) {
+	manager := newTestSyncManager(t)
+	j, err := journal.Open(journal.DefaultConfig(filepath.Join(t.TempDir(), "journal")))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer j.Close()
+	manager.SetJournal(j)
+
+	body := "Use this:\n```go\nconst token = \"hunter2hunter2hunter2hunter2\"\n```\n"
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Type: "assistant", Content: body, Status: "completed"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+	if err := manager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.CodeBlocksExtracted,
+		ExpectedVersion: manager.GetState().GetCurrentVersion(),
+		Payload:         types.CodeBlocksPayload{MessageID: "m1", Blocks: codeblocks.Extract(body)},
+		SourcePanel:     "test",
+		Timestamp:       time.Now(),
+	}); err != nil {
+		t.Fatalf("CodeBlocksExtracted error = %v", err)
+	}
+	extracted := manager.GetState().Version.Version
+
+	// The redaction shortens the body, leaving the block's end past it
+	start := strings.Index(body, "hunter2")
+	if err := manager.RedactMessage("m1", []types.RedactionRange{{Start: start, End: start + 28}}, "test", "test"); err != nil {
+		t.Fatalf("RedactMessage() error = %v", err)
+	}
+
+	if msg, _ := manager.GetState().GetMessageByID("m1"); msg.CodeBlocks != nil {
+		t.Errorf("redacted message kept code blocks %+v", msg.CodeBlocks)
+	}
+	past, err := manager.StateAt(extracted)
+	if err != nil {
+		t.Fatalf("StateAt(%d) error = %v", extracted, err)
+	}
+	if msg, _ := past.GetMessageByID("m1"); msg.CodeBlocks != nil || strings.Contains(msg.Content, "hunter2") {
+		t.Errorf("historical message = %q with code blocks %+v, want the redacted body and none", msg.Content, msg.CodeBlocks)
+	}
+}
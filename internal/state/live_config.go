@@ -0,0 +1,246 @@
+package state
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// historyResizer is implemented by event buses whose history can be resized live
+type historyResizer interface {
+	SetMaxHistory(maxHistory int)
+}
+
+// Validate reports settings a sync manager cannot run with
+func (config SyncManagerConfig) Validate() error {
+	switch {
+	case config.AutoSaveEnabled && config.AutoSaveInterval <= 0:
+		return fmt.Errorf("auto_save_interval must be positive when auto-save is enabled, got %v", config.AutoSaveInterval)
+	case config.EventHistorySize < 0:
+		return fmt.Errorf("event_history_size cannot be negative, got %d", config.EventHistorySize)
+	case config.SaveQueueSize < 0:
+		return fmt.Errorf("save_queue_size cannot be negative, got %d", config.SaveQueueSize)
+	case config.ApplyQueueSize < 0:
+		return fmt.Errorf("apply_queue_size cannot be negative, got %d", config.ApplyQueueSize)
+	case config.GCInterval < 0:
+		return fmt.Errorf("gc_interval cannot be negative, got %v", config.GCInterval)
+	case config.DedupeWindow < 0:
+		return fmt.Errorf("dedupe_window cannot be negative, got %v", config.DedupeWindow)
+	case config.MaxStateSize < 0:
+		return fmt.Errorf("max_state_size cannot be negative, got %d", config.MaxStateSize)
+	case config.SlowUpdate < 0:
+		return fmt.Errorf("slow_update cannot be negative, got %v", config.SlowUpdate)
+	case config.SlowSave < 0:
+		return fmt.Errorf("slow_save cannot be negative, got %v", config.SlowSave)
+	case config.MaxBatchSize < 0:
+		return fmt.Errorf("max_batch_size cannot be negative, got %d", config.MaxBatchSize)
+	case config.Retention.MaxMessagesPerSession < 0:
+		return fmt.Errorf("retention.max_messages_per_session cannot be negative, got %d", config.Retention.MaxMessagesPerSession)
+	}
+
+	switch config.SecretPolicy {
+	case "", SecretPolicyOff, SecretPolicyFlag, SecretPolicyBlock:
+	default:
+		return fmt.Errorf("invalid secret_policy %q (must be 'off', 'flag', or 'block')", config.SecretPolicy)
+	}
+	return nil
+}
+
+// GetConfig returns the configuration the manager is running with
+func (manager *PanelSyncManager) GetConfig() SyncManagerConfig {
+	config, _ := manager.currentConfig()
+	return config
+}
+
+// currentConfig returns the live configuration and a channel closed when it next changes
+func (manager *PanelSyncManager) currentConfig() (SyncManagerConfig, <-chan struct{}) {
+	manager.configMutex.RLock()
+	defer manager.configMutex.RUnlock()
+	return manager.config, manager.configChanged
+}
+
+// SetConfig applies a new configuration to the running manager. Autosave,
+// garbage collection, the quota and retention take effect on their next run;
+// queues are resized without losing or reordering queued work. The vector
+// clock node cannot change while running. Panels are sent a ConfigChanged
+// event listing the changed settings.
+func (manager *PanelSyncManager) SetConfig(config SyncManagerConfig) error {
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("invalid sync manager config: %w", err)
+	}
+	if manager.ctx.Err() != nil {
+		return ErrSyncManagerStopped
+	}
+
+	// Workers read the config while they wait on the queues, so configMutex is
+	// not held across the resizes; setConfigMutex keeps callers from interleaving
+	manager.setConfigMutex.Lock()
+	defer manager.setConfigMutex.Unlock()
+
+	manager.configMutex.Lock()
+	previous := manager.config
+	if config.VectorClockNode != previous.VectorClockNode {
+		manager.configMutex.Unlock()
+		return fmt.Errorf("vector_clock_node cannot be changed while running (is %q)", previous.VectorClockNode)
+	}
+	changed := changedConfigFields(previous, config)
+	if len(changed) == 0 {
+		manager.configMutex.Unlock()
+		return nil
+	}
+	manager.config = config
+	close(manager.configChanged)
+	manager.configChanged = make(chan struct{})
+	manager.configMutex.Unlock()
+
+	if config.DedupeWindow != previous.DedupeWindow || config.SecretPolicy != previous.SecretPolicy {
+		manager.syncMutex.Lock()
+		manager.dedupe = manager.dedupe.withWindow(config.DedupeWindow)
+		if config.SecretPolicy != previous.SecretPolicy {
+			manager.secretScanner = nil
+			if config.SecretPolicy != "" && config.SecretPolicy != SecretPolicyOff {
+				manager.secretScanner = NewSecretScanner(config.SecretPolicy)
+			}
+		}
+		manager.syncMutex.Unlock()
+	}
+	if config.EventHistorySize != previous.EventHistorySize {
+		if resizer, ok := manager.eventBus.(historyResizer); ok {
+			resizer.SetMaxHistory(config.EventHistorySize)
+		}
+	}
+	if config.ApplyQueueSize != previous.ApplyQueueSize {
+		manager.resizeApplyQueue(config.ApplyQueueSize)
+	}
+	if config.SaveQueueSize != previous.SaveQueueSize {
+		manager.resizeSaveQueue(config.SaveQueueSize)
+	}
+
+	log.Printf("Sync manager configuration changed: %v", changed)
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventConfigChanged,
+		Data:        types.ConfigChangedPayload{Component: "sync_manager", Changed: changed, Config: config.Fields()},
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+	return nil
+}
+
+// UpdateConfig applies settings given as JSON field names and values, with
+// nested objects merged, on top of the current configuration and returns the
+// configuration now in effect
+func (manager *PanelSyncManager) UpdateConfig(changes map[string]interface{}) (SyncManagerConfig, error) {
+	fields := manager.GetConfig().Fields()
+	if err := mergeConfigFields(fields, changes, ""); err != nil {
+		return SyncManagerConfig{}, err
+	}
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return SyncManagerConfig{}, fmt.Errorf("failed to encode sync manager config: %w", err)
+	}
+	var config SyncManagerConfig
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return SyncManagerConfig{}, fmt.Errorf("invalid sync manager config: %w", err)
+	}
+
+	if err := manager.SetConfig(config); err != nil {
+		return SyncManagerConfig{}, err
+	}
+	return config, nil
+}
+
+// mergeConfigFields overlays changes onto fields, descending into objects
+func mergeConfigFields(fields, changes map[string]interface{}, prefix string) error {
+	for name, value := range changes {
+		nested, isObject := fields[name].(map[string]interface{})
+		if !isObject {
+			fields[name] = value
+			continue
+		}
+		nestedChanges, ok := value.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("invalid sync manager config: %s%s must be an object", prefix, name)
+		}
+		if err := mergeConfigFields(nested, nestedChanges, prefix+name+"."); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// changedConfigFields lists the JSON names of the settings that differ
+func changedConfigFields(previous, next SyncManagerConfig) []string {
+	before, after := previous.Fields(), next.Fields()
+	var changed []string
+	for name, value := range after {
+		if !reflect.DeepEqual(before[name], value) {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// Fields is the configuration as its JSON object, the form admin clients use
+func (config SyncManagerConfig) Fields() map[string]interface{} {
+	fields := make(map[string]interface{})
+	data, err := json.Marshal(config)
+	if err == nil {
+		err = json.Unmarshal(data, &fields)
+	}
+	if err != nil {
+		log.Printf("Failed to encode sync manager config: %v", err)
+	}
+	return fields
+}
+
+// resizeApplyQueue swaps in a queue of the new size. Closing the old queue
+// tells the apply loop to finish it before moving on, which keeps submission
+// order; no sender can still hold it once the write lock is taken.
+func (manager *PanelSyncManager) resizeApplyQueue(size int) {
+	manager.applyMutex.Lock()
+	defer manager.applyMutex.Unlock()
+
+	close(manager.applyQueue)
+	manager.applyQueue = make(chan applyRequest, size)
+}
+
+// resizeSaveQueue swaps in a save queue of the new size, the same way as
+// resizeApplyQueue. A queue already closed by Stop is left alone.
+func (manager *PanelSyncManager) resizeSaveQueue(size int) {
+	manager.saveMutex.Lock()
+	defer manager.saveMutex.Unlock()
+
+	if manager.saveClosed {
+		return
+	}
+	close(manager.saveQueue)
+	manager.saveQueue = make(chan saveRequest, size)
+}
+
+// currentApplyQueue returns the queue new updates are sent to
+func (manager *PanelSyncManager) currentApplyQueue() chan applyRequest {
+	manager.applyMutex.RLock()
+	defer manager.applyMutex.RUnlock()
+	return manager.applyQueue
+}
+
+// nextSaveQueue returns the queue the save worker should read after finishing
+// one, or nil once Stop has closed the current queue
+func (manager *PanelSyncManager) nextSaveQueue(finished chan saveRequest) chan saveRequest {
+	manager.saveMutex.RLock()
+	defer manager.saveMutex.RUnlock()
+	if manager.saveClosed && manager.saveQueue == finished {
+		return nil
+	}
+	return manager.saveQueue
+}
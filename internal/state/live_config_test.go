@@ -0,0 +1,137 @@
+package state
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSetConfigRejectsInvalidSettings(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	tests := []struct {
+		name   string
+		modify func(*SyncManagerConfig)
+		want   string
+	}{
+		{name: "negative queue", modify: func(c *SyncManagerConfig) { c.ApplyQueueSize = -1 }, want: "apply_queue_size"},
+		{name: "autosave without interval", modify: func(c *SyncManagerConfig) { c.AutoSaveEnabled, c.AutoSaveInterval = true, 0 }, want: "auto_save_interval"},
+		{name: "unknown secret policy", modify: func(c *SyncManagerConfig) { c.SecretPolicy = "shout" }, want: "secret_policy"},
+		{name: "clock node", modify: func(c *SyncManagerConfig) { c.VectorClockNode = "b" }, want: "vector_clock_node"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := manager.GetConfig()
+			tt.modify(&config)
+			if err := manager.SetConfig(config); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("SetConfig() error = %v, want mention of %s", err, tt.want)
+			}
+		})
+	}
+	if !reflect.DeepEqual(manager.GetConfig(), newTestSyncManagerConfig()) {
+		t.Errorf("rejected configs changed the running config: %+v", manager.GetConfig())
+	}
+}
+
+// newTestSyncManagerConfig is the config newTestSyncManager starts with
+func newTestSyncManagerConfig() SyncManagerConfig {
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	return config
+}
+
+func TestSetConfigResizesQueuesUnderLoad(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+
+	const writers, perWriter = 4, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers*perWriter*2)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWriter; i++ {
+				message := types.MessageInfo{ID: fmt.Sprintf("m%d-%d", w, i), SessionID: "s1", Content: "hi"}
+				errs <- manager.AddMessage(message, "test")
+				errs <- manager.SaveStateSync()
+			}
+		}(w)
+	}
+
+	for size := 1; size <= 8; size++ {
+		config := manager.GetConfig()
+		config.ApplyQueueSize, config.SaveQueueSize = size, size
+		config.AutoSaveEnabled, config.AutoSaveInterval = size%2 == 0, time.Duration(size)*time.Millisecond
+		if err := manager.SetConfig(config); err != nil {
+			t.Fatalf("SetConfig() error = %v", err)
+		}
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("operation during resize failed: %v", err)
+		}
+	}
+	if got := len(manager.GetState().Messages); got != writers*perWriter {
+		t.Errorf("%d messages applied, want %d", got, writers*perWriter)
+	}
+	if got := manager.GetConfig(); got.ApplyQueueSize != 8 || got.SaveQueueSize != 8 {
+		t.Errorf("config after resizes = %+v", got)
+	}
+
+	var changes int
+	for len(events) > 0 {
+		event := <-events
+		if event.Type != types.EventConfigChanged {
+			continue
+		}
+		changes++
+		payload := event.Data.(types.ConfigChangedPayload)
+		if payload.Changed[0] != "apply_queue_size" || !strings.Contains(strings.Join(payload.Changed, ","), "save_queue_size") {
+			t.Errorf("changed = %v", payload.Changed)
+		}
+	}
+	if changes == 0 {
+		t.Error("no config_changed events")
+	}
+}
+
+func TestUpdateConfigMergesFields(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	config, err := manager.UpdateConfig(map[string]interface{}{
+		"dedupe_window": 0,
+		"retention":     map[string]interface{}{"max_messages_per_session": 3},
+	})
+	if err != nil {
+		t.Fatalf("UpdateConfig() error = %v", err)
+	}
+	if config.DedupeWindow != 0 || config.Retention.MaxMessagesPerSession != 3 || config.SaveQueueSize != newTestSyncManagerConfig().SaveQueueSize {
+		t.Errorf("config = %+v", config)
+	}
+	manager.syncMutex.RLock()
+	dedupe := manager.dedupe
+	manager.syncMutex.RUnlock()
+	if dedupe != nil {
+		t.Error("dedupe still enabled after dedupe_window=0")
+	}
+
+	for _, changes := range []map[string]interface{}{
+		{"autosave": true},
+		{"retention": 5},
+		{"save_queue_size": "big"},
+	} {
+		if _, err := manager.UpdateConfig(changes); err == nil {
+			t.Errorf("UpdateConfig(%v) succeeded", changes)
+		}
+	}
+}
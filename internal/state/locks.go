@@ -0,0 +1,153 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrSessionLocked is returned when another panel holds the lock on a session
+var ErrSessionLocked = errors.New("session is locked")
+
+const (
+	// DefaultSessionLockTTL applies when a lock request does not name a TTL
+	DefaultSessionLockTTL = 5 * time.Minute
+	// MaxSessionLockTTL bounds a single grant; long operations renew instead
+	MaxSessionLockTTL = time.Hour
+)
+
+// LockSession acquires or renews the advisory lock on a session for panelID.
+// While held, other panels cannot delete the session or remove its messages.
+func (manager *PanelSyncManager) LockSession(sessionID, operation string, ttl time.Duration, panelID string) error {
+	update := types.StateUpdate{
+		ID:   generateUpdateID(),
+		Type: types.SessionLocked,
+		Payload: types.SessionLockPayload{
+			SessionID:  sessionID,
+			Operation:  operation,
+			TTLSeconds: int(ttl / time.Second),
+		},
+		SourcePanel: panelID,
+		Timestamp:   manager.now(),
+	}
+
+	return manager.applyUpdateWithEvents(update)
+}
+
+// UnlockSession releases panelID's lock on a session; force releases another panel's lock
+func (manager *PanelSyncManager) UnlockSession(sessionID string, force bool, panelID string) error {
+	update := types.StateUpdate{
+		ID:          generateUpdateID(),
+		Type:        types.SessionUnlocked,
+		Payload:     types.SessionUnlockPayload{SessionID: sessionID, Force: force},
+		SourcePanel: panelID,
+		Timestamp:   manager.now(),
+	}
+
+	return manager.applyUpdateWithEvents(update)
+}
+
+// applySessionLockLocked grants or renews a lock and returns the payload to
+// broadcast (caller must hold syncMutex)
+func (manager *PanelSyncManager) applySessionLockLocked(payload types.SessionLockPayload, panelID string) (types.SessionLockPayload, error) {
+	// Replayed history carries the lock exactly as it was granted
+	if manager.replaying && payload.Lock != nil {
+		manager.setSessionLockLocked(*payload.Lock)
+		return payload, nil
+	}
+
+	if payload.SessionID == "" {
+		return payload, fmt.Errorf("session lock requires session_id")
+	}
+	if manager.findSessionLocked(payload.SessionID) == nil {
+		return payload, fmt.Errorf("session %s not found", payload.SessionID)
+	}
+
+	now := manager.now()
+	if err := manager.checkSessionLockLocked(payload.SessionID, panelID, now); err != nil {
+		return payload, err
+	}
+
+	ttl := time.Duration(payload.TTLSeconds) * time.Second
+	if ttl <= 0 {
+		ttl = DefaultSessionLockTTL
+	}
+	if ttl > MaxSessionLockTTL {
+		ttl = MaxSessionLockTTL
+	}
+
+	lock := types.SessionLock{
+		SessionID:  payload.SessionID,
+		Owner:      panelID,
+		Operation:  payload.Operation,
+		AcquiredAt: now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	// A renewal keeps the original acquisition time
+	if existing, ok := manager.state.GetSessionLock(payload.SessionID, now); ok {
+		lock.AcquiredAt = existing.AcquiredAt
+	}
+	manager.setSessionLockLocked(lock)
+
+	payload.TTLSeconds = int(ttl / time.Second)
+	payload.Lock = &lock
+	return payload, nil
+}
+
+// applySessionUnlockLocked releases a lock (caller must hold syncMutex).
+// Releasing a session that is not locked is a no-op.
+func (manager *PanelSyncManager) applySessionUnlockLocked(payload types.SessionUnlockPayload, panelID string) error {
+	if !payload.Force && !manager.replaying {
+		if err := manager.checkSessionLockLocked(payload.SessionID, panelID, manager.now()); err != nil {
+			return err
+		}
+	}
+	manager.removeSessionLockLocked(payload.SessionID)
+	return nil
+}
+
+// checkSessionLockLocked fails when a panel other than panelID holds an
+// unexpired lock on the session (caller must hold syncMutex)
+func (manager *PanelSyncManager) checkSessionLockLocked(sessionID, panelID string, now time.Time) error {
+	if manager.replaying {
+		return nil
+	}
+	lock, ok := manager.state.GetSessionLock(sessionID, now)
+	if !ok || lock.Owner == panelID {
+		return nil
+	}
+	if lock.Operation != "" {
+		return fmt.Errorf("%w: %s holds it for %s until %s", ErrSessionLocked,
+			lock.Owner, lock.Operation, lock.ExpiresAt.Format(time.RFC3339))
+	}
+	return fmt.Errorf("%w: %s holds it until %s", ErrSessionLocked, lock.Owner, lock.ExpiresAt.Format(time.RFC3339))
+}
+
+// setSessionLockLocked replaces the session's lock and prunes expired ones
+func (manager *PanelSyncManager) setSessionLockLocked(lock types.SessionLock) {
+	manager.removeSessionLockLocked(lock.SessionID)
+	manager.state.SessionLocks = append(manager.state.SessionLocks, lock)
+}
+
+// removeSessionLockLocked drops the session's lock along with any expired locks
+func (manager *PanelSyncManager) removeSessionLockLocked(sessionID string) {
+	now := manager.now()
+	kept := manager.state.SessionLocks[:0]
+	for _, lock := range manager.state.SessionLocks {
+		if lock.SessionID != sessionID && (manager.replaying || !lock.Expired(now)) {
+			kept = append(kept, lock)
+		}
+	}
+	manager.state.SessionLocks = kept
+}
+
+func (manager *PanelSyncManager) findSessionLocked(sessionID string) *types.SessionInfo {
+	for i := range manager.state.Sessions {
+		if manager.state.Sessions[i].ID == sessionID {
+			return &manager.state.Sessions[i]
+		}
+	}
+	return nil
+}
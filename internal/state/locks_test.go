@@ -0,0 +1,81 @@
+package state
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSessionLockBlocksDestructiveOps(t *testing.T) {
+	manager := newTestSyncManager(t)
+	fake := clock.NewFake(time.Now())
+	manager.SetClock(fake)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "export me", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	if err := manager.AddMessage(types.MessageInfo{ID: "m1", SessionID: "s1", Content: "hello"}, "test"); err != nil {
+		t.Fatalf("AddMessage() error = %v", err)
+	}
+
+	if err := manager.LockSession("missing", "export", 0, "exporter"); err == nil {
+		t.Error("LockSession() on an unknown session should fail")
+	}
+	if err := manager.LockSession("s1", "export", time.Minute, "exporter"); err != nil {
+		t.Fatalf("LockSession() error = %v", err)
+	}
+	lock, ok := manager.GetState().GetSessionLock("s1", time.Now())
+	if !ok || lock.Owner != "exporter" || lock.Operation != "export" {
+		t.Fatalf("GetSessionLock() = %+v, %v", lock, ok)
+	}
+
+	tests := []struct {
+		name string
+		run  func(panelID string) error
+	}{
+		{"delete session", func(panelID string) error { return manager.DeleteSession("s1", panelID) }},
+		{"clear messages", func(panelID string) error { return manager.ClearSessionMessages("s1", panelID) }},
+		{"lock", func(panelID string) error { return manager.LockSession("s1", "merge", 0, panelID) }},
+		{"unlock", func(panelID string) error { return manager.UnlockSession("s1", false, panelID) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.run("sessions-panel"); !errors.Is(err, ErrSessionLocked) {
+				t.Errorf("%s by another panel: error = %v, want ErrSessionLocked", tt.name, err)
+			}
+		})
+	}
+	if len(manager.GetState().Messages) != 1 {
+		t.Fatal("blocked operations modified the session")
+	}
+
+	// The owner may renew; the acquisition time is kept
+	if err := manager.LockSession("s1", "export", 2*time.Minute, "exporter"); err != nil {
+		t.Fatalf("renew error = %v", err)
+	}
+	renewed, _ := manager.GetState().GetSessionLock("s1", time.Now())
+	if !renewed.AcquiredAt.Equal(lock.AcquiredAt) || !renewed.ExpiresAt.After(lock.ExpiresAt) {
+		t.Errorf("renewed lock = %+v, want same acquisition and later expiry than %+v", renewed, lock)
+	}
+
+	// An expired lock no longer blocks, so a crashed owner cannot wedge a session
+	fake.Advance(2*time.Minute + time.Second)
+	if err := manager.ClearSessionMessages("s1", "sessions-panel"); err != nil {
+		t.Fatalf("ClearSessionMessages() after expiry error = %v", err)
+	}
+
+	if err := manager.LockSession("s1", "merge", 0, "merger"); err != nil {
+		t.Fatalf("LockSession() after expiry error = %v", err)
+	}
+	if err := manager.UnlockSession("s1", true, "sessions-panel"); err != nil {
+		t.Fatalf("forced UnlockSession() error = %v", err)
+	}
+	if err := manager.DeleteSession("s1", "sessions-panel"); err != nil {
+		t.Fatalf("DeleteSession() after unlock error = %v", err)
+	}
+	if locks := manager.GetState().SessionLocks; len(locks) != 0 {
+		t.Errorf("SessionLocks = %+v after delete, want none", locks)
+	}
+}
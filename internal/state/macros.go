@@ -0,0 +1,41 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// SetMacroRecorder attaches a recorder that is offered every applied update;
+// nil disables macro recording
+func (manager *PanelSyncManager) SetMacroRecorder(recorder *macro.Recorder) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.macroRecorder = recorder
+}
+
+// recordMacroLocked offers an applied update to the macro recorder (caller must hold syncMutex)
+func (manager *PanelSyncManager) recordMacroLocked(update types.StateUpdate) {
+	if manager.macroRecorder == nil || manager.replaying {
+		return
+	}
+	manager.macroRecorder.Record(update)
+}
+
+// ApplyMacroStep applies one step of a macro replay as an update from
+// macro.ReplaySource, built against the current version
+func (manager *PanelSyncManager) ApplyMacroStep(updateType types.UpdateType, payload interface{}) error {
+	if !macro.Recordable(updateType) {
+		return fmt.Errorf("update type %s cannot be replayed", updateType)
+	}
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            updateType,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         payload,
+		SourcePanel:     macro.ReplaySource,
+		Timestamp:       manager.now(),
+	}
+	return manager.applyUpdateWithEvents(update)
+}
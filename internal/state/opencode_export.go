@@ -0,0 +1,327 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+
+	"github.com/sst/opencode-sdk-go"
+)
+
+// OpencodeSession is a conversation in the opencode server's native format,
+// the one `opencode export` writes and `opencode import` reads, so sessions
+// can move between the plain opencode TUI and tmux. Records are kept as raw
+// JSON: fields this SDK does not know about survive a round trip.
+type OpencodeSession struct {
+	Info     json.RawMessage   `json:"info"` // opencode.Session
+	Messages []OpencodeMessage `json:"messages"`
+}
+
+// OpencodeMessage is one message of an OpencodeSession with its parts
+type OpencodeMessage struct {
+	Info  json.RawMessage   `json:"info"`  // opencode.Message
+	Parts []json.RawMessage `json:"parts"` // opencode.Part
+}
+
+// ExportOpencodeSession renders a session in the opencode server's format.
+// Sessions and messages imported from opencode are written back as they were
+// recorded; the rest are described from state, their body as one text part.
+func (manager *PanelSyncManager) ExportOpencodeSession(sessionID string) (*OpencodeSession, error) {
+	snapshot := manager.GetState()
+
+	session, found := snapshot.GetSessionByID(sessionID)
+	if !found {
+		return nil, fmt.Errorf("session %s not found", sessionID)
+	}
+	info, err := opencodeSessionInfo(session)
+	if err != nil {
+		return nil, err
+	}
+
+	export := &OpencodeSession{Info: info, Messages: make([]OpencodeMessage, 0)}
+	for _, msg := range snapshot.Messages {
+		if msg.SessionID != sessionID {
+			continue
+		}
+		if msg.NativeRef != "" {
+			record, err := manager.GetBlob(msg.NativeRef)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load native record of message %s: %w", msg.ID, err)
+			}
+			msg.Native = record
+		}
+		if len(msg.Native) > 0 {
+			var native OpencodeMessage
+			if err := json.Unmarshal(msg.Native, &native); err != nil {
+				return nil, fmt.Errorf("invalid native record of message %s: %w", msg.ID, err)
+			}
+			export.Messages = append(export.Messages, native)
+			continue
+		}
+		if msg.BodyRef != "" {
+			body, err := manager.GetBlob(msg.BodyRef)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load body of message %s: %w", msg.ID, err)
+			}
+			msg.Content = string(body)
+		}
+		message, err := opencodeMessage(msg, snapshot, session)
+		if err != nil {
+			return nil, err
+		}
+		export.Messages = append(export.Messages, message)
+	}
+
+	return export, nil
+}
+
+// ExportOpencodeSessionJSON renders ExportOpencodeSession as indented JSON
+func (manager *PanelSyncManager) ExportOpencodeSessionJSON(sessionID string) ([]byte, error) {
+	export, err := manager.ExportOpencodeSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(export, "", "  ")
+}
+
+// ImportOpencodeSession adds a session exported by opencode, keeping its ID
+// and those of its messages. Each message is shown as the text of its parts
+// and keeps its native record, so exporting it again loses nothing. The
+// import is all or nothing: a message that cannot be added removes the
+// session again.
+func (manager *PanelSyncManager) ImportOpencodeSession(export *OpencodeSession, panelID string) (types.SessionInfo, error) {
+	var info opencode.Session
+	if err := json.Unmarshal(export.Info, &info); err != nil {
+		return types.SessionInfo{}, fmt.Errorf("invalid session info: %w", err)
+	}
+	if info.ID == "" {
+		return types.SessionInfo{}, fmt.Errorf("session info has no ID")
+	}
+	if _, exists := manager.GetState().GetSessionByID(info.ID); exists {
+		return types.SessionInfo{}, fmt.Errorf("session %s already exists", info.ID)
+	}
+
+	messages := make([]types.MessageInfo, 0, len(export.Messages))
+	seen := make(map[string]bool, len(export.Messages))
+	for i, native := range export.Messages {
+		msg, err := importOpencodeMessage(native, info.ID)
+		if err != nil {
+			return types.SessionInfo{}, fmt.Errorf("message %d: %w", i, err)
+		}
+		if _, exists := manager.GetState().GetMessageByID(msg.ID); exists || seen[msg.ID] {
+			return types.SessionInfo{}, fmt.Errorf("message %s already exists", msg.ID)
+		}
+		seen[msg.ID] = true
+		messages = append(messages, msg)
+	}
+
+	session := types.SessionInfo{
+		ID:        info.ID,
+		Title:     info.Title,
+		CreatedAt: opencodeTime(info.Time.Created),
+		UpdatedAt: opencodeTime(info.Time.Updated),
+		Workspace: info.Directory,
+		Native:    export.Info,
+	}
+	if err := manager.AddSession(session, panelID); err != nil {
+		return types.SessionInfo{}, err
+	}
+	for _, msg := range messages {
+		if err := manager.AddMessage(msg, panelID); err != nil {
+			if deleteErr := manager.discardOpencodeImport(session.ID, panelID); deleteErr != nil {
+				return types.SessionInfo{}, fmt.Errorf("failed to add message %s: %w; removing the partial session failed: %v", msg.ID, err, deleteErr)
+			}
+			return types.SessionInfo{}, fmt.Errorf("failed to add message %s: %w", msg.ID, err)
+		}
+	}
+	return session, nil
+}
+
+// discardOpencodeImport removes a partly imported session and its messages
+func (manager *PanelSyncManager) discardOpencodeImport(sessionID, panelID string) error {
+	if err := manager.ClearSessionMessages(sessionID, panelID); err != nil {
+		return err
+	}
+	return manager.DeleteSession(sessionID, panelID)
+}
+
+// ImportOpencodeSessionJSON imports a session from the output of `opencode export`
+func (manager *PanelSyncManager) ImportOpencodeSessionJSON(data []byte, panelID string) (types.SessionInfo, error) {
+	var export OpencodeSession
+	if err := json.Unmarshal(data, &export); err != nil {
+		return types.SessionInfo{}, fmt.Errorf("invalid opencode export: %w", err)
+	}
+	return manager.ImportOpencodeSession(&export, panelID)
+}
+
+// importOpencodeMessage reads a native message into the form kept in state
+func importOpencodeMessage(native OpencodeMessage, sessionID string) (types.MessageInfo, error) {
+	var info opencode.Message
+	if err := json.Unmarshal(native.Info, &info); err != nil {
+		return types.MessageInfo{}, fmt.Errorf("invalid message info: %w", err)
+	}
+	if info.ID == "" {
+		return types.MessageInfo{}, fmt.Errorf("message info has no ID")
+	}
+	record, err := json.Marshal(native)
+	if err != nil {
+		return types.MessageInfo{}, err
+	}
+
+	msg := types.MessageInfo{
+		ID:        info.ID,
+		SessionID: sessionID,
+		Status:    "completed",
+		Native:    record,
+	}
+	switch variant := info.AsUnion().(type) {
+	case opencode.UserMessage:
+		msg.Type = "user"
+		msg.Timestamp = opencodeTime(variant.Time.Created)
+	case opencode.AssistantMessage:
+		msg.Type = "assistant"
+		msg.Timestamp = opencodeTime(variant.Time.Created)
+		msg.Agent = variant.Mode
+		if variant.Error.Name != "" {
+			msg.Status = "error"
+		}
+	default:
+		return types.MessageInfo{}, fmt.Errorf("message %s has unknown role %q", info.ID, info.Role)
+	}
+	// Newer servers link a reply to its prompt, which this SDK does not model
+	var parent struct {
+		ParentID string `json:"parentID"`
+	}
+	if json.Unmarshal(native.Info, &parent) == nil {
+		msg.ParentID = parent.ParentID
+	}
+
+	var text []string
+	for _, raw := range native.Parts {
+		var part opencode.Part
+		if err := json.Unmarshal(raw, &part); err != nil {
+			return types.MessageInfo{}, fmt.Errorf("invalid part of message %s: %w", info.ID, err)
+		}
+		if textPart, ok := part.AsUnion().(opencode.TextPart); ok && !textPart.Synthetic {
+			text = append(text, textPart.Text)
+		}
+	}
+	msg.Content = strings.Join(text, "\n")
+	return msg, nil
+}
+
+// opencodeSessionInfo describes a session as opencode records it, updating
+// the native record of an imported session with what has changed since
+func opencodeSessionInfo(session types.SessionInfo) (json.RawMessage, error) {
+	info := map[string]interface{}{}
+	if len(session.Native) > 0 {
+		if err := json.Unmarshal(session.Native, &info); err != nil {
+			return nil, fmt.Errorf("invalid native record of session %s: %w", session.ID, err)
+		}
+	}
+	sessionTime, _ := info["time"].(map[string]interface{})
+	if sessionTime == nil {
+		sessionTime = map[string]interface{}{}
+	}
+	sessionTime["created"] = opencodeMillis(session.CreatedAt)
+	sessionTime["updated"] = opencodeMillis(session.UpdatedAt)
+
+	info["id"] = session.ID
+	info["title"] = session.Title
+	info["time"] = sessionTime
+	for field, value := range map[string]string{"directory": session.Workspace, "projectID": "", "version": ""} {
+		if _, ok := info[field]; !ok {
+			info[field] = value
+		}
+	}
+	return json.Marshal(info)
+}
+
+// opencodeMessage describes a message recorded only in state as opencode
+// would have: its body becomes one text part, and notes of the orchestrator,
+// which opencode has no role for, synthetic assistant text
+func opencodeMessage(msg types.MessageInfo, snapshot *types.SharedApplicationState, session types.SessionInfo) (OpencodeMessage, error) {
+	created := opencodeMillis(msg.Timestamp)
+	info := map[string]interface{}{
+		"id":        msg.ID,
+		"sessionID": msg.SessionID,
+	}
+	if msg.Type == "user" {
+		info["role"] = "user"
+		info["time"] = map[string]interface{}{"created": created}
+	} else {
+		messageTime := map[string]interface{}{"created": created}
+		if msg.Status == "completed" {
+			messageTime["completed"] = created
+		}
+		info["role"] = "assistant"
+		info["time"] = messageTime
+		info["providerID"] = snapshot.Provider
+		info["modelID"] = snapshot.Model
+		info["mode"] = snapshot.Agent
+		if msg.Agent != "" {
+			info["mode"] = msg.Agent
+		}
+		info["cost"] = 0
+		info["system"] = []string{}
+		info["tokens"] = map[string]interface{}{
+			"input": 0, "output": 0, "reasoning": 0,
+			"cache": map[string]interface{}{"read": 0, "write": 0},
+		}
+		info["path"] = map[string]interface{}{"cwd": session.Workspace, "root": session.Workspace}
+		if msg.ParentID != "" {
+			info["parentID"] = msg.ParentID
+		}
+	}
+
+	var parts []json.RawMessage
+	for _, part := range msg.Parts {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return OpencodeMessage{}, fmt.Errorf("failed to encode part of message %s: %w", msg.ID, err)
+		}
+		parts = append(parts, data)
+	}
+	if len(parts) == 0 && msg.Content != "" {
+		data, err := json.Marshal(map[string]interface{}{
+			"id":        "prt_" + strings.TrimPrefix(msg.ID, "msg_"),
+			"messageID": msg.ID,
+			"sessionID": msg.SessionID,
+			"type":      "text",
+			"text":      msg.Content,
+			"synthetic": msg.Type != "user" && msg.Type != "assistant",
+		})
+		if err != nil {
+			return OpencodeMessage{}, err
+		}
+		parts = append(parts, data)
+	}
+
+	data, err := json.Marshal(info)
+	if err != nil {
+		return OpencodeMessage{}, err
+	}
+	if parts == nil {
+		parts = []json.RawMessage{}
+	}
+	return OpencodeMessage{Info: data, Parts: parts}, nil
+}
+
+// opencodeTime converts opencode's milliseconds since the epoch
+func opencodeTime(millis float64) time.Time {
+	if millis <= 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(millis)).UTC()
+}
+
+// opencodeMillis converts to opencode's milliseconds since the epoch
+func opencodeMillis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
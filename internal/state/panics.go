@@ -0,0 +1,98 @@
+package state
+
+import (
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Components whose panics are recovered, as counted in metrics and named in
+// internal_error events
+const (
+	ComponentApply    = "apply_loop"
+	ComponentSave     = "save_worker"
+	ComponentAutoSave = "autosave_worker"
+	ComponentGC       = "gc_worker"
+	ComponentResync   = "resync_worker"
+)
+
+// workerRestartDelay keeps a worker that panics as soon as it starts from
+// spinning
+const workerRestartDelay = time.Second
+
+// ReportPanic records a recovered panic: the stack is logged, the panic is
+// counted by component and panels are told with an internal_error event.
+// context names what was being handled, if anything.
+func (manager *PanelSyncManager) ReportPanic(component, context string, value interface{}, stack []byte) {
+	manager.metrics.RecordPanic(component)
+	log.Printf("[PANIC] Recovered panic in %s (%s): %v\n%s", component, context, value, stack)
+
+	// The panic may have come from the event bus itself
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[PANIC] Failed to announce panic in %s: %v", component, r)
+		}
+	}()
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:   generateEventID(),
+		Type: types.EventInternalError,
+		Data: types.InternalErrorPayload{
+			Component: component,
+			Error:     fmt.Sprint(value),
+			Context:   context,
+		},
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+}
+
+// runWorker runs a background worker, restarting it after a panic until the
+// manager stops
+func (manager *PanelSyncManager) runWorker(component string, worker func()) {
+	for manager.runRecovered(component, worker) {
+		select {
+		case <-manager.ctx.Done():
+			return
+		case <-time.After(workerRestartDelay):
+		}
+	}
+}
+
+// runRecovered runs fn and reports whether it panicked
+func (manager *PanelSyncManager) runRecovered(component string, fn func()) (panicked bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			manager.ReportPanic(component, "", r, debug.Stack())
+			panicked = true
+		}
+	}()
+	fn()
+	return false
+}
+
+// applyRecovered processes a queued update, failing that update rather than
+// the apply loop when it panics
+func (manager *PanelSyncManager) applyRecovered(request applyRequest) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			manager.ReportPanic(ComponentApply, fmt.Sprintf("%s update %s from %s", request.update.Type, request.update.ID, request.update.SourcePanel), r, debug.Stack())
+			err = fmt.Errorf("internal error applying %s update: %v", request.update.Type, r)
+		}
+	}()
+	return manager.processApplyRequest(request)
+}
+
+// writeStateRecovered writes the state, failing the save rather than the
+// save worker when it panics
+func (manager *PanelSyncManager) writeStateRecovered() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			manager.ReportPanic(ComponentSave, "", r, debug.Stack())
+			err = fmt.Errorf("internal error saving state: %v", r)
+		}
+	}()
+	return manager.writeState()
+}
@@ -0,0 +1,120 @@
+package state
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// panickingRepository panics on save while panicking is set
+type panickingRepository struct {
+	stubRepository
+	panicking atomic.Bool
+}
+
+func (r *panickingRepository) SaveStateAtomic(state *types.SharedApplicationState) error {
+	if r.panicking.Load() {
+		panic("corrupt index")
+	}
+	return r.stubRepository.SaveStateAtomic(state)
+}
+
+// waitInternalError returns the next internal_error event on events
+func waitInternalError(t *testing.T, events chan types.StateEvent) types.InternalErrorPayload {
+	t.Helper()
+	deadline := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-events:
+			if event.Type == types.EventInternalError {
+				return event.Data.(types.InternalErrorPayload)
+			}
+		case <-deadline:
+			t.Fatal("no internal_error event")
+		}
+	}
+}
+
+func TestSaveWorkerSurvivesPanic(t *testing.T) {
+	repository := &panickingRepository{}
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(10), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	defer manager.Stop()
+	events := make(chan types.StateEvent, 10)
+	manager.eventBus.Subscribe("conn", "panel", "test", events)
+
+	repository.panicking.Store(true)
+	if err := manager.SaveStateSync(); err == nil {
+		t.Fatal("SaveStateSync() succeeded through a panic")
+	}
+	payload := waitInternalError(t, events)
+	if payload.Component != ComponentSave || payload.Error != "corrupt index" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// The worker is still there for the next save
+	repository.panicking.Store(false)
+	if err := manager.SaveStateSync(); err != nil {
+		t.Fatalf("SaveStateSync() after a panic error = %v", err)
+	}
+	if got := manager.GetMetrics().Panics[ComponentSave]; got != 1 {
+		t.Errorf("save panics = %d, want 1", got)
+	}
+}
+
+func TestRunWorkerRestartsAfterPanic(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	var runs atomic.Int32
+	done := make(chan struct{})
+	go func() {
+		manager.runWorker(ComponentGC, func() {
+			if runs.Add(1) == 1 {
+				panic("nil map")
+			}
+		})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("worker never restarted")
+	}
+	if runs.Load() != 2 {
+		t.Errorf("worker ran %d times, want 2", runs.Load())
+	}
+	if got := manager.GetMetrics().Panics[ComponentGC]; got != 1 {
+		t.Errorf("gc panics = %d, want 1", got)
+	}
+}
+
+func TestApplyRecoveredFailsOnlyTheUpdate(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 10)
+	manager.eventBus.Subscribe("conn", "panel", "test", events)
+
+	// Checking the version panics on the missing state
+	state := manager.state
+	manager.state = nil
+	err := manager.applyRecovered(applyRequest{update: types.StateUpdate{Type: types.MessageAdded, ID: "update_1", SourcePanel: "input"}, strict: true})
+	manager.state = state
+	if err == nil {
+		t.Fatal("applyRecovered() succeeded through a panic")
+	}
+	payload := waitInternalError(t, events)
+	if payload.Component != ComponentApply || payload.Context != "message_added update update_1 from input" {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	// The state lock was released and later updates apply
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "after", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() after a failed update error = %v", err)
+	}
+}
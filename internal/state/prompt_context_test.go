@@ -0,0 +1,62 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestPromptContextFollowsInputLocation(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	first := types.CodeLocation{Path: "/w/main.go", Line: 3, Column: 1}
+	second := types.CodeLocation{Path: "/w/util.go", Line: 7, Column: 4}
+
+	if err := apply(types.InputLocationChanged, types.InputLocationPayload{Location: &types.CodeLocation{Path: "main.go", Line: 1, Column: 1}}); err == nil {
+		t.Errorf("relative location accepted")
+	}
+	if err := apply(types.InputLocationChanged, types.InputLocationPayload{Location: &first}); err != nil {
+		t.Fatalf("attach location error = %v", err)
+	}
+	if err := apply(types.PromptContextUpdated, types.PromptContextPayload{Context: types.PromptContext{Location: second, Hover: "stale"}}); err == nil {
+		t.Errorf("context for another location accepted")
+	}
+	if err := apply(types.PromptContextUpdated, types.PromptContextPayload{Context: types.PromptContext{Location: first, Hover: "func main()"}}); err != nil {
+		t.Fatalf("store context error = %v", err)
+	}
+	if got := manager.GetState().GetPromptContext(); got == nil || got.Hover != "func main()" {
+		t.Fatalf("prompt context = %+v", got)
+	}
+
+	// Re-attaching the same location keeps the context; moving drops it
+	if err := apply(types.InputLocationChanged, types.InputLocationPayload{Location: &first}); err != nil {
+		t.Fatal(err)
+	}
+	if manager.GetState().GetPromptContext() == nil {
+		t.Errorf("context dropped when the location did not change")
+	}
+	if err := apply(types.InputLocationChanged, types.InputLocationPayload{Location: &second}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetPromptContext(); got != nil {
+		t.Errorf("context kept after the location moved: %+v", got)
+	}
+
+	if err := apply(types.InputLocationChanged, types.InputLocationPayload{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := manager.GetState().GetInputLocation(); ok {
+		t.Errorf("location still attached after detaching")
+	}
+}
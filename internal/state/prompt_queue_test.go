@@ -0,0 +1,91 @@
+package state
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestPromptQueue(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+	queued := func() string {
+		var parts []string
+		for _, prompt := range manager.GetState().Clone().PromptQueue {
+			parts = append(parts, prompt.ID+"="+prompt.Text)
+		}
+		return strings.Join(parts, ",")
+	}
+
+	for _, id := range []string{"s1", "s2"} {
+		if err := apply(types.SessionAdded, types.SessionAddPayload{Session: testutil.Session(id, id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, prompt := range []types.QueuedPrompt{
+		{ID: "p1", SessionID: "s1", Text: "first"},
+		{ID: "p2", SessionID: "s1", Text: "second"},
+		{ID: "p3", SessionID: "s2", Text: "other"},
+		{ID: "p4", SessionID: "s1", Text: "third"},
+	} {
+		if err := apply(types.PromptQueued, types.PromptQueuedPayload{Prompt: prompt}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := manager.GetState().Clone().PromptQueue[0].QueuedAt; got.IsZero() {
+		t.Error("queued prompt has no queue time")
+	}
+
+	// Queuing an existing ID edits it in place
+	if err := apply(types.PromptQueued, types.PromptQueuedPayload{Prompt: types.QueuedPrompt{ID: "p2", SessionID: "s1", Text: "second, edited"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.PromptQueueReordered, types.PromptQueueReorderPayload{PromptID: "p4", Before: "p1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := queued(), "p4=third,p1=first,p2=second, edited,p3=other"; got != want {
+		t.Errorf("queue = %s, want %s", got, want)
+	}
+
+	if err := apply(types.PromptDequeued, types.PromptDequeuedPayload{PromptID: "p4", Reason: types.DequeueSubmitted}); err != nil {
+		t.Fatal(err)
+	}
+	// A prompt can only be taken once
+	if err := apply(types.PromptDequeued, types.PromptDequeuedPayload{PromptID: "p4", Reason: types.DequeueSubmitted}); err == nil {
+		t.Error("dequeued a prompt twice")
+	}
+
+	for _, bad := range []struct {
+		updateType types.UpdateType
+		payload    interface{}
+	}{
+		{types.PromptQueued, types.PromptQueuedPayload{Prompt: types.QueuedPrompt{ID: "p5", SessionID: "s1", Text: "  "}}},
+		{types.PromptQueued, types.PromptQueuedPayload{Prompt: types.QueuedPrompt{SessionID: "s1", Text: "no id"}}},
+		{types.PromptQueued, types.PromptQueuedPayload{Prompt: types.QueuedPrompt{ID: "p1", SessionID: "s2", Text: "moved"}}},
+		{types.PromptQueueReordered, types.PromptQueueReorderPayload{PromptID: "p1", After: "p3"}},
+	} {
+		if err := apply(bad.updateType, bad.payload); err == nil {
+			t.Errorf("%s %+v was accepted", bad.updateType, bad.payload)
+		}
+	}
+
+	// Deleting a session drops its queue
+	if err := apply(types.SessionDeleted, types.SessionDeletePayload{SessionID: "s1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := queued(); got != "p3=other" {
+		t.Errorf("queue after deleting s1 = %s, want p3=other", got)
+	}
+}
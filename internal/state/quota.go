@@ -0,0 +1,202 @@
+package state
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+const (
+	// StorageQuotaWarnRatio is the share of MaxStateSize at which panels are warned
+	StorageQuotaWarnRatio = 0.8
+	// minCompactThreshold is the smallest body compaction moves to the blob store
+	minCompactThreshold = 1024
+	// recompactGrowth is how much the state must grow past the size it had at the
+	// last compaction before an oversized state is compacted again
+	recompactGrowth = 1.1
+)
+
+// errNothingToCompact is returned when the retention policy keeps everything
+// and no body is large enough to offload
+var errNothingToCompact = errors.New("nothing to compact")
+
+// RetentionPolicy bounds what compaction keeps; zero values keep everything
+type RetentionPolicy struct {
+	// MaxMessagesPerSession keeps only the newest messages of each unlocked session
+	MaxMessagesPerSession int `json:"max_messages_per_session"`
+}
+
+// CompactState shrinks the state by pruning messages beyond the retention policy
+// and moving bodies above a lowered threshold into the blob store. Locked
+// sessions are left alone. The applied payload is returned.
+func (manager *PanelSyncManager) CompactState(reason string) (types.StateCompactPayload, error) {
+	payload := types.StateCompactPayload{Reason: reason}
+
+	manager.syncMutex.RLock()
+	if limit := manager.GetConfig().Retention.MaxMessagesPerSession; limit > 0 {
+		payload.MessageIDs = selectPrunedMessages(manager.state, limit, manager.now())
+	}
+	if manager.blobs != nil && manager.blobThreshold > minCompactThreshold {
+		payload.OffloadThreshold = max(manager.blobThreshold/4, minCompactThreshold)
+	}
+	manager.syncMutex.RUnlock()
+
+	if len(payload.MessageIDs) == 0 && payload.OffloadThreshold == 0 {
+		return payload, errNothingToCompact
+	}
+
+	update := types.StateUpdate{
+		ID:          generateUpdateID(),
+		Type:        types.StateCompacted,
+		Payload:     payload,
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	}
+	if err := manager.applyUpdateWithEvents(update); err != nil {
+		return payload, err
+	}
+
+	log.Printf("Compacted state (%s): pruned %d messages, offload threshold %d",
+		reason, len(payload.MessageIDs), payload.OffloadThreshold)
+	return payload, nil
+}
+
+// selectPrunedMessages returns the oldest messages of each unlocked session beyond limit
+func selectPrunedMessages(state *types.SharedApplicationState, limit int, now time.Time) []string {
+	counts := make(map[string]int)
+	for _, msg := range state.Messages {
+		counts[msg.SessionID]++
+	}
+
+	var pruned []string
+	seen := make(map[string]int)
+	for _, msg := range state.Messages {
+		excess := counts[msg.SessionID] - limit
+		if excess <= 0 || seen[msg.SessionID] >= excess {
+			continue
+		}
+		if _, locked := state.GetSessionLock(msg.SessionID, now); locked {
+			continue
+		}
+		seen[msg.SessionID]++
+		pruned = append(pruned, msg.ID)
+	}
+	return pruned
+}
+
+// applyCompactionLocked removes pruned messages and offloads large bodies, and
+// returns the payload to broadcast (caller must hold syncMutex)
+func (manager *PanelSyncManager) applyCompactionLocked(payload types.StateCompactPayload) types.StateCompactPayload {
+	now := manager.now()
+	prune := make(map[string]bool, len(payload.MessageIDs))
+	for _, id := range payload.MessageIDs {
+		prune[id] = true
+	}
+
+	// A session locked since the selection keeps its messages
+	var pruned []string
+	kept := manager.state.Messages[:0]
+	for _, msg := range manager.state.Messages {
+		if prune[msg.ID] && manager.checkSessionLockLocked(msg.SessionID, "system", now) == nil {
+			pruned = append(pruned, msg.ID)
+			for j := range manager.state.Sessions {
+				if manager.state.Sessions[j].ID == msg.SessionID && manager.state.Sessions[j].MessageCount > 0 {
+					manager.state.Sessions[j].MessageCount--
+					break
+				}
+			}
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	manager.state.Messages = kept
+	payload.MessageIDs = pruned
+
+	removed := make(map[string]bool, len(pruned))
+	for _, id := range pruned {
+		removed[id] = true
+	}
+	manager.removeAnnotationsLocked(func(a types.MessageAnnotation) bool {
+		return removed[a.MessageID]
+	})
+
+	// Blobs of pruned messages stay for history; garbage collection removes them.
+	// Replays have no blob store and keep bodies inline, which reads the same.
+	if payload.OffloadThreshold > 0 && manager.blobs != nil {
+		threshold := manager.blobThreshold
+		manager.blobThreshold = payload.OffloadThreshold
+		payload.Offloaded = 0
+		for i := range manager.state.Messages {
+			msg := &manager.state.Messages[i]
+			before := msg.BodyRef + msg.PartsRef + msg.NativeRef
+			if err := manager.offloadMessageLocked(msg); err != nil {
+				log.Printf("Failed to offload message %s during compaction: %v", msg.ID, err)
+				continue
+			}
+			if msg.BodyRef+msg.PartsRef+msg.NativeRef != before {
+				payload.Offloaded++
+			}
+		}
+		manager.blobThreshold = threshold
+	}
+
+	return payload
+}
+
+// checkStateQuota compares the saved state file against MaxStateSize, warns
+// panels when the level changes and starts compaction once the quota is
+// exceeded. Only the save worker calls it, so quota fields need no lock.
+func (manager *PanelSyncManager) checkStateQuota() {
+	maxSize := manager.GetConfig().MaxStateSize
+	if maxSize <= 0 {
+		return
+	}
+
+	size := manager.repository.GetStats().FileSize
+	level := types.QuotaOK
+	switch {
+	case size > maxSize:
+		level = types.QuotaExceeded
+	case float64(size) > float64(maxSize)*StorageQuotaWarnRatio:
+		level = types.QuotaWarning
+	}
+
+	compact := level == types.QuotaExceeded && manager.ctx.Err() == nil && !manager.compacting.Load() &&
+		(manager.compactedAtSize == 0 || float64(size) > float64(manager.compactedAtSize)*recompactGrowth)
+	if level == manager.quotaLevel && !compact {
+		return
+	}
+	manager.quotaLevel = level
+	if level != types.QuotaExceeded {
+		manager.compactedAtSize = 0
+	}
+
+	if level != types.QuotaOK {
+		log.Printf("Warning: state file is %d bytes, quota %d (%s)", size, maxSize, level)
+	}
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:   generateEventID(),
+		Type: types.EventStorageQuota,
+		Data: types.StorageQuotaPayload{
+			Level:      level,
+			StateSize:  size,
+			MaxSize:    maxSize,
+			Compacting: compact,
+		},
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+
+	if compact {
+		manager.compacting.Store(true)
+		manager.compactedAtSize = size
+		go func() {
+			defer manager.compacting.Store(false)
+			if _, err := manager.CompactState("state file exceeds quota"); err != nil {
+				log.Printf("Automatic compaction did not run: %v", err)
+			}
+		}()
+	}
+}
@@ -0,0 +1,160 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSelectPrunedMessages(t *testing.T) {
+	now := time.Now()
+	state := types.NewSharedApplicationState()
+	for i := 1; i <= 4; i++ {
+		state.Messages = append(state.Messages,
+			types.MessageInfo{ID: fmt.Sprintf("a%d", i), SessionID: "a"},
+			types.MessageInfo{ID: fmt.Sprintf("b%d", i), SessionID: "b"})
+	}
+	state.SessionLocks = []types.SessionLock{
+		{SessionID: "b", Owner: "export", ExpiresAt: now.Add(time.Minute)},
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		want  []string
+	}{
+		{name: "keeps newest per session", limit: 2, want: []string{"a1", "a2"}},
+		{name: "limit above count", limit: 4, want: nil},
+		{name: "keep one", limit: 1, want: []string{"a1", "a2", "a3"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := selectPrunedMessages(state, tt.limit, now); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("selectPrunedMessages() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompactStatePrunesAndOffloads(t *testing.T) {
+	manager := newTestSyncManager(t)
+	store := persistence.NewBlobStore(filepath.Join(t.TempDir(), "blobs"), 0, 0)
+	manager.SetBlobStore(store, 8192)
+	config := manager.GetConfig()
+	config.Retention = RetentionPolicy{MaxMessagesPerSession: 2}
+	if err := manager.SetConfig(config); err != nil {
+		t.Fatalf("SetConfig() error = %v", err)
+	}
+
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	body := strings.Repeat("x", 3000)
+	for i := 1; i <= 4; i++ {
+		message := types.MessageInfo{ID: fmt.Sprintf("m%d", i), SessionID: "s1", Content: body}
+		if err := manager.AddMessage(message, "test"); err != nil {
+			t.Fatalf("AddMessage() error = %v", err)
+		}
+	}
+	if err := manager.AddAnnotation(types.MessageAnnotation{MessageID: "m1", Kind: types.AnnotationRating, Rating: 1}, "test"); err != nil {
+		t.Fatalf("AddAnnotation() error = %v", err)
+	}
+
+	payload, err := manager.CompactState("test")
+	if err != nil {
+		t.Fatalf("CompactState() error = %v", err)
+	}
+	if !reflect.DeepEqual(payload.MessageIDs, []string{"m1", "m2"}) || payload.OffloadThreshold != 2048 {
+		t.Errorf("payload = %+v", payload)
+	}
+
+	state := manager.GetState()
+	if len(state.Messages) != 2 || state.Messages[0].ID != "m3" {
+		t.Fatalf("messages after compaction = %d, first %s", len(state.Messages), state.Messages[0].ID)
+	}
+	for _, msg := range state.Messages {
+		if msg.Content != "" || msg.BodyRef == "" {
+			t.Errorf("message %s not offloaded", msg.ID)
+		}
+	}
+	if len(state.Annotations) != 0 {
+		t.Errorf("annotations of pruned messages survived: %+v", state.Annotations)
+	}
+
+	// Nothing left above the retention limit or inline
+	manager.SetBlobStore(nil, 0)
+	if _, err := manager.CompactState("again"); err != errNothingToCompact {
+		t.Errorf("second CompactState() error = %v, want errNothingToCompact", err)
+	}
+}
+
+// sizedRepository reports a settable state file size
+type sizedRepository struct {
+	stubRepository
+	size atomic.Int64
+}
+
+func (r *sizedRepository) GetStats() interfaces.RepositoryStats {
+	return interfaces.RepositoryStats{FileSize: r.size.Load()}
+}
+
+func TestCheckStateQuotaLevels(t *testing.T) {
+	repository := &sizedRepository{}
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	config.MaxStateSize = 1000
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(10), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	defer manager.Stop()
+
+	events := make(chan types.StateEvent, 16)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+
+	steps := []struct {
+		size int64
+		want string // Level broadcast, "" for none
+		// Compaction started by this step
+		compacting bool
+	}{
+		{size: 500},
+		{size: 850, want: types.QuotaWarning},
+		{size: 900},
+		{size: 1200, want: types.QuotaExceeded, compacting: true},
+		{size: 1250},
+		{size: 1400, want: types.QuotaExceeded, compacting: true},
+		{size: 100, want: types.QuotaOK},
+	}
+	for _, step := range steps {
+		repository.size.Store(step.size)
+		manager.checkStateQuota()
+		for manager.compacting.Load() {
+			time.Sleep(time.Millisecond)
+		}
+
+		select {
+		case event := <-events:
+			payload, ok := event.Data.(types.StorageQuotaPayload)
+			if step.want == "" || event.Type != types.EventStorageQuota || !ok {
+				t.Fatalf("size %d: unexpected event %s %+v", step.size, event.Type, event.Data)
+			}
+			if payload.Level != step.want || payload.Compacting != step.compacting {
+				t.Errorf("size %d: level %s compacting %v, want %s %v",
+					step.size, payload.Level, payload.Compacting, step.want, step.compacting)
+			}
+		default:
+			if step.want != "" {
+				t.Errorf("size %d: no quota event, want %s", step.size, step.want)
+			}
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package state
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/ids"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// RedactionPlaceholder replaces each redacted range of message content
+const RedactionPlaceholder = "[REDACTED]"
+
+// RedactMessage replaces ranges of a message's content with placeholders and
+// records a redaction log entry. Unlike regular updates the state is persisted
+// synchronously, so the unredacted content does not linger in the save queue.
+func (manager *PanelSyncManager) RedactMessage(messageID string, ranges []types.RedactionRange, reason, panelID string) error {
+	if len(ranges) == 0 {
+		return fmt.Errorf("no redaction ranges provided for message %s", messageID)
+	}
+
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.MessageRedacted,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         types.MessageRedactPayload{MessageID: messageID, Ranges: ranges, Reason: reason},
+		SourcePanel:     panelID,
+		Timestamp:       manager.now(),
+	}
+
+	start := time.Now()
+	err := manager.submitUpdate(update, false)
+	manager.metrics.RecordUpdate(update.Type, err == nil, time.Since(start))
+	if err != nil {
+		return err
+	}
+
+	if err := manager.SaveStateSync(); err != nil {
+		return fmt.Errorf("redaction applied but failed to persist: %w", err)
+	}
+	return nil
+}
+
+// applyRedactionLocked rewrites the message content and appends a log entry.
+// It returns the payload to broadcast in place of the redaction request.
+func (manager *PanelSyncManager) applyRedactionLocked(payload types.MessageRedactPayload, source string) (types.MessageUpdatePayload, error) {
+	for i := range manager.state.Messages {
+		msg := &manager.state.Messages[i]
+		if msg.ID != payload.MessageID {
+			continue
+		}
+
+		// Work on a copy so a failed redaction leaves the message untouched
+		redacted := *msg
+		if err := manager.loadMessageBodyLocked(&redacted); err != nil {
+			return types.MessageUpdatePayload{}, fmt.Errorf("failed to load body of message %s: %w", msg.ID, err)
+		}
+
+		normalized := normalizeRedactionRanges(payload.Ranges, len([]rune(redacted.Content)))
+		if len(normalized) == 0 {
+			return types.MessageUpdatePayload{}, fmt.Errorf("redaction ranges are outside message %s", payload.MessageID)
+		}
+
+		redacted.Content = redactContent(redacted.Content, normalized)
+		// Parts may carry the same text, so they are dropped rather than left unredacted
+		redacted.Parts = nil
+		redacted.PartsRef = ""
+		redacted.Native = nil
+		redacted.NativeRef = ""
+		// Offsets into the old body no longer hold, and the meta is of the body as redacted
+		redacted.CodeBlocks = nil
+		meta := codeblocks.Describe(redacted.Content)
+		redacted.Meta = &meta
+		if err := manager.offloadMessageLocked(&redacted); err != nil {
+			return types.MessageUpdatePayload{}, err
+		}
+
+		staleRefs := []string{msg.BodyRef, msg.PartsRef, msg.NativeRef}
+		*msg = redacted
+		if manager.state.CurrentMessage != nil && manager.state.CurrentMessage.ID == msg.ID {
+			current := *msg
+			manager.state.CurrentMessage = &current
+		}
+		// The unredacted blobs must not outlive the redaction
+		manager.dropBlobsLocked(staleRefs...)
+
+		manager.state.Redactions = append(manager.state.Redactions, types.RedactionEntry{
+			ID:         ids.New("redaction"),
+			MessageID:  msg.ID,
+			SessionID:  msg.SessionID,
+			Ranges:     normalized,
+			Reason:     payload.Reason,
+			Source:     source,
+			RedactedAt: manager.now(),
+		})
+
+		return types.MessageUpdatePayload{
+			MessageID: msg.ID,
+			Content:   msg.Content,
+			Status:    msg.Status,
+			BodyRef:   msg.BodyRef,
+			BodySize:  msg.BodySize,
+			Truncated: msg.Truncated,
+			Meta:      msg.Meta,
+		}, nil
+	}
+
+	return types.MessageUpdatePayload{}, fmt.Errorf("message %s not found", payload.MessageID)
+}
+
+// normalizeRedactionRanges clamps ranges to the content length, drops empty
+// ones and merges overlaps so placeholders never nest
+func normalizeRedactionRanges(ranges []types.RedactionRange, length int) []types.RedactionRange {
+	clamped := make([]types.RedactionRange, 0, len(ranges))
+	for _, r := range ranges {
+		if r.Start < 0 {
+			r.Start = 0
+		}
+		if r.End > length {
+			r.End = length
+		}
+		if r.Start < r.End {
+			clamped = append(clamped, r)
+		}
+	}
+
+	sort.Slice(clamped, func(i, j int) bool { return clamped[i].Start < clamped[j].Start })
+
+	merged := make([]types.RedactionRange, 0, len(clamped))
+	for _, r := range clamped {
+		if n := len(merged); n > 0 && r.Start <= merged[n-1].End {
+			if r.End > merged[n-1].End {
+				merged[n-1].End = r.End
+			}
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// redactContent replaces normalized rune ranges with RedactionPlaceholder
+func redactContent(content string, ranges []types.RedactionRange) string {
+	runes := []rune(content)
+	out := make([]rune, 0, len(runes))
+	cursor := 0
+	for _, r := range ranges {
+		out = append(out, runes[cursor:r.Start]...)
+		out = append(out, []rune(RedactionPlaceholder)...)
+		cursor = r.End
+	}
+	out = append(out, runes[cursor:]...)
+	return string(out)
+}
@@ -0,0 +1,31 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+)
+
+func TestReplayUpdateSequence(t *testing.T) {
+	manager := newTestSyncManager(t)
+
+	updates := testutil.NewUpdates("panel-1", 1).
+		AddSession("s1", "First").
+		AddSession("s2", "Second").
+		ChangeSession("s2").
+		AddMessage(testutil.Message("m1", "s2", "user", "hello")).
+		AddMessage(testutil.Message("m2", "s2", "assistant", "hi")).
+		UpdateMessage("m2", "hi there", "completed").
+		DeleteSession("s1").
+		ChangeTheme("tokyonight")
+
+	for _, update := range updates.List() {
+		update.ExpectedVersion = manager.GetState().Version.Version
+		if err := manager.UpdateWithVersionCheck(update); err != nil {
+			t.Fatalf("update %s (%s): %v", update.ID, update.Type, err)
+		}
+	}
+
+	testutil.AssertGoldenJSON(t, "testdata/replay.golden.json", manager.GetState(),
+		append(testutil.StateScrubs, "version.source", "sessions.*.updated_at", "messages.*.updated_at")...)
+}
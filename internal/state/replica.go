@@ -0,0 +1,362 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// ErrReadOnlyReplica is returned for writes sent to a read replica
+var ErrReadOnlyReplica = errors.New("state is read-only on a replica; send updates to the primary")
+
+// ErrReplicaBehind is returned by Apply for an event the replica cannot apply
+// in order, after a missed event or before its first sync; Sync catches it up
+var ErrReplicaBehind = errors.New("replica is behind the primary")
+
+// ReplicaSource is how a replica reaches its primary; *ipc.SocketClient is one
+type ReplicaSource interface {
+	RequestState() (*types.SharedApplicationState, error)
+	ReplayEvents(sinceVersion int64) ([]types.StateEvent, bool, error)
+}
+
+// Replica is a read-only copy of a primary's state, kept current by applying
+// the events the primary broadcasts the way StateAt replays the journal. It
+// serves heavy readers such as exporters and dashboards from a socket server
+// of its own, so their reads never wait on the primary's state lock. Writes
+// fail with ErrReadOnlyReplica.
+// Implements the interfaces.StateManager interface.
+type Replica struct {
+	mutex       sync.RWMutex
+	applier     *PanelSyncManager // Scratch manager the state is kept and events applied in
+	eventBus    *EventBus         // Passes the primary's events on to the replica's readers
+	blobs       *persistence.BlobStore
+	synced      bool
+	diverged    bool               // Events were applied out of order; only a full copy repairs the state
+	pending     []types.StateEvent // Events of a batch sent one at a time, until its last
+	pendingID   string
+	applied     int64
+	resyncs     int64
+	lastApplied time.Time
+}
+
+// NewReplica returns a replica that keeps eventHistory events for readers to
+// replay. It holds no state until the first Sync.
+func NewReplica(eventHistory int) *Replica {
+	return &Replica{eventBus: NewEventBus(eventHistory)}
+}
+
+// SetBlobStore lets the replica serve message bodies from the primary's blob
+// store, which it only ever reads
+func (r *Replica) SetBlobStore(store *persistence.BlobStore) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.blobs = store
+}
+
+// GetEventBus returns the bus the replica's socket server subscribes readers to
+func (r *Replica) GetEventBus() interfaces.EventBus {
+	return r.eventBus
+}
+
+// Version returns the version of the replicated state, 0 before the first sync
+func (r *Replica) Version() int64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.applier == nil {
+		return 0
+	}
+	return r.applier.state.Version.Version
+}
+
+// Reset replaces the replicated state with a full copy from the primary and
+// hands it to the replica's readers as a state sync
+func (r *Replica) Reset(state *types.SharedApplicationState) {
+	r.mutex.Lock()
+	r.applier = &PanelSyncManager{
+		state:     state,
+		eventBus:  NewEventBus(0),
+		replaying: true,
+	}
+	r.synced = true
+	r.diverged = false
+	r.pending = nil
+	event := types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStateSync,
+		Data:        types.StateSyncPayload{State: state.Clone()},
+		Version:     state.Version.Version,
+		Clock:       state.Version.Clock.Clone(),
+		SourcePanel: "system",
+		Timestamp:   state.Version.Timestamp,
+	}
+	r.mutex.Unlock()
+
+	r.eventBus.Broadcast(event)
+}
+
+// Apply applies an event from the primary and passes it on to the replica's
+// readers. Events already applied are ignored. Applying is deterministic, so
+// an event that leaves the replica at a version other than the primary's
+// followed missed events; the replica's state has then diverged and Apply
+// returns ErrReplicaBehind.
+func (r *Replica) Apply(event types.StateEvent) error {
+	r.mutex.Lock()
+	forward, err := r.applyLocked(event)
+	r.mutex.Unlock()
+
+	if forward != nil {
+		r.eventBus.Broadcast(*forward)
+	}
+	return err
+}
+
+// applyLocked applies an event and returns the event to pass on to readers, if any
+func (r *Replica) applyLocked(event types.StateEvent) (*types.StateEvent, error) {
+	if !r.synced {
+		return nil, ErrReplicaBehind
+	}
+	state := r.applier.state
+	current := state.Version.Version
+	if event.Batch != nil {
+		return r.applyBatchMemberLocked(event)
+	}
+
+	updateType, ok := eventUpdates[event.Type]
+	switch {
+	case !ok && event.Type != types.EventStateSync:
+		// Not the outcome of an update, such as a quota warning
+		return &event, nil
+	case event.Version <= current:
+		return nil, nil
+	case !ok:
+		// A state sync stands for an update without an event of its own
+		r.synced = false
+		return nil, fmt.Errorf("%w: version %d, state sync for version %d", ErrReplicaBehind, current, event.Version)
+	}
+
+	var err error
+	if updateType == types.StateBatched {
+		var payload types.StateBatchPayload
+		var updates []types.StateUpdate
+		if err = decodePayload(event.Data, &payload); err == nil {
+			if updates, err = batchedUpdates(payload); err == nil {
+				err = r.applier.replayBatchLocked(updates)
+			}
+		}
+	} else {
+		err = r.applier.applyUpdateLocked(types.StateUpdate{
+			Type:        updateType,
+			Payload:     event.Data,
+			SourcePanel: event.SourcePanel,
+			Timestamp:   event.Timestamp,
+		})
+	}
+	if err != nil {
+		r.synced = false
+		return nil, fmt.Errorf("%w: failed to apply version %d: %v", ErrReplicaBehind, event.Version, err)
+	}
+	if reached := state.Version.Version; reached != event.Version {
+		r.synced = false
+		r.diverged = true
+		return nil, fmt.Errorf("%w: %s from version %d reached %d, primary reached %d", ErrReplicaBehind, event.Type, current, reached, event.Version)
+	}
+	state.Version.Timestamp = event.Timestamp
+	state.Version.Source = event.SourcePanel
+	state.Version.Clock = event.Clock.Clone()
+	state.LastUpdate = event.Timestamp
+	r.applied++
+	r.lastApplied = time.Now()
+	return &event, nil
+}
+
+// applyBatchMemberLocked collects the events of a batch sent one at a time and
+// applies them together once the last arrives
+func (r *Replica) applyBatchMemberLocked(event types.StateEvent) (*types.StateEvent, error) {
+	position := event.Batch
+	if event.Version <= r.applier.state.Version.Version {
+		return nil, nil
+	}
+	if position.Index == 0 {
+		r.pending = r.pending[:0]
+	}
+	if len(r.pending) != position.Index || r.pendingID != position.ID && position.Index > 0 {
+		r.pending = nil
+		r.synced = false
+		return nil, fmt.Errorf("%w: missed events of batch %s", ErrReplicaBehind, position.ID)
+	}
+	r.pendingID = position.ID
+	event.Batch = nil
+	r.pending = append(r.pending, event)
+	if !position.Last() {
+		return nil, nil
+	}
+
+	members := r.pending
+	r.pending = nil
+	source := members[0].SourcePanel
+	for _, member := range members[1:] {
+		if member.SourcePanel != source {
+			source = ""
+		}
+	}
+	return r.applyLocked(types.StateEvent{
+		ID:          position.ID,
+		Type:        types.EventStateBatch,
+		Data:        types.StateBatchPayload{Events: members},
+		Version:     event.Version,
+		Clock:       event.Clock,
+		SourcePanel: source,
+		Timestamp:   event.Timestamp,
+	})
+}
+
+// Sync catches the replica up with the primary: by replaying the events it
+// missed when its state is intact and the primary still holds them, otherwise
+// with a full copy
+func (r *Replica) Sync(source ReplicaSource) error {
+	r.mutex.Lock()
+	r.resyncs++
+	replayable := r.applier != nil && !r.diverged
+	r.mutex.Unlock()
+
+	if replayable {
+		if events, complete, err := source.ReplayEvents(r.Version()); err == nil && complete {
+			r.mutex.Lock()
+			r.synced = true
+			r.mutex.Unlock()
+
+			var applyErr error
+			for _, event := range events {
+				if applyErr = r.Apply(event); applyErr != nil {
+					break
+				}
+			}
+			if applyErr == nil {
+				return nil
+			}
+			log.Printf("[REPLICA] Replaying missed events failed, fetching full state: %v", applyErr)
+		}
+	}
+
+	state, err := source.RequestState()
+	if err != nil {
+		return fmt.Errorf("failed to fetch state from primary: %w", err)
+	}
+	r.Reset(state)
+	log.Printf("[REPLICA] Synced full state version %d from primary", state.Version.Version)
+	return nil
+}
+
+// Follow handles an event from the primary: a state sync replaces the state,
+// anything else is applied, and a replica that fell behind catches up
+func (r *Replica) Follow(source ReplicaSource, event types.StateEvent) error {
+	if event.Type == types.EventStateSync {
+		var payload types.StateSyncPayload
+		if err := decodePayload(event.Data, &payload); err == nil && payload.State != nil {
+			r.Reset(payload.State)
+			return nil
+		}
+	}
+
+	err := r.Apply(event)
+	if errors.Is(err, ErrReplicaBehind) {
+		log.Printf("[REPLICA] %v; catching up", err)
+		return r.Sync(source)
+	}
+	return err
+}
+
+// GetState returns a copy of the replicated state
+func (r *Replica) GetState() *types.SharedApplicationState {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	if r.applier == nil {
+		return nil
+	}
+	return r.applier.state.Clone()
+}
+
+// UpdateWithVersionCheck rejects the update; replicas are read-only
+func (r *Replica) UpdateWithVersionCheck(update types.StateUpdate) error {
+	return ErrReadOnlyReplica
+}
+
+// ForceFullSync hands the replicated state to every reader as a state sync
+func (r *Replica) ForceFullSync() error {
+	state := r.GetState()
+	if state == nil {
+		return ErrReplicaBehind
+	}
+	r.eventBus.Broadcast(types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStateSync,
+		Data:        types.StateSyncPayload{State: state},
+		Version:     state.Version.Version,
+		SourcePanel: "system",
+		Timestamp:   time.Now(),
+	})
+	return nil
+}
+
+// SaveStateSync does nothing; the primary persists the state
+func (r *Replica) SaveStateSync() error {
+	return nil
+}
+
+// IsHealthy reports whether the replica holds an in-order copy of the state
+func (r *Replica) IsHealthy() bool {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return r.synced
+}
+
+// GetMetrics counts the events applied, as updates, and the catch-ups, as
+// failed ones
+func (r *Replica) GetMetrics() interfaces.StateManagerMetrics {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	return interfaces.StateManagerMetrics{
+		TotalUpdates:      r.applied + r.resyncs,
+		SuccessfulUpdates: r.applied,
+		FailedUpdates:     r.resyncs,
+		LastUpdateTime:    r.lastApplied,
+	}
+}
+
+// ClearSessionMessages rejects the change; replicas are read-only
+func (r *Replica) ClearSessionMessages(sessionID string, panelID string) error {
+	return ErrReadOnlyReplica
+}
+
+// RedactMessage rejects the change; replicas are read-only
+func (r *Replica) RedactMessage(messageID string, ranges []types.RedactionRange, reason, panelID string) error {
+	return ErrReadOnlyReplica
+}
+
+// GetBlob returns an offloaded message body or parts list from the primary's blob store
+func (r *Replica) GetBlob(hash string) ([]byte, error) {
+	r.mutex.RLock()
+	store := r.blobs
+	r.mutex.RUnlock()
+
+	if store == nil {
+		return nil, errBlobsDisabled
+	}
+	return store.Get(hash)
+}
+
+// StateAt returns the current state; past versions are rebuilt by the
+// primary, which keeps the journal
+func (r *Replica) StateAt(version int64) (*types.SharedApplicationState, error) {
+	state := r.GetState()
+	if state == nil || state.Version.Version != version {
+		return nil, fmt.Errorf("%w; ask the primary for past versions", errHistoryDisabled)
+	}
+	return state, nil
+}
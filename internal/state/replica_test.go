@@ -0,0 +1,185 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// primarySource serves a replica from a manager in the same process
+type primarySource struct {
+	manager  *PanelSyncManager
+	requests int
+}
+
+func (s *primarySource) RequestState() (*types.SharedApplicationState, error) {
+	s.requests++
+	return s.manager.GetState(), nil
+}
+
+func (s *primarySource) ReplayEvents(sinceVersion int64) ([]types.StateEvent, bool, error) {
+	return s.manager.eventBus.GetEventsSince(sinceVersion)
+}
+
+// drainEvents returns the events broadcast so far, as they arrive over IPC
+func drainEvents(t *testing.T, events chan types.StateEvent) []types.StateEvent {
+	t.Helper()
+	var drained []types.StateEvent
+	for {
+		select {
+		case event := <-events:
+			data, err := json.Marshal(event)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded types.StateEvent
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			drained = append(drained, decoded)
+		default:
+			return drained
+		}
+	}
+}
+
+func assertReplicated(t *testing.T, primary *PanelSyncManager, replica *Replica) {
+	t.Helper()
+	want, got := primary.GetState(), replica.GetState()
+	if got.Version.Version != want.Version.Version {
+		t.Errorf("replica version = %d, want %d", got.Version.Version, want.Version.Version)
+	}
+	for _, section := range []struct {
+		name      string
+		want, got any
+	}{
+		{"sessions", want.Sessions, got.Sessions},
+		{"messages", want.Messages, got.Messages},
+		{"current session", want.CurrentSessionID, got.CurrentSessionID},
+	} {
+		wantJSON, _ := json.Marshal(section.want)
+		gotJSON, _ := json.Marshal(section.got)
+		if string(gotJSON) != string(wantJSON) {
+			t.Errorf("replica %s = %s, want %s", section.name, gotJSON, wantJSON)
+		}
+	}
+}
+
+func TestReplicaFollowsPrimary(t *testing.T) {
+	primary := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	primary.eventBus.Subscribe("replica", "replica", "controller", events)
+	source := &primarySource{manager: primary}
+
+	replica := NewReplica(10)
+	if replica.IsHealthy() {
+		t.Error("replica is healthy before its first sync")
+	}
+	if err := replica.Sync(source); err != nil {
+		t.Fatal(err)
+	}
+	readers := make(chan types.StateEvent, 64)
+	replica.eventBus.Subscribe("reader", "reader", "controller", readers)
+
+	if err := primary.AddSession(types.SessionInfo{ID: "s1", Title: "work", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"m1", "m2", "secret"} {
+		if err := primary.AddMessage(types.MessageInfo{ID: id, SessionID: "s1", Type: "user", Content: "token=hunter2\nexpires=never"}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The redaction spans lines, so the message's meta changes with it
+	if err := primary.RedactMessage("secret", []types.RedactionRange{{Start: 6, End: 27}}, "test", "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	forwarded := drainEvents(t, events)
+	for _, event := range forwarded {
+		if err := replica.Follow(source, event); err != nil {
+			t.Fatalf("Follow(%s) error = %v", event.Type, err)
+		}
+	}
+	assertReplicated(t, primary, replica)
+	if source.requests != 1 {
+		t.Errorf("replica fetched the full state %d times, want only the first sync", source.requests)
+	}
+	if got := len(drainEvents(t, readers)); got != len(forwarded) {
+		t.Errorf("readers got %d events, want the %d from the primary", got, len(forwarded))
+	}
+}
+
+func TestReplicaCatchesUpAfterGap(t *testing.T) {
+	primary := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	primary.eventBus.Subscribe("replica", "replica", "controller", events)
+	source := &primarySource{manager: primary}
+
+	replica := NewReplica(10)
+	if err := replica.Sync(source); err != nil {
+		t.Fatal(err)
+	}
+	if err := primary.AddSession(types.SessionInfo{ID: "s1", Title: "work", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"m1", "m2"} {
+		if err := primary.AddMessage(types.MessageInfo{ID: id, SessionID: "s1", Type: "user", Content: id}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Applying the last event without the one before it leaves the replica
+	// short of the primary's version
+	forwarded := drainEvents(t, events)
+	if err := replica.Apply(forwarded[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := replica.Apply(forwarded[len(forwarded)-1]); !errors.Is(err, ErrReplicaBehind) {
+		t.Fatalf("Apply() after a gap = %v, want ErrReplicaBehind", err)
+	}
+	if replica.IsHealthy() {
+		t.Error("replica is healthy after a gap")
+	}
+
+	// Its state diverged, so it is fetched whole rather than replayed onto
+	if err := replica.Follow(source, forwarded[len(forwarded)-1]); err != nil {
+		t.Fatal(err)
+	}
+	assertReplicated(t, primary, replica)
+	if !replica.IsHealthy() || source.requests != 2 {
+		t.Errorf("healthy = %v after %d full fetches, want 2", replica.IsHealthy(), source.requests)
+	}
+
+	// Events already applied, such as those re-sent after a reconnect, are ignored
+	for _, event := range forwarded {
+		if err := replica.Apply(event); err != nil {
+			t.Errorf("Apply() of an old event = %v", err)
+		}
+	}
+	assertReplicated(t, primary, replica)
+}
+
+func TestReplicaIsReadOnly(t *testing.T) {
+	primary := newTestSyncManager(t)
+	replica := NewReplica(10)
+	if err := replica.Sync(&primarySource{manager: primary}); err != nil {
+		t.Fatal(err)
+	}
+
+	writes := map[string]error{
+		"update": replica.UpdateWithVersionCheck(types.StateUpdate{Type: types.SessionAdded}),
+		"clear":  replica.ClearSessionMessages("s1", "test"),
+		"redact": replica.RedactMessage("m1", nil, "test", "test"),
+	}
+	for name, err := range writes {
+		if !errors.Is(err, ErrReadOnlyReplica) {
+			t.Errorf("%s on a replica = %v, want ErrReadOnlyReplica", name, err)
+		}
+	}
+	if _, err := replica.GetBlob("abc"); err == nil {
+		t.Error("GetBlob() without a blob store succeeded")
+	}
+}
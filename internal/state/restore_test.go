@@ -0,0 +1,55 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestRestoreStateContinuesVersions(t *testing.T) {
+	manager := newTestSyncManager(t)
+	if err := manager.AddSession(types.SessionInfo{ID: "s1", Title: "kept", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	backup := manager.GetState()
+	if err := manager.AddSession(types.SessionInfo{ID: "s2", Title: "lost", CreatedAt: time.Now()}, "test"); err != nil {
+		t.Fatalf("AddSession() error = %v", err)
+	}
+	before := manager.GetState().GetCurrentVersion()
+
+	events := make(chan types.StateEvent, 8)
+	manager.eventBus.Subscribe("conn", "sessions", "sessions", events)
+	for len(events) > 0 {
+		<-events // Connection notice
+	}
+
+	if err := manager.RestoreState(backup); err != nil {
+		t.Fatalf("RestoreState() error = %v", err)
+	}
+
+	restored := manager.GetState()
+	if len(restored.Sessions) != 1 || restored.Sessions[0].ID != "s1" {
+		t.Errorf("restored sessions = %+v, want only s1", restored.Sessions)
+	}
+	if got := restored.GetCurrentVersion(); got != before+1 {
+		t.Errorf("restored version = %d, want %d", got, before+1)
+	}
+
+	select {
+	case event := <-events:
+		if event.Type != types.EventStateSync || event.Version != before+1 {
+			t.Errorf("broadcast %s at v%d, want state sync at v%d", event.Type, event.Version, before+1)
+		}
+	default:
+		t.Error("no state sync broadcast after restore")
+	}
+
+	persisted, err := manager.repository.LoadStateAtomic()
+	if err != nil {
+		t.Fatalf("LoadStateAtomic() error = %v", err)
+	}
+	if len(persisted.Sessions) != 1 {
+		t.Errorf("persisted %d sessions, want 1", len(persisted.Sessions))
+	}
+}
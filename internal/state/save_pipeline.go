@@ -0,0 +1,171 @@
+package state
+
+import (
+	"fmt"
+	"time"
+)
+
+// SaveFuture is the pending outcome of a queued save. Every future is resolved
+// exactly once: with the save's own error, or with ErrSyncManagerStopped when
+// the manager stopped before the save was accepted.
+type SaveFuture struct {
+	done chan struct{}
+	err  error
+}
+
+func newSaveFuture() *SaveFuture {
+	return &SaveFuture{done: make(chan struct{})}
+}
+
+// resolve publishes the outcome; the save worker and enqueueSave each resolve
+// only the futures they own, so it is never called twice
+func (f *SaveFuture) resolve(err error) {
+	f.err = err
+	close(f.done)
+}
+
+// Done is closed once the outcome is available
+func (f *SaveFuture) Done() <-chan struct{} {
+	return f.done
+}
+
+// Wait blocks until the save has been attempted and returns its error
+func (f *SaveFuture) Wait() error {
+	<-f.done
+	return f.err
+}
+
+// saveRequest asks the save worker to persist state at least as new as when it was queued
+type saveRequest struct {
+	future *SaveFuture
+}
+
+// SaveStateAsync queues a save and returns its future without waiting. When
+// the queue is full the caller waits for room rather than losing the save.
+func (manager *PanelSyncManager) SaveStateAsync() *SaveFuture {
+	return manager.enqueueSave(true)
+}
+
+// SaveStateSync saves the state and returns the save's error, or
+// ErrSyncManagerStopped once Stop has begun. It never blocks past shutdown.
+func (manager *PanelSyncManager) SaveStateSync() error {
+	return manager.SaveStateAsync().Wait()
+}
+
+// enqueueSave hands a request to the save worker. Non-blocking requests are
+// dropped when the queue is full, which loses nothing: a queued save writes
+// the state current when it runs, not when it was queued.
+func (manager *PanelSyncManager) enqueueSave(block bool) *SaveFuture {
+	future := newSaveFuture()
+
+	manager.saveMutex.RLock()
+	defer manager.saveMutex.RUnlock()
+
+	if manager.saveClosed {
+		future.resolve(ErrSyncManagerStopped)
+		return future
+	}
+
+	request := saveRequest{future: future}
+	if block {
+		// The worker keeps draining until the queue is closed, and closing
+		// waits for this read lock, so the send always completes
+		manager.saveQueue <- request
+		return future
+	}
+
+	select {
+	case manager.saveQueue <- request:
+	default:
+		manager.metrics.coalescedSaves.Add(1)
+		future.resolve(nil)
+	}
+	return future
+}
+
+// saveWorker is the only writer of the state file while the manager runs. Requests
+// that pile up during a write are coalesced into the next one, and the queue is
+// drained after Stop closes it, so every accepted future gets a real outcome. A
+// queue closed by a resize is drained the same way before its replacement is read.
+func (manager *PanelSyncManager) saveWorker() {
+	defer close(manager.saveDone)
+
+	manager.saveMutex.RLock()
+	queue := manager.saveQueue
+	manager.saveMutex.RUnlock()
+
+	for queue != nil {
+		for request := range queue {
+			pending := []*SaveFuture{request.future}
+		coalesce:
+			for {
+				select {
+				case next, ok := <-queue:
+					if !ok {
+						break coalesce
+					}
+					pending = append(pending, next.future)
+				default:
+					break coalesce
+				}
+			}
+
+			err := manager.writeStateRecovered()
+			for _, future := range pending {
+				future.resolve(err)
+			}
+		}
+		queue = manager.nextSaveQueue(queue)
+	}
+}
+
+// writeState persists a clone of the current state. Only the save worker and
+// Stop, after the worker has exited, call it.
+func (manager *PanelSyncManager) writeState() error {
+	done := manager.watchSlow(SlowOperation{Kind: SlowKindSave}, manager.GetConfig().SlowSave)
+	defer done()
+
+	manager.syncMutex.RLock()
+	stateClone := manager.state.Clone()
+	tracer, parent := manager.tracer, manager.lastTrace
+	manager.syncMutex.RUnlock()
+
+	// Saves are coalesced, so the span joins the trace of the newest update written
+	span := tracer.Start(parent, "state.persist")
+	span.SetAttr("state.version", stateClone.Version.Version)
+	defer span.End()
+
+	startTime := time.Now()
+	err := manager.repository.SaveStateAtomic(stateClone)
+	duration := time.Since(startTime)
+	span.SetError(err)
+
+	manager.updateStorageHealth(err)
+	if err != nil {
+		manager.metrics.RecordSave(false, duration)
+		return fmt.Errorf("failed to save state version %d: %w", stateClone.Version.Version, err)
+	}
+
+	manager.metrics.RecordSave(true, duration)
+	manager.publishSnapshot(stateClone)
+	manager.checkStateQuota()
+	return nil
+}
+
+// sinceLastSave reports how long ago the state was last written
+func (manager *PanelSyncManager) sinceLastSave() time.Duration {
+	return manager.clock().Since(manager.metrics.LastSaveTime())
+}
+
+// closeSaveQueue stops accepting saves and waits for the worker to drain the
+// ones already accepted
+func (manager *PanelSyncManager) closeSaveQueue() {
+	manager.saveMutex.Lock()
+	if !manager.saveClosed {
+		manager.saveClosed = true
+		close(manager.saveQueue)
+	}
+	manager.saveMutex.Unlock()
+
+	<-manager.saveDone
+}
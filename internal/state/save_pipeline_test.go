@@ -0,0 +1,136 @@
+package state
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// stubRepository counts saves and fails them while failing is set; slow delays
+// each save so requests pile up behind it
+type stubRepository struct {
+	saves   atomic.Int64
+	failing atomic.Bool
+	slow    time.Duration
+}
+
+var errStubSave = errors.New("disk full")
+
+func (r *stubRepository) SaveStateAtomic(*types.SharedApplicationState) error {
+	time.Sleep(r.slow)
+	r.saves.Add(1)
+	if r.failing.Load() {
+		return errStubSave
+	}
+	return nil
+}
+
+func (r *stubRepository) LoadStateAtomic() (*types.SharedApplicationState, error) {
+	return types.NewSharedApplicationState(), nil
+}
+
+func (r *stubRepository) GetStats() interfaces.RepositoryStats { return interfaces.RepositoryStats{} }
+
+func (r *stubRepository) Initialize() error { return nil }
+
+func newStubSyncManager(t *testing.T, repository *stubRepository) *PanelSyncManager {
+	t.Helper()
+	config := DefaultSyncManagerConfig()
+	config.AutoSaveEnabled = false
+	config.SaveQueueSize = 4
+	manager := NewPanelSyncManager(types.NewSharedApplicationState(), repository, NewEventBus(10), DefaultConflictResolver(), config)
+	if err := manager.Initialize(); err != nil {
+		t.Fatalf("Initialize() error = %v", err)
+	}
+	return manager
+}
+
+func waitFuture(t *testing.T, future *SaveFuture) error {
+	t.Helper()
+	select {
+	case <-future.Done():
+		return future.Wait()
+	case <-time.After(5 * time.Second):
+		t.Fatal("save future never resolved")
+		return nil
+	}
+}
+
+func TestSaveFutureReportsOwnError(t *testing.T) {
+	repository := &stubRepository{}
+	manager := newStubSyncManager(t, repository)
+	defer manager.Stop()
+
+	if err := manager.SaveStateSync(); err != nil {
+		t.Fatalf("SaveStateSync() error = %v", err)
+	}
+
+	repository.failing.Store(true)
+	if err := waitFuture(t, manager.SaveStateAsync()); !errors.Is(err, errStubSave) {
+		t.Fatalf("failed save error = %v, want %v", err, errStubSave)
+	}
+	repository.failing.Store(false)
+}
+
+func TestSaveFuturesResolveAcrossShutdown(t *testing.T) {
+	repository := &stubRepository{slow: 5 * time.Millisecond}
+	manager := newStubSyncManager(t, repository)
+
+	const callers = 50
+	futures := make(chan *SaveFuture, callers)
+	var wg sync.WaitGroup
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			futures <- manager.SaveStateAsync()
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	stopped := make(chan struct{})
+	go func() {
+		manager.Stop()
+		close(stopped)
+	}()
+
+	wg.Wait()
+	close(futures)
+
+	var saved, refused int
+	for future := range futures {
+		switch err := waitFuture(t, future); {
+		case err == nil:
+			saved++
+		case errors.Is(err, ErrSyncManagerStopped):
+			refused++
+		default:
+			t.Errorf("unexpected save error %v", err)
+		}
+	}
+	if saved+refused != callers || saved == 0 {
+		t.Errorf("saved %d, refused %d of %d", saved, refused, callers)
+	}
+	// Coalescing means far fewer writes than requests
+	if writes := repository.saves.Load(); writes >= callers {
+		t.Errorf("%d writes for %d requests, want coalescing", writes, callers)
+	}
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop() did not return")
+	}
+
+	if err := manager.SaveStateSync(); !errors.Is(err, ErrSyncManagerStopped) {
+		t.Errorf("SaveStateSync() after Stop = %v, want ErrSyncManagerStopped", err)
+	}
+	if err := manager.Stop(); err != nil {
+		t.Errorf("second Stop() error = %v", err)
+	}
+}
@@ -0,0 +1,84 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestScheduledPrompts(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+	schedule := func(id string) (types.ScheduledPrompt, bool) {
+		for _, s := range manager.GetState().GetScheduledPrompts() {
+			if s.ID == id {
+				return s, true
+			}
+		}
+		return types.ScheduledPrompt{}, false
+	}
+
+	if err := apply(types.SessionAdded, types.SessionAddPayload{Session: testutil.Session("s1", "one")}); err != nil {
+		t.Fatal(err)
+	}
+	at := testutil.At(0)
+	daily := types.ScheduledPrompt{ID: "daily", SessionID: "s1", Text: "summarize today", NextRun: at, Every: 24 * time.Hour}
+	once := types.ScheduledPrompt{ID: "once", Text: "remind me", NextRun: at}
+	for _, s := range []types.ScheduledPrompt{daily, once} {
+		if err := apply(types.PromptScheduled, types.PromptSchedulePayload{Schedule: s}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// A recurring prompt moves on to its next run
+	if err := apply(types.ScheduledPromptRan, types.ScheduledPromptRanPayload{ScheduleID: "daily", SessionID: "s1", RanAt: at.Add(time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := schedule("daily")
+	if !ok || got.Runs != 1 || !got.NextRun.Equal(at.Add(24*time.Hour)) || !got.LastRun.Equal(at.Add(time.Minute)) {
+		t.Errorf("daily after running = %+v", got)
+	}
+	// and cannot run again before then
+	if err := apply(types.ScheduledPromptRan, types.ScheduledPromptRanPayload{ScheduleID: "daily", SessionID: "s1", RanAt: at.Add(2 * time.Minute)}); err == nil {
+		t.Error("ran a scheduled prompt twice")
+	}
+
+	// A one-off prompt is deleted once it ran
+	if err := apply(types.ScheduledPromptRan, types.ScheduledPromptRanPayload{ScheduleID: "once", SessionID: "s1", RanAt: at}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := schedule("once"); ok {
+		t.Error("one-off prompt still scheduled after running")
+	}
+
+	for _, bad := range []types.ScheduledPrompt{
+		{ID: "x", Text: "no time"},
+		{ID: "x", SessionID: "missing", Text: "hi", NextRun: at},
+		{ID: "x", Text: "hi", NextRun: at, Every: time.Second},
+	} {
+		if err := apply(types.PromptScheduled, types.PromptSchedulePayload{Schedule: bad}); err == nil {
+			t.Errorf("scheduled %+v", bad)
+		}
+	}
+
+	if err := apply(types.PromptUnscheduled, types.PromptUnschedulePayload{ScheduleID: "daily"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.PromptUnscheduled, types.PromptUnschedulePayload{ScheduleID: "daily"}); err == nil {
+		t.Error("deleted a scheduled prompt twice")
+	}
+	if n := len(manager.GetState().GetScheduledPrompts()); n != 0 {
+		t.Errorf("%d scheduled prompts left", n)
+	}
+}
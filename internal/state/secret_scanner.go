@@ -0,0 +1,174 @@
+package state
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// SecretPolicy controls what the sync manager does when an update contains a suspected secret
+type SecretPolicy string
+
+const (
+	SecretPolicyOff   SecretPolicy = "off"   // Scanning disabled
+	SecretPolicyFlag  SecretPolicy = "flag"  // Apply the update and raise a security alert
+	SecretPolicyBlock SecretPolicy = "block" // Reject the update and raise a security alert
+)
+
+// ErrSecretBlocked is returned when an update is rejected by the secret scanner
+var ErrSecretBlocked = errors.New("update blocked: content contains a suspected secret")
+
+// SecretRule is a named pattern for detecting one kind of secret
+type SecretRule struct {
+	Name    string
+	Pattern *regexp.Regexp
+}
+
+// DefaultSecretRules returns patterns for commonly leaked credentials
+func DefaultSecretRules() []SecretRule {
+	return []SecretRule{
+		{Name: "private_key", Pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |PGP |ENCRYPTED )?PRIVATE KEY(?: BLOCK)?-----`)},
+		{Name: "aws_access_key", Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+		{Name: "github_token", Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[A-Za-z0-9]{36,}|github_pat_[A-Za-z0-9_]{22,})\b`)},
+		{Name: "anthropic_api_key", Pattern: regexp.MustCompile(`\bsk-ant-[A-Za-z0-9_-]{20,}`)},
+		{Name: "openai_api_key", Pattern: regexp.MustCompile(`\bsk-(?:proj-)?[A-Za-z0-9]{32,}`)},
+		{Name: "slack_token", Pattern: regexp.MustCompile(`\bxox[abprs]-[A-Za-z0-9-]{10,}`)},
+		{Name: "google_api_key", Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	}
+}
+
+// SecretScanner detects suspected secrets in update content
+type SecretScanner struct {
+	policy SecretPolicy
+	rules  []SecretRule
+}
+
+// NewSecretScanner creates a scanner with the given policy and the default rules
+func NewSecretScanner(policy SecretPolicy) *SecretScanner {
+	return &SecretScanner{
+		policy: policy,
+		rules:  DefaultSecretRules(),
+	}
+}
+
+// AddRule registers an additional detection pattern
+func (scanner *SecretScanner) AddRule(rule SecretRule) {
+	scanner.rules = append(scanner.rules, rule)
+}
+
+// Policy returns the configured policy
+func (scanner *SecretScanner) Policy() SecretPolicy {
+	return scanner.policy
+}
+
+// Enabled reports whether the scanner should inspect updates
+func (scanner *SecretScanner) Enabled() bool {
+	return scanner != nil && (scanner.policy == SecretPolicyFlag || scanner.policy == SecretPolicyBlock)
+}
+
+// Scan returns the findings for text. Offsets are in runes, matching redaction ranges,
+// so a flagged message can be passed straight to RedactMessage.
+func (scanner *SecretScanner) Scan(field, text string) []types.SecretFinding {
+	var findings []types.SecretFinding
+	for _, rule := range scanner.rules {
+		for _, loc := range rule.Pattern.FindAllStringIndex(text, -1) {
+			start := utf8.RuneCountInString(text[:loc[0]])
+			findings = append(findings, types.SecretFinding{
+				Rule:  rule.Name,
+				Field: field,
+				Start: start,
+				End:   start + utf8.RuneCountInString(text[loc[0]:loc[1]]),
+			})
+		}
+	}
+	return findings
+}
+
+// Redact returns text with every finding replaced by RedactionPlaceholder,
+// and how many were replaced
+func (scanner *SecretScanner) Redact(text string) (string, int) {
+	findings := scanner.Scan("", text)
+	if len(findings) == 0 {
+		return text, 0
+	}
+	ranges := make([]types.RedactionRange, 0, len(findings))
+	for _, finding := range findings {
+		ranges = append(ranges, types.RedactionRange{Start: finding.Start, End: finding.End})
+	}
+	ranges = normalizeRedactionRanges(ranges, utf8.RuneCountInString(text))
+	return redactContent(text, ranges), len(ranges)
+}
+
+// SetSecretScanner replaces the scanner used for incoming updates; nil disables scanning
+func (manager *PanelSyncManager) SetSecretScanner(scanner *SecretScanner) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.secretScanner = scanner
+}
+
+// checkSecretsLocked scans the text carried by a MessageAdded or InputUpdated
+// update. It broadcasts a security alert for any findings and returns
+// ErrSecretBlocked when the policy rejects the update (caller must hold syncMutex).
+func (manager *PanelSyncManager) checkSecretsLocked(update types.StateUpdate, alert types.SecurityAlertPayload, field, text string) error {
+	if !manager.secretScanner.Enabled() {
+		return nil
+	}
+
+	alert.Findings = manager.secretScanner.Scan(field, text)
+	key := field + "\x00" + update.SourcePanel
+	if len(alert.Findings) == 0 {
+		delete(manager.secretAlerts, key)
+		return nil
+	}
+
+	blocked := manager.secretScanner.Policy() == SecretPolicyBlock
+	var err error
+	if blocked {
+		err = ErrSecretBlocked
+	}
+
+	// The input buffer is rescanned on every keystroke; alert only when what
+	// was found changes, not each time the same secret is seen again
+	fingerprint := secretFingerprint(alert, text)
+	if manager.secretAlerts[key] == fingerprint {
+		return err
+	}
+	if manager.secretAlerts == nil {
+		manager.secretAlerts = make(map[string]string)
+	}
+	manager.secretAlerts[key] = fingerprint
+
+	alert.UpdateID = update.ID
+	alert.UpdateType = update.Type
+	alert.SourcePanel = update.SourcePanel
+	alert.Action = "flagged"
+	if blocked {
+		alert.Action = "blocked"
+	}
+
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventSecurityAlert,
+		Data:        alert,
+		Version:     manager.state.Version.Version,
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+
+	return err
+}
+
+// secretFingerprint identifies the findings of an alert by rule and matched
+// text, so edits that only move a secret within the text do not alert again
+func secretFingerprint(alert types.SecurityAlertPayload, text string) string {
+	runes := []rune(text)
+	var b strings.Builder
+	b.WriteString(alert.MessageID)
+	for _, finding := range alert.Findings {
+		b.WriteString("\x00" + finding.Rule + "\x00" + string(runes[finding.Start:finding.End]))
+	}
+	return b.String()
+}
@@ -0,0 +1,102 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSessionCompaction(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+	ids := func(sessionID string) []string {
+		var got []string
+		for _, msg := range manager.GetState().Messages {
+			if msg.SessionID == sessionID {
+				got = append(got, msg.ID)
+			}
+		}
+		return got
+	}
+
+	for _, msg := range []types.MessageInfo{
+		{ID: "msg_1", SessionID: "ses_a", Type: "user", Content: "first"},
+		{ID: "msg_x", SessionID: "ses_b", Type: "user", Content: "other session"},
+		{ID: "msg_2", SessionID: "ses_a", Type: "assistant", Content: "reply"},
+		{ID: "msg_3", SessionID: "ses_a", Type: "user", Content: "sent while summarizing"},
+	} {
+		if err := manager.AddMessage(msg, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	usage := types.ContextUsage{SessionID: "ses_a", Tokens: 90000, Limit: 100000}
+	if err := apply(types.ContextUsageUpdated, types.ContextUsagePayload{Usage: usage}); err != nil {
+		t.Fatal(err)
+	}
+
+	summary := types.MessageInfo{ID: "msg_sum", SessionID: "ses_a", Type: "assistant", Content: "summary", Status: "completed"}
+	compaction := types.SessionCompaction{SessionID: "ses_a", ArchivedIDs: []string{"msg_1", "msg_2", "msg_x", "msg_gone"}, TokensBefore: 90000, TokensAfter: 500}
+	wrongSession := summary
+	wrongSession.SessionID = "ses_b"
+	if err := apply(types.SessionCompacted, types.SessionCompactedPayload{Compaction: compaction, Summary: wrongSession}); err == nil {
+		t.Errorf("summary from another session accepted")
+	}
+	if err := apply(types.SessionCompacted, types.SessionCompactedPayload{
+		Compaction: types.SessionCompaction{SessionID: "ses_a", ArchivedIDs: []string{"msg_gone"}},
+		Summary:    summary,
+	}); err == nil {
+		t.Errorf("compaction archiving nothing accepted")
+	}
+
+	if err := apply(types.SessionCompacted, types.SessionCompactedPayload{Compaction: compaction, Summary: summary}); err != nil {
+		t.Fatalf("compaction error = %v", err)
+	}
+	current := manager.GetState()
+	// The summary takes the place of the first archived message
+	if got := ids("ses_a"); len(got) != 2 || got[0] != "msg_sum" || got[1] != "msg_3" {
+		t.Errorf("session messages = %v, want [msg_sum msg_3]", got)
+	}
+	if got := ids("ses_b"); len(got) != 1 {
+		t.Errorf("other session messages = %v, want it untouched", got)
+	}
+	if archived := current.GetArchivedMessages("ses_a"); len(archived) != 2 || archived[0].ID != "msg_1" || archived[1].Content != "reply" {
+		t.Errorf("archived = %+v", archived)
+	}
+	if !current.IsMessageArchived("msg_2") || current.IsMessageArchived("msg_x") {
+		t.Errorf("archive membership is wrong")
+	}
+	if len(current.Compactions) != 1 || current.Compactions[0].SummaryID != "msg_sum" || len(current.Compactions[0].ArchivedIDs) != 2 {
+		t.Errorf("compactions = %+v", current.Compactions)
+	}
+	if got, _ := current.GetContextUsage(); got.Tokens != 500 || got.Level != types.ContextLevelOK || !got.Estimated {
+		t.Errorf("context usage after compaction = %+v", got)
+	}
+
+	// A summary that already arrived as a reply is updated where it is
+	if err := manager.AddMessage(types.MessageInfo{ID: "msg_sum2", SessionID: "ses_a", Type: "assistant", Status: "pending"}, "sse"); err != nil {
+		t.Fatal(err)
+	}
+	second := types.MessageInfo{ID: "msg_sum2", SessionID: "ses_a", Type: "assistant", Content: "shorter", Status: "completed"}
+	if err := apply(types.SessionCompacted, types.SessionCompactedPayload{
+		Compaction: types.SessionCompaction{SessionID: "ses_a", ArchivedIDs: []string{"msg_sum", "msg_3", "msg_sum2"}},
+		Summary:    second,
+	}); err != nil {
+		t.Fatalf("second compaction error = %v", err)
+	}
+	if got := ids("ses_a"); len(got) != 1 || got[0] != "msg_sum2" {
+		t.Errorf("session messages = %v, want [msg_sum2]", got)
+	}
+	if got := manager.GetState().Messages; got[len(got)-1].Content != "shorter" {
+		t.Errorf("existing summary not updated: %+v", got[len(got)-1])
+	}
+}
@@ -0,0 +1,119 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSessionOrdering(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 64)
+	manager.eventBus.Subscribe("conn", "panel", "sessions", events)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+	shown := func() string {
+		return sessionOrderIDs(manager.GetState().GetOrderedSessions())
+	}
+
+	for i, title := range []string{"beta", "alpha", "gamma"} {
+		session := testutil.Session(string(rune('a'+i)), title)
+		session.CreatedAt = testutil.At(i)
+		session.UpdatedAt = testutil.At(i)
+		if err := apply(types.SessionAdded, types.SessionAddPayload{Session: session}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := shown(); got != "a,b,c" {
+		t.Fatalf("sessions shown as %s, want insertion order", got)
+	}
+
+	// A new message makes its session the most recently active
+	if err := apply(types.MessageAdded, types.MessageAddPayload{Message: testutil.Message("m1", "a", "user", "hi")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.SessionOrderChanged, types.SessionOrderPayload{Order: types.SessionOrder{Mode: types.SessionSortRecent}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.MessageAdded, types.MessageAddPayload{Message: func() types.MessageInfo {
+		message := testutil.Message("m2", "a", "user", "again")
+		message.Timestamp = testutil.At(10)
+		return message
+	}()}); err != nil {
+		t.Fatal(err)
+	}
+	if got := shown(); got != "a,c,b" {
+		t.Errorf("recent order = %s, want a,c,b", got)
+	}
+
+	// Dragging in a sorted list keeps what was shown and switches to manual
+	if err := apply(types.SessionReordered, types.SessionReorderPayload{SessionID: "b", Before: "c"}); err != nil {
+		t.Fatal(err)
+	}
+	st := manager.GetState()
+	if got := sessionOrderIDs(st.Sessions); got != "a,b,c" || st.SessionOrder.Mode != types.SessionSortManual {
+		t.Errorf("after reorder sessions = %s in %q order, want a,b,c in manual order", got, st.SessionOrder.Mode)
+	}
+
+	if err := apply(types.SessionPinned, types.SessionPinPayload{SessionID: "c", Pinned: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := apply(types.SessionOrderChanged, types.SessionOrderPayload{Order: types.SessionOrder{Mode: types.SessionSortAlphabetical, PinnedFirst: true}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := shown(); got != "c,b,a" {
+		t.Errorf("pinned first alphabetical order = %s, want c,b,a", got)
+	}
+
+	// Bad requests leave the order alone
+	for _, bad := range []struct {
+		updateType types.UpdateType
+		payload    interface{}
+	}{
+		{types.SessionOrderChanged, types.SessionOrderPayload{Order: types.SessionOrder{Mode: "random"}}},
+		{types.SessionReordered, types.SessionReorderPayload{SessionID: "missing", Before: "a"}},
+		{types.SessionPinned, types.SessionPinPayload{SessionID: "missing", Pinned: true}},
+	} {
+		if err := apply(bad.updateType, bad.payload); err == nil {
+			t.Errorf("%s %+v succeeded", bad.updateType, bad.payload)
+		}
+	}
+	if got := shown(); got != "c,b,a" {
+		t.Errorf("order after rejected updates = %s, want c,b,a", got)
+	}
+
+	// Panels hear about each change
+	want := map[types.StateEventType]bool{types.EventSessionOrderChanged: false, types.EventSessionReordered: false, types.EventSessionPinned: false}
+	for len(events) > 0 {
+		event := <-events
+		if _, ok := want[event.Type]; ok {
+			want[event.Type] = true
+		}
+	}
+	for eventType, seen := range want {
+		if !seen {
+			t.Errorf("no %s event", eventType)
+		}
+	}
+}
+
+func sessionOrderIDs(sessions []types.SessionInfo) string {
+	var ids string
+	for i, session := range sessions {
+		if i > 0 {
+			ids += ","
+		}
+		ids += session.ID
+	}
+	return ids
+}
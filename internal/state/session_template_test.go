@@ -0,0 +1,71 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSessionTemplates(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	review := types.SessionTemplate{
+		Name:         "review",
+		Title:        "Code review",
+		Instructions: "Point out bugs; do not edit files.",
+		Agent:        "plan",
+		Model:        "anthropic/claude-sonnet",
+		Tags:         []string{"review"},
+	}
+	debug := types.SessionTemplate{Name: "debug", Tags: []string{"debug"}}
+	if err := apply(types.SessionTemplatesChanged, types.SessionTemplatesPayload{Templates: []types.SessionTemplate{review, debug}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetSessionTemplates(); len(got) != 2 || got[0].Name != "review" || got[1].Name != "debug" {
+		t.Fatalf("templates = %+v", got)
+	}
+
+	for name, templates := range map[string][]types.SessionTemplate{
+		"duplicate": {review, review},
+		"no name":   {{Title: "untitled"}},
+		"space":     {{Name: "code review"}},
+		"bad model": {{Name: "x", Model: "sonnet"}},
+		"empty tag": {{Name: "x", Tags: []string{" "}}},
+	} {
+		if err := apply(types.SessionTemplatesChanged, types.SessionTemplatesPayload{Templates: templates}); err == nil {
+			t.Errorf("%s: templates accepted", name)
+		}
+	}
+	if got := manager.GetState().GetSessionTemplates(); len(got) != 2 {
+		t.Errorf("rejected templates replaced the list: %+v", got)
+	}
+
+	// Sessions created from a template keep its instructions and tags
+	session := types.NewSessionFromTemplate(review, testutil.Session("s1", "Code review"))
+	if err := apply(types.SessionAdded, types.SessionAddPayload{Session: session}); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := manager.GetState().GetSessionByID("s1")
+	if !ok || got.Template != "review" || got.Instructions != review.Instructions || len(got.Tags) != 1 || got.Tags[0] != "review" {
+		t.Errorf("session from template = %+v", got)
+	}
+
+	if err := apply(types.SessionTemplatesChanged, types.SessionTemplatesPayload{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetSessionTemplates(); len(got) != 0 {
+		t.Errorf("templates after clearing = %+v", got)
+	}
+}
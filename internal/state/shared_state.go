@@ -7,9 +7,13 @@ import (
 // Re-export types for backward compatibility
 type SharedApplicationState = types.SharedApplicationState
 type StateVersion = types.StateVersion
+type VectorClock = types.VectorClock
 type SessionInfo = types.SessionInfo
 type MessageInfo = types.MessageInfo
 type InputState = types.InputState
+type MessageAnnotation = types.MessageAnnotation
+type AnnotationKind = types.AnnotationKind
+type SessionLock = types.SessionLock
 type StateEvent = types.StateEvent
 type StateEventType = types.StateEventType
 
@@ -20,21 +24,71 @@ func NewSharedApplicationState() *SharedApplicationState {
 
 // Re-export constants
 const (
-	EventSessionChanged    = types.EventSessionChanged
-	EventSessionAdded      = types.EventSessionAdded
-	EventSessionDeleted    = types.EventSessionDeleted
-	EventSessionUpdated    = types.EventSessionUpdated
-	EventMessageAdded      = types.EventMessageAdded
-	EventMessageUpdated    = types.EventMessageUpdated
-	EventMessageDeleted    = types.EventMessageDeleted
-	EventMessagesCleared   = types.EventMessagesCleared
-	EventInputUpdated      = types.EventInputUpdated
-	EventCursorMoved       = types.EventCursorMoved
-	EventThemeChanged      = types.EventThemeChanged
-	EventModelChanged      = types.EventModelChanged
-	EventAgentChanged      = types.EventAgentChanged
-	EventUIActionTriggered = types.EventUIActionTriggered
-	EventStateSync         = types.EventStateSync
-	EventPanelConnected    = types.EventPanelConnected
-	EventPanelDisconnected = types.EventPanelDisconnected
+	EventSessionChanged          = types.EventSessionChanged
+	EventSessionAdded            = types.EventSessionAdded
+	EventSessionDeleted          = types.EventSessionDeleted
+	EventSessionUpdated          = types.EventSessionUpdated
+	EventMessageAdded            = types.EventMessageAdded
+	EventMessageUpdated          = types.EventMessageUpdated
+	EventMessageDeleted          = types.EventMessageDeleted
+	EventMessageAttributed       = types.EventMessageAttributed
+	EventMessagesCleared         = types.EventMessagesCleared
+	EventInputUpdated            = types.EventInputUpdated
+	EventCursorMoved             = types.EventCursorMoved
+	EventThemeChanged            = types.EventThemeChanged
+	EventModelChanged            = types.EventModelChanged
+	EventAgentChanged            = types.EventAgentChanged
+	EventAgentModelCleared       = types.EventAgentModelCleared
+	EventUIActionTriggered       = types.EventUIActionTriggered
+	EventStateSync               = types.EventStateSync
+	EventPanelConnected          = types.EventPanelConnected
+	EventPanelDisconnected       = types.EventPanelDisconnected
+	EventShutdown                = types.EventShutdown
+	EventConfirmationRequired    = types.EventConfirmationRequired
+	EventAnnotationAdded         = types.EventAnnotationAdded
+	EventAnnotationUpdated       = types.EventAnnotationUpdated
+	EventAnnotationRemoved       = types.EventAnnotationRemoved
+	EventSessionLocked           = types.EventSessionLocked
+	EventSessionUnlocked         = types.EventSessionUnlocked
+	EventStateCompacted          = types.EventStateCompacted
+	EventPromptSubmitted         = types.EventPromptSubmitted
+	EventGitStatusChanged        = types.EventGitStatusChanged
+	EventFileDiffReady           = types.EventFileDiffReady
+	EventFileDiffResolved        = types.EventFileDiffResolved
+	EventFileTreeChanged         = types.EventFileTreeChanged
+	EventTerminalRunStarted      = types.EventTerminalRunStarted
+	EventTerminalRunFinished     = types.EventTerminalRunFinished
+	EventInputLocationChanged    = types.EventInputLocationChanged
+	EventPromptContextUpdated    = types.EventPromptContextUpdated
+	EventRunStarted              = types.EventRunStarted
+	EventRunFinished             = types.EventRunFinished
+	EventRunCancelled            = types.EventRunCancelled
+	EventRunAttempted            = types.EventRunAttempted
+	EventModelPolicyChanged      = types.EventModelPolicyChanged
+	EventAgentRoutesChanged      = types.EventAgentRoutesChanged
+	EventContextUsageUpdated     = types.EventContextUsageUpdated
+	EventContextThreshold        = types.EventContextThreshold
+	EventSessionCompacted        = types.EventSessionCompacted
+	EventConnectivityChanged     = types.EventConnectivityChanged
+	EventSessionOrderChanged     = types.EventSessionOrderChanged
+	EventSessionReordered        = types.EventSessionReordered
+	EventSessionPinned           = types.EventSessionPinned
+	EventWorkspaceChanged        = types.EventWorkspaceChanged
+	EventPromptQueued            = types.EventPromptQueued
+	EventPromptDequeued          = types.EventPromptDequeued
+	EventPromptQueueReordered    = types.EventPromptQueueReordered
+	EventPromptScheduled         = types.EventPromptScheduled
+	EventPromptUnscheduled       = types.EventPromptUnscheduled
+	EventScheduledPromptRan      = types.EventScheduledPromptRan
+	EventSessionTemplatesChanged = types.EventSessionTemplatesChanged
+	EventThreadCollapsed         = types.EventThreadCollapsed
+	EventCodeBlocksExtracted     = types.EventCodeBlocksExtracted
+	EventCodeBlockHandled        = types.EventCodeBlockHandled
+	EventSecurityAlert           = types.EventSecurityAlert
+	EventStorageRecovered        = types.EventStorageRecovered
+	EventStorageQuota            = types.EventStorageQuota
+	EventStorageHealth           = types.EventStorageHealth
+	EventCrashReport             = types.EventCrashReport
+	EventInternalError           = types.EventInternalError
+	EventConfigChanged           = types.EventConfigChanged
 )
@@ -0,0 +1,48 @@
+package state
+
+import (
+	"log"
+
+	"github.com/opencode/tmux_coder/internal/snapshot"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// SetSnapshotWriter attaches a shared-memory snapshot refreshed after every save; nil disables it
+func (manager *PanelSyncManager) SetSnapshotWriter(writer *snapshot.Writer) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.snapshot = writer
+}
+
+// publishSnapshot writes a saved state to the snapshot and tells panels it changed.
+// Failures only cost readers a fallback to IPC, so they are logged and not returned.
+func (manager *PanelSyncManager) publishSnapshot(state *types.SharedApplicationState) {
+	manager.syncMutex.RLock()
+	writer := manager.snapshot
+	manager.syncMutex.RUnlock()
+
+	if writer == nil {
+		return
+	}
+
+	header, err := writer.Write(state)
+	if err != nil {
+		log.Printf("Failed to publish state snapshot: %v", err)
+		return
+	}
+
+	// No Version or Clock: the saved state may trail the live one, and panels
+	// must not rewind to it. The payload says which version the snapshot holds.
+	manager.eventBus.Broadcast(types.StateEvent{
+		ID:   generateEventID(),
+		Type: types.EventSnapshotUpdated,
+		Data: types.SnapshotUpdatedPayload{
+			Path:         writer.Path(),
+			Sequence:     header.Sequence,
+			StateVersion: header.StateVersion,
+			Size:         header.Length,
+		},
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
+	})
+}
@@ -3,12 +3,30 @@ package state
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/opencode/tmux_coder/internal/agentroute"
+	"github.com/opencode/tmux_coder/internal/audit"
+	"github.com/opencode/tmux_coder/internal/clock"
+	"github.com/opencode/tmux_coder/internal/codeblocks"
+	"github.com/opencode/tmux_coder/internal/ids"
 	"github.com/opencode/tmux_coder/internal/interfaces"
+	"github.com/opencode/tmux_coder/internal/journal"
+	"github.com/opencode/tmux_coder/internal/macro"
+	"github.com/opencode/tmux_coder/internal/metrics"
+	"github.com/opencode/tmux_coder/internal/persistence"
+	"github.com/opencode/tmux_coder/internal/snapshot"
+	"github.com/opencode/tmux_coder/internal/timefmt"
+	"github.com/opencode/tmux_coder/internal/tracing"
 	"github.com/opencode/tmux_coder/internal/types"
 )
 
@@ -21,17 +39,41 @@ type PanelSyncManager struct {
 	ctx              context.Context
 	cancel           context.CancelFunc
 	syncMutex        sync.RWMutex
-	autoSaveEnabled  bool
-	autoSaveInterval time.Duration
-	lastSaveTime     time.Time
+	config           SyncManagerConfig
+	configMutex      sync.RWMutex
+	configChanged    chan struct{} // Closed and replaced on each SetConfig and SetClock
+	setConfigMutex   sync.Mutex
 	saveQueue        chan saveRequest
+	saveMutex        sync.RWMutex // Guards saveClosed against sends racing the close
+	saveClosed       bool
+	saveDone         chan struct{}
+	stopOnce         sync.Once
 	metrics          *SyncMetrics
-}
-
-// saveRequest represents a queued save operation
-type saveRequest struct {
-	state    *types.SharedApplicationState
-	callback chan error
+	wallClock        atomic.Value // wallClock; see SetClock
+	secretScanner    *SecretScanner
+	secretAlerts     map[string]string // Findings last alerted per field and source panel
+	auditLog         *audit.Log
+	journal          *journal.Journal
+	macroRecorder    *macro.Recorder
+	tracer           *tracing.Tracer
+	lastTrace        string // Trace context of the last applied update, for the save that persists it
+	watchdog         slowWatchdog
+	applyQueue       chan applyRequest
+	applyMutex       sync.RWMutex // Guards applyQueue against a resize swapping it
+	clockNode        string
+	snapshot         *snapshot.Writer
+	blobs            *persistence.BlobStore
+	blobThreshold    int
+	blobPreview      int // Bytes of an offloaded body kept inline as a preview
+	dedupe           *updateDedupe
+	quotaLevel       string // Owned by the save worker
+	compactedAtSize  int64  // Owned by the save worker
+	compacting       atomic.Bool
+	healthMutex      sync.Mutex
+	storageHealth    types.StorageHealthPayload
+	// replaying marks a scratch manager rebuilding history, where checks that
+	// passed when the update was first applied are skipped
+	replaying bool
 }
 
 // SyncManagerConfig contains configuration for the sync manager
@@ -40,6 +82,29 @@ type SyncManagerConfig struct {
 	AutoSaveInterval time.Duration `json:"auto_save_interval"`
 	EventHistorySize int           `json:"event_history_size"`
 	SaveQueueSize    int           `json:"save_queue_size"`
+	ApplyQueueSize   int           `json:"apply_queue_size"`
+	// VectorClockNode enables vector-clock versioning, naming this process's entry in the clock
+	VectorClockNode string       `json:"vector_clock_node,omitempty"`
+	SecretPolicy    SecretPolicy `json:"secret_policy"`
+	// GCInterval is how often orphaned files are collected; 0 disables collection
+	GCInterval time.Duration `json:"gc_interval"`
+	GCDryRun   bool          `json:"gc_dry_run"` // Only log what collection would remove
+	// DedupeWindow is how long applied update IDs are remembered so retried
+	// deliveries are dropped; 0 disables deduplication
+	DedupeWindow time.Duration `json:"dedupe_window"`
+	// MaxStateSize is the state file size in bytes at which panels are warned and
+	// the state is compacted per Retention; 0 disables the quota
+	MaxStateSize int64           `json:"max_state_size"`
+	Retention    RetentionPolicy `json:"retention"`
+	// SlowUpdate and SlowSave are how long an update or save may run before
+	// the watchdog reports it with a goroutine dump; 0 disables the check
+	SlowUpdate time.Duration `json:"slow_update"`
+	SlowSave   time.Duration `json:"slow_save"`
+	// WatchdogDumpDir receives the goroutine dumps; when empty they are logged
+	WatchdogDumpDir string `json:"watchdog_dump_dir,omitempty"`
+	// MaxBatchSize is how many queued updates may be applied together under
+	// one version; 0 or 1 applies every update on its own
+	MaxBatchSize int `json:"max_batch_size"`
 }
 
 // DefaultSyncManagerConfig returns default configuration
@@ -49,6 +114,13 @@ func DefaultSyncManagerConfig() SyncManagerConfig {
 		AutoSaveInterval: 5 * time.Second,
 		EventHistorySize: 1000,
 		SaveQueueSize:    100,
+		ApplyQueueSize:   256,
+		SecretPolicy:     SecretPolicyOff,
+		GCInterval:       time.Hour,
+		DedupeWindow:     DefaultDedupeWindow,
+		SlowUpdate:       DefaultSlowUpdate,
+		SlowSave:         DefaultSlowSave,
+		MaxBatchSize:     DefaultMaxBatchSize,
 	}
 }
 
@@ -69,15 +141,30 @@ func NewPanelSyncManager(
 		conflictResolver: conflictResolver,
 		ctx:              ctx,
 		cancel:           cancel,
-		autoSaveEnabled:  config.AutoSaveEnabled,
-		autoSaveInterval: config.AutoSaveInterval,
+		config:           config,
+		configChanged:    make(chan struct{}),
 		saveQueue:        make(chan saveRequest, config.SaveQueueSize),
+		saveDone:         make(chan struct{}),
+		applyQueue:       make(chan applyRequest, config.ApplyQueueSize),
+		clockNode:        config.VectorClockNode,
+		dedupe:           newUpdateDedupe(config.DedupeWindow),
+		quotaLevel:       types.QuotaOK,
 		metrics:          NewSyncMetrics(),
 	}
 
+	manager.wallClock.Store(wallClock{clock.Real})
+	manager.metrics.now = manager.now
+
+	if config.SecretPolicy != "" && config.SecretPolicy != SecretPolicyOff {
+		manager.secretScanner = NewSecretScanner(config.SecretPolicy)
+	}
+
 	// Start background workers
-	go manager.autoSaveWorker()
+	go manager.applyLoop()
+	go manager.runWorker(ComponentAutoSave, manager.autoSaveWorker)
 	go manager.saveWorker()
+	go manager.runWorker(ComponentGC, manager.gcWorker)
+	go manager.runWorker(ComponentResync, manager.resyncWorker)
 
 	return manager
 }
@@ -89,6 +176,22 @@ func (manager *PanelSyncManager) Initialize() error {
 		return fmt.Errorf("failed to initialize repository: %w", err)
 	}
 
+	repoStats := manager.repository.GetStats()
+	for _, issue := range repoStats.PermissionIssues {
+		log.Printf("Warning: insecure state file permissions: %s", issue)
+	}
+
+	// Tell panels when startup had to repair an interrupted save
+	if recovery := repoStats.LastRecovery; recovery.Changed() {
+		manager.eventBus.Broadcast(types.StateEvent{
+			ID:          generateEventID(),
+			Type:        types.EventStorageRecovered,
+			Data:        recovery,
+			SourcePanel: "system",
+			Timestamp:   manager.now(),
+		})
+	}
+
 	// Try to load existing state
 	if loadedState, err := manager.repository.LoadStateAtomic(); err == nil {
 		manager.syncMutex.Lock()
@@ -103,7 +206,7 @@ func (manager *PanelSyncManager) Initialize() error {
 		manager.syncMutex.Unlock()
 
 		// Save initial state
-		if err := manager.saveStateSync(); err != nil {
+		if err := manager.SaveStateSync(); err != nil {
 			log.Printf("Failed to save initial state: %v", err)
 		}
 	}
@@ -112,28 +215,36 @@ func (manager *PanelSyncManager) Initialize() error {
 	return nil
 }
 
-// Stop gracefully shuts down the sync manager
+// Stop gracefully shuts down the sync manager. Saves already queued are
+// drained and their callers get the real outcome; later saves fail with
+// ErrSyncManagerStopped. Calling Stop again is a no-op.
 func (manager *PanelSyncManager) Stop() error {
-	log.Printf("Stopping panel sync manager")
-
-	// Cancel context to signal shutdown
-	manager.cancel()
+	manager.stopOnce.Do(func() {
+		log.Printf("Stopping panel sync manager")
 
-	// Save current state before shutdown
-	if err := manager.saveStateSync(); err != nil {
-		log.Printf("Failed to save state during shutdown: %v", err)
-	}
+		// Cancel context to signal shutdown; no further updates are applied
+		manager.cancel()
+		manager.closeSaveQueue()
 
-	// Close save queue
-	close(manager.saveQueue)
+		// Save current state before shutdown
+		if err := manager.writeState(); err != nil {
+			log.Printf("Failed to save state during shutdown: %v", err)
+		}
+		if closer, ok := manager.repository.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				log.Printf("Failed to close state repository: %v", err)
+			}
+		}
 
-	log.Printf("Panel sync manager stopped")
+		log.Printf("Panel sync manager stopped")
+	})
 	return nil
 }
 
 // decodePayload is a helper to convert a map payload from JSON decoding back into a specific struct type.
+// Times come out in UTC, whatever zone the sender stamped them in.
 func decodePayload(data interface{}, target interface{}) error {
-	bytes, err := json.Marshal(data)
+	bytes, err := json.Marshal(timefmt.UTC(data))
 	if err != nil {
 		return fmt.Errorf("failed to marshal payload map: %w", err)
 	}
@@ -148,10 +259,10 @@ func (manager *PanelSyncManager) UpdateSessionSelection(sessionID string, panelI
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.SessionChanged,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.SessionChangePayload{SessionID: sessionID},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -162,10 +273,10 @@ func (manager *PanelSyncManager) AddSession(session types.SessionInfo, panelID s
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.SessionAdded,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.SessionAddPayload{Session: session},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -176,10 +287,10 @@ func (manager *PanelSyncManager) UpdateSession(sessionID, title string, isActive
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.SessionUpdated,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.SessionUpdatePayload{SessionID: sessionID, Title: title, IsActive: isActive},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -190,10 +301,10 @@ func (manager *PanelSyncManager) DeleteSession(sessionID string, panelID string)
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.SessionDeleted,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.SessionDeletePayload{SessionID: sessionID},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -204,10 +315,10 @@ func (manager *PanelSyncManager) AddMessage(message types.MessageInfo, panelID s
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.MessageAdded,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.MessageAddPayload{Message: message},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -218,10 +329,24 @@ func (manager *PanelSyncManager) UpdateMessage(messageID, content, status string
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.MessageUpdated,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.MessageUpdatePayload{MessageID: messageID, Content: content, Status: status},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
+	}
+
+	return manager.applyUpdateWithEvents(update)
+}
+
+// AttributeMessage records which agent answered with a message
+func (manager *PanelSyncManager) AttributeMessage(messageID, agent string, panelID string) error {
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.MessageAttributed,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         types.MessageAttributionPayload{MessageID: messageID, Agent: agent},
+		SourcePanel:     panelID,
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -232,10 +357,10 @@ func (manager *PanelSyncManager) ClearSessionMessages(sessionID string, panelID
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.MessagesCleared,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.MessagesClearPayload{SessionID: sessionID},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -246,7 +371,7 @@ func (manager *PanelSyncManager) UpdateInputBuffer(buffer string, cursorPos, sel
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.InputUpdated,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload: types.InputUpdatePayload{
 			Buffer:         buffer,
 			CursorPosition: cursorPos,
@@ -255,7 +380,7 @@ func (manager *PanelSyncManager) UpdateInputBuffer(buffer string, cursorPos, sel
 			Mode:           mode,
 		},
 		SourcePanel: panelID,
-		Timestamp:   time.Now(),
+		Timestamp:   manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -266,10 +391,10 @@ func (manager *PanelSyncManager) MoveCursor(position, selStart, selEnd int, pane
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.CursorMoved,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.CursorMovePayload{Position: position, SelectionStart: selStart, SelectionEnd: selEnd},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -280,10 +405,10 @@ func (manager *PanelSyncManager) ChangeTheme(theme string, panelID string) error
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.ThemeChanged,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.ThemeChangePayload{Theme: theme},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -294,10 +419,10 @@ func (manager *PanelSyncManager) ChangeModel(provider, model string, panelID str
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.ModelChanged,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.ModelChangePayload{Provider: provider, Model: model},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
@@ -308,70 +433,126 @@ func (manager *PanelSyncManager) ChangeAgent(agent string, panelID string) error
 	update := types.StateUpdate{
 		ID:              generateUpdateID(),
 		Type:            types.AgentChanged,
-		ExpectedVersion: manager.state.GetCurrentVersion(),
+		ExpectedVersion: manager.currentVersion(),
 		Payload:         types.AgentChangePayload{Agent: agent},
 		SourcePanel:     panelID,
-		Timestamp:       time.Now(),
+		Timestamp:       manager.now(),
 	}
 
 	return manager.applyUpdateWithEvents(update)
 }
 
-// applyUpdateWithEvents applies an update and broadcasts events
-func (manager *PanelSyncManager) applyUpdateWithEvents(update types.StateUpdate) error {
-	// Apply update with conflict resolution
-	result := manager.conflictResolver.ResolveConflict(manager, update)
-	if !result.Success {
-		manager.metrics.RecordUpdate(update.Type, false, result.TimeTaken)
-		return result.Error
+// AddAnnotation attaches a user annotation to a message
+func (manager *PanelSyncManager) AddAnnotation(annotation types.MessageAnnotation, panelID string) error {
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.AnnotationAdded,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         types.AnnotationAddPayload{Annotation: annotation},
+		SourcePanel:     panelID,
+		Timestamp:       manager.now(),
 	}
 
-	manager.metrics.RecordUpdate(update.Type, true, result.TimeTaken)
+	return manager.applyUpdateWithEvents(update)
+}
 
-	// Queue save operation if auto-save is enabled
-	if manager.autoSaveEnabled {
-		select {
-		case manager.saveQueue <- saveRequest{state: manager.state.Clone(), callback: nil}:
-			// Save queued successfully
-		default:
-			// Save queue full, log warning
-			log.Printf("Save queue full, skipping auto-save for update %s", update.Type)
-		}
+// UpdateAnnotation edits the content, rating or completion flag of an annotation.
+// Empty content and nil rating or done leave those fields unchanged.
+func (manager *PanelSyncManager) UpdateAnnotation(annotationID, content string, rating *int, done *bool, panelID string) error {
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.AnnotationUpdated,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         types.AnnotationUpdatePayload{AnnotationID: annotationID, Content: content, Rating: rating, Done: done},
+		SourcePanel:     panelID,
+		Timestamp:       manager.now(),
+	}
+
+	return manager.applyUpdateWithEvents(update)
+}
+
+// RemoveAnnotation removes an annotation by ID
+func (manager *PanelSyncManager) RemoveAnnotation(annotationID string, panelID string) error {
+	update := types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.AnnotationRemoved,
+		ExpectedVersion: manager.currentVersion(),
+		Payload:         types.AnnotationRemovePayload{AnnotationID: annotationID},
+		SourcePanel:     panelID,
+		Timestamp:       manager.now(),
+	}
+
+	return manager.applyUpdateWithEvents(update)
+}
+
+// applyUpdateWithEvents applies an in-process update and broadcasts events.
+// The apply loop orders it after everything already queued, so it cannot conflict.
+func (manager *PanelSyncManager) applyUpdateWithEvents(update types.StateUpdate) error {
+	start := time.Now()
+	err := manager.submitUpdate(update, false)
+	manager.metrics.RecordUpdate(update.Type, err == nil, time.Since(start))
+	if err != nil {
+		return err
+	}
+
+	// Queue save operation if auto-save is enabled; a full queue already holds a
+	// save that will include this update
+	if manager.GetConfig().AutoSaveEnabled {
+		manager.enqueueSave(false)
 	}
 
 	return nil
 }
 
-// UpdateWithVersionCheck applies a state update with optimistic locking
+// UpdateWithVersionCheck applies a state update with optimistic locking. Updates
+// built against a stale version (typically by another process) are handed to the
+// conflict resolver, which runs outside the apply loop.
 func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate) error {
-	// Acquire lock to perform version check and apply updates atomically.
-	// IMPORTANT: Do NOT hold the lock while invoking the conflict resolver,
-	// which calls UpdateWithVersionCheck again and would deadlock.
-	manager.syncMutex.Lock()
-
-	// Check for version conflicts (optimistic locking)
-	if manager.state.Version.Version != update.ExpectedVersion {
-		// Release lock before invoking resolver to avoid re-entrant deadlock.
-		manager.syncMutex.Unlock()
+	err := manager.submitUpdate(update, true)
+	if !errors.Is(err, ErrVersionConflict) {
+		return err
+	}
 
-		// Attempt to resolve the conflict using the configured resolver
-		if manager.conflictResolver != nil {
-			result := manager.conflictResolver.ResolveConflict(manager, update)
-			if result != nil && result.Success {
-				// Conflict resolved and update applied within resolver path
-				// Return early to avoid double application/broadcast
-				return nil
-			}
-			// If resolver did not succeed, fall through to original error
+	if manager.conflictResolver != nil {
+		span := manager.currentTracer().Start(update.TraceParent, "state.resolve_conflict")
+		span.SetAttr("update.id", update.ID)
+		span.SetAttr("update.type", string(update.Type))
+		update.TraceParent = span.TraceParent()
+		result := manager.conflictResolver.ResolveConflict(manager, update)
+		switch {
+		case result != nil && result.Error != nil:
+			span.SetError(result.Error)
+		case result == nil || !result.Success:
+			span.SetError(err)
+		}
+		span.End()
+		if result != nil && result.Success {
+			// Conflict resolved and update applied within resolver path
+			return nil
+		}
+		// Deliberate rejections on the retry are more useful to the caller than the conflict
+		if result != nil && (errors.Is(result.Error, ErrSessionLocked) || errors.Is(result.Error, ErrSecretBlocked)) {
+			return result.Error
 		}
-
-		return fmt.Errorf("version conflict: expected %d, current %d",
-			update.ExpectedVersion, manager.GetState().GetCurrentVersion())
 	}
 
-	// No conflict: ensure we unlock on all return paths below
-	defer manager.syncMutex.Unlock()
+	return err
+}
+
+// applyUpdateLocked applies one update, bumps the version and broadcasts the
+// resulting event. Only the apply loop calls it, with syncMutex held.
+func (manager *PanelSyncManager) applyUpdateLocked(update types.StateUpdate) error {
+	if err := manager.applyChangeLocked(&update); err != nil {
+		return err
+	}
+	manager.commitUpdateLocked(update)
+	return nil
+}
 
+// applyChangeLocked changes the state as update says, without bumping the
+// version. Payloads the change normalizes are replaced in update, so its event
+// and history carry what was applied.
+func (manager *PanelSyncManager) applyChangeLocked(update *types.StateUpdate) error {
 	// Apply the update based on its type
 	switch update.Type {
 	case types.SessionAdded:
@@ -379,6 +560,15 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		// Sessions belong to the workspace they were started in, on the branch
+		// checked out then
+		if payload.Session.Workspace == "" && manager.state.Workspace != "" {
+			payload.Session.Workspace = manager.state.Workspace
+			if git := manager.state.Git; git != nil && types.SameWorkspace(git.Root, manager.state.Workspace) {
+				payload.Session.Branch = git.Branch
+			}
+			update.Payload = payload
+		}
 		manager.state.AddSession(payload.Session)
 
 	case types.SessionChanged:
@@ -395,21 +585,103 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		if err := manager.checkSessionLockLocked(payload.SessionID, update.SourcePanel, manager.now()); err != nil {
+			return err
+		}
 		// Remove session if it exists, but don't fail if it doesn't exist
 		// This makes the deletion operation idempotent and more robust
 		manager.state.RemoveSession(payload.SessionID)
+		manager.removeSessionLockLocked(payload.SessionID)
+		manager.state.PromptQueue = slices.DeleteFunc(manager.state.PromptQueue, func(prompt types.QueuedPrompt) bool {
+			return prompt.SessionID == payload.SessionID
+		})
+		manager.state.ScheduledPrompts = slices.DeleteFunc(manager.state.ScheduledPrompts, func(schedule types.ScheduledPrompt) bool {
+			return schedule.SessionID == payload.SessionID
+		})
+
+	case types.SessionOrderChanged:
+		var payload types.SessionOrderPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if !payload.Order.Mode.Valid() {
+			return fmt.Errorf("unknown session sort mode %q", payload.Order.Mode)
+		}
+		manager.state.SessionOrder = payload.Order
+
+	case types.SessionReordered:
+		var payload types.SessionReorderPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		sessions, err := types.ReorderSessions(manager.state.Sessions, manager.state.SessionOrder, payload)
+		if err != nil {
+			return err
+		}
+		manager.state.Sessions = sessions
+		manager.state.SessionOrder.Mode = types.SessionSortManual
+
+	case types.SessionPinned:
+		var payload types.SessionPinPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		found := false
+		for i := range manager.state.Sessions {
+			if manager.state.Sessions[i].ID == payload.SessionID {
+				manager.state.Sessions[i].Pinned = payload.Pinned
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("session %s not found", payload.SessionID)
+		}
+
+	case types.WorkspaceChanged:
+		var payload types.WorkspacePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		manager.state.Workspace = payload.Workspace
+		manager.state.TmuxSession = payload.TmuxSession
 
 	case types.MessageAdded:
 		var payload types.MessageAddPayload
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		alert := types.SecurityAlertPayload{MessageID: payload.Message.ID, SessionID: payload.Message.SessionID}
+		if err := manager.checkSecretsLocked(*update, alert, "content", payload.Message.Content); err != nil {
+			return err
+		}
+		// An imported native record holds every part, tool output included
+		if len(payload.Message.Native) > 0 {
+			if err := manager.checkSecretsLocked(*update, alert, "native", string(payload.Message.Native)); err != nil {
+				return err
+			}
+		}
+		// Described before offloading, while the whole body is at hand
+		if payload.Message.BodyRef == "" {
+			meta := codeblocks.Describe(payload.Message.Content)
+			payload.Message.Meta = &meta
+		}
+		if err := manager.offloadMessageLocked(&payload.Message); err != nil {
+			return err
+		}
+		// Replies, tool call output and notes join the thread of the prompt
+		// that triggered them
+		payload.Message.ParentID = types.ThreadParentID(manager.state.Messages, payload.Message)
+		update.Payload = payload
 		// Append message to state
 		manager.state.Messages = append(manager.state.Messages, payload.Message)
-		// Update session message count if session exists
+		// Update session message count and activity if session exists
 		for i := range manager.state.Sessions {
 			if manager.state.Sessions[i].ID == payload.Message.SessionID {
 				manager.state.Sessions[i].MessageCount++
+				if payload.Message.Timestamp.After(manager.state.Sessions[i].UpdatedAt) {
+					manager.state.Sessions[i].UpdatedAt = payload.Message.Timestamp
+				}
 				break
 			}
 		}
@@ -422,21 +694,68 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		if payload.Content != "" && payload.BodyRef == "" {
+			meta := codeblocks.Describe(payload.Content)
+			payload.Meta = &meta
+		}
+		if err := manager.offloadUpdatePayloadLocked(&payload); err != nil {
+			return err
+		}
+		for _, ref := range []string{payload.BodyRef, payload.PartsRef} {
+			if err := manager.checkBlobRefLocked(ref); err != nil {
+				return err
+			}
+		}
+		update.Payload = payload
 		for i := range manager.state.Messages {
 			if manager.state.Messages[i].ID == payload.MessageID {
+				msg := &manager.state.Messages[i]
+				if payload.Content != "" || payload.BodyRef != "" {
+					// Offsets into the old body no longer hold, nor does the native record
+					msg.CodeBlocks = nil
+					msg.Meta = payload.Meta
+					msg.Native, msg.NativeRef = nil, ""
+				}
 				if payload.Content != "" {
-					manager.state.Messages[i].Content = payload.Content
+					msg.Content = payload.Content
+					msg.BodyRef, msg.BodySize = "", 0
 				}
-				if payload.Status != "" {
-					manager.state.Messages[i].Status = payload.Status
+				if payload.BodyRef != "" {
+					msg.Content, msg.Truncated = payload.Content, payload.Truncated
+					msg.BodyRef, msg.BodySize = payload.BodyRef, payload.BodySize
+				} else if payload.Content != "" {
+					msg.Truncated = false
+				}
+				// A cancelled reply stays cancelled whatever the server reports after the abort
+				if payload.Status != "" && msg.Status != "cancelled" {
+					msg.Status = payload.Status
 				}
 				if payload.Parts != nil {
-					manager.state.Messages[i].Parts = payload.Parts
+					msg.Parts = payload.Parts
+					msg.PartsRef = ""
+				}
+				if payload.PartsRef != "" {
+					msg.Parts = nil
+					msg.PartsRef = payload.PartsRef
 				}
 				break
 			}
 		}
 
+	case types.MessageRedacted:
+		var payload types.MessageRedactPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		updated, err := manager.applyRedactionLocked(payload, update.SourcePanel)
+		if err != nil {
+			return err
+		}
+		// Broadcast the redacted message rather than the offsets
+		update.Payload = updated
+		manager.redactJournalLocked(updated)
+		manager.redactEventsLocked(updated)
+
 	case types.MessageDeleted:
 		var payload types.MessageDeletePayload
 		if err := decodePayload(update.Payload, &payload); err != nil {
@@ -445,6 +764,9 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		// Find message and remove it; adjust session count
 		for i := range manager.state.Messages {
 			if manager.state.Messages[i].ID == payload.MessageID {
+				if err := manager.checkSessionLockLocked(manager.state.Messages[i].SessionID, update.SourcePanel, manager.now()); err != nil {
+					return err
+				}
 				// adjust session count
 				sid := manager.state.Messages[i].SessionID
 				for j := range manager.state.Sessions {
@@ -455,6 +777,10 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 				}
 				// remove message
 				manager.state.Messages = append(manager.state.Messages[:i], manager.state.Messages[i+1:]...)
+				manager.removeAnnotationsLocked(func(a types.MessageAnnotation) bool {
+					return a.MessageID == payload.MessageID
+				})
+				manager.pruneCollapsedThreadsLocked()
 				break
 			}
 		}
@@ -464,6 +790,9 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		if err := manager.checkSessionLockLocked(payload.SessionID, update.SourcePanel, manager.now()); err != nil {
+			return err
+		}
 		// Remove all messages for the given session
 		originalCount := len(manager.state.Messages)
 		filteredMessages := make([]types.MessageInfo, 0)
@@ -476,6 +805,10 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 			}
 		}
 		manager.state.Messages = filteredMessages
+		manager.removeAnnotationsLocked(func(a types.MessageAnnotation) bool {
+			return a.SessionID == payload.SessionID
+		})
+		manager.pruneCollapsedThreadsLocked()
 
 		// Update session message count to 0
 		for j := range manager.state.Sessions {
@@ -487,11 +820,80 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		log.Printf("[SYNC] Cleared %d messages from session %s (original: %d, remaining: %d)",
 			removedCount, payload.SessionID, originalCount, len(manager.state.Messages))
 
+	case types.ThreadCollapsed:
+		var payload types.ThreadCollapsePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if len(payload.MessageIDs) == 0 {
+			return fmt.Errorf("no threads given to collapse or expand")
+		}
+		for _, id := range payload.MessageIDs {
+			if manager.messageLocked(id) == nil {
+				return fmt.Errorf("message %s not found", id)
+			}
+		}
+		for _, id := range payload.MessageIDs {
+			collapsed := slices.Contains(manager.state.CollapsedThreads, id)
+			if payload.Collapsed && !collapsed {
+				manager.state.CollapsedThreads = append(manager.state.CollapsedThreads, id)
+			} else if !payload.Collapsed && collapsed {
+				manager.state.CollapsedThreads = slices.DeleteFunc(manager.state.CollapsedThreads, func(rootID string) bool { return rootID == id })
+			}
+		}
+
+	case types.CodeBlocksExtracted:
+		var payload types.CodeBlocksPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		msg := manager.messageLocked(payload.MessageID)
+		if msg == nil {
+			return fmt.Errorf("message %s not found", payload.MessageID)
+		}
+		size := len(msg.Content)
+		if msg.BodyRef != "" {
+			size = msg.BodySize
+		}
+		for i, block := range payload.Blocks {
+			if block.Index != i {
+				return fmt.Errorf("code block %d has index %d", i, block.Index)
+			}
+			if block.Start < 0 || block.End < block.Start || block.End > size {
+				return fmt.Errorf("code block %d lies outside message %s", i, payload.MessageID)
+			}
+		}
+		msg.CodeBlocks = payload.Blocks
+		update.Payload = payload
+
+	case types.MessageAttributed:
+		var payload types.MessageAttributionPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		msg := manager.messageLocked(payload.MessageID)
+		if msg == nil {
+			return fmt.Errorf("message %s not found", payload.MessageID)
+		}
+		msg.Agent = payload.Agent
+		update.Payload = payload
+
+	case types.CodeBlockHandled:
+		// Results of code block actions only inform panels; state is unchanged
+		var payload types.CodeBlockHandledPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		update.Payload = payload
+
 	case types.InputUpdated:
 		var payload types.InputUpdatePayload
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
+		if err := manager.checkSecretsLocked(*update, types.SecurityAlertPayload{}, "input_buffer", payload.Buffer); err != nil {
+			return err
+		}
 		manager.state.Input.Buffer = payload.Buffer
 		manager.state.Input.CursorPosition = payload.CursorPosition
 		manager.state.Input.SelectionStart = payload.SelectionStart
@@ -521,8 +923,20 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 		if err := decodePayload(update.Payload, &payload); err != nil {
 			return err
 		}
-		manager.state.Provider = payload.Provider
-		manager.state.Model = payload.Model
+		if payload.Agent == "" {
+			payload.Agent = manager.state.Agent
+		}
+		if payload.Agent == manager.state.Agent {
+			manager.state.Provider = payload.Provider
+			manager.state.Model = payload.Model
+		}
+		if payload.Agent != "" && payload.Provider != "" && payload.Model != "" {
+			if manager.state.AgentModel == nil {
+				manager.state.AgentModel = make(map[string]string)
+			}
+			manager.state.AgentModel[payload.Agent] = payload.Provider + "/" + payload.Model
+		}
+		update.Payload = payload
 
 	case types.AgentChanged:
 		var payload types.AgentChangePayload
@@ -530,138 +944,930 @@ func (manager *PanelSyncManager) UpdateWithVersionCheck(update types.StateUpdate
 			return err
 		}
 		manager.state.Agent = payload.Agent
+		// Switching agent switches to its default model; panels read it from the event
+		payload.Provider, payload.Model = "", ""
+		if model, err := types.ParseModelRef(manager.state.AgentModel[payload.Agent]); err == nil {
+			manager.state.Provider, manager.state.Model = model.ProviderID, model.ModelID
+			payload.Provider, payload.Model = model.ProviderID, model.ModelID
+		}
+		update.Payload = payload
 
-	case types.UIActionTriggered:
-		// UI actions don't modify state directly, they just trigger events
-		// The payload is passed through to the event for panels to handle
-		log.Printf("UI action triggered: %+v", update.Payload)
+	case types.AgentModelCleared:
+		var payload types.AgentModelClearPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if _, ok := manager.state.AgentModel[payload.Agent]; !ok {
+			return fmt.Errorf("agent %q has no default model", payload.Agent)
+		}
+		delete(manager.state.AgentModel, payload.Agent)
 
-	default:
-		log.Printf("Warning: unhandled update type in UpdateWithVersionCheck: %s. Bumping version only.", update.Type)
-	}
+	case types.AnnotationAdded:
+		var payload types.AnnotationAddPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Annotation.MessageID == "" {
+			return fmt.Errorf("annotation requires message_id")
+		}
+		msg := manager.messageLocked(payload.Annotation.MessageID)
+		if msg == nil {
+			return fmt.Errorf("message %s not found", payload.Annotation.MessageID)
+		}
+		if !payload.Annotation.Kind.Valid() {
+			return fmt.Errorf("unknown annotation kind %q", payload.Annotation.Kind)
+		}
+		if err := validateAnnotationRating(payload.Annotation.Kind, payload.Annotation.Rating); err != nil {
+			return err
+		}
+		if payload.Annotation.ID == "" {
+			payload.Annotation.ID = generateAnnotationID()
+		} else {
+			for _, existing := range manager.state.Annotations {
+				if existing.ID == payload.Annotation.ID {
+					return fmt.Errorf("annotation %s already exists", payload.Annotation.ID)
+				}
+			}
+		}
+		if payload.Annotation.Author == "" {
+			payload.Annotation.Author = update.SourcePanel
+		}
+		if payload.Annotation.CreatedAt.IsZero() {
+			payload.Annotation.CreatedAt = manager.now()
+		}
+		// The annotation always belongs to the session of the message it marks
+		payload.Annotation.SessionID = msg.SessionID
+		manager.state.Annotations = append(manager.state.Annotations, payload.Annotation)
+		update.Payload = payload
 
-	// Increment version and update timestamps for any successful change
-	manager.state.Version.Version++
-	manager.state.Version.Timestamp = time.Now()
-	manager.state.Version.Source = update.SourcePanel
-	manager.state.LastUpdate = time.Now()
-	manager.state.UpdateCount++
+	case types.AnnotationUpdated:
+		var payload types.AnnotationUpdatePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		var annotation *types.MessageAnnotation
+		for i := range manager.state.Annotations {
+			if manager.state.Annotations[i].ID == payload.AnnotationID {
+				annotation = &manager.state.Annotations[i]
+				break
+			}
+		}
+		if annotation == nil {
+			return fmt.Errorf("annotation %s not found", payload.AnnotationID)
+		}
+		if payload.Content != "" {
+			annotation.Content = payload.Content
+		}
+		if payload.Rating != nil {
+			if err := validateAnnotationRating(annotation.Kind, *payload.Rating); err != nil {
+				return err
+			}
+			annotation.Rating = *payload.Rating
+		}
+		if payload.Done != nil {
+			annotation.Done = *payload.Done
+		}
 
-	// Create and broadcast event
-	event := CreateEventFromUpdate(update, manager.state.Version.Version)
-	manager.eventBus.Broadcast(event)
+	case types.AnnotationRemoved:
+		var payload types.AnnotationRemovePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		// Removing an unknown annotation is a no-op to keep the operation idempotent
+		manager.removeAnnotationsLocked(func(a types.MessageAnnotation) bool {
+			return a.ID == payload.AnnotationID
+		})
 
-	return nil
-}
+	case types.SessionLocked:
+		var payload types.SessionLockPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		granted, err := manager.applySessionLockLocked(payload, update.SourcePanel)
+		if err != nil {
+			return err
+		}
+		update.Payload = granted
 
-// GetState returns a copy of the current state
-func (manager *PanelSyncManager) GetState() *types.SharedApplicationState {
-	manager.syncMutex.RLock()
-	defer manager.syncMutex.RUnlock()
-	return manager.state.Clone()
-}
+	case types.SessionUnlocked:
+		var payload types.SessionUnlockPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if err := manager.applySessionUnlockLocked(payload, update.SourcePanel); err != nil {
+			return err
+		}
 
-// GetEventBus returns the event bus for subscribing to events
-func (manager *PanelSyncManager) GetEventBus() interfaces.EventBus {
-	return manager.eventBus
-}
+	case types.StateCompacted:
+		var payload types.StateCompactPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		update.Payload = manager.applyCompactionLocked(payload)
 
-// SaveStateSync saves the state synchronously
-func (manager *PanelSyncManager) SaveStateSync() error {
-	return manager.saveStateSync()
-}
+	case types.UIActionTriggered:
+		// UI actions don't modify state directly, they just trigger events
+		// The payload is passed through to the event for panels to handle
+		var payload types.UIActionPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if err := payload.Validate(); err != nil {
+			return err
+		}
+		if router, ok := manager.eventBus.(actionRouter); ok && !router.HandlesAction(payload.Action, update.SourcePanel) {
+			return fmt.Errorf("%w: %s", ErrNoActionHandler, payload.Action)
+		}
+		update.Payload = payload
+		log.Printf("UI action triggered: %+v", payload)
 
-// ResetState replaces the current state with a fresh instance and persists it.
-func (manager *PanelSyncManager) ResetState() error {
-	manager.syncMutex.Lock()
-	manager.state = types.NewSharedApplicationState()
-	manager.syncMutex.Unlock()
+	case types.PromptSubmitted:
+		// Like UI actions, submitted prompts only produce an event
+		var payload types.PromptSubmitPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if strings.TrimSpace(payload.SessionID) == "" || strings.TrimSpace(payload.Text) == "" {
+			return fmt.Errorf("prompt_submitted needs a session_id and text")
+		}
+		update.Payload = payload
 
-	if err := manager.saveStateSync(); err != nil {
-		return fmt.Errorf("failed to persist reset state: %w", err)
-	}
+	case types.PromptQueued:
+		var payload types.PromptQueuedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		prompt := payload.Prompt
+		if prompt.ID == "" || strings.TrimSpace(prompt.SessionID) == "" || strings.TrimSpace(prompt.Text) == "" {
+			return fmt.Errorf("prompt_queued needs an id, a session_id and text")
+		}
+		if i := queuedPromptIndex(manager.state.PromptQueue, prompt.ID); i >= 0 {
+			// Editing a queued prompt keeps its place
+			if manager.state.PromptQueue[i].SessionID != prompt.SessionID {
+				return fmt.Errorf("queued prompt %s belongs to session %s", prompt.ID, manager.state.PromptQueue[i].SessionID)
+			}
+			manager.state.PromptQueue[i].Text = prompt.Text
+		} else {
+			if prompt.QueuedAt.IsZero() {
+				prompt.QueuedAt = update.Timestamp
+			}
+			manager.state.PromptQueue = append(manager.state.PromptQueue, prompt)
+		}
+		update.Payload = types.PromptQueuedPayload{Prompt: prompt}
 
-	manager.syncMutex.RLock()
-	stateClone := manager.state.Clone()
-	manager.syncMutex.RUnlock()
+	case types.PromptDequeued:
+		var payload types.PromptDequeuedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		// Failing for a prompt already gone keeps two writers from both taking it
+		i := queuedPromptIndex(manager.state.PromptQueue, payload.PromptID)
+		if i < 0 {
+			return fmt.Errorf("queued prompt %s not found", payload.PromptID)
+		}
+		manager.state.PromptQueue = append(manager.state.PromptQueue[:i:i], manager.state.PromptQueue[i+1:]...)
+		update.Payload = payload
 
-	event := types.StateEvent{
-		ID:          generateEventID(),
+	case types.PromptQueueReordered:
+		var payload types.PromptQueueReorderPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		queue, err := types.ReorderPromptQueue(manager.state.PromptQueue, payload)
+		if err != nil {
+			return err
+		}
+		manager.state.PromptQueue = queue
+		update.Payload = payload
+
+	case types.PromptScheduled:
+		var payload types.PromptSchedulePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		schedule := payload.Schedule
+		if err := schedule.Validate(); err != nil {
+			return err
+		}
+		if schedule.SessionID != "" {
+			if manager.findSessionLocked(schedule.SessionID) == nil {
+				return fmt.Errorf("session %s not found", schedule.SessionID)
+			}
+		}
+		if schedule.CreatedAt.IsZero() {
+			schedule.CreatedAt = update.Timestamp
+		}
+		if i := scheduleIndex(manager.state.ScheduledPrompts, schedule.ID); i >= 0 {
+			manager.state.ScheduledPrompts[i] = schedule
+		} else {
+			manager.state.ScheduledPrompts = append(manager.state.ScheduledPrompts, schedule)
+		}
+		update.Payload = types.PromptSchedulePayload{Schedule: schedule}
+
+	case types.PromptUnscheduled:
+		var payload types.PromptUnschedulePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		i := scheduleIndex(manager.state.ScheduledPrompts, payload.ScheduleID)
+		if i < 0 {
+			return fmt.Errorf("scheduled prompt %s not found", payload.ScheduleID)
+		}
+		manager.state.ScheduledPrompts = append(manager.state.ScheduledPrompts[:i:i], manager.state.ScheduledPrompts[i+1:]...)
+		update.Payload = payload
+
+	case types.ScheduledPromptRan:
+		var payload types.ScheduledPromptRanPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		i := scheduleIndex(manager.state.ScheduledPrompts, payload.ScheduleID)
+		if i < 0 {
+			return fmt.Errorf("scheduled prompt %s not found", payload.ScheduleID)
+		}
+		schedule := &manager.state.ScheduledPrompts[i]
+		if !schedule.Due(payload.RanAt) {
+			return fmt.Errorf("scheduled prompt %s is not due until %s", schedule.ID, schedule.NextRun.Format(time.RFC3339))
+		}
+		schedule.LastRun = payload.RanAt
+		schedule.Runs++
+		if next := schedule.Following(payload.RanAt); !next.IsZero() {
+			schedule.NextRun = next
+		} else {
+			manager.state.ScheduledPrompts = append(manager.state.ScheduledPrompts[:i:i], manager.state.ScheduledPrompts[i+1:]...)
+		}
+		update.Payload = payload
+
+	case types.GitStatusChanged:
+		var payload types.GitStatusPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		manager.state.Git = payload.Git
+
+	case types.ConnectivityChanged:
+		var payload types.ConnectivityChangedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		for _, link := range append([]types.LinkState{payload.Connection.Server}, payload.Connection.Panels...) {
+			switch link.Status {
+			case types.LinkOnline, types.LinkDegraded, types.LinkOffline:
+			default:
+				return fmt.Errorf("link %q has unknown status %q", link.Name, link.Status)
+			}
+		}
+		manager.state.Connection = &payload.Connection
+
+	case types.FileDiffReady:
+		var payload types.FileDiffReadyPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Diff.ID == "" {
+			return fmt.Errorf("file diff requires an id")
+		}
+		diffs := manager.state.Diffs[:0:0]
+		for _, diff := range manager.state.Diffs {
+			if diff.ID != payload.Diff.ID {
+				diffs = append(diffs, diff)
+			}
+		}
+		diffs = append(diffs, payload.Diff)
+		if len(diffs) > types.MaxFileDiffs {
+			diffs = diffs[len(diffs)-types.MaxFileDiffs:]
+		}
+		manager.state.Diffs = diffs
+
+	case types.FileDiffResolved:
+		var payload types.FileDiffResolvedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		found := false
+		for i := range manager.state.Diffs {
+			if manager.state.Diffs[i].ID != payload.DiffID {
+				continue
+			}
+			found = true
+			if payload.Error == "" {
+				manager.state.Diffs[i].Status = payload.Status
+			}
+			manager.state.Diffs[i].Error = payload.Error
+		}
+		if !found {
+			return fmt.Errorf("file diff %s not found", payload.DiffID)
+		}
+
+	case types.FileTreeChanged:
+		var payload types.FileTreeUpdatePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if err := manager.state.FileTree.Apply(payload); err != nil {
+			return err
+		}
+
+	case types.TerminalRunStarted:
+		var payload types.TerminalRunStartedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Run.ID == "" {
+			return fmt.Errorf("terminal run requires an id")
+		}
+		runs := manager.state.TerminalRuns[:0:0]
+		for _, run := range manager.state.TerminalRuns {
+			if run.ID != payload.Run.ID {
+				runs = append(runs, run)
+			}
+		}
+		runs = append(runs, payload.Run)
+		if len(runs) > types.MaxTerminalRuns {
+			runs = runs[len(runs)-types.MaxTerminalRuns:]
+		}
+		manager.state.TerminalRuns = runs
+
+	case types.TerminalRunFinished:
+		var payload types.TerminalRunFinishedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		found := false
+		for i := range manager.state.TerminalRuns {
+			run := &manager.state.TerminalRuns[i]
+			if run.ID != payload.RunID {
+				continue
+			}
+			found = true
+			run.ExitCode, run.Error, run.FinishedAt = payload.ExitCode, payload.Error, payload.FinishedAt
+			run.Status = types.TerminalRunSucceeded
+			if payload.Error != "" || payload.ExitCode != 0 {
+				run.Status = types.TerminalRunFailed
+			}
+		}
+		if !found {
+			return fmt.Errorf("terminal run %s not found", payload.RunID)
+		}
+
+	case types.InputLocationChanged:
+		var payload types.InputLocationPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if loc := payload.Location; loc != nil && (!filepath.IsAbs(loc.Path) || loc.Line < 1 || loc.Column < 1) {
+			return fmt.Errorf("invalid input location %s", loc)
+		}
+		if payload.Location == nil || manager.state.PromptContext == nil || manager.state.PromptContext.Location != *payload.Location {
+			manager.state.PromptContext = nil
+		}
+		manager.state.Input.Location = payload.Location
+
+	case types.PromptContextUpdated:
+		var payload types.PromptContextPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		// Gathering takes a while; the location may have moved on meanwhile
+		if manager.state.Input.Location == nil || *manager.state.Input.Location != payload.Context.Location {
+			return fmt.Errorf("prompt context for %s is stale", payload.Context.Location)
+		}
+		manager.state.PromptContext = &payload.Context
+
+	case types.RunStarted:
+		var payload types.RunStartedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Run.ID == "" || payload.Run.SessionID == "" {
+			return fmt.Errorf("run requires an id and a session")
+		}
+		if manager.runLocked(payload.Run.ID) != nil {
+			return fmt.Errorf("run %s already exists", payload.Run.ID)
+		}
+		payload.Run.Status = types.AgentRunRunning
+		manager.state.Runs = append(manager.state.Runs, payload.Run)
+		manager.trimRunsLocked()
+
+	case types.RunFinished:
+		var payload types.RunFinishedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		run, err := manager.runningRunLocked(payload.RunID)
+		if err != nil {
+			return err
+		}
+		run.Status = types.AgentRunCompleted
+		if payload.Error != "" {
+			run.Status = types.AgentRunFailed
+		}
+		if payload.MessageID != "" {
+			run.MessageID = payload.MessageID
+		}
+		if payload.ParentMessageID != "" {
+			run.ParentMessageID = payload.ParentMessageID
+		} else if run.ParentMessageID == "" && run.MessageID != "" {
+			run.ParentMessageID = manager.precedingUserMessageLocked(run.SessionID, run.MessageID)
+		}
+		run.Error, run.FinishedAt = payload.Error, payload.FinishedAt
+
+	case types.RunAttempted:
+		var payload types.RunAttemptedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		run, err := manager.runningRunLocked(payload.RunID)
+		if err != nil {
+			return err
+		}
+		if payload.Attempt.Number != len(run.Attempts)+1 {
+			return fmt.Errorf("run %s: attempt %d out of order, %d recorded", run.ID, payload.Attempt.Number, len(run.Attempts))
+		}
+		run.Attempts = append(run.Attempts, payload.Attempt)
+
+	case types.SessionTemplatesChanged:
+		var payload types.SessionTemplatesPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		names := make(map[string]bool, len(payload.Templates))
+		for _, template := range payload.Templates {
+			if err := template.Validate(); err != nil {
+				return err
+			}
+			if names[template.Name] {
+				return fmt.Errorf("session template %s is defined twice", template.Name)
+			}
+			names[template.Name] = true
+		}
+		manager.state.SessionTemplates = payload.Templates
+		update.Payload = payload
+
+	case types.ModelPolicyChanged:
+		var payload types.ModelPolicyPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Policy != nil && (payload.Policy.MaxRetries < 0 || payload.Policy.Backoff < 0) {
+			return fmt.Errorf("model policy retries and backoff cannot be negative")
+		}
+		manager.state.ModelPolicy = payload.Policy
+
+	case types.AgentRoutesChanged:
+		var payload types.AgentRoutesPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		for name, agent := range payload.Routes {
+			if !agentroute.ValidMention(name) || agent == "" {
+				return fmt.Errorf("invalid agent route %q -> %q", name, agent)
+			}
+		}
+		manager.state.AgentRoutes = payload.Routes
+		update.Payload = payload
+
+	case types.ContextUsageUpdated:
+		var payload types.ContextUsagePayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Usage.Tokens < 0 || payload.Usage.Limit < 0 {
+			return fmt.Errorf("context usage cannot be negative")
+		}
+		payload.Usage.Level = types.ContextLevel(payload.Usage.Percent())
+		manager.state.ContextUsage = &payload.Usage
+		update.Payload = payload
+
+	case types.ContextThreshold:
+		var payload types.ContextThresholdPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if payload.Usage.Level == types.ContextLevelOK {
+			return fmt.Errorf("context threshold requires a warning level")
+		}
+
+	case types.SessionCompacted:
+		var payload types.SessionCompactedPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		if err := manager.checkSessionLockLocked(payload.Compaction.SessionID, update.SourcePanel, manager.now()); err != nil {
+			return err
+		}
+		if err := manager.compactSessionLocked(&payload, update.Timestamp); err != nil {
+			return err
+		}
+		update.Payload = payload
+
+	case types.CancelRun:
+		var payload types.CancelRunPayload
+		if err := decodePayload(update.Payload, &payload); err != nil {
+			return err
+		}
+		cancelled, err := manager.cancelRunLocked(payload, update.Timestamp)
+		if err != nil {
+			return err
+		}
+		update.Payload = cancelled
+
+	case types.StateBatched:
+		return fmt.Errorf("%s updates are formed by the apply loop and cannot be submitted", update.Type)
+
+	default:
+		log.Printf("Warning: unhandled update type in applyUpdateLocked: %s. Bumping version only.", update.Type)
+	}
+	return nil
+}
+
+// commitUpdateLocked bumps the version for an applied update, records it and
+// broadcasts its event
+func (manager *PanelSyncManager) commitUpdateLocked(update types.StateUpdate) {
+	// Increment version and update timestamps for any successful change
+	versionBefore := manager.state.Version.Version
+	manager.state.Version.Version++
+	manager.state.Version.Timestamp = manager.now()
+	manager.state.Version.Source = update.SourcePanel
+	manager.state.LastUpdate = manager.now()
+	manager.state.UpdateCount++
+	manager.advanceClockLocked(update)
+
+	manager.recordAuditLocked(update, versionBefore)
+	manager.recordJournalLocked(update)
+	manager.recordMacroLocked(update)
+
+	// Create and broadcast event
+	span := manager.tracer.Start(update.TraceParent, "state.broadcast")
+	event := CreateEventFromUpdate(update, manager.state.Version.Version)
+	event.Timestamp = manager.state.Version.Timestamp
+	event.Clock = manager.state.Version.Clock.Clone()
+	event.TraceParent = span.TraceParent()
+	span.SetAttr("event.type", string(event.Type))
+	manager.eventBus.Broadcast(event)
+	span.End()
+	manager.lastTrace = update.TraceParent
+}
+
+// removeAnnotationsLocked drops annotations matching the predicate (caller must hold syncMutex)
+func (manager *PanelSyncManager) removeAnnotationsLocked(match func(types.MessageAnnotation) bool) {
+	kept := manager.state.Annotations[:0]
+	for _, annotation := range manager.state.Annotations {
+		if !match(annotation) {
+			kept = append(kept, annotation)
+		}
+	}
+	manager.state.Annotations = kept
+}
+
+// pruneCollapsedThreadsLocked forgets collapsed threads whose first message
+// is gone (caller must hold syncMutex)
+func (manager *PanelSyncManager) pruneCollapsedThreadsLocked() {
+	manager.state.CollapsedThreads = slices.DeleteFunc(manager.state.CollapsedThreads, func(rootID string) bool {
+		return manager.messageLocked(rootID) == nil
+	})
+}
+
+// validateAnnotationRating checks a rating is a thumbs up or down; ratings are
+// required on rating annotations and optional on the other kinds
+func validateAnnotationRating(kind types.AnnotationKind, rating int) error {
+	if rating < -1 || rating > 1 {
+		return fmt.Errorf("annotation rating must be -1, 0 or +1, got %d", rating)
+	}
+	if kind == types.AnnotationRating && rating == 0 {
+		return fmt.Errorf("rating annotation requires a rating of -1 or +1")
+	}
+	return nil
+}
+
+// messageLocked returns the message with the given ID, or nil (caller must hold syncMutex)
+func (manager *PanelSyncManager) messageLocked(id string) *types.MessageInfo {
+	for i := range manager.state.Messages {
+		if manager.state.Messages[i].ID == id {
+			return &manager.state.Messages[i]
+		}
+	}
+	return nil
+}
+
+// runLocked returns the run with the given ID, or nil (caller must hold syncMutex)
+func (manager *PanelSyncManager) runLocked(id string) *types.AgentRun {
+	for i := range manager.state.Runs {
+		if manager.state.Runs[i].ID == id {
+			return &manager.state.Runs[i]
+		}
+	}
+	return nil
+}
+
+// scheduleIndex returns the index of the scheduled prompt with the given ID, or -1
+func scheduleIndex(schedules []types.ScheduledPrompt, scheduleID string) int {
+	for i, schedule := range schedules {
+		if schedule.ID == scheduleID {
+			return i
+		}
+	}
+	return -1
+}
+
+// runningRunLocked returns the run with the given ID if it is still in flight
+// (caller must hold syncMutex)
+func (manager *PanelSyncManager) runningRunLocked(id string) (*types.AgentRun, error) {
+	run := manager.runLocked(id)
+	if run == nil {
+		return nil, fmt.Errorf("run %s not found", id)
+	}
+	if run.Status != types.AgentRunRunning {
+		return nil, fmt.Errorf("run %s already %s", id, run.Status)
+	}
+	return run, nil
+}
+
+// compactSessionLocked moves a compaction's messages to the archive and puts
+// the summary where the first of them was, or updates it in place when it
+// already arrived as a reply. The archived IDs and token counts in the
+// payload are narrowed to what was applied (caller must hold syncMutex).
+func (manager *PanelSyncManager) compactSessionLocked(payload *types.SessionCompactedPayload, at time.Time) error {
+	compaction := &payload.Compaction
+	summary := &payload.Summary
+	if compaction.SessionID == "" {
+		return fmt.Errorf("session id is required")
+	}
+	if summary.ID == "" || summary.SessionID != compaction.SessionID {
+		return fmt.Errorf("summary must be a message of session %s", compaction.SessionID)
+	}
+	if compaction.TokensBefore < 0 || compaction.TokensAfter < 0 {
+		return fmt.Errorf("token counts cannot be negative")
+	}
+
+	archive := make(map[string]bool, len(compaction.ArchivedIDs))
+	for _, id := range compaction.ArchivedIDs {
+		if id != summary.ID {
+			archive[id] = true
+		}
+	}
+	kept := make([]types.MessageInfo, 0, len(manager.state.Messages))
+	archivedIDs := make([]string, 0, len(archive))
+	summaryAt, existing := -1, false
+	for _, msg := range manager.state.Messages {
+		switch {
+		case msg.SessionID == compaction.SessionID && archive[msg.ID]:
+			if summaryAt < 0 {
+				summaryAt = len(kept)
+			}
+			manager.state.ArchivedMessages = append(manager.state.ArchivedMessages, msg)
+			archivedIDs = append(archivedIDs, msg.ID)
+		case msg.ID == summary.ID:
+			existing = true
+			kept = append(kept, *summary)
+		default:
+			kept = append(kept, msg)
+		}
+	}
+	if len(archivedIDs) == 0 {
+		return fmt.Errorf("session %s has none of the messages to archive", compaction.SessionID)
+	}
+	if !existing {
+		kept = append(kept[:summaryAt], append([]types.MessageInfo{*summary}, kept[summaryAt:]...)...)
+	}
+	manager.state.Messages = kept
+
+	count := 0
+	for _, msg := range kept {
+		if msg.SessionID == compaction.SessionID {
+			count++
+		}
+	}
+	for i := range manager.state.Sessions {
+		if manager.state.Sessions[i].ID == compaction.SessionID {
+			manager.state.Sessions[i].MessageCount = count
+			break
+		}
+	}
+
+	compaction.SummaryID = summary.ID
+	compaction.ArchivedIDs = archivedIDs
+	if compaction.CompactedAt.IsZero() {
+		compaction.CompactedAt = at
+	}
+	manager.state.Compactions = append(manager.state.Compactions, *compaction)
+
+	// The summary stands in for the archived messages until the gauge measures again
+	if usage := manager.state.ContextUsage; usage != nil && usage.SessionID == compaction.SessionID {
+		usage.Tokens = compaction.TokensAfter
+		usage.Estimated = true
+		usage.Level = types.ContextLevel(usage.Percent())
+		usage.UpdatedAt = at
+	}
+	return nil
+}
+
+// queuedPromptIndex returns the index of the queued prompt with the given ID, or -1
+func queuedPromptIndex(queue []types.QueuedPrompt, promptID string) int {
+	for i, prompt := range queue {
+		if prompt.ID == promptID {
+			return i
+		}
+	}
+	return -1
+}
+
+// cancelRunLocked resolves a cancel request to a run, or to the session of a
+// message when no run of ours is answering there, and marks the run and the
+// session's pending replies cancelled (caller must hold syncMutex)
+func (manager *PanelSyncManager) cancelRunLocked(payload types.CancelRunPayload, at time.Time) (types.RunCancelledPayload, error) {
+	var run *types.AgentRun
+	sessionID := ""
+	switch {
+	case payload.RunID != "":
+		var err error
+		if run, err = manager.runningRunLocked(payload.RunID); err != nil {
+			return types.RunCancelledPayload{}, err
+		}
+		sessionID = run.SessionID
+	case payload.MessageID != "":
+		for _, msg := range manager.state.Messages {
+			if msg.ID == payload.MessageID {
+				sessionID = msg.SessionID
+				break
+			}
+		}
+		if sessionID == "" {
+			return types.RunCancelledPayload{}, fmt.Errorf("message %s not found", payload.MessageID)
+		}
+		for i := range manager.state.Runs {
+			candidate := &manager.state.Runs[i]
+			if candidate.Status != types.AgentRunRunning || candidate.SessionID != sessionID {
+				continue
+			}
+			// The run that produced the message wins over other runs of the session
+			if run == nil || candidate.MessageID == payload.MessageID {
+				run = candidate
+			}
+		}
+	default:
+		return types.RunCancelledPayload{}, fmt.Errorf("cancel requires a run id or a message id")
+	}
+
+	if at.IsZero() {
+		at = manager.now()
+	}
+	cancelled := types.RunCancelledPayload{SessionID: sessionID, Reason: payload.Reason, FinishedAt: at}
+	for i := range manager.state.Messages {
+		msg := &manager.state.Messages[i]
+		if msg.SessionID == sessionID && msg.Type == "assistant" && msg.Status == "pending" {
+			msg.Status = "cancelled"
+			cancelled.MessageIDs = append(cancelled.MessageIDs, msg.ID)
+		}
+	}
+	if run == nil && len(cancelled.MessageIDs) == 0 {
+		return types.RunCancelledPayload{}, fmt.Errorf("nothing running in session %s", sessionID)
+	}
+	if run != nil {
+		run.Status = types.AgentRunCancelled
+		run.Error, run.FinishedAt = payload.Reason, at
+		cancelled.RunID, cancelled.CancelToken = run.ID, run.CancelToken
+	}
+	return cancelled, nil
+}
+
+// precedingUserMessageLocked returns the last user message of a session before
+// the given message, the prompt an assistant reply answers (caller must hold
+// syncMutex)
+func (manager *PanelSyncManager) precedingUserMessageLocked(sessionID, messageID string) string {
+	parent := ""
+	for _, msg := range manager.state.Messages {
+		if msg.ID == messageID {
+			return parent
+		}
+		if msg.SessionID == sessionID && msg.Type == "user" {
+			parent = msg.ID
+		}
+	}
+	return ""
+}
+
+// trimRunsLocked drops the oldest finished runs beyond MaxAgentRuns; runs in
+// flight are always kept (caller must hold syncMutex)
+func (manager *PanelSyncManager) trimRunsLocked() {
+	excess := len(manager.state.Runs) - types.MaxAgentRuns
+	if excess <= 0 {
+		return
+	}
+	kept := manager.state.Runs[:0]
+	for _, run := range manager.state.Runs {
+		if excess > 0 && run.Status != types.AgentRunRunning {
+			excess--
+			continue
+		}
+		kept = append(kept, run)
+	}
+	manager.state.Runs = kept
+}
+
+// GetState returns a copy of the current state
+func (manager *PanelSyncManager) GetState() *types.SharedApplicationState {
+	manager.syncMutex.RLock()
+	defer manager.syncMutex.RUnlock()
+	return manager.state.Clone()
+}
+
+// GetEventBus returns the event bus for subscribing to events
+func (manager *PanelSyncManager) GetEventBus() interfaces.EventBus {
+	return manager.eventBus
+}
+
+// ResetState replaces the current state with a fresh instance and persists it.
+func (manager *PanelSyncManager) ResetState() error {
+	manager.syncMutex.Lock()
+	manager.state = types.NewSharedApplicationState()
+	manager.syncMutex.Unlock()
+
+	if err := manager.SaveStateSync(); err != nil {
+		return fmt.Errorf("failed to persist reset state: %w", err)
+	}
+
+	manager.syncMutex.RLock()
+	stateClone := manager.state.Clone()
+	manager.syncMutex.RUnlock()
+
+	event := types.StateEvent{
+		ID:          generateEventID(),
 		Type:        types.EventStateSync,
 		Data:        types.StateSyncPayload{State: stateClone},
 		Version:     stateClone.Version.Version,
 		SourcePanel: "system",
-		Timestamp:   time.Now(),
+		Timestamp:   manager.now(),
 	}
 
 	manager.eventBus.Broadcast(event)
 	return nil
 }
 
-// saveStateSync performs synchronous state saving
-func (manager *PanelSyncManager) saveStateSync() error {
+// RestoreState replaces the current state with a restored copy, such as one
+// loaded from a backup, persists it and sends panels a full state sync. The
+// restored state continues the current version sequence so panels holding a
+// newer version do not reject it.
+func (manager *PanelSyncManager) RestoreState(restored *types.SharedApplicationState) error {
+	if restored == nil {
+		return fmt.Errorf("no state to restore")
+	}
+	restored = restored.Clone()
+
+	manager.syncMutex.Lock()
+	restored.Version.Version = manager.state.Version.Version + 1
+	restored.Version.Timestamp = manager.now()
+	restored.Version.Source = "system"
+	manager.state = restored
+	manager.syncMutex.Unlock()
+
+	if err := manager.SaveStateSync(); err != nil {
+		return fmt.Errorf("failed to persist restored state: %w", err)
+	}
+
 	manager.syncMutex.RLock()
 	stateClone := manager.state.Clone()
 	manager.syncMutex.RUnlock()
 
-	startTime := time.Now()
-	err := manager.repository.SaveStateAtomic(stateClone)
-	duration := time.Since(startTime)
-
-	if err == nil {
-		manager.lastSaveTime = time.Now()
-		manager.metrics.RecordSave(true, duration)
-	} else {
-		manager.metrics.RecordSave(false, duration)
+	event := types.StateEvent{
+		ID:          generateEventID(),
+		Type:        types.EventStateSync,
+		Data:        types.StateSyncPayload{State: stateClone},
+		Version:     stateClone.Version.Version,
+		SourcePanel: "system",
+		Timestamp:   manager.now(),
 	}
 
-	return err
+	manager.eventBus.Broadcast(event)
+	return nil
 }
 
-// autoSaveWorker performs periodic auto-saves
+// autoSaveWorker performs periodic auto-saves, following configuration changes
 func (manager *PanelSyncManager) autoSaveWorker() {
-	if !manager.autoSaveEnabled {
-		return
-	}
-
-	ticker := time.NewTicker(manager.autoSaveInterval)
-	defer ticker.Stop()
-
 	for {
-		select {
-		case <-manager.ctx.Done():
-			return
-		case <-ticker.C:
-			// Check if state has been modified since last save
-			if time.Since(manager.lastSaveTime) >= manager.autoSaveInterval {
-				if err := manager.saveStateSync(); err != nil {
-					log.Printf("Auto-save failed: %v", err)
-				}
-			}
+		config, changed := manager.currentConfig()
+		var tick <-chan time.Time
+		if config.AutoSaveEnabled {
+			tick = manager.clock().After(config.AutoSaveInterval)
 		}
-	}
-}
 
-// saveWorker processes queued save operations
-func (manager *PanelSyncManager) saveWorker() {
-	for {
 		select {
 		case <-manager.ctx.Done():
 			return
-		case req, ok := <-manager.saveQueue:
-			if !ok {
-				return
-			}
-
-			// Process save request
-			err := manager.repository.SaveStateAtomic(req.state)
-			if err == nil {
-				manager.lastSaveTime = time.Now()
+		case <-changed:
+			continue
+		case <-tick:
+			// A full disk pauses autosave until a probe finds room again; the
+			// first save after that runs at once
+			if manager.storageDegraded() {
+				if !manager.diskSpaceRecovered() {
+					continue
+				}
+			} else if manager.sinceLastSave() < config.AutoSaveInterval {
+				continue
 			}
-
-			// Send response if callback provided
-			if req.callback != nil {
-				req.callback <- err
+			if err := manager.SaveStateSync(); err != nil {
+				log.Printf("Auto-save failed: %v", err)
 			}
 		}
 	}
@@ -670,18 +1876,22 @@ func (manager *PanelSyncManager) saveWorker() {
 // ForceFullSync forces a full state synchronization
 func (manager *PanelSyncManager) ForceFullSync() error {
 	// Save current state
-	if err := manager.saveStateSync(); err != nil {
+	if err := manager.SaveStateSync(); err != nil {
 		return fmt.Errorf("failed to save state: %w", err)
 	}
 
+	manager.syncMutex.RLock()
+	stateClone := manager.state.Clone()
+	manager.syncMutex.RUnlock()
+
 	// Broadcast full state sync event
 	event := types.StateEvent{
 		ID:          generateEventID(),
 		Type:        types.EventStateSync,
-		Data:        types.StateSyncPayload{State: manager.state},
-		Version:     manager.state.GetCurrentVersion(),
+		Data:        types.StateSyncPayload{State: stateClone},
+		Version:     stateClone.Version.Version,
 		SourcePanel: "system",
-		Timestamp:   time.Now(),
+		Timestamp:   manager.now(),
 	}
 
 	manager.eventBus.Broadcast(event)
@@ -690,23 +1900,12 @@ func (manager *PanelSyncManager) ForceFullSync() error {
 
 // GetMetrics returns sync manager metrics
 func (manager *PanelSyncManager) GetMetrics() interfaces.StateManagerMetrics {
-	m := manager.metrics
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
-	return interfaces.StateManagerMetrics{
-		TotalUpdates:         m.TotalUpdates,
-		SuccessfulUpdates:    m.SuccessfulUpdates,
-		FailedUpdates:        m.FailedUpdates,
-		UpdatesByType:        m.UpdatesByType,
-		TotalSaves:           m.TotalSaves,
-		SuccessfulSaves:      m.SuccessfulSaves,
-		FailedSaves:          m.FailedSaves,
-		AverageUpdateLatency: m.AverageUpdateLatency,
-		AverageSaveLatency:   m.AverageSaveLatency,
-		LastUpdateTime:       m.LastUpdateTime,
-		LastSaveTime:         m.LastSaveTime,
-	}
+	snapshot := manager.metrics.Snapshot()
+	manager.saveMutex.RLock()
+	snapshot.SaveQueueDepth = len(manager.saveQueue)
+	snapshot.SaveQueueCapacity = cap(manager.saveQueue)
+	manager.saveMutex.RUnlock()
+	return snapshot
 }
 
 // GetConflictStatistics returns conflict resolution statistics
@@ -722,7 +1921,15 @@ func (manager *PanelSyncManager) IsHealthy() bool {
 	}
 
 	// Check if save queue is not full
-	if len(manager.saveQueue) >= cap(manager.saveQueue) {
+	manager.saveMutex.RLock()
+	saveQueueFull := len(manager.saveQueue) >= cap(manager.saveQueue)
+	manager.saveMutex.RUnlock()
+	if saveQueueFull {
+		return false
+	}
+
+	// Check that persisted files have not become readable by other users
+	if len(manager.repository.GetStats().PermissionIssues) > 0 {
 		return false
 	}
 
@@ -730,138 +1937,214 @@ func (manager *PanelSyncManager) IsHealthy() bool {
 	return manager.metrics.IsHealthy()
 }
 
-// generateUpdateID creates a unique identifier for state updates
+// generateUpdateID creates a unique identifier for state updates, which
+// deduplication relies on
 func generateUpdateID() string {
-	return fmt.Sprintf("update_%d_%d", time.Now().UnixNano(), time.Now().Unix())
+	return ids.New("update")
 }
 
-// SyncMetrics tracks synchronization performance metrics
+// generateAnnotationID creates a unique identifier for message annotations
+func generateAnnotationID() string {
+	return ids.New("annotation")
+}
+
+// SyncMetrics tracks synchronization performance metrics. Counters and
+// timestamps are atomic, so recording never blocks the apply loop and a
+// snapshot takes no lock that a reader could re-enter; only the latency
+// histograms share a mutex.
 type SyncMetrics struct {
-	mutex                sync.RWMutex
-	TotalUpdates         int64                      `json:"total_updates"`
-	SuccessfulUpdates    int64                      `json:"successful_updates"`
-	FailedUpdates        int64                      `json:"failed_updates"`
-	UpdatesByType        map[types.UpdateType]int64 `json:"updates_by_type"`
-	TotalSaves           int64                      `json:"total_saves"`
-	SuccessfulSaves      int64                      `json:"successful_saves"`
-	FailedSaves          int64                      `json:"failed_saves"`
-	AverageUpdateLatency time.Duration              `json:"average_update_latency"`
-	AverageSaveLatency   time.Duration              `json:"average_save_latency"`
-	LastUpdateTime       time.Time                  `json:"last_update_time"`
-	LastSaveTime         time.Time                  `json:"last_save_time"`
-	InitializationTime   time.Time                  `json:"initialization_time"`
-	IsInitialized        bool                       `json:"is_initialized"`
+	totalUpdates      atomic.Int64
+	successfulUpdates atomic.Int64
+	failedUpdates     atomic.Int64
+	duplicateUpdates  atomic.Int64
+	updatesByType     metrics.CounterMap[types.UpdateType]
+	totalSaves        atomic.Int64
+	successfulSaves   atomic.Int64
+	failedSaves       atomic.Int64
+	slowUpdates       atomic.Int64 // Updates the watchdog reported
+	slowSaves         atomic.Int64 // Saves the watchdog reported
+	batches           atomic.Int64 // Passes of the apply loop that took more than one update
+	batchedUpdates    atomic.Int64 // Updates taken in those passes
+	largestBatch      atomic.Int64
+	coalescedSaves    atomic.Int64 // Save requests dropped because the queue was full
+	panics            metrics.CounterMap[string]
+	lastUpdate        metrics.Stamp
+	lastSave          metrics.Stamp
+	initializedAt     metrics.Stamp
+	initialized       atomic.Bool
+	now               func() time.Time // The owning manager's clock
+
+	// Latency distributions; the reported averages are their means
+	latencyMutex  sync.Mutex
+	updateLatency metrics.Histogram
+	saveLatency   metrics.Histogram
 }
 
 // NewSyncMetrics creates a new sync metrics tracker
 func NewSyncMetrics() *SyncMetrics {
-	return &SyncMetrics{
-		UpdatesByType: make(map[types.UpdateType]int64),
-	}
+	return &SyncMetrics{now: time.Now}
 }
 
 // RecordUpdate records statistics for a state update
 func (m *SyncMetrics) RecordUpdate(updateType types.UpdateType, success bool, duration time.Duration) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	m.TotalUpdates++
-	m.UpdatesByType[updateType]++
-	m.LastUpdateTime = time.Now()
+	m.totalUpdates.Add(1)
+	m.updatesByType.Add(updateType, 1)
+	m.lastUpdate.Set(m.now())
 
 	if success {
-		m.SuccessfulUpdates++
+		m.successfulUpdates.Add(1)
 	} else {
-		m.FailedUpdates++
+		m.failedUpdates.Add(1)
 	}
 
-	// Update average latency (simple moving average)
-	if m.TotalUpdates == 1 {
-		m.AverageUpdateLatency = duration
-	} else {
-		m.AverageUpdateLatency = (m.AverageUpdateLatency + duration) / 2
+	m.latencyMutex.Lock()
+	m.updateLatency.Record(duration)
+	m.latencyMutex.Unlock()
+}
+
+// RecordDuplicate counts an update dropped because it was already applied
+func (m *SyncMetrics) RecordDuplicate() {
+	m.duplicateUpdates.Add(1)
+}
+
+// RecordBatch records a pass of the apply loop that took size queued updates together
+func (m *SyncMetrics) RecordBatch(size int) {
+	m.batches.Add(1)
+	m.batchedUpdates.Add(int64(size))
+	for {
+		largest := m.largestBatch.Load()
+		if int64(size) <= largest || m.largestBatch.CompareAndSwap(largest, int64(size)) {
+			return
+		}
 	}
 }
 
 // RecordSave records statistics for a save operation
 func (m *SyncMetrics) RecordSave(success bool, duration time.Duration) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	m.TotalSaves++
-	m.LastSaveTime = time.Now()
+	m.totalSaves.Add(1)
+	m.lastSave.Set(m.now())
 
 	if success {
-		m.SuccessfulSaves++
+		m.successfulSaves.Add(1)
 	} else {
-		m.FailedSaves++
+		m.failedSaves.Add(1)
 	}
 
-	// Update average latency
-	if m.TotalSaves == 1 {
-		m.AverageSaveLatency = duration
+	m.latencyMutex.Lock()
+	m.saveLatency.Record(duration)
+	m.latencyMutex.Unlock()
+}
+
+// UpdateLatencyPercentile returns the update latency at percentile p (0-100)
+func (m *SyncMetrics) UpdateLatencyPercentile(p float64) time.Duration {
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+	return m.updateLatency.Percentile(p)
+}
+
+// SaveLatencyPercentile returns the save latency at percentile p (0-100)
+func (m *SyncMetrics) SaveLatencyPercentile(p float64) time.Duration {
+	m.latencyMutex.Lock()
+	defer m.latencyMutex.Unlock()
+	return m.saveLatency.Percentile(p)
+}
+
+// RecordSlow counts an update or save the watchdog reported
+func (m *SyncMetrics) RecordSlow(kind string) {
+	if kind == SlowKindSave {
+		m.slowSaves.Add(1)
 	} else {
-		m.AverageSaveLatency = (m.AverageSaveLatency + duration) / 2
+		m.slowUpdates.Add(1)
 	}
 }
 
+// RecordPanic counts a panic recovered in component
+func (m *SyncMetrics) RecordPanic(component string) {
+	m.panics.Add(component, 1)
+}
+
 // RecordInitialization records initialization status
 func (m *SyncMetrics) RecordInitialization(success bool) {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
+	m.initializedAt.Set(m.now())
+	m.initialized.Store(success)
+}
 
-	m.IsInitialized = success
-	m.InitializationTime = time.Now()
+// LastSaveTime returns when a save last finished, successful or not
+func (m *SyncMetrics) LastSaveTime() time.Time {
+	return m.lastSave.Load()
 }
 
-// GetSuccessRate returns the success rate for updates
-func (m *SyncMetrics) GetSuccessRate() float64 {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+// Snapshot copies the metrics. Each counter is read atomically, but updates
+// recorded while it runs may show in some counters and not yet in others.
+func (m *SyncMetrics) Snapshot() interfaces.StateManagerMetrics {
+	m.latencyMutex.Lock()
+	updateLatency := m.updateLatency.Summary()
+	saveLatency := m.saveLatency.Summary()
+	m.latencyMutex.Unlock()
 
-	if m.TotalUpdates == 0 {
-		return 100.0
+	return interfaces.StateManagerMetrics{
+		TotalUpdates:         m.totalUpdates.Load(),
+		SuccessfulUpdates:    m.successfulUpdates.Load(),
+		FailedUpdates:        m.failedUpdates.Load(),
+		DuplicateUpdates:     m.duplicateUpdates.Load(),
+		UpdatesByType:        m.updatesByType.Snapshot(),
+		TotalSaves:           m.totalSaves.Load(),
+		SuccessfulSaves:      m.successfulSaves.Load(),
+		FailedSaves:          m.failedSaves.Load(),
+		AverageUpdateLatency: updateLatency.Mean,
+		AverageSaveLatency:   saveLatency.Mean,
+		UpdateLatency:        updateLatency,
+		SaveLatency:          saveLatency,
+		LastUpdateTime:       m.lastUpdate.Load(),
+		LastSaveTime:         m.lastSave.Load(),
+		SlowUpdates:          m.slowUpdates.Load(),
+		SlowSaves:            m.slowSaves.Load(),
+		Batches:              m.batches.Load(),
+		BatchedUpdates:       m.batchedUpdates.Load(),
+		LargestBatch:         m.largestBatch.Load(),
+		Panics:               m.panics.Snapshot(),
+		CoalescedSaves:       m.coalescedSaves.Load(),
 	}
+}
 
-	return float64(m.SuccessfulUpdates) / float64(m.TotalUpdates) * 100.0
+// GetSuccessRate returns the success rate for updates
+func (m *SyncMetrics) GetSuccessRate() float64 {
+	return successRate(m.successfulUpdates.Load(), m.totalUpdates.Load())
 }
 
 // GetSaveSuccessRate returns the success rate for saves
 func (m *SyncMetrics) GetSaveSuccessRate() float64 {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
+	return successRate(m.successfulSaves.Load(), m.totalSaves.Load())
+}
 
-	if m.TotalSaves == 0 {
+// successRate is a percentage; with nothing attempted nothing has failed.
+// successful is read before total by callers, so a concurrent record can
+// only lower the rate, never push it past 100.
+func successRate(successful, total int64) float64 {
+	if total == 0 {
 		return 100.0
 	}
-
-	return float64(m.SuccessfulSaves) / float64(m.TotalSaves) * 100.0
+	return float64(successful) / float64(total) * 100.0
 }
 
 // IsHealthy returns true if metrics indicate healthy operation
 func (m *SyncMetrics) IsHealthy() bool {
-	m.mutex.RLock()
-	defer m.mutex.RUnlock()
-
 	// Consider healthy if:
 	// - Initialized successfully
 	// - Update success rate > 90%
 	// - Save success rate > 95%
 	// - Recent activity (within last 5 minutes)
 
-	if !m.IsInitialized {
+	if !m.initialized.Load() {
 		return false
 	}
 
-	updateSuccessRate := m.GetSuccessRate()
-	saveSuccessRate := m.GetSaveSuccessRate()
-
-	if updateSuccessRate < 90.0 || saveSuccessRate < 95.0 {
+	if m.GetSuccessRate() < 90.0 || m.GetSaveSuccessRate() < 95.0 {
 		return false
 	}
 
 	// Check for recent activity
-	if time.Since(m.LastUpdateTime) > 5*time.Minute && m.TotalUpdates > 0 {
+	if m.now().Sub(m.lastUpdate.Load()) > 5*time.Minute && m.totalUpdates.Load() > 0 {
 		return false
 	}
 
@@ -0,0 +1,109 @@
+package state
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Run with -race: recorders, snapshots and health checks all touch the
+// metrics at once, as the apply loop, save pipeline and IPC readers do
+func TestSyncMetricsConcurrent(t *testing.T) {
+	m := NewSyncMetrics()
+	m.RecordInitialization(true)
+
+	const workers, perWorker = 8, 500
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(2)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < perWorker; i++ {
+				updateType := types.SessionAdded
+				if i%2 == 1 {
+					updateType = types.MessageAdded
+				}
+				m.RecordUpdate(updateType, i%10 != 0, time.Duration(i)*time.Microsecond)
+				m.RecordSave(true, time.Millisecond)
+				if i%50 == 0 {
+					m.RecordDuplicate()
+					m.RecordSlow(SlowKindSave)
+				}
+			}
+		}(w)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perWorker/10; i++ {
+				m.Snapshot()
+				if rate := m.GetSuccessRate(); rate < 0 || rate > 100 {
+					t.Errorf("GetSuccessRate() = %v", rate)
+				}
+				m.IsHealthy()
+				m.UpdateLatencyPercentile(99)
+			}
+		}()
+	}
+	wg.Wait()
+
+	snapshot := m.Snapshot()
+	total := int64(workers * perWorker)
+	if snapshot.TotalUpdates != total || snapshot.SuccessfulUpdates+snapshot.FailedUpdates != total {
+		t.Errorf("updates = %d (%d ok, %d failed), want %d", snapshot.TotalUpdates, snapshot.SuccessfulUpdates, snapshot.FailedUpdates, total)
+	}
+	if snapshot.FailedUpdates != total/10 {
+		t.Errorf("failed updates = %d, want %d", snapshot.FailedUpdates, total/10)
+	}
+	if by := snapshot.UpdatesByType; by[types.SessionAdded]+by[types.MessageAdded] != total {
+		t.Errorf("updates by type = %v, want %d in all", by, total)
+	}
+	if snapshot.DuplicateUpdates != workers*perWorker/50 || snapshot.SlowSaves != workers*perWorker/50 {
+		t.Errorf("duplicates = %d, slow saves = %d, want %d each", snapshot.DuplicateUpdates, snapshot.SlowSaves, workers*perWorker/50)
+	}
+	if snapshot.UpdateLatency.Count != total || snapshot.SaveLatency.Count != total {
+		t.Errorf("latency counts = %d, %d, want %d", snapshot.UpdateLatency.Count, snapshot.SaveLatency.Count, total)
+	}
+	if snapshot.AverageUpdateLatency != snapshot.UpdateLatency.Mean {
+		t.Errorf("average update latency %v differs from histogram mean %v", snapshot.AverageUpdateLatency, snapshot.UpdateLatency.Mean)
+	}
+	if snapshot.LastSaveTime.IsZero() || !snapshot.LastSaveTime.Equal(m.LastSaveTime()) {
+		t.Errorf("LastSaveTime = %v", snapshot.LastSaveTime)
+	}
+	// 90% of updates succeeded, exactly the threshold
+	if !m.IsHealthy() {
+		t.Errorf("IsHealthy() = false at %.1f%% success", m.GetSuccessRate())
+	}
+}
+
+func TestSyncMetricsHealth(t *testing.T) {
+	tests := []struct {
+		name        string
+		initialized bool
+		records     bool
+		failUpdates int
+		failSaves   int
+		want        bool
+	}{
+		{name: "not initialized", initialized: false, want: false},
+		{name: "idle", initialized: true, want: true},
+		{name: "healthy", initialized: true, records: true, failUpdates: 1, want: true},
+		{name: "failing updates", initialized: true, records: true, failUpdates: 5, want: false},
+		{name: "failing saves", initialized: true, records: true, failSaves: 1, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewSyncMetrics()
+			m.RecordInitialization(tt.initialized)
+			if tt.records {
+				for i := 0; i < 10; i++ {
+					m.RecordUpdate(types.ThemeChanged, i >= tt.failUpdates, time.Millisecond)
+					m.RecordSave(i >= tt.failSaves, time.Millisecond)
+				}
+			}
+			if got := m.IsHealthy(); got != tt.want {
+				t.Errorf("IsHealthy() = %v, want %v (updates %.0f%%, saves %.0f%%)", got, tt.want, m.GetSuccessRate(), m.GetSaveSuccessRate())
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/testutil"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestThreadCollapsed(t *testing.T) {
+	manager := newTestSyncManager(t)
+	apply := func(updateType types.UpdateType, payload interface{}) error {
+		return manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+	}
+
+	if err := apply(types.SessionAdded, types.SessionAddPayload{Session: testutil.Session("s1", "one")}); err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []types.MessageInfo{
+		testutil.Message("u1", "s1", "user", "fix the build"),
+		testutil.Message("a1", "s1", "assistant", "running go build"),
+		testutil.Message("a2", "s1", "assistant", "fixed"),
+	} {
+		if err := apply(types.MessageAdded, types.MessageAddPayload{Message: message}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Replies are threaded under the prompt when added
+	if got, _ := manager.GetState().GetMessageByID("a2"); got.ParentID != "u1" {
+		t.Errorf("a2 parent = %q, want u1", got.ParentID)
+	}
+	if thread, ok := manager.GetState().GetThread("a1"); !ok || thread.ID() != "u1" || len(thread.Replies) != 2 {
+		t.Errorf("GetThread(a1) = %+v, %v", thread, ok)
+	}
+
+	if err := apply(types.ThreadCollapsed, types.ThreadCollapsePayload{MessageIDs: []string{"u1"}, Collapsed: true}); err != nil {
+		t.Fatal(err)
+	}
+	// Collapsing twice keeps one entry
+	if err := apply(types.ThreadCollapsed, types.ThreadCollapsePayload{MessageIDs: []string{"u1"}, Collapsed: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetCollapsedThreads(); len(got) != 1 || !manager.GetState().IsThreadCollapsed("u1") {
+		t.Errorf("collapsed threads = %v", got)
+	}
+	if err := apply(types.ThreadCollapsed, types.ThreadCollapsePayload{MessageIDs: []string{"missing"}, Collapsed: true}); err == nil {
+		t.Error("collapsing an unknown message succeeded")
+	}
+
+	// A thread is forgotten with the message starting it
+	if err := apply(types.MessageDeleted, types.MessageDeletePayload{MessageID: "u1"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := manager.GetState().GetCollapsedThreads(); len(got) != 0 {
+		t.Errorf("collapsed threads after deleting the root = %v", got)
+	}
+}
@@ -0,0 +1,20 @@
+package state
+
+import (
+	"github.com/opencode/tmux_coder/internal/tracing"
+)
+
+// SetTracer attaches a tracer that records the resolve, apply, broadcast and
+// persist steps of each update under the update's trace; nil disables spans
+func (manager *PanelSyncManager) SetTracer(tracer *tracing.Tracer) {
+	manager.syncMutex.Lock()
+	defer manager.syncMutex.Unlock()
+	manager.tracer = tracer
+}
+
+// currentTracer returns the attached tracer, possibly nil
+func (manager *PanelSyncManager) currentTracer() *tracing.Tracer {
+	manager.syncMutex.RLock()
+	defer manager.syncMutex.RUnlock()
+	return manager.tracer
+}
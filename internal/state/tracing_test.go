@@ -0,0 +1,79 @@
+package state
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/tracing"
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+type spanRecorder struct {
+	mutex sync.Mutex
+	spans []tracing.SpanData
+}
+
+func (r *spanRecorder) Export(_ context.Context, spans []tracing.SpanData) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestUpdateSpans(t *testing.T) {
+	manager := newTestSyncManager(t)
+	exporter := &spanRecorder{}
+	tracer := tracing.NewTracer(tracing.Options{FlushInterval: time.Hour}, exporter)
+	manager.SetTracer(tracer)
+	events := make(chan types.StateEvent, 8)
+	manager.eventBus.Subscribe("conn", "panel", "messages", events)
+
+	parent := tracing.NewRoot()
+	root, _ := tracing.Parse(parent)
+	err := manager.UpdateWithVersionCheck(types.StateUpdate{
+		ID:              generateUpdateID(),
+		Type:            types.MessageAdded,
+		ExpectedVersion: manager.GetState().GetCurrentVersion(),
+		Payload:         types.MessageAddPayload{Message: types.MessageInfo{ID: "msg_1", SessionID: "ses_a", Type: "user"}},
+		SourcePanel:     "input",
+		Timestamp:       time.Now(),
+		TraceParent:     parent,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := manager.SaveStateSync(); err != nil {
+		t.Fatal(err)
+	}
+
+	event := <-events
+	if sc, err := tracing.Parse(event.TraceParent); err != nil || sc.TraceID != root.TraceID {
+		t.Errorf("event trace parent %q is not in trace %x", event.TraceParent, root.TraceID)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	tracer.Run(ctx)
+
+	byName := make(map[string]tracing.SpanData)
+	for _, span := range exporter.spans {
+		if span.Context.TraceID != root.TraceID {
+			t.Errorf("span %s is in another trace", span.Name)
+		}
+		byName[span.Name] = span
+	}
+	for _, name := range []string{"state.resolve", "state.apply", "state.broadcast", "state.persist"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("no %s span in %+v", name, exporter.spans)
+		}
+	}
+	apply := byName["state.apply"].Context.SpanID
+	if byName["state.resolve"].Parent != root.SpanID || byName["state.apply"].Parent != root.SpanID {
+		t.Errorf("resolve and apply are not children of the sender's span")
+	}
+	if byName["state.broadcast"].Parent != apply || byName["state.persist"].Parent != apply {
+		t.Errorf("broadcast and persist are not children of the apply span")
+	}
+}
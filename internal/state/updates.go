@@ -16,6 +16,7 @@ type SessionDeletePayload = types.SessionDeletePayload
 type MessageAddPayload = types.MessageAddPayload
 type MessageUpdatePayload = types.MessageUpdatePayload
 type MessageDeletePayload = types.MessageDeletePayload
+type MessageRedactPayload = types.MessageRedactPayload
 type MessagesClearPayload = types.MessagesClearPayload
 type InputUpdatePayload = types.InputUpdatePayload
 type CursorMovePayload = types.CursorMovePayload
@@ -23,21 +24,71 @@ type ThemeChangePayload = types.ThemeChangePayload
 type ModelChangePayload = types.ModelChangePayload
 type AgentChangePayload = types.AgentChangePayload
 type UIActionPayload = types.UIActionPayload
+type AnnotationAddPayload = types.AnnotationAddPayload
+type AnnotationUpdatePayload = types.AnnotationUpdatePayload
+type AnnotationRemovePayload = types.AnnotationRemovePayload
+type SessionLockPayload = types.SessionLockPayload
+type SessionUnlockPayload = types.SessionUnlockPayload
+type PromptSubmitPayload = types.PromptSubmitPayload
+type SecretFinding = types.SecretFinding
+type SecurityAlertPayload = types.SecurityAlertPayload
 
 // Re-export constants
 const (
-	SessionChanged    = types.SessionChanged
-	SessionAdded      = types.SessionAdded
-	SessionDeleted    = types.SessionDeleted
-	SessionUpdated    = types.SessionUpdated
-	MessageAdded      = types.MessageAdded
-	MessageUpdated    = types.MessageUpdated
-	MessageDeleted    = types.MessageDeleted
-	MessagesCleared   = types.MessagesCleared
-	InputUpdated      = types.InputUpdated
-	CursorMoved       = types.CursorMoved
-	ThemeChanged      = types.ThemeChanged
-	ModelChanged      = types.ModelChanged
-	AgentChanged      = types.AgentChanged
-	UIActionTriggered = types.UIActionTriggered
+	SessionChanged          = types.SessionChanged
+	SessionAdded            = types.SessionAdded
+	SessionDeleted          = types.SessionDeleted
+	SessionUpdated          = types.SessionUpdated
+	MessageAdded            = types.MessageAdded
+	MessageUpdated          = types.MessageUpdated
+	MessageDeleted          = types.MessageDeleted
+	MessageRedacted         = types.MessageRedacted
+	MessageAttributed       = types.MessageAttributed
+	MessagesCleared         = types.MessagesCleared
+	InputUpdated            = types.InputUpdated
+	CursorMoved             = types.CursorMoved
+	ThemeChanged            = types.ThemeChanged
+	ModelChanged            = types.ModelChanged
+	AgentChanged            = types.AgentChanged
+	AgentModelCleared       = types.AgentModelCleared
+	UIActionTriggered       = types.UIActionTriggered
+	AnnotationAdded         = types.AnnotationAdded
+	AnnotationUpdated       = types.AnnotationUpdated
+	AnnotationRemoved       = types.AnnotationRemoved
+	SessionLocked           = types.SessionLocked
+	SessionUnlocked         = types.SessionUnlocked
+	StateCompacted          = types.StateCompacted
+	PromptSubmitted         = types.PromptSubmitted
+	GitStatusChanged        = types.GitStatusChanged
+	FileDiffReady           = types.FileDiffReady
+	FileDiffResolved        = types.FileDiffResolved
+	FileTreeChanged         = types.FileTreeChanged
+	TerminalRunStarted      = types.TerminalRunStarted
+	TerminalRunFinished     = types.TerminalRunFinished
+	InputLocationChanged    = types.InputLocationChanged
+	PromptContextUpdated    = types.PromptContextUpdated
+	RunStarted              = types.RunStarted
+	RunFinished             = types.RunFinished
+	CancelRun               = types.CancelRun
+	RunAttempted            = types.RunAttempted
+	ModelPolicyChanged      = types.ModelPolicyChanged
+	AgentRoutesChanged      = types.AgentRoutesChanged
+	ContextUsageUpdated     = types.ContextUsageUpdated
+	ContextThreshold        = types.ContextThreshold
+	SessionCompacted        = types.SessionCompacted
+	ConnectivityChanged     = types.ConnectivityChanged
+	SessionOrderChanged     = types.SessionOrderChanged
+	SessionReordered        = types.SessionReordered
+	SessionPinned           = types.SessionPinned
+	WorkspaceChanged        = types.WorkspaceChanged
+	PromptQueued            = types.PromptQueued
+	PromptDequeued          = types.PromptDequeued
+	PromptQueueReordered    = types.PromptQueueReordered
+	PromptScheduled         = types.PromptScheduled
+	PromptUnscheduled       = types.PromptUnscheduled
+	ScheduledPromptRan      = types.ScheduledPromptRan
+	SessionTemplatesChanged = types.SessionTemplatesChanged
+	ThreadCollapsed         = types.ThreadCollapsed
+	CodeBlocksExtracted     = types.CodeBlocksExtracted
+	CodeBlockHandled        = types.CodeBlockHandled
 )
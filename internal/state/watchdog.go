@@ -0,0 +1,135 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Default watchdog thresholds: an update holds the state lock every panel
+// waits on, so a quarter second is already visible as input lag
+const (
+	DefaultSlowUpdate = 250 * time.Millisecond
+	DefaultSlowSave   = 2 * time.Second
+)
+
+// Kinds of operation the watchdog reports
+const (
+	SlowKindUpdate = "update"
+	SlowKindSave   = "save"
+)
+
+// Goroutine dumps stop everything while they are taken, so a burst of slow
+// operations gets one dump per interval; every one is still reported
+const (
+	slowDumpInterval = time.Minute
+	maxSlowDumpSize  = 8 << 20
+)
+
+// SlowOperation is the report logged when an update or save outlives its threshold
+type SlowOperation struct {
+	Kind        string           `json:"kind"`
+	UpdateType  types.UpdateType `json:"update_type,omitempty"`
+	UpdateID    string           `json:"update_id,omitempty"`
+	SourcePanel string           `json:"source_panel,omitempty"`
+	Threshold   time.Duration    `json:"threshold"`
+	StartedAt   time.Time        `json:"started_at"`
+	Goroutines  int              `json:"goroutines"`
+	DumpPath    string           `json:"dump_path,omitempty"`
+}
+
+// slowWatchdog rate-limits goroutine dumps across reports
+type slowWatchdog struct {
+	mutex    sync.Mutex
+	lastDump time.Time
+}
+
+// watchSlow starts timing an operation and returns the function that ends it.
+// If the operation is still running at the threshold it is reported while it
+// runs, so the dump shows where it is stuck.
+func (manager *PanelSyncManager) watchSlow(op SlowOperation, threshold time.Duration) func() {
+	if threshold <= 0 {
+		return func() {}
+	}
+	op.Threshold = threshold
+	op.StartedAt = time.Now()
+	timer := time.AfterFunc(threshold, func() {
+		manager.reportSlow(op)
+	})
+	return func() {
+		if !timer.Stop() {
+			log.Printf("[WATCHDOG] Slow %s %s finished after %v", op.Kind, op.UpdateType, time.Since(op.StartedAt).Round(time.Millisecond))
+		}
+	}
+}
+
+// reportSlow counts a slow operation, captures a goroutine dump unless one was
+// taken recently and logs the report as one JSON line
+func (manager *PanelSyncManager) reportSlow(op SlowOperation) {
+	manager.metrics.RecordSlow(op.Kind)
+	op.Goroutines = runtime.NumGoroutine()
+
+	var dump []byte
+	manager.watchdog.mutex.Lock()
+	if time.Since(manager.watchdog.lastDump) >= slowDumpInterval {
+		manager.watchdog.lastDump = time.Now()
+		dump = goroutineDump()
+	}
+	manager.watchdog.mutex.Unlock()
+
+	dumpDir := manager.GetConfig().WatchdogDumpDir
+	if dump != nil && dumpDir != "" {
+		path, err := writeSlowDump(dumpDir, op, dump)
+		if err != nil {
+			log.Printf("[WATCHDOG] Failed to write goroutine dump: %v", err)
+		} else {
+			op.DumpPath = path
+			dump = nil
+		}
+	}
+
+	report, err := json.Marshal(op)
+	if err != nil {
+		log.Printf("[WATCHDOG] Failed to encode report: %v", err)
+		return
+	}
+	log.Printf("[WATCHDOG] Slow %s: %s", op.Kind, report)
+	if dump != nil {
+		log.Printf("[WATCHDOG] Goroutines during slow %s:\n%s", op.Kind, dump)
+	}
+}
+
+// goroutineDump returns the stacks of all goroutines, growing the buffer
+// until they fit or the size cap is reached
+func goroutineDump() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= maxSlowDumpSize {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// writeSlowDump stores a dump under dir, named after the operation and its start
+func writeSlowDump(dir string, op SlowOperation, dump []byte) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("slow-%s-%s.txt", op.Kind, op.StartedAt.UTC().Format("20060102T150405.000000000"))
+	path := filepath.Join(dir, name)
+	header := fmt.Sprintf("slow %s %s %s from %s, over %v since %s\n\n",
+		op.Kind, op.UpdateType, op.UpdateID, op.SourcePanel, op.Threshold, op.StartedAt.Format(time.RFC3339Nano))
+	if err := os.WriteFile(path, append([]byte(header), dump...), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,65 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestWatchdogReportsSlowOperations(t *testing.T) {
+	manager := newTestSyncManager(t)
+	dir := t.TempDir()
+	config := manager.GetConfig()
+	config.WatchdogDumpDir = dir
+	if err := manager.SetConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	// Fast operations are not reported
+	manager.watchSlow(SlowOperation{Kind: SlowKindUpdate}, time.Hour)()
+	manager.watchSlow(SlowOperation{Kind: SlowKindUpdate}, 0)()
+	if m := manager.GetMetrics(); m.SlowUpdates != 0 {
+		t.Fatalf("fast update reported as slow")
+	}
+
+	// Slow ones are reported while still running, the first with a dump
+	for i := 0; i < 2; i++ {
+		done := manager.watchSlow(SlowOperation{Kind: SlowKindUpdate, UpdateType: types.MessageAdded, UpdateID: "update_1"}, time.Millisecond)
+		deadline := time.Now().Add(5 * time.Second)
+		for manager.GetMetrics().SlowUpdates <= int64(i) && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		done()
+	}
+	done := manager.watchSlow(SlowOperation{Kind: SlowKindSave}, time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	done()
+
+	m := manager.GetMetrics()
+	if m.SlowUpdates != 2 || m.SlowSaves != 1 {
+		t.Errorf("slow updates %d, saves %d, want 2 and 1", m.SlowUpdates, m.SlowSaves)
+	}
+	dumps, _ := filepath.Glob(filepath.Join(dir, "slow-*.txt"))
+	if len(dumps) != 1 {
+		t.Fatalf("dumps = %v, want one per interval", dumps)
+	}
+	data, err := os.ReadFile(dumps[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "slow update message_added update_1") || !strings.Contains(string(data), "goroutine ") {
+		t.Errorf("dump lacks the operation or the stacks:\n%.300s", data)
+	}
+}
+
+func TestWatchdogThresholdsValidate(t *testing.T) {
+	config := DefaultSyncManagerConfig()
+	config.SlowUpdate = -time.Second
+	if err := config.Validate(); err == nil {
+		t.Errorf("negative slow_update accepted")
+	}
+}
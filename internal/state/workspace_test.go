@@ -0,0 +1,62 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestSessionsRecordWorkspace(t *testing.T) {
+	manager := newTestSyncManager(t)
+	events := make(chan types.StateEvent, 16)
+	manager.eventBus.Subscribe("conn", "panel", "sessions", events)
+	apply := func(updateType types.UpdateType, payload interface{}) {
+		t.Helper()
+		err := manager.UpdateWithVersionCheck(types.StateUpdate{
+			ID:              generateUpdateID(),
+			Type:            updateType,
+			ExpectedVersion: manager.GetState().GetCurrentVersion(),
+			Payload:         payload,
+			SourcePanel:     "test",
+			Timestamp:       time.Now(),
+		})
+		if err != nil {
+			t.Fatalf("%s error = %v", updateType, err)
+		}
+	}
+
+	// Sessions from before a workspace is known keep none
+	apply(types.SessionAdded, types.SessionAddPayload{Session: types.SessionInfo{ID: "old"}})
+	apply(types.WorkspaceChanged, types.WorkspacePayload{Workspace: "/src/app"})
+	apply(types.GitStatusChanged, types.GitStatusPayload{Git: &types.GitState{Root: "/src/app", Branch: "main"}})
+	apply(types.SessionAdded, types.SessionAddPayload{Session: types.SessionInfo{ID: "new"}})
+	// A session that already knows where it came from keeps it
+	apply(types.SessionAdded, types.SessionAddPayload{Session: types.SessionInfo{ID: "lib", Workspace: "/src/lib", Branch: "dev"}})
+
+	st := manager.GetState()
+	want := map[string][2]string{"old": {"", ""}, "new": {"/src/app", "main"}, "lib": {"/src/lib", "dev"}}
+	for _, session := range st.Sessions {
+		if got := [2]string{session.Workspace, session.Branch}; got != want[session.ID] {
+			t.Errorf("session %s workspace, branch = %v, want %v", session.ID, got, want[session.ID])
+		}
+	}
+	if got := sessionOrderIDs(st.GetWorkspaceSessions("/src/app")); got != "old,new" {
+		t.Errorf("GetWorkspaceSessions() = %s, want old,new", got)
+	}
+
+	// Panels learn the stamped workspace from the event
+	for len(events) > 0 {
+		event := <-events
+		if event.Type != types.EventSessionAdded {
+			continue
+		}
+		var payload types.SessionAddPayload
+		if err := decodePayload(event.Data, &payload); err != nil {
+			t.Fatal(err)
+		}
+		if payload.Session.ID == "new" && payload.Session.Workspace != "/src/app" {
+			t.Errorf("session added event carries workspace %q, want /src/app", payload.Session.Workspace)
+		}
+	}
+}
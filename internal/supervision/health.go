@@ -16,6 +16,7 @@ const (
 	PaneDead                      // Process has exited (pane_dead=1)
 	PaneZombie                    // Process PID is invalid or zombie
 	PaneMissing                   // Pane does not exist in session
+	PaneFailing                   // Process is running but its health check command fails
 )
 
 // String returns a human-readable representation of the health status
@@ -29,6 +30,8 @@ func (h PaneHealth) String() string {
 		return "Zombie"
 	case PaneMissing:
 		return "Missing"
+	case PaneFailing:
+		return "Failing"
 	default:
 		return "Unknown"
 	}
@@ -123,6 +126,22 @@ func (hc *PaneHealthChecker) CheckPaneHealth(paneTarget string) PaneHealth {
 	return PaneHealthy
 }
 
+// ExitStatus returns the exit status of a dead pane's process, or -1 when the
+// pane is not dead or tmux does not know it
+func (hc *PaneHealthChecker) ExitStatus(paneTarget string) int {
+	cmd := exec.Command(hc.tmuxCommand, "display-message", "-p", "-t", paneTarget, "#{pane_dead}:#{pane_dead_status}")
+	output, err := cmd.Output()
+	if err != nil {
+		return -1
+	}
+	dead, status, _ := strings.Cut(strings.TrimSpace(string(output)), ":")
+	code, err := strconv.Atoi(status)
+	if dead != "1" || err != nil {
+		return -1
+	}
+	return code
+}
+
 // CheckAllPanesHealth checks the health status of multiple panes
 //
 // Returns a map of pane target -> health status
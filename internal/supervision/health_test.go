@@ -28,6 +28,11 @@ func TestPaneHealthString(t *testing.T) {
 			health:   PaneMissing,
 			expected: "Missing",
 		},
+		{
+			name:     "Failing pane",
+			health:   PaneFailing,
+			expected: "Failing",
+		},
 		{
 			name:     "Unknown status",
 			health:   PaneHealth(99),
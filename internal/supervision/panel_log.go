@@ -0,0 +1,137 @@
+package supervision
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Defaults for a PanelLog's limits
+const (
+	DefaultPanelLogMaxSize = 1 << 20
+	DefaultPanelLogBackups = 3
+)
+
+// PanelLog is the file a panel process's stderr is appended to. The process
+// keeps the file open for as long as it runs, so rotation copies the file
+// aside and truncates it in place rather than renaming it; output written
+// between the copy and the truncate is lost.
+type PanelLog struct {
+	Path    string
+	MaxSize int64 // Rotate once the file grows past this; 0 never rotates
+	Backups int   // Rotated copies kept, Path.1 being the newest
+}
+
+// NewPanelLog returns the log at path, using the defaults for limits left zero
+func NewPanelLog(path string, maxSize int64, backups int) *PanelLog {
+	if maxSize == 0 {
+		maxSize = DefaultPanelLogMaxSize
+	}
+	if backups <= 0 {
+		backups = DefaultPanelLogBackups
+	}
+	return &PanelLog{Path: path, MaxSize: maxSize, Backups: backups}
+}
+
+// Mark appends a line set apart from the panel's own output, such as the
+// start of a new process
+func (l *PanelLog) Mark(at time.Time, format string, args ...interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(l.Path), 0700); err != nil {
+		return fmt.Errorf("failed to create panel log directory: %w", err)
+	}
+	file, err := os.OpenFile(l.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open panel log %s: %w", l.Path, err)
+	}
+	defer file.Close()
+	_, err = fmt.Fprintf(file, "=== %s %s ===\n", at.Format(time.RFC3339), fmt.Sprintf(format, args...))
+	return err
+}
+
+// RotateIfNeeded rotates the log once it is larger than MaxSize and reports
+// whether it did
+func (l *PanelLog) RotateIfNeeded() (bool, error) {
+	if l.MaxSize <= 0 {
+		return false, nil
+	}
+	info, err := os.Stat(l.Path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if info.Size() <= l.MaxSize {
+		return false, nil
+	}
+	return true, l.Rotate()
+}
+
+// Rotate shifts the backups along, copies the log to Path.1 and truncates it
+func (l *PanelLog) Rotate() error {
+	backups := l.Backups
+	if backups <= 0 {
+		backups = 1
+	}
+	os.Remove(l.backupPath(backups))
+	for generation := backups - 1; generation >= 1; generation-- {
+		if err := os.Rename(l.backupPath(generation), l.backupPath(generation+1)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to shift panel log backup: %w", err)
+		}
+	}
+
+	src, err := os.Open(l.Path)
+	if err != nil {
+		return fmt.Errorf("failed to open panel log %s: %w", l.Path, err)
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(l.backupPath(1), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create panel log backup: %w", err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to copy panel log %s: %w", l.Path, err)
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	// The panel writes with O_APPEND, so its next write lands at the new end
+	if err := os.Truncate(l.Path, 0); err != nil {
+		return fmt.Errorf("failed to truncate panel log %s: %w", l.Path, err)
+	}
+	return nil
+}
+
+func (l *PanelLog) backupPath(generation int) string {
+	return fmt.Sprintf("%s.%d", l.Path, generation)
+}
+
+// TailLines returns up to the last n lines of the file at path
+func TailLines(path string, n int) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+		if n > 0 && len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	return lines, nil
+}
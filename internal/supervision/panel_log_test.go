@@ -0,0 +1,111 @@
+package supervision
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanelLogRotateKeepsWriterAppending(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "panels", "sessions.log")
+	log := NewPanelLog(path, 10, 2)
+	if err := log.Mark(time.Unix(0, 0).UTC(), "started %s", "sessions-pane"); err != nil {
+		t.Fatalf("Mark() error = %v", err)
+	}
+
+	// Stands in for the panel process, which holds the file open across rotations
+	writer, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	for i, text := range []string{"first\n", "second\n", "third\n"} {
+		writer.WriteString(text)
+		rotated, err := log.RotateIfNeeded()
+		if err != nil {
+			t.Fatalf("RotateIfNeeded() error = %v", err)
+		}
+		// "second" alone is under MaxSize, so it is rotated out with "third"
+		if want := i != 1; rotated != want {
+			t.Fatalf("write %d: RotateIfNeeded() = %v, want %v", i, rotated, want)
+		}
+	}
+	writer.WriteString("fourth\n")
+
+	read := func(p string) string {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return ""
+		}
+		return string(data)
+	}
+	if got := read(path); got != "fourth\n" {
+		t.Errorf("log = %q, want only what was written after the last rotation", got)
+	}
+	if got := read(path + ".1"); got != "second\nthird\n" {
+		t.Errorf("backup 1 = %q, want %q", got, "second\nthird\n")
+	}
+	if got := read(path + ".2"); !strings.HasSuffix(got, "started sessions-pane ===\nfirst\n") {
+		t.Errorf("backup 2 = %q, want the start mark and the first line", got)
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("backup 3 exists beyond the 2 kept")
+	}
+}
+
+func TestPanelLogRotateIfNeeded(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		maxSize int64
+		want    bool
+	}{
+		{name: "missing file", maxSize: 10, want: false},
+		{name: "under the limit", content: "short", maxSize: 10, want: false},
+		{name: "over the limit", content: strings.Repeat("x", 11), maxSize: 10, want: true},
+		{name: "rotation disabled", content: strings.Repeat("x", 11), maxSize: -1, want: false},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, string(rune('a'+i))+".log")
+			if tt.content != "" {
+				os.WriteFile(path, []byte(tt.content), 0600)
+			}
+			got, err := NewPanelLog(path, tt.maxSize, 1).RotateIfNeeded()
+			if err != nil {
+				t.Fatalf("RotateIfNeeded() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("RotateIfNeeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTailLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "panel.log")
+	os.WriteFile(path, []byte("one\ntwo\nthree\nfour\n"), 0600)
+
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{n: 2, want: []string{"three", "four"}},
+		{n: 10, want: []string{"one", "two", "three", "four"}},
+		{n: 0, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := TailLines(path, tt.n)
+		if err != nil {
+			t.Fatalf("TailLines(%d) error = %v", tt.n, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("TailLines(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package supervision
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RestartPolicy says when the supervisor restarts a pane's process
+type RestartPolicy string
+
+const (
+	RestartAlways    RestartPolicy = "always"     // Restart whenever the process is gone or unhealthy
+	RestartOnFailure RestartPolicy = "on-failure" // Leave a process that exited with status 0 alone
+	RestartNever     RestartPolicy = "never"      // Run once, as for a setup script
+)
+
+// DefaultStartupTimeout is how long a pane's process has to come up
+const DefaultStartupTimeout = 3 * time.Second
+
+// ParseRestartPolicy parses a restart policy, "always" when empty
+func ParseRestartPolicy(value string) (RestartPolicy, error) {
+	switch policy := RestartPolicy(strings.ToLower(strings.TrimSpace(value))); policy {
+	case "":
+		return RestartAlways, nil
+	case RestartAlways, RestartOnFailure, RestartNever:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown restart policy %q (want always, on-failure or never)", value)
+	}
+}
+
+// PanePolicy is how the supervisor looks after one pane. The zero value
+// restarts always, with the default startup timeout and no health check.
+type PanePolicy struct {
+	Restart        RestartPolicy
+	StartupTimeout time.Duration // Time the process has to come up, and before the health check first runs
+	HealthCheck    string        // Shell command run each check while the pane is up; failing marks it unhealthy
+}
+
+// Startup returns the startup timeout, the default when none is set
+func (p PanePolicy) Startup() time.Duration {
+	if p.StartupTimeout > 0 {
+		return p.StartupTimeout
+	}
+	return DefaultStartupTimeout
+}
+
+// KeepsExitedPane reports whether a pane whose process exits should stay
+// open, so its exit status and output can be read
+func (p PanePolicy) KeepsExitedPane() bool {
+	return p.Restart == RestartOnFailure || p.Restart == RestartNever
+}
+
+// ShouldRestart reports whether a pane in the given health is restarted. For
+// a dead pane exitStatus is its process's exit status, or -1 when unknown.
+func (p PanePolicy) ShouldRestart(health PaneHealth, exitStatus int) bool {
+	switch p.Restart {
+	case RestartNever:
+		return false
+	case RestartOnFailure:
+		return health != PaneDead || exitStatus != 0
+	default:
+		return true
+	}
+}
+
+// RunHealthCheck runs a health check command with env added to the
+// orchestrator's environment, failing when it exits non-zero or outlasts timeout
+func RunHealthCheck(ctx context.Context, command string, env map[string]string, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.WaitDelay = time.Second // Children of the shell may hold its output open
+	cmd.Env = os.Environ()
+	for key, value := range env {
+		if value != "" {
+			cmd.Env = append(cmd.Env, key+"="+value)
+		}
+	}
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("health check timed out after %v", timeout)
+	}
+	if err != nil {
+		if detail := strings.TrimSpace(string(output)); detail != "" {
+			return fmt.Errorf("health check failed: %w: %s", err, detail)
+		}
+		return fmt.Errorf("health check failed: %w", err)
+	}
+	return nil
+}
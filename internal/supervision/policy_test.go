@@ -0,0 +1,57 @@
+package supervision
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanePolicyShouldRestart(t *testing.T) {
+	tests := []struct {
+		restart    RestartPolicy
+		health     PaneHealth
+		exitStatus int
+		want       bool
+	}{
+		{"", PaneDead, 0, true},
+		{RestartAlways, PaneDead, 0, true},
+		{RestartOnFailure, PaneDead, 0, false},
+		{RestartOnFailure, PaneDead, 1, true},
+		{RestartOnFailure, PaneDead, -1, true},
+		{RestartOnFailure, PaneFailing, -1, true},
+		{RestartNever, PaneDead, 1, false},
+		{RestartNever, PaneFailing, -1, false},
+	}
+	for _, tt := range tests {
+		policy := PanePolicy{Restart: tt.restart}
+		if got := policy.ShouldRestart(tt.health, tt.exitStatus); got != tt.want {
+			t.Errorf("%q.ShouldRestart(%s, %d) = %v, want %v", tt.restart, tt.health, tt.exitStatus, got, tt.want)
+		}
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	for value, want := range map[string]RestartPolicy{"": RestartAlways, "On-Failure": RestartOnFailure, " never ": RestartNever} {
+		if got, err := ParseRestartPolicy(value); err != nil || got != want {
+			t.Errorf("ParseRestartPolicy(%q) = %q, %v; want %q", value, got, err, want)
+		}
+	}
+	if _, err := ParseRestartPolicy("sometimes"); err == nil {
+		t.Error("ParseRestartPolicy() accepted an unknown policy")
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	ctx := context.Background()
+	env := map[string]string{"PANEL_READY": "yes"}
+	if err := RunHealthCheck(ctx, `test "$PANEL_READY" = yes`, env, time.Second); err != nil {
+		t.Errorf("passing check error = %v", err)
+	}
+	if err := RunHealthCheck(ctx, "echo not ready; exit 3", env, time.Second); err == nil || !strings.Contains(err.Error(), "not ready") {
+		t.Errorf("failing check error = %v, want its output", err)
+	}
+	if err := RunHealthCheck(ctx, "sleep 5", env, 50*time.Millisecond); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("slow check error = %v, want a timeout", err)
+	}
+}
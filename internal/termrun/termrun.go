@@ -0,0 +1,247 @@
+// Package termrun runs shell commands in their own tmux pane and captures
+// what the pane prints with pipe-pane, so a command can be watched live and
+// its output and exit status recorded.
+package termrun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/shellquote"
+)
+
+// DefaultPollInterval is how often a run's capture file is read
+const DefaultPollInterval = 250 * time.Millisecond
+
+// exitGrace lets pipe-pane flush the last output after the command exits
+const exitGrace = 100 * time.Millisecond
+
+// Spec describes a command to run
+type Spec struct {
+	ID      string // Names the capture files and the tmux wait channel
+	Command string // Run with sh -c
+	Dir     string // Working directory; the pane's default when empty
+	Target  string // Pane to split
+	Size    string // Size of the new pane, e.g. "30%"
+}
+
+// Runner starts commands in tmux panes, keeping capture files in dir
+type Runner struct {
+	tmux string
+	dir  string
+}
+
+// NewRunner returns a runner using the given tmux binary
+func NewRunner(tmuxCommand, dir string) *Runner {
+	return &Runner{tmux: tmuxCommand, dir: dir}
+}
+
+// Run is a started command
+type Run struct {
+	ID       string
+	PaneID   string
+	runner   *Runner
+	outPath  string
+	exitPath string
+	offset   int64
+}
+
+// Start opens a pane for the command. The pane waits on a tmux channel until
+// its output is piped to the capture file, so nothing printed is missed, and
+// stays open after the command exits so the output can still be read.
+func (r *Runner) Start(ctx context.Context, spec Spec) (*Run, error) {
+	if strings.TrimSpace(spec.Command) == "" {
+		return nil, fmt.Errorf("command cannot be empty")
+	}
+	if spec.ID == "" || strings.ContainsAny(spec.ID, "/\\ ") {
+		return nil, fmt.Errorf("invalid run id %q", spec.ID)
+	}
+	if err := os.MkdirAll(r.dir, 0o700); err != nil {
+		return nil, fmt.Errorf("create run directory: %w", err)
+	}
+
+	run := &Run{
+		ID:       spec.ID,
+		runner:   r,
+		outPath:  filepath.Join(r.dir, spec.ID+".out"),
+		exitPath: filepath.Join(r.dir, spec.ID+".exit"),
+	}
+	if err := os.WriteFile(run.outPath, nil, 0o600); err != nil {
+		return nil, fmt.Errorf("create capture file: %w", err)
+	}
+	os.Remove(run.exitPath)
+
+	channel := "tmuxcoder-run-" + spec.ID
+	script := fmt.Sprintf("%s wait-for %s; sh -c %s; printf %%s $? > %s",
+		shellquote.Quote(r.tmux), shellquote.Quote(channel), shellquote.Quote(spec.Command), shellquote.Quote(run.exitPath))
+	// tmux runs the pane command with the user's default-shell, which may not
+	// be POSIX (fish has no $?); a single quoted word reads the same in all of them
+	script = "sh -c " + shellquote.Quote(script)
+
+	args := []string{"split-window", "-d", "-P", "-F", "#{pane_id}"}
+	if spec.Target != "" {
+		args = append(args, "-t", spec.Target)
+	}
+	if spec.Size != "" {
+		args = append(args, "-l", spec.Size)
+	}
+	if spec.Dir != "" {
+		args = append(args, "-c", spec.Dir)
+	}
+	out, err := r.tmuxOutput(ctx, append(args, script)...)
+	if err != nil {
+		run.cleanup()
+		return nil, fmt.Errorf("open run pane: %w", err)
+	}
+	run.PaneID = strings.TrimSpace(string(out))
+
+	steps := [][]string{
+		{"set-option", "-p", "-t", run.PaneID, "remain-on-exit", "on"},
+		{"pipe-pane", "-O", "-t", run.PaneID, "cat >> " + shellquote.Quote(run.outPath)},
+		{"wait-for", "-S", channel},
+	}
+	for _, step := range steps {
+		if _, err := r.tmuxOutput(ctx, step...); err != nil {
+			r.tmuxOutput(context.Background(), "kill-pane", "-t", run.PaneID)
+			run.cleanup()
+			return nil, fmt.Errorf("tmux %s: %w", step[0], err)
+		}
+	}
+	return run, nil
+}
+
+// Wait reads the run's output as it is captured, passing each new chunk to
+// onOutput, until the command exits, and returns its exit code. The capture
+// files are removed when it returns.
+func (run *Run) Wait(ctx context.Context, interval time.Duration, onOutput func(string)) (int, error) {
+	defer run.cleanup()
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return -1, ctx.Err()
+		case <-ticker.C:
+		}
+
+		code, exited, err := run.exitCode()
+		if err != nil {
+			return -1, err
+		}
+		if exited {
+			time.Sleep(exitGrace)
+		}
+		chunk, err := run.read()
+		if err != nil {
+			return -1, err
+		}
+		if chunk != "" && onOutput != nil {
+			onOutput(chunk)
+		}
+		if exited {
+			return code, nil
+		}
+		if !run.paneAlive(ctx) {
+			return -1, fmt.Errorf("run pane %s closed before the command exited", run.PaneID)
+		}
+	}
+}
+
+// Kill closes the run's pane, ending the command
+func (run *Run) Kill() error {
+	_, err := run.runner.tmuxOutput(context.Background(), "kill-pane", "-t", run.PaneID)
+	return err
+}
+
+// read returns the output captured since the last read
+func (run *Run) read() (string, error) {
+	file, err := os.Open(run.outPath)
+	if err != nil {
+		return "", fmt.Errorf("open capture file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Seek(run.offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return "", err
+	}
+	run.offset += int64(len(data))
+	return string(data), nil
+}
+
+// exitCode reports the command's exit code once it has been written
+func (run *Run) exitCode() (int, bool, error) {
+	data, err := os.ReadFile(run.exitPath)
+	if errors.Is(err, os.ErrNotExist) || (err == nil && len(data) == 0) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid exit status %q", data)
+	}
+	return code, true, nil
+}
+
+// paneAlive reports whether the pane still exists; a pane closed by hand
+// never writes an exit status
+func (run *Run) paneAlive(ctx context.Context) bool {
+	out, err := run.runner.tmuxOutput(ctx, "display-message", "-p", "-t", run.PaneID, "#{pane_id}")
+	return err == nil && strings.TrimSpace(string(out)) == run.PaneID
+}
+
+func (run *Run) cleanup() {
+	os.Remove(run.outPath)
+	os.Remove(run.exitPath)
+}
+
+func (r *Runner) tmuxOutput(ctx context.Context, args ...string) ([]byte, error) {
+	cmdCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	out, err := exec.CommandContext(cmdCtx, r.tmux, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return out, fmt.Errorf("%w: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return out, err
+	}
+	return out, nil
+}
+
+// escapeSequence matches terminal control sequences: CSI, OSC and
+// two-character escapes
+var escapeSequence = regexp.MustCompile(`\x1b(\[[0-9;?]*[ -/]*[@-~]|\][^\x07\x1b]*(\x07|\x1b\\)|[@-Z\\-_])`)
+
+// Clean turns captured pane output into plain text: escape sequences are
+// dropped and carriage returns resolved the way a terminal would show them,
+// so progress bars keep only their last state
+func Clean(output string) string {
+	output = escapeSequence.ReplaceAllString(output, "")
+	output = strings.ReplaceAll(output, "\r\n", "\n")
+	lines := strings.Split(output, "\n")
+	for i, line := range lines {
+		if cut := strings.LastIndexByte(line, '\r'); cut >= 0 {
+			line = line[cut+1:]
+		}
+		lines[i] = line
+	}
+	return strings.Join(lines, "\n")
+}
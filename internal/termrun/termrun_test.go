@@ -0,0 +1,102 @@
+package termrun
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestClean(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"plain", "a\nb\n", "a\nb\n"},
+		{"crlf", "a\r\nb\r\n", "a\nb\n"},
+		{"colors", "\x1b[1;31merror\x1b[0m: x", "error: x"},
+		{"title", "\x1b]0;title\x07done", "done"},
+		{"progress", "10%\r50%\r100%\nok", "100%\nok"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Clean(tc.in); got != tc.want {
+				t.Errorf("Clean(%q) = %q, want %q", tc.in, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := exec.LookPath("tmux"); err != nil {
+		t.Skip("tmux not installed")
+	}
+	// A private tmux server, so the test never touches the user's sessions
+	t.Setenv("TMUX_TMPDIR", t.TempDir())
+	t.Setenv("TMUX", "")
+	if out, err := exec.Command("tmux", "new-session", "-d", "-s", "termrun-test", "-x", "120", "-y", "40").CombinedOutput(); err != nil {
+		t.Skipf("cannot start tmux: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("tmux", "kill-server").Run() })
+
+	runner := NewRunner("tmux", t.TempDir())
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+
+	for _, tc := range []struct {
+		id, command, output string
+		code                int
+	}{
+		{"ok", "echo first; echo \"it's\"", "first\nit's", 0},
+		{"fail", "echo nope >&2; exit 3", "nope", 3},
+	} {
+		run, err := runner.Start(ctx, Spec{ID: tc.id, Command: tc.command, Target: "termrun-test", Dir: os.TempDir()})
+		if err != nil {
+			t.Fatalf("Start(%s) error = %v", tc.id, err)
+		}
+		var output strings.Builder
+		code, err := run.Wait(ctx, 20*time.Millisecond, func(chunk string) { output.WriteString(chunk) })
+		if err != nil {
+			t.Fatalf("Wait(%s) error = %v", tc.id, err)
+		}
+		if code != tc.code {
+			t.Errorf("%s exit code = %d, want %d", tc.id, code, tc.code)
+		}
+		if got := strings.TrimSpace(Clean(output.String())); got != tc.output {
+			t.Errorf("%s output = %q, want %q", tc.id, got, tc.output)
+		}
+		if !run.paneAlive(ctx) {
+			t.Errorf("%s pane closed when the command exited", tc.id)
+		}
+		run.Kill()
+		if _, err := os.Stat(run.outPath); !os.IsNotExist(err) {
+			t.Errorf("%s capture file left behind", tc.id)
+		}
+	}
+
+	// A default-shell that is not POSIX, like fish, must only be asked to start sh
+	fakeShell := filepath.Join(t.TempDir(), "notposix")
+	script := "#!/bin/sh\ncase \"$2\" in \"sh -c '\"*) eval \"exec $2\" ;; *) exit 127 ;; esac\n"
+	if err := os.WriteFile(fakeShell, []byte(script), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if out, err := exec.Command("tmux", "set-option", "-g", "default-shell", fakeShell).CombinedOutput(); err != nil {
+		t.Fatalf("set default-shell: %v: %s", err, out)
+	}
+	run, err := runner.Start(ctx, Spec{ID: "fish", Command: "echo fine; exit 4", Target: "termrun-test"})
+	if err != nil {
+		t.Fatalf("Start(fish) error = %v", err)
+	}
+	if code, err := run.Wait(ctx, 20*time.Millisecond, nil); err != nil || code != 4 {
+		t.Errorf("Wait(fish) = %d, %v; want 4", code, err)
+	}
+	run.Kill()
+
+	if _, err := runner.Start(ctx, Spec{ID: "empty", Command: "  "}); err == nil {
+		t.Errorf("Start() accepted an empty command")
+	}
+}
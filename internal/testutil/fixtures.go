@@ -0,0 +1,161 @@
+// Package testutil builds states, sessions, messages and update sequences
+// for tests, compares results against golden files, and checks that a test
+// leaves no goroutines or open files behind.
+//
+// Fixtures use a fixed clock starting at Epoch, so a state built twice is the
+// same state and can be compared byte for byte.
+package testutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Epoch is the time fixture clocks start from
+var Epoch = time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC)
+
+// At returns the fixture time n seconds after Epoch
+func At(n int) time.Time {
+	return Epoch.Add(time.Duration(n) * time.Second)
+}
+
+// Session returns an active session created at Epoch
+func Session(id, title string) types.SessionInfo {
+	return types.SessionInfo{
+		ID:        id,
+		Title:     title,
+		CreatedAt: Epoch,
+		UpdatedAt: Epoch,
+		IsActive:  true,
+	}
+}
+
+// Message returns a completed message sent at Epoch; typ is "user",
+// "assistant" or "system"
+func Message(id, sessionID, typ, content string) types.MessageInfo {
+	return types.MessageInfo{
+		ID:        id,
+		SessionID: sessionID,
+		Type:      typ,
+		Content:   content,
+		Timestamp: Epoch,
+		Status:    "completed",
+	}
+}
+
+// StateBuilder assembles a SharedApplicationState. Each session and message
+// added advances its clock a second, so they keep the order they were added in.
+type StateBuilder struct {
+	state *types.SharedApplicationState
+	clock int
+}
+
+// NewState starts an empty state at version 1
+func NewState() *StateBuilder {
+	state := types.NewSharedApplicationState()
+	state.Version.Timestamp = Epoch
+	state.LastUpdate = Epoch
+	return &StateBuilder{state: state}
+}
+
+func (b *StateBuilder) tick() time.Time {
+	b.clock++
+	return At(b.clock)
+}
+
+// Version sets the state version
+func (b *StateBuilder) Version(version int64) *StateBuilder {
+	b.state.Version.Version = version
+	return b
+}
+
+// Session adds a session; the first one added becomes current
+func (b *StateBuilder) Session(id, title string) *StateBuilder {
+	session := Session(id, title)
+	session.CreatedAt = b.tick()
+	session.UpdatedAt = session.CreatedAt
+	b.state.Sessions = append(b.state.Sessions, session)
+	if b.state.CurrentSessionID == "" {
+		b.state.CurrentSessionID = id
+	}
+	return b
+}
+
+// Sessions adds n sessions named s1, s2, ...
+func (b *StateBuilder) Sessions(n int) *StateBuilder {
+	for i := 1; i <= n; i++ {
+		b.Session(fmt.Sprintf("s%d", i), fmt.Sprintf("Session %d", i))
+	}
+	return b
+}
+
+// Current selects the current session
+func (b *StateBuilder) Current(sessionID string) *StateBuilder {
+	b.state.CurrentSessionID = sessionID
+	return b
+}
+
+// Message adds a message and counts it against its session. A message still
+// at Epoch, as Message returns it, is stamped with the builder's clock.
+func (b *StateBuilder) Message(message types.MessageInfo) *StateBuilder {
+	if message.Timestamp.IsZero() || message.Timestamp.Equal(Epoch) {
+		message.Timestamp = b.tick()
+	}
+	b.state.Messages = append(b.state.Messages, message)
+	for i := range b.state.Sessions {
+		if b.state.Sessions[i].ID == message.SessionID {
+			b.state.Sessions[i].MessageCount++
+			b.state.Sessions[i].UpdatedAt = message.Timestamp
+		}
+	}
+	return b
+}
+
+// Conversation adds messages to a session alternating user and assistant,
+// starting with the user; they are named <session>-m1, <session>-m2, ...
+func (b *StateBuilder) Conversation(sessionID string, turns ...string) *StateBuilder {
+	for i, content := range turns {
+		typ := "user"
+		if i%2 == 1 {
+			typ = "assistant"
+		}
+		b.Message(Message(fmt.Sprintf("%s-m%d", sessionID, i+1), sessionID, typ, content))
+	}
+	return b
+}
+
+// Annotation attaches an annotation, filling in the session of its message
+func (b *StateBuilder) Annotation(annotation types.MessageAnnotation) *StateBuilder {
+	if annotation.SessionID == "" {
+		for _, message := range b.state.Messages {
+			if message.ID == annotation.MessageID {
+				annotation.SessionID = message.SessionID
+			}
+		}
+	}
+	if annotation.CreatedAt.IsZero() {
+		annotation.CreatedAt = b.tick()
+	}
+	b.state.Annotations = append(b.state.Annotations, annotation)
+	return b
+}
+
+// Theme sets the theme
+func (b *StateBuilder) Theme(theme string) *StateBuilder {
+	b.state.Theme = theme
+	return b
+}
+
+// Model sets the provider and model
+func (b *StateBuilder) Model(provider, model string) *StateBuilder {
+	b.state.Provider = provider
+	b.state.Model = model
+	return b
+}
+
+// Build returns a copy of the state, so the builder can go on to build variants
+func (b *StateBuilder) Build() *types.SharedApplicationState {
+	return b.state.Clone()
+}
@@ -0,0 +1,108 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// StateScrubs are the fields of a state that change each time it is written,
+// blanked before a state is compared against a golden file
+var StateScrubs = []string{"version.timestamp", "last_update"}
+
+// AssertGolden fails t unless got matches the golden file at path. Run the
+// test with -update to write got to the file instead.
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("failed to create golden directory: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file:\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+// AssertGoldenJSON encodes v as indented JSON, blanks the scrubbed paths,
+// and compares the result against the golden file at path
+func AssertGoldenJSON(t testing.TB, path string, v interface{}, scrub ...string) {
+	t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to encode %T: %v", v, err)
+	}
+	if data, err = ScrubJSON(data, scrub...); err != nil {
+		t.Fatalf("failed to scrub %T: %v", v, err)
+	}
+	AssertGolden(t, path, data)
+}
+
+// AssertGoldenState compares a state against the golden file at path,
+// ignoring when it was last updated
+func AssertGoldenState(t testing.TB, path string, state *types.SharedApplicationState) {
+	t.Helper()
+	AssertGoldenJSON(t, path, state, StateScrubs...)
+}
+
+// ScrubJSON returns data re-encoded as indented JSON with the values at the
+// given dotted paths replaced by "<scrubbed>". A "*" element matches every key
+// of an object or every element of an array; paths that do not exist are
+// ignored.
+func ScrubJSON(data []byte, paths ...string) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JSON: %w", err)
+	}
+	for _, path := range paths {
+		doc = scrub(doc, strings.Split(path, "."))
+	}
+	var out bytes.Buffer
+	encoder := json.NewEncoder(&out)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+func scrub(node interface{}, path []string) interface{} {
+	if len(path) == 0 {
+		return "<scrubbed>"
+	}
+	key, rest := path[0], path[1:]
+	switch n := node.(type) {
+	case map[string]interface{}:
+		for k, v := range n {
+			if key == "*" || key == k {
+				n[k] = scrub(v, rest)
+			}
+		}
+	case []interface{}:
+		for i, v := range n {
+			if key == "*" || key == fmt.Sprint(i) {
+				n[i] = scrub(v, rest)
+			}
+		}
+	}
+	return node
+}
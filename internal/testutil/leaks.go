@@ -0,0 +1,81 @@
+package testutil
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/goleak"
+)
+
+// leakWait bounds how long CheckLeaks waits for descriptors closed by
+// goroutines that are still winding down
+const leakWait = 2 * time.Second
+
+// CheckLeaks fails t if the test leaves goroutines running or files open
+// that were not there when CheckLeaks was called. Call it first in the test,
+// before anything registers its own cleanup, so the check runs after the rest
+// of the test has been torn down. Tests using it must not run in parallel.
+func CheckLeaks(t testing.TB, opts ...goleak.Option) {
+	t.Helper()
+	opts = append([]goleak.Option{goleak.IgnoreCurrent()}, opts...)
+	before := OpenFiles()
+
+	t.Cleanup(func() {
+		if err := goleak.Find(opts...); err != nil {
+			t.Errorf("goroutines leaked: %v", err)
+		}
+		if before == nil {
+			return
+		}
+		var leaked []string
+		for deadline := time.Now().Add(leakWait); ; time.Sleep(10 * time.Millisecond) {
+			leaked = leakedFiles(before, OpenFiles())
+			if len(leaked) == 0 || time.Now().After(deadline) {
+				break
+			}
+		}
+		if len(leaked) > 0 {
+			t.Errorf("files left open: %s", strings.Join(leaked, ", "))
+		}
+	})
+}
+
+// OpenFiles returns what each of the process's open descriptors refers to,
+// by descriptor number, or nil where the platform does not list them.
+// Anonymous inodes are left out: the runtime opens its poller on first use
+// and keeps it for the life of the process.
+func OpenFiles() map[string]string {
+	for _, dir := range []string{"/proc/self/fd", "/dev/fd"} {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		files := make(map[string]string, len(entries))
+		for _, entry := range entries {
+			target, err := os.Readlink(filepath.Join(dir, entry.Name()))
+			if err != nil || strings.HasPrefix(target, "anon_inode:") {
+				continue // Includes the descriptor ReadDir itself had open
+			}
+			files[entry.Name()] = target
+		}
+		return files
+	}
+	return nil
+}
+
+// leakedFiles lists the descriptors in after that were not open before
+func leakedFiles(before, after map[string]string) []string {
+	var leaked []string
+	for fd, target := range after {
+		if before[fd] != target {
+			leaked = append(leaked, fmt.Sprintf("%s (%s)", fd, target))
+		}
+	}
+	sort.Strings(leaked)
+	return leaked
+}
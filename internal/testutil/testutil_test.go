@@ -0,0 +1,106 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+func TestStateBuilder(t *testing.T) {
+	build := func() *types.SharedApplicationState {
+		return NewState().
+			Version(4).
+			Sessions(2).
+			Conversation("s1", "hello", "hi there").
+			Message(Message("s2-m1", "s2", "system", "started")).
+			Annotation(types.MessageAnnotation{ID: "a1", MessageID: "s1-m2", Kind: types.AnnotationRating, Rating: 1, Author: "panel-1"}).
+			Model("anthropic", "claude").
+			Build()
+	}
+
+	state := build()
+	if state.CurrentSessionID != "s1" {
+		t.Errorf("CurrentSessionID = %q, want s1", state.CurrentSessionID)
+	}
+	if state.Sessions[0].MessageCount != 2 || state.Sessions[1].MessageCount != 1 {
+		t.Errorf("message counts = %d, %d, want 2, 1", state.Sessions[0].MessageCount, state.Sessions[1].MessageCount)
+	}
+	if state.Annotations[0].SessionID != "s1" {
+		t.Errorf("annotation session = %q, want s1", state.Annotations[0].SessionID)
+	}
+	for i := 1; i < len(state.Messages); i++ {
+		if !state.Messages[i].Timestamp.After(state.Messages[i-1].Timestamp) {
+			t.Errorf("message %d is not after message %d", i, i-1)
+		}
+	}
+
+	// The same fixture builds byte-identical states, timestamps included
+	first, _ := json.Marshal(state)
+	second, _ := json.Marshal(build())
+	if string(first) != string(second) {
+		t.Errorf("building twice gave different states")
+	}
+
+	AssertGoldenJSON(t, "testdata/state.golden.json", state)
+}
+
+func TestUpdates(t *testing.T) {
+	updates := NewUpdates("panel-1", 3).
+		AddSession("s1", "First").
+		AddMessage(Message("m1", "s1", "user", "hello")).
+		DeleteSession("s1")
+
+	list := updates.List()
+	if len(list) != 3 || updates.Version() != 6 {
+		t.Fatalf("got %d updates ending at version %d, want 3 ending at 6", len(list), updates.Version())
+	}
+	for i, u := range list {
+		if u.ExpectedVersion != int64(3+i) {
+			t.Errorf("update %d expects version %d, want %d", i, u.ExpectedVersion, 3+i)
+		}
+		if u.SourcePanel != "panel-1" || u.ID == "" {
+			t.Errorf("update %d = %+v", i, u)
+		}
+	}
+	if list[2].Type != types.SessionDeleted {
+		t.Errorf("last update type = %s, want %s", list[2].Type, types.SessionDeleted)
+	}
+}
+
+func TestScrubJSON(t *testing.T) {
+	input := `{"a":1,"b":{"c":2,"d":3},"list":[{"t":1,"k":"x"},{"t":2,"k":"y"}]}`
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  string
+	}{
+		{"none", nil, `{"a":1,"b":{"c":2,"d":3},"list":[{"k":"x","t":1},{"k":"y","t":2}]}`},
+		{"top level", []string{"a"}, `{"a":"<scrubbed>","b":{"c":2,"d":3},"list":[{"k":"x","t":1},{"k":"y","t":2}]}`},
+		{"nested", []string{"b.d"}, `{"a":1,"b":{"c":2,"d":"<scrubbed>"},"list":[{"k":"x","t":1},{"k":"y","t":2}]}`},
+		{"every element", []string{"list.*.t"}, `{"a":1,"b":{"c":2,"d":3},"list":[{"k":"x","t":"<scrubbed>"},{"k":"y","t":"<scrubbed>"}]}`},
+		{"one element", []string{"list.1.k"}, `{"a":1,"b":{"c":2,"d":3},"list":[{"k":"x","t":1},{"k":"<scrubbed>","t":2}]}`},
+		{"missing", []string{"b.z.q", "nope"}, `{"a":1,"b":{"c":2,"d":3},"list":[{"k":"x","t":1},{"k":"y","t":2}]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ScrubJSON([]byte(input), tt.paths...)
+			if err != nil {
+				t.Fatalf("ScrubJSON() error = %v", err)
+			}
+			var flat bytes.Buffer
+			if err := json.Compact(&flat, got); err != nil {
+				t.Fatalf("ScrubJSON() returned invalid JSON: %v", err)
+			}
+			if flat.String() != tt.want {
+				t.Errorf("ScrubJSON() = %s, want %s", flat.String(), tt.want)
+			}
+		})
+	}
+
+	if _, err := ScrubJSON([]byte("{")); err == nil {
+		t.Errorf("ScrubJSON() accepted invalid JSON")
+	}
+}
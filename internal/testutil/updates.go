@@ -0,0 +1,82 @@
+package testutil
+
+import (
+	"fmt"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Updates builds a sequence of state updates from one panel. Each update
+// expects the version after the one before it, counting one bump per update;
+// tests replaying through a sync manager whose updates bump more than once
+// should rebase ExpectedVersion on the live version, as a panel would.
+type Updates struct {
+	panel   string
+	version int64
+	list    []types.StateUpdate
+}
+
+// NewUpdates starts a sequence from panel against a state at version
+func NewUpdates(panel string, version int64) *Updates {
+	return &Updates{panel: panel, version: version}
+}
+
+// Add appends an update of any type
+func (u *Updates) Add(updateType types.UpdateType, payload interface{}) *Updates {
+	n := len(u.list) + 1
+	u.list = append(u.list, types.StateUpdate{
+		ID:              fmt.Sprintf("%s-u%d", u.panel, n),
+		Type:            updateType,
+		ExpectedVersion: u.version,
+		Payload:         payload,
+		SourcePanel:     u.panel,
+		Timestamp:       At(n),
+	})
+	u.version++
+	return u
+}
+
+// AddSession appends a SessionAdded for a session created at Epoch
+func (u *Updates) AddSession(id, title string) *Updates {
+	return u.Add(types.SessionAdded, types.SessionAddPayload{Session: Session(id, title)})
+}
+
+// ChangeSession appends a SessionChanged
+func (u *Updates) ChangeSession(id string) *Updates {
+	return u.Add(types.SessionChanged, types.SessionChangePayload{SessionID: id})
+}
+
+// DeleteSession appends a SessionDeleted
+func (u *Updates) DeleteSession(id string) *Updates {
+	return u.Add(types.SessionDeleted, types.SessionDeletePayload{SessionID: id})
+}
+
+// AddMessage appends a MessageAdded
+func (u *Updates) AddMessage(message types.MessageInfo) *Updates {
+	return u.Add(types.MessageAdded, types.MessageAddPayload{Message: message})
+}
+
+// UpdateMessage appends a MessageUpdated
+func (u *Updates) UpdateMessage(messageID, content, status string) *Updates {
+	return u.Add(types.MessageUpdated, types.MessageUpdatePayload{MessageID: messageID, Content: content, Status: status})
+}
+
+// ClearMessages appends a MessagesCleared
+func (u *Updates) ClearMessages(sessionID string) *Updates {
+	return u.Add(types.MessagesCleared, types.MessagesClearPayload{SessionID: sessionID})
+}
+
+// ChangeTheme appends a ThemeChanged
+func (u *Updates) ChangeTheme(theme string) *Updates {
+	return u.Add(types.ThemeChanged, types.ThemeChangePayload{Theme: theme})
+}
+
+// Version returns the version the state reaches once every update applied
+func (u *Updates) Version() int64 {
+	return u.version
+}
+
+// List returns the updates in order
+func (u *Updates) List() []types.StateUpdate {
+	return append([]types.StateUpdate(nil), u.list...)
+}
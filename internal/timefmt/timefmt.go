@@ -0,0 +1,116 @@
+// Package timefmt keeps timestamps in UTC wherever they leave a process, on
+// disk or over IPC, and formats them for people in a configured time zone.
+package timefmt
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Environment variables the orchestrator hands display settings to panels in
+const (
+	EnvTimezone       = "OPENCODE_TIMEZONE"
+	EnvClockFormat    = "OPENCODE_TIME_FORMAT"
+	EnvDateTimeFormat = "OPENCODE_DATETIME_FORMAT"
+)
+
+// Default layouts for a time of day and for a full date and time
+const (
+	DefaultClockFormat    = "15:04:05"
+	DefaultDateTimeFormat = "2006-01-02 15:04:05"
+)
+
+var (
+	mu             sync.RWMutex
+	location       = time.Local
+	clockFormat    = DefaultClockFormat
+	dateTimeFormat = DefaultDateTimeFormat
+)
+
+// LoadLocation resolves a configured time zone. Empty and "local" mean the
+// machine's zone; anything else is an IANA name such as "Europe/Berlin" or "UTC".
+func LoadLocation(name string) (*time.Location, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %q: %w", name, err)
+	}
+	return loc, nil
+}
+
+// Configure sets the zone and layouts times are displayed with. Empty
+// layouts keep the defaults.
+func Configure(timezone, clock, dateTime string) error {
+	loc, err := LoadLocation(timezone)
+	if err != nil {
+		return err
+	}
+	if clock == "" {
+		clock = DefaultClockFormat
+	}
+	if dateTime == "" {
+		dateTime = DefaultDateTimeFormat
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	location = loc
+	clockFormat = clock
+	dateTimeFormat = dateTime
+	return nil
+}
+
+// ConfigureFromEnv applies the display settings in the environment, leaving
+// the current ones in place when none are set
+func ConfigureFromEnv() error {
+	timezone, clock, dateTime := os.Getenv(EnvTimezone), os.Getenv(EnvClockFormat), os.Getenv(EnvDateTimeFormat)
+	if timezone == "" && clock == "" && dateTime == "" {
+		return nil
+	}
+	return Configure(timezone, clock, dateTime)
+}
+
+// Env returns the environment that carries the given display settings to a
+// panel, omitting the ones left at their defaults
+func Env(timezone, clock, dateTime string) map[string]string {
+	env := map[string]string{}
+	if timezone != "" {
+		env[EnvTimezone] = timezone
+	}
+	if clock != "" {
+		env[EnvClockFormat] = clock
+	}
+	if dateTime != "" {
+		env[EnvDateTimeFormat] = dateTime
+	}
+	return env
+}
+
+// In returns t in the display zone
+func In(t time.Time) time.Time {
+	mu.RLock()
+	defer mu.RUnlock()
+	return t.In(location)
+}
+
+// Clock formats the time of day of t in the display zone
+func Clock(t time.Time) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return t.In(location).Format(clockFormat)
+}
+
+// DateTime formats t as a date and time in the display zone
+func DateTime(t time.Time) string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return t.In(location).Format(dateTimeFormat)
+}
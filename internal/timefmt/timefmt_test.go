@@ -0,0 +1,144 @@
+package timefmt
+
+import (
+	"testing"
+	"time"
+)
+
+type record struct {
+	At       time.Time
+	Seen     *time.Time
+	History  []time.Time
+	ByName   map[string]time.Time
+	Payload  interface{}
+	Name     string
+	internal time.Time
+}
+
+func TestUTC(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	at := time.Date(2026, 6, 1, 14, 30, 0, 0, berlin)
+	seen := at.Add(time.Minute)
+
+	original := &record{
+		At:       at,
+		Seen:     &seen,
+		History:  []time.Time{at, at.Add(time.Hour)},
+		ByName:   map[string]time.Time{"start": at},
+		Payload:  map[string]interface{}{"when": at, "count": 3},
+		Name:     "run",
+		internal: at,
+	}
+
+	got := UTC(original)
+
+	checks := []struct {
+		name string
+		got  time.Time
+		want time.Time
+	}{
+		{"field", got.At, at},
+		{"pointer", *got.Seen, seen},
+		{"slice", got.History[1], at.Add(time.Hour)},
+		{"map", got.ByName["start"], at},
+		{"interface", got.Payload.(map[string]interface{})["when"].(time.Time), at},
+	}
+	for _, check := range checks {
+		if check.got.Location() != time.UTC {
+			t.Errorf("%s: location %v, want UTC", check.name, check.got.Location())
+		}
+		if !check.got.Equal(check.want) {
+			t.Errorf("%s: %v, want the same instant as %v", check.name, check.got, check.want)
+		}
+	}
+
+	if got.Name != "run" || got.Payload.(map[string]interface{})["count"] != 3 {
+		t.Errorf("other fields changed: %+v", got)
+	}
+	if got.internal.Location() != berlin {
+		t.Errorf("unexported field converted")
+	}
+
+	// The input is copied, not changed
+	if original.At.Location() != berlin || original.Seen.Location() != berlin ||
+		original.History[0].Location() != berlin || original.ByName["start"].Location() != berlin {
+		t.Errorf("input was modified: %+v", original)
+	}
+}
+
+func TestUTCUnchangedSharesValue(t *testing.T) {
+	history := []time.Time{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	original := &record{History: history}
+
+	if got := UTC(original); got != original {
+		t.Errorf("value already in UTC was copied")
+	}
+	if got := UTC(history); &got[0] != &history[0] {
+		t.Errorf("slice already in UTC was copied")
+	}
+	if got := UTC[interface{}](nil); got != nil {
+		t.Errorf("UTC(nil) = %v", got)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	defer Configure("", "", "")
+
+	at := time.Date(2026, 6, 1, 12, 0, 5, 0, time.UTC)
+	tests := []struct {
+		name                  string
+		zone, clock, dateTime string
+		wantClock, wantDate   string
+		wantErr               bool
+	}{
+		{name: "utc", zone: "UTC", wantClock: "12:00:05", wantDate: "2026-06-01 12:00:05"},
+		{name: "named zone", zone: "Asia/Tokyo", wantClock: "21:00:05", wantDate: "2026-06-01 21:00:05"},
+		{name: "layouts", zone: "utc", clock: "3:04PM", dateTime: "Jan 2 15:04", wantClock: "12:00PM", wantDate: "Jun 1 12:00"},
+		{name: "unknown zone", zone: "Mars/Olympus", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Configure(tt.zone, tt.clock, tt.dateTime)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Configure(%q) succeeded", tt.zone)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Configure: %v", err)
+			}
+			if got := Clock(at); got != tt.wantClock {
+				t.Errorf("Clock = %q, want %q", got, tt.wantClock)
+			}
+			if got := DateTime(at); got != tt.wantDate {
+				t.Errorf("DateTime = %q, want %q", got, tt.wantDate)
+			}
+		})
+	}
+}
+
+func TestConfigureFromEnv(t *testing.T) {
+	defer Configure("", "", "")
+	Configure("UTC", "", "")
+
+	t.Setenv(EnvTimezone, "")
+	t.Setenv(EnvClockFormat, "")
+	t.Setenv(EnvDateTimeFormat, "")
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	if got := Clock(at); got != "12:00:00" {
+		t.Errorf("empty environment changed settings: Clock = %q", got)
+	}
+
+	t.Setenv(EnvTimezone, "America/New_York")
+	t.Setenv(EnvClockFormat, "15:04")
+	if err := ConfigureFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if got := Clock(at); got != "08:00" {
+		t.Errorf("Clock = %q, want 08:00", got)
+	}
+}
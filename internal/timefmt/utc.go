@@ -0,0 +1,153 @@
+package timefmt
+
+import (
+	"reflect"
+	"sync"
+	"time"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// holdsTime caches, by type, whether a value of the type can reach a time.Time
+var holdsTime sync.Map
+
+// UTC returns v with every time.Time it reaches through exported fields,
+// pointers, slices, arrays, maps and interfaces converted to UTC. Whatever
+// holds a converted time is copied rather than changed, so v may be shared
+// with other goroutines; parts without a time to convert are shared with the
+// result.
+func UTC[T any](v T) T {
+	out, changed := toUTC(reflect.ValueOf(&v).Elem())
+	if !changed {
+		return v
+	}
+	return out.Interface().(T)
+}
+
+// toUTC returns a copy of v with its times in UTC, or v and false when they
+// already are
+func toUTC(v reflect.Value) (reflect.Value, bool) {
+	if !mayHoldTime(v.Type()) {
+		return v, false
+	}
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		if t.Location() == time.UTC {
+			return v, false
+		}
+		return reflect.ValueOf(t.UTC()), true
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		elem, changed := toUTC(v.Elem())
+		if !changed {
+			return v, false
+		}
+		if v.Kind() == reflect.Interface {
+			out := reflect.New(v.Type()).Elem()
+			out.Set(elem)
+			return out, true
+		}
+		out := reflect.New(v.Type().Elem())
+		out.Elem().Set(elem)
+		return out, true
+
+	case reflect.Struct:
+		var out reflect.Value
+		for i := 0; i < v.NumField(); i++ {
+			if !v.Type().Field(i).IsExported() {
+				continue
+			}
+			field, changed := toUTC(v.Field(i))
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.New(v.Type()).Elem()
+				out.Set(v)
+			}
+			out.Field(i).Set(field)
+		}
+		return out, out.IsValid()
+
+	case reflect.Slice, reflect.Array:
+		var out reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			elem, changed := toUTC(v.Index(i))
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				if v.Kind() == reflect.Slice {
+					out = reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+					reflect.Copy(out, v)
+				} else {
+					out = reflect.New(v.Type()).Elem()
+					out.Set(v)
+				}
+			}
+			out.Index(i).Set(elem)
+		}
+		return out, out.IsValid()
+
+	case reflect.Map:
+		var out reflect.Value
+		iter := v.MapRange()
+		for iter.Next() {
+			elem, changed := toUTC(iter.Value())
+			if !changed {
+				continue
+			}
+			if !out.IsValid() {
+				out = reflect.MakeMapWithSize(v.Type(), v.Len())
+				copied := v.MapRange()
+				for copied.Next() {
+					out.SetMapIndex(copied.Key(), copied.Value())
+				}
+			}
+			out.SetMapIndex(iter.Key(), elem)
+		}
+		return out, out.IsValid()
+	}
+	return v, false
+}
+
+// mayHoldTime reports whether a value of type t can reach a time.Time that
+// toUTC converts. Interfaces always may; a recursive type is assumed to.
+func mayHoldTime(t reflect.Type) bool {
+	if cached, ok := holdsTime.Load(t); ok {
+		return cached.(bool)
+	}
+	result := scanType(t, map[reflect.Type]bool{})
+	holdsTime.Store(t, result)
+	return result
+}
+
+func scanType(t reflect.Type, visiting map[reflect.Type]bool) bool {
+	if t == timeType {
+		return true
+	}
+	if visiting[t] {
+		return true
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return true
+	case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+		return scanType(t.Elem(), visiting)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if t.Field(i).IsExported() && scanType(t.Field(i).Type, visiting) {
+				return true
+			}
+		}
+	}
+	return false
+}
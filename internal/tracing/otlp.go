@@ -0,0 +1,183 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OTLP span kinds and status codes used here
+const (
+	otlpKindInternal = 1
+	otlpStatusError  = 2
+)
+
+// OTLPExporter posts spans to an OTLP/HTTP collector as JSON
+type OTLPExporter struct {
+	url         string
+	serviceName string
+	headers     map[string]string
+	client      *http.Client
+}
+
+// NewOTLPExporter returns an exporter for a collector at endpoint, such as
+// "http://localhost:4318"; spans go to <endpoint>/v1/traces unless the
+// endpoint already names that path
+func NewOTLPExporter(endpoint, serviceName string, headers map[string]string, timeout time.Duration) *OTLPExporter {
+	url := strings.TrimSuffix(endpoint, "/")
+	if !strings.HasSuffix(url, "/v1/traces") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{
+		url:         url,
+		serviceName: serviceName,
+		headers:     headers,
+		client:      &http.Client{Timeout: timeout},
+	}
+}
+
+// Export posts one batch
+func (e *OTLPExporter) Export(ctx context.Context, spans []SpanData) error {
+	body, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range e.headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector returned %s", resp.Status)
+	}
+	return nil
+}
+
+// The OTLP/JSON encoding: IDs are hex, 64-bit integers are decimal strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Status            *otlpStatus    `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	encoded := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(span.Context.TraceID[:]),
+			SpanID:            hex.EncodeToString(span.Context.SpanID[:]),
+			Name:              span.Name,
+			Kind:              otlpKindInternal,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attrs),
+		}
+		if span.Parent != (SpanID{}) {
+			out.ParentSpanID = hex.EncodeToString(span.Parent[:])
+		}
+		if span.Error != "" {
+			out.Status = &otlpStatus{Code: otlpStatusError, Message: span.Error}
+		}
+		encoded = append(encoded, out)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: attributes(map[string]interface{}{"service.name": e.serviceName})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "github.com/opencode/tmux_coder"}, Spans: encoded}},
+	}}}
+}
+
+// attributes encodes a span's attributes in key order
+func attributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for key := range attrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]otlpKeyValue, 0, len(keys))
+	for _, key := range keys {
+		var value otlpValue
+		switch v := attrs[key].(type) {
+		case string:
+			value.StringValue = &v
+		case bool:
+			value.BoolValue = &v
+		case int:
+			s := strconv.FormatInt(int64(v), 10)
+			value.IntValue = &s
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case float64:
+			value.DoubleValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		out = append(out, otlpKeyValue{Key: key, Value: value})
+	}
+	return out
+}
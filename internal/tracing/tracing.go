@@ -0,0 +1,286 @@
+// Package tracing records spans for state updates as they cross the IPC
+// socket and move through the sync manager, and exports them over OTLP/HTTP.
+//
+// Trace context travels as a W3C traceparent string
+// ("00-<trace id>-<span id>-01") on state updates, events and IPC messages,
+// so spans from a panel, the socket server and the apply loop join one trace.
+// A nil *Tracer is valid: it propagates trace context without recording.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span within a trace
+type SpanID [8]byte
+
+// SpanContext is the part of a span that is propagated
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+}
+
+// Valid reports whether both IDs are set; all-zero IDs are invalid per W3C
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != TraceID{} && sc.SpanID != SpanID{}
+}
+
+// String formats the context as a traceparent, empty when invalid
+func (sc SpanContext) String() string {
+	if !sc.Valid() {
+		return ""
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-01"
+}
+
+// Parse reads a traceparent. Unknown versions are accepted as long as the
+// fields they share with version 00 are well formed.
+func Parse(traceParent string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return sc, fmt.Errorf("malformed traceparent %q", traceParent)
+	}
+	if len(parts[1]) != 2*len(sc.TraceID) || len(parts[2]) != 2*len(sc.SpanID) || len(parts[3]) != 2 {
+		return sc, fmt.Errorf("malformed traceparent %q", traceParent)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, fmt.Errorf("malformed trace id in %q", traceParent)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, fmt.Errorf("malformed span id in %q", traceParent)
+	}
+	if !sc.Valid() {
+		return sc, fmt.Errorf("traceparent %q has a zero id", traceParent)
+	}
+	return sc, nil
+}
+
+// NewRoot returns the context of a new trace, for processes that propagate
+// trace context without recording spans of their own
+func NewRoot() string {
+	return SpanContext{TraceID: newTraceID(), SpanID: newSpanID()}.String()
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for id == (TraceID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for id == (SpanID{}) {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+// SpanData is a finished span
+type SpanData struct {
+	Context SpanContext
+	Parent  SpanID // Zero for a root span
+	Name    string
+	Start   time.Time
+	End     time.Time
+	Attrs   map[string]interface{}
+	Error   string // Non-empty when the operation failed
+}
+
+// Exporter ships finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []SpanData) error
+}
+
+// Options tune batching
+type Options struct {
+	QueueSize     int           // Finished spans waiting for export; more are dropped
+	BatchSize     int           // Spans per export
+	FlushInterval time.Duration // Longest a finished span waits for export
+}
+
+// DefaultOptions returns the options used when none are configured
+func DefaultOptions() Options {
+	return Options{QueueSize: 2048, BatchSize: 256, FlushInterval: 5 * time.Second}
+}
+
+// Tracer starts spans and hands finished ones to an exporter in batches
+type Tracer struct {
+	opts     Options
+	exporter Exporter
+	queue    chan SpanData
+
+	mutex   sync.Mutex
+	dropped int64
+}
+
+// NewTracer returns a tracer exporting to exporter once Run is started; zero
+// options take their defaults
+func NewTracer(opts Options, exporter Exporter) *Tracer {
+	defaults := DefaultOptions()
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = defaults.QueueSize
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaults.BatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaults.FlushInterval
+	}
+	return &Tracer{opts: opts, exporter: exporter, queue: make(chan SpanData, opts.QueueSize)}
+}
+
+// Start begins a span under the given traceparent, or a new trace when the
+// parent is empty or malformed
+func (t *Tracer) Start(parent, name string) *Span {
+	span := &Span{tracer: t, name: name, start: time.Now()}
+	if sc, err := Parse(parent); err == nil {
+		span.context.TraceID = sc.TraceID
+		span.parent = sc.SpanID
+	} else {
+		span.context.TraceID = newTraceID()
+	}
+	span.context.SpanID = newSpanID()
+	return span
+}
+
+// Dropped returns how many finished spans were discarded because the queue was full
+func (t *Tracer) Dropped() int64 {
+	if t == nil {
+		return 0
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.dropped
+}
+
+func (t *Tracer) finish(data SpanData) {
+	if t == nil {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		t.mutex.Lock()
+		t.dropped++
+		t.mutex.Unlock()
+	}
+}
+
+// Run exports finished spans until ctx is cancelled, then flushes what is
+// queued with a short deadline of its own
+func (t *Tracer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.opts.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, t.opts.BatchSize)
+	flush := func(ctx context.Context) {
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			log.Printf("[TRACING] Failed to export %d span(s): %v", len(batch), err)
+		}
+		batch = make([]SpanData, 0, t.opts.BatchSize)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+		drain:
+			for {
+				select {
+				case data := <-t.queue:
+					batch = append(batch, data)
+				default:
+					break drain
+				}
+			}
+			shutdown, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			flush(shutdown)
+			cancel()
+			return
+		case data := <-t.queue:
+			batch = append(batch, data)
+			if len(batch) >= t.opts.BatchSize {
+				flush(ctx)
+			}
+		case <-ticker.C:
+			flush(ctx)
+		}
+	}
+}
+
+// Span is an operation in progress. Its methods are safe to call on a span
+// from a nil tracer, and End records it at most once.
+type Span struct {
+	tracer  *Tracer
+	context SpanContext
+	parent  SpanID
+	name    string
+	start   time.Time
+
+	mutex sync.Mutex
+	attrs map[string]interface{}
+	err   string
+	ended bool
+}
+
+// TraceParent returns the span's context for propagation to its children
+func (s *Span) TraceParent() string {
+	return s.context.String()
+}
+
+// SetAttr records an attribute; strings, bools, integers and floats are
+// exported as such and anything else as its formatted value
+func (s *Span) SetAttr(key string, value interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.attrs == nil {
+		s.attrs = make(map[string]interface{})
+	}
+	s.attrs[key] = value
+}
+
+// SetError marks the operation as failed; nil is ignored
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.err = err.Error()
+}
+
+// End finishes the span and queues it for export
+func (s *Span) End() {
+	s.mutex.Lock()
+	if s.ended {
+		s.mutex.Unlock()
+		return
+	}
+	s.ended = true
+	data := SpanData{
+		Context: s.context,
+		Parent:  s.parent,
+		Name:    s.name,
+		Start:   s.start,
+		End:     time.Now(),
+		Attrs:   s.attrs,
+		Error:   s.err,
+	}
+	s.mutex.Unlock()
+	s.tracer.finish(data)
+}
@@ -0,0 +1,177 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	valid := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	tests := []struct {
+		name   string
+		in     string
+		wantOK bool
+	}{
+		{"w3c example", valid, true},
+		{"future version with extra field", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"empty", "", false},
+		{"version 00 with extra field", valid + "-extra", false},
+		{"forbidden version", "ff" + valid[2:], false},
+		{"short trace id", "00-4bf92f3577b34da6-00f067aa0ba902b7-01", false},
+		{"zero trace id", "00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"zero span id", "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"not hex", "00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sc, err := Parse(tc.in)
+			if (err == nil) != tc.wantOK {
+				t.Fatalf("Parse(%q) error = %v, want ok %v", tc.in, err, tc.wantOK)
+			}
+			if tc.in == valid && sc.String() != valid {
+				t.Errorf("round trip = %q, want %q", sc.String(), valid)
+			}
+		})
+	}
+	if _, err := Parse(NewRoot()); err != nil {
+		t.Errorf("NewRoot does not parse: %v", err)
+	}
+}
+
+// recorder keeps exported spans
+type recorder struct {
+	mutex sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(_ context.Context, spans []SpanData) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func (r *recorder) count() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.spans)
+}
+
+func TestSpansJoinTheParentTrace(t *testing.T) {
+	exporter := &recorder{}
+	tracer := NewTracer(Options{BatchSize: 2, FlushInterval: time.Hour}, exporter)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tracer.Run(ctx)
+		close(done)
+	}()
+
+	root := tracer.Start("", "ipc.handle_state_update")
+	child := tracer.Start(root.TraceParent(), "state.apply")
+	child.SetAttr("update.type", "message_added")
+	child.SetError(errors.New("rejected"))
+	child.End()
+	child.End()
+	root.End()
+
+	// A full batch is exported without waiting for the flush interval
+	deadline := time.Now().Add(5 * time.Second)
+	for exporter.count() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("exported %d spans, want 2 (End twice records once)", len(exporter.spans))
+	}
+	gotChild, gotRoot := exporter.spans[0], exporter.spans[1]
+	if gotChild.Context.TraceID != gotRoot.Context.TraceID || gotChild.Parent != gotRoot.Context.SpanID {
+		t.Errorf("child %+v is not under root %+v", gotChild.Context, gotRoot.Context)
+	}
+	if gotRoot.Parent != (SpanID{}) {
+		t.Errorf("root has parent %x", gotRoot.Parent)
+	}
+	if gotChild.Error != "rejected" || gotChild.Attrs["update.type"] != "message_added" {
+		t.Errorf("child = %+v", gotChild)
+	}
+}
+
+func TestNilTracerPropagates(t *testing.T) {
+	var tracer *Tracer
+	parent := NewRoot()
+	span := tracer.Start(parent, "state.apply")
+	span.SetAttr("k", "v")
+	span.End()
+
+	want, _ := Parse(parent)
+	got, err := Parse(span.TraceParent())
+	if err != nil || got.TraceID != want.TraceID || got.SpanID == want.SpanID {
+		t.Errorf("span context %v from parent %v", span.TraceParent(), parent)
+	}
+	if tracer.Dropped() != 0 {
+		t.Errorf("nil tracer reports drops")
+	}
+}
+
+func TestOTLPExport(t *testing.T) {
+	var body map[string]interface{}
+	var path, auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, auth = r.URL.Path, r.Header.Get("Authorization")
+		data, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(data, &body)
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL+"/", "tmux_coder", map[string]string{"Authorization": "Bearer t"}, time.Second)
+	start := time.Unix(1700000000, 5)
+	span := SpanData{
+		Context: SpanContext{TraceID: TraceID{1}, SpanID: SpanID{2}},
+		Parent:  SpanID{3},
+		Name:    "state.persist",
+		Start:   start,
+		End:     start.Add(time.Millisecond),
+		Attrs:   map[string]interface{}{"state.version": int64(7), "ok": true},
+		Error:   "disk full",
+	}
+	if err := exporter.Export(context.Background(), []SpanData{span}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/traces" || auth != "Bearer t" {
+		t.Errorf("posted to %q with auth %q", path, auth)
+	}
+
+	encoded, _ := json.Marshal(body)
+	for _, want := range []string{
+		`"service.name","value":{"stringValue":"tmux_coder"}`,
+		`"traceId":"01000000000000000000000000000000"`,
+		`"spanId":"0200000000000000"`,
+		`"parentSpanId":"0300000000000000"`,
+		`"startTimeUnixNano":"1700000000000000005"`,
+		`"key":"state.version","value":{"intValue":"7"}`,
+		`"key":"ok","value":{"boolValue":true}`,
+		`"status":{"code":2,"message":"disk full"}`,
+	} {
+		if !strings.Contains(string(encoded), want) {
+			t.Errorf("export body lacks %s: %s", want, encoded)
+		}
+	}
+
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	if err := NewOTLPExporter(failing.URL, "x", nil, time.Second).Export(context.Background(), []SpanData{span}); err == nil {
+		t.Errorf("collector error not reported")
+	}
+}
@@ -0,0 +1,74 @@
+package types
+
+import (
+	"github.com/sst/opencode-sdk-go"
+)
+
+// PanelCapabilities is what a panel declares it can do when it connects. The
+// server routes UI actions and diff-bearing events only to panels that can
+// handle them. A panel that declares nothing is sent everything.
+type PanelCapabilities struct {
+	RendersMessages bool       `json:"renders_messages"`
+	UIActions       []UIAction `json:"ui_actions,omitempty"` // UI actions the panel handles
+	Diffs           bool       `json:"diffs"`                // Renders patch parts of messages
+	// Batches takes the updates applied together as one state_batch event
+	// instead of one event each
+	Batches bool `json:"batches,omitempty"`
+	// Topic patterns of the events the panel wants, see MatchTopic; empty
+	// means every event. State syncs and shutdown are always delivered.
+	Topics []string `json:"topics,omitempty"`
+}
+
+// HandlesAction reports whether the panel handles a UI action
+func (c *PanelCapabilities) HandlesAction(action UIAction) bool {
+	if c == nil {
+		return true
+	}
+	for _, handled := range c.UIActions {
+		if handled == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Accepts reports whether an event should be delivered to the panel
+func (c *PanelCapabilities) Accepts(event StateEvent) bool {
+	if c == nil {
+		return true
+	}
+	if len(c.Topics) > 0 && !alwaysDelivered[event.Type] && !MatchAnyTopic(c.Topics, EventTopic(event)) {
+		return false
+	}
+	if event.Type == EventUIActionTriggered {
+		payload, ok := UIActionFromEvent(event)
+		return !ok || c.HandlesAction(payload.Action)
+	}
+	if !c.Diffs && EventCarriesDiff(event) {
+		return false
+	}
+	return true
+}
+
+// EventCarriesDiff reports whether a message event carries a patch part.
+// Parts moved to the blob store are not inspected; panels fetch them on demand.
+func EventCarriesDiff(event StateEvent) bool {
+	var parts []opencode.PartUnion
+	switch payload := event.Data.(type) {
+	case MessageAddPayload:
+		parts = payload.Message.Parts
+	case MessageUpdatePayload:
+		parts = payload.Parts
+	case MessageInfo:
+		parts = payload.Parts
+	default:
+		return false
+	}
+	for _, part := range parts {
+		switch part.(type) {
+		case opencode.PartPatchPart, *opencode.PartPatchPart:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,34 @@
+package types
+
+import "fmt"
+
+// CodeBlock is a fenced code block found in a message body. Start and End
+// are byte offsets of the code, without its fences, in the full body, which
+// is behind BodyRef when the message was offloaded.
+type CodeBlock struct {
+	Index     int    `json:"index"`
+	Language  string `json:"language,omitempty"` // Info string of the opening fence, e.g. "go"
+	Path      string `json:"path,omitempty"`     // File the fence names, as in "go title=main.go" or "go:main.go"
+	Start     int    `json:"start"`
+	End       int    `json:"end"`
+	StartLine int    `json:"start_line"` // 1-based line of the first line of code
+	EndLine   int    `json:"end_line"`   // Line of the last line of code; StartLine-1 for an empty block
+}
+
+// Code returns the block's code taken from the full message body
+func (b CodeBlock) Code(body string) (string, error) {
+	if b.Start < 0 || b.End < b.Start || b.End > len(body) {
+		return "", fmt.Errorf("code block %d lies outside the message body", b.Index)
+	}
+	return body[b.Start:b.End], nil
+}
+
+// FindCodeBlock returns the block of message with the given index
+func FindCodeBlock(message MessageInfo, index int) (CodeBlock, bool) {
+	for _, block := range message.CodeBlocks {
+		if block.Index == index {
+			return block, true
+		}
+	}
+	return CodeBlock{}, false
+}
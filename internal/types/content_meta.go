@@ -0,0 +1,13 @@
+package types
+
+// ContentMeta describes a message body for panels: its size, its code and
+// the lines its diffs change. It is worked out once as the body arrives, so
+// panels need not scan bodies on every render.
+type ContentMeta struct {
+	Lines      int    `json:"lines"`
+	Language   string `json:"language,omitempty"` // Language of most of the code, "diff" for a body that is a patch
+	CodeBlocks int    `json:"code_blocks,omitempty"`
+	CodeLines  int    `json:"code_lines,omitempty"`
+	Additions  int    `json:"additions,omitempty"` // Lines added by the unified diffs in the body
+	Deletions  int    `json:"deletions,omitempty"`
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// An event is sealed when it is published: it is encoded to JSON once, with
+// its times in UTC, and every copy handed to a subscriber shares that encoding
+// instead of encoding the event again. Panels receive the encoding, so a subscriber changing its
+// copy cannot change what the others are sent. Data remains the typed view of
+// the payload; it is shared too and must be treated as read-only.
+
+// sealedEvent is the encoding shared by the copies of a sealed event
+type sealedEvent struct {
+	data []byte // The event's JSON; never modified
+
+	wireOnce sync.Once
+	wire     []byte
+	wireErr  error
+}
+
+// plainEvent is encoded with the default encoding, which MarshalJSON would
+// otherwise recurse into
+type plainEvent StateEvent
+
+// SealEvent returns event with its encoding attached. Fields changed on a
+// sealed event are not reflected in its encoding, so a changed event has to be
+// built afresh rather than copied from a sealed one.
+func SealEvent(event StateEvent) (StateEvent, error) {
+	if event.sealed != nil {
+		return event, nil
+	}
+	data, err := json.Marshal(plainEvent(timefmt.UTC(event)))
+	if err != nil {
+		return event, err
+	}
+	event.sealed = &sealedEvent{data: data}
+	return event, nil
+}
+
+// WithData returns a copy of event carrying data and no encoding, to be
+// sealed again once it is complete
+func (event StateEvent) WithData(data interface{}) StateEvent {
+	event.Data = data
+	event.sealed = nil
+	return event
+}
+
+// Sealed reports whether event carries its encoding
+func (event StateEvent) Sealed() bool {
+	return event.sealed != nil
+}
+
+// MarshalJSON returns the sealed encoding, or encodes an unsealed event
+func (event StateEvent) MarshalJSON() ([]byte, error) {
+	if event.sealed != nil {
+		return event.sealed.data, nil
+	}
+	return json.Marshal(plainEvent(timefmt.UTC(event)))
+}
+
+// WireEncoding returns the message a transport sends for event, built by
+// build from the event's JSON. For a sealed event the first caller builds it
+// and every later caller gets the same bytes, which must not be modified.
+func (event StateEvent) WireEncoding(build func(eventJSON []byte) ([]byte, error)) ([]byte, error) {
+	if event.sealed == nil {
+		data, err := json.Marshal(plainEvent(timefmt.UTC(event)))
+		if err != nil {
+			return nil, err
+		}
+		return build(data)
+	}
+	sealed := event.sealed
+	sealed.wireOnce.Do(func() {
+		sealed.wire, sealed.wireErr = build(sealed.data)
+	})
+	return sealed.wire, sealed.wireErr
+}
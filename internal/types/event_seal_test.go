@@ -0,0 +1,100 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func sealTestEvent() StateEvent {
+	return StateEvent{
+		ID:          "evt_1",
+		Type:        EventInputUpdated,
+		Data:        map[string]interface{}{"input": "hello"},
+		Version:     7,
+		SourcePanel: "input",
+		Timestamp:   time.Date(2025, 1, 1, 9, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestSealEventKeepsEncoding(t *testing.T) {
+	event := sealTestEvent()
+	plain, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealEvent(event)
+	if err != nil {
+		t.Fatalf("SealEvent() error = %v", err)
+	}
+	if !sealed.Sealed() || event.Sealed() {
+		t.Fatalf("Sealed() = %v on the sealed copy and %v on the original", sealed.Sealed(), event.Sealed())
+	}
+	encoded, err := json.Marshal(sealed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(encoded, plain) {
+		t.Errorf("sealed encoding = %s, want %s", encoded, plain)
+	}
+
+	// A receiver changing its copy does not change what is sent
+	tampered := sealed
+	tampered.Data.(map[string]interface{})["input"] = "changed"
+	tampered.Version = 99
+	if encoded, _ := json.Marshal(tampered); !bytes.Equal(encoded, plain) {
+		t.Errorf("encoding after tampering = %s, want %s", encoded, plain)
+	}
+
+	var decoded StateEvent
+	if err := json.Unmarshal(plain, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Sealed() || decoded.Version != 7 {
+		t.Errorf("decoded = %+v, want version 7 and unsealed", decoded)
+	}
+}
+
+func TestWireEncodingSharedAcrossCopies(t *testing.T) {
+	sealed, err := SealEvent(sealTestEvent())
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds := 0
+	build := func(eventJSON []byte) ([]byte, error) {
+		builds++
+		return append([]byte(`{"data":`), append(eventJSON, '}')...), nil
+	}
+
+	first, err := sealed.WireEncoding(build)
+	if err != nil {
+		t.Fatalf("WireEncoding() error = %v", err)
+	}
+	copies := []StateEvent{sealed, sealed, sealed}
+	for _, event := range copies {
+		wire, _ := event.WireEncoding(build)
+		if &wire[0] != &first[0] {
+			t.Error("copy got its own wire encoding")
+		}
+	}
+	if builds != 1 {
+		t.Errorf("built %d times, want once", builds)
+	}
+
+	// Fanning a sealed event out allocates nothing
+	allocs := testing.AllocsPerRun(100, func() {
+		for _, event := range copies {
+			event.WireEncoding(build)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("fan-out allocated %v times per run, want 0", allocs)
+	}
+
+	// Unsealed events are built every time
+	if _, err := sealTestEvent().WireEncoding(build); err != nil || builds != 2 {
+		t.Errorf("unsealed WireEncoding() error = %v, builds = %d; want 2", err, builds)
+	}
+}
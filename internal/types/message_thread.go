@@ -0,0 +1,72 @@
+package types
+
+// MessageThread is a message starting a thread, usually a user prompt, and
+// the messages answering it: the assistant's replies, tool call output and
+// notes made while it ran, in order
+type MessageThread struct {
+	Root    MessageInfo   `json:"root"`
+	Replies []MessageInfo `json:"replies,omitempty"`
+}
+
+// ID returns the ID of the message starting the thread
+func (t MessageThread) ID() string {
+	return t.Root.ID
+}
+
+// ThreadParentID returns the message a message added after messages replies
+// to: its ParentID when set, otherwise, for anything but a user message, the
+// latest user message of its session. It is empty for a message that starts
+// a thread.
+func ThreadParentID(messages []MessageInfo, message MessageInfo) string {
+	if message.ParentID != "" || message.Type == "user" {
+		return message.ParentID
+	}
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].SessionID == message.SessionID && messages[i].Type == "user" {
+			return messages[i].ID
+		}
+	}
+	return ""
+}
+
+// GroupThreads splits messages, in order, into threads. Messages without a
+// ParentID are placed as ThreadParentID would place them; messages whose
+// parent is not among messages, and those before a session's first user
+// message, start threads of their own.
+func GroupThreads(messages []MessageInfo) []MessageThread {
+	var threads []MessageThread
+	threadOf := make(map[string]int, len(messages))
+	lastUser := make(map[string]string)
+	for _, message := range messages {
+		parent := message.ParentID
+		if parent == "" && message.Type != "user" {
+			parent = lastUser[message.SessionID]
+		}
+		if i, ok := threadOf[parent]; ok && parent != "" {
+			threads[i].Replies = append(threads[i].Replies, message)
+			threadOf[message.ID] = i
+		} else {
+			threadOf[message.ID] = len(threads)
+			threads = append(threads, MessageThread{Root: message})
+		}
+		if message.Type == "user" {
+			lastUser[message.SessionID] = message.ID
+		}
+	}
+	return threads
+}
+
+// FindThread returns the thread of messages that messageID belongs to
+func FindThread(messages []MessageInfo, messageID string) (MessageThread, bool) {
+	for _, thread := range GroupThreads(messages) {
+		if thread.Root.ID == messageID {
+			return thread, true
+		}
+		for _, reply := range thread.Replies {
+			if reply.ID == messageID {
+				return thread, true
+			}
+		}
+	}
+	return MessageThread{}, false
+}
@@ -0,0 +1,59 @@
+package types
+
+import "testing"
+
+func TestGroupThreads(t *testing.T) {
+	msg := func(id, session, typ, parent string) MessageInfo {
+		return MessageInfo{ID: id, SessionID: session, Type: typ, ParentID: parent}
+	}
+	messages := []MessageInfo{
+		msg("note", "s1", "system", ""),
+		msg("u1", "s1", "user", ""),
+		msg("a1", "s1", "assistant", ""),
+		msg("u2", "s2", "user", ""),
+		msg("tool", "s1", "assistant", ""),
+		msg("u3", "s1", "user", ""),
+		msg("late", "s1", "assistant", "u1"),
+		msg("a3", "s1", "assistant", ""),
+		msg("orphan", "s1", "assistant", "gone"),
+	}
+
+	threads := GroupThreads(messages)
+	got := make(map[string][]string)
+	var roots []string
+	for _, thread := range threads {
+		roots = append(roots, thread.ID())
+		for _, reply := range thread.Replies {
+			got[thread.ID()] = append(got[thread.ID()], reply.ID)
+		}
+	}
+	want := map[string][]string{
+		"u1": {"a1", "tool", "late"},
+		"u3": {"a3"},
+	}
+	if len(roots) != 5 || roots[0] != "note" || roots[1] != "u1" || roots[2] != "u2" || roots[3] != "u3" || roots[4] != "orphan" {
+		t.Errorf("thread roots = %v", roots)
+	}
+	for root, replies := range want {
+		if len(got[root]) != len(replies) {
+			t.Errorf("replies of %s = %v, want %v", root, got[root], replies)
+			continue
+		}
+		for i := range replies {
+			if got[root][i] != replies[i] {
+				t.Errorf("replies of %s = %v, want %v", root, got[root], replies)
+				break
+			}
+		}
+	}
+
+	if thread, ok := FindThread(messages, "tool"); !ok || thread.ID() != "u1" {
+		t.Errorf("FindThread(tool) = %s, %v", thread.ID(), ok)
+	}
+	if parent := ThreadParentID(messages[:5], msg("next", "s1", "assistant", "")); parent != "u1" {
+		t.Errorf("ThreadParentID() = %q, want u1", parent)
+	}
+	if parent := ThreadParentID(messages, msg("u4", "s1", "user", "")); parent != "" {
+		t.Errorf("ThreadParentID() of a user message = %q", parent)
+	}
+}
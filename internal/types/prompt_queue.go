@@ -0,0 +1,78 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+// QueuedPrompt is a prompt waiting for the runs of its session to finish.
+// The orchestrator submits a session's queued prompts one at a time, in
+// queue order, whenever the session has no run in flight.
+type QueuedPrompt struct {
+	ID        string    `json:"id"`
+	SessionID string    `json:"session_id"`
+	Text      string    `json:"text"`
+	QueuedBy  string    `json:"queued_by,omitempty"` // Panel that queued it
+	QueuedAt  time.Time `json:"queued_at"`
+}
+
+// Reasons a prompt leaves the queue
+const (
+	DequeueSubmitted = "submitted" // Sent to the assistant
+	DequeueEdited    = "edited"    // Taken back into the input to be edited
+	DequeueRemoved   = "removed"   // Dropped by the user
+)
+
+// PromptsQueuedFor returns the prompts queued for a session, in queue order
+func PromptsQueuedFor(queue []QueuedPrompt, sessionID string) []QueuedPrompt {
+	var queued []QueuedPrompt
+	for _, prompt := range queue {
+		if prompt.SessionID == sessionID {
+			queued = append(queued, prompt)
+		}
+	}
+	return queued
+}
+
+// ReorderPromptQueue moves one queued prompt directly before or after
+// another and returns the queue in its new order. Both prompts must be
+// queued for the same session.
+func ReorderPromptQueue(queue []QueuedPrompt, move PromptQueueReorderPayload) ([]QueuedPrompt, error) {
+	if (move.Before == "") == (move.After == "") {
+		return nil, fmt.Errorf("reorder of queued prompt %s needs exactly one of before and after", move.PromptID)
+	}
+	anchor := move.Before + move.After
+	if anchor == move.PromptID {
+		return nil, fmt.Errorf("cannot move queued prompt %s next to itself", move.PromptID)
+	}
+
+	var moved *QueuedPrompt
+	rest := make([]QueuedPrompt, 0, len(queue))
+	for i := range queue {
+		if queue[i].ID == move.PromptID {
+			moved = &queue[i]
+		} else {
+			rest = append(rest, queue[i])
+		}
+	}
+	if moved == nil {
+		return nil, fmt.Errorf("queued prompt %s not found", move.PromptID)
+	}
+
+	for i, prompt := range rest {
+		if prompt.ID != anchor {
+			continue
+		}
+		if prompt.SessionID != moved.SessionID {
+			return nil, fmt.Errorf("queued prompts %s and %s belong to different sessions", move.PromptID, anchor)
+		}
+		if move.After != "" {
+			i++
+		}
+		reordered := make([]QueuedPrompt, 0, len(queue))
+		reordered = append(reordered, rest[:i]...)
+		reordered = append(reordered, *moved)
+		return append(reordered, rest[i:]...), nil
+	}
+	return nil, fmt.Errorf("queued prompt %s not found", anchor)
+}
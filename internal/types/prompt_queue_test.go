@@ -0,0 +1,62 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func queuedIDs(queue []QueuedPrompt) string {
+	ids := make([]string, len(queue))
+	for i, prompt := range queue {
+		ids[i] = prompt.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestReorderPromptQueue(t *testing.T) {
+	queue := []QueuedPrompt{
+		{ID: "a", SessionID: "s1"},
+		{ID: "b", SessionID: "s1"},
+		{ID: "x", SessionID: "s2"},
+		{ID: "c", SessionID: "s1"},
+	}
+	tests := []struct {
+		name    string
+		move    PromptQueueReorderPayload
+		want    string
+		wantErr bool
+	}{
+		{name: "before", move: PromptQueueReorderPayload{PromptID: "c", Before: "a"}, want: "c,a,b,x"},
+		{name: "after", move: PromptQueueReorderPayload{PromptID: "a", After: "c"}, want: "b,x,c,a"},
+		{name: "in place", move: PromptQueueReorderPayload{PromptID: "b", After: "a"}, want: "a,b,x,c"},
+		{name: "other session", move: PromptQueueReorderPayload{PromptID: "a", Before: "x"}, wantErr: true},
+		{name: "no anchor", move: PromptQueueReorderPayload{PromptID: "a"}, wantErr: true},
+		{name: "both anchors", move: PromptQueueReorderPayload{PromptID: "a", Before: "b", After: "c"}, wantErr: true},
+		{name: "itself", move: PromptQueueReorderPayload{PromptID: "a", Before: "a"}, wantErr: true},
+		{name: "unknown prompt", move: PromptQueueReorderPayload{PromptID: "z", Before: "a"}, wantErr: true},
+		{name: "unknown anchor", move: PromptQueueReorderPayload{PromptID: "a", Before: "z"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ReorderPromptQueue(queue, tt.move)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: ReorderPromptQueue() = %s, want error", tt.name, queuedIDs(got))
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: ReorderPromptQueue() error = %v", tt.name, err)
+			continue
+		}
+		if ids := queuedIDs(got); ids != tt.want {
+			t.Errorf("%s: ReorderPromptQueue() = %s, want %s", tt.name, ids, tt.want)
+		}
+	}
+	if ids := queuedIDs(queue); ids != "a,b,x,c" {
+		t.Errorf("ReorderPromptQueue() changed its input to %s", ids)
+	}
+
+	if got := queuedIDs(PromptsQueuedFor(queue, "s1")); got != "a,b,c" {
+		t.Errorf("PromptsQueuedFor(s1) = %s, want a,b,c", got)
+	}
+}
@@ -0,0 +1,92 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// MinScheduleInterval is the shortest interval a prompt can recur at
+const MinScheduleInterval = time.Minute
+
+// ScheduledPrompt is a stored prompt the orchestrator submits at NextRun, and
+// every Every after that when Every is set. It is queued like a prompt sent
+// while a run is in flight, so it waits for the session's runs to finish.
+type ScheduledPrompt struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+	// SessionID is the session the prompt goes to; empty means the session
+	// that is current when it runs
+	SessionID string        `json:"session_id,omitempty"`
+	Text      string        `json:"text"`
+	NextRun   time.Time     `json:"next_run"`
+	Every     time.Duration `json:"every,omitempty"` // Zero runs the prompt once
+	CreatedAt time.Time     `json:"created_at"`
+	LastRun   time.Time     `json:"last_run,omitempty"`
+	Runs      int           `json:"runs,omitempty"`
+}
+
+// Validate reports what keeps the schedule from running
+func (s ScheduledPrompt) Validate() error {
+	switch {
+	case s.ID == "":
+		return fmt.Errorf("scheduled prompt needs an id")
+	case strings.TrimSpace(s.Text) == "":
+		return fmt.Errorf("scheduled prompt %s has no text", s.ID)
+	case s.NextRun.IsZero():
+		return fmt.Errorf("scheduled prompt %s has no run time", s.ID)
+	case s.Every < 0 || (s.Every > 0 && s.Every < MinScheduleInterval):
+		return fmt.Errorf("scheduled prompt %s recurs every %s; the shortest interval is %s", s.ID, s.Every, MinScheduleInterval)
+	}
+	return nil
+}
+
+// Due reports whether the prompt should run at now
+func (s ScheduledPrompt) Due(now time.Time) bool {
+	return !s.NextRun.After(now)
+}
+
+// Following returns when the prompt runs next after running at ran: the
+// first interval after ran, so runs missed while nothing was running are
+// skipped rather than made up. It is zero for a prompt that runs once.
+func (s ScheduledPrompt) Following(ran time.Time) time.Time {
+	if s.Every <= 0 {
+		return time.Time{}
+	}
+	next := s.NextRun
+	if !next.After(ran) {
+		missed := ran.Sub(next) / s.Every
+		next = next.Add((missed + 1) * s.Every)
+	}
+	return next
+}
+
+// ParseScheduleTime reads when a prompt should first run, relative to now:
+// a clock time such as "18:00", meaning its next occurrence; a date and time
+// such as "2025-06-01 09:30" in now's location, or RFC 3339; or a delay such
+// as "30m"
+func ParseScheduleTime(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if delay, err := time.ParseDuration(strings.TrimPrefix(value, "+")); err == nil {
+		if delay < 0 {
+			return time.Time{}, fmt.Errorf("schedule time %q is in the past", value)
+		}
+		return now.Add(delay), nil
+	}
+	if clock, err := time.ParseInLocation("15:04", value, now.Location()); err == nil {
+		at := time.Date(now.Year(), now.Month(), now.Day(), clock.Hour(), clock.Minute(), 0, 0, now.Location())
+		if !at.After(now) {
+			at = at.AddDate(0, 0, 1)
+		}
+		return at, nil
+	}
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+	for _, layout := range []string{"2006-01-02 15:04", "2006-01-02T15:04"} {
+		if at, err := time.ParseInLocation(layout, value, now.Location()); err == nil {
+			return at, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid schedule time %q: use HH:MM, YYYY-MM-DD HH:MM, RFC 3339 or a delay such as 30m", value)
+}
@@ -0,0 +1,71 @@
+package types
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduledPromptFollowing(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2025, 6, 1, hour, minute, 0, 0, time.UTC) }
+	daily := ScheduledPrompt{NextRun: at(18, 0), Every: 24 * time.Hour}
+
+	if got := daily.Following(at(18, 0)); !got.Equal(at(18, 0).AddDate(0, 0, 1)) {
+		t.Errorf("Following() on time = %v, want the next day", got)
+	}
+	// Three days missed: the next run is still at 18:00, not made up
+	if got := daily.Following(at(18, 5).AddDate(0, 0, 3)); !got.Equal(at(18, 0).AddDate(0, 0, 4)) {
+		t.Errorf("Following() after missed runs = %v, want 18:00 four days later", got)
+	}
+	once := ScheduledPrompt{NextRun: at(18, 0)}
+	if got := once.Following(at(18, 0)); !got.IsZero() {
+		t.Errorf("Following() of a one-off prompt = %v, want zero", got)
+	}
+	if !daily.Due(at(18, 0)) || daily.Due(at(17, 59)) {
+		t.Error("Due() wrong around the run time")
+	}
+}
+
+func TestScheduledPromptValidate(t *testing.T) {
+	valid := ScheduledPrompt{ID: "s1", Text: "summarize", NextRun: time.Now()}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Validate() = %v", err)
+	}
+	for name, s := range map[string]ScheduledPrompt{
+		"no id":     {Text: "x", NextRun: time.Now()},
+		"no text":   {ID: "s1", Text: " ", NextRun: time.Now()},
+		"no time":   {ID: "s1", Text: "x"},
+		"too often": {ID: "s1", Text: "x", NextRun: time.Now(), Every: time.Second},
+		"negative":  {ID: "s1", Text: "x", NextRun: time.Now(), Every: -time.Hour},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%s) succeeded", name)
+		}
+	}
+}
+
+func TestParseScheduleTime(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value string
+		want  time.Time
+	}{
+		{"18:00", time.Date(2025, 6, 1, 18, 0, 0, 0, time.UTC)},
+		{"09:30", time.Date(2025, 6, 2, 9, 30, 0, 0, time.UTC)},
+		{"12:00", time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)},
+		{"30m", now.Add(30 * time.Minute)},
+		{"+2h", now.Add(2 * time.Hour)},
+		{"2025-06-03 08:15", time.Date(2025, 6, 3, 8, 15, 0, 0, time.UTC)},
+		{"2025-06-03T08:15:00Z", time.Date(2025, 6, 3, 8, 15, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := ParseScheduleTime(tt.value, now)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("ParseScheduleTime(%q) = %v, %v; want %v", tt.value, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"6pm", "-5m", "25:00", ""} {
+		if _, err := ParseScheduleTime(bad, now); err == nil {
+			t.Errorf("ParseScheduleTime(%q) succeeded", bad)
+		}
+	}
+}
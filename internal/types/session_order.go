@@ -0,0 +1,145 @@
+package types
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SessionSortMode chooses how the sessions list is ordered
+type SessionSortMode string
+
+const (
+	SessionSortManual       SessionSortMode = "manual"       // The order sessions were added in, as rearranged by SessionReordered
+	SessionSortRecent       SessionSortMode = "recent"       // Most recently active first
+	SessionSortCreated      SessionSortMode = "created"      // Newest first
+	SessionSortAlphabetical SessionSortMode = "alphabetical" // By title, ignoring case
+)
+
+// SessionSortModes lists the sort modes in the order panels cycle through them
+var SessionSortModes = []SessionSortMode{SessionSortManual, SessionSortRecent, SessionSortCreated, SessionSortAlphabetical}
+
+// Valid reports whether m is a known sort mode; empty means manual
+func (m SessionSortMode) Valid() bool {
+	if m == "" {
+		return true
+	}
+	for _, mode := range SessionSortModes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Next returns the mode after m in SessionSortModes, wrapping around
+func (m SessionSortMode) Next() SessionSortMode {
+	for i, mode := range SessionSortModes {
+		if m == mode {
+			return SessionSortModes[(i+1)%len(SessionSortModes)]
+		}
+	}
+	return SessionSortModes[1]
+}
+
+// SessionOrder is how every panel orders the sessions list. The zero value
+// keeps sessions in manual order with pinned sessions mixed in, and shows
+// only the sessions of the current workspace.
+type SessionOrder struct {
+	Mode          SessionSortMode `json:"mode,omitempty"`
+	PinnedFirst   bool            `json:"pinned_first,omitempty"`
+	AllWorkspaces bool            `json:"all_workspaces,omitempty"`
+}
+
+// SortSessions returns a copy of sessions, which are in manual order, in the
+// given order. Sessions that compare equal keep their manual order.
+func SortSessions(sessions []SessionInfo, order SessionOrder) []SessionInfo {
+	sorted := append([]SessionInfo(nil), sessions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if order.PinnedFirst && a.Pinned != b.Pinned {
+			return a.Pinned
+		}
+		switch order.Mode {
+		case SessionSortRecent:
+			return a.UpdatedAt.After(b.UpdatedAt)
+		case SessionSortCreated:
+			return a.CreatedAt.After(b.CreatedAt)
+		case SessionSortAlphabetical:
+			return strings.ToLower(a.Title) < strings.ToLower(b.Title)
+		}
+		return false
+	})
+	return sorted
+}
+
+// ReorderSessions moves one session next to another, as a user dragging it
+// in the list would. sessions are in manual order and the move is made
+// against the order they are shown in, which becomes the new manual order.
+// It returns the sessions in their new manual order.
+func ReorderSessions(sessions []SessionInfo, order SessionOrder, move SessionReorderPayload) ([]SessionInfo, error) {
+	if (move.Before == "") == (move.After == "") {
+		return nil, fmt.Errorf("reorder of session %s needs exactly one of before and after", move.SessionID)
+	}
+	anchor := move.Before + move.After
+	if anchor == move.SessionID {
+		return nil, fmt.Errorf("cannot move session %s next to itself", move.SessionID)
+	}
+
+	shown := SortSessions(sessions, order)
+	var moved *SessionInfo
+	rest := make([]SessionInfo, 0, len(shown))
+	for i := range shown {
+		if shown[i].ID == move.SessionID {
+			moved = &shown[i]
+		} else {
+			rest = append(rest, shown[i])
+		}
+	}
+	if moved == nil {
+		return nil, fmt.Errorf("session %s not found", move.SessionID)
+	}
+
+	for i, session := range rest {
+		if session.ID != anchor {
+			continue
+		}
+		if move.After != "" {
+			i++
+		}
+		reordered := make([]SessionInfo, 0, len(shown))
+		reordered = append(reordered, rest[:i]...)
+		reordered = append(reordered, *moved)
+		return append(reordered, rest[i:]...), nil
+	}
+	return nil, fmt.Errorf("session %s not found", anchor)
+}
+
+// SessionsInWorkspace returns the sessions of workspace, keeping their order.
+// Sessions with no recorded workspace predate workspace tracking and are
+// kept; an empty workspace keeps every session.
+func SessionsInWorkspace(sessions []SessionInfo, workspace string) []SessionInfo {
+	kept := make([]SessionInfo, 0, len(sessions))
+	for _, session := range sessions {
+		if workspace == "" || session.Workspace == "" || SameWorkspace(session.Workspace, workspace) {
+			kept = append(kept, session)
+		}
+	}
+	return kept
+}
+
+// SameWorkspace reports whether two workspace paths name the same directory
+func SameWorkspace(a, b string) bool {
+	return filepath.Clean(a) == filepath.Clean(b)
+}
+
+// ShownSessions returns the sessions a list in the given order shows while
+// workspace is current: sorted, and limited to that workspace unless the
+// order asks for every workspace
+func ShownSessions(sessions []SessionInfo, order SessionOrder, workspace string) []SessionInfo {
+	if !order.AllWorkspaces {
+		sessions = SessionsInWorkspace(sessions, workspace)
+	}
+	return SortSessions(sessions, order)
+}
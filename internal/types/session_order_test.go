@@ -0,0 +1,142 @@
+package types
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func orderSessions() []SessionInfo {
+	at := func(minutes int) time.Time { return time.Date(2025, 1, 1, 9, minutes, 0, 0, time.UTC) }
+	// Manual order: a, b, c, d
+	return []SessionInfo{
+		{ID: "a", Title: "delta", CreatedAt: at(0), UpdatedAt: at(30)},
+		{ID: "b", Title: "Alpha", CreatedAt: at(10), UpdatedAt: at(10), Pinned: true},
+		{ID: "c", Title: "charlie", CreatedAt: at(20), UpdatedAt: at(40)},
+		{ID: "d", Title: "bravo", CreatedAt: at(5), UpdatedAt: at(15), Pinned: true},
+	}
+}
+
+func sessionIDs(sessions []SessionInfo) string {
+	ids := make([]string, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestSortSessions(t *testing.T) {
+	tests := []struct {
+		order SessionOrder
+		want  string
+	}{
+		{order: SessionOrder{}, want: "a,b,c,d"},
+		{order: SessionOrder{Mode: SessionSortManual}, want: "a,b,c,d"},
+		{order: SessionOrder{Mode: SessionSortRecent}, want: "c,a,d,b"},
+		{order: SessionOrder{Mode: SessionSortCreated}, want: "c,b,d,a"},
+		{order: SessionOrder{Mode: SessionSortAlphabetical}, want: "b,d,c,a"},
+		{order: SessionOrder{PinnedFirst: true}, want: "b,d,a,c"},
+		{order: SessionOrder{Mode: SessionSortRecent, PinnedFirst: true}, want: "d,b,c,a"},
+	}
+	for _, tt := range tests {
+		sessions := orderSessions()
+		if got := sessionIDs(SortSessions(sessions, tt.order)); got != tt.want {
+			t.Errorf("SortSessions(%+v) = %s, want %s", tt.order, got, tt.want)
+		}
+		if got := sessionIDs(sessions); got != "a,b,c,d" {
+			t.Errorf("SortSessions(%+v) changed its input to %s", tt.order, got)
+		}
+	}
+}
+
+func TestReorderSessions(t *testing.T) {
+	tests := []struct {
+		name    string
+		order   SessionOrder
+		move    SessionReorderPayload
+		want    string
+		wantErr bool
+	}{
+		{name: "before", move: SessionReorderPayload{SessionID: "c", Before: "a"}, want: "c,a,b,d"},
+		{name: "after", move: SessionReorderPayload{SessionID: "a", After: "c"}, want: "b,c,a,d"},
+		{name: "after last", move: SessionReorderPayload{SessionID: "b", After: "d"}, want: "a,c,d,b"},
+		{
+			// The shown order becomes the manual order before the move
+			name:  "from sorted",
+			order: SessionOrder{Mode: SessionSortRecent},
+			move:  SessionReorderPayload{SessionID: "b", Before: "a"},
+			want:  "c,b,a,d",
+		},
+		{
+			name:  "within pinned",
+			order: SessionOrder{PinnedFirst: true},
+			move:  SessionReorderPayload{SessionID: "d", Before: "b"},
+			want:  "d,b,a,c",
+		},
+		{name: "unknown session", move: SessionReorderPayload{SessionID: "x", Before: "a"}, wantErr: true},
+		{name: "unknown anchor", move: SessionReorderPayload{SessionID: "a", After: "x"}, wantErr: true},
+		{name: "no anchor", move: SessionReorderPayload{SessionID: "a"}, wantErr: true},
+		{name: "both anchors", move: SessionReorderPayload{SessionID: "a", Before: "b", After: "c"}, wantErr: true},
+		{name: "itself", move: SessionReorderPayload{SessionID: "a", Before: "a"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReorderSessions(orderSessions(), tt.order, tt.move)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ReorderSessions() = %s, want an error", sessionIDs(got))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReorderSessions() error = %v", err)
+			}
+			if ids := sessionIDs(got); ids != tt.want {
+				t.Errorf("ReorderSessions() = %s, want %s", ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSessionSortModeNext(t *testing.T) {
+	mode := SessionSortMode("")
+	var seen []string
+	for range SessionSortModes {
+		mode = mode.Next()
+		seen = append(seen, string(mode))
+	}
+	if got := strings.Join(seen, ","); got != "recent,created,alphabetical,manual" {
+		t.Errorf("cycled through %s", got)
+	}
+	if SessionSortMode("random").Valid() || !SessionSortMode("").Valid() {
+		t.Error("Valid() accepts unknown modes or rejects the default")
+	}
+}
+
+func TestShownSessions(t *testing.T) {
+	sessions := []SessionInfo{
+		{ID: "a", Title: "b", Workspace: "/src/app"},
+		{ID: "b", Title: "a", Workspace: "/src/lib"},
+		{ID: "c", Title: "c"}, // From before workspaces were recorded
+		{ID: "d", Title: "d", Workspace: "/src/app/"},
+	}
+	tests := []struct {
+		name      string
+		order     SessionOrder
+		workspace string
+		want      string
+	}{
+		{name: "this workspace", workspace: "/src/app", want: "a,c,d"},
+		{name: "other workspace", workspace: "/src/lib", want: "b,c"},
+		{name: "no workspace", want: "a,b,c,d"},
+		{name: "all workspaces", order: SessionOrder{AllWorkspaces: true}, workspace: "/src/app", want: "a,b,c,d"},
+		{name: "sorted", order: SessionOrder{Mode: SessionSortAlphabetical}, workspace: "/src/lib", want: "b,c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sessionIDs(ShownSessions(sessions, tt.order, tt.workspace)); got != tt.want {
+				t.Errorf("ShownSessions() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
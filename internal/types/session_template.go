@@ -0,0 +1,60 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SessionTemplate pre-configures new sessions for a kind of work, such as
+// code review or debugging. Sessions created from it keep its instructions,
+// which go with every prompt as system instructions, and its tags.
+type SessionTemplate struct {
+	Name         string   `json:"name"`
+	Title        string   `json:"title,omitempty"`        // Title of new sessions; the server names them when empty
+	Description  string   `json:"description,omitempty"`  // Shown in the picker
+	Instructions string   `json:"instructions,omitempty"` // System instructions sent with each prompt
+	Agent        string   `json:"agent,omitempty"`        // Agent selected when a session is created
+	Model        string   `json:"model,omitempty"`        // "provider/model" selected when a session is created
+	Tags         []string `json:"tags,omitempty"`
+}
+
+// Validate reports what keeps the template from being used
+func (t SessionTemplate) Validate() error {
+	name := strings.TrimSpace(t.Name)
+	if name == "" {
+		return fmt.Errorf("session template needs a name")
+	}
+	if strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("session template name %q cannot contain spaces", t.Name)
+	}
+	if t.Model != "" {
+		if _, err := ParseModelRef(t.Model); err != nil {
+			return fmt.Errorf("session template %s: %w", t.Name, err)
+		}
+	}
+	for _, tag := range t.Tags {
+		if strings.TrimSpace(tag) == "" {
+			return fmt.Errorf("session template %s has an empty tag", t.Name)
+		}
+	}
+	return nil
+}
+
+// FindSessionTemplate returns the template with the given name
+func FindSessionTemplate(templates []SessionTemplate, name string) (SessionTemplate, bool) {
+	for _, template := range templates {
+		if template.Name == name {
+			return template, true
+		}
+	}
+	return SessionTemplate{}, false
+}
+
+// NewSessionFromTemplate returns the session info of a session the server
+// created from template, carrying the template's instructions and tags
+func NewSessionFromTemplate(template SessionTemplate, info SessionInfo) SessionInfo {
+	info.Template = template.Name
+	info.Instructions = template.Instructions
+	info.Tags = append([]string(nil), template.Tags...)
+	return info
+}
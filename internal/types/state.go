@@ -1,10 +1,18 @@
 package types
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
+
+	"github.com/opencode/tmux_coder/internal/ids"
 
 	"github.com/sst/opencode-sdk-go"
 )
@@ -14,6 +22,8 @@ type StateVersion struct {
 	Version   int64     `json:"version"`
 	Timestamp time.Time `json:"timestamp"`
 	Source    string    `json:"source"` // panel identifier
+	// Clock is set only when vector-clock versioning is enabled for multi-writer setups
+	Clock VectorClock `json:"clock,omitempty"`
 }
 
 // SessionInfo represents session data shared across panels
@@ -24,17 +34,591 @@ type SessionInfo struct {
 	UpdatedAt    time.Time `json:"updated_at"`
 	MessageCount int       `json:"message_count"`
 	IsActive     bool      `json:"is_active"`
+	Pinned       bool      `json:"pinned,omitempty"`
+	// Where the session was started: the repository root, or the working
+	// directory outside a repository, and the branch checked out then
+	Workspace string `json:"workspace,omitempty"`
+	Branch    string `json:"branch,omitempty"`
+	// The template the session was created from, its system instructions,
+	// sent with every prompt, and its tags
+	Template     string   `json:"template,omitempty"`
+	Instructions string   `json:"instructions,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	// Native is the session info as the opencode server recorded it, kept
+	// from an import so exporting the session back loses nothing
+	Native json.RawMessage `json:"native,omitempty"`
 }
 
 // MessageInfo represents message data for cross-panel synchronization
 type MessageInfo struct {
-	ID        string               `json:"id"`
-	SessionID string               `json:"session_id"`
+	ID        string `json:"id"`
+	SessionID string `json:"session_id"`
+	// ParentID is the message this one answers, grouping tool call output
+	// and replies under the prompt that triggered them; see GroupThreads
+	ParentID  string               `json:"parent_id,omitempty"`
 	Type      string               `json:"type"` // "user", "assistant", "system"
 	Content   string               `json:"content"`
 	Timestamp time.Time            `json:"timestamp"`
-	Status    string               `json:"status"` // "pending", "completed", "error"
+	Status    string               `json:"status"` // "pending", "completed", "error", "cancelled"
 	Parts     []opencode.PartUnion `json:"parts,omitempty"`
+	// Large bodies and parts live in the blob store; Content or Parts is empty when set,
+	// unless Truncated says Content holds the start of the body behind BodyRef
+	BodyRef   string `json:"body_ref,omitempty"`
+	BodySize  int    `json:"body_size,omitempty"`
+	PartsRef  string `json:"parts_ref,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+	// CodeBlocks are the fenced code blocks of a completed assistant reply,
+	// extracted by the orchestrator; empty until then and when the body changes
+	CodeBlocks []CodeBlock `json:"code_blocks,omitempty"`
+	// Meta describes the full body, worked out by the state server as it arrives
+	Meta *ContentMeta `json:"meta,omitempty"`
+	// Native is the message, info and parts, as the opencode server recorded
+	// it, kept from an import; dropped when the body changes or is redacted
+	Native json.RawMessage `json:"native,omitempty"`
+	// NativeRef replaces a large Native record with a stored blob
+	NativeRef string `json:"native_ref,omitempty"`
+	// Agent is the opencode agent that answered, for assistant replies; empty
+	// when the server did not say
+	Agent string `json:"agent,omitempty"`
+}
+
+// DecodeParts decodes a JSON list of message parts, such as an offloaded parts
+// blob; PartUnion is an interface, so each part goes through opencode.Part
+func DecodeParts(data []byte) ([]opencode.PartUnion, error) {
+	var raw []opencode.Part
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	parts := make([]opencode.PartUnion, len(raw))
+	for i, part := range raw {
+		parts[i] = part.AsUnion()
+	}
+	return parts, nil
+}
+
+// ContentPreview returns the start of content, at most size bytes cut at a
+// line or character boundary, followed by a marker saying how much is left out
+func ContentPreview(content string, size int) string {
+	if len(content) <= size {
+		return content
+	}
+	cut := size
+	for cut > 0 && !utf8.RuneStart(content[cut]) {
+		cut--
+	}
+	if newline := strings.LastIndexByte(content[:cut], '\n'); newline > cut/2 {
+		cut = newline
+	}
+	return fmt.Sprintf("%s\n\n[… %d more bytes not shown; load the full content to see them]", content[:cut], len(content)-cut)
+}
+
+// AnnotationKind identifies the kind of user annotation attached to a message
+type AnnotationKind string
+
+const (
+	AnnotationNote   AnnotationKind = "note"
+	AnnotationRating AnnotationKind = "rating"
+	AnnotationTodo   AnnotationKind = "todo"
+)
+
+// Valid reports whether k is a known annotation kind
+func (k AnnotationKind) Valid() bool {
+	switch k {
+	case AnnotationNote, AnnotationRating, AnnotationTodo:
+		return true
+	}
+	return false
+}
+
+// MessageAnnotation represents a user review note attached to a message
+type MessageAnnotation struct {
+	ID        string         `json:"id"`
+	MessageID string         `json:"message_id"`
+	SessionID string         `json:"session_id"`
+	Kind      AnnotationKind `json:"kind"`
+	Content   string         `json:"content,omitempty"`
+	Rating    int            `json:"rating,omitempty"` // +1 thumbs up, -1 thumbs down
+	Done      bool           `json:"done,omitempty"`   // only meaningful for todo markers
+	Author    string         `json:"author"`           // panel identifier
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// GitFileStatus is one changed path in the working tree
+type GitFileStatus struct {
+	Path     string `json:"path"`
+	Status   string `json:"status"`              // Porcelain XY code: index then worktree, e.g. ".M", "A.", "??"
+	OrigPath string `json:"orig_path,omitempty"` // Source of a rename or copy
+}
+
+// Link statuses, from best to worst
+const (
+	LinkOnline   = "online"
+	LinkDegraded = "degraded" // Reachable but slow, failing intermittently or quiet
+	LinkOffline  = "offline"
+)
+
+// Link kinds
+const (
+	LinkServer = "server" // The opencode server
+	LinkIPC    = "ipc"    // A panel's socket connection to the orchestrator
+)
+
+// LinkState is the health of one connection as last probed
+type LinkState struct {
+	Name     string        `json:"name"` // "server" or the panel ID
+	Kind     string        `json:"kind"`
+	Status   string        `json:"status"`
+	Latency  time.Duration `json:"latency,omitempty"`  // Of the last successful probe
+	Failures int           `json:"failures,omitempty"` // Consecutive failed probes
+	Error    string        `json:"error,omitempty"`
+	LastOK   time.Time     `json:"last_ok,omitempty"`
+	Since    time.Time     `json:"since"` // When Status last changed
+}
+
+// ConnectionState is the health of the opencode server link and of each
+// panel's IPC link. Status follows the server; it is degraded while the
+// server is online but a panel link is not.
+type ConnectionState struct {
+	Status    string      `json:"status"`
+	Server    LinkState   `json:"server"`
+	Panels    []LinkState `json:"panels,omitempty"` // Sorted by name
+	CheckedAt time.Time   `json:"checked_at"`
+}
+
+// Clone returns a deep copy; nil stays nil
+func (c *ConnectionState) Clone() *ConnectionState {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.Panels = append([]LinkState(nil), c.Panels...)
+	return &clone
+}
+
+// Online reports whether the opencode server answers
+func (c *ConnectionState) Online() bool {
+	return c == nil || c.Server.Status != LinkOffline
+}
+
+// LinkTransition records a link changing status; From is empty for a link
+// seen for the first time
+type LinkTransition struct {
+	Name  string    `json:"name"`
+	Kind  string    `json:"kind"`
+	From  string    `json:"from"`
+	To    string    `json:"to"`
+	Error string    `json:"error,omitempty"`
+	At    time.Time `json:"at"`
+}
+
+// GitState describes the workspace repository
+type GitState struct {
+	Root     string `json:"root"`
+	Branch   string `json:"branch"`             // Empty when HEAD is detached
+	Head     string `json:"head"`               // Commit of HEAD; empty before the first commit
+	Upstream string `json:"upstream,omitempty"` // Tracking branch, e.g. "origin/main"
+	Ahead    int    `json:"ahead"`
+	Behind   int    `json:"behind"`
+	// Files lists changed paths, capped; FileCount is the full count
+	Files     []GitFileStatus `json:"files,omitempty"`
+	FileCount int             `json:"file_count"`
+	UpdatedAt time.Time       `json:"updated_at"`
+}
+
+// Dirty reports whether the working tree or index has changes
+func (g *GitState) Dirty() bool {
+	return g.FileCount > 0
+}
+
+// Clone returns a deep copy
+func (g *GitState) Clone() *GitState {
+	if g == nil {
+		return nil
+	}
+	clone := *g
+	clone.Files = append([]GitFileStatus(nil), g.Files...)
+	return &clone
+}
+
+// File diff statuses
+const (
+	FileDiffPending  = "pending"
+	FileDiffAccepted = "accepted"
+	FileDiffReverted = "reverted"
+	// FileDiffDiscarded is a proposed change turned down before it was written
+	FileDiffDiscarded = "discarded"
+)
+
+// MaxFileDiffs caps the diffs kept in state; the oldest are dropped first
+const MaxFileDiffs = 20
+
+// FileDiff is the change to one file
+type FileDiff struct {
+	Path   string `json:"path"`   // Relative to the repository root when Source is "git"
+	Patch  string `json:"patch"`  // Unified diff; empty when nothing is left to show
+	Source string `json:"source"` // "git" when read from the working tree, "patch" when taken from the tool call, "proposal" for a change not made yet
+}
+
+// FileDiffSet is the file changes made by one assistant tool call
+type FileDiffSet struct {
+	ID        string     `json:"id"` // ID of the message part that made the change
+	SessionID string     `json:"session_id"`
+	MessageID string     `json:"message_id"`
+	Tool      string     `json:"tool"`
+	Files     []FileDiff `json:"files"`
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"` // Why the last accept or revert failed
+	CreatedAt time.Time  `json:"created_at"`
+	// Proposal is set for a change not made yet: accepting it writes the
+	// files, reverting it discards the change
+	Proposal *CodeBlockProposal `json:"proposal,omitempty"`
+}
+
+// CodeBlockProposal is a code block of a message offered as the new content of a file
+type CodeBlockProposal struct {
+	MessageID string `json:"message_id"`
+	Index     int    `json:"index"`
+	Path      string `json:"path"`      // Relative to the workspace
+	BaseHash  string `json:"base_hash"` // Hash of the file when previewed; empty when it did not exist
+	CodeHash  string `json:"code_hash"` // Hash of the content previewed; only that content is written
+}
+
+// Clone returns a deep copy
+func (d FileDiffSet) Clone() FileDiffSet {
+	d.Files = append([]FileDiff(nil), d.Files...)
+	if d.Proposal != nil {
+		proposal := *d.Proposal
+		d.Proposal = &proposal
+	}
+	return d
+}
+
+// Agent run statuses
+const (
+	AgentRunRunning   = "running"
+	AgentRunCompleted = "completed"
+	AgentRunFailed    = "failed"
+	AgentRunCancelled = "cancelled"
+)
+
+// MaxAgentRuns caps the runs kept in state; the oldest finished runs are dropped first
+const MaxAgentRuns = 50
+
+// AgentRun is one prompt being answered by the assistant. Several can be in
+// flight at once, in the same or different sessions.
+type AgentRun struct {
+	ID              string `json:"id"`
+	SessionID       string `json:"session_id"`
+	ParentMessageID string `json:"parent_message_id,omitempty"` // User message that started the run, once known
+	MessageID       string `json:"message_id,omitempty"`        // Assistant reply, once known
+	Status          string `json:"status"`
+	Owner           string `json:"owner"` // Panel or component holding the request
+	// CancelToken lets the owner find the request to cancel when a
+	// cancellation is recorded, even across a restart that reuses run IDs
+	CancelToken string    `json:"cancel_token"`
+	Error       string    `json:"error,omitempty"` // Why the run failed or was cancelled
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at,omitempty"`
+	// Attempts made under the model policy, in order; empty until one ends
+	Attempts []RunAttempt `json:"attempts,omitempty"`
+}
+
+// Context usage levels, by percentage of the model's context window used
+const (
+	ContextLevelOK       = ""
+	ContextLevelWarning  = "warning"  // At least ContextWarningPercent
+	ContextLevelCritical = "critical" // At least ContextCriticalPercent
+)
+
+const (
+	ContextWarningPercent  = 80
+	ContextCriticalPercent = 95
+)
+
+// ContextUsage is how much of the selected model's context window the current
+// conversation takes
+type ContextUsage struct {
+	SessionID string   `json:"session_id"`
+	Model     ModelRef `json:"model"`
+	Tokens    int      `json:"tokens"`
+	Limit     int      `json:"limit"` // Context window of the model; 0 when unknown
+	// Estimated is set when part of Tokens is guessed from text length rather
+	// than reported by the provider
+	Estimated bool      `json:"estimated,omitempty"`
+	Level     string    `json:"level,omitempty"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Percent returns the share of the context window used, 0 when the limit is unknown
+func (u ContextUsage) Percent() float64 {
+	if u.Limit <= 0 {
+		return 0
+	}
+	return float64(u.Tokens) * 100 / float64(u.Limit)
+}
+
+// SessionCompaction records one summarization of a session: the messages it
+// archived and the context they took before and after
+type SessionCompaction struct {
+	SessionID    string    `json:"session_id"`
+	SummaryID    string    `json:"summary_id"`   // Assistant message holding the summary
+	ArchivedIDs  []string  `json:"archived_ids"` // Messages moved to the archive, oldest first
+	TokensBefore int       `json:"tokens_before"`
+	TokensAfter  int       `json:"tokens_after"`
+	CompactedAt  time.Time `json:"compacted_at"`
+}
+
+// ContextLevel returns the usage level for a percentage
+func ContextLevel(percent float64) string {
+	switch {
+	case percent >= ContextCriticalPercent:
+		return ContextLevelCritical
+	case percent >= ContextWarningPercent:
+		return ContextLevelWarning
+	}
+	return ContextLevelOK
+}
+
+// ModelRef names a provider model; the zero value is the server's default
+type ModelRef struct {
+	ProviderID string `json:"provider_id"`
+	ModelID    string `json:"model_id"`
+}
+
+// ParseModelRef parses "provider/model"
+func ParseModelRef(s string) (ModelRef, error) {
+	provider, model, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok || provider == "" || model == "" {
+		return ModelRef{}, fmt.Errorf("model %q is not provider/model", s)
+	}
+	return ModelRef{ProviderID: provider, ModelID: model}, nil
+}
+
+// IsZero reports whether the reference leaves the model to the server
+func (m ModelRef) IsZero() bool {
+	return m.ProviderID == "" && m.ModelID == ""
+}
+
+func (m ModelRef) String() string {
+	if m.IsZero() {
+		return "default model"
+	}
+	return m.ProviderID + "/" + m.ModelID
+}
+
+// ModelPolicy says how a run reacts to provider errors that may pass, such as
+// rate limits and timeouts
+type ModelPolicy struct {
+	MaxRetries int           `json:"max_retries"` // Retries on each model before moving on
+	Backoff    time.Duration `json:"backoff"`     // Wait before the first retry on a model; doubles with each retry
+	Fallbacks  []ModelRef    `json:"fallbacks,omitempty"`
+}
+
+// Attempt outcomes
+const (
+	AttemptSucceeded = "succeeded"
+	AttemptRetry     = "retry"    // Failed; the same model is tried again
+	AttemptFallback  = "fallback" // Failed; the next fallback model is tried
+	AttemptFailed    = "failed"   // Failed; the run gives up
+)
+
+// RunAttempt is one try of a run's prompt on one model
+type RunAttempt struct {
+	Number     int       `json:"number"` // From 1
+	Model      ModelRef  `json:"model"`
+	Outcome    string    `json:"outcome"`
+	Reason     string    `json:"reason,omitempty"` // Error class when the failure may pass: rate_limit, timeout or overloaded
+	Error      string    `json:"error,omitempty"`
+	Next       *ModelRef `json:"next,omitempty"` // Model tried next on fallback
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// NewAgentRun returns a running run with a fresh ID and cancel token
+func NewAgentRun(sessionID, owner string) AgentRun {
+	token := make([]byte, 16)
+	rand.Read(token)
+	return AgentRun{
+		ID:          ids.New("run"),
+		SessionID:   sessionID,
+		Status:      AgentRunRunning,
+		Owner:       owner,
+		CancelToken: hex.EncodeToString(token),
+		StartedAt:   time.Now().UTC(),
+	}
+}
+
+// Terminal run statuses
+const (
+	TerminalRunRunning   = "running"
+	TerminalRunSucceeded = "succeeded"
+	TerminalRunFailed    = "failed"
+)
+
+// MaxTerminalRuns caps the runs kept in state; the oldest are dropped first
+const MaxTerminalRuns = 20
+
+// TerminalRun is a shell command run in its own tmux pane. Its output is
+// streamed into the transcript as the message named by MessageID.
+type TerminalRun struct {
+	ID         string    `json:"id"`
+	SessionID  string    `json:"session_id"`
+	MessageID  string    `json:"message_id"`
+	Command    string    `json:"command"`
+	Dir        string    `json:"dir,omitempty"`
+	PaneID     string    `json:"pane_id"`
+	Status     string    `json:"status"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"` // Why the run ended without an exit status
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+}
+
+// FileTreeState is the workspace file browser: which directories are open,
+// the path under the cursor and the files to attach to the next prompt. Paths
+// are absolute and inside one of the roots.
+type FileTreeState struct {
+	Roots    []string `json:"roots,omitempty"`
+	Expanded []string `json:"expanded,omitempty"`
+	Selected string   `json:"selected,omitempty"`
+	Attached []string `json:"attached,omitempty"`
+}
+
+// Clone returns a deep copy
+func (t FileTreeState) Clone() FileTreeState {
+	t.Roots = append([]string(nil), t.Roots...)
+	t.Expanded = append([]string(nil), t.Expanded...)
+	t.Attached = append([]string(nil), t.Attached...)
+	return t
+}
+
+// IsExpanded reports whether a directory is open
+func (t FileTreeState) IsExpanded(path string) bool {
+	return containsPath(t.Expanded, path)
+}
+
+// Contains reports whether path is one of the roots or inside one
+func (t FileTreeState) Contains(path string) bool {
+	for _, root := range t.Roots {
+		if path == root || strings.HasPrefix(path, strings.TrimSuffix(root, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply performs a file tree change
+func (t *FileTreeState) Apply(p FileTreeUpdatePayload) error {
+	if p.Action == FileTreeSetRoots {
+		roots := make([]string, 0, len(p.Roots))
+		for _, root := range p.Roots {
+			if !filepath.IsAbs(root) {
+				return fmt.Errorf("file tree root %q is not absolute", root)
+			}
+			roots = append(roots, filepath.Clean(root))
+		}
+		t.Roots = roots
+		// Drop whatever the new roots no longer cover
+		t.Expanded = t.filter(t.Expanded)
+		t.Attached = t.filter(t.Attached)
+		if t.Selected != "" && !t.Contains(t.Selected) {
+			t.Selected = ""
+		}
+		return nil
+	}
+	if p.Action == FileTreeClearAttached {
+		t.Attached = nil
+		return nil
+	}
+
+	if !filepath.IsAbs(p.Path) {
+		return fmt.Errorf("file tree path %q is not absolute", p.Path)
+	}
+	target := filepath.Clean(p.Path)
+	if !t.Contains(target) {
+		return fmt.Errorf("%s is outside the file tree roots", target)
+	}
+	switch p.Action {
+	case FileTreeExpand:
+		if !containsPath(t.Expanded, target) {
+			t.Expanded = append(t.Expanded, target)
+		}
+	case FileTreeCollapse:
+		t.Expanded = removePath(t.Expanded, target)
+	case FileTreeSelect:
+		t.Selected = target
+	case FileTreeAttach:
+		if !containsPath(t.Attached, target) {
+			t.Attached = append(t.Attached, target)
+		}
+	case FileTreeDetach:
+		t.Attached = removePath(t.Attached, target)
+	default:
+		return fmt.Errorf("unknown file tree action %q", p.Action)
+	}
+	return nil
+}
+
+func (t FileTreeState) filter(paths []string) []string {
+	var kept []string
+	for _, p := range paths {
+		if t.Contains(p) {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+func containsPath(paths []string, target string) bool {
+	for _, p := range paths {
+		if p == target {
+			return true
+		}
+	}
+	return false
+}
+
+func removePath(paths []string, target string) []string {
+	var kept []string
+	for _, p := range paths {
+		if p != target {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// RedactionRange identifies a span of message content by rune offsets [Start, End)
+type RedactionRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// RedactionEntry records that part of a message was redacted; the original
+// content is intentionally not retained
+type RedactionEntry struct {
+	ID         string           `json:"id"`
+	MessageID  string           `json:"message_id"`
+	SessionID  string           `json:"session_id"`
+	Ranges     []RedactionRange `json:"ranges"`
+	Reason     string           `json:"reason,omitempty"`
+	Source     string           `json:"source"` // panel identifier
+	RedactedAt time.Time        `json:"redacted_at"`
+}
+
+// SessionLock is an advisory lock that keeps other panels from deleting or
+// clearing a session while a long-running operation uses it
+type SessionLock struct {
+	SessionID  string    `json:"session_id"`
+	Owner      string    `json:"owner"`               // panel identifier
+	Operation  string    `json:"operation,omitempty"` // What the owner is doing, e.g. "export"
+	AcquiredAt time.Time `json:"acquired_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// Expired reports whether the lock has lapsed; a crashed owner never blocks forever
+func (l SessionLock) Expired(now time.Time) bool {
+	return !now.Before(l.ExpiresAt)
 }
 
 // InputState represents the current input panel state
@@ -46,6 +630,92 @@ type InputState struct {
 	Mode           string   `json:"mode"` // "normal", "command", "multiline"
 	History        []string `json:"history"`
 	HistoryIndex   int      `json:"history_index"`
+	// Code position the prompt is about; its context is gathered into PromptContext
+	Location *CodeLocation `json:"location,omitempty"`
+}
+
+// CodeLocation is a position in a workspace file. Line and Column count from
+// 1; Column counts characters, not bytes.
+type CodeLocation struct {
+	Path   string `json:"path"` // Absolute
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+}
+
+// String formats the location as path:line:column
+func (l CodeLocation) String() string {
+	return fmt.Sprintf("%s:%d:%d", l.Path, l.Line, l.Column)
+}
+
+// CodeDefinition is where a symbol is defined, with the source line there
+type CodeDefinition struct {
+	CodeLocation
+	Snippet string `json:"snippet,omitempty"`
+}
+
+// CodeDiagnostic is an error or warning a language server reported for the file
+type CodeDiagnostic struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"` // "error", "warning", "info" or "hint"
+	Message  string `json:"message"`
+	Source   string `json:"source,omitempty"`
+}
+
+// PromptContext is code context gathered from a language server for the
+// location attached to the input
+type PromptContext struct {
+	Location    CodeLocation     `json:"location"`
+	Hover       string           `json:"hover,omitempty"`
+	Definitions []CodeDefinition `json:"definitions,omitempty"`
+	Diagnostics []CodeDiagnostic `json:"diagnostics,omitempty"`
+	Error       string           `json:"error,omitempty"` // Why the context could not be gathered
+	UpdatedAt   time.Time        `json:"updated_at"`
+}
+
+// Clone returns a deep copy
+func (c *PromptContext) Clone() *PromptContext {
+	if c == nil {
+		return nil
+	}
+	clone := *c
+	clone.Definitions = append([]CodeDefinition(nil), c.Definitions...)
+	clone.Diagnostics = append([]CodeDiagnostic(nil), c.Diagnostics...)
+	return &clone
+}
+
+// Render formats the context as text to send ahead of a prompt; empty when
+// nothing was gathered
+func (c *PromptContext) Render() string {
+	if c == nil || c.Error != "" || (c.Hover == "" && len(c.Definitions) == 0 && len(c.Diagnostics) == 0) {
+		return ""
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Code context for %s\n", c.Location)
+	if c.Hover != "" {
+		fmt.Fprintf(&b, "\nHover:\n%s\n", strings.TrimSpace(c.Hover))
+	}
+	if len(c.Definitions) > 0 {
+		b.WriteString("\nDefinitions:\n")
+		for _, def := range c.Definitions {
+			fmt.Fprintf(&b, "- %s", def.CodeLocation)
+			if def.Snippet != "" {
+				fmt.Fprintf(&b, ": %s", def.Snippet)
+			}
+			b.WriteString("\n")
+		}
+	}
+	if len(c.Diagnostics) > 0 {
+		b.WriteString("\nDiagnostics:\n")
+		for _, diag := range c.Diagnostics {
+			fmt.Fprintf(&b, "- %d:%d %s: %s", diag.Line, diag.Column, diag.Severity, diag.Message)
+			if diag.Source != "" {
+				fmt.Fprintf(&b, " (%s)", diag.Source)
+			}
+			b.WriteString("\n")
+		}
+	}
+	return b.String()
 }
 
 // SharedApplicationState represents the global state shared across all panels
@@ -56,11 +726,29 @@ type SharedApplicationState struct {
 	// Session management state
 	Sessions         []SessionInfo `json:"sessions"`
 	CurrentSessionID string        `json:"current_session_id"`
+	// How panels order Sessions, which are kept in manual order
+	SessionOrder SessionOrder `json:"session_order"`
+	// The orchestrator's workspace; new sessions are stamped with it
+	Workspace string `json:"workspace,omitempty"`
+	// The tmux session the orchestrator runs, as its name template resolved
+	TmuxSession string `json:"tmux_session,omitempty"`
 
 	// Message state
 	Messages       []MessageInfo `json:"messages"`
 	CurrentMessage *MessageInfo  `json:"current_message,omitempty"`
 
+	// Annotation state
+	Annotations []MessageAnnotation `json:"annotations,omitempty"`
+
+	// Threads collapsed in message panels, by the ID of the message starting them
+	CollapsedThreads []string `json:"collapsed_threads,omitempty"`
+
+	// Redaction log
+	Redactions []RedactionEntry `json:"redactions,omitempty"`
+
+	// Advisory session locks; expired entries are pruned lazily
+	SessionLocks []SessionLock `json:"session_locks,omitempty"`
+
 	// Input state
 	Input InputState `json:"input"`
 
@@ -71,6 +759,45 @@ type SharedApplicationState struct {
 	Agent      string            `json:"agent"`
 	AgentModel map[string]string `json:"agent_model"`
 
+	// Workspace repository status; nil outside a repository
+	Git *GitState `json:"git,omitempty"`
+
+	// Health of the opencode server and panel links; nil until first probed
+	Connection *ConnectionState `json:"connection,omitempty"`
+
+	// File changes made by tool calls, oldest first
+	Diffs []FileDiffSet `json:"diffs,omitempty"`
+
+	// Workspace file browser
+	FileTree FileTreeState `json:"file_tree"`
+
+	// Commands run in terminal panes, oldest first
+	TerminalRuns []TerminalRun `json:"terminal_runs,omitempty"`
+
+	// Assistant runs, in flight and recently finished, oldest first
+	Runs []AgentRun `json:"runs,omitempty"`
+	// Prompts waiting for their session's runs to finish, in submission order
+	PromptQueue []QueuedPrompt `json:"prompt_queue,omitempty"`
+	// Prompts submitted at set times, in the order they were scheduled
+	ScheduledPrompts []ScheduledPrompt `json:"scheduled_prompts,omitempty"`
+	// Templates new sessions can be created from, as configured
+	SessionTemplates []SessionTemplate `json:"session_templates,omitempty"`
+	// Retry and fallback policy for provider errors; nil retries nothing
+	ModelPolicy *ModelPolicy `json:"model_policy,omitempty"`
+	// Agents prompts are routed to by a leading "@name", by name, as configured
+	AgentRoutes map[string]string `json:"agent_routes,omitempty"`
+
+	// Language server context for Input.Location; nil until gathered
+	PromptContext *PromptContext `json:"prompt_context,omitempty"`
+
+	// Context window usage of the current session; nil until measured
+	ContextUsage *ContextUsage `json:"context_usage,omitempty"`
+
+	// Messages replaced by a summary, kept for reference, and the compactions
+	// that moved them, oldest first
+	ArchivedMessages []MessageInfo       `json:"archived_messages,omitempty"`
+	Compactions      []SessionCompaction `json:"compactions,omitempty"`
+
 	// Synchronization metadata
 	LastUpdate  time.Time `json:"last_update"`
 	UpdateCount int64     `json:"update_count"`
@@ -86,12 +813,13 @@ func NewSharedApplicationState() *SharedApplicationState {
 	return &SharedApplicationState{
 		Version: StateVersion{
 			Version:   1,
-			Timestamp: time.Now(),
+			Timestamp: time.Now().UTC(),
 			Source:    "init",
 		},
 		Sessions:         make([]SessionInfo, 0),
 		CurrentSessionID: "",
 		Messages:         make([]MessageInfo, 0),
+		Annotations:      make([]MessageAnnotation, 0),
 		Input: InputState{
 			Buffer:         "",
 			CursorPosition: 0,
@@ -101,7 +829,7 @@ func NewSharedApplicationState() *SharedApplicationState {
 		},
 		Theme:       "opencode",
 		AgentModel:  make(map[string]string),
-		LastUpdate:  time.Now(),
+		LastUpdate:  time.Now().UTC(),
 		UpdateCount: 0,
 		subscribers: make(map[string]chan StateEvent),
 	}
@@ -131,6 +859,22 @@ func (s *SharedApplicationState) GetSessions() []SessionInfo {
 	return sessions
 }
 
+// GetOrderedSessions returns a copy of all sessions, from every workspace, in
+// the order panels show them (thread-safe)
+func (s *SharedApplicationState) GetOrderedSessions() []SessionInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return SortSessions(s.Sessions, s.SessionOrder)
+}
+
+// GetWorkspaceSessions returns a copy of the sessions of workspace, in manual
+// order (thread-safe)
+func (s *SharedApplicationState) GetWorkspaceSessions(workspace string) []SessionInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return SessionsInWorkspace(s.Sessions, workspace)
+}
+
 // GetMessages returns a copy of messages for the current session (thread-safe)
 func (s *SharedApplicationState) GetMessages() []MessageInfo {
 	s.mutex.RLock()
@@ -145,6 +889,272 @@ func (s *SharedApplicationState) GetMessages() []MessageInfo {
 	return messages
 }
 
+// GetSessionMessages returns a copy of the messages of any session (thread-safe)
+func (s *SharedApplicationState) GetSessionMessages(sessionID string) []MessageInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	messages := make([]MessageInfo, 0)
+	for _, msg := range s.Messages {
+		if msg.SessionID == sessionID {
+			messages = append(messages, msg)
+		}
+	}
+	return messages
+}
+
+// GetThread returns the thread a message of any session belongs to (thread-safe)
+func (s *SharedApplicationState) GetThread(messageID string) (MessageThread, bool) {
+	message, ok := s.GetMessageByID(messageID)
+	if !ok {
+		return MessageThread{}, false
+	}
+	return FindThread(s.GetSessionMessages(message.SessionID), messageID)
+}
+
+// GetSessionThreads returns the messages of a session grouped into threads (thread-safe)
+func (s *SharedApplicationState) GetSessionThreads(sessionID string) []MessageThread {
+	return GroupThreads(s.GetSessionMessages(sessionID))
+}
+
+// GetCollapsedThreads returns the IDs of the collapsed threads (thread-safe)
+func (s *SharedApplicationState) GetCollapsedThreads() []string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]string(nil), s.CollapsedThreads...)
+}
+
+// IsThreadCollapsed reports whether the thread started by rootID is collapsed (thread-safe)
+func (s *SharedApplicationState) IsThreadCollapsed(rootID string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return slices.Contains(s.CollapsedThreads, rootID)
+}
+
+// GetMessageByID returns a message of any session by ID (thread-safe)
+func (s *SharedApplicationState) GetMessageByID(messageID string) (MessageInfo, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, msg := range s.Messages {
+		if msg.ID == messageID {
+			return msg, true
+		}
+	}
+	return MessageInfo{}, false
+}
+
+// GetGitState returns a copy of the workspace repository status, nil outside a repository (thread-safe)
+func (s *SharedApplicationState) GetGitState() *GitState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Git.Clone()
+}
+
+// GetFileTree returns a copy of the file browser state (thread-safe)
+func (s *SharedApplicationState) GetFileTree() FileTreeState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.FileTree.Clone()
+}
+
+// GetInputLocation returns the code location attached to the input, if any (thread-safe)
+func (s *SharedApplicationState) GetInputLocation() (CodeLocation, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.Input.Location == nil {
+		return CodeLocation{}, false
+	}
+	return *s.Input.Location, true
+}
+
+// GetPromptContext returns a copy of the gathered prompt context, or nil (thread-safe)
+func (s *SharedApplicationState) GetPromptContext() *PromptContext {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.PromptContext.Clone()
+}
+
+// GetConnectionState returns the link health, nil until first probed (thread-safe)
+func (s *SharedApplicationState) GetConnectionState() *ConnectionState {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.Connection.Clone()
+}
+
+// GetContextUsage returns the context window usage of the current session, if
+// measured (thread-safe)
+func (s *SharedApplicationState) GetContextUsage() (ContextUsage, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.ContextUsage == nil {
+		return ContextUsage{}, false
+	}
+	return *s.ContextUsage, true
+}
+
+// IsMessageArchived reports whether a message was replaced by a summary (thread-safe)
+func (s *SharedApplicationState) IsMessageArchived(id string) bool {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, msg := range s.ArchivedMessages {
+		if msg.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// GetArchivedMessages returns the archived messages of a session, oldest first (thread-safe)
+func (s *SharedApplicationState) GetArchivedMessages(sessionID string) []MessageInfo {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var archived []MessageInfo
+	for _, msg := range s.ArchivedMessages {
+		if msg.SessionID == sessionID {
+			archived = append(archived, msg)
+		}
+	}
+	return archived
+}
+
+// GetAgentRun returns the assistant run with the given ID (thread-safe)
+func (s *SharedApplicationState) GetAgentRun(id string) (AgentRun, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, run := range s.Runs {
+		if run.ID == id {
+			return run, true
+		}
+	}
+	return AgentRun{}, false
+}
+
+// GetModelPolicy returns the retry and fallback policy; the zero policy when
+// none is set (thread-safe)
+func (s *SharedApplicationState) GetModelPolicy() ModelPolicy {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if s.ModelPolicy == nil {
+		return ModelPolicy{}
+	}
+	policy := *s.ModelPolicy
+	policy.Fallbacks = append([]ModelRef(nil), policy.Fallbacks...)
+	return policy
+}
+
+// GetAgentRoutes returns the agents prompts are routed to by mention (thread-safe)
+func (s *SharedApplicationState) GetAgentRoutes() map[string]string {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	routes := make(map[string]string, len(s.AgentRoutes))
+	for name, agent := range s.AgentRoutes {
+		routes[name] = agent
+	}
+	return routes
+}
+
+// GetActiveRuns returns the runs in flight, in one session or in all of them
+// when sessionID is empty (thread-safe)
+func (s *SharedApplicationState) GetActiveRuns(sessionID string) []AgentRun {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	var runs []AgentRun
+	for _, run := range s.Runs {
+		if run.Status == AgentRunRunning && (sessionID == "" || run.SessionID == sessionID) {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// GetPromptQueue returns the queued prompts, of one session or of all of them
+// when sessionID is empty, in queue order (thread-safe)
+func (s *SharedApplicationState) GetPromptQueue(sessionID string) []QueuedPrompt {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	if sessionID == "" {
+		return append([]QueuedPrompt(nil), s.PromptQueue...)
+	}
+	return PromptsQueuedFor(s.PromptQueue, sessionID)
+}
+
+// GetScheduledPrompts returns the scheduled prompts (thread-safe)
+func (s *SharedApplicationState) GetScheduledPrompts() []ScheduledPrompt {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]ScheduledPrompt(nil), s.ScheduledPrompts...)
+}
+
+// GetSessionTemplates returns the session templates (thread-safe)
+func (s *SharedApplicationState) GetSessionTemplates() []SessionTemplate {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return append([]SessionTemplate(nil), s.SessionTemplates...)
+}
+
+// GetTerminalRun returns the terminal run with the given ID (thread-safe)
+func (s *SharedApplicationState) GetTerminalRun(id string) (TerminalRun, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, run := range s.TerminalRuns {
+		if run.ID == id {
+			return run, true
+		}
+	}
+	return TerminalRun{}, false
+}
+
+// GetFileDiffs returns a copy of the tracked file diffs, oldest first (thread-safe)
+func (s *SharedApplicationState) GetFileDiffs() []FileDiffSet {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	diffs := make([]FileDiffSet, len(s.Diffs))
+	for i, diff := range s.Diffs {
+		diffs[i] = diff.Clone()
+	}
+	return diffs
+}
+
+// GetFileDiff returns a copy of the diff with the given ID (thread-safe)
+func (s *SharedApplicationState) GetFileDiff(id string) (FileDiffSet, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	for _, diff := range s.Diffs {
+		if diff.ID == id {
+			return diff.Clone(), true
+		}
+	}
+	return FileDiffSet{}, false
+}
+
+// GetAnnotations returns a copy of annotations attached to a message (thread-safe)
+func (s *SharedApplicationState) GetAnnotations(messageID string) []MessageAnnotation {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	annotations := make([]MessageAnnotation, 0)
+	for _, annotation := range s.Annotations {
+		if annotation.MessageID == messageID {
+			annotations = append(annotations, annotation)
+		}
+	}
+	return annotations
+}
+
+// GetSessionLock returns the unexpired lock on a session, if any (thread-safe)
+func (s *SharedApplicationState) GetSessionLock(sessionID string, now time.Time) (SessionLock, bool) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	for _, lock := range s.SessionLocks {
+		if lock.SessionID == sessionID && !lock.Expired(now) {
+			return lock, true
+		}
+	}
+	return SessionLock{}, false
+}
+
 // GetInputState returns a copy of the input state (thread-safe)
 func (s *SharedApplicationState) GetInputState() InputState {
 	s.mutex.RLock()
@@ -173,6 +1183,9 @@ func (s *SharedApplicationState) Clone() *SharedApplicationState {
 	clone := &SharedApplicationState{
 		Version:          s.Version,
 		CurrentSessionID: s.CurrentSessionID,
+		SessionOrder:     s.SessionOrder,
+		Workspace:        s.Workspace,
+		TmuxSession:      s.TmuxSession,
 		Theme:            s.Theme,
 		Provider:         s.Provider,
 		Model:            s.Model,
@@ -180,6 +1193,7 @@ func (s *SharedApplicationState) Clone() *SharedApplicationState {
 		LastUpdate:       s.LastUpdate,
 		UpdateCount:      s.UpdateCount,
 	}
+	clone.Version.Clock = s.Version.Clock.Clone()
 
 	// Deep copy sessions
 	clone.Sessions = make([]SessionInfo, len(s.Sessions))
@@ -189,6 +1203,24 @@ func (s *SharedApplicationState) Clone() *SharedApplicationState {
 	clone.Messages = make([]MessageInfo, len(s.Messages))
 	copy(clone.Messages, s.Messages)
 
+	// Deep copy annotations
+	clone.Annotations = make([]MessageAnnotation, len(s.Annotations))
+	copy(clone.Annotations, s.Annotations)
+	if s.CollapsedThreads != nil {
+		clone.CollapsedThreads = append([]string(nil), s.CollapsedThreads...)
+	}
+
+	// Deep copy redaction log
+	clone.Redactions = make([]RedactionEntry, len(s.Redactions))
+	for i, entry := range s.Redactions {
+		clone.Redactions[i] = entry
+		clone.Redactions[i].Ranges = append([]RedactionRange(nil), entry.Ranges...)
+	}
+
+	// Deep copy session locks
+	clone.SessionLocks = make([]SessionLock, len(s.SessionLocks))
+	copy(clone.SessionLocks, s.SessionLocks)
+
 	// Deep copy current message if exists
 	if s.CurrentMessage != nil {
 		msg := *s.CurrentMessage
@@ -206,6 +1238,66 @@ func (s *SharedApplicationState) Clone() *SharedApplicationState {
 	}
 	clone.Input.History = make([]string, len(s.Input.History))
 	copy(clone.Input.History, s.Input.History)
+	if s.Input.Location != nil {
+		location := *s.Input.Location
+		clone.Input.Location = &location
+	}
+	clone.PromptContext = s.PromptContext.Clone()
+	if s.ContextUsage != nil {
+		usage := *s.ContextUsage
+		clone.ContextUsage = &usage
+	}
+	if s.ArchivedMessages != nil {
+		clone.ArchivedMessages = append([]MessageInfo(nil), s.ArchivedMessages...)
+	}
+	if s.Compactions != nil {
+		clone.Compactions = make([]SessionCompaction, len(s.Compactions))
+		for i, compaction := range s.Compactions {
+			compaction.ArchivedIDs = append([]string(nil), compaction.ArchivedIDs...)
+			clone.Compactions[i] = compaction
+		}
+	}
+
+	clone.Git = s.Git.Clone()
+	clone.Connection = s.Connection.Clone()
+	clone.FileTree = s.FileTree.Clone()
+	if s.TerminalRuns != nil {
+		clone.TerminalRuns = append([]TerminalRun(nil), s.TerminalRuns...)
+	}
+	if s.Runs != nil {
+		clone.Runs = make([]AgentRun, len(s.Runs))
+		for i, run := range s.Runs {
+			run.Attempts = append([]RunAttempt(nil), run.Attempts...)
+			clone.Runs[i] = run
+		}
+	}
+	if s.PromptQueue != nil {
+		clone.PromptQueue = append([]QueuedPrompt(nil), s.PromptQueue...)
+	}
+	if s.ScheduledPrompts != nil {
+		clone.ScheduledPrompts = append([]ScheduledPrompt(nil), s.ScheduledPrompts...)
+	}
+	// Templates are replaced whole, never changed in place
+	if s.SessionTemplates != nil {
+		clone.SessionTemplates = append([]SessionTemplate(nil), s.SessionTemplates...)
+	}
+	if s.ModelPolicy != nil {
+		policy := *s.ModelPolicy
+		policy.Fallbacks = append([]ModelRef(nil), policy.Fallbacks...)
+		clone.ModelPolicy = &policy
+	}
+	if s.AgentRoutes != nil {
+		clone.AgentRoutes = make(map[string]string, len(s.AgentRoutes))
+		for name, agent := range s.AgentRoutes {
+			clone.AgentRoutes[name] = agent
+		}
+	}
+	if s.Diffs != nil {
+		clone.Diffs = make([]FileDiffSet, len(s.Diffs))
+		for i, diff := range s.Diffs {
+			clone.Diffs[i] = diff.Clone()
+		}
+	}
 
 	// Deep copy agent model map
 	clone.AgentModel = make(map[string]string)
@@ -233,33 +1325,98 @@ func (s *SharedApplicationState) MarshalJSON() ([]byte, error) {
 type StateEvent struct {
 	ID          string         `json:"id"`
 	Type        StateEventType `json:"type"`
+	Topic       string         `json:"topic,omitempty"` // See EventTopic; derived from Type and Data when empty
 	Data        interface{}    `json:"data"`
 	Version     int64          `json:"version"`
+	Clock       VectorClock    `json:"clock,omitempty"`
 	SourcePanel string         `json:"source_panel"`
 	Timestamp   time.Time      `json:"timestamp"`
+	// TraceParent is the trace context of the update that produced the event
+	TraceParent string `json:"trace_parent,omitempty"`
+	// Batch is set on the events of a batch sent one at a time; they share the
+	// batch's version and clock
+	Batch *BatchPosition `json:"batch,omitempty"`
+	// Sequence numbers the events queued for one subscriber, from 1 on each
+	// connection; a skipped number is an event lost on the way. It travels
+	// in the message envelope, so sealing leaves it out.
+	Sequence int64 `json:"-"`
+
+	sealed *sealedEvent // Set by SealEvent; shared by every copy
 }
 
 // StateEventType defines the different types of state change events
 type StateEventType string
 
 const (
-	EventSessionChanged    StateEventType = "session_changed"
-	EventSessionAdded      StateEventType = "session_added"
-	EventSessionDeleted    StateEventType = "session_deleted"
-	EventSessionUpdated    StateEventType = "session_updated"
-	EventMessageAdded      StateEventType = "message_added"
-	EventMessageUpdated    StateEventType = "message_updated"
-	EventMessageDeleted    StateEventType = "message_deleted"
-	EventMessagesCleared   StateEventType = "messages_cleared"
-	EventInputUpdated      StateEventType = "input_updated"
-	EventCursorMoved       StateEventType = "cursor_moved"
-	EventThemeChanged      StateEventType = "theme_changed"
-	EventModelChanged      StateEventType = "model_changed"
-	EventAgentChanged      StateEventType = "agent_changed"
-	EventUIActionTriggered StateEventType = "ui_action_triggered"
-	EventStateSync         StateEventType = "state_sync"
-	EventPanelConnected    StateEventType = "panel_connected"
-	EventPanelDisconnected StateEventType = "panel_disconnected"
+	EventSessionChanged          StateEventType = "session_changed"
+	EventSessionAdded            StateEventType = "session_added"
+	EventSessionDeleted          StateEventType = "session_deleted"
+	EventSessionUpdated          StateEventType = "session_updated"
+	EventMessageAdded            StateEventType = "message_added"
+	EventMessageUpdated          StateEventType = "message_updated"
+	EventMessageDeleted          StateEventType = "message_deleted"
+	EventMessageAttributed       StateEventType = "message_attributed"
+	EventMessagesCleared         StateEventType = "messages_cleared"
+	EventInputUpdated            StateEventType = "input_updated"
+	EventCursorMoved             StateEventType = "cursor_moved"
+	EventThemeChanged            StateEventType = "theme_changed"
+	EventModelChanged            StateEventType = "model_changed"
+	EventAgentChanged            StateEventType = "agent_changed"
+	EventAgentModelCleared       StateEventType = "agent_model_cleared"
+	EventUIActionTriggered       StateEventType = "ui_action_triggered"
+	EventAnnotationAdded         StateEventType = "annotation_added"
+	EventAnnotationUpdated       StateEventType = "annotation_updated"
+	EventAnnotationRemoved       StateEventType = "annotation_removed"
+	EventSessionLocked           StateEventType = "session_locked"
+	EventSessionUnlocked         StateEventType = "session_unlocked"
+	EventStateCompacted          StateEventType = "state_compacted"
+	EventPromptSubmitted         StateEventType = "prompt_submitted"
+	EventGitStatusChanged        StateEventType = "git_status_changed"
+	EventFileDiffReady           StateEventType = "file_diff_ready"
+	EventFileDiffResolved        StateEventType = "file_diff_resolved"
+	EventFileTreeChanged         StateEventType = "file_tree_changed"
+	EventTerminalRunStarted      StateEventType = "terminal_run_started"
+	EventTerminalRunFinished     StateEventType = "terminal_run_finished"
+	EventInputLocationChanged    StateEventType = "input_location_changed"
+	EventRunStarted              StateEventType = "run_started"
+	EventRunFinished             StateEventType = "run_finished"
+	EventRunCancelled            StateEventType = "run_cancelled"
+	EventRunAttempted            StateEventType = "run_attempted"
+	EventModelPolicyChanged      StateEventType = "model_policy_changed"
+	EventAgentRoutesChanged      StateEventType = "agent_routes_changed"
+	EventContextUsageUpdated     StateEventType = "context_usage_updated"
+	EventContextThreshold        StateEventType = "context_threshold"
+	EventSessionCompacted        StateEventType = "session_compacted"
+	EventConnectivityChanged     StateEventType = "connectivity_changed"
+	EventSessionOrderChanged     StateEventType = "session_order_changed"
+	EventSessionReordered        StateEventType = "session_reordered"
+	EventSessionPinned           StateEventType = "session_pinned"
+	EventWorkspaceChanged        StateEventType = "workspace_changed"
+	EventPromptQueued            StateEventType = "prompt_queued"
+	EventPromptDequeued          StateEventType = "prompt_dequeued"
+	EventPromptQueueReordered    StateEventType = "prompt_queue_reordered"
+	EventPromptScheduled         StateEventType = "prompt_scheduled"
+	EventPromptUnscheduled       StateEventType = "prompt_unscheduled"
+	EventScheduledPromptRan      StateEventType = "scheduled_prompt_ran"
+	EventSessionTemplatesChanged StateEventType = "session_templates_changed"
+	EventThreadCollapsed         StateEventType = "thread_collapsed"
+	EventCodeBlocksExtracted     StateEventType = "code_blocks_extracted"
+	EventCodeBlockHandled        StateEventType = "code_block_handled"
+	EventPromptContextUpdated    StateEventType = "prompt_context_updated"
+	EventSecurityAlert           StateEventType = "security_alert"
+	EventStorageRecovered        StateEventType = "storage_recovered"
+	EventStorageQuota            StateEventType = "storage_quota"
+	EventStorageHealth           StateEventType = "storage_health"
+	EventCrashReport             StateEventType = "crash_report"
+	EventInternalError           StateEventType = "internal_error"
+	EventConfigChanged           StateEventType = "config_changed"
+	EventSnapshotUpdated         StateEventType = "snapshot_updated"
+	EventStateBatch              StateEventType = "state_batch"
+	EventStateSync               StateEventType = "state_sync"
+	EventPanelConnected          StateEventType = "panel_connected"
+	EventPanelDisconnected       StateEventType = "panel_disconnected"
+	EventShutdown                StateEventType = "shutdown"
+	EventConfirmationRequired    StateEventType = "confirmation_required"
 )
 
 // Session management methods
@@ -275,8 +1432,8 @@ func (s *SharedApplicationState) AddSession(session SessionInfo) {
 			// Update existing session with new data
 			s.Sessions[i] = session
 			s.Version.Version++
-			s.Version.Timestamp = time.Now()
-			s.LastUpdate = time.Now()
+			s.Version.Timestamp = time.Now().UTC()
+			s.LastUpdate = time.Now().UTC()
 			s.UpdateCount++
 			return
 		}
@@ -285,8 +1442,8 @@ func (s *SharedApplicationState) AddSession(session SessionInfo) {
 	// Add new session if it doesn't exist
 	s.Sessions = append(s.Sessions, session)
 	s.Version.Version++
-	s.Version.Timestamp = time.Now()
-	s.LastUpdate = time.Now()
+	s.Version.Timestamp = time.Now().UTC()
+	s.LastUpdate = time.Now().UTC()
 	s.UpdateCount++
 }
 
@@ -305,8 +1462,8 @@ func (s *SharedApplicationState) RemoveSession(sessionID string) bool {
 			}
 
 			s.Version.Version++
-			s.Version.Timestamp = time.Now()
-			s.LastUpdate = time.Now()
+			s.Version.Timestamp = time.Now().UTC()
+			s.LastUpdate = time.Now().UTC()
 			s.UpdateCount++
 			return true
 		}
@@ -324,8 +1481,8 @@ func (s *SharedApplicationState) SetCurrentSession(sessionID string) bool {
 		if session.ID == sessionID {
 			s.CurrentSessionID = sessionID
 			s.Version.Version++
-			s.Version.Timestamp = time.Now()
-			s.LastUpdate = time.Now()
+			s.Version.Timestamp = time.Now().UTC()
+			s.LastUpdate = time.Now().UTC()
 			s.UpdateCount++
 			return true
 		}
@@ -348,9 +1505,9 @@ func (s *SharedApplicationState) GetSessionByID(sessionID string) (SessionInfo,
 
 // CreateNewSession creates a new session with a generated ID
 func (s *SharedApplicationState) CreateNewSession(title string) SessionInfo {
-	now := time.Now()
+	now := time.Now().UTC()
 	session := SessionInfo{
-		ID:           fmt.Sprintf("session_%d", now.UnixNano()),
+		ID:           ids.New("session"),
 		Title:        title,
 		CreatedAt:    now,
 		UpdatedAt:    now,
@@ -0,0 +1,82 @@
+package types
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/opencode/tmux_coder/internal/timefmt"
+)
+
+// The server gossips a checksum of each section of its state in its heartbeat
+// replies. A panel that caches part of the state checksums the same sections
+// of its cache and resyncs those that differ, which catches divergence that
+// event-based sync missed. Times are hashed in UTC, so a decoded copy of the
+// state checksums the same as the original.
+
+// Sections of the state that are checksummed
+const (
+	ChecksumSessions       = "sessions"
+	ChecksumInput          = "input"
+	ChecksumSettings       = "settings"
+	ChecksumMessagesPrefix = "messages/" // Followed by the session ID
+)
+
+// StateChecksums maps a section of the state to its checksum
+type StateChecksums map[string]string
+
+// Mismatched returns the sections of view whose checksum differs from the
+// one in authoritative; sections only one of them has are not compared
+func (authoritative StateChecksums) Mismatched(view StateChecksums) []string {
+	var sections []string
+	for section, sum := range view {
+		if want, ok := authoritative[section]; ok && want != sum {
+			sections = append(sections, section)
+		}
+	}
+	return sections
+}
+
+// Checksums returns the checksum of each of the given sections of the state,
+// or with none given of every section: the sessions, the messages of each
+// session, the input and the settings
+func (s *SharedApplicationState) Checksums(sections ...string) StateChecksums {
+	if len(sections) == 0 {
+		sections = []string{ChecksumSessions, ChecksumInput, ChecksumSettings}
+		for _, session := range s.Sessions {
+			sections = append(sections, ChecksumMessagesPrefix+session.ID)
+		}
+	}
+
+	// Hashed as encoded, which is a clone of the state
+	s = s.Clone()
+	sums := make(StateChecksums, len(sections))
+	for _, section := range sections {
+		switch {
+		case section == ChecksumSessions:
+			sums[section] = checksumOf(struct {
+				Sessions         []SessionInfo
+				CurrentSessionID string
+			}{s.Sessions, s.CurrentSessionID})
+		case section == ChecksumInput:
+			sums[section] = checksumOf(s.Input)
+		case section == ChecksumSettings:
+			sums[section] = checksumOf(struct {
+				Theme, Provider, Model, Agent string
+			}{s.Theme, s.Provider, s.Model, s.Agent})
+		case strings.HasPrefix(section, ChecksumMessagesPrefix):
+			sums[section] = checksumOf(s.GetSessionMessages(strings.TrimPrefix(section, ChecksumMessagesPrefix)))
+		}
+	}
+	return sums
+}
+
+func checksumOf(section interface{}) string {
+	data, err := json.Marshal(timefmt.UTC(section))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
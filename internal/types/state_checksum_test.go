@@ -0,0 +1,44 @@
+package types
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestChecksumsSurviveEncoding(t *testing.T) {
+	at := time.Date(2025, 1, 1, 9, 0, 0, 0, time.FixedZone("CET", 3600))
+	state := &SharedApplicationState{
+		Sessions:         []SessionInfo{{ID: "s1", Title: "one", CreatedAt: at}, {ID: "s2", Title: "two"}},
+		CurrentSessionID: "s1",
+		Messages:         []MessageInfo{{ID: "m1", SessionID: "s1", Content: "hi", Timestamp: at}},
+		Provider:         "anthropic",
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded SharedApplicationState
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	sums := state.Checksums()
+	if len(sums) != 5 {
+		t.Fatalf("sections = %v, want sessions, input, settings and two of messages", sums)
+	}
+	if sections := sums.Mismatched(decoded.Checksums()); len(sections) != 0 {
+		t.Errorf("decoded copy differs in %v", sections)
+	}
+
+	// Only the sections that changed differ, and only those the view holds
+	decoded.Provider = "openai"
+	decoded.Messages[0].Content = "edited"
+	view := decoded.Checksums(ChecksumSessions, ChecksumSettings)
+	if sections := sums.Mismatched(view); len(sections) != 1 || sections[0] != ChecksumSettings {
+		t.Errorf("mismatched sections = %v, want [settings]", sections)
+	}
+	if sections := sums.Mismatched(decoded.Checksums(ChecksumMessagesPrefix + "s1")); len(sections) != 1 {
+		t.Errorf("mismatched sections = %v, want the messages of s1", sections)
+	}
+}
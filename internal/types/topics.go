@@ -0,0 +1,249 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Events are published under topics of dot-separated segments: a domain, the
+// ID of the entity the event is about when it has one, and what happened, e.g.
+// "message.msg_123.updated", "panel.input.connected" or "theme.changed".
+// Panels subscribe with topic patterns, in which "*" matches any one segment
+// and a trailing "*" matches the rest of the topic: "session.*" matches every
+// session event and "message.msg_123.*" every event about that message.
+
+// topicName is an event type's domain and what happened
+type topicName struct {
+	domain string
+	action string
+}
+
+var eventTopics = map[StateEventType]topicName{
+	EventSessionChanged:          {"session", "changed"},
+	EventSessionAdded:            {"session", "added"},
+	EventSessionDeleted:          {"session", "deleted"},
+	EventSessionUpdated:          {"session", "updated"},
+	EventSessionLocked:           {"session", "locked"},
+	EventSessionUnlocked:         {"session", "unlocked"},
+	EventSessionCompacted:        {"session", "compacted"},
+	EventSessionOrderChanged:     {"session", "order_changed"},
+	EventSessionReordered:        {"session", "reordered"},
+	EventSessionPinned:           {"session", "pinned"},
+	EventMessageAdded:            {"message", "added"},
+	EventMessageUpdated:          {"message", "updated"},
+	EventMessageDeleted:          {"message", "deleted"},
+	EventMessageAttributed:       {"message", "attributed"},
+	EventMessagesCleared:         {"message", "cleared"},
+	EventThreadCollapsed:         {"message", "thread_collapsed"},
+	EventCodeBlocksExtracted:     {"message", "code_blocks"},
+	EventCodeBlockHandled:        {"message", "code_block_handled"},
+	EventAnnotationAdded:         {"annotation", "added"},
+	EventAnnotationUpdated:       {"annotation", "updated"},
+	EventAnnotationRemoved:       {"annotation", "removed"},
+	EventInputUpdated:            {"input", "updated"},
+	EventCursorMoved:             {"input", "cursor_moved"},
+	EventInputLocationChanged:    {"input", "location_changed"},
+	EventPromptSubmitted:         {"prompt", "submitted"},
+	EventPromptContextUpdated:    {"prompt", "context_updated"},
+	EventPromptQueued:            {"prompt", "queued"},
+	EventPromptDequeued:          {"prompt", "dequeued"},
+	EventPromptQueueReordered:    {"prompt", "queue_reordered"},
+	EventPromptScheduled:         {"schedule", "saved"},
+	EventPromptUnscheduled:       {"schedule", "deleted"},
+	EventScheduledPromptRan:      {"schedule", "ran"},
+	EventSessionTemplatesChanged: {"template", "changed"},
+	EventThemeChanged:            {"theme", "changed"},
+	EventModelChanged:            {"model", "changed"},
+	EventModelPolicyChanged:      {"model", "policy_changed"},
+	EventAgentChanged:            {"agent", "changed"},
+	EventAgentModelCleared:       {"agent", "model_cleared"},
+	EventAgentRoutesChanged:      {"agent", "routes_changed"},
+	EventUIActionTriggered:       {"ui", "triggered"},
+	EventRunStarted:              {"run", "started"},
+	EventRunFinished:             {"run", "finished"},
+	EventRunCancelled:            {"run", "cancelled"},
+	EventRunAttempted:            {"run", "attempted"},
+	EventContextUsageUpdated:     {"context", "usage_updated"},
+	EventContextThreshold:        {"context", "threshold"},
+	EventGitStatusChanged:        {"git", "status_changed"},
+	EventWorkspaceChanged:        {"workspace", "changed"},
+	EventFileDiffReady:           {"diff", "ready"},
+	EventFileDiffResolved:        {"diff", "resolved"},
+	EventFileTreeChanged:         {"files", "tree_changed"},
+	EventTerminalRunStarted:      {"terminal", "run_started"},
+	EventTerminalRunFinished:     {"terminal", "run_finished"},
+	EventConnectivityChanged:     {"connectivity", "changed"},
+	EventSecurityAlert:           {"security", "alert"},
+	EventStateCompacted:          {"state", "compacted"},
+	EventSnapshotUpdated:         {"state", "snapshot_updated"},
+	EventStateSync:               {"state", "sync"},
+	EventStorageRecovered:        {"storage", "recovered"},
+	EventStorageQuota:            {"storage", "quota"},
+	EventStorageHealth:           {"storage", "health"},
+	EventCrashReport:             {"system", "crash_report"},
+	EventInternalError:           {"system", "internal_error"},
+	EventConfigChanged:           {"config", "changed"},
+	EventPanelConnected:          {"panel", "connected"},
+	EventPanelDisconnected:       {"panel", "disconnected"},
+	EventShutdown:                {"system", "shutdown"},
+	EventConfirmationRequired:    {"system", "confirmation_required"},
+}
+
+// alwaysDelivered are events every panel gets whatever it subscribed to, as
+// panels cannot stay in step without them
+var alwaysDelivered = map[StateEventType]bool{
+	EventStateSync: true,
+	EventShutdown:  true,
+}
+
+// topicIDKeys name the payload field holding a domain's entity ID, for
+// payloads that arrive decoded as maps
+var topicIDKeys = map[string]string{
+	"session":    "session_id",
+	"message":    "message_id",
+	"annotation": "annotation_id",
+	"run":        "run_id",
+	"prompt":     "prompt_id",
+	"schedule":   "schedule_id",
+	"ui":         "action",
+	"panel":      "panel_type",
+}
+
+// EventTopic returns the topic event is published under
+func EventTopic(event StateEvent) string {
+	if event.Topic != "" {
+		return event.Topic
+	}
+	return TopicFor(event.Type, event.Data)
+}
+
+// TopicFor returns the topic of an event of eventType carrying data. Event
+// types without a domain of their own are published under "event".
+func TopicFor(eventType StateEventType, data interface{}) string {
+	name, ok := eventTopics[eventType]
+	if !ok {
+		return "event." + string(eventType)
+	}
+	if id := topicID(name.domain, data); id != "" {
+		// Dots would split the ID into several segments
+		return name.domain + "." + strings.ReplaceAll(id, ".", "_") + "." + name.action
+	}
+	return name.domain + "." + name.action
+}
+
+// topicID returns the ID of the entity of domain that data is about
+func topicID(domain string, data interface{}) string {
+	switch payload := data.(type) {
+	case SessionAddPayload:
+		return payload.Session.ID
+	case SessionChangePayload:
+		return payload.SessionID
+	case SessionUpdatePayload:
+		return payload.SessionID
+	case SessionDeletePayload:
+		return payload.SessionID
+	case SessionLockPayload:
+		return payload.SessionID
+	case SessionUnlockPayload:
+		return payload.SessionID
+	case SessionReorderPayload:
+		return payload.SessionID
+	case SessionPinPayload:
+		return payload.SessionID
+	case SessionCompactedPayload:
+		return payload.Compaction.SessionID
+	case MessageAddPayload:
+		return payload.Message.ID
+	case MessageUpdatePayload:
+		return payload.MessageID
+	case MessageDeletePayload:
+		return payload.MessageID
+	case MessageAttributionPayload:
+		return payload.MessageID
+	case MessageInfo:
+		return payload.ID
+	case AnnotationAddPayload:
+		return payload.Annotation.ID
+	case AnnotationUpdatePayload:
+		return payload.AnnotationID
+	case AnnotationRemovePayload:
+		return payload.AnnotationID
+	case PromptQueuedPayload:
+		return payload.Prompt.ID
+	case PromptDequeuedPayload:
+		return payload.PromptID
+	case PromptQueueReorderPayload:
+		return payload.PromptID
+	case PromptSchedulePayload:
+		return payload.Schedule.ID
+	case PromptUnschedulePayload:
+		return payload.ScheduleID
+	case ScheduledPromptRanPayload:
+		return payload.ScheduleID
+	case RunStartedPayload:
+		return payload.Run.ID
+	case RunFinishedPayload:
+		return payload.RunID
+	case RunAttemptedPayload:
+		return payload.RunID
+	case RunCancelledPayload:
+		return payload.RunID
+	case UIActionPayload:
+		return string(payload.Action)
+	case PanelConnectionPayload:
+		return payload.PanelType
+	case map[string]interface{}:
+		if id, ok := payload[topicIDKeys[domain]].(string); ok {
+			return id
+		}
+		// Added entities are nested under their domain, e.g. {"session": {"id": ...}}
+		if entity, ok := payload[domain].(map[string]interface{}); ok {
+			if id, ok := entity["id"].(string); ok {
+				return id
+			}
+		}
+	}
+	return ""
+}
+
+// MatchTopic reports whether topic matches pattern
+func MatchTopic(pattern, topic string) bool {
+	for {
+		patternSegment, patternRest, patternMore := strings.Cut(pattern, ".")
+		topicSegment, topicRest, topicMore := strings.Cut(topic, ".")
+		if patternSegment == "*" && !patternMore {
+			return true
+		}
+		if patternSegment != "*" && patternSegment != topicSegment {
+			return false
+		}
+		if !patternMore || !topicMore {
+			return patternMore == topicMore
+		}
+		pattern, topic = patternRest, topicRest
+	}
+}
+
+// MatchAnyTopic reports whether topic matches one of patterns
+func MatchAnyTopic(patterns []string, topic string) bool {
+	for _, pattern := range patterns {
+		if MatchTopic(pattern, topic) {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateTopicPattern checks that pattern is a usable subscription: non-empty
+// segments, with "*" only ever a whole segment
+func ValidateTopicPattern(pattern string) error {
+	for _, segment := range strings.Split(pattern, ".") {
+		if segment == "" {
+			return fmt.Errorf("topic pattern %q has an empty segment", pattern)
+		}
+		if segment != "*" && strings.Contains(segment, "*") {
+			return fmt.Errorf("topic pattern %q: * must be a whole segment", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,73 @@
+package types
+
+import "testing"
+
+func TestTopicFor(t *testing.T) {
+	tests := []struct {
+		eventType StateEventType
+		data      interface{}
+		want      string
+	}{
+		{EventMessageUpdated, MessageUpdatePayload{MessageID: "msg_1"}, "message.msg_1.updated"},
+		{EventMessageAdded, map[string]interface{}{"message": map[string]interface{}{"id": "msg_2"}}, "message.msg_2.added"},
+		{EventSessionAdded, SessionAddPayload{Session: SessionInfo{ID: "ses_1"}}, "session.ses_1.added"},
+		{EventSessionOrderChanged, SessionOrderPayload{}, "session.order_changed"},
+		{EventPanelConnected, PanelConnectionPayload{PanelID: "input-1", PanelType: "input"}, "panel.input.connected"},
+		{EventUIActionTriggered, UIActionPayload{Action: UIActionFocusPane}, "ui." + string(UIActionFocusPane) + ".triggered"},
+		{EventRunFinished, map[string]interface{}{"run_id": "run.1"}, "run.run_1.finished"},
+		{EventThemeChanged, ThemeChangePayload{}, "theme.changed"},
+		{StateEventType("brand_new"), nil, "event.brand_new"},
+	}
+	for _, tt := range tests {
+		if got := TopicFor(tt.eventType, tt.data); got != tt.want {
+			t.Errorf("TopicFor(%s, %+v) = %q, want %q", tt.eventType, tt.data, got, tt.want)
+		}
+	}
+
+	event := StateEvent{Type: EventMessageDeleted, Topic: "message.custom.deleted", Data: MessageDeletePayload{MessageID: "msg_1"}}
+	if got := EventTopic(event); got != "message.custom.deleted" {
+		t.Errorf("EventTopic() = %q, want the topic the event was published under", got)
+	}
+}
+
+func TestMatchTopic(t *testing.T) {
+	tests := []struct {
+		pattern string
+		topic   string
+		want    bool
+	}{
+		{"session.*", "session.ses_1.added", true},
+		{"session.*", "session.order_changed", true},
+		{"session.*", "sessions.added", false},
+		{"session.*", "session", false},
+		{"message.msg_1.*", "message.msg_1.updated", true},
+		{"message.msg_1.*", "message.msg_2.updated", false},
+		{"message.*.added", "message.msg_1.added", true},
+		{"message.*.added", "message.msg_1.updated", false},
+		{"message.*.added", "message.added", false},
+		{"panel.input.*", "panel.input.connected", true},
+		{"panel.input.*", "panel.messages.connected", false},
+		{"theme.changed", "theme.changed", true},
+		{"theme.changed", "theme.changed.again", false},
+		{"theme.changed.again", "theme.changed", false},
+		{"*", "anything.at.all", true},
+	}
+	for _, tt := range tests {
+		if got := MatchTopic(tt.pattern, tt.topic); got != tt.want {
+			t.Errorf("MatchTopic(%q, %q) = %v, want %v", tt.pattern, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTopicPattern(t *testing.T) {
+	for _, good := range []string{"*", "session.*", "message.*.added", "panel.input.connected"} {
+		if err := ValidateTopicPattern(good); err != nil {
+			t.Errorf("ValidateTopicPattern(%q) error = %v", good, err)
+		}
+	}
+	for _, bad := range []string{"", "session.", ".added", "message..added", "sess*", "message.msg_*"} {
+		if err := ValidateTopicPattern(bad); err == nil {
+			t.Errorf("ValidateTopicPattern(%q) succeeded", bad)
+		}
+	}
+}
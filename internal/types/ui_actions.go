@@ -0,0 +1,291 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// UIAction names an action a panel performs when asked through a UIActionTriggered update
+type UIAction string
+
+const (
+	UIActionOpenModelPicker    UIAction = "open_models"
+	UIActionOpenAgentPicker    UIAction = "open_agents"
+	UIActionOpenSessionPicker  UIAction = "open_sessions"
+	UIActionOpenThemePicker    UIAction = "open_themes"
+	UIActionOpenTemplatePicker UIAction = "open_templates"
+	UIActionOpenHelp           UIAction = "open_help"
+	UIActionRefreshMessages    UIAction = "refresh_messages"
+	UIActionFocusPane          UIAction = "focus_pane"
+	UIActionZoomPane           UIAction = "zoom_pane"
+	UIActionCycleFocus         UIAction = "cycle_focus"
+	UIActionMaximizeMessages   UIAction = "maximize_messages"
+	UIActionScrollToMessage    UIAction = "scroll_to_message"
+	UIActionRunCommand         UIAction = "run_command"
+	UIActionDiffAccept         UIAction = "diff_accept"
+	UIActionDiffRevert         UIAction = "diff_revert"
+	UIActionCopyCodeBlock      UIAction = "copy_code_block"
+	UIActionSaveCodeBlock      UIAction = "save_code_block"
+	UIActionOpenCodeBlock      UIAction = "open_code_block"
+	UIActionApplyCodeBlock     UIAction = "apply_code_block"
+)
+
+// UIActionArgs are the structured arguments of one UI action
+type UIActionArgs interface {
+	Validate() error
+}
+
+// NoArgs is the argument type of actions that take none
+type NoArgs struct{}
+
+func (NoArgs) Validate() error { return nil }
+
+// RefreshMessagesArgs limits a refresh to panels showing one session
+type RefreshMessagesArgs struct {
+	SessionID string `json:"session_id,omitempty"` // Empty refreshes whatever is shown
+}
+
+func (RefreshMessagesArgs) Validate() error { return nil }
+
+// FocusPaneArgs names the panel whose tmux pane should take focus
+type FocusPaneArgs struct {
+	Panel string `json:"panel"` // Panel type: "sessions", "messages" or "input"
+}
+
+func (a FocusPaneArgs) Validate() error {
+	if strings.TrimSpace(a.Panel) == "" {
+		return fmt.Errorf("panel is required")
+	}
+	return nil
+}
+
+// ZoomPaneArgs toggles tmux zoom of a panel's pane
+type ZoomPaneArgs struct {
+	Panel string `json:"panel"` // Panel type or layout ID
+}
+
+func (a ZoomPaneArgs) Validate() error {
+	if strings.TrimSpace(a.Panel) == "" {
+		return fmt.Errorf("panel is required")
+	}
+	return nil
+}
+
+// CycleFocusArgs moves focus to the next panel's pane, in layout order
+type CycleFocusArgs struct {
+	Reverse bool `json:"reverse,omitempty"` // Move to the previous pane instead
+}
+
+func (CycleFocusArgs) Validate() error { return nil }
+
+// MaximizeMessagesArgs zooms the messages pane for a while, e.g. while a long
+// reply streams in, and restores the layout afterwards
+type MaximizeMessagesArgs struct {
+	Seconds int  `json:"seconds,omitempty"` // Restore after this long; 0 stays maximized until released
+	Release bool `json:"release,omitempty"` // Restore the layout now
+}
+
+func (a MaximizeMessagesArgs) Validate() error {
+	if a.Seconds < 0 {
+		return fmt.Errorf("seconds cannot be negative, got %d", a.Seconds)
+	}
+	return nil
+}
+
+// ScrollToMessageArgs scrolls the messages panel to a message
+type ScrollToMessageArgs struct {
+	MessageID string `json:"message_id"`
+	SessionID string `json:"session_id,omitempty"` // Ignored by panels showing another session
+}
+
+func (a ScrollToMessageArgs) Validate() error {
+	if strings.TrimSpace(a.MessageID) == "" {
+		return fmt.Errorf("message_id is required")
+	}
+	return nil
+}
+
+// RunCommandArgs runs an input panel slash command as if typed
+type RunCommandArgs struct {
+	Command string   `json:"command"` // Without the leading slash, e.g. "theme"
+	Args    []string `json:"args,omitempty"`
+}
+
+func (a RunCommandArgs) Validate() error {
+	name := strings.TrimPrefix(strings.TrimSpace(a.Command), "/")
+	if name == "" || strings.ContainsAny(name, " \t\n") {
+		return fmt.Errorf("command must be a single word, got %q", a.Command)
+	}
+	return nil
+}
+
+// DiffActionArgs accepts or reverts the file changes of a tool call
+type DiffActionArgs struct {
+	DiffID string   `json:"diff_id"`
+	Paths  []string `json:"paths,omitempty"` // Limit to these files; empty means every file in the diff
+}
+
+func (a DiffActionArgs) Validate() error {
+	if strings.TrimSpace(a.DiffID) == "" {
+		return fmt.Errorf("diff_id is required")
+	}
+	return nil
+}
+
+// CodeBlockArgs copies, saves, opens or applies one code block extracted from a message
+type CodeBlockArgs struct {
+	MessageID string `json:"message_id"`
+	Index     int    `json:"index"`
+	// File to save or apply to, relative to the workspace. Saving names the
+	// file after the block when empty; applying uses the path the fence names.
+	Path string `json:"path,omitempty"`
+}
+
+func (a CodeBlockArgs) Validate() error {
+	if strings.TrimSpace(a.MessageID) == "" {
+		return fmt.Errorf("message_id is required")
+	}
+	if a.Index < 0 {
+		return fmt.Errorf("index cannot be negative")
+	}
+	return nil
+}
+
+// uiActionCatalog maps each action to a constructor for its argument type
+var uiActionCatalog = map[UIAction]func() UIActionArgs{
+	UIActionOpenModelPicker:    func() UIActionArgs { return &NoArgs{} },
+	UIActionOpenAgentPicker:    func() UIActionArgs { return &NoArgs{} },
+	UIActionOpenSessionPicker:  func() UIActionArgs { return &NoArgs{} },
+	UIActionOpenThemePicker:    func() UIActionArgs { return &NoArgs{} },
+	UIActionOpenTemplatePicker: func() UIActionArgs { return &NoArgs{} },
+	UIActionOpenHelp:           func() UIActionArgs { return &NoArgs{} },
+	UIActionRefreshMessages:    func() UIActionArgs { return &RefreshMessagesArgs{} },
+	UIActionFocusPane:          func() UIActionArgs { return &FocusPaneArgs{} },
+	UIActionZoomPane:           func() UIActionArgs { return &ZoomPaneArgs{} },
+	UIActionCycleFocus:         func() UIActionArgs { return &CycleFocusArgs{} },
+	UIActionMaximizeMessages:   func() UIActionArgs { return &MaximizeMessagesArgs{} },
+	UIActionScrollToMessage:    func() UIActionArgs { return &ScrollToMessageArgs{} },
+	UIActionRunCommand:         func() UIActionArgs { return &RunCommandArgs{} },
+	UIActionDiffAccept:         func() UIActionArgs { return &DiffActionArgs{} },
+	UIActionDiffRevert:         func() UIActionArgs { return &DiffActionArgs{} },
+	UIActionCopyCodeBlock:      func() UIActionArgs { return &CodeBlockArgs{} },
+	UIActionSaveCodeBlock:      func() UIActionArgs { return &CodeBlockArgs{} },
+	UIActionOpenCodeBlock:      func() UIActionArgs { return &CodeBlockArgs{} },
+	UIActionApplyCodeBlock:     func() UIActionArgs { return &CodeBlockArgs{} },
+}
+
+// Known reports whether the action is in the catalog
+func (a UIAction) Known() bool {
+	_, ok := uiActionCatalog[a]
+	return ok
+}
+
+// UIActions lists every action in the catalog, sorted
+func UIActions() []UIAction {
+	actions := make([]UIAction, 0, len(uiActionCatalog))
+	for action := range uiActionCatalog {
+		actions = append(actions, action)
+	}
+	sort.Slice(actions, func(i, j int) bool { return actions[i] < actions[j] })
+	return actions
+}
+
+// ParseUIAction returns the catalog action with the given name
+func ParseUIAction(name string) (UIAction, error) {
+	action := UIAction(strings.TrimSpace(name))
+	if !action.Known() {
+		return "", fmt.Errorf("unknown UI action %q", name)
+	}
+	return action, nil
+}
+
+// NewUIActionPayload builds a validated payload for an action and its arguments;
+// nil args stands for none
+func NewUIActionPayload(action UIAction, args UIActionArgs) (UIActionPayload, error) {
+	payload := UIActionPayload{Action: action}
+	if args != nil {
+		data, err := json.Marshal(args)
+		if err != nil {
+			return UIActionPayload{}, fmt.Errorf("failed to encode %s arguments: %w", action, err)
+		}
+		if err := json.Unmarshal(data, &payload.Data); err != nil {
+			return UIActionPayload{}, fmt.Errorf("failed to encode %s arguments: %w", action, err)
+		}
+		if len(payload.Data) == 0 {
+			payload.Data = nil
+		}
+	}
+	if err := payload.Validate(); err != nil {
+		return UIActionPayload{}, err
+	}
+	return payload, nil
+}
+
+// Validate checks that the action is in the catalog and its arguments decode
+// into the action's argument type and are valid
+func (p UIActionPayload) Validate() error {
+	newArgs, ok := uiActionCatalog[p.Action]
+	if !ok {
+		return fmt.Errorf("unknown UI action %q", p.Action)
+	}
+	return p.decodeArgs(newArgs())
+}
+
+// DecodeArgs decodes the payload's arguments into target, which must be the
+// action's argument type
+func (p UIActionPayload) DecodeArgs(target UIActionArgs) error {
+	newArgs, ok := uiActionCatalog[p.Action]
+	if !ok {
+		return fmt.Errorf("unknown UI action %q", p.Action)
+	}
+	if want := fmt.Sprintf("%T", newArgs()); want != fmt.Sprintf("%T", target) {
+		return fmt.Errorf("%s arguments decode into %s, not %T", p.Action, want, target)
+	}
+	return p.decodeArgs(target)
+}
+
+func (p UIActionPayload) decodeArgs(target UIActionArgs) error {
+	if len(p.Data) > 0 {
+		data, err := json.Marshal(p.Data)
+		if err != nil {
+			return fmt.Errorf("invalid %s arguments: %w", p.Action, err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(target); err != nil {
+			return fmt.Errorf("invalid %s arguments: %w", p.Action, err)
+		}
+	}
+	if err := target.Validate(); err != nil {
+		return fmt.Errorf("invalid %s arguments: %w", p.Action, err)
+	}
+	return nil
+}
+
+// UIActionFromEvent extracts the UI action payload of an event, whether it
+// holds the typed payload or one decoded from JSON
+func UIActionFromEvent(event StateEvent) (UIActionPayload, bool) {
+	if event.Type != EventUIActionTriggered {
+		return UIActionPayload{}, false
+	}
+	switch data := event.Data.(type) {
+	case UIActionPayload:
+		return data, true
+	case *UIActionPayload:
+		if data != nil {
+			return *data, true
+		}
+	case map[string]interface{}:
+		action, ok := data["action"].(string)
+		if !ok {
+			return UIActionPayload{}, false
+		}
+		payload := UIActionPayload{Action: UIAction(action)}
+		payload.Data, _ = data["data"].(map[string]interface{})
+		return payload, true
+	}
+	return UIActionPayload{}, false
+}
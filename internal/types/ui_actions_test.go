@@ -0,0 +1,65 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUIActionPayloadValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload UIActionPayload
+		wantErr bool
+	}{
+		{"no args", UIActionPayload{Action: UIActionOpenModelPicker}, false},
+		{"misspelled action", UIActionPayload{Action: "open_model"}, true},
+		{"args for argless action", UIActionPayload{Action: UIActionOpenHelp, Data: map[string]interface{}{"topic": "x"}}, true},
+		{"optional args omitted", UIActionPayload{Action: UIActionRefreshMessages}, false},
+		{"misspelled argument", UIActionPayload{Action: UIActionRefreshMessages, Data: map[string]interface{}{"session": "s1"}}, true},
+		{"required arg missing", UIActionPayload{Action: UIActionScrollToMessage}, true},
+		{"wrong arg type", UIActionPayload{Action: UIActionFocusPane, Data: map[string]interface{}{"panel": 3}}, true},
+		{"valid args", UIActionPayload{Action: UIActionScrollToMessage, Data: map[string]interface{}{"message_id": "m1"}}, false},
+		{"command with spaces", UIActionPayload{Action: UIActionRunCommand, Data: map[string]interface{}{"command": "theme dark"}}, true},
+		{"diff without id", UIActionPayload{Action: UIActionDiffRevert, Data: map[string]interface{}{"paths": []interface{}{"a.go"}}}, true},
+		{"zoom without panel", UIActionPayload{Action: UIActionZoomPane}, true},
+		{"cycle focus back", UIActionPayload{Action: UIActionCycleFocus, Data: map[string]interface{}{"reverse": true}}, false},
+		{"maximize for negative time", UIActionPayload{Action: UIActionMaximizeMessages, Data: map[string]interface{}{"seconds": -1}}, true},
+		{"diff with paths", UIActionPayload{Action: UIActionDiffAccept, Data: map[string]interface{}{"diff_id": "p1", "paths": []interface{}{"a.go"}}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.payload.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUIActionRoundTrip(t *testing.T) {
+	args := RunCommandArgs{Command: "theme", Args: []string{"dark"}}
+	payload, err := NewUIActionPayload(UIActionRunCommand, args)
+	if err != nil {
+		t.Fatalf("NewUIActionPayload() error = %v", err)
+	}
+
+	// As a panel receives it: decoded from JSON into a map
+	event := StateEvent{
+		Type: EventUIActionTriggered,
+		Data: map[string]interface{}{"action": "run_command", "data": map[string]interface{}(payload.Data)},
+	}
+	received, ok := UIActionFromEvent(event)
+	if !ok || received.Action != UIActionRunCommand {
+		t.Fatalf("UIActionFromEvent() = %+v, %v", received, ok)
+	}
+
+	var decoded RunCommandArgs
+	if err := received.DecodeArgs(&decoded); err != nil {
+		t.Fatalf("DecodeArgs() error = %v", err)
+	}
+	if !reflect.DeepEqual(decoded, args) {
+		t.Errorf("decoded %+v, want %+v", decoded, args)
+	}
+	if err := received.DecodeArgs(&FocusPaneArgs{}); err == nil {
+		t.Error("DecodeArgs() into another action's arguments succeeded")
+	}
+}
@@ -10,20 +10,63 @@ import (
 type UpdateType string
 
 const (
-	SessionChanged    UpdateType = "session_changed"
-	SessionAdded      UpdateType = "session_added"
-	SessionDeleted    UpdateType = "session_deleted"
-	SessionUpdated    UpdateType = "session_updated"
-	MessageAdded      UpdateType = "message_added"
-	MessageUpdated    UpdateType = "message_updated"
-	MessageDeleted    UpdateType = "message_deleted"
-	MessagesCleared   UpdateType = "messages_cleared"
-	InputUpdated      UpdateType = "input_updated"
-	CursorMoved       UpdateType = "cursor_moved"
-	ThemeChanged      UpdateType = "theme_changed"
-	ModelChanged      UpdateType = "model_changed"
-	AgentChanged      UpdateType = "agent_changed"
-	UIActionTriggered UpdateType = "ui_action_triggered"
+	SessionChanged          UpdateType = "session_changed"
+	SessionAdded            UpdateType = "session_added"
+	SessionDeleted          UpdateType = "session_deleted"
+	SessionUpdated          UpdateType = "session_updated"
+	MessageAdded            UpdateType = "message_added"
+	MessageUpdated          UpdateType = "message_updated"
+	MessageDeleted          UpdateType = "message_deleted"
+	MessageRedacted         UpdateType = "message_redacted"
+	MessageAttributed       UpdateType = "message_attributed"
+	MessagesCleared         UpdateType = "messages_cleared"
+	InputUpdated            UpdateType = "input_updated"
+	CursorMoved             UpdateType = "cursor_moved"
+	ThemeChanged            UpdateType = "theme_changed"
+	ModelChanged            UpdateType = "model_changed"
+	AgentChanged            UpdateType = "agent_changed"
+	AgentModelCleared       UpdateType = "agent_model_cleared"
+	UIActionTriggered       UpdateType = "ui_action_triggered"
+	AnnotationAdded         UpdateType = "annotation_added"
+	AnnotationUpdated       UpdateType = "annotation_updated"
+	AnnotationRemoved       UpdateType = "annotation_removed"
+	SessionLocked           UpdateType = "session_locked"
+	SessionUnlocked         UpdateType = "session_unlocked"
+	StateCompacted          UpdateType = "state_compacted"
+	PromptSubmitted         UpdateType = "prompt_submitted"
+	GitStatusChanged        UpdateType = "git_status_changed"
+	FileDiffReady           UpdateType = "file_diff_ready"
+	FileDiffResolved        UpdateType = "file_diff_resolved"
+	FileTreeChanged         UpdateType = "file_tree_changed"
+	TerminalRunStarted      UpdateType = "terminal_run_started"
+	TerminalRunFinished     UpdateType = "terminal_run_finished"
+	InputLocationChanged    UpdateType = "input_location_changed"
+	PromptContextUpdated    UpdateType = "prompt_context_updated"
+	RunStarted              UpdateType = "run_started"
+	RunFinished             UpdateType = "run_finished"
+	CancelRun               UpdateType = "cancel_run"
+	RunAttempted            UpdateType = "run_attempted"
+	ModelPolicyChanged      UpdateType = "model_policy_changed"
+	AgentRoutesChanged      UpdateType = "agent_routes_changed"
+	ContextUsageUpdated     UpdateType = "context_usage_updated"
+	ContextThreshold        UpdateType = "context_threshold"
+	SessionCompacted        UpdateType = "session_compacted"
+	ConnectivityChanged     UpdateType = "connectivity_changed"
+	SessionOrderChanged     UpdateType = "session_order_changed"
+	SessionReordered        UpdateType = "session_reordered"
+	SessionPinned           UpdateType = "session_pinned"
+	WorkspaceChanged        UpdateType = "workspace_changed"
+	PromptQueued            UpdateType = "prompt_queued"
+	PromptDequeued          UpdateType = "prompt_dequeued"
+	PromptQueueReordered    UpdateType = "prompt_queue_reordered"
+	PromptScheduled         UpdateType = "prompt_scheduled"
+	PromptUnscheduled       UpdateType = "prompt_unscheduled"
+	ScheduledPromptRan      UpdateType = "scheduled_prompt_ran"
+	SessionTemplatesChanged UpdateType = "session_templates_changed"
+	ThreadCollapsed         UpdateType = "thread_collapsed"
+	CodeBlocksExtracted     UpdateType = "code_blocks_extracted"
+	CodeBlockHandled        UpdateType = "code_block_handled"
+	StateBatched            UpdateType = "state_batched"
 )
 
 // StateUpdate represents an atomic state change operation
@@ -34,6 +77,21 @@ type StateUpdate struct {
 	Payload         interface{} `json:"payload"`
 	SourcePanel     string      `json:"source_panel"`
 	Timestamp       time.Time   `json:"timestamp"`
+	// Clock is the writer's vector clock including this update; when set it
+	// replaces ExpectedVersion for conflict detection
+	Clock VectorClock `json:"clock,omitempty"`
+	// TraceParent is the W3C trace context of the span that sent the update
+	TraceParent string `json:"trace_parent,omitempty"`
+	// ConfirmationToken confirms a destructive update the server asked to
+	// have confirmed; it must repeat the original update's type and payload
+	ConfirmationToken string `json:"confirmation_token,omitempty"`
+}
+
+// ConfirmableUpdates are the destructive updates that can be required to be
+// confirmed before they apply
+var ConfirmableUpdates = map[UpdateType]bool{
+	SessionDeleted:  true,
+	MessagesCleared: true,
 }
 
 // Update payload structures for different types of updates
@@ -60,6 +118,32 @@ type SessionDeletePayload struct {
 	SessionID string `json:"session_id"`
 }
 
+// SessionOrderPayload replaces how the sessions list is ordered
+type SessionOrderPayload struct {
+	Order SessionOrder `json:"order"`
+}
+
+// SessionReorderPayload moves a session directly before or after another in
+// the order the list is shown in, and switches the list to manual order.
+// Exactly one of Before and After is set.
+type SessionReorderPayload struct {
+	SessionID string `json:"session_id"`
+	Before    string `json:"before,omitempty"`
+	After     string `json:"after,omitempty"`
+}
+
+// SessionPinPayload pins a session to the top of the list or unpins it
+type SessionPinPayload struct {
+	SessionID string `json:"session_id"`
+	Pinned    bool   `json:"pinned"`
+}
+
+// WorkspacePayload sets the orchestrator's workspace and tmux session
+type WorkspacePayload struct {
+	Workspace   string `json:"workspace"`
+	TmuxSession string `json:"tmux_session,omitempty"`
+}
+
 // MessageAddPayload represents adding a new message
 type MessageAddPayload struct {
 	Message MessageInfo `json:"message"`
@@ -71,6 +155,11 @@ type MessageUpdatePayload struct {
 	Content   string               `json:"content,omitempty"`
 	Status    string               `json:"status,omitempty"`
 	Parts     []opencode.PartUnion `json:"parts,omitempty"`
+	BodyRef   string               `json:"body_ref,omitempty"`  // Replaces Content with a stored blob
+	BodySize  int                  `json:"body_size,omitempty"` // Length of the body behind BodyRef
+	PartsRef  string               `json:"parts_ref,omitempty"` // Replaces Parts with a stored blob
+	Truncated bool                 `json:"truncated,omitempty"` // Content is a preview of the body behind BodyRef
+	Meta      *ContentMeta         `json:"meta,omitempty"`      // Describes the new body; set by the state server
 }
 
 // MessageDeletePayload represents deleting a message
@@ -78,6 +167,19 @@ type MessageDeletePayload struct {
 	MessageID string `json:"message_id"`
 }
 
+// MessageAttributionPayload records which agent answered with a message
+type MessageAttributionPayload struct {
+	MessageID string `json:"message_id"`
+	Agent     string `json:"agent"`
+}
+
+// MessageRedactPayload represents redacting ranges of a message's content
+type MessageRedactPayload struct {
+	MessageID string           `json:"message_id"`
+	Ranges    []RedactionRange `json:"ranges"`
+	Reason    string           `json:"reason,omitempty"`
+}
+
 // MessagesClearPayload represents clearing all messages in a session
 type MessagesClearPayload struct {
 	SessionID string `json:"session_id"`
@@ -104,23 +206,84 @@ type ThemeChangePayload struct {
 	Theme string `json:"theme"`
 }
 
-// ModelChangePayload represents model selection changes
+// ModelChangePayload represents model selection changes. The model becomes the
+// default of Agent, or of the current agent when Agent is empty.
 type ModelChangePayload struct {
 	Provider string `json:"provider"`
 	Model    string `json:"model"`
+	Agent    string `json:"agent,omitempty"`
 }
 
-// AgentChangePayload represents agent selection changes
+// AgentChangePayload represents agent selection changes. Provider and Model
+// are filled in with the agent's default model when it has one.
 type AgentChangePayload struct {
+	Agent    string `json:"agent"`
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// AgentModelClearPayload forgets an agent's default model
+type AgentModelClearPayload struct {
 	Agent string `json:"agent"`
 }
 
 // UIActionPayload represents UI action triggers
 type UIActionPayload struct {
-	Action string                 `json:"action"`
+	Action UIAction               `json:"action"`
 	Data   map[string]interface{} `json:"data,omitempty"`
 }
 
+// PromptSubmitPayload records a prompt sent to the opencode server; it changes
+// no state but lets the submission be audited and recorded into macros
+type PromptSubmitPayload struct {
+	SessionID string   `json:"session_id"`
+	Text      string   `json:"text"`
+	Files     []string `json:"files,omitempty"` // Files attached from the file tree
+}
+
+// AnnotationAddPayload represents attaching an annotation to a message
+type AnnotationAddPayload struct {
+	Annotation MessageAnnotation `json:"annotation"`
+}
+
+// AnnotationUpdatePayload represents editing an existing annotation
+type AnnotationUpdatePayload struct {
+	AnnotationID string `json:"annotation_id"`
+	Content      string `json:"content,omitempty"`
+	Rating       *int   `json:"rating,omitempty"` // nil leaves the rating unchanged
+	Done         *bool  `json:"done,omitempty"`   // nil leaves the flag unchanged
+}
+
+// AnnotationRemovePayload represents removing an annotation
+type AnnotationRemovePayload struct {
+	AnnotationID string `json:"annotation_id"`
+}
+
+// SessionLockPayload represents acquiring or renewing a session lock
+type SessionLockPayload struct {
+	SessionID  string `json:"session_id"`
+	Operation  string `json:"operation,omitempty"`
+	TTLSeconds int    `json:"ttl_seconds,omitempty"` // 0 uses the default TTL
+	// Lock is filled in when the lock is granted, so the broadcast carries the holder and expiry
+	Lock *SessionLock `json:"lock,omitempty"`
+}
+
+// SessionUnlockPayload represents releasing a session lock. Only the owner may
+// release an unexpired lock unless Force is set.
+type SessionUnlockPayload struct {
+	SessionID string `json:"session_id"`
+	Force     bool   `json:"force,omitempty"`
+}
+
+// StateCompactPayload represents compacting an oversized state: pruning messages
+// beyond the retention policy and offloading bodies above a lowered threshold
+type StateCompactPayload struct {
+	MessageIDs       []string `json:"message_ids,omitempty"`       // Messages pruned by the retention policy
+	OffloadThreshold int      `json:"offload_threshold,omitempty"` // 0 skips offloading
+	Offloaded        int      `json:"offloaded,omitempty"`         // Filled in when applied
+	Reason           string   `json:"reason,omitempty"`
+}
+
 // Event payload structures
 
 // PanelConnectionPayload represents panel connection/disconnection events
@@ -129,7 +292,335 @@ type PanelConnectionPayload struct {
 	PanelType string `json:"panel_type"`
 }
 
+// ShutdownPayload is the last event a subscriber receives before its event
+// channel is closed
+type ShutdownPayload struct {
+	Reason string `json:"reason"`
+}
+
+// ConfirmationRequiredPayload announces a destructive update waiting for its
+// sender to confirm it. The token itself goes only to the sender.
+type ConfirmationRequiredPayload struct {
+	Operation   UpdateType `json:"operation"`
+	SourcePanel string     `json:"source_panel"`
+	SessionID   string     `json:"session_id,omitempty"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+}
+
+// Storage quota levels reported in StorageQuotaPayload
+const (
+	QuotaOK       = "ok"
+	QuotaWarning  = "warning"
+	QuotaExceeded = "exceeded"
+)
+
+// StorageQuotaPayload reports the state file approaching or exceeding its size
+// quota, so panels can warn the user before saves start failing
+type StorageQuotaPayload struct {
+	Level     string `json:"level"`
+	StateSize int64  `json:"state_size"`
+	MaxSize   int64  `json:"max_size"`
+	// Compacting is set when automatic compaction has been started
+	Compacting bool `json:"compacting,omitempty"`
+}
+
+// StorageHealthPayload reports saves pausing because the disk is full and
+// resuming once space is available again
+type StorageHealthPayload struct {
+	Degraded  bool      `json:"degraded"`
+	Reason    string    `json:"reason,omitempty"`
+	Needed    uint64    `json:"needed,omitempty"`
+	Available uint64    `json:"available,omitempty"`
+	Since     time.Time `json:"since,omitempty"`
+}
+
+// CrashReportPayload announces a crash bundle written after a panel crashed
+// or state was found corrupt
+type CrashReportPayload struct {
+	Kind      string    `json:"kind"`    // What triggered the bundle: "panel_crash" or "state_corruption"
+	Subject   string    `json:"subject"` // The panel, or the state file or backups
+	Detail    string    `json:"detail,omitempty"`
+	Path      string    `json:"path"` // The bundle archive
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InternalErrorPayload reports a panic the orchestrator recovered from. The
+// component kept running; the stack is in the orchestrator log.
+type InternalErrorPayload struct {
+	Component string `json:"component"` // e.g. "save_worker" or "ipc_handler"
+	Error     string `json:"error"`
+	Context   string `json:"context,omitempty"` // What was being handled, such as a message type
+}
+
+// GitStatusPayload replaces the workspace repository status; a nil Git means
+// the workspace is not a repository
+type GitStatusPayload struct {
+	Git *GitState `json:"git"`
+}
+
+// FileDiffReadyPayload adds the file changes of a tool call, replacing an
+// earlier diff with the same ID
+type FileDiffReadyPayload struct {
+	Diff FileDiffSet `json:"diff"`
+}
+
+// FileDiffResolvedPayload records the outcome of accepting or reverting a diff
+type FileDiffResolvedPayload struct {
+	DiffID string `json:"diff_id"`
+	Status string `json:"status"`          // FileDiffAccepted or FileDiffReverted; unchanged when Error is set
+	Error  string `json:"error,omitempty"` // Why the action failed
+}
+
+// File tree actions
+const (
+	FileTreeSetRoots      = "set_roots"
+	FileTreeExpand        = "expand"
+	FileTreeCollapse      = "collapse"
+	FileTreeSelect        = "select"
+	FileTreeAttach        = "attach"
+	FileTreeDetach        = "detach"
+	FileTreeClearAttached = "clear_attached"
+)
+
+// FileTreeUpdatePayload changes the file browser state; Roots is used by
+// set_roots and Path, an absolute path inside the roots, by the others
+type FileTreeUpdatePayload struct {
+	Action string   `json:"action"`
+	Path   string   `json:"path,omitempty"`
+	Roots  []string `json:"roots,omitempty"`
+}
+
+// TerminalRunStartedPayload records a command started in a terminal pane
+type TerminalRunStartedPayload struct {
+	Run TerminalRun `json:"run"`
+}
+
+// TerminalRunFinishedPayload records how a terminal run ended; the run failed
+// when Error is set or the exit code is not zero
+type TerminalRunFinishedPayload struct {
+	RunID      string    `json:"run_id"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// InputLocationPayload attaches a code location to the input; nil detaches it.
+// Changing the location drops the prompt context gathered for the old one.
+type InputLocationPayload struct {
+	Location *CodeLocation `json:"location"`
+}
+
+// PromptContextPayload stores the context gathered for the attached location
+type PromptContextPayload struct {
+	Context PromptContext `json:"context"`
+}
+
+// RunStartedPayload records an assistant run put in flight
+type RunStartedPayload struct {
+	Run AgentRun `json:"run"`
+}
+
+// RunFinishedPayload records the end of a run; it failed when Error is set
+type RunFinishedPayload struct {
+	RunID           string    `json:"run_id"`
+	ParentMessageID string    `json:"parent_message_id,omitempty"`
+	MessageID       string    `json:"message_id,omitempty"`
+	Error           string    `json:"error,omitempty"`
+	FinishedAt      time.Time `json:"finished_at"`
+}
+
+// PromptQueuedPayload adds a prompt to the end of the queue. A prompt already
+// queued under the same ID keeps its place and has its text replaced.
+type PromptQueuedPayload struct {
+	Prompt QueuedPrompt `json:"prompt"`
+}
+
+// PromptDequeuedPayload removes a prompt from the queue; Reason is one of the
+// Dequeue reasons
+type PromptDequeuedPayload struct {
+	PromptID string `json:"prompt_id"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PromptQueueReorderPayload moves a queued prompt directly before or after
+// another of its session. Exactly one of Before and After is set.
+type PromptQueueReorderPayload struct {
+	PromptID string `json:"prompt_id"`
+	Before   string `json:"before,omitempty"`
+	After    string `json:"after,omitempty"`
+}
+
+// PromptSchedulePayload stores a scheduled prompt, replacing the one with the
+// same ID
+type PromptSchedulePayload struct {
+	Schedule ScheduledPrompt `json:"schedule"`
+}
+
+// PromptUnschedulePayload deletes a scheduled prompt
+type PromptUnschedulePayload struct {
+	ScheduleID string `json:"schedule_id"`
+}
+
+// ScheduledPromptRanPayload records that a scheduled prompt was queued at
+// RanAt. The schedule moves on to its next run, or is deleted when it runs
+// once; a prompt not yet due is rejected, so it only runs once per time.
+type ScheduledPromptRanPayload struct {
+	ScheduleID string    `json:"schedule_id"`
+	SessionID  string    `json:"session_id"` // Session the prompt was queued for
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// ThreadCollapsePayload collapses or expands message threads in message
+// panels, by the IDs of the messages starting them
+type ThreadCollapsePayload struct {
+	MessageIDs []string `json:"message_ids"`
+	Collapsed  bool     `json:"collapsed"`
+}
+
+// CodeBlocksPayload stores the code blocks extracted from a message,
+// replacing any extracted before
+type CodeBlocksPayload struct {
+	MessageID string      `json:"message_id"`
+	Blocks    []CodeBlock `json:"blocks"`
+}
+
+// CodeBlockHandledPayload reports how a copy, save or open action on a code
+// block went; Error is set when it failed
+type CodeBlockHandledPayload struct {
+	MessageID string   `json:"message_id"`
+	Index     int      `json:"index"`
+	Action    UIAction `json:"action"`
+	Path      string   `json:"path,omitempty"` // File the block was saved to
+	Error     string   `json:"error,omitempty"`
+}
+
+// SessionTemplatesPayload replaces the session templates
+type SessionTemplatesPayload struct {
+	Templates []SessionTemplate `json:"templates"`
+}
+
+// RunAttemptedPayload records the end of one attempt of a run
+type RunAttemptedPayload struct {
+	RunID   string     `json:"run_id"`
+	Attempt RunAttempt `json:"attempt"`
+}
+
+// ModelPolicyPayload replaces the model policy; nil clears it
+type ModelPolicyPayload struct {
+	Policy *ModelPolicy `json:"policy"`
+}
+
+// AgentRoutesPayload replaces the agents prompts are routed to by mention
+type AgentRoutesPayload struct {
+	Routes map[string]string `json:"routes"`
+}
+
+// ContextUsagePayload replaces the context window usage; the level is derived
+// from the tokens and limit
+type ContextUsagePayload struct {
+	Usage ContextUsage `json:"usage"`
+}
+
+// ContextThresholdPayload announces that usage rose to a warning level, so
+// panels can warn before a request gets truncated
+type ContextThresholdPayload struct {
+	Usage ContextUsage `json:"usage"`
+}
+
+// SessionCompactedPayload replaces the archived messages of a compaction with
+// its summary. Only the listed messages still in the session are archived.
+type SessionCompactedPayload struct {
+	Compaction SessionCompaction `json:"compaction"`
+	Summary    MessageInfo       `json:"summary"`
+}
+
+// ConnectivityChangedPayload replaces the link health and lists the links
+// whose status changed since the last report
+type ConnectivityChangedPayload struct {
+	Connection  ConnectionState  `json:"connection"`
+	Transitions []LinkTransition `json:"transitions,omitempty"`
+}
+
+// CancelRunPayload asks to cancel a run, by run ID or by a message of it: the
+// assistant reply, or any message of the session the run is answering in
+type CancelRunPayload struct {
+	RunID     string `json:"run_id,omitempty"`
+	MessageID string `json:"message_id,omitempty"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+// RunCancelledPayload is what a CancelRun update resolved to, carried by
+// EventRunCancelled. The owner cancels the request registered under
+// CancelToken, the orchestrator aborts the session on the opencode server and
+// panels mark the messages cancelled. RunID is empty when the generation was
+// not started from here, such as a prompt sent from another opencode client.
+type RunCancelledPayload struct {
+	RunID       string    `json:"run_id,omitempty"`
+	SessionID   string    `json:"session_id"`
+	CancelToken string    `json:"cancel_token,omitempty"`
+	MessageIDs  []string  `json:"message_ids,omitempty"` // Replies whose status became cancelled
+	Reason      string    `json:"reason,omitempty"`
+	FinishedAt  time.Time `json:"finished_at"`
+}
+
+// ConfigChangedPayload reports settings changed on a running component
+type ConfigChangedPayload struct {
+	Component string                 `json:"component"`
+	Changed   []string               `json:"changed"` // Setting names as they appear in Config
+	Config    map[string]interface{} `json:"config"`
+}
+
+// SecretFinding describes one suspected secret detected in update content.
+// Only the rule name and rune offsets are reported, never the matched text.
+type SecretFinding struct {
+	Rule  string `json:"rule"`
+	Field string `json:"field"`
+	Start int    `json:"start"`
+	End   int    `json:"end"`
+}
+
+// SecurityAlertPayload represents a security alert raised while applying an update
+type SecurityAlertPayload struct {
+	UpdateID    string          `json:"update_id"`
+	UpdateType  UpdateType      `json:"update_type"`
+	MessageID   string          `json:"message_id,omitempty"`
+	SessionID   string          `json:"session_id,omitempty"`
+	Findings    []SecretFinding `json:"findings"`
+	Action      string          `json:"action"` // "flagged" or "blocked"
+	SourcePanel string          `json:"source_panel"`
+}
+
+// SnapshotUpdatedPayload announces a new shared-memory state snapshot
+type SnapshotUpdatedPayload struct {
+	Path         string `json:"path"`
+	Sequence     uint64 `json:"sequence"`
+	StateVersion int64  `json:"state_version"`
+	Size         uint64 `json:"size"`
+}
+
 // StateSyncPayload represents full state synchronization events
 type StateSyncPayload struct {
 	State *SharedApplicationState `json:"state"`
+	// Sections of the panel's view found to differ from State, see
+	// StateChecksums; such a sync may be at the version the panel is at
+	Sections []string `json:"sections,omitempty"`
+}
+
+// StateBatchPayload carries the updates applied together under one version,
+// as the events each would have broadcast on its own, in the order applied
+type StateBatchPayload struct {
+	Events []StateEvent `json:"events"`
+}
+
+// BatchPosition places an event within the batch it was applied in, for
+// subscribers that are sent a batch's events one at a time
+type BatchPosition struct {
+	ID    string `json:"id"` // ID of the batch event
+	Index int    `json:"index"`
+	Size  int    `json:"size"`
+}
+
+// Last reports whether the event ends its batch, so the state is consistent
+func (p *BatchPosition) Last() bool {
+	return p == nil || p.Index == p.Size-1
 }
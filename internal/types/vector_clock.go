@@ -0,0 +1,100 @@
+package types
+
+// VectorClock maps writer IDs to the number of updates observed from each.
+// A nil clock means vector versioning is not in use.
+type VectorClock map[string]int64
+
+// ClockRelation describes the causal ordering of two vector clocks
+type ClockRelation int
+
+const (
+	ClockEqual      ClockRelation = iota // Both clocks have seen exactly the same updates
+	ClockBefore                          // Receiver happened before the argument
+	ClockAfter                           // Receiver happened after the argument
+	ClockConcurrent                      // Neither has seen all of the other's updates
+)
+
+func (r ClockRelation) String() string {
+	switch r {
+	case ClockEqual:
+		return "equal"
+	case ClockBefore:
+		return "before"
+	case ClockAfter:
+		return "after"
+	default:
+		return "concurrent"
+	}
+}
+
+// Clone returns an independent copy of the clock
+func (vc VectorClock) Clone() VectorClock {
+	if vc == nil {
+		return nil
+	}
+	clone := make(VectorClock, len(vc))
+	for node, counter := range vc {
+		clone[node] = counter
+	}
+	return clone
+}
+
+// Increment returns a copy of the clock with node's counter advanced by one
+func (vc VectorClock) Increment(node string) VectorClock {
+	next := vc.Clone()
+	if next == nil {
+		next = make(VectorClock)
+	}
+	next[node]++
+	return next
+}
+
+// Merge returns the element-wise maximum of both clocks
+func (vc VectorClock) Merge(other VectorClock) VectorClock {
+	merged := vc.Clone()
+	if merged == nil {
+		merged = make(VectorClock, len(other))
+	}
+	for node, counter := range other {
+		if counter > merged[node] {
+			merged[node] = counter
+		}
+	}
+	return merged
+}
+
+// Compare reports the causal relation of vc to other
+func (vc VectorClock) Compare(other VectorClock) ClockRelation {
+	less, greater := false, false
+
+	for node, counter := range vc {
+		switch theirs := other[node]; {
+		case counter < theirs:
+			less = true
+		case counter > theirs:
+			greater = true
+		}
+	}
+	for node, theirs := range other {
+		if _, seen := vc[node]; !seen && theirs > 0 {
+			less = true
+		}
+	}
+
+	switch {
+	case less && greater:
+		return ClockConcurrent
+	case less:
+		return ClockBefore
+	case greater:
+		return ClockAfter
+	default:
+		return ClockEqual
+	}
+}
+
+// Descends reports whether vc has seen every update other has
+func (vc VectorClock) Descends(other VectorClock) bool {
+	relation := vc.Compare(other)
+	return relation == ClockAfter || relation == ClockEqual
+}
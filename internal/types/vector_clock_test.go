@@ -0,0 +1,41 @@
+package types
+
+import "testing"
+
+func TestVectorClockCompare(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b VectorClock
+		want ClockRelation
+	}{
+		{"both empty", nil, VectorClock{}, ClockEqual},
+		{"same counters", VectorClock{"a": 1, "b": 2}, VectorClock{"a": 1, "b": 2}, ClockEqual},
+		{"behind on one node", VectorClock{"a": 1}, VectorClock{"a": 2}, ClockBefore},
+		{"missing node", VectorClock{"a": 1}, VectorClock{"a": 1, "b": 1}, ClockBefore},
+		{"ahead", VectorClock{"a": 3, "b": 1}, VectorClock{"a": 2}, ClockAfter},
+		{"concurrent", VectorClock{"a": 2, "b": 1}, VectorClock{"a": 1, "b": 2}, ClockConcurrent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.a.Compare(tt.b); got != tt.want {
+				t.Errorf("Compare() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVectorClockMergeAndIncrement(t *testing.T) {
+	a := VectorClock{"a": 2, "b": 1}
+	b := VectorClock{"a": 1, "b": 3, "c": 1}
+
+	merged := a.Merge(b)
+	if !merged.Descends(a) || !merged.Descends(b) {
+		t.Fatalf("merged clock %v should descend from both inputs", merged)
+	}
+
+	next := merged.Increment("a")
+	if next.Compare(merged) != ClockAfter || merged["a"] != 2 {
+		t.Errorf("Increment() should return a later copy without touching the receiver")
+	}
+}
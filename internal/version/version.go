@@ -0,0 +1,74 @@
+// Package version identifies the build of each binary and decides whether a
+// panel built from one release can work with an orchestrator built from
+// another. Both sides send their build and IPC protocol in the handshake;
+// after an upgrade the panels still running the old binary show up as
+// mismatched until they are restarted.
+package version
+
+import "strings"
+
+// Build is the version of this binary, set at build time with
+// -ldflags "-X github.com/opencode/tmux_coder/internal/version.Build=v2.1.0"
+var Build = "dev"
+
+// Protocol is the IPC protocol this binary speaks. It changes only when
+// messages change in a way older peers cannot read.
+const Protocol = "1.0"
+
+// Compatibility says how a panel's build relates to the orchestrator's
+type Compatibility string
+
+const (
+	// Match means both run the same release
+	Match Compatibility = "match"
+	// Compatible means the releases differ but speak protocols that work
+	// together; restarting the panel picks up the newer binary
+	Compatible Compatibility = "compatible"
+	// Incompatible means the protocols cannot work together and the panel is refused
+	Incompatible Compatibility = "incompatible"
+	// Unknown means a side is a development build or did not report its
+	// build, so whether it is current cannot be told
+	Unknown Compatibility = "unknown"
+)
+
+// protocolMatrix lists, by the protocol the orchestrator speaks, the panel
+// protocols it accepts. Panels from before builds were exchanged send 1.0.
+var protocolMatrix = map[string][]string{
+	"1.0": {"1.0"},
+}
+
+// Check compares a panel's build and protocol with the orchestrator's
+func Check(serverBuild, serverProtocol, panelBuild, panelProtocol string) Compatibility {
+	if !ProtocolSupported(serverProtocol, panelProtocol) {
+		return Incompatible
+	}
+	if !released(serverBuild) || !released(panelBuild) {
+		return Unknown
+	}
+	if serverBuild == panelBuild {
+		return Match
+	}
+	return Compatible
+}
+
+// ProtocolSupported reports whether an orchestrator speaking serverProtocol
+// accepts panels speaking panelProtocol. Custom panels that send no protocol
+// are taken to speak the first one.
+func ProtocolSupported(serverProtocol, panelProtocol string) bool {
+	if panelProtocol == "" {
+		panelProtocol = "1.0"
+	}
+	for _, accepted := range protocolMatrix[serverProtocol] {
+		if accepted == panelProtocol {
+			return true
+		}
+	}
+	return false
+}
+
+// released reports whether build names a release rather than a development
+// build, which every local compile shares
+func released(build string) bool {
+	build = strings.TrimSpace(build)
+	return build != "" && build != "dev" && !strings.HasSuffix(build, "-dirty")
+}
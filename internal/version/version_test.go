@@ -0,0 +1,28 @@
+package version
+
+import "testing"
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name                        string
+		serverBuild, serverProtocol string
+		panelBuild, panelProtocol   string
+		want                        Compatibility
+	}{
+		{"same release", "v2.1.0", "1.0", "v2.1.0", "1.0", Match},
+		{"older panel", "v2.1.0", "1.0", "v2.0.3", "1.0", Compatible},
+		{"panel without build", "v2.1.0", "1.0", "", "1.0", Unknown},
+		{"development server", "dev", "1.0", "v2.1.0", "1.0", Unknown},
+		{"dirty build", "v2.1.0-dirty", "1.0", "v2.1.0-dirty", "1.0", Unknown},
+		{"panel without protocol", "v2.1.0", "1.0", "v2.1.0", "", Match},
+		{"unknown panel protocol", "v2.1.0", "1.0", "v3.0.0", "2.0", Incompatible},
+		{"unknown server protocol", "v3.0.0", "9.9", "v2.1.0", "1.0", Incompatible},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Check(tt.serverBuild, tt.serverProtocol, tt.panelBuild, tt.panelProtocol); got != tt.want {
+				t.Errorf("Check() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,410 @@
+// Package webhook POSTs selected state events to external URLs.
+//
+// Each delivery is a JSON Notification. When an endpoint has a secret the body
+// is signed with HMAC-SHA256 and the hex digest sent as
+// "X-TmuxCoder-Signature: sha256=<digest>". Failed deliveries are retried with
+// exponential backoff; 4xx responses other than 408 and 429 are not retried.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+// Webhook event names
+const (
+	EventMessageCompleted = "message.completed"
+	EventSessionCreated   = "session.created"
+	EventSessionDeleted   = "session.deleted"
+	EventHealthDegraded   = "health.degraded"
+	EventHealthRecovered  = "health.recovered"
+	EventSecurityAlert    = "security.alert"
+)
+
+var knownEvents = map[string]bool{
+	EventMessageCompleted: true,
+	EventSessionCreated:   true,
+	EventSessionDeleted:   true,
+	EventHealthDegraded:   true,
+	EventHealthRecovered:  true,
+	EventSecurityAlert:    true,
+}
+
+// KnownEvent reports whether name is an event endpoints can subscribe to
+func KnownEvent(name string) bool {
+	return knownEvents[name]
+}
+
+// Request headers
+const (
+	HeaderEvent     = "X-TmuxCoder-Event"
+	HeaderDelivery  = "X-TmuxCoder-Delivery"
+	HeaderSignature = "X-TmuxCoder-Signature"
+)
+
+// queueSize bounds the notifications waiting for one endpoint
+const queueSize = 256
+
+// Endpoint is one webhook receiver
+type Endpoint struct {
+	Name   string
+	URL    string
+	Events []string // Event names delivered; empty delivers every event
+	Secret string   // HMAC key; empty sends unsigned requests
+}
+
+func (e Endpoint) wants(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, name := range e.Events {
+		if name == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Options control delivery
+type Options struct {
+	Timeout     time.Duration // Per-attempt request timeout
+	MaxAttempts int           // Attempts per notification, including the first
+	Backoff     time.Duration // Delay before the first retry; doubles after each
+	Session     string        // tmux session name included in notifications
+	Client      *http.Client  // Defaults to a client with Timeout
+}
+
+// DefaultOptions returns the delivery settings used when none are configured
+func DefaultOptions() Options {
+	return Options{
+		Timeout:     10 * time.Second,
+		MaxAttempts: 5,
+		Backoff:     time.Second,
+	}
+}
+
+// Notification is the JSON body of a delivery
+type Notification struct {
+	ID        string      `json:"id"`
+	Event     string      `json:"event"`
+	Session   string      `json:"session,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data"`
+}
+
+// Stats counts deliveries to one endpoint
+type Stats struct {
+	Name      string    `json:"name"`
+	Delivered int64     `json:"delivered"`
+	Failed    int64     `json:"failed"`  // Notifications dropped after the last attempt
+	Dropped   int64     `json:"dropped"` // Notifications dropped because the queue was full
+	LastError string    `json:"last_error,omitempty"`
+	LastAt    time.Time `json:"last_at,omitempty"`
+}
+
+type target struct {
+	endpoint Endpoint
+	queue    chan Notification
+
+	mutex sync.Mutex
+	stats Stats
+}
+
+// Dispatcher turns state events into notifications and delivers them
+type Dispatcher struct {
+	targets []*target
+	opts    Options
+	lookup  func(messageID string) (types.MessageInfo, bool)
+
+	// Messages already reported complete; status updates repeat while parts stream in
+	completedMutex sync.Mutex
+	completed      map[string]bool
+}
+
+// NewDispatcher returns a dispatcher for endpoints. lookup resolves message IDs
+// for message.completed notifications and may be nil.
+func NewDispatcher(endpoints []Endpoint, opts Options, lookup func(messageID string) (types.MessageInfo, bool)) *Dispatcher {
+	defaults := DefaultOptions()
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaults.Timeout
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = defaults.MaxAttempts
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = defaults.Backoff
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: opts.Timeout}
+	}
+
+	d := &Dispatcher{opts: opts, lookup: lookup, completed: make(map[string]bool)}
+	for _, endpoint := range endpoints {
+		d.targets = append(d.targets, &target{
+			endpoint: endpoint,
+			queue:    make(chan Notification, queueSize),
+			stats:    Stats{Name: endpoint.Name},
+		})
+	}
+	return d
+}
+
+// Run delivers notifications for events until the channel closes or ctx is cancelled
+func (d *Dispatcher) Run(ctx context.Context, events <-chan types.StateEvent) {
+	var wg sync.WaitGroup
+	for _, t := range d.targets {
+		wg.Add(1)
+		go func(t *target) {
+			defer wg.Done()
+			d.deliverLoop(ctx, t)
+		}(t)
+	}
+	defer wg.Wait()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-events:
+			if !ok {
+				log.Printf("Webhooks: event subscription closed, notifications stopped")
+				return
+			}
+			d.Notify(event)
+		}
+	}
+}
+
+// Notify queues a notification for every endpoint subscribed to the event.
+// Events that map to no webhook event are ignored.
+func (d *Dispatcher) Notify(event types.StateEvent) {
+	name, data, ok := d.translate(event)
+	if !ok {
+		return
+	}
+	notification := Notification{
+		ID:        event.ID,
+		Event:     name,
+		Session:   d.opts.Session,
+		Timestamp: event.Timestamp,
+		Data:      data,
+	}
+	if notification.Timestamp.IsZero() {
+		notification.Timestamp = time.Now()
+	}
+
+	for _, t := range d.targets {
+		if !t.endpoint.wants(name) {
+			continue
+		}
+		select {
+		case t.queue <- notification:
+		default:
+			t.mutex.Lock()
+			t.stats.Dropped++
+			t.mutex.Unlock()
+			log.Printf("Webhook %s: queue full, dropping %s notification %s", t.endpoint.Name, name, notification.ID)
+		}
+	}
+}
+
+// Stats returns delivery counters per endpoint
+func (d *Dispatcher) Stats() []Stats {
+	stats := make([]Stats, 0, len(d.targets))
+	for _, t := range d.targets {
+		t.mutex.Lock()
+		stats = append(stats, t.stats)
+		t.mutex.Unlock()
+	}
+	return stats
+}
+
+// translate maps a state event to a webhook event name and payload
+func (d *Dispatcher) translate(event types.StateEvent) (string, interface{}, bool) {
+	switch event.Type {
+	case types.EventSessionAdded:
+		var payload types.SessionAddPayload
+		if decode(event.Data, &payload) != nil {
+			return "", nil, false
+		}
+		return EventSessionCreated, payload.Session, true
+
+	case types.EventSessionDeleted:
+		var payload types.SessionDeletePayload
+		if decode(event.Data, &payload) != nil {
+			return "", nil, false
+		}
+		return EventSessionDeleted, payload, true
+
+	case types.EventMessageAdded, types.EventMessageUpdated:
+		var message types.MessageInfo
+		if event.Type == types.EventMessageAdded {
+			var payload types.MessageAddPayload
+			if decode(event.Data, &payload) != nil {
+				return "", nil, false
+			}
+			message = payload.Message
+		} else {
+			var payload types.MessageUpdatePayload
+			if decode(event.Data, &payload) != nil || payload.Status == "" {
+				return "", nil, false
+			}
+			message = types.MessageInfo{ID: payload.MessageID, Status: payload.Status}
+			if d.lookup != nil {
+				if stored, ok := d.lookup(payload.MessageID); ok {
+					message = stored
+					message.Status = payload.Status
+				}
+			}
+		}
+		if message.Status != "completed" || !d.markCompleted(message.ID) {
+			return "", nil, false
+		}
+		// Streamed parts can be large; receivers get the text and fetch the rest if needed
+		message.Parts, message.Native = nil, nil
+		return EventMessageCompleted, message, true
+
+	case types.EventStorageHealth:
+		var payload types.StorageHealthPayload
+		if decode(event.Data, &payload) != nil {
+			return "", nil, false
+		}
+		if payload.Degraded {
+			return EventHealthDegraded, map[string]interface{}{"component": "storage", "detail": payload}, true
+		}
+		return EventHealthRecovered, map[string]interface{}{"component": "storage"}, true
+
+	case types.EventSecurityAlert:
+		return EventSecurityAlert, event.Data, true
+	}
+	return "", nil, false
+}
+
+// markCompleted records that a message was reported and returns false if it already was
+func (d *Dispatcher) markCompleted(messageID string) bool {
+	d.completedMutex.Lock()
+	defer d.completedMutex.Unlock()
+	if d.completed[messageID] {
+		return false
+	}
+	// Forget old messages rather than grow without bound; a repeat is harmless
+	if len(d.completed) >= 10000 {
+		d.completed = make(map[string]bool)
+	}
+	d.completed[messageID] = true
+	return true
+}
+
+func (d *Dispatcher) deliverLoop(ctx context.Context, t *target) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case notification := <-t.queue:
+			err := d.deliver(ctx, t.endpoint, notification)
+			t.mutex.Lock()
+			t.stats.LastAt = time.Now()
+			if err != nil {
+				t.stats.Failed++
+				t.stats.LastError = err.Error()
+			} else {
+				t.stats.Delivered++
+			}
+			t.mutex.Unlock()
+			if err != nil && ctx.Err() == nil {
+				log.Printf("Webhook %s: giving up on %s notification %s: %v", t.endpoint.Name, notification.Event, notification.ID, err)
+			}
+		}
+	}
+}
+
+// deliver POSTs a notification, retrying until it is accepted or attempts run out
+func (d *Dispatcher) deliver(ctx context.Context, endpoint Endpoint, notification Notification) error {
+	body, err := json.Marshal(notification)
+	if err != nil {
+		return fmt.Errorf("encode notification: %w", err)
+	}
+
+	backoff := d.opts.Backoff
+	var lastErr error
+	for attempt := 1; attempt <= d.opts.MaxAttempts; attempt++ {
+		retry, err := d.post(ctx, endpoint, notification, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = fmt.Errorf("attempt %d: %w", attempt, err)
+		if !retry || attempt == d.opts.MaxAttempts {
+			break
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+	return lastErr
+}
+
+// post makes one delivery attempt and reports whether a failure is worth retrying
+func (d *Dispatcher) post(ctx context.Context, endpoint Endpoint, notification Notification, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "opencode-tmux-webhook")
+	req.Header.Set(HeaderEvent, notification.Event)
+	req.Header.Set(HeaderDelivery, notification.ID)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, body))
+	}
+
+	resp, err := d.opts.Client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusRequestTimeout || resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("status %s", resp.Status)
+	default:
+		return false, fmt.Errorf("status %s", resp.Status)
+	}
+}
+
+// Sign returns the signature header value for body
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// decode converts event data, which is a typed payload in process and a map
+// after a round trip, into out
+func decode(data interface{}, out interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
@@ -0,0 +1,122 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/opencode/tmux_coder/internal/types"
+)
+
+type received struct {
+	event     string
+	signature string
+	body      []byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) (*httptest.Server, func() []received) {
+	t.Helper()
+	var mutex sync.Mutex
+	var requests []received
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mutex.Lock()
+		requests = append(requests, received{event: r.Header.Get(HeaderEvent), signature: r.Header.Get(HeaderSignature), body: body})
+		status := http.StatusOK
+		if len(requests) <= len(statuses) {
+			status = statuses[len(requests)-1]
+		}
+		mutex.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, func() []received {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]received(nil), requests...)
+	}
+}
+
+func TestTranslate(t *testing.T) {
+	d := NewDispatcher(nil, Options{}, func(id string) (types.MessageInfo, bool) {
+		return types.MessageInfo{ID: id, SessionID: "ses_1", Content: "done"}, true
+	})
+
+	tests := []struct {
+		name  string
+		event types.StateEvent
+		want  string
+	}{
+		{"session added", types.StateEvent{Type: types.EventSessionAdded, Data: types.SessionAddPayload{Session: types.SessionInfo{ID: "ses_1"}}}, EventSessionCreated},
+		{"message completed", types.StateEvent{Type: types.EventMessageUpdated, Data: types.MessageUpdatePayload{MessageID: "msg_1", Status: "completed"}}, EventMessageCompleted},
+		{"repeat completion", types.StateEvent{Type: types.EventMessageUpdated, Data: map[string]interface{}{"message_id": "msg_1", "status": "completed"}}, ""},
+		{"still streaming", types.StateEvent{Type: types.EventMessageUpdated, Data: types.MessageUpdatePayload{MessageID: "msg_2", Status: "pending"}}, ""},
+		{"storage degraded", types.StateEvent{Type: types.EventStorageHealth, Data: types.StorageHealthPayload{Degraded: true}}, EventHealthDegraded},
+		{"storage recovered", types.StateEvent{Type: types.EventStorageHealth, Data: types.StorageHealthPayload{}}, EventHealthRecovered},
+		{"unrelated", types.StateEvent{Type: types.EventThemeChanged}, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			name, _, ok := d.translate(tc.event)
+			if ok != (tc.want != "") || name != tc.want {
+				t.Fatalf("translate = (%q, %v), want %q", name, ok, tc.want)
+			}
+		})
+	}
+}
+
+func TestDeliverSignsAndRetries(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusServiceUnavailable, http.StatusOK)
+	d := NewDispatcher([]Endpoint{{Name: "ci", URL: server.URL, Events: []string{EventSessionCreated}, Secret: "s3cret"}},
+		Options{Backoff: time.Millisecond, MaxAttempts: 3}, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan types.StateEvent, 2)
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx, events)
+		close(done)
+	}()
+
+	events <- types.StateEvent{ID: "evt_1", Type: types.EventSessionAdded, Data: types.SessionAddPayload{Session: types.SessionInfo{ID: "ses_1"}}}
+	events <- types.StateEvent{ID: "evt_2", Type: types.EventStorageHealth, Data: types.StorageHealthPayload{Degraded: true}}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(requests()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	got := requests()
+	if len(got) != 2 {
+		t.Fatalf("got %d requests, want a failed attempt and a retry", len(got))
+	}
+	last := got[1]
+	if last.event != EventSessionCreated || last.signature != Sign("s3cret", last.body) {
+		t.Fatalf("unexpected request: event %q signature %q", last.event, last.signature)
+	}
+	var notification Notification
+	if err := json.Unmarshal(last.body, &notification); err != nil || notification.ID != "evt_1" {
+		t.Fatalf("unexpected body %s: %v", last.body, err)
+	}
+	if stats := d.Stats(); stats[0].Delivered != 1 || stats[0].Failed != 0 {
+		t.Fatalf("unexpected stats %+v", stats[0])
+	}
+}
+
+func TestDeliverDoesNotRetryClientErrors(t *testing.T) {
+	server, requests := newReceiver(t, http.StatusBadRequest)
+	d := NewDispatcher(nil, Options{Backoff: time.Millisecond, MaxAttempts: 3}, nil)
+
+	err := d.deliver(context.Background(), Endpoint{Name: "bad", URL: server.URL}, Notification{ID: "evt_1", Event: EventSecurityAlert})
+	if err == nil || len(requests()) != 1 {
+		t.Fatalf("deliver = %v after %d requests, want one failed attempt", err, len(requests()))
+	}
+}
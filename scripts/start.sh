@@ -430,7 +430,7 @@ fi
 if [[ $SKIP_BUILD -eq 0 ]]; then
   echo "==> Building..."
   pushd "$REPO_ROOT" >/dev/null
-  for pkg in cmd/opencode-tmux cmd/opencode-sessions cmd/opencode-messages cmd/opencode-input; do
+  for pkg in cmd/opencode-tmux cmd/opencode-sessions cmd/opencode-messages cmd/opencode-input cmd/opencode-controller cmd/opencode-diff; do
     out="$REPO_ROOT/$pkg/dist/$(basename "$pkg" | sed 's/opencode-//')-pane"
     [[ "$pkg" == "cmd/opencode-tmux" ]] && out="$REPO_ROOT/$pkg/dist/opencode-tmux"
     mkdir -p "$(dirname "$out")"